@@ -0,0 +1,55 @@
+// Command apidoc regenerates internal/apidoc/docs.json from the handler,
+// service and models sources. Run it from the backend directory, or via
+// go generate ./internal/apidoc.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/new-api-tools/backend/internal/apidoc"
+)
+
+func main() {
+	root, err := moduleRoot()
+	if err != nil {
+		fail(err)
+	}
+	docs, err := apidoc.Generate(root)
+	if err != nil {
+		fail(err)
+	}
+	out, err := apidoc.Marshal(docs)
+	if err != nil {
+		fail(err)
+	}
+	path := filepath.Join(root, "internal", "apidoc", "docs.json")
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		fail(err)
+	}
+	fmt.Printf("apidoc: %d operations, %d schemas -> %s\n", len(docs.Operations), len(docs.Schemas), path)
+}
+
+// moduleRoot walks up from the working directory to the go.mod
+func moduleRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "apidoc:", err)
+	os.Exit(1)
+}
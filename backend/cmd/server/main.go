@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -61,23 +62,57 @@ func main() {
 	}
 	defer cache.Close()
 
+	// ========== 4.1 Extra New API instances (optional) ==========
+	if len(cfg.Instances) > 0 {
+		database.InitInstances(cfg)
+		for _, inst := range cfg.Instances {
+			cache.InitInstance(inst.Name, inst.RedisConnString)
+		}
+		logger.L.System(fmt.Sprintf("已注册 %d 个附加实例", len(cfg.Instances)))
+	}
+	defer database.CloseInstances()
+	defer cache.CloseInstances()
+
+	// ========== 4.2 Sweep cache entries of older schema versions ==========
+	if cache.Available() {
+		go func() {
+			if n, err := cache.SweepStaleKeys(); err != nil {
+				logger.L.Warn("清理旧版本缓存失败: " + err.Error())
+			} else if n > 0 {
+				logger.L.System(fmt.Sprintf("已清理 %d 个旧版本缓存键 (schema v%d)", n, cache.SchemaVersion))
+			}
+		}()
+	}
+
 	// ========== 5. Setup Gin router ==========
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 
 	// Global middleware
-	r.Use(middleware.ErrorHandlerMiddleware())  // Panic recovery
-	r.Use(middleware.CORSMiddleware())          // CORS
-	r.Use(middleware.RequestLoggerMiddleware()) // Request logging
+	requestTimeout := time.Duration(cfg.RequestTimeoutSeconds) * time.Second
+	r.Use(middleware.ErrorHandlerMiddleware())       // Panic recovery
+	r.Use(middleware.CORSMiddleware())               // CORS
+	r.Use(middleware.RequestLoggerMiddleware())      // Request logging
+	r.Use(middleware.LocalizationMiddleware())       // Accept-Language → translated messages
+	r.Use(middleware.RequestTimeout(requestTimeout)) // Per-request deadline, cancels DB queries
 
 	// ========== 6. Register routes ==========
 
+	// All routes live under BASE_PATH ("" = root) for sub-path deployments
+	root := r.Group(cfg.BasePath)
+	if cfg.BasePath != "" {
+		logger.L.System(fmt.Sprintf("路由前缀: %s", cfg.BasePath))
+	}
+
 	// Health check (no auth required)
-	handler.RegisterHealthRoutes(r)
+	handler.RegisterHealthRoutes(root)
 
 	// API group with authentication
-	api := r.Group("/api")
+	api := root.Group("/api")
 	api.Use(auth.AuthMiddleware())
+	api.Use(middleware.AuditMiddleware())                            // Audit trail for write actions
+	api.Use(middleware.InstanceMiddleware(handler.SupportsInstance)) // X-Instance / ?instance= selector
+	api.Use(middleware.DataMaskingMiddleware())                      // Email / IP redaction for operators
 	{
 		// Auth routes (login/logout are whitelisted in middleware)
 		handler.RegisterAuthRoutes(api)
@@ -91,12 +126,16 @@ func main() {
 
 		// Phase 2.2: Dashboard, UserManagement, LogAnalytics
 		handler.RegisterDashboardRoutes(api)
+		handler.RegisterGroupBudgetRoutes(api)
 		handler.RegisterUserManagementRoutes(api)
 		handler.RegisterAffiliateStatsRoutes(api)
 		handler.RegisterLogAnalyticsRoutes(api)
+		handler.RegisterLogSearchRoutes(api)
 
 		// Phase 2.3: IP Monitoring, Risk Monitoring, Model Status
 		handler.RegisterIPMonitoringRoutes(api)
+		handler.RegisterIPBlocklistRoutes(api)
+		handler.RegisterIPReputationRoutes(api)
 		handler.RegisterRiskMonitoringRoutes(api)
 		handler.RegisterModelStatusRoutes(api)
 		handler.RegisterAbuseBroadcastRoutes(api)
@@ -108,13 +147,49 @@ func main() {
 		handler.RegisterAIAutoBanRoutes(api)
 		handler.RegisterAutoGroupRoutes(api)
 		handler.RegisterLinuxDoRoutes(api)
+
+		// Audit trail
+		handler.RegisterAuditLogRoutes(api)
+
+		// Live UI events (SSE)
+		handler.RegisterEventRoutes(api)
+
+		// Multi-instance registry
+		handler.RegisterInstanceRoutes(api)
+
+		// Channel management
+		handler.RegisterChannelRoutes(api)
+
+		// Public stats config (the endpoint itself is public, below)
+		handler.RegisterPublicStatsAdminRoutes(api)
+		handler.RegisterStatusPageAdminRoutes(api)
+
+		// Saved filter views (per admin)
+		handler.RegisterSavedViewRoutes(api)
+		handler.RegisterReportRoutes(api)
+		handler.RegisterWatchlistRoutes(api)
+		handler.RegisterUserCommsRoutes(api)
+		handler.RegisterSearchRoutes(api)
+
+		// Unified settings (typed schema, history, hot reload)
+		handler.RegisterSettingsRoutes(api)
 	}
 
 	// Public embed routes (no auth)
-	handler.RegisterModelStatusEmbedRoutes(r)
+	handler.RegisterModelStatusEmbedRoutes(root)
+	handler.RegisterPublicStatsRoutes(root)
+	handler.RegisterStatusPageRoutes(root)
+
+	// OpenAPI description and Swagger UI (no auth)
+	handler.RegisterOpenAPIRoutes(root, r.Routes)
 
 	// ========== 7. Background tasks ==========
 
+	// Runtime overrides saved via /api/settings (query limits, scale override)
+	for _, msg := range service.NewSettingsService().Reload(context.Background()) {
+		logger.L.Warn("[配置] 加载运行时配置失败: " + msg)
+	}
+
 	// IP recording enforcement: check every 10 minutes, enable if any user disabled it
 	stopIPEnforce := make(chan struct{})
 	go backgroundEnforceIPRecording(stopIPEnforce)
@@ -122,6 +197,86 @@ func main() {
 	stopAbuseBroadcast := make(chan struct{})
 	go backgroundSyncAbuseBroadcast(stopAbuseBroadcast)
 
+	stopChannelProbe := make(chan struct{})
+	go backgroundProbeChannels(stopChannelProbe)
+
+	stopChannelBalance := make(chan struct{})
+	go backgroundSnapshotChannelBalances(stopChannelBalance)
+
+	// Per-model 5-minute status slots for the uptime history / SLA endpoints
+	stopModelUptime := make(chan struct{})
+	go backgroundSnapshotModelUptime(stopModelUptime)
+
+	stopChannelFailover := make(chan struct{})
+	go backgroundChannelFailover(stopChannelFailover)
+
+	stopChannelKeyHealth := make(chan struct{})
+	go backgroundCheckChannelKeys(stopChannelKeyHealth)
+
+	stopIPBlocklist := make(chan struct{})
+	go backgroundEnforceIPBlocklist(stopIPBlocklist)
+
+	stopIPReputation := make(chan struct{})
+	go backgroundRefreshIPReputation(stopIPReputation)
+
+	stopAnalytics := make(chan struct{})
+	go backgroundProcessAnalytics(stopAnalytics)
+
+	stopRetention := make(chan struct{})
+	go backgroundApplyRetention(stopRetention)
+
+	stopLogArchive := make(chan struct{})
+	go backgroundArchiveLogs(stopLogArchive)
+
+	stopReports := make(chan struct{})
+	go backgroundRunScheduledReports(stopReports)
+
+	stopWatchlist := make(chan struct{})
+	go backgroundEvaluateWatchlist(stopWatchlist)
+
+	stopScale := make(chan struct{})
+	go backgroundDetectSystemScale(stopScale)
+
+	stopAnomalies := make(chan struct{})
+	go backgroundDetectAnomalies(stopAnomalies)
+
+	stopRegistrations := make(chan struct{})
+	go backgroundRegistrationSpikes(stopRegistrations)
+
+	stopMarginAlerts := make(chan struct{})
+	go backgroundMarginAlerts(stopMarginAlerts)
+
+	stopHighRisk := make(chan struct{})
+	go backgroundDetectHighRiskUsers(stopHighRisk)
+
+	stopRiskPolicy := make(chan struct{})
+	go backgroundEnforceRiskPolicy(stopRiskPolicy)
+
+	stopEndpointSLO := make(chan struct{})
+	go backgroundCheckEndpointSLOs(stopEndpointSLO)
+
+	stopDBStats := make(chan struct{})
+	go backgroundAnalyzeStaleTables(stopDBStats)
+
+	stopQueryProfiler := make(chan struct{})
+	go backgroundProfileSlowQueries(stopQueryProfiler)
+
+	// In-process rate counters stand in for Redis on deployments without it
+	stopRateMetrics := make(chan struct{})
+	go backgroundPollRateMetrics(stopRateMetrics)
+
+	// Group quota budgets: daily caps every 10 minutes, monthly 80% / 100% alerts hourly
+	stopGroupBudgets := make(chan struct{})
+	go backgroundGroupBudgets(stopGroupBudgets)
+
+	// Auto-group scans honoring auto_scan_enabled / scan_interval_minutes
+	stopAutoGroupScan := make(chan struct{})
+	go backgroundAutoGroupScan(stopAutoGroupScan)
+
+	// Synthetic token → completion → log → quota checks on their own interval
+	stopSmokeTests := make(chan struct{})
+	go backgroundSmokeTests(stopSmokeTests)
+
 	// ========== 8. Start server with graceful shutdown ==========
 	srv := &http.Server{
 		Addr:         cfg.ServerAddr(),
@@ -149,6 +304,31 @@ func main() {
 	// Stop background tasks
 	close(stopIPEnforce)
 	close(stopAbuseBroadcast)
+	close(stopChannelProbe)
+	close(stopChannelBalance)
+	close(stopModelUptime)
+	close(stopChannelFailover)
+	close(stopChannelKeyHealth)
+	close(stopIPBlocklist)
+	close(stopIPReputation)
+	close(stopAnalytics)
+	close(stopRetention)
+	close(stopLogArchive)
+	close(stopReports)
+	close(stopWatchlist)
+	close(stopScale)
+	close(stopAnomalies)
+	close(stopRegistrations)
+	close(stopMarginAlerts)
+	close(stopHighRisk)
+	close(stopRiskPolicy)
+	close(stopEndpointSLO)
+	close(stopDBStats)
+	close(stopQueryProfiler)
+	close(stopRateMetrics)
+	close(stopGroupBudgets)
+	close(stopAutoGroupScan)
+	close(stopSmokeTests)
 
 	// Give the server 10 seconds to finish processing requests
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -309,18 +489,1339 @@ func syncAbuseBroadcastOnce() {
 	}
 }
 
-func toInt64(v interface{}) int64 {
-	if v == nil {
-		return 0
+// backgroundProbeChannels runs the active channel prober. Like the abuse
+// broadcast supervisor it re-reads settings on every tick, so enabling or
+// changing the interval takes effect without a restart.
+func backgroundProbeChannels(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[渠道探测] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(60 * time.Second):
+	case <-stop:
+		return
 	}
-	switch val := v.(type) {
-	case int64:
-		return val
-	case int:
-		return int64(val)
-	case float64:
-		return int64(val)
-	default:
-		return 0
+
+	logger.L.System("[渠道探测] 主动探测监督任务已启动")
+
+	const checkInterval = 60 * time.Second
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			svc := service.NewChannelProbeService()
+			settings, err := svc.GetSettings(ctx)
+			cancel()
+			if err == nil && settings.Enabled && svc.Configured() {
+				interval := time.Duration(settings.IntervalMinutes) * time.Minute
+				if time.Since(lastRun) >= interval {
+					probeChannelsOnce()
+					lastRun = time.Now()
+				}
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[渠道探测] 主动探测监督任务已停止")
+			return
+		}
+	}
+}
+
+func probeChannelsOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[渠道探测] 探测执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	summary, err := service.NewChannelProbeService().RunProbes(ctx)
+	if err != nil {
+		logger.L.Warn("[渠道探测] 探测失败: " + err.Error())
+		return
+	}
+	logger.L.System(fmt.Sprintf("[渠道探测] 已探测 %d 个渠道: 成功 %d, 失败 %d, 自动禁用 %d",
+		summary.Probed, summary.Success, summary.Failed, len(summary.Disabled)))
+}
+
+// backgroundSnapshotChannelBalances records channel balance snapshots on the
+// configured interval and evaluates low-balance alerts after each snapshot.
+func backgroundSnapshotChannelBalances(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[渠道余额] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(90 * time.Second):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[渠道余额] 余额快照监督任务已启动")
+
+	const checkInterval = 60 * time.Second
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.NewChannelBalanceService().GetSettings(ctx)
+			cancel()
+			if err == nil && settings.Enabled && time.Since(lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute {
+				snapshotChannelBalancesOnce()
+				lastRun = time.Now()
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[渠道余额] 余额快照监督任务已停止")
+			return
+		}
+	}
+}
+
+func snapshotChannelBalancesOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[渠道余额] 快照执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	svc := service.NewChannelBalanceService()
+	if _, err := svc.TakeSnapshot(ctx); err != nil {
+		logger.L.Warn("[渠道余额] 快照失败: " + err.Error())
+		return
+	}
+	// Burn-rate evaluation emits channel_low_balance events as a side effect.
+	if _, err := svc.GetBurnRates(ctx); err != nil {
+		logger.L.Warn("[渠道余额] 告警评估失败: " + err.Error())
+	}
+}
+
+// backgroundChannelFailover evaluates the log-based failover policy every
+// minute; the service itself is a no-op while the policy is disabled.
+func backgroundChannelFailover(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[渠道熔断] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(45 * time.Second):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[渠道熔断] 失败率熔断任务已启动 (间隔: 1分钟)")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			evaluateChannelFailoverOnce()
+		case <-stop:
+			logger.L.System("[渠道熔断] 失败率熔断任务已停止")
+			return
+		}
+	}
+}
+
+func evaluateChannelFailoverOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[渠道熔断] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := service.NewChannelFailoverService().Evaluate(ctx, false)
+	if err != nil {
+		logger.L.Warn("[渠道熔断] 执行失败: " + err.Error())
+		return
+	}
+	if len(result.Disabled) > 0 || len(result.Recovered) > 0 {
+		logger.L.System(fmt.Sprintf("[渠道熔断] 本轮禁用 %d 个，恢复 %d 个渠道", len(result.Disabled), len(result.Recovered)))
+	}
+}
+
+// backgroundCheckChannelKeys validates upstream channel keys on the configured
+// interval (default every 6 hours) while the checker is enabled.
+func backgroundCheckChannelKeys(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[Key巡检] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(2 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[Key巡检] 上游 Key 巡检任务已启动")
+
+	const checkInterval = 60 * time.Second
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.NewChannelKeyHealthService().GetSettings(ctx)
+			cancel()
+			if err == nil && settings.Enabled && time.Since(lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute {
+				checkChannelKeysOnce()
+				lastRun = time.Now()
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[Key巡检] 上游 Key 巡检任务已停止")
+			return
+		}
+	}
+}
+
+func checkChannelKeysOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[Key巡检] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	summary, err := service.NewChannelKeyHealthService().CheckKeys(ctx, nil)
+	if err != nil {
+		logger.L.Warn("[Key巡检] 执行失败: " + err.Error())
+		return
+	}
+	logger.L.System(fmt.Sprintf("[Key巡检] 已检查 %d 个渠道 %d 个 Key，异常 %d 个",
+		summary.Channels, summary.Checked, len(summary.Flagged)))
+}
+
+// backgroundEnforceIPBlocklist disables tokens / bans users whose recent
+// traffic comes from blocklisted ranges, on the configured interval while
+// enforcement is enabled.
+func backgroundEnforceIPBlocklist(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[IP黑名单] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(90 * time.Second):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[IP黑名单] 黑名单执行任务已启动")
+
+	const checkInterval = 60 * time.Second
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.NewIPBlocklistService().GetSettings(ctx)
+			cancel()
+			if err == nil && settings.Enabled && time.Since(lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute {
+				enforceIPBlocklistOnce()
+				lastRun = time.Now()
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[IP黑名单] 黑名单执行任务已停止")
+			return
+		}
+	}
+}
+
+func enforceIPBlocklistOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[IP黑名单] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := service.NewIPBlocklistService().Enforce(ctx, nil)
+	if err != nil {
+		logger.L.Warn("[IP黑名单] 执行失败: " + err.Error())
+		return
+	}
+	if len(result.Hits) > 0 {
+		mode := "执行"
+		if result.DryRun {
+			mode = "试运行"
+		}
+		logger.L.System(fmt.Sprintf("[IP黑名单] %s: 命中 %d 个，已处置 %d 个", mode, len(result.Hits), result.Applied))
+	}
+}
+
+// backgroundRefreshIPReputation re-downloads the datacenter / VPN / Tor lists
+// once they are older than the configured refresh interval (default 24h).
+func backgroundRefreshIPReputation(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[IP信誉] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(3 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[IP信誉] 信誉列表更新任务已启动")
+
+	const checkInterval = 10 * time.Minute
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			refreshIPReputationOnce()
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[IP信誉] 信誉列表更新任务已停止")
+			return
+		}
+	}
+}
+
+func refreshIPReputationOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[IP信誉] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	svc := service.GetIPReputationService()
+	settings, err := svc.GetSettings(ctx)
+	if err != nil || !settings.Enabled || !svc.Stale(time.Duration(settings.RefreshHours)*time.Hour) {
+		return
+	}
+	status, err := svc.Refresh(ctx)
+	if err != nil {
+		logger.L.Warn("[IP信誉] 更新失败: " + err.Error())
+		return
+	}
+	entries := 0
+	for _, st := range status {
+		entries += st.Entries
+	}
+	logger.L.System(fmt.Sprintf("[IP信誉] 已更新 %d 个列表，共 %d 条", len(status), entries))
+}
+
+// backgroundProcessAnalytics keeps the local rollup and ip_history tables
+// current so rankings and IP analyses can skip scanning logs
+func backgroundProcessAnalytics(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[分析汇总] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(90 * time.Second):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[分析汇总] 增量处理任务已启动")
+
+	const checkInterval = 5 * time.Minute
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			processAnalyticsOnce()
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[分析汇总] 增量处理任务已停止")
+			return
+		}
+	}
+}
+
+func processAnalyticsOnce() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[分析汇总] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Minute)
+	defer cancel()
+
+	service.NewLogAnalyticsService().SyncIncremental(ctx, 200)
+}
+
+// backgroundApplyRetention deletes / archives rows past their TTL on the
+// configured interval while retention is enabled
+func backgroundApplyRetention(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[数据保留] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(3 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[数据保留] 清理任务已启动")
+
+	const checkInterval = 60 * time.Second
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.NewRetentionService().GetSettings(ctx)
+			cancel()
+			if err == nil && settings.Enabled && time.Since(lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute {
+				applyRetentionOnce(stop)
+				lastRun = time.Now()
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[数据保留] 清理任务已停止")
+			return
+		}
+	}
+}
+
+func applyRetentionOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[数据保留] 执行 panic: %v", r))
+		}
+	}()
+
+	// 关闭服务时中断当前批次之后的清理，未完成部分下次继续
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if _, err := service.NewRetentionService().Run(ctx, "schedule"); err != nil && !errors.Is(err, service.ErrRetentionRunning) {
+		logger.L.Warn("[数据保留] 清理失败: " + err.Error())
+	}
+}
+
+// backgroundArchiveLogs uploads old logs to object storage on the configured
+// interval while scheduled archiving is enabled
+func backgroundArchiveLogs(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[日志归档] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(5 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[日志归档] 归档任务已启动")
+
+	const checkInterval = 5 * time.Minute
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.NewLogArchiveService().GetSettings(ctx)
+			cancel()
+			if err == nil && settings.Enabled && time.Since(lastRun) >= time.Duration(settings.IntervalHours)*time.Hour {
+				archiveLogsOnce(stop)
+				lastRun = time.Now()
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[日志归档] 归档任务已停止")
+			return
+		}
+	}
+}
+
+func archiveLogsOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[日志归档] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if _, err := service.NewLogArchiveService().Run(ctx, "schedule"); err != nil && !errors.Is(err, service.ErrLogArchiveRunning) {
+		logger.L.Warn("[日志归档] 归档失败: " + err.Error())
+	}
+}
+
+// backgroundRunScheduledReports generates saved reports whose scheduled time
+// has passed and announces them via the report_ready event, and mails the
+// daily/weekly digest when it is due
+func backgroundRunScheduledReports(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[报表] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(2 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[报表] 定时报表任务已启动")
+
+	const checkInterval = time.Minute
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			runScheduledReportsOnce(stop)
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[报表] 定时报表任务已停止")
+			return
+		}
+	}
+}
+
+func runScheduledReportsOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[报表] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ran, err := service.NewReportService().RunDue(ctx)
+	if err != nil {
+		logger.L.Warn("[报表] 定时生成失败: " + err.Error())
+	}
+	if ran > 0 {
+		logger.L.Info(fmt.Sprintf("[报表] 已生成 %d 份定时报表", ran))
+	}
+
+	sent, err := service.NewReportDigestService().SendDue(ctx)
+	if err != nil {
+		logger.L.Warn("[报表] 摘要邮件发送失败: " + err.Error())
+	}
+	if sent {
+		logger.L.Info("[报表] 摘要邮件已发送")
+	}
+}
+
+// backgroundEvaluateWatchlist is the periodic risk check for watched users:
+// it notifies each admin when one of their watched users crosses a threshold,
+// changes country or gets banned
+func backgroundEvaluateWatchlist(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[关注名单] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(3 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[关注名单] 检查任务已启动 (间隔: 5分钟)")
+
+	const checkInterval = 5 * time.Minute
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			evaluateWatchlistOnce(stop)
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[关注名单] 检查任务已停止")
+			return
+		}
+	}
+}
+
+func evaluateWatchlistOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[关注名单] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	result, err := service.NewWatchlistService().Evaluate(ctx)
+	if err != nil {
+		logger.L.Warn("[关注名单] 检查失败: " + err.Error())
+		return
+	}
+	if result.Alerts > 0 {
+		logger.L.Info(fmt.Sprintf("[关注名单] 检查 %d 项，发出 %d 条通知", result.Evaluated, result.Alerts))
+	}
+}
+
+// backgroundDetectAnomalies checks each completed hour for traffic spikes and
+// drops while anomaly detection is enabled, notifying via event and webhook
+func backgroundDetectAnomalies(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[异常检测] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(4 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[异常检测] 检测任务已启动 (间隔: 10分钟)")
+
+	const checkInterval = 10 * time.Minute
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			detectAnomaliesOnce(stop)
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[异常检测] 检测任务已停止")
+			return
+		}
+	}
+}
+
+func detectAnomaliesOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[异常检测] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	anomalies, err := service.NewAnomalyService().WithContext(ctx).DetectAndNotify(ctx)
+	if err != nil {
+		logger.L.Warn("[异常检测] 检测失败: " + err.Error())
+	}
+	if len(anomalies) > 0 {
+		logger.L.Info(fmt.Sprintf("[异常检测] 发现 %d 处流量异常", len(anomalies)))
+	}
+}
+
+// backgroundRegistrationSpikes samples users.id growth once per hour and
+// raises a spike when the registration rate jumps above the baseline; it also
+// keeps the daily signup watermark snapshots
+func backgroundRegistrationSpikes(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[注册监控] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(2 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[注册监控] 采样任务已启动 (间隔: 5分钟)")
+
+	const checkInterval = 5 * time.Minute
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			checkRegistrationSpikesOnce(stop)
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[注册监控] 采样任务已停止")
+			return
+		}
+	}
+}
+
+func checkRegistrationSpikesOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[注册监控] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	spike, err := service.NewRegistrationSpikeService().WithContext(ctx).Check(ctx)
+	if err != nil {
+		logger.L.Warn("[注册监控] 采样失败: " + err.Error())
+	}
+	if spike != nil {
+		logger.L.Warn(fmt.Sprintf("[注册监控] 注册突增: %d 个新用户，%.1f/小时，基线 %.1f/小时", spike.NewUsers, spike.Rate, spike.Baseline))
+	}
+	// Daily users.id watermark for /api/users/signups
+	if err := service.NewSignupStatsService().WithContext(ctx).Snapshot(ctx); err != nil {
+		logger.L.Warn("[注册监控] 每日注册快照失败: " + err.Error())
+	}
+}
+
+// backgroundMarginAlerts compares charged quota against the upstream cost
+// table per model once per hour and raises negative margin alerts
+func backgroundMarginAlerts(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[毛利告警] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(3 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[毛利告警] 检查任务已启动 (间隔: 1小时)")
+
+	const checkInterval = time.Hour
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			checkMarginAlertsOnce(stop)
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[毛利告警] 检查任务已停止")
+			return
+		}
+	}
+}
+
+func checkMarginAlertsOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[毛利告警] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	raised, err := service.NewChannelMarginService().WithContext(ctx).CheckAlerts(ctx)
+	if err != nil {
+		logger.L.Warn("[毛利告警] 检查失败: " + err.Error())
+	}
+	for _, a := range raised {
+		logger.L.Warn(fmt.Sprintf("[毛利告警] 模型 %s 近 %d 小时毛利 $%.4f（收入 $%.4f，成本 $%.4f）",
+			a.ModelName, a.WindowHours, a.MarginUSD, a.RevenueUSD, a.CostUSD))
+	}
+}
+
+// backgroundGroupBudgets checks today's consumption against the daily caps
+// every 10 minutes (disabling / restoring tokens where configured) and this
+// month's consumption against the monthly budgets once per hour
+func backgroundGroupBudgets(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[分组预算] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(4 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[分组预算] 检查任务已启动 (日额度间隔: 10分钟, 月度预算间隔: 1小时)")
+
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	var lastMonthly time.Time
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		svc := service.NewGroupBudgetService().WithContext(ctx)
+		daily, err := svc.CheckDailyCaps(ctx)
+		if err != nil {
+			logger.L.Warn("[分组预算] 日额度检查失败: " + err.Error())
+		}
+		for _, a := range daily.Alerts {
+			logger.L.Warn(fmt.Sprintf("[分组预算] 分组 %s 今日已用 %d 额度，超出日额度 %d（禁用 %d 个令牌）", a.Group, a.Used, a.Budget, a.TokensDisabled))
+		}
+		if time.Since(lastMonthly) >= time.Hour {
+			lastMonthly = time.Now()
+			raised, err := svc.CheckAlerts(ctx)
+			if err != nil {
+				logger.L.Warn("[分组预算] 检查失败: " + err.Error())
+			}
+			for _, a := range raised {
+				logger.L.Warn(fmt.Sprintf("[分组预算] 分组 %s 本月已用 %d / %d 额度（达到 %d%%）", a.Group, a.Used, a.Budget, a.Threshold))
+			}
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			logger.L.System("[分组预算] 检查任务已停止")
+			return
+		}
+	}
+}
+
+// backgroundAutoGroupScan checks every minute whether a scheduled auto-group
+// scan is due (config is re-read each time, so changes apply without restart)
+func backgroundAutoGroupScan(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[自动分组] 定时扫描 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(90 * time.Second):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[自动分组] 定时扫描任务已启动")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if result := service.NewAutoGroupService().WithContext(ctx).RunScheduledScan(); result != nil {
+			if success, _ := result["success"].(bool); !success {
+				logger.L.Warn("[自动分组] 定时扫描失败: " + fmt.Sprint(result["message"]))
+			}
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			logger.L.System("[自动分组] 定时扫描任务已停止")
+			return
+		}
+	}
+}
+
+// backgroundSmokeTests checks every minute whether the end-to-end smoke test
+// suite is due and runs it; alerting happens inside the service
+func backgroundSmokeTests(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[冒烟测试] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(2 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[冒烟测试] 定时任务已启动")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		run, err := service.NewSmokeTestService().WithContext(ctx).RunIfDue(ctx)
+		if err != nil {
+			logger.L.Warn("[冒烟测试] 执行失败: " + err.Error())
+		} else if run != nil && !run.Success {
+			logger.L.Warn(fmt.Sprintf("[冒烟测试] 未通过，失败步骤: %s", run.FailedStep))
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			logger.L.System("[冒烟测试] 定时任务已停止")
+			return
+		}
+	}
+}
+
+// backgroundEnforceRiskPolicy lifts expired penalties every minute and, while
+// the policy is enabled, escalates repeat offenders on the configured interval
+func backgroundEnforceRiskPolicy(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[处罚策略] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(2 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	logger.L.System("[处罚策略] 监督任务已启动")
+
+	const checkInterval = 60 * time.Second
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.NewRiskPolicyService().GetSettings(ctx)
+			cancel()
+			due := err == nil && settings.Enabled && time.Since(lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute
+			enforceRiskPolicyOnce(stop, due)
+			if due {
+				lastRun = time.Now()
+			}
+			timer.Reset(checkInterval)
+		case <-stop:
+			logger.L.System("[处罚策略] 监督任务已停止")
+			return
+		}
+	}
+}
+
+// enforceRiskPolicyOnce runs a full pass when due; otherwise it only lifts
+// expired temporary bans so they end on time even with the policy disabled
+func enforceRiskPolicyOnce(stop <-chan struct{}, due bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[处罚策略] 执行 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	svc := service.NewRiskPolicyService().WithContext(ctx)
+	if !due {
+		if _, err := svc.LiftExpired(ctx); err != nil {
+			logger.L.Warn("[处罚策略] 到期解除失败: " + err.Error())
+		}
+		return
+	}
+	result, err := svc.Enforce(ctx, nil)
+	if err != nil {
+		logger.L.Warn("[处罚策略] 执行失败: " + err.Error())
+		return
+	}
+	if len(result.Decisions) > 0 || result.Lifted > 0 {
+		logger.L.Info(fmt.Sprintf("[处罚策略] 升级 %d 人，处置 %d，到期解除 %d (dry_run=%v)",
+			len(result.Decisions), result.Applied, result.Lifted, result.DryRun))
+	}
+}
+
+// backgroundDetectHighRiskUsers analyzes the last hour's suspicious users
+// every 10 minutes; flagged users are recorded for the risk digest and the
+// penalty ladder and published as high_risk_user
+func backgroundDetectHighRiskUsers(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[高风险检测] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(3 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	detect := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		analyzed, flagged, err := service.NewAIAutoBanService().WithContext(ctx).DetectHighRiskUsers(ctx)
+		if err != nil {
+			logger.L.Warn("[高风险检测] 检测失败: " + err.Error())
+			return
+		}
+		if flagged > 0 {
+			logger.L.Info(fmt.Sprintf("[高风险检测] 分析 %d 人，标记 %d 人", analyzed, flagged))
+		}
+	}
+	detect()
+
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			detect()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// backgroundSnapshotModelUptime records every model's request / success
+// counts per 5-minute slot; a run after downtime backfills up to a day
+func backgroundSnapshotModelUptime(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[模型可用率] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(2 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	snapshot := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if _, err := service.NewModelStatusService().WithContext(ctx).SnapshotUptime(ctx); err != nil {
+			logger.L.Warn("[模型可用率] 快照失败: " + err.Error())
+		}
+	}
+	snapshot()
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			snapshot()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// backgroundCheckEndpointSLOs compares each route's p95 latency with its SLO
+// every minute; the check is a no-op while SLO alerting is disabled
+func backgroundCheckEndpointSLOs(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[接口 SLO] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(time.Minute):
+	case <-stop:
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if _, err := service.CheckEndpointSLOs(ctx); err != nil {
+				logger.L.Warn("[接口 SLO] 检查失败: " + err.Error())
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// backgroundAnalyzeStaleTables runs ANALYZE on tables with stale planner
+// statistics during the configured maintenance window (PostgreSQL only)
+func backgroundAnalyzeStaleTables(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[统计信息] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(5 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+			if _, err := service.RunScheduledAnalyze(ctx); err != nil && !errors.Is(err, service.ErrDBStatsRunning) {
+				logger.L.Warn("[统计信息] 定时 ANALYZE 失败: " + err.Error())
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// backgroundProfileSlowQueries samples the plans of recurring slow queries
+// when the profiler is enabled
+func backgroundProfileSlowQueries(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[查询计划] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(10 * time.Minute):
+	case <-stop:
+		return
+	}
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			settings, err := service.GetQueryProfilerSettings(ctx)
+			cancel()
+			if err != nil || !settings.Enabled || time.Since(lastRun) < time.Duration(settings.IntervalMinutes)*time.Minute {
+				continue
+			}
+			lastRun = time.Now()
+			ctx, cancel = context.WithTimeout(context.Background(), 15*time.Minute)
+			if _, err := service.RunQueryProfiler(ctx); err != nil && !errors.Is(err, service.ErrQueryProfilerRunning) {
+				logger.L.Warn("[查询计划] 采样失败: " + err.Error())
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	switch val := v.(type) {
+	case int64:
+		return val
+	case int:
+		return int64(val)
+	case float64:
+		return int64(val)
+	default:
+		return 0
+	}
+}
+
+// backgroundPollRateMetrics feeds the in-process per-user request counters
+// from new logs every 15 seconds; only runs when Redis is not configured
+func backgroundPollRateMetrics(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[速率计数] 后台任务 panic: %v", r))
+		}
+	}()
+
+	if cache.Available() {
+		return
+	}
+	logger.L.System("未启用 Redis，使用进程内计数器估算用户 RPM")
+
+	select {
+	case <-time.After(20 * time.Second):
+	case <-stop:
+		return
+	}
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if _, err := service.PollRateMetrics(ctx); err != nil {
+			logger.L.Warn("[速率计数] 拉取日志失败: " + err.Error())
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// backgroundDetectSystemScale re-detects the system scale every 6 hours so
+// batch sizes, cache TTLs and limit caps follow the data as it grows
+func backgroundDetectSystemScale(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[系统规模] 后台任务 panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(30 * time.Second):
+	case <-stop:
+		return
+	}
+
+	const interval = 6 * time.Hour
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			detectSystemScaleOnce(stop)
+			timer.Reset(interval)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func detectSystemScaleOnce(stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L.Error(fmt.Sprintf("[系统规模] 检测 panic: %v", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if _, err := service.NewSystemScaleService().Detect(ctx); err != nil {
+		logger.L.Warn("[系统规模] 检测失败: " + err.Error())
 	}
 }
@@ -0,0 +1,90 @@
+// Package apidoc serves the OpenAPI description of the HTTP API. Routes come
+// from the live gin route table, so every registered endpoint is listed; their
+// summaries, query parameters and request / response schemas come from
+// docs.json, which is extracted from the handler doc comments and the
+// handler / service / models sources:
+//
+//	go generate ./internal/apidoc
+//
+// TestDocsUpToDate fails when docs.json is stale.
+package apidoc
+
+//go:generate go run ../../cmd/apidoc
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sync"
+)
+
+// Schema is the subset of an OpenAPI 3.0 schema object the extractor emits.
+// The zero value is "any value".
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// Param is a query parameter read by a handler
+type Param struct {
+	Name    string `json:"name"`
+	Array   bool   `json:"array,omitempty"`
+	Default string `json:"default,omitempty"`
+	Example string `json:"example,omitempty"`
+}
+
+// Operation documents one handler function
+type Operation struct {
+	Summary     string  `json:"summary,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Query       []Param `json:"query,omitempty"`
+	// Request is the JSON body the handler binds; Upload names the multipart
+	// file field of upload endpoints
+	Request *Schema `json:"request,omitempty"`
+	Upload  string  `json:"upload,omitempty"`
+	// ContentType of the success response, "" for application/json
+	ContentType string  `json:"content_type,omitempty"`
+	Response    *Schema `json:"response,omitempty"`
+}
+
+// Docs is the content of docs.json
+type Docs struct {
+	// Operations are keyed by handler function name
+	Operations map[string]*Operation `json:"operations"`
+	Schemas    map[string]*Schema    `json:"schemas"`
+	// ErrorSchema is the component holding models.ErrorResponse
+	ErrorSchema string `json:"error_schema"`
+}
+
+// Marshal encodes docs the way docs.json is written
+func Marshal(d *Docs) ([]byte, error) {
+	out, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+//go:embed docs.json
+var docsJSON []byte
+
+var (
+	docsOnce sync.Once
+	docs     *Docs
+	docsErr  error
+)
+
+// Load returns the embedded docs
+func Load() (*Docs, error) {
+	docsOnce.Do(func() {
+		docs = &Docs{}
+		docsErr = json.Unmarshal(docsJSON, docs)
+	})
+	return docs, docsErr
+}
@@ -0,0 +1,95 @@
+package apidoc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDocsUpToDate(t *testing.T) {
+	docs, err := Generate("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Marshal(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, docsJSON) {
+		t.Fatal("docs.json is stale, run: go generate ./internal/apidoc")
+	}
+
+	login := docs.Operations["Login"]
+	if login == nil || login.Request == nil || login.Request.Ref != schemaRef+"LoginRequest" {
+		t.Errorf("Login request = %+v", login)
+	}
+	search := docs.Operations["SearchLogs"]
+	if search == nil || len(search.Query) == 0 {
+		t.Fatalf("SearchLogs = %+v", search)
+	}
+	names := map[string]bool{}
+	for _, q := range search.Query {
+		names[q.Name] = true
+	}
+	for _, want := range []string{"username", "limit", "cursor"} {
+		if !names[want] {
+			t.Errorf("SearchLogs query misses %s: %+v", want, search.Query)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	docs, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := []Route{
+		{Method: "POST", Path: "/tools/api/auth/login", Handler: "github.com/new-api-tools/backend/internal/handler.Login"},
+		{Method: "GET", Path: "/tools/api/ip/users/:user_id/ips", Handler: "github.com/new-api-tools/backend/internal/handler.GetUserIPs"},
+		{Method: "GET", Path: "/tools/api/custom", Handler: "github.com/new-api-tools/backend/internal/handler.RegisterX.func1"},
+		{Method: "GET", Path: "/tools/api/custom/:id", Handler: "github.com/new-api-tools/backend/internal/handler.RegisterX.func2"},
+	}
+	doc := Build(routes, docs, Options{
+		Title: "t", Version: "1", BasePath: "/tools",
+		Security: func(path string) []map[string][]string {
+			if path == "/api/auth/login" {
+				return []map[string][]string{}
+			}
+			return nil
+		},
+	})
+	paths := doc["paths"].(map[string]map[string]any)
+
+	login := paths["/api/auth/login"]["post"].(map[string]any)
+	if sec := login["security"].([]map[string][]string); len(sec) != 0 {
+		t.Errorf("login must be public, got %v", sec)
+	}
+	if login["requestBody"] == nil {
+		t.Error("login must document its request body")
+	}
+	if _, ok := login["responses"].(map[string]any)["401"]; ok {
+		t.Error("public operations have no 401 response")
+	}
+
+	user := paths["/api/ip/users/{user_id}/ips"]["get"].(map[string]any)
+	if _, ok := user["security"]; ok {
+		t.Error("authenticated operations use the global security")
+	}
+	params := user["parameters"].([]map[string]any)
+	if params[0]["name"] != "user_id" || params[0]["in"] != "path" {
+		t.Errorf("first parameter = %v", params[0])
+	}
+	if user["tags"].([]string)[0] != "ip" {
+		t.Errorf("tags = %v", user["tags"])
+	}
+
+	custom := paths["/api/custom"]["get"].(map[string]any)
+	if custom["summary"] != "GET /api/custom" {
+		t.Errorf("undocumented handler summary = %v", custom["summary"])
+	}
+	if id := paths["/api/custom/{id}"]["get"].(map[string]any)["operationId"]; id != "get_api_custom_id" {
+		t.Errorf("closure operationId = %v", id)
+	}
+	if doc["servers"].([]map[string]any)[0]["url"] != "/tools/" {
+		t.Errorf("servers = %v", doc["servers"])
+	}
+}
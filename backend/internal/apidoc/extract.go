@@ -0,0 +1,1069 @@
+package apidoc
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sourcePackages are parsed for handlers and the types they use, relative to
+// the module root
+var sourcePackages = []string{"internal/handler", "internal/service", "internal/models", "pkg/api"}
+
+const handlerPkg = "handler"
+
+// stdPackages are imports whose selectors are never local variables
+var stdPackages = map[string]bool{
+	"gin": true, "http": true, "strconv": true, "strings": true, "time": true, "fmt": true,
+	"errors": true, "json": true, "io": true, "bytes": true, "context": true, "math": true,
+	"sort": true, "slices": true, "url": true, "config": true, "cache": true, "logger": true,
+	"database": true, "auth": true, "i18n": true, "middleware": true,
+}
+
+// stdResults are the result types of library calls handlers commonly put in
+// responses
+var stdResults = map[string]string{
+	"fmt.Sprintf": "string", "strconv.Itoa": "string", "strconv.FormatInt": "string",
+	"strconv.FormatFloat": "string", "strconv.Atoi": "int", "strconv.ParseInt": "int64",
+	"strconv.ParseFloat": "float64", "strconv.ParseBool": "bool", "strings.Join": "string",
+	"strings.TrimSpace": "string", "strings.ToLower": "string", "strings.ToUpper": "string",
+	"strings.Split": "[]string", "strings.Fields": "[]string", "strings.HasPrefix": "bool",
+	"strings.Contains": "bool", "time.Now": "time.Time", "time.Unix": "time.Time",
+	"config.BasePath": "string",
+}
+
+// pkgIndex holds the declarations of one parsed package
+type pkgIndex struct {
+	types   map[string]*ast.TypeSpec
+	typeDoc map[string]string
+	funcs   map[string]*ast.FuncDecl
+	methods map[string]map[string]*ast.FuncDecl // receiver type → name → decl
+}
+
+// typeRef is a type expression and the package it is written in
+type typeRef struct {
+	pkg  string
+	expr ast.Expr
+}
+
+type extractor struct {
+	pkgs      map[string]*pkgIndex
+	schemas   map[string]*Schema
+	typeCount map[string]int         // packages declaring each type name
+	byMethod  map[string][]methodRef // method name → declarations
+}
+
+type methodRef struct {
+	pkg string
+	fd  *ast.FuncDecl
+}
+
+// Generate extracts the operation docs of every handler below the module root
+func Generate(root string) (*Docs, error) {
+	x := &extractor{
+		pkgs:      map[string]*pkgIndex{},
+		schemas:   map[string]*Schema{},
+		typeCount: map[string]int{},
+		byMethod:  map[string][]methodRef{},
+	}
+	var handlerFiles []*ast.File
+	for _, dir := range sourcePackages {
+		files, err := parseDir(filepath.Join(root, dir))
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(dir)
+		idx := indexPackage(files)
+		x.pkgs[name] = idx
+		for t := range idx.types {
+			x.typeCount[t]++
+		}
+		for _, methods := range idx.methods {
+			for m, fd := range methods {
+				x.byMethod[m] = append(x.byMethod[m], methodRef{pkg: name, fd: fd})
+			}
+		}
+		if name == handlerPkg {
+			handlerFiles = files
+		}
+	}
+	if len(handlerFiles) == 0 {
+		return nil, fmt.Errorf("no handler sources below %s", root)
+	}
+
+	d := &Docs{Operations: map[string]*Operation{}, Schemas: x.schemas}
+	for _, f := range handlerFiles {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil || fd.Body == nil || fd.Type.Results != nil {
+				continue
+			}
+			if ctx := handlerContext(fd); ctx != "" {
+				d.Operations[fd.Name.Name] = x.operation(fd, ctx)
+			}
+		}
+	}
+	d.ErrorSchema = strings.TrimPrefix(x.named("models", "ErrorResponse").Ref, "#/components/schemas/")
+	return d, nil
+}
+
+func parseDir(dir string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func indexPackage(files []*ast.File) *pkgIndex {
+	idx := &pkgIndex{
+		types:   map[string]*ast.TypeSpec{},
+		typeDoc: map[string]string{},
+		funcs:   map[string]*ast.FuncDecl{},
+		methods: map[string]map[string]*ast.FuncDecl{},
+	}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					ts := spec.(*ast.TypeSpec)
+					idx.types[ts.Name.Name] = ts
+					doc := ts.Doc
+					if doc == nil && len(d.Specs) == 1 {
+						doc = d.Doc
+					}
+					idx.typeDoc[ts.Name.Name] = commentText(doc)
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					idx.funcs[d.Name.Name] = d
+					continue
+				}
+				recv := receiverName(d.Recv.List[0].Type)
+				if idx.methods[recv] == nil {
+					idx.methods[recv] = map[string]*ast.FuncDecl{}
+				}
+				idx.methods[recv][d.Name.Name] = d
+			}
+		}
+	}
+	return idx
+}
+
+func receiverName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// handlerContext returns the *gin.Context parameter name of a gin handler
+func handlerContext(fd *ast.FuncDecl) string {
+	params := fd.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) != 1 || !isGinContext(params[0].Type) {
+		return ""
+	}
+	return params[0].Names[0].Name
+}
+
+func isGinContext(e ast.Expr) bool {
+	star, ok := e.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && id.Name == "gin" && sel.Sel.Name == "Context"
+}
+
+func commentText(g *ast.CommentGroup) string {
+	if g == nil {
+		return ""
+	}
+	return strings.TrimSpace(g.Text())
+}
+
+var routeLineRe = regexp.MustCompile(`^(GET|POST|PUT|PATCH|DELETE)\s+(/\S*)`)
+
+// operation documents one handler. Extraction is best effort: a construct the
+// resolver does not understand leaves that part of the operation generic.
+func (x *extractor) operation(fd *ast.FuncDecl, ctx string) (op *Operation) {
+	op = &Operation{}
+	var documented []Param
+	op.Summary, op.Description, documented = parseDoc(fd)
+	defer func() {
+		if recover() != nil {
+			op.Request, op.Response = nil, nil
+		}
+	}()
+
+	sc := newScope(handlerPkg, fd)
+	op.Query = x.queryParams(fd, ctx, map[string]bool{})
+	// the route line documents parameters the code reads indirectly
+	// (e.g. in a loop over names)
+	for _, d := range documented {
+		i := slices.IndexFunc(op.Query, func(q Param) bool { return q.Name == d.Name })
+		if i < 0 {
+			op.Query = append(op.Query, d)
+		} else if op.Query[i].Example == "" {
+			op.Query[i].Example = d.Example
+		}
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		call, name := contextCall(n, ctx)
+		switch name {
+		case "ShouldBindJSON", "BindJSON", "ShouldBind":
+			if op.Request == nil && len(call.Args) == 1 {
+				op.Request = x.schemaOfExpr(sc, call.Args[0], 0)
+			}
+		case "FormFile":
+			if len(call.Args) == 1 {
+				op.Upload = stringLit(call.Args[0])
+			}
+		}
+		return true
+	})
+	op.ContentType, op.Response, _ = x.response(sc, fd, ctx, map[string]bool{fd.Name.Name: true})
+	return op
+}
+
+// parseDoc splits a handler comment into summary and description; route lines
+// ("GET /api/x?limit=50") are dropped and their query values kept as examples
+func parseDoc(fd *ast.FuncDecl) (summary, description string, params []Param) {
+	var lines []string
+	route := false
+	for _, line := range strings.Split(commentText(fd.Doc), "\n") {
+		text := strings.TrimSpace(line)
+		text = strings.TrimPrefix(text, fd.Name.Name+" handles ")
+		if strings.HasPrefix(text, "Matches Python") {
+			continue
+		}
+		var query string
+		if m := routeLineRe.FindStringSubmatch(text); m != nil {
+			route = true
+			_, query, _ = strings.Cut(m[2], "?")
+		} else if route && strings.HasPrefix(text, "&") {
+			// a long query string wrapped onto the next line
+			query = text[1:]
+		} else {
+			route = false
+			lines = append(lines, line)
+			continue
+		}
+		for _, kv := range strings.Split(query, "&") {
+			k, v, _ := strings.Cut(kv, "=")
+			if k != "" && !slices.ContainsFunc(params, func(q Param) bool { return q.Name == k }) {
+				params = append(params, Param{Name: k, Example: v})
+			}
+		}
+	}
+	description = strings.TrimSpace(strings.Join(lines, "\n"))
+	if rest, ok := strings.CutPrefix(description, fd.Name.Name+" "); ok {
+		description = upperFirst(rest)
+	}
+	summary = firstSentence(description)
+	// "同上" only makes sense next to the handler above it in the source, and
+	// a request body example or a heading such as "请求体:" summarises nothing
+	if summary == "" || strings.HasPrefix(summary, "同上") || strings.HasPrefix(summary, "请求体") ||
+		strings.HasSuffix(summary, ":") || strings.HasSuffix(summary, "：") {
+		summary = humanize(fd.Name.Name)
+	}
+	if description == summary {
+		description = ""
+	}
+	return summary, description, params
+}
+
+// firstSentence returns the first sentence of the first paragraph of a doc
+// comment, shortened at a clause boundary when it is too long for a summary
+func firstSentence(doc string) string {
+	para, _, _ := strings.Cut(doc, "\n\n")
+	first := ""
+	for _, line := range strings.Split(para, "\n") {
+		line = strings.TrimSpace(line)
+		// wrapped Chinese text joins without a space
+		if first != "" && line != "" && first[len(first)-1] < utf8.RuneSelf && line[0] < utf8.RuneSelf {
+			first += " "
+		}
+		first += line
+	}
+	for _, sep := range []string{"。", "；", "; ", ". ", "，例如"} {
+		first, _, _ = strings.Cut(first, sep)
+	}
+	first = strings.TrimRight(strings.TrimSpace(first), ".，、")
+	if runes := []rune(first); len(runes) > 80 {
+		cut := strings.LastIndexAny(string(runes[:80]), "，：")
+		if cut <= 0 {
+			return ""
+		}
+		first = first[:cut]
+		if open := strings.LastIndex(first, "（"); open > 0 && !strings.Contains(first[open:], "）") {
+			first = first[:open]
+		}
+	}
+	return first
+}
+
+// humanize turns a handler name into a sentence: GetIPStats → "Get IP stats"
+func humanize(name string) string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) {
+			cur, prev := runes[i], runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(cur) || (unicode.IsUpper(prev) && !nextLower) {
+				continue
+			}
+		}
+		word := string(runes[start:i])
+		if start > 0 && !isAcronym(word) {
+			word = strings.ToLower(word)
+		}
+		words = append(words, word)
+		start = i
+	}
+	return upperFirst(strings.Join(words, " "))
+}
+
+func isAcronym(word string) bool {
+	return len(word) > 1 && strings.ToUpper(word) == word
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// contextCall reports n as a method call on the gin context variable ctx
+func contextCall(n ast.Node, ctx string) (*ast.CallExpr, string) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return nil, ""
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, ""
+	}
+	if id, ok := sel.X.(*ast.Ident); !ok || id.Name != ctx {
+		return nil, ""
+	}
+	return call, sel.Sel.Name
+}
+
+// helperCall reports n as a call of a handler-package helper that receives the
+// gin context, returning the helper and its context parameter name
+func (x *extractor) helperCall(n ast.Node, ctx string) (*ast.FuncDecl, string) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return nil, ""
+	}
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return nil, ""
+	}
+	fd := x.pkgs[handlerPkg].funcs[id.Name]
+	if fd == nil || fd.Body == nil {
+		return nil, ""
+	}
+	var names []string
+	var ctxParam string
+	for _, field := range fd.Type.Params.List {
+		for _, n := range field.Names {
+			if isGinContext(field.Type) && ctxParam == "" {
+				ctxParam = n.Name
+			}
+			names = append(names, n.Name)
+		}
+	}
+	for i, arg := range call.Args {
+		if a, ok := arg.(*ast.Ident); ok && a.Name == ctx && i < len(names) && names[i] == ctxParam {
+			return fd, ctxParam
+		}
+	}
+	return nil, ""
+}
+
+func (x *extractor) queryParams(fd *ast.FuncDecl, ctx string, seen map[string]bool) []Param {
+	var params []Param
+	add := func(p Param) {
+		for _, q := range params {
+			if q.Name == p.Name {
+				return
+			}
+		}
+		params = append(params, p)
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		if call, name := contextCall(n, ctx); call != nil && len(call.Args) > 0 {
+			key := stringLit(call.Args[0])
+			if key == "" {
+				return true
+			}
+			switch name {
+			case "Query", "GetQuery":
+				add(Param{Name: key})
+			case "DefaultQuery":
+				p := Param{Name: key}
+				if len(call.Args) > 1 {
+					p.Default = stringLit(call.Args[1])
+				}
+				add(p)
+			case "QueryArray", "GetQueryArray":
+				add(Param{Name: key, Array: true})
+			}
+			return true
+		}
+		if helper, helperCtx := x.helperCall(n, ctx); helper != nil && !seen[helper.Name.Name] {
+			seen[helper.Name.Name] = true
+			for _, p := range x.queryParams(helper, helperCtx, seen) {
+				add(p)
+			}
+		}
+		return true
+	})
+	return params
+}
+
+// response finds the success response of a handler (or a helper it passes the
+// context to): its content type and, for JSON, its schema
+func (x *extractor) response(sc *scope, fd *ast.FuncDecl, ctx string, seen map[string]bool) (contentType string, schema *Schema, found bool) {
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		if call, name := contextCall(n, ctx); call != nil {
+			switch name {
+			case "JSON", "PureJSON", "IndentedJSON", "AbortWithStatusJSON":
+				if len(call.Args) == 2 && isSuccessStatus(call.Args[0]) {
+					schema, found = x.schemaOfExpr(sc, call.Args[1], 0), true
+				}
+			case "Data":
+				if len(call.Args) == 3 && isSuccessStatus(call.Args[0]) {
+					contentType, _, _ = strings.Cut(stringLit(call.Args[1]), ";")
+					if contentType == "" {
+						contentType = "application/octet-stream"
+					}
+					found = true
+				}
+			case "String":
+				if len(call.Args) >= 2 && isSuccessStatus(call.Args[0]) {
+					contentType, found = "text/plain", true
+				}
+			case "File", "FileAttachment", "DataFromReader":
+				contentType, found = "application/octet-stream", true
+			case "Stream", "SSEvent":
+				contentType, found = "text/event-stream", true
+			}
+			return !found
+		}
+		if helper, helperCtx := x.helperCall(n, ctx); helper != nil && !seen[helper.Name.Name] {
+			seen[helper.Name.Name] = true
+			contentType, schema, found = x.response(newScope(handlerPkg, helper), helper, helperCtx, seen)
+		}
+		return !found
+	})
+	return contentType, schema, found
+}
+
+func isSuccessStatus(e ast.Expr) bool {
+	switch v := e.(type) {
+	case *ast.SelectorExpr:
+		return v.Sel.Name == "StatusOK" || v.Sel.Name == "StatusCreated" || v.Sel.Name == "StatusAccepted"
+	case *ast.BasicLit:
+		return v.Value == "200" || v.Value == "201" || v.Value == "202"
+	}
+	return false
+}
+
+func stringLit(e ast.Expr) string {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// scope maps the local variables of a function to their declared type or
+// initializer
+type scope struct {
+	pkg  string
+	vars map[string]varDef
+}
+
+type varDef struct {
+	typ   ast.Expr
+	value ast.Expr
+	index int // result index when value is a multi-value call
+}
+
+func newScope(pkg string, fd *ast.FuncDecl) *scope {
+	sc := &scope{pkg: pkg, vars: map[string]varDef{}}
+	define := func(name string, v varDef) {
+		if _, ok := sc.vars[name]; !ok && name != "_" {
+			sc.vars[name] = v
+		}
+	}
+	for _, field := range fd.Type.Params.List {
+		for _, n := range field.Names {
+			define(n.Name, varDef{typ: field.Type})
+		}
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			for i, l := range s.Lhs {
+				id, ok := l.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				if len(s.Rhs) == len(s.Lhs) {
+					define(id.Name, varDef{value: s.Rhs[i]})
+				} else if len(s.Rhs) == 1 {
+					define(id.Name, varDef{value: s.Rhs[0], index: i})
+				}
+			}
+		case *ast.ValueSpec:
+			for i, id := range s.Names {
+				if s.Type != nil {
+					define(id.Name, varDef{typ: s.Type})
+				} else if len(s.Values) == len(s.Names) {
+					define(id.Name, varDef{value: s.Values[i]})
+				} else if len(s.Values) == 1 {
+					define(id.Name, varDef{value: s.Values[0], index: i})
+				}
+			}
+		}
+		return true
+	})
+	return sc
+}
+
+func (x *extractor) isPackage(sc *scope, name string) bool {
+	if _, local := sc.vars[name]; local {
+		return false
+	}
+	return x.pkgs[name] != nil || stdPackages[name]
+}
+
+func basicRef(name string) (typeRef, bool) {
+	if strings.HasPrefix(name, "[]") {
+		return typeRef{expr: &ast.ArrayType{Elt: ast.NewIdent(name[2:])}}, true
+	}
+	if pkg, sel, ok := strings.Cut(name, "."); ok {
+		return typeRef{expr: &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(sel)}}, true
+	}
+	return typeRef{expr: ast.NewIdent(name)}, true
+}
+
+const maxDepth = 10
+
+// resolve infers the type of expression e (result idx of a multi-value call)
+func (x *extractor) resolve(sc *scope, e ast.Expr, idx, depth int) (typeRef, bool) {
+	if depth > maxDepth {
+		return typeRef{}, false
+	}
+	switch v := e.(type) {
+	case *ast.ParenExpr:
+		return x.resolve(sc, v.X, idx, depth+1)
+	case *ast.BasicLit:
+		switch v.Kind {
+		case token.INT:
+			return basicRef("int")
+		case token.FLOAT:
+			return basicRef("float64")
+		case token.STRING, token.CHAR:
+			return basicRef("string")
+		}
+	case *ast.Ident:
+		if v.Name == "true" || v.Name == "false" {
+			return basicRef("bool")
+		}
+		if def, ok := sc.vars[v.Name]; ok {
+			if def.typ != nil {
+				return typeRef{pkg: sc.pkg, expr: def.typ}, true
+			}
+			return x.resolve(sc, def.value, def.index, depth+1)
+		}
+	case *ast.CompositeLit:
+		if v.Type != nil {
+			return typeRef{pkg: sc.pkg, expr: v.Type}, true
+		}
+	case *ast.UnaryExpr:
+		if v.Op == token.NOT {
+			return basicRef("bool")
+		}
+		return x.resolve(sc, v.X, 0, depth+1)
+	case *ast.StarExpr:
+		t, ok := x.resolve(sc, v.X, 0, depth+1)
+		if star, isStar := t.expr.(*ast.StarExpr); ok && isStar {
+			t.expr = star.X
+		}
+		return t, ok
+	case *ast.BinaryExpr:
+		switch v.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			return basicRef("bool")
+		}
+		return x.resolve(sc, v.X, 0, depth+1)
+	case *ast.IndexExpr:
+		t, ok := x.resolve(sc, v.X, 0, depth+1)
+		if !ok {
+			break
+		}
+		switch u := x.underlying(t, 0); ut := u.expr.(type) {
+		case *ast.ArrayType:
+			return typeRef{pkg: u.pkg, expr: ut.Elt}, true
+		case *ast.MapType:
+			return typeRef{pkg: u.pkg, expr: ut.Value}, true
+		}
+	case *ast.SliceExpr:
+		return x.resolve(sc, v.X, 0, depth+1)
+	case *ast.SelectorExpr:
+		if id, ok := v.X.(*ast.Ident); ok && x.isPackage(sc, id.Name) {
+			break
+		}
+		t, ok := x.resolve(sc, v.X, 0, depth+1)
+		if ok {
+			return x.field(t, v.Sel.Name, 0)
+		}
+	case *ast.CallExpr:
+		return x.resolveCall(sc, v, idx, depth)
+	}
+	return typeRef{}, false
+}
+
+func (x *extractor) resolveCall(sc *scope, call *ast.CallExpr, idx, depth int) (typeRef, bool) {
+	switch f := call.Fun.(type) {
+	case *ast.Ident:
+		switch f.Name {
+		case "len", "cap":
+			return basicRef("int")
+		case "make", "new":
+			if len(call.Args) > 0 {
+				return typeRef{pkg: sc.pkg, expr: call.Args[0]}, true
+			}
+		case "append", "min", "max":
+			if len(call.Args) > 0 {
+				return x.resolve(sc, call.Args[0], 0, depth+1)
+			}
+		case "string", "bool", "int", "int32", "int64", "uint", "uint64", "float32", "float64":
+			return basicRef(f.Name)
+		}
+		pkg := x.pkgs[sc.pkg]
+		if fd := pkg.funcs[f.Name]; fd != nil {
+			return result(sc.pkg, fd, idx)
+		}
+		if _, ok := pkg.types[f.Name]; ok {
+			return typeRef{pkg: sc.pkg, expr: f}, true
+		}
+	case *ast.SelectorExpr:
+		if id, ok := f.X.(*ast.Ident); ok && x.isPackage(sc, id.Name) {
+			if name, ok := stdResults[id.Name+"."+f.Sel.Name]; ok && idx == 0 {
+				return basicRef(name)
+			}
+			if p := x.pkgs[id.Name]; p != nil {
+				if fd := p.funcs[f.Sel.Name]; fd != nil {
+					return result(id.Name, fd, idx)
+				}
+				if _, ok := p.types[f.Sel.Name]; ok {
+					return typeRef{pkg: sc.pkg, expr: f}, true
+				}
+			}
+			return typeRef{}, false
+		}
+		if recv, ok := x.resolve(sc, f.X, 0, depth+1); ok {
+			if t, ok := x.timeMethod(recv, f.Sel.Name); ok {
+				return t, true
+			}
+			if pkg, fd := x.method(recv, f.Sel.Name, 0); fd != nil {
+				return result(pkg, fd, idx)
+			}
+		}
+		// receiver unknown: fall back to a method name declared only once
+		if refs := x.byMethod[f.Sel.Name]; len(refs) == 1 {
+			return result(refs[0].pkg, refs[0].fd, idx)
+		}
+	}
+	return typeRef{}, false
+}
+
+func (x *extractor) timeMethod(recv typeRef, name string) (typeRef, bool) {
+	sel, ok := stripStar(recv.expr).(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Time" {
+		return typeRef{}, false
+	}
+	if id, ok := sel.X.(*ast.Ident); !ok || id.Name != "time" {
+		return typeRef{}, false
+	}
+	switch name {
+	case "Unix", "UnixMilli", "UnixNano":
+		return basicRef("int64")
+	case "Format", "String":
+		return basicRef("string")
+	}
+	return typeRef{}, false
+}
+
+// result returns the idx-th result type of fd
+func result(pkg string, fd *ast.FuncDecl, idx int) (typeRef, bool) {
+	if fd.Type.Results == nil {
+		return typeRef{}, false
+	}
+	var types []ast.Expr
+	for _, field := range fd.Type.Results.List {
+		for range max(1, len(field.Names)) {
+			types = append(types, field.Type)
+		}
+	}
+	if idx >= len(types) {
+		return typeRef{}, false
+	}
+	return typeRef{pkg: pkg, expr: types[idx]}, true
+}
+
+func stripStar(e ast.Expr) ast.Expr {
+	for {
+		star, ok := e.(*ast.StarExpr)
+		if !ok {
+			return e
+		}
+		e = star.X
+	}
+}
+
+// namedType returns the package and name of a (possibly pointer) named type
+func namedType(t typeRef) (pkg, name string) {
+	switch v := stripStar(t.expr).(type) {
+	case *ast.Ident:
+		return t.pkg, v.Name
+	case *ast.SelectorExpr:
+		if id, ok := v.X.(*ast.Ident); ok {
+			return id.Name, v.Sel.Name
+		}
+	case *ast.IndexExpr:
+		return namedType(typeRef{pkg: t.pkg, expr: v.X})
+	}
+	return "", ""
+}
+
+// method looks a method up on a named type, following embedded fields
+func (x *extractor) method(recv typeRef, name string, depth int) (string, *ast.FuncDecl) {
+	pkg, typeName := namedType(recv)
+	p := x.pkgs[pkg]
+	if p == nil || depth > 3 {
+		return "", nil
+	}
+	if fd := p.methods[typeName][name]; fd != nil {
+		return pkg, fd
+	}
+	if st, ok := x.underlying(recv, 0).expr.(*ast.StructType); ok {
+		for _, f := range st.Fields.List {
+			if len(f.Names) == 0 {
+				if mp, fd := x.method(typeRef{pkg: pkg, expr: f.Type}, name, depth+1); fd != nil {
+					return mp, fd
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// underlying follows named types (within the parsed packages) to their
+// definition
+func (x *extractor) underlying(t typeRef, depth int) typeRef {
+	if depth > maxDepth {
+		return t
+	}
+	t.expr = stripStar(t.expr)
+	pkg, name := namedType(t)
+	if p := x.pkgs[pkg]; p != nil {
+		if ts := p.types[name]; ts != nil {
+			return x.underlying(typeRef{pkg: pkg, expr: ts.Type}, depth+1)
+		}
+	}
+	return t
+}
+
+// field returns the type of a struct field, including promoted fields
+func (x *extractor) field(t typeRef, name string, depth int) (typeRef, bool) {
+	if depth > 3 {
+		return typeRef{}, false
+	}
+	u := x.underlying(t, 0)
+	st, ok := u.expr.(*ast.StructType)
+	if !ok {
+		return typeRef{}, false
+	}
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			if n.Name == name {
+				return typeRef{pkg: u.pkg, expr: f.Type}, true
+			}
+		}
+	}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			if ft, ok := x.field(typeRef{pkg: u.pkg, expr: f.Type}, name, depth+1); ok {
+				return ft, true
+			}
+		}
+	}
+	return typeRef{}, false
+}
+
+// schemaOfExpr describes the JSON encoding of expression e. gin.H and map
+// literals become objects with one property per literal key.
+func (x *extractor) schemaOfExpr(sc *scope, e ast.Expr, depth int) *Schema {
+	if depth > maxDepth {
+		return &Schema{}
+	}
+	switch v := e.(type) {
+	case *ast.UnaryExpr:
+		if v.Op == token.AND {
+			return x.schemaOfExpr(sc, v.X, depth+1)
+		}
+	case *ast.Ident:
+		if def, ok := sc.vars[v.Name]; ok && def.typ == nil {
+			if lit, ok := def.value.(*ast.CompositeLit); ok {
+				return x.schemaOfExpr(sc, lit, depth+1)
+			}
+		}
+	case *ast.CompositeLit:
+		if isObjectType(v.Type) && len(v.Elts) > 0 {
+			s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			for _, elt := range v.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				if key := stringLit(kv.Key); key != "" {
+					s.Properties[key] = x.schemaOfExpr(sc, kv.Value, depth+1)
+				}
+			}
+			return s
+		}
+		if arr, ok := v.Type.(*ast.ArrayType); ok && len(v.Elts) > 0 {
+			if lit, ok := v.Elts[0].(*ast.CompositeLit); ok && lit.Type == nil && isObjectType(arr.Elt) {
+				lit = &ast.CompositeLit{Type: arr.Elt, Elts: lit.Elts}
+				return &Schema{Type: "array", Items: x.schemaOfExpr(sc, lit, depth+1)}
+			}
+		}
+	}
+	t, ok := x.resolve(sc, e, 0, 0)
+	if !ok {
+		return &Schema{}
+	}
+	return x.schemaOf(t, 0)
+}
+
+func isObjectType(e ast.Expr) bool {
+	switch v := e.(type) {
+	case *ast.SelectorExpr:
+		id, ok := v.X.(*ast.Ident)
+		return ok && id.Name == "gin" && v.Sel.Name == "H"
+	case *ast.MapType:
+		key, ok := v.Key.(*ast.Ident)
+		return ok && key.Name == "string"
+	}
+	return false
+}
+
+// schemaOf describes the JSON encoding of a type. Named struct types become
+// components so recursive types terminate.
+func (x *extractor) schemaOf(t typeRef, depth int) *Schema {
+	if depth > maxDepth {
+		return &Schema{}
+	}
+	switch v := t.expr.(type) {
+	case *ast.Ident:
+		if p := x.pkgs[t.pkg]; p != nil && p.types[v.Name] != nil {
+			return x.named(t.pkg, v.Name)
+		}
+		return basicSchema(v.Name)
+	case *ast.SelectorExpr:
+		id, ok := v.X.(*ast.Ident)
+		if !ok {
+			return &Schema{}
+		}
+		switch id.Name + "." + v.Sel.Name {
+		case "time.Time":
+			return &Schema{Type: "string", Format: "date-time"}
+		case "time.Duration":
+			return &Schema{Type: "integer", Format: "int64"}
+		case "gin.H":
+			return &Schema{Type: "object", AdditionalProperties: &Schema{}}
+		case "sql.NullString":
+			return &Schema{Type: "string", Nullable: true}
+		case "sql.NullInt64", "sql.NullInt32":
+			return &Schema{Type: "integer", Nullable: true}
+		case "sql.NullFloat64":
+			return &Schema{Type: "number", Nullable: true}
+		case "sql.NullBool":
+			return &Schema{Type: "boolean", Nullable: true}
+		}
+		if p := x.pkgs[id.Name]; p != nil && p.types[v.Sel.Name] != nil {
+			return x.named(id.Name, v.Sel.Name)
+		}
+		return &Schema{}
+	case *ast.StarExpr:
+		return x.schemaOf(typeRef{pkg: t.pkg, expr: v.X}, depth+1)
+	case *ast.ArrayType:
+		if id, ok := v.Elt.(*ast.Ident); ok && id.Name == "byte" {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: x.schemaOf(typeRef{pkg: t.pkg, expr: v.Elt}, depth+1)}
+	case *ast.MapType:
+		return &Schema{Type: "object", AdditionalProperties: x.schemaOf(typeRef{pkg: t.pkg, expr: v.Value}, depth+1)}
+	case *ast.StructType:
+		return x.structSchema(t.pkg, v, depth+1)
+	case *ast.IndexExpr:
+		return x.schemaOf(typeRef{pkg: t.pkg, expr: v.X}, depth+1)
+	}
+	return &Schema{}
+}
+
+func basicSchema(name string) *Schema {
+	switch name {
+	case "string", "error":
+		return &Schema{Type: "string"}
+	case "bool":
+		return &Schema{Type: "boolean"}
+	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "byte", "rune":
+		return &Schema{Type: "integer"}
+	case "int64", "uint64":
+		return &Schema{Type: "integer", Format: "int64"}
+	case "float32", "float64":
+		return &Schema{Type: "number"}
+	}
+	return &Schema{}
+}
+
+// named returns the schema of a declared type: a component reference for
+// structs, the inlined definition otherwise
+func (x *extractor) named(pkg, name string) *Schema {
+	ts := x.pkgs[pkg].types[name]
+	if _, isStruct := ts.Type.(*ast.StructType); !isStruct {
+		return x.schemaOf(typeRef{pkg: pkg, expr: ts.Type}, 1)
+	}
+	comp := name
+	if x.typeCount[name] > 1 {
+		comp = pkg + "." + name
+	}
+	if _, ok := x.schemas[comp]; !ok {
+		s := &Schema{}
+		x.schemas[comp] = s // placeholder while recursing
+		*s = *x.structSchema(pkg, ts.Type.(*ast.StructType), 0)
+		s.Description = x.pkgs[pkg].typeDoc[name]
+	}
+	return &Schema{Ref: "#/components/schemas/" + comp}
+}
+
+func (x *extractor) structSchema(pkg string, st *ast.StructType, depth int) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, f := range st.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			tag, _ = strconv.Unquote(f.Tag.Value)
+		}
+		tags := reflect.StructTag(tag)
+		jsonName, opts, _ := strings.Cut(tags.Get("json"), ",")
+		if jsonName == "-" && opts == "" {
+			continue
+		}
+		names := f.Names
+		if len(names) == 0 {
+			if jsonName == "" {
+				// embedded struct: its fields are promoted into this object
+				u := x.underlying(typeRef{pkg: pkg, expr: f.Type}, 0)
+				if est, ok := u.expr.(*ast.StructType); ok && depth < maxDepth {
+					inner := x.structSchema(u.pkg, est, depth+1)
+					for k, v := range inner.Properties {
+						s.Properties[k] = v
+					}
+					s.Required = append(s.Required, inner.Required...)
+				}
+				continue
+			}
+			_, typeName := namedType(typeRef{pkg: pkg, expr: f.Type})
+			names = []*ast.Ident{ast.NewIdent(typeName)}
+		}
+		for _, n := range names {
+			if !n.IsExported() {
+				continue
+			}
+			name := jsonName
+			if name == "" {
+				name = n.Name
+			}
+			fs := x.schemaOf(typeRef{pkg: pkg, expr: f.Type}, depth+1)
+			if strings.Contains(opts, "string") {
+				fs = &Schema{Type: "string"}
+			}
+			if doc := fieldDoc(f); doc != "" && fs.Ref == "" {
+				fs.Description = doc
+			}
+			s.Properties[name] = fs
+			if strings.Contains(tags.Get("binding"), "required") {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func fieldDoc(f *ast.Field) string {
+	doc := commentText(f.Doc)
+	if doc == "" {
+		doc = commentText(f.Comment)
+	}
+	return strings.Join(strings.Fields(doc), " ")
+}
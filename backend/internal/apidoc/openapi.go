@@ -0,0 +1,217 @@
+package apidoc
+
+import (
+	"go/token"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Route is one registered endpoint
+type Route struct {
+	Method  string
+	Path    string
+	Handler string // fully qualified handler function name, as gin reports it
+}
+
+// Options describe the served API
+type Options struct {
+	Title    string
+	Version  string
+	BasePath string
+	// Security returns the security requirements of a path; nil keeps the
+	// default (JWT or API key), an empty list marks it public
+	Security func(path string) []map[string][]string
+	// Instance reports handlers that accept the instance selector
+	Instance func(handler string) bool
+}
+
+const schemaRef = "#/components/schemas/"
+
+var nonIdent = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Build returns the OpenAPI 3.0 document describing routes
+func Build(routes []Route, docs *Docs, opts Options) map[string]any {
+	paths := map[string]map[string]any{}
+	opIDs := map[string]int{}
+	for _, r := range routes {
+		path := strings.TrimPrefix(r.Path, opts.BasePath)
+		name := handlerName(r.Handler)
+		op := docs.Operations[name]
+		if op == nil {
+			op = &Operation{Summary: r.Method + " " + path}
+		}
+		opID := name
+		if !token.IsIdentifier(name) {
+			// closures and method values have no docs; name them by route
+			opID = strings.ToLower(r.Method) + nonIdent.ReplaceAllString(path, "_")
+		}
+		opIDs[opID]++
+		if n := opIDs[opID]; n > 1 {
+			opID += strconv.Itoa(n)
+		}
+
+		var security []map[string][]string
+		if opts.Security != nil {
+			security = opts.Security(path)
+		}
+		oaPath, params := pathParams(path)
+		if opts.Instance != nil && opts.Instance(r.Handler) {
+			params = append(params, map[string]any{"$ref": "#/components/parameters/instance"})
+		}
+		for _, q := range op.Query {
+			schema := map[string]any{"type": "string"}
+			if q.Array {
+				schema = map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+			}
+			if q.Default != "" {
+				schema["default"] = q.Default
+			}
+			p := map[string]any{"name": q.Name, "in": "query", "schema": schema}
+			if q.Example != "" {
+				p["example"] = q.Example
+			}
+			params = append(params, p)
+		}
+
+		operation := map[string]any{
+			"operationId": opID,
+			"summary":     op.Summary,
+			"tags":        []string{pathTag(path)},
+			"responses":   responses(op, security != nil),
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if security != nil {
+			operation["security"] = security
+		}
+		if body := requestBody(r.Method, op); body != nil {
+			operation["requestBody"] = body
+		}
+		if paths[oaPath] == nil {
+			paths[oaPath] = map[string]any{}
+		}
+		paths[oaPath][strings.ToLower(r.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": opts.Title, "version": opts.Version},
+		"servers": []map[string]any{{"url": opts.BasePath + "/"}},
+		"paths":   paths,
+		"security": []map[string][]string{
+			{"bearerAuth": {}},
+			{"apiKey": {}},
+		},
+		"components": map[string]any{
+			"schemas": docs.Schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "POST /api/auth/login 返回的 token"},
+				"apiKey":     map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "API_KEY 环境变量"},
+				"embedToken": map[string]any{"type": "apiKey", "in": "header", "name": "X-Embed-Token", "description": "嵌入访问令牌（启用时必填，也可用 ?token= 传递）"},
+			},
+			"parameters": map[string]any{
+				"instance": map[string]any{
+					"name": "instance", "in": "query", "schema": map[string]any{"type": "string"},
+					"description": "多实例部署时选择 New API 实例（也可用 X-Instance 请求头），默认 default",
+				},
+			},
+			"responses": map[string]any{
+				"Error": map[string]any{
+					"description": "错误",
+					"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": schemaRef + docs.ErrorSchema}}},
+				},
+			},
+		},
+	}
+}
+
+// handlerName strips the package path of a gin handler name
+func handlerName(full string) string {
+	if i := strings.LastIndex(full, "/"); i >= 0 {
+		full = full[i+1:]
+	}
+	_, name, _ := strings.Cut(full, ".")
+	return name
+}
+
+// pathParams converts gin's :id / *path segments to OpenAPI {id} templates
+func pathParams(path string) (string, []map[string]any) {
+	segments := strings.Split(path, "/")
+	var params []map[string]any
+	for i, s := range segments {
+		if s == "" || (s[0] != ':' && s[0] != '*') {
+			continue
+		}
+		segments[i] = "{" + s[1:] + "}"
+		params = append(params, map[string]any{
+			"name": s[1:], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// pathTag groups operations by their first path segment below /api
+func pathTag(path string) string {
+	rest := strings.TrimPrefix(path, "/api/")
+	tag, _, _ := strings.Cut(rest, "/")
+	if tag == "" {
+		return "api"
+	}
+	return tag
+}
+
+func requestBody(method string, op *Operation) map[string]any {
+	if method == http.MethodGet || method == http.MethodHead {
+		return nil
+	}
+	if op.Upload != "" {
+		return map[string]any{
+			"required": true,
+			"content": map[string]any{"multipart/form-data": map[string]any{"schema": map[string]any{
+				"type":       "object",
+				"required":   []string{op.Upload},
+				"properties": map[string]any{op.Upload: map[string]any{"type": "string", "format": "binary"}},
+			}}},
+		}
+	}
+	if op.Request == nil {
+		return nil
+	}
+	return map[string]any{
+		"required": true,
+		"content":  map[string]any{"application/json": map[string]any{"schema": op.Request}},
+	}
+}
+
+func responses(op *Operation, public bool) map[string]any {
+	var content map[string]any
+	switch ct := op.ContentType; {
+	case ct == "" || ct == "application/json":
+		schema := op.Response
+		if schema == nil {
+			schema = &Schema{Type: "object", Properties: map[string]*Schema{
+				"success": {Type: "boolean"},
+				"data":    {},
+			}}
+		}
+		content = map[string]any{"application/json": map[string]any{"schema": schema}}
+	case ct == "application/octet-stream":
+		content = map[string]any{ct: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	default:
+		content = map[string]any{ct: map[string]any{"schema": map[string]any{"type": "string"}}}
+	}
+	out := map[string]any{
+		"200":     map[string]any{"description": "成功", "content": content},
+		"default": map[string]any{"$ref": "#/components/responses/Error"},
+	}
+	if !public {
+		out["401"] = map[string]any{"$ref": "#/components/responses/Error"}
+	}
+	return out
+}
@@ -9,6 +9,13 @@ import (
 	"github.com/new-api-tools/backend/internal/config"
 )
 
+// JWT subjects: the admin password logs in as SubjectAdmin, OPERATOR_PASSWORD
+// as SubjectOperator (always served masked data)
+const (
+	SubjectAdmin    = "admin"
+	SubjectOperator = "operator"
+)
+
 // Claims represents the JWT claims
 type Claims struct {
 	jwt.RegisteredClaims
@@ -70,6 +77,15 @@ func VerifyPassword(password string) bool {
 	return subtle.ConstantTimeCompare([]byte(password), []byte(cfg.AdminPassword)) == 1
 }
 
+// VerifyOperatorPassword checks the optional masked-operator password
+func VerifyOperatorPassword(password string) bool {
+	cfg := config.Get()
+	if cfg.OperatorPassword == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(cfg.OperatorPassword)) == 1
+}
+
 // VerifyAPIKey checks if the provided API key is valid
 // Uses constant-time comparison to prevent timing attacks
 func VerifyAPIKey(apiKey string) bool {
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
 	"github.com/new-api-tools/backend/internal/logger"
 	"github.com/new-api-tools/backend/internal/models"
 )
@@ -20,11 +21,17 @@ var SkipPrefixes = []string{
 	"/api/auth/",
 }
 
+// QueryTokenPaths accept the JWT via ?token= because browser EventSource
+// cannot set the Authorization header.
+var QueryTokenPaths = map[string]bool{
+	"/api/events": true,
+}
+
 // AuthMiddleware provides authentication via API Key or JWT Token
 // Matches Python's verify_auth dependency
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Request.URL.Path
+		path := config.StripBasePath(c.Request.URL.Path)
 
 		// Skip authentication for health check endpoints
 		if SkipPaths[path] {
@@ -84,6 +91,19 @@ func AuthMiddleware() gin.HandlerFunc {
 			}
 		}
 
+		// Long-lived stream endpoints: JWT in query string
+		if QueryTokenPaths[path] {
+			if tokenString := c.Query("token"); tokenString != "" {
+				claims, err := ValidateToken(tokenString)
+				if err == nil && claims != nil {
+					c.Set("auth_method", "jwt")
+					c.Set("user_sub", claims.Subject)
+					c.Next()
+					return
+				}
+			}
+		}
+
 		// No authentication provided
 		logger.L.Warn("Missing authentication for request: "+c.Request.Method+" "+path, logger.CatAuth)
 		c.AbortWithStatusJSON(http.StatusUnauthorized, models.NewErrorResponse(
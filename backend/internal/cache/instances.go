@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	instanceMu   sync.RWMutex
+	instanceMgrs = map[string]*Manager{}
+)
+
+// InitInstance registers the cache of an extra New API instance. Keys are
+// prefixed with "inst:<name>:" so instances can safely share one Redis; when
+// connString is empty the primary Redis connection is reused.
+func InitInstance(name, connString string) {
+	m := &Manager{ctx: context.Background(), prefix: fmt.Sprintf("inst:%s:", name)}
+	if connString != "" {
+		opt, err := redis.ParseURL(connString)
+		if err != nil {
+			opt = &redis.Options{Addr: connString}
+		}
+		opt.PoolSize = 5
+		rdb := redis.NewClient(opt)
+		if err := rdb.Ping(m.ctx).Err(); err != nil {
+			logger.L.Warn(fmt.Sprintf("实例 %s Redis 连接失败，改用主 Redis: %v", name, err))
+			_ = rdb.Close()
+		} else {
+			m.rdb = rdb
+		}
+	}
+	if m.rdb == nil && mgr != nil {
+		m.rdb = mgr.rdb
+	}
+	go m.cleanupExpiredEntries()
+
+	instanceMu.Lock()
+	instanceMgrs[name] = m
+	instanceMu.Unlock()
+}
+
+// ForInstance returns the cache manager of an instance; "" / "default" /
+// unknown names resolve to the primary cache.
+func ForInstance(name string) *Manager {
+	if name != "" {
+		instanceMu.RLock()
+		m, ok := instanceMgrs[name]
+		instanceMu.RUnlock()
+		if ok {
+			return m
+		}
+	}
+	return Get()
+}
+
+// CloseInstances closes Redis connections owned by extra instances.
+func CloseInstances() {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+	for name, m := range instanceMgrs {
+		if m.rdb != nil && (mgr == nil || m.rdb != mgr.rdb) {
+			_ = m.rdb.Close()
+		}
+		delete(instanceMgrs, name)
+	}
+}
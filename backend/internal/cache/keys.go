@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SchemaVersion is the shape version of cached query results. Bump it
+// whenever a cached struct/map changes fields, so that after an upgrade the
+// new code never deserializes entries written by the old one (they are
+// simply missed and swept on startup).
+const SchemaVersion = 1
+
+// versionedPrefix is the root of every versioned cache key, e.g.
+// "cache:v1:dashboard:overview:24h". ClearAll removes everything under "cache:".
+const versionedPrefix = "cache:"
+
+// legacyPrefixes are cache keys written before versioning was introduced.
+// Only volatile query caches are listed — config keys such as
+// ai_ban:config or model_status:theme are persistent state and kept.
+var legacyPrefixes = []string{
+	"dashboard:",
+	"topup:",
+	"risk:leaderboards:",
+	"risk:token_rotation:",
+	"risk:affiliated:",
+	"risk:same_ip:",
+	"ip:shared:",
+	"ip:multi_token:",
+	"ip:multi_user:",
+	"redemption:analytics:",
+	"channel_margin:",
+	"channel_routing:",
+	"ai_ban:suspicious:",
+	"ai_ban:models_cache",
+	"analytics:state",
+	"analytics:user_request_ranking",
+	"analytics:user_quota_ranking",
+	"analytics:model_statistics",
+	"model_status:available_models",
+	"model_status:token_groups",
+	"model_status:top_models:",
+	"public_stats:data",
+}
+
+// Key builds a versioned cache key for a query result:
+// Key("dashboard:daily:%d", 7) → "cache:v1:dashboard:daily:7".
+// Use it for anything whose JSON shape can change between releases.
+func Key(format string, args ...interface{}) string {
+	return fmt.Sprintf("%sv%d:%s", versionedPrefix, SchemaVersion, fmt.Sprintf(format, args...))
+}
+
+// isStaleKey reports whether a (non-prefixed) key belongs to another schema
+// version or predates versioning.
+func isStaleKey(key string) bool {
+	if rest, ok := strings.CutPrefix(key, versionedPrefix); ok {
+		return !strings.HasPrefix(rest, fmt.Sprintf("v%d:", SchemaVersion))
+	}
+	for _, p := range legacyPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// SweepStaleKeys deletes Redis cache entries written under another schema
+// version (or before versioning) for the primary and every instance cache.
+// Called once on startup; entries would otherwise linger until their TTL
+// expires.
+func SweepStaleKeys() (int64, error) {
+	managers := []*Manager{Get()}
+	instanceMu.RLock()
+	for _, m := range instanceMgrs {
+		managers = append(managers, m)
+	}
+	instanceMu.RUnlock()
+
+	var total int64
+	for _, m := range managers {
+		n, err := m.sweepStaleKeys()
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (m *Manager) sweepStaleKeys() (int64, error) {
+	if m.rdb == nil {
+		return 0, nil
+	}
+	var deleted int64
+	patterns := []string{versionedPrefix + "*"}
+	for _, p := range legacyPrefixes {
+		patterns = append(patterns, p+"*")
+	}
+	for _, pattern := range patterns {
+		var cursor uint64
+		for {
+			keys, next, err := m.rdb.Scan(m.ctx, cursor, m.prefix+pattern, 200).Result()
+			if err != nil {
+				return deleted, err
+			}
+			var stale []string
+			for _, k := range keys {
+				if isStaleKey(strings.TrimPrefix(k, m.prefix)) {
+					stale = append(stale, k)
+				}
+			}
+			if len(stale) > 0 {
+				n, err := m.rdb.Del(m.ctx, stale...).Result()
+				if err != nil {
+					return deleted, err
+				}
+				deleted += n
+			}
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
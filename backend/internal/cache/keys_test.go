@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeyVersioning(t *testing.T) {
+	if got, want := Key("dashboard:daily:%d", 7), fmt.Sprintf("cache:v%d:dashboard:daily:7", SchemaVersion); got != want {
+		t.Fatalf("Key = %q, want %q", got, want)
+	}
+	for key, stale := range map[string]bool{
+		Key("dashboard:overview:%s", "24h"): false,
+		"cache:v0:dashboard:overview:24h":   true,
+		"dashboard:overview:24h":            true, // 版本化之前写入
+		"model_status:available_models":     true,
+		"model_status:theme":                false, // 配置，不是查询缓存
+		"ai_ban:config":                     false,
+		"ai_ban:models_cache_url":           true,
+	} {
+		if got := isStaleKey(key); got != stale {
+			t.Errorf("isStaleKey(%q) = %v, want %v", key, got, stale)
+		}
+	}
+}
@@ -33,6 +33,7 @@ type Manager struct {
 	rdb        *redis.Client
 	localCache sync.Map // level-1 local cache (stores *localEntry)
 	ctx        context.Context
+	prefix     string // Redis key prefix, "" for the primary instance
 
 	// Stats — use atomic for lock-free incrementing
 	hits   int64
@@ -117,6 +118,11 @@ func Close() error {
 	return nil
 }
 
+// redisKey applies the instance prefix to a Redis key.
+func (m *Manager) redisKey(key string) string {
+	return m.prefix + key
+}
+
 // RedisClient returns the underlying redis client for advanced usage
 func (m *Manager) RedisClient() *redis.Client {
 	return m.rdb
@@ -143,7 +149,7 @@ func (m *Manager) Set(key string, value interface{}, ttl time.Duration) error {
 	if m.rdb == nil {
 		return nil
 	}
-	return m.rdb.Set(m.ctx, key, data, ttl).Err()
+	return m.rdb.Set(m.ctx, m.redisKey(key), data, ttl).Err()
 }
 
 // GetJSON retrieves and deserializes a value from cache
@@ -167,7 +173,7 @@ func (m *Manager) GetJSON(key string, dest interface{}) (bool, error) {
 	}
 
 	// Try Redis
-	data, err := m.rdb.Get(m.ctx, key).Bytes()
+	data, err := m.rdb.Get(m.ctx, m.redisKey(key)).Bytes()
 	if err == redis.Nil {
 		atomic.AddInt64(&m.misses, 1)
 		return false, nil
@@ -193,7 +199,7 @@ func (m *Manager) GetString(key string) (string, bool, error) {
 	if m.rdb == nil {
 		return "", false, nil
 	}
-	val, err := m.rdb.Get(m.ctx, key).Result()
+	val, err := m.rdb.Get(m.ctx, m.redisKey(key)).Result()
 	if err == redis.Nil {
 		return "", false, nil
 	}
@@ -209,7 +215,7 @@ func (m *Manager) Delete(key string) error {
 	if m.rdb == nil {
 		return nil
 	}
-	return m.rdb.Del(m.ctx, key).Err()
+	return m.rdb.Del(m.ctx, m.redisKey(key)).Err()
 }
 
 // DeleteByPrefix removes all keys matching a prefix
@@ -230,7 +236,7 @@ func (m *Manager) DeleteByPrefix(prefix string) (int64, error) {
 	// Clear Redis keys with this prefix
 	var cursor uint64
 	var deleted int64
-	pattern := prefix + "*"
+	pattern := m.prefix + prefix + "*"
 
 	for {
 		keys, nextCursor, err := m.rdb.Scan(m.ctx, cursor, pattern, 100).Result()
@@ -264,7 +270,7 @@ func (m *Manager) Exists(key string) (bool, error) {
 	if m.rdb == nil {
 		return false, nil
 	}
-	n, err := m.rdb.Exists(m.ctx, key).Result()
+	n, err := m.rdb.Exists(m.ctx, m.redisKey(key)).Result()
 	return n > 0, err
 }
 
@@ -339,7 +345,7 @@ func (m *Manager) HSet(key, field string, value interface{}) error {
 	if err != nil {
 		return err
 	}
-	return m.rdb.HSet(m.ctx, key, field, data).Err()
+	return m.rdb.HSet(m.ctx, m.redisKey(key), field, data).Err()
 }
 
 // HGet retrieves a field from a Redis hash
@@ -347,7 +353,7 @@ func (m *Manager) HGet(key, field string, dest interface{}) (bool, error) {
 	if m.rdb == nil {
 		return false, nil
 	}
-	data, err := m.rdb.HGet(m.ctx, key, field).Bytes()
+	data, err := m.rdb.HGet(m.ctx, m.redisKey(key), field).Bytes()
 	if err == redis.Nil {
 		return false, nil
 	}
@@ -362,7 +368,7 @@ func (m *Manager) HGetString(key, field string) (string, bool, error) {
 	if m.rdb == nil {
 		return "", false, nil
 	}
-	val, err := m.rdb.HGet(m.ctx, key, field).Result()
+	val, err := m.rdb.HGet(m.ctx, m.redisKey(key), field).Result()
 	if err == redis.Nil {
 		return "", false, nil
 	}
@@ -377,7 +383,7 @@ func (m *Manager) HDel(key string, fields ...string) error {
 	if m.rdb == nil {
 		return nil
 	}
-	return m.rdb.HDel(m.ctx, key, fields...).Err()
+	return m.rdb.HDel(m.ctx, m.redisKey(key), fields...).Err()
 }
 
 // HGetAll retrieves all fields from a Redis hash
@@ -385,7 +391,7 @@ func (m *Manager) HGetAll(key string) (map[string]string, error) {
 	if m.rdb == nil {
 		return map[string]string{}, nil
 	}
-	return m.rdb.HGetAll(m.ctx, key).Result()
+	return m.rdb.HGetAll(m.ctx, m.redisKey(key)).Result()
 }
 
 // ========== Convenience wrappers for handlers ==========
@@ -422,7 +428,7 @@ func (m *Manager) HashDelete(key, field string) (bool, error) {
 	if m.rdb == nil {
 		return false, nil
 	}
-	n, err := m.rdb.HDel(m.ctx, key, field).Result()
+	n, err := m.rdb.HDel(m.ctx, m.redisKey(key), field).Result()
 	return n > 0, err
 }
 
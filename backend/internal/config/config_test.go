@@ -0,0 +1,79 @@
+package config
+
+import "testing"
+
+func TestNormalizeBasePath(t *testing.T) {
+	cases := map[string]string{
+		"":         "",
+		"/":        "",
+		"tools":    "/tools",
+		"/tools/":  "/tools",
+		" /a/b// ": "/a/b",
+	}
+	for in, want := range cases {
+		if got := normalizeBasePath(in); got != want {
+			t.Errorf("normalizeBasePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStripBasePath(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("BASE_PATH", "/tools/")
+	Load()
+	defer func() { cfg = nil }()
+
+	cases := map[string]string{
+		"/tools/api/health": "/api/health",
+		"/tools":            "/",
+		"/toolsx/api":       "/toolsx/api",
+		"/api/health":       "/api/health",
+	}
+	for in, want := range cases {
+		if got := StripBasePath(in); got != want {
+			t.Errorf("StripBasePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReplicaDSN(t *testing.T) {
+	t.Setenv("SQL_DSN", "mysql://u:p@tcp(primary:3306)/newapi")
+	t.Setenv("REPLICA_SQL_DSN", "")
+	c := Load()
+	defer func() { cfg = nil }()
+	if c.HasReplica() || c.ReplicaDSN() != "u:p@tcp(primary:3306)/newapi" {
+		t.Fatalf("no replica configured: HasReplica=%v ReplicaDSN=%q", c.HasReplica(), c.ReplicaDSN())
+	}
+
+	t.Setenv("REPLICA_SQL_DSN", "mysql://u:p@tcp(replica:3306)/newapi")
+	c = Load()
+	if !c.HasReplica() || c.ReplicaDSN() != "u:p@tcp(replica:3306)/newapi" || c.ReplicaDriverName() != "mysql" {
+		t.Fatalf("replica: HasReplica=%v ReplicaDSN=%q driver=%q", c.HasReplica(), c.ReplicaDSN(), c.ReplicaDriverName())
+	}
+
+	// same DSN as the primary is not a separate replica
+	t.Setenv("REPLICA_SQL_DSN", "mysql://u:p@tcp(primary:3306)/newapi")
+	if Load().HasReplica() {
+		t.Fatal("a replica DSN equal to SQL_DSN should be ignored")
+	}
+}
+
+func TestLoadLogTypes(t *testing.T) {
+	defer func() { cfg = nil }()
+	if LogTypes() != DefaultLogTypes {
+		t.Fatalf("before Load: %+v", LogTypes())
+	}
+
+	t.Setenv("LOG_TYPE_ERROR", "3")
+	t.Setenv("LOG_TYPE_MANAGE", "7")
+	Load()
+	if got := LogTypes(); got.Error != 3 || got.Manage != 7 || got.Consume != 2 {
+		t.Fatalf("custom mapping: %+v", got)
+	}
+
+	// error collides with manage → defaults
+	t.Setenv("LOG_TYPE_MANAGE", "3")
+	if got := Load().LogTypes; got != DefaultLogTypes {
+		t.Fatalf("duplicate codes should fall back to defaults, got %+v", got)
+	}
+}
@@ -19,6 +19,9 @@ type Manager struct {
 	DB     *sqlx.DB
 	Config *config.Config
 	IsPG   bool
+	Name   string // main | log | replica | <instance>，用于慢查询日志
+
+	ctx context.Context // 请求上下文，见 WithContext；nil = context.Background()
 }
 
 // Global database manager
@@ -29,6 +32,15 @@ var mgr *Manager
 // `logs` table go through GetLog(); everything else uses Get().
 var logMgr *Manager
 
+// Read-only managers for heavy analytics SELECTs. replicaMgr points at the
+// read replica (REPLICA_SQL_DSN) when configured, otherwise aliases mgr.
+// readLogMgr follows the replica as well when logs live in the main DB.
+// Writes (bans, group changes, ...) must always go through Get().
+var (
+	replicaMgr *Manager
+	readLogMgr *Manager
+)
+
 // Init creates and configures the database connection pool
 func Init(cfg *config.Config) (*Manager, error) {
 	driverName := cfg.DriverName()
@@ -63,7 +75,9 @@ func Init(cfg *config.Config) (*Manager, error) {
 		DB:     db,
 		Config: cfg,
 		IsPG:   isPG,
+		Name:   "main",
 	}
+	ConfigureQueryLimits(cfg)
 
 	// Log connection info
 	engineStr := "MySQL"
@@ -76,6 +90,7 @@ func Init(cfg *config.Config) (*Manager, error) {
 	if err := initLogDB(cfg, maxOpen, maxIdle); err != nil {
 		return nil, err
 	}
+	initReplicaDB(cfg, maxOpen, maxIdle)
 
 	return mgr, nil
 }
@@ -113,6 +128,7 @@ func initLogDB(cfg *config.Config, maxOpen, maxIdle int) error {
 		DB:     db,
 		Config: cfg,
 		IsPG:   isPG,
+		Name:   "log",
 	}
 
 	engineStr := "MySQL"
@@ -124,6 +140,48 @@ func initLogDB(cfg *config.Config, maxOpen, maxIdle int) error {
 	return nil
 }
 
+// initReplicaDB sets up replicaMgr/readLogMgr. Without REPLICA_SQL_DSN both
+// alias the primary managers. A replica that cannot be reached is never fatal:
+// reads simply stay on the primary.
+func initReplicaDB(cfg *config.Config, maxOpen, maxIdle int) {
+	replicaMgr = mgr
+	readLogMgr = logMgr
+	if !cfg.HasReplica() {
+		return
+	}
+
+	dsn := cfg.ReplicaDSN()
+	db, err := sqlx.Connect(cfg.ReplicaDriverName(), dsn)
+	if err != nil {
+		logger.L.Warn(fmt.Sprintf("只读副本连接失败，分析查询将继续使用主库: %v", err), logger.CatSystem)
+		return
+	}
+
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxIdleTime(3 * time.Minute)
+
+	isPG := cfg.ReplicaDatabaseEngine == config.PostgreSQL
+	replicaMgr = &Manager{
+		DB:     db,
+		Config: cfg,
+		IsPG:   isPG,
+		Name:   "replica",
+	}
+	// The replica mirrors the main DB, so it also carries logs unless they
+	// were split off to a dedicated log database.
+	if logMgr == mgr {
+		readLogMgr = replicaMgr
+	}
+
+	engineStr := "MySQL"
+	if isPG {
+		engineStr = "PostgreSQL"
+	}
+	logger.L.DBConnected(engineStr+" [只读副本]", extractHost(dsn), extractDB(dsn))
+}
+
 // Get returns the global database manager
 func Get() *Manager {
 	if mgr == nil {
@@ -143,16 +201,40 @@ func GetLog() *Manager {
 	return logMgr
 }
 
+// GetRead returns the manager for read-only analytics queries: the read replica
+// when REPLICA_SQL_DSN is configured, otherwise the main manager. Never write
+// through it.
+func GetRead() *Manager {
+	if replicaMgr == nil {
+		return Get()
+	}
+	return replicaMgr
+}
+
+// GetReadLog is the read-only counterpart of GetLog: the read replica when logs
+// live in the main DB and a replica is configured, otherwise GetLog().
+func GetReadLog() *Manager {
+	if readLogMgr == nil {
+		return GetLog()
+	}
+	return readLogMgr
+}
+
 // SetForTesting overrides the package-level manager. Tests use this to inject
 // an in-memory SQLite backend or a stub Manager — production code never calls it.
 func SetForTesting(m *Manager) {
 	mgr = m
 	logMgr = m
+	replicaMgr = m
+	readLogMgr = m
 }
 
 // Close closes the database connection(s)
 func Close() error {
-	// Close the dedicated log DB first if it is a distinct connection.
+	// Close the read replica and the dedicated log DB first if they are distinct connections.
+	if replicaMgr != nil && replicaMgr != mgr && replicaMgr.DB != nil {
+		_ = replicaMgr.DB.Close()
+	}
 	if logMgr != nil && logMgr != mgr && logMgr.DB != nil {
 		_ = logMgr.DB.Close()
 	}
@@ -163,23 +245,54 @@ func Close() error {
 	return nil
 }
 
+// WithContext returns a copy of m whose queries are bound to ctx: a client
+// that disconnects or a request that times out cancels the running query.
+// The copy shares the connection pool with m.
+func (m *Manager) WithContext(ctx context.Context) *Manager {
+	if m == nil || ctx == nil {
+		return m
+	}
+	c := *m
+	c.ctx = ctx
+	return &c
+}
+
+// Context returns the context queries run under, for direct sqlx calls
+// (SelectContext, BeginTxx, ...)
+func (m *Manager) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
 // Ping checks the database connection
 func (m *Manager) Ping() error {
-	return m.DB.Ping()
+	return m.DB.PingContext(m.Context())
 }
 
-// QueryWithTimeout executes a query with a context timeout
-func (m *Manager) QueryWithTimeout(timeout time.Duration, query string, args ...interface{}) ([]map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// QueryWithTimeout executes a heavy query with a context timeout. It waits
+// for a slot of the heavy query limiter (DB_MAX_HEAVY_QUERIES) within the
+// same timeout and is recorded in the slow query log.
+func (m *Manager) QueryWithTimeout(timeout time.Duration, query string, args ...interface{}) (results []map[string]interface{}, err error) {
+	ctx, cancel := context.WithTimeout(m.Context(), timeout)
 	defer cancel()
 
+	queued := time.Now()
+	release, err := acquireHeavy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	start := time.Now()
+	defer func() { m.observeQuery(query, args, start.Sub(queued), time.Since(start), len(results), err) }()
+
 	rows, err := m.DB.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []map[string]interface{}
 	for rows.Next() {
 		row := make(map[string]interface{})
 		if err := rows.MapScan(row); err != nil {
@@ -197,14 +310,16 @@ func (m *Manager) QueryWithTimeout(timeout time.Duration, query string, args ...
 }
 
 // Query executes a query that returns rows
-func (m *Manager) Query(query string, args ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := m.DB.Queryx(query, args...)
+func (m *Manager) Query(query string, args ...interface{}) (results []map[string]interface{}, err error) {
+	start := time.Now()
+	defer func() { m.observeQuery(query, args, 0, time.Since(start), len(results), err) }()
+
+	rows, err := m.DB.QueryxContext(m.Context(), query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []map[string]interface{}
 	for rows.Next() {
 		row := make(map[string]interface{})
 		if err := rows.MapScan(row); err != nil {
@@ -247,8 +362,11 @@ func (m *Manager) QueryOneWithTimeout(timeout time.Duration, query string, args
 }
 
 // Execute runs a query that doesn't return rows (INSERT, UPDATE, DELETE)
-func (m *Manager) Execute(query string, args ...interface{}) (int64, error) {
-	result, err := m.DB.Exec(query, args...)
+func (m *Manager) Execute(query string, args ...interface{}) (n int64, err error) {
+	start := time.Now()
+	defer func() { m.observeQuery(query, args, 0, time.Since(start), int(n), err) }()
+
+	result, err := m.DB.ExecContext(m.Context(), query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -260,7 +378,7 @@ func (m *Manager) Execute(query string, args ...interface{}) (int64, error) {
 func (m *Manager) ExecuteDDL(query string) error {
 	if m.IsPG {
 		// PostgreSQL DDL with CONCURRENTLY needs its own connection
-		ctx := context.Background()
+		ctx := m.Context()
 		conn, err := m.DB.DB.Conn(ctx)
 		if err != nil {
 			return err
@@ -270,7 +388,7 @@ func (m *Manager) ExecuteDDL(query string) error {
 		return err
 	}
 
-	_, err := m.DB.Exec(query)
+	_, err := m.DB.ExecContext(m.Context(), query)
 	return err
 }
 
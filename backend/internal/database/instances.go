@@ -0,0 +1,162 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// DefaultInstance is the name of the primary instance (SQL_DSN / LOG_SQL_DSN).
+const DefaultInstance = "default"
+
+// instanceMaxOpenConns keeps extra instances on a smaller pool than the primary.
+const instanceMaxOpenConns = 10
+
+// instance holds the connections of one extra New API deployment.
+type instance struct {
+	name  string
+	main  *Manager
+	log   *Manager
+	err   string
+	ready bool
+}
+
+var (
+	instancesMu sync.RWMutex
+	instances   = map[string]*instance{}
+)
+
+// InitInstances connects every extra instance from cfg.Instances. A failing
+// instance is kept in the registry (marked unavailable) instead of aborting startup.
+func InitInstances(cfg *config.Config) {
+	for _, ic := range cfg.Instances {
+		inst := &instance{name: ic.Name}
+		mainMgr, err := openInstanceManager(cfg, ic.Engine(), ic.DSN())
+		if err != nil {
+			inst.err = err.Error()
+			logger.L.Warn(fmt.Sprintf("实例 %s 数据库连接失败: %v", ic.Name, err), logger.CatSystem)
+		} else {
+			mainMgr.Name = ic.Name
+			inst.main = mainMgr
+			inst.log = mainMgr
+			inst.ready = true
+			if ic.LogSQLDSN != "" && ic.LogSQLDSN != ic.SQLDSN {
+				if logMgr, err := openInstanceManager(cfg, ic.LogEngine(), ic.LogDSN()); err != nil {
+					logger.L.Warn(fmt.Sprintf("实例 %s 日志库连接失败，已降级为读取主库: %v", ic.Name, err), logger.CatSystem)
+				} else {
+					logMgr.Name = ic.Name + "/log"
+					inst.log = logMgr
+				}
+			}
+			logger.L.System(fmt.Sprintf("实例 %s 已连接", ic.Name))
+		}
+
+		instancesMu.Lock()
+		instances[ic.Name] = inst
+		instancesMu.Unlock()
+	}
+}
+
+func openInstanceManager(cfg *config.Config, engine config.DatabaseEngine, dsn string) (*Manager, error) {
+	driverName := "mysql"
+	if engine == config.PostgreSQL {
+		driverName = "pgx"
+	}
+	db, err := sqlx.Connect(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(instanceMaxOpenConns)
+	db.SetMaxIdleConns(instanceMaxOpenConns / 2)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxIdleTime(3 * time.Minute)
+	return &Manager{DB: db, Config: cfg, IsPG: engine == config.PostgreSQL}, nil
+}
+
+// HasInstance reports whether name is the primary or a registered, connected instance.
+func HasInstance(name string) bool {
+	if name == "" || name == DefaultInstance {
+		return true
+	}
+	instancesMu.RLock()
+	defer instancesMu.RUnlock()
+	inst, ok := instances[name]
+	return ok && inst.ready
+}
+
+// ForInstance returns the main and log managers of an instance.
+// "" / "default" / unknown names resolve to the primary instance.
+func ForInstance(name string) (*Manager, *Manager) {
+	if name != "" && name != DefaultInstance {
+		instancesMu.RLock()
+		inst, ok := instances[name]
+		instancesMu.RUnlock()
+		if ok && inst.ready {
+			return inst.main, inst.log
+		}
+	}
+	return Get(), GetLog()
+}
+
+// ForInstanceRead is ForInstance for read-only analytics: the primary instance
+// is served by the read replica (see GetRead); registered instances have no
+// replica and return their own managers.
+func ForInstanceRead(name string) (*Manager, *Manager) {
+	if name != "" && name != DefaultInstance {
+		instancesMu.RLock()
+		inst, ok := instances[name]
+		instancesMu.RUnlock()
+		if ok && inst.ready {
+			return inst.main, inst.log
+		}
+	}
+	return GetRead(), GetReadLog()
+}
+
+// ListInstances returns the registry (primary first) for the instance selector.
+func ListInstances() []map[string]interface{} {
+	result := []map[string]interface{}{{
+		"name":      DefaultInstance,
+		"available": mgr != nil,
+		"is_pg":     mgr != nil && mgr.IsPG,
+		"error":     "",
+	}}
+
+	instancesMu.RLock()
+	names := make([]string, 0, len(instances))
+	for name := range instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		inst := instances[name]
+		result = append(result, map[string]interface{}{
+			"name":      inst.name,
+			"available": inst.ready,
+			"is_pg":     inst.main != nil && inst.main.IsPG,
+			"error":     inst.err,
+		})
+	}
+	instancesMu.RUnlock()
+	return result
+}
+
+// CloseInstances closes all extra instance connections.
+func CloseInstances() {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	for name, inst := range instances {
+		if inst.log != nil && inst.log != inst.main && inst.log.DB != nil {
+			_ = inst.log.DB.Close()
+		}
+		if inst.main != nil && inst.main.DB != nil {
+			_ = inst.main.DB.Close()
+		}
+		delete(instances, name)
+	}
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	slowQueryBufferSize = 200
+	slowQueryMaxSQLLen  = 2000
+	slowQueryMaxArgLen  = 200
+)
+
+// SlowQuery is one query that ran longer than the slow query threshold
+type SlowQuery struct {
+	At         int64    `json:"at"`
+	Database   string   `json:"database"` // main | log | replica | <instance>
+	SQL        string   `json:"sql"`
+	Args       []string `json:"args"`
+	DurationMs int64    `json:"duration_ms"`
+	WaitMs     int64    `json:"wait_ms"` // 排队等待重查询名额的时间
+	Rows       int      `json:"rows"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// QueryLimiterStats describes the heavy query limiter and slow query log
+type QueryLimiterStats struct {
+	MaxHeavyQueries int   `json:"max_heavy_queries"` // 0 = 不限制
+	InFlight        int   `json:"in_flight"`
+	Waiting         int   `json:"waiting"`
+	Rejected        int64 `json:"rejected"`      // 排队超时未执行的查询数
+	SlowQueryMs     int   `json:"slow_query_ms"` // 0 = 不记录
+	SlowTotal       int64 `json:"slow_total"`
+}
+
+// queryStats holds the heavy query semaphore and the slow query ring buffer.
+// Heavy queries are the ones run through QueryWithTimeout (dashboard,
+// analytics, risk scans); short lookups and writes are never queued.
+var queryStats = struct {
+	sync.Mutex
+	sem       chan struct{}
+	maxHeavy  int
+	waiting   int
+	rejected  int64
+	slowMs    int
+	slowTotal int64
+	slow      []SlowQuery
+	next      int
+}{slowMs: 2000}
+
+// ConfigureQueryLimits applies DB_MAX_HEAVY_QUERIES and SLOW_QUERY_MS
+func ConfigureQueryLimits(cfg *config.Config) {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	queryStats.maxHeavy = cfg.DBMaxHeavyQueries
+	queryStats.sem = nil
+	if cfg.DBMaxHeavyQueries > 0 {
+		queryStats.sem = make(chan struct{}, cfg.DBMaxHeavyQueries)
+	}
+	queryStats.slowMs = cfg.SlowQueryMs
+}
+
+// acquireHeavy waits for a heavy query slot until ctx is done. The returned
+// release func must be called once the query has finished.
+func acquireHeavy(ctx context.Context) (func(), error) {
+	queryStats.Lock()
+	sem := queryStats.sem
+	if sem == nil {
+		queryStats.Unlock()
+		return func() {}, nil
+	}
+	queryStats.waiting++
+	queryStats.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		queryStats.Lock()
+		queryStats.waiting--
+		queryStats.Unlock()
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		queryStats.Lock()
+		queryStats.waiting--
+		queryStats.rejected++
+		queryStats.Unlock()
+		return nil, fmt.Errorf("等待重查询名额超时（DB_MAX_HEAVY_QUERIES=%d）: %w", cap(sem), ctx.Err())
+	}
+}
+
+// observeQuery records q in the slow query log when it ran past the threshold
+func (m *Manager) observeQuery(query string, args []interface{}, wait, took time.Duration, rows int, err error) {
+	queryStats.Lock()
+	threshold := queryStats.slowMs
+	queryStats.Unlock()
+	if threshold <= 0 || took < time.Duration(threshold)*time.Millisecond {
+		return
+	}
+
+	entry := SlowQuery{
+		At:         time.Now().Unix(),
+		Database:   m.Name,
+		SQL:        compactSQL(query),
+		Args:       formatQueryArgs(args),
+		DurationMs: took.Milliseconds(),
+		WaitMs:     wait.Milliseconds(),
+		Rows:       rows,
+	}
+	if entry.Database == "" {
+		entry.Database = "main"
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	queryStats.Lock()
+	if len(queryStats.slow) < slowQueryBufferSize {
+		queryStats.slow = append(queryStats.slow, entry)
+	} else {
+		queryStats.slow[queryStats.next] = entry
+	}
+	queryStats.next = (queryStats.next + 1) % slowQueryBufferSize
+	queryStats.slowTotal++
+	queryStats.Unlock()
+
+	logger.L.Warn(fmt.Sprintf("慢查询 %dms [%s]: %s", entry.DurationMs, entry.Database, truncate(entry.SQL, 200)), logger.CatDatabase)
+}
+
+// SlowQueries returns up to limit recent slow queries, newest first
+func SlowQueries(limit int) []SlowQuery {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	n := len(queryStats.slow)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]SlowQuery, 0, limit)
+	for i := 1; i <= limit; i++ {
+		out = append(out, queryStats.slow[(queryStats.next-i+n)%n])
+	}
+	return out
+}
+
+// ManagerByName resolves the Database of a SlowQuery (main | log | replica |
+// <instance> | <instance>/log) back to its manager, nil if it is unknown or
+// no longer connected
+func ManagerByName(name string) *Manager {
+	switch name {
+	case "", "main":
+		return Get()
+	case "log":
+		return GetLog()
+	case "replica":
+		return GetRead()
+	}
+	inst, isLog := strings.CutSuffix(name, "/log")
+	if !HasInstance(inst) {
+		return nil
+	}
+	main, log := ForInstance(inst)
+	if isLog {
+		return log
+	}
+	return main
+}
+
+// ClearSlowQueries empties the slow query log
+func ClearSlowQueries() {
+	queryStats.Lock()
+	queryStats.slow = nil
+	queryStats.next = 0
+	queryStats.Unlock()
+}
+
+// QueryLimits returns the current limiter and slow query counters
+func QueryLimits() QueryLimiterStats {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	return QueryLimiterStats{
+		MaxHeavyQueries: queryStats.maxHeavy,
+		InFlight:        len(queryStats.sem),
+		Waiting:         queryStats.waiting,
+		Rejected:        queryStats.rejected,
+		SlowQueryMs:     queryStats.slowMs,
+		SlowTotal:       queryStats.slowTotal,
+	}
+}
+
+func compactSQL(query string) string {
+	return truncate(strings.Join(strings.Fields(query), " "), slowQueryMaxSQLLen)
+}
+
+func formatQueryArgs(args []interface{}) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		if b, ok := a.([]byte); ok {
+			a = string(b)
+		}
+		out[i] = truncate(fmt.Sprintf("%v", a), slowQueryMaxArgLen)
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
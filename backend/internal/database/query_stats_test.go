@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+	_ "modernc.org/sqlite"
+)
+
+func TestHeavyQueryLimiter(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	m := &Manager{DB: db, Name: "main"}
+
+	ConfigureQueryLimits(&config.Config{DBMaxHeavyQueries: 1, SlowQueryMs: 2000})
+	defer ConfigureQueryLimits(&config.Config{SlowQueryMs: 2000})
+
+	release, err := acquireHeavy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.QueryWithTimeout(50*time.Millisecond, `SELECT 1 AS n`); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("query should time out waiting for the only slot, got %v", err)
+	}
+	if stats := QueryLimits(); stats.InFlight != 1 || stats.Rejected != 1 || stats.Waiting != 0 {
+		t.Fatalf("unexpected limiter stats %+v", stats)
+	}
+	release()
+
+	rows, err := m.QueryWithTimeout(time.Second, `SELECT 1 AS n`)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("query after release = %v, %v", rows, err)
+	}
+	if stats := QueryLimits(); stats.InFlight != 0 {
+		t.Fatalf("slot should be released after the query, got %+v", stats)
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	logger.Init("error", "")
+	ConfigureQueryLimits(&config.Config{SlowQueryMs: 100})
+	defer ConfigureQueryLimits(&config.Config{SlowQueryMs: 2000})
+	ClearSlowQueries()
+	defer ClearSlowQueries()
+
+	m := &Manager{Name: "replica"}
+	m.observeQuery("SELECT 1", nil, 0, 50*time.Millisecond, 1, nil)
+	if got := SlowQueries(10); len(got) != 0 {
+		t.Fatalf("fast query should not be logged, got %+v", got)
+	}
+
+	for i := 0; i < slowQueryBufferSize+5; i++ {
+		m.observeQuery(fmt.Sprintf("SELECT *\n\t FROM logs WHERE id > ? -- %d", i), []interface{}{int64(i), []byte("x")},
+			10*time.Millisecond, 150*time.Millisecond, 3, nil)
+	}
+	got := SlowQueries(0)
+	if len(got) != slowQueryBufferSize {
+		t.Fatalf("ring buffer should hold %d entries, got %d", slowQueryBufferSize, len(got))
+	}
+	last := got[0]
+	if last.SQL != fmt.Sprintf("SELECT * FROM logs WHERE id > ? -- %d", slowQueryBufferSize+4) ||
+		last.Database != "replica" || last.DurationMs != 150 || last.WaitMs != 10 ||
+		len(last.Args) != 2 || last.Args[0] != fmt.Sprint(slowQueryBufferSize+4) || last.Args[1] != "x" {
+		t.Fatalf("unexpected newest entry %+v", last)
+	}
+	if oldest := got[len(got)-1]; oldest.SQL != "SELECT * FROM logs WHERE id > ? -- 5" {
+		t.Fatalf("oldest entries should be overwritten, got %q", oldest.SQL)
+	}
+}
+
+func TestManagerWithContextCancelsQueries(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := &Manager{DB: db, Name: "main"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := m.WithContext(ctx)
+	if _, err := bound.Query(`SELECT 1 AS n`); err != nil {
+		t.Fatalf("query with a live context: %v", err)
+	}
+	cancel()
+	if _, err := bound.Query(`SELECT 1 AS n`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("query after cancel should fail with context.Canceled, got %v", err)
+	}
+	if _, err := bound.QueryWithTimeout(time.Second, `SELECT 1 AS n`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("timeout query should inherit the cancellation, got %v", err)
+	}
+	if _, err := m.Query(`SELECT 1 AS n`); err != nil || m.Context() != context.Background() {
+		t.Fatalf("the shared manager must stay unbound, got %v", err)
+	}
+}
@@ -13,12 +13,14 @@ import (
 //
 //	GET /api/users/affiliate-stats          —— 按 inviter_id 聚合的分页列表
 //	GET /api/users/affiliate-stats/summary  —— 顶部统计卡片所需的整体汇总
+//	GET /api/users/aff-performance          —— 按邀请码聚合的被邀请用户表现
 func RegisterAffiliateStatsRoutes(r *gin.RouterGroup) {
 	g := r.Group("/users/affiliate-stats")
 	{
 		g.GET("", ListAffiliateStats)
 		g.GET("/summary", GetAffiliateStatsSummary)
 	}
+	r.GET("/users/aff-performance", ListAffPerformance)
 }
 
 func parseAffiliateParams(c *gin.Context) service.AffiliateStatsParams {
@@ -38,7 +40,7 @@ func parseAffiliateParams(c *gin.Context) service.AffiliateStatsParams {
 // GET /api/users/affiliate-stats
 func ListAffiliateStats(c *gin.Context) {
 	params := parseAffiliateParams(c)
-	result, err := service.ListAffiliateStats(params)
+	result, err := service.ListAffiliateStats(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -52,7 +54,7 @@ func ListAffiliateStats(c *gin.Context) {
 // GET /api/users/affiliate-stats/summary
 func GetAffiliateStatsSummary(c *gin.Context) {
 	params := parseAffiliateParams(c)
-	summary, err := service.GetAffiliateStatsSummary(params)
+	summary, err := service.GetAffiliateStatsSummary(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -62,3 +64,26 @@ func GetAffiliateStatsSummary(c *gin.Context) {
 		"data":    summary,
 	})
 }
+
+// GET /api/users/aff-performance
+func ListAffPerformance(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	minSignups, _ := strconv.ParseInt(c.DefaultQuery("min_signups", "0"), 10, 64)
+	result, err := service.ListAffPerformance(c.Request.Context(), service.AffPerformanceParams{
+		Page:       page,
+		PageSize:   pageSize,
+		Search:     c.Query("search"),
+		MinSignups: minSignups,
+		SortBy:     c.Query("sort_by"),
+		SortDir:    c.Query("sort_dir"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/new-api-tools/backend/internal/models"
 	"github.com/new-api-tools/backend/internal/service"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // RegisterAIAutoBanRoutes registers /api/ai-ban endpoints
@@ -18,6 +22,8 @@ func RegisterAIAutoBanRoutes(r *gin.RouterGroup) {
 		g.POST("/reset-api-health", ResetAPIHealth)
 		g.GET("/audit-logs", GetAuditLogs)
 		g.DELETE("/audit-logs", ClearAuditLogs)
+		g.POST("/audit-logs/:id/false-positive", MarkAIBanFalsePositive)
+		g.GET("/false-positives", ListAIBanFalsePositives)
 		g.GET("/groups", GetAvailableGroupsForBan)
 		g.GET("/available-groups", GetAvailableGroupsForBan)
 		g.GET("/models", GetAvailableModelsForExclude)
@@ -26,11 +32,16 @@ func RegisterAIAutoBanRoutes(r *gin.RouterGroup) {
 		g.GET("/suspicious-users", GetSuspiciousUsers)
 		g.POST("/assess", ManualAssess)
 		g.POST("/scan", RunAIBanScan)
+		g.POST("/simulate", SimulateAIBan)
 		g.POST("/test-connection", TestAIConnection)
 		g.GET("/whitelist", GetAIBanWhitelist)
 		g.POST("/whitelist/add", AddToAIBanWhitelist)
 		g.POST("/whitelist/remove", RemoveFromAIBanWhitelist)
 		g.GET("/whitelist/search", SearchUserForAIWhitelist)
+		g.GET("/whitelist/check/:user_id", CheckAIBanWhitelist)
+		g.POST("/whitelist/import", ImportAIBanWhitelist)
+		g.POST("/whitelist/rules/add", AddAIBanWhitelistRule)
+		g.POST("/whitelist/rules/remove", RemoveAIBanWhitelistRule)
 		// Model fetching / testing
 		g.POST("/models", FetchAIModels)       // 前端实际调用的路径
 		g.POST("/fetch-models", FetchAIModels) // 保持向后兼容
@@ -40,20 +51,24 @@ func RegisterAIAutoBanRoutes(r *gin.RouterGroup) {
 
 // GET /api/ai-ban/config
 func GetAIBanConfig(c *gin.Context) {
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": svc.GetConfig()})
 }
 
 // POST /api/ai-ban/config
+//
+// 请求体可带 version（GET 时读到的版本号），期间已被他人保存则返回 409 与 current_version。
 func SaveAIBanConfig(c *gin.Context) {
 	var req map[string]interface{}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
 		return
 	}
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	if err := svc.SaveConfig(req); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResp("SAVE_ERROR", err.Error(), ""))
+		if !respondConfigConflict(c, err) {
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("SAVE_ERROR", err.Error(), ""))
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -65,7 +80,7 @@ func SaveAIBanConfig(c *gin.Context) {
 
 // POST /api/ai-ban/reset-api-health
 func ResetAPIHealth(c *gin.Context) {
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.ResetAPIHealth()
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
@@ -79,22 +94,69 @@ func GetAuditLogs(c *gin.Context) {
 	}
 	status := c.Query("status")
 
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.GetAuditLogs(limit, offset, status)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
 // DELETE /api/ai-ban/audit-logs
 func ClearAuditLogs(c *gin.Context) {
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.ClearAuditLogs()
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
+// POST /api/ai-ban/audit-logs/:id/false-positive
+//
+// 将审查记录中的一个用户标记为误判：解封、加入白名单（附原因）并留存案例供提示词引用。
+func MarkAIBanFalsePositive(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid audit log ID", ""))
+		return
+	}
+	var req service.FalsePositiveInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	fp, err := svc.MarkFalsePositive(c.Request.Context(), id, req, operatorIdentity(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidFalsePositive):
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		case errors.Is(err, service.ErrAuditLogNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", err.Error(), ""))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("FALSE_POSITIVE_ERROR", err.Error(), ""))
+		}
+		return
+	}
+	setAuditDetail(c, "audit_log=%d user=%d reason=%s", id, fp.UserID, fp.Reason)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": fp})
+}
+
+// GET /api/ai-ban/false-positives
+func ListAIBanFalsePositives(c *gin.Context) {
+	limit := parseLimit(c, 50, 200)
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	items, total, err := svc.ListFalsePositives(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": total}})
+}
+
 // GET /api/ai-ban/groups
 func GetAvailableGroupsForBan(c *gin.Context) {
 	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data, err := svc.GetAvailableGroups(days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -106,7 +168,7 @@ func GetAvailableGroupsForBan(c *gin.Context) {
 // GET /api/ai-ban/models
 func GetAvailableModelsForExclude(c *gin.Context) {
 	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data, err := svc.GetAvailableModelsForExclude(days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -124,7 +186,7 @@ func GetSuspiciousUsers(c *gin.Context) {
 	}
 	limit := parseLimit(c, 20, 200)
 
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data, err := svc.GetSuspiciousUsers(window, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -135,10 +197,7 @@ func GetSuspiciousUsers(c *gin.Context) {
 
 // POST /api/ai-ban/assess
 func ManualAssess(c *gin.Context) {
-	var req struct {
-		UserID int64  `json:"user_id"`
-		Window string `json:"window"`
-	}
+	var req api.AssessRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
@@ -146,7 +205,7 @@ func ManualAssess(c *gin.Context) {
 	if req.Window == "" {
 		req.Window = "1h"
 	}
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.ManualAssess(req.UserID, req.Window)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
@@ -160,53 +219,152 @@ func RunAIBanScan(c *gin.Context) {
 	}
 	limit := parseLimit(c, 10, 100)
 
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.RunScan(window, limit)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
+// POST /api/ai-ban/simulate
+//
+// 用候选风险权重回放最近 N 天的小时聚合行为，返回会被封禁的用户数（与当前配置对比）与样本，不落库。
+func SimulateAIBan(c *gin.Context) {
+	var req service.BanSimulationInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+			return
+		}
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	data, err := svc.SimulateBans(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBanSimulation) || errors.Is(err, service.ErrInvalidRiskWeights) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
 // POST /api/ai-ban/test-connection
 func TestAIConnection(c *gin.Context) {
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.TestConnection()
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
 // GET /api/ai-ban/whitelist
 func GetAIBanWhitelist(c *gin.Context) {
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.GetWhitelist()
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
 // POST /api/ai-ban/whitelist/add
 func AddToAIBanWhitelist(c *gin.Context) {
-	var req struct {
-		UserID int64 `json:"user_id"`
-	}
+	var req api.AddWhitelistRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewAIAutoBanService()
-	data := svc.AddToWhitelist(req.UserID)
+	if req.ExpiresAt < 0 || (req.ExpiresAt > 0 && req.ExpiresAt <= time.Now().Unix()) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "expires_at 需晚于当前时间", ""))
+		return
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	data := svc.AddToWhitelist(req.UserID, req.Reason, req.ExpiresAt)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
 // POST /api/ai-ban/whitelist/remove
 func RemoveFromAIBanWhitelist(c *gin.Context) {
-	var req struct {
-		UserID int64 `json:"user_id"`
-	}
+	var req api.RemoveWhitelistRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data := svc.RemoveFromWhitelist(req.UserID)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
+// GET /api/ai-ban/whitelist/check/:user_id
+//
+// 返回用户是否在白名单中，以及命中的是用户 ID（user）还是某条规则（如 group:vip）。
+func CheckAIBanWhitelist(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user_id", ""))
+		return
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	by, ok, err := svc.IsWhitelisted(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"user_id": userID, "whitelisted": ok, "matched": by}})
+}
+
+// POST /api/ai-ban/whitelist/import
+//
+// 批量导入：entries 每项为用户 ID，或 group:<分组>、email:<域名>（或 @<域名>）、trust_level:<0-4>。
+func ImportAIBanWhitelist(c *gin.Context) {
+	var req service.WhitelistImportInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
+		return
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	result, err := svc.ImportWhitelist(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWhitelist) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("WHITELIST_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "entries=%d users=%d rules=%d", len(req.Entries), result.UsersAdded, result.RulesAdded)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// POST /api/ai-ban/whitelist/rules/add
+func AddAIBanWhitelistRule(c *gin.Context) {
+	var req api.WhitelistRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
+		return
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	rule, err := svc.AddWhitelistRule(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "rule=%s", rule.String())
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rule})
+}
+
+// POST /api/ai-ban/whitelist/rules/remove
+func RemoveAIBanWhitelistRule(c *gin.Context) {
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
+		return
+	}
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
+	if !svc.RemoveWhitelistRule(req.ID) {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", fmt.Sprintf("白名单规则 %d 不存在", req.ID), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": fmt.Sprintf("白名单规则 %d 已删除", req.ID)}})
+}
+
 // GET /api/ai-ban/whitelist/search
 func SearchUserForAIWhitelist(c *gin.Context) {
 	q := c.Query("q")
@@ -214,7 +372,7 @@ func SearchUserForAIWhitelist(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Missing search keyword", ""))
 		return
 	}
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	data, err := svc.SearchUserForWhitelist(q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -231,7 +389,7 @@ func FetchAIModels(c *gin.Context) {
 		ForceRefresh bool   `json:"force_refresh"`
 	}
 	c.ShouldBindJSON(&req)
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	result := svc.FetchModels(req.BaseURL, req.APIKey, req.ForceRefresh)
 	c.JSON(http.StatusOK, result)
 }
@@ -244,7 +402,7 @@ func TestAIModel(c *gin.Context) {
 		Model   string `json:"model"`
 	}
 	c.ShouldBindJSON(&req)
-	svc := service.NewAIAutoBanService()
+	svc := service.NewAIAutoBanService().WithContext(c.Request.Context())
 	result := svc.TestModel(req.BaseURL, req.APIKey, req.Model)
 	c.JSON(http.StatusOK, result)
 }
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondAnomalyError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidAnomalyConfig) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+}
+
+// GET /api/analytics/anomalies?hours=24&method=seasonal&dimension=model&metric=requests&limit=100&no_cache=true
+//
+// 按小时请求量/额度检测各模型、各用户分组的突增与骤降。基线为此前 lookback_days 天：
+// seasonal 与同一小时比较，ewma 用指数加权均值；|score| ≥ threshold 视为异常，按 |score| 降序。
+func GetTrafficAnomalies(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	report, err := service.NewAnomalyService().WithContext(c.Request.Context()).Detect(c.Request.Context(), service.AnomalyQuery{
+		Hours:     hours,
+		Method:    c.Query("method"),
+		Dimension: c.Query("dimension"),
+		Metric:    c.Query("metric"),
+		Limit:     parseLimit(c, 100, 500),
+		NoCache:   c.Query("no_cache") == "true",
+	})
+	if err != nil {
+		respondAnomalyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// GET /api/analytics/anomalies/config
+//
+// 异常检测配置，webhook 密钥不返回，has_webhook_secret 表示是否已设置。
+func GetAnomalyConfig(c *gin.Context) {
+	settings, err := service.NewAnomalyService().GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"settings":   settings,
+		"methods":    service.AnomalyMethods,
+		"dimensions": service.AnomalyDimensions,
+		"metrics":    service.AnomalyMetrics,
+	}})
+}
+
+// PUT /api/analytics/anomalies/config
+//
+// 部分更新，例如 {"enabled": true, "method": "seasonal", "lookback_days": 7, "threshold": 3,
+// "min_requests": 50, "webhook_url": "https://hooks.example.com/x", "webhook_secret": "..."}。
+// 开启后每小时检测上一个完整小时，发现异常时推送 traffic_anomaly 事件并调用 webhook
+// （配置了密钥时带 X-Signature: sha256=<HMAC>）。
+func UpdateAnomalyConfig(c *gin.Context) {
+	var req service.AnomalySettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewAnomalyService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		respondAnomalyError(c, err)
+		return
+	}
+	setAuditDetail(c, "更新异常检测配置 enabled=%v method=%s threshold=%.1f", settings.Enabled, settings.Method, settings.Threshold)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "异常检测配置已保存", "data": settings})
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterAuditLogRoutes registers /api/audit-logs endpoints
+func RegisterAuditLogRoutes(r *gin.RouterGroup) {
+	r.GET("/audit-logs", ListAuditLogs)
+}
+
+// GET /api/audit-logs?target_instance=eu
+// 管理写操作的审计日志。
+// target_instance 按写操作的目标实例筛选（默认实例为 default）；?instance= 是实例选择器，不能用于筛选。
+func ListAuditLogs(c *gin.Context) {
+	q := service.AuditLogQuery{
+		Page:     parsePage(c),
+		PageSize: parsePageSize(c, 50, 200),
+		Operator: c.Query("operator"),
+		Instance: c.Query("target_instance"),
+		Method:   c.Query("method"),
+		Path:     c.Query("path"),
+	}
+	if v := c.Query("success"); v != "" {
+		b := v == "true" || v == "1"
+		q.Success = &b
+	}
+	if v := c.Query("start_time"); v != "" {
+		q.StartTime, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v := c.Query("end_time"); v != "" {
+		q.EndTime, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	svc := service.NewAuditLogService()
+	data, err := svc.ListAuditLogs(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
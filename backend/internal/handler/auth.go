@@ -8,6 +8,7 @@ import (
 	"github.com/new-api-tools/backend/internal/auth"
 	"github.com/new-api-tools/backend/internal/logger"
 	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // RegisterAuthRoutes registers authentication endpoints
@@ -26,6 +27,8 @@ func RegisterAuthRoutes(rg *gin.RouterGroup) {
 //
 //	{"password": "admin_password"}
 //
+// 使用 OPERATOR_PASSWORD 登录得到脱敏操作员会话（subject=operator）。
+//
 // 成功响应 (200):
 //
 //	{"success": true, "message": "登录成功", "token": "eyJ...", "expires_at": "2024-01-01T00:00:00Z"}
@@ -34,9 +37,9 @@ func RegisterAuthRoutes(rg *gin.RouterGroup) {
 //
 //	{"success": false, "message": "密码错误"}
 func Login(c *gin.Context) {
-	var req models.LoginRequest
+	var req api.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.LoginResponse{
+		c.JSON(http.StatusBadRequest, api.LoginResponse{
 			Success: false,
 			Message: "请求格式错误",
 		})
@@ -44,10 +47,16 @@ func Login(c *gin.Context) {
 	}
 
 	// Verify password
-	if !auth.VerifyPassword(req.Password) {
+	var subject string
+	switch {
+	case auth.VerifyPassword(req.Password):
+		subject = auth.SubjectAdmin
+	case auth.VerifyOperatorPassword(req.Password):
+		subject = auth.SubjectOperator
+	default:
 		clientIP := c.ClientIP()
 		logger.L.AuthFail("登录失败 | ip=" + clientIP)
-		c.JSON(http.StatusUnauthorized, models.LoginResponse{
+		c.JSON(http.StatusUnauthorized, api.LoginResponse{
 			Success: false,
 			Message: "密码错误",
 		})
@@ -55,10 +64,10 @@ func Login(c *gin.Context) {
 	}
 
 	// Generate JWT token
-	token, expiresAt, err := auth.GenerateToken("admin")
+	token, expiresAt, err := auth.GenerateToken(subject)
 	if err != nil {
 		logger.L.Error("Token 生成失败: "+err.Error(), logger.CatAuth)
-		c.JSON(http.StatusInternalServerError, models.LoginResponse{
+		c.JSON(http.StatusInternalServerError, api.LoginResponse{
 			Success: false,
 			Message: "Token 生成失败",
 		})
@@ -66,9 +75,9 @@ func Login(c *gin.Context) {
 	}
 
 	clientIP := c.ClientIP()
-	logger.L.Auth("登录成功 | ip=" + clientIP)
+	logger.L.Auth("登录成功 | role=" + subject + " | ip=" + clientIP)
 
-	c.JSON(http.StatusOK, models.LoginResponse{
+	c.JSON(http.StatusOK, api.LoginResponse{
 		Success:   true,
 		Message:   "登录成功",
 		Token:     token,
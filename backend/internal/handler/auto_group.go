@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -15,11 +16,16 @@ func RegisterAutoGroupRoutes(r *gin.RouterGroup) {
 	{
 		g.GET("/config", GetAutoGroupConfig)
 		g.POST("/config", SaveAutoGroupConfig)
+		g.GET("/rules", GetAutoGroupRules)
+		g.PUT("/rules", SaveAutoGroupRules)
+		g.GET("/demotion-rules", GetAutoGroupDemotionRules)
+		g.PUT("/demotion-rules", SaveAutoGroupDemotionRules)
 		g.GET("/stats", GetAutoGroupStats)
 		g.GET("/groups", GetAutoGroupAvailableGroups)
 		g.GET("/preview", GetPendingAutoGroupUsers)
 		g.GET("/users", GetAutoGroupUsers)
 		g.POST("/scan", RunAutoGroupScan)
+		g.GET("/last-run", GetAutoGroupLastRun)
 		g.POST("/batch-move", BatchMoveAutoGroupUsers)
 		g.GET("/logs", GetAutoGroupLogs)
 		g.POST("/revert", RevertAutoGroupUser)
@@ -28,11 +34,13 @@ func RegisterAutoGroupRoutes(r *gin.RouterGroup) {
 
 // GET /api/auto-group/config
 func GetAutoGroupConfig(c *gin.Context) {
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": svc.GetConfig()})
 }
 
 // POST /api/auto-group/config
+//
+// 请求体可带 version（GET 时读到的版本号），期间已被他人保存则返回 409 与 current_version。
 func SaveAutoGroupConfig(c *gin.Context) {
 	var req map[string]interface{}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -41,7 +49,7 @@ func SaveAutoGroupConfig(c *gin.Context) {
 	}
 
 	// Validate mode if provided
-	if mode, ok := req["mode"].(string); ok && mode != "simple" && mode != "by_source" {
+	if mode, ok := req["mode"].(string); ok && mode != "simple" && mode != "by_source" && mode != "by_rules" {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的分组模式", ""))
 		return
 	}
@@ -69,9 +77,9 @@ func SaveAutoGroupConfig(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewAutoGroupService()
-	if !svc.SaveConfig(req) {
-		c.JSON(http.StatusInternalServerError, models.ErrorResp("SAVE_ERROR", "保存配置失败", ""))
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
+	if err := svc.SaveConfig(req); err != nil {
+		respondAutoGroupSaveError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -81,15 +89,116 @@ func SaveAutoGroupConfig(c *gin.Context) {
 	})
 }
 
+func respondAutoGroupSaveError(c *gin.Context, err error) {
+	switch {
+	case respondConfigConflict(c, err):
+	case errors.Is(err, service.ErrInvalidAutoGroupRule):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("SAVE_ERROR", "保存配置失败", ""))
+	}
+}
+
+// GET /api/auto-group/rules
+//
+// by_rules 模式的条件规则（按顺序匹配，首条命中的规则决定目标分组）与配置版本号。
+func GetAutoGroupRules(c *gin.Context) {
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
+	config := svc.GetConfig()
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"rules":   svc.GetRules(),
+		"mode":    config["mode"],
+		"version": config["version"],
+	}})
+}
+
+// PUT /api/auto-group/rules
+//
+// {"rules": [{"name", "target_group", "sources": ["linux_do"], "min_trust_level": 2,
+// "min_account_age_days": 30, "min_quota_used": 0}], "version": 3}
+// 整表替换；切换到 by_rules 模式仍需保存 mode。效果可用 POST /scan?dry_run=true 预览。
+func SaveAutoGroupRules(c *gin.Context) {
+	var req struct {
+		Rules   []service.AutoGroupRule `json:"rules"`
+		Version *int64                  `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []service.AutoGroupRule{}
+	}
+	updates := map[string]interface{}{"condition_rules": req.Rules}
+	if req.Version != nil {
+		updates["version"] = *req.Version
+	}
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
+	if err := svc.SaveConfig(updates); err != nil {
+		respondAutoGroupSaveError(c, err)
+		return
+	}
+	setAuditDetail(c, "自动分组条件规则: %d 条", len(req.Rules))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "条件规则已保存", "data": gin.H{
+		"rules":   svc.GetRules(),
+		"version": svc.GetConfig()["version"],
+	}})
+}
+
+// GET /api/auto-group/demotion-rules
+//
+// 降级规则与配置版本号；每次扫描（含定时扫描）在分配之后执行，结果位于扫描返回的 demotion 中。
+func GetAutoGroupDemotionRules(c *gin.Context) {
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"rules":   svc.GetDemotionRules(),
+		"version": svc.GetConfig()["version"],
+	}})
+}
+
+// PUT /api/auto-group/demotion-rules
+//
+// {"rules": [{"name", "from_groups": ["vip"], "target_group": "default", "sources": ["linux_do"],
+// "linux_do_suspended": true, "below_trust_level": 2}], "version": 3}
+// 整表替换；任一条件成立即降级，条件无法判定（信任等级未知等）的用户保持不变。
+// 降级写入 action=demote 的分组日志，可通过 POST /revert {"log_id"} 恢复。
+func SaveAutoGroupDemotionRules(c *gin.Context) {
+	var req struct {
+		Rules   []service.AutoGroupDemotionRule `json:"rules"`
+		Version *int64                          `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []service.AutoGroupDemotionRule{}
+	}
+	updates := map[string]interface{}{"demotion_rules": req.Rules}
+	if req.Version != nil {
+		updates["version"] = *req.Version
+	}
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
+	if err := svc.SaveConfig(updates); err != nil {
+		respondAutoGroupSaveError(c, err)
+		return
+	}
+	setAuditDetail(c, "自动分组降级规则: %d 条", len(req.Rules))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "降级规则已保存", "data": gin.H{
+		"rules":   svc.GetDemotionRules(),
+		"version": svc.GetConfig()["version"],
+	}})
+}
+
 // GET /api/auto-group/stats
 func GetAutoGroupStats(c *gin.Context) {
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": svc.GetStats()})
 }
 
 // GET /api/auto-group/groups
 func GetAutoGroupAvailableGroups(c *gin.Context) {
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	groups := svc.GetAvailableGroups()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -105,7 +214,7 @@ func GetPendingAutoGroupUsers(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
 
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	data := svc.GetPendingUsers(page, pageSize)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
@@ -130,7 +239,7 @@ func GetAutoGroupUsers(c *gin.Context) {
 		}
 	}
 
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	data := svc.GetUsers(page, pageSize, group, source, keyword)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
@@ -140,16 +249,30 @@ func RunAutoGroupScan(c *gin.Context) {
 	dryRunStr := c.DefaultQuery("dry_run", "true")
 	dryRun := dryRunStr == "true"
 
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	if !svc.IsEnabled() {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("DISABLED", "自动分组功能未启用", ""))
 		return
 	}
-	data := svc.RunScan(dryRun)
+	var data map[string]interface{}
+	if dryRun {
+		data = svc.RunScan(true)
+	} else {
+		data = svc.ScanAndRecord("manual")
+	}
 	success, _ := data["success"].(bool)
 	c.JSON(http.StatusOK, gin.H{"success": success, "data": data})
 }
 
+// GET /api/auto-group/last-run
+//
+// 最近一次实际执行（非试运行）的扫描：触发方式（schedule / manual）、统计与逐用户结果（最多 200 条）；
+// 从未执行过时 data 为 null。
+func GetAutoGroupLastRun(c *gin.Context) {
+	svc := service.NewAutoGroupService()
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": svc.GetLastRun()})
+}
+
 // POST /api/auto-group/batch-move
 func BatchMoveAutoGroupUsers(c *gin.Context) {
 	var req struct {
@@ -169,7 +292,7 @@ func BatchMoveAutoGroupUsers(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	data := svc.BatchMoveUsers(req.UserIDs, req.TargetGroup)
 	success, _ := data["success"].(bool)
 	c.JSON(http.StatusOK, gin.H{"success": success, "data": data})
@@ -187,7 +310,7 @@ func GetAutoGroupLogs(c *gin.Context) {
 		userID = &v
 	}
 
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	data := svc.GetLogs(page, pageSize, action, userID)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
@@ -201,7 +324,7 @@ func RevertAutoGroupUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewAutoGroupService()
+	svc := service.NewAutoGroupService().WithContext(c.Request.Context())
 	data := svc.RevertUser(req.LogID)
 	success, _ := data["success"].(bool)
 	c.JSON(http.StatusOK, gin.H{"success": success, "data": data})
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/channels/balance
+//
+// 每个渠道的余额消耗速率与预计耗尽天数（按最早耗尽排序）。
+func GetChannelBurnRates(c *gin.Context) {
+	data, err := service.NewChannelBalanceService().WithContext(c.Request.Context()).GetBurnRates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// POST /api/channels/balance/snapshot
+func TakeChannelBalanceSnapshot(c *gin.Context) {
+	count, err := service.NewChannelBalanceService().WithContext(c.Request.Context()).TakeSnapshot(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("SNAPSHOT_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"channels": count}})
+}
+
+// GET /api/channels/:channel_id/balance-history?days=30
+func GetChannelBalanceHistory(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	days = clampInt(days, 1, 365)
+	data, err := service.NewChannelBalanceService().WithContext(c.Request.Context()).GetHistory(c.Request.Context(), id, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"channel_id": id, "days": days, "items": data}})
+}
+
+// GET /api/channels/balance/config
+func GetChannelBalanceConfig(c *gin.Context) {
+	settings, err := service.NewChannelBalanceService().WithContext(c.Request.Context()).GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/channels/balance/config
+func UpdateChannelBalanceConfig(c *gin.Context) {
+	var req service.ChannelBalanceSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewChannelBalanceService().WithContext(c.Request.Context()).UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "余额监控配置已更新", "data": settings})
+}
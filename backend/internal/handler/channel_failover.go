@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/channels/failover?active=true
+func GetChannelFailoverStates(c *gin.Context) {
+	svc := service.NewChannelFailoverService().WithContext(c.Request.Context())
+	states, err := svc.ListStates(c.Request.Context(), c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": states}})
+}
+
+// POST /api/channels/failover/evaluate
+//
+// 立即执行一次熔断判定与恢复探测（即使策略未启用）。
+func EvaluateChannelFailover(c *gin.Context) {
+	result, err := service.NewChannelFailoverService().WithContext(c.Request.Context()).Evaluate(c.Request.Context(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("FAILOVER_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// GET /api/channels/failover/config
+func GetChannelFailoverConfig(c *gin.Context) {
+	settings, err := service.NewChannelFailoverService().WithContext(c.Request.Context()).GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/channels/failover/config
+func UpdateChannelFailoverConfig(c *gin.Context) {
+	var req service.ChannelFailoverSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewChannelFailoverService().WithContext(c.Request.Context()).UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "熔断策略已更新", "data": settings})
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/channels/key-health?status=flagged|valid|invalid|quota_exhausted|rate_limited|error|unsupported
+//
+// 各渠道 Key 最近一次上游校验结果（仅保存脱敏后的 Key 提示）。
+func GetChannelKeyHealth(c *gin.Context) {
+	data, err := service.NewChannelKeyHealthService().WithContext(c.Request.Context()).ListKeyHealth(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// POST /api/channels/key-health/check
+//
+// 立即校验 Key。请求体可选 {"channel_ids": [1, 2]}，为空时检查全部启用渠道。
+func CheckChannelKeys(c *gin.Context) {
+	var req struct {
+		ChannelIDs []int64 `json:"channel_ids"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+			return
+		}
+	}
+	summary, err := service.NewChannelKeyHealthService().WithContext(c.Request.Context()).CheckKeys(c.Request.Context(), req.ChannelIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("CHECK_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": summary})
+}
+
+// GET /api/channels/key-health/config
+func GetChannelKeyHealthConfig(c *gin.Context) {
+	settings, err := service.NewChannelKeyHealthService().WithContext(c.Request.Context()).GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/channels/key-health/config
+func UpdateChannelKeyHealthConfig(c *gin.Context) {
+	var req service.ChannelKeyHealthSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewChannelKeyHealthService().WithContext(c.Request.Context()).UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Key 巡检配置已更新", "data": settings})
+}
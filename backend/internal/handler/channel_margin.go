@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondChannelMarginError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidModelCost), errors.Is(err, service.ErrInvalidMarginAlert):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrModelCostNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", err.Error(), ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+	}
+}
+
+// GET /api/channels/margin?days=7
+//
+// 按渠道 / 模型对比向用户收取的额度与上游成本（成本表见 /margin/costs）。
+func GetChannelMargin(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	days = clampInt(days, 1, 90)
+	data, err := service.NewChannelMarginService().WithContext(c.Request.Context()).GetMargin(c.Request.Context(), days, c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/channels/margin/profitability?days=30 或 ?start_date=2026-01-01&end_date=2026-01-31
+//
+// 以本期成功充值的实收金额（按成本表 topup_currency_per_usd 折算为美元）为收入口径，
+// 按渠道 / 模型统计毛利，并列出亏损的渠道 × 模型路由。
+func GetChannelProfitability(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	data, err := service.NewChannelMarginService().WithContext(c.Request.Context()).GetProfitability(c.Request.Context(), service.TopUpTrendsParams{
+		StartDate: c.Query("start_date"),
+		EndDate:   c.Query("end_date"),
+		Days:      clampInt(days, 1, 365),
+	}, c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/channels/margin/costs
+func GetChannelCostTable(c *gin.Context) {
+	table, err := service.NewChannelMarginService().WithContext(c.Request.Context()).GetCostTable(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": table})
+}
+
+// PUT /api/channels/margin/costs
+//
+// 整表替换：
+//
+//	{"models": [{"model": "gpt-4o*", "input_per_1m": 2.5, "output_per_1m": 10}],
+//	 "multipliers": [{"channel_id": 3, "multiplier": 0.8}], "topup_currency_per_usd": 7.2}
+func UpdateChannelCostTable(c *gin.Context) {
+	var req service.ChannelCostTable
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	table, err := service.NewChannelMarginService().WithContext(c.Request.Context()).SaveCostTable(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "成本表: %d 个模型, %d 个渠道系数", len(table.Models), len(table.Multipliers))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "成本表已更新", "data": table})
+}
+
+// PUT /api/channels/margin/costs/models
+//
+// 新增或修改单个模型的成本，价格可按每 1K tokens 填写（存储时换算为每 1M）：
+//
+//	{"model": "gpt-4o", "input_per_1k": 0.0025, "output_per_1k": 0.01}
+func UpsertModelCost(c *gin.Context) {
+	var req service.ModelCostInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewChannelMarginService().WithContext(c.Request.Context()).UpsertModelCost(c.Request.Context(), req)
+	if err != nil {
+		respondChannelMarginError(c, err)
+		return
+	}
+	setAuditDetail(c, "模型成本 %s: 输入 $%g/1M, 输出 $%g/1M, 每次 $%g", entry.Model, entry.InputPer1M, entry.OutputPer1M, entry.PerRequest)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "模型成本已更新", "data": entry})
+}
+
+// DELETE /api/channels/margin/costs/models?model=gpt-4o*
+//
+// 模型名可能包含 "/"，因此通过 query 传入。
+func DeleteModelCost(c *gin.Context) {
+	model := c.Query("model")
+	if model == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "model is required", ""))
+		return
+	}
+	if err := service.NewChannelMarginService().WithContext(c.Request.Context()).DeleteModelCost(c.Request.Context(), model); err != nil {
+		respondChannelMarginError(c, err)
+		return
+	}
+	setAuditDetail(c, "删除模型成本 %s", model)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "模型成本已删除"})
+}
+
+// GET /api/channels/margin/alerts?model=&limit=50&offset=0
+//
+// 模型毛利告警历史（窗口内收取额度不足以覆盖上游成本），按时间倒序。
+func ListMarginAlerts(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	items, total, err := service.NewChannelMarginService().ListAlerts(c.Request.Context(), c.Query("model"), parseLimit(c, 50, 200), offset)
+	if err != nil {
+		respondChannelMarginError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": total}})
+}
+
+// POST /api/channels/margin/alerts/check
+//
+// 立即执行一次毛利检查（后台每小时执行），返回本次新触发的告警。
+func CheckMarginAlerts(c *gin.Context) {
+	raised, err := service.NewChannelMarginService().WithContext(c.Request.Context()).CheckAlerts(c.Request.Context())
+	if err != nil {
+		respondChannelMarginError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": raised})
+}
+
+// GET /api/channels/margin/alerts/config
+func GetMarginAlertConfig(c *gin.Context) {
+	settings, err := service.NewChannelMarginService().GetAlertSettings(c.Request.Context())
+	if err != nil {
+		respondChannelMarginError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/channels/margin/alerts/config
+func UpdateMarginAlertConfig(c *gin.Context) {
+	var req service.MarginAlertSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewChannelMarginService().UpdateAlertSettings(c.Request.Context(), req)
+	if err != nil {
+		respondChannelMarginError(c, err)
+		return
+	}
+	setAuditDetail(c, "毛利告警: 窗口 %d 小时, 阈值 %g%%, 最低成本 $%g", settings.WindowHours, settings.MarginRate, settings.MinCostUSD)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "毛利告警配置已更新", "data": settings})
+}
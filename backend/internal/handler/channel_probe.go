@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/model-status/probes?channel_id=&limit=
+func GetChannelProbes(c *gin.Context) {
+	channelID, _ := strconv.ParseInt(c.Query("channel_id"), 10, 64)
+	svc := service.NewChannelProbeService().WithContext(c.Request.Context())
+	data, err := svc.ListProbes(c.Request.Context(), channelID, parseLimit(c, 50, 500))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// POST /api/model-status/probes/run
+func RunChannelProbes(c *gin.Context) {
+	svc := service.NewChannelProbeService().WithContext(c.Request.Context())
+	summary, err := svc.RunProbes(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrProbeNotConfigured) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("NOT_CONFIGURED", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("PROBE_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": summary})
+}
+
+// GET /api/model-status/probes/config
+func GetChannelProbeConfig(c *gin.Context) {
+	svc := service.NewChannelProbeService().WithContext(c.Request.Context())
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"settings":   settings,
+		"configured": svc.Configured(),
+	}})
+}
+
+// PUT /api/model-status/probes/config
+func UpdateChannelProbeConfig(c *gin.Context) {
+	var req service.ChannelProbeSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "请求参数错误", err.Error()))
+		return
+	}
+	svc := service.NewChannelProbeService().WithContext(c.Request.Context())
+	settings, err := svc.UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "探测配置已更新", "data": gin.H{
+		"settings":   settings,
+		"configured": svc.Configured(),
+	}})
+}
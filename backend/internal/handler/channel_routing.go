@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/channels/routing?model=gpt-4o&group=default&hours=24
+//
+// 每个模型在各分组下由哪些渠道承接：abilities 中的优先级 / 权重 / 启用状态，
+// 以及近期实际请求量、成功率和流量占比，用于排查"请求为什么走了这个渠道"。
+func GetChannelRouting(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	q := service.ChannelRoutingQuery{
+		Model: strings.TrimSpace(c.Query("model")),
+		Group: strings.TrimSpace(c.Query("group")),
+		Hours: clampInt(hours, 1, 168),
+	}
+	data, err := service.NewChannelRoutingServiceFor(instanceParam(c)).WithContext(c.Request.Context()).GetModelRouting(q, c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/channels/group-audit?hours=24&group=vip
+//
+// 分组与渠道映射审计：各分组可用的模型 / 渠道组合，与 logs 中实际命中的渠道对比，
+// violations 为越权命中（分组没有该模型，或该模型不应由此渠道承接）。
+func GetChannelGroupAudit(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	data, err := service.NewChannelRoutingServiceFor(instanceParam(c)).WithContext(c.Request.Context()).AuditGroupChannels(
+		clampInt(hours, 1, 720), strings.TrimSpace(c.Query("group")), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterChannelRoutes registers /api/channels endpoints
+func RegisterChannelRoutes(r *gin.RouterGroup) {
+	g := r.Group("/channels")
+	{
+		g.GET("", ListChannels)
+		g.POST("/batch/status", BatchSetChannelStatus)
+		g.GET("/balance", GetChannelBurnRates)
+		g.POST("/balance/snapshot", TakeChannelBalanceSnapshot)
+		g.GET("/balance/config", GetChannelBalanceConfig)
+		g.PUT("/balance/config", UpdateChannelBalanceConfig)
+		g.GET("/failover", GetChannelFailoverStates)
+		g.POST("/failover/evaluate", EvaluateChannelFailover)
+		g.GET("/failover/config", GetChannelFailoverConfig)
+		g.PUT("/failover/config", UpdateChannelFailoverConfig)
+		g.GET("/key-health", GetChannelKeyHealth)
+		g.POST("/key-health/check", CheckChannelKeys)
+		g.GET("/key-health/config", GetChannelKeyHealthConfig)
+		g.PUT("/key-health/config", UpdateChannelKeyHealthConfig)
+		g.GET("/margin", GetChannelMargin)
+		g.GET("/margin/profitability", GetChannelProfitability)
+		g.GET("/margin/costs", GetChannelCostTable)
+		g.PUT("/margin/costs", UpdateChannelCostTable)
+		g.PUT("/margin/costs/models", UpsertModelCost)
+		g.DELETE("/margin/costs/models", DeleteModelCost)
+		g.GET("/margin/alerts", ListMarginAlerts)
+		g.POST("/margin/alerts/check", CheckMarginAlerts)
+		g.GET("/margin/alerts/config", GetMarginAlertConfig)
+		g.PUT("/margin/alerts/config", UpdateMarginAlertConfig)
+		g.GET("/routing", GetChannelRouting)
+		g.GET("/group-audit", GetChannelGroupAudit)
+		g.GET("/:channel_id", GetChannel)
+		g.PUT("/:channel_id", UpdateChannel)
+		g.PUT("/:channel_id/status", SetChannelStatus)
+		g.POST("/:channel_id/enable", EnableChannel)
+		g.POST("/:channel_id/disable", DisableChannel)
+		g.PUT("/:channel_id/priority", UpdateChannel)
+		g.GET("/:channel_id/balance-history", GetChannelBalanceHistory)
+	}
+}
+
+// SetChannelStatusRequest 启用/禁用渠道
+type SetChannelStatusRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// BatchSetChannelStatusRequest 批量启用/禁用渠道
+type BatchSetChannelStatusRequest struct {
+	ChannelIDs []int64 `json:"channel_ids" binding:"required"`
+	Enabled    *bool   `json:"enabled" binding:"required"`
+}
+
+func parseChannelID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("channel_id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的渠道 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+func respondChannelError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrChannelNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "渠道不存在", ""))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResp("CHANNEL_ERROR", err.Error(), ""))
+}
+
+// setAuditDetail attaches a change description to the audit entry of this request
+func setAuditDetail(c *gin.Context, format string, args ...interface{}) {
+	c.Set(service.AuditDetailContextKey, fmt.Sprintf(format, args...))
+}
+
+// GET /api/channels?page=1&page_size=50&status=1&type=&group=&keyword=&sort_by=priority
+func ListChannels(c *gin.Context) {
+	q := service.ChannelListQuery{
+		Page:     parsePage(c),
+		PageSize: parsePageSize(c, 50, 200),
+		Group:    c.Query("group"),
+		Keyword:  c.Query("keyword"),
+		SortBy:   c.DefaultQuery("sort_by", "priority"),
+	}
+	q.Status, _ = strconv.Atoi(c.Query("status"))
+	q.Type, _ = strconv.Atoi(c.Query("type"))
+
+	data, err := service.NewChannelServiceFor(instanceParam(c)).WithContext(c.Request.Context()).ListChannels(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/channels/:channel_id
+func GetChannel(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	data, err := service.NewChannelServiceFor(instanceParam(c)).WithContext(c.Request.Context()).GetChannel(id)
+	if err != nil {
+		respondChannelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// PUT /api/channels/:channel_id  {"priority": 10, "weight": 5}
+func UpdateChannel(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	var req service.ChannelUpdateInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	if req.Priority == nil && req.Weight == nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "priority 或 weight 至少提供一个", ""))
+		return
+	}
+	if req.Weight != nil && *req.Weight < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "weight 不能为负数", ""))
+		return
+	}
+	svc := service.NewChannelServiceFor(instanceParam(c)).WithContext(c.Request.Context())
+	before, err := svc.GetChannel(id)
+	if err != nil {
+		respondChannelError(c, err)
+		return
+	}
+	data, err := svc.UpdateChannel(id, req)
+	if err != nil {
+		respondChannelError(c, err)
+		return
+	}
+	setAuditDetail(c, "channel #%d %q priority %v→%v weight %v→%v",
+		id, before["name"], before["priority"], data["priority"], before["weight"], data["weight"])
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "渠道已更新", "data": data})
+}
+
+// PUT /api/channels/:channel_id/status  {"enabled": false}
+func SetChannelStatus(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	var req SetChannelStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	setChannelEnabled(c, id, *req.Enabled)
+}
+
+// POST /api/channels/:channel_id/enable
+func EnableChannel(c *gin.Context) {
+	if id, ok := parseChannelID(c); ok {
+		setChannelEnabled(c, id, true)
+	}
+}
+
+// POST /api/channels/:channel_id/disable
+func DisableChannel(c *gin.Context) {
+	if id, ok := parseChannelID(c); ok {
+		setChannelEnabled(c, id, false)
+	}
+}
+
+func setChannelEnabled(c *gin.Context, id int64, enabled bool) {
+	svc := service.NewChannelServiceFor(instanceParam(c)).WithContext(c.Request.Context())
+	before, err := svc.GetChannel(id)
+	if err != nil {
+		respondChannelError(c, err)
+		return
+	}
+	data, err := svc.SetStatus(id, enabled)
+	if err != nil {
+		respondChannelError(c, err)
+		return
+	}
+	setAuditDetail(c, "channel #%d %q status %v→%v", id, before["name"], before["status"], data["status"])
+	msg := "渠道已禁用"
+	if enabled {
+		msg = "渠道已启用"
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": msg, "data": data})
+}
+
+// POST /api/channels/batch/status  {"channel_ids": [1,2,3], "enabled": false}
+func BatchSetChannelStatus(c *gin.Context) {
+	var req BatchSetChannelStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	affected, err := service.NewChannelServiceFor(instanceParam(c)).WithContext(c.Request.Context()).BatchSetStatus(req.ChannelIDs, *req.Enabled)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("CHANNEL_ERROR", err.Error(), ""))
+		return
+	}
+	ids := make([]string, len(req.ChannelIDs))
+	for i, id := range req.ChannelIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	setAuditDetail(c, "batch enabled=%v channels [%s] changed=%d", *req.Enabled, strings.Join(ids, ","), affected)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"requested": len(req.ChannelIDs),
+		"affected":  affected,
+		"enabled":   *req.Enabled,
+	}})
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondCostAttributionError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidCostQuery) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+}
+
+// GET /api/analytics/costs?by=user|group|channel&days=7&limit=50&no_cache=true
+//
+// 按上游成本表（/api/channels/margin/costs）为近 N 天的消耗计价，返回每个用户 / 分组 / 渠道的
+// 收入、上游成本与毛利（美元），按成本从高到低排列。
+func GetCostAttribution(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	days = clampInt(days, 1, 90)
+	data, err := service.NewCostAttributionService().WithContext(c.Request.Context()).GetCosts(c.Request.Context(),
+		c.DefaultQuery("by", service.CostByUser), days, parseLimit(c, 50, 500), c.Query("no_cache") == "true")
+	if err != nil {
+		respondCostAttributionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/analytics/costs/trend?days=30&by=user&id=123&no_cache=true
+//
+// 按报表时区逐日统计收入、上游成本与毛利；不传 by 时为全站，by=group 时 id 为分组名。
+func GetCostTrend(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	days = clampInt(days, 1, 90)
+	data, err := service.NewCostAttributionService().WithContext(c.Request.Context()).GetCostTrend(c.Request.Context(),
+		c.Query("by"), strings.TrimSpace(c.Query("id")), days, c.Query("no_cache") == "true")
+	if err != nil {
+		respondCostAttributionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -23,6 +24,18 @@ func RegisterDashboardRoutes(r *gin.RouterGroup) {
 		g.GET("/refresh-estimate", GetRefreshEstimate)
 		g.GET("/system-info", GetDashboardSystemInfo)
 		g.GET("/ip-distribution", GetIPDistribution)
+		g.GET("/fleet", GetFleetOverview)
+		g.GET("/budgets", GetGroupBudgets)
+		g.POST("/budgets/check", CheckGroupBudgets)
+		g.GET("/budgets/config", GetGroupBudgetConfig)
+		g.PUT("/budgets/config", UpdateGroupBudgetConfig)
+		g.GET("/widgets", ListDashboardWidgets)
+		g.POST("/widgets", CreateDashboardWidget)
+		g.GET("/widgets/options", GetDashboardWidgetOptions)
+		g.GET("/widgets/:id", GetDashboardWidget)
+		g.PUT("/widgets/:id", UpdateDashboardWidget)
+		g.DELETE("/widgets/:id", DeleteDashboardWidget)
+		g.GET("/widgets/:id/data", GetDashboardWidgetData)
 	}
 }
 
@@ -30,7 +43,7 @@ func RegisterDashboardRoutes(r *gin.RouterGroup) {
 func GetSystemOverview(c *gin.Context) {
 	period := c.DefaultQuery("period", "7d")
 	noCache := c.Query("no_cache") == "true"
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetSystemOverview(period, noCache)
 	if err != nil {
@@ -44,7 +57,7 @@ func GetSystemOverview(c *gin.Context) {
 func GetUsageStatistics(c *gin.Context) {
 	period := c.DefaultQuery("period", "24h")
 	noCache := c.Query("no_cache") == "true"
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetUsageStatistics(period, noCache)
 	if err != nil {
@@ -59,7 +72,7 @@ func GetModelUsage(c *gin.Context) {
 	period := c.DefaultQuery("period", "7d")
 	limit := parseLimit(c, 10, 200)
 	noCache := c.Query("no_cache") == "true"
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetModelUsage(period, limit, noCache)
 	if err != nil {
@@ -74,7 +87,7 @@ func GetDailyTrends(c *gin.Context) {
 	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
 	days = clampInt(days, 1, 90)
 	noCache := c.Query("no_cache") == "true"
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetDailyTrends(days, noCache)
 	if err != nil {
@@ -89,7 +102,7 @@ func GetHourlyTrends(c *gin.Context) {
 	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
 	hours = clampInt(hours, 1, 168)
 	noCache := c.Query("no_cache") == "true"
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetHourlyTrends(hours, noCache)
 	if err != nil {
@@ -104,7 +117,7 @@ func GetTopUsers(c *gin.Context) {
 	period := c.DefaultQuery("period", "7d")
 	limit := parseLimit(c, 10, 200)
 	noCache := c.Query("no_cache") == "true"
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetTopUsers(period, limit, noCache)
 	if err != nil {
@@ -116,7 +129,7 @@ func GetTopUsers(c *gin.Context) {
 
 // GET /api/dashboard/channels
 func GetChannelStatus(c *gin.Context) {
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 
 	data, err := svc.GetChannelStatus()
 	if err != nil {
@@ -128,7 +141,7 @@ func GetChannelStatus(c *gin.Context) {
 
 // POST /api/dashboard/cache/invalidate
 func InvalidateDashboardCache(c *gin.Context) {
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	svc.InvalidateDashboardCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -137,26 +150,65 @@ func InvalidateDashboardCache(c *gin.Context) {
 }
 
 // GET /api/dashboard/refresh-estimate
+//
+// 大型 / 超大型系统刷新前给出预估，前端据此弹出确认框。
 func GetRefreshEstimate(c *gin.Context) {
+	profile := service.CurrentScaleProfile()
+	metrics := service.CurrentScaleMetrics()
+	if profile.Scale != service.ScaleLarge && profile.Scale != service.ScaleXLarge {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"show_estimate": false, "scale": profile.Scale}})
+		return
+	}
+	seconds := 10
+	if profile.Scale == service.ScaleXLarge {
+		seconds = 30
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"show_estimate":  false,
-			"estimated_time": 0,
+			"show_estimate":            true,
+			"scale":                    profile.Scale,
+			"estimated_logs":           metrics.TotalLogs,
+			"estimated_logs_formatted": formatCount(metrics.TotalLogs),
+			"estimated_seconds":        seconds,
+			"estimated_time_formatted": fmt.Sprintf("约 %d 秒", seconds),
+			"warning":                  fmt.Sprintf("%s，实时查询可能较慢，缓存每 %d 秒自动刷新", profile.Description, profile.CacheTTL),
 		},
 	})
 }
 
 // GET /api/dashboard/system-info
 func GetDashboardSystemInfo(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"scale":     "medium",
-			"cache_ttl": 300,
-			"tips":      []string{},
+	profile := service.CurrentScaleProfile()
+	metrics := service.CurrentScaleMetrics()
+	large := profile.Scale == service.ScaleLarge || profile.Scale == service.ScaleXLarge
+	data := gin.H{
+		"scale":           profile.Scale,
+		"is_large_system": large,
+		"cache_ttl":       profile.CacheTTL,
+		"metrics": gin.H{
+			"total_users": metrics.TotalUsers,
+			"total_logs":  metrics.TotalLogs,
 		},
-	})
+	}
+	if large {
+		data["tips"] = gin.H{
+			"refresh_warning": true,
+			"message":         fmt.Sprintf("%s，刷新前会提示预估耗时", profile.Description),
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// formatCount renders large counts as 万 / 亿
+func formatCount(n int64) string {
+	switch {
+	case n >= 100000000:
+		return fmt.Sprintf("%.1f 亿", float64(n)/100000000)
+	case n >= 10000:
+		return fmt.Sprintf("%.1f 万", float64(n)/10000)
+	}
+	return fmt.Sprintf("%d", n)
 }
 
 // GET /api/dashboard/ip-distribution
@@ -168,7 +220,7 @@ func GetIPDistribution(c *gin.Context) {
 	}
 	noCache := c.Query("no_cache") == "true"
 
-	svc := service.NewDashboardService()
+	svc := service.NewDashboardServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetIPDistribution(window, noCache)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": gin.H{"message": err.Error()}})
@@ -176,3 +228,12 @@ func GetIPDistribution(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
+
+// GET /api/dashboard/fleet?period=24h
+//
+// 跨实例汇总：所有已注册实例的请求/额度/用户总和，以及每个实例的明细列。
+func GetFleetOverview(c *gin.Context) {
+	period := c.DefaultQuery("period", "24h")
+	noCache := c.Query("no_cache") == "true"
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.GetFleetOverview(c.Request.Context(), period, noCache)})
+}
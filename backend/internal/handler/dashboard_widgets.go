@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondWidgetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWidget):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrWidgetNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "组件不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseWidgetID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的组件 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api/dashboard/widgets
+func ListDashboardWidgets(c *gin.Context) {
+	widgets, err := service.NewDashboardWidgetService().List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": widgets, "total": len(widgets)}})
+}
+
+// GET /api/dashboard/widgets/options
+//
+// 可选的维度、指标、周期、日志类型与图表类型，供前端构建自定义面板。
+func GetDashboardWidgetOptions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"dimensions": service.WidgetDimensions,
+		"metrics":    service.WidgetMetrics,
+		"periods":    service.WidgetPeriods,
+		"log_types":  service.WidgetLogTypes,
+		"charts":     service.WidgetCharts,
+	}})
+}
+
+// GET /api/dashboard/widgets/:id
+func GetDashboardWidget(c *gin.Context) {
+	id, ok := parseWidgetID(c)
+	if !ok {
+		return
+	}
+	widget, err := service.NewDashboardWidgetService().Get(c.Request.Context(), id)
+	if err != nil {
+		respondWidgetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": widget})
+}
+
+// POST /api/dashboard/widgets
+//
+// 请求体 {"name": "各模型 7 天额度", "dimension": "model", "metric": "quota", "period": "7d", "limit": 10,
+// "filters": {"models": ["gpt-4*"], "channel_ids": [], "user_ids": [], "groups": ["vip"], "log_type": "consume"}, "chart": "bar"}
+func CreateDashboardWidget(c *gin.Context) {
+	var req service.DashboardWidgetInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	widget, err := service.NewDashboardWidgetService().Create(c.Request.Context(), operatorIdentity(c), req)
+	if err != nil {
+		respondWidgetError(c, err)
+		return
+	}
+	setAuditDetail(c, "创建看板组件 #%d %s", widget.ID, widget.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "组件已保存", "data": widget})
+}
+
+// PUT /api/dashboard/widgets/:id
+func UpdateDashboardWidget(c *gin.Context) {
+	id, ok := parseWidgetID(c)
+	if !ok {
+		return
+	}
+	var req service.DashboardWidgetInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	widget, err := service.NewDashboardWidgetService().Update(c.Request.Context(), id, req)
+	if err != nil {
+		respondWidgetError(c, err)
+		return
+	}
+	setAuditDetail(c, "更新看板组件 #%d %s", widget.ID, widget.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "组件已更新", "data": widget})
+}
+
+// DELETE /api/dashboard/widgets/:id
+func DeleteDashboardWidget(c *gin.Context) {
+	id, ok := parseWidgetID(c)
+	if !ok {
+		return
+	}
+	if err := service.NewDashboardWidgetService().Delete(c.Request.Context(), id); err != nil {
+		respondWidgetError(c, err)
+		return
+	}
+	setAuditDetail(c, "删除看板组件 #%d", id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "组件已删除"})
+}
+
+// GET /api/dashboard/widgets/:id/data?period=7d&no_cache=true
+//
+// 按保存的查询聚合日志，period 可临时覆盖组件自身的周期。
+func GetDashboardWidgetData(c *gin.Context) {
+	id, ok := parseWidgetID(c)
+	if !ok {
+		return
+	}
+	noCache := c.Query("no_cache") == "true"
+	data, err := service.NewDashboardWidgetService().Data(c.Request.Context(), id, c.Query("period"), noCache)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWidget) || errors.Is(err, service.ErrWidgetNotFound) {
+			respondWidgetError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
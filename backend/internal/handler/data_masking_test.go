@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/auth"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/middleware"
+)
+
+func TestOperatorSessionIsMaskedOnEveryEndpoint(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("ADMIN_PASSWORD", "admin-pass")
+	t.Setenv("OPERATOR_PASSWORD", "operator-pass")
+	config.Load()
+	logger.Init("error", "")
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	api := r.Group("/api", auth.AuthMiddleware(), middleware.DataMaskingMiddleware())
+	RegisterAuthRoutes(api)
+	// stand-ins for endpoints outside the user / risk / IP prefixes
+	api.GET("/abuse-broadcast/events", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+			"top_ips": []gin.H{{"ip": "203.0.113.7", "count": 3}},
+			"email":   "alice@example.com",
+		}})
+	})
+	api.GET("/top-ups/export", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/csv", []byte("user,ip\nalice,203.0.113.7\n"))
+	})
+
+	login := func(password string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"password":"`+password+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var resp struct{ Token string }
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+			t.Fatalf("login failed: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Token
+	}
+	get := func(token, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	operator := login("operator-pass")
+	w := get(operator, "/api/abuse-broadcast/events")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || strings.Contains(body, "203.0.113.7") || strings.Contains(body, "alice@example.com") {
+		t.Fatalf("operator response must be masked, got %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, "203.0.113.*") || w.Header().Get("X-Data-Masking") != "on" {
+		t.Errorf("expected a masked IP, got %s", body)
+	}
+	if w := get(operator, "/api/top-ups/export"); w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("operator downloads must be refused, got %d: %s", w.Code, w.Body.String())
+	}
+
+	admin := login("admin-pass")
+	if w := get(admin, "/api/abuse-broadcast/events"); !strings.Contains(w.Body.String(), "203.0.113.7") {
+		t.Errorf("admin sessions keep raw data outside the masked prefixes, got %s", w.Body.String())
+	}
+	if w := get(admin, "/api/top-ups/export"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("admin downloads must pass, got %d", w.Code)
+	}
+}
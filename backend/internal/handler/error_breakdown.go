@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/analytics/errors?window=24h&model_name=&channel_id=&no_cache=true
+//
+// 失败请求（type=5）按错误分类统计：超时、限流、额度、鉴权、模型不存在、上下文超长、
+// 内容审核、请求错误、上游 5xx、网络、客户端取消、未知。返回总体分布（含状态码与高频报错）、
+// 各模型 / 各渠道分布以及按时间槽的序列。
+func GetErrorBreakdown(c *gin.Context) {
+	channelID, _ := strconv.ParseInt(c.Query("channel_id"), 10, 64)
+	data, err := service.NewErrorBreakdownService().WithContext(c.Request.Context()).GetBreakdown(service.ErrorQuery{
+		Window:    c.DefaultQuery("window", "24h"),
+		ModelName: c.Query("model_name"),
+		ChannelID: channelID,
+		NoCache:   c.Query("no_cache") == "true",
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidErrorQuery) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/analytics/failures?window=24h&model_name=&channel_id=&user_id=&class=timeout&sample=recent&limit=50
+//
+// 抽样返回失败请求（type=5）明细：模型、渠道、用户、令牌、IP、错误分类与报错摘要。
+// sample=recent 取最近的记录，spread 按 id 等距抽样覆盖整个窗口；class 在抽样后过滤。
+func GetFailureSamples(c *gin.Context) {
+	channelID, _ := strconv.ParseInt(c.Query("channel_id"), 10, 64)
+	userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	data, err := service.NewErrorBreakdownService().WithContext(c.Request.Context()).GetFailureSamples(service.FailureQuery{
+		Window:    c.DefaultQuery("window", "24h"),
+		ModelName: c.Query("model_name"),
+		ChannelID: channelID,
+		UserID:    userID,
+		Class:     c.Query("class"),
+		Sample:    c.Query("sample"),
+		Limit:     parseLimit(c, 50, 500),
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidErrorQuery) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
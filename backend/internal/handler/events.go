@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/middleware"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// eventsHeartbeatInterval keeps proxies (nginx proxy_read_timeout) from
+// closing idle SSE connections.
+const eventsHeartbeatInterval = 25 * time.Second
+
+// RegisterEventRoutes registers the /api/events SSE stream
+func RegisterEventRoutes(r *gin.RouterGroup) {
+	r.GET("/events", StreamEvents)
+}
+
+// GET /api/events?types=cache_invalidated,scan_finished
+//
+// Server-Sent Events stream. 浏览器 EventSource 无法设置请求头，可通过 ?token=<jwt> 认证。
+func StreamEvents(c *gin.Context) {
+	var filter map[string]bool
+	if types := strings.TrimSpace(c.Query("types")); types != "" {
+		filter = map[string]bool{}
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter[t] = true
+			}
+		}
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+
+	// The server-wide WriteTimeout would cut long-lived streams; lift it here.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logger.L.Warn("[事件流] 无法取消写超时，连接将在 WriteTimeout 后断开: "+err.Error(), logger.CatAPI)
+	}
+
+	owner := operatorIdentity(c)
+	masker := middleware.ResponseMasker(c)
+	events, cancel := service.GetEventBus().Subscribe()
+	defer cancel()
+
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 5000\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if filter != nil && !filter[ev.Type] {
+				continue
+			}
+			if ev.Owner != "" && ev.Owner != owner {
+				continue
+			}
+			payload, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if masker != nil {
+				payload = masker.MaskJSON(payload)
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, payload); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
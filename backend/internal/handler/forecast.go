@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/analytics/forecast?horizon=7|30&history_days=56&no_cache=true
+//
+// 用最近 history_days 个完整自然日（14 ~ 180，默认 8 周）的请求数、额度消耗与充值收入拟合
+// 带周季节性的 Holt-Winters 模型，预测从今天起 horizon 天（1 ~ 30）的值及 95% 置信区间，用于容量规划。
+func GetForecast(c *gin.Context) {
+	horizon, _ := strconv.Atoi(c.DefaultQuery("horizon", "7"))
+	historyDays, _ := strconv.Atoi(c.DefaultQuery("history_days", "56"))
+	data, err := service.GetForecast(c.Request.Context(), clampInt(historyDays, 14, 180), clampInt(horizon, 1, 30), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
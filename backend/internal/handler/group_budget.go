@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterGroupBudgetRoutes registers /api/groups/budgets endpoints. The
+// older /api/dashboard/budgets routes stay as aliases.
+func RegisterGroupBudgetRoutes(r *gin.RouterGroup) {
+	g := r.Group("/groups/budgets")
+	{
+		g.GET("", GetGroupBudgets)
+		g.POST("/check", RunGroupBudgetChecks)
+		g.GET("/config", GetGroupBudgetConfig)
+		g.PUT("/config", UpdateGroupBudgetConfig)
+	}
+}
+
+func respondGroupBudgetError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidGroupBudget) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+}
+
+// GET /api/groups/budgets?month=2026-01&no_cache=true
+//
+// 各分组本月（或指定月份）额度消耗与预算的燃尽情况、今日用量与日额度，
+// 以及已触发的 80% / 100% 月度告警和超出日额度告警。
+func GetGroupBudgets(c *gin.Context) {
+	report, err := service.NewGroupBudgetService().WithContext(c.Request.Context()).
+		GetReport(c.Request.Context(), c.Query("month"), c.Query("no_cache") == "true")
+	if err != nil {
+		respondGroupBudgetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// POST /api/dashboard/budgets/check
+//
+// 立即执行一次月度预算检查（后台每小时执行），返回本次新触发的告警。
+func CheckGroupBudgets(c *gin.Context) {
+	raised, err := service.NewGroupBudgetService().WithContext(c.Request.Context()).CheckAlerts(c.Request.Context())
+	if err != nil {
+		respondGroupBudgetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": raised})
+}
+
+// POST /api/groups/budgets/check
+//
+// 立即执行一次日额度检查（后台每 10 分钟执行）和月度预算检查，返回本次新触发的告警及禁用 / 恢复的令牌数。
+func RunGroupBudgetChecks(c *gin.Context) {
+	svc := service.NewGroupBudgetService().WithContext(c.Request.Context())
+	daily, err := svc.CheckDailyCaps(c.Request.Context())
+	if err != nil {
+		respondGroupBudgetError(c, err)
+		return
+	}
+	raised, err := svc.CheckAlerts(c.Request.Context())
+	if err != nil {
+		respondGroupBudgetError(c, err)
+		return
+	}
+	if raised == nil {
+		raised = []service.GroupBudgetAlert{}
+	}
+	if daily.TokensDisabled > 0 || daily.TokensRestored > 0 {
+		setAuditDetail(c, "分组预算检查: 禁用 %d 个令牌, 恢复 %d 个令牌", daily.TokensDisabled, daily.TokensRestored)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"monthly": raised, "daily": daily}})
+}
+
+// GET /api/groups/budgets/config
+func GetGroupBudgetConfig(c *gin.Context) {
+	settings, err := service.NewGroupBudgetService().GetSettings(c.Request.Context())
+	if err != nil {
+		respondGroupBudgetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/groups/budgets/config
+//
+// {"enabled": true, "webhook_url": "", "webhook_secret": "", "budgets": [{"group": "vip", "monthly_quota": 500000000, "daily_quota": 50000000, "disable_tokens": true, "note": ""}]}
+func UpdateGroupBudgetConfig(c *gin.Context) {
+	var req service.GroupBudgetSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewGroupBudgetService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		respondGroupBudgetError(c, err)
+		return
+	}
+	setAuditDetail(c, "分组额度预算: %d 个分组, 告警 %v", len(settings.Budgets), settings.Enabled)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "分组额度预算已更新", "data": settings})
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/new-api-tools/backend/internal/models"
 )
 
+// apiVersion is reported by /api/health and the OpenAPI document
+const apiVersion = "0.1.0"
+
 // RegisterHealthRoutes registers health check endpoints
-func RegisterHealthRoutes(r *gin.Engine) {
+func RegisterHealthRoutes(r *gin.RouterGroup) {
 	r.GET("/api/health", HealthCheck)
 	r.GET("/api/health/db", DatabaseHealthCheck)
 }
@@ -19,7 +22,7 @@ func RegisterHealthRoutes(r *gin.Engine) {
 func HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, models.HealthResponse{
 		Status:  "healthy",
-		Version: "0.1.0",
+		Version: apiVersion,
 	})
 }
 
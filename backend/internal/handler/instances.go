@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// RegisterInstanceRoutes registers /api/instances endpoints
+func RegisterInstanceRoutes(r *gin.RouterGroup) {
+	r.GET("/instances", ListInstances)
+}
+
+// GET /api/instances
+func ListInstances(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"items":   database.ListInstances(),
+			"current": instanceParam(c),
+		},
+	})
+}
+
+// instanceParam returns the instance resolved by middleware.InstanceMiddleware ("" = primary)
+func instanceParam(c *gin.Context) string {
+	return c.GetString("instance")
+}
+
+// instanceHandlers read instanceParam and so honour the X-Instance selector.
+// Every other handler runs against the primary instance, so
+// middleware.InstanceMiddleware rejects a selector sent to them instead of
+// silently acting on the wrong database.
+var instanceHandlers = handlerNames(
+	ListInstances,
+	// dashboard
+	GetSystemOverview, GetUsageStatistics, GetModelUsage, GetDailyTrends, GetHourlyTrends,
+	GetTopUsers, GetChannelStatus, InvalidateDashboardCache, GetIPDistribution,
+	// risk
+	GetLeaderboards, GetUserRiskAnalysis, ListBanRecords, GetTokenRotationUsers,
+	GetAffiliatedAccounts, GetInvitationGraph, GetSameIPRegistrations, GetDeviceClusters,
+	// IP monitoring
+	GetIPStats, GetSharedIPs, GetSharedIPTimeline, GetMultiIPTokens, GetMultiIPUsers,
+	EnableAllIPRecording, LookupIPUsers, GetUserIPs, GetIPIndexStatus,
+	// channels
+	ListChannels, GetChannel, UpdateChannel, SetChannelStatus, EnableChannel, DisableChannel,
+	BatchSetChannelStatus, GetChannelRouting, GetChannelGroupAudit,
+)
+
+func handlerNames(handlers ...gin.HandlerFunc) map[string]bool {
+	names := make(map[string]bool, len(handlers))
+	for _, h := range handlers {
+		// same naming as gin's RouteInfo.Handler / Context.HandlerName
+		names[runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()] = true
+	}
+	return names
+}
+
+// SupportsInstance reports whether the matched route honours X-Instance / ?instance=
+func SupportsInstance(handlerName string) bool {
+	return instanceHandlers[handlerName]
+}
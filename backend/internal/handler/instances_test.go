@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/middleware"
+)
+
+func TestInstanceSelectorRejectedOnUnawareRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", middleware.InstanceMiddleware(SupportsInstance))
+	reached := false
+	api.DELETE("/users/:user_id", func(c *gin.Context) { reached = true })
+	api.GET("/instances", ListInstances)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, "/api/users/1?instance=b", nil),
+		func() *http.Request {
+			req := httptest.NewRequest(http.MethodDelete, "/api/users/1", nil)
+			req.Header.Set("X-Instance", "b")
+			return req
+		}(),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_INSTANCE") {
+			t.Fatalf("expected INVALID_INSTANCE, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if reached {
+		t.Fatal("handler must not run against the primary instance")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/users/1?instance=default", nil))
+	if !reached || w.Code != http.StatusOK {
+		t.Fatalf("the default instance must pass, got %d: %s", w.Code, w.Body.String())
+	}
+
+	names := gin.New()
+	for i, h := range []gin.HandlerFunc{ListInstances, GetSystemOverview, GetLeaderboards, GetIPStats, EnableChannel} {
+		names.GET("/"+string(rune('a'+i)), h)
+	}
+	for _, route := range names.Routes() {
+		if !SupportsInstance(route.Handler) {
+			t.Errorf("%s must be instance-aware", route.Handler)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterIPBlocklistRoutes registers /api/ip/blocklist endpoints
+func RegisterIPBlocklistRoutes(r *gin.RouterGroup) {
+	g := r.Group("/ip/blocklist")
+	{
+		g.GET("", ListIPBlocklist)
+		g.POST("", AddIPBlocklistEntry)
+		g.PUT("/:id", UpdateIPBlocklistEntry)
+		g.DELETE("/:id", DeleteIPBlocklistEntry)
+		g.GET("/check", CheckIPBlocklist)
+		g.GET("/config", GetIPBlocklistConfig)
+		g.PUT("/config", UpdateIPBlocklistConfig)
+		g.POST("/enforce", EnforceIPBlocklist)
+		g.GET("/actions", ListIPBlocklistActions)
+	}
+}
+
+func respondIPBlocklistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCIDR):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrIPBlocklistEntryExists):
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_EXISTS", err.Error(), ""))
+	case errors.Is(err, service.ErrIPBlocklistNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "黑名单条目不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseIPBlocklistID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的条目 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api/ip/blocklist
+//
+// 本地黑名单条目，以及（配置开启时）AI 封禁配置中的 blacklist_ips（source=ai_ban，只读）。
+func ListIPBlocklist(c *gin.Context) {
+	entries, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).ListEntries(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": entries, "total": len(entries)}})
+}
+
+// POST /api/ip/blocklist
+//
+// 请求体 {"cidr": "203.0.113.0/24", "note": "..."}，单个 IP 自动转为 /32 或 /128。
+func AddIPBlocklistEntry(c *gin.Context) {
+	var req struct {
+		CIDR string `json:"cidr" binding:"required"`
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).AddEntry(c.Request.Context(), req.CIDR, req.Note)
+	if err != nil {
+		respondIPBlocklistError(c, err)
+		return
+	}
+	setAuditDetail(c, "IP 黑名单新增 %s", entry.CIDR)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已加入 IP 黑名单", "data": entry})
+}
+
+// PUT /api/ip/blocklist/:id
+func UpdateIPBlocklistEntry(c *gin.Context) {
+	id, ok := parseIPBlocklistID(c)
+	if !ok {
+		return
+	}
+	var req service.IPBlocklistEntryInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).UpdateEntry(c.Request.Context(), id, req)
+	if err != nil {
+		respondIPBlocklistError(c, err)
+		return
+	}
+	setAuditDetail(c, "IP 黑名单 #%d → %s (enabled=%v)", entry.ID, entry.CIDR, entry.Enabled)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "黑名单条目已更新", "data": entry})
+}
+
+// DELETE /api/ip/blocklist/:id
+func DeleteIPBlocklistEntry(c *gin.Context) {
+	id, ok := parseIPBlocklistID(c)
+	if !ok {
+		return
+	}
+	if err := service.NewIPBlocklistService().WithContext(c.Request.Context()).DeleteEntry(c.Request.Context(), id); err != nil {
+		respondIPBlocklistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "黑名单条目已删除"})
+}
+
+// GET /api/ip/blocklist/check?ip=1.2.3.4
+func CheckIPBlocklist(c *gin.Context) {
+	data, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).CheckIP(c.Request.Context(), c.Query("ip"))
+	if err != nil {
+		respondIPBlocklistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/ip/blocklist/config
+func GetIPBlocklistConfig(c *gin.Context) {
+	settings, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/ip/blocklist/config
+func UpdateIPBlocklistConfig(c *gin.Context) {
+	var req service.IPBlocklistSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "IP 黑名单执行: enabled=%v action=%s dry_run=%v", settings.Enabled, settings.Action, settings.DryRun)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "IP 黑名单配置已更新", "data": settings})
+}
+
+// POST /api/ip/blocklist/enforce
+//
+// 立即执行一轮。请求体可选 {"dry_run": true}，缺省时沿用配置中的 dry_run。
+func EnforceIPBlocklist(c *gin.Context) {
+	var req struct {
+		DryRun *bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+			return
+		}
+	}
+	result, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).Enforce(c.Request.Context(), req.DryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("ENFORCE_ERROR", err.Error(), ""))
+		return
+	}
+	if !result.DryRun {
+		setAuditDetail(c, "IP 黑名单执行: 命中 %d，处置 %d", len(result.Hits), result.Applied)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// GET /api/ip/blocklist/actions?limit=100
+func ListIPBlocklistActions(c *gin.Context) {
+	items, err := service.NewIPBlocklistService().WithContext(c.Request.Context()).ListActions(c.Request.Context(), parseLimit(c, 100, 1000))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": len(items)}})
+}
@@ -19,6 +19,7 @@ func RegisterIPMonitoringRoutes(r *gin.RouterGroup) {
 		g.GET("/stats", GetIPStats)
 		g.GET("/shared", GetSharedIPs)
 		g.GET("/shared-ips", GetSharedIPs)
+		g.GET("/shared-ips/:ip/timeline", GetSharedIPTimeline)
 		g.GET("/multi-ip-tokens", GetMultiIPTokens)
 		g.GET("/multi-ip-users", GetMultiIPUsers)
 		g.POST("/enable-all-recording", EnableAllIPRecording)
@@ -29,12 +30,13 @@ func RegisterIPMonitoringRoutes(r *gin.RouterGroup) {
 		g.POST("/indexes/ensure", EnsureIPIndexes)
 		g.GET("/geo/:ip", GetIPGeo)
 		g.POST("/geo/batch", GetIPGeoBatch)
+		g.POST("/geo/reload", ReloadIPGeo)
 	}
 }
 
 // GET /api/ip/stats
 func GetIPStats(c *gin.Context) {
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetIPStats()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -54,7 +56,7 @@ func GetSharedIPs(c *gin.Context) {
 	limit := parseLimit(c, 50, maxIPLimit)
 	noCache := c.Query("no_cache") == "true"
 
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetSharedIPs(window, minTokens, limit, noCache)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -74,7 +76,7 @@ func GetMultiIPTokens(c *gin.Context) {
 	limit := parseLimit(c, 50, maxIPLimit)
 	noCache := c.Query("no_cache") == "true"
 
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetMultiIPTokens(window, minIPs, limit, noCache)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -94,7 +96,7 @@ func GetMultiIPUsers(c *gin.Context) {
 	limit := parseLimit(c, 50, maxIPLimit)
 	noCache := c.Query("no_cache") == "true"
 
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetMultiIPUsers(window, minIPs, limit, noCache)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -105,7 +107,7 @@ func GetMultiIPUsers(c *gin.Context) {
 
 // POST /api/ip/enable-all-recording
 func EnableAllIPRecording(c *gin.Context) {
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.EnableAllIPRecording()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
@@ -114,6 +116,28 @@ func EnableAllIPRecording(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data, "message": data["message"]})
 }
 
+// GET /api/ip/shared-ips/:ip/timeline?window=24h&bucket=900
+//
+// 按时间桶列出各用户在该 IP 上的请求，用于区分同时使用（账号共享）与先后使用（动态 IP 重新分配）。
+// bucket 为桶宽（秒），缺省或桶数超过 200 时自动放宽；summary.pattern 为
+// simultaneous / sequential / mixed / single_user。
+func GetSharedIPTimeline(c *gin.Context) {
+	window := c.DefaultQuery("window", "24h")
+	if !validWindow(window) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid window value", ""))
+		return
+	}
+	bucket, _ := strconv.ParseInt(c.Query("bucket"), 10, 64)
+
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
+	data, err := svc.GetSharedIPTimeline(c.Param("ip"), window, bucket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
 // GET /api/ip/lookup/:ip
 func LookupIPUsers(c *gin.Context) {
 	ip := c.Param("ip")
@@ -125,7 +149,7 @@ func LookupIPUsers(c *gin.Context) {
 	limit := parseLimit(c, 100, maxIPLimit)
 	includeGeo := c.Query("include_geo") == "true"
 
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.LookupIPUsers(ip, window, limit, includeGeo)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -147,7 +171,7 @@ func GetUserIPs(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetUserIPs(userID, window)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -158,7 +182,7 @@ func GetUserIPs(c *gin.Context) {
 
 // GET /api/ip/indexes
 func GetIPIndexStatus(c *gin.Context) {
-	svc := service.NewIPMonitoringService()
+	svc := service.NewIPMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetIPIndexStatus()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -218,3 +242,18 @@ func GetIPGeoBatch(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": results})
 }
+
+// POST /api/ip/geo/reload
+//
+// 立即从磁盘重新加载 GeoIP 数据库（修复 / 替换文件后无需等待后台重试），
+// 并重新解析降级期间未能解析的 IP、刷新 IP 分布缓存。
+func ReloadIPGeo(c *gin.Context) {
+	data, err := service.ReloadIPGeo()
+	if err != nil {
+		resp := models.ErrorResp("GEOIP_UNAVAILABLE", "GeoIP 数据库加载失败", err.Error())
+		resp["data"] = data
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterIPReputationRoutes registers /api/ip/reputation endpoints
+func RegisterIPReputationRoutes(r *gin.RouterGroup) {
+	g := r.Group("/ip/reputation")
+	{
+		g.GET("/status", GetIPReputationStatus)
+		g.POST("/refresh", RefreshIPReputation)
+		g.GET("/config", GetIPReputationConfig)
+		g.PUT("/config", UpdateIPReputationConfig)
+		g.GET("/lookup/:ip", LookupIPReputation)
+		g.POST("/lookup", LookupIPReputationBatch)
+	}
+}
+
+// GET /api/ip/reputation/status
+//
+// 已加载的信誉列表（条目数、更新时间、最近一次下载错误）。
+func GetIPReputationStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.GetIPReputationService().Status()})
+}
+
+// POST /api/ip/reputation/refresh
+func RefreshIPReputation(c *gin.Context) {
+	status, err := service.GetIPReputationService().Refresh(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("REFRESH_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"sources": status}})
+}
+
+// GET /api/ip/reputation/config
+func GetIPReputationConfig(c *gin.Context) {
+	settings, err := service.GetIPReputationService().GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/ip/reputation/config
+//
+// sources 为整体替换：[{"name": "my-dc", "category": "datacenter", "url": "https://...", "enabled": true}]
+func UpdateIPReputationConfig(c *gin.Context) {
+	var req service.IPReputationSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.GetIPReputationService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidReputationSource) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "IP 信誉配置: enabled=%v, %d 个列表", settings.Enabled, len(settings.Sources))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "IP 信誉配置已更新", "data": settings})
+}
+
+// GET /api/ip/reputation/lookup/:ip
+func LookupIPReputation(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.ClassifyIP(c.Param("ip"))})
+}
+
+// POST /api/ip/reputation/lookup
+//
+// 请求体 {"ips": ["1.2.3.4", ...]}，最多 100 个。
+func LookupIPReputationBatch(c *gin.Context) {
+	var req struct {
+		IPs []string `json:"ips" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	if len(req.IPs) > 100 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Maximum 100 IPs per request", ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.ClassifyIPBatch(req.IPs)})
+}
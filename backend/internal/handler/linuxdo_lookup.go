@@ -13,6 +13,7 @@ func RegisterLinuxDoRoutes(r *gin.RouterGroup) {
 	g := r.Group("/linuxdo")
 	{
 		g.GET("/lookup/:linux_do_id", LinuxDoLookup)
+		g.GET("/trust-level/:linux_do_id", LinuxDoTrustLevel)
 	}
 }
 
@@ -58,7 +59,7 @@ func LinuxDoLookup(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewLinuxDoLookupService()
+	svc := service.NewLinuxDoLookupService().WithContext(c.Request.Context())
 	result, lookupErr := svc.LookupUsername(linuxDoID)
 
 	if lookupErr != nil {
@@ -86,3 +87,37 @@ func LinuxDoLookup(c *gin.Context) {
 		"data":    result,
 	})
 }
+
+// GET /api/linuxdo/trust-level/:linux_do_id
+// Reads the linux.do trust level (0-4) from the user's public profile; cached
+// for 7 days and used by trust_level whitelist rules.
+func LinuxDoTrustLevel(c *gin.Context) {
+	linuxDoID := c.Param("linux_do_id")
+	if linuxDoID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success":    false,
+			"message":    "linux_do_id 不能为空",
+			"error_type": "invalid_params",
+		})
+		return
+	}
+
+	result, lookupErr := service.NewLinuxDoLookupService().WithContext(c.Request.Context()).LookupTrustLevel(linuxDoID)
+	if lookupErr != nil {
+		resp := gin.H{
+			"success":    false,
+			"message":    lookupErr.Message,
+			"error_type": lookupErr.ErrorType,
+		}
+		if lookupErr.WaitSeconds > 0 {
+			resp["wait_seconds"] = lookupErr.WaitSeconds
+		}
+		c.JSON(lookupErr.StatusCode, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/logger"
 	"github.com/new-api-tools/backend/internal/models"
 	"github.com/new-api-tools/backend/internal/service"
 )
@@ -27,19 +31,32 @@ func RegisterLogAnalyticsRoutes(r *gin.RouterGroup) {
 		g.POST("/reset", ResetAnalytics)
 		g.GET("/sync-status", GetSyncStatus)
 		g.POST("/check-consistency", CheckDataConsistency)
+		g.GET("/ip-history", GetIPHistoryState)
+		g.GET("/rollups", GetAnalyticsRollupState)
+		g.GET("/rollups/backfill", GetRollupBackfill)
+		g.POST("/rollups/backfill", StartRollupBackfill)
+		g.POST("/rollups/backfill/cancel", CancelRollupBackfill)
+		g.GET("/anomalies", GetTrafficAnomalies)
+		g.GET("/anomalies/config", GetAnomalyConfig)
+		g.PUT("/anomalies/config", UpdateAnomalyConfig)
+		g.GET("/errors", GetErrorBreakdown)
+		g.GET("/failures", GetFailureSamples)
+		g.GET("/costs", GetCostAttribution)
+		g.GET("/costs/trend", GetCostTrend)
+		g.GET("/forecast", GetForecast)
 	}
 }
 
 // GET /api/analytics/state
 func GetAnalyticsState(c *gin.Context) {
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	state := svc.GetAnalyticsState()
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": state})
 }
 
 // POST /api/analytics/process
 func ProcessLogs(c *gin.Context) {
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	result, err := svc.ProcessLogs()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("PROCESS_ERROR", err.Error(), ""))
@@ -52,7 +69,7 @@ func ProcessLogs(c *gin.Context) {
 func BatchProcessLogs(c *gin.Context) {
 	maxIter, _ := strconv.Atoi(c.DefaultQuery("max_iterations", "100"))
 	maxIter = clampInt(maxIter, 1, 1000)
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	result, err := svc.BatchProcess(maxIter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("PROCESS_ERROR", err.Error(), ""))
@@ -61,10 +78,35 @@ func BatchProcessLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// includeArchived reports whether ?include_archived=1 asks to merge archived logs
+func includeArchived(c *gin.Context) bool {
+	v := c.Query("include_archived")
+	return v == "1" || v == "true"
+}
+
+// respondRankingWithArchive serves ?include_archived=1 rankings over the last
+// ?days=30 (1-365) days, labeled with the archive scan summary
+func respondRankingWithArchive(c *gin.Context, orderBy string, limit int) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	days = clampInt(days, 1, 365)
+	rows, scan, err := service.NewLogAnalyticsService().WithContext(c.Request.Context()).UserRankingWithArchive(c.Request.Context(), orderBy, days, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rows, "days": days, "archive": scan})
+}
+
 // GET /api/analytics/ranking/requests or /api/analytics/users/requests
+//
+// include_archived=1&days=90 时合并已清理、但已归档的日志（结果带 archive 标注）。
 func GetUserRequestRanking(c *gin.Context) {
 	limit := parseLimit(c, 10, 200)
-	svc := service.NewLogAnalyticsService()
+	if includeArchived(c) {
+		respondRankingWithArchive(c, "requests", limit)
+		return
+	}
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	data, err := svc.GetUserRequestRanking(limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -74,9 +116,15 @@ func GetUserRequestRanking(c *gin.Context) {
 }
 
 // GET /api/analytics/ranking/quota or /api/analytics/users/quota
+//
+// 参数同 /ranking/requests。
 func GetUserQuotaRanking(c *gin.Context) {
 	limit := parseLimit(c, 10, 200)
-	svc := service.NewLogAnalyticsService()
+	if includeArchived(c) {
+		respondRankingWithArchive(c, "quota", limit)
+		return
+	}
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	data, err := svc.GetUserQuotaRanking(limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -88,7 +136,7 @@ func GetUserQuotaRanking(c *gin.Context) {
 // GET /api/analytics/models
 func GetModelStatistics(c *gin.Context) {
 	limit := parseLimit(c, 20, 200)
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	data, err := svc.GetModelStatistics(limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -99,7 +147,7 @@ func GetModelStatistics(c *gin.Context) {
 
 // GET /api/analytics/summary
 func GetAnalyticsSummary(c *gin.Context) {
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	data, err := svc.GetSummary()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -110,7 +158,7 @@ func GetAnalyticsSummary(c *gin.Context) {
 
 // POST /api/analytics/reset
 func ResetAnalytics(c *gin.Context) {
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	if err := svc.ResetAnalytics(); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("RESET_ERROR", err.Error(), ""))
 		return
@@ -123,7 +171,7 @@ func ResetAnalytics(c *gin.Context) {
 
 // GET /api/analytics/sync-status
 func GetSyncStatus(c *gin.Context) {
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	data, err := svc.GetSyncStatus()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -135,7 +183,7 @@ func GetSyncStatus(c *gin.Context) {
 // POST /api/analytics/check-consistency
 func CheckDataConsistency(c *gin.Context) {
 	autoReset := c.DefaultQuery("auto_reset", "false") == "true"
-	svc := service.NewLogAnalyticsService()
+	svc := service.NewLogAnalyticsService().WithContext(c.Request.Context())
 	data, err := svc.CheckDataConsistency(autoReset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("CHECK_ERROR", err.Error(), ""))
@@ -143,3 +191,91 @@ func CheckDataConsistency(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
+
+// GET /api/analytics/ip-history
+//
+// 本地 ip_history 表的同步游标与行数；covers_24h 表示 IP 分析当前是否走该表。
+func GetIPHistoryState(c *gin.Context) {
+	svc := service.NewIPHistoryService()
+	state, err := svc.GetState(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	covers := svc.Covers(c.Request.Context(), time.Now().Unix()-86400)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"state": state, "covers_24h": covers}})
+}
+
+// GET /api/analytics/rollups
+//
+// 本地小时汇总表的同步游标与行数；covers_30d 表示排行 / 模型统计当前是否走汇总表。
+func GetAnalyticsRollupState(c *gin.Context) {
+	svc := service.NewAnalyticsRollupService()
+	state, err := svc.GetState(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	covers := svc.Covers(c.Request.Context(), time.Now().AddDate(0, 0, -30).Unix())
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"state": state, "covers_30d": covers}})
+}
+
+// GET /api/analytics/rollups/backfill
+//
+// 历史回填任务的状态与进度（status 为空表示从未执行）。
+func GetRollupBackfill(c *gin.Context) {
+	job, err := service.NewAnalyticsRollupService().GetBackfill(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
+
+// POST /api/analytics/rollups/backfill
+//
+// 请求体 {"days": 90, "rebuild": false}。从日志分批重建本地小时汇总（quota_data 缺失或损坏时的替代），
+// 中断后由后台分析任务自动续跑；rebuild=true 先清空现有汇总再重建。
+func StartRollupBackfill(c *gin.Context) {
+	var req struct {
+		Days    int  `json:"days"`
+		Rebuild bool `json:"rebuild"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewAnalyticsRollupService()
+	job, err := svc.StartBackfill(c.Request.Context(), req.Days, req.Rebuild)
+	switch {
+	case errors.Is(err, service.ErrInvalidRollupBackfill):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	case errors.Is(err, service.ErrRollupBackfillRunning):
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "历史回填正在进行中", ""))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+		if _, err := svc.RunBackfill(ctx, 0); err != nil && !errors.Is(err, service.ErrRollupBackfillRunning) {
+			logger.L.Warn("[分析汇总] 历史回填失败: "+err.Error(), logger.CatAnalytics)
+		}
+	}()
+	setAuditDetail(c, "启动汇总历史回填 %d 天 (rebuild=%v)", req.Days, req.Rebuild)
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "历史回填已开始", "data": job})
+}
+
+// POST /api/analytics/rollups/backfill/cancel
+func CancelRollupBackfill(c *gin.Context) {
+	job, err := service.NewAnalyticsRollupService().CancelBackfill(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "取消汇总历史回填")
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
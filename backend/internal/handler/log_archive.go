@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/system/archive?page=1&page_size=50
+//
+// 已写入对象存储 / 本地磁盘的日志归档清单（按 id 区间），以及累计行数 / 字节数。
+func ListLogArchives(c *gin.Context) {
+	page := parsePage(c)
+	pageSize := parsePageSize(c, 50, 200)
+	data, err := service.NewLogArchiveService().ListArchives(c.Request.Context(), pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/system/archive/config
+func GetLogArchiveConfig(c *gin.Context) {
+	settings, err := service.NewLogArchiveService().GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/system/archive/config
+//
+// secret_access_key 省略时保持不变，传空字符串清除。
+func UpdateLogArchiveConfig(c *gin.Context) {
+	var req service.LogArchiveSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewLogArchiveService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLogArchiveConfig) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "日志归档: enabled=%v storage=%s bucket=%s after=%dd", settings.Enabled, settings.Storage, settings.Bucket, settings.ArchiveAfterDays)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "日志归档配置已更新", "data": settings})
+}
+
+// POST /api/system/archive/test
+//
+// 列出前缀下的少量对象，验证 endpoint 与访问密钥（本地存储则验证目录可用）。
+func TestLogArchiveConnection(c *gin.Context) {
+	objects, err := service.NewLogArchiveService().TestConnection(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrLogArchiveNotConfigured) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("NOT_CONFIGURED", "对象存储尚未配置", ""))
+			return
+		}
+		c.JSON(http.StatusBadGateway, models.ErrorResp("STORAGE_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"objects": objects}})
+}
+
+// GET /api/system/archive/status
+func GetLogArchiveStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.NewLogArchiveService().GetRun()})
+}
+
+// POST /api/system/archive/run
+//
+// 立即在后台执行一轮归档，进度通过 GET /api/system/archive/status 查看。
+func RunLogArchive(c *gin.Context) {
+	svc := service.NewLogArchiveService()
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	if !settings.Ready() {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("NOT_CONFIGURED", "对象存储尚未配置", ""))
+		return
+	}
+	if svc.GetRun().Running {
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "日志归档正在进行中", ""))
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+		if _, err := svc.Run(ctx, "manual"); err != nil && !errors.Is(err, service.ErrLogArchiveRunning) {
+			logger.L.Warn("[日志归档] 手动归档失败: " + err.Error())
+		}
+	}()
+	setAuditDetail(c, "手动触发日志归档")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "日志归档已开始"})
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// POST /api/logs/:id/replay
+//
+// 按失败日志还原模型、令牌、渠道信息，通过 NewAPI 渠道测试在同一渠道、同一模型上重新发起一次测试请求，
+// 记录结果（persists=true 表示故障仍在）。
+func ReplayLog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的日志 ID", ""))
+		return
+	}
+	replay, err := service.NewLogReplayService().WithContext(c.Request.Context()).Replay(c.Request.Context(), id, operatorIdentity(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrProbeNotConfigured):
+			c.JSON(http.StatusBadRequest, models.ErrorResp("NOT_CONFIGURED", err.Error(), ""))
+		case errors.Is(err, service.ErrInvalidReplay):
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		case errors.Is(err, service.ErrLogNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "日志不存在", ""))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("PROBE_ERROR", err.Error(), ""))
+		}
+		return
+	}
+	setAuditDetail(c, "重放失败日志 #%d（渠道 #%d %s）", id, replay.ChannelID, replay.Model)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": replay})
+}
+
+// GET /api/logs/replays?log_id=&limit=50
+func ListLogReplays(c *gin.Context) {
+	logID, _ := strconv.ParseInt(c.Query("log_id"), 10, 64)
+	replays, err := service.NewLogReplayService().ListReplays(c.Request.Context(), logID, parseLimit(c, 50, 500))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": replays, "total": len(replays)}})
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterLogSearchRoutes registers /api/logs endpoints
+func RegisterLogSearchRoutes(r *gin.RouterGroup) {
+	g := r.Group("/logs")
+	{
+		g.GET("/search", SearchLogs)
+		g.GET("/replays", ListLogReplays)
+		g.POST("/:id/replay", ReplayLog)
+	}
+}
+
+// GET /api/logs/search?user_id=&username=&token_id=&token_name=&model_name=gpt-4*&channel_id=&ip=
+// &type=requests|consume|error|all&content=&start_time=&end_time=&cursor=&limit=50
+//
+// 按条件检索原始日志（最新在前），时间范围默认最近 24 小时、最长 31 天；
+// 翻页时把上一页返回的 next_cursor 作为 cursor 传入。
+func SearchLogs(c *gin.Context) {
+	q := service.LogSearchQuery{
+		Username:  c.Query("username"),
+		TokenName: c.Query("token_name"),
+		ModelName: c.Query("model_name"),
+		IP:        c.Query("ip"),
+		Type:      c.Query("type"),
+		Content:   c.Query("content"),
+		Limit:     parseLimit(c, 50, 200),
+	}
+	for param, dst := range map[string]*int64{
+		"user_id":    &q.UserID,
+		"token_id":   &q.TokenID,
+		"channel_id": &q.ChannelID,
+		"start_time": &q.StartTime,
+		"end_time":   &q.EndTime,
+		"cursor":     &q.Cursor,
+	} {
+		if v := c.Query(param); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的 "+param, ""))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	data, err := service.NewLogSearchService().WithContext(c.Request.Context()).Search(q)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLogSearch) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondMaintenanceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMaintenance):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrMaintenanceNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "维护窗口不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseMaintenanceID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的维护窗口 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api/model-status/maintenance?all=false&limit=50
+//
+// 维护窗口列表（按开始时间倒序），默认只返回进行中与未开始的窗口，all=true 含已结束。
+func ListMaintenanceWindows(c *gin.Context) {
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	windows, err := svc.ListMaintenanceWindows(c.Request.Context(), c.Query("all") == "true", parseLimit(c, 50, 200))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": windows, "total": len(windows)}})
+}
+
+// POST /api/model-status/maintenance
+//
+// 请求体 {"title": "上游迁移", "message": "", "channel_ids": [3], "models": ["gpt-4o"],
+// "starts_at": 1735689600, "ends_at": 1735696800}。窗口内相关渠道不做主动探测与熔断，
+// 相关模型不推送状态变化 / 流量异常告警，可用率不计宕机，公开状态页显示维护中。
+func CreateMaintenanceWindow(c *gin.Context) {
+	var req service.MaintenanceWindowInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	window, err := svc.CreateMaintenanceWindow(c.Request.Context(), req, operatorIdentity(c))
+	if err != nil {
+		respondMaintenanceError(c, err)
+		return
+	}
+	setAuditDetail(c, "维护窗口 #%d %s: 渠道 %v 模型 %v", window.ID, window.Title, window.ChannelIDs, window.Models)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "维护窗口已创建", "data": window})
+}
+
+// PUT /api/model-status/maintenance/:id
+//
+// 部分更新，例如 {"ends_at": 1735690000} 提前结束维护。
+func UpdateMaintenanceWindow(c *gin.Context) {
+	id, ok := parseMaintenanceID(c)
+	if !ok {
+		return
+	}
+	var req service.MaintenanceWindowInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	window, err := svc.UpdateMaintenanceWindow(c.Request.Context(), id, req)
+	if err != nil {
+		respondMaintenanceError(c, err)
+		return
+	}
+	setAuditDetail(c, "维护窗口 #%d %s: %d ~ %d", window.ID, window.Title, window.StartsAt, window.EndsAt)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "维护窗口已更新", "data": window})
+}
+
+// DELETE /api/model-status/maintenance/:id
+func DeleteMaintenanceWindow(c *gin.Context) {
+	id, ok := parseMaintenanceID(c)
+	if !ok {
+		return
+	}
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	if err := svc.DeleteMaintenanceWindow(c.Request.Context(), id); err != nil {
+		respondMaintenanceError(c, err)
+		return
+	}
+	setAuditDetail(c, "删除维护窗口 #%d", id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "维护窗口已删除"})
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/new-api-tools/backend/internal/models"
@@ -45,15 +48,34 @@ func RegisterModelStatusRoutes(r *gin.RouterGroup) {
 		g.PUT("/config/site-title", SetSiteTitleConfig)
 		g.POST("/config/site-title", SetSiteTitleConfig)
 		g.GET("/token-groups", GetTokenGroupsForModelStatus)
+		g.GET("/top-models", GetTopModelsHandler)
+		g.GET("/config/profiles", ListEmbedProfiles)
+		g.PUT("/config/profiles/:name", SaveEmbedProfile)
+		g.DELETE("/config/profiles/:name", DeleteEmbedProfile)
+		g.GET("/config/embed-token", GetEmbedTokenConfig)
+		g.PUT("/config/embed-token", SetEmbedTokenConfig)
+		g.GET("/probes", GetChannelProbes)
+		g.POST("/probes/run", RunChannelProbes)
+		g.GET("/probes/config", GetChannelProbeConfig)
+		g.PUT("/probes/config", UpdateChannelProbeConfig)
+		g.GET("/latency", GetLatencyOverview)
+		g.GET("/latency/:model_name", GetModelLatency)
+		g.GET("/matrix", GetModelMatrix)
+		g.GET("/uptime", GetModelUptimeSummary)
+		g.GET("/uptime/:model_name", GetModelUptimeHistory)
+		g.GET("/maintenance", ListMaintenanceWindows)
+		g.POST("/maintenance", CreateMaintenanceWindow)
+		g.PUT("/maintenance/:id", UpdateMaintenanceWindow)
+		g.DELETE("/maintenance/:id", DeleteMaintenanceWindow)
 	}
 
 }
 
 // RegisterModelStatusEmbedRoutes registers public embed endpoints (no auth)
 // Supports both /api/embed/model-status/... and /api/model-status/embed/... paths
-func RegisterModelStatusEmbedRoutes(r *gin.Engine) {
+func RegisterModelStatusEmbedRoutes(r *gin.RouterGroup) {
 	// Original embed path: /api/embed/model-status/...
-	g := r.Group("/api/embed/model-status")
+	g := r.Group("/api/embed/model-status", EmbedTokenGate())
 	{
 		g.GET("/time-windows", GetTimeWindows)
 		g.GET("/models", GetAvailableModels)
@@ -64,10 +86,13 @@ func RegisterModelStatusEmbedRoutes(r *gin.Engine) {
 		g.GET("/config", GetEmbedConfig)
 		g.GET("/config/selected", GetSelectedModels)
 		g.GET("/token-groups", GetTokenGroupsForModelStatus)
+		g.GET("/top-models", GetTopModelsHandler)
+		g.GET("/uptime", GetModelUptimeSummary)
+		g.GET("/uptime/:model_name", GetModelUptimeHistory)
 	}
 
 	// Compat embed path: /api/model-status/embed/... (used by embed.html frontend)
-	e := r.Group("/api/model-status/embed")
+	e := r.Group("/api/model-status/embed", EmbedTokenGate())
 	{
 		e.GET("/time-windows", GetTimeWindows)
 		e.GET("/models", GetAvailableModels)
@@ -78,6 +103,32 @@ func RegisterModelStatusEmbedRoutes(r *gin.Engine) {
 		e.GET("/config", GetEmbedConfig)
 		e.GET("/config/selected", GetSelectedModels)
 		e.GET("/token-groups", GetTokenGroupsForModelStatus)
+		e.GET("/top-models", GetTopModelsHandler)
+		e.GET("/uptime", GetModelUptimeSummary)
+		e.GET("/uptime/:model_name", GetModelUptimeHistory)
+	}
+}
+
+// EmbedTokenGate rejects public embed requests without the configured embed
+// token (?token= or X-Embed-Token). /config and /config/selected stay open:
+// they carry display settings only, and let the embed page learn that a
+// token is required.
+func EmbedTokenGate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if strings.HasSuffix(path, "/config") || strings.HasSuffix(path, "/config/selected") {
+			c.Next()
+			return
+		}
+		token := c.GetHeader("X-Embed-Token")
+		if token == "" {
+			token = c.Query("token")
+		}
+		if !service.NewModelStatusService().CheckEmbedToken(token) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResp("UNAUTHORIZED", "嵌入访问令牌无效", ""))
+			return
+		}
+		c.Next()
 	}
 }
 
@@ -92,7 +143,7 @@ func GetTimeWindows(c *gin.Context) {
 
 // GET /models
 func GetAvailableModels(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	data, err := svc.GetAvailableModels()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -106,7 +157,7 @@ func GetSingleModelStatus(c *gin.Context) {
 	modelName := c.Param("model_name")
 	window := c.DefaultQuery("window", service.DefaultTimeWindow)
 
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	data, err := svc.GetModelStatus(modelName, window)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -115,6 +166,88 @@ func GetSingleModelStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
+// GET /api/model-status/latency?window=24h&limit=50
+//
+// 各模型成功请求的 use_time 分位数（秒），按请求量降序。
+func GetLatencyOverview(c *gin.Context) {
+	window := c.DefaultQuery("window", service.DefaultTimeWindow)
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	data, err := svc.GetLatencyOverview(window, parseLimit(c, 50, 500))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/model-status/latency/:model_name?window=24h
+//
+// 单模型 p50/p90/p99 时间序列（window: 1h/6h/12h/24h/3d/7d），
+// previous 为上一个等长窗口的汇总，便于发现均值掩盖的长尾劣化。
+func GetModelLatency(c *gin.Context) {
+	window := c.DefaultQuery("window", service.DefaultTimeWindow)
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	data, err := svc.GetModelLatency(c.Param("model_name"), window)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/model-status/uptime?models=gpt-4o,claude-3-5-sonnet
+//
+// 各模型近 30 / 90 天可用率（按 5 分钟时间槽，非 red 槽占比），
+// 未指定 models 时使用已选模型，仍为空则返回全部有记录的模型。
+func GetModelUptimeSummary(c *gin.Context) {
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	var modelNames []string
+	if v := c.Query("models"); v != "" {
+		modelNames = strings.Split(v, ",")
+	} else {
+		modelNames = svc.GetSelectedModels()
+	}
+	data, err := svc.GetUptimeSummary(c.Request.Context(), modelNames)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/model-status/uptime/:model_name?days=90
+//
+// 单模型按天的可用率条形历史（最长 90 天，含今天），类似状态页。
+func GetModelUptimeHistory(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "90"))
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	data, err := svc.GetUptimeHistory(c.Request.Context(), c.Param("model_name"), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/model-status/matrix?window=24h&limit=30&models=gpt-4o,claude-3-5-sonnet
+//
+// 渠道 × 模型可用性矩阵：每个有流量的组合的成功率与平均耗时（window: 1h/6h/12h/24h/3d/7d），
+// 未指定 models 时只保留请求量最多的 limit 个模型。
+func GetModelMatrix(c *gin.Context) {
+	window := c.DefaultQuery("window", service.DefaultTimeWindow)
+	var modelNames []string
+	if v := c.Query("models"); v != "" {
+		modelNames = strings.Split(v, ",")
+	}
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	data, err := svc.GetModelMatrix(window, modelNames, parseLimit(c, 30, 200))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
 // POST /status/multiple
 func GetMultipleModelsStatusHandler(c *gin.Context) {
 	var modelNames []string
@@ -124,7 +257,7 @@ func GetMultipleModelsStatusHandler(c *gin.Context) {
 	}
 	window := c.DefaultQuery("window", service.DefaultTimeWindow)
 
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	data, err := svc.GetMultipleModelsStatus(modelNames, window)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -142,7 +275,7 @@ func GetMultipleModelsStatusHandler(c *gin.Context) {
 func GetAllModelsStatusHandler(c *gin.Context) {
 	window := c.DefaultQuery("window", service.DefaultTimeWindow)
 
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	data, err := svc.GetAllModelsStatus(window)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -156,15 +289,20 @@ func GetAllModelsStatusHandler(c *gin.Context) {
 	})
 }
 
-// GET /selected
+// GET /selected?profile=
 func GetSelectedModels(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	themeProfile, ok := resolveEmbedThemeParam(c, svc)
+	if !ok {
+		return
+	}
 	config := svc.GetConfig()
 	c.JSON(http.StatusOK, gin.H{
 		"success":          true,
 		"data":             config["selected_models"],
 		"time_window":      config["time_window"],
-		"theme":            config["theme"],
+		"theme":            themeProfile["theme"],
+		"theme_profile":    themeProfile,
 		"refresh_interval": config["refresh_interval"],
 		"sort_mode":        config["sort_mode"],
 		"custom_order":     config["custom_order"],
@@ -173,6 +311,21 @@ func GetSelectedModels(c *gin.Context) {
 	})
 }
 
+// resolveEmbedThemeParam resolves ?profile= into a theme block (the global
+// theme when absent). Writes a 404 and returns false for an unknown profile.
+func resolveEmbedThemeParam(c *gin.Context, svc *service.ModelStatusService) (map[string]interface{}, bool) {
+	themeProfile, err := svc.ResolveEmbedTheme(c.Request.Context(), c.Query("profile"))
+	if err != nil {
+		if errors.Is(err, service.ErrEmbedProfileNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "嵌入主题配置不存在", ""))
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		}
+		return nil, false
+	}
+	return themeProfile, true
+}
+
 // PUT /selected
 func SetSelectedModels(c *gin.Context) {
 	var req struct {
@@ -182,7 +335,7 @@ func SetSelectedModels(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetSelectedModels(req.Models)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -193,7 +346,7 @@ func SetSelectedModels(c *gin.Context) {
 
 // GET /config/time-window
 func GetTimeWindowConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	config := svc.GetConfig()
 	c.JSON(http.StatusOK, gin.H{
 		"success":     true,
@@ -222,7 +375,7 @@ func SetTimeWindowConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid time window", ""))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetTimeWindow(req.TimeWindow)
 	c.JSON(http.StatusOK, gin.H{
 		"success":     true,
@@ -233,7 +386,7 @@ func SetTimeWindowConfig(c *gin.Context) {
 
 // GET /config/theme
 func GetThemeConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	config := svc.GetConfig()
 	c.JSON(http.StatusOK, gin.H{
 		"success":          true,
@@ -267,7 +420,7 @@ func SetThemeConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid theme", ""))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetTheme(theme)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -278,7 +431,7 @@ func SetThemeConfig(c *gin.Context) {
 
 // GET /config/refresh-interval
 func GetRefreshIntervalConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	config := svc.GetConfig()
 	c.JSON(http.StatusOK, gin.H{
 		"success":          true,
@@ -307,7 +460,7 @@ func SetRefreshIntervalConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid refresh interval", ""))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetRefreshInterval(req.RefreshInterval)
 	c.JSON(http.StatusOK, gin.H{
 		"success":          true,
@@ -318,7 +471,7 @@ func SetRefreshIntervalConfig(c *gin.Context) {
 
 // GET /config/sort-mode
 func GetSortModeConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	config := svc.GetConfig()
 	c.JSON(http.StatusOK, gin.H{
 		"success":   true,
@@ -347,7 +500,7 @@ func SetSortModeConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid sort mode", ""))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetSortMode(req.SortMode)
 	c.JSON(http.StatusOK, gin.H{
 		"success":   true,
@@ -365,7 +518,7 @@ func SetCustomOrderConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetCustomOrder(req.CustomOrder)
 	c.JSON(http.StatusOK, gin.H{
 		"success":      true,
@@ -374,16 +527,22 @@ func SetCustomOrderConfig(c *gin.Context) {
 	})
 }
 
-// GET /config (embed)
+// GET /config?profile= (embed)
 func GetEmbedConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	themeProfile, ok := resolveEmbedThemeParam(c, svc)
+	if !ok {
+		return
+	}
 	config := svc.GetEmbedConfig()
+	config["theme"] = themeProfile["theme"]
+	config["theme_profile"] = themeProfile
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": config})
 }
 
 // GET /config/groups
 func GetCustomGroupsConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	groups := svc.GetCustomGroups()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -400,7 +559,7 @@ func SetCustomGroupsConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetCustomGroups(req.Groups)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -411,7 +570,7 @@ func SetCustomGroupsConfig(c *gin.Context) {
 
 // GET /token-groups
 func GetTokenGroupsForModelStatus(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	groups, err := svc.GetTokenGroups()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -423,9 +582,111 @@ func GetTokenGroupsForModelStatus(c *gin.Context) {
 	})
 }
 
+// GET /top-models?window=7d&limit=10&profile=
+//
+// 热门模型请求量排行（仅计数，不含用户数据），嵌入图表使用。
+func GetTopModelsHandler(c *gin.Context) {
+	window := c.DefaultQuery("window", service.DefaultTopModelsWindow)
+	limit := parseLimit(c, 10, 50)
+
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	themeProfile, ok := resolveEmbedThemeParam(c, svc)
+	if !ok {
+		return
+	}
+	data, err := svc.GetTopModels(window, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data, "theme_profile": themeProfile, "cache_ttl": 600})
+}
+
+// GET /config/profiles
+func ListEmbedProfiles(c *gin.Context) {
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	profiles, err := svc.ListEmbedProfiles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":              true,
+		"data":                 profiles,
+		"available_themes":     service.AvailableThemes,
+		"available_dark_modes": service.AvailableEmbedDarkModes,
+	})
+}
+
+// PUT /config/profiles/:name
+//
+// 创建或覆盖命名嵌入主题，嵌入地址带 ?profile=name 即可使用。
+func SaveEmbedProfile(c *gin.Context) {
+	var req service.EmbedProfile
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
+		return
+	}
+	req.Name = c.Param("name")
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	profile, err := svc.SaveEmbedProfile(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidEmbedProfile) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		}
+		return
+	}
+	setAuditDetail(c, "嵌入主题 %s → %s", profile.Name, profile.Theme)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": profile, "message": "Embed profile saved"})
+}
+
+// DELETE /config/profiles/:name
+func DeleteEmbedProfile(c *gin.Context) {
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	if err := svc.DeleteEmbedProfile(c.Request.Context(), c.Param("name")); err != nil {
+		if errors.Is(err, service.ErrEmbedProfileNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "嵌入主题配置不存在", ""))
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Embed profile deleted"})
+}
+
+// GET /config/embed-token
+func GetEmbedTokenConfig(c *gin.Context) {
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"success": true, "embed_token": svc.GetEmbedToken()})
+}
+
+// PUT /config/embed-token
+//
+// 设置公开嵌入（状态 / 热门模型）的访问令牌，留空则不校验。
+func SetEmbedTokenConfig(c *gin.Context) {
+	var req struct {
+		EmbedToken string `json:"embed_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
+		return
+	}
+	token := strings.TrimSpace(req.EmbedToken)
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
+	svc.SetEmbedToken(token)
+	setAuditDetail(c, "嵌入访问令牌: required=%v", token != "")
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"embed_token": token,
+		"message":     "Embed token updated",
+	})
+}
+
 // GET /config/site-title
 func GetSiteTitleConfig(c *gin.Context) {
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	c.JSON(http.StatusOK, gin.H{
 		"success":    true,
 		"site_title": svc.GetSiteTitle(),
@@ -441,7 +702,7 @@ func SetSiteTitleConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request", err.Error()))
 		return
 	}
-	svc := service.NewModelStatusService()
+	svc := service.NewModelStatusService().WithContext(c.Request.Context())
 	svc.SetSiteTitle(req.SiteTitle)
 	c.JSON(http.StatusOK, gin.H{
 		"success":    true,
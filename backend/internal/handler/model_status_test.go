@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// installEmbedRouter serves the public embed routes over an empty logs table,
+// with the config cache seeded with the kind of values a cold or stale Redis
+// hands back: nulls, wrong shapes and options that no longer exist.
+func installEmbedRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, type INTEGER, model_name TEXT, created_at INTEGER)`)
+	database.SetForTesting(&database.Manager{DB: db})
+
+	cm := cache.Get()
+	seeded := map[string]interface{}{
+		"model_status:time_window":      "90d",
+		"model_status:theme":            nil,
+		"model_status:refresh_interval": 7,
+		"model_status:sort_mode":        "",
+		"model_status:custom_order":     nil,
+		"model_status:selected_models":  nil,
+		"model_status:custom_groups": []interface{}{
+			map[string]interface{}{"name": "GPT"},
+			map[string]interface{}{"id": "claude", "models": []string{"claude-3", ""}},
+			map[string]interface{}{"icon": "x"},
+		},
+	}
+	for k, v := range seeded {
+		_ = cm.Set(k, v, 0)
+	}
+	_ = cm.Set(cache.Key("model_status:available_models"), nil, 0)
+	t.Cleanup(func() {
+		for k := range seeded {
+			_ = cm.Delete(k)
+		}
+		_ = cm.Delete(cache.Key("model_status:available_models"))
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterModelStatusEmbedRoutes(r.Group(""))
+	return r
+}
+
+func getEmbedJSON(t *testing.T, r *gin.Engine, path string) map[string]interface{} {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body = %s", path, rec.Code, rec.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: decode: %v", path, err)
+	}
+	return body
+}
+
+// assertEmbedConfigSchema checks every config key is present with its type
+func assertEmbedConfigSchema(t *testing.T, path string, cfg map[string]interface{}, selectedKey string) {
+	t.Helper()
+	want := map[string]string{
+		"time_window": "string", "theme": "string", "refresh_interval": "number",
+		"sort_mode": "string", "custom_order": "array", selectedKey: "array",
+		"custom_groups": "array", "site_title": "string", "theme_profile": "object",
+	}
+	for key, typ := range want {
+		if got := jsonType(cfg[key]); got != typ {
+			t.Errorf("%s: %s is %s, want %s (%v)", path, key, got, typ, cfg[key])
+		}
+	}
+	if cfg["time_window"] != service.DefaultTimeWindow || cfg["theme"] != service.DefaultTheme ||
+		cfg["refresh_interval"] != float64(60) || cfg["sort_mode"] != "default" {
+		t.Errorf("%s: invalid values should fall back to defaults, got %v", path, cfg)
+	}
+
+	groups, _ := cfg["custom_groups"].([]interface{})
+	if len(groups) != 2 {
+		t.Fatalf("%s: groups without id or name should be dropped, got %v", path, groups)
+	}
+	for _, g := range groups {
+		group, _ := g.(map[string]interface{})
+		for _, key := range service.EmbedCustomGroupKeys {
+			if group[key] == nil {
+				t.Errorf("%s: custom group missing %s: %v", path, key, group)
+			}
+		}
+	}
+	if models := groups[1].(map[string]interface{})["models"].([]interface{}); len(models) != 1 {
+		t.Errorf("%s: blank model names should be dropped, got %v", path, models)
+	}
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func TestEmbedConfigSchemaIsCompleteWithStaleCache(t *testing.T) {
+	r := installEmbedRouter(t)
+
+	for _, prefix := range []string{"/api/model-status/embed", "/api/embed/model-status"} {
+		body := getEmbedJSON(t, r, prefix+"/config")
+		cfg, _ := body["data"].(map[string]interface{})
+		assertEmbedConfigSchema(t, prefix+"/config", cfg, "selected_models")
+		for _, key := range service.EmbedConfigKeys {
+			if _, ok := cfg[key]; !ok {
+				t.Errorf("%s/config: missing key %s", prefix, key)
+			}
+		}
+		for _, key := range []string{"available_time_windows", "available_themes", "available_refresh_intervals",
+			"available_sort_modes", "available_top_models_windows"} {
+			if jsonType(cfg[key]) != "array" {
+				t.Errorf("%s/config: %s is %v", prefix, key, cfg[key])
+			}
+		}
+
+		assertEmbedConfigSchema(t, prefix+"/config/selected", getEmbedJSON(t, r, prefix+"/config/selected"), "data")
+	}
+}
+
+func TestEmbedListsAreNeverNull(t *testing.T) {
+	r := installEmbedRouter(t)
+
+	for _, path := range []string{"/api/model-status/embed/models", "/api/model-status/embed/time-windows",
+		"/api/model-status/embed/status/all"} {
+		if body := getEmbedJSON(t, r, path); jsonType(body["data"]) != "array" {
+			t.Errorf("%s: data should be an array, got %v", path, body["data"])
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"embed"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/apidoc"
+	"github.com/new-api-tools/backend/internal/auth"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/models"
+)
+
+// RegisterOpenAPIRoutes registers the API description (no auth required).
+// routes is called on first request, after every route has been registered.
+func RegisterOpenAPIRoutes(r *gin.RouterGroup, routes func() gin.RoutesInfo) {
+	openAPIRoutes = routes
+	r.GET("/api/openapi.json", GetOpenAPISpec)
+	r.GET("/api/docs", GetSwaggerUI)
+	r.GET("/api/docs/:file", GetSwaggerUIAsset)
+}
+
+// publicPrefixes are served outside the authenticated api group
+var publicPrefixes = []string{"/api/public/", "/api/openapi.json", "/api/docs"}
+
+// embedPrefixes are gated by EmbedTokenGate when an embed token is configured
+var embedPrefixes = []string{"/api/embed/", "/api/model-status/embed/"}
+
+var (
+	openAPIRoutes func() gin.RoutesInfo
+	openAPIOnce   sync.Once
+	openAPIDoc    map[string]any
+	openAPIErr    error
+)
+
+// GET /api/openapi.json
+// OpenAPI 3.0 描述：路由取自实际注册表，参数与请求 / 响应模型取自 go generate 生成的 docs.json。
+func GetOpenAPISpec(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		docs, err := apidoc.Load()
+		if err != nil {
+			openAPIErr = err
+			return
+		}
+		var routes []apidoc.Route
+		for _, r := range openAPIRoutes() {
+			routes = append(routes, apidoc.Route{Method: r.Method, Path: r.Path, Handler: r.Handler})
+		}
+		openAPIDoc = apidoc.Build(routes, docs, apidoc.Options{
+			Title:    "NewAPI Middleware Tool API",
+			Version:  apiVersion,
+			BasePath: config.BasePath(),
+			Security: routeSecurity,
+			Instance: SupportsInstance,
+		})
+	})
+	if openAPIErr != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("INTERNAL_ERROR", "加载接口文档失败", openAPIErr.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, openAPIDoc)
+}
+
+// routeSecurity mirrors auth.AuthMiddleware and EmbedTokenGate
+func routeSecurity(path string) []map[string][]string {
+	if auth.SkipPaths[path] || hasAnyPrefix(path, auth.SkipPrefixes) || hasAnyPrefix(path, publicPrefixes) {
+		return []map[string][]string{}
+	}
+	if hasAnyPrefix(path, embedPrefixes) {
+		return []map[string][]string{{"embedToken": {}}, {}}
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/docs
+// Swagger UI（静态资源随二进制内嵌，见 swaggerui/），读取同源的 /api/openapi.json
+func GetSwaggerUI(c *gin.Context) {
+	base := config.BasePath()
+	html := strings.NewReplacer("{{SPEC_URL}}", base+"/api/openapi.json", "{{ASSETS}}", base+"/api/docs").Replace(swaggerUIPage)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// swaggerUIAssets is swagger-ui-dist 5.18.2; to upgrade, replace both files
+// from the npm package and bump the version in swaggerui/LICENSE
+//
+//go:embed swaggerui/swagger-ui.css swaggerui/swagger-ui-bundle.js
+var swaggerUIAssets embed.FS
+
+// GET /api/docs/:file
+// Swagger UI 静态资源（swagger-ui.css / swagger-ui-bundle.js）
+func GetSwaggerUIAsset(c *gin.Context) {
+	data, err := swaggerUIAssets.ReadFile("swaggerui/" + c.Param("file"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "资源不存在", ""))
+		return
+	}
+	contentType := "text/css; charset=utf-8"
+	if strings.HasSuffix(c.Param("file"), ".js") {
+		contentType = "application/javascript; charset=utf-8"
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>NewAPI Middleware Tool API</title>
+<link rel="stylesheet" href="{{ASSETS}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{ASSETS}}/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({ url: "{{SPEC_URL}}", dom_id: "#swagger-ui" });
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestSwaggerUIServesVendoredAssets(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterOpenAPIRoutes(&r.RouterGroup, r.Routes)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	page := get("/api/docs").Body.String()
+	if strings.Contains(page, "https://") || strings.Contains(page, "persistAuthorization") {
+		t.Fatalf("docs page must not load remote assets or persist credentials:\n%s", page)
+	}
+	for _, asset := range []string{"/api/docs/swagger-ui.css", "/api/docs/swagger-ui-bundle.js"} {
+		if !strings.Contains(page, asset) {
+			t.Fatalf("docs page does not reference %s", asset)
+		}
+		if w := get(asset); w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Fatalf("GET %s = %d (%d bytes)", asset, w.Code, w.Body.Len())
+		}
+	}
+	if w := get("/api/docs/LICENSE"); w.Code != http.StatusNotFound {
+		t.Fatalf("only the embedded assets should be served, got %d", w.Code)
+	}
+}
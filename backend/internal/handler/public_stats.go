@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterPublicStatsRoutes registers the unauthenticated /api/public/stats endpoint
+func RegisterPublicStatsRoutes(r *gin.RouterGroup) {
+	r.GET("/api/public/stats", GetPublicStats)
+}
+
+// RegisterPublicStatsAdminRoutes registers /api/public-stats config endpoints
+func RegisterPublicStatsAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/public-stats")
+	{
+		g.GET("/config", GetPublicStatsConfig)
+		g.PUT("/config", UpdatePublicStatsConfig)
+		g.GET("/preview", PreviewPublicStats)
+	}
+}
+
+// GET /api/public/stats
+//
+// 公开透明度统计（无需认证）。仅返回配置白名单中的预聚合字段，结果按 cache_minutes 缓存；未启用时 404。
+func GetPublicStats(c *gin.Context) {
+	svc := service.NewPublicStatsService().WithContext(c.Request.Context())
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil || !settings.Enabled {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "公开统计未启用", ""))
+		return
+	}
+	stats, err := svc.GetPublicStats(c.Request.Context(), settings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", "统计数据暂不可用", ""))
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", settings.CacheMinutes*60))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
+
+// GET /api/public-stats/config
+func GetPublicStatsConfig(c *gin.Context) {
+	settings, err := service.NewPublicStatsService().WithContext(c.Request.Context()).GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"config":           settings,
+		"available_fields": service.PublicStatFields,
+	}})
+}
+
+// PUT /api/public-stats/config
+func UpdatePublicStatsConfig(c *gin.Context) {
+	var req service.PublicStatsSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewPublicStatsService().WithContext(c.Request.Context())
+	settings, err := svc.UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "公开统计: enabled=%v fields=%v", settings.Enabled, settings.Fields)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "公开统计配置已更新", "data": settings})
+}
+
+// GET /api/public-stats/preview
+//
+// 预览公开接口将返回的内容（未启用时同样可用）。
+func PreviewPublicStats(c *gin.Context) {
+	svc := service.NewPublicStatsService().WithContext(c.Request.Context())
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	stats, err := svc.GetPublicStats(c.Request.Context(), settings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"enabled": settings.Enabled, "stats": stats}})
+}
@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/new-api-tools/backend/internal/models"
@@ -16,6 +21,13 @@ func RegisterRedemptionRoutes(r *gin.RouterGroup) {
 		g.POST("/generate", GenerateRedemptionCodes)
 		g.GET("", ListRedemptionCodes)
 		g.GET("/statistics", GetRedemptionStatistics)
+		g.GET("/export", ExportRedemptionCodes)
+		g.POST("/import", ImportRedemptionCodes)
+		g.GET("/analytics", GetRedemptionAnalytics)
+		g.GET("/analytics/trend", GetRedemptionTrend)
+		g.GET("/analytics/time-to-redeem", GetRedemptionLatency)
+		g.GET("/analytics/top-redeemers", GetTopRedeemers)
+		g.GET("/analytics/value-distribution", GetRedemptionValueDistribution)
 		g.POST("/batch-delete", BatchDeleteRedemptionCodes)
 		g.DELETE("/batch", BatchDeleteRedemptionCodes)
 		g.POST("/batch", BatchDeleteRedemptionCodes)
@@ -31,7 +43,7 @@ func GenerateRedemptionCodes(c *gin.Context) {
 		return
 	}
 
-	result, err := service.GenerateCodes(req)
+	result, err := service.GenerateCodes(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("GENERATION_ERROR", err.Error(), ""))
 		return
@@ -66,7 +78,7 @@ func ListRedemptionCodes(c *gin.Context) {
 		EndDate:   c.Query("end_date"),
 	}
 
-	result, err := service.ListCodes(params)
+	result, err := service.ListCodes(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -83,7 +95,7 @@ func GetRedemptionStatistics(c *gin.Context) {
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 
-	stats, err := service.GetRedemptionStatistics(startDate, endDate)
+	stats, err := service.GetRedemptionStatistics(c.Request.Context(), startDate, endDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -105,7 +117,7 @@ func BatchDeleteRedemptionCodes(c *gin.Context) {
 		return
 	}
 
-	affected, err := service.DeleteCodes(req.IDs)
+	affected, err := service.DeleteCodes(c.Request.Context(), req.IDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("DELETE_ERROR", err.Error(), ""))
 		return
@@ -126,7 +138,7 @@ func DeleteRedemptionCode(c *gin.Context) {
 		return
 	}
 
-	affected, err := service.DeleteCodes([]int64{id})
+	affected, err := service.DeleteCodes(c.Request.Context(), []int64{id})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("DELETE_ERROR", err.Error(), ""))
 		return
@@ -142,3 +154,151 @@ func DeleteRedemptionCode(c *gin.Context) {
 		"message": "Redemption code deleted successfully",
 	})
 }
+
+// GET /api/redemptions/export?format=csv|txt&name=&status=&start_date=&end_date=&anonymize=true
+//
+// anonymize=true（仅 csv）将兑换码与兑换用户替换为稳定的假名，便于交给外部会计。
+func ExportRedemptionCodes(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "txt" {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "format 仅支持 csv 或 txt", ""))
+		return
+	}
+	if format == "txt" && c.Query("anonymize") == "true" {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "txt 格式仅包含兑换码，不支持脱敏导出", ""))
+		return
+	}
+	params := service.ListRedemptionParams{
+		Name:      c.Query("name"),
+		Status:    c.Query("status"),
+		StartDate: c.Query("start_date"),
+		EndDate:   c.Query("end_date"),
+	}
+
+	total, err := service.CountRedemptionCodes(c.Request.Context(), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	if total > service.RedemptionExportLimit {
+		c.JSON(http.StatusBadRequest, models.ErrorResp(
+			"EXPORT_TOO_LARGE",
+			fmt.Sprintf("数据量 %d 行超过 %d 行上限，请收窄名称或日期范围", total, service.RedemptionExportLimit),
+			"",
+		))
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == "txt" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	anon, ok := exportAnonymizer(c)
+	if !ok {
+		return
+	}
+	filename := exportFilename("redemptions_"+time.Now().Format("20060102_150405"), "."+format, anon)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	// 审计日志：兑换码等同现金，记录谁导出了哪些码。
+	subject, _ := c.Get("user_sub")
+	method, _ := c.Get("auth_method")
+	log.Printf(
+		"audit redemptions_export user=%v auth=%v rows=%d format=%s anonymized=%v filters={name:%q status:%q start:%q end:%q} ip=%s",
+		subject, method, total, format, anon != nil, params.Name, params.Status, params.StartDate, params.EndDate, c.ClientIP(),
+	)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	if err := service.ExportRedemptionCodes(ctx, c.Writer, format, params, anon); err != nil {
+		// 响应头已发出，无法切回 JSON，仅记录 server log。
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("redemptions export failed: %v", err)
+		}
+	}
+}
+
+// POST /api/redemptions/import
+//
+// 请求体:
+//
+//	{"name": "partner-2024", "format": "csv", "content": "key,amount\nabc...,10", "default_amount": 5, "dry_run": true}
+func ImportRedemptionCodes(c *gin.Context) {
+	var req service.RedemptionImportParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+
+	result, err := service.ImportRedemptionCodes(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("IMPORT_ERROR", err.Error(), ""))
+		return
+	}
+
+	message := fmt.Sprintf("成功导入 %d 个兑换码", result.Imported)
+	if result.DryRun {
+		message = fmt.Sprintf("校验完成：%d 个可导入", result.Valid)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": message, "data": result})
+}
+
+// redemptionAnalyticsDays parses ?days= (default 30, max 365)
+func redemptionAnalyticsDays(c *gin.Context) int {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	return clampInt(days, 1, 365)
+}
+
+// GET /api/redemptions/analytics?days=30&limit=10
+func GetRedemptionAnalytics(c *gin.Context) {
+	data, err := service.GetRedemptionAnalytics(c.Request.Context(), redemptionAnalyticsDays(c), parseLimit(c, 10, 100), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/redemptions/analytics/trend?days=30
+func GetRedemptionTrend(c *gin.Context) {
+	data, err := service.GetRedemptionTrend(c.Request.Context(), redemptionAnalyticsDays(c), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/redemptions/analytics/time-to-redeem?days=30
+func GetRedemptionLatency(c *gin.Context) {
+	data, err := service.GetRedemptionLatency(c.Request.Context(), redemptionAnalyticsDays(c), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/redemptions/analytics/top-redeemers?days=30&limit=10
+func GetTopRedeemers(c *gin.Context) {
+	data, err := service.GetTopRedeemers(c.Request.Context(), redemptionAnalyticsDays(c), parseLimit(c, 10, 100), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/redemptions/analytics/value-distribution?days=30
+func GetRedemptionValueDistribution(c *gin.Context) {
+	data, err := service.GetRedemptionValueDistribution(c.Request.Context(), redemptionAnalyticsDays(c), c.Query("no_cache") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondRegistrationSpikeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRegistrationSpike):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrRegistrationSpikeNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", err.Error(), ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+	}
+}
+
+// GET /api/risk/registration-spikes?status=open&limit=50&offset=0
+//
+// 注册突增告警列表（不含快照），按时间倒序。
+func ListRegistrationSpikes(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	items, total, err := service.NewRegistrationSpikeService().List(c.Request.Context(), c.Query("status"), parseLimit(c, 50, 200), offset)
+	if err != nil {
+		respondRegistrationSpikeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": total}})
+}
+
+// GET /api/risk/registration-spikes/rate?hours=168
+//
+// 每小时新增用户（按 users.id 增长估算）与当前基线、告警阈值。
+func GetRegistrationRate(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "168"))
+	if hours < 1 || hours > 24*60 {
+		hours = 168
+	}
+	data, err := service.NewRegistrationSpikeService().Rate(c.Request.Context(), hours)
+	if err != nil {
+		respondRegistrationSpikeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/risk/registration-spikes/:id
+//
+// 单条告警及其快照：该批新用户、分组分布、集中邀请人、被多个新用户共用的 IP。
+func GetRegistrationSpike(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid spike ID", ""))
+		return
+	}
+	spike, err := service.NewRegistrationSpikeService().Get(c.Request.Context(), id)
+	if err != nil {
+		respondRegistrationSpikeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": spike})
+}
+
+// POST /api/risk/registration-spikes/:id/review
+//
+// {"status": "reviewed" | "dismissed" | "open", "note": "..."}
+func ReviewRegistrationSpike(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid spike ID", ""))
+		return
+	}
+	var req struct {
+		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	spike, err := service.NewRegistrationSpikeService().Review(c.Request.Context(), id, req.Status, req.Note, operatorIdentity(c))
+	if err != nil {
+		respondRegistrationSpikeError(c, err)
+		return
+	}
+	setAuditDetail(c, "审核注册突增 #%d status=%s", id, spike.Status)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": spike})
+}
+
+// GET /api/risk/registration-spikes/config
+func GetRegistrationSpikeConfig(c *gin.Context) {
+	settings, err := service.NewRegistrationSpikeService().GetSettings(c.Request.Context())
+	if err != nil {
+		respondRegistrationSpikeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/risk/registration-spikes/config
+//
+// 部分更新，例如 {"enabled": true, "multiplier": 3, "baseline_hours": 168, "min_new_users": 10}。
+// 每小时采样一次；速率 ≥ multiplier × 基线且新增 ≥ min_new_users 时记录告警并推送 registration_spike 事件。
+func UpdateRegistrationSpikeConfig(c *gin.Context) {
+	var req service.RegistrationSpikeSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewRegistrationSpikeService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		respondRegistrationSpikeError(c, err)
+		return
+	}
+	setAuditDetail(c, "更新注册突增监控 enabled=%v multiplier=%.1f", settings.Enabled, settings.Multiplier)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "注册突增监控配置已保存", "data": settings})
+}
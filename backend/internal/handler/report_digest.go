@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondReportDigestError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidReportDigest) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+}
+
+// GET /api/reports/config
+//
+// 摘要邮件（日报/周报）配置，SMTP 密码不返回，has_password 表示是否已设置。
+func GetReportDigestConfig(c *gin.Context) {
+	settings, err := service.NewReportDigestService().GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/reports/config
+//
+// 部分更新，例如 {"enabled": true, "frequency": "weekly", "weekday": 1, "hour": 9,
+// "recipients": ["ops@example.com"], "smtp_host": "smtp.example.com", "smtp_port": 465,
+// "smtp_security": "ssl", "smtp_username": "bot", "smtp_password": "...", "from": "NewAPI <bot@example.com>"}。
+// smtp_password 不传则保持不变，传空字符串则清除。
+func UpdateReportDigestConfig(c *gin.Context) {
+	var req service.ReportDigestSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewReportDigestService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		respondReportDigestError(c, err)
+		return
+	}
+	setAuditDetail(c, "更新摘要邮件配置 enabled=%v frequency=%s 收件人 %d 个", settings.Enabled, settings.Frequency, len(settings.Recipients))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "摘要邮件配置已保存", "data": settings})
+}
+
+// GET /api/reports/config/preview
+//
+// 按当前配置即时生成摘要邮件的 HTML，不发送。
+func PreviewReportDigest(c *gin.Context) {
+	html, err := service.NewReportDigestService().Preview(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// POST /api/reports/config/send
+//
+// 立即向收件人发送一封摘要邮件（用于验证 SMTP 配置），不改变排期。
+func SendReportDigest(c *gin.Context) {
+	digest, err := service.NewReportDigestService().Send(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidReportDigest) {
+			respondReportDigestError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadGateway, models.ErrorResp("SEND_FAILED", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "手动发送摘要邮件")
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "摘要邮件已发送", "data": digest})
+}
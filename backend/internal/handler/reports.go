@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterReportRoutes registers /api/reports endpoints
+func RegisterReportRoutes(r *gin.RouterGroup) {
+	g := r.Group("/reports")
+	{
+		g.GET("", ListReports)
+		g.GET("/options", GetReportOptions)
+		g.POST("", CreateReport)
+		g.POST("/preview", PreviewReport)
+		g.GET("/config", GetReportDigestConfig)
+		g.PUT("/config", UpdateReportDigestConfig)
+		g.GET("/config/preview", PreviewReportDigest)
+		g.POST("/config/send", SendReportDigest)
+		g.GET("/:id", GetReport)
+		g.PUT("/:id", UpdateReport)
+		g.DELETE("/:id", DeleteReport)
+		g.POST("/:id/run", RunReport)
+		g.GET("/:id/download", DownloadReport)
+		g.GET("/:id/runs", ListReportRuns)
+		g.GET("/:id/runs/:run_id", GetReportRun)
+	}
+}
+
+func respondReportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReport):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrReportNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "报表不存在", ""))
+	case errors.Is(err, service.ErrReportRunNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "报表记录不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseReportID(c *gin.Context, param string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的报表 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// reportContentType maps a report format to the download content type
+func reportContentType(format string) (string, string) {
+	switch format {
+	case service.ReportFormatJSON:
+		return "application/json; charset=utf-8", "json"
+	case service.ReportFormatCSV:
+		return "text/csv; charset=utf-8", "csv"
+	case service.ReportFormatPDF:
+		return "application/pdf", "pdf"
+	default:
+		return "text/markdown; charset=utf-8", "md"
+	}
+}
+
+// GET /api/reports
+func ListReports(c *gin.Context) {
+	reports, err := service.NewReportService().List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": reports, "total": len(reports)}})
+}
+
+// GET /api/reports/options
+//
+// 可选的指标、周期、格式与排期频率，供前端构建报表表单。
+func GetReportOptions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"metrics":     service.ReportMetrics,
+		"periods":     service.ReportPeriods,
+		"formats":     service.ReportFormats,
+		"frequencies": service.ReportFrequencies,
+	}})
+}
+
+// POST /api/reports
+//
+// 请求体 {"name": "每周运营", "metrics": ["overview", "top_users"], "period": "7d", "format": "markdown",
+// "limit": 10, "schedule": {"frequency": "weekly", "weekday": 1, "hour": 9}}
+func CreateReport(c *gin.Context) {
+	var req service.ReportDefinitionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	report, err := service.NewReportService().Create(c.Request.Context(), operatorIdentity(c), req)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	setAuditDetail(c, "创建报表 #%d %s", report.ID, report.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "报表已保存", "data": report})
+}
+
+// POST /api/reports/preview
+//
+// 按请求体（同创建）即时生成报表内容，不保存。format=pdf 时直接返回 PDF 文件。
+func PreviewReport(c *gin.Context) {
+	var req service.ReportDefinitionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	if req.Name == nil {
+		name := "preview"
+		req.Name = &name
+	}
+	content, err := service.NewReportService().Preview(c.Request.Context(), req)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	if req.Format != nil && *req.Format == service.ReportFormatPDF {
+		c.Header("Content-Disposition", `inline; filename="report-preview.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", []byte(content))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"content": content}})
+}
+
+// GET /api/reports/:id
+func GetReport(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	report, err := service.NewReportService().Get(c.Request.Context(), id)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// PUT /api/reports/:id
+func UpdateReport(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	var req service.ReportDefinitionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	report, err := service.NewReportService().Update(c.Request.Context(), id, req)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	setAuditDetail(c, "更新报表 #%d %s", report.ID, report.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "报表已更新", "data": report})
+}
+
+// DELETE /api/reports/:id
+func DeleteReport(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	if err := service.NewReportService().Delete(c.Request.Context(), id); err != nil {
+		respondReportError(c, err)
+		return
+	}
+	setAuditDetail(c, "删除报表 #%d", id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "报表已删除"})
+}
+
+// POST /api/reports/:id/run
+//
+// 立即生成一次并推送 report_ready 事件，不改变排期。
+func RunReport(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	run, err := service.NewReportService().Run(c.Request.Context(), id, "manual")
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	setAuditDetail(c, "生成报表 #%d", id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
+
+// GET /api/reports/:id/runs
+func ListReportRuns(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	runs, err := service.NewReportService().ListRuns(c.Request.Context(), id)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": runs, "total": len(runs)}})
+}
+
+// GET /api/reports/:id/runs/:run_id?download=1
+//
+// 返回一次生成结果；download=1 时以附件形式输出原始内容。
+func GetReportRun(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	runID, ok := parseReportID(c, "run_id")
+	if !ok {
+		return
+	}
+	run, err := service.NewReportService().GetRun(c.Request.Context(), id, runID)
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	if c.Query("download") == "1" || c.Query("download") == "true" {
+		writeReportRunFile(c, run)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
+
+// GET /api/reports/:id/download?run_id=
+//
+// 下载报表文件（PDF 等），默认最近一次成功生成的结果；run_id 指定某次记录。
+// 生成结果保留 REPORT_RETENTION_DAYS 天。
+func DownloadReport(c *gin.Context) {
+	id, ok := parseReportID(c, "id")
+	if !ok {
+		return
+	}
+	svc := service.NewReportService()
+	var run service.ReportRun
+	var err error
+	if c.Query("run_id") != "" {
+		runID, convErr := strconv.ParseInt(c.Query("run_id"), 10, 64)
+		if convErr != nil || runID <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的 run_id", ""))
+			return
+		}
+		run, err = svc.GetRun(c.Request.Context(), id, runID)
+	} else {
+		run, err = svc.LatestRun(c.Request.Context(), id)
+	}
+	if err != nil {
+		respondReportError(c, err)
+		return
+	}
+	writeReportRunFile(c, run)
+}
+
+// writeReportRunFile sends a run's output as an attachment
+func writeReportRunFile(c *gin.Context, run service.ReportRun) {
+	contentType, ext := reportContentType(run.Format)
+	filename := fmt.Sprintf("report-%d-%s.%s", run.ReportID, time.Unix(run.CreatedAt, 0).Format("20060102-1504"), ext)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, run.Body())
+}
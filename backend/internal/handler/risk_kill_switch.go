@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// POST /api/risk/kill-switch
+//
+// 事件处置一键封禁：{"user_id": 1, "reason": "..."} 封禁用户并禁用其全部令牌（disable_tokens=false 时保留令牌），
+// {"token_id": 2, "reason": "..."} 仅禁用该令牌。数据库变更在同一事务内完成，随后清理风控 / IP / 仪表盘缓存、
+// 推送 kill_switch 事件并写入处置记录；后续步骤的结果见 steps。管理员账号及其令牌会被拒绝。
+func ActivateKillSwitch(c *gin.Context) {
+	var req service.KillSwitchInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	rec, err := service.NewKillSwitchService().WithContext(c.Request.Context()).Activate(c.Request.Context(), req, operatorIdentity(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidKillSwitch):
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		case errors.Is(err, service.ErrKillSwitchNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", err.Error(), ""))
+		case errors.Is(err, service.ErrKillSwitchProtected):
+			c.JSON(http.StatusForbidden, models.ErrorResp("FORBIDDEN", err.Error(), ""))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("KILL_SWITCH_ERROR", err.Error(), ""))
+		}
+		return
+	}
+	if rec.Target == "user" {
+		setAuditDetail(c, "紧急封禁用户 %d，禁用令牌 %d 个: %s", rec.UserID, rec.TokensDisabled, rec.Reason)
+	} else {
+		setAuditDetail(c, "紧急禁用令牌 %d（用户 %d）: %s", rec.TokenID, rec.UserID, rec.Reason)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已处置", "data": rec})
+}
+
+// GET /api/risk/kill-switch?user_id=&limit=50&offset=0
+func ListKillSwitchRecords(c *gin.Context) {
+	userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	items, total, err := service.NewKillSwitchService().ListRecords(c.Request.Context(), userID, parseLimit(c, 50, 500), offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": total}})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/new-api-tools/backend/internal/models"
 	"github.com/new-api-tools/backend/internal/service"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // RegisterRiskMonitoringRoutes registers /api/risk endpoints
@@ -15,14 +17,79 @@ func RegisterRiskMonitoringRoutes(r *gin.RouterGroup) {
 	g := r.Group("/risk")
 	{
 		g.GET("/leaderboards", GetLeaderboards)
+		g.GET("/config", GetRiskWeights)
+		g.PUT("/config", UpdateRiskWeights)
 		g.GET("/users/:user_id/analysis", GetUserRiskAnalysis)
 		g.GET("/ban-records", ListBanRecords)
 		g.GET("/token-rotation", GetTokenRotationUsers)
 		g.GET("/affiliated-accounts", GetAffiliatedAccounts)
+		g.GET("/users/:user_id/invitations", GetInvitationGraph)
 		g.GET("/same-ip-registrations", GetSameIPRegistrations)
+		g.GET("/clusters", GetDeviceClusters)
+		g.GET("/registration-spikes", ListRegistrationSpikes)
+		g.GET("/registration-spikes/rate", GetRegistrationRate)
+		g.GET("/registration-spikes/config", GetRegistrationSpikeConfig)
+		g.PUT("/registration-spikes/config", UpdateRegistrationSpikeConfig)
+		g.GET("/registration-spikes/:id", GetRegistrationSpike)
+		g.POST("/registration-spikes/:id/review", ReviewRegistrationSpike)
+		g.GET("/policies", GetRiskPolicies)
+		g.PUT("/policies", UpdateRiskPolicies)
+		g.POST("/policies/enforce", EnforceRiskPolicies)
+		g.GET("/penalties", ListRiskPenalties)
+		g.POST("/penalties/:id/revoke", RevokeRiskPenalty)
+		g.GET("/users/:user_id/penalties", GetUserRiskPenalties)
+		g.POST("/kill-switch", ActivateKillSwitch)
+		g.GET("/kill-switch", ListKillSwitchRecords)
+		g.GET("/rate-metrics", GetRateMetrics)
 	}
 }
 
+// GET /api/risk/rate-metrics
+//
+// 进程内计数器（未配置 Redis 时自动启用）估算的各用户实时 RPM，按最近 5 分钟请求数排序。
+func GetRateMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.GetRateMetrics(c.Request.Context(), parseLimit(c, 50, 500))})
+}
+
+// GET /api/risk/config
+//
+// 风险标签阈值与加权分（rules：标签 → threshold / points），以及默认值。
+// 用户分析与 AI 封禁候选扫描均按此计算 risk_flags 与 rule_score（0-100）。
+func GetRiskWeights(c *gin.Context) {
+	weights, err := service.GetRiskWeights(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"weights":  weights,
+		"defaults": service.DefaultRiskWeights(),
+	}})
+}
+
+// PUT /api/risk/config
+//
+// 部分更新，rules 按标签合并，例如
+// {"rules": {"MANY_IPS": {"threshold": 20, "points": 30}}, "suspicious_min_requests": 20, "high_score": 70}。
+func UpdateRiskWeights(c *gin.Context) {
+	var req service.RiskWeightsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	weights, err := service.UpdateRiskWeights(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRiskWeights) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "风险权重: %d 条规则更新, medium=%d high=%d", len(req.Rules), weights.MediumScore, weights.HighScore)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "风险权重已保存", "data": weights})
+}
+
 // GET /api/risk/leaderboards
 func GetLeaderboards(c *gin.Context) {
 	windowsStr := c.DefaultQuery("windows", "1h,3h,6h,12h,24h")
@@ -35,7 +102,7 @@ func GetLeaderboards(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewRiskMonitoringService()
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetLeaderboards(windows, limit, sortBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -45,6 +112,9 @@ func GetLeaderboards(c *gin.Context) {
 }
 
 // GET /api/risk/users/:user_id/analysis
+//
+// include_archived=1 时合并窗口内已清理、但已归档的日志（见 archive / archived_summary）。
+// communications 为该用户的人工联系记录摘要（见 /api/users/:user_id/communications）。
 func GetUserRiskAnalysis(c *gin.Context) {
 	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
 	if err != nil {
@@ -66,12 +136,23 @@ func GetUserRiskAnalysis(c *gin.Context) {
 		}
 	}
 
-	svc := service.NewRiskMonitoringService()
-	data, err := svc.GetUserAnalysis(userID, seconds, endTime)
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
+	var data *api.UserAnalysis
+	if includeArchived(c) && instanceParam(c) == "" {
+		data, err = svc.GetUserAnalysisWithArchive(c.Request.Context(), userID, seconds, endTime)
+	} else {
+		data, err = svc.GetUserAnalysis(userID, seconds, endTime)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
 	}
+	if instanceParam(c) == "" {
+		// 联系记录仅属于主实例；失败不影响分析结果
+		if comms, err := service.NewUserCommsService().Summary(c.Request.Context(), userID); err == nil {
+			data.Communications = &comms
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
@@ -89,7 +170,7 @@ func ListBanRecords(c *gin.Context) {
 		}
 	}
 
-	svc := service.NewRiskMonitoringService()
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data := svc.ListBanRecords(page, pageSize, action, userID)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
@@ -105,7 +186,7 @@ func GetTokenRotationUsers(c *gin.Context) {
 	maxReqPerToken, _ := strconv.Atoi(c.DefaultQuery("max_requests_per_token", "10"))
 	limit := parseLimit(c, 50, 500)
 
-	svc := service.NewRiskMonitoringService()
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetTokenRotationUsers(window, minTokens, maxReqPerToken, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -119,7 +200,7 @@ func GetAffiliatedAccounts(c *gin.Context) {
 	minInvited, _ := strconv.Atoi(c.DefaultQuery("min_invited", "3"))
 	limit := parseLimit(c, 50, 500)
 
-	svc := service.NewRiskMonitoringService()
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetAffiliatedAccounts(minInvited, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -128,6 +209,59 @@ func GetAffiliatedAccounts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
+// GET /api/risk/users/:user_id/invitations?depth=3
+//
+// 以该用户为根的邀请树（最多 10 层、5000 个节点）与其上级邀请链，返回 nodes / edges 供前端绘图。
+// 每个节点带子树人数与子树累计消耗额度；cycle=true 的边闭合了一个邀请环（见 cycles）。
+// truncated 节点还有未展开的下级，可以它为根继续查询。
+func GetInvitationGraph(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user ID", ""))
+		return
+	}
+	depth, _ := strconv.Atoi(c.DefaultQuery("depth", "3"))
+
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
+	data, err := svc.GetInvitationGraph(userID, depth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	if data == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "用户不存在", ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/risk/clusters?window=24h&min_users=2&min_similarity=0.8&limit=50
+//
+// 疑似同一操作者的多账号簇：相同 user-agent（日志中有记录时）+ 相同网络（ASN，无 ASN 库时为 /24 网段），
+// 且按小时分布的活跃时间模式余弦相似度 ≥ min_similarity。fingerprint_source=none 时仅凭网络与时间模式，置信度打折。
+func GetDeviceClusters(c *gin.Context) {
+	window := c.DefaultQuery("window", "24h")
+	if !validWindow(window) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid window value", ""))
+		return
+	}
+	minUsers, _ := strconv.Atoi(c.DefaultQuery("min_users", "2"))
+	minSimilarity, _ := strconv.ParseFloat(c.DefaultQuery("min_similarity", "0.8"), 64)
+
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
+	data, err := svc.GetDeviceClusters(service.ClusterQuery{
+		Window:        window,
+		MinUsers:      minUsers,
+		MinSimilarity: minSimilarity,
+		Limit:         parseLimit(c, 50, 500),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
 // GET /api/risk/same-ip-registrations
 func GetSameIPRegistrations(c *gin.Context) {
 	window := c.DefaultQuery("window", "7d")
@@ -138,7 +272,7 @@ func GetSameIPRegistrations(c *gin.Context) {
 	minUsers, _ := strconv.Atoi(c.DefaultQuery("min_users", "3"))
 	limit := parseLimit(c, 50, 500)
 
-	svc := service.NewRiskMonitoringService()
+	svc := service.NewRiskMonitoringServiceFor(instanceParam(c)).WithContext(c.Request.Context())
 	data, err := svc.GetSameIPRegistrations(window, minUsers, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
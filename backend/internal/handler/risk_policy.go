@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func respondRiskPolicyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRiskPolicy):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrRiskPenaltyNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", err.Error(), ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+	}
+}
+
+// GET /api/risk/policies
+func GetRiskPolicies(c *gin.Context) {
+	settings, err := service.NewRiskPolicyService().GetSettings(c.Request.Context())
+	if err != nil {
+		respondRiskPolicyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/risk/policies
+//
+// 部分更新；steps 整体替换，需按 warn → rate_limit → temp_ban → permanent_ban 递进，例如
+//
+//	{"enabled": true, "dry_run": false, "window_days": 30, "steps": [
+//	  {"action": "warn", "min_offenses": 1},
+//	  {"action": "temp_ban", "min_offenses": 3, "duration_hours": 24},
+//	  {"action": "permanent_ban", "min_offenses": 5}]}
+//
+// 违规次数 = 窗口内该用户的 high_risk_user 风险标记数。
+func UpdateRiskPolicies(c *gin.Context) {
+	var req service.RiskPolicySettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewRiskPolicyService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		respondRiskPolicyError(c, err)
+		return
+	}
+	setAuditDetail(c, "处罚策略: enabled=%v dry_run=%v window_days=%d steps=%d",
+		settings.Enabled, settings.DryRun, settings.WindowDays, len(settings.Steps))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "处罚策略已保存", "data": settings})
+}
+
+// POST /api/risk/policies/enforce
+//
+// 立即执行一轮。请求体可选 {"dry_run": true}，缺省时沿用配置中的 dry_run。
+func EnforceRiskPolicies(c *gin.Context) {
+	var req struct {
+		DryRun *bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+			return
+		}
+	}
+	result, err := service.NewRiskPolicyService().WithContext(c.Request.Context()).Enforce(c.Request.Context(), req.DryRun)
+	if err != nil {
+		respondRiskPolicyError(c, err)
+		return
+	}
+	if !result.DryRun {
+		setAuditDetail(c, "处罚策略执行: 升级 %d，处置 %d，到期解除 %d", len(result.Decisions), result.Applied, result.Lifted)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// GET /api/risk/penalties?user_id=&action=&active=1&limit=50&offset=0
+func ListRiskPenalties(c *gin.Context) {
+	userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	active := c.Query("active") == "1" || c.Query("active") == "true"
+	items, total, err := service.NewRiskPolicyService().ListPenalties(c.Request.Context(), userID, c.Query("action"), active, parseLimit(c, 50, 500), offset)
+	if err != nil {
+		respondRiskPolicyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": total}})
+}
+
+// POST /api/risk/penalties/:id/revoke
+//
+// 撤销一条处罚（如误判）：解除该用户所有生效中的处罚与封禁，违规计数从此刻重新开始。
+func RevokeRiskPenalty(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid penalty ID", ""))
+		return
+	}
+	penalty, err := service.NewRiskPolicyService().WithContext(c.Request.Context()).Revoke(c.Request.Context(), id, operatorIdentity(c))
+	if err != nil {
+		respondRiskPolicyError(c, err)
+		return
+	}
+	setAuditDetail(c, "撤销处罚 #%d 用户 %d (%s)", id, penalty.UserID, penalty.Action)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "处罚已撤销", "data": penalty})
+}
+
+// GET /api/risk/users/:user_id/penalties
+//
+// 该用户在处罚阶梯上的位置：窗口内违规次数、已到达的等级、下一级及处罚历史。
+func GetUserRiskPenalties(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user ID", ""))
+		return
+	}
+	data, err := service.NewRiskPolicyService().UserPenalties(c.Request.Context(), userID)
+	if err != nil {
+		respondRiskPolicyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
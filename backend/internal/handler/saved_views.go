@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterSavedViewRoutes registers /api/saved-views endpoints
+func RegisterSavedViewRoutes(r *gin.RouterGroup) {
+	g := r.Group("/saved-views")
+	{
+		g.GET("", ListSavedViews)
+		g.GET("/scopes", GetSavedViewScopes)
+		g.POST("", CreateSavedView)
+		g.PUT("/:id", UpdateSavedView)
+		g.DELETE("/:id", DeleteSavedView)
+	}
+}
+
+// operatorIdentity identifies the calling admin (owner of saved views,
+// watchlists, ...): the JWT subject, or the auth method for API key callers
+// (same rule as the audit trail)
+func operatorIdentity(c *gin.Context) string {
+	if sub := c.GetString("user_sub"); sub != "" {
+		return sub
+	}
+	if method := c.GetString("auth_method"); method != "" {
+		return method
+	}
+	return "admin"
+}
+
+func respondSavedViewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSavedView):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrSavedViewExists):
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_EXISTS", err.Error(), ""))
+	case errors.Is(err, service.ErrSavedViewNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "视图不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseSavedViewID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的视图 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api/saved-views?scope=users
+//
+// 当前管理员保存的筛选视图，scope 省略时返回全部。
+func ListSavedViews(c *gin.Context) {
+	views, err := service.NewSavedViewService().List(c.Request.Context(), operatorIdentity(c), c.Query("scope"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": views, "total": len(views)}})
+}
+
+// GET /api/saved-views/scopes
+func GetSavedViewScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.SavedViewScopes})
+}
+
+// POST /api/saved-views
+//
+// 请求体 {"scope": "risk_leaderboards", "name": "每日巡检", "params": {"windows": "1h,24h", "limit": 50}, "is_default": true}
+func CreateSavedView(c *gin.Context) {
+	var req service.SavedViewInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	view, err := service.NewSavedViewService().Create(c.Request.Context(), operatorIdentity(c), req)
+	if err != nil {
+		respondSavedViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "视图已保存", "data": view})
+}
+
+// PUT /api/saved-views/:id
+func UpdateSavedView(c *gin.Context) {
+	id, ok := parseSavedViewID(c)
+	if !ok {
+		return
+	}
+	var req service.SavedViewInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	view, err := service.NewSavedViewService().Update(c.Request.Context(), operatorIdentity(c), id, req)
+	if err != nil {
+		respondSavedViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "视图已更新", "data": view})
+}
+
+// DELETE /api/saved-views/:id
+func DeleteSavedView(c *gin.Context) {
+	id, ok := parseSavedViewID(c)
+	if !ok {
+		return
+	}
+	if err := service.NewSavedViewService().Delete(c.Request.Context(), operatorIdentity(c), id); err != nil {
+		respondSavedViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "视图已删除"})
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterSearchRoutes registers /api/search
+func RegisterSearchRoutes(r *gin.RouterGroup) {
+	r.GET("/search", GlobalSearch)
+}
+
+// GET /api/search?q=&limit=
+//
+// 同时检索用户、令牌、IP、兑换码与充值单号，按类型分组返回（每组最多 limit 条）。
+func GlobalSearch(c *gin.Context) {
+	result, err := service.GlobalSearch(c.Request.Context(), c.Query("q"), parseLimit(c, 10, 50))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearch) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
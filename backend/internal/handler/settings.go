@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterSettingsRoutes registers /api/settings endpoints
+func RegisterSettingsRoutes(r *gin.RouterGroup) {
+	g := r.Group("/settings")
+	{
+		g.GET("", ListSettings)
+		g.GET("/history", GetSettingsHistory)
+		g.POST("/reload", ReloadSettings)
+		g.GET("/:section", GetSettingsSection)
+		g.PUT("/:section", UpdateSettingsSection)
+	}
+}
+
+// respondConfigConflict answers a save based on a stale config version with
+// 409 and the version now stored; reports whether err was such a conflict
+func respondConfigConflict(c *gin.Context, err error) bool {
+	var conflict *service.ConfigConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	resp := models.ErrorResp("VERSION_CONFLICT", "配置已被其他管理员修改，请刷新后重试", "")
+	resp["data"] = gin.H{"current_version": conflict.Current}
+	c.JSON(http.StatusConflict, resp)
+	return true
+}
+
+func respondSettingsError(c *gin.Context, err error) {
+	if respondConfigConflict(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrSettingsSectionNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", err.Error(), ""))
+	case errors.Is(err, service.ErrSettingsReadOnly):
+		c.JSON(http.StatusForbidden, models.ErrorResp("READ_ONLY", "该配置来自环境变量，修改后需重启", ""))
+	case errors.Is(err, service.ErrInvalidSetting):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("SETTINGS_ERROR", err.Error(), ""))
+	}
+}
+
+// GET /api/settings
+//
+// 全部配置分组：字段类型、取值范围、来源（env / redis / local）与当前值，密钥以 *** 显示。
+func ListSettings(c *gin.Context) {
+	sections, err := service.NewSettingsService().List(c.Request.Context())
+	if err != nil {
+		respondSettingsError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": sections})
+}
+
+// GET /api/settings/:section
+func GetSettingsSection(c *gin.Context) {
+	section, err := service.NewSettingsService().Get(c.Request.Context(), c.Param("section"))
+	if err != nil {
+		respondSettingsError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": section})
+}
+
+// PUT /api/settings/:section
+//
+// 请求体为要修改的键值（部分更新）；按 schema 校验后保存、记录变更历史并立即生效。
+// 密钥字段回传 *** 表示不修改。
+func UpdateSettingsSection(c *gin.Context) {
+	var req map[string]interface{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	name := c.Param("section")
+	section, changes, err := service.NewSettingsService().Update(c.Request.Context(), name, operatorIdentity(c), req)
+	if err != nil {
+		respondSettingsError(c, err)
+		return
+	}
+	keys := make([]string, len(changes))
+	for i, ch := range changes {
+		keys[i] = ch.Key
+	}
+	setAuditDetail(c, "配置 %s: %s", name, strings.Join(keys, ", "))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "配置已保存并生效", "data": gin.H{
+		"section": section,
+		"changes": changes,
+	}})
+}
+
+// GET /api/settings/history?section=ai_ban&page=1&page_size=50
+func GetSettingsHistory(c *gin.Context) {
+	page := parsePage(c)
+	pageSize := parsePageSize(c, 50, 200)
+	data, err := service.NewSettingsService().History(c.Request.Context(), c.Query("section"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		respondSettingsError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// POST /api/settings/reload
+//
+// 重新读取本地存储的运行时配置并应用（例如直接修改了 tools.db 之后），无需重启。
+func ReloadSettings(c *gin.Context) {
+	errs := service.NewSettingsService().Reload(c.Request.Context())
+	setAuditDetail(c, "重新加载配置")
+	if len(errs) > 0 {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("RELOAD_FAILED", strings.Join(errs, "; "), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "配置已重新加载"})
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// GET /api/system/smoke-tests?limit=20
+//
+// 最近的端到端冒烟测试记录（新的在前）、当前连续失败次数与是否已配置。
+func GetSmokeTests(c *gin.Context) {
+	svc := service.NewSmokeTestService().WithContext(c.Request.Context())
+	data, err := svc.ListRuns(c.Request.Context(), parseLimit(c, 20, 200))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// POST /api/system/smoke-tests/run
+//
+// 立即执行一次冒烟测试；会真实消耗测试令牌的少量额度。
+func RunSmokeTests(c *gin.Context) {
+	svc := service.NewSmokeTestService().WithContext(c.Request.Context())
+	run, err := svc.Run(c.Request.Context(), "manual")
+	if err != nil {
+		if errors.Is(err, service.ErrSmokeTestNotConfigured) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("NOT_CONFIGURED", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("SMOKE_TEST_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "手动执行冒烟测试: success=%v failed_step=%s", run.Success, run.FailedStep)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": run})
+}
+
+// GET /api/system/smoke-tests/config
+func GetSmokeTestConfig(c *gin.Context) {
+	svc := service.NewSmokeTestService()
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/system/smoke-tests/config
+//
+// 部分更新，例如
+//
+//	{"enabled": true, "interval_minutes": 30, "token": "sk-...", "model": "gpt-4o-mini",
+//	 "steps": ["auth", "completion", "log", "quota"], "failure_threshold": 2, "webhook_url": "https://..."}
+//
+// token / webhook_secret 不会返回，传空字符串清除；连续失败达到 failure_threshold 与恢复时各推送一次 smoke_test 事件。
+func UpdateSmokeTestConfig(c *gin.Context) {
+	var req service.SmokeTestSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewSmokeTestService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSmokeTest) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "冒烟测试: enabled=%v model=%s steps=%v", settings.Enabled, settings.Model, settings.Steps)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "冒烟测试配置已保存", "data": settings})
+}
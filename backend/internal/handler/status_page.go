@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterStatusPageRoutes registers the unauthenticated status page endpoints
+func RegisterStatusPageRoutes(r *gin.RouterGroup) {
+	r.GET("/api/public/status", GetPublicStatusPage)
+	r.GET("/api/public/status/page", GetPublicStatusPageHTML)
+}
+
+// RegisterStatusPageAdminRoutes registers /api/status-page config and incident endpoints
+func RegisterStatusPageAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/status-page")
+	{
+		g.GET("/config", GetStatusPageConfig)
+		g.PUT("/config", UpdateStatusPageConfig)
+		g.GET("/preview", PreviewStatusPage)
+		g.GET("/incidents", ListStatusIncidents)
+		g.POST("/incidents", CreateStatusIncident)
+		g.PUT("/incidents/:id", UpdateStatusIncident)
+		g.DELETE("/incidents/:id", DeleteStatusIncident)
+	}
+}
+
+func respondStatusPageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidStatusPage):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrStatusIncidentNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "事件不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseIncidentID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的事件 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// loadPublishedStatusPage builds the page when publishing is enabled, writing
+// a 404 otherwise
+func loadPublishedStatusPage(c *gin.Context) (*service.StatusPage, bool) {
+	svc := service.NewStatusPageService().WithContext(c.Request.Context())
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil || !settings.Enabled {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "状态页未发布", ""))
+		return nil, false
+	}
+	page, err := svc.GetStatusPage(c.Request.Context(), settings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", "状态数据暂不可用", ""))
+		return nil, false
+	}
+	c.Header("Cache-Control", "public, max-age=60")
+	return page, true
+}
+
+// GET /api/public/status
+//
+// 公开状态页数据（无需认证，与嵌入访问令牌无关）：已发布模型的当前状态、
+// 30 / 90 天可用率、按天条形历史与事件公告；未发布时 404。
+func GetPublicStatusPage(c *gin.Context) {
+	page, ok := loadPublishedStatusPage(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": page})
+}
+
+// GET /api/public/status/page
+//
+// 同上，渲染为可直接访问的 HTML 页面，主题取自配置的嵌入主题。
+func GetPublicStatusPageHTML(c *gin.Context) {
+	page, ok := loadPublishedStatusPage(c)
+	if !ok {
+		return
+	}
+	writeStatusPageHTML(c, page)
+}
+
+func writeStatusPageHTML(c *gin.Context, page *service.StatusPage) {
+	html, err := service.RenderStatusPage(page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src http: https:")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// GET /api/status-page/config
+func GetStatusPageConfig(c *gin.Context) {
+	settings, err := service.NewStatusPageService().WithContext(c.Request.Context()).GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"config":               settings,
+		"available_severities": service.IncidentSeverities,
+		"page_path":            service.StatusPagePath(),
+	}})
+}
+
+// PUT /api/status-page/config
+//
+// 请求体 {"enabled": true, "title": "服务状态", "description": "", "logo_url": "https://...",
+// "profile": "brand", "models": ["gpt-4o"], "history_days": 90}，字段均可省略。
+func UpdateStatusPageConfig(c *gin.Context) {
+	var req service.StatusPageSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewStatusPageService().WithContext(c.Request.Context()).UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		respondStatusPageError(c, err)
+		return
+	}
+	setAuditDetail(c, "状态页: enabled=%v profile=%s models=%d", settings.Enabled, settings.Profile, len(settings.Models))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "状态页配置已更新", "data": settings})
+}
+
+// GET /api/status-page/preview?format=html
+//
+// 预览公开状态页（未发布时同样可用），format=html 返回渲染后的页面。
+func PreviewStatusPage(c *gin.Context) {
+	svc := service.NewStatusPageService().WithContext(c.Request.Context())
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	page, err := svc.GetStatusPage(c.Request.Context(), settings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	if c.Query("format") == "html" {
+		writeStatusPageHTML(c, page)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"enabled": settings.Enabled, "page": page}})
+}
+
+// GET /api/status-page/incidents?limit=50
+func ListStatusIncidents(c *gin.Context) {
+	incidents, err := service.NewStatusPageService().ListIncidents(c.Request.Context(), 0, parseLimit(c, 50, 200))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": incidents, "total": len(incidents)}})
+}
+
+// POST /api/status-page/incidents
+//
+// 请求体 {"title": "gpt-4o 上游超时", "message": "", "severity": "minor", "models": ["gpt-4o"],
+// "started_at": 0, "resolved_at": 0}；started_at 默认当前时间，resolved_at 为 0 表示仍在进行。
+func CreateStatusIncident(c *gin.Context) {
+	var req service.StatusIncidentInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	incident, err := service.NewStatusPageService().CreateIncident(c.Request.Context(), req, operatorIdentity(c))
+	if err != nil {
+		respondStatusPageError(c, err)
+		return
+	}
+	setAuditDetail(c, "状态页事件 #%d [%s] %s", incident.ID, incident.Severity, incident.Title)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "事件已发布", "data": incident})
+}
+
+// PUT /api/status-page/incidents/:id
+//
+// 部分更新，例如 {"resolved_at": 1735689600} 标记事件已恢复。
+func UpdateStatusIncident(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	var req service.StatusIncidentInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	incident, err := service.NewStatusPageService().UpdateIncident(c.Request.Context(), id, req)
+	if err != nil {
+		respondStatusPageError(c, err)
+		return
+	}
+	setAuditDetail(c, "状态页事件 #%d resolved_at=%d", incident.ID, incident.ResolvedAt)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "事件已更新", "data": incident})
+}
+
+// DELETE /api/status-page/incidents/:id
+func DeleteStatusIncident(c *gin.Context) {
+	id, ok := parseIncidentID(c)
+	if !ok {
+		return
+	}
+	if err := service.NewStatusPageService().DeleteIncident(c.Request.Context(), id); err != nil {
+		respondStatusPageError(c, err)
+		return
+	}
+	setAuditDetail(c, "删除状态页事件 #%d", id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "事件已删除"})
+}
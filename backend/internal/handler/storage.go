@@ -165,7 +165,7 @@ func ClearAllCache(c *gin.Context) {
 // DELETE /api/storage/cache/dashboard
 func ClearDashboardCache(c *gin.Context) {
 	cm := cache.Get()
-	cm.DeleteLocal("dashboard:")
+	cm.DeleteLocal(cache.Key("dashboard:"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
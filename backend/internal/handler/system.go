@@ -1,11 +1,19 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/auth"
 	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/middleware"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
 )
 
 // RegisterSystemRoutes registers /api/system endpoints
@@ -13,42 +21,105 @@ func RegisterSystemRoutes(r *gin.RouterGroup) {
 	g := r.Group("/system")
 	{
 		g.GET("/scale", GetSystemScale)
+		g.PUT("/scale", UpdateSystemScale)
 		g.POST("/scale/refresh", RefreshSystemScale)
 		g.GET("/warmup-status", GetWarmupStatus)
 		g.GET("/indexes", GetIndexStatus)
 		g.POST("/indexes/ensure", EnsureIndexes)
+		g.GET("/retention", GetRetention)
+		g.PUT("/retention", UpdateRetention)
+		g.POST("/retention/run", RunRetention)
+		g.GET("/archive", ListLogArchives)
+		g.GET("/archive/config", GetLogArchiveConfig)
+		g.PUT("/archive/config", UpdateLogArchiveConfig)
+		g.POST("/archive/test", TestLogArchiveConnection)
+		g.GET("/archive/status", GetLogArchiveStatus)
+		g.POST("/archive/run", RunLogArchive)
+		g.GET("/slow-queries", GetSlowQueries)
+		g.DELETE("/slow-queries", ClearSlowQueries)
+		g.GET("/query-plans", ListQueryPlans)
+		g.GET("/query-plans/config", GetQueryProfilerConfig)
+		g.PUT("/query-plans/config", UpdateQueryProfilerConfig)
+		g.POST("/query-plans/run", RunQueryProfiler)
+		g.GET("/query-plans/:fingerprint", GetQueryPlan)
+		g.DELETE("/query-plans", ClearQueryPlans)
+		g.GET("/slo", GetEndpointSLO)
+		g.GET("/slo/config", GetEndpointSLOConfig)
+		g.PUT("/slo/config", UpdateEndpointSLOConfig)
+		g.DELETE("/slo", ResetEndpointSLO)
+		g.GET("/smoke-tests", GetSmokeTests)
+		g.POST("/smoke-tests/run", RunSmokeTests)
+		g.GET("/smoke-tests/config", GetSmokeTestConfig)
+		g.PUT("/smoke-tests/config", UpdateSmokeTestConfig)
+		g.GET("/geoip", GetGeoIPStatus)
+		g.PUT("/geoip/config", UpdateGeoIPConfig)
+		g.POST("/geoip/update", UpdateGeoIPDatabases)
+		g.GET("/db-stats", GetDBStats)
+		g.PUT("/db-stats/config", UpdateDBStatsConfig)
+		g.POST("/db-stats/analyze", RunDBAnalyze)
+		g.GET("/log-types", GetLogTypes)
+		g.GET("/masking", GetDataMasking)
+		g.PUT("/masking", UpdateDataMasking)
+		g.GET("/backup", DownloadBackup)
+		g.POST("/restore", RestoreBackup)
 	}
 }
 
-// GET /api/system/scale — placeholder until system_scale service is migrated
+// GET /api/system/scale
+//
+// 当前生效的规模档位（检测结果 + 手动覆盖），各模块的批大小、缓存时长、
+// 并发数与 limit 上限均取自 settings。
 func GetSystemScale(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"scale": "medium",
-			"metrics": gin.H{
-				"total_users": 0,
-				"total_logs":  0,
-			},
-			"settings": gin.H{
-				"cache_ttl":                 300,
-				"refresh_interval":          300,
-				"frontend_refresh_interval": 60,
-				"description":               "中型系统",
-			},
-		},
-	})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": service.NewSystemScaleService().Get(c.Request.Context())})
+}
+
+// GET /api/system/log-types
+//
+// 当前的日志类型映射（LOG_TYPE_*）及近 24 小时 logs 表中各 type 的条数，
+// 用于确认 fork 版本的类型编号是否需要重新映射。
+func GetLogTypes(c *gin.Context) {
+	report, err := service.GetLogTypeReport(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
 }
 
 // POST /api/system/scale/refresh
 func RefreshSystemScale(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"scale":   "medium",
-			"message": "Scale detection refreshed",
-		},
-	})
+	svc := service.NewSystemScaleService()
+	if _, err := svc.Detect(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("SCALE_DETECT_FAILED", err.Error(), ""))
+		return
+	}
+	data := svc.Get(c.Request.Context())
+	data["message"] = "Scale detection refreshed"
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// PUT /api/system/scale
+//
+// 覆盖检测出的规模档位或单项参数；字段为 0 / 空表示沿用检测结果，全部为空即清除覆盖。
+func UpdateSystemScale(c *gin.Context) {
+	var req service.ScaleOverride
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "请求参数无效", err.Error()))
+		return
+	}
+	svc := service.NewSystemScaleService()
+	override, err := svc.SetOverride(c.Request.Context(), req)
+	if errors.Is(err, service.ErrInvalidScaleOverride) {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("SAVE_FAILED", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "系统规模覆盖: scale=%q cache_ttl=%d batch_size=%d scan_concurrency=%d query_limit_cap=%d",
+		override.Scale, override.CacheTTL, override.BatchSize, override.ScanConcurrency, override.QueryLimitCap)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": svc.Get(c.Request.Context())})
 }
 
 // GET /api/system/warmup-status
@@ -137,3 +208,447 @@ func EnsureIndexes(c *gin.Context) {
 		},
 	})
 }
+
+// GET /api/system/slow-queries?limit=50
+//
+// 最近的慢查询（执行时间、排队时间与参数，最新在前），以及重查询限流器状态。
+func GetSlowQueries(c *gin.Context) {
+	limit := parseLimit(c, 50, 200)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"items":   database.SlowQueries(limit),
+		"limiter": database.QueryLimits(),
+	}})
+}
+
+// DELETE /api/system/slow-queries
+func ClearSlowQueries(c *gin.Context) {
+	database.ClearSlowQueries()
+	setAuditDetail(c, "清空慢查询日志")
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "慢查询日志已清空"})
+}
+
+// GET /api/system/query-plans?limit=50
+//
+// 最近采样的慢查询执行计划（按采样时间倒序，不含计划正文）：出现次数、平均 / 最大耗时、
+// 计划成本，seq_scans 列出全表扫描的表与过滤条件，即下一次 EnsureIndexes 可考虑补的索引。
+func ListQueryPlans(c *gin.Context) {
+	plans, err := service.ListQueryPlans(c.Request.Context(), parseLimit(c, 50, 100), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": plans}})
+}
+
+// GET /api/system/query-plans/:fingerprint
+//
+// 单条查询的完整执行计划（PostgreSQL / MySQL 为 JSON，SQLite 为 EXPLAIN QUERY PLAN 文本）。
+func GetQueryPlan(c *gin.Context) {
+	plan, err := service.GetQueryPlan(c.Request.Context(), c.Param("fingerprint"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	if plan == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "执行计划不存在", ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": plan})
+}
+
+// GET /api/system/query-plans/config
+func GetQueryProfilerConfig(c *gin.Context) {
+	settings, err := service.GetQueryProfilerSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/system/query-plans/config
+//
+// 部分更新，例如 {"enabled": true, "top_n": 5, "min_occurrences": 3, "interval_minutes": 60,
+// "analyze_on_replica": true}。enabled 后后台按间隔采样，默认关闭。
+func UpdateQueryProfilerConfig(c *gin.Context) {
+	var req service.QueryProfilerSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.UpdateQueryProfilerSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQueryProfiler) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "查询计划采样: enabled=%v top_n=%d interval_minutes=%d", settings.Enabled, settings.TopN, settings.IntervalMinutes)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "查询计划采样配置已保存", "data": settings})
+}
+
+// POST /api/system/query-plans/run
+//
+// 立即采样一次（不受 enabled 限制），同步返回本轮的执行计划。
+func RunQueryProfiler(c *gin.Context) {
+	result, err := service.RunQueryProfiler(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrQueryProfilerRunning) {
+			c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "查询计划采样正在执行", ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("PROFILE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "手动采样查询计划: %d 条", len(result.Plans))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// DELETE /api/system/query-plans
+func ClearQueryPlans(c *gin.Context) {
+	n, err := service.ClearQueryPlans(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("DELETE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "清空查询计划: %d 条", n)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "查询计划已清空"})
+}
+
+// GET /api/system/slo
+//
+// 本服务各路由近 window_minutes 分钟的 p50/p95/p99 响应时间与 SLO 目标（超标在前）。
+// 样本仅保存在进程内，重启后重新累积。
+func GetEndpointSLO(c *gin.Context) {
+	report, err := service.EndpointSLOReportNow(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// DELETE /api/system/slo
+func ResetEndpointSLO(c *gin.Context) {
+	service.ResetEndpointLatency()
+	setAuditDetail(c, "清空接口 SLO 样本")
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "接口响应时间样本已清空"})
+}
+
+// GET /api/system/slo/config
+func GetEndpointSLOConfig(c *gin.Context) {
+	settings, err := service.GetEndpointSLOSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/system/slo/config
+//
+// 部分更新，targets 整体替换，例如
+//
+//	{"enabled": true, "default_p95_ms": 3000, "window_minutes": 15, "min_samples": 20,
+//	 "targets": {"GET /api/dashboard/overview": 1500, "GET /api/risk/leaderboards": 8000}}
+//
+// enabled 时每分钟检查一次，路由开始超标与恢复时各推送一次 endpoint_slo 事件。
+func UpdateEndpointSLOConfig(c *gin.Context) {
+	var req service.EndpointSLOSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.UpdateEndpointSLOSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidEndpointSLO) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "接口 SLO: enabled=%v default_p95_ms=%d targets=%d", settings.Enabled, settings.DefaultP95Ms, len(settings.Targets))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "接口 SLO 配置已保存", "data": settings})
+}
+
+// GET /api/system/geoip
+//
+// GeoIP 数据库版本（database_type、build_epoch、文件大小与修改时间）、自动更新状态与配置。
+func GetGeoIPStatus(c *gin.Context) {
+	data, err := service.GetGeoIPStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// PUT /api/system/geoip/config
+//
+// 部分更新，例如 {"enabled": true, "interval_hours": 24, "city_urls": [], "asn_urls": ["https://.../GeoLite2-ASN.mmdb"]}。
+// city_urls 为空时使用内置 GeoLite2-City 镜像；asn_urls 为空时不下载 ASN 库。
+func UpdateGeoIPConfig(c *gin.Context) {
+	var req service.GeoIPUpdateSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.UpdateGeoIPUpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGeoIPUpdate) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "GeoIP 自动更新: enabled=%v interval_hours=%d", settings.Enabled, settings.IntervalHours)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "GeoIP 更新配置已保存", "data": settings})
+}
+
+// POST /api/system/geoip/update
+//
+// 立即下载并替换 GeoIP 数据库（忽略更新间隔与 enabled），后台执行，结果见 GET /api/system/geoip。
+func UpdateGeoIPDatabases(c *gin.Context) {
+	if service.GeoIPUpdating() {
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "GeoIP 数据库正在更新", ""))
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if _, err := service.UpdateGeoIPNow(ctx); err != nil && !errors.Is(err, service.ErrGeoIPUpdateRunning) {
+			logger.L.Warn("[GeoIP] 手动更新失败: " + err.Error())
+		}
+	}()
+	setAuditDetail(c, "手动触发 GeoIP 数据库更新")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "GeoIP 数据库更新已开始"})
+}
+
+// GET /api/system/db-stats
+//
+// PostgreSQL 统计信息检查：各表上次 ANALYZE 时间、变更比例、是否过期，
+// 代表性 GROUP BY 查询的计划成本，以及最近的 ANALYZE 记录。非 PostgreSQL 时 supported=false。
+func GetDBStats(c *gin.Context) {
+	report, err := service.DBStatsReportNow(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+// PUT /api/system/db-stats/config
+//
+// 部分更新，例如 {"enabled": true, "tables": ["logs", "users"], "stale_hours": 24,
+// "modified_ratio": 0.1, "window_start": "03:00", "window_end": "05:00"}。
+// enabled 时仅在维护窗口内（报表时区）自动 ANALYZE 过期的表。
+func UpdateDBStatsConfig(c *gin.Context) {
+	var req service.DBStatsSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.UpdateDBStatsSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDBStatsSettings) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "统计信息顾问: enabled=%v tables=%v window=%s-%s",
+		settings.Enabled, settings.Tables, settings.WindowStart, settings.WindowEnd)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "统计信息配置已保存", "data": settings})
+}
+
+// POST /api/system/db-stats/analyze
+//
+// 立即 ANALYZE（不受维护窗口限制），可选 {"tables": ["logs"]}，缺省为配置中的全部表。
+// 同步执行，返回每张表 ANALYZE 前后的计划成本。
+func RunDBAnalyze(c *gin.Context) {
+	var req struct {
+		Tables []string `json:"tables"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+			return
+		}
+	}
+	runs, err := service.AnalyzeTables(c.Request.Context(), req.Tables, "manual")
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDBStatsSettings), errors.Is(err, service.ErrDBStatsUnsupported):
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+		case errors.Is(err, service.ErrDBStatsRunning):
+			c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "ANALYZE 正在执行", ""))
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResp("ANALYZE_ERROR", err.Error(), ""))
+		}
+		return
+	}
+	setAuditDetail(c, "手动 ANALYZE: %d 张表", len(runs))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": runs})
+}
+
+// GET /api/system/masking
+//
+// 脱敏配置，以及当前会话在用户 / 风控 / IP 接口中是否看到脱敏数据（active）。
+// 操作员会话（OPERATOR_PASSWORD 登录）与带 X-Data-Masking: on 的请求始终脱敏。
+func GetDataMasking(c *gin.Context) {
+	settings, _, err := service.CurrentDataMasking(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"settings": settings,
+		"active":   settings.Enabled || middleware.MaskingRequested(c),
+		"operator": c.GetString("user_sub") == auth.SubjectOperator,
+	}})
+}
+
+// PUT /api/system/masking
+//
+// 部分更新，例如 {"enabled": true, "mask_emails": true, "mask_ips": true}。
+// enabled 为全局开关；操作员会话不能修改。
+func UpdateDataMasking(c *gin.Context) {
+	if c.GetString("user_sub") == auth.SubjectOperator {
+		c.JSON(http.StatusForbidden, models.ErrorResp("FORBIDDEN", "操作员会话不能修改脱敏配置", ""))
+		return
+	}
+	var req service.DataMaskingSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.UpdateDataMaskingSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "数据脱敏: enabled=%v emails=%v ips=%v", settings.Enabled, settings.MaskEmails, settings.MaskIPs)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "脱敏配置已保存", "data": settings})
+}
+
+// GET /api/system/retention
+//
+// 保留策略配置，以及当前（或最近一次）清理运行的逐表进度。
+func GetRetention(c *gin.Context) {
+	svc := service.NewRetentionService()
+	settings, err := svc.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"settings": settings,
+		"run":      svc.GetRun(c.Request.Context()),
+	}})
+}
+
+// PUT /api/system/retention
+//
+// 请求体 {"enabled": true, "policies": {"logs": {"ttl_days": 90, "action": "archive"}}}，
+// policies 只覆盖给出的表；ttl_days=0 表示永久保留。
+func UpdateRetention(c *gin.Context) {
+	var req service.RetentionSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewRetentionService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRetentionPolicy) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	p := settings.Policies
+	setAuditDetail(c, "数据保留: enabled=%v logs=%dd audit_logs=%dd ip_history=%dd", settings.Enabled,
+		p[service.RetentionTableLogs].TTLDays, p[service.RetentionTableAuditLogs].TTLDays, p[service.RetentionTableIPHistory].TTLDays)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "数据保留策略已更新", "data": settings})
+}
+
+// POST /api/system/retention/run
+//
+// 立即在后台执行一轮清理，进度通过 GET /api/system/retention 查看。
+func RunRetention(c *gin.Context) {
+	svc := service.NewRetentionService()
+	if svc.GetRun(c.Request.Context()).Running {
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "数据保留清理正在进行中", ""))
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+		if _, err := svc.Run(ctx, "manual"); err != nil && !errors.Is(err, service.ErrRetentionRunning) {
+			logger.L.Warn("[数据保留] 手动清理失败: " + err.Error())
+		}
+	}()
+	setAuditDetail(c, "手动触发数据保留清理")
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "数据保留清理已开始"})
+}
+
+// GET /api/system/backup
+//
+// 下载本工具本地状态的完整备份（tar.gz）：DATA_DIR 下所有 SQLite 库
+// （配置、分析汇总、审计日志、联合广播缓存等）与 Redis 中的配置键。
+func DownloadBackup(c *gin.Context) {
+	backup, err := service.NewBackupService().Create(c.Request.Context())
+	if errors.Is(err, service.ErrBackupBusy) {
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "备份或恢复正在进行中", ""))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("BACKUP_FAILED", err.Error(), ""))
+		return
+	}
+	defer backup.Cleanup()
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", `attachment; filename="`+backup.FileName()+`"`)
+	c.Status(http.StatusOK)
+	if err := backup.Write(c.Writer); err != nil {
+		logger.L.Error("[备份] 写出备份失败: " + err.Error())
+	}
+}
+
+// POST /api/system/restore?redis=true
+//
+// 上传 GET /api/system/backup 生成的归档（multipart 字段 file，或直接作为请求体）。
+// 校验通过后替换本地数据库，旧文件以 .pre-restore-<时间戳> 保留；redis=false 时不恢复 Redis 配置键。
+func RestoreBackup(c *gin.Context) {
+	body := io.Reader(c.Request.Body)
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无法读取上传文件", err.Error()))
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	result, err := service.NewBackupService().Restore(c.Request.Context(), body, c.DefaultQuery("redis", "true") != "false")
+	switch {
+	case errors.Is(err, service.ErrInvalidBackup):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_BACKUP", err.Error(), ""))
+		return
+	case errors.Is(err, service.ErrBackupBusy):
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_RUNNING", "备份或恢复正在进行中", ""))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("RESTORE_FAILED", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "恢复备份: %d 个数据库文件, %d 个 Redis 键", len(result.RestoredFiles), len(result.RedisKeys))
+	c.JSON(http.StatusOK, gin.H{"success": len(result.Errors) == 0, "data": result})
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
 	"github.com/new-api-tools/backend/internal/service"
 )
 
@@ -15,6 +18,11 @@ func RegisterTokenRoutes(r *gin.RouterGroup) {
 		g.GET("", ListTokens)
 		g.GET("/statistics", GetTokenStatistics)
 		g.GET("/groups", GetTokenGroups)
+		g.GET("/top", GetTopTokens)
+		g.GET("/:token_id/usage", GetTokenUsage)
+		g.POST("/batch/disable-group", BatchDisableGroupTokens)
+		g.POST("/batch/expire-unused", BatchExpireUnusedTokens)
+		g.POST("/batch/purge-deleted", BatchPurgeDeletedTokens)
 	}
 }
 
@@ -35,7 +43,7 @@ func ListTokens(c *gin.Context) {
 		Expired:  c.Query("expired"),
 	}
 
-	svc := service.NewTokenService()
+	svc := service.NewTokenService().WithContext(c.Request.Context())
 	result, err := svc.ListTokens(params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -53,7 +61,7 @@ func ListTokens(c *gin.Context) {
 
 // GET /api/tokens/groups
 func GetTokenGroups(c *gin.Context) {
-	svc := service.NewTokenService()
+	svc := service.NewTokenService().WithContext(c.Request.Context())
 	groups, err := svc.GetTokenGroups()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -71,7 +79,7 @@ func GetTokenGroups(c *gin.Context) {
 
 // GET /api/tokens/statistics
 func GetTokenStatistics(c *gin.Context) {
-	svc := service.NewTokenService()
+	svc := service.NewTokenService().WithContext(c.Request.Context())
 	stats, err := svc.GetTokenStatistics()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -86,3 +94,131 @@ func GetTokenStatistics(c *gin.Context) {
 		"data":    stats,
 	})
 }
+
+func respondTokenUsageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTokenQuery):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrTokenNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "令牌不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+	}
+}
+
+// GET /api/tokens/:token_id/usage?window=24h
+//
+// 令牌在窗口内的使用情况：按模型的请求 / 额度、来源 IP、按小时时间线，以及首次 / 最后使用时间。
+func GetTokenUsage(c *gin.Context) {
+	tokenID, err := strconv.ParseInt(c.Param("token_id"), 10, 64)
+	if err != nil || tokenID <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid token ID", ""))
+		return
+	}
+	svc := service.NewTokenService().WithContext(c.Request.Context())
+	data, err := svc.GetTokenUsage(tokenID, c.DefaultQuery("window", "24h"))
+	if err != nil {
+		respondTokenUsageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/tokens/top?window=24h&sort_by=quota&limit=20
+//
+// 窗口内消耗最多的令牌（sort_by: quota | requests），不含按角色排除的管理员账号。
+func GetTopTokens(c *gin.Context) {
+	svc := service.NewTokenService().WithContext(c.Request.Context())
+	data, err := svc.GetTopTokens(c.DefaultQuery("window", "24h"), c.Query("sort_by"), parseLimit(c, 20, 200))
+	if err != nil {
+		respondTokenUsageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+func respondTokenBatch(c *gin.Context, result service.TokenBatchResult, err error) {
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTokenBatch) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	message := "预览完成"
+	if !result.DryRun {
+		message = fmt.Sprintf("已处理 %d 个令牌", result.Affected)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": message, "data": result})
+}
+
+// POST /api/tokens/batch/disable-group
+//
+// 禁用某个用户分组下所有启用中的令牌，默认 dry_run=true 只返回数量与预览：
+//
+//	{"group": "free", "dry_run": false}
+func BatchDisableGroupTokens(c *gin.Context) {
+	var req struct {
+		Group  string `json:"group"`
+		DryRun bool   `json:"dry_run"`
+	}
+	req.DryRun = true
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewTokenService().WithContext(c.Request.Context())
+	result, err := svc.DisableGroupTokens(req.Group, req.DryRun)
+	if err == nil && !req.DryRun {
+		setAuditDetail(c, "禁用分组 %s 的令牌: %d 个", req.Group, result.Affected)
+	}
+	respondTokenBatch(c, result, err)
+}
+
+// POST /api/tokens/batch/expire-unused
+//
+// 将 N 天未使用（从未使用则按创建时间）的启用令牌标记为已过期：
+//
+//	{"days": 90, "dry_run": false}
+func BatchExpireUnusedTokens(c *gin.Context) {
+	var req struct {
+		Days   int  `json:"days"`
+		DryRun bool `json:"dry_run"`
+	}
+	req.Days, req.DryRun = 90, true
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewTokenService().WithContext(c.Request.Context())
+	result, err := svc.ExpireUnusedTokens(req.Days, req.DryRun)
+	if err == nil && !req.DryRun {
+		setAuditDetail(c, "过期 %d 天未使用的令牌: %d 个", req.Days, result.Affected)
+	}
+	respondTokenBatch(c, result, err)
+}
+
+// POST /api/tokens/batch/purge-deleted
+//
+// 彻底删除已软删除的令牌；执行时需 confirm_text="彻底删除"。
+func BatchPurgeDeletedTokens(c *gin.Context) {
+	var req struct {
+		DryRun      bool   `json:"dry_run"`
+		ConfirmText string `json:"confirm_text"`
+	}
+	req.DryRun = true
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	if !req.DryRun && !requireDeleteConfirmText(c, req.ConfirmText, confirmTextHardDelete) {
+		return
+	}
+	svc := service.NewTokenService().WithContext(c.Request.Context())
+	result, err := svc.PurgeDeletedTokens(req.DryRun)
+	if err == nil && !req.DryRun {
+		setAuditDetail(c, "彻底删除软删除令牌: %d 个", result.Affected)
+	}
+	respondTokenBatch(c, result, err)
+}
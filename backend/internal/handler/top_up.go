@@ -41,6 +41,7 @@ func RegisterTopUpRoutes(r *gin.RouterGroup) {
 		g.GET("/payment-methods", GetPaymentMethods)
 		g.GET("/payment-providers", GetPaymentProviders)
 		g.GET("/export", ExportTopUps)
+		g.GET("/reconciliation", GetTopUpReconciliation)
 		g.GET("/:id", GetTopUpRecord)
 	}
 }
@@ -78,7 +79,7 @@ func ListTopUps(c *gin.Context) {
 		}
 	}
 
-	result, err := service.ListTopUpRecords(params)
+	result, err := service.ListTopUpRecords(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -95,7 +96,7 @@ func GetTopUpStatistics(c *gin.Context) {
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 
-	stats, err := service.GetTopUpStatistics(startDate, endDate)
+	stats, err := service.GetTopUpStatistics(c.Request.Context(), startDate, endDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -109,7 +110,7 @@ func GetTopUpStatistics(c *gin.Context) {
 
 // GET /api/top-ups/payment-methods
 func GetPaymentMethods(c *gin.Context) {
-	methods, err := service.GetPaymentMethods()
+	methods, err := service.GetPaymentMethods(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -123,7 +124,7 @@ func GetPaymentMethods(c *gin.Context) {
 
 // GET /api/top-ups/payment-providers
 func GetPaymentProviders(c *gin.Context) {
-	providers, err := service.GetPaymentProviders()
+	providers, err := service.GetPaymentProviders(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -143,7 +144,7 @@ func GetTopUpRecord(c *gin.Context) {
 		return
 	}
 
-	record, err := service.GetTopUpByID(id)
+	record, err := service.GetTopUpByID(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "Top up record not found", ""))
 		return
@@ -155,7 +156,30 @@ func GetTopUpRecord(c *gin.Context) {
 	})
 }
 
+// exportAnonymizer returns the pseudonymizer when the export asks for
+// anonymize=true (nil otherwise); false means an error response was written
+func exportAnonymizer(c *gin.Context) (*service.ExportAnonymizer, bool) {
+	if c.Query("anonymize") != "true" {
+		return nil, true
+	}
+	anon, err := service.NewExportAnonymizer(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("EXPORT_ERROR", "无法加载脱敏密钥", err.Error()))
+		return nil, false
+	}
+	return anon, true
+}
+
+// exportFilename appends "_anonymized" to anonymized export names
+func exportFilename(prefix, suffix string, anon *service.ExportAnonymizer) string {
+	if anon != nil {
+		prefix += "_anonymized"
+	}
+	return prefix + suffix
+}
+
 // GET /api/top-ups/export — streams matching records as CSV. Filters mirror /api/top-ups.
+// anonymize=true 时用户 ID 与用户名替换为稳定的假名，便于交给外部会计。
 func ExportTopUps(c *gin.Context) {
 	// 并发互斥：同一个用户已有导出在跑就直接 429，不让长查询叠加。
 	lockKey := exportLockKey(c)
@@ -184,7 +208,7 @@ func ExportTopUps(c *gin.Context) {
 		}
 	}
 
-	total, err := service.CountTopUps(params)
+	total, err := service.CountTopUps(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -198,7 +222,12 @@ func ExportTopUps(c *gin.Context) {
 		return
 	}
 
-	filename := fmt.Sprintf("top_ups_%s.csv", time.Now().Format("20060102_150405"))
+	anon, ok := exportAnonymizer(c)
+	if !ok {
+		return
+	}
+
+	filename := exportFilename("top_ups_"+time.Now().Format("20060102_150405"), ".csv", anon)
 	c.Header("Content-Type", "text/csv; charset=utf-8")
 	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
 	c.Header("Cache-Control", "no-store")
@@ -208,8 +237,8 @@ func ExportTopUps(c *gin.Context) {
 	subject, _ := c.Get("user_sub")
 	method, _ := c.Get("auth_method")
 	log.Printf(
-		"audit top_ups_export user=%v auth=%v rows=%d filters={status:%q payment:%q provider:%q trade_no:%q username:%q user_id:%v start:%q end:%q} ip=%s",
-		subject, method, total,
+		"audit top_ups_export user=%v auth=%v rows=%d anonymized=%v filters={status:%q payment:%q provider:%q trade_no:%q username:%q user_id:%v start:%q end:%q} ip=%s",
+		subject, method, total, anon != nil,
 		params.Status, params.PaymentMethod, params.PaymentProvider, params.TradeNo, params.Username, params.UserID,
 		params.StartDate, params.EndDate, c.ClientIP(),
 	)
@@ -217,7 +246,7 @@ func ExportTopUps(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
 	defer cancel()
 
-	if err := service.ExportTopUpsToCSV(ctx, c.Writer, params); err != nil {
+	if err := service.ExportTopUpsToCSV(ctx, c.Writer, params, anon); err != nil {
 		// 响应头已发出，无法切回 JSON。CSV 末尾追加注释会污染 Excel 解析，
 		// 这里仅 server log，前端通过文件最后一行可观察到截断。
 		if !errors.Is(err, context.Canceled) {
@@ -225,3 +254,51 @@ func ExportTopUps(c *gin.Context) {
 		}
 	}
 }
+
+// GET /api/top-ups/reconciliation?start_date=2024-05-01&end_date=2024-05-31&slack_minutes=10&format=json|csv
+//
+// 对账：成功 / 退款订单 vs 额度到账日志，列出未到账、金额不符、退款未冲正、无单到账。
+// CSV 支持 anonymize=true。
+func GetTopUpReconciliation(c *gin.Context) {
+	slack, _ := strconv.Atoi(c.Query("slack_minutes"))
+	params := service.TopUpReconcileParams{
+		StartDate:    c.Query("start_date"),
+		EndDate:      c.Query("end_date"),
+		SlackMinutes: slack,
+	}
+
+	report, err := service.ReconcileTopUps(c.Request.Context(), params)
+	if err != nil {
+		if errors.Is(err, service.ErrReconcileWindow) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+		return
+	}
+
+	anon, ok := exportAnonymizer(c)
+	if !ok {
+		return
+	}
+
+	filename := exportFilename(fmt.Sprintf("top_up_reconciliation_%s_%s",
+		time.Unix(report.StartTime, 0).Format("20060102"), time.Unix(report.EndTime, 0).Format("20060102")), ".csv", anon)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	subject, _ := c.Get("user_sub")
+	log.Printf("audit top_up_reconciliation_export user=%v rows=%d anonymized=%v start:%q end:%q ip=%s",
+		subject, len(report.Mismatches), anon != nil, params.StartDate, params.EndDate, c.ClientIP())
+
+	if err := service.WriteReconciliationCSV(c.Writer, report, anon); err != nil {
+		log.Printf("top_up reconciliation export failed: %v", err)
+	}
+}
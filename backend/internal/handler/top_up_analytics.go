@@ -14,6 +14,7 @@ func RegisterTopUpAnalyticsRoutes(r *gin.RouterGroup) {
 	g := r.Group("/top-ups/analytics")
 	{
 		g.GET("/trends", GetTopUpTrends)
+		g.GET("/revenue", GetTopUpRevenueTrends)
 		g.GET("/financial-summary", GetTopUpFinancialSummary)
 		g.GET("/top-users", GetTopUpTopUsers)
 		g.GET("/payment-distribution", GetPaymentMethodDistribution)
@@ -40,7 +41,35 @@ func GetTopUpTrends(c *gin.Context) {
 		Days:        days,
 	}
 
-	data, err := service.GetTopUpTrends(params)
+	data, err := service.GetTopUpTrends(c.Request.Context(), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// GET /api/top-ups/analytics/revenue?granularity=daily|weekly&days=30
+//
+// 按支付方式拆分的收入趋势，含 ARPU、退款率、新老付费用户拆分。
+func GetTopUpRevenueTrends(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days < 1 || days > 365 {
+		days = 30
+	}
+
+	params := service.TopUpTrendsParams{
+		Granularity: c.DefaultQuery("granularity", "daily"),
+		StartDate:   c.Query("start_date"),
+		EndDate:     c.Query("end_date"),
+		Days:        days,
+	}
+
+	data, err := service.GetRevenueTrends(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -59,7 +88,7 @@ func GetTopUpFinancialSummary(c *gin.Context) {
 		months = 12
 	}
 
-	data, err := service.GetTopUpFinancialSummary(months)
+	data, err := service.GetTopUpFinancialSummary(c.Request.Context(), months)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -82,7 +111,7 @@ func GetTopUpTopUsers(c *gin.Context) {
 		days = 30
 	}
 
-	data, err := service.GetTopUpTopUsers(limit, days)
+	data, err := service.GetTopUpTopUsers(c.Request.Context(), limit, days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -101,7 +130,7 @@ func GetPaymentMethodDistribution(c *gin.Context) {
 		days = 30
 	}
 
-	data, err := service.GetPaymentMethodDistribution(days)
+	data, err := service.GetPaymentMethodDistribution(c.Request.Context(), days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -115,7 +144,7 @@ func GetPaymentMethodDistribution(c *gin.Context) {
 
 // GET /api/top-ups/analytics/realtime
 func GetTopUpRealtimeStats(c *gin.Context) {
-	data, err := service.GetTopUpRealtimeStats()
+	data, err := service.GetTopUpRealtimeStats(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -134,7 +163,7 @@ func GetTopUpHourlyHeatmap(c *gin.Context) {
 		days = 30
 	}
 
-	data, err := service.GetTopUpHourlyHeatmap(days)
+	data, err := service.GetTopUpHourlyHeatmap(c.Request.Context(), days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -153,7 +182,7 @@ func GetTopUpFunnel(c *gin.Context) {
 		days = 30
 	}
 
-	data, err := service.GetTopUpFunnel(days)
+	data, err := service.GetTopUpFunnel(c.Request.Context(), days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -172,7 +201,7 @@ func GetTopUpPayerCohorts(c *gin.Context) {
 		days = 30
 	}
 
-	data, err := service.GetTopUpPayerCohorts(days)
+	data, err := service.GetTopUpPayerCohorts(c.Request.Context(), days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -191,7 +220,7 @@ func GetTopUpProviderHealth(c *gin.Context) {
 		days = 30
 	}
 
-	data, err := service.GetTopUpProviderHealth(days)
+	data, err := service.GetTopUpProviderHealth(c.Request.Context(), days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -218,7 +247,7 @@ func GetTopUpAnomalies(c *gin.Context) {
 		limit = 50
 	}
 
-	data, err := service.GetTopUpAnomalies(days, pendingHours, limit)
+	data, err := service.GetTopUpAnomalies(c.Request.Context(), days, pendingHours, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
 		return
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterUserCommsRoutes registers /api/communications endpoints; per-user
+// listing and creation live under /api/users/:user_id/communications
+func RegisterUserCommsRoutes(r *gin.RouterGroup) {
+	g := r.Group("/communications")
+	{
+		g.GET("", ListCommunications)
+		g.PUT("/:id", UpdateCommunication)
+		g.DELETE("/:id", DeleteCommunication)
+	}
+}
+
+func respondCommError(c *gin.Context, err error) {
+	var recent *service.RecentContactError
+	switch {
+	case errors.As(err, &recent):
+		resp := models.ErrorResp("RECENTLY_CONTACTED",
+			"该用户 24 小时内已由 "+recent.Previous.Operator+" 联系过，确认仍需联系请设置 force", "")
+		resp["data"] = recent.Previous
+		c.JSON(http.StatusConflict, resp)
+	case errors.Is(err, service.ErrInvalidComm):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrCommNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "联系记录不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseCommID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的联系记录 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api/communications?operator=&outcome=pending&follow_up_due=true&limit=50&offset=0
+//
+// 全部联系记录；follow_up_due=true 只返回到期待跟进的记录。
+func ListCommunications(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	items, total, err := service.NewUserCommsService().List(c.Request.Context(), service.CommQuery{
+		UserID:      userID,
+		Operator:    c.Query("operator"),
+		Outcome:     c.Query("outcome"),
+		FollowUpDue: c.Query("follow_up_due") == "true",
+		Limit:       parseLimit(c, 50, 500),
+		Offset:      max(offset, 0),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": items, "total": total}})
+}
+
+// GET /api/users/:user_id/communications
+//
+// 该用户的联系记录摘要（最近联系时间、联系人、待跟进数）与完整列表。
+func GetUserCommunications(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user ID", ""))
+		return
+	}
+	svc := service.NewUserCommsService()
+	summary, err := svc.Summary(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	items, total, err := svc.List(c.Request.Context(), service.CommQuery{UserID: userID, Limit: parseLimit(c, 100, 500)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"summary": summary, "items": items, "total": total}})
+}
+
+// POST /api/users/:user_id/communications
+//
+// 请求体 {"channel": "email", "subject": "滥用警告", "summary": "...", "outcome": "pending",
+// "contacted_at": 1700000000, "follow_up_at": 1700259200, "force": false}。
+// 24 小时内其他管理员已联系过该用户时返回 409 及那条记录，避免重复联系。
+func CreateUserCommunication(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user ID", ""))
+		return
+	}
+	var req service.UserCommunicationInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewUserCommsService().WithContext(c.Request.Context()).Create(c.Request.Context(), operatorIdentity(c), userID, req)
+	if err != nil {
+		respondCommError(c, err)
+		return
+	}
+	setAuditDetail(c, "记录联系用户 %d (%s) via %s: %s", entry.UserID, entry.Username, entry.Channel, entry.Subject)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "联系记录已保存", "data": entry})
+}
+
+// PUT /api/communications/:id
+//
+// 部分更新，通常用于记录结果 {"outcome": "resolved", "summary": "..."}。
+func UpdateCommunication(c *gin.Context) {
+	id, ok := parseCommID(c)
+	if !ok {
+		return
+	}
+	var req service.UserCommunicationInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewUserCommsService().Update(c.Request.Context(), id, req)
+	if err != nil {
+		respondCommError(c, err)
+		return
+	}
+	setAuditDetail(c, "更新联系记录 #%d outcome=%s", id, entry.Outcome)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "联系记录已更新", "data": entry})
+}
+
+// DELETE /api/communications/:id
+func DeleteCommunication(c *gin.Context) {
+	id, ok := parseCommID(c)
+	if !ok {
+		return
+	}
+	entry, err := service.NewUserCommsService().Delete(c.Request.Context(), id)
+	if err != nil {
+		respondCommError(c, err)
+		return
+	}
+	setAuditDetail(c, "删除联系记录 #%d (用户 %d)", id, entry.UserID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "联系记录已删除"})
+}
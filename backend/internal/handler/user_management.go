@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,11 +9,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/new-api-tools/backend/internal/models"
 	"github.com/new-api-tools/backend/internal/service"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 const (
-	confirmTextSoftDelete = "注销用户"
-	confirmTextHardDelete = "彻底删除"
+	confirmTextSoftDelete = api.ConfirmTextSoftDelete
+	confirmTextHardDelete = api.ConfirmTextHardDelete
 )
 
 func RegisterUserManagementRoutes(r *gin.RouterGroup) {
@@ -28,15 +30,26 @@ func RegisterUserManagementRoutes(r *gin.RouterGroup) {
 		g.POST("/soft-deleted/purge", PurgeSoftDeletedUsers)
 		g.POST("/:user_id/ban", BanUser)
 		g.POST("/:user_id/unban", UnbanUser)
+		g.POST("/:user_id/quota", AdjustUserQuota)
+		g.POST("/quota/batch", BatchAdjustUserQuota)
+		g.POST("/lookup", LookupUsers)
+		g.GET("/signups", GetSignupStats)
+		g.GET("/signups/config", GetSignupConfig)
+		g.PUT("/signups/config", UpdateSignupConfig)
 		g.GET("/:user_id/invited", GetInvitedUsers)
+		g.GET("/:user_id/communications", GetUserCommunications)
+		g.POST("/:user_id/communications", CreateUserCommunication)
 		g.POST("/tokens/:token_id/disable", DisableToken)
+		g.GET("/oauth-enrichment/config", GetOAuthEnrichmentConfig)
+		g.PUT("/oauth-enrichment/config", UpdateOAuthEnrichmentConfig)
+		g.GET("/:user_id/oauth-profile", GetUserOAuthProfile)
 	}
 }
 
 // GET /api/users/activity-stats
 func GetActivityStats(c *gin.Context) {
 	quick := c.DefaultQuery("quick", "false") == "true"
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 
 	stats, err := svc.GetActivityStats(quick)
 	if err != nil {
@@ -52,7 +65,7 @@ func GetBannedUsers(c *gin.Context) {
 	pageSize := parsePageSize(c, 50, 200)
 	search := c.Query("search")
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	result, err := svc.GetBannedUsers(page, pageSize, search)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -63,21 +76,14 @@ func GetBannedUsers(c *gin.Context) {
 
 // GET /api/users
 func GetUsers(c *gin.Context) {
-	page := parsePage(c)
-	pageSize := parsePageSize(c, 20, 200)
-
-	params := service.ListUsersParams{
-		Page:           page,
-		PageSize:       pageSize,
-		ActivityFilter: c.Query("activity"),
-		GroupFilter:    c.Query("group"),
-		SourceFilter:   c.Query("source"),
-		Search:         c.Query("search"),
-		OrderBy:        c.DefaultQuery("order_by", "request_count"),
-		OrderDir:       c.DefaultQuery("order_dir", "DESC"),
+	params := api.ListUsersParams{OrderBy: "request_count", OrderDir: "DESC"}
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid query parameters", err.Error()))
+		return
 	}
+	params.Page, params.PageSize = parsePage(c), parsePageSize(c, 20, 200)
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	result, err := svc.GetUsers(params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -95,9 +101,7 @@ func DeleteUser(c *gin.Context) {
 	}
 
 	hardDelete := c.DefaultQuery("hard_delete", "false") == "true"
-	var req struct {
-		ConfirmText string `json:"confirm_text"`
-	}
+	var req api.DeleteUserRequest
 	_ = c.ShouldBindJSON(&req)
 
 	expectedConfirmText := confirmTextSoftDelete
@@ -108,7 +112,7 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	affected, err := svc.DeleteUser(userID, hardDelete)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("DELETE_ERROR", err.Error(), ""))
@@ -126,20 +130,13 @@ func DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "用户已" + action,
-		"data":    gin.H{"affected": affected},
+		"data":    api.AffectedResult{Affected: affected},
 	})
 }
 
 // POST /api/users/batch-delete
 func BatchDeleteInactiveUsers(c *gin.Context) {
-	var req struct {
-		ActivityLevel string `json:"activity_level"`
-		DryRun        bool   `json:"dry_run"`
-		HardDelete    bool   `json:"hard_delete"`
-		ConfirmText   string `json:"confirm_text"`
-	}
-	req.ActivityLevel = "very_inactive"
-	req.DryRun = true
+	req := api.BatchDeleteRequest{ActivityLevel: "very_inactive", DryRun: true}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
@@ -156,7 +153,7 @@ func BatchDeleteInactiveUsers(c *gin.Context) {
 		}
 	}
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	result, err := svc.BatchDeleteInactiveUsers(req.ActivityLevel, req.DryRun, req.HardDelete)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResp("DELETE_ERROR", err.Error(), ""))
@@ -168,7 +165,7 @@ func BatchDeleteInactiveUsers(c *gin.Context) {
 
 // GET /api/users/soft-deleted/count
 func GetSoftDeletedCount(c *gin.Context) {
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	count, err := svc.GetSoftDeletedCount()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
@@ -190,7 +187,7 @@ func PurgeSoftDeletedUsers(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	if req.DryRun {
 		result, err := svc.PreviewSoftDeletedUsers()
 		if err != nil {
@@ -214,7 +211,7 @@ func PurgeSoftDeletedUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "清理完成",
-		"data":    gin.H{"affected": affected},
+		"data":    api.AffectedResult{Affected: affected},
 	})
 }
 
@@ -238,14 +235,10 @@ func BanUser(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Reason        string `json:"reason"`
-		DisableTokens bool   `json:"disable_tokens"`
-	}
-	req.DisableTokens = true
+	req := api.BanUserRequest{DisableTokens: true}
 	c.ShouldBindJSON(&req)
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	if err := svc.BanUser(userID, req.DisableTokens); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("BAN_ERROR", err.Error(), ""))
 		return
@@ -265,13 +258,10 @@ func UnbanUser(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Reason       string `json:"reason"`
-		EnableTokens bool   `json:"enable_tokens"`
-	}
+	var req api.UnbanUserRequest
 	c.ShouldBindJSON(&req)
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	if err := svc.UnbanUser(userID, req.EnableTokens); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("UNBAN_ERROR", err.Error(), ""))
 		return
@@ -283,6 +273,207 @@ func UnbanUser(c *gin.Context) {
 	})
 }
 
+func respondQuotaAdjustError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidQuotaAdjust):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrQuotaUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "用户不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+// POST /api/users/:user_id/quota
+//
+// 直接调整用户额度（如误封后补偿），原因与操作人写入审计日志：
+//
+//	{"mode": "grant", "amount_usd": 5, "reason": "误封补偿"}
+//
+// mode: grant 增加 / deduct 扣减（不低于 0）/ set 设为指定值；额度用 quota 或 amount_usd 二选一。
+func AdjustUserQuota(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user ID", ""))
+		return
+	}
+	var req service.QuotaAdjustInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
+	result, err := svc.AdjustQuota(userID, req)
+	if err != nil {
+		respondQuotaAdjustError(c, err)
+		return
+	}
+	setAuditDetail(c, "额度调整 用户 %d %s: %d -> %d, 操作人 %s, 原因: %s",
+		userID, req.Mode, result.Before, result.After, operatorIdentity(c), strings.TrimSpace(req.Reason))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "额度已调整", "data": result})
+}
+
+// POST /api/users/quota/batch
+//
+// 批量调整额度（最多 500 个用户），逐个用户独立提交，失败项在结果中标注：
+//
+//	{"user_ids": [1, 2, 3], "mode": "grant", "quota": 500000, "reason": "故障补偿"}
+func BatchAdjustUserQuota(c *gin.Context) {
+	var req struct {
+		UserIDs []int64 `json:"user_ids"`
+		service.QuotaAdjustInput
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
+	results, err := svc.BatchAdjustQuota(req.UserIDs, req.QuotaAdjustInput)
+	if err != nil {
+		respondQuotaAdjustError(c, err)
+		return
+	}
+	var applied int
+	var delta int64
+	for _, r := range results {
+		if r.Error == "" {
+			applied++
+			delta += r.Delta
+		}
+	}
+	setAuditDetail(c, "批量额度调整 %s: %d/%d 个用户, 合计变化 %d, 操作人 %s, 原因: %s",
+		req.Mode, applied, len(results), delta, operatorIdentity(c), strings.TrimSpace(req.Reason))
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"applied": applied, "total_delta": delta, "results": results}})
+}
+
+// POST /api/users/lookup
+//
+// 批量解析用户（ids 与 usernames 合计最多 500 个），一次查询返回精简资料：
+//
+//	{"ids": [1, 2, 3], "usernames": ["alice"]}
+//
+// 已软删除的用户带 deleted=true；未找到的输入列在 missing_ids / missing_usernames。
+func LookupUsers(c *gin.Context) {
+	var req struct {
+		IDs       []int64  `json:"ids"`
+		Usernames []string `json:"usernames"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
+	result, err := svc.LookupUsers(req.IDs, req.Usernames)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUserLookup) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// GET /api/users/signups?days=30&source=
+//
+// 每日新增用户数（报表时区），含 today 与最近 7 天 week。source 缺省用配置值：
+// user_id = 每日 users.id 水位快照（统计全部注册，仅从首个快照起有数据），
+// token = 首个令牌创建时间，logs = 首条请求日志时间（后两者漏掉从未使用的注册）。
+func GetSignupStats(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	data, err := service.NewSignupStatsService().WithContext(c.Request.Context()).Stats(c.Request.Context(), c.Query("source"), days)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSignupSource) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// GET /api/users/signups/config
+func GetSignupConfig(c *gin.Context) {
+	settings, err := service.NewSignupStatsService().GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"source": settings.Source, "updated_at": settings.UpdatedAt, "sources": service.SignupSources}})
+}
+
+// PUT /api/users/signups/config
+//
+// {"source": "user_id" | "token" | "logs"}
+func UpdateSignupConfig(c *gin.Context) {
+	var req struct {
+		Source string `json:"source" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewSignupStatsService().UpdateSettings(c.Request.Context(), req.Source)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSignupSource) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "新增用户统计来源: %s", settings.Source)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "新增用户统计来源已保存", "data": settings})
+}
+
+// GET /api/users/oauth-enrichment/config
+func GetOAuthEnrichmentConfig(c *gin.Context) {
+	settings, err := service.NewOAuthEnrichmentService().GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+// PUT /api/users/oauth-enrichment/config
+func UpdateOAuthEnrichmentConfig(c *gin.Context) {
+	var req service.OAuthEnrichmentSettingsInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	settings, err := service.NewOAuthEnrichmentService().UpdateSettings(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+		return
+	}
+	setAuditDetail(c, "OAuth 资料补全: enabled=%v rpm=%d", settings.Enabled, settings.RequestsPerMinute)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "OAuth 资料补全配置已保存", "data": settings})
+}
+
+// GET /api/users/:user_id/oauth-profile?refresh=1
+func GetUserOAuthProfile(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid user ID", ""))
+		return
+	}
+	refresh := c.Query("refresh") == "1" || c.Query("refresh") == "true"
+	profiles, err := service.NewOAuthEnrichmentService().UserProfiles(c.Request.Context(), userID, refresh)
+	if err != nil {
+		if errors.Is(err, service.ErrOAuthEnrichmentDisabled) {
+			c.JSON(http.StatusBadRequest, models.ErrorResp("DISABLED", err.Error(), ""))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"user_id": userID, "profiles": profiles}})
+}
+
 // POST /api/users/tokens/:token_id/disable
 func DisableToken(c *gin.Context) {
 	tokenID, err := strconv.ParseInt(c.Param("token_id"), 10, 64)
@@ -291,7 +482,7 @@ func DisableToken(c *gin.Context) {
 		return
 	}
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	if err := svc.DisableToken(tokenID); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("DISABLE_ERROR", err.Error(), ""))
 		return
@@ -314,7 +505,7 @@ func GetInvitedUsers(c *gin.Context) {
 	page := parsePage(c)
 	pageSize := parsePageSize(c, 20, 200)
 
-	svc := service.NewUserManagementService()
+	svc := service.NewUserManagementService().WithContext(c.Request.Context())
 	data, err := svc.GetInvitedUsers(userID, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
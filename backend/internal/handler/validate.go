@@ -20,6 +20,13 @@ func clampInt(val, min, max int) int {
 
 // parseLimit parses "limit" query param with default and max cap
 func parseLimit(c *gin.Context, defaultVal, maxVal int) int {
+	// 大规模系统下收紧上限，但不低于接口默认值
+	if limitCap := service.CurrentScaleProfile().QueryLimitCap; limitCap > 0 && limitCap < maxVal {
+		maxVal = limitCap
+		if maxVal < defaultVal {
+			maxVal = defaultVal
+		}
+	}
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultVal)))
 	return clampInt(limit, 1, maxVal)
 }
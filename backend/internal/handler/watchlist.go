@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// RegisterWatchlistRoutes registers /api/watchlist endpoints
+func RegisterWatchlistRoutes(r *gin.RouterGroup) {
+	g := r.Group("/watchlist")
+	{
+		g.GET("", ListWatchlist)
+		g.POST("", CreateWatch)
+		g.PUT("/:id", UpdateWatch)
+		g.DELETE("/:id", DeleteWatch)
+		g.GET("/alerts", ListWatchAlerts)
+		g.POST("/alerts/read", MarkWatchAlertsRead)
+		g.POST("/evaluate", EvaluateWatchlist)
+	}
+}
+
+func respondWatchlistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWatch):
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", err.Error(), ""))
+	case errors.Is(err, service.ErrWatchExists):
+		c.JSON(http.StatusConflict, models.ErrorResp("ALREADY_EXISTS", "该用户已在关注名单中", ""))
+	case errors.Is(err, service.ErrWatchNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResp("NOT_FOUND", "关注项不存在", ""))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("UPDATE_ERROR", err.Error(), ""))
+	}
+}
+
+func parseWatchID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "无效的关注项 ID", ""))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /api/watchlist
+//
+// 当前管理员关注的用户及其通知规则。
+func ListWatchlist(c *gin.Context) {
+	entries, err := service.NewWatchlistService().WithContext(c.Request.Context()).List(c.Request.Context(), operatorIdentity(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": entries, "total": len(entries)}})
+}
+
+// POST /api/watchlist
+//
+// 请求体 {"user_id": 42, "window_minutes": 60, "request_threshold": 5000, "quota_threshold": 0,
+// "notify_country_change": true, "notify_ban": true, "note": "疑似转售"}
+func CreateWatch(c *gin.Context) {
+	var req service.WatchEntryInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewWatchlistService().WithContext(c.Request.Context()).Create(c.Request.Context(), operatorIdentity(c), req)
+	if err != nil {
+		respondWatchlistError(c, err)
+		return
+	}
+	setAuditDetail(c, "关注用户 %d (%s)", entry.UserID, entry.Username)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已加入关注名单", "data": entry})
+}
+
+// PUT /api/watchlist/:id
+func UpdateWatch(c *gin.Context) {
+	id, ok := parseWatchID(c)
+	if !ok {
+		return
+	}
+	var req service.WatchEntryInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResp("INVALID_PARAMS", "Invalid request body", err.Error()))
+		return
+	}
+	entry, err := service.NewWatchlistService().WithContext(c.Request.Context()).Update(c.Request.Context(), operatorIdentity(c), id, req)
+	if err != nil {
+		respondWatchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "关注规则已更新", "data": entry})
+}
+
+// DELETE /api/watchlist/:id
+func DeleteWatch(c *gin.Context) {
+	id, ok := parseWatchID(c)
+	if !ok {
+		return
+	}
+	if err := service.NewWatchlistService().WithContext(c.Request.Context()).Delete(c.Request.Context(), operatorIdentity(c), id); err != nil {
+		respondWatchlistError(c, err)
+		return
+	}
+	setAuditDetail(c, "取消关注 #%d", id)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已取消关注"})
+}
+
+// GET /api/watchlist/alerts?unread=1&limit=50
+//
+// 当前管理员收到的关注通知；实时推送见 /api/events 的 watchlist_alert 事件。
+func ListWatchAlerts(c *gin.Context) {
+	limit := parseLimit(c, 50, 500)
+	unreadOnly := c.Query("unread") == "1" || c.Query("unread") == "true"
+	alerts, unread, err := service.NewWatchlistService().WithContext(c.Request.Context()).ListAlerts(c.Request.Context(), operatorIdentity(c), unreadOnly, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResp("QUERY_ERROR", err.Error(), ""))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"items": alerts, "unread": unread}})
+}
+
+// POST /api/watchlist/alerts/read
+//
+// 请求体 {"max_id": 120}，省略 max_id 时全部标记为已读。
+func MarkWatchAlertsRead(c *gin.Context) {
+	var req struct {
+		MaxID int64 `json:"max_id"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	n, err := service.NewWatchlistService().WithContext(c.Request.Context()).MarkAlertsRead(c.Request.Context(), operatorIdentity(c), req.MaxID)
+	if err != nil {
+		respondWatchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"updated": n}})
+}
+
+// POST /api/watchlist/evaluate
+//
+// 立即执行一次关注名单检查（后台每 5 分钟自动执行）。
+func EvaluateWatchlist(c *gin.Context) {
+	result, err := service.NewWatchlistService().WithContext(c.Request.Context()).Evaluate(c.Request.Context())
+	if err != nil {
+		respondWatchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
@@ -0,0 +1,253 @@
+// Package i18n localizes API-facing messages. Handlers and services keep
+// writing Chinese (the source language); responses for other languages are
+// translated at the edge from a catalog of exact messages and templates, so
+// an untranslated message degrades to the original text instead of failing.
+package i18n
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lang is a supported response language
+type Lang string
+
+const (
+	ZH Lang = "zh" // source language, responses are left untouched
+	EN Lang = "en"
+)
+
+// Supported lists the languages responses can be localized to
+var Supported = []Lang{ZH, EN}
+
+// ContextKey is the gin context key holding the negotiated Lang
+const ContextKey = "lang"
+
+// Parse maps a language tag ("en", "en-US", "zh_CN", "zh-Hans") to a
+// supported Lang
+func Parse(tag string) (Lang, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, l := range Supported {
+		if string(l) == tag {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// Negotiate picks the highest-weighted supported language of an
+// Accept-Language header, falling back to def ("*" also means def)
+func Negotiate(header string, def Lang) Lang {
+	best, bestQ := def, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q <= bestQ {
+			continue
+		}
+		if strings.TrimSpace(tag) == "*" {
+			best, bestQ = def, q
+		} else if l, ok := Parse(tag); ok {
+			best, bestQ = l, q
+		}
+	}
+	return best
+}
+
+// Translate returns msg in lang. Messages without Chinese text, and every
+// message for ZH, are returned as is.
+func Translate(lang Lang, msg string) string {
+	c := catalogs[lang]
+	if c == nil || !hasHan(msg) {
+		return msg
+	}
+	out := punctuation.Replace(c.translate(strings.TrimSpace(msg)))
+	if first := []rune(msg)[0]; unicode.Is(unicode.Han, first) {
+		out = capitalize(out)
+	}
+	return out
+}
+
+// LocalizeJSON translates the top-level "message" and "error.message" strings
+// of a JSON response body. Bodies that are not objects, or carry nothing to
+// translate, are returned unchanged.
+func LocalizeJSON(lang Lang, body []byte) []byte {
+	if catalogs[lang] == nil {
+		return body
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+	changed := localizeField(lang, doc, "message")
+	if raw, ok := doc["error"]; ok {
+		var errDoc map[string]json.RawMessage
+		if json.Unmarshal(raw, &errDoc) == nil && localizeField(lang, errDoc, "message") {
+			if out, err := json.Marshal(errDoc); err == nil {
+				doc["error"], changed = out, true
+			}
+		}
+	}
+	if !changed {
+		return body
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func localizeField(lang Lang, doc map[string]json.RawMessage, key string) bool {
+	raw, ok := doc[key]
+	if !ok {
+		return false
+	}
+	var msg string
+	if json.Unmarshal(raw, &msg) != nil {
+		return false
+	}
+	translated := Translate(lang, msg)
+	if translated == msg {
+		return false
+	}
+	out, err := json.Marshal(translated)
+	if err != nil {
+		return false
+	}
+	doc[key] = out
+	return true
+}
+
+// template is a catalog entry with {1}, {2}... placeholders. The Chinese side
+// is compiled to a regexp; captured arguments are translated recursively and
+// substituted into the target by number, so word order may differ.
+type template struct {
+	re     *regexp.Regexp
+	order  []int // placeholder number of each capture group
+	target string
+}
+
+var placeholderRe = regexp.MustCompile(`\{(\d)\}`)
+
+func compileTemplate(zh, target string) template {
+	var pattern strings.Builder
+	var order []int
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(zh, -1) {
+		pattern.WriteString(literalPattern(zh[last:m[0]], last > 0))
+		pattern.WriteString(`(.+?)`)
+		n, _ := strconv.Atoi(zh[m[2]:m[3]])
+		order = append(order, n)
+		last = m[1]
+	}
+	pattern.WriteString(literalPattern(zh[last:], false))
+	return template{re: regexp.MustCompile(`^` + pattern.String() + `$`), order: order, target: target}
+}
+
+// literalPattern quotes s, letting spaces match any (or no) whitespace since
+// Chinese messages are written both with and without spaces around ASCII.
+// Between two placeholders the spaces are required, otherwise "{1} 的 {2}"
+// would split words like "目的".
+func literalPattern(s string, between bool) string {
+	space := `\s*`
+	if between {
+		space = `\s+`
+	}
+	parts := strings.Split(s, " ")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return strings.Join(parts, space)
+}
+
+// catalog holds the translations of one language
+type catalog struct {
+	exact     map[string]string
+	templates []template
+}
+
+func newCatalog(exact map[string]string, templates [][2]string) *catalog {
+	c := &catalog{exact: exact}
+	for _, t := range templates {
+		c.templates = append(c.templates, compileTemplate(t[0], t[1]))
+	}
+	return c
+}
+
+// separators split compound messages ("invalid report: title 不能为空；...")
+// whose parts are translated independently, tried in order
+var separators = []struct{ zh, target string }{
+	{"; ", "; "}, {"；", "; "}, {": ", ": "}, {"：", ": "}, {"，", ", "},
+}
+
+// punctuation normalizes full-width marks left in translated messages
+var punctuation = strings.NewReplacer("，", ", ", "、", ", ", "：", ": ", "；", "; ", "（", " (", "）", ")", "。", ".")
+
+func (c *catalog) translate(s string) string {
+	if s == "" || !hasHan(s) {
+		return s
+	}
+	if out, ok := c.exact[s]; ok {
+		return out
+	}
+	for _, t := range c.templates {
+		m := t.re.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		args := map[string]string{}
+		for i, n := range t.order {
+			args["{"+strconv.Itoa(n)+"}"] = c.translate(strings.TrimSpace(m[i+1]))
+		}
+		return placeholderRe.ReplaceAllStringFunc(t.target, func(p string) string { return args[p] })
+	}
+	for _, sep := range separators {
+		if head, tail, ok := strings.Cut(s, sep.zh); ok {
+			return c.translate(strings.TrimSpace(head)) + sep.target + c.translate(strings.TrimSpace(tail))
+		}
+	}
+	// "用户 42" / "嵌入主题配置 \"brand\"": translate the noun, keep the value
+	if i := strings.LastIndex(s, " "); i > 0 && !hasHan(s[i:]) {
+		return c.translate(strings.TrimSpace(s[:i])) + s[i:]
+	}
+	return s
+}
+
+var catalogs = map[Lang]*catalog{
+	EN: newCatalog(enMessages, enTemplates),
+}
+
+func hasHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// capitalize upper-cases the first letter unless the message starts with an
+// identifier such as "min_trust_level"
+func capitalize(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	if word, _, _ := strings.Cut(s, " "); strings.ContainsAny(word, "_.") {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
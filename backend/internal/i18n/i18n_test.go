@@ -0,0 +1,86 @@
+package i18n
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]Lang{
+		"":                            ZH,
+		"en-US,en;q=0.9":              EN,
+		"zh-CN,zh;q=0.9,en;q=0.8":     ZH,
+		"fr-FR, en;q=0.5":             EN,
+		"fr-FR":                       ZH,
+		"de;q=0.9, *;q=0.8, en;q=0.1": ZH,
+		"en;q=abc":                    ZH,
+	}
+	for header, want := range cases {
+		if got := Negotiate(header, ZH); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+	if got := Negotiate("", EN); got != EN {
+		t.Errorf("default must be used without a header, got %q", got)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	cases := map[string]string{
+		"登录成功":                                             "Login successful",
+		"视图已保存":                                            "View saved",
+		"GeoIP 数据库更新已开始":                                   "GeoIP database update started",
+		"用户 42 不存在":                                        "User 42 not found",
+		"无效的渠道 ID":                                         "Invalid channel ID",
+		"已处理 3 个令牌":                                        "Processed 3 tokens",
+		"expires_at 需晚于当前时间":                               "expires_at must be in the future",
+		"规则1 的 min_trust_level 需在 0-4 之间":                  "min_trust_level of 规则1 must be between 0-4",
+		"smtp_security 只能是 starttls、ssl 或 none":            "smtp_security must be one of starttls, ssl or none",
+		"invalid status page: resolved_at 不能早于 started_at": "invalid status page: resolved_at must not be earlier than started_at",
+		"invalid report: title 不能为空；days 需在 1-30 之间":       "invalid report: title is required; days must be between 1-30",
+		"Invalid request body":                             "Invalid request body",
+		"完全未收录的提示":                                         "完全未收录的提示",
+	}
+	for zh, want := range cases {
+		if got := Translate(EN, zh); got != want {
+			t.Errorf("Translate(%q) = %q, want %q", zh, got, want)
+		}
+	}
+	if got := Translate(ZH, "视图已保存"); got != "视图已保存" {
+		t.Errorf("zh must be untouched, got %q", got)
+	}
+}
+
+func TestLocalizeJSON(t *testing.T) {
+	body := []byte(`{"success":false,"error":{"code":"NOT_FOUND","message":"维护窗口不存在","details":""}}`)
+	var got struct {
+		Error struct{ Code, Message string }
+	}
+	if err := json.Unmarshal(LocalizeJSON(EN, body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Error.Code != "NOT_FOUND" || got.Error.Message != "Maintenance window not found" {
+		t.Errorf("error = %+v", got.Error)
+	}
+
+	data := []byte(`{"success":true,"message":"渠道已禁用","data":{"message":"保持原样","id":1}}`)
+	var ok struct {
+		Message string
+		Data    struct{ Message string }
+	}
+	if err := json.Unmarshal(LocalizeJSON(EN, data), &ok); err != nil {
+		t.Fatal(err)
+	}
+	if ok.Message != "Channel disabled" || ok.Data.Message != "保持原样" {
+		t.Errorf("only the top-level message is translated, got %+v", ok)
+	}
+
+	for _, raw := range []string{`[1,2]`, `{"success":true,"data":{}}`, `not json`} {
+		if out := LocalizeJSON(EN, []byte(raw)); string(out) != raw {
+			t.Errorf("LocalizeJSON(%s) = %s, want unchanged", raw, out)
+		}
+	}
+	if out := LocalizeJSON(ZH, data); string(out) != string(data) {
+		t.Errorf("zh body must be unchanged, got %s", out)
+	}
+}
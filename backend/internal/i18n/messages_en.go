@@ -0,0 +1,287 @@
+package i18n
+
+// enMessages are exact translations: complete messages, and the nouns that
+// templates capture ("视图" in "视图已保存")
+var enMessages = map[string]string{
+	// auth / common
+	"登录成功":                     "Login successful",
+	"已登出":                      "Logged out",
+	"密码错误":                     "Incorrect password",
+	"认证失败":                     "Authentication failed",
+	"请求处理超时":                   "Request timed out",
+	"服务器内部错误":                  "Internal server error",
+	"客户端错误":                    "Client error",
+	"请求参数错误":                   "Invalid request parameters",
+	"请求参数无效":                   "Invalid request parameters",
+	"保存配置失败":                   "Failed to save config",
+	"没有要保存的配置":                 "Nothing to save",
+	"已保存":                      "Saved",
+	"已处置":                      "Handled",
+	"预览完成":                     "Preview completed",
+	"清理完成":                     "Cleanup completed",
+	"通报成功":                     "Report submitted",
+	"priority 或 weight 至少提供一个": "Give at least one of priority or weight",
+	"扫描间隔必须在 1-1440 分钟之间": "The scan interval must be between 1-1440 minutes",
+	"数值超出允许范围":            "Value out of range",
+	"无法识别":                "Unrecognized",
+	"必须是字符串":              "must be a string",
+	"必须是对象":               "must be an object",
+	"必须是布尔值":              "must be a boolean",
+	"必须是数组":               "must be an array",
+	"必须是整数":               "must be an integer",
+	"元素必须是字符串":            "elements must be strings",
+	"元素必须是对象":             "elements must be objects",
+	"元素必须是整数":             "elements must be integers",
+	"统计数据暂不可用":            "Statistics are temporarily unavailable",
+	"状态数据暂不可用":            "Status data is temporarily unavailable",
+	"无法读取上传文件":            "Cannot read the uploaded file",
+	"该配置来自环境变量，修改后需重启":    "This setting comes from an environment variable; restart after changing it",
+	"配置已被其他管理员修改，请刷新后重试":  "The config was changed by another admin, refresh and try again",
+
+	// users / tokens
+	"未选择用户":                "No users selected",
+	"用户已封禁":                "User banned",
+	"用户已解封":                "User unbanned",
+	"用户已注销":                "User deactivated",
+	"用户已彻底删除":              "User permanently deleted",
+	"不能封禁管理员账号":            "Admin accounts cannot be banned",
+	"不能禁用管理员的令牌":           "Admin tokens cannot be disabled",
+	"该用户已在关注名单中":           "The user is already on the watch list",
+	"已加入关注名单":              "Added to the watch list",
+	"已取消关注":                "Removed from the watch list",
+	"额度已调整":                "Quota adjusted",
+	"必须填写调整原因":             "An adjustment reason is required",
+	"调整原因不能超过 500 字":       "The adjustment reason must be at most 500 characters",
+	"请填写原因（不超过 500 字）":     "A reason is required (at most 500 characters)",
+	"请填写误判原因（不超过 500 字）":   "A false positive reason is required (at most 500 characters)",
+	"信任等级需为 0-4":           "Trust level must be 0-4",
+	"Token 已禁用":            "Token disabled",
+	"处罚已撤销":                "Penalty revoked",
+	"已加入 IP 黑名单":           "Added to the IP blocklist",
+	"未指定目标分组":              "No target group given",
+	"自动分组功能未启用":            "Auto grouping is not enabled",
+	"无效的分组模式":              "Invalid group mode",
+	"分组名不能为空且不超过 64 个字符":   "Group name is required and at most 64 characters",
+	"分组名需为 1-64 个字符":       "Group name must be 1-64 characters",
+	"linux_do_id 不能为空":     "linux_do_id is required",
+	"无法连接到 linux.do，请稍后重试": "Cannot reach linux.do, try again later",
+	"OAuth 资料补全未开启":        "OAuth profile completion is not enabled",
+	"操作员会话不能修改脱敏配置":        "Operator sessions cannot change the masking config",
+	"无法加载脱敏密钥":             "Cannot load the masking key",
+
+	// channels / models / status
+	"渠道已启用":                                        "Channel enabled",
+	"渠道已禁用":                                        "Channel disabled",
+	"至少指定一个渠道或模型":                                  "Specify at least one channel or model",
+	"单个维护窗口最长 30 天":                                "A maintenance window may last at most 30 days",
+	"需要 starts_at < ends_at":                       "starts_at must be before ends_at",
+	"状态页未发布":                                       "The status page is not published",
+	"公开统计未启用":                                      "Public stats are not enabled",
+	"嵌入访问令牌无效":                                     "Invalid embed access token",
+	"冒烟测试未配置测试令牌或模型":                               "The smoke test has no test token or model configured",
+	"启用前需配置测试令牌与模型":                                "Configure a test token and model before enabling",
+	"数据库中找不到测试令牌":                                  "The test token was not found in the database",
+	"至少需要启用一个检查步骤":                                 "Enable at least one check step",
+	"NEWAPI_BASEURL / NEWAPI_API_KEY 未配置，无法主动探测渠道": "NEWAPI_BASEURL / NEWAPI_API_KEY are not configured, channels cannot be probed",
+	"索引建议已列出；为避免影响生产库，本接口不会自动创建重索引": "Index suggestions listed; heavy indexes are never created automatically to protect the production database",
+
+	// jobs
+	"备份或恢复正在进行中":                         "A backup or restore is already in progress",
+	"查询计划采样正在执行":                         "Query plan sampling is already running",
+	"GeoIP 数据库正在更新":                      "The GeoIP database is already updating",
+	"GeoIP 数据库加载失败":                      "Failed to load the GeoIP database",
+	"该接口不支持切换实例，仅作用于默认实例":                "This endpoint does not support instance selection and only acts on the default instance",
+	"脱敏配置加载失败，操作员会话暂不可用":                 "Masking settings failed to load; operator sessions are unavailable",
+	"操作员会话不能下载无法脱敏的文件":                   "Operator sessions cannot download files that cannot be masked",
+	"加载接口文档失败":                           "Failed to load the API description",
+	"ANALYZE 正在执行":                       "ANALYZE is already running",
+	"对象存储尚未配置":                           "Object storage is not configured",
+	"时间范围最长 31 天":                        "The time range may span at most 31 days",
+	"不能查询未来月份":                           "Future months cannot be queried",
+	"缺少 manifest.json":                   "manifest.json is missing",
+	"SMTP 服务器、发件人和收件人尚未配置":               "SMTP server, sender and recipients are not configured",
+	"SMTP 服务器、发件人和收件人填写完整后才能开启":          "Fill in the SMTP server, sender and recipients before enabling",
+	"endpoint、bucket 与访问密钥填写完整后才能开启定时归档": "Fill in endpoint, bucket and access keys before enabling scheduled archiving",
+	"请先在前端开启并填写 Hub 接入信息":                "Enable and fill in the Hub connection in the UI first",
+	"各级处罚需按 warn → rate_limit → temp_ban → permanent_ban 递进，且 min_offenses 递增": "Penalty steps must escalate warn → rate_limit → temp_ban → permanent_ban with increasing min_offenses",
+	"需满足 1 <= medium_score < high_score <= 100":                                "Requires 1 <= medium_score < high_score <= 100",
+
+	// nouns captured by templates
+	"用户":           "user",
+	"令牌":           "token",
+	"渠道":           "channel",
+	"模型":           "model",
+	"分组":           "group",
+	"日志":           "log",
+	"视图":           "view",
+	"组件":           "widget",
+	"报表":           "report",
+	"报表记录":         "report run",
+	"事件":           "incident",
+	"维护窗口":         "maintenance window",
+	"联系记录":         "contact record",
+	"关注项":          "watch entry",
+	"关注规则":         "watch rules",
+	"条目":           "entry",
+	"黑名单条目":        "blocklist entry",
+	"白名单规则":        "whitelist rule",
+	"审查记录":         "review",
+	"执行计划":         "query plan",
+	"查询计划":         "query plans",
+	"嵌入主题配置":       "embed profile",
+	"配置":           "config",
+	"配置项":          "setting",
+	"模型成本":         "model cost",
+	"成本表":          "cost table",
+	"风险权重":         "risk weights",
+	"降级规则":         "demotion rules",
+	"条件规则":         "condition rules",
+	"处罚策略":         "penalty policy",
+	"熔断策略":         "circuit breaker policy",
+	"数据保留策略":       "retention policy",
+	"数据保留清理":       "retention cleanup",
+	"日志归档":         "log archive",
+	"日志归档配置":       "log archive config",
+	"历史回填":         "history backfill",
+	"GeoIP 数据库更新":  "GeoIP database update",
+	"状态页配置":        "status page config",
+	"脱敏配置":         "masking config",
+	"探测配置":         "probe config",
+	"统计信息配置":       "statistics config",
+	"查询计划采样配置":     "query plan sampling config",
+	"注册突增监控配置":     "registration spike config",
+	"毛利告警配置":       "margin alert config",
+	"余额监控配置":       "balance monitor config",
+	"摘要邮件":         "digest email",
+	"摘要邮件配置":       "digest email config",
+	"异常检测配置":       "anomaly detection config",
+	"冒烟测试配置":       "smoke test config",
+	"公开统计配置":       "public stats config",
+	"分组额度预算":       "group quota budget",
+	"新增用户统计来源":     "new user stats source",
+	"接口 SLO 配置":    "API SLO config",
+	"接口响应时间样本":     "API latency samples",
+	"慢查询日志":        "slow query log",
+	"分析数据":         "analytics data",
+	"OAuth 资料补全配置": "OAuth profile completion config",
+	"Key 巡检配置":     "Key inspection config",
+	"IP 黑名单配置":     "IP blocklist config",
+	"IP 信誉配置":      "IP reputation config",
+	"GeoIP 更新配置":   "GeoIP update config",
+	"调整额度":         "Adjustment amount",
+	"注册来源":         "registration source",
+	"发件人":          "sender",
+	"收件人":          "recipient",
+	"邮箱域名":         "email domain",
+	"时区":           "timezone",
+	"表":            "table",
+	"文件":           "file",
+	"文件名":          "file name",
+	"备份版本":         "backup version",
+	"处罚":           "penalty",
+	"风险标签":         "risk label",
+	"规则类型":         "rule type",
+	"检查步骤":         "check step",
+	"ID":           "ID",
+}
+
+// enTemplates are tried in order after exact matches; put specific entries
+// before generic ones
+var enTemplates = [][2]string{
+	// summaries with counts
+	{"已处理 {1} 个令牌", "Processed {1} tokens"},
+	{"成功导入 {1} 个兑换码", "Imported {1} redemption codes"},
+	{"校验完成：{1} 个可导入", "Validation completed: {1} importable"},
+	{"请求被限速，请等待 {1} 秒后重试", "Rate limited, retry in {1} seconds"},
+	{"{1}，刷新前会提示预估耗时", "{1}; the estimated duration is shown before refreshing"},
+
+	// specific validation messages
+	{"审查记录 {1} 中没有用户 {2}", "review {1} has no user {2}"},
+	{"分组 {1} 开启 disable_tokens 时需设置 daily_quota", "group {1} needs daily_quota when disable_tokens is on"},
+	{"分组 {1} 需设置大于 0 的 monthly_quota 或 daily_quota", "group {1} needs a monthly_quota or daily_quota above 0"},
+	{"按 {1} 查询趋势时需指定 id", "an id is required for trends by {1}"},
+	{"维护窗口需为 HH:MM，得到 {1}", "maintenance window must be HH:MM, got {1}"},
+	{"调整额度需在 1 ~ {1} 之间（set 可为 0）", "adjustment must be between 1 ~ {1} (0 allowed for set)"},
+	{"最少次数不能为负（suspicious_min_requests 至少为 1）", "minimum count must not be negative (suspicious_min_requests at least 1)"},
+	{"{1} 不是有效的 SQLite 数据库: {2}", "{1} is not a valid SQLite database: {2}"},
+	{"{1} 校验和不匹配", "{1} checksum mismatch"},
+	{"不允许恢复的 Redis 键 {1}", "Redis key {1} cannot be restored"},
+	{"未知的检查步骤 {1}，可选 {2}", "unknown check step {1}, choose from {2}"},
+	{"未知的规则类型 {1}（可选 {2}）", "unknown rule type {1} (choose from {2})"},
+	{"未知处罚 {1}（{2}）", "unknown penalty {1} ({2})"},
+	{"{1} 的注册来源 {2} 无效", "registration source {2} of {1} is invalid"},
+	{"路由需形如 {1}", "route must look like {1}"},
+	{"渠道和模型各最多 {1} 个", "at most {1} channels and {1} models"},
+	{"{1} 与 {2} 需且仅需填一个", "give exactly one of {1} and {2}"},
+	{"{1} 与 {2} 合计需为 {3} 个", "{1} and {2} together must be {3}"},
+	{"{1} 与 {2} 只能填一个", "give only one of {1} and {2}"},
+	{"{1} 至少需要一个降级条件", "{1} needs at least one demotion condition"},
+	{"{1} 需指定 {2}", "{1} needs {2}"},
+	{"{1} 为百分比，需在 {2} 之间", "{1} is a percentage and must be between {2}"},
+	{"{1} 的目标分组不能为空且不超过 64 个字符", "target group of {1} is required and at most 64 characters"},
+	{"{1} 的目标分组不能出现在 from_groups 中", "target group of {1} must not be in from_groups"},
+	{"{1} 的目标分组不超过 64 个字符", "target group of {1} must be at most 64 characters"},
+	{"{1} 的目标需在 {2} 毫秒之间", "target of {1} must be between {2} ms"},
+	{"{1} 必填且不超过 {2} 字", "{1} is required and at most {2} characters"},
+	{"{1} 不能为空且最多 {2} 个字符", "{1} is required and at most {2} characters"},
+	{"{1} 不能为空且不超过 {2} 个字符", "{1} is required and at most {2} characters"},
+	{"{1} 需包含 {2} 级", "{1} must have {2} steps"},
+	{"{1} 需为 {2} 条", "{1} must have {2} items"},
+	{"{1} 需为 {2} 个有效用户 ID", "{1} must be {2} valid user IDs"},
+	{"{1} 格式应为 {2}", "{1} must be formatted as {2}"},
+	{"{1} 仅支持 {2}", "{1} only supports {2}"},
+	{"txt 格式仅包含兑换码，不支持脱敏导出", "txt exports contain codes only and cannot be masked"},
+
+	// generic shapes
+	{"{1} 不存在", "{1} not found"},
+	{"{1} 重复", "duplicate {1}"},
+	{"无效的 {1}", "invalid {1}"},
+	{"未知的 {1}", "unknown {1}"},
+	{"未知{1}", "unknown {1}"},
+	{"非法{1}", "invalid {1}"},
+	{"不支持的 {1}", "unsupported {1}"},
+	{"无法识别的 {1}", "unrecognized {1}"},
+	{"缺少 {1}", "missing {1}"},
+	{"最多 {1} 个模型", "at most {1} models"},
+	{"最多 {1} 条规则", "at most {1} rules"},
+	{"最多 {1} 条降级规则", "at most {1} demotion rules"},
+	{"{1} 最多 {2} 个镜像", "{1} allows at most {2} mirrors"},
+	{"{1} 最多 {2} 个字符", "{1} must be at most {2} characters"},
+	{"{1} 不超过 {2} 字", "{1} must be at most {2} characters"},
+	{"{1} 需为 {2} 个字符", "{1} must be {2} characters"},
+	{"{1} 需在 {2} 之间", "{1} must be between {2}"},
+	{"{1} 只能是 {2}", "{1} must be one of {2}"},
+	{"{1} 必须是规则数组", "{1} must be an array of rules"},
+	{"{1} 必须是正整数", "{1} must be a positive integer"},
+	{"{1} 需为 http(s) 地址", "{1} must be an http(s) URL"},
+	{"{1} 必须是 http(s) 地址", "{1} must be an http(s) URL"},
+	{"{1} 不能为空", "{1} is required"},
+	{"{1} 无效", "{1} is invalid"},
+	{"{1} 不能为负数", "{1} must not be negative"},
+	{"{1} 不能为负", "{1} must not be negative"},
+	{"{1} 至少为 {2}", "{1} must be at least {2}"},
+	{"{1} 不能早于 {2}", "{1} must not be earlier than {2}"},
+	{"{1} 不能晚于 {2}", "{1} must not be later than {2}"},
+	{"{1} 需晚于当前时间", "{1} must be in the future"},
+	{"{1} 不能是未来时间", "{1} must not be in the future"},
+	{"{1} 正在进行中", "{1} is already in progress"},
+	{"{1} 正在执行", "{1} is already running"},
+	{"{1} 未启用", "{1} is not enabled"},
+	{"{1} 加载失败", "failed to load {1}"},
+	{"{1} 的 {2}", "{2} of {1}"},
+	{"{1} 或 {2}", "{1} or {2}"},
+
+	// action summaries
+	{"{1} 已保存并生效", "{1} saved and applied"},
+	{"{1} 已重新加载", "{1} reloaded"},
+	{"{1} 已保存", "{1} saved"},
+	{"{1} 已更新", "{1} updated"},
+	{"{1} 已删除", "{1} deleted"},
+	{"{1} 已创建", "{1} created"},
+	{"{1} 已发布", "{1} published"},
+	{"{1} 已开始", "{1} started"},
+	{"{1} 已清空", "{1} cleared"},
+	{"{1} 已重置", "{1} reset"},
+	{"{1} 已列出", "{1} listed"},
+	{"{1} 已发送", "{1} sent"},
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// auditMaxBodyRead bounds how much of a request body is buffered for auditing.
+const auditMaxBodyRead = 64 * 1024
+
+// auditSkipPrefixes are write endpoints that are not admin actions
+// (login carries a password and is already covered by the auth log).
+var auditSkipPrefixes = []string{
+	"/api/auth/",
+}
+
+// AuditMiddleware records every mutating /api request (POST/PUT/PATCH/DELETE)
+// into the local audit trail: operator, target instance, endpoint, payload
+// summary and result. Must be installed after auth.AuthMiddleware so operator
+// info is available; the instance is read after the handler ran, so it may sit
+// before InstanceMiddleware and still audit the requests that one rejects.
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		path := config.StripBasePath(c.Request.URL.Path)
+		for _, prefix := range auditSkipPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, auditMaxBodyRead))
+			rest := c.Request.Body
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), rest))
+		}
+
+		start := time.Now()
+		c.Next()
+
+		// Requests rejected by auth never reached a handler.
+		if c.Writer.Status() == http.StatusUnauthorized {
+			return
+		}
+
+		authMethod := c.GetString("auth_method")
+		operator := c.GetString("user_sub")
+		if operator == "" {
+			operator = authMethod
+		}
+		status := c.Writer.Status()
+		entry := service.AuditLogEntry{
+			Operator:   operator,
+			AuthMethod: authMethod,
+			Instance:   auditInstance(c),
+			Method:     method,
+			Path:       path,
+			Query:      c.Request.URL.RawQuery,
+			Payload:    service.SummarizeAuditPayload(body),
+			Detail:     c.GetString(service.AuditDetailContextKey),
+			StatusCode: status,
+			Success:    status < 400,
+			ClientIP:   c.ClientIP(),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := service.NewAuditLogService().Record(ctx, entry); err != nil {
+			logger.L.Warn("[审计] 写入审计日志失败: " + err.Error())
+		}
+	}
+}
+
+// auditInstance is the instance a write went to: the one InstanceMiddleware
+// resolved, or the requested name when it rejected the request
+func auditInstance(c *gin.Context) string {
+	name := c.GetString("instance")
+	if _, resolved := c.Get("instance"); !resolved {
+		name = strings.TrimSpace(c.GetHeader("X-Instance"))
+		if name == "" {
+			name = strings.TrimSpace(c.Query("instance"))
+		}
+	}
+	if name == "" {
+		return database.DefaultInstance
+	}
+	return name
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+func TestAuditMiddlewareRecordsTargetInstance(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	// same order as cmd/server: audit before the instance selector
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", AuditMiddleware(), InstanceMiddleware(func(string) bool { return true }))
+	api.POST("/users/:user_id/ban", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"success": true}) })
+
+	send := func(instance string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/7/ban", nil)
+		if instance != "" {
+			req.Header.Set("X-Instance", instance)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := send(""); code != http.StatusOK {
+		t.Fatalf("default instance write: %d", code)
+	}
+	// "eu" is not registered, so InstanceMiddleware rejects it after the audit hook
+	if code := send("eu"); code != http.StatusBadRequest {
+		t.Fatalf("unknown instance write: %d", code)
+	}
+
+	svc := service.NewAuditLogService()
+	for instance, wantSuccess := range map[string]bool{"default": true, "eu": false} {
+		data, err := svc.ListAuditLogs(context.Background(), service.AuditLogQuery{Page: 1, PageSize: 10, Instance: instance})
+		if err != nil {
+			t.Fatalf("ListAuditLogs: %v", err)
+		}
+		items := data["items"].([]service.AuditLogEntry)
+		if len(items) != 1 || items[0].Path != "/api/users/7/ban" || items[0].Success != wantSuccess {
+			t.Fatalf("instance %s: unexpected entries %+v", instance, items)
+		}
+	}
+}
@@ -16,8 +16,8 @@ func CORSMiddleware() gin.HandlerFunc {
 			return true // Allow all origins dynamically
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Data-Masking"},
+		ExposeHeaders:    []string{"Content-Length", "X-Data-Masking"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	})
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/i18n"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// LocalizationMiddleware negotiates the response language from
+// Accept-Language (DEFAULT_LANGUAGE when absent or unsupported) and, for
+// languages other than the Chinese source, translates the "message" and
+// "error.message" fields of JSON responses. Non-JSON responses (exports,
+// event streams, HTML) pass through unbuffered.
+func LocalizationMiddleware() gin.HandlerFunc {
+	def, ok := i18n.Parse(config.Get().DefaultLanguage)
+	if !ok {
+		logger.L.Warn("DEFAULT_LANGUAGE 无效（可选 zh / en），使用 zh: " + config.Get().DefaultLanguage)
+		def = i18n.ZH
+	}
+	return func(c *gin.Context) {
+		lang := i18n.Negotiate(c.GetHeader("Accept-Language"), def)
+		c.Set(i18n.ContextKey, lang)
+		c.Header("Content-Language", string(lang))
+		if lang == i18n.ZH {
+			c.Next()
+			return
+		}
+
+		orig := c.Writer
+		w := &localizingWriter{ResponseWriter: orig}
+		c.Writer = w
+		c.Next()
+		c.Writer = orig
+
+		if w.passthrough || (w.status == 0 && w.body.Len() == 0) {
+			return
+		}
+		body := i18n.LocalizeJSON(lang, w.body.Bytes())
+		orig.Header().Del("Content-Length")
+		if w.status != 0 {
+			orig.WriteHeader(w.status)
+		}
+		_, _ = orig.Write(body)
+	}
+}
+
+// localizingWriter buffers JSON responses so their messages can be
+// translated; anything else is forwarded as soon as it is written.
+type localizingWriter struct {
+	gin.ResponseWriter
+	status      int
+	passthrough bool
+	decided     bool
+	body        bytes.Buffer
+}
+
+// decide picks buffering or passthrough once the handler has set its headers
+func (w *localizingWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if !strings.HasPrefix(w.ResponseWriter.Header().Get("Content-Type"), "application/json") {
+		w.passthrough = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+}
+
+func (w *localizingWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *localizingWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *localizingWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *localizingWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+func (w *localizingWriter) Flush() {
+	w.decide()
+	if w.passthrough {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *localizingWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func (w *localizingWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. for the
+// write deadline of event streams
+func (w *localizingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *localizingWriter) Status() int {
+	if w.passthrough || w.status == 0 {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
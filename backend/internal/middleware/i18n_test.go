@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+// serveEventStream runs an SSE-style handler behind mw on a real server and
+// returns the error of lifting the write deadline, as handler.StreamEvents does
+func serveEventStream(t *testing.T, mw ...gin.HandlerFunc) (body string, deadlineErr error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw...)
+	r.GET("/api/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		deadlineErr = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+		c.Status(http.StatusOK)
+		_, _ = io.WriteString(c.Writer, "retry: 5000\n\n")
+		c.Writer.Flush()
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/events", nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events: %v", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return string(raw), deadlineErr
+}
+
+func TestLocalizationMiddlewareKeepsEventStreamDeadlineControl(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	body, err := serveEventStream(t, LocalizationMiddleware())
+	if err != nil {
+		t.Fatalf("SetWriteDeadline through localizingWriter: %v", err)
+	}
+	if !strings.Contains(body, "retry: 5000") {
+		t.Fatalf("event stream should pass through untranslated, got %q", body)
+	}
+}
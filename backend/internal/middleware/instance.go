@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/models"
+)
+
+// InstanceMiddleware resolves the target New API instance from the
+// X-Instance header or ?instance= query and stores it as "instance".
+// Unknown or unavailable instances are rejected with 400, and so is any
+// non-default instance sent to a route whose handler is not instance-aware
+// (supported is called with the matched handler name).
+func InstanceMiddleware(supported func(handlerName string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.GetHeader("X-Instance"))
+		if name == "" {
+			name = strings.TrimSpace(c.Query("instance"))
+		}
+		if name == database.DefaultInstance {
+			name = ""
+		}
+		if name != "" && !supported(c.HandlerName()) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResp("INVALID_INSTANCE", "该接口不支持切换实例，仅作用于默认实例", ""))
+			return
+		}
+		if !database.HasInstance(name) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResp("INVALID_INSTANCE", "Unknown or unavailable instance: "+name, ""))
+			return
+		}
+		c.Set("instance", name)
+		c.Next()
+	}
+}
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
 	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/service"
 )
 
 // RequestLoggerMiddleware logs all API requests
@@ -12,7 +15,7 @@ import (
 func RequestLoggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip logging for health check endpoints
-		path := c.Request.URL.Path
+		path := config.StripBasePath(c.Request.URL.Path)
 		if path == "/api/health" || path == "/api/health/db" {
 			c.Next()
 			return
@@ -29,6 +32,13 @@ func RequestLoggerMiddleware() gin.HandlerFunc {
 		statusCode := c.Writer.Status()
 		method := c.Request.Method
 
+		// SLO tracking; streams and exports have no deadline and no meaningful latency
+		if strings.HasPrefix(path, "/api/") && routeTimeout(path, time.Second) > 0 {
+			if route := c.FullPath(); route != "" {
+				service.RecordEndpointLatency(method, config.StripBasePath(route), duration, statusCode)
+			}
+		}
+
 		// Log based on status code (matching Python's behavior)
 		switch {
 		case statusCode >= 500:
@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/auth"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/models"
+	"github.com/new-api-tools/backend/internal/service"
+)
+
+// maskedPrefixes are the endpoints whose responses carry user emails and
+// client IPs; they are masked when masking is enabled globally or requested
+// with X-Data-Masking
+var maskedPrefixes = []string{
+	"/api/users",
+	"/api/risk",
+	"/api/ip",
+	"/api/search",
+	"/api/logs",
+}
+
+// operatorUnmaskedPrefixes are the only /api endpoints an operator session is
+// served unmasked; everything else is masked, so new endpoints are covered
+// without being listed here
+var operatorUnmaskedPrefixes = []string{
+	"/api/auth/",
+}
+
+// DataMaskingContextKey is set to true on requests whose response is masked
+const DataMaskingContextKey = "data_masking"
+
+const dataMaskerContextKey = "data_masker"
+
+// DataMaskingMiddleware redacts emails and IPs in JSON responses. Operator
+// logins are masked on every endpoint except operatorUnmaskedPrefixes, and
+// their file downloads (CSV, archives, HTML previews) are refused because
+// they cannot be masked; event streams are masked by the handler through
+// ResponseMasker. Other sessions are masked on the user, risk, IP, search and
+// log search endpoints when masking is enabled globally or the request sends
+// X-Data-Masking: on (the frontend toggle for screen sharing). Must be
+// installed after auth.AuthMiddleware.
+func DataMaskingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := config.StripBasePath(c.Request.URL.Path)
+		operator := c.GetString("user_sub") == auth.SubjectOperator
+		var matched bool
+		if operator {
+			matched = !hasPrefix(path, operatorUnmaskedPrefixes)
+		} else {
+			matched = hasPrefix(path, maskedPrefixes)
+		}
+		if !matched {
+			c.Next()
+			return
+		}
+
+		settings, masker, err := service.CurrentDataMasking(c.Request.Context())
+		if err != nil {
+			logger.L.Warn("[脱敏] 加载配置失败: " + err.Error())
+		}
+		if masker == nil && operator {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, models.ErrorResp("MASKING_UNAVAILABLE", "脱敏配置加载失败，操作员会话暂不可用", ""))
+			return
+		}
+		if masker == nil || !(settings.Enabled || MaskingRequested(c)) {
+			c.Next()
+			return
+		}
+
+		c.Set(DataMaskingContextKey, true)
+		c.Set(dataMaskerContextKey, masker)
+		orig := c.Writer
+		w := &maskingWriter{ResponseWriter: orig, refuseFiles: operator}
+		c.Writer = w
+		c.Next()
+		c.Writer = orig
+
+		if w.passthrough || (w.status == 0 && w.body.Len() == 0) {
+			return
+		}
+		body := w.body.Bytes()
+		if w.refused {
+			body, _ = json.Marshal(models.ErrorResp("MASKING_REQUIRED", "操作员会话不能下载无法脱敏的文件", ""))
+			orig.Header().Set("Content-Type", "application/json; charset=utf-8")
+			orig.Header().Del("Content-Disposition")
+			w.status = http.StatusForbidden
+		} else if strings.HasPrefix(orig.Header().Get("Content-Type"), "application/json") {
+			body = masker.MaskJSON(body)
+		}
+		orig.Header().Del("Content-Length")
+		orig.Header().Set("X-Data-Masking", "on")
+		if w.status != 0 {
+			orig.WriteHeader(w.status)
+		}
+		_, _ = orig.Write(body)
+	}
+}
+
+// ResponseMasker returns the masker of a masked request, nil otherwise.
+// Streaming handlers use it to mask what they write themselves.
+func ResponseMasker(c *gin.Context) *service.DataMasker {
+	if m, ok := c.Get(dataMaskerContextKey); ok {
+		return m.(*service.DataMasker)
+	}
+	return nil
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskingRequested reports whether the session or request asks for masked
+// data regardless of the global setting
+func MaskingRequested(c *gin.Context) bool {
+	if c.GetString("user_sub") == auth.SubjectOperator {
+		return true
+	}
+	switch strings.ToLower(c.GetHeader("X-Data-Masking")) {
+	case "1", "true", "on":
+		return true
+	}
+	return false
+}
+
+// maskingWriter buffers the response so it can be masked as a whole. Event
+// streams pass through (see ResponseMasker); other non-JSON bodies are
+// buffered as before, or dropped when refuseFiles is set.
+type maskingWriter struct {
+	gin.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	refuseFiles bool
+	decided     bool
+	passthrough bool
+	refused     bool
+}
+
+// decide picks buffering, passthrough or refusal once the handler has set its headers
+func (w *maskingWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	ct := w.ResponseWriter.Header().Get("Content-Type")
+	switch {
+	case strings.HasPrefix(ct, "application/json"):
+	case strings.HasPrefix(ct, "text/event-stream"):
+		w.passthrough = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	default:
+		w.refused = w.refuseFiles
+	}
+}
+
+func (w *maskingWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *maskingWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *maskingWriter) Write(b []byte) (int, error) {
+	w.decide()
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	case w.refused:
+		return len(b), nil
+	}
+	return w.body.Write(b)
+}
+
+func (w *maskingWriter) WriteString(s string) (int, error) {
+	w.decide()
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.WriteString(s)
+	case w.refused:
+		return len(s), nil
+	}
+	return w.body.WriteString(s)
+}
+
+func (w *maskingWriter) Flush() {
+	w.decide()
+	if w.passthrough {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *maskingWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+	return w.status != 0 || w.body.Len() > 0 || w.refused
+}
+
+func (w *maskingWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. for the
+// write deadline of event streams
+func (w *maskingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *maskingWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return 200
+	}
+	return w.status
+}
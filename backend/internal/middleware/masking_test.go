@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/auth"
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestDataMaskingMiddlewareKeepsEventStreamDeadlineControl(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	var masked bool
+	operator := func(c *gin.Context) { c.Set("user_sub", auth.SubjectOperator) }
+	recordMasking := func(c *gin.Context) { masked = c.GetBool(DataMaskingContextKey) }
+
+	body, err := serveEventStream(t, operator, DataMaskingMiddleware(), recordMasking)
+	if !masked {
+		t.Fatalf("operator event stream should go through the masking writer")
+	}
+	if err != nil {
+		t.Fatalf("SetWriteDeadline through maskingWriter: %v", err)
+	}
+	if !strings.Contains(body, "retry: 5000") {
+		t.Fatalf("event stream should pass through, got %q", body)
+	}
+}
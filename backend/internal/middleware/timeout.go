@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/models"
+)
+
+// routeTimeouts overrides the default request timeout by path prefix
+// (first match wins). 0 means no deadline: streams, exports and
+// backup/restore run as long as the client stays connected.
+var routeTimeouts = []struct {
+	prefix  string
+	timeout time.Duration
+}{
+	{"/api/events", 0},
+	{"/api/system/backup", 0},
+	{"/api/system/restore", 0},
+	{"/api/system/db-stats/analyze", 10 * time.Minute},
+	{"/api/system/query-plans/run", 10 * time.Minute},
+	{"/api/ai-ban/simulate", 5 * time.Minute},
+	{"/api/top-ups/export", 0},
+	{"/api/redemptions/export", 0},
+	{"/api/redemptions/import", 0},
+}
+
+// RequestTimeout bounds every request with a context deadline. Services take
+// the request context, so once it expires (or the client disconnects) their
+// in-flight database queries are cancelled. A handler that fails because of
+// the deadline answers 504 instead of 500. def <= 0 disables the default.
+func RequestTimeout(def time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := routeTimeout(config.StripBasePath(c.Request.URL.Path), def)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, models.ErrorResp("TIMEOUT", "请求处理超时", ""))
+		}
+	}
+}
+
+func routeTimeout(path string, def time.Duration) time.Duration {
+	for _, rt := range routeTimeouts {
+		if strings.HasPrefix(path, rt.prefix) {
+			return rt.timeout
+		}
+	}
+	return def
+}
+
+// timeoutWriter turns the 500 a handler writes after its query was cut off
+// by the deadline into a 504, keeping the handler's error body.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code == http.StatusInternalServerError && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // SuccessResponse is the standard success response format
@@ -13,18 +15,11 @@ type SuccessResponse struct {
 	Message string      `json:"message,omitempty"`
 }
 
-// ErrorDetail holds the error detail structure
-type ErrorDetail struct {
-	Code    string      `json:"code"`
-	Message string      `json:"message"`
-	Details interface{} `json:"details,omitempty"`
-}
-
 // ErrorResponse is the standard error response format
 // Matches Python: {"success": false, "error": {"code": "...", "message": "...", "details": ...}}
 type ErrorResponse struct {
-	Success bool        `json:"success"`
-	Error   ErrorDetail `json:"error"`
+	Success bool            `json:"success"`
+	Error   api.ErrorDetail `json:"error"`
 }
 
 // PaginatedResponse wraps paginated data
@@ -51,19 +46,6 @@ type DatabaseHealthResponse struct {
 	Database string `json:"database,omitempty"`
 }
 
-// LoginRequest matches Python's LoginRequest
-type LoginRequest struct {
-	Password string `json:"password" binding:"required"`
-}
-
-// LoginResponse matches Python's LoginResponse
-type LoginResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
-	Token     string `json:"token,omitempty"`
-	ExpiresAt string `json:"expires_at,omitempty"`
-}
-
 // LogoutResponse matches Python's LogoutResponse
 type LogoutResponse struct {
 	Success bool   `json:"success"`
@@ -111,7 +93,7 @@ func NewSuccessMessageResponse(message string) SuccessResponse {
 func NewErrorResponse(code, message string, details ...interface{}) ErrorResponse {
 	resp := ErrorResponse{
 		Success: false,
-		Error: ErrorDetail{
+		Error: api.ErrorDetail{
 			Code:    code,
 			Message: message,
 		},
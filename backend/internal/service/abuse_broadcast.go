@@ -20,6 +20,7 @@ import (
 
 	"github.com/new-api-tools/backend/internal/config"
 	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/pkg/api"
 
 	_ "modernc.org/sqlite"
 )
@@ -608,7 +609,7 @@ func (s *AbuseBroadcastService) ReportUser(ctx context.Context, req AbuseBroadca
 	}
 	requestJSON, _ := json.Marshal(createReq)
 
-	user := mapFromInterface(analysis["user"])
+	user := analysis.User
 	now := time.Now().Unix()
 	localReportID := "local_" + randomAbuseHex(10)
 	result.LocalReportID = localReportID
@@ -625,8 +626,8 @@ func (s *AbuseBroadcastService) ReportUser(ctx context.Context, req AbuseBroadca
 	if err := insertOutgoingReport(ctx, db, AbuseBroadcastOutgoingReport{
 		LocalReportID: localReportID,
 		LocalUserID:   req.UserID,
-		Username:      toString(user["username"]),
-		DisplayName:   toString(user["display_name"]),
+		Username:      user.Username,
+		DisplayName:   user.DisplayName,
 		Reason:        reason,
 		Severity:      severity,
 		Status:        "pending",
@@ -1414,18 +1415,17 @@ func evidenceSummaryString(value interface{}) string {
 	}
 }
 
-func buildHubReportIdentities(analysis map[string]interface{}) []hubReportIdentity {
+func buildHubReportIdentities(analysis *api.UserAnalysis) []hubReportIdentity {
 	identities := make([]hubReportIdentity, 0, defaultAbuseReportTopIPLimit+1)
-	user := mapFromInterface(analysis["user"])
 	seen := map[string]struct{}{}
-	if linuxDoID := strings.TrimSpace(toString(user["linux_do_id"])); linuxDoID != "" {
+	if linuxDoID := strings.TrimSpace(analysis.User.LinuxDoID); linuxDoID != "" {
 		identities = appendHubIdentity(identities, seen, "linuxdo_id", linuxDoID, 95)
 	}
-	for _, row := range sliceOfMaps(analysis["top_ips"]) {
+	for _, row := range analysis.TopIPs {
 		if len(identities) >= defaultAbuseReportTopIPLimit+1 {
 			break
 		}
-		ip := strings.TrimSpace(toString(row["ip"]))
+		ip := strings.TrimSpace(row.IP)
 		if ip == "" {
 			continue
 		}
@@ -1448,27 +1448,31 @@ func appendHubIdentity(identities []hubReportIdentity, seen map[string]struct{},
 	})
 }
 
-func buildAbuseEvidenceSummary(analysis map[string]interface{}, window string) map[string]interface{} {
-	user := mapFromInterface(analysis["user"])
+func buildAbuseEvidenceSummary(analysis *api.UserAnalysis, window string) map[string]interface{} {
+	user := analysis.User
+	topIPs := analysis.TopIPs
+	if len(topIPs) > defaultAbuseReportTopIPLimit {
+		topIPs = topIPs[:defaultAbuseReportTopIPLimit]
+	}
 	return map[string]interface{}{
-		"range":  analysis["range"],
+		"range":  analysis.Range,
 		"window": window,
 		"user": map[string]interface{}{
-			"id":           user["id"],
-			"username":     user["username"],
-			"display_name": user["display_name"],
-			"status":       user["status"],
-			"group":        user["group"],
-			"linux_do_id":  user["linux_do_id"],
+			"id":           user.ID,
+			"username":     user.Username,
+			"display_name": user.DisplayName,
+			"status":       user.Status,
+			"group":        user.Group,
+			"linux_do_id":  user.LinuxDoID,
 		},
-		"summary":     analysis["summary"],
-		"risk":        analysis["risk"],
-		"top_ips":     limitMaps(sliceOfMaps(analysis["top_ips"]), defaultAbuseReportTopIPLimit),
-		"recent_logs": sanitizeRecentLogs(sliceOfMaps(analysis["recent_logs"]), defaultAbuseReportRecentLogLimit),
+		"summary":     analysis.Summary,
+		"risk":        analysis.Risk,
+		"top_ips":     topIPs,
+		"recent_logs": sanitizeRecentLogs(analysis.RecentLogs, defaultAbuseReportRecentLogLimit),
 	}
 }
 
-func sanitizeRecentLogs(rows []map[string]interface{}, limit int) []map[string]interface{} {
+func sanitizeRecentLogs(rows []api.UserRecentLog, limit int) []map[string]interface{} {
 	if limit <= 0 || len(rows) == 0 {
 		return []map[string]interface{}{}
 	}
@@ -1478,61 +1482,22 @@ func sanitizeRecentLogs(rows []map[string]interface{}, limit int) []map[string]i
 	result := make([]map[string]interface{}, 0, len(rows))
 	for _, row := range rows {
 		result = append(result, map[string]interface{}{
-			"id":                row["id"],
-			"created_at":        row["created_at"],
-			"type":              row["type"],
-			"model_name":        row["model_name"],
-			"quota":             row["quota"],
-			"prompt_tokens":     row["prompt_tokens"],
-			"completion_tokens": row["completion_tokens"],
-			"use_time":          row["use_time"],
-			"ip":                row["ip"],
-			"channel_name":      row["channel_name"],
-			"token_name":        row["token_name"],
+			"id":                row.ID,
+			"created_at":        row.CreatedAt,
+			"type":              row.Type,
+			"model_name":        row.ModelName,
+			"quota":             row.Quota,
+			"prompt_tokens":     row.PromptTokens,
+			"completion_tokens": row.CompletionTokens,
+			"use_time":          row.UseTime,
+			"ip":                row.IP,
+			"channel_name":      row.ChannelName,
+			"token_name":        row.TokenName,
 		})
 	}
 	return result
 }
 
-func limitMaps(rows []map[string]interface{}, limit int) []map[string]interface{} {
-	if limit <= 0 || len(rows) == 0 {
-		return []map[string]interface{}{}
-	}
-	if len(rows) <= limit {
-		return rows
-	}
-	return rows[:limit]
-}
-
-func mapFromInterface(value interface{}) map[string]interface{} {
-	if value == nil {
-		return map[string]interface{}{}
-	}
-	if m, ok := value.(map[string]interface{}); ok {
-		return m
-	}
-	return map[string]interface{}{}
-}
-
-func sliceOfMaps(value interface{}) []map[string]interface{} {
-	if value == nil {
-		return []map[string]interface{}{}
-	}
-	if rows, ok := value.([]map[string]interface{}); ok {
-		return rows
-	}
-	if rawRows, ok := value.([]interface{}); ok {
-		rows := make([]map[string]interface{}, 0, len(rawRows))
-		for _, raw := range rawRows {
-			if row, ok := raw.(map[string]interface{}); ok {
-				rows = append(rows, row)
-			}
-		}
-		return rows
-	}
-	return []map[string]interface{}{}
-}
-
 func upsertMatchedUser(matched map[int64]*AbuseBroadcastMatchedUser, userID int64) *AbuseBroadcastMatchedUser {
 	user := matched[userID]
 	if user == nil {
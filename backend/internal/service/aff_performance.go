@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// AffPerformanceRow 是一个邀请码（邀请人的 aff_code）带来的被邀请用户表现
+type AffPerformanceRow struct {
+	InviterID       int64   `db:"inviter_id" json:"inviter_id"`
+	AffCode         *string `db:"aff_code" json:"aff_code"`
+	InviterUsername *string `db:"inviter_username" json:"inviter_username"`
+	Signups         int64   `db:"signups" json:"signups"`                 // 被邀请用户数（含已删除）
+	Activated       int64   `db:"activated" json:"activated"`             // 至少发起过一次请求的被邀请用户
+	ActivationRate  float64 `db:"activation_rate" json:"activation_rate"` // activated / signups
+	QuotaUsed       int64   `db:"quota_used" json:"quota_used"`           // 被邀请用户累计消耗额度
+	TopUpCount      int64   `db:"topup_count" json:"topup_count"`         // 被邀请用户成功充值笔数
+	TopUpMoney      float64 `db:"topup_money" json:"topup_money"`         // 被邀请用户成功充值金额
+	RedeemedCount   int64   `db:"redeemed_count" json:"redeemed_count"`   // 被邀请用户使用的兑换码数
+	RedeemedQuota   int64   `db:"redeemed_quota" json:"redeemed_quota"`   // 被邀请用户兑换的额度
+	Banned          int64   `db:"banned" json:"banned"`                   // 被禁用（status = 2）的被邀请用户
+	BanRate         float64 `db:"ban_rate" json:"ban_rate"`               // banned / signups
+}
+
+// AffPerformanceParams 列表查询参数
+type AffPerformanceParams struct {
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	Search     string `json:"search"` // 匹配邀请码或邀请人用户名
+	MinSignups int64  `json:"min_signups"`
+	SortBy     string `json:"sort_by"`
+	SortDir    string `json:"sort_dir"`
+}
+
+// AffPerformanceSummary 汇总卡片数据，口径与列表一致
+type AffPerformanceSummary struct {
+	TotalCodes     int64   `db:"total_codes" json:"total_codes"`
+	TotalSignups   int64   `db:"total_signups" json:"total_signups"`
+	TotalActivated int64   `db:"total_activated" json:"total_activated"`
+	TotalQuotaUsed int64   `db:"total_quota_used" json:"total_quota_used"`
+	TotalTopUp     float64 `db:"total_topup_money" json:"total_topup_money"`
+	TotalRedeemed  int64   `db:"total_redeemed_quota" json:"total_redeemed_quota"`
+	TotalBanned    int64   `db:"total_banned" json:"total_banned"`
+	ActivationRate float64 `json:"activation_rate"`
+	BanRate        float64 `json:"ban_rate"`
+}
+
+// PaginatedAffPerformance 列表分页响应
+type PaginatedAffPerformance struct {
+	Items      []AffPerformanceRow   `json:"items"`
+	Summary    AffPerformanceSummary `json:"summary"`
+	Total      int64                 `json:"total"`
+	Page       int                   `json:"page"`
+	PageSize   int                   `json:"page_size"`
+	TotalPages int                   `json:"total_pages"`
+}
+
+// affPerformanceSortColumn 把前端 sort_by 映射成安全的列引用，未知输入回退到注册数
+func affPerformanceSortColumn(sortBy string) string {
+	switch sortBy {
+	case "activated", "activation_rate", "quota_used", "topup_count", "topup_money",
+		"redeemed_count", "redeemed_quota", "banned", "ban_rate":
+		return sortBy
+	default:
+		return "signups"
+	}
+}
+
+// affPerformanceSQL 返回按邀请人聚合的子查询与其参数。users 表没有 created_at，
+// 因此统计口径是全量历史，不按注册时间过滤。
+func affPerformanceSQL(db *database.Manager, params AffPerformanceParams) (string, []interface{}) {
+	where := []string{"1=1"}
+	args := []interface{}{"success"}
+	argIdx := 2
+	if params.Search != "" {
+		like := "%" + params.Search + "%"
+		where = append(where, fmt.Sprintf("(iu.aff_code LIKE %s OR iu.username LIKE %s)",
+			db.Placeholder(argIdx), db.Placeholder(argIdx+1)))
+		args = append(args, like, like)
+		argIdx += 2
+	}
+	if params.MinSignups > 0 {
+		where = append(where, "s.signups >= "+db.Placeholder(argIdx))
+		args = append(args, params.MinSignups)
+	}
+
+	// 比率在 SQL 中计算，使其可以排序；* 1.0 避免各数据库的整数除法
+	query := fmt.Sprintf(`
+		SELECT s.inviter_id,
+		       iu.aff_code                     AS aff_code,
+		       iu.username                     AS inviter_username,
+		       s.signups,
+		       s.activated,
+		       s.activated * 1.0 / s.signups   AS activation_rate,
+		       s.quota_used,
+		       COALESCE(t.topup_count, 0)      AS topup_count,
+		       COALESCE(t.topup_money, 0)      AS topup_money,
+		       COALESCE(r.redeemed_count, 0)   AS redeemed_count,
+		       COALESCE(r.redeemed_quota, 0)   AS redeemed_quota,
+		       s.banned,
+		       s.banned * 1.0 / s.signups      AS ban_rate
+		FROM (
+			SELECT inviter_id,
+			       COUNT(*) AS signups,
+			       SUM(CASE WHEN request_count > 0 THEN 1 ELSE 0 END) AS activated,
+			       COALESCE(SUM(used_quota), 0) AS quota_used,
+			       SUM(CASE WHEN status = 2 THEN 1 ELSE 0 END) AS banned
+			FROM users
+			WHERE inviter_id IS NOT NULL AND inviter_id > 0
+			GROUP BY inviter_id
+		) s
+		LEFT JOIN (
+			SELECT u.inviter_id,
+			       COUNT(t.id) AS topup_count,
+			       COALESCE(SUM(t.money), 0) AS topup_money
+			FROM top_ups t
+			JOIN users u ON u.id = t.user_id
+			WHERE t.status = %s AND u.inviter_id > 0
+			GROUP BY u.inviter_id
+		) t ON t.inviter_id = s.inviter_id
+		LEFT JOIN (
+			SELECT u.inviter_id,
+			       COUNT(r.id) AS redeemed_count,
+			       COALESCE(SUM(r.quota), 0) AS redeemed_quota
+			FROM redemptions r
+			JOIN users u ON u.id = r.used_user_id
+			WHERE r.redeemed_time > 0 AND u.inviter_id > 0
+			GROUP BY u.inviter_id
+		) r ON r.inviter_id = s.inviter_id
+		LEFT JOIN users iu ON iu.id = s.inviter_id
+		WHERE %s`, db.Placeholder(1), strings.Join(where, " AND "))
+	return query, args
+}
+
+// ListAffPerformance 按邀请码聚合注册数、激活率、消耗额度、充值/兑换收入与封禁率
+func ListAffPerformance(ctx context.Context, params AffPerformanceParams) (*PaginatedAffPerformance, error) {
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	if params.PageSize < 1 || params.PageSize > 100 {
+		params.PageSize = 20
+	}
+
+	db := database.GetRead().WithContext(ctx)
+	baseSQL, args := affPerformanceSQL(db, params)
+
+	var summary AffPerformanceSummary
+	summarySQL := fmt.Sprintf(`
+		SELECT COUNT(*)                           AS total_codes,
+		       COALESCE(SUM(a.signups), 0)        AS total_signups,
+		       COALESCE(SUM(a.activated), 0)      AS total_activated,
+		       COALESCE(SUM(a.quota_used), 0)     AS total_quota_used,
+		       COALESCE(SUM(a.topup_money), 0)    AS total_topup_money,
+		       COALESCE(SUM(a.redeemed_quota), 0) AS total_redeemed_quota,
+		       COALESCE(SUM(a.banned), 0)         AS total_banned
+		FROM (%s) a`, baseSQL)
+	if err := db.DB.GetContext(ctx, &summary, summarySQL, args...); err != nil {
+		return nil, fmt.Errorf("query aff performance summary failed: %w", err)
+	}
+	if summary.TotalSignups > 0 {
+		summary.ActivationRate = float64(summary.TotalActivated) / float64(summary.TotalSignups)
+		summary.BanRate = float64(summary.TotalBanned) / float64(summary.TotalSignups)
+	}
+
+	totalPages := int((summary.TotalCodes + int64(params.PageSize) - 1) / int64(params.PageSize))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	offset := (params.Page - 1) * params.PageSize
+
+	listSQL := fmt.Sprintf(`SELECT * FROM (%s) a ORDER BY %s %s, inviter_id ASC LIMIT %d OFFSET %d`,
+		baseSQL, affPerformanceSortColumn(params.SortBy), affiliateSortDir(params.SortDir), params.PageSize, offset)
+	rows, err := db.DB.QueryxContext(ctx, listSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query aff performance failed: %w", err)
+	}
+	defer rows.Close()
+
+	items := []AffPerformanceRow{}
+	for rows.Next() {
+		var r AffPerformanceRow
+		if err := rows.StructScan(&r); err != nil {
+			continue
+		}
+		items = append(items, r)
+	}
+
+	return &PaginatedAffPerformance{
+		Items:      items,
+		Summary:    summary,
+		Total:      summary.TotalCodes,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+		TotalPages: totalPages,
+	}, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListAffPerformance(t *testing.T) {
+	db := installSQLiteForTests(t)
+	// 1 (AFF1) invited 2, 3, 4; 5 (AFF5) invited 6
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, aff_code TEXT, inviter_id INTEGER,
+			status INTEGER, used_quota INTEGER, request_count INTEGER, deleted_at INTEGER);
+		INSERT INTO users VALUES
+			(1, 'alice', 'AFF1', 0, 1, 0, 0, NULL),
+			(2, 'u2', 'X2', 1, 1, 100, 5, NULL),
+			(3, 'u3', 'X3', 1, 2, 50, 2, NULL),
+			(4, 'u4', 'X4', 1, 1, 0, 0, NULL),
+			(5, 'bob', 'AFF5', 0, 1, 0, 0, NULL),
+			(6, 'u6', 'X6', 5, 1, 10, 1, NULL);
+		CREATE TABLE top_ups (id INTEGER PRIMARY KEY, user_id INTEGER, money REAL, status TEXT);
+		INSERT INTO top_ups VALUES (1, 2, 10.5, 'success'), (2, 2, 99, 'pending'), (3, 6, 3, 'success');
+		CREATE TABLE redemptions (id INTEGER PRIMARY KEY, used_user_id INTEGER, quota INTEGER, redeemed_time INTEGER);
+		INSERT INTO redemptions VALUES (1, 3, 500, 1700000000), (2, 4, 700, 0);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	result, err := ListAffPerformance(context.Background(), AffPerformanceParams{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if result.Total != 2 || len(result.Items) != 2 {
+		t.Fatalf("expected two codes, got %+v", result)
+	}
+	a := result.Items[0]
+	if a.AffCode == nil || *a.AffCode != "AFF1" || a.Signups != 3 || a.Activated != 2 || a.QuotaUsed != 150 {
+		t.Errorf("AFF1 signups: %+v", a)
+	}
+	if a.TopUpCount != 1 || a.TopUpMoney != 10.5 || a.RedeemedCount != 1 || a.RedeemedQuota != 500 {
+		t.Errorf("AFF1 revenue: %+v", a)
+	}
+	if a.Banned != 1 || a.BanRate < 0.33 || a.BanRate > 0.34 {
+		t.Errorf("AFF1 bans: %+v", a)
+	}
+	if s := result.Summary; s.TotalSignups != 4 || s.TotalTopUp != 13.5 || s.ActivationRate != 0.75 {
+		t.Errorf("summary: %+v", s)
+	}
+
+	filtered, err := ListAffPerformance(context.Background(), AffPerformanceParams{Search: "AFF5", SortBy: "ban_rate"})
+	if err != nil || filtered.Total != 1 || filtered.Items[0].InviterID != 5 {
+		t.Fatalf("search: %+v %v", filtered, err)
+	}
+	if atLeast2, _ := ListAffPerformance(context.Background(), AffPerformanceParams{MinSignups: 2}); atLeast2.Total != 1 {
+		t.Errorf("min_signups should keep only AFF1: %+v", atLeast2)
+	}
+}
@@ -1,11 +1,11 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/new-api-tools/backend/internal/database"
-	"github.com/new-api-tools/backend/internal/util"
 )
 
 // AffiliateStatsRow 表示按 inviter_id 聚合后的一行返利统计
@@ -54,7 +54,7 @@ type PaginatedAffiliateStats struct {
 // 此处 search 不在聚合阶段过滤（邀请人字段在外层 JOIN 后才可用），
 // 仅过滤 status / 日期 / inviter_id 非空。
 func buildAffiliateAggWhere(params AffiliateStatsParams) (string, []interface{}, int) {
-	db := database.Get()
+	db := database.GetRead()
 	where := []string{
 		"t.status = " + db.Placeholder(1),
 		"u.inviter_id IS NOT NULL",
@@ -64,14 +64,14 @@ func buildAffiliateAggWhere(params AffiliateStatsParams) (string, []interface{},
 	argIdx := 2
 
 	if params.StartDate != "" {
-		if ts, err := util.ParseDateToTimestampPublic(params.StartDate, false); err == nil {
+		if ts, err := parseReportDate(params.StartDate, false); err == nil {
 			where = append(where, fmt.Sprintf("t.complete_time >= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
 			argIdx++
 		}
 	}
 	if params.EndDate != "" {
-		if ts, err := util.ParseDateToTimestampPublic(params.EndDate, true); err == nil {
+		if ts, err := parseReportDate(params.EndDate, true); err == nil {
 			where = append(where, fmt.Sprintf("t.complete_time <= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
 			argIdx++
@@ -110,7 +110,7 @@ func affiliateSortDir(dir string) string {
 }
 
 // ListAffiliateStats 按 inviter_id 聚合 top_ups（只算 success），返回分页列表。
-func ListAffiliateStats(params AffiliateStatsParams) (*PaginatedAffiliateStats, error) {
+func ListAffiliateStats(ctx context.Context, params AffiliateStatsParams) (*PaginatedAffiliateStats, error) {
 	if params.Page < 1 {
 		params.Page = 1
 	}
@@ -118,7 +118,7 @@ func ListAffiliateStats(params AffiliateStatsParams) (*PaginatedAffiliateStats,
 		params.PageSize = 20
 	}
 
-	db := database.Get()
+	db := database.GetRead().WithContext(ctx)
 	aggWhere, aggArgs, aggNextIdx := buildAffiliateAggWhere(params)
 
 	// 外层 search 过滤：作用于邀请人 iu.username / iu.display_name
@@ -162,7 +162,7 @@ func ListAffiliateStats(params AffiliateStatsParams) (*PaginatedAffiliateStats,
 	countArgs = append(countArgs, outerArgs...)
 
 	var total int64
-	if err := db.DB.Get(&total, countSQL, countArgs...); err != nil {
+	if err := db.DB.GetContext(ctx, &total, countSQL, countArgs...); err != nil {
 		return nil, fmt.Errorf("count affiliate stats failed: %w", err)
 	}
 
@@ -195,7 +195,7 @@ func ListAffiliateStats(params AffiliateStatsParams) (*PaginatedAffiliateStats,
 	listArgs = append(listArgs, outerArgs...)
 	listArgs = append(listArgs, params.PageSize, offset)
 
-	rows, err := db.DB.Queryx(listSQL, listArgs...)
+	rows, err := db.DB.QueryxContext(ctx, listSQL, listArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("query affiliate stats failed: %w", err)
 	}
@@ -221,8 +221,8 @@ func ListAffiliateStats(params AffiliateStatsParams) (*PaginatedAffiliateStats,
 
 // GetAffiliateStatsSummary 计算顶部统计卡片所需的整体汇总。
 // 与列表用同一组过滤（status / 日期 / 邀请人关键字），保证卡片与表格口径一致。
-func GetAffiliateStatsSummary(params AffiliateStatsParams) (*AffiliateStatsSummary, error) {
-	db := database.Get()
+func GetAffiliateStatsSummary(ctx context.Context, params AffiliateStatsParams) (*AffiliateStatsSummary, error) {
+	db := database.GetRead().WithContext(ctx)
 	aggWhere, aggArgs, aggNextIdx := buildAffiliateAggWhere(params)
 
 	outerWhere := []string{}
@@ -269,7 +269,7 @@ func GetAffiliateStatsSummary(params AffiliateStatsParams) (*AffiliateStatsSumma
 	args = append(args, outerArgs...)
 
 	var s AffiliateStatsSummary
-	if err := db.DB.Get(&s, summarySQL, args...); err != nil {
+	if err := db.DB.GetContext(ctx, &s, summarySQL, args...); err != nil {
 		return nil, fmt.Errorf("query affiliate summary failed: %w", err)
 	}
 	return &s, nil
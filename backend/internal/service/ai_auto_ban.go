@@ -2,10 +2,13 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,6 +16,7 @@ import (
 
 	"github.com/new-api-tools/backend/internal/cache"
 	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // AIAutoBanService handles AI-assisted automatic user banning
@@ -26,6 +30,13 @@ func NewAIAutoBanService() *AIAutoBanService {
 	return &AIAutoBanService{db: database.Get(), logDB: database.GetLog()}
 }
 
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *AIAutoBanService) WithContext(ctx context.Context) *AIAutoBanService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
 // Default config
 var defaultAIBanConfig = map[string]interface{}{
 	"base_url":              "",
@@ -39,6 +50,8 @@ var defaultAIBanConfig = map[string]interface{}{
 	"blacklist_ips":         []string{},
 	"excluded_models":       []string{},
 	"excluded_groups":       []string{},
+	"fp_examples":           3, // 提示词 {false_positive_examples} 带入的最近误判案例数
+	"version":               0,
 }
 
 // GetConfig returns AI auto ban configuration with computed fields
@@ -70,8 +83,12 @@ func (s *AIAutoBanService) GetConfig() map[string]interface{} {
 	return config
 }
 
-// SaveConfig saves AI auto ban configuration
+// SaveConfig saves AI auto ban configuration. A "version" in updates must
+// match the stored one, otherwise *ConfigConflictError is returned.
 func (s *AIAutoBanService) SaveConfig(updates map[string]interface{}) error {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
 	cm := cache.Get()
 	// Read raw config from Redis (not via GetConfig which adds computed fields)
 	var config map[string]interface{}
@@ -83,6 +100,10 @@ func (s *AIAutoBanService) SaveConfig(updates map[string]interface{}) error {
 		}
 	}
 
+	if err := applyConfigVersion(config, updates); err != nil {
+		return err
+	}
+
 	// Apply updates
 	for k, v := range updates {
 		config[k] = v
@@ -92,8 +113,7 @@ func (s *AIAutoBanService) SaveConfig(updates map[string]interface{}) error {
 	delete(config, "has_api_key")
 	delete(config, "masked_api_key")
 
-	cm.Set("ai_ban:config", config, 0)
-	return nil
+	return cm.Set("ai_ban:config", config, 0)
 }
 
 // ResetAPIHealth resets the API health status
@@ -107,13 +127,16 @@ func (s *AIAutoBanService) ResetAPIHealth() map[string]interface{} {
 }
 
 // GetAuditLogs returns AI audit logs
-func (s *AIAutoBanService) GetAuditLogs(limit, offset int, status string) map[string]interface{} {
+func (s *AIAutoBanService) GetAuditLogs(limit, offset int, status string) *api.AuditLogPage {
 	cm := cache.Get()
 	var allLogs []map[string]interface{}
 	cm.GetJSON("ai_ban:audit_logs", &allLogs)
 
 	// Filter by status if provided
 	filtered := allLogs
+	if filtered == nil {
+		filtered = []map[string]interface{}{}
+	}
 	if status != "" {
 		filtered = make([]map[string]interface{}, 0)
 		for _, log := range allLogs {
@@ -134,11 +157,11 @@ func (s *AIAutoBanService) GetAuditLogs(limit, offset int, status string) map[st
 		end = total
 	}
 
-	return map[string]interface{}{
-		"items":  filtered[start:end],
-		"total":  total,
-		"limit":  limit,
-		"offset": offset,
+	return &api.AuditLogPage{
+		Items:  filtered[start:end],
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
 	}
 }
 
@@ -178,15 +201,17 @@ func (s *AIAutoBanService) GetAvailableGroups(days int) ([]map[string]interface{
 	return rows, nil
 }
 
-// GetAvailableModelsForExclude returns models used in recent logs
+// GetAvailableModelsForExclude returns the most used models in recent logs
+// (at most groupedRowCap; rarely used models past the cap are not offered)
 func (s *AIAutoBanService) GetAvailableModelsForExclude(days int) ([]map[string]interface{}, error) {
 	startTime := time.Now().Unix() - int64(days*86400)
-	query := s.logDB.RebindQuery(`
+	query := s.logDB.RebindQuery(fmt.Sprintf(`
 		SELECT DISTINCT model_name as name, COUNT(*) as count
 		FROM logs
 		WHERE created_at >= ? AND model_name IS NOT NULL AND model_name != ''
 		GROUP BY model_name
-		ORDER BY count DESC`)
+		ORDER BY count DESC
+		LIMIT %d`, groupedRowCap))
 
 	rows, err := s.logDB.Query(query, startTime)
 	if err != nil {
@@ -196,79 +221,293 @@ func (s *AIAutoBanService) GetAvailableModelsForExclude(days int) ([]map[string]
 }
 
 // GetSuspiciousUsers returns users with suspicious behavior patterns
-func (s *AIAutoBanService) GetSuspiciousUsers(window string, limit int) ([]map[string]interface{}, error) {
+func (s *AIAutoBanService) GetSuspiciousUsers(window string, limit int) ([]api.SuspiciousUser, error) {
 	seconds, ok := WindowSeconds[window]
 	if !ok {
 		seconds = 3600
 	}
 	startTime := time.Now().Unix() - seconds
 
-	cacheKey := fmt.Sprintf("ai_ban:suspicious:%s:%d", window, limit)
+	cacheKey := cache.Key("ai_ban:suspicious:%s:%d", window, limit)
 	cm := cache.Get()
-	var cached []map[string]interface{}
+	var cached []api.SuspiciousUser
 	found, _ := cm.GetJSON(cacheKey, &cached)
 	if found {
 		return cached, nil
 	}
 
+	rows, err := s.suspiciousUsers(startTime, seconds, limit)
+	if err != nil {
+		return nil, err
+	}
+	cm.Set(cacheKey, rows, 2*time.Minute)
+	return rows, nil
+}
+
+// suspiciousUsers runs the uncached candidate aggregate since startTime; the
+// background high-risk detection shares it with GetSuspiciousUsers
+func (s *AIAutoBanService) suspiciousUsers(startTime, seconds int64, limit int) ([]api.SuspiciousUser, error) {
 	// Find users with high failure rates or unusual patterns.
 	// logs 自带 username，无需 JOIN users（兼容日志独立库）。
+	weights := currentRiskWeights(s.db.Context())
+	excludeSQL, excludeArgs := roleExclusionClause(s.db, "l.user_id")
 	query := s.logDB.RebindQuery(`
 		SELECT l.user_id, COALESCE(l.username, '') as username,
 			COUNT(*) as total_requests,
-			SUM(CASE WHEN l.type = 5 THEN 1 ELSE 0 END) as failure_count,
+			SUM(CASE WHEN l.type = ` + ltError() + ` THEN 1 ELSE 0 END) as failure_count,
 			COALESCE(SUM(l.quota), 0) as total_quota,
 			COUNT(DISTINCT l.ip) as unique_ips,
 			COUNT(DISTINCT l.model_name) as unique_models
 		FROM logs l
-		WHERE l.created_at >= ? AND l.type IN (2, 5)
+		WHERE l.created_at >= ? AND l.type IN (` + ltRequests() + `)` + excludeSQL + `
 		GROUP BY l.user_id, l.username
-		HAVING COUNT(*) >= 10
+		HAVING COUNT(*) >= ?
 		ORDER BY failure_count DESC, total_requests DESC
 		LIMIT ?`)
 
-	rows, err := s.logDB.Query(query, startTime, limit)
+	args := append([]interface{}{startTime}, excludeArgs...)
+	rows, err := s.logDB.Query(query, append(args, weights.SuspiciousMinRequests, limit)...)
 	if err != nil {
 		return nil, err
 	}
 
+	windowMinutes := float64(seconds) / 60
+	users := make([]api.SuspiciousUser, 0, len(rows))
 	for _, row := range rows {
-		total := toInt64(row["total_requests"])
-		failures := toInt64(row["failure_count"])
-		if total > 0 {
-			row["failure_rate"] = float64(failures) / float64(total) * 100
-		} else {
-			row["failure_rate"] = 0.0
+		user := api.SuspiciousUser{
+			UserID:        toInt64(row["user_id"]),
+			Username:      toString(row["username"]),
+			TotalRequests: toInt64(row["total_requests"]),
+			FailureCount:  toInt64(row["failure_count"]),
+			TotalQuota:    toInt64(row["total_quota"]),
+			UniqueIPs:     toInt64(row["unique_ips"]),
+			UniqueModels:  toInt64(row["unique_models"]),
 		}
+		if user.TotalRequests > 0 {
+			user.FailureRate = float64(user.FailureCount) / float64(user.TotalRequests) * 100
+		}
+		user.RiskFlags = suspiciousFlags(weights, user.TotalRequests, user.FailureCount, user.UniqueIPs, windowMinutes)
+		user.RuleScore, user.RuleLevel = weights.Score(user.RiskFlags)
+		users = append(users, user)
 	}
+	return users, nil
+}
 
-	cm.Set(cacheKey, rows, 2*time.Minute)
-	return rows, nil
+// suspiciousFlags raises the flags a per-user logs aggregate can see (the
+// full analysis scores more); shared by the candidate scan and the simulator
+func suspiciousFlags(w RiskWeights, total, failures, uniqueIPs int64, windowMinutes float64) []string {
+	flags := []string{}
+	if total > 0 && float64(failures)/float64(total)*100 >= w.Rules[RiskFlagHighFailureRate].Threshold && total >= w.FailureMinRequests {
+		flags = append(flags, RiskFlagHighFailureRate)
+	}
+	if float64(total)/windowMinutes > w.Rules[RiskFlagHighRPM].Threshold {
+		flags = append(flags, RiskFlagHighRPM)
+	}
+	if float64(uniqueIPs) > w.Rules[RiskFlagManyIPs].Threshold {
+		flags = append(flags, RiskFlagManyIPs)
+	}
+	return flags
 }
 
-// ManualAssess performs AI assessment on a single user (placeholder)
-func (s *AIAutoBanService) ManualAssess(userID int64, window string) map[string]interface{} {
-	return map[string]interface{}{
-		"user_id":     userID,
-		"window":      window,
-		"risk_score":  0,
-		"risk_level":  "unknown",
-		"suggestion":  "AI 评估功能需要配置 API",
-		"assessed":    false,
-		"assessed_at": time.Now().Unix(),
+// highRiskDetectCandidates caps the users given a full analysis per detection run
+const highRiskDetectCandidates = 20
+
+// DetectHighRiskUsers is the background high-risk pass: the last hour's
+// candidate aggregate picks the users, each gets the full analysis (IP
+// switching, check-in, IP reputation ...) and users with any flag are recorded
+// and published as high_risk_user (once an hour per user). Returns the users
+// analyzed and flagged.
+func (s *AIAutoBanService) DetectHighRiskUsers(ctx context.Context) (int, int, error) {
+	const window = "1h"
+	seconds := WindowSeconds[window]
+	candidates, err := s.suspiciousUsers(time.Now().Unix()-seconds, seconds, highRiskDetectCandidates)
+	if err != nil {
+		return 0, 0, err
 	}
+
+	risk := NewRiskMonitoringService().WithContext(ctx)
+	analyzed, flagged := 0, 0
+	for _, row := range candidates {
+		if err := ctx.Err(); err != nil {
+			return analyzed, flagged, err
+		}
+		analysis, err := risk.GetUserAnalysis(row.UserID, seconds, nil)
+		if err != nil {
+			continue
+		}
+		analyzed++
+		flags := analysis.Risk.RiskFlags
+		if len(flags) == 0 {
+			continue
+		}
+		flagged++
+		notifyHighRiskUser(row.UserID, row.Username, strings.Join(flags, ","), map[string]interface{}{
+			"window":       window,
+			"risk_flags":   flags,
+			"failure_rate": row.FailureRate,
+		})
+	}
+
+	PublishEvent(EventScanFinished, map[string]interface{}{
+		"scanner": "high_risk",
+		"window":  window,
+		"scanned": analyzed,
+		"flagged": flagged,
+	})
+	return analyzed, flagged, nil
 }
 
-// RunScan performs a scan (placeholder)
-func (s *AIAutoBanService) RunScan(window string, limit int) map[string]interface{} {
-	return map[string]interface{}{
-		"scanned":  0,
-		"assessed": 0,
-		"banned":   0,
-		"dry_run":  true,
-		"window":   window,
-		"message":  "扫描功能需要配置 AI API",
+// ManualAssess performs AI assessment on a single user (placeholder).
+// The prompt variables are already resolved so the prompt can be previewed.
+func (s *AIAutoBanService) ManualAssess(userID int64, window string) *api.Assessment {
+	result := &api.Assessment{
+		UserID:     userID,
+		Window:     window,
+		RiskLevel:  "unknown",
+		Suggestion: "AI 评估功能需要配置 API",
+		AssessedAt: time.Now().Unix(),
+	}
+	seconds, ok := WindowSeconds[window]
+	if !ok {
+		seconds = 3600
+	}
+	analysis, err := NewRiskMonitoringService().GetUserAnalysis(userID, seconds, nil)
+	if err != nil {
+		return result
 	}
+	result.RuleScore, result.RuleLevel = analysis.Risk.RuleScore, analysis.Risk.RuleLevel
+	config := s.GetConfig()
+	vars := aiBanPromptVariables(analysis, config)
+	fpExamples := 3 // 早于该配置项保存的配置没有 fp_examples
+	if v, ok := config["fp_examples"]; ok {
+		fpExamples = int(toInt64(v))
+	}
+	vars["false_positive_examples"] = s.falsePositiveExamples(s.db.Context(), fpExamples)
+	result.PromptVariables = vars
+	if tpl, _ := config["custom_prompt"].(string); tpl != "" {
+		result.Prompt = renderAIBanPrompt(tpl, vars)
+	}
+	return result
+}
+
+// aiBanPromptVariables resolves the {变量} placeholders of the assessment
+// prompt from a GetUserAnalysis result
+func aiBanPromptVariables(analysis *api.UserAnalysis, config map[string]interface{}) map[string]string {
+	user, summary, risk := analysis.User, analysis.Summary, analysis.Risk
+	switches := risk.IPSwitchAnalysis
+
+	userIPs := make([]string, 0, len(analysis.TopIPs))
+	for _, row := range analysis.TopIPs {
+		userIPs = append(userIPs, row.IP)
+	}
+	whitelist := aiBanConfigList(config, "whitelist_ips")
+	blacklist := aiBanConfigList(config, "blacklist_ips")
+	matchIPs := func(ranges []string) string {
+		m := newIPBlockMatcher(ranges, nil)
+		var hits []string
+		for _, ip := range userIPs {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				if rules, _ := m.match(parsed); len(rules) > 0 {
+					hits = append(hits, ip)
+				}
+			}
+		}
+		return joinOrNone(hits)
+	}
+
+	// IP 信誉：机房 / VPN / Tor 占比（无信誉数据时为 "未知"）
+	ipTypes, datacenterIPs, vpnIPs, torIPs := "未知", "无", "无", "无"
+	if rep := risk.IPReputation; rep != nil {
+		shares := rep.ShareByType
+		types := make([]string, 0, len(shares))
+		for t := range shares {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool { return shares[types[i]] > shares[types[j]] })
+		parts := make([]string, 0, len(types))
+		for _, t := range types {
+			parts = append(parts, fmt.Sprintf("%s %.1f%%", t, shares[t]))
+		}
+		ipTypes = joinOrNone(parts)
+		byType := rep.IPsByType
+		datacenterIPs = joinOrNone(byType[IPTypeDatacenter])
+		vpnIPs = joinOrNone(byType[IPTypeVPN])
+		torIPs = joinOrNone(byType[IPTypeTor])
+	}
+
+	oauthAccounts, oauthAge := oauthPromptVariables(user.OAuthProfiles)
+
+	return map[string]string{
+		"user_id":                strconv.FormatInt(user.ID, 10),
+		"username":               user.Username,
+		"user_group":             user.Group,
+		"total_requests":         strconv.FormatInt(summary.TotalRequests, 10),
+		"unique_models":          strconv.FormatInt(summary.UniqueModels, 10),
+		"unique_tokens":          strconv.FormatInt(summary.UniqueTokens, 10),
+		"unique_ips":             strconv.FormatInt(summary.UniqueIPs, 10),
+		"switch_count":           toString(switches["switch_count"]),
+		"rapid_switch_count":     toString(switches["rapid_switch_count"]),
+		"avg_ip_duration":        fmt.Sprintf("%.0f", toFloat64(switches["avg_ip_duration"])),
+		"min_switch_interval":    toString(switches["min_switch_interval"]),
+		"risk_flags":             joinOrNone(risk.RiskFlags),
+		"user_ips":               joinOrNone(userIPs),
+		"whitelist_ips":          joinOrNone(whitelist),
+		"blacklist_ips":          joinOrNone(blacklist),
+		"user_whitelisted_ips":   matchIPs(whitelist),
+		"user_blacklisted_ips":   matchIPs(blacklist),
+		"ip_types":               ipTypes,
+		"datacenter_ips":         datacenterIPs,
+		"vpn_ips":                vpnIPs,
+		"tor_ips":                torIPs,
+		"oauth_accounts":         oauthAccounts,
+		"oauth_account_age_days": oauthAge,
+	}
+}
+
+// renderAIBanPrompt replaces {name} placeholders; unknown ones are left as-is
+func renderAIBanPrompt(tpl string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2)
+	for k, v := range vars {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(tpl)
+}
+
+// aiBanConfigList reads a string list (e.g. whitelist_ips) from the AI ban
+// config, which is []string by default and []interface{} once round-tripped
+// through the cache
+func aiBanConfigList(config map[string]interface{}, key string) []string {
+	var values []string
+	switch v := config[key].(type) {
+	case []string:
+		values = v
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, toString(item))
+		}
+	case string:
+		values = splitCSV(v)
+	}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "无"
+	}
+	return strings.Join(items, ", ")
+}
+
+// RunScan performs a scan (placeholder). It scans nothing, so it publishes no
+// scan_finished event.
+func (s *AIAutoBanService) RunScan(window string, limit int) *api.ScanResult {
+	return &api.ScanResult{DryRun: true, Window: window, Message: "扫描功能需要配置 AI API"}
 }
 
 // TestConnection tests the configured API connection (placeholder)
@@ -317,8 +556,8 @@ func (s *AIAutoBanService) FetchModels(baseURL, apiKey string, forceRefresh bool
 	}
 
 	cm := cache.Get()
-	cacheKey := "ai_ban:models_cache"
-	cacheURLKey := "ai_ban:models_cache_url"
+	cacheKey := cache.Key("ai_ban:models_cache")
+	cacheURLKey := cache.Key("ai_ban:models_cache_url")
 
 	// Check if API URL changed
 	var cachedURL string
@@ -566,12 +805,12 @@ func (s *AIAutoBanService) TestModel(baseURL, apiKey, model string) map[string]i
 // Whitelist management
 
 // GetWhitelist returns the whitelist user IDs
-func (s *AIAutoBanService) GetWhitelist() map[string]interface{} {
+func (s *AIAutoBanService) GetWhitelist() *api.Whitelist {
 	cm := cache.Get()
 	var whitelist []int64
 	cm.GetJSON("ai_ban:whitelist", &whitelist)
 
-	items := make([]map[string]interface{}, 0)
+	items := make([]api.WhitelistedUser, 0)
 	if len(whitelist) > 0 {
 		// Batch query all whitelist users in one query
 		placeholders := buildPlaceholders(s.db.IsPG, len(whitelist), 1)
@@ -581,36 +820,88 @@ func (s *AIAutoBanService) GetWhitelist() map[string]interface{} {
 		}
 		query := s.db.RebindQuery(fmt.Sprintf(
 			"SELECT id, username, status FROM users WHERE id IN (%s)", placeholders))
-		rows, err := s.db.Query(query, args...)
-		if err == nil && rows != nil {
-			items = rows
+		rows, _ := s.db.Query(query, args...)
+		var reasons map[string]whitelistReason
+		cm.GetJSON("ai_ban:whitelist_reasons", &reasons)
+		now := time.Now().Unix()
+		for _, row := range rows {
+			r := reasons[toString(row["id"])]
+			if r.ExpiresAt > 0 && r.ExpiresAt <= now {
+				continue
+			}
+			items = append(items, api.WhitelistedUser{
+				ID:        toInt64(row["id"]),
+				Username:  toString(row["username"]),
+				Status:    toInt64(row["status"]),
+				Reason:    r.Reason,
+				AddedAt:   r.AddedAt,
+				ExpiresAt: r.ExpiresAt,
+			})
 		}
 	}
 
-	return map[string]interface{}{
-		"items": items,
-		"total": len(items),
+	return &api.Whitelist{
+		Items: items,
+		Total: len(items),
+		Rules: s.ListWhitelistRules(),
 	}
 }
 
-// AddToWhitelist adds a user to the whitelist
-func (s *AIAutoBanService) AddToWhitelist(userID int64) map[string]interface{} {
+// whitelistReason is why (and when, and until when) a user was whitelisted
+type whitelistReason struct {
+	Reason    string `json:"reason"`
+	AddedAt   int64  `json:"added_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // 0 = 永久
+}
+
+// AddToWhitelist adds a user to the whitelist; reason is optional and
+// expiresAt 0 keeps the user whitelisted until removed
+func (s *AIAutoBanService) AddToWhitelist(userID int64, reason string, expiresAt int64) *api.WhitelistResult {
+	if !s.addToWhitelist(userID, reason, expiresAt) {
+		return &api.WhitelistResult{Message: "用户已在白名单中"}
+	}
+	return &api.WhitelistResult{Message: fmt.Sprintf("用户 %d 已加入白名单", userID)}
+}
+
+// addToWhitelist reports whether the user was added; a user already on the
+// list gets the given reason and expiry (re-adding without expiry makes the
+// entry permanent). An expired entry counts as absent.
+func (s *AIAutoBanService) addToWhitelist(userID int64, reason string, expiresAt int64) bool {
 	cm := cache.Get()
 	var whitelist []int64
 	cm.GetJSON("ai_ban:whitelist", &whitelist)
-
-	for _, uid := range whitelist {
-		if uid == userID {
-			return map[string]interface{}{"message": "用户已在白名单中"}
+	var reasons map[string]whitelistReason
+	cm.GetJSON("ai_ban:whitelist_reasons", &reasons)
+	if reasons == nil {
+		reasons = map[string]whitelistReason{}
+	}
+	key := strconv.FormatInt(userID, 10)
+	prev, hasPrev := reasons[key]
+
+	added := !slices.Contains(whitelist, userID) || (prev.ExpiresAt > 0 && prev.ExpiresAt <= time.Now().Unix())
+	if !slices.Contains(whitelist, userID) {
+		whitelist = append(whitelist, userID)
+		cm.Set("ai_ban:whitelist", whitelist, 0)
+	}
+	reason = strings.TrimSpace(reason)
+	switch {
+	case reason != "" || expiresAt > 0 || added && hasPrev:
+		if reason == "" && !added {
+			reason = prev.Reason
 		}
-	}
-	whitelist = append(whitelist, userID)
-	cm.Set("ai_ban:whitelist", whitelist, 0)
-	return map[string]interface{}{"message": fmt.Sprintf("用户 %d 已加入白名单", userID)}
+		reasons[key] = whitelistReason{Reason: reason, AddedAt: time.Now().Unix(), ExpiresAt: expiresAt}
+	case hasPrev && prev.ExpiresAt > 0:
+		prev.ExpiresAt = 0
+		reasons[key] = prev
+	default:
+		return added
+	}
+	cm.Set("ai_ban:whitelist_reasons", reasons, 0)
+	return added
 }
 
 // RemoveFromWhitelist removes a user from the whitelist
-func (s *AIAutoBanService) RemoveFromWhitelist(userID int64) map[string]interface{} {
+func (s *AIAutoBanService) RemoveFromWhitelist(userID int64) *api.WhitelistResult {
 	cm := cache.Get()
 	var whitelist []int64
 	cm.GetJSON("ai_ban:whitelist", &whitelist)
@@ -622,7 +913,12 @@ func (s *AIAutoBanService) RemoveFromWhitelist(userID int64) map[string]interfac
 		}
 	}
 	cm.Set("ai_ban:whitelist", newList, 0)
-	return map[string]interface{}{"message": fmt.Sprintf("用户 %d 已从白名单移除", userID)}
+	var reasons map[string]whitelistReason
+	if found, _ := cm.GetJSON("ai_ban:whitelist_reasons", &reasons); found {
+		delete(reasons, strconv.FormatInt(userID, 10))
+		cm.Set("ai_ban:whitelist_reasons", reasons, 0)
+	}
+	return &api.WhitelistResult{Message: fmt.Sprintf("用户 %d 已从白名单移除", userID)}
 }
 
 // SearchUserForWhitelist searches users for whitelist addition
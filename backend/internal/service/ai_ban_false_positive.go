@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+var (
+	ErrInvalidFalsePositive = errors.New("invalid false positive request")
+	ErrAuditLogNotFound     = errors.New("audit log not found")
+)
+
+// FalsePositiveInput marks one user of an audit log entry as a false positive
+type FalsePositiveInput struct {
+	UserID       int64  `json:"user_id"` // 审查记录只有一个用户时可省略
+	Reason       string `json:"reason"`
+	EnableTokens *bool  `json:"enable_tokens"` // 解封时同时启用其令牌，默认 true
+}
+
+// FalsePositiveCase is a reviewed AI ban decision that turned out wrong.
+// Recent cases are fed back to the assessment prompt as examples.
+type FalsePositiveCase struct {
+	ID          int64   `json:"id"`
+	AuditLogID  int64   `json:"audit_log_id"`
+	ScanID      string  `json:"scan_id"`
+	UserID      int64   `json:"user_id"`
+	Username    string  `json:"username"`
+	AIAction    string  `json:"ai_action"`     // AI 当时的处置，如 ban / warn
+	AIRiskScore float64 `json:"ai_risk_score"` // AI 给出的 0-10 风险分
+	AIReason    string  `json:"ai_reason"`     // AI 当时的判断理由
+	Reason      string  `json:"reason"`        // 人工复核结论
+	Operator    string  `json:"operator"`
+	CreatedAt   int64   `json:"created_at"`
+}
+
+func ensureFalsePositiveTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS ai_ban_false_positives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			audit_log_id INTEGER NOT NULL DEFAULT 0,
+			scan_id TEXT NOT NULL DEFAULT '',
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			ai_action TEXT NOT NULL DEFAULT '',
+			ai_risk_score REAL NOT NULL DEFAULT 0,
+			ai_reason TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			operator TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_ai_ban_false_positives_user ON ai_ban_false_positives (user_id, id)`)
+	return err
+}
+
+func openFalsePositiveStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureFalsePositiveTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// auditLogDetails returns the per-user results of an audit log entry
+func auditLogDetails(entry map[string]interface{}) []map[string]interface{} {
+	var raw []interface{}
+	switch v := entry["details"].(type) {
+	case []interface{}:
+		raw = v
+	case map[string]interface{}:
+		raw, _ = v["results"].([]interface{})
+	}
+	out := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// firstString returns the first non-empty string value among keys
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s := strings.TrimSpace(toString(m[k])); s != "" && s != "<nil>" {
+			return s
+		}
+	}
+	return ""
+}
+
+// MarkFalsePositive reverses an AI ban decision: the user is unbanned and
+// whitelisted with the reason, the audit log result is flagged, and the case
+// (with the AI's reasoning) is recorded for the prompt's examples.
+func (s *AIAutoBanService) MarkFalsePositive(ctx context.Context, auditLogID int64, in FalsePositiveInput, operator string) (*FalsePositiveCase, error) {
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Reason == "" || len([]rune(in.Reason)) > 500 {
+		return nil, fmt.Errorf("%w: 请填写误判原因（不超过 500 字）", ErrInvalidFalsePositive)
+	}
+
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+	cm := cache.Get()
+	var logs []map[string]interface{}
+	cm.GetJSON("ai_ban:audit_logs", &logs)
+	var entry map[string]interface{}
+	for _, l := range logs {
+		if toInt64(l["id"]) == auditLogID {
+			entry = l
+			break
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: 审查记录 %d 不存在", ErrAuditLogNotFound, auditLogID)
+	}
+	details := auditLogDetails(entry)
+	if in.UserID == 0 && len(details) == 1 {
+		in.UserID = toInt64(details[0]["user_id"])
+	}
+	var detail map[string]interface{}
+	for _, d := range details {
+		if toInt64(d["user_id"]) == in.UserID {
+			detail = d
+			break
+		}
+	}
+	if in.UserID <= 0 || detail == nil {
+		return nil, fmt.Errorf("%w: 审查记录 %d 中没有用户 %d", ErrInvalidFalsePositive, auditLogID, in.UserID)
+	}
+
+	fp := &FalsePositiveCase{
+		AuditLogID:  auditLogID,
+		ScanID:      toString(entry["scan_id"]),
+		UserID:      in.UserID,
+		Username:    firstString(detail, "username"),
+		AIAction:    firstString(detail, "action"),
+		AIRiskScore: toFloat64(detail["risk_score"]),
+		AIReason:    firstString(detail, "reason", "reasoning", "analysis"),
+		Reason:      in.Reason,
+		Operator:    operator,
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	if err := NewUserManagementService().WithContext(ctx).UnbanUser(in.UserID, in.EnableTokens == nil || *in.EnableTokens); err != nil {
+		return nil, err
+	}
+	s.addToWhitelist(in.UserID, "误判: "+in.Reason, 0)
+
+	detail["false_positive"] = true
+	detail["false_positive_at"] = fp.CreatedAt
+	if err := cm.Set("ai_ban:audit_logs", logs, 0); err != nil {
+		logger.L.Warn("[AI 封禁] 审查记录误判标记保存失败: " + err.Error())
+	}
+	_, _ = cm.DeleteByPrefix(cache.Key("ai_ban:suspicious:"))
+
+	store, err := openFalsePositiveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	res, err := store.ExecContext(ctx, `
+		INSERT INTO ai_ban_false_positives (audit_log_id, scan_id, user_id, username, ai_action, ai_risk_score, ai_reason, reason, operator, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		fp.AuditLogID, fp.ScanID, fp.UserID, fp.Username, fp.AIAction, fp.AIRiskScore, fp.AIReason, fp.Reason, fp.Operator, fp.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	fp.ID, _ = res.LastInsertId()
+	logger.L.Security(fmt.Sprintf("[AI 封禁] %s 将用户 %d (%s) 标记为误判并解封 | 原因: %s", operator, fp.UserID, fp.Username, fp.Reason))
+	return fp, nil
+}
+
+// ListFalsePositives returns recorded false positives, newest first
+func (s *AIAutoBanService) ListFalsePositives(ctx context.Context, limit, offset int) ([]FalsePositiveCase, int64, error) {
+	store, err := openFalsePositiveStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer store.Close()
+	var total int64
+	if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM ai_ban_false_positives`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, audit_log_id, scan_id, user_id, username, ai_action, ai_risk_score, ai_reason, reason, operator, created_at
+		FROM ai_ban_false_positives ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items := []FalsePositiveCase{}
+	for rows.Next() {
+		var c FalsePositiveCase
+		if err := rows.Scan(&c.ID, &c.AuditLogID, &c.ScanID, &c.UserID, &c.Username, &c.AIAction, &c.AIRiskScore,
+			&c.AIReason, &c.Reason, &c.Operator, &c.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, c)
+	}
+	return items, total, rows.Err()
+}
+
+// falsePositiveExamples renders the latest n false positives as the
+// {false_positive_examples} prompt variable
+func (s *AIAutoBanService) falsePositiveExamples(ctx context.Context, n int) string {
+	if n <= 0 {
+		return "无"
+	}
+	cases, _, err := s.ListFalsePositives(ctx, n, 0)
+	if err != nil || len(cases) == 0 {
+		return "无"
+	}
+	lines := make([]string, 0, len(cases))
+	for i, c := range cases {
+		aiReason := c.AIReason
+		if aiReason == "" {
+			aiReason = "未记录"
+		}
+		lines = append(lines, fmt.Sprintf("%d. 用户 %s（AI 判定 %s，风险分 %.1f）AI 理由：%s；人工复核为误判：%s",
+			i+1, c.Username, c.AIAction, c.AIRiskScore, aiReason, c.Reason))
+	}
+	return strings.Join(lines, "\n")
+}
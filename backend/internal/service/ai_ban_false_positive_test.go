@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestMarkFalsePositive(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, status INTEGER);
+		CREATE TABLE tokens (id INTEGER PRIMARY KEY, user_id INTEGER, status INTEGER);
+		INSERT INTO users VALUES (7, 'alice', 2), (8, 'bob', 2);
+		INSERT INTO tokens VALUES (1, 7, 2), (2, 8, 2);`); err != nil {
+		t.Fatal(err)
+	}
+	cm := cache.Get()
+	t.Cleanup(func() {
+		cm.Delete("ai_ban:audit_logs")
+		cm.Delete("ai_ban:whitelist")
+		cm.Delete("ai_ban:whitelist_reasons")
+	})
+	cm.Set("ai_ban:audit_logs", []map[string]interface{}{{
+		"id": 42, "scan_id": "scan-1", "status": "success",
+		"details": []map[string]interface{}{
+			{"user_id": 7, "username": "alice", "action": "ban", "risk_score": 8.5, "reason": "多 IP 高频切换"},
+			{"user_id": 8, "username": "bob", "action": "ban", "risk_score": 9},
+		},
+	}}, 0)
+
+	svc := NewAIAutoBanService()
+	ctx := context.Background()
+	if _, err := svc.MarkFalsePositive(ctx, 42, FalsePositiveInput{UserID: 7}, "admin"); !errors.Is(err, ErrInvalidFalsePositive) {
+		t.Errorf("missing reason: %v", err)
+	}
+	if _, err := svc.MarkFalsePositive(ctx, 99, FalsePositiveInput{UserID: 7, Reason: "x"}, "admin"); !errors.Is(err, ErrAuditLogNotFound) {
+		t.Errorf("unknown audit log: %v", err)
+	}
+	// Two users in the entry, so user_id is required
+	if _, err := svc.MarkFalsePositive(ctx, 42, FalsePositiveInput{Reason: "x"}, "admin"); !errors.Is(err, ErrInvalidFalsePositive) {
+		t.Errorf("ambiguous user: %v", err)
+	}
+
+	fp, err := svc.MarkFalsePositive(ctx, 42, FalsePositiveInput{UserID: 7, Reason: "公司出口 IP 轮换"}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.ID == 0 || fp.Username != "alice" || fp.AIAction != "ban" || fp.AIRiskScore != 8.5 || fp.AIReason != "多 IP 高频切换" || fp.ScanID != "scan-1" {
+		t.Errorf("case: %+v", fp)
+	}
+	var userStatus, tokenStatus int
+	db.QueryRow("SELECT status FROM users WHERE id = 7").Scan(&userStatus)
+	db.QueryRow("SELECT status FROM tokens WHERE id = 1").Scan(&tokenStatus)
+	if userStatus != 1 || tokenStatus != 1 {
+		t.Errorf("user 7 should be unbanned with tokens: %d %d", userStatus, tokenStatus)
+	}
+
+	wl := svc.GetWhitelist().Items
+	if len(wl) != 1 || wl[0].ID != 7 || !strings.Contains(wl[0].Reason, "公司出口 IP 轮换") {
+		t.Errorf("whitelist: %v", wl)
+	}
+	var logs []map[string]interface{}
+	cm.GetJSON("ai_ban:audit_logs", &logs)
+	if d := auditLogDetails(logs[0]); d[0]["false_positive"] != true || d[1]["false_positive"] != nil {
+		t.Errorf("audit log flag: %v", d)
+	}
+
+	examples := svc.falsePositiveExamples(ctx, 3)
+	if !strings.Contains(examples, "alice") || !strings.Contains(examples, "多 IP 高频切换") {
+		t.Errorf("examples: %s", examples)
+	}
+	if got := svc.falsePositiveExamples(ctx, 0); got != "无" {
+		t.Errorf("disabled examples: %s", got)
+	}
+	if items, total, err := svc.ListFalsePositives(ctx, 10, 0); err != nil || total != 1 || items[0].Reason != "公司出口 IP 轮换" {
+		t.Errorf("list: %v %d %v", items, total, err)
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+var ErrInvalidBanSimulation = errors.New("invalid ban simulation")
+
+// BanSimulationInput is a candidate config to backtest. Weights are merged
+// onto the saved risk weights and never persisted.
+type BanSimulationInput struct {
+	Days        int              `json:"days"`         // 回放最近几天，1-30，默认 7
+	Weights     RiskWeightsInput `json:"weights"`      // 候选权重（部分覆盖当前配置）
+	BanScore    int              `json:"ban_score"`    // rule_score 达到该值即视为封禁，默认候选 high_score
+	SampleLimit int              `json:"sample_limit"` // 样本用户数，默认 20，最多 100
+}
+
+// BanSimulationCounts are the would-ban totals of one config
+type BanSimulationCounts struct {
+	BanScore    int `json:"ban_score"`
+	Users       int `json:"users"`       // 至少一个小时窗口达到封禁分的用户
+	Windows     int `json:"windows"`     // 达到封禁分的（用户, 小时）窗口
+	Whitelisted int `json:"whitelisted"` // 达到封禁分但在白名单中（未计入 users）
+}
+
+// BanSimulationSample is one user that the candidate config would ban
+type BanSimulationSample struct {
+	UserID        int64    `json:"user_id"`
+	Username      string   `json:"username"`
+	WindowsHit    int      `json:"windows_hit"`
+	MaxScore      int      `json:"max_score"`
+	Flags         []string `json:"flags"`
+	FirstHit      int64    `json:"first_hit"`
+	LastHit       int64    `json:"last_hit"`
+	MaxRequests   int64    `json:"max_requests"` // 命中窗口中的最大小时请求数
+	BannedCurrent bool     `json:"banned_current"`
+}
+
+// BanSimulationResult compares the candidate config against the saved one
+type BanSimulationResult struct {
+	Days             int                      `json:"days"`
+	StartTime        int64                    `json:"start_time"`
+	EndTime          int64                    `json:"end_time"`
+	EvaluatedUsers   int                      `json:"evaluated_users"`
+	EvaluatedWindows int                      `json:"evaluated_windows"`
+	Candidate        BanSimulationCounts      `json:"candidate"`
+	Current          BanSimulationCounts      `json:"current"`
+	ByFlag           map[string]int           `json:"by_flag"` // 候选配置下各标签命中的封禁用户数
+	ByDay            []map[string]interface{} `json:"by_day"`  // 每天（报表时区）候选配置下的封禁用户数
+	Samples          []BanSimulationSample    `json:"samples"`
+	Weights          RiskWeights              `json:"weights"` // 合并后的候选权重
+	ElapsedMs        int64                    `json:"elapsed_ms"`
+}
+
+// SimulateBans replays the last N days of hourly per-user log aggregates
+// against a candidate risk config: every (user, hour) window is scored the
+// way the suspicious-user scan scores it, and a window whose rule_score
+// reaches ban_score counts as a ban. The saved config is evaluated in the
+// same pass so the two can be compared.
+func (s *AIAutoBanService) SimulateBans(ctx context.Context, in BanSimulationInput) (*BanSimulationResult, error) {
+	started := time.Now()
+	if in.Days == 0 {
+		in.Days = 7
+	}
+	if in.Days < 1 || in.Days > 30 {
+		return nil, fmt.Errorf("%w: days 需在 1-30 之间", ErrInvalidBanSimulation)
+	}
+	in.SampleLimit = clampSetting(in.SampleLimit, 1, 100, 20)
+
+	current, err := GetRiskWeights(ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidate := current.clone()
+	if err := mergeRiskWeights(&candidate, in.Weights); err != nil {
+		return nil, err
+	}
+	if in.BanScore == 0 {
+		in.BanScore = candidate.HighScore
+	}
+	if in.BanScore < 1 || in.BanScore > 100 {
+		return nil, fmt.Errorf("%w: ban_score 需在 1-100 之间", ErrInvalidBanSimulation)
+	}
+
+	// The lower of the two minimums, so either config sees every window it would scan
+	minRequests := min(candidate.SuspiciousMinRequests, current.SuspiciousMinRequests)
+	end := time.Now().Unix()
+	start := end - int64(in.Days)*86400
+	logDB := database.GetReadLog().WithContext(ctx)
+	excludeSQL, excludeArgs := roleExclusionClause(s.db, "user_id")
+	args := append([]interface{}{start}, excludeArgs...)
+	rows, err := logDB.QueryWithTimeout(4*time.Minute, logDB.RebindQuery(`
+		SELECT created_at - (created_at % 3600) as hour, user_id, MAX(username) as username,
+			COUNT(*) as total_requests,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failure_count,
+			COUNT(DISTINCT ip) as unique_ips
+		FROM logs
+		WHERE created_at >= ? AND type IN (`+ltRequests()+`)`+excludeSQL+`
+		GROUP BY created_at - (created_at % 3600), user_id
+		HAVING COUNT(*) >= ?`), append(args, minRequests)...)
+	if err != nil {
+		return nil, err
+	}
+	// Whitelist rules are evaluated against cached trust levels only; a
+	// backtest does not query linux.do
+	seen := map[int64]bool{}
+	userIDs := []int64{}
+	for _, row := range rows {
+		if userID := toInt64(row["user_id"]); !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	whitelisted, err := whitelistedUsers(s.db.WithContext(ctx), userIDs, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BanSimulationResult{
+		Days:             in.Days,
+		StartTime:        start,
+		EndTime:          end,
+		EvaluatedWindows: len(rows),
+		Candidate:        BanSimulationCounts{BanScore: in.BanScore},
+		Current:          BanSimulationCounts{BanScore: current.HighScore},
+		ByFlag:           map[string]int{},
+		ByDay:            []map[string]interface{}{},
+		Samples:          []BanSimulationSample{},
+		Weights:          candidate,
+	}
+
+	evaluated := map[int64]bool{}
+	samples := map[int64]*BanSimulationSample{}
+	flagsByUser := map[int64]map[string]bool{}
+	bannedCurrent := map[int64]bool{}
+	daily := map[string]map[int64]bool{}
+	loc := ReportLocation()
+	for _, row := range rows {
+		userID := toInt64(row["user_id"])
+		hour := toInt64(row["hour"])
+		total := toInt64(row["total_requests"])
+		failures := toInt64(row["failure_count"])
+		uniqueIPs := toInt64(row["unique_ips"])
+		evaluated[userID] = true
+
+		if total >= int64(current.SuspiciousMinRequests) {
+			if score, _ := current.Score(suspiciousFlags(current, total, failures, uniqueIPs, 60)); score >= current.HighScore {
+				result.Current.Windows++
+				if whitelisted[userID] != "" {
+					result.Current.Whitelisted++
+				} else {
+					bannedCurrent[userID] = true
+				}
+			}
+		}
+		if total < int64(candidate.SuspiciousMinRequests) {
+			continue
+		}
+		flags := suspiciousFlags(candidate, total, failures, uniqueIPs, 60)
+		score, _ := candidate.Score(flags)
+		if score < in.BanScore {
+			continue
+		}
+		result.Candidate.Windows++
+		if whitelisted[userID] != "" {
+			result.Candidate.Whitelisted++
+			continue
+		}
+		sample := samples[userID]
+		if sample == nil {
+			sample = &BanSimulationSample{UserID: userID, Username: toString(row["username"]), FirstHit: hour, LastHit: hour}
+			samples[userID], flagsByUser[userID] = sample, map[string]bool{}
+		}
+		sample.WindowsHit++
+		sample.MaxScore = max(sample.MaxScore, score)
+		sample.MaxRequests = max(sample.MaxRequests, total)
+		sample.FirstHit, sample.LastHit = min(sample.FirstHit, hour), max(sample.LastHit, hour)
+		for _, flag := range flags {
+			flagsByUser[userID][flag] = true
+		}
+		day := time.Unix(hour, 0).In(loc).Format("2006-01-02")
+		if daily[day] == nil {
+			daily[day] = map[int64]bool{}
+		}
+		daily[day][userID] = true
+	}
+
+	result.EvaluatedUsers = len(evaluated)
+	result.Candidate.Users = len(samples)
+	result.Current.Users = len(bannedCurrent)
+
+	list := make([]*BanSimulationSample, 0, len(samples))
+	for userID, sample := range samples {
+		for flag := range flagsByUser[userID] {
+			sample.Flags = append(sample.Flags, flag)
+			result.ByFlag[flag]++
+		}
+		sort.Strings(sample.Flags)
+		sample.BannedCurrent = bannedCurrent[userID]
+		list = append(list, sample)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].MaxScore != list[j].MaxScore {
+			return list[i].MaxScore > list[j].MaxScore
+		}
+		if list[i].WindowsHit != list[j].WindowsHit {
+			return list[i].WindowsHit > list[j].WindowsHit
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	for i := 0; i < len(list) && i < in.SampleLimit; i++ {
+		result.Samples = append(result.Samples, *list[i])
+	}
+
+	days := make([]string, 0, len(daily))
+	for day := range daily {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		result.ByDay = append(result.ByDay, map[string]interface{}{"day": day, "users": len(daily[day])})
+	}
+	result.ElapsedMs = time.Since(started).Milliseconds()
+	return result, nil
+}
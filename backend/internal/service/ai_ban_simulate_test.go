@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func TestSimulateBans(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	installIPMonitoringSchema(t)
+	resetRiskWeightsCache(t)
+	ctx := context.Background()
+
+	// Users 1 and 2 send 400 requests in the last full hour (HIGH_RPM); half of
+	// user 1's fail (HIGH_FAILURE_RATE). Default weights score them 35 and 20.
+	hour := time.Now().Unix()/3600*3600 - 3600
+	if _, err := database.Get().Execute(`
+		WITH RECURSIVE n(i) AS (SELECT 0 UNION ALL SELECT i + 1 FROM n WHERE i < 399)
+		INSERT INTO logs (user_id, created_at, type, ip, username, model_name)
+		SELECT 1, ? + i % 3600, CASE WHEN i % 2 = 0 THEN 5 ELSE 2 END, '10.0.0.1', 'u1', 'gpt' FROM n
+		UNION ALL
+		SELECT 2, ? + i % 3600, 2, '10.0.0.2', 'u2', 'gpt' FROM n`, hour, hour); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewAIAutoBanService()
+	result, err := svc.SimulateBans(ctx, BanSimulationInput{Days: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.EvaluatedUsers != 2 || result.EvaluatedWindows != 2 || result.Candidate.Users != 0 || result.Current.Users != 0 {
+		t.Fatalf("default weights should ban nobody: %+v", result)
+	}
+
+	result, err = svc.SimulateBans(ctx, BanSimulationInput{
+		Days:    1,
+		Weights: RiskWeightsInput{Rules: map[string]RiskRule{RiskFlagHighRPM: {Threshold: 5, Points: 50}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Candidate.Users != 1 || result.Candidate.Windows != 1 || result.Current.Users != 0 {
+		t.Fatalf("candidate should ban user 1 only: %+v", result)
+	}
+	s := result.Samples[0]
+	if s.UserID != 1 || s.MaxScore != 65 || len(s.Flags) != 2 || s.FirstHit != hour || s.BannedCurrent {
+		t.Errorf("sample: %+v", s)
+	}
+	if result.ByFlag[RiskFlagHighRPM] != 1 || len(result.ByDay) != 1 {
+		t.Errorf("breakdown: %v %v", result.ByFlag, result.ByDay)
+	}
+
+	// A lower ban score catches both users; the saved weights stay untouched
+	if result, err = svc.SimulateBans(ctx, BanSimulationInput{Days: 1, BanScore: 20}); err != nil || result.Candidate.Users != 2 {
+		t.Fatalf("ban_score 20: %+v %v", result, err)
+	}
+	if saved, _ := GetRiskWeights(ctx); saved.Rules[RiskFlagHighRPM].Points != 20 {
+		t.Errorf("simulation must not persist weights: %+v", saved.Rules)
+	}
+
+	if _, err := svc.SimulateBans(ctx, BanSimulationInput{Days: 31}); !errors.Is(err, ErrInvalidBanSimulation) {
+		t.Errorf("days 31: %v", err)
+	}
+	if _, err := svc.SimulateBans(ctx, BanSimulationInput{Weights: RiskWeightsInput{Rules: map[string]RiskRule{"X": {}}}}); !errors.Is(err, ErrInvalidRiskWeights) {
+		t.Errorf("unknown flag: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+var ErrInvalidWhitelist = errors.New("invalid whitelist entry")
+
+// Whitelist rule types; a matching user is whitelisted like a listed user ID
+const (
+	WhitelistRuleGroup       = "group"        // users.group 等于 value
+	WhitelistRuleEmailDomain = "email_domain" // 邮箱域名等于 value（不区分大小写）
+	WhitelistRuleTrustLevel  = "trust_level"  // linux.do 信任等级 >= value
+)
+
+// normalizeWhitelistRule validates a rule and canonicalizes its value
+func normalizeWhitelistRule(r *api.WhitelistRule) error {
+	r.Type = strings.TrimSpace(strings.ToLower(r.Type))
+	r.Value = strings.TrimSpace(r.Value)
+	r.Reason = strings.TrimSpace(r.Reason)
+	switch r.Type {
+	case WhitelistRuleGroup:
+		if r.Value == "" || len(r.Value) > 64 {
+			return fmt.Errorf("%w: 分组名需为 1-64 个字符", ErrInvalidWhitelist)
+		}
+	case WhitelistRuleEmailDomain:
+		r.Value = strings.ToLower(strings.TrimPrefix(r.Value, "@"))
+		if !strings.Contains(r.Value, ".") || strings.ContainsAny(r.Value, "@ ") {
+			return fmt.Errorf("%w: 无效的邮箱域名 %q", ErrInvalidWhitelist, r.Value)
+		}
+	case WhitelistRuleTrustLevel:
+		level, err := strconv.Atoi(r.Value)
+		if err != nil || level < 0 || level > 4 {
+			return fmt.Errorf("%w: 信任等级需为 0-4", ErrInvalidWhitelist)
+		}
+		r.Value = strconv.Itoa(level)
+	default:
+		return fmt.Errorf("%w: 未知的规则类型 %q（可选 group / email_domain / trust_level）", ErrInvalidWhitelist, r.Type)
+	}
+	if r.ExpiresAt < 0 || (r.ExpiresAt > 0 && r.ExpiresAt <= time.Now().Unix()) {
+		return fmt.Errorf("%w: expires_at 需晚于当前时间", ErrInvalidWhitelist)
+	}
+	return nil
+}
+
+// loadWhitelistRules returns the unexpired rules
+func loadWhitelistRules(cm *cache.Manager) []api.WhitelistRule {
+	var rules []api.WhitelistRule
+	cm.GetJSON("ai_ban:whitelist_rules", &rules)
+	now := time.Now().Unix()
+	return slices.DeleteFunc(rules, func(r api.WhitelistRule) bool { return r.ExpiresAt > 0 && r.ExpiresAt <= now })
+}
+
+// ListWhitelistRules returns the unexpired whitelist rules
+func (s *AIAutoBanService) ListWhitelistRules() []api.WhitelistRule {
+	rules := loadWhitelistRules(cache.Get())
+	if rules == nil {
+		rules = []api.WhitelistRule{}
+	}
+	return rules
+}
+
+// AddWhitelistRule adds a rule; a rule with the same type and value is
+// updated in place with the new reason and expiry
+func (s *AIAutoBanService) AddWhitelistRule(in api.WhitelistRule) (*api.WhitelistRule, error) {
+	if err := normalizeWhitelistRule(&in); err != nil {
+		return nil, err
+	}
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+	rule, _ := s.addWhitelistRule(in)
+	return &rule, nil
+}
+
+// addWhitelistRule stores a normalized rule and reports whether it is new;
+// callers hold configWriteMu
+func (s *AIAutoBanService) addWhitelistRule(in api.WhitelistRule) (api.WhitelistRule, bool) {
+	cm := cache.Get()
+	rules := loadWhitelistRules(cm)
+	for i := range rules {
+		if rules[i].Type == in.Type && rules[i].Value == in.Value {
+			rules[i].Reason, rules[i].ExpiresAt = in.Reason, in.ExpiresAt
+			cm.Set("ai_ban:whitelist_rules", rules, 0)
+			return rules[i], false
+		}
+	}
+	in.ID, in.CreatedAt = 1, time.Now().Unix()
+	for _, r := range rules {
+		in.ID = max(in.ID, r.ID+1)
+	}
+	cm.Set("ai_ban:whitelist_rules", append(rules, in), 0)
+	return in, true
+}
+
+// RemoveWhitelistRule deletes a rule by id
+func (s *AIAutoBanService) RemoveWhitelistRule(id int64) bool {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+	cm := cache.Get()
+	rules := loadWhitelistRules(cm)
+	n := len(rules)
+	rules = slices.DeleteFunc(rules, func(r api.WhitelistRule) bool { return r.ID == id })
+	if len(rules) == n {
+		return false
+	}
+	cm.Set("ai_ban:whitelist_rules", rules, 0)
+	return true
+}
+
+// WhitelistImportInput is a bulk import. Each entry is a user ID or a rule
+// written as group:<name>, email:<domain> (or @<domain>) or trust_level:<n>.
+type WhitelistImportInput struct {
+	Entries   []string `json:"entries"`
+	Reason    string   `json:"reason"`
+	ExpiresAt int64    `json:"expires_at"` // 0 = 永久
+}
+
+// WhitelistImportResult counts what a bulk import changed
+type WhitelistImportResult struct {
+	UsersAdded   int      `json:"users_added"`
+	RulesAdded   int      `json:"rules_added"`
+	Updated      int      `json:"updated"` // 已存在，更新了原因 / 过期时间
+	Invalid      []string `json:"invalid"`
+	InvalidCount int      `json:"invalid_count"`
+}
+
+// parseWhitelistEntry parses one bulk import entry into a user ID or a rule
+func parseWhitelistEntry(entry string) (int64, *api.WhitelistRule, error) {
+	entry = strings.TrimSpace(entry)
+	if id, err := strconv.ParseInt(entry, 10, 64); err == nil {
+		if id <= 0 {
+			return 0, nil, fmt.Errorf("%w: 无效的用户 ID", ErrInvalidWhitelist)
+		}
+		return id, nil, nil
+	}
+	if strings.HasPrefix(entry, "@") {
+		return 0, &api.WhitelistRule{Type: WhitelistRuleEmailDomain, Value: entry}, nil
+	}
+	typ, value, ok := strings.Cut(entry, ":")
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: 无法识别", ErrInvalidWhitelist)
+	}
+	switch strings.TrimSpace(strings.ToLower(typ)) {
+	case "group":
+		typ = WhitelistRuleGroup
+	case "email", "email_domain", "domain":
+		typ = WhitelistRuleEmailDomain
+	case "trust_level", "tl":
+		typ = WhitelistRuleTrustLevel
+	}
+	return 0, &api.WhitelistRule{Type: typ, Value: value}, nil
+}
+
+// ImportWhitelist adds user IDs and rules in bulk; invalid entries are
+// reported and skipped
+func (s *AIAutoBanService) ImportWhitelist(in WhitelistImportInput) (*WhitelistImportResult, error) {
+	if len(in.Entries) == 0 || len(in.Entries) > 5000 {
+		return nil, fmt.Errorf("%w: entries 需为 1-5000 条", ErrInvalidWhitelist)
+	}
+	if in.ExpiresAt < 0 || (in.ExpiresAt > 0 && in.ExpiresAt <= time.Now().Unix()) {
+		return nil, fmt.Errorf("%w: expires_at 需晚于当前时间", ErrInvalidWhitelist)
+	}
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	result := &WhitelistImportResult{Invalid: []string{}}
+	for _, entry := range in.Entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		userID, rule, err := parseWhitelistEntry(entry)
+		if err == nil && rule != nil {
+			rule.Reason, rule.ExpiresAt = in.Reason, in.ExpiresAt
+			err = normalizeWhitelistRule(rule)
+		}
+		if err != nil {
+			result.InvalidCount++
+			if len(result.Invalid) < 100 {
+				result.Invalid = append(result.Invalid, fmt.Sprintf("%s: %s", strings.TrimSpace(entry), strings.TrimPrefix(err.Error(), ErrInvalidWhitelist.Error()+": ")))
+			}
+			continue
+		}
+		var added bool
+		if rule != nil {
+			_, added = s.addWhitelistRule(*rule)
+		} else {
+			added = s.addToWhitelist(userID, in.Reason, in.ExpiresAt)
+		}
+		switch {
+		case !added:
+			result.Updated++
+		case rule != nil:
+			result.RulesAdded++
+		default:
+			result.UsersAdded++
+		}
+	}
+	logger.L.Business(fmt.Sprintf("[AI 封禁] 白名单批量导入: 用户 %d, 规则 %d, 更新 %d, 无效 %d",
+		result.UsersAdded, result.RulesAdded, result.Updated, result.InvalidCount))
+	return result, nil
+}
+
+// whitelistSubject is what the whitelist rules look at for one user
+type whitelistSubject struct {
+	UserID    int64
+	Group     string
+	Email     string
+	LinuxDoID string
+}
+
+// whitelistMatcher is a snapshot of the whitelist (user IDs and rules) with
+// expired entries dropped
+type whitelistMatcher struct {
+	users map[int64]bool
+	rules []api.WhitelistRule
+	// trustLookups bounds the linux.do lookups for uncached trust levels
+	trustLookups int
+}
+
+func loadWhitelistMatcher() *whitelistMatcher {
+	cm := cache.Get()
+	m := &whitelistMatcher{users: map[int64]bool{}, rules: loadWhitelistRules(cm)}
+	var ids []int64
+	cm.GetJSON("ai_ban:whitelist", &ids)
+	var reasons map[string]whitelistReason
+	cm.GetJSON("ai_ban:whitelist_reasons", &reasons)
+	now := time.Now().Unix()
+	for _, id := range ids {
+		if r := reasons[strconv.FormatInt(id, 10)]; r.ExpiresAt > 0 && r.ExpiresAt <= now {
+			continue
+		}
+		m.users[id] = true
+	}
+	return m
+}
+
+func (m *whitelistMatcher) hasRules() bool {
+	return len(m.rules) > 0
+}
+
+// isWhitelisted reports whether a user is whitelisted and by what: "user"
+// for a listed ID, otherwise the matching rule (e.g. group:vip)
+func (m *whitelistMatcher) isWhitelisted(u whitelistSubject) (string, bool) {
+	if m.users[u.UserID] {
+		return "user", true
+	}
+	trustLevel, trustKnown := -1, false
+	for _, r := range m.rules {
+		switch r.Type {
+		case WhitelistRuleGroup:
+			if u.Group == r.Value {
+				return r.String(), true
+			}
+		case WhitelistRuleEmailDomain:
+			if _, domain, ok := strings.Cut(u.Email, "@"); ok && strings.EqualFold(domain, r.Value) {
+				return r.String(), true
+			}
+		case WhitelistRuleTrustLevel:
+			if u.LinuxDoID == "" {
+				continue
+			}
+			if !trustKnown {
+				trustLevel, trustKnown = m.trustLevel(u.LinuxDoID), true
+			}
+			if atLeast, _ := strconv.Atoi(r.Value); trustLevel >= atLeast {
+				return r.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// trustLevel returns a cached linux.do trust level, looking it up while the
+// lookup budget lasts; -1 when unknown
+func (m *whitelistMatcher) trustLevel(linuxDoID string) int {
+	if level, ok := CachedLinuxDoTrustLevel(linuxDoID); ok {
+		return level
+	}
+	if m.trustLookups <= 0 {
+		return -1
+	}
+	m.trustLookups--
+	level, err := linuxDoTrustLevelLookup(linuxDoID)
+	if err != nil {
+		logger.L.Warn(fmt.Sprintf("[AI 封禁] 白名单信任等级查询失败: linux_do_id=%s err=%v", linuxDoID, err))
+		return -1
+	}
+	return level
+}
+
+// whitelistedUsers returns the whitelisted users among ids with what matched
+// them. Rules need the users' group / email / linux_do_id, which are read in
+// batches only when rules exist; at most trustLookups uncached trust levels
+// are fetched from linux.do.
+func whitelistedUsers(db *database.Manager, ids []int64, trustLookups int) (map[int64]string, error) {
+	m := loadWhitelistMatcher()
+	m.trustLookups = trustLookups
+	out := map[int64]string{}
+	pending := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		if by, ok := m.isWhitelisted(whitelistSubject{UserID: id}); ok {
+			out[id] = by
+		} else if m.hasRules() {
+			pending = append(pending, id)
+		}
+	}
+	if len(pending) == 0 {
+		return out, nil
+	}
+
+	groupCol := "`group`"
+	if db.IsPG {
+		groupCol = `"group"`
+	}
+	linuxDoCol := "''"
+	if slices.Contains(NewUserManagementService().getAvailableOAuthColumns(), "linux_do_id") {
+		linuxDoCol = "COALESCE(linux_do_id, '')"
+	}
+	for start := 0; start < len(pending); start += 500 {
+		batch := pending[start:min(start+500, len(pending))]
+		rows, err := db.Query(db.RebindQuery(fmt.Sprintf(
+			"SELECT id, COALESCE(%s, '') as user_group, COALESCE(email, '') as email, %s as linux_do_id FROM users WHERE id IN (%s)",
+			groupCol, linuxDoCol, buildPlaceholders(db.IsPG, len(batch), 1))), batch...)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			u := whitelistSubject{
+				UserID:    toInt64(row["id"]),
+				Group:     toString(row["user_group"]),
+				Email:     toString(row["email"]),
+				LinuxDoID: toString(row["linux_do_id"]),
+			}
+			if by, ok := m.isWhitelisted(u); ok {
+				out[u.UserID] = by
+			}
+		}
+	}
+	return out, nil
+}
+
+// IsWhitelisted reports whether one user is whitelisted (by ID or rule) and
+// what matched
+func (s *AIAutoBanService) IsWhitelisted(ctx context.Context, userID int64) (string, bool, error) {
+	matched, err := whitelistedUsers(s.db.WithContext(ctx), []int64{userID}, 1)
+	if err != nil {
+		return "", false, err
+	}
+	by, ok := matched[userID]
+	return by, ok, nil
+}
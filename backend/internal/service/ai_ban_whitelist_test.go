@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+func clearWhitelistCache(t *testing.T) {
+	t.Helper()
+	cm := cache.Get()
+	reset := func() {
+		cm.Delete("ai_ban:whitelist")
+		cm.Delete("ai_ban:whitelist_reasons")
+		cm.Delete("ai_ban:whitelist_rules")
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestWhitelistRulesAndImport(t *testing.T) {
+	clearWhitelistCache(t)
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, status INTEGER, "group" TEXT, email TEXT);
+		INSERT INTO users VALUES
+			(1, 'alice', 1, 'vip', 'alice@example.com'),
+			(2, 'bob', 1, 'default', 'bob@Corp.example'),
+			(3, 'carol', 1, 'default', 'carol@other.example'),
+			(4, 'dave', 1, 'default', '');`); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAIAutoBanService()
+	ctx := context.Background()
+
+	if _, err := svc.AddWhitelistRule(api.WhitelistRule{Type: "group", Value: "vip"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AddWhitelistRule(api.WhitelistRule{Type: "bogus", Value: "x"}); !errors.Is(err, ErrInvalidWhitelist) {
+		t.Errorf("unknown type: %v", err)
+	}
+	if _, err := svc.AddWhitelistRule(api.WhitelistRule{Type: "trust_level", Value: "9"}); !errors.Is(err, ErrInvalidWhitelist) {
+		t.Errorf("trust level out of range: %v", err)
+	}
+
+	result, err := svc.ImportWhitelist(WhitelistImportInput{
+		Entries: []string{"4", "@CORP.example", "group:vip", "nonsense", "tl:7", ""},
+		Reason:  "合作方",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UsersAdded != 1 || result.RulesAdded != 1 || result.Updated != 1 || result.InvalidCount != 2 {
+		t.Errorf("import result = %+v", result)
+	}
+
+	matched, err := whitelistedUsers(database.Get(), []int64{1, 2, 3, 4, 5}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]string{1: "group:vip", 2: "email_domain:corp.example", 4: "user"}
+	if len(matched) != len(want) {
+		t.Fatalf("matched = %v, want %v", matched, want)
+	}
+	for id, by := range want {
+		if matched[id] != by {
+			t.Errorf("user %d matched by %q, want %q", id, matched[id], by)
+		}
+	}
+
+	rules := svc.ListWhitelistRules()
+	if len(rules) != 2 || rules[0].Reason != "合作方" {
+		t.Fatalf("rules = %+v", rules)
+	}
+	if !svc.RemoveWhitelistRule(rules[0].ID) || svc.RemoveWhitelistRule(rules[0].ID) {
+		t.Error("remove should succeed exactly once")
+	}
+	if by, ok, _ := svc.IsWhitelisted(ctx, 1); ok {
+		t.Errorf("user 1 still whitelisted by %q after the group rule was removed", by)
+	}
+}
+
+func TestWhitelistExpiry(t *testing.T) {
+	clearWhitelistCache(t)
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, status INTEGER);
+		INSERT INTO users VALUES (1, 'alice', 1), (2, 'bob', 1);`); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAIAutoBanService()
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	svc.AddToWhitelist(1, "临时放行", now+3600)
+	svc.AddToWhitelist(2, "", 0)
+	if _, ok, _ := svc.IsWhitelisted(ctx, 1); !ok {
+		t.Fatal("user 1 should be whitelisted until expiry")
+	}
+
+	// Simulate the expiry passing
+	cm := cache.Get()
+	var reasons map[string]whitelistReason
+	cm.GetJSON("ai_ban:whitelist_reasons", &reasons)
+	r := reasons["1"]
+	r.ExpiresAt = now - 1
+	reasons["1"] = r
+	cm.Set("ai_ban:whitelist_reasons", reasons, 0)
+
+	if _, ok, _ := svc.IsWhitelisted(ctx, 1); ok {
+		t.Error("expired user should not be whitelisted")
+	}
+	if items := svc.GetWhitelist().Items; len(items) != 1 || items[0].ID != 2 {
+		t.Errorf("whitelist items = %v", items)
+	}
+	// Re-adding an expired user counts as an add and makes it permanent
+	if msg := svc.AddToWhitelist(1, "", 0).Message; msg == "用户已在白名单中" {
+		t.Error("expired entry should be re-added")
+	}
+	if _, ok, _ := svc.IsWhitelisted(ctx, 1); !ok {
+		t.Error("re-added user should be whitelisted")
+	}
+
+	rule := api.WhitelistRule{Type: WhitelistRuleGroup, Value: "vip", ExpiresAt: now - 10}
+	if err := normalizeWhitelistRule(&rule); !errors.Is(err, ErrInvalidWhitelist) {
+		t.Errorf("past expires_at: %v", err)
+	}
+	cm.Set("ai_ban:whitelist_rules", []api.WhitelistRule{{ID: 1, Type: WhitelistRuleGroup, Value: "vip", ExpiresAt: now - 10}}, 0)
+	if rules := svc.ListWhitelistRules(); len(rules) != 0 {
+		t.Errorf("expired rules are listed: %+v", rules)
+	}
+}
+
+func TestWhitelistTrustLevelRule(t *testing.T) {
+	cm := cache.Get()
+	t.Cleanup(func() {
+		cm.Delete(ldTrustLevelCachePrefix + "100")
+		cm.Delete(ldTrustLevelCachePrefix + "200")
+	})
+	cm.Set(ldTrustLevelCachePrefix+"100", 3, time.Hour)
+	lookups := 0
+	orig := linuxDoTrustLevelLookup
+	linuxDoTrustLevelLookup = func(string) (int, error) {
+		lookups++
+		return 1, nil
+	}
+	t.Cleanup(func() { linuxDoTrustLevelLookup = orig })
+
+	m := &whitelistMatcher{users: map[int64]bool{}, rules: []api.WhitelistRule{{Type: WhitelistRuleTrustLevel, Value: "2"}}}
+	if by, ok := m.isWhitelisted(whitelistSubject{UserID: 1, LinuxDoID: "100"}); !ok || by != "trust_level:2" {
+		t.Errorf("cached trust level 3: %q %v", by, ok)
+	}
+	// No lookup budget: an uncached trust level is unknown
+	if _, ok := m.isWhitelisted(whitelistSubject{UserID: 2, LinuxDoID: "200"}); ok || lookups != 0 {
+		t.Errorf("uncached without budget: ok=%v lookups=%d", ok, lookups)
+	}
+	m.trustLookups = 1
+	if _, ok := m.isWhitelisted(whitelistSubject{UserID: 2, LinuxDoID: "200"}); ok || lookups != 1 {
+		t.Errorf("looked up level 1: ok=%v lookups=%d", ok, lookups)
+	}
+	if _, ok := m.isWhitelisted(whitelistSubject{UserID: 3}); ok {
+		t.Error("user without linux_do_id matched a trust level rule")
+	}
+}
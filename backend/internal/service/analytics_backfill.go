@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const rollupBackfillKey = "analytics_rollup_backfill"
+
+// Rollup backfill job states
+const (
+	RollupBackfillPending   = "pending" // 等待执行或被中断，后台分析任务会继续
+	RollupBackfillRunning   = "running"
+	RollupBackfillCompleted = "completed"
+	RollupBackfillFailed    = "failed"
+	RollupBackfillCanceled  = "canceled"
+)
+
+var (
+	ErrRollupBackfillRunning = errors.New("rollup backfill already running")
+	ErrInvalidRollupBackfill = errors.New("invalid rollup backfill")
+)
+
+// RollupBackfillJob reconstructs the hourly rollups (the local equivalent of
+// quota_data) from logs further back than the regular 30-day backfill. It
+// walks log ids downwards in batches; each batch is merged in the same local
+// transaction that lowers the cursor's start_log_id, so it resumes after an
+// interruption without double counting.
+type RollupBackfillJob struct {
+	Status       string  `json:"status"`
+	Days         int     `json:"days"`
+	Rebuild      bool    `json:"rebuild"`        // 先清空汇总表再重建（修复损坏数据）
+	TargetSince  int64   `json:"target_since"`   // 回填完成后汇总表覆盖的最早时间
+	TargetLogID  int64   `json:"target_log_id"`  // target_since 之后的第一条日志
+	InitialLogID int64   `json:"initial_log_id"` // 任务开始时汇总表的下界
+	CurrentLogID int64   `json:"current_log_id"` // 汇总表已包含 id > current_log_id 的日志
+	Processed    int64   `json:"processed"`
+	Upserted     int64   `json:"upserted"`
+	Batches      int     `json:"batches"`
+	Progress     float64 `json:"progress"` // 0-100
+	Error        string  `json:"error,omitempty"`
+	CreatedAt    int64   `json:"created_at"`
+	UpdatedAt    int64   `json:"updated_at"`
+	CompletedAt  int64   `json:"completed_at"`
+}
+
+// rollupBackfillState guards against two batch loops running at once
+var rollupBackfillState struct {
+	sync.Mutex
+	running  bool
+	canceled bool
+}
+
+func (j *RollupBackfillJob) updateProgress() {
+	total := j.InitialLogID - (j.TargetLogID - 1)
+	switch {
+	case j.Status == RollupBackfillCompleted:
+		j.Progress = 100
+	case total > 0:
+		done := j.InitialLogID - j.CurrentLogID
+		j.Progress = float64(int64(float64(done)/float64(total)*10000)) / 100
+	}
+}
+
+// GetBackfill returns the current (or last) backfill job; Status is "" if none was started
+func (s *AnalyticsRollupService) GetBackfill(ctx context.Context) (RollupBackfillJob, error) {
+	var job RollupBackfillJob
+	_, err := loadLocalSetting(ctx, rollupBackfillKey, &job)
+	job.updateProgress()
+	return job, err
+}
+
+// StartBackfill records a job extending the rollups back to days ago (local
+// midnight). rebuild drops the existing rollups first, for when they are
+// known to be wrong. The batches run in RunBackfill.
+func (s *AnalyticsRollupService) StartBackfill(ctx context.Context, days int, rebuild bool) (RollupBackfillJob, error) {
+	if days < 1 || days > analyticsRollupRetentionDays {
+		return RollupBackfillJob{}, fmt.Errorf("%w: days must be 1-%d", ErrInvalidRollupBackfill, analyticsRollupRetentionDays)
+	}
+	rollupBackfillState.Lock()
+	defer rollupBackfillState.Unlock()
+	if rollupBackfillState.running {
+		return RollupBackfillJob{}, ErrRollupBackfillRunning
+	}
+
+	now := time.Now()
+	job := RollupBackfillJob{
+		Status:      RollupBackfillPending,
+		Days:        days,
+		Rebuild:     rebuild,
+		TargetSince: reportDayStart(now.AddDate(0, 0, -days)).Unix(),
+		CreatedAt:   now.Unix(),
+		UpdatedAt:   now.Unix(),
+	}
+
+	err := withRollupStore(ctx, func(db *sql.DB) error {
+		if rebuild {
+			if err := s.resetRollups(ctx, db); err != nil {
+				return err
+			}
+		}
+		cur, found, err := loadLogCursor(ctx, db, analyticsRollupCursor)
+		if err != nil {
+			return err
+		}
+		if !found {
+			// Start from the newest log: the regular sync keeps up from there
+			// while this job fills everything older.
+			maxRow, err := s.logDB.WithContext(ctx).QueryOneWithTimeout(15*time.Second, `SELECT COALESCE(MAX(id), 0) as max_id FROM logs`)
+			if err != nil {
+				return fmt.Errorf("max log id query failed: %w", err)
+			}
+			maxID := toInt64(maxRow["max_id"])
+			cur = LogCursor{Name: analyticsRollupCursor, LastLogID: maxID, StartLogID: maxID, BackfillSince: now.Unix()}
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			if err := saveLogCursor(ctx, tx, cur); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+		}
+
+		row, err := s.logDB.WithContext(ctx).QueryOneWithTimeout(60*time.Second, s.logDB.RebindQuery(
+			`SELECT COALESCE(MIN(id), 0) as min_id FROM logs WHERE created_at >= ?`), job.TargetSince)
+		if err != nil {
+			return fmt.Errorf("backfill target query failed: %w", err)
+		}
+		job.TargetLogID = toInt64(row["min_id"])
+		if job.TargetLogID == 0 {
+			job.TargetLogID = cur.StartLogID + 1
+		}
+		job.InitialLogID = cur.StartLogID
+		job.CurrentLogID = cur.StartLogID
+		return nil
+	})
+	if err != nil {
+		return job, err
+	}
+	job.updateProgress()
+	return job, saveLocalSetting(ctx, rollupBackfillKey, job)
+}
+
+// CancelBackfill stops a pending or running job; the rollups keep whatever was merged
+func (s *AnalyticsRollupService) CancelBackfill(ctx context.Context) (RollupBackfillJob, error) {
+	rollupBackfillState.Lock()
+	defer rollupBackfillState.Unlock()
+	job, err := s.GetBackfill(ctx)
+	if err != nil {
+		return job, err
+	}
+	if job.Status != RollupBackfillPending && job.Status != RollupBackfillRunning {
+		return job, nil
+	}
+	if rollupBackfillState.running {
+		rollupBackfillState.canceled = true
+	}
+	job.Status = RollupBackfillCanceled
+	job.UpdatedAt = time.Now().Unix()
+	return job, saveLocalSetting(ctx, rollupBackfillKey, job)
+}
+
+// RunBackfill advances the pending job by at most maxBatches batches (<= 0:
+// until done or ctx ends). It returns nil when there is nothing to do.
+func (s *AnalyticsRollupService) RunBackfill(ctx context.Context, maxBatches int) (*RollupBackfillJob, error) {
+	if maxBatches <= 0 {
+		maxBatches = math.MaxInt32
+	}
+	rollupBackfillState.Lock()
+	if rollupBackfillState.running {
+		rollupBackfillState.Unlock()
+		return nil, ErrRollupBackfillRunning
+	}
+	job, err := s.GetBackfill(ctx)
+	if err != nil || (job.Status != RollupBackfillPending && job.Status != RollupBackfillRunning) {
+		rollupBackfillState.Unlock()
+		return nil, err
+	}
+	rollupBackfillState.running = true
+	rollupBackfillState.canceled = false
+	rollupBackfillState.Unlock()
+	defer func() {
+		rollupBackfillState.Lock()
+		rollupBackfillState.running = false
+		rollupBackfillState.Unlock()
+	}()
+
+	err = withRollupStore(ctx, func(db *sql.DB) error {
+		return s.runBackfillBatches(ctx, db, &job, maxBatches)
+	})
+
+	rollupBackfillState.Lock()
+	canceled := rollupBackfillState.canceled
+	rollupBackfillState.Unlock()
+	switch {
+	case canceled:
+		job.Status = RollupBackfillCanceled
+	case err != nil && ctx.Err() == nil:
+		job.Status = RollupBackfillFailed
+		job.Error = err.Error()
+	case job.Status == RollupBackfillRunning:
+		// out of batches or interrupted: the next round picks it up again
+		job.Status = RollupBackfillPending
+	}
+	job.UpdatedAt = time.Now().Unix()
+	job.updateProgress()
+	if saveErr := saveLocalSetting(context.WithoutCancel(ctx), rollupBackfillKey, job); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if job.Status == RollupBackfillCompleted {
+		logger.L.Info(fmt.Sprintf("[分析汇总] 历史回填完成：覆盖最近 %d 天，合并 %d 行", job.Days, job.Upserted), logger.CatAnalytics)
+	}
+	return &job, err
+}
+
+func (s *AnalyticsRollupService) runBackfillBatches(ctx context.Context, db *sql.DB, job *RollupBackfillJob, maxBatches int) error {
+	// The cursor is the source of truth: the job record may lag one batch
+	// behind if the process stopped between the two writes.
+	cur, found, err := loadLogCursor(ctx, db, analyticsRollupCursor)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: rollups were reset, start the backfill again", ErrInvalidRollupBackfill)
+	}
+	job.CurrentLogID = cur.StartLogID
+	job.Status = RollupBackfillRunning
+	job.Error = ""
+
+	for batches := 0; batches < maxBatches && job.CurrentLogID >= job.TargetLogID; batches++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rollupBackfillState.Lock()
+		canceled := rollupBackfillState.canceled
+		rollupBackfillState.Unlock()
+		if canceled {
+			return nil
+		}
+
+		hi := job.CurrentLogID
+		lo := hi - scaleBatchSize()
+		if lo < job.TargetLogID-1 {
+			lo = job.TargetLogID - 1
+		}
+		rows, err := s.fetchRollupBatch(ctx, lo, hi)
+		if err != nil {
+			return fmt.Errorf("backfill batch query failed: %w", err)
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := writeAnalyticsRollupRows(ctx, tx, rows); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE log_cursors SET start_log_id = ? WHERE name = ?`, lo, analyticsRollupCursor); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		job.CurrentLogID = lo
+		job.Processed += hi - lo
+		job.Upserted += int64(len(rows))
+		job.Batches++
+		job.UpdatedAt = time.Now().Unix()
+		job.updateProgress()
+		_ = saveLocalSetting(ctx, rollupBackfillKey, *job)
+	}
+
+	if job.CurrentLogID < job.TargetLogID {
+		if _, err := db.ExecContext(ctx, `UPDATE log_cursors SET backfill_since = ? WHERE name = ? AND backfill_since > ?`,
+			job.TargetSince, analyticsRollupCursor, job.TargetSince); err != nil {
+			return err
+		}
+		job.Status = RollupBackfillCompleted
+		job.CompletedAt = time.Now().Unix()
+	}
+	return nil
+}
+
+// DailyTrends returns per-local-day successes, quota and distinct users
+// between startTime and endTime in the shape of the quota_data / logs queries
+// of the dashboard (day_group as in reportDayExpr)
+func (s *AnalyticsRollupService) DailyTrends(ctx context.Context, startTime, endTime int64) ([]map[string]interface{}, error) {
+	byDay := map[int64]map[string]interface{}{}
+	err := withRollupStore(ctx, func(db *sql.DB) error {
+		dayExpr := fmt.Sprintf("(hour + %s) / 86400", reportTZOffsetSQL("hour", startTime, endTime))
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT %s as day_group, SUM(successes), SUM(quota)
+			FROM analytics_model_hourly WHERE hour >= ?
+			GROUP BY day_group`, dayExpr), startTime-startTime%3600)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var day, requests, quota int64
+			if err := rows.Scan(&day, &requests, &quota); err != nil {
+				rows.Close()
+				return err
+			}
+			byDay[day] = map[string]interface{}{"day_group": day, "request_count": requests, "quota_used": quota, "unique_users": int64(0)}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT %s as day_group, COUNT(DISTINCT user_id)
+			FROM analytics_user_hourly WHERE hour >= ?
+			GROUP BY day_group`, dayExpr), startTime-startTime%3600)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var day, users int64
+			if err := rows.Scan(&day, &users); err != nil {
+				return err
+			}
+			if byDay[day] == nil {
+				byDay[day] = map[string]interface{}{"day_group": day, "request_count": int64(0), "quota_used": int64(0)}
+			}
+			byDay[day]["unique_users"] = users
+		}
+		return rows.Err()
+	})
+	out := make([]map[string]interface{}, 0, len(byDay))
+	for _, row := range byDay {
+		out = append(out, row)
+	}
+	return out, err
+}
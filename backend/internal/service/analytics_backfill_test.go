@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestRollupBackfillExtendsCoverageResumably(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, user_id INTEGER, username TEXT, model_name TEXT, ip TEXT,
+		type INTEGER, quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, created_at INTEGER)`)
+	// one log per day for 60 days, ids spaced out so the walk takes several batches
+	now := time.Now()
+	for d := 59; d >= 0; d-- {
+		id := int64(60-d) * 3000
+		db.MustExec(`INSERT INTO logs (id, user_id, username, model_name, type, quota, prompt_tokens, completion_tokens, created_at)
+			VALUES (?, ?, 'u', 'gpt-4o', 2, 10, 1, 1, ?)`, id, 1+d%3, now.AddDate(0, 0, -d).Unix()-60)
+	}
+
+	ctx := context.Background()
+	rollup := NewAnalyticsRollupService()
+	if _, err := rollup.Sync(ctx, 0); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	sixtyDays := now.AddDate(0, 0, -59).Unix() - 3600
+	if rollup.Covers(ctx, sixtyDays) {
+		t.Fatal("the regular sync only backfills 30 days")
+	}
+
+	if _, err := rollup.StartBackfill(ctx, 0, false); !errors.Is(err, ErrInvalidRollupBackfill) {
+		t.Fatalf("days=0 should be rejected, got %v", err)
+	}
+	job, err := rollup.StartBackfill(ctx, 60, false)
+	if err != nil || job.Status != RollupBackfillPending {
+		t.Fatalf("StartBackfill = %+v, %v", job, err)
+	}
+
+	// an interrupted run leaves the job pending with partial progress
+	partial, err := rollup.RunBackfill(ctx, 2)
+	if err != nil || partial.Status != RollupBackfillPending || partial.Progress <= 0 || partial.Progress >= 100 {
+		t.Fatalf("partial run = %+v, %v", partial, err)
+	}
+	done, err := rollup.RunBackfill(ctx, 0)
+	if err != nil || done.Status != RollupBackfillCompleted || done.Progress != 100 {
+		t.Fatalf("resumed run = %+v, %v", done, err)
+	}
+	if again, err := rollup.RunBackfill(ctx, 0); err != nil || again != nil {
+		t.Fatalf("a completed job has nothing left to do, got %+v, %v", again, err)
+	}
+
+	if !rollup.Covers(ctx, sixtyDays) {
+		t.Fatal("rollups should cover 60 days after the backfill")
+	}
+	trends, err := NewDashboardService().GetDailyTrends(60, true)
+	if err != nil {
+		t.Fatalf("GetDailyTrends: %v", err)
+	}
+	var requests, quota int64
+	for _, row := range trends {
+		requests += row.RequestCount
+		quota += row.QuotaUsed
+	}
+	if requests != 60 || quota != 600 {
+		t.Fatalf("every log should be counted exactly once, got %d requests / %d quota", requests, quota)
+	}
+
+	// rebuild starts from scratch and ends with the same totals
+	if _, err := rollup.StartBackfill(ctx, 60, true); err != nil {
+		t.Fatalf("StartBackfill rebuild: %v", err)
+	}
+	if job, err := rollup.RunBackfill(ctx, 0); err != nil || job.Status != RollupBackfillCompleted {
+		t.Fatalf("rebuild = %+v, %v", job, err)
+	}
+	rows, err := rollup.DailyTrends(ctx, sixtyDays, now.Unix())
+	if err != nil {
+		t.Fatalf("DailyTrends: %v", err)
+	}
+	requests = 0
+	for _, row := range rows {
+		requests += toInt64(row["request_count"])
+	}
+	if requests != 60 {
+		t.Fatalf("rebuilt rollups should hold 60 requests, got %d", requests)
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	analyticsRollupCursor = "analytics_rollup"
+	// analyticsRollupBackfillDays matches the 30-day window of the rankings
+	analyticsRollupBackfillDays = 30
+	// analyticsRollupRetentionDays bounds the size of the hourly tables
+	analyticsRollupRetentionDays = 90
+)
+
+// AnalyticsRollupState is the sync cursor and size of the rollup tables
+type AnalyticsRollupState struct {
+	LogCursor
+	UserRows  int64 `json:"user_rows"`
+	ModelRows int64 `json:"model_rows"`
+}
+
+// AnalyticsRollupService materializes per-user and per-model hourly
+// aggregates of logs into the local store, fed incrementally by the
+// analytics processor, so rankings and model statistics stop scanning logs.
+type AnalyticsRollupService struct {
+	logDB *database.Manager
+}
+
+// NewAnalyticsRollupService creates an AnalyticsRollupService on the primary instance
+func NewAnalyticsRollupService() *AnalyticsRollupService {
+	return &AnalyticsRollupService{logDB: database.GetReadLog()}
+}
+
+func ensureAnalyticsRollupTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS analytics_user_hourly (
+			hour INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			requests INTEGER NOT NULL DEFAULT 0,
+			quota INTEGER NOT NULL DEFAULT 0,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (hour, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_analytics_user_hourly_user ON analytics_user_hourly(user_id);
+		CREATE TABLE IF NOT EXISTS analytics_model_hourly (
+			hour INTEGER NOT NULL,
+			model_name TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			successes INTEGER NOT NULL DEFAULT 0,
+			failures INTEGER NOT NULL DEFAULT 0,
+			empty_count INTEGER NOT NULL DEFAULT 0,
+			quota INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (hour, model_name)
+		)`)
+	return err
+}
+
+// withRollupStore opens the local store with the rollup tables in place
+func withRollupStore(ctx context.Context, fn func(db *sql.DB) error) error {
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureAnalyticsRollupTables(ctx, db); err != nil {
+		return err
+	}
+	return fn(db)
+}
+
+// GetState returns the rollup cursor and table sizes
+func (s *AnalyticsRollupService) GetState(ctx context.Context) (AnalyticsRollupState, error) {
+	var st AnalyticsRollupState
+	err := withRollupStore(ctx, func(db *sql.DB) error {
+		cur, _, err := loadLogCursor(ctx, db, analyticsRollupCursor)
+		st.LogCursor = cur
+		if err != nil {
+			return err
+		}
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM analytics_user_hourly`).Scan(&st.UserRows); err != nil {
+			return err
+		}
+		return db.QueryRowContext(ctx, `SELECT COUNT(*) FROM analytics_model_hourly`).Scan(&st.ModelRows)
+	})
+	return st, err
+}
+
+// Covers reports whether the rollups are caught up and reach back to since
+func (s *AnalyticsRollupService) Covers(ctx context.Context, since int64) bool {
+	st, err := s.GetState(ctx)
+	return err == nil && logCursorCovers(st.LogCursor, since)
+}
+
+// Sync folds logs newer than the cursor into the hourly rollups (at most
+// maxBatches batches) and prunes hours past the retention window
+func (s *AnalyticsRollupService) Sync(ctx context.Context, maxBatches int) (*LogCursorSyncResult, error) {
+	var result *LogCursorSyncResult
+	err := withRollupStore(ctx, func(db *sql.DB) error {
+		var err error
+		result, err = runLogCursorSync(ctx, db, s.logDB, analyticsRollupCursor, analyticsRollupBackfillDays, maxBatches, logCursorBatch{
+			fetch: s.fetchRollupBatch,
+			write: writeAnalyticsRollupRows,
+		})
+		if err != nil {
+			return err
+		}
+		cutoff := time.Now().AddDate(0, 0, -analyticsRollupRetentionDays).Unix()
+		if _, err := db.ExecContext(ctx, `DELETE FROM analytics_user_hourly WHERE hour < ?`, cutoff); err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, `DELETE FROM analytics_model_hourly WHERE hour < ?`, cutoff)
+		return err
+	})
+	if err == nil && result.Upserted > 0 {
+		logger.L.Info(fmt.Sprintf("[分析汇总] 同步 %d 批，合并 %d 行，游标 %d/%d",
+			result.Batches, result.Upserted, result.LastLogID, result.MaxLogID), logger.CatAnalytics)
+	}
+	return result, err
+}
+
+// fetchRollupBatch aggregates logs with id in (lo, hi] per (hour, user, model)
+func (s *AnalyticsRollupService) fetchRollupBatch(ctx context.Context, lo, hi int64) ([]map[string]interface{}, error) {
+	return s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(`
+		SELECT created_at - (created_at % 3600) as hour, user_id, MAX(username) as username, model_name,
+			COUNT(*) as requests,
+			SUM(CASE WHEN type = `+ltConsume()+` THEN 1 ELSE 0 END) as successes,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures,
+			SUM(CASE WHEN type = `+ltConsume()+` AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count,
+			COALESCE(SUM(quota), 0) as quota,
+			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) as completion_tokens
+		FROM logs
+		WHERE id > ? AND id <= ? AND type IN (`+ltRequests()+`)
+		GROUP BY created_at - (created_at % 3600), user_id, model_name`), lo, hi)
+}
+
+// writeAnalyticsRollupRows splits (hour, user, model) rows into the per-user
+// and per-model tables and merges them
+func writeAnalyticsRollupRows(ctx context.Context, tx *sql.Tx, rows []map[string]interface{}) error {
+	type userKey struct{ hour, userID int64 }
+	type modelKey struct {
+		hour  int64
+		model string
+	}
+	users := map[userKey]map[string]int64{}
+	usernames := map[userKey]string{}
+	modelsAgg := map[modelKey]map[string]int64{}
+	add := func(dst map[string]int64, r map[string]interface{}, fields ...string) {
+		for _, f := range fields {
+			dst[f] += toInt64(r[f])
+		}
+	}
+	for _, r := range rows {
+		hour := toInt64(r["hour"])
+		if uid := toInt64(r["user_id"]); uid > 0 {
+			k := userKey{hour, uid}
+			if users[k] == nil {
+				users[k] = map[string]int64{}
+			}
+			add(users[k], r, "requests", "quota", "prompt_tokens", "completion_tokens")
+			if name := toString(r["username"]); name != "" {
+				usernames[k] = name
+			}
+		}
+		if model := toString(r["model_name"]); model != "" {
+			k := modelKey{hour, model}
+			if modelsAgg[k] == nil {
+				modelsAgg[k] = map[string]int64{}
+			}
+			add(modelsAgg[k], r, "requests", "successes", "failures", "empty_count", "quota")
+		}
+	}
+
+	for k, v := range users {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO analytics_user_hourly (hour, user_id, username, requests, quota, prompt_tokens, completion_tokens)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(hour, user_id) DO UPDATE SET
+				username = CASE WHEN excluded.username <> '' THEN excluded.username ELSE analytics_user_hourly.username END,
+				requests = analytics_user_hourly.requests + excluded.requests,
+				quota = analytics_user_hourly.quota + excluded.quota,
+				prompt_tokens = analytics_user_hourly.prompt_tokens + excluded.prompt_tokens,
+				completion_tokens = analytics_user_hourly.completion_tokens + excluded.completion_tokens`,
+			k.hour, k.userID, usernames[k], v["requests"], v["quota"], v["prompt_tokens"], v["completion_tokens"]); err != nil {
+			return err
+		}
+	}
+	for k, v := range modelsAgg {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO analytics_model_hourly (hour, model_name, requests, successes, failures, empty_count, quota)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(hour, model_name) DO UPDATE SET
+				requests = analytics_model_hourly.requests + excluded.requests,
+				successes = analytics_model_hourly.successes + excluded.successes,
+				failures = analytics_model_hourly.failures + excluded.failures,
+				empty_count = analytics_model_hourly.empty_count + excluded.empty_count,
+				quota = analytics_model_hourly.quota + excluded.quota`,
+			k.hour, k.model, v["requests"], v["successes"], v["failures"], v["empty_count"], v["quota"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset drops all rollups; the next sync starts a fresh backfill
+func (s *AnalyticsRollupService) Reset(ctx context.Context) error {
+	return withRollupStore(ctx, func(db *sql.DB) error {
+		return s.resetRollups(ctx, db)
+	})
+}
+
+func (s *AnalyticsRollupService) resetRollups(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM analytics_user_hourly`); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM analytics_model_hourly`); err != nil {
+		return err
+	}
+	return deleteLogCursor(ctx, db, analyticsRollupCursor)
+}
+
+// UserRanking returns users since startTime ordered by request count
+// (orderBy "requests") or quota ("quota"), in the shape of the logs fallback;
+// accounts excluded by role are left out
+func (s *AnalyticsRollupService) UserRanking(ctx context.Context, startTime int64, orderBy string, limit int) ([]map[string]interface{}, error) {
+	order := "request_count DESC"
+	if orderBy == "quota" {
+		order = "quota_used DESC"
+	}
+	excludeSQL, excludeArgs := roleExclusionClause(database.Get(), "user_id")
+	args := append([]interface{}{startTime - startTime%3600}, excludeArgs...)
+	var out []map[string]interface{}
+	err := withRollupStore(ctx, func(db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT user_id, MAX(username), SUM(requests) as request_count, SUM(quota) as quota_used
+			FROM analytics_user_hourly
+			WHERE hour >= ?%s
+			GROUP BY user_id
+			ORDER BY %s, user_id ASC
+			LIMIT ?`, excludeSQL, order), append(args, limit)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = []map[string]interface{}{}
+		for rows.Next() {
+			var userID, requests, quota int64
+			var username string
+			if err := rows.Scan(&userID, &username, &requests, &quota); err != nil {
+				return err
+			}
+			out = append(out, map[string]interface{}{
+				"user_id":       userID,
+				"username":      username,
+				"request_count": requests,
+				"quota_used":    quota,
+			})
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// ModelStatistics returns per-model totals since startTime ordered by requests
+func (s *AnalyticsRollupService) ModelStatistics(ctx context.Context, startTime int64, limit int) ([]map[string]interface{}, error) {
+	var out []map[string]interface{}
+	err := withRollupStore(ctx, func(db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, `
+			SELECT model_name, SUM(requests), SUM(successes), SUM(failures), SUM(empty_count)
+			FROM analytics_model_hourly
+			WHERE hour >= ?
+			GROUP BY model_name
+			ORDER BY SUM(requests) DESC, model_name ASC
+			LIMIT ?`, startTime-startTime%3600, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		out = []map[string]interface{}{}
+		for rows.Next() {
+			var model string
+			var total, success, failure, empty int64
+			if err := rows.Scan(&model, &total, &success, &failure, &empty); err != nil {
+				return err
+			}
+			out = append(out, map[string]interface{}{
+				"model_name":     model,
+				"total_requests": total,
+				"success_count":  success,
+				"failure_count":  failure,
+				"empty_count":    empty,
+			})
+		}
+		return rows.Err()
+	})
+	return out, err
+}
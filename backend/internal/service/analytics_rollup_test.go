@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestAnalyticsRollupsServeRankings(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+		model_name TEXT, ip TEXT, type INTEGER, quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	insert := func(userID int, username, model string, typ, quota, completion int, ts int64) {
+		db.MustExec(`INSERT INTO logs (user_id, username, model_name, type, quota, prompt_tokens, completion_tokens, created_at)
+			VALUES (?, ?, ?, ?, ?, 10, ?, ?)`, userID, username, model, typ, quota, completion, ts)
+	}
+	insert(1, "alice", "gpt-4o", 2, 100, 5, now-7200)
+	insert(1, "alice", "gpt-4o", 2, 100, 0, now-7100) // empty response
+	insert(2, "bob", "claude", 2, 500, 5, now-3600)
+	insert(2, "bob", "gpt-4o", 5, 0, 0, now-60)
+
+	svc := NewLogAnalyticsService()
+	status, err := svc.GetSyncStatus()
+	if err != nil || status["needs_initial_sync"] != true {
+		t.Fatalf("fresh install should need an initial sync, got %v %v", status, err)
+	}
+
+	res := svc.SyncIncremental(context.Background(), 0)
+	if len(res.Errors) > 0 || !res.Rollups.Completed {
+		t.Fatalf("SyncIncremental: %+v", res)
+	}
+	if !NewAnalyticsRollupService().Covers(context.Background(), time.Now().AddDate(0, 0, -30).Unix()) {
+		t.Fatal("a completed backfill must cover the 30-day ranking window")
+	}
+
+	// rows added after the sync only show up once the processor runs again
+	insert(1, "alice", "gpt-4o", 2, 100, 5, now-30)
+	svc.SyncIncremental(context.Background(), 0)
+
+	byRequests, err := svc.GetUserRequestRanking(10)
+	if err != nil || len(byRequests) != 2 {
+		t.Fatalf("GetUserRequestRanking: %v %v", byRequests, err)
+	}
+	if byRequests[0]["username"] != "alice" || toInt64(byRequests[0]["request_count"]) != 3 {
+		t.Fatalf("alice should lead with 3 requests, got %v", byRequests[0])
+	}
+	byQuota, _ := svc.GetUserQuotaRanking(10)
+	if byQuota[0]["username"] != "bob" || toInt64(byQuota[0]["quota_used"]) != 500 {
+		t.Fatalf("bob should lead by quota, got %v", byQuota)
+	}
+
+	modelStats, err := svc.GetModelStatistics(10)
+	if err != nil || len(modelStats) != 2 || modelStats[0]["model_name"] != "gpt-4o" {
+		t.Fatalf("GetModelStatistics: %v %v", modelStats, err)
+	}
+	gpt := modelStats[0]
+	if toInt64(gpt["total_requests"]) != 4 || toInt64(gpt["failure_count"]) != 1 || toInt64(gpt["empty_count"]) != 1 {
+		t.Fatalf("unexpected gpt-4o totals: %v", gpt)
+	}
+	if gpt["success_rate"] != 75.0 || toFloat64(gpt["empty_rate"]) != 33.33 {
+		t.Fatalf("unexpected gpt-4o rates: %v", gpt)
+	}
+
+	status, _ = svc.GetSyncStatus()
+	if status["is_synced"] != true || toInt64(status["remaining_logs"]) != 0 {
+		t.Fatalf("expected synced status, got %v", status)
+	}
+
+	if err := svc.ResetAnalytics(); err != nil {
+		t.Fatalf("ResetAnalytics: %v", err)
+	}
+	if st, _ := NewAnalyticsRollupService().GetState(context.Background()); st.UserRows != 0 || st.SyncedAt != 0 {
+		t.Fatalf("reset should drop rollups and the cursor, got %+v", st)
+	}
+}
@@ -0,0 +1,581 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+const anomalySettingsKey = "anomaly_detection"
+
+// Anomaly detection methods
+const (
+	AnomalyMethodEWMA     = "ewma"     // 指数加权均值/方差，适应趋势
+	AnomalyMethodSeasonal = "seasonal" // 与前几天同一小时比较，适应日周期
+)
+
+// Anomaly series dimensions and metrics
+const (
+	AnomalyDimensionModel = "model"
+	AnomalyDimensionGroup = "group"
+	AnomalyMetricRequests = "requests"
+	AnomalyMetricQuota    = "quota"
+)
+
+var (
+	AnomalyMethods    = []string{AnomalyMethodEWMA, AnomalyMethodSeasonal}
+	AnomalyDimensions = []string{AnomalyDimensionModel, AnomalyDimensionGroup}
+	AnomalyMetrics    = []string{AnomalyMetricRequests, AnomalyMetricQuota}
+)
+
+var ErrInvalidAnomalyConfig = errors.New("invalid anomaly detection config")
+
+// anomalyMu keeps the scheduler from notifying the same hour twice
+var anomalyMu sync.Mutex
+
+// AnomalySettings configures the traffic anomaly detector
+type AnomalySettings struct {
+	Enabled          bool    `json:"enabled"` // 定时检测并推送事件 / webhook
+	Method           string  `json:"method"`  // ewma | seasonal
+	LookbackDays     int     `json:"lookback_days"`
+	Threshold        float64 `json:"threshold"`    // |z| 达到该值视为异常
+	MinRequests      int64   `json:"min_requests"` // 实际与期望请求数都低于该值的小时忽略
+	Alpha            float64 `json:"alpha"`        // ewma 平滑系数
+	WebhookURL       string  `json:"webhook_url"`
+	WebhookSecret    string  `json:"webhook_secret,omitempty"` // 仅存储，接口返回时清空
+	HasWebhookSecret bool    `json:"has_webhook_secret"`
+
+	LastCheckedHour int64  `json:"last_checked_hour"`
+	LastError       string `json:"last_error"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+// AnomalySettingsInput supports partial update of AnomalySettings.
+// For WebhookSecret: nil = unchanged, empty string = clear.
+type AnomalySettingsInput struct {
+	Enabled       *bool    `json:"enabled"`
+	Method        *string  `json:"method"`
+	LookbackDays  *int     `json:"lookback_days"`
+	Threshold     *float64 `json:"threshold"`
+	MinRequests   *int64   `json:"min_requests"`
+	Alpha         *float64 `json:"alpha"`
+	WebhookURL    *string  `json:"webhook_url"`
+	WebhookSecret *string  `json:"webhook_secret"`
+}
+
+// AnomalyQuery selects what to evaluate; empty fields use the settings / all
+type AnomalyQuery struct {
+	Hours     int    // 评估最近多少个完整小时
+	Method    string // 覆盖配置中的方法
+	Dimension string // model | group，空 = 全部
+	Metric    string // requests | quota，空 = 全部
+	Limit     int
+	NoCache   bool
+}
+
+// TrafficAnomaly is one hour of one series that deviates from its baseline
+type TrafficAnomaly struct {
+	Dimension string  `json:"dimension"`
+	Key       string  `json:"key"`
+	Metric    string  `json:"metric"`
+	Hour      int64   `json:"hour"`
+	Actual    float64 `json:"actual"`
+	Expected  float64 `json:"expected"`
+	StdDev    float64 `json:"std_dev"`
+	Score     float64 `json:"score"`     // z-score，正数为突增
+	Direction string  `json:"direction"` // spike | drop
+}
+
+// AnomalyReport is the result of one detection pass
+type AnomalyReport struct {
+	Method      string           `json:"method"`
+	Threshold   float64          `json:"threshold"`
+	StartHour   int64            `json:"start_hour"` // 评估窗口（不含基线）
+	EndHour     int64            `json:"end_hour"`
+	Series      int              `json:"series"`
+	Sources     []string         `json:"sources"` // rollup | logs
+	Anomalies   []TrafficAnomaly `json:"anomalies"`
+	GeneratedAt int64            `json:"generated_at"`
+}
+
+// AnomalyService detects spikes and drops in hourly traffic per model and per user group
+type AnomalyService struct {
+	logDB *database.Manager
+}
+
+// NewAnomalyService creates an AnomalyService on the primary instance
+func NewAnomalyService() *AnomalyService {
+	return &AnomalyService{logDB: database.GetReadLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *AnomalyService) WithContext(ctx context.Context) *AnomalyService {
+	c := *s
+	c.logDB = s.logDB.WithContext(ctx)
+	return &c
+}
+
+func defaultAnomalySettings() AnomalySettings {
+	return AnomalySettings{
+		Method:       AnomalyMethodSeasonal,
+		LookbackDays: 7,
+		Threshold:    3,
+		MinRequests:  50,
+		Alpha:        0.3,
+	}
+}
+
+func normalizeAnomalySettings(s *AnomalySettings) error {
+	s.Method = strings.ToLower(strings.TrimSpace(s.Method))
+	if s.Method == "" {
+		s.Method = AnomalyMethodSeasonal
+	}
+	if !isReportOption(AnomalyMethods, s.Method) {
+		return fmt.Errorf("%w: method 只能是 %s", ErrInvalidAnomalyConfig, strings.Join(AnomalyMethods, "、"))
+	}
+	s.LookbackDays = clampSetting(s.LookbackDays, 2, 28, 7)
+	if s.Threshold == 0 {
+		s.Threshold = 3
+	}
+	if s.Threshold < 1.5 || s.Threshold > 10 {
+		return fmt.Errorf("%w: threshold 需在 1.5-10 之间", ErrInvalidAnomalyConfig)
+	}
+	if s.MinRequests < 0 {
+		return fmt.Errorf("%w: min_requests 不能为负数", ErrInvalidAnomalyConfig)
+	}
+	if s.Alpha == 0 {
+		s.Alpha = 0.3
+	}
+	if s.Alpha < 0.01 || s.Alpha > 0.9 {
+		return fmt.Errorf("%w: alpha 需在 0.01-0.9 之间", ErrInvalidAnomalyConfig)
+	}
+	s.WebhookURL = strings.TrimSpace(s.WebhookURL)
+	if s.WebhookURL != "" {
+		u, err := url.Parse(s.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: webhook_url 需为 http(s) 地址", ErrInvalidAnomalyConfig)
+		}
+	}
+	s.HasWebhookSecret = s.WebhookSecret != ""
+	return nil
+}
+
+// view hides the webhook secret from API responses
+func (s AnomalySettings) view() AnomalySettings {
+	s.HasWebhookSecret = s.WebhookSecret != ""
+	s.WebhookSecret = ""
+	return s
+}
+
+func (s *AnomalyService) loadSettings(ctx context.Context) (AnomalySettings, error) {
+	settings := defaultAnomalySettings()
+	if _, err := loadLocalSetting(ctx, anomalySettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeAnomalySettings(&settings); err != nil {
+		def := defaultAnomalySettings()
+		def.LastCheckedHour = settings.LastCheckedHour
+		settings = def
+	}
+	return settings, nil
+}
+
+// GetSettings returns the detector settings without the webhook secret
+func (s *AnomalyService) GetSettings(ctx context.Context) (AnomalySettings, error) {
+	settings, err := s.loadSettings(ctx)
+	return settings.view(), err
+}
+
+// UpdateSettings applies a partial update
+func (s *AnomalyService) UpdateSettings(ctx context.Context, in AnomalySettingsInput) (AnomalySettings, error) {
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return settings.view(), err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Method != nil {
+		settings.Method = *in.Method
+	}
+	if in.LookbackDays != nil {
+		settings.LookbackDays = *in.LookbackDays
+	}
+	if in.Threshold != nil {
+		settings.Threshold = *in.Threshold
+	}
+	if in.MinRequests != nil {
+		settings.MinRequests = *in.MinRequests
+	}
+	if in.Alpha != nil {
+		settings.Alpha = *in.Alpha
+	}
+	if in.WebhookURL != nil {
+		settings.WebhookURL = *in.WebhookURL
+	}
+	if in.WebhookSecret != nil {
+		settings.WebhookSecret = *in.WebhookSecret
+	}
+	if err := normalizeAnomalySettings(&settings); err != nil {
+		return settings.view(), err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, anomalySettingsKey, settings); err != nil {
+		return settings.view(), err
+	}
+	return settings.view(), nil
+}
+
+// hourPoint is one hour of a series
+type hourPoint struct {
+	requests float64
+	quota    float64
+}
+
+// hourlySeries maps a series key (model name / group) to its hours
+type hourlySeries map[string]map[int64]hourPoint
+
+// fetchHourlySeries loads hourly requests/quota per model or group in
+// [start, end). Models come from the local rollups when they cover the
+// range; groups are only recorded in logs.
+func (s *AnomalyService) fetchHourlySeries(ctx context.Context, dimension string, start, end int64) (hourlySeries, string, error) {
+	series := hourlySeries{}
+	add := func(key string, hour int64, requests, quota float64) {
+		if series[key] == nil {
+			series[key] = map[int64]hourPoint{}
+		}
+		p := series[key][hour]
+		p.requests += requests
+		p.quota += quota
+		series[key][hour] = p
+	}
+
+	if dimension == AnomalyDimensionModel && NewAnalyticsRollupService().Covers(ctx, start) {
+		err := withRollupStore(ctx, func(db *sql.DB) error {
+			rows, err := db.QueryContext(ctx, `
+				SELECT hour, model_name, requests, quota FROM analytics_model_hourly
+				WHERE hour >= ? AND hour < ?`, start, end)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var hour, requests, quota int64
+				var model string
+				if err := rows.Scan(&hour, &model, &requests, &quota); err != nil {
+					return err
+				}
+				add(model, hour, float64(requests), float64(quota))
+			}
+			return rows.Err()
+		})
+		return series, "rollup", err
+	}
+
+	column := "model_name"
+	if dimension == AnomalyDimensionGroup {
+		if !s.logDB.ColumnExists("logs", "group") {
+			return series, "logs", nil
+		}
+		column = "`group`"
+		if s.logDB.IsPG {
+			column = `"group"`
+		}
+	}
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT created_at - (created_at %% 3600) AS hour, COALESCE(%s, '') AS series_key,
+			COUNT(*) AS requests, COALESCE(SUM(quota), 0) AS quota
+		FROM logs
+		WHERE type IN (`+ltRequests()+`) AND created_at >= ? AND created_at < ?
+		GROUP BY created_at - (created_at %% 3600), COALESCE(%s, '')`, column, column)), start, end)
+	if err != nil {
+		return series, "logs", err
+	}
+	for _, row := range rows {
+		key := toString(row["series_key"])
+		if key == "" && dimension == AnomalyDimensionGroup {
+			key = "default"
+		}
+		if key == "" {
+			continue
+		}
+		add(key, toInt64(row["hour"]), toFloat64(row["requests"]), toFloat64(row["quota"]))
+	}
+	return series, "logs", nil
+}
+
+// anomalyBaseline returns the expected value and standard deviation of
+// values[i] from the points before it. The EWMA skips points that were
+// anomalous themselves, so a spike does not mask the hours after it. The
+// seasonal method compares the same local hour of earlier days in the
+// reporting timezone, which is 23 or 25 hours back across a DST change.
+func anomalyBaseline(settings AnomalySettings, values []float64, baseStart int64, i int) (float64, float64, bool) {
+	switch settings.Method {
+	case AnomalyMethodEWMA:
+		if i < 24 {
+			return 0, 0, false
+		}
+		alpha := settings.Alpha
+		mean, variance := values[0], 0.0
+		for j := 1; j < i; j++ {
+			if j >= 24 && math.Abs(anomalyScore(values[j], mean, math.Sqrt(variance))) >= settings.Threshold {
+				continue
+			}
+			diff := values[j] - mean
+			incr := alpha * diff
+			mean += incr
+			variance = (1 - alpha) * (variance + diff*incr)
+		}
+		return mean, math.Sqrt(variance), true
+	default:
+		samples := []float64{}
+		at := time.Unix(baseStart+int64(i)*3600, 0).In(ReportLocation())
+		for k := 1; k <= settings.LookbackDays; k++ {
+			if d := at.AddDate(0, 0, -k).Unix() - baseStart; d >= 0 && int(d/3600) < i {
+				samples = append(samples, values[d/3600])
+			}
+		}
+		if len(samples) < 2 {
+			return 0, 0, false
+		}
+		var sum float64
+		for _, v := range samples {
+			sum += v
+		}
+		mean := sum / float64(len(samples))
+		var sq float64
+		for _, v := range samples {
+			sq += (v - mean) * (v - mean)
+		}
+		return mean, math.Sqrt(sq / float64(len(samples)-1)), true
+	}
+}
+
+// anomalyScore is the z-score of actual against the baseline. The deviation
+// is floored at the Poisson noise of the expected count so that flat,
+// low-volume series do not turn every small wobble into an anomaly.
+func anomalyScore(actual, expected, stddev float64) float64 {
+	floor := math.Max(math.Sqrt(math.Max(expected, 1)), 1)
+	return (actual - expected) / math.Max(stddev, floor)
+}
+
+// detectSeries scores the evaluated hours of one zero-filled series
+func detectSeries(settings AnomalySettings, dimension, key string, points map[int64]hourPoint,
+	baseStart, evalStart, evalEnd int64, metrics []string) []TrafficAnomaly {
+	n := int((evalEnd - baseStart) / 3600)
+	requests := make([]float64, n)
+	quota := make([]float64, n)
+	for hour, p := range points {
+		if i := int((hour - baseStart) / 3600); i >= 0 && i < n {
+			requests[i], quota[i] = p.requests, p.quota
+		}
+	}
+
+	out := []TrafficAnomaly{}
+	for i := int((evalStart - baseStart) / 3600); i < n; i++ {
+		expectedRequests, _, ok := anomalyBaseline(settings, requests, baseStart, i)
+		if !ok || math.Max(requests[i], expectedRequests) < float64(settings.MinRequests) {
+			continue
+		}
+		for _, metric := range metrics {
+			values := requests
+			if metric == AnomalyMetricQuota {
+				values = quota
+			}
+			expected, stddev, _ := anomalyBaseline(settings, values, baseStart, i)
+			score := anomalyScore(values[i], expected, stddev)
+			if math.Abs(score) < settings.Threshold {
+				continue
+			}
+			direction := "spike"
+			if score < 0 {
+				direction = "drop"
+			}
+			out = append(out, TrafficAnomaly{
+				Dimension: dimension,
+				Key:       key,
+				Metric:    metric,
+				Hour:      baseStart + int64(i)*3600,
+				Actual:    values[i],
+				Expected:  math.Round(expected*100) / 100,
+				StdDev:    math.Round(stddev*100) / 100,
+				Score:     math.Round(score*100) / 100,
+				Direction: direction,
+			})
+		}
+	}
+	return out
+}
+
+// Detect scores the last q.Hours complete hours of every series against its
+// baseline over the preceding lookback window
+func (s *AnomalyService) Detect(ctx context.Context, q AnomalyQuery) (AnomalyReport, error) {
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return AnomalyReport{}, err
+	}
+	return s.detect(ctx, settings, q, time.Now())
+}
+
+func (s *AnomalyService) detect(ctx context.Context, settings AnomalySettings, q AnomalyQuery, now time.Time) (AnomalyReport, error) {
+	if q.Method != "" {
+		if !isReportOption(AnomalyMethods, q.Method) {
+			return AnomalyReport{}, fmt.Errorf("%w: method 只能是 %s", ErrInvalidAnomalyConfig, strings.Join(AnomalyMethods, "、"))
+		}
+		settings.Method = q.Method
+	}
+	dimensions, metrics := AnomalyDimensions, AnomalyMetrics
+	if q.Dimension != "" {
+		if !isReportOption(AnomalyDimensions, q.Dimension) {
+			return AnomalyReport{}, fmt.Errorf("%w: dimension 只能是 %s", ErrInvalidAnomalyConfig, strings.Join(AnomalyDimensions, "、"))
+		}
+		dimensions = []string{q.Dimension}
+	}
+	if q.Metric != "" {
+		if !isReportOption(AnomalyMetrics, q.Metric) {
+			return AnomalyReport{}, fmt.Errorf("%w: metric 只能是 %s", ErrInvalidAnomalyConfig, strings.Join(AnomalyMetrics, "、"))
+		}
+		metrics = []string{q.Metric}
+	}
+	q.Hours = clampSetting(q.Hours, 1, 168, 24)
+	q.Limit = clampSetting(q.Limit, 1, 500, 100)
+
+	evalEnd := now.Unix() - now.Unix()%3600 // 当前小时未结束，不参与评估
+	evalStart := evalEnd - int64(q.Hours)*3600
+	baseStart := evalStart - int64(settings.LookbackDays)*86400
+
+	cacheKey := cache.Key("analytics:anomalies:%s:%s:%s:%d:%d:%d", settings.Method, strings.Join(dimensions, ","),
+		strings.Join(metrics, ","), q.Hours, evalEnd, settings.UpdatedAt)
+	cm := cache.Get()
+	var cached AnomalyReport
+	if found, _ := cm.GetJSON(cacheKey, &cached); found && !q.NoCache && cached.Anomalies != nil {
+		if len(cached.Anomalies) > q.Limit {
+			cached.Anomalies = cached.Anomalies[:q.Limit]
+		}
+		return cached, nil
+	}
+
+	report := AnomalyReport{
+		Method:      settings.Method,
+		Threshold:   settings.Threshold,
+		StartHour:   evalStart,
+		EndHour:     evalEnd,
+		Sources:     []string{},
+		Anomalies:   []TrafficAnomaly{},
+		GeneratedAt: now.Unix(),
+	}
+	for _, dimension := range dimensions {
+		series, source, err := s.fetchHourlySeries(ctx, dimension, baseStart, evalEnd)
+		if err != nil {
+			return report, err
+		}
+		report.Sources = appendUniqueString(report.Sources, source)
+		report.Series += len(series)
+		for key, points := range series {
+			report.Anomalies = append(report.Anomalies, detectSeries(settings, dimension, key, points, baseStart, evalStart, evalEnd, metrics)...)
+		}
+	}
+	sort.SliceStable(report.Anomalies, func(i, j int) bool {
+		a, b := report.Anomalies[i], report.Anomalies[j]
+		if math.Abs(a.Score) != math.Abs(b.Score) {
+			return math.Abs(a.Score) > math.Abs(b.Score)
+		}
+		return a.Hour > b.Hour
+	})
+	cm.Set(cacheKey, report, 10*time.Minute)
+	if len(report.Anomalies) > q.Limit {
+		report.Anomalies = report.Anomalies[:q.Limit]
+	}
+	return report, nil
+}
+
+// DetectAndNotify evaluates the hours completed since the last check and
+// publishes a traffic_anomaly event (and webhook) when something is off.
+// Returns the anomalies found; nothing happens while detection is disabled.
+func (s *AnomalyService) DetectAndNotify(ctx context.Context) ([]TrafficAnomaly, error) {
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+
+	settings, err := s.loadSettings(ctx)
+	if err != nil || !settings.Enabled {
+		return nil, err
+	}
+	now := time.Now()
+	lastHour := now.Unix() - now.Unix()%3600
+	if settings.LastCheckedHour >= lastHour {
+		return nil, nil
+	}
+	hours := 1
+	if settings.LastCheckedHour > 0 {
+		hours = int((lastHour - settings.LastCheckedHour) / 3600)
+	}
+	report, err := s.detect(ctx, settings, AnomalyQuery{Hours: clampSetting(hours, 1, 24, 1), Limit: 500}, now)
+	settings.LastError = ""
+	if err != nil {
+		settings.LastError = err.Error()
+	} else {
+		settings.LastCheckedHour = lastHour
+		report.Anomalies = dropMaintenanceAnomalies(ctx, report.Anomalies)
+		if len(report.Anomalies) > 0 {
+			PublishEvent(EventTrafficAnomaly, map[string]interface{}{
+				"count":     len(report.Anomalies),
+				"anomalies": report.Anomalies,
+			})
+			if settings.WebhookURL != "" {
+				if werr := postAnomalyWebhook(ctx, settings, report); werr != nil {
+					settings.LastError = werr.Error()
+				}
+			}
+		}
+	}
+	if serr := saveLocalSetting(ctx, anomalySettingsKey, settings); serr != nil && err == nil {
+		err = serr
+	}
+	return report.Anomalies, err
+}
+
+// dropMaintenanceAnomalies removes model anomalies in hours overlapping a
+// maintenance window of that model; they are expected and must not alert
+func dropMaintenanceAnomalies(ctx context.Context, anomalies []TrafficAnomaly) []TrafficAnomaly {
+	if len(anomalies) == 0 {
+		return anomalies
+	}
+	from, to := anomalies[0].Hour, anomalies[0].Hour+3600
+	for _, a := range anomalies {
+		from, to = min(from, a.Hour), max(to, a.Hour+3600)
+	}
+	schedule := loadMaintenanceSchedule(ctx, from, to)
+	if len(schedule) == 0 {
+		return anomalies
+	}
+	kept := make([]TrafficAnomaly, 0, len(anomalies))
+	for _, a := range anomalies {
+		if a.Dimension == AnomalyDimensionModel && schedule.modelDuring(a.Key, a.Hour, a.Hour+3600) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// postAnomalyWebhook delivers the report to the configured webhook
+func postAnomalyWebhook(ctx context.Context, settings AnomalySettings, report AnomalyReport) error {
+	return postSignedWebhook(ctx, settings.WebhookURL, settings.WebhookSecret, "NewAPI-Tools/anomaly-detector", map[string]interface{}{
+		"event":     EventTrafficAnomaly,
+		"report":    report,
+		"timestamp": time.Now().Unix(),
+	})
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestDetectSeriesFlagsSpikesAndDrops(t *testing.T) {
+	settings := defaultAnomalySettings()
+	settings.MinRequests = 10
+	const base = int64(1_700_000_000 / 3600 * 3600)
+	points := map[int64]hourPoint{}
+	hours := 8 * 24
+	for i := 0; i < hours; i++ {
+		v := 40.0 + float64(i%24) // daily shape
+		if i%2 == 0 {
+			v += 3
+		}
+		points[base+int64(i)*3600] = hourPoint{requests: v, quota: v * 100}
+	}
+	evalStart := base + int64(hours-2)*3600
+	last := points[evalStart+3600]
+	points[evalStart] = hourPoint{requests: 400, quota: 40000} // spike
+	points[evalStart+3600] = hourPoint{requests: 0, quota: last.quota}
+
+	for _, method := range AnomalyMethods {
+		settings.Method = method
+		got := detectSeries(settings, AnomalyDimensionModel, "gpt-4o", points, base, evalStart, base+int64(hours)*3600, AnomalyMetrics)
+		directions := map[string]string{}
+		for _, a := range got {
+			directions[a.Metric+"@"+time.Unix(a.Hour, 0).UTC().Format("15")] = a.Direction
+		}
+		spikeHour := time.Unix(evalStart, 0).UTC().Format("15")
+		dropHour := time.Unix(evalStart+3600, 0).UTC().Format("15")
+		if directions["requests@"+spikeHour] != "spike" || directions["quota@"+spikeHour] != "spike" ||
+			directions["requests@"+dropHour] != "drop" {
+			t.Errorf("%s: unexpected anomalies %+v", method, got)
+		}
+		if _, ok := directions["quota@"+dropHour]; ok {
+			t.Errorf("%s: quota at its usual level should not be flagged: %+v", method, got)
+		}
+	}
+
+	// a low-volume series never reaches min_requests
+	settings.MinRequests = 1000
+	if got := detectSeries(settings, AnomalyDimensionModel, "gpt-4o", points, base, evalStart, base+int64(hours)*3600, AnomalyMetrics); len(got) != 0 {
+		t.Fatalf("series below min_requests should be skipped, got %+v", got)
+	}
+}
+
+func TestDetectAndNotifyPostsSignedWebhook(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, type INTEGER, model_name TEXT, quota INTEGER, created_at INTEGER)`)
+	now := time.Now().Unix()
+	lastHour := now - now%3600 - 3600
+	tx := db.MustBegin()
+	for h := int64(1); h <= 8*24; h++ {
+		n := 20 + int(h%3)
+		if h == 1 {
+			n = 200
+		}
+		for i := 0; i < n; i++ {
+			tx.MustExec(`INSERT INTO logs (type, model_name, quota, created_at) VALUES (2, 'gpt-4o', 10, ?)`,
+				lastHour-(h-1)*3600+int64(i))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotBody []byte
+	var gotSig string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSig = r.Header.Get("X-Signature")
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc := NewAnomalyService()
+	bad := "ftp://example.com"
+	if _, err := svc.UpdateSettings(ctx, AnomalySettingsInput{WebhookURL: &bad}); !errors.Is(err, ErrInvalidAnomalyConfig) {
+		t.Fatalf("non-http webhook should be rejected, got %v", err)
+	}
+	enabled, minRequests, secret := true, int64(10), "s3cret"
+	settings, err := svc.UpdateSettings(ctx, AnomalySettingsInput{
+		Enabled: &enabled, MinRequests: &minRequests, WebhookURL: &srv.URL, WebhookSecret: &secret,
+	})
+	if err != nil || settings.WebhookSecret != "" || !settings.HasWebhookSecret {
+		t.Fatalf("UpdateSettings = %+v, %v", settings, err)
+	}
+
+	events, cancel := GetEventBus().Subscribe()
+	defer cancel()
+
+	anomalies, err := svc.DetectAndNotify(ctx)
+	if err != nil {
+		t.Fatalf("DetectAndNotify: %v", err)
+	}
+	if len(anomalies) == 0 || anomalies[0].Key != "gpt-4o" || anomalies[0].Hour != lastHour || anomalies[0].Direction != "spike" {
+		t.Fatalf("expected a spike on the last hour, got %+v", anomalies)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventTrafficAnomaly {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("traffic_anomaly event not published")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(gotBody)
+	if gotSig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("bad webhook signature %q", gotSig)
+	}
+	var payload struct {
+		Event  string        `json:"event"`
+		Report AnomalyReport `json:"report"`
+	}
+	if err := json.Unmarshal(gotBody, &payload); err != nil || payload.Event != EventTrafficAnomaly || len(payload.Report.Anomalies) == 0 {
+		t.Fatalf("unexpected webhook payload %s (%v)", gotBody, err)
+	}
+
+	// the same hour is not reported twice
+	gotBody = nil
+	if again, err := svc.DetectAndNotify(ctx); err != nil || len(again) != 0 || gotBody != nil {
+		t.Fatalf("second pass should be a no-op, got %+v, %v", again, err)
+	}
+}
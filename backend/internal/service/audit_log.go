@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// auditPayloadMaxLen caps the stored payload summary so a bulk request body
+// (e.g. thousands of user IDs) cannot bloat the local audit table.
+const auditPayloadMaxLen = 2000
+
+// AuditDetailContextKey is the gin context key handlers use to attach a
+// human-readable change description (e.g. before → after values) to the
+// audit entry recorded by middleware.AuditMiddleware.
+const AuditDetailContextKey = "audit_detail"
+
+// auditSensitiveKeys are JSON keys whose values are masked before persisting.
+var auditSensitiveKeys = []string{"password", "secret", "token", "key", "authorization"}
+
+// AuditLogEntry is one recorded admin write action.
+type AuditLogEntry struct {
+	ID         int64  `json:"id"`
+	Operator   string `json:"operator"`
+	AuthMethod string `json:"auth_method"`
+	Instance   string `json:"instance"` // 目标 New API 实例；启用该字段前的记录为空
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Query      string `json:"query"`
+	Payload    string `json:"payload"`
+	Detail     string `json:"detail"`
+	StatusCode int    `json:"status_code"`
+	Success    bool   `json:"success"`
+	ClientIP   string `json:"client_ip"`
+	DurationMs int64  `json:"duration_ms"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// AuditLogQuery filters ListAuditLogs results.
+type AuditLogQuery struct {
+	Page      int
+	PageSize  int
+	Operator  string
+	Instance  string
+	Method    string
+	Path      string
+	Success   *bool
+	StartTime int64
+	EndTime   int64
+}
+
+// AuditLogService persists and queries the admin audit trail.
+type AuditLogService struct{}
+
+// NewAuditLogService creates a new AuditLogService
+func NewAuditLogService() *AuditLogService {
+	return &AuditLogService{}
+}
+
+// Record stores one audit entry. CreatedAt defaults to now.
+func (s *AuditLogService) Record(ctx context.Context, entry AuditLogEntry) error {
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureAuditLogTables(ctx, db); err != nil {
+		return err
+	}
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().Unix()
+	}
+	success := 0
+	if entry.Success {
+		success = 1
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO audit_logs (operator, auth_method, instance, method, path, query, payload, detail, status_code, success, client_ip, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Operator, entry.AuthMethod, entry.Instance, entry.Method, entry.Path, entry.Query, entry.Payload, entry.Detail,
+		entry.StatusCode, success, entry.ClientIP, entry.DurationMs, entry.CreatedAt)
+	return err
+}
+
+// ListAuditLogs returns a page of audit entries, newest first.
+func (s *AuditLogService) ListAuditLogs(ctx context.Context, q AuditLogQuery) (map[string]interface{}, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureAuditLogTables(ctx, db); err != nil {
+		return nil, err
+	}
+
+	where := []string{"1=1"}
+	args := []interface{}{}
+	if q.Operator != "" {
+		where = append(where, "operator = ?")
+		args = append(args, q.Operator)
+	}
+	if q.Instance != "" {
+		where = append(where, "instance = ?")
+		args = append(args, q.Instance)
+	}
+	if q.Method != "" {
+		where = append(where, "method = ?")
+		args = append(args, strings.ToUpper(q.Method))
+	}
+	if q.Path != "" {
+		where = append(where, "path LIKE ?")
+		args = append(args, "%"+q.Path+"%")
+	}
+	if q.Success != nil {
+		where = append(where, "success = ?")
+		if *q.Success {
+			args = append(args, 1)
+		} else {
+			args = append(args, 0)
+		}
+	}
+	if q.StartTime > 0 {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.StartTime)
+	}
+	if q.EndTime > 0 {
+		where = append(where, "created_at <= ?")
+		args = append(args, q.EndTime)
+	}
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_logs WHERE "+whereSQL, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	offset := (q.Page - 1) * q.PageSize
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, operator, auth_method, instance, method, path, query, payload, detail, status_code, success, client_ip, duration_ms, created_at
+		FROM audit_logs WHERE `+whereSQL+`
+		ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, q.PageSize, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []AuditLogEntry{}
+	for rows.Next() {
+		var e AuditLogEntry
+		var success int
+		if err := rows.Scan(&e.ID, &e.Operator, &e.AuthMethod, &e.Instance, &e.Method, &e.Path, &e.Query, &e.Payload, &e.Detail,
+			&e.StatusCode, &success, &e.ClientIP, &e.DurationMs, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Success = success == 1
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	totalPages := (total + int64(q.PageSize) - 1) / int64(q.PageSize)
+	return map[string]interface{}{
+		"items":       items,
+		"total":       total,
+		"page":        q.Page,
+		"page_size":   q.PageSize,
+		"total_pages": totalPages,
+	}, nil
+}
+
+// SummarizeAuditPayload renders a request body for storage: JSON bodies have
+// sensitive fields masked, everything is truncated to auditPayloadMaxLen.
+func SummarizeAuditPayload(body []byte) string {
+	trimmed := strings.TrimSpace(string(body))
+	if trimmed == "" {
+		return ""
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil {
+		if raw, err := json.Marshal(maskAuditValue(parsed)); err == nil {
+			trimmed = string(raw)
+		}
+	}
+	if len(trimmed) > auditPayloadMaxLen {
+		trimmed = trimmed[:auditPayloadMaxLen] + "...(truncated)"
+	}
+	return trimmed
+}
+
+func maskAuditValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, inner := range val {
+			if isAuditSensitiveKey(k) {
+				val[k] = "***"
+				continue
+			}
+			val[k] = maskAuditValue(inner)
+		}
+		return val
+	case []interface{}:
+		for i, inner := range val {
+			val[i] = maskAuditValue(inner)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+func isAuditSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, s := range auditSensitiveKeys {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func ensureAuditLogTables(ctx context.Context, db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS audit_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			operator TEXT NOT NULL DEFAULT '',
+			auth_method TEXT NOT NULL DEFAULT '',
+			method TEXT NOT NULL DEFAULT '',
+			path TEXT NOT NULL DEFAULT '',
+			query TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			status_code INTEGER NOT NULL DEFAULT 0,
+			success INTEGER NOT NULL DEFAULT 0,
+			client_ip TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs (created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_operator ON audit_logs (operator)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if err := ensureSQLiteColumn(ctx, db, "audit_logs", "detail", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return ensureSQLiteColumn(ctx, db, "audit_logs", "instance", "TEXT NOT NULL DEFAULT ''")
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestSummarizeAuditPayloadMasksSecrets(t *testing.T) {
+	got := SummarizeAuditPayload([]byte(`{"user_ids":[1,2],"password":"p@ss","nested":{"api_key":"sk-1"}}`))
+	if strings.Contains(got, "p@ss") || strings.Contains(got, "sk-1") {
+		t.Fatalf("secret leaked into audit payload: %s", got)
+	}
+	if !strings.Contains(got, `"user_ids":[1,2]`) {
+		t.Fatalf("expected non-sensitive fields preserved, got %s", got)
+	}
+
+	long := SummarizeAuditPayload([]byte(strings.Repeat("x", auditPayloadMaxLen+10)))
+	if !strings.HasSuffix(long, "...(truncated)") {
+		t.Fatalf("expected long payload to be truncated")
+	}
+}
+
+func TestAuditLogRecordAndList(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	svc := NewAuditLogService()
+	ctx := context.Background()
+	entries := []AuditLogEntry{
+		{Operator: "admin", Instance: "eu", Method: "PUT", Path: "/api/channels/3/status", Detail: "channel #3 status 1→2", StatusCode: 200, Success: true},
+		{Operator: "api_key", Instance: "default", Method: "POST", Path: "/api/redemptions/batch", StatusCode: 500},
+	}
+	for _, e := range entries {
+		if err := svc.Record(ctx, e); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	failed := false
+	data, err := svc.ListAuditLogs(ctx, AuditLogQuery{Page: 1, PageSize: 10, Success: &failed})
+	if err != nil {
+		t.Fatalf("ListAuditLogs failed: %v", err)
+	}
+	items := data["items"].([]AuditLogEntry)
+	if data["total"].(int64) != 1 || len(items) != 1 || items[0].Path != "/api/redemptions/batch" {
+		t.Fatalf("unexpected filtered result: %+v", data)
+	}
+
+	data, err = svc.ListAuditLogs(ctx, AuditLogQuery{Page: 1, PageSize: 10, Path: "/api/channels"})
+	if err != nil {
+		t.Fatalf("ListAuditLogs failed: %v", err)
+	}
+	items = data["items"].([]AuditLogEntry)
+	if len(items) != 1 || items[0].Detail != "channel #3 status 1→2" {
+		t.Fatalf("expected change detail to round-trip, got %+v", items)
+	}
+
+	data, err = svc.ListAuditLogs(ctx, AuditLogQuery{Page: 1, PageSize: 10, Instance: "eu"})
+	if err != nil {
+		t.Fatalf("ListAuditLogs failed: %v", err)
+	}
+	items = data["items"].([]AuditLogEntry)
+	if len(items) != 1 || items[0].Instance != "eu" || items[0].Path != "/api/channels/3/status" {
+		t.Fatalf("expected only the eu entry, got %+v", items)
+	}
+}
@@ -34,6 +34,13 @@ func NewAutoGroupService() *AutoGroupService {
 	return &AutoGroupService{db: database.Get()}
 }
 
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *AutoGroupService) WithContext(ctx context.Context) *AutoGroupService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
 // getGroupCol returns the properly quoted column name for "group"
 func (s *AutoGroupService) getGroupCol() string {
 	if s.db.IsPG {
@@ -121,10 +128,13 @@ var defaultAutoGroupConfig = map[string]interface{}{
 	"mode":                  "simple",
 	"target_group":          "",
 	"source_rules":          map[string]interface{}{"github": "", "wechat": "", "telegram": "", "discord": "", "oidc": "", "linux_do": "", "password": ""},
+	"condition_rules":       []interface{}{},
+	"demotion_rules":        []interface{}{},
 	"scan_interval_minutes": 60,
 	"auto_scan_enabled":     false,
 	"whitelist_ids":         []interface{}{},
 	"last_scan_time":        0,
+	"version":               0,
 }
 
 // 优化3: getConfigCached 请求级缓存，避免重复 Redis GET + JSON Unmarshal
@@ -163,20 +173,54 @@ func (s *AutoGroupService) GetConfig() map[string]interface{} {
 	return result
 }
 
-// SaveConfig saves auto group configuration
-func (s *AutoGroupService) SaveConfig(updates map[string]interface{}) bool {
+// SaveConfig saves an operator update of the auto group configuration. A
+// "version" in updates must match the stored one, otherwise
+// *ConfigConflictError is returned.
+func (s *AutoGroupService) SaveConfig(updates map[string]interface{}) error {
+	if raw, ok := updates["condition_rules"]; ok {
+		rules, err := decodeAutoGroupRules(raw)
+		if err != nil {
+			return err
+		}
+		updates["condition_rules"] = rules
+	}
+	if raw, ok := updates["demotion_rules"]; ok {
+		rules, err := decodeAutoGroupDemotionRules(raw)
+		if err != nil {
+			return err
+		}
+		updates["demotion_rules"] = rules
+	}
+	if err := s.writeConfig(updates, true); err != nil {
+		return err
+	}
+	logger.L.Business("自动分组配置已更新")
+	return nil
+}
+
+// writeConfig merges updates into the stored config; only operator saves
+// check and bump the version, so scan bookkeeping never invalidates a form
+// another admin has open
+func (s *AutoGroupService) writeConfig(updates map[string]interface{}, operator bool) error {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
 	config := s.GetConfig()
+	if operator {
+		if err := applyConfigVersion(config, updates); err != nil {
+			return err
+		}
+	}
 	for k, v := range updates {
 		config[k] = v
 	}
 	cm := cache.Get()
 	if err := cm.Set("auto_group:config", config, 0); err != nil {
 		logger.L.Error(fmt.Sprintf("保存自动分组配置失败: %v", err))
-		return false
+		return err
 	}
 	s.invalidateConfigCache()
-	logger.L.Business("自动分组配置已更新")
-	return true
+	return nil
 }
 
 // IsEnabled returns whether auto group is enabled
@@ -339,6 +383,7 @@ func (s *AutoGroupService) GetStats() map[string]interface{} {
 		"next_scan_time":    nextScanTime,
 		"enabled":           enabled,
 		"auto_scan_enabled": autoScanEnabled,
+		"last_run":          s.GetLastRun(),
 	}
 }
 
@@ -601,6 +646,12 @@ func (s *AutoGroupService) GetUsers(page, pageSize int, group, source, keyword s
 
 // assignUser assigns a single user to a target group — matches Python's assign_user()
 func (s *AutoGroupService) assignUser(userID int64, targetGroup, operator string) map[string]interface{} {
+	return s.moveUser(userID, targetGroup, operator, "assign")
+}
+
+// moveUser updates the user's group and writes a revertable log entry with
+// the given action (assign | demote)
+func (s *AutoGroupService) moveUser(userID int64, targetGroup, operator, action string) map[string]interface{} {
 	groupCol := s.getGroupCol()
 	oauthCols := s.buildOAuthSelectCols()
 
@@ -645,14 +696,18 @@ func (s *AutoGroupService) assignUser(userID int64, targetGroup, operator string
 		}
 	}
 
-	s.addUserLog("assign", userID, username, oldGroup, targetGroup, source, operator)
+	s.addUserLog(action, userID, username, oldGroup, targetGroup, source, operator)
 
-	logger.L.Business(fmt.Sprintf("自动分组: 用户分配 user_id=%d username=%s %s -> %s source=%s operator=%s",
-		userID, username, oldGroup, targetGroup, source, operator))
+	verb, message := "分配", fmt.Sprintf("用户 %s 已分配到 %s", username, targetGroup)
+	if action == "demote" {
+		verb, message = "降级", fmt.Sprintf("用户 %s 已从 %s 降级到 %s", username, oldGroup, targetGroup)
+	}
+	logger.L.Business(fmt.Sprintf("自动分组: 用户%s user_id=%d username=%s %s -> %s source=%s operator=%s",
+		verb, userID, username, oldGroup, targetGroup, source, operator))
 
 	return map[string]interface{}{
 		"success":   true,
-		"message":   fmt.Sprintf("用户 %s 已分配到 %s", username, targetGroup),
+		"message":   message,
 		"user_id":   userID,
 		"username":  username,
 		"old_group": oldGroup,
@@ -661,8 +716,19 @@ func (s *AutoGroupService) assignUser(userID int64, targetGroup, operator string
 	}
 }
 
-// 优化1: RunScan 使用批量 UPDATE 消除 N+1
+// RunScan assigns pending users and, when demotion rules are configured,
+// moves users whose conditions no longer hold out of their group; the
+// demotion outcome is returned under "demotion"
 func (s *AutoGroupService) RunScan(dryRun bool) map[string]interface{} {
+	result := s.runAssignScan(dryRun)
+	if rules := s.GetDemotionRules(); len(rules) > 0 {
+		result["demotion"] = s.runDemotions(rules, dryRun)
+	}
+	return result
+}
+
+// 优化1: runAssignScan 使用批量 UPDATE 消除 N+1
+func (s *AutoGroupService) runAssignScan(dryRun bool) map[string]interface{} {
 	config := s.getConfigCached()
 	mode, _ := config["mode"].(string)
 
@@ -675,6 +741,13 @@ func (s *AutoGroupService) RunScan(dryRun bool) map[string]interface{} {
 				"message": "未配置目标分组",
 			}
 		}
+	} else if mode == "by_rules" {
+		if len(s.GetRules()) == 0 {
+			return map[string]interface{}{
+				"success": false,
+				"message": "未配置任何条件规则",
+			}
+		}
 	} else if mode == "by_source" {
 		rules, _ := config["source_rules"].(map[string]interface{})
 		hasAnyRule := false
@@ -786,29 +859,63 @@ func (s *AutoGroupService) RunScan(dryRun bool) map[string]interface{} {
 			logger.L.Business(fmt.Sprintf("自动分组: 批量分配 %d 个用户到 %s", assignedCount, targetGroup))
 		}
 	} else {
-		// by_source 模式 or dry_run: 逐用户处理
+		// by_rules 模式：先批量取出条件所需的已用额度 / 首条日志时间
+		var matcher *autoGroupRuleMatcher
+		if mode == "by_rules" {
+			userIDs := make([]int64, 0, len(users))
+			for _, user := range users {
+				userIDs = append(userIDs, toInt64(user["id"]))
+			}
+			facts, err := s.loadRuleFacts(userIDs)
+			if err != nil {
+				logger.L.Error(fmt.Sprintf("自动分组读取规则条件数据失败: %v", err))
+				return map[string]interface{}{
+					"success": false,
+					"message": fmt.Sprintf("读取规则条件数据失败: %v", err),
+				}
+			}
+			matcher = newAutoGroupRuleMatcher(s.GetRules(), facts)
+		}
+
+		// by_source / by_rules 模式 or dry_run: 逐用户处理
 		for _, user := range users {
 			userID := toInt64(user["id"])
 			username := toString(user["username"])
 			userSource := toString(user["source"])
 
-			targetGroup := s.getTargetGroupBySource(userSource)
+			var targetGroup, ruleName string
+			skipMessage := fmt.Sprintf("来源 %s 未配置目标分组", userSource)
+			if matcher != nil {
+				if rule, reason := matcher.match(userID, userSource); rule != nil {
+					targetGroup, ruleName = rule.TargetGroup, rule.Name
+				} else if reason != "" {
+					skipMessage = "未命中任何条件规则（" + reason + "）"
+				} else {
+					skipMessage = "未命中任何条件规则"
+				}
+			} else {
+				targetGroup = s.getTargetGroupBySource(userSource)
+			}
 
 			if targetGroup == "" {
 				skippedCount++
 				results = append(results, map[string]interface{}{
 					"user_id": userID, "username": username, "source": userSource,
-					"action": "skipped", "message": fmt.Sprintf("来源 %s 未配置目标分组", userSource),
+					"action": "skipped", "message": skipMessage,
 				})
 				continue
 			}
 
 			if dryRun {
 				assignedCount++
+				message := fmt.Sprintf("[试运行] 将分配到 %s", targetGroup)
+				if ruleName != "" {
+					message = fmt.Sprintf("[试运行] 命中 %s，将分配到 %s", ruleName, targetGroup)
+				}
 				results = append(results, map[string]interface{}{
 					"user_id": userID, "username": username, "source": userSource,
-					"target_group": targetGroup, "action": "would_assign",
-					"message": fmt.Sprintf("[试运行] 将分配到 %s", targetGroup),
+					"target_group": targetGroup, "rule": ruleName, "action": "would_assign",
+					"message": message,
 				})
 			} else {
 				result := s.assignUser(userID, targetGroup, "system")
@@ -816,7 +923,7 @@ func (s *AutoGroupService) RunScan(dryRun bool) map[string]interface{} {
 					assignedCount++
 					results = append(results, map[string]interface{}{
 						"user_id": userID, "username": username, "source": userSource,
-						"target_group": targetGroup, "action": "assigned",
+						"target_group": targetGroup, "rule": ruleName, "action": "assigned",
 						"message": toString(result["message"]),
 					})
 				} else {
@@ -833,12 +940,19 @@ func (s *AutoGroupService) RunScan(dryRun bool) map[string]interface{} {
 	elapsed := time.Since(startTime).Seconds()
 
 	// Update last scan time
-	s.SaveConfig(map[string]interface{}{
+	s.writeConfig(map[string]interface{}{
 		"last_scan_time": time.Now().Unix(),
-	})
+	}, false)
 
 	logger.L.Business(fmt.Sprintf("自动分组扫描完成 dry_run=%v total=%d assigned=%d skipped=%d errors=%d elapsed=%.2fs",
 		dryRun, len(users), assignedCount, skippedCount, errorCount, elapsed))
+	PublishEvent(EventScanFinished, map[string]interface{}{
+		"scanner":  "auto_group",
+		"dry_run":  dryRun,
+		"total":    len(users),
+		"assigned": assignedCount,
+		"errors":   errorCount,
+	})
 
 	return map[string]interface{}{
 		"success": true,
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// autoGroupDemotionBatch caps the users one scan evaluates for demotion
+const autoGroupDemotionBatch = 1000
+
+// AutoGroupDemotionRule moves users out of FromGroups once any of its
+// conditions holds — the reverse of an assignment rule. Users whose
+// conditions cannot be resolved (trust level unknown, lookup budget used up)
+// are left alone.
+type AutoGroupDemotionRule struct {
+	Name             string   `json:"name"`
+	FromGroups       []string `json:"from_groups"`
+	TargetGroup      string   `json:"target_group"`       // 空 = default
+	Sources          []string `json:"sources,omitempty"`  // 限定注册来源，空 = 不限
+	LinuxDoSuspended bool     `json:"linux_do_suspended"` // linux.do 账号被论坛封禁
+	BelowTrustLevel  int      `json:"below_trust_level"`  // linux.do 信任等级 < 该值（1-4）
+}
+
+// normalizeAutoGroupDemotionRules validates rules in place
+func normalizeAutoGroupDemotionRules(rules []AutoGroupDemotionRule) error {
+	if len(rules) > autoGroupMaxRules {
+		return fmt.Errorf("%w: 最多 %d 条降级规则", ErrInvalidAutoGroupRule, autoGroupMaxRules)
+	}
+	for i := range rules {
+		r := &rules[i]
+		r.Name = strings.TrimSpace(r.Name)
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("降级规则 %d", i+1)
+		}
+		r.TargetGroup = strings.TrimSpace(r.TargetGroup)
+		if r.TargetGroup == "" {
+			r.TargetGroup = "default"
+		}
+		if len(r.TargetGroup) > 64 {
+			return fmt.Errorf("%w: %s 的目标分组不超过 64 个字符", ErrInvalidAutoGroupRule, r.Name)
+		}
+		groups := make([]string, 0, len(r.FromGroups))
+		for _, g := range r.FromGroups {
+			if g = strings.TrimSpace(g); g != "" && !containsStr(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+		if len(groups) == 0 {
+			return fmt.Errorf("%w: %s 需指定 from_groups", ErrInvalidAutoGroupRule, r.Name)
+		}
+		if containsStr(groups, r.TargetGroup) {
+			return fmt.Errorf("%w: %s 的目标分组不能出现在 from_groups 中", ErrInvalidAutoGroupRule, r.Name)
+		}
+		r.FromGroups = groups
+		for j, src := range r.Sources {
+			src = strings.ToLower(strings.TrimSpace(src))
+			if !containsStr(autoGroupSources, src) {
+				return fmt.Errorf("%w: %s 的注册来源 %q 无效", ErrInvalidAutoGroupRule, r.Name, src)
+			}
+			r.Sources[j] = src
+		}
+		if r.BelowTrustLevel < 0 || r.BelowTrustLevel > 4 {
+			return fmt.Errorf("%w: %s 的 below_trust_level 需在 0-4 之间", ErrInvalidAutoGroupRule, r.Name)
+		}
+		if !r.LinuxDoSuspended && r.BelowTrustLevel == 0 {
+			return fmt.Errorf("%w: %s 至少需要一个降级条件", ErrInvalidAutoGroupRule, r.Name)
+		}
+	}
+	return nil
+}
+
+// decodeAutoGroupDemotionRules converts a config value into demotion rules
+func decodeAutoGroupDemotionRules(raw interface{}) ([]AutoGroupDemotionRule, error) {
+	rules := []AutoGroupDemotionRule{}
+	if raw == nil {
+		return rules, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAutoGroupRule, err)
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%w: demotion_rules 必须是规则数组", ErrInvalidAutoGroupRule)
+	}
+	if err := normalizeAutoGroupDemotionRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetDemotionRules returns the configured demotion rules
+func (s *AutoGroupService) GetDemotionRules() []AutoGroupDemotionRule {
+	rules, err := decodeAutoGroupDemotionRules(s.getConfigCached()["demotion_rules"])
+	if err != nil {
+		return []AutoGroupDemotionRule{}
+	}
+	return rules
+}
+
+// autoGroupDemotionMatcher evaluates demotion rules for one scan, sharing
+// the linux.do lookup budget between trust levels and suspensions
+type autoGroupDemotionMatcher struct {
+	rules     []AutoGroupDemotionRule
+	trust     *autoGroupRuleMatcher
+	suspended map[string]int // linux_do_id -> 1 封禁 / 0 正常 / -1 未知
+}
+
+func newAutoGroupDemotionMatcher(rules []AutoGroupDemotionRule) *autoGroupDemotionMatcher {
+	return &autoGroupDemotionMatcher{
+		rules:     rules,
+		trust:     newAutoGroupRuleMatcher(nil, nil),
+		suspended: map[string]int{},
+	}
+}
+
+func (m *autoGroupDemotionMatcher) suspendedState(linuxDoID string) int {
+	if linuxDoID == "" {
+		return -1
+	}
+	if state, ok := m.suspended[linuxDoID]; ok {
+		return state
+	}
+	state := -1
+	if cached, ok := CachedLinuxDoSuspended(linuxDoID); ok {
+		state = boolToInt(cached)
+	} else if m.trust.trustLookups > 0 {
+		m.trust.trustLookups--
+		if fetched, err := linuxDoSuspendedLookup(linuxDoID); err == nil {
+			state = boolToInt(fetched)
+		}
+	}
+	m.suspended[linuxDoID] = state
+	return state
+}
+
+// match returns the first rule covering the user's group and source whose
+// conditions hold, with the reason. unknown is set when no rule matched but
+// some condition could not be resolved.
+func (m *autoGroupDemotionMatcher) match(group, source, linuxDoID string) (rule *AutoGroupDemotionRule, reason string, unknown bool) {
+	for i := range m.rules {
+		r := &m.rules[i]
+		if !containsStr(r.FromGroups, group) || (len(r.Sources) > 0 && !containsStr(r.Sources, source)) {
+			continue
+		}
+		if r.LinuxDoSuspended {
+			switch m.suspendedState(linuxDoID) {
+			case 1:
+				return r, "linux.do 账号已被论坛封禁", false
+			case -1:
+				unknown = unknown || linuxDoID != ""
+			}
+		}
+		if r.BelowTrustLevel > 0 {
+			if level := m.trust.trustLevel(linuxDoID); level >= 0 && level < r.BelowTrustLevel {
+				return r, fmt.Sprintf("信任等级 %d < %d", level, r.BelowTrustLevel), false
+			} else if level < 0 && linuxDoID != "" {
+				unknown = true
+			}
+		}
+	}
+	return nil, "", unknown
+}
+
+// runDemotions evaluates the demotion rules against active users in their
+// from_groups and moves matches to the rule's target group (logged as
+// "demote", revertable like assignments)
+func (s *AutoGroupService) runDemotions(rules []AutoGroupDemotionRule, dryRun bool) map[string]interface{} {
+	groups := []string{}
+	for _, r := range rules {
+		for _, g := range r.FromGroups {
+			if !containsStr(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+	}
+	groupCol := s.getGroupCol()
+	hasLinuxDo := containsStr(s.getAvailableOAuthColumns(), "linux_do_id")
+	args := make([]interface{}, 0, len(groups))
+	for _, g := range groups {
+		args = append(args, g)
+	}
+	query := fmt.Sprintf("SELECT id, username, %s AS user_group%s FROM users WHERE %s IN (%s) AND deleted_at IS NULL AND status = 1",
+		groupCol, s.buildOAuthSelectCols(), groupCol, placeholders(len(groups)))
+	if whitelist := s.getWhitelistIDs(); len(whitelist) > 0 {
+		in, wlArgs := inClause(whitelist)
+		query += " AND id NOT IN (" + in + ")"
+		args = append(args, wlArgs...)
+	}
+	query += fmt.Sprintf(" ORDER BY id LIMIT %d", autoGroupDemotionBatch)
+
+	rows, err := s.db.Query(s.db.RebindQuery(query), args...)
+	if err != nil {
+		logger.L.Error(fmt.Sprintf("自动分组读取降级候选用户失败: %v", err))
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("读取降级候选用户失败: %v", err),
+		}
+	}
+
+	matcher := newAutoGroupDemotionMatcher(rules)
+	results := []map[string]interface{}{}
+	demoted, kept, unknown, errorCount := 0, 0, 0, 0
+	for _, row := range rows {
+		userID := toInt64(row["id"])
+		username := toString(row["username"])
+		source := s.detectSource(row)
+		oldGroup := toString(row["user_group"])
+		linuxDoID := ""
+		if hasLinuxDo {
+			linuxDoID = strings.TrimSpace(toString(row["linux_do_id"]))
+		}
+
+		rule, reason, undecided := matcher.match(oldGroup, source, linuxDoID)
+		if rule == nil {
+			if undecided {
+				unknown++
+			} else {
+				kept++
+			}
+			continue
+		}
+		entry := map[string]interface{}{
+			"user_id": userID, "username": username, "source": source,
+			"old_group": oldGroup, "target_group": rule.TargetGroup, "rule": rule.Name,
+		}
+		if dryRun {
+			demoted++
+			entry["action"] = "would_demote"
+			entry["message"] = fmt.Sprintf("[试运行] %s（%s），将从 %s 降级到 %s", rule.Name, reason, oldGroup, rule.TargetGroup)
+		} else if result := s.moveUser(userID, rule.TargetGroup, "system", "demote"); result["success"] == true {
+			demoted++
+			entry["action"] = "demoted"
+			entry["message"] = fmt.Sprintf("%s（%s）: %s", rule.Name, reason, toString(result["message"]))
+		} else {
+			errorCount++
+			entry["action"] = "error"
+			entry["message"] = toString(result["message"])
+		}
+		results = append(results, entry)
+	}
+
+	if !dryRun && demoted > 0 {
+		logger.L.Business(fmt.Sprintf("自动分组降级完成 total=%d demoted=%d unknown=%d errors=%d", len(rows), demoted, unknown, errorCount))
+	}
+	return map[string]interface{}{
+		"success": true,
+		"stats": map[string]interface{}{
+			"total":     len(rows),
+			"demoted":   demoted,
+			"kept":      kept,
+			"unknown":   unknown,
+			"errors":    errorCount,
+			"truncated": len(rows) == autoGroupDemotionBatch,
+		},
+		"results": results,
+	}
+}
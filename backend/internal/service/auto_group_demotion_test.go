@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+func TestNormalizeAutoGroupDemotionRules(t *testing.T) {
+	rules := []AutoGroupDemotionRule{{FromGroups: []string{" vip ", "vip", ""}, LinuxDoSuspended: true}}
+	if err := normalizeAutoGroupDemotionRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	if r := rules[0]; r.Name != "降级规则 1" || r.TargetGroup != "default" || len(r.FromGroups) != 1 || r.FromGroups[0] != "vip" {
+		t.Errorf("normalized = %+v", r)
+	}
+	for _, bad := range []AutoGroupDemotionRule{
+		{LinuxDoSuspended: true},
+		{FromGroups: []string{"vip"}},
+		{FromGroups: []string{"vip"}, TargetGroup: "vip", LinuxDoSuspended: true},
+		{FromGroups: []string{"vip"}, BelowTrustLevel: 5},
+	} {
+		if err := normalizeAutoGroupDemotionRules([]AutoGroupDemotionRule{bad}); !errors.Is(err, ErrInvalidAutoGroupRule) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+}
+
+func TestAutoGroupDemotionScan(t *testing.T) {
+	cm := cache.Get()
+	cm.Delete("auto_group:config")
+	t.Cleanup(func() { cm.Delete("auto_group:config") })
+	agOAuthColumnsOnce.Do(func() {})
+	origCols := agAvailableOAuthCols
+	agAvailableOAuthCols = []string{"linux_do_id"}
+	t.Cleanup(func() { agAvailableOAuthCols = origCols })
+
+	// 301 suspended (cached), 302 trust level 1 (looked up), 303 fine, 304 unknown
+	cm.Set(ldSuspendedCachePrefix+"301", true, time.Hour)
+	cm.Set(ldSuspendedCachePrefix+"303", false, time.Hour)
+	cm.Set(ldTrustLevelCachePrefix+"303", 3, time.Hour)
+	t.Cleanup(func() { cm.DeleteByPrefix(cache.Key("linuxdo:")) })
+	origTrust, origSuspended := linuxDoTrustLevelLookup, linuxDoSuspendedLookup
+	linuxDoTrustLevelLookup = func(id string) (int, error) {
+		if id == "302" {
+			return 1, nil
+		}
+		return 0, errors.New("rate limited")
+	}
+	linuxDoSuspendedLookup = func(id string) (bool, error) {
+		if id == "302" {
+			return false, nil
+		}
+		return false, errors.New("rate limited")
+	}
+	t.Cleanup(func() { linuxDoTrustLevelLookup, linuxDoSuspendedLookup = origTrust, origSuspended })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, email TEXT, "group" TEXT,
+			status INTEGER, deleted_at INTEGER, linux_do_id TEXT);
+		INSERT INTO users VALUES
+			(1, 'banned', '', '', 'vip', 1, NULL, '301'),
+			(2, 'newbie', '', '', 'vip', 1, NULL, '302'),
+			(3, 'fine', '', '', 'vip', 1, NULL, '303'),
+			(4, 'unknown', '', '', 'vip', 1, NULL, '304'),
+			(5, 'other', '', '', 'plus', 1, NULL, '301'),
+			(6, 'regular', '', '', 'default', 1, NULL, '');`); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewAutoGroupService()
+	if err := svc.SaveConfig(map[string]interface{}{"demotion_rules": []interface{}{
+		map[string]interface{}{"from_groups": []interface{}{}},
+	}}); !errors.Is(err, ErrInvalidAutoGroupRule) {
+		t.Fatalf("invalid demotion rule saved: %v", err)
+	}
+	if err := svc.SaveConfig(map[string]interface{}{
+		"enabled":      true,
+		"mode":         "simple",
+		"target_group": "vip",
+		"demotion_rules": []interface{}{
+			map[string]interface{}{"name": "论坛封禁", "from_groups": []interface{}{"vip"}, "linux_do_suspended": true, "below_trust_level": 2.0},
+		},
+		"whitelist_ids": []interface{}{6.0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewAutoGroupService().RunScan(true)
+	demotion, _ := result["demotion"].(map[string]interface{})
+	if ok, _ := demotion["success"].(bool); !ok {
+		t.Fatalf("scan = %v", result)
+	}
+	stats := demotion["stats"].(map[string]interface{})
+	if stats["total"] != 4 || stats["demoted"] != 2 || stats["kept"] != 1 || stats["unknown"] != 1 {
+		t.Errorf("stats = %v", stats)
+	}
+	results := demotion["results"].([]map[string]interface{})
+	want := map[int64]string{1: "[试运行] 论坛封禁（linux.do 账号已被论坛封禁），将从 vip 降级到 default", 2: "[试运行] 论坛封禁（信任等级 1 < 2），将从 vip 降级到 default"}
+	if len(results) != len(want) {
+		t.Fatalf("results = %v", results)
+	}
+	for _, r := range results {
+		if id := toInt64(r["user_id"]); r["message"] != want[id] || r["action"] != "would_demote" {
+			t.Errorf("user %d = %v", id, r)
+		}
+	}
+}
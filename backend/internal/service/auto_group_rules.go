@@ -0,0 +1,221 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+var ErrInvalidAutoGroupRule = errors.New("invalid auto group rule")
+
+// autoGroupMaxRules caps the by_rules rule list
+const autoGroupMaxRules = 50
+
+// autoGroupTrustLookupsPerScan bounds the linux.do profile fetches of one scan;
+// users beyond it are matched on cached trust levels only
+const autoGroupTrustLookupsPerScan = 20
+
+// autoGroupSources are the registration sources detectSource can return
+var autoGroupSources = []string{"github", "wechat", "telegram", "discord", "oidc", "linux_do", "password"}
+
+// AutoGroupRule is one rule of the by_rules mode. Every set condition must
+// hold (0 / empty = no condition); rules are tried in order and the first
+// match decides the target group.
+type AutoGroupRule struct {
+	Name              string   `json:"name"`
+	TargetGroup       string   `json:"target_group"`
+	Sources           []string `json:"sources,omitempty"`    // 限定注册来源，空 = 不限
+	MinTrustLevel     int      `json:"min_trust_level"`      // linux.do 信任等级 ≥ 该值（1-4），需绑定 linux_do_id
+	MinAccountAgeDays int      `json:"min_account_age_days"` // 距首条日志的天数 ≥ 该值
+	MinQuotaUsed      int64    `json:"min_quota_used"`       // 累计已用额度（users.used_quota）≥ 该值
+}
+
+// normalizeAutoGroupRules validates rules in place
+func normalizeAutoGroupRules(rules []AutoGroupRule) error {
+	if len(rules) > autoGroupMaxRules {
+		return fmt.Errorf("%w: 最多 %d 条规则", ErrInvalidAutoGroupRule, autoGroupMaxRules)
+	}
+	for i := range rules {
+		r := &rules[i]
+		r.Name = strings.TrimSpace(r.Name)
+		r.TargetGroup = strings.TrimSpace(r.TargetGroup)
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("规则 %d", i+1)
+		}
+		if r.TargetGroup == "" || len(r.TargetGroup) > 64 {
+			return fmt.Errorf("%w: %s 的目标分组不能为空且不超过 64 个字符", ErrInvalidAutoGroupRule, r.Name)
+		}
+		for j, src := range r.Sources {
+			src = strings.ToLower(strings.TrimSpace(src))
+			if !containsStr(autoGroupSources, src) {
+				return fmt.Errorf("%w: %s 的注册来源 %q 无效", ErrInvalidAutoGroupRule, r.Name, src)
+			}
+			r.Sources[j] = src
+		}
+		if r.MinTrustLevel < 0 || r.MinTrustLevel > 4 {
+			return fmt.Errorf("%w: %s 的 min_trust_level 需在 0-4 之间", ErrInvalidAutoGroupRule, r.Name)
+		}
+		if r.MinAccountAgeDays < 0 || r.MinAccountAgeDays > 3650 {
+			return fmt.Errorf("%w: %s 的 min_account_age_days 需在 0-3650 之间", ErrInvalidAutoGroupRule, r.Name)
+		}
+		if r.MinQuotaUsed < 0 {
+			return fmt.Errorf("%w: %s 的 min_quota_used 不能为负数", ErrInvalidAutoGroupRule, r.Name)
+		}
+	}
+	return nil
+}
+
+// decodeAutoGroupRules converts a config value (JSON-decoded or typed) into rules
+func decodeAutoGroupRules(raw interface{}) ([]AutoGroupRule, error) {
+	rules := []AutoGroupRule{}
+	if raw == nil {
+		return rules, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAutoGroupRule, err)
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%w: condition_rules 必须是规则数组", ErrInvalidAutoGroupRule)
+	}
+	if err := normalizeAutoGroupRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetRules returns the by_rules condition rules
+func (s *AutoGroupService) GetRules() []AutoGroupRule {
+	rules, err := decodeAutoGroupRules(s.getConfigCached()["condition_rules"])
+	if err != nil {
+		return []AutoGroupRule{}
+	}
+	return rules
+}
+
+// autoGroupFacts is what the rule conditions are evaluated against
+type autoGroupFacts struct {
+	LinuxDoID  string
+	QuotaUsed  int64
+	FirstLogAt int64 // 0 = 没有任何日志
+}
+
+// loadRuleFacts reads used quota / linux_do_id from users and the first log
+// time from logs (possibly a separate database, so no JOIN)
+func (s *AutoGroupService) loadRuleFacts(userIDs []int64) (map[int64]*autoGroupFacts, error) {
+	facts := make(map[int64]*autoGroupFacts, len(userIDs))
+	hasLinuxDo := containsStr(s.getAvailableOAuthColumns(), "linux_do_id")
+	cols := "id, COALESCE(used_quota, 0) AS used_quota"
+	if hasLinuxDo {
+		cols += ", linux_do_id"
+	}
+	logDB := database.GetLog().WithContext(s.db.Context())
+	const chunk = 500
+	for i := 0; i < len(userIDs); i += chunk {
+		end := min(i+chunk, len(userIDs))
+		in, args := inClause(userIDs[i:end])
+		rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf("SELECT %s FROM users WHERE id IN (%s)", cols, in)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			f := &autoGroupFacts{QuotaUsed: toInt64(r["used_quota"])}
+			if hasLinuxDo {
+				f.LinuxDoID = strings.TrimSpace(toString(r["linux_do_id"]))
+			}
+			facts[toInt64(r["id"])] = f
+		}
+		logRows, err := logDB.QueryWithTimeout(30*time.Second, logDB.RebindQuery(fmt.Sprintf(
+			"SELECT user_id, MIN(created_at) AS first_at FROM logs WHERE user_id IN (%s) GROUP BY user_id", in)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range logRows {
+			if f := facts[toInt64(r["user_id"])]; f != nil {
+				f.FirstLogAt = toInt64(r["first_at"])
+			}
+		}
+	}
+	return facts, nil
+}
+
+// autoGroupRuleMatcher evaluates the rules for one scan; trust levels are
+// resolved at most once per user and fetched within the lookup budget
+type autoGroupRuleMatcher struct {
+	rules        []AutoGroupRule
+	facts        map[int64]*autoGroupFacts
+	trustLookups int
+	trustLevels  map[string]int // linux_do_id -> level, -1 = 未知
+	now          int64
+}
+
+func newAutoGroupRuleMatcher(rules []AutoGroupRule, facts map[int64]*autoGroupFacts) *autoGroupRuleMatcher {
+	return &autoGroupRuleMatcher{
+		rules: rules, facts: facts, trustLookups: autoGroupTrustLookupsPerScan,
+		trustLevels: map[string]int{}, now: time.Now().Unix(),
+	}
+}
+
+func (m *autoGroupRuleMatcher) trustLevel(linuxDoID string) int {
+	if linuxDoID == "" {
+		return -1
+	}
+	if level, ok := m.trustLevels[linuxDoID]; ok {
+		return level
+	}
+	level := -1
+	if cached, ok := CachedLinuxDoTrustLevel(linuxDoID); ok {
+		level = cached
+	} else if m.trustLookups > 0 {
+		m.trustLookups--
+		if fetched, err := linuxDoTrustLevelLookup(linuxDoID); err == nil {
+			level = fetched
+		}
+	}
+	m.trustLevels[linuxDoID] = level
+	return level
+}
+
+// match returns the first rule the user satisfies, or nil with the reason the
+// closest rule (the first one whose source filter applies) failed
+func (m *autoGroupRuleMatcher) match(userID int64, source string) (*AutoGroupRule, string) {
+	f := m.facts[userID]
+	if f == nil {
+		f = &autoGroupFacts{}
+	}
+	reason := ""
+	for i := range m.rules {
+		r := &m.rules[i]
+		if len(r.Sources) > 0 && !containsStr(r.Sources, source) {
+			continue
+		}
+		miss := ""
+		if r.MinQuotaUsed > 0 && f.QuotaUsed < r.MinQuotaUsed {
+			miss = fmt.Sprintf("已用额度 %d < %d", f.QuotaUsed, r.MinQuotaUsed)
+		} else if r.MinAccountAgeDays > 0 {
+			if f.FirstLogAt == 0 {
+				miss = "没有请求记录"
+			} else if age := int((m.now - f.FirstLogAt) / 86400); age < r.MinAccountAgeDays {
+				miss = fmt.Sprintf("首次请求距今 %d 天 < %d", age, r.MinAccountAgeDays)
+			}
+		}
+		if miss == "" && r.MinTrustLevel > 0 {
+			if level := m.trustLevel(f.LinuxDoID); level < 0 {
+				miss = "信任等级未知"
+			} else if level < r.MinTrustLevel {
+				miss = fmt.Sprintf("信任等级 %d < %d", level, r.MinTrustLevel)
+			}
+		}
+		if miss == "" {
+			return r, ""
+		}
+		if reason == "" {
+			reason = r.Name + ": " + miss
+		}
+	}
+	return nil, reason
+}
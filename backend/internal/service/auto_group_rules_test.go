@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+func TestNormalizeAutoGroupRules(t *testing.T) {
+	rules := []AutoGroupRule{{TargetGroup: " vip ", Sources: []string{"LINUX_DO"}, MinTrustLevel: 2}}
+	if err := normalizeAutoGroupRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].Name != "规则 1" || rules[0].TargetGroup != "vip" || rules[0].Sources[0] != "linux_do" {
+		t.Errorf("normalized = %+v", rules[0])
+	}
+	for _, bad := range []AutoGroupRule{
+		{TargetGroup: ""},
+		{TargetGroup: "vip", Sources: []string{"qq"}},
+		{TargetGroup: "vip", MinTrustLevel: 5},
+		{TargetGroup: "vip", MinQuotaUsed: -1},
+	} {
+		if err := normalizeAutoGroupRules([]AutoGroupRule{bad}); !errors.Is(err, ErrInvalidAutoGroupRule) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+	if _, err := decodeAutoGroupRules("nope"); !errors.Is(err, ErrInvalidAutoGroupRule) {
+		t.Errorf("non-list rules: %v", err)
+	}
+}
+
+func TestAutoGroupRuleMatcher(t *testing.T) {
+	cm := cache.Get()
+	cm.Set(ldTrustLevelCachePrefix+"101", 3, time.Hour)
+	t.Cleanup(func() { cm.Delete(ldTrustLevelCachePrefix + "101") })
+	lookups := 0
+	orig := linuxDoTrustLevelLookup
+	linuxDoTrustLevelLookup = func(string) (int, error) {
+		lookups++
+		return 1, nil
+	}
+	t.Cleanup(func() { linuxDoTrustLevelLookup = orig })
+
+	now := time.Now().Unix()
+	rules := []AutoGroupRule{
+		{Name: "老用户", TargetGroup: "vip", MinTrustLevel: 2, MinAccountAgeDays: 30},
+		{Name: "大户", TargetGroup: "plus", MinQuotaUsed: 1000},
+		{Name: "GitHub", TargetGroup: "gh", Sources: []string{"github"}},
+	}
+	m := newAutoGroupRuleMatcher(rules, map[int64]*autoGroupFacts{
+		1: {LinuxDoID: "101", FirstLogAt: now - 40*86400},
+		2: {LinuxDoID: "102", FirstLogAt: now - 40*86400, QuotaUsed: 5000},
+		3: {FirstLogAt: now - 86400},
+		4: {LinuxDoID: "101", FirstLogAt: now - 5*86400},
+	})
+
+	if r, _ := m.match(1, "linux_do"); r == nil || r.TargetGroup != "vip" {
+		t.Errorf("user 1 = %+v", r)
+	}
+	// Trust level 1 (looked up) fails the first rule, quota matches the second
+	if r, _ := m.match(2, "linux_do"); r == nil || r.TargetGroup != "plus" || lookups != 1 {
+		t.Errorf("user 2 = %+v lookups=%d", r, lookups)
+	}
+	if r, _ := m.match(3, "github"); r == nil || r.TargetGroup != "gh" {
+		t.Errorf("github user = %+v", r)
+	}
+	r, reason := m.match(4, "linux_do")
+	if r != nil || reason != "老用户: 首次请求距今 5 天 < 30" {
+		t.Errorf("user 4 = %+v %q", r, reason)
+	}
+	if _, reason := m.match(99, "password"); reason != "老用户: 没有请求记录" {
+		t.Errorf("unknown user reason = %q", reason)
+	}
+
+	m.trustLookups = 0
+	if _, reason := m.match(5, "linux_do"); reason == "" {
+		t.Error("expected a miss reason")
+	}
+}
+
+func TestAutoGroupScanByRules(t *testing.T) {
+	cm := cache.Get()
+	cm.Delete("auto_group:config")
+	t.Cleanup(func() { cm.Delete("auto_group:config") })
+	agOAuthColumnsOnce.Do(func() {})
+	origCols := agAvailableOAuthCols
+	agAvailableOAuthCols = []string{"linux_do_id"}
+	t.Cleanup(func() { agAvailableOAuthCols = origCols })
+	cm.Set(ldTrustLevelCachePrefix+"201", 3, time.Hour)
+	t.Cleanup(func() { cm.Delete(ldTrustLevelCachePrefix + "201") })
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, email TEXT, "group" TEXT,
+			status INTEGER, deleted_at INTEGER, used_quota INTEGER, linux_do_id TEXT);
+		INSERT INTO users VALUES
+			(1, 'alice', '', '', 'default', 1, NULL, 0, '201'),
+			(2, 'bob', '', '', '', 1, NULL, 9000, ''),
+			(3, 'carol', '', '', 'default', 1, NULL, 0, ''),
+			(4, 'dave', '', '', 'vip', 1, NULL, 0, '201');
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type INTEGER, created_at INTEGER);`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO logs (user_id, type, created_at) VALUES (1, 2, ?), (1, 2, ?), (2, 2, ?)`,
+		now-60*86400, now, now-86400); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewAutoGroupService()
+	if err := svc.SaveConfig(map[string]interface{}{"condition_rules": []interface{}{
+		map[string]interface{}{"target_group": "x", "min_trust_level": 9.0},
+	}}); !errors.Is(err, ErrInvalidAutoGroupRule) {
+		t.Fatalf("invalid rule saved: %v", err)
+	}
+	if err := svc.SaveConfig(map[string]interface{}{
+		"enabled": true,
+		"mode":    "by_rules",
+		"condition_rules": []interface{}{
+			map[string]interface{}{"name": "老用户", "target_group": "vip", "min_trust_level": 2.0, "min_account_age_days": 30.0},
+			map[string]interface{}{"name": "大户", "target_group": "plus", "min_quota_used": 1000.0},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewAutoGroupService().RunScan(true)
+	if ok, _ := result["success"].(bool); !ok {
+		t.Fatalf("scan = %v", result)
+	}
+	want := map[int64]string{1: "vip", 2: "plus", 3: ""}
+	results, _ := result["results"].([]map[string]interface{})
+	if len(results) != len(want) {
+		t.Fatalf("results = %v", results)
+	}
+	for _, r := range results {
+		id := toInt64(r["user_id"])
+		if got := toString(r["target_group"]); got != want[id] {
+			t.Errorf("user %d → %q, want %q (%v)", id, got, want[id], r["message"])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// autoGroupLastRunKey stores the summary of the last real (non dry-run) scan
+const autoGroupLastRunKey = "auto_group:last_run"
+
+// autoGroupLastRunMaxResults caps the per-user results kept with the last run
+const autoGroupLastRunMaxResults = 200
+
+// autoGroupScanMu serialises real scans (scheduler vs manual trigger)
+var autoGroupScanMu sync.Mutex
+
+// AutoGroupRun is the outcome of one real scan
+type AutoGroupRun struct {
+	Trigger        string                   `json:"trigger"` // schedule | manual
+	StartedAt      int64                    `json:"started_at"`
+	FinishedAt     int64                    `json:"finished_at"`
+	Success        bool                     `json:"success"`
+	Message        string                   `json:"message,omitempty"`
+	Stats          map[string]interface{}   `json:"stats"`
+	ElapsedSeconds string                   `json:"elapsed_seconds"`
+	Results        []map[string]interface{} `json:"results"`
+	Truncated      bool                     `json:"truncated"` // results 只保留前 200 条
+	Demotion       map[string]interface{}   `json:"demotion,omitempty"`
+}
+
+// ScanAndRecord runs a real scan and keeps its summary as the last run
+func (s *AutoGroupService) ScanAndRecord(trigger string) map[string]interface{} {
+	autoGroupScanMu.Lock()
+	defer autoGroupScanMu.Unlock()
+
+	started := time.Now()
+	result := s.RunScan(false)
+	run := &AutoGroupRun{
+		Trigger:        trigger,
+		StartedAt:      started.Unix(),
+		FinishedAt:     time.Now().Unix(),
+		Message:        toString(result["message"]),
+		ElapsedSeconds: toString(result["elapsed_seconds"]),
+		Results:        []map[string]interface{}{},
+	}
+	run.Success, _ = result["success"].(bool)
+	run.Stats, _ = result["stats"].(map[string]interface{})
+	run.Demotion, _ = result["demotion"].(map[string]interface{})
+	if results, ok := result["results"].([]map[string]interface{}); ok {
+		run.Results = results
+		if len(results) > autoGroupLastRunMaxResults {
+			run.Results, run.Truncated = results[:autoGroupLastRunMaxResults], true
+		}
+	}
+	if err := cache.Get().Set(autoGroupLastRunKey, run, 0); err != nil {
+		logger.L.Warn(fmt.Sprintf("保存自动分组扫描结果失败: %v", err))
+	}
+	return result
+}
+
+// GetLastRun returns the last real scan, or nil before the first one
+func (s *AutoGroupService) GetLastRun() *AutoGroupRun {
+	var run AutoGroupRun
+	if found, _ := cache.Get().GetJSON(autoGroupLastRunKey, &run); !found {
+		return nil
+	}
+	return &run
+}
+
+// ScheduledScanDue reports whether auto_scan_enabled is on and
+// scan_interval_minutes have passed since the last scan. Failed or empty
+// scans do not move last_scan_time, so the last run's start counts too.
+func (s *AutoGroupService) ScheduledScanDue(now time.Time) bool {
+	config := s.getConfigCached()
+	enabled, _ := config["enabled"].(bool)
+	autoScan, _ := config["auto_scan_enabled"].(bool)
+	interval := toInt64(config["scan_interval_minutes"])
+	if !enabled || !autoScan || interval <= 0 {
+		return false
+	}
+	last := toInt64(config["last_scan_time"])
+	if run := s.GetLastRun(); run != nil && run.StartedAt > last {
+		last = run.StartedAt
+	}
+	return now.Unix()-last >= interval*60
+}
+
+// RunScheduledScan performs a real scan when one is due; returns nil otherwise
+func (s *AutoGroupService) RunScheduledScan() map[string]interface{} {
+	if !s.ScheduledScanDue(time.Now()) {
+		return nil
+	}
+	return s.ScanAndRecord("schedule")
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+func TestAutoGroupScheduledScan(t *testing.T) {
+	cm := cache.Get()
+	reset := func() {
+		cm.Delete("auto_group:config")
+		cm.Delete(autoGroupLastRunKey)
+	}
+	reset()
+	t.Cleanup(reset)
+	agOAuthColumnsOnce.Do(func() {})
+	origCols := agAvailableOAuthCols
+	agAvailableOAuthCols = []string{}
+	t.Cleanup(func() { agAvailableOAuthCols = origCols })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, email TEXT, "group" TEXT,
+			status INTEGER, deleted_at INTEGER);
+		INSERT INTO users VALUES (1, 'alice', '', '', 'vip', 1, NULL), (2, 'bob', '', '', 'default', 2, NULL);`); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewAutoGroupService()
+	if err := svc.SaveConfig(map[string]interface{}{"enabled": true, "mode": "simple", "target_group": "vip"}); err != nil {
+		t.Fatal(err)
+	}
+	if svc.RunScheduledScan() != nil {
+		t.Fatal("scan ran while auto_scan_enabled is off")
+	}
+	if err := svc.SaveConfig(map[string]interface{}{"auto_scan_enabled": true, "scan_interval_minutes": 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody is pending (assigned or disabled): the empty scan is still recorded
+	result := NewAutoGroupService().RunScheduledScan()
+	if ok, _ := result["success"].(bool); !ok {
+		t.Fatalf("scheduled scan = %v", result)
+	}
+	run := svc.GetLastRun()
+	if run == nil || run.Trigger != "schedule" || !run.Success || len(run.Results) != 0 || toInt64(run.Stats["total"]) != 0 {
+		t.Fatalf("last run = %+v", run)
+	}
+	fresh := NewAutoGroupService()
+	if fresh.ScheduledScanDue(time.Now()) {
+		t.Error("scan due again right after running")
+	}
+	if !fresh.ScheduledScanDue(time.Now().Add(31 * time.Minute)) {
+		t.Error("scan not due after the interval")
+	}
+
+	// A scan that fails validation still counts as a run, so it is not retried every minute
+	if err := svc.SaveConfig(map[string]interface{}{"target_group": ""}); err != nil {
+		t.Fatal(err)
+	}
+	cm.Delete(autoGroupLastRunKey)
+	svc.writeConfig(map[string]interface{}{"last_scan_time": 0}, false)
+	if result = NewAutoGroupService().RunScheduledScan(); result == nil || result["success"] != false {
+		t.Fatalf("misconfigured scan = %v", result)
+	}
+	if run = svc.GetLastRun(); run == nil || run.Success || run.Message != "未配置目标分组" {
+		t.Errorf("failed last run = %+v", run)
+	}
+	if NewAutoGroupService().ScheduledScanDue(time.Now()) {
+		t.Error("failed scan retried before the interval")
+	}
+}
@@ -0,0 +1,438 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// backupFormatVersion is bumped when the archive layout changes; restore
+// rejects archives from a newer version
+const backupFormatVersion = 1
+
+const (
+	backupManifestName = "manifest.json"
+	backupRedisName    = "redis.json"
+	backupFilesDir     = "db/"
+	backupMaxFileBytes = 8 << 30 // 单个数据库文件上限
+)
+
+var (
+	ErrInvalidBackup = errors.New("invalid backup archive")
+	ErrBackupBusy    = errors.New("backup or restore already in progress")
+)
+
+// backupMu serializes backup and restore
+var backupMu sync.Mutex
+
+// backupRedisPrefix bounds which Redis keys a restore may write
+var backupRedisPrefix = []string{"ai_ban:", "auto_group:", "model_status:"}
+
+// backupRedisKeys are the Redis keys that hold configuration rather than
+// cached query results (written with no expiry)
+var backupRedisKeys = []string{
+	"ai_ban:config",
+	"ai_ban:whitelist",
+	"ai_ban:whitelist_reasons",
+	"ai_ban:whitelist_rules",
+	"ai_ban:audit_logs",
+	"auto_group:config",
+	"model_status:selected_models",
+	"model_status:time_window",
+	"model_status:theme",
+	"model_status:refresh_interval",
+	"model_status:sort_mode",
+	"model_status:custom_order",
+	"model_status:custom_groups",
+	"model_status:site_title",
+	"model_status:embed_token",
+}
+
+// BackupFile is one SQLite file in a backup
+type BackupFile struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupManifest describes a backup archive
+type BackupManifest struct {
+	Version   int          `json:"version"`
+	CreatedAt int64        `json:"created_at"`
+	Files     []BackupFile `json:"files"`
+	RedisKeys []string     `json:"redis_keys"`
+}
+
+// RestoreResult is the outcome of a restore
+type RestoreResult struct {
+	Manifest      BackupManifest `json:"manifest"`
+	RestoredFiles []string       `json:"restored_files"`
+	PreviousFiles []string       `json:"previous_files"` // 被替换的旧文件（保留在 DATA_DIR 以便回退）
+	RedisKeys     []string       `json:"redis_keys"`
+	Errors        []string       `json:"errors,omitempty"`
+}
+
+// Backup is a consistent snapshot of the tool-local state, ready to stream
+type Backup struct {
+	Manifest BackupManifest
+	dir      string
+	redis    map[string]json.RawMessage
+}
+
+// BackupService dumps and restores the tool-local state: every SQLite file in
+// DATA_DIR (settings, analytics rollups, audit trail, abuse broadcast cache,
+// ...) plus the configuration keys kept in Redis
+type BackupService struct{}
+
+// NewBackupService creates a BackupService
+func NewBackupService() *BackupService {
+	return &BackupService{}
+}
+
+func backupDataDir() string {
+	dataDir := strings.TrimSpace(config.Get().DataDir)
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return dataDir
+}
+
+// localDataFiles lists the SQLite files directly under DATA_DIR
+func localDataFiles() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(backupDataDir(), "*.db"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	return names, nil
+}
+
+// validBackupFileName rejects anything that is not a plain *.db file name
+func validBackupFileName(name string) bool {
+	return strings.HasSuffix(name, ".db") && name == filepath.Base(name) && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
+
+// Create snapshots every local database (VACUUM INTO, safe while the service
+// is running) and reads the Redis configuration keys. Call Cleanup when done.
+func (s *BackupService) Create(ctx context.Context) (*Backup, error) {
+	if !backupMu.TryLock() {
+		return nil, ErrBackupBusy
+	}
+	defer backupMu.Unlock()
+
+	if err := os.MkdirAll(backupDataDir(), 0750); err != nil {
+		return nil, err
+	}
+	names, err := localDataFiles()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(backupDataDir(), ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{
+		Manifest: BackupManifest{Version: backupFormatVersion, CreatedAt: time.Now().Unix(), Files: []BackupFile{}, RedisKeys: []string{}},
+		dir:      dir,
+		redis:    make(map[string]json.RawMessage),
+	}
+	for _, name := range names {
+		f, err := snapshotSQLite(ctx, filepath.Join(backupDataDir(), name), filepath.Join(dir, name))
+		if err != nil {
+			b.Cleanup()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		f.Name = name
+		b.Manifest.Files = append(b.Manifest.Files, f)
+	}
+
+	cm := cache.Get()
+	for _, key := range backupRedisKeys {
+		var raw json.RawMessage
+		if found, err := cm.GetJSON(key, &raw); err != nil || !found {
+			continue
+		}
+		b.redis[key] = raw
+		b.Manifest.RedisKeys = append(b.Manifest.RedisKeys, key)
+	}
+	return b, nil
+}
+
+// snapshotSQLite writes a consistent copy of src to dest and hashes it
+func snapshotSQLite(ctx context.Context, src, dest string) (BackupFile, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(src))
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		return BackupFile{}, err
+	}
+	return hashBackupFile(dest)
+}
+
+func hashBackupFile(path string) (BackupFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	return BackupFile{Bytes: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// FileName is the suggested download name
+func (b *Backup) FileName() string {
+	return "newapi-tools-backup-" + time.Unix(b.Manifest.CreatedAt, 0).Format("20060102-150405") + ".tar.gz"
+}
+
+// Write streams the backup as a tar.gz archive
+func (b *Backup) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeJSON := func(name string, v interface{}) error {
+		raw, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(raw)), ModTime: time.Now()}); err != nil {
+			return err
+		}
+		_, err = tw.Write(raw)
+		return err
+	}
+
+	if err := writeJSON(backupManifestName, b.Manifest); err != nil {
+		return err
+	}
+	if err := writeJSON(backupRedisName, b.redis); err != nil {
+		return err
+	}
+	for _, f := range b.Manifest.Files {
+		if err := tw.WriteHeader(&tar.Header{Name: backupFilesDir + f.Name, Mode: 0600, Size: f.Bytes, ModTime: time.Now()}); err != nil {
+			return err
+		}
+		src, err := os.Open(filepath.Join(b.dir, f.Name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Cleanup removes the snapshot files
+func (b *Backup) Cleanup() {
+	_ = os.RemoveAll(b.dir)
+}
+
+// Restore imports a backup archive: every database file is verified (sha256
+// + integrity check) before any live file is touched; the replaced files are
+// kept as <name>.pre-restore-<ts> next to the new ones. Runtime settings are
+// reloaded afterwards so no restart is needed.
+func (s *BackupService) Restore(ctx context.Context, r io.Reader, restoreRedis bool) (*RestoreResult, error) {
+	if !backupMu.TryLock() {
+		return nil, ErrBackupBusy
+	}
+	defer backupMu.Unlock()
+
+	dataDir := backupDataDir()
+	if err := os.MkdirAll(dataDir, 0750); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(dataDir, ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, redisValues, err := extractBackup(r, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		got, err := hashBackupFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			return nil, fmt.Errorf("%w: 缺少 %s", ErrInvalidBackup, f.Name)
+		}
+		if got.SHA256 != f.SHA256 {
+			return nil, fmt.Errorf("%w: %s 校验和不匹配", ErrInvalidBackup, f.Name)
+		}
+		if err := checkSQLiteIntegrity(ctx, filepath.Join(dir, f.Name)); err != nil {
+			return nil, fmt.Errorf("%w: %s 不是有效的 SQLite 数据库: %v", ErrInvalidBackup, f.Name, err)
+		}
+	}
+
+	result := &RestoreResult{Manifest: manifest, RestoredFiles: []string{}, PreviousFiles: []string{}, RedisKeys: []string{}}
+	suffix := fmt.Sprintf(".pre-restore-%d", time.Now().Unix())
+	for _, f := range manifest.Files {
+		live := filepath.Join(dataDir, f.Name)
+		if _, err := os.Stat(live); err == nil {
+			checkpointSQLite(ctx, live)
+			if err := os.Rename(live, live+suffix); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.Name, err))
+				continue
+			}
+			result.PreviousFiles = append(result.PreviousFiles, f.Name+suffix)
+		}
+		// 旧库的 WAL 不能套用到新文件上
+		_ = os.Remove(live + "-wal")
+		_ = os.Remove(live + "-shm")
+		if err := os.Rename(filepath.Join(dir, f.Name), live); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.Name, err))
+			continue
+		}
+		result.RestoredFiles = append(result.RestoredFiles, f.Name)
+	}
+
+	if restoreRedis {
+		cm := cache.Get()
+		for _, key := range manifest.RedisKeys {
+			raw, ok := redisValues[key]
+			if !ok {
+				continue
+			}
+			if err := cm.Set(key, raw, 0); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("redis %s: %v", key, err))
+				continue
+			}
+			result.RedisKeys = append(result.RedisKeys, key)
+		}
+	}
+
+	result.Errors = append(result.Errors, NewSettingsService().Reload(ctx)...)
+	logger.L.System(fmt.Sprintf("[备份] 已恢复 %d 个数据库文件、%d 个 Redis 键", len(result.RestoredFiles), len(result.RedisKeys)))
+	return result, nil
+}
+
+// extractBackup unpacks the archive into dir and validates its layout
+func extractBackup(r io.Reader, dir string) (BackupManifest, map[string]json.RawMessage, error) {
+	var manifest BackupManifest
+	redisValues := make(map[string]json.RawMessage)
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	seenManifest := false
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		switch {
+		case h.Name == backupManifestName:
+			if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&manifest); err != nil {
+				return manifest, nil, fmt.Errorf("%w: manifest: %v", ErrInvalidBackup, err)
+			}
+			seenManifest = true
+		case h.Name == backupRedisName:
+			if err := json.NewDecoder(io.LimitReader(tr, 64<<20)).Decode(&redisValues); err != nil {
+				return manifest, nil, fmt.Errorf("%w: redis: %v", ErrInvalidBackup, err)
+			}
+		case strings.HasPrefix(h.Name, backupFilesDir):
+			name := strings.TrimPrefix(h.Name, backupFilesDir)
+			if !validBackupFileName(name) || h.Typeflag != tar.TypeReg || h.Size > backupMaxFileBytes {
+				return manifest, nil, fmt.Errorf("%w: 非法文件 %s", ErrInvalidBackup, h.Name)
+			}
+			out, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return manifest, nil, err
+			}
+			_, err = io.Copy(out, io.LimitReader(tr, backupMaxFileBytes))
+			out.Close()
+			if err != nil {
+				return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+			}
+		}
+	}
+
+	if !seenManifest {
+		return manifest, nil, fmt.Errorf("%w: 缺少 manifest.json", ErrInvalidBackup)
+	}
+	if manifest.Version <= 0 || manifest.Version > backupFormatVersion {
+		return manifest, nil, fmt.Errorf("%w: 不支持的备份版本 %d", ErrInvalidBackup, manifest.Version)
+	}
+	for _, f := range manifest.Files {
+		if !validBackupFileName(f.Name) {
+			return manifest, nil, fmt.Errorf("%w: 非法文件名 %s", ErrInvalidBackup, f.Name)
+		}
+	}
+	for _, key := range manifest.RedisKeys {
+		if !hasAnyPrefix(key, backupRedisPrefix) {
+			return manifest, nil, fmt.Errorf("%w: 不允许恢复的 Redis 键 %s", ErrInvalidBackup, key)
+		}
+	}
+	return manifest, redisValues, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkSQLiteIntegrity(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var res string
+	if err := db.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&res); err != nil {
+		return err
+	}
+	if res != "ok" {
+		return errors.New(res)
+	}
+	return nil
+}
+
+// checkpointSQLite folds the WAL back into the main file before it is moved
+func checkpointSQLite(ctx context.Context, path string) {
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	_, _ = db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", dataDir)
+	config.Load()
+	logger.Init("error", "")
+	cm := cache.Get()
+	t.Cleanup(func() { _ = cm.Delete("model_status:site_title") })
+
+	ctx := context.Background()
+	if err := saveLocalSetting(ctx, "backup_test", map[string]string{"v": "before"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = cm.Set("model_status:site_title", "Before", 0)
+
+	svc := NewBackupService()
+	backup, err := svc.Create(ctx)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := backup.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	backup.Cleanup()
+	if len(backup.Manifest.Files) != 1 || backup.Manifest.Files[0].Name != localStoreFile ||
+		!containsString(backup.Manifest.RedisKeys, "model_status:site_title") {
+		t.Fatalf("unexpected manifest %+v", backup.Manifest)
+	}
+	archive := buf.Bytes()
+
+	// state drifts after the backup
+	_ = saveLocalSetting(ctx, "backup_test", map[string]string{"v": "after"})
+	_ = cm.Set("model_status:site_title", "After", 0)
+
+	if _, err := svc.Restore(ctx, strings.NewReader("not a backup"), true); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("garbage should be rejected, got %v", err)
+	}
+	if _, err := svc.Restore(ctx, bytes.NewReader(tamperBackup(t, archive)), true); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("checksum mismatch should be rejected, got %v", err)
+	}
+	var v map[string]string
+	if _, _ = loadLocalSetting(ctx, "backup_test", &v); v["v"] != "after" {
+		t.Fatalf("a rejected restore must not touch live data, got %v", v)
+	}
+
+	result, err := svc.Restore(ctx, bytes.NewReader(archive), true)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("Restore = %+v, %v", result, err)
+	}
+	if _, _ = loadLocalSetting(ctx, "backup_test", &v); v["v"] != "before" {
+		t.Fatalf("local settings not restored, got %v", v)
+	}
+	var title string
+	if _, _ = cm.GetJSON("model_status:site_title", &title); title != "Before" {
+		t.Fatalf("redis key not restored, got %q", title)
+	}
+	if len(result.PreviousFiles) != 1 {
+		t.Fatalf("the replaced file should be kept, got %+v", result.PreviousFiles)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, result.PreviousFiles[0])); err != nil {
+		t.Fatalf("previous file missing: %v", err)
+	}
+}
+
+// tamperBackup rewrites the archive with one byte of the database flipped
+func tamperBackup(t *testing.T, archive []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(tr)
+		data := body.Bytes()
+		if strings.HasPrefix(h.Name, backupFilesDir) {
+			data[len(data)-1] ^= 0xff
+		}
+		_ = tw.WriteHeader(h)
+		_, _ = tw.Write(data)
+	}
+	_ = tw.Close()
+	_ = gw.Close()
+	return out.Bytes()
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const channelBalanceSettingsKey = "channel_balance"
+
+// ChannelBalanceSettings 渠道余额快照与告警配置
+type ChannelBalanceSettings struct {
+	Enabled         bool  `json:"enabled"`
+	IntervalMinutes int   `json:"interval_minutes"`
+	AlertDays       int   `json:"alert_days"`     // 预计 N 天内耗尽时告警
+	WindowDays      int   `json:"window_days"`    // 计算消耗速率的回看窗口
+	RetentionDays   int   `json:"retention_days"` // 快照保留天数
+	UpdatedAt       int64 `json:"updated_at"`
+}
+
+// ChannelBalanceSettingsInput supports partial update of ChannelBalanceSettings
+type ChannelBalanceSettingsInput struct {
+	Enabled         *bool `json:"enabled"`
+	IntervalMinutes *int  `json:"interval_minutes"`
+	AlertDays       *int  `json:"alert_days"`
+	WindowDays      *int  `json:"window_days"`
+	RetentionDays   *int  `json:"retention_days"`
+}
+
+// ChannelBalanceSnapshot is one recorded point of a channel's balance
+type ChannelBalanceSnapshot struct {
+	ChannelID   int64   `json:"channel_id"`
+	ChannelName string  `json:"channel_name,omitempty"`
+	Balance     float64 `json:"balance"`
+	UsedQuota   int64   `json:"used_quota"`
+	CreatedAt   int64   `json:"created_at"`
+}
+
+// ChannelBalanceService records channel balance snapshots in the local store
+// and derives burn rate / projected exhaustion from them.
+//
+// NewAPI only refreshes channels.balance when a balance query runs (manually
+// or via its own scheduled update), so the burn rate is only as fresh as
+// balance_updated_time; used_quota is always current and reported alongside.
+type ChannelBalanceService struct {
+	db *database.Manager
+}
+
+// NewChannelBalanceService creates a new ChannelBalanceService
+func NewChannelBalanceService() *ChannelBalanceService {
+	return &ChannelBalanceService{db: database.Get()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelBalanceService) WithContext(ctx context.Context) *ChannelBalanceService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+func defaultChannelBalanceSettings() ChannelBalanceSettings {
+	return ChannelBalanceSettings{
+		IntervalMinutes: 60,
+		AlertDays:       7,
+		WindowDays:      7,
+		RetentionDays:   90,
+	}
+}
+
+func normalizeChannelBalanceSettings(s *ChannelBalanceSettings) {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 5, 1440, 60)
+	s.AlertDays = clampSetting(s.AlertDays, 1, 90, 7)
+	s.WindowDays = clampSetting(s.WindowDays, 1, 90, 7)
+	s.RetentionDays = clampSetting(s.RetentionDays, 7, 365, 90)
+}
+
+// GetSettings returns the balance monitor settings (defaults if never saved)
+func (s *ChannelBalanceService) GetSettings(ctx context.Context) (ChannelBalanceSettings, error) {
+	settings := defaultChannelBalanceSettings()
+	if _, err := loadLocalSetting(ctx, channelBalanceSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	normalizeChannelBalanceSettings(&settings)
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update and persists it
+func (s *ChannelBalanceService) UpdateSettings(ctx context.Context, in ChannelBalanceSettingsInput) (ChannelBalanceSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.AlertDays != nil {
+		settings.AlertDays = *in.AlertDays
+	}
+	if in.WindowDays != nil {
+		settings.WindowDays = *in.WindowDays
+	}
+	if in.RetentionDays != nil {
+		settings.RetentionDays = *in.RetentionDays
+	}
+	normalizeChannelBalanceSettings(&settings)
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, channelBalanceSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// TakeSnapshot records the current balance/used_quota of every channel and
+// prunes snapshots older than the retention window. Returns the row count.
+func (s *ChannelBalanceService) TakeSnapshot(ctx context.Context) (int, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := s.db.Query(`
+		SELECT id, name, COALESCE(balance, 0) as balance, COALESCE(used_quota, 0) as used_quota
+		FROM channels ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+
+	store, err := openLocalStore()
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	if err := ensureChannelBalanceTables(ctx, store); err != nil {
+		return 0, err
+	}
+
+	tx, err := store.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO channel_balance_snapshots (channel_id, channel_name, balance, used_quota, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			toInt64(row["id"]), toString(row["name"]), toFloat64(row["balance"]), toInt64(row["used_quota"]), now); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM channel_balance_snapshots WHERE created_at < ?`,
+		now-int64(settings.RetentionDays)*86400); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// GetBurnRates returns per-channel burn rate and projected exhaustion over the
+// configured window, sorted by soonest exhaustion first. Channels projected to
+// run out within AlertDays are flagged (and announced once a day via SSE).
+func (s *ChannelBalanceService) GetBurnRates(ctx context.Context) (map[string]interface{}, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.db.Query(`
+		SELECT id, name, status, COALESCE(balance, 0) as balance,
+			COALESCE(balance_updated_time, 0) as balance_updated_time, COALESCE(used_quota, 0) as used_quota
+		FROM channels ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelBalanceTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Unix() - int64(settings.WindowDays)*86400
+	snapshots, err := loadBalanceSnapshots(ctx, store, 0, since)
+	if err != nil {
+		return nil, err
+	}
+	byChannel := make(map[int64][]ChannelBalanceSnapshot)
+	for _, snap := range snapshots {
+		byChannel[snap.ChannelID] = append(byChannel[snap.ChannelID], snap)
+	}
+
+	items := make([]map[string]interface{}, 0, len(channels))
+	alerts := 0
+	for _, ch := range channels {
+		id := toInt64(ch["id"])
+		balance := toFloat64(ch["balance"])
+		burnPerDay, quotaPerDay := computeBalanceBurn(byChannel[id])
+
+		var projectedDays interface{}
+		lowBalance := false
+		if burnPerDay > 0 {
+			days := balance / burnPerDay
+			projectedDays = math.Round(days*10) / 10
+			lowBalance = days <= float64(settings.AlertDays)
+		}
+		item := map[string]interface{}{
+			"channel_id":           id,
+			"channel_name":         toString(ch["name"]),
+			"status":               toInt64(ch["status"]),
+			"balance":              balance,
+			"balance_updated_time": toInt64(ch["balance_updated_time"]),
+			"used_quota":           toInt64(ch["used_quota"]),
+			"burn_per_day":         math.Round(burnPerDay*10000) / 10000,
+			"quota_per_day":        math.Round(quotaPerDay),
+			"projected_days":       projectedDays,
+			"snapshots":            len(byChannel[id]),
+			"low_balance":          lowBalance,
+		}
+		if lowBalance {
+			alerts++
+			if notifyLowBalance(id, map[string]interface{}{
+				"channel_name":   item["channel_name"],
+				"balance":        balance,
+				"projected_days": projectedDays,
+			}) {
+				logger.L.Warn(fmt.Sprintf("[渠道余额] 渠道 #%d (%s) 预计 %.1f 天内耗尽 | balance=%.2f",
+					id, item["channel_name"], balance/burnPerDay, balance), logger.CatSystem)
+			}
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		pi, iok := items[i]["projected_days"].(float64)
+		pj, jok := items[j]["projected_days"].(float64)
+		if iok != jok {
+			return iok
+		}
+		return iok && pi < pj
+	})
+
+	return map[string]interface{}{
+		"items":       items,
+		"alert_count": alerts,
+		"alert_days":  settings.AlertDays,
+		"window_days": settings.WindowDays,
+	}, nil
+}
+
+// GetHistory returns the snapshot series of one channel for charting
+func (s *ChannelBalanceService) GetHistory(ctx context.Context, channelID int64, days int) ([]ChannelBalanceSnapshot, error) {
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelBalanceTables(ctx, store); err != nil {
+		return nil, err
+	}
+	return loadBalanceSnapshots(ctx, store, channelID, time.Now().Unix()-int64(days)*86400)
+}
+
+// computeBalanceBurn derives balance burn per day and used_quota growth per day
+// from time-ordered snapshots. Only balance decreases count as burn, so a
+// top-up in the middle of the window doesn't hide consumption.
+func computeBalanceBurn(snaps []ChannelBalanceSnapshot) (burnPerDay, quotaPerDay float64) {
+	if len(snaps) < 2 {
+		return 0, 0
+	}
+	elapsed := float64(snaps[len(snaps)-1].CreatedAt-snaps[0].CreatedAt) / 86400
+	if elapsed < 1.0/24 {
+		return 0, 0
+	}
+	var burned float64
+	for i := 1; i < len(snaps); i++ {
+		if d := snaps[i-1].Balance - snaps[i].Balance; d > 0 {
+			burned += d
+		}
+	}
+	quotaDelta := float64(snaps[len(snaps)-1].UsedQuota - snaps[0].UsedQuota)
+	if quotaDelta < 0 {
+		quotaDelta = 0
+	}
+	return burned / elapsed, quotaDelta / elapsed
+}
+
+func loadBalanceSnapshots(ctx context.Context, db *sql.DB, channelID, since int64) ([]ChannelBalanceSnapshot, error) {
+	query := `SELECT channel_id, channel_name, balance, used_quota, created_at
+		FROM channel_balance_snapshots WHERE created_at >= ?`
+	args := []interface{}{since}
+	if channelID > 0 {
+		query += " AND channel_id = ?"
+		args = append(args, channelID)
+	}
+	query += " ORDER BY channel_id, created_at"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []ChannelBalanceSnapshot{}
+	for rows.Next() {
+		var snap ChannelBalanceSnapshot
+		if err := rows.Scan(&snap.ChannelID, &snap.ChannelName, &snap.Balance, &snap.UsedQuota, &snap.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, snap)
+	}
+	return result, rows.Err()
+}
+
+func ensureChannelBalanceTables(ctx context.Context, db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS channel_balance_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id INTEGER NOT NULL,
+			channel_name TEXT NOT NULL DEFAULT '',
+			balance REAL NOT NULL DEFAULT 0,
+			used_quota INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_channel_balance_snapshots_channel ON channel_balance_snapshots(channel_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_channel_balance_snapshots_created ON channel_balance_snapshots(created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeBalanceBurnIgnoresTopUps(t *testing.T) {
+	day := int64(86400)
+	snaps := []ChannelBalanceSnapshot{
+		{Balance: 100, UsedQuota: 0, CreatedAt: 0},
+		{Balance: 90, UsedQuota: 500, CreatedAt: day},
+		{Balance: 190, UsedQuota: 500, CreatedAt: day + 1}, // top-up
+		{Balance: 170, UsedQuota: 1500, CreatedAt: 2 * day},
+	}
+	burn, quota := computeBalanceBurn(snaps)
+	if math.Abs(burn-15) > 0.01 {
+		t.Fatalf("burn per day = %v, want 15", burn)
+	}
+	if math.Abs(quota-750) > 0.01 {
+		t.Fatalf("quota per day = %v, want 750", quota)
+	}
+}
+
+func TestComputeBalanceBurnNeedsSpan(t *testing.T) {
+	if burn, _ := computeBalanceBurn([]ChannelBalanceSnapshot{{Balance: 10}}); burn != 0 {
+		t.Fatalf("single snapshot should give zero burn, got %v", burn)
+	}
+	burn, _ := computeBalanceBurn([]ChannelBalanceSnapshot{{Balance: 10, CreatedAt: 0}, {Balance: 5, CreatedAt: 60}})
+	if burn != 0 {
+		t.Fatalf("snapshots under an hour apart should give zero burn, got %v", burn)
+	}
+}
@@ -0,0 +1,460 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const channelFailoverSettingsKey = "channel_failover"
+
+// ChannelFailoverSettings 基于日志失败率的自动禁用 / 自动恢复策略
+type ChannelFailoverSettings struct {
+	Enabled                 bool    `json:"enabled"`
+	WindowMinutes           int     `json:"window_minutes"`            // 统计失败率的滑动窗口 (M 分钟)
+	FailureRateThreshold    float64 `json:"failure_rate_threshold"`    // 0-1
+	MinRequests             int     `json:"min_requests"`              // 窗口内请求数不足时不判定
+	AutoRecover             bool    `json:"auto_recover"`              // 是否主动探测并自动恢复
+	RecoveryIntervalMinutes int     `json:"recovery_interval_minutes"` // 两次恢复探测的间隔
+	RecoverySuccesses       int     `json:"recovery_successes"`        // 连续成功 N 次后恢复
+	UpdatedAt               int64   `json:"updated_at"`
+}
+
+// ChannelFailoverSettingsInput supports partial update of ChannelFailoverSettings
+type ChannelFailoverSettingsInput struct {
+	Enabled                 *bool    `json:"enabled"`
+	WindowMinutes           *int     `json:"window_minutes"`
+	FailureRateThreshold    *float64 `json:"failure_rate_threshold"`
+	MinRequests             *int     `json:"min_requests"`
+	AutoRecover             *bool    `json:"auto_recover"`
+	RecoveryIntervalMinutes *int     `json:"recovery_interval_minutes"`
+	RecoverySuccesses       *int     `json:"recovery_successes"`
+}
+
+// ChannelFailoverState tracks a channel disabled by the failover policy
+type ChannelFailoverState struct {
+	ChannelID            int64   `json:"channel_id"`
+	ChannelName          string  `json:"channel_name"`
+	Active               bool    `json:"active"` // still disabled and awaiting recovery
+	FailureRate          float64 `json:"failure_rate"`
+	Requests             int64   `json:"requests"`
+	DisabledAt           int64   `json:"disabled_at"`
+	RecoveryAttempts     int     `json:"recovery_attempts"`
+	ConsecutiveSuccesses int     `json:"consecutive_successes"`
+	LastProbeAt          int64   `json:"last_probe_at"`
+	LastProbeError       string  `json:"last_probe_error,omitempty"`
+	RecoveredAt          int64   `json:"recovered_at"`
+}
+
+// ChannelFailoverRunResult summarises one evaluation pass
+type ChannelFailoverRunResult struct {
+	Evaluated int     `json:"evaluated"`
+	Disabled  []int64 `json:"disabled"`
+	Probed    int     `json:"probed"`
+	Recovered []int64 `json:"recovered"`
+	Released  []int64 `json:"released"` // manually re-enabled / changed by an admin, no longer tracked
+}
+
+// ChannelFailoverService disables channels whose failure rate in logs stays
+// above a threshold and re-enables them once synthetic probes succeed again.
+type ChannelFailoverService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// channelFailoverMu serialises evaluation passes (background vs manual)
+var channelFailoverMu = make(chan struct{}, 1)
+
+// NewChannelFailoverService creates a new ChannelFailoverService
+func NewChannelFailoverService() *ChannelFailoverService {
+	return &ChannelFailoverService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelFailoverService) WithContext(ctx context.Context) *ChannelFailoverService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func defaultChannelFailoverSettings() ChannelFailoverSettings {
+	return ChannelFailoverSettings{
+		WindowMinutes:           10,
+		FailureRateThreshold:    0.5,
+		MinRequests:             20,
+		AutoRecover:             true,
+		RecoveryIntervalMinutes: 5,
+		RecoverySuccesses:       2,
+	}
+}
+
+func normalizeChannelFailoverSettings(s *ChannelFailoverSettings) {
+	s.WindowMinutes = clampSetting(s.WindowMinutes, 1, 1440, 10)
+	s.MinRequests = clampSetting(s.MinRequests, 1, 100000, 20)
+	s.RecoveryIntervalMinutes = clampSetting(s.RecoveryIntervalMinutes, 1, 1440, 5)
+	s.RecoverySuccesses = clampSetting(s.RecoverySuccesses, 1, 20, 2)
+	if s.FailureRateThreshold <= 0 || s.FailureRateThreshold > 1 {
+		s.FailureRateThreshold = 0.5
+	}
+}
+
+// GetSettings returns the failover policy (defaults if never saved)
+func (s *ChannelFailoverService) GetSettings(ctx context.Context) (ChannelFailoverSettings, error) {
+	settings := defaultChannelFailoverSettings()
+	if _, err := loadLocalSetting(ctx, channelFailoverSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	normalizeChannelFailoverSettings(&settings)
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update and persists it
+func (s *ChannelFailoverService) UpdateSettings(ctx context.Context, in ChannelFailoverSettingsInput) (ChannelFailoverSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.WindowMinutes != nil {
+		settings.WindowMinutes = *in.WindowMinutes
+	}
+	if in.FailureRateThreshold != nil {
+		settings.FailureRateThreshold = *in.FailureRateThreshold
+	}
+	if in.MinRequests != nil {
+		settings.MinRequests = *in.MinRequests
+	}
+	if in.AutoRecover != nil {
+		settings.AutoRecover = *in.AutoRecover
+	}
+	if in.RecoveryIntervalMinutes != nil {
+		settings.RecoveryIntervalMinutes = *in.RecoveryIntervalMinutes
+	}
+	if in.RecoverySuccesses != nil {
+		settings.RecoverySuccesses = *in.RecoverySuccesses
+	}
+	normalizeChannelFailoverSettings(&settings)
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, channelFailoverSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// Evaluate runs one pass: disable channels over the failure threshold, then
+// probe previously disabled channels for recovery. force skips the Enabled check.
+func (s *ChannelFailoverService) Evaluate(ctx context.Context, force bool) (*ChannelFailoverRunResult, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &ChannelFailoverRunResult{Disabled: []int64{}, Recovered: []int64{}, Released: []int64{}}
+	if !settings.Enabled && !force {
+		return result, nil
+	}
+
+	select {
+	case channelFailoverMu <- struct{}{}:
+		defer func() { <-channelFailoverMu }()
+	default:
+		return nil, fmt.Errorf("another failover evaluation is running")
+	}
+
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelFailoverTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	if err := s.disableFailing(ctx, store, settings, result); err != nil {
+		return nil, err
+	}
+	if settings.AutoRecover {
+		if err := s.recoverDisabled(ctx, store, settings, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// disableFailing checks failure rate per enabled channel over the window
+func (s *ChannelFailoverService) disableFailing(ctx context.Context, store *sql.DB, settings ChannelFailoverSettings, result *ChannelFailoverRunResult) error {
+	since := time.Now().Unix() - int64(settings.WindowMinutes)*60
+	rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT channel_id,
+			COUNT(*) as total,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures
+		FROM logs
+		WHERE created_at >= ? AND type IN (`+ltRequests()+`) AND channel_id > 0
+		GROUP BY channel_id
+		HAVING COUNT(*) >= ?`), since, settings.MinRequests)
+	if err != nil {
+		return err
+	}
+
+	enabled, err := s.channelNames(true)
+	if err != nil {
+		return err
+	}
+	// Failures logged before a recovery are still inside the window; give
+	// recently recovered channels one full window of grace.
+	states, err := listChannelFailoverStates(ctx, store, false)
+	if err != nil {
+		return err
+	}
+	recentlyRecovered := make(map[int64]bool)
+	for _, st := range states {
+		if st.RecoveredAt >= since {
+			recentlyRecovered[st.ChannelID] = true
+		}
+	}
+	// Errors logged during a maintenance window are expected; skip channels
+	// whose window overlaps the evaluated period.
+	now := time.Now().Unix()
+	maintenance := loadMaintenanceSchedule(ctx, since, now+1)
+	channels := &ChannelService{db: s.db, cm: cache.Get()}
+	for _, row := range rows {
+		channelID := toInt64(row["channel_id"])
+		name, isEnabled := enabled[channelID]
+		if !isEnabled || recentlyRecovered[channelID] || maintenance.channelDuring(channelID, since, now+1) {
+			continue
+		}
+		result.Evaluated++
+		total := toInt64(row["total"])
+		rate := failoverRate(toInt64(row["failures"]), total)
+		if rate < settings.FailureRateThreshold {
+			continue
+		}
+
+		if _, err := channels.writeStatus([]int64{channelID}, ChannelStatusAutoDisabled); err != nil {
+			logger.L.Warn(fmt.Sprintf("[渠道熔断] 禁用渠道 #%d 失败: %v", channelID, err), logger.CatSystem)
+			continue
+		}
+		state := ChannelFailoverState{
+			ChannelID:   channelID,
+			ChannelName: name,
+			Active:      true,
+			FailureRate: rate,
+			Requests:    total,
+			DisabledAt:  time.Now().Unix(),
+		}
+		if err := saveChannelFailoverState(ctx, store, state); err != nil {
+			return err
+		}
+		result.Disabled = append(result.Disabled, channelID)
+		logger.L.Warn(fmt.Sprintf("[渠道熔断] 渠道 #%d (%s) 最近 %d 分钟失败率 %.0f%% (%d 请求)，已自动禁用",
+			channelID, name, settings.WindowMinutes, rate*100, total), logger.CatSystem)
+		PublishEvent(EventChannelAutoDisabled, map[string]interface{}{
+			"channel_id":     channelID,
+			"channel_name":   name,
+			"failure_rate":   rate,
+			"requests":       total,
+			"window_minutes": settings.WindowMinutes,
+		})
+	}
+	return nil
+}
+
+// recoverDisabled probes channels this policy disabled and re-enables them
+// after RecoverySuccesses consecutive successful probes.
+func (s *ChannelFailoverService) recoverDisabled(ctx context.Context, store *sql.DB, settings ChannelFailoverSettings, result *ChannelFailoverRunResult) error {
+	states, err := listChannelFailoverStates(ctx, store, true)
+	if err != nil || len(states) == 0 {
+		return err
+	}
+
+	prober := NewChannelProbeService()
+	if !prober.Configured() {
+		logger.L.Debug("[渠道熔断] 未配置 NEWAPI_BASEURL / NEWAPI_API_KEY，跳过自动恢复探测")
+		return nil
+	}
+	probeSettings, err := prober.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	disabled, err := s.channelStatus()
+	if err != nil {
+		return err
+	}
+
+	channels := &ChannelService{db: s.db, cm: cache.Get()}
+	now := time.Now().Unix()
+	for _, st := range states {
+		// An admin changed the channel since we disabled it — stop tracking.
+		if status, ok := disabled[st.ChannelID]; !ok || status != ChannelStatusAutoDisabled {
+			st.Active = false
+			if err := saveChannelFailoverState(ctx, store, st); err != nil {
+				return err
+			}
+			result.Released = append(result.Released, st.ChannelID)
+			continue
+		}
+		if now-st.LastProbeAt < int64(settings.RecoveryIntervalMinutes)*60 {
+			continue
+		}
+
+		targets, err := prober.loadTargets([]int64{st.ChannelID}, false)
+		if err != nil || len(targets) == 0 {
+			continue
+		}
+		probe := prober.probeOne(ctx, targets[0], probeSettings)
+		result.Probed++
+		st.RecoveryAttempts++
+		st.LastProbeAt = now
+		if probe.Success {
+			st.ConsecutiveSuccesses++
+			st.LastProbeError = ""
+		} else {
+			st.ConsecutiveSuccesses = 0
+			st.LastProbeError = probe.ErrorClass + ": " + probe.Message
+		}
+
+		if st.ConsecutiveSuccesses >= settings.RecoverySuccesses {
+			if _, err := channels.writeStatus([]int64{st.ChannelID}, ChannelStatusEnabled); err != nil {
+				logger.L.Warn(fmt.Sprintf("[渠道熔断] 恢复渠道 #%d 失败: %v", st.ChannelID, err), logger.CatSystem)
+			} else {
+				st.Active = false
+				st.RecoveredAt = now
+				result.Recovered = append(result.Recovered, st.ChannelID)
+				logger.L.Business(fmt.Sprintf("[渠道熔断] 渠道 #%d (%s) 探测连续成功 %d 次，已自动恢复",
+					st.ChannelID, st.ChannelName, st.ConsecutiveSuccesses))
+				PublishEvent(EventChannelRecovered, map[string]interface{}{
+					"channel_id":   st.ChannelID,
+					"channel_name": st.ChannelName,
+					"attempts":     st.RecoveryAttempts,
+					"downtime_sec": now - st.DisabledAt,
+				})
+			}
+		}
+		if err := saveChannelFailoverState(ctx, store, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListStates returns tracked channels; activeOnly limits to those awaiting recovery
+func (s *ChannelFailoverService) ListStates(ctx context.Context, activeOnly bool) ([]ChannelFailoverState, error) {
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelFailoverTables(ctx, store); err != nil {
+		return nil, err
+	}
+	return listChannelFailoverStates(ctx, store, activeOnly)
+}
+
+func (s *ChannelFailoverService) channelNames(enabledOnly bool) (map[int64]string, error) {
+	query := `SELECT id, name FROM channels`
+	if enabledOnly {
+		query += ` WHERE status = 1`
+	}
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		names[toInt64(row["id"])] = toString(row["name"])
+	}
+	return names, nil
+}
+
+func (s *ChannelFailoverService) channelStatus() (map[int64]int, error) {
+	rows, err := s.db.Query(`SELECT id, status FROM channels`)
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		status[toInt64(row["id"])] = int(toInt64(row["status"]))
+	}
+	return status, nil
+}
+
+// failoverRate returns failures/total rounded to 4 decimals
+func failoverRate(failures, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(float64(failures)/float64(total)*10000) / 10000
+}
+
+func ensureChannelFailoverTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS channel_failover_state (
+			channel_id INTEGER PRIMARY KEY,
+			channel_name TEXT NOT NULL DEFAULT '',
+			active INTEGER NOT NULL DEFAULT 0,
+			failure_rate REAL NOT NULL DEFAULT 0,
+			requests INTEGER NOT NULL DEFAULT 0,
+			disabled_at INTEGER NOT NULL DEFAULT 0,
+			recovery_attempts INTEGER NOT NULL DEFAULT 0,
+			consecutive_successes INTEGER NOT NULL DEFAULT 0,
+			last_probe_at INTEGER NOT NULL DEFAULT 0,
+			last_probe_error TEXT NOT NULL DEFAULT '',
+			recovered_at INTEGER NOT NULL DEFAULT 0
+		)`)
+	return err
+}
+
+func listChannelFailoverStates(ctx context.Context, db *sql.DB, activeOnly bool) ([]ChannelFailoverState, error) {
+	query := `SELECT channel_id, channel_name, active, failure_rate, requests, disabled_at, recovery_attempts,
+		consecutive_successes, last_probe_at, last_probe_error, recovered_at FROM channel_failover_state`
+	if activeOnly {
+		query += ` WHERE active = 1`
+	}
+	query += ` ORDER BY disabled_at DESC`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := []ChannelFailoverState{}
+	for rows.Next() {
+		var st ChannelFailoverState
+		var active int
+		if err := rows.Scan(&st.ChannelID, &st.ChannelName, &active, &st.FailureRate, &st.Requests, &st.DisabledAt,
+			&st.RecoveryAttempts, &st.ConsecutiveSuccesses, &st.LastProbeAt, &st.LastProbeError, &st.RecoveredAt); err != nil {
+			return nil, err
+		}
+		st.Active = active == 1
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+func saveChannelFailoverState(ctx context.Context, db *sql.DB, st ChannelFailoverState) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO channel_failover_state (channel_id, channel_name, active, failure_rate, requests, disabled_at,
+			recovery_attempts, consecutive_successes, last_probe_at, last_probe_error, recovered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(channel_id) DO UPDATE SET
+			channel_name = excluded.channel_name,
+			active = excluded.active,
+			failure_rate = excluded.failure_rate,
+			requests = excluded.requests,
+			disabled_at = excluded.disabled_at,
+			recovery_attempts = excluded.recovery_attempts,
+			consecutive_successes = excluded.consecutive_successes,
+			last_probe_at = excluded.last_probe_at,
+			last_probe_error = excluded.last_probe_error,
+			recovered_at = excluded.recovered_at`,
+		st.ChannelID, st.ChannelName, boolToInt(st.Active), st.FailureRate, st.Requests, st.DisabledAt,
+		st.RecoveryAttempts, st.ConsecutiveSuccesses, st.LastProbeAt, st.LastProbeError, st.RecoveredAt)
+	return err
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestChannelFailoverDisableAndRecover(t *testing.T) {
+	upstreamOK := false
+	newapi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": upstreamOK, "message": "bad response status code 503", "time": 0.2})
+	}))
+	defer newapi.Close()
+
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("NEWAPI_BASEURL", newapi.URL)
+	t.Setenv("NEWAPI_API_KEY", "test-key")
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	schema := `
+	CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT, status INTEGER, models TEXT, test_model TEXT);
+	CREATE TABLE abilities (channel_id INTEGER, model TEXT, enabled INTEGER);
+	CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, channel_id INTEGER, type INTEGER, created_at INTEGER);
+	INSERT INTO channels VALUES (1, 'flaky', 1, 'gpt-4o', ''), (2, 'healthy', 1, 'gpt-4o', '');
+	INSERT INTO abilities VALUES (1, 'gpt-4o', 1), (2, 'gpt-4o', 1);`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		failType := 2
+		if i%3 != 0 {
+			failType = 5
+		}
+		db.MustExec(`INSERT INTO logs (channel_id, type, created_at) VALUES (1, ?, ?), (2, 2, ?)`, failType, now-60, now-60)
+	}
+
+	svc := NewChannelFailoverService()
+	ctx := context.Background()
+	recoverySuccesses, interval := 1, 1
+	if _, err := svc.UpdateSettings(ctx, ChannelFailoverSettingsInput{RecoverySuccesses: &recoverySuccesses, RecoveryIntervalMinutes: &interval}); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+
+	res, err := svc.Evaluate(ctx, true)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if len(res.Disabled) != 1 || res.Disabled[0] != 1 {
+		t.Fatalf("expected only channel 1 disabled, got %+v", res)
+	}
+	var status, enabled int
+	db.Get(&status, `SELECT status FROM channels WHERE id = 1`)
+	db.Get(&enabled, `SELECT enabled FROM abilities WHERE channel_id = 1`)
+	if status != ChannelStatusAutoDisabled || enabled != 0 {
+		t.Fatalf("channel 1 should be auto-disabled with abilities off, got status=%d enabled=%d", status, enabled)
+	}
+
+	// Upstream back to healthy: next pass (after the probe interval) re-enables.
+	upstreamOK = true
+	store, _ := openLocalStore()
+	store.Exec(`UPDATE channel_failover_state SET last_probe_at = 0`)
+	store.Close()
+	res, err = svc.Evaluate(ctx, true)
+	if err != nil {
+		t.Fatalf("Evaluate (recovery): %v", err)
+	}
+	if len(res.Recovered) != 1 || len(res.Disabled) != 0 {
+		t.Fatalf("expected recovery without re-disable, got %+v", res)
+	}
+	db.Get(&status, `SELECT status FROM channels WHERE id = 1`)
+	if status != ChannelStatusEnabled {
+		t.Fatalf("channel 1 should be re-enabled, got status=%d", status)
+	}
+}
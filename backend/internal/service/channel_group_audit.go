@@ -0,0 +1,273 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+// Out-of-group hit kinds
+const (
+	GroupHitModelOutside   = "model_outside_group"   // 分组在 abilities 中根本没有该模型
+	GroupHitChannelOutside = "channel_outside_group" // 分组有该模型，但不应由此渠道承接
+)
+
+// GroupChannelCombo is one model of a group and the channels allowed to serve it
+type GroupChannelCombo struct {
+	Model      string  `json:"model"`
+	ChannelIDs []int64 `json:"channel_ids"`
+	Requests   int64   `json:"requests"`
+}
+
+// GroupChannelSummary is the audit result of one user group
+type GroupChannelSummary struct {
+	Group              string              `json:"group"`
+	Models             int                 `json:"models"`
+	Channels           int                 `json:"channels"`
+	Requests           int64               `json:"requests"`
+	OutOfGroupRequests int64               `json:"out_of_group_requests"`
+	Combos             []GroupChannelCombo `json:"combos"`
+}
+
+// GroupChannelViolation is traffic of a group served by a (model, channel)
+// the group has no ability for
+type GroupChannelViolation struct {
+	Group       string `json:"group"`
+	Model       string `json:"model"`
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Kind        string `json:"kind"`
+	Requests    int64  `json:"requests"`
+	Users       int64  `json:"users"`
+	LastSeen    int64  `json:"last_seen"`
+}
+
+// GroupChannelAudit is the response of AuditGroupChannels
+type GroupChannelAudit struct {
+	Hours       int                     `json:"hours"`
+	GroupSource string                  `json:"group_source"` // logs: logs.group；users: 按用户当前分组推断
+	Groups      []GroupChannelSummary   `json:"groups"`
+	Violations  []GroupChannelViolation `json:"violations"`
+}
+
+// AuditGroupChannels 分组与渠道映射审计：列出每个分组在 abilities 中可用的
+// 模型 / 渠道组合，并与近期 logs 中该分组实际命中的渠道对比，标记越权命中。
+//
+// 较新的 NewAPI 在 logs 中记录请求实际使用的分组；旧版本没有该列时退回到
+// 用户当前的分组（令牌单独指定分组、或期间改过分组的请求会被误判，仅供参考）。
+func (s *ChannelRoutingService) AuditGroupChannels(hours int, group string, noCache bool) (*GroupChannelAudit, error) {
+	cacheKey := cache.Key("channel_routing:group_audit:%d:%s", hours, group)
+	if !noCache {
+		var cached GroupChannelAudit
+		if found, _ := s.cm.GetJSON(cacheKey, &cached); found {
+			return &cached, nil
+		}
+	}
+
+	groupCol := s.groupCol()
+	abilityRows, err := s.db.QueryWithTimeout(15*time.Second, fmt.Sprintf(`
+		SELECT COALESCE(NULLIF(a.%s, ''), 'default') as group_name, a.model, a.channel_id
+		FROM abilities a`, groupCol))
+	if err != nil {
+		return nil, fmt.Errorf("abilities query failed: %w", err)
+	}
+	channelNames := map[int64]string{}
+	if rows, err := s.db.Query(`SELECT id, name FROM channels`); err == nil {
+		for _, r := range rows {
+			channelNames[toInt64(r["id"])] = toString(r["name"])
+		}
+	}
+
+	since := time.Now().Unix() - int64(hours)*3600
+	source := "logs"
+	var trafficRows []map[string]interface{}
+	if s.logDB.ColumnExists("logs", "group") {
+		logGroupCol := "`group`"
+		if s.logDB.IsPG {
+			logGroupCol = `"group"`
+		}
+		trafficRows, err = s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+			SELECT COALESCE(NULLIF(%s, ''), 'default') as group_name, model_name, channel_id,
+				COUNT(*) as requests, COUNT(DISTINCT user_id) as users, MAX(created_at) as last_seen
+			FROM logs
+			WHERE created_at >= ? AND type IN (`+ltRequests()+`) AND channel_id > 0
+			GROUP BY COALESCE(NULLIF(%s, ''), 'default'), model_name, channel_id`, logGroupCol, logGroupCol)), since)
+	} else {
+		source = "users"
+		trafficRows, err = s.trafficByUserGroup(since)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("group traffic query failed: %w", err)
+	}
+
+	audit := buildGroupChannelAudit(abilityRows, trafficRows, channelNames, group)
+	audit.Hours = hours
+	audit.GroupSource = source
+	s.cm.Set(cacheKey, audit, 5*time.Minute)
+	return audit, nil
+}
+
+// trafficByUserGroup aggregates logs per user and maps each user to their
+// current users.group (logs may live in a separate database, so no JOIN)
+func (s *ChannelRoutingService) trafficByUserGroup(since int64) ([]map[string]interface{}, error) {
+	rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT user_id, model_name, channel_id, COUNT(*) as requests, MAX(created_at) as last_seen
+		FROM logs
+		WHERE created_at >= ? AND type IN (`+ltRequests()+`) AND channel_id > 0
+		GROUP BY user_id, model_name, channel_id`), since)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int64]bool{}
+	var userIDs []int64
+	for _, r := range rows {
+		if uid := toInt64(r["user_id"]); uid > 0 && !seen[uid] {
+			seen[uid] = true
+			userIDs = append(userIDs, uid)
+		}
+	}
+	userGroups := make(map[int64]string, len(userIDs))
+	const chunk = 500
+	for i := 0; i < len(userIDs); i += chunk {
+		end := i + chunk
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		in, args := inClause(userIDs[i:end])
+		groupRows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(
+			`SELECT id, COALESCE(NULLIF(%s, ''), 'default') as group_name FROM users WHERE id IN (%s)`, s.groupCol(), in)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range groupRows {
+			userGroups[toInt64(r["id"])] = toString(r["group_name"])
+		}
+	}
+
+	type key struct {
+		group, model string
+		channel      int64
+	}
+	agg := map[key]map[string]interface{}{}
+	for _, r := range rows {
+		g, ok := userGroups[toInt64(r["user_id"])]
+		if !ok {
+			g = "default"
+		}
+		k := key{g, toString(r["model_name"]), toInt64(r["channel_id"])}
+		row := agg[k]
+		if row == nil {
+			row = map[string]interface{}{"group_name": k.group, "model_name": k.model, "channel_id": k.channel,
+				"requests": int64(0), "users": int64(0), "last_seen": int64(0)}
+			agg[k] = row
+		}
+		row["requests"] = toInt64(row["requests"]) + toInt64(r["requests"])
+		row["users"] = toInt64(row["users"]) + 1
+		if ls := toInt64(r["last_seen"]); ls > toInt64(row["last_seen"]) {
+			row["last_seen"] = ls
+		}
+	}
+	out := make([]map[string]interface{}, 0, len(agg))
+	for _, row := range agg {
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// buildGroupChannelAudit compares allowed (group, model, channel) combos with
+// observed traffic. onlyGroup limits the output to one group ("" = all).
+func buildGroupChannelAudit(abilityRows, trafficRows []map[string]interface{}, channelNames map[int64]string, onlyGroup string) *GroupChannelAudit {
+	// group -> model -> channel set
+	allowed := map[string]map[string]map[int64]bool{}
+	for _, r := range abilityRows {
+		g, model := toString(r["group_name"]), toString(r["model"])
+		if allowed[g] == nil {
+			allowed[g] = map[string]map[int64]bool{}
+		}
+		if allowed[g][model] == nil {
+			allowed[g][model] = map[int64]bool{}
+		}
+		allowed[g][model][toInt64(r["channel_id"])] = true
+	}
+
+	summaries := map[string]*GroupChannelSummary{}
+	comboRequests := map[string]map[string]int64{}
+	summary := func(g string) *GroupChannelSummary {
+		if summaries[g] == nil {
+			summaries[g] = &GroupChannelSummary{Group: g}
+			comboRequests[g] = map[string]int64{}
+		}
+		return summaries[g]
+	}
+	for g := range allowed {
+		summary(g)
+	}
+
+	violations := []GroupChannelViolation{}
+	for _, r := range trafficRows {
+		g, model, channelID := toString(r["group_name"]), toString(r["model_name"]), toInt64(r["channel_id"])
+		requests := toInt64(r["requests"])
+		sum := summary(g)
+		sum.Requests += requests
+
+		channels, hasModel := allowed[g][model]
+		if hasModel && channels[channelID] {
+			comboRequests[g][model] += requests
+			continue
+		}
+		sum.OutOfGroupRequests += requests
+		kind := GroupHitModelOutside
+		if hasModel {
+			kind = GroupHitChannelOutside
+		}
+		violations = append(violations, GroupChannelViolation{
+			Group:       g,
+			Model:       model,
+			ChannelID:   channelID,
+			ChannelName: channelNames[channelID],
+			Kind:        kind,
+			Requests:    requests,
+			Users:       toInt64(r["users"]),
+			LastSeen:    toInt64(r["last_seen"]),
+		})
+	}
+
+	audit := &GroupChannelAudit{Groups: []GroupChannelSummary{}, Violations: []GroupChannelViolation{}}
+	for g, sum := range summaries {
+		if onlyGroup != "" && g != onlyGroup {
+			continue
+		}
+		channelSet := map[int64]bool{}
+		sum.Combos = make([]GroupChannelCombo, 0, len(allowed[g]))
+		for model, channels := range allowed[g] {
+			combo := GroupChannelCombo{Model: model, Requests: comboRequests[g][model], ChannelIDs: make([]int64, 0, len(channels))}
+			for id := range channels {
+				combo.ChannelIDs = append(combo.ChannelIDs, id)
+				channelSet[id] = true
+			}
+			sort.Slice(combo.ChannelIDs, func(i, j int) bool { return combo.ChannelIDs[i] < combo.ChannelIDs[j] })
+			sum.Combos = append(sum.Combos, combo)
+		}
+		sort.Slice(sum.Combos, func(i, j int) bool { return sum.Combos[i].Model < sum.Combos[j].Model })
+		sum.Models = len(sum.Combos)
+		sum.Channels = len(channelSet)
+		audit.Groups = append(audit.Groups, *sum)
+	}
+	sort.Slice(audit.Groups, func(i, j int) bool { return audit.Groups[i].Group < audit.Groups[j].Group })
+
+	for _, v := range violations {
+		if onlyGroup == "" || v.Group == onlyGroup {
+			audit.Violations = append(audit.Violations, v)
+		}
+	}
+	sort.Slice(audit.Violations, func(i, j int) bool {
+		if audit.Violations[i].Requests != audit.Violations[j].Requests {
+			return audit.Violations[i].Requests > audit.Violations[j].Requests
+		}
+		return audit.Violations[i].Group < audit.Violations[j].Group
+	})
+	return audit
+}
@@ -0,0 +1,580 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const channelKeyHealthSettingsKey = "channel_key_health"
+
+// Key health statuses
+const (
+	KeyHealthValid       = "valid"
+	KeyHealthInvalid     = "invalid"
+	KeyHealthQuota       = "quota_exhausted"
+	KeyHealthRateLimited = "rate_limited"
+	KeyHealthError       = "error"
+	KeyHealthUnsupported = "unsupported"
+)
+
+// NewAPI channel types with a known upstream (common.ChannelType*)
+const (
+	channelTypeOpenAI      = 1
+	channelTypeAzure       = 3
+	channelTypeAnthropic   = 14
+	channelTypeOpenRouter  = 20
+	channelTypeGemini      = 24
+	channelTypeMoonshot    = 25
+	channelTypeSiliconFlow = 40
+	channelTypeMistral     = 42
+	channelTypeDeepSeek    = 43
+	channelTypeXai         = 48
+)
+
+// channelDefaultBaseURLs mirrors NewAPI's ChannelBaseURLs for the types we can check
+var channelDefaultBaseURLs = map[int]string{
+	channelTypeOpenAI:      "https://api.openai.com",
+	channelTypeAnthropic:   "https://api.anthropic.com",
+	channelTypeOpenRouter:  "https://openrouter.ai/api",
+	channelTypeGemini:      "https://generativelanguage.googleapis.com",
+	channelTypeMoonshot:    "https://api.moonshot.cn",
+	channelTypeSiliconFlow: "https://api.siliconflow.cn",
+	channelTypeMistral:     "https://api.mistral.ai",
+	channelTypeDeepSeek:    "https://api.deepseek.com",
+	channelTypeXai:         "https://api.x.ai",
+}
+
+// ChannelKeyHealthSettings 上游 Key 有效性巡检配置
+type ChannelKeyHealthSettings struct {
+	Enabled           bool  `json:"enabled"`
+	IntervalMinutes   int   `json:"interval_minutes"`
+	TimeoutSeconds    int   `json:"timeout_seconds"`
+	Concurrency       int   `json:"concurrency"`
+	MaxKeysPerChannel int   `json:"max_keys_per_channel"` // 多 Key 渠道每轮最多检查的 Key 数
+	UpdatedAt         int64 `json:"updated_at"`
+}
+
+// ChannelKeyHealthSettingsInput supports partial update of ChannelKeyHealthSettings
+type ChannelKeyHealthSettingsInput struct {
+	Enabled           *bool `json:"enabled"`
+	IntervalMinutes   *int  `json:"interval_minutes"`
+	TimeoutSeconds    *int  `json:"timeout_seconds"`
+	Concurrency       *int  `json:"concurrency"`
+	MaxKeysPerChannel *int  `json:"max_keys_per_channel"`
+}
+
+// ChannelKeyHealth is the latest check result of one channel key
+type ChannelKeyHealth struct {
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	ChannelType int    `json:"channel_type"`
+	KeyIndex    int    `json:"key_index"`
+	KeyHint     string `json:"key_hint"`
+	Status      string `json:"status"`
+	HTTPStatus  int    `json:"http_status"`
+	Message     string `json:"message,omitempty"`
+	LatencyMs   int64  `json:"latency_ms"`
+	CheckedAt   int64  `json:"checked_at"`
+	// ChangedAt is when Status last changed (first seen = first check)
+	ChangedAt int64 `json:"changed_at"`
+}
+
+// ChannelKeyCheckSummary 一轮检查的汇总
+type ChannelKeyCheckSummary struct {
+	Channels int                `json:"channels"`
+	Checked  int                `json:"checked"`
+	Counts   map[string]int     `json:"counts"`
+	Flagged  []ChannelKeyHealth `json:"flagged"`
+	Duration int64              `json:"duration_ms"`
+}
+
+type keyCheckTarget struct {
+	ChannelID   int64
+	ChannelName string
+	ChannelType int
+	BaseURL     string
+	KeyIndex    int
+	Key         string
+}
+
+// ChannelKeyHealthService validates channel API keys directly against their
+// upstream with a cheap model-list call, so revoked or drained keys surface
+// before user traffic hits them. Keys never leave this process: only a masked
+// hint is stored.
+type ChannelKeyHealthService struct {
+	db         *database.Manager
+	httpClient *http.Client
+}
+
+// channelKeyCheckMu serialises check rounds (background ticker vs manual run)
+var channelKeyCheckMu sync.Mutex
+
+// NewChannelKeyHealthService creates a new ChannelKeyHealthService
+func NewChannelKeyHealthService() *ChannelKeyHealthService {
+	return &ChannelKeyHealthService{db: database.Get(), httpClient: &http.Client{}}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelKeyHealthService) WithContext(ctx context.Context) *ChannelKeyHealthService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+func defaultChannelKeyHealthSettings() ChannelKeyHealthSettings {
+	return ChannelKeyHealthSettings{
+		IntervalMinutes:   360,
+		TimeoutSeconds:    15,
+		Concurrency:       4,
+		MaxKeysPerChannel: 20,
+	}
+}
+
+func normalizeChannelKeyHealthSettings(s *ChannelKeyHealthSettings) {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 10, 10080, 360)
+	s.TimeoutSeconds = clampSetting(s.TimeoutSeconds, 3, 60, 15)
+	s.Concurrency = clampSetting(s.Concurrency, 1, 16, 4)
+	s.MaxKeysPerChannel = clampSetting(s.MaxKeysPerChannel, 1, 200, 20)
+}
+
+// GetSettings returns the key health settings (defaults if never saved)
+func (s *ChannelKeyHealthService) GetSettings(ctx context.Context) (ChannelKeyHealthSettings, error) {
+	settings := defaultChannelKeyHealthSettings()
+	if _, err := loadLocalSetting(ctx, channelKeyHealthSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	normalizeChannelKeyHealthSettings(&settings)
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update and persists it
+func (s *ChannelKeyHealthService) UpdateSettings(ctx context.Context, in ChannelKeyHealthSettingsInput) (ChannelKeyHealthSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.TimeoutSeconds != nil {
+		settings.TimeoutSeconds = *in.TimeoutSeconds
+	}
+	if in.Concurrency != nil {
+		settings.Concurrency = *in.Concurrency
+	}
+	if in.MaxKeysPerChannel != nil {
+		settings.MaxKeysPerChannel = *in.MaxKeysPerChannel
+	}
+	normalizeChannelKeyHealthSettings(&settings)
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, channelKeyHealthSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// CheckKeys validates the keys of the given channels (all enabled channels
+// when channelIDs is empty) and stores the latest result per key. Keys that
+// newly turn invalid / quota_exhausted are announced via SSE.
+func (s *ChannelKeyHealthService) CheckKeys(ctx context.Context, channelIDs []int64) (*ChannelKeyCheckSummary, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channelKeyCheckMu.Lock()
+	defer channelKeyCheckMu.Unlock()
+
+	start := time.Now()
+	targets, channels, err := s.loadKeyTargets(uniquePositiveIDs(channelIDs), settings.MaxKeysPerChannel)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ChannelKeyHealth, len(targets))
+	sem := make(chan struct{}, settings.Concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t keyCheckTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.checkKey(ctx, t, time.Duration(settings.TimeoutSeconds)*time.Second)
+		}(i, t)
+	}
+	wg.Wait()
+
+	summary := &ChannelKeyCheckSummary{
+		Channels: channels,
+		Checked:  len(results),
+		Counts:   map[string]int{},
+		Flagged:  []ChannelKeyHealth{},
+	}
+	changed, err := s.saveResults(ctx, results)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		summary.Counts[r.Status]++
+		if !keyHealthFlagged(r.Status) {
+			continue
+		}
+		summary.Flagged = append(summary.Flagged, r)
+		if changed[keyHealthID(r.ChannelID, r.KeyIndex)] {
+			logger.L.Warn(fmt.Sprintf("[Key巡检] 渠道 #%d (%s) Key[%d] %s → %s | HTTP %d %s",
+				r.ChannelID, r.ChannelName, r.KeyIndex, r.KeyHint, r.Status, r.HTTPStatus, r.Message), logger.CatSystem)
+			PublishEvent(EventChannelKeyInvalid, map[string]interface{}{
+				"channel_id":   r.ChannelID,
+				"channel_name": r.ChannelName,
+				"key_index":    r.KeyIndex,
+				"key_hint":     r.KeyHint,
+				"status":       r.Status,
+			})
+		}
+	}
+	summary.Duration = time.Since(start).Milliseconds()
+
+	PublishEvent(EventScanFinished, map[string]interface{}{
+		"scanner": "channel_key_health",
+		"checked": summary.Checked,
+		"flagged": len(summary.Flagged),
+	})
+	return summary, nil
+}
+
+// keyHealthFlagged reports whether a status needs operator attention
+func keyHealthFlagged(status string) bool {
+	return status == KeyHealthInvalid || status == KeyHealthQuota
+}
+
+func keyHealthID(channelID int64, keyIndex int) string {
+	return fmt.Sprintf("%d:%d", channelID, keyIndex)
+}
+
+// loadKeyTargets expands channels into one target per key. Multi-key channels
+// store keys newline-separated; Vertex / AWS style JSON keys are reported as
+// unsupported by checkKey.
+func (s *ChannelKeyHealthService) loadKeyTargets(channelIDs []int64, maxKeys int) ([]keyCheckTarget, int, error) {
+	query := `SELECT id, name, type, COALESCE(base_url, '') as base_url, ` + keyCol(s.db.IsPG) + ` as channel_key FROM channels WHERE `
+	var args []interface{}
+	if len(channelIDs) > 0 {
+		var in string
+		in, args = inClause(channelIDs)
+		query += "id IN (" + in + ")"
+	} else {
+		query += "status = 1"
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(s.db.RebindQuery(query), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var targets []keyCheckTarget
+	for _, row := range rows {
+		keys := splitChannelKeys(toString(row["channel_key"]))
+		if len(keys) > maxKeys {
+			keys = keys[:maxKeys]
+		}
+		for i, k := range keys {
+			targets = append(targets, keyCheckTarget{
+				ChannelID:   toInt64(row["id"]),
+				ChannelName: toString(row["name"]),
+				ChannelType: int(toInt64(row["type"])),
+				BaseURL:     toString(row["base_url"]),
+				KeyIndex:    i,
+				Key:         k,
+			})
+		}
+	}
+	return targets, len(rows), nil
+}
+
+func splitChannelKeys(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	// JSON 凭据（Vertex 服务账号等）整体算一个 Key
+	if strings.HasPrefix(raw, "{") || strings.HasPrefix(raw, "[") {
+		return []string{raw}
+	}
+	var keys []string
+	for _, k := range strings.Split(raw, "\n") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// maskChannelKey keeps the first 6 and last 4 characters
+func maskChannelKey(key string) string {
+	if strings.HasPrefix(key, "{") || strings.HasPrefix(key, "[") {
+		return "{json}"
+	}
+	if len(key) <= 10 {
+		return "****"
+	}
+	return key[:6] + "****" + key[len(key)-4:]
+}
+
+// buildKeyCheckRequest returns the model-list request for a channel type, or
+// nil when the type has no cheap, key-validating endpoint we know of.
+func buildKeyCheckRequest(ctx context.Context, channelType int, baseURL, key string) (*http.Request, error) {
+	base := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if base == "" {
+		base = channelDefaultBaseURLs[channelType]
+	}
+	if base == "" || strings.HasPrefix(key, "{") || strings.HasPrefix(key, "[") {
+		return nil, nil
+	}
+
+	var (
+		endpoint string
+		headers  = map[string]string{}
+	)
+	switch channelType {
+	case channelTypeAnthropic:
+		endpoint = base + "/v1/models?limit=1"
+		headers["x-api-key"] = key
+		headers["anthropic-version"] = "2023-06-01"
+	case channelTypeGemini:
+		endpoint = base + "/v1beta/models?pageSize=1&key=" + url.QueryEscape(key)
+	case channelTypeAzure:
+		endpoint = base + "/openai/models?api-version=2024-10-21"
+		headers["api-key"] = key
+	case channelTypeOpenRouter:
+		// OpenRouter 的 /models 无需鉴权，改用 /key 校验
+		endpoint = base + "/v1/key"
+		headers["Authorization"] = "Bearer " + key
+	case channelTypeOpenAI, channelTypeMoonshot, channelTypeSiliconFlow, channelTypeMistral,
+		channelTypeDeepSeek, channelTypeXai:
+		endpoint = base + "/v1/models"
+		headers["Authorization"] = "Bearer " + key
+	default:
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (s *ChannelKeyHealthService) checkKey(ctx context.Context, t keyCheckTarget, timeout time.Duration) ChannelKeyHealth {
+	result := ChannelKeyHealth{
+		ChannelID:   t.ChannelID,
+		ChannelName: t.ChannelName,
+		ChannelType: t.ChannelType,
+		KeyIndex:    t.KeyIndex,
+		KeyHint:     maskChannelKey(t.Key),
+		CheckedAt:   time.Now().Unix(),
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := buildKeyCheckRequest(reqCtx, t.ChannelType, t.BaseURL, t.Key)
+	if err != nil {
+		result.Status, result.Message = KeyHealthError, err.Error()
+		return result
+	}
+	if req == nil {
+		result.Status = KeyHealthUnsupported
+		return result
+	}
+
+	started := time.Now()
+	resp, err := s.httpClient.Do(req)
+	result.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		// url.Error 会带上完整 URL（Gemini 的 key 在 query 里），只保留底层错误
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		result.Status, result.Message = KeyHealthError, truncateProbeMessage(err.Error())
+		return result
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8*1024))
+
+	result.HTTPStatus = resp.StatusCode
+	result.Status = classifyKeyHealth(resp.StatusCode, string(body))
+	if result.Status != KeyHealthValid {
+		result.Message = truncateProbeMessage(strings.TrimSpace(string(body)))
+	}
+	return result
+}
+
+// classifyKeyHealth maps an upstream model-list response to a key status
+func classifyKeyHealth(status int, body string) string {
+	msg := strings.ToLower(body)
+	switch {
+	case status >= 200 && status < 300:
+		return KeyHealthValid
+	case status == http.StatusPaymentRequired || strings.Contains(msg, "insufficient_quota") ||
+		strings.Contains(msg, "billing") || strings.Contains(msg, "credit balance") || strings.Contains(msg, "余额不足"):
+		return KeyHealthQuota
+	case status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		strings.Contains(msg, "invalid api key") || strings.Contains(msg, "invalid_api_key") ||
+		strings.Contains(msg, "api key not valid") || strings.Contains(msg, "api_key_invalid") ||
+		strings.Contains(msg, "incorrect api key") || strings.Contains(msg, "expired"):
+		return KeyHealthInvalid
+	case status == http.StatusTooManyRequests:
+		// 被限流说明 Key 本身可用
+		return KeyHealthRateLimited
+	}
+	return KeyHealthError
+}
+
+// saveResults upserts the latest result per key, drops rows for keys that no
+// longer exist on a checked channel, and returns the ids whose flagged status
+// is new.
+func (s *ChannelKeyHealthService) saveResults(ctx context.Context, results []ChannelKeyHealth) (map[string]bool, error) {
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelKeyHealthTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	tx, err := store.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	changed := map[string]bool{}
+	keysPerChannel := map[int64]int{}
+	for i := range results {
+		r := &results[i]
+		if r.KeyIndex+1 > keysPerChannel[r.ChannelID] {
+			keysPerChannel[r.ChannelID] = r.KeyIndex + 1
+		}
+
+		var prevStatus string
+		var prevChanged int64
+		err := tx.QueryRowContext(ctx, `SELECT status, changed_at FROM channel_key_health WHERE channel_id = ? AND key_index = ?`,
+			r.ChannelID, r.KeyIndex).Scan(&prevStatus, &prevChanged)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		r.ChangedAt = prevChanged
+		if err == sql.ErrNoRows || prevStatus != r.Status {
+			r.ChangedAt = r.CheckedAt
+			if keyHealthFlagged(r.Status) && !keyHealthFlagged(prevStatus) {
+				changed[keyHealthID(r.ChannelID, r.KeyIndex)] = true
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO channel_key_health (channel_id, key_index, channel_name, channel_type, key_hint, status, http_status, message, latency_ms, checked_at, changed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(channel_id, key_index) DO UPDATE SET
+				channel_name = excluded.channel_name, channel_type = excluded.channel_type, key_hint = excluded.key_hint,
+				status = excluded.status, http_status = excluded.http_status, message = excluded.message,
+				latency_ms = excluded.latency_ms, checked_at = excluded.checked_at, changed_at = excluded.changed_at`,
+			r.ChannelID, r.KeyIndex, r.ChannelName, r.ChannelType, r.KeyHint, r.Status, r.HTTPStatus, r.Message,
+			r.LatencyMs, r.CheckedAt, r.ChangedAt); err != nil {
+			return nil, err
+		}
+	}
+	for channelID, n := range keysPerChannel {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM channel_key_health WHERE channel_id = ? AND key_index >= ?`, channelID, n); err != nil {
+			return nil, err
+		}
+	}
+	return changed, tx.Commit()
+}
+
+// ListKeyHealth returns the latest stored result per key. status filters by
+// one status, or "flagged" for invalid + quota_exhausted.
+func (s *ChannelKeyHealthService) ListKeyHealth(ctx context.Context, status string) (map[string]interface{}, error) {
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelKeyHealthTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	rows, err := store.QueryContext(ctx, `
+		SELECT channel_id, key_index, channel_name, channel_type, key_hint, status, http_status, message, latency_ms, checked_at, changed_at
+		FROM channel_key_health ORDER BY channel_id, key_index`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ChannelKeyHealth{}
+	counts := map[string]int{}
+	var lastChecked int64
+	for rows.Next() {
+		var h ChannelKeyHealth
+		if err := rows.Scan(&h.ChannelID, &h.KeyIndex, &h.ChannelName, &h.ChannelType, &h.KeyHint, &h.Status,
+			&h.HTTPStatus, &h.Message, &h.LatencyMs, &h.CheckedAt, &h.ChangedAt); err != nil {
+			return nil, err
+		}
+		counts[h.Status]++
+		if h.CheckedAt > lastChecked {
+			lastChecked = h.CheckedAt
+		}
+		switch {
+		case status == "":
+		case status == "flagged" && keyHealthFlagged(h.Status):
+		case status == h.Status:
+		default:
+			continue
+		}
+		items = append(items, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"items":           items,
+		"counts":          counts,
+		"last_checked_at": lastChecked,
+	}, nil
+}
+
+func ensureChannelKeyHealthTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS channel_key_health (
+		channel_id INTEGER NOT NULL,
+		key_index INTEGER NOT NULL,
+		channel_name TEXT NOT NULL DEFAULT '',
+		channel_type INTEGER NOT NULL DEFAULT 0,
+		key_hint TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		http_status INTEGER NOT NULL DEFAULT 0,
+		message TEXT NOT NULL DEFAULT '',
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		checked_at INTEGER NOT NULL DEFAULT 0,
+		changed_at INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (channel_id, key_index)
+	)`)
+	return err
+}
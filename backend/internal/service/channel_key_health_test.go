@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestChannelKeyHealthCheck(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer sk-good-000000000001":
+			w.Write([]byte(`{"data":[]}`))
+		case "Bearer sk-broke-00000000002":
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"code":"insufficient_quota"}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"invalid_api_key"}}`))
+		}
+	}))
+	defer upstream.Close()
+
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT, type INTEGER, status INTEGER, base_url TEXT, key TEXT)`)
+	db.MustExec(`INSERT INTO channels VALUES
+		(1, 'multi', 1, 1, ?, 'sk-good-000000000001
+sk-revoked-0000000003
+sk-broke-00000000002'),
+		(2, 'vertex', 41, 1, '', '{"type":"service_account"}'),
+		(3, 'off', 1, 2, ?, 'sk-good-000000000001')`, upstream.URL, upstream.URL)
+
+	svc := NewChannelKeyHealthService()
+	summary, err := svc.CheckKeys(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("CheckKeys: %v", err)
+	}
+	if summary.Channels != 2 || summary.Checked != 4 {
+		t.Fatalf("expected 2 enabled channels / 4 keys, got %+v", summary)
+	}
+	want := map[string]int{KeyHealthValid: 1, KeyHealthInvalid: 1, KeyHealthQuota: 1, KeyHealthUnsupported: 1}
+	for status, n := range want {
+		if summary.Counts[status] != n {
+			t.Fatalf("%s: want %d, got %v", status, n, summary.Counts)
+		}
+	}
+
+	list, err := svc.ListKeyHealth(context.Background(), "flagged")
+	if err != nil {
+		t.Fatalf("ListKeyHealth: %v", err)
+	}
+	items := list["items"].([]ChannelKeyHealth)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 flagged keys, got %+v", items)
+	}
+	for _, it := range items {
+		if it.KeyHint == "" || len(it.KeyHint) >= 20 {
+			t.Fatalf("key should be masked, got %q", it.KeyHint)
+		}
+	}
+
+	// A key dropped from the channel disappears from the report on the next check.
+	db.MustExec(`UPDATE channels SET key = 'sk-good-000000000001' WHERE id = 1`)
+	if _, err := svc.CheckKeys(context.Background(), []int64{1}); err != nil {
+		t.Fatalf("CheckKeys (single): %v", err)
+	}
+	list, _ = svc.ListKeyHealth(context.Background(), "")
+	if n := len(list["items"].([]ChannelKeyHealth)); n != 2 {
+		t.Fatalf("expected channel 1 key + vertex row, got %d", n)
+	}
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// NewAPI channel status codes (common.ChannelStatus*)
+const (
+	ChannelStatusEnabled          = 1
+	ChannelStatusManuallyDisabled = 2
+	ChannelStatusAutoDisabled     = channelStatusAutoDisabled
+)
+
+const maxChannelBatchSize = 500
+
+var ErrChannelNotFound = errors.New("channel not found")
+
+// ChannelListQuery filters ListChannels results
+type ChannelListQuery struct {
+	Page     int
+	PageSize int
+	Status   int // 0 = all
+	Type     int // 0 = all
+	Group    string
+	Keyword  string // matches name / tag, or exact id
+	SortBy   string // priority (default) | id | balance | used_quota | response_time
+}
+
+// channelSortColumns whitelists ORDER BY columns for ListChannels
+var channelSortColumns = map[string]string{
+	"priority":      "priority DESC, id ASC",
+	"id":            "id ASC",
+	"balance":       "balance ASC, id ASC",
+	"used_quota":    "used_quota DESC, id ASC",
+	"response_time": "response_time DESC, id ASC",
+}
+
+// ChannelUpdateInput 可编辑的渠道调度字段（nil 表示不修改）
+type ChannelUpdateInput struct {
+	Priority *int64 `json:"priority"`
+	Weight   *int64 `json:"weight"`
+}
+
+// ChannelService manages NewAPI channels (status / priority / weight).
+//
+// NewAPI keeps a per-(group, model) copy of status/priority/weight in the
+// abilities table, which is what the relay actually routes on, so every write
+// here updates channels and abilities in one transaction — the same thing
+// NewAPI's own UpdateAbilityStatus / UpdateAbilities do. NewAPI instances
+// running with MEMORY_CACHE_ENABLED pick the change up on their next
+// SYNC_FREQUENCY reload.
+type ChannelService struct {
+	db *database.Manager
+	cm *cache.Manager
+}
+
+// NewChannelService creates a new ChannelService
+func NewChannelService() *ChannelService {
+	return NewChannelServiceFor("")
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelService) WithContext(ctx context.Context) *ChannelService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+// NewChannelServiceFor creates a ChannelService bound to a registered New API instance ("" = primary)
+func NewChannelServiceFor(instance string) *ChannelService {
+	db, _ := database.ForInstance(instance)
+	return &ChannelService{db: db, cm: cache.ForInstance(instance)}
+}
+
+func (s *ChannelService) groupCol() string {
+	if s.db.IsPG {
+		return `"group"`
+	}
+	return "`group`"
+}
+
+// ListChannels returns a page of channels (without keys) plus per-status counts
+func (s *ChannelService) ListChannels(q ChannelListQuery) (map[string]interface{}, error) {
+	groupCol := s.groupCol()
+	where := []string{"1=1"}
+	var args []interface{}
+	if q.Status > 0 {
+		where = append(where, "status = ?")
+		args = append(args, q.Status)
+	}
+	if q.Type > 0 {
+		where = append(where, "type = ?")
+		args = append(args, q.Type)
+	}
+	if g := strings.TrimSpace(q.Group); g != "" {
+		// group 字段是逗号分隔的多分组
+		padded := "CONCAT(',', " + groupCol + ", ',')"
+		if s.db.IsPG {
+			padded = "(',' || " + groupCol + " || ',')"
+		}
+		where = append(where, padded+" LIKE ?")
+		args = append(args, "%,"+g+",%")
+	}
+	if kw := strings.TrimSpace(q.Keyword); kw != "" {
+		if id, err := strconv.ParseInt(kw, 10, 64); err == nil {
+			where = append(where, "(id = ? OR name LIKE ?)")
+			args = append(args, id, "%"+kw+"%")
+		} else {
+			where = append(where, "(name LIKE ? OR tag LIKE ?)")
+			args = append(args, "%"+kw+"%", "%"+kw+"%")
+		}
+	}
+	whereSQL := strings.Join(where, " AND ")
+
+	orderBy, ok := channelSortColumns[q.SortBy]
+	if !ok {
+		orderBy = channelSortColumns["priority"]
+	}
+
+	countRow, err := s.db.QueryOne(s.db.RebindQuery(`SELECT COUNT(*) as total FROM channels WHERE `+whereSQL), args...)
+	if err != nil {
+		return nil, err
+	}
+	total := toInt64(countRow["total"])
+
+	offset := (q.Page - 1) * q.PageSize
+	rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(`
+		SELECT id, name, type, status, %s as channel_group, tag,
+			COALESCE(priority, 0) as priority, COALESCE(weight, 0) as weight,
+			COALESCE(balance, 0) as balance, COALESCE(used_quota, 0) as used_quota,
+			COALESCE(response_time, 0) as response_time, COALESCE(test_time, 0) as test_time
+		FROM channels WHERE %s
+		ORDER BY %s LIMIT ? OFFSET ?`, groupCol, whereSQL, orderBy)), append(args, q.PageSize, offset)...)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCounts := map[string]int64{"enabled": 0, "manually_disabled": 0, "auto_disabled": 0}
+	if countRows, err := s.db.Query(`SELECT status, COUNT(*) as cnt FROM channels GROUP BY status`); err == nil {
+		for _, r := range countRows {
+			switch toInt64(r["status"]) {
+			case ChannelStatusEnabled:
+				statusCounts["enabled"] += toInt64(r["cnt"])
+			case ChannelStatusManuallyDisabled:
+				statusCounts["manually_disabled"] += toInt64(r["cnt"])
+			case ChannelStatusAutoDisabled:
+				statusCounts["auto_disabled"] += toInt64(r["cnt"])
+			}
+		}
+	}
+
+	totalPages := (total + int64(q.PageSize) - 1) / int64(q.PageSize)
+	return map[string]interface{}{
+		"items":         rows,
+		"total":         total,
+		"page":          q.Page,
+		"page_size":     q.PageSize,
+		"total_pages":   totalPages,
+		"status_counts": statusCounts,
+	}, nil
+}
+
+// GetChannel returns a single channel (without its key)
+func (s *ChannelService) GetChannel(id int64) (map[string]interface{}, error) {
+	row, err := s.db.QueryOne(s.db.RebindQuery(fmt.Sprintf(`
+		SELECT id, name, type, status, %s as channel_group, models,
+			COALESCE(priority, 0) as priority, COALESCE(weight, 0) as weight,
+			COALESCE(balance, 0) as balance, COALESCE(used_quota, 0) as used_quota,
+			COALESCE(response_time, 0) as response_time, COALESCE(test_time, 0) as test_time
+		FROM channels WHERE id = ?`, s.groupCol())), id)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, ErrChannelNotFound
+	}
+	return row, nil
+}
+
+// SetStatus enables (status=1) or manually disables (status=2) a channel
+func (s *ChannelService) SetStatus(id int64, enabled bool) (map[string]interface{}, error) {
+	if _, err := s.BatchSetStatus([]int64{id}, enabled); err != nil {
+		return nil, err
+	}
+	return s.GetChannel(id)
+}
+
+// BatchSetStatus enables or manually disables channels in bulk.
+// Returns the number of channels whose status actually changed.
+func (s *ChannelService) BatchSetStatus(ids []int64, enabled bool) (int64, error) {
+	ids = uniquePositiveIDs(ids)
+	if len(ids) == 0 {
+		return 0, errors.New("no channel ids given")
+	}
+	if len(ids) > maxChannelBatchSize {
+		return 0, fmt.Errorf("too many channels (max %d)", maxChannelBatchSize)
+	}
+
+	status := ChannelStatusManuallyDisabled
+	if enabled {
+		status = ChannelStatusEnabled
+	}
+	affected, err := s.writeStatus(ids, status)
+	if err != nil {
+		return 0, err
+	}
+
+	action := "禁用"
+	if enabled {
+		action = "启用"
+	}
+	logger.L.Business(fmt.Sprintf("[渠道管理] %s渠道 %d 个 (变更 %d) | ids=%s", action, len(ids), affected, joinIDs(ids)))
+	return affected, nil
+}
+
+// writeStatus sets channels.status and the matching abilities.enabled flag
+// in one transaction. Only channels whose status differs are counted.
+func (s *ChannelService) writeStatus(ids []int64, status int) (int64, error) {
+	in, args := inClause(ids)
+
+	tx, err := s.db.DB.BeginTxx(s.db.Context(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(s.db.RebindQuery(`UPDATE channels SET status = ? WHERE status <> ? AND id IN (`+in+`)`),
+		append([]interface{}{status, status}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	affected, _ := res.RowsAffected()
+
+	if _, err := tx.Exec(s.db.RebindQuery(`UPDATE abilities SET enabled = ? WHERE channel_id IN (`+in+`)`),
+		append([]interface{}{status == ChannelStatusEnabled}, args...)...); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	s.invalidateCaches()
+	return affected, nil
+}
+
+// UpdateChannel edits priority / weight of a channel and its abilities
+func (s *ChannelService) UpdateChannel(id int64, in ChannelUpdateInput) (map[string]interface{}, error) {
+	if in.Priority == nil && in.Weight == nil {
+		return nil, errors.New("nothing to update")
+	}
+	if in.Weight != nil && *in.Weight < 0 {
+		return nil, errors.New("weight must be >= 0")
+	}
+	if _, err := s.GetChannel(id); err != nil {
+		return nil, err
+	}
+
+	var sets []string
+	var args []interface{}
+	if in.Priority != nil {
+		sets = append(sets, "priority = ?")
+		args = append(args, *in.Priority)
+	}
+	if in.Weight != nil {
+		sets = append(sets, "weight = ?")
+		args = append(args, *in.Weight)
+	}
+	args = append(args, id)
+
+	tx, err := s.db.DB.BeginTxx(s.db.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	setClause := strings.Join(sets, ", ")
+	if _, err := tx.Exec(s.db.RebindQuery(`UPDATE channels SET `+setClause+` WHERE id = ?`), args...); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(s.db.RebindQuery(`UPDATE abilities SET `+setClause+` WHERE channel_id = ?`), args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.invalidateCaches()
+	logger.L.Business(fmt.Sprintf("[渠道管理] 更新渠道 #%d 调度参数 | %s", id, setClause))
+	return s.GetChannel(id)
+}
+
+// invalidateCaches drops cached views that include channel status
+func (s *ChannelService) invalidateCaches() {
+	_, _ = s.cm.DeleteByPrefix(cache.Key("dashboard:"))
+	_, _ = s.cm.DeleteByPrefix(cache.Key("channel_routing:"))
+	PublishEvent(EventCacheInvalidated, map[string]interface{}{"scope": "channels"})
+}
+
+func uniquePositiveIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// inClause returns "?,?,?" and the matching args for an IN (...) list
+func inClause(ids []int64) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ","), args
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%d", id)
+	}
+	return strings.Join(parts, ",")
+}
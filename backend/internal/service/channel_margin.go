@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+const (
+	channelCostSettingsKey = "channel_cost_table"
+	channelMarginCacheTTL  = 5 * time.Minute
+	maxModelCostEntries    = 2000
+)
+
+var (
+	ErrInvalidModelCost  = errors.New("invalid model cost")
+	ErrModelCostNotFound = errors.New("model cost not found")
+)
+
+// ModelCost is the upstream price of a model (USD). Model may end with "*"
+// to match a prefix, e.g. "gpt-4o*"; exact names win over prefixes and longer
+// prefixes win over shorter ones.
+type ModelCost struct {
+	Model       string  `json:"model"`
+	InputPer1M  float64 `json:"input_per_1m"`  // USD per 1M prompt tokens
+	OutputPer1M float64 `json:"output_per_1m"` // USD per 1M completion tokens
+	PerRequest  float64 `json:"per_request"`   // USD per call (image / per-call models)
+}
+
+// ChannelCostMultiplier scales upstream cost for one channel (reseller discount, FX, etc.)
+type ChannelCostMultiplier struct {
+	ChannelID  int64   `json:"channel_id"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// ChannelCostTable 上游成本表
+type ChannelCostTable struct {
+	Models      []ModelCost             `json:"models"`
+	Multipliers []ChannelCostMultiplier `json:"multipliers"`
+	// TopUpCurrencyPerUSD converts top-up money into USD for the
+	// profitability report (e.g. 7.2 when users pay in CNY); 0 = money is USD
+	TopUpCurrencyPerUSD float64 `json:"topup_currency_per_usd"`
+	UpdatedAt           int64   `json:"updated_at"`
+}
+
+// ChannelMarginService compares quota charged to users against the upstream
+// cost derived from the configured cost table, per channel and per model.
+type ChannelMarginService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewChannelMarginService creates a new ChannelMarginService
+func NewChannelMarginService() *ChannelMarginService {
+	return &ChannelMarginService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelMarginService) WithContext(ctx context.Context) *ChannelMarginService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// GetCostTable returns the configured cost table (empty if never saved)
+func (s *ChannelMarginService) GetCostTable(ctx context.Context) (ChannelCostTable, error) {
+	table := ChannelCostTable{}
+	if _, err := loadLocalSetting(ctx, channelCostSettingsKey, &table); err != nil {
+		return table, err
+	}
+	if table.Models == nil {
+		table.Models = []ModelCost{}
+	}
+	if table.Multipliers == nil {
+		table.Multipliers = []ChannelCostMultiplier{}
+	}
+	return table, nil
+}
+
+// SaveCostTable validates and replaces the cost table
+func (s *ChannelMarginService) SaveCostTable(ctx context.Context, table ChannelCostTable) (ChannelCostTable, error) {
+	if err := normalizeCostTable(&table); err != nil {
+		return table, err
+	}
+	table.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, channelCostSettingsKey, table); err != nil {
+		return table, err
+	}
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("channel_margin:"))
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("cost_attribution:"))
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("channel_profit:"))
+	return table, nil
+}
+
+// ModelCostInput updates one entry of the cost table. Token prices may be
+// given per 1K tokens (converted to the stored per-1M unit) or per 1M tokens;
+// omitted fields keep the current value.
+type ModelCostInput struct {
+	Model       string   `json:"model"`
+	InputPer1K  *float64 `json:"input_per_1k"`
+	OutputPer1K *float64 `json:"output_per_1k"`
+	InputPer1M  *float64 `json:"input_per_1m"`
+	OutputPer1M *float64 `json:"output_per_1m"`
+	PerRequest  *float64 `json:"per_request"`
+}
+
+// UpsertModelCost adds or updates a single model in the cost table
+func (s *ChannelMarginService) UpsertModelCost(ctx context.Context, in ModelCostInput) (ModelCost, error) {
+	in.Model = strings.TrimSpace(in.Model)
+	if in.Model == "" {
+		return ModelCost{}, fmt.Errorf("%w: model name is required", ErrInvalidModelCost)
+	}
+	if (in.InputPer1K != nil && in.InputPer1M != nil) || (in.OutputPer1K != nil && in.OutputPer1M != nil) {
+		return ModelCost{}, fmt.Errorf("%w: give either per_1k or per_1m prices, not both", ErrInvalidModelCost)
+	}
+	table, err := s.GetCostTable(ctx)
+	if err != nil {
+		return ModelCost{}, err
+	}
+	idx := -1
+	for i, m := range table.Models {
+		if m.Model == in.Model {
+			idx = i
+			break
+		}
+	}
+	entry := ModelCost{Model: in.Model}
+	if idx >= 0 {
+		entry = table.Models[idx]
+	}
+	if in.InputPer1K != nil {
+		entry.InputPer1M = *in.InputPer1K * 1000
+	}
+	if in.InputPer1M != nil {
+		entry.InputPer1M = *in.InputPer1M
+	}
+	if in.OutputPer1K != nil {
+		entry.OutputPer1M = *in.OutputPer1K * 1000
+	}
+	if in.OutputPer1M != nil {
+		entry.OutputPer1M = *in.OutputPer1M
+	}
+	if in.PerRequest != nil {
+		entry.PerRequest = *in.PerRequest
+	}
+	if idx >= 0 {
+		table.Models[idx] = entry
+	} else {
+		table.Models = append(table.Models, entry)
+	}
+	if _, err := s.SaveCostTable(ctx, table); err != nil {
+		return ModelCost{}, fmt.Errorf("%w: %v", ErrInvalidModelCost, err)
+	}
+	return entry, nil
+}
+
+// DeleteModelCost removes a model (exact entry name, including a trailing "*")
+func (s *ChannelMarginService) DeleteModelCost(ctx context.Context, model string) error {
+	table, err := s.GetCostTable(ctx)
+	if err != nil {
+		return err
+	}
+	models := make([]ModelCost, 0, len(table.Models))
+	for _, m := range table.Models {
+		if m.Model != model {
+			models = append(models, m)
+		}
+	}
+	if len(models) == len(table.Models) {
+		return ErrModelCostNotFound
+	}
+	table.Models = models
+	_, err = s.SaveCostTable(ctx, table)
+	return err
+}
+
+func normalizeCostTable(t *ChannelCostTable) error {
+	if len(t.Models) > maxModelCostEntries {
+		return fmt.Errorf("too many model entries (max %d)", maxModelCostEntries)
+	}
+	seen := map[string]bool{}
+	models := make([]ModelCost, 0, len(t.Models))
+	for _, m := range t.Models {
+		m.Model = strings.TrimSpace(m.Model)
+		if m.Model == "" || m.Model == "*" {
+			return fmt.Errorf("model name is required")
+		}
+		if m.InputPer1M < 0 || m.OutputPer1M < 0 || m.PerRequest < 0 {
+			return fmt.Errorf("model %s: prices must be >= 0", m.Model)
+		}
+		if seen[m.Model] {
+			return fmt.Errorf("duplicate model entry: %s", m.Model)
+		}
+		seen[m.Model] = true
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Model < models[j].Model })
+	t.Models = models
+
+	seenChannels := map[int64]bool{}
+	multipliers := make([]ChannelCostMultiplier, 0, len(t.Multipliers))
+	for _, m := range t.Multipliers {
+		if m.ChannelID <= 0 {
+			return fmt.Errorf("invalid channel_id %d", m.ChannelID)
+		}
+		if m.Multiplier <= 0 || m.Multiplier > 100 {
+			return fmt.Errorf("channel %d: multiplier must be in (0, 100]", m.ChannelID)
+		}
+		if seenChannels[m.ChannelID] {
+			return fmt.Errorf("duplicate multiplier for channel %d", m.ChannelID)
+		}
+		seenChannels[m.ChannelID] = true
+		multipliers = append(multipliers, m)
+	}
+	sort.Slice(multipliers, func(i, j int) bool { return multipliers[i].ChannelID < multipliers[j].ChannelID })
+	t.Multipliers = multipliers
+	if t.TopUpCurrencyPerUSD < 0 || t.TopUpCurrencyPerUSD > 100000 {
+		return fmt.Errorf("topup_currency_per_usd must be in [0, 100000]")
+	}
+	return nil
+}
+
+// costLookup resolves model names to cost entries (exact, then longest prefix)
+type costLookup struct {
+	exact    map[string]ModelCost
+	prefixes []ModelCost // sorted longest first
+}
+
+func newCostLookup(models []ModelCost) *costLookup {
+	l := &costLookup{exact: map[string]ModelCost{}}
+	for _, m := range models {
+		if strings.HasSuffix(m.Model, "*") {
+			l.prefixes = append(l.prefixes, ModelCost{
+				Model: strings.TrimSuffix(m.Model, "*"), InputPer1M: m.InputPer1M, OutputPer1M: m.OutputPer1M, PerRequest: m.PerRequest,
+			})
+		} else {
+			l.exact[m.Model] = m
+		}
+	}
+	sort.Slice(l.prefixes, func(i, j int) bool { return len(l.prefixes[i].Model) > len(l.prefixes[j].Model) })
+	return l
+}
+
+func (l *costLookup) find(model string) (ModelCost, bool) {
+	if m, ok := l.exact[model]; ok {
+		return m, true
+	}
+	for _, p := range l.prefixes {
+		if strings.HasPrefix(model, p.Model) {
+			return p, true
+		}
+	}
+	return ModelCost{}, false
+}
+
+// upstreamCost returns the USD cost of a usage row for a cost entry
+func upstreamCost(c ModelCost, requests, promptTokens, completionTokens int64) float64 {
+	return float64(promptTokens)/1e6*c.InputPer1M +
+		float64(completionTokens)/1e6*c.OutputPer1M +
+		float64(requests)*c.PerRequest
+}
+
+// marginAgg accumulates revenue / cost for a channel or model
+type marginAgg struct {
+	Requests         int64
+	Quota            int64
+	PromptTokens     int64
+	CompletionTokens int64
+	PricedRevenue    float64
+	Cost             float64
+	UnpricedQuota    int64
+}
+
+func (a *marginAgg) add(requests, quota, prompt, completion int64, cost float64, priced bool) {
+	a.Requests += requests
+	a.Quota += quota
+	a.PromptTokens += prompt
+	a.CompletionTokens += completion
+	if priced {
+		a.PricedRevenue += float64(quota) / util.TokensPerUSD
+		a.Cost += cost
+	} else {
+		a.UnpricedQuota += quota
+	}
+}
+
+func (a *marginAgg) toMap() map[string]interface{} {
+	revenue := float64(a.Quota) / util.TokensPerUSD
+	margin := a.PricedRevenue - a.Cost
+	var marginRate, coverage interface{}
+	if a.PricedRevenue > 0 {
+		marginRate = roundRate(margin / a.PricedRevenue * 100)
+	}
+	if a.Quota > 0 {
+		coverage = roundRate(float64(a.Quota-a.UnpricedQuota) / float64(a.Quota) * 100)
+	}
+	return map[string]interface{}{
+		"requests":          a.Requests,
+		"quota":             a.Quota,
+		"prompt_tokens":     a.PromptTokens,
+		"completion_tokens": a.CompletionTokens,
+		"revenue_usd":       round4dp(revenue),
+		"priced_revenue":    round4dp(a.PricedRevenue),
+		"cost_usd":          round4dp(a.Cost),
+		"margin_usd":        round4dp(margin),
+		"margin_rate":       marginRate,
+		"cost_coverage":     coverage, // percent of charged quota that has a cost entry
+		"unpriced_quota":    a.UnpricedQuota,
+	}
+}
+
+func round4dp(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// GetMargin returns charged-vs-cost margin per channel, per model and overall
+// for the last `days` days. Only successful consume logs (type=2) count.
+func (s *ChannelMarginService) GetMargin(ctx context.Context, days int, noCache bool) (map[string]interface{}, error) {
+	cm := cache.Get()
+	cacheKey := cache.Key("channel_margin:%d", days)
+	if !noCache {
+		var cached map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	table, err := s.GetCostTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.usageRows(time.Now().AddDate(0, 0, -days).Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[int64]string{}
+	if chRows, err := s.db.Query(`SELECT id, name FROM channels`); err == nil {
+		for _, r := range chRows {
+			names[toInt64(r["id"])] = toString(r["name"])
+		}
+	}
+
+	result := computeChannelMargin(rows, table, names)
+	result["days"] = days
+	result["cost_table_updated_at"] = table.UpdatedAt
+	cm.Set(cacheKey, result, channelMarginCacheTTL)
+	return result, nil
+}
+
+// usageRows sums successful consume logs since startTime per (channel_id, model_name)
+func (s *ChannelMarginService) usageRows(startTime int64) ([]map[string]interface{}, error) {
+	return s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(`
+		SELECT channel_id, model_name,
+			COUNT(*) as requests,
+			COALESCE(SUM(quota), 0) as quota,
+			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) as completion_tokens
+		FROM logs
+		WHERE created_at >= ? AND type = `+ltConsume()+`
+		GROUP BY channel_id, model_name`), startTime)
+}
+
+// computeChannelMargin aggregates (channel_id, model_name) usage rows
+func computeChannelMargin(rows []map[string]interface{}, table ChannelCostTable, names map[int64]string) map[string]interface{} {
+	lookup := newCostLookup(table.Models)
+	multipliers := make(map[int64]float64, len(table.Multipliers))
+	for _, m := range table.Multipliers {
+		multipliers[m.ChannelID] = m.Multiplier
+	}
+
+	byChannel := map[int64]*marginAgg{}
+	byModel := map[string]*marginAgg{}
+	total := &marginAgg{}
+	unpriced := map[string]int64{}
+	for _, r := range rows {
+		channelID := toInt64(r["channel_id"])
+		model := toString(r["model_name"])
+		requests, quota := toInt64(r["requests"]), toInt64(r["quota"])
+		prompt, completion := toInt64(r["prompt_tokens"]), toInt64(r["completion_tokens"])
+
+		cost, priced := 0.0, false
+		if entry, ok := lookup.find(model); ok {
+			priced = true
+			cost = upstreamCost(entry, requests, prompt, completion)
+			if mult, ok := multipliers[channelID]; ok {
+				cost *= mult
+			}
+		} else {
+			unpriced[model] += quota
+		}
+
+		if byChannel[channelID] == nil {
+			byChannel[channelID] = &marginAgg{}
+		}
+		if byModel[model] == nil {
+			byModel[model] = &marginAgg{}
+		}
+		byChannel[channelID].add(requests, quota, prompt, completion, cost, priced)
+		byModel[model].add(requests, quota, prompt, completion, cost, priced)
+		total.add(requests, quota, prompt, completion, cost, priced)
+	}
+
+	channels := make([]map[string]interface{}, 0, len(byChannel))
+	for id, agg := range byChannel {
+		item := agg.toMap()
+		item["channel_id"] = id
+		item["channel_name"] = names[id]
+		if mult, ok := multipliers[id]; ok {
+			item["cost_multiplier"] = mult
+		}
+		channels = append(channels, item)
+	}
+	sortByRevenue(channels)
+
+	modelItems := make([]map[string]interface{}, 0, len(byModel))
+	for name, agg := range byModel {
+		item := agg.toMap()
+		item["model_name"] = name
+		_, item["priced"] = lookup.find(name)
+		modelItems = append(modelItems, item)
+	}
+	sortByRevenue(modelItems)
+
+	unpricedModels := make([]map[string]interface{}, 0, len(unpriced))
+	for name, q := range unpriced {
+		unpricedModels = append(unpricedModels, map[string]interface{}{"model_name": name, "quota": q})
+	}
+	sort.Slice(unpricedModels, func(i, j int) bool {
+		return toInt64(unpricedModels[i]["quota"]) > toInt64(unpricedModels[j]["quota"])
+	})
+
+	return map[string]interface{}{
+		"summary":         total.toMap(),
+		"channels":        channels,
+		"models":          modelItems,
+		"unpriced_models": unpricedModels,
+	}
+}
+
+func sortByRevenue(items []map[string]interface{}) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return toFloat64(items[i]["revenue_usd"]) > toFloat64(items[j]["revenue_usd"])
+	})
+}
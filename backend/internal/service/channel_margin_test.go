@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestComputeChannelMargin(t *testing.T) {
+	table := ChannelCostTable{
+		Models: []ModelCost{
+			{Model: "gpt-4o*", InputPer1M: 2, OutputPer1M: 8},
+			{Model: "gpt-4o-mini", InputPer1M: 0.1, OutputPer1M: 0.4},
+			{Model: "dall-e-3", PerRequest: 0.04},
+		},
+		Multipliers: []ChannelCostMultiplier{{ChannelID: 2, Multiplier: 0.5}},
+	}
+	if err := normalizeCostTable(&table); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	rows := []map[string]interface{}{
+		// $5 charged, cost 1M*2 + 0.25M*8 = $4
+		{"channel_id": int64(1), "model_name": "gpt-4o-2024-08-06", "requests": int64(100), "quota": int64(2500000), "prompt_tokens": int64(1000000), "completion_tokens": int64(250000)},
+		// same usage on a half-price channel: cost $2
+		{"channel_id": int64(2), "model_name": "gpt-4o-2024-08-06", "requests": int64(100), "quota": int64(2500000), "prompt_tokens": int64(1000000), "completion_tokens": int64(250000)},
+		// exact match beats the gpt-4o* prefix: cost 0.1 + 0.4 = $0.5, charged $1
+		{"channel_id": int64(1), "model_name": "gpt-4o-mini", "requests": int64(10), "quota": int64(500000), "prompt_tokens": int64(1000000), "completion_tokens": int64(1000000)},
+		{"channel_id": int64(1), "model_name": "dall-e-3", "requests": int64(10), "quota": int64(500000)},
+		{"channel_id": int64(1), "model_name": "mystery", "requests": int64(1), "quota": int64(1000000)},
+	}
+
+	res := computeChannelMargin(rows, table, map[int64]string{1: "main", 2: "discount"})
+	summary := res["summary"].(map[string]interface{})
+	if got := summary["cost_usd"].(float64); got != 6.9 {
+		t.Fatalf("total cost = %v, want 6.9", got)
+	}
+	if got := summary["margin_usd"].(float64); got != 5.1 { // priced revenue $12 - cost $6.9
+		t.Fatalf("margin = %v", got)
+	}
+	if summary["unpriced_quota"].(int64) != 1000000 {
+		t.Fatalf("unpriced quota = %v", summary["unpriced_quota"])
+	}
+
+	for _, ch := range res["channels"].([]map[string]interface{}) {
+		if ch["channel_id"].(int64) == 2 && ch["margin_rate"].(float64) != 60 {
+			t.Fatalf("discount channel margin rate = %v, want 60", ch["margin_rate"])
+		}
+	}
+	unpriced := res["unpriced_models"].([]map[string]interface{})
+	if len(unpriced) != 1 || unpriced[0]["model_name"] != "mystery" {
+		t.Fatalf("unpriced models = %v", unpriced)
+	}
+
+	dup := ChannelCostTable{Models: []ModelCost{{Model: "a"}, {Model: "a"}}}
+	if err := normalizeCostTable(&dup); err == nil {
+		t.Fatalf("duplicate model entries should be rejected")
+	}
+}
+
+func TestModelCostUpsertAndMarginAlerts(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, channel_id INTEGER, model_name TEXT,
+		type INTEGER, quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	now := time.Now().Unix()
+	// loss-maker: $1 charged, 1M prompt tokens cost $3; profitable: $5 charged, cost $1
+	for _, r := range [][]interface{}{
+		{1, "loss-model", 2, 500000, 1000000, 0, now - 600},
+		{1, "good-model", 2, 2500000, 1000000, 0, now - 600},
+		{1, "loss-model", 2, 500000, 0, 0, now - 30*3600}, // outside the 24h window
+	} {
+		if _, err := db.Exec(`INSERT INTO logs (channel_id, model_name, type, quota, prompt_tokens, completion_tokens, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, r...); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	svc := NewChannelMarginService()
+	price := 0.003 // per 1K = $3 per 1M
+	entry, err := svc.UpsertModelCost(ctx, ModelCostInput{Model: "loss-model", InputPer1K: &price})
+	if err != nil || entry.InputPer1M != 3 {
+		t.Fatalf("upsert per-1k price: %+v %v", entry, err)
+	}
+	one := 1.0
+	if _, err := svc.UpsertModelCost(ctx, ModelCostInput{Model: "good-model", InputPer1M: &one}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if _, err := svc.UpsertModelCost(ctx, ModelCostInput{Model: "x", InputPer1K: &one, InputPer1M: &one}); !errors.Is(err, ErrInvalidModelCost) {
+		t.Fatalf("per_1k and per_1m together should be rejected, got %v", err)
+	}
+
+	raised, err := svc.CheckAlerts(ctx)
+	if err != nil {
+		t.Fatalf("CheckAlerts: %v", err)
+	}
+	if len(raised) != 1 || raised[0].ModelName != "loss-model" || raised[0].MarginUSD != -2 || *raised[0].MarginRate != -200 {
+		t.Fatalf("expected one loss-model alert, got %+v", raised)
+	}
+	if again, _ := svc.CheckAlerts(ctx); len(again) != 0 {
+		t.Fatalf("cooldown should suppress a repeat alert, got %+v", again)
+	}
+	items, total, err := svc.ListAlerts(ctx, "loss-model", 10, 0)
+	if err != nil || total != 1 || len(items) != 1 {
+		t.Fatalf("ListAlerts: %v %d %+v", err, total, items)
+	}
+
+	if err := svc.DeleteModelCost(ctx, "loss-model"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := svc.DeleteModelCost(ctx, "loss-model"); !errors.Is(err, ErrModelCostNotFound) {
+		t.Fatalf("second delete should be not found, got %v", err)
+	}
+}
+
+func TestChannelProfitability(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE top_ups (id INTEGER PRIMARY KEY, user_id INTEGER, amount INTEGER, money REAL, create_time INTEGER, status TEXT);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, channel_id INTEGER, model_name TEXT,
+			type INTEGER, quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, created_at INTEGER);
+		INSERT INTO channels VALUES (1, 'main'), (2, 'pricey');`)
+	now := time.Now().Unix()
+	// 10 USD of quota sold for 56 CNY = 8 USD: every list dollar realizes $0.8
+	db.MustExec(`INSERT INTO top_ups VALUES (1, 1, 10, 56, ?, 'success'), (2, 1, 100, 700, ?, 'failed')`, now-3600, now-3600)
+	// main: $5 list -> $4 realized, cost $2; pricey: $1 list -> $0.8 realized, cost $2
+	db.MustExec(`INSERT INTO logs (user_id, channel_id, model_name, type, quota, prompt_tokens, completion_tokens, created_at) VALUES
+		(1, 1, 'gpt-4o', 2, 2500000, 1000000, 0, ?),
+		(1, 2, 'gpt-4o', 2, 500000, 1000000, 0, ?)`, now-60, now-60)
+
+	svc := NewChannelMarginService()
+	ctx := context.Background()
+	if _, err := svc.SaveCostTable(ctx, ChannelCostTable{TopUpCurrencyPerUSD: -1}); err == nil {
+		t.Error("negative currency rate accepted")
+	}
+	if _, err := svc.SaveCostTable(ctx, ChannelCostTable{
+		Models:              []ModelCost{{Model: "gpt-4o*", InputPer1M: 2, OutputPer1M: 8}},
+		TopUpCurrencyPerUSD: 7,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := svc.GetProfitability(ctx, TopUpTrendsParams{Days: 30}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["revenue_basis"] != "top_ups" || res["realized_per_usd"] != 0.8 {
+		t.Fatalf("basis = %v, %v", res["revenue_basis"], res["realized_per_usd"])
+	}
+	summary := res["summary"].(map[string]interface{})
+	if summary["revenue_usd"] != 4.8 || summary["list_revenue_usd"] != 6.0 || summary["cost_usd"] != 4.0 || summary["margin_usd"] != 0.8 {
+		t.Errorf("summary = %+v", summary)
+	}
+	routes := res["loss_routes"].([]map[string]interface{})
+	if len(routes) != 1 || routes[0]["channel_name"] != "pricey" || routes[0]["margin_usd"] != -1.2 {
+		t.Errorf("loss routes = %+v", routes)
+	}
+	for _, ch := range res["channels"].([]map[string]interface{}) {
+		if ch["loss_making"] != (ch["channel_id"] == int64(2)) {
+			t.Errorf("channel = %+v", ch)
+		}
+	}
+
+	// No top-ups in the period: fall back to the list price
+	db.MustExec(`DELETE FROM top_ups`)
+	if res, err = svc.GetProfitability(ctx, TopUpTrendsParams{Days: 30}, true); err != nil || res["revenue_basis"] != "list" {
+		t.Fatalf("list basis = %v, %v", res["revenue_basis"], err)
+	}
+}
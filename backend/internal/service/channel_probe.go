@@ -0,0 +1,649 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	channelProbeSettingsKey = "channel_probe"
+
+	// channelStatusAutoDisabled mirrors NewAPI's common.ChannelStatusAutoDisabled
+	channelStatusAutoDisabled = 3
+
+	defaultProbeResultLimit = 50
+	maxProbeResultLimit     = 500
+	probeResultRetention    = 7 * 24 * time.Hour
+)
+
+// Probe error classes
+const (
+	ProbeErrorTimeout       = "timeout"
+	ProbeErrorAuth          = "auth"
+	ProbeErrorQuota         = "quota"
+	ProbeErrorRateLimit     = "rate_limit"
+	ProbeErrorModelNotFound = "model_not_found"
+	ProbeErrorUpstream5xx   = "upstream_5xx"
+	ProbeErrorNetwork       = "network"
+	ProbeErrorUnknown       = "unknown"
+)
+
+var ErrProbeNotConfigured = errors.New("NEWAPI_BASEURL / NEWAPI_API_KEY 未配置，无法主动探测渠道")
+
+// ChannelProbeSettings 主动探测配置
+type ChannelProbeSettings struct {
+	Enabled          bool    `json:"enabled"`
+	IntervalMinutes  int     `json:"interval_minutes"`
+	TimeoutSeconds   int     `json:"timeout_seconds"`
+	Concurrency      int     `json:"concurrency"`
+	AutoDisable      bool    `json:"auto_disable"`
+	FailureThreshold int     `json:"failure_threshold"`
+	NewAPIUserID     int64   `json:"newapi_user_id"`
+	ChannelIDs       []int64 `json:"channel_ids"`
+	UpdatedAt        int64   `json:"updated_at"`
+}
+
+// ChannelProbeSettingsInput supports partial update of ChannelProbeSettings
+type ChannelProbeSettingsInput struct {
+	Enabled          *bool    `json:"enabled"`
+	IntervalMinutes  *int     `json:"interval_minutes"`
+	TimeoutSeconds   *int     `json:"timeout_seconds"`
+	Concurrency      *int     `json:"concurrency"`
+	AutoDisable      *bool    `json:"auto_disable"`
+	FailureThreshold *int     `json:"failure_threshold"`
+	NewAPIUserID     *int64   `json:"newapi_user_id"`
+	ChannelIDs       *[]int64 `json:"channel_ids"`
+}
+
+// ChannelProbeResult 单次探测结果
+type ChannelProbeResult struct {
+	ID          int64  `json:"id"`
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Model       string `json:"model"`
+	Success     bool   `json:"success"`
+	LatencyMs   int64  `json:"latency_ms"`
+	ErrorClass  string `json:"error_class,omitempty"`
+	Message     string `json:"message,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// ChannelProbeState 渠道的累计探测状态
+type ChannelProbeState struct {
+	ChannelID           int64  `json:"channel_id"`
+	ChannelName         string `json:"channel_name"`
+	Model               string `json:"model"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastSuccessAt       int64  `json:"last_success_at"`
+	LastFailureAt       int64  `json:"last_failure_at"`
+	LastErrorClass      string `json:"last_error_class,omitempty"`
+	LastLatencyMs       int64  `json:"last_latency_ms"`
+	DisabledByProbe     bool   `json:"disabled_by_probe"`
+	DisabledAt          int64  `json:"disabled_at"`
+	UpdatedAt           int64  `json:"updated_at"`
+}
+
+// ChannelProbeRunSummary 一轮探测的汇总
+type ChannelProbeRunSummary struct {
+	Probed   int                  `json:"probed"`
+	Success  int                  `json:"success"`
+	Failed   int                  `json:"failed"`
+	Disabled []int64              `json:"disabled"`
+	Skipped  []int64              `json:"skipped"` // 处于维护窗口而跳过的渠道
+	Results  []ChannelProbeResult `json:"results"`
+	Duration int64                `json:"duration_ms"`
+}
+
+type probeTarget struct {
+	ID    int64
+	Name  string
+	Model string
+}
+
+// ChannelProbeService actively tests NewAPI channels through NewAPI's own
+// /api/channel/test endpoint and keeps the results in the tool-local store.
+type ChannelProbeService struct {
+	cfg        *config.Config
+	db         *database.Manager
+	httpClient *http.Client
+}
+
+// channelProbeMu serialises probe rounds (background ticker vs manual run)
+var channelProbeMu sync.Mutex
+
+// NewChannelProbeService creates a new ChannelProbeService
+func NewChannelProbeService() *ChannelProbeService {
+	return &ChannelProbeService{
+		cfg:        config.Get(),
+		db:         database.Get(),
+		httpClient: &http.Client{},
+	}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelProbeService) WithContext(ctx context.Context) *ChannelProbeService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+func defaultChannelProbeSettings() ChannelProbeSettings {
+	return ChannelProbeSettings{
+		IntervalMinutes:  30,
+		TimeoutSeconds:   30,
+		Concurrency:      4,
+		FailureThreshold: 3,
+		NewAPIUserID:     1,
+		ChannelIDs:       []int64{},
+	}
+}
+
+func normalizeChannelProbeSettings(s *ChannelProbeSettings) {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 1, 1440, 30)
+	s.TimeoutSeconds = clampSetting(s.TimeoutSeconds, 5, 120, 30)
+	s.Concurrency = clampSetting(s.Concurrency, 1, 16, 4)
+	s.FailureThreshold = clampSetting(s.FailureThreshold, 1, 100, 3)
+	if s.NewAPIUserID <= 0 {
+		s.NewAPIUserID = 1
+	}
+	if s.ChannelIDs == nil {
+		s.ChannelIDs = []int64{}
+	}
+}
+
+// clampSetting returns def for unset (<=0) values, otherwise v clamped to [min, max]
+func clampSetting(v, min, max, def int) int {
+	if v <= 0 {
+		return def
+	}
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// GetSettings returns the probe settings (defaults if never saved)
+func (s *ChannelProbeService) GetSettings(ctx context.Context) (ChannelProbeSettings, error) {
+	settings := defaultChannelProbeSettings()
+	if _, err := loadLocalSetting(ctx, channelProbeSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	normalizeChannelProbeSettings(&settings)
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update and persists it
+func (s *ChannelProbeService) UpdateSettings(ctx context.Context, in ChannelProbeSettingsInput) (ChannelProbeSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.TimeoutSeconds != nil {
+		settings.TimeoutSeconds = *in.TimeoutSeconds
+	}
+	if in.Concurrency != nil {
+		settings.Concurrency = *in.Concurrency
+	}
+	if in.AutoDisable != nil {
+		settings.AutoDisable = *in.AutoDisable
+	}
+	if in.FailureThreshold != nil {
+		settings.FailureThreshold = *in.FailureThreshold
+	}
+	if in.NewAPIUserID != nil {
+		settings.NewAPIUserID = *in.NewAPIUserID
+	}
+	if in.ChannelIDs != nil {
+		settings.ChannelIDs = *in.ChannelIDs
+	}
+	normalizeChannelProbeSettings(&settings)
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, channelProbeSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// Configured reports whether NewAPI admin access is available for probing
+func (s *ChannelProbeService) Configured() bool {
+	return strings.TrimSpace(s.cfg.NewAPIBaseURL) != "" && strings.TrimSpace(s.cfg.NewAPIKey) != ""
+}
+
+// RunProbes probes every enabled channel once and updates consecutive-failure state.
+// Channels reaching the failure threshold are set to auto-disabled when AutoDisable is on.
+func (s *ChannelProbeService) RunProbes(ctx context.Context) (*ChannelProbeRunSummary, error) {
+	if !s.Configured() {
+		return nil, ErrProbeNotConfigured
+	}
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channelProbeMu.Lock()
+	defer channelProbeMu.Unlock()
+
+	start := time.Now()
+	targets, err := s.loadTargets(settings.ChannelIDs, true)
+	if err != nil {
+		return nil, err
+	}
+	// 维护中的渠道或探测模型预期会失败，不探测也不累计失败次数
+	skipped := []int64{}
+	now := start.Unix()
+	if schedule := loadMaintenanceSchedule(ctx, now, now+1); len(schedule) > 0 {
+		kept := targets[:0]
+		for _, t := range targets {
+			if schedule.channelDuring(t.ID, now, now+1) || schedule.modelDuring(t.Model, now, now+1) {
+				skipped = append(skipped, t.ID)
+				continue
+			}
+			kept = append(kept, t)
+		}
+		targets = kept
+	}
+
+	results := make([]ChannelProbeResult, len(targets))
+	sem := make(chan struct{}, settings.Concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t probeTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.probeOne(ctx, t, settings)
+		}(i, t)
+	}
+	wg.Wait()
+
+	summary := &ChannelProbeRunSummary{Results: results, Disabled: []int64{}, Skipped: skipped}
+	if err := s.recordResults(ctx, results, settings, summary); err != nil {
+		return nil, err
+	}
+	summary.Probed = len(results)
+	summary.Duration = time.Since(start).Milliseconds()
+
+	PublishEvent(EventScanFinished, map[string]interface{}{
+		"scanner":  "channel_probe",
+		"probed":   summary.Probed,
+		"success":  summary.Success,
+		"failed":   summary.Failed,
+		"disabled": summary.Disabled,
+		"skipped":  summary.Skipped,
+	})
+	return summary, nil
+}
+
+// loadTargets returns channels with the model used for probing (test_model
+// first, otherwise the first entry of models). enabledOnly restricts to status=1;
+// recovery probes pass false to test channels that are currently disabled.
+func (s *ChannelProbeService) loadTargets(channelIDs []int64, enabledOnly bool) ([]probeTarget, error) {
+	query := `SELECT id, name, models, test_model FROM channels WHERE 1=1`
+	if enabledOnly {
+		query += " AND status = 1"
+	}
+	var args []interface{}
+	if len(channelIDs) > 0 {
+		var in string
+		in, args = inClause(channelIDs)
+		query += " AND id IN (" + in + ")"
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(s.db.RebindQuery(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]probeTarget, 0, len(rows))
+	for _, row := range rows {
+		model := strings.TrimSpace(toString(row["test_model"]))
+		if model == "" {
+			for _, m := range strings.Split(toString(row["models"]), ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					model = m
+					break
+				}
+			}
+		}
+		targets = append(targets, probeTarget{ID: toInt64(row["id"]), Name: toString(row["name"]), Model: model})
+	}
+	return targets, nil
+}
+
+// probeOne calls NewAPI GET /api/channel/test/:id?model=...
+func (s *ChannelProbeService) probeOne(ctx context.Context, t probeTarget, settings ChannelProbeSettings) ChannelProbeResult {
+	result := ChannelProbeResult{
+		ChannelID:   t.ID,
+		ChannelName: t.Name,
+		Model:       t.Model,
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(settings.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	endpoint := strings.TrimRight(s.cfg.NewAPIBaseURL, "/") + "/api/channel/test/" + strconv.FormatInt(t.ID, 10)
+	if t.Model != "" {
+		endpoint += "?model=" + url.QueryEscape(t.Model)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		result.ErrorClass, result.Message = ProbeErrorUnknown, err.Error()
+		return result
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.NewAPIKey)
+	req.Header.Set("New-Api-User", strconv.FormatInt(settings.NewAPIUserID, 10))
+
+	started := time.Now()
+	resp, err := s.httpClient.Do(req)
+	result.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.ErrorClass, result.Message = classifyProbeError(0, err.Error(), err), err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var payload struct {
+		Success bool    `json:"success"`
+		Message string  `json:"message"`
+		Time    float64 `json:"time"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		result.ErrorClass = classifyProbeError(resp.StatusCode, string(body), nil)
+		result.Message = truncateProbeMessage(fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(body)))
+		return result
+	}
+	if payload.Time > 0 {
+		// NewAPI 返回的 time 是上游耗时（秒），比包含管理接口开销的本地计时更准确
+		result.LatencyMs = int64(payload.Time * 1000)
+	}
+	if resp.StatusCode == http.StatusOK && payload.Success {
+		result.Success = true
+		return result
+	}
+	result.ErrorClass = classifyProbeError(resp.StatusCode, payload.Message, nil)
+	result.Message = truncateProbeMessage(payload.Message)
+	return result
+}
+
+// classifyProbeError maps an HTTP status / NewAPI error message to a coarse error class
+func classifyProbeError(status int, message string, err error) string {
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || strings.Contains(strings.ToLower(err.Error()), "timeout") {
+			return ProbeErrorTimeout
+		}
+		return ProbeErrorNetwork
+	}
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline exceeded") || strings.Contains(msg, "超时"):
+		return ProbeErrorTimeout
+	case status == http.StatusTooManyRequests || strings.Contains(msg, "rate limit") || strings.Contains(msg, "429"):
+		return ProbeErrorRateLimit
+	case strings.Contains(msg, "insufficient") || strings.Contains(msg, "quota") || strings.Contains(msg, "balance") || strings.Contains(msg, "余额"):
+		return ProbeErrorQuota
+	case status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		strings.Contains(msg, "unauthorized") || strings.Contains(msg, "invalid api key") ||
+		strings.Contains(msg, "incorrect api key") || strings.Contains(msg, "401") || strings.Contains(msg, "403"):
+		return ProbeErrorAuth
+	case strings.Contains(msg, "model_not_found") || strings.Contains(msg, "model not found") ||
+		strings.Contains(msg, "does not exist") || strings.Contains(msg, "no available channel"):
+		return ProbeErrorModelNotFound
+	case status >= 500 || strings.Contains(msg, "status code 5") || strings.Contains(msg, "bad gateway") ||
+		strings.Contains(msg, "service unavailable") || strings.Contains(msg, "internal server error"):
+		return ProbeErrorUpstream5xx
+	case strings.Contains(msg, "connection refused") || strings.Contains(msg, "no such host") ||
+		strings.Contains(msg, "connection reset") || strings.Contains(msg, "eof"):
+		return ProbeErrorNetwork
+	}
+	return ProbeErrorUnknown
+}
+
+func truncateProbeMessage(msg string) string {
+	const max = 500
+	if len(msg) > max {
+		return msg[:max] + "..."
+	}
+	return msg
+}
+
+// recordResults persists the results, updates per-channel state and applies auto-disable.
+func (s *ChannelProbeService) recordResults(ctx context.Context, results []ChannelProbeResult, settings ChannelProbeSettings, summary *ChannelProbeRunSummary) error {
+	store, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := ensureChannelProbeTables(ctx, store); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for i := range results {
+		r := &results[i]
+		res, err := store.ExecContext(ctx, `
+			INSERT INTO channel_probe_results (channel_id, channel_name, model, success, latency_ms, error_class, message, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.ChannelID, r.ChannelName, r.Model, boolToInt(r.Success), r.LatencyMs, r.ErrorClass, r.Message, r.CreatedAt)
+		if err != nil {
+			return err
+		}
+		r.ID, _ = res.LastInsertId()
+
+		state, err := loadChannelProbeState(ctx, store, r.ChannelID)
+		if err != nil {
+			return err
+		}
+		state.ChannelName, state.Model, state.LastLatencyMs, state.UpdatedAt = r.ChannelName, r.Model, r.LatencyMs, now
+		if r.Success {
+			summary.Success++
+			state.ConsecutiveFailures = 0
+			state.LastSuccessAt = r.CreatedAt
+			// 渠道被手动重新启用并恢复正常后，允许下次再次自动禁用
+			state.DisabledByProbe = false
+		} else {
+			summary.Failed++
+			state.ConsecutiveFailures++
+			state.LastFailureAt = r.CreatedAt
+			state.LastErrorClass = r.ErrorClass
+			if settings.AutoDisable && state.ConsecutiveFailures >= settings.FailureThreshold && !state.DisabledByProbe {
+				if err := s.disableChannel(r.ChannelID); err != nil {
+					logger.L.Warn(fmt.Sprintf("[渠道探测] 自动禁用渠道 #%d 失败: %v", r.ChannelID, err), logger.CatSystem)
+				} else {
+					state.DisabledByProbe = true
+					state.DisabledAt = now
+					summary.Disabled = append(summary.Disabled, r.ChannelID)
+					logger.L.Business(fmt.Sprintf("[渠道探测] 渠道 #%d (%s) 连续失败 %d 次，已自动禁用 | class=%s",
+						r.ChannelID, r.ChannelName, state.ConsecutiveFailures, r.ErrorClass))
+				}
+			}
+		}
+		if err := saveChannelProbeState(ctx, store, state); err != nil {
+			return err
+		}
+	}
+
+	_, err = store.ExecContext(ctx, `DELETE FROM channel_probe_results WHERE created_at < ?`,
+		time.Now().Add(-probeResultRetention).Unix())
+	return err
+}
+
+// disableChannel marks the channel auto-disabled (status=3) in the NewAPI database
+func (s *ChannelProbeService) disableChannel(channelID int64) error {
+	channels := &ChannelService{db: s.db, cm: cache.Get()}
+	_, err := channels.writeStatus([]int64{channelID}, ChannelStatusAutoDisabled)
+	return err
+}
+
+// ListProbes returns the latest state per channel plus recent raw results.
+// channelID > 0 restricts both lists to a single channel.
+func (s *ChannelProbeService) ListProbes(ctx context.Context, channelID int64, limit int) (map[string]interface{}, error) {
+	if limit <= 0 {
+		limit = defaultProbeResultLimit
+	}
+	if limit > maxProbeResultLimit {
+		limit = maxProbeResultLimit
+	}
+
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureChannelProbeTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	stateQuery := `SELECT channel_id, channel_name, model, consecutive_failures, last_success_at, last_failure_at,
+		last_error_class, last_latency_ms, disabled_by_probe, disabled_at, updated_at FROM channel_probe_state`
+	resultQuery := `SELECT id, channel_id, channel_name, model, success, latency_ms, error_class, message, created_at
+		FROM channel_probe_results`
+	var args []interface{}
+	if channelID > 0 {
+		stateQuery += " WHERE channel_id = ?"
+		resultQuery += " WHERE channel_id = ?"
+		args = append(args, channelID)
+	}
+	stateQuery += " ORDER BY consecutive_failures DESC, channel_id"
+	resultQuery += " ORDER BY id DESC LIMIT ?"
+
+	stateRows, err := store.QueryContext(ctx, stateQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	channels := []ChannelProbeState{}
+	for stateRows.Next() {
+		var st ChannelProbeState
+		var disabled int
+		if err := stateRows.Scan(&st.ChannelID, &st.ChannelName, &st.Model, &st.ConsecutiveFailures, &st.LastSuccessAt,
+			&st.LastFailureAt, &st.LastErrorClass, &st.LastLatencyMs, &disabled, &st.DisabledAt, &st.UpdatedAt); err != nil {
+			stateRows.Close()
+			return nil, err
+		}
+		st.DisabledByProbe = disabled == 1
+		channels = append(channels, st)
+	}
+	stateRows.Close()
+
+	resultRows, err := store.QueryContext(ctx, resultQuery, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultRows.Close()
+	results := []ChannelProbeResult{}
+	for resultRows.Next() {
+		var r ChannelProbeResult
+		var success int
+		if err := resultRows.Scan(&r.ID, &r.ChannelID, &r.ChannelName, &r.Model, &success, &r.LatencyMs,
+			&r.ErrorClass, &r.Message, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Success = success == 1
+		results = append(results, r)
+	}
+
+	return map[string]interface{}{
+		"configured": s.Configured(),
+		"channels":   channels,
+		"results":    results,
+	}, resultRows.Err()
+}
+
+func ensureChannelProbeTables(ctx context.Context, db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS channel_probe_results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id INTEGER NOT NULL,
+			channel_name TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			success INTEGER NOT NULL DEFAULT 0,
+			latency_ms INTEGER NOT NULL DEFAULT 0,
+			error_class TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_channel_probe_results_channel ON channel_probe_results(channel_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS channel_probe_state (
+			channel_id INTEGER PRIMARY KEY,
+			channel_name TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			last_success_at INTEGER NOT NULL DEFAULT 0,
+			last_failure_at INTEGER NOT NULL DEFAULT 0,
+			last_error_class TEXT NOT NULL DEFAULT '',
+			last_latency_ms INTEGER NOT NULL DEFAULT 0,
+			disabled_by_probe INTEGER NOT NULL DEFAULT 0,
+			disabled_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadChannelProbeState(ctx context.Context, db *sql.DB, channelID int64) (ChannelProbeState, error) {
+	st := ChannelProbeState{ChannelID: channelID}
+	var disabled int
+	err := db.QueryRowContext(ctx, `
+		SELECT channel_name, model, consecutive_failures, last_success_at, last_failure_at, last_error_class,
+			last_latency_ms, disabled_by_probe, disabled_at, updated_at
+		FROM channel_probe_state WHERE channel_id = ?`, channelID).Scan(
+		&st.ChannelName, &st.Model, &st.ConsecutiveFailures, &st.LastSuccessAt, &st.LastFailureAt,
+		&st.LastErrorClass, &st.LastLatencyMs, &disabled, &st.DisabledAt, &st.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return st, nil
+	}
+	st.DisabledByProbe = disabled == 1
+	return st, err
+}
+
+func saveChannelProbeState(ctx context.Context, db *sql.DB, st ChannelProbeState) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO channel_probe_state (channel_id, channel_name, model, consecutive_failures, last_success_at,
+			last_failure_at, last_error_class, last_latency_ms, disabled_by_probe, disabled_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(channel_id) DO UPDATE SET
+			channel_name = excluded.channel_name,
+			model = excluded.model,
+			consecutive_failures = excluded.consecutive_failures,
+			last_success_at = excluded.last_success_at,
+			last_failure_at = excluded.last_failure_at,
+			last_error_class = excluded.last_error_class,
+			last_latency_ms = excluded.last_latency_ms,
+			disabled_by_probe = excluded.disabled_by_probe,
+			disabled_at = excluded.disabled_at,
+			updated_at = excluded.updated_at`,
+		st.ChannelID, st.ChannelName, st.Model, st.ConsecutiveFailures, st.LastSuccessAt, st.LastFailureAt,
+		st.LastErrorClass, st.LastLatencyMs, boolToInt(st.DisabledByProbe), st.DisabledAt, st.UpdatedAt)
+	return err
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestClassifyProbeError(t *testing.T) {
+	cases := []struct {
+		status int
+		msg    string
+		err    error
+		want   string
+	}{
+		{0, "", context.DeadlineExceeded, ProbeErrorTimeout},
+		{0, "", errors.New("dial tcp: connection refused"), ProbeErrorNetwork},
+		{http.StatusOK, "status code 401: Incorrect API key provided", nil, ProbeErrorAuth},
+		{http.StatusOK, "insufficient_quota: You exceeded your current quota", nil, ProbeErrorQuota},
+		{http.StatusTooManyRequests, "", nil, ProbeErrorRateLimit},
+		{http.StatusOK, "The model `gpt-x` does not exist", nil, ProbeErrorModelNotFound},
+		{http.StatusOK, "bad response status code 502, Bad Gateway", nil, ProbeErrorUpstream5xx},
+		{http.StatusOK, "something odd", nil, ProbeErrorUnknown},
+	}
+	for _, tc := range cases {
+		if got := classifyProbeError(tc.status, tc.msg, tc.err); got != tc.want {
+			t.Errorf("classifyProbeError(%d, %q, %v) = %s, want %s", tc.status, tc.msg, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestChannelProbeSettingsPartialUpdate(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	installSQLiteForTests(t)
+
+	svc := NewChannelProbeService()
+	ctx := context.Background()
+
+	enabled, threshold := true, 0
+	if _, err := svc.UpdateSettings(ctx, ChannelProbeSettingsInput{Enabled: &enabled, FailureThreshold: &threshold}); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+	got, err := svc.GetSettings(ctx)
+	if err != nil {
+		t.Fatalf("GetSettings failed: %v", err)
+	}
+	if !got.Enabled || got.FailureThreshold != 3 || got.IntervalMinutes != 30 {
+		t.Fatalf("unexpected settings after partial update: %+v", got)
+	}
+}
+
+func TestChannelProbeAutoDisableAndRecovery(t *testing.T) {
+	var healthy atomic.Bool
+	newapi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/channel/test/1" || r.URL.Query().Get("model") != "gpt-4o-mini" ||
+			r.Header.Get("Authorization") != "Bearer admin-key" || r.Header.Get("New-Api-User") != "1" {
+			t.Errorf("unexpected probe request: %s %v", r.URL, r.Header)
+		}
+		if healthy.Load() {
+			w.Write([]byte(`{"success":true,"message":"","time":0.25}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"message":"status code 401: Incorrect API key provided"}`))
+	}))
+	defer newapi.Close()
+
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("NEWAPI_BASEURL", newapi.URL)
+	t.Setenv("NEWAPI_API_KEY", "admin-key")
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT, status INTEGER, models TEXT, test_model TEXT)`)
+	db.MustExec(`CREATE TABLE abilities (channel_id INTEGER, enabled INTEGER)`)
+	db.MustExec(`INSERT INTO channels VALUES (1, 'openai', 1, 'gpt-4o,gpt-4o-mini', 'gpt-4o-mini')`)
+	db.MustExec(`INSERT INTO abilities VALUES (1, 1)`)
+	channelStatus := func() int {
+		var status int
+		db.Get(&status, `SELECT status FROM channels WHERE id = 1`)
+		return status
+	}
+
+	svc := NewChannelProbeService()
+	ctx := context.Background()
+	enabled, autoDisable, threshold := true, true, 2
+	if _, err := svc.UpdateSettings(ctx, ChannelProbeSettingsInput{Enabled: &enabled, AutoDisable: &autoDisable, FailureThreshold: &threshold}); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	probeState := func() ChannelProbeState {
+		list, err := svc.ListProbes(ctx, 1, 0)
+		if err != nil {
+			t.Fatalf("ListProbes: %v", err)
+		}
+		states := list["channels"].([]ChannelProbeState)
+		if len(states) != 1 {
+			t.Fatalf("expected one channel state, got %+v", states)
+		}
+		return states[0]
+	}
+
+	// Below the threshold the failure is only counted
+	summary, err := svc.RunProbes(ctx)
+	if err != nil {
+		t.Fatalf("RunProbes: %v", err)
+	}
+	if summary.Failed != 1 || len(summary.Disabled) != 0 || summary.Results[0].ErrorClass != ProbeErrorAuth || summary.Results[0].ID == 0 {
+		t.Fatalf("first failure: %+v", summary)
+	}
+	if st := probeState(); st.ConsecutiveFailures != 1 || st.DisabledByProbe || st.LastErrorClass != ProbeErrorAuth || channelStatus() != 1 {
+		t.Fatalf("state after first failure: %+v status=%d", st, channelStatus())
+	}
+
+	// Crossing the threshold disables the channel
+	summary, _ = svc.RunProbes(ctx)
+	if len(summary.Disabled) != 1 || summary.Disabled[0] != 1 || channelStatus() != channelStatusAutoDisabled {
+		t.Fatalf("second failure should auto-disable: %+v status=%d", summary, channelStatus())
+	}
+	if st := probeState(); st.ConsecutiveFailures != 2 || !st.DisabledByProbe || st.DisabledAt == 0 {
+		t.Fatalf("state after auto-disable: %+v", st)
+	}
+
+	// The operator re-enables it while it still fails: no second auto-disable
+	db.MustExec(`UPDATE channels SET status = 1 WHERE id = 1`)
+	summary, _ = svc.RunProbes(ctx)
+	if summary.Failed != 1 || len(summary.Disabled) != 0 || channelStatus() != 1 {
+		t.Fatalf("manually re-enabled channel must stay enabled: %+v status=%d", summary, channelStatus())
+	}
+	if st := probeState(); st.ConsecutiveFailures != 3 || !st.DisabledByProbe {
+		t.Fatalf("DisabledByProbe should stick until a success: %+v", st)
+	}
+
+	// A success resets the streak and re-arms auto-disable
+	healthy.Store(true)
+	summary, _ = svc.RunProbes(ctx)
+	if summary.Success != 1 || summary.Results[0].LatencyMs != 250 {
+		t.Fatalf("recovery probe: %+v", summary)
+	}
+	if st := probeState(); st.ConsecutiveFailures != 0 || st.DisabledByProbe || st.LastSuccessAt == 0 {
+		t.Fatalf("state after recovery: %+v", st)
+	}
+	healthy.Store(false)
+	svc.RunProbes(ctx)
+	if summary, _ = svc.RunProbes(ctx); len(summary.Disabled) != 1 || channelStatus() != channelStatusAutoDisabled {
+		t.Fatalf("auto-disable should re-arm after recovery: %+v status=%d", summary, channelStatus())
+	}
+}
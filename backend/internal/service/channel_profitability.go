@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+// maxLossRoutes caps the loss-making (channel, model) routes listed
+const maxLossRoutes = 50
+
+// profitAgg is a marginAgg whose revenue is valued at the price users
+// actually paid for their quota (realized) instead of the list price
+type profitAgg struct {
+	marginAgg
+}
+
+func (a *profitAgg) toMap(realizedPerUSD float64) map[string]interface{} {
+	item := a.marginAgg.toMap()
+	revenue := a.PricedRevenue * realizedPerUSD
+	margin := revenue - a.Cost
+	var marginRate interface{}
+	if revenue > 0 {
+		marginRate = roundRate(margin / revenue * 100)
+	}
+	item["list_revenue_usd"] = item["revenue_usd"]
+	item["revenue_usd"] = round4dp(float64(a.Quota) / util.TokensPerUSD * realizedPerUSD)
+	item["priced_revenue"] = round4dp(revenue)
+	item["margin_usd"] = round4dp(margin)
+	item["margin_rate"] = marginRate
+	item["loss_making"] = a.Cost > 0 && margin < 0
+	return item
+}
+
+// topUpRevenue sums successful top-ups created in [startTs, endTs]
+func (s *ChannelMarginService) topUpRevenue(startTs, endTs int64) (map[string]interface{}, error) {
+	return s.db.QueryOneWithTimeout(30*time.Second, s.db.RebindQuery(fmt.Sprintf(`
+		SELECT COUNT(*) as orders,
+			COALESCE(SUM(money), 0) as money,
+			COALESCE(SUM(amount), 0) as amount
+		FROM top_ups
+		WHERE create_time >= ? AND create_time <= ? AND %s`, successStatusCondition())), startTs, endTs)
+}
+
+// GetProfitability values the quota consumed per channel and per model in
+// the period at the price users actually paid for it — successful top-up
+// money in the period (converted with topup_currency_per_usd) divided by the
+// USD of quota those top-ups bought — and compares it with the upstream cost.
+// Without top-ups in the period the list price (quota / 500000) is used.
+// Loss-making (channel, model) routes are listed separately, worst first.
+func (s *ChannelMarginService) GetProfitability(ctx context.Context, p TopUpTrendsParams, noCache bool) (map[string]interface{}, error) {
+	_, startTs, endTs := resolveTrendsRange(p)
+	cm := cache.Get()
+	cacheKey := cache.Key("channel_profit:%d:%d", startTs, endTs)
+	if !noCache {
+		var cached map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	table, err := s.GetCostTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	topUps, err := s.topUpRevenue(startTs, endTs)
+	if err != nil {
+		return nil, err
+	}
+	fx := table.TopUpCurrencyPerUSD
+	if fx <= 0 {
+		fx = 1
+	}
+	money, amount := toFloat64(topUps["money"]), toInt64(topUps["amount"])
+	moneyUSD := money / fx
+	realizedPerUSD, basis := 1.0, "list"
+	if amount > 0 && moneyUSD > 0 {
+		realizedPerUSD, basis = moneyUSD/float64(amount), "top_ups"
+	}
+
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(`
+		SELECT `+costUsageColumns+`
+		FROM logs
+		WHERE created_at >= ? AND created_at <= ? AND type = `+ltConsume()+`
+		GROUP BY channel_id, model_name`), startTs, endTs)
+	if err != nil {
+		return nil, err
+	}
+	names := map[int64]string{}
+	if chRows, err := s.db.Query(`SELECT id, name FROM channels`); err == nil {
+		for _, r := range chRows {
+			names[toInt64(r["id"])] = toString(r["name"])
+		}
+	}
+
+	pricer := newCostPricer(table)
+	byChannel := map[int64]*profitAgg{}
+	byModel := map[string]*profitAgg{}
+	total := &profitAgg{}
+	routes := []map[string]interface{}{}
+	for _, r := range rows {
+		channelID, model := toInt64(r["channel_id"]), toString(r["model_name"])
+		if byChannel[channelID] == nil {
+			byChannel[channelID] = &profitAgg{}
+		}
+		if byModel[model] == nil {
+			byModel[model] = &profitAgg{}
+		}
+		route := &profitAgg{}
+		for _, agg := range []*profitAgg{byChannel[channelID], byModel[model], total, route} {
+			pricer.add(&agg.marginAgg, r)
+		}
+		if item := route.toMap(realizedPerUSD); item["loss_making"] == true {
+			item["channel_id"] = channelID
+			item["channel_name"] = names[channelID]
+			item["model_name"] = model
+			routes = append(routes, item)
+		}
+	}
+
+	channels := make([]map[string]interface{}, 0, len(byChannel))
+	for id, agg := range byChannel {
+		item := agg.toMap(realizedPerUSD)
+		item["channel_id"] = id
+		item["channel_name"] = names[id]
+		channels = append(channels, item)
+	}
+	sortByRevenue(channels)
+	modelItems := make([]map[string]interface{}, 0, len(byModel))
+	for name, agg := range byModel {
+		item := agg.toMap(realizedPerUSD)
+		item["model_name"] = name
+		modelItems = append(modelItems, item)
+	}
+	sortByRevenue(modelItems)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return toFloat64(routes[i]["margin_usd"]) < toFloat64(routes[j]["margin_usd"])
+	})
+	if len(routes) > maxLossRoutes {
+		routes = routes[:maxLossRoutes]
+	}
+
+	result := map[string]interface{}{
+		"start_time": startTs,
+		"end_time":   endTs,
+		"top_ups": map[string]interface{}{
+			"orders":                 toInt64(topUps["orders"]),
+			"money":                  round4dp(money),
+			"money_usd":              round4dp(moneyUSD),
+			"amount":                 amount, // 充值购买的额度（美元计）
+			"topup_currency_per_usd": fx,
+		},
+		"revenue_basis":         basis, // top_ups：按实收充值折算；list：本期无充值，按额度标价
+		"realized_per_usd":      round4dp(realizedPerUSD),
+		"summary":               total.toMap(realizedPerUSD),
+		"channels":              channels,
+		"models":                modelItems,
+		"loss_routes":           routes,
+		"cost_table_updated_at": table.UpdatedAt,
+	}
+	cm.Set(cacheKey, result, channelMarginCacheTTL)
+	return result, nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// RoutingChannel is one channel serving a (group, model) pair
+type RoutingChannel struct {
+	ChannelID     int64   `json:"channel_id"`
+	ChannelName   string  `json:"channel_name"`
+	ChannelType   int     `json:"channel_type"`
+	ChannelStatus int     `json:"channel_status"`
+	Enabled       bool    `json:"enabled"` // abilities.enabled，relay 实际依据的开关
+	Priority      int64   `json:"priority"`
+	Weight        int64   `json:"weight"`
+	TopTier       bool    `json:"top_tier"`       // 属于当前可用的最高优先级梯队
+	ExpectedShare float64 `json:"expected_share"` // 按权重在最高梯队内的理论分流占比 (%)
+	Requests      int64   `json:"requests"`
+	Failures      int64   `json:"failures"`
+	SuccessRate   float64 `json:"success_rate"`
+	TrafficShare  float64 `json:"traffic_share"` // 该模型近期请求中由此渠道承接的占比 (%)
+}
+
+// RoutingGroup lists the channels of one group for a model, in routing order
+type RoutingGroup struct {
+	Group    string           `json:"group"`
+	Channels []RoutingChannel `json:"channels"`
+}
+
+// ModelRouting is the routing view of one model
+type ModelRouting struct {
+	Model       string         `json:"model"`
+	Requests    int64          `json:"requests"`
+	SuccessRate float64        `json:"success_rate"`
+	Groups      []RoutingGroup `json:"groups"`
+}
+
+// ChannelRoutingQuery filters GetModelRouting
+type ChannelRoutingQuery struct {
+	Model string // exact model name; "" = all models
+	Group string // "" = all groups
+	Hours int    // traffic window
+}
+
+// ChannelRoutingService explains how NewAPI routes a model: the abilities
+// rows per group (priority / weight / enabled) next to the traffic each
+// channel actually took in the recent window.
+type ChannelRoutingService struct {
+	db    *database.Manager
+	logDB *database.Manager
+	cm    *cache.Manager
+}
+
+// NewChannelRoutingServiceFor creates a ChannelRoutingService bound to a registered New API instance ("" = primary)
+func NewChannelRoutingServiceFor(instance string) *ChannelRoutingService {
+	db, logDB := database.ForInstance(instance)
+	return &ChannelRoutingService{db: db, logDB: logDB, cm: cache.ForInstance(instance)}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ChannelRoutingService) WithContext(ctx context.Context) *ChannelRoutingService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func (s *ChannelRoutingService) groupCol() string {
+	if s.db.IsPG {
+		return `"group"`
+	}
+	return "`group`"
+}
+
+// GetModelRouting returns, per model and group, the channels that can serve
+// it ordered the way the relay picks them (priority tier, then weight).
+//
+// NewAPI selects among enabled abilities of the highest priority for the
+// user's group, weighted by weight; lower tiers are only used on retry. So
+// expected_share is the weight split inside that top tier, and traffic_share
+// is what the logs show actually happened.
+func (s *ChannelRoutingService) GetModelRouting(q ChannelRoutingQuery, noCache bool) (map[string]interface{}, error) {
+	cacheKey := cache.Key("channel_routing:%s:%s:%d", q.Model, q.Group, q.Hours)
+	if !noCache {
+		var cached map[string]interface{}
+		if found, _ := s.cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	groupCol := s.groupCol()
+	where := []string{"1=1"}
+	var args []interface{}
+	if q.Model != "" {
+		where = append(where, "a.model = ?")
+		args = append(args, q.Model)
+	}
+	if q.Group != "" {
+		where = append(where, fmt.Sprintf("COALESCE(NULLIF(a.%s, ''), 'default') = ?", groupCol))
+		args = append(args, q.Group)
+	}
+	abilityRows, err := s.db.QueryWithTimeout(15*time.Second, s.db.RebindQuery(fmt.Sprintf(`
+		SELECT a.model, COALESCE(NULLIF(a.%s, ''), 'default') as group_name, a.channel_id,
+			a.enabled, COALESCE(a.priority, 0) as priority, COALESCE(a.weight, 0) as weight,
+			COALESCE(c.name, '') as channel_name, COALESCE(c.type, 0) as channel_type, COALESCE(c.status, 0) as channel_status
+		FROM abilities a
+		LEFT JOIN channels c ON c.id = a.channel_id
+		WHERE %s`, groupCol, strings.Join(where, " AND "))), args...)
+	if err != nil {
+		return nil, fmt.Errorf("abilities query failed: %w", err)
+	}
+
+	since := time.Now().Unix() - int64(q.Hours)*3600
+	trafficQuery := `
+		SELECT model_name, channel_id, COUNT(*) as requests,
+			SUM(CASE WHEN type = ` + ltError() + ` THEN 1 ELSE 0 END) as failures
+		FROM logs
+		WHERE created_at >= ? AND type IN (` + ltRequests() + `)`
+	trafficArgs := []interface{}{since}
+	if q.Model != "" {
+		trafficQuery += ` AND model_name = ?`
+		trafficArgs = append(trafficArgs, q.Model)
+	}
+	trafficQuery += ` GROUP BY model_name, channel_id`
+	trafficRows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(trafficQuery), trafficArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("routing traffic query failed: %w", err)
+	}
+
+	models := buildModelRouting(abilityRows, trafficRows)
+	result := map[string]interface{}{
+		"hours":  q.Hours,
+		"models": models,
+		"total":  len(models),
+	}
+	s.cm.Set(cacheKey, result, 2*time.Minute)
+	return result, nil
+}
+
+// buildModelRouting joins abilities with per-(model, channel) traffic
+func buildModelRouting(abilityRows, trafficRows []map[string]interface{}) []ModelRouting {
+	type traffic struct{ requests, failures int64 }
+	trafficByKey := map[string]traffic{}
+	modelTotals := map[string]traffic{}
+	for _, r := range trafficRows {
+		model := toString(r["model_name"])
+		t := traffic{requests: toInt64(r["requests"]), failures: toInt64(r["failures"])}
+		trafficByKey[fmt.Sprintf("%s|%d", model, toInt64(r["channel_id"]))] = t
+		mt := modelTotals[model]
+		mt.requests += t.requests
+		mt.failures += t.failures
+		modelTotals[model] = mt
+	}
+
+	groupsByModel := map[string]map[string][]RoutingChannel{}
+	for _, r := range abilityRows {
+		model := toString(r["model"])
+		group := toString(r["group_name"])
+		ch := RoutingChannel{
+			ChannelID:     toInt64(r["channel_id"]),
+			ChannelName:   toString(r["channel_name"]),
+			ChannelType:   int(toInt64(r["channel_type"])),
+			ChannelStatus: int(toInt64(r["channel_status"])),
+			Enabled:       toInt64(r["enabled"]) == 1 || r["enabled"] == true,
+			Priority:      toInt64(r["priority"]),
+			Weight:        toInt64(r["weight"]),
+		}
+		t := trafficByKey[fmt.Sprintf("%s|%d", model, ch.ChannelID)]
+		ch.Requests, ch.Failures = t.requests, t.failures
+		if t.requests > 0 {
+			ch.SuccessRate = roundRate(float64(t.requests-t.failures) / float64(t.requests) * 100)
+		}
+		if total := modelTotals[model].requests; total > 0 {
+			ch.TrafficShare = roundRate(float64(t.requests) / float64(total) * 100)
+		}
+		if groupsByModel[model] == nil {
+			groupsByModel[model] = map[string][]RoutingChannel{}
+		}
+		groupsByModel[model][group] = append(groupsByModel[model][group], ch)
+	}
+
+	models := make([]ModelRouting, 0, len(groupsByModel))
+	for model, groups := range groupsByModel {
+		mr := ModelRouting{Model: model, Requests: modelTotals[model].requests, Groups: make([]RoutingGroup, 0, len(groups))}
+		if mr.Requests > 0 {
+			mr.SuccessRate = roundRate(float64(mr.Requests-modelTotals[model].failures) / float64(mr.Requests) * 100)
+		}
+		for group, channels := range groups {
+			rankRoutingChannels(channels)
+			mr.Groups = append(mr.Groups, RoutingGroup{Group: group, Channels: channels})
+		}
+		sort.Slice(mr.Groups, func(i, j int) bool { return mr.Groups[i].Group < mr.Groups[j].Group })
+		models = append(models, mr)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Requests != models[j].Requests {
+			return models[i].Requests > models[j].Requests
+		}
+		return models[i].Model < models[j].Model
+	})
+	return models
+}
+
+// rankRoutingChannels sorts channels into routing order and marks the top
+// enabled priority tier with its weight split
+func rankRoutingChannels(channels []RoutingChannel) {
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Enabled != channels[j].Enabled {
+			return channels[i].Enabled
+		}
+		if channels[i].Priority != channels[j].Priority {
+			return channels[i].Priority > channels[j].Priority
+		}
+		if channels[i].Weight != channels[j].Weight {
+			return channels[i].Weight > channels[j].Weight
+		}
+		return channels[i].ChannelID < channels[j].ChannelID
+	})
+	if len(channels) == 0 || !channels[0].Enabled {
+		return
+	}
+
+	top := channels[0].Priority
+	var tier []int
+	var weightSum int64
+	for i, ch := range channels {
+		if ch.Enabled && ch.Priority == top {
+			tier = append(tier, i)
+			weightSum += ch.Weight
+		}
+	}
+	for _, i := range tier {
+		channels[i].TopTier = true
+		if weightSum > 0 {
+			channels[i].ExpectedShare = roundRate(float64(channels[i].Weight) / float64(weightSum) * 100)
+		} else {
+			channels[i].ExpectedShare = roundRate(100 / float64(len(tier)))
+		}
+	}
+}
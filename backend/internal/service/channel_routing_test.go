@@ -0,0 +1,73 @@
+package service
+
+import "testing"
+
+func TestBuildModelRoutingTiersAndShares(t *testing.T) {
+	abilities := []map[string]interface{}{
+		{"model": "gpt-4o", "group_name": "default", "channel_id": int64(1), "enabled": int64(1), "priority": int64(10), "weight": int64(3), "channel_name": "a", "channel_status": int64(1)},
+		{"model": "gpt-4o", "group_name": "default", "channel_id": int64(2), "enabled": int64(1), "priority": int64(10), "weight": int64(1), "channel_name": "b", "channel_status": int64(1)},
+		{"model": "gpt-4o", "group_name": "default", "channel_id": int64(3), "enabled": int64(1), "priority": int64(0), "weight": int64(5), "channel_name": "fallback", "channel_status": int64(1)},
+		{"model": "gpt-4o", "group_name": "default", "channel_id": int64(4), "enabled": int64(0), "priority": int64(99), "weight": int64(9), "channel_name": "off", "channel_status": int64(3)},
+	}
+	traffic := []map[string]interface{}{
+		{"model_name": "gpt-4o", "channel_id": int64(1), "requests": int64(60), "failures": int64(6)},
+		{"model_name": "gpt-4o", "channel_id": int64(2), "requests": int64(30), "failures": int64(0)},
+		{"model_name": "gpt-4o", "channel_id": int64(3), "requests": int64(10), "failures": int64(5)},
+	}
+
+	models := buildModelRouting(abilities, traffic)
+	if len(models) != 1 || models[0].Requests != 100 || models[0].SuccessRate != 89 {
+		t.Fatalf("unexpected model summary: %+v", models)
+	}
+	chs := models[0].Groups[0].Channels
+	order := []int64{1, 2, 3, 4}
+	for i, id := range order {
+		if chs[i].ChannelID != id {
+			t.Fatalf("routing order = %+v, want %v", chs, order)
+		}
+	}
+	if !chs[0].TopTier || chs[0].ExpectedShare != 75 || chs[1].ExpectedShare != 25 {
+		t.Fatalf("top tier weight split wrong: %+v %+v", chs[0], chs[1])
+	}
+	if chs[2].TopTier || chs[3].TopTier {
+		t.Fatalf("lower priority / disabled channels must not be top tier: %+v", chs[2:])
+	}
+	if chs[0].SuccessRate != 90 || chs[0].TrafficShare != 60 || chs[2].SuccessRate != 50 {
+		t.Fatalf("traffic stats wrong: %+v", chs)
+	}
+}
+
+func TestBuildGroupChannelAuditFlagsOutOfGroupHits(t *testing.T) {
+	abilities := []map[string]interface{}{
+		{"group_name": "default", "model": "gpt-4o-mini", "channel_id": int64(1)},
+		{"group_name": "vip", "model": "gpt-4o", "channel_id": int64(2)},
+		{"group_name": "vip", "model": "gpt-4o-mini", "channel_id": int64(1)},
+	}
+	traffic := []map[string]interface{}{
+		{"group_name": "default", "model_name": "gpt-4o-mini", "channel_id": int64(1), "requests": int64(50), "users": int64(5)},
+		{"group_name": "default", "model_name": "gpt-4o", "channel_id": int64(2), "requests": int64(7), "users": int64(1)},
+		{"group_name": "vip", "model_name": "gpt-4o", "channel_id": int64(3), "requests": int64(3), "users": int64(1)},
+		{"group_name": "vip", "model_name": "gpt-4o", "channel_id": int64(2), "requests": int64(20), "users": int64(2)},
+	}
+
+	audit := buildGroupChannelAudit(abilities, traffic, map[int64]string{2: "premium", 3: "legacy"}, "")
+	if len(audit.Groups) != 2 || len(audit.Violations) != 2 {
+		t.Fatalf("unexpected audit: %+v", audit)
+	}
+	v := audit.Violations[0]
+	if v.Group != "default" || v.Model != "gpt-4o" || v.Kind != GroupHitModelOutside || v.ChannelName != "premium" {
+		t.Fatalf("expected default/gpt-4o model_outside_group first, got %+v", v)
+	}
+	if v := audit.Violations[1]; v.Group != "vip" || v.ChannelID != 3 || v.Kind != GroupHitChannelOutside {
+		t.Fatalf("expected vip channel 3 channel_outside_group, got %+v", v)
+	}
+	vip := audit.Groups[1]
+	if vip.Requests != 23 || vip.OutOfGroupRequests != 3 || vip.Models != 2 || vip.Channels != 2 {
+		t.Fatalf("vip summary wrong: %+v", vip)
+	}
+
+	only := buildGroupChannelAudit(abilities, traffic, nil, "vip")
+	if len(only.Groups) != 1 || len(only.Violations) != 1 {
+		t.Fatalf("group filter not applied: %+v", only)
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// configVersionField is the version number stored with the Redis-backed
+// configs (ai_ban, auto_group). Every operator save increments it; a client
+// echoes the version it loaded so a save based on stale data is rejected.
+const configVersionField = "version"
+
+var ErrConfigVersionConflict = errors.New("config modified by another operator")
+
+// configWriteMu serialises the read-check-write of versioned configs
+var configWriteMu sync.Mutex
+
+// ConfigConflictError reports a stale write and the version now stored
+type ConfigConflictError struct {
+	Expected int64
+	Current  int64
+}
+
+func (e *ConfigConflictError) Error() string {
+	return fmt.Sprintf("%s: expected version %d, current %d", ErrConfigVersionConflict, e.Expected, e.Current)
+}
+
+func (e *ConfigConflictError) Unwrap() error { return ErrConfigVersionConflict }
+
+// applyConfigVersion checks the version carried in updates (if any) against
+// config, removes it from updates and bumps the stored version. Saves without
+// a version (older clients, internal writers) are accepted unchecked.
+func applyConfigVersion(config, updates map[string]interface{}) error {
+	current := toInt64(config[configVersionField])
+	if v, ok := updates[configVersionField]; ok {
+		delete(updates, configVersionField)
+		if expected := toInt64(v); v != nil && expected != current {
+			return &ConfigConflictError{Expected: expected, Current: current}
+		}
+	}
+	config[configVersionField] = current + 1
+	return nil
+}
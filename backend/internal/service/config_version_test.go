@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// TestConfigSavesRejectStaleVersion 模拟两个管理员基于同一版本同时保存：
+// 后到的一方必须收到冲突与当前版本，而不是静默覆盖。
+func TestConfigSavesRejectStaleVersion(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	installSQLiteForTests(t)
+	t.Cleanup(func() {
+		cache.Get().Delete("ai_ban:config")
+		cache.Get().Delete("auto_group:config")
+	})
+
+	ban := NewAIAutoBanService()
+	loaded := toInt64(ban.GetConfig()["version"])
+	if err := ban.SaveConfig(map[string]interface{}{"enabled": true, "version": float64(loaded)}); err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	err := ban.SaveConfig(map[string]interface{}{"enabled": false, "version": float64(loaded)})
+	var conflict *ConfigConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrConfigVersionConflict) {
+		t.Fatalf("stale save should conflict, got %v", err)
+	}
+	if conflict.Current != loaded+1 {
+		t.Errorf("conflict should report version %d, got %d", loaded+1, conflict.Current)
+	}
+	if cfg := ban.GetConfig(); cfg["enabled"] != true {
+		t.Errorf("rejected save must not be applied, got enabled=%v", cfg["enabled"])
+	}
+	if err := ban.SaveConfig(map[string]interface{}{"dry_run": false}); err != nil {
+		t.Fatalf("save without version should be accepted: %v", err)
+	}
+	if got := toInt64(ban.GetConfig()["version"]); got != loaded+2 {
+		t.Errorf("every save should bump the version, got %d", got)
+	}
+
+	group := NewAutoGroupService()
+	loaded = toInt64(group.GetConfig()["version"])
+	if err := group.writeConfig(map[string]interface{}{"last_scan_time": 1}, false); err != nil {
+		t.Fatalf("scan bookkeeping: %v", err)
+	}
+	if err := group.SaveConfig(map[string]interface{}{"enabled": true, "version": float64(loaded)}); err != nil {
+		t.Fatalf("scan bookkeeping must not invalidate an open form: %v", err)
+	}
+	if err := group.SaveConfig(map[string]interface{}{"enabled": false, "version": float64(loaded)}); !errors.Is(err, ErrConfigVersionConflict) {
+		t.Fatalf("stale auto group save should conflict, got %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// Cost attribution dimensions
+const (
+	CostByUser    = "user"
+	CostByGroup   = "group"
+	CostByChannel = "channel"
+)
+
+const costAttributionCacheTTL = 5 * time.Minute
+
+var ErrInvalidCostQuery = errors.New("invalid cost query")
+
+// CostAttributionService prices consumption with the upstream cost table
+// (see ChannelMarginService) and attributes the money spent to users, groups
+// and channels
+type CostAttributionService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewCostAttributionService creates a new CostAttributionService
+func NewCostAttributionService() *CostAttributionService {
+	return &CostAttributionService{db: database.GetRead(), logDB: database.GetReadLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *CostAttributionService) WithContext(ctx context.Context) *CostAttributionService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func validCostDimension(by string) error {
+	switch by {
+	case CostByUser, CostByGroup, CostByChannel:
+		return nil
+	}
+	return fmt.Errorf("%w: by 只能是 user、group 或 channel", ErrInvalidCostQuery)
+}
+
+// groupColFor quotes the reserved "group" column for the database of m
+func groupColFor(m *database.Manager) string {
+	if m.IsPG {
+		return `"group"`
+	}
+	return "`group`"
+}
+
+// costPricer prices (channel, model) usage with the cost table
+type costPricer struct {
+	lookup      *costLookup
+	multipliers map[int64]float64
+}
+
+func newCostPricer(table ChannelCostTable) *costPricer {
+	p := &costPricer{lookup: newCostLookup(table.Models), multipliers: make(map[int64]float64, len(table.Multipliers))}
+	for _, m := range table.Multipliers {
+		p.multipliers[m.ChannelID] = m.Multiplier
+	}
+	return p
+}
+
+// add prices one usage row and accumulates it into agg
+func (p *costPricer) add(agg *marginAgg, r map[string]interface{}) {
+	requests, quota := toInt64(r["requests"]), toInt64(r["quota"])
+	prompt, completion := toInt64(r["prompt_tokens"]), toInt64(r["completion_tokens"])
+	cost, priced := 0.0, false
+	if entry, ok := p.lookup.find(toString(r["model_name"])); ok {
+		priced = true
+		cost = upstreamCost(entry, requests, prompt, completion)
+		if mult, ok := p.multipliers[toInt64(r["channel_id"])]; ok {
+			cost *= mult
+		}
+	}
+	agg.add(requests, quota, prompt, completion, cost, priced)
+}
+
+const costUsageColumns = `channel_id, model_name,
+			COUNT(*) as requests,
+			COALESCE(SUM(quota), 0) as quota,
+			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) as completion_tokens`
+
+// userGroups maps user ids to their current group ("" becomes "default")
+func (s *CostAttributionService) userGroups(userIDs []int64) (map[int64]string, error) {
+	groups := make(map[int64]string, len(userIDs))
+	const chunk = 500
+	for i := 0; i < len(userIDs); i += chunk {
+		in, args := inClause(userIDs[i:min(i+chunk, len(userIDs))])
+		rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(
+			`SELECT id, COALESCE(%s, '') as group_name FROM users WHERE id IN (%s)`, groupColFor(s.db), in)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			group := toString(r["group_name"])
+			if group == "" {
+				group = "default"
+			}
+			groups[toInt64(r["id"])] = group
+		}
+	}
+	return groups, nil
+}
+
+// GetCosts returns revenue, upstream cost and margin in USD per user, group
+// or channel for the last `days` days, most expensive first
+func (s *CostAttributionService) GetCosts(ctx context.Context, by string, days, limit int, noCache bool) (map[string]interface{}, error) {
+	if err := validCostDimension(by); err != nil {
+		return nil, err
+	}
+	cm := cache.Get()
+	cacheKey := cache.Key("cost_attribution:%s:%d:%d", by, days, limit)
+	if !noCache {
+		var cached map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	table, err := NewChannelMarginService().GetCostTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pricer := newCostPricer(table)
+	start := time.Now().AddDate(0, 0, -days).Unix()
+
+	// 按分组统计时优先使用日志的 group 字段，否则按用户当前分组归集
+	dimCol, source := "user_id", ""
+	if by == CostByChannel {
+		dimCol = "channel_id"
+	}
+	if by == CostByGroup {
+		source = "users"
+		if s.logDB.ColumnExists("logs", "group") {
+			dimCol, source = "COALESCE("+groupColFor(s.logDB)+", '')", "logs"
+		}
+	}
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT %s AS dim, %s
+		FROM logs
+		WHERE created_at >= ? AND type = `+ltConsume()+`
+		GROUP BY %s, channel_id, model_name`, dimCol, costUsageColumns, dimCol)), start)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupOf map[int64]string
+	if by == CostByGroup && source == "users" {
+		seen := map[int64]bool{}
+		var ids []int64
+		for _, r := range rows {
+			if id := toInt64(r["dim"]); !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if groupOf, err = s.userGroups(ids); err != nil {
+			return nil, err
+		}
+	}
+
+	aggs := map[string]*marginAgg{}
+	total := &marginAgg{}
+	for _, r := range rows {
+		key := toString(r["dim"])
+		switch {
+		case groupOf != nil:
+			if key = groupOf[toInt64(r["dim"])]; key == "" {
+				key = "default"
+			}
+		case by == CostByGroup && key == "":
+			key = "default"
+		}
+		if aggs[key] == nil {
+			aggs[key] = &marginAgg{}
+		}
+		pricer.add(aggs[key], r)
+		pricer.add(total, r)
+	}
+
+	items := make([]map[string]interface{}, 0, len(aggs))
+	for key, agg := range aggs {
+		item := agg.toMap()
+		switch by {
+		case CostByUser:
+			item["user_id"] = toInt64(key)
+		case CostByChannel:
+			item["channel_id"] = toInt64(key)
+		default:
+			item["group"] = key
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		ci, cj := toFloat64(items[i]["cost_usd"]), toFloat64(items[j]["cost_usd"])
+		if ci != cj {
+			return ci > cj
+		}
+		return toFloat64(items[i]["revenue_usd"]) > toFloat64(items[j]["revenue_usd"])
+	})
+	truncated := limit > 0 && len(items) > limit
+	if truncated {
+		items = items[:limit]
+	}
+	s.attachNames(by, items)
+
+	result := map[string]interface{}{
+		"by":                    by,
+		"days":                  days,
+		"summary":               total.toMap(),
+		"items":                 items,
+		"truncated":             truncated,
+		"cost_table_updated_at": table.UpdatedAt,
+	}
+	if source != "" {
+		result["source"] = source
+	}
+	cm.Set(cacheKey, result, costAttributionCacheTTL)
+	return result, nil
+}
+
+// attachNames adds usernames / channel names to the (already limited) items
+func (s *CostAttributionService) attachNames(by string, items []map[string]interface{}) {
+	if len(items) == 0 || by == CostByGroup {
+		return
+	}
+	idKey, table, nameCol, nameKey := "user_id", "users", "username", "username"
+	if by == CostByChannel {
+		idKey, table, nameCol, nameKey = "channel_id", "channels", "name", "channel_name"
+	}
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, toInt64(item[idKey]))
+	}
+	in, args := inClause(ids)
+	rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(`SELECT id, %s AS name FROM %s WHERE id IN (%s)`, nameCol, table, in)), args...)
+	if err != nil {
+		return
+	}
+	names := make(map[int64]string, len(rows))
+	for _, r := range rows {
+		names[toInt64(r["id"])] = toString(r["name"])
+	}
+	for _, item := range items {
+		item[nameKey] = names[toInt64(item[idKey])]
+	}
+}
+
+// GetCostTrend returns daily revenue, upstream cost and margin in USD for the
+// last `days` days (reporting timezone), optionally for a single user, group
+// or channel
+func (s *CostAttributionService) GetCostTrend(ctx context.Context, by, id string, days int, noCache bool) (map[string]interface{}, error) {
+	if by != "" {
+		if err := validCostDimension(by); err != nil {
+			return nil, err
+		}
+		if id == "" {
+			return nil, fmt.Errorf("%w: 按 %s 查询趋势时需指定 id", ErrInvalidCostQuery, by)
+		}
+		if by != CostByGroup && toInt64(id) <= 0 {
+			return nil, fmt.Errorf("%w: id 必须是正整数", ErrInvalidCostQuery)
+		}
+	}
+	cm := cache.Get()
+	cacheKey := cache.Key("cost_attribution:trend:%s:%s:%d", by, id, days)
+	if !noCache {
+		var cached map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	table, err := NewChannelMarginService().GetCostTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pricer := newCostPricer(table)
+
+	loc := ReportLocation()
+	now := time.Now().In(loc)
+	first := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -(days - 1))
+	_, offset := first.Zone()
+	dayExpr := fmt.Sprintf("created_at - ((created_at + %d) %% 86400)", offset)
+
+	// filters is one or more (where, args) pairs whose rows are summed
+	type filter struct {
+		where string
+		args  []interface{}
+	}
+	filters := []filter{{}}
+	switch by {
+	case CostByUser:
+		filters = []filter{{" AND user_id = ?", []interface{}{toInt64(id)}}}
+	case CostByChannel:
+		filters = []filter{{" AND channel_id = ?", []interface{}{toInt64(id)}}}
+	case CostByGroup:
+		if s.logDB.ColumnExists("logs", "group") {
+			filters = []filter{{" AND COALESCE(NULLIF(" + groupColFor(s.logDB) + ", ''), 'default') = ?", []interface{}{id}}}
+			break
+		}
+		// 日志可能在独立库，不能 JOIN users：按用户当前分组分批过滤
+		userRows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(
+			`SELECT id FROM users WHERE COALESCE(NULLIF(%s, ''), 'default') = ?`, groupColFor(s.db))), id)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, 0, len(userRows))
+		for _, r := range userRows {
+			ids = append(ids, toInt64(r["id"]))
+		}
+		filters = filters[:0]
+		const chunk = 500
+		for i := 0; i < len(ids); i += chunk {
+			in, args := inClause(ids[i:min(i+chunk, len(ids))])
+			filters = append(filters, filter{" AND user_id IN (" + in + ")", args})
+		}
+	}
+
+	byDay := map[int64]*marginAgg{}
+	total := &marginAgg{}
+	for _, f := range filters {
+		rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+			SELECT %s AS day, %s
+			FROM logs
+			WHERE created_at >= ? AND type = `+ltConsume()+f.where+`
+			GROUP BY %s, channel_id, model_name`, dayExpr, costUsageColumns, dayExpr)),
+			append([]interface{}{first.Unix()}, f.args...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			day := toInt64(r["day"])
+			if byDay[day] == nil {
+				byDay[day] = &marginAgg{}
+			}
+			pricer.add(byDay[day], r)
+			pricer.add(total, r)
+		}
+	}
+
+	points := make([]map[string]interface{}, 0, days)
+	for d := 0; d < days; d++ {
+		day := first.AddDate(0, 0, d)
+		agg := byDay[first.Unix()+int64(d)*86400] // same fixed-offset buckets as dayExpr
+		if agg == nil {
+			agg = &marginAgg{}
+		}
+		point := agg.toMap()
+		point["date"] = day.Format("2006-01-02")
+		points = append(points, point)
+	}
+
+	result := map[string]interface{}{
+		"by":                    by,
+		"id":                    id,
+		"days":                  days,
+		"summary":               total.toMap(),
+		"points":                points,
+		"cost_table_updated_at": table.UpdatedAt,
+	}
+	cm.Set(cacheKey, result, costAttributionCacheTTL)
+	return result, nil
+}
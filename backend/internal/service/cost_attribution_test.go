@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestCostAttribution(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { cache.Get().DeleteByPrefix(cache.Key("cost_attribution:")) })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, `group` TEXT);" + `
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, channel_id INTEGER, model_name TEXT,
+			type INTEGER, quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, created_at INTEGER);
+		INSERT INTO users VALUES (1, 'alice', 'vip'), (2, 'bob', '');
+		INSERT INTO channels VALUES (1, 'main'), (2, 'discount');`); err != nil {
+		t.Fatal(err)
+	}
+	_, dayStart, _ := budgetToday(time.Now())
+	now := max(time.Now().Unix(), dayStart.Unix()+60)
+	for _, r := range [][]interface{}{
+		// alice: $5 charged on channel 1, cost 1M*2 + 0.25M*8 = $4
+		{1, 1, "gpt-4o", 2, 2500000, 1000000, 250000, now - 60},
+		// bob: same usage on the half-price channel 2, cost $2
+		{2, 2, "gpt-4o", 2, 2500000, 1000000, 250000, now - 60},
+		// bob: an unpriced model, charged $1
+		{2, 1, "mystery", 2, 500000, 0, 0, now - 60},
+		{1, 1, "gpt-4o", 5, 9999999, 1000000, 0, now - 60},            // failed requests are not billed
+		{1, 1, "gpt-4o", 2, 2500000, 1000000, 250000, now - 40*86400}, // outside the window
+	} {
+		if _, err := db.Exec(`INSERT INTO logs (user_id, channel_id, model_name, type, quota, prompt_tokens, completion_tokens, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	if _, err := NewChannelMarginService().SaveCostTable(ctx, ChannelCostTable{
+		Models:      []ModelCost{{Model: "gpt-4o*", InputPer1M: 2, OutputPer1M: 8}},
+		Multipliers: []ChannelCostMultiplier{{ChannelID: 2, Multiplier: 0.5}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewCostAttributionService()
+
+	if _, err := svc.GetCosts(ctx, "model", 7, 10, true); !errors.Is(err, ErrInvalidCostQuery) {
+		t.Errorf("bad dimension: %v", err)
+	}
+	users, err := svc.GetCosts(ctx, CostByUser, 7, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := users["items"].([]map[string]interface{})
+	if len(items) != 2 || items[0]["username"] != "alice" || items[0]["cost_usd"] != 4.0 || items[0]["margin_usd"] != 1.0 {
+		t.Fatalf("users = %+v", items)
+	}
+	if bob := items[1]; bob["cost_usd"] != 2.0 || bob["revenue_usd"] != 6.0 || bob["unpriced_quota"] != int64(500000) {
+		t.Errorf("bob = %+v", bob)
+	}
+	if summary := users["summary"].(map[string]interface{}); summary["cost_usd"] != 6.0 || summary["revenue_usd"] != 11.0 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	groups, err := svc.GetCosts(ctx, CostByGroup, 7, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items = groups["items"].([]map[string]interface{}); groups["source"] != "users" || len(items) != 2 ||
+		items[0]["group"] != "vip" || items[1]["group"] != "default" {
+		t.Errorf("groups = %+v", groups)
+	}
+
+	channels, err := svc.GetCosts(ctx, CostByChannel, 7, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items = channels["items"].([]map[string]interface{}); len(items) != 1 || items[0]["channel_name"] != "main" || channels["truncated"] != true {
+		t.Errorf("channels = %+v", channels)
+	}
+
+	if _, err := svc.GetCostTrend(ctx, CostByUser, "", 7, true); !errors.Is(err, ErrInvalidCostQuery) {
+		t.Errorf("trend without id: %v", err)
+	}
+	trend, err := svc.GetCostTrend(ctx, CostByGroup, "default", 7, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := trend["points"].([]map[string]interface{})
+	today := points[len(points)-1]
+	if len(points) != 7 || today["date"] != time.Now().In(ReportLocation()).Format("2006-01-02") || today["cost_usd"] != 2.0 || points[0]["quota"] != int64(0) {
+		t.Errorf("trend = %+v", points)
+	}
+}
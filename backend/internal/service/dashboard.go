@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -9,12 +10,17 @@ import (
 
 	"github.com/new-api-tools/backend/internal/cache"
 	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // DashboardService handles dashboard analytics queries
 type DashboardService struct {
 	db    *database.Manager
 	logDB *database.Manager
+	cm    *cache.Manager
+	// instance is the registered New API instance ("" = primary); local
+	// rollups only exist for the primary
+	instance string
 }
 
 var ipDistributionSampleLimit = 3000
@@ -23,7 +29,20 @@ const ipDistributionQueryTimeout = 30 * time.Second
 
 // NewDashboardService creates a new DashboardService
 func NewDashboardService() *DashboardService {
-	return &DashboardService{db: database.Get(), logDB: database.GetLog()}
+	return NewDashboardServiceFor("")
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *DashboardService) WithContext(ctx context.Context) *DashboardService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// NewDashboardServiceFor creates a DashboardService bound to a registered New API instance ("" = primary)
+func NewDashboardServiceFor(instance string) *DashboardService {
+	db, logDB := database.ForInstanceRead(instance)
+	return &DashboardService{db: db, logDB: logDB, cm: cache.ForInstance(instance), instance: instance}
 }
 
 // parsePeriodToTimestamps converts period strings like "24h", "7d" to start/end timestamps
@@ -55,18 +74,18 @@ func parsePeriodToTimestamps(period string) (int64, int64) {
 }
 
 // GetSystemOverview returns system overview statistics
-func (s *DashboardService) GetSystemOverview(period string, noCache bool) (map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:overview:%s", period)
+func (s *DashboardService) GetSystemOverview(period string, noCache bool) (*api.SystemOverview, error) {
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:overview:%s", period)
 	if !noCache {
-		var cached map[string]interface{}
+		var cached api.SystemOverview
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
-			return cached, nil
+			return &cached, nil
 		}
 	}
 
 	startTime, _ := parsePeriodToTimestamps(period)
-	result := map[string]interface{}{}
+	result := &api.SystemOverview{}
 
 	// Combined query 1: users + tokens counts (reduces 4 queries → 1)
 	userTokenQuery := s.db.RebindQuery(`
@@ -76,25 +95,25 @@ func (s *DashboardService) GetSystemOverview(period string, noCache bool) (map[s
 			(SELECT COUNT(*) FROM tokens WHERE deleted_at IS NULL AND status = 1) as active_tokens`)
 	row, err := s.db.QueryOneWithTimeout(15*time.Second, userTokenQuery)
 	if err == nil && row != nil {
-		result["total_users"] = row["total_users"]
-		result["total_tokens"] = row["total_tokens"]
-		result["active_tokens"] = row["active_tokens"]
+		result.TotalUsers = toInt64(row["total_users"])
+		result.TotalTokens = toInt64(row["total_tokens"])
+		result.ActiveTokens = toInt64(row["active_tokens"])
 	}
 
 	// active_users lives in the logs table → query the log DB separately
 	// (logs may be on a different database via LOG_SQL_DSN, so it can't be a
 	// subquery alongside the users/tokens counts above).
-	activeQuery := s.logDB.RebindQuery(`SELECT COUNT(DISTINCT user_id) as active_users FROM logs WHERE created_at >= ? AND type IN (2, 5)`)
+	activeQuery := s.logDB.RebindQuery(`SELECT COUNT(DISTINCT user_id) as active_users FROM logs WHERE created_at >= ? AND type IN (` + ltRequests() + `)`)
 	if activeRow, aErr := s.logDB.QueryOneWithTimeout(15*time.Second, activeQuery, startTime); aErr == nil && activeRow != nil {
-		result["active_users"] = activeRow["active_users"]
+		result.ActiveUsers = toInt64(activeRow["active_users"])
 	}
 
 	// Combined query 2: channels
 	channelQuery := `SELECT COUNT(*) as total, SUM(CASE WHEN status = 1 THEN 1 ELSE 0 END) as active FROM channels`
 	row, err = s.db.QueryOneWithTimeout(10*time.Second, channelQuery)
 	if err == nil && row != nil {
-		result["total_channels"] = row["total"]
-		result["active_channels"] = row["active"]
+		result.TotalChannels = toInt64(row["total"])
+		result.ActiveChannels = toInt64(row["active"])
 	}
 
 	// Models count
@@ -104,12 +123,12 @@ func (s *DashboardService) GetSystemOverview(period string, noCache bool) (map[s
 		 INNER JOIN channels c ON c.id = a.channel_id
 		 WHERE c.status = 1`)
 	if err == nil && row != nil {
-		result["total_models"] = row["count"]
+		result.TotalModels = toInt64(row["count"])
 	} else {
 		row, err = s.db.QueryOneWithTimeout(10*time.Second,
 			"SELECT COUNT(*) as count FROM models WHERE deleted_at IS NULL")
 		if err == nil && row != nil {
-			result["total_models"] = row["count"]
+			result.TotalModels = toInt64(row["count"])
 		}
 	}
 
@@ -119,22 +138,22 @@ func (s *DashboardService) GetSystemOverview(period string, noCache bool) (map[s
 		 SUM(CASE WHEN status = 1 THEN 1 ELSE 0 END) as unused
 		 FROM redemptions WHERE deleted_at IS NULL`)
 	if err == nil && row != nil {
-		result["total_redemptions"] = row["total"]
-		result["unused_redemptions"] = row["unused"]
+		result.TotalRedemptions = toInt64(row["total"])
+		result.UnusedRedemptions = toInt64(row["unused"])
 	}
 
-	cm.Set(cacheKey, result, 3*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(3*time.Minute))
 	return result, nil
 }
 
 // GetUsageStatistics returns usage statistics for a time period
-func (s *DashboardService) GetUsageStatistics(period string, noCache bool) (map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:usage:%s", period)
+func (s *DashboardService) GetUsageStatistics(period string, noCache bool) (*api.UsageStatistics, error) {
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:usage:%s", period)
 	if !noCache {
-		var cached map[string]interface{}
+		var cached api.UsageStatistics
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
-			return cached, nil
+			return &cached, nil
 		}
 	}
 
@@ -149,43 +168,32 @@ func (s *DashboardService) GetUsageStatistics(period string, noCache bool) (map[
 			COALESCE(SUM(completion_tokens), 0) as total_completion_tokens,
 			COALESCE(AVG(use_time), 0) as avg_response_time
 		FROM logs
-		WHERE created_at >= ? AND created_at <= ? AND type = 2`)
+		WHERE created_at >= ? AND created_at <= ? AND type = ` + ltConsume())
 
 	row, err := s.logDB.QueryOneWithTimeout(15*time.Second, query, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
 
-	result := map[string]interface{}{
-		"total_requests":          0,
-		"total_quota_used":        0,
-		"total_prompt_tokens":     0,
-		"total_completion_tokens": 0,
-		"average_response_time":   float64(0),
-		"period":                  period,
-	}
-
+	result := &api.UsageStatistics{Period: period}
 	if row != nil {
-		result["total_requests"] = row["total_requests"]
-		result["total_quota_used"] = row["total_quota_used"]
-		result["total_prompt_tokens"] = row["total_prompt_tokens"]
-		result["total_completion_tokens"] = row["total_completion_tokens"]
-		// Average response time in milliseconds
-		if avgTime, ok := row["avg_response_time"]; ok {
-			result["average_response_time"] = toFloat64(avgTime)
-		}
+		result.TotalRequests = toInt64(row["total_requests"])
+		result.TotalQuotaUsed = toInt64(row["total_quota_used"])
+		result.TotalPromptTokens = toInt64(row["total_prompt_tokens"])
+		result.TotalCompletionTokens = toInt64(row["total_completion_tokens"])
+		result.AverageResponseTime = toFloat64(row["avg_response_time"])
 	}
 
-	cm.Set(cacheKey, result, 3*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(3*time.Minute))
 	return result, nil
 }
 
 // GetModelUsage returns model usage distribution
-func (s *DashboardService) GetModelUsage(period string, limit int, noCache bool) ([]map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:models:%s:%d", period, limit)
+func (s *DashboardService) GetModelUsage(period string, limit int, noCache bool) ([]api.ModelUsage, error) {
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:models:%s:%d", period, limit)
 	if !noCache {
-		var cached []map[string]interface{}
+		var cached []api.ModelUsage
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
 			return cached, nil
 		}
@@ -200,7 +208,7 @@ func (s *DashboardService) GetModelUsage(period string, limit int, noCache bool)
 			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
 			COALESCE(SUM(completion_tokens), 0) as completion_tokens
 		FROM logs
-		WHERE created_at >= ? AND created_at <= ? AND type = 2
+		WHERE created_at >= ? AND created_at <= ? AND type = ` + ltConsume() + `
 		GROUP BY model_name
 		ORDER BY request_count DESC
 		LIMIT ?`)
@@ -209,38 +217,45 @@ func (s *DashboardService) GetModelUsage(period string, limit int, noCache bool)
 	if err != nil {
 		return nil, err
 	}
-	cm.Set(cacheKey, rows, 3*time.Minute)
-	return rows, nil
-}
-
-// localTZOffset returns the local timezone offset in seconds (e.g. 28800 for UTC+8).
-func localTZOffset() int {
-	_, offset := time.Now().Zone()
-	return offset
+	result := make([]api.ModelUsage, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, api.ModelUsage{
+			ModelName:        toString(row["model_name"]),
+			RequestCount:     toInt64(row["request_count"]),
+			QuotaUsed:        toInt64(row["quota_used"]),
+			PromptTokens:     toInt64(row["prompt_tokens"]),
+			CompletionTokens: toInt64(row["completion_tokens"]),
+		})
+	}
+	cm.Set(cacheKey, result, scaledTTL(3*time.Minute))
+	return result, nil
 }
 
 // GetDailyTrends returns daily usage trends
-func (s *DashboardService) GetDailyTrends(days int, noCache bool) ([]map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:daily:%d", days)
+func (s *DashboardService) GetDailyTrends(days int, noCache bool) ([]api.DailyTrend, error) {
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:daily:%d", days)
 	if !noCache {
-		var cached []map[string]interface{}
+		var cached []api.DailyTrend
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
 			return cached, nil
 		}
 	}
 
-	now := time.Now()
-	startTime := now.AddDate(0, 0, -days).Unix()
-	tzOffset := localTZOffset()
+	now := reportNow()
+	startTime := reportDayStart(now.AddDate(0, 0, -(days - 1))).Unix()
 
-	// Group by local-time day using pure unix arithmetic — timezone-safe
-	dayGroupExpr := fmt.Sprintf("FLOOR((created_at + %d) / 86400)", tzOffset)
+	// Group by reporting-timezone day; the offset follows DST within the range
+	dayGroupExpr := reportDayExpr("created_at", startTime, now.Unix())
 
 	var rows []map[string]interface{}
 	var err error
 
-	if IsQuotaDataAvailable() {
+	rollup := NewAnalyticsRollupService()
+	if s.instance == "" && rollup.Covers(context.Background(), startTime) {
+		// Fastest path: local hourly rollups (extend with /api/analytics/rollups/backfill)
+		rows, err = rollup.DailyTrends(context.Background(), startTime, now.Unix())
+	} else if IsQuotaDataAvailable() {
 		query := s.db.RebindQuery(fmt.Sprintf(`
 			SELECT %s as day_group,
 				COALESCE(SUM(count), 0) as request_count,
@@ -259,7 +274,7 @@ func (s *DashboardService) GetDailyTrends(days int, noCache bool) ([]map[string]
 				COALESCE(SUM(quota), 0) as quota_used,
 				COUNT(DISTINCT user_id) as unique_users
 			FROM logs
-			WHERE created_at >= ? AND type = 2
+			WHERE created_at >= ? AND type = `+ltConsume()+`
 			GROUP BY %s
 			ORDER BY day_group ASC`,
 			dayGroupExpr, dayGroupExpr))
@@ -270,18 +285,18 @@ func (s *DashboardService) GetDailyTrends(days int, noCache bool) ([]map[string]
 		return nil, err
 	}
 
-	rows = fillDailyGaps(rows, days, tzOffset)
+	trends := fillDailyGaps(rows, days, now)
 
-	cm.Set(cacheKey, rows, 5*time.Minute)
-	return rows, nil
+	cm.Set(cacheKey, trends, scaledTTL(5*time.Minute))
+	return trends, nil
 }
 
 // GetHourlyTrends returns hourly usage trends
-func (s *DashboardService) GetHourlyTrends(hours int, noCache bool) ([]map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:hourly:%d", hours)
+func (s *DashboardService) GetHourlyTrends(hours int, noCache bool) ([]api.HourlyTrend, error) {
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:hourly:%d", hours)
 	if !noCache {
-		var cached []map[string]interface{}
+		var cached []api.HourlyTrend
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
 			return cached, nil
 		}
@@ -298,7 +313,7 @@ func (s *DashboardService) GetHourlyTrends(hours int, noCache bool) ([]map[strin
 			COUNT(*) as request_count,
 			COALESCE(SUM(quota), 0) as quota_used
 		FROM logs
-		WHERE created_at >= ? AND type = 2
+		WHERE created_at >= ? AND type = `+ltConsume()+`
 		GROUP BY %s
 		ORDER BY hour_group ASC`,
 		hourGroupExpr, hourGroupExpr))
@@ -308,18 +323,18 @@ func (s *DashboardService) GetHourlyTrends(hours int, noCache bool) ([]map[strin
 		return nil, err
 	}
 
-	rows = fillHourlyGaps(rows, hours, tzOffset)
+	trends := fillHourlyGaps(rows, hours, tzOffset, time.Now())
 
-	cm.Set(cacheKey, rows, 2*time.Minute)
-	return rows, nil
+	cm.Set(cacheKey, trends, scaledTTL(2*time.Minute))
+	return trends, nil
 }
 
 // GetTopUsers returns top users by quota usage (subquery-first optimization)
-func (s *DashboardService) GetTopUsers(period string, limit int, noCache bool) ([]map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:topusers:%s:%d", period, limit)
+func (s *DashboardService) GetTopUsers(period string, limit int, noCache bool) ([]api.TopUser, error) {
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:topusers:%s:%d", period, limit)
 	if !noCache {
-		var cached []map[string]interface{}
+		var cached []api.TopUser
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
 			return cached, nil
 		}
@@ -328,32 +343,44 @@ func (s *DashboardService) GetTopUsers(period string, limit int, noCache bool) (
 	startTime, endTime := parsePeriodToTimestamps(period)
 
 	// logs 表已反范式存有 username，直接聚合，无需 JOIN users（兼容 logs 独立库）。
+	excludeSQL, excludeArgs := roleExclusionClause(s.db, "user_id")
 	query := s.logDB.RebindQuery(`
 		SELECT user_id,
 			COALESCE(MAX(username), '') as username,
 			COUNT(*) as request_count,
 			COALESCE(SUM(quota), 0) as quota_used
 		FROM logs
-		WHERE created_at >= ? AND created_at <= ? AND type IN (2, 5)
+		WHERE created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `)` + excludeSQL + `
 		GROUP BY user_id
 		ORDER BY quota_used DESC
 		LIMIT ?`)
 
-	rows, err := s.logDB.QueryWithTimeout(15*time.Second, query, startTime, endTime, limit)
+	args := append([]interface{}{startTime, endTime}, excludeArgs...)
+	rows, err := s.logDB.QueryWithTimeout(15*time.Second, query, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
 
 	// username 可能为空（老日志未回填）→ 用主库补齐
 	s.fillUsernames(rows)
-	cm.Set(cacheKey, rows, 3*time.Minute)
-	return rows, nil
+	result := make([]api.TopUser, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, api.TopUser{
+			UserID:       toInt64(row["user_id"]),
+			Username:     toString(row["username"]),
+			RequestCount: toInt64(row["request_count"]),
+			QuotaUsed:    toInt64(row["quota_used"]),
+		})
+	}
+	cm.Set(cacheKey, result, scaledTTL(3*time.Minute))
+	return result, nil
 }
 
 // InvalidateDashboardCache clears all dashboard-related caches
 func (s *DashboardService) InvalidateDashboardCache() {
-	cm := cache.Get()
-	cm.DeleteByPrefix("dashboard:")
+	cm := s.cm
+	cm.DeleteByPrefix(cache.Key("dashboard:"))
+	PublishEvent(EventCacheInvalidated, map[string]interface{}{"scope": "dashboard"})
 }
 
 // fillUsernames backfills empty "username" fields in log-derived rows by looking
@@ -406,7 +433,7 @@ func (s *DashboardService) fillUsernames(rows []map[string]interface{}) {
 }
 
 // GetChannelStatus returns channel status overview
-func (s *DashboardService) GetChannelStatus() ([]map[string]interface{}, error) {
+func (s *DashboardService) GetChannelStatus() ([]api.ChannelStatus, error) {
 	query := `
 		SELECT id, name, type, status,
 			COALESCE(used_quota, 0) as used_quota,
@@ -415,15 +442,31 @@ func (s *DashboardService) GetChannelStatus() ([]map[string]interface{}, error)
 		FROM channels
 		ORDER BY priority DESC, id ASC`
 
-	return s.db.Query(query)
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]api.ChannelStatus, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, api.ChannelStatus{
+			ID:        toInt64(row["id"]),
+			Name:      toString(row["name"]),
+			Type:      toInt64(row["type"]),
+			Status:    toInt64(row["status"]),
+			UsedQuota: toInt64(row["used_quota"]),
+			Balance:   toFloat64(row["balance"]),
+			Priority:  toInt64(row["priority"]),
+		})
+	}
+	return result, nil
 }
 
 // GetIPDistribution returns IP access distribution statistics.
 // Total counters are computed from the full time window; geographic breakdowns
 // use a top-IP sample so large logs tables stay responsive.
 func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("dashboard:ip_distribution:%s", window)
+	cm := s.cm
+	cacheKey := cache.Key("dashboard:ip_distribution:%s", window)
 	if !noCache {
 		var cached map[string]interface{}
 		if found, _ := cm.GetJSON(cacheKey, &cached); found {
@@ -433,13 +476,14 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 
 	startTime, endTime := parsePeriodToTimestamps(window)
 	geoAvailable := IsIPGeoAvailable()
+	asnAvailable := IsIPASNAvailable()
 
 	statsQuery := s.logDB.RebindQuery(`
 		SELECT
 			COUNT(DISTINCT ip) as total_ips,
 			COUNT(*) as total_requests
 		FROM logs
-		WHERE created_at >= ? AND created_at <= ? AND type IN (2, 5) AND ip IS NOT NULL AND ip <> ''`)
+		WHERE created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `) AND ip IS NOT NULL AND ip <> ''`)
 	statsRow, err := s.logDB.QueryOneWithTimeout(ipDistributionQueryTimeout, statsQuery, startTime, endTime)
 	if err != nil {
 		return nil, err
@@ -453,7 +497,7 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 			COUNT(*) as request_count,
 			COUNT(DISTINCT user_id) as user_count
 		FROM logs
-		WHERE created_at >= ? AND created_at <= ? AND type IN (2, 5) AND ip IS NOT NULL AND ip <> ''
+		WHERE created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `) AND ip IS NOT NULL AND ip <> ''
 		GROUP BY ip
 		ORDER BY request_count DESC
 		LIMIT ?`)
@@ -471,16 +515,18 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 			"sampled_requests":    int64(0),
 			"coverage_percentage": float64(0),
 			"geo_available":       geoAvailable,
+			"asn_available":       asnAvailable,
 			"domestic_percentage": 0.0,
 			"overseas_percentage": 0.0,
 			"by_country":          []map[string]interface{}{},
 			"by_province":         []map[string]interface{}{},
 			"top_cities":          []map[string]interface{}{},
+			"by_asn":              []map[string]interface{}{},
 			"snapshot_time":       time.Now().Unix(),
 		}
 		result["total_ips"] = totalIPs
 		result["total_requests"] = totalRequests
-		cm.Set(cacheKey, result, 5*time.Minute)
+		cm.Set(cacheKey, result, scaledTTL(5*time.Minute))
 		return result, nil
 	}
 
@@ -531,10 +577,17 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 		RequestCount int64
 		UserCount    int64
 	}
+	type asnAgg struct {
+		Org          string
+		IPCount      int64
+		RequestCount int64
+		UserCount    int64
+	}
 
 	byCountry := map[string]*countryAgg{}
 	byProvince := map[string]*provinceAgg{}
 	byCity := map[string]*cityAgg{}
+	byASN := map[string]*asnAgg{}
 
 	var sampledIPs int64
 	var sampledRequests int64
@@ -591,6 +644,16 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 			byCity[cityKey].RequestCount += stat.RequestCount
 			byCity[cityKey].UserCount += stat.UserCount
 		}
+
+		// By ASN (only when the optional ASN database is loaded)
+		if geo.ASN != "" {
+			if _, ok := byASN[geo.ASN]; !ok {
+				byASN[geo.ASN] = &asnAgg{Org: geo.Org}
+			}
+			byASN[geo.ASN].IPCount++
+			byASN[geo.ASN].RequestCount += stat.RequestCount
+			byASN[geo.ASN].UserCount += stat.UserCount
+		}
 	}
 
 	coveragePct := float64(0)
@@ -653,6 +716,23 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 	}
 	sortByRequestCount(cityList)
 
+	asnList := make([]map[string]interface{}, 0, len(byASN))
+	for asn, agg := range byASN {
+		pct := float64(0)
+		if sampledRequests > 0 {
+			pct = float64(agg.RequestCount) / float64(sampledRequests) * 100
+		}
+		asnList = append(asnList, map[string]interface{}{
+			"asn":           asn,
+			"org":           agg.Org,
+			"ip_count":      agg.IPCount,
+			"request_count": agg.RequestCount,
+			"user_count":    agg.UserCount,
+			"percentage":    math.Round(pct*100) / 100,
+		})
+	}
+	sortByRequestCount(asnList)
+
 	// Domestic/overseas percentage
 	domesticPct := float64(0)
 	overseasPct := float64(0)
@@ -669,23 +749,25 @@ func (s *DashboardService) GetIPDistribution(window string, noCache bool) (map[s
 		"sampled_requests":    sampledRequests,
 		"coverage_percentage": coveragePct,
 		"geo_available":       geoAvailable,
+		"asn_available":       asnAvailable,
+		"geo_pending":         IPGeoPendingCount(), // 待 GeoIP 恢复 / 更新后重新解析的 IP 数
 		"domestic_percentage": domesticPct,
 		"overseas_percentage": overseasPct,
 		"by_country":          countryList,
 		"by_province":         provinceList,
 		"top_cities":          cityList,
+		"by_asn":              asnList,
 		"snapshot_time":       time.Now().Unix(),
 	}
-	cm.Set(cacheKey, result, 5*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(5*time.Minute))
 	return result, nil
 }
 
 // fillDailyGaps ensures every day in the range has a row.
-// Matches DB rows by day_group (FLOOR((unix_ts + tzOffset) / 86400)) for
-// timezone-safe bucket matching that is identical to the SQL grouping expression.
-func fillDailyGaps(rows []map[string]interface{}, days int, tzOffset int) []map[string]interface{} {
-	now := time.Now()
-	loc := now.Location()
+// Matches DB rows by day_group (see reportDayExpr), walking calendar days in
+// the reporting timezone so 23 / 25 hour DST days keep their own bucket.
+func fillDailyGaps(rows []map[string]interface{}, days int, now time.Time) []api.DailyTrend {
+	now = now.In(ReportLocation())
 
 	// Build lookup keyed by day_group integer
 	lookup := make(map[int64]map[string]interface{}, len(rows))
@@ -696,39 +778,27 @@ func fillDailyGaps(rows []map[string]interface{}, days int, tzOffset int) []map[
 		}
 	}
 
-	result := make([]map[string]interface{}, 0, days)
+	result := make([]api.DailyTrend, 0, days)
 	for i := days - 1; i >= 0; i-- {
-		day := now.AddDate(0, 0, -i)
-		dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+		dayStart := reportDayStart(now.AddDate(0, 0, -i))
 		// Compute the same day_group as the SQL expression
-		expectedGroup := (dayStart.Unix() + int64(tzOffset)) / 86400
-		dateStr := dayStart.Format("2006-01-02")
-		ts := dayStart.Unix()
-
-		if existing, ok := lookup[expectedGroup]; ok {
-			existing["date"] = dateStr
-			existing["timestamp"] = ts
-			delete(existing, "day_group")
-			result = append(result, existing)
-		} else {
-			result = append(result, map[string]interface{}{
-				"date":          dateStr,
-				"timestamp":     ts,
-				"request_count": int64(0),
-				"quota_used":    int64(0),
-				"unique_users":  int64(0),
-			})
+		day := api.DailyTrend{Date: dayStart.Format("2006-01-02"), Timestamp: dayStart.Unix()}
+		if existing, ok := lookup[reportDayGroup(dayStart)]; ok {
+			day.RequestCount = toInt64(existing["request_count"])
+			day.QuotaUsed = toInt64(existing["quota_used"])
+			day.UniqueUsers = toInt64(existing["unique_users"])
 		}
+		result = append(result, day)
 	}
 	return result
 }
 
 // fillHourlyGaps ensures every hour in the range has a row.
-// Matches DB rows by hour_group (FLOOR((unix_ts + tzOffset) / 3600)) for
-// timezone-safe bucket matching that is identical to the SQL grouping expression.
-func fillHourlyGaps(rows []map[string]interface{}, hours int, tzOffset int) []map[string]interface{} {
-	now := time.Now()
-	loc := now.Location()
+// Matches DB rows by hour_group (FLOOR((unix_ts + tzOffset) / 3600)). Hours are
+// walked as real 3600s buckets and only labelled in the reporting timezone, so
+// the repeated hour of a DST fall-back shows up twice instead of colliding.
+func fillHourlyGaps(rows []map[string]interface{}, hours int, tzOffset int, now time.Time) []api.HourlyTrend {
+	loc := ReportLocation()
 
 	// Build lookup keyed by hour_group integer
 	lookup := make(map[int64]map[string]interface{}, len(rows))
@@ -739,28 +809,17 @@ func fillHourlyGaps(rows []map[string]interface{}, hours int, tzOffset int) []ma
 		}
 	}
 
-	result := make([]map[string]interface{}, 0, hours)
+	result := make([]api.HourlyTrend, 0, hours)
 	for i := hours - 1; i >= 0; i-- {
-		t := now.Add(-time.Duration(i) * time.Hour)
-		hourStart := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
 		// Compute the same hour_group as the SQL expression
-		expectedGroup := (hourStart.Unix() + int64(tzOffset)) / 3600
-		hourStr := hourStart.Format("2006-01-02 15:00")
-		ts := hourStart.Unix()
-
+		expectedGroup := floorDiv(now.Unix()+int64(tzOffset), 3600) - int64(i)
+		ts := expectedGroup*3600 - int64(tzOffset)
+		hour := api.HourlyTrend{Hour: time.Unix(ts, 0).In(loc).Format("2006-01-02 15:00"), Timestamp: ts}
 		if existing, ok := lookup[expectedGroup]; ok {
-			existing["hour"] = hourStr
-			existing["timestamp"] = ts
-			delete(existing, "hour_group")
-			result = append(result, existing)
-		} else {
-			result = append(result, map[string]interface{}{
-				"hour":          hourStr,
-				"timestamp":     ts,
-				"request_count": int64(0),
-				"quota_used":    int64(0),
-			})
+			hour.RequestCount = toInt64(existing["request_count"])
+			hour.QuotaUsed = toInt64(existing["quota_used"])
 		}
+		result = append(result, hour)
 	}
 	return result
 }
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// GetFleetOverview aggregates overview + usage statistics across every registered
+// instance. Instances are queried concurrently (at most the scale profile's
+// scan_concurrency at a time) through their own DashboardService (and therefore
+// their own cache namespace); unavailable or failing instances are reported
+// per-row instead of failing the whole response.
+func GetFleetOverview(ctx context.Context, period string, noCache bool) *api.FleetOverview {
+	registry := database.ListInstances()
+	rows := make([]api.FleetInstance, len(registry))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, CurrentScaleProfile().ScanConcurrency)
+	for i, inst := range registry {
+		available, _ := inst["available"].(bool)
+		row := &rows[i]
+		*row = api.FleetInstance{Instance: toString(inst["name"]), Available: available, Error: toString(inst["error"])}
+		if !available {
+			continue
+		}
+		wg.Add(1)
+		go func(row *api.FleetInstance) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			svc := NewDashboardServiceFor(row.Instance).WithContext(ctx)
+			if overview, err := svc.GetSystemOverview(period, noCache); err == nil {
+				row.SystemOverview = overview
+			} else {
+				row.Error = err.Error()
+			}
+			if usage, err := svc.GetUsageStatistics(period, noCache); err == nil {
+				row.UsageStatistics = usage
+			} else {
+				row.Error = err.Error()
+			}
+		}(row)
+	}
+	wg.Wait()
+
+	return &api.FleetOverview{
+		Period:    period,
+		Totals:    aggregateFleetRows(rows),
+		Instances: rows,
+	}
+}
+
+// aggregateFleetRows sums the instances that answered into the fleet totals
+func aggregateFleetRows(rows []api.FleetInstance) api.FleetTotals {
+	totals := api.FleetTotals{InstancesTotal: len(rows)}
+	var weightedRT float64
+	for _, row := range rows {
+		if o := row.SystemOverview; o != nil {
+			totals.TotalUsers += o.TotalUsers
+			totals.ActiveUsers += o.ActiveUsers
+			totals.TotalTokens += o.TotalTokens
+			totals.ActiveTokens += o.ActiveTokens
+			totals.TotalChannels += o.TotalChannels
+			totals.ActiveChannels += o.ActiveChannels
+		}
+		if u := row.UsageStatistics; u != nil {
+			totals.InstancesReporting++
+			totals.TotalRequests += u.TotalRequests
+			totals.TotalQuotaUsed += u.TotalQuotaUsed
+			totals.TotalPromptTokens += u.TotalPromptTokens
+			totals.TotalCompletionTokens += u.TotalCompletionTokens
+			weightedRT += u.AverageResponseTime * float64(u.TotalRequests)
+		}
+	}
+	if totals.TotalRequests > 0 {
+		totals.AverageResponseTime = roundRate(weightedRT / float64(totals.TotalRequests))
+	}
+	return totals
+}
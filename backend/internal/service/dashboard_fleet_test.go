@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+func TestAggregateFleetRows(t *testing.T) {
+	rows := []api.FleetInstance{
+		{Instance: "default", Available: true, SystemOverview: &api.SystemOverview{TotalUsers: 10},
+			UsageStatistics: &api.UsageStatistics{TotalRequests: 100, TotalQuotaUsed: 500, AverageResponseTime: 2.0}},
+		{Instance: "eu", Available: true, SystemOverview: &api.SystemOverview{TotalUsers: 5},
+			UsageStatistics: &api.UsageStatistics{TotalRequests: 300, TotalQuotaUsed: 1500, AverageResponseTime: 4.0}},
+		{Instance: "down", Error: "dial tcp: refused"},
+	}
+	totals := aggregateFleetRows(rows)
+
+	if totals.TotalUsers != 15 {
+		t.Errorf("total_users = %d, want 15", totals.TotalUsers)
+	}
+	if totals.TotalQuotaUsed != 2000 {
+		t.Errorf("total_quota_used = %d, want 2000", totals.TotalQuotaUsed)
+	}
+	if totals.AverageResponseTime != 3.5 {
+		t.Errorf("weighted average_response_time = %v, want 3.5", totals.AverageResponseTime)
+	}
+	if totals.InstancesReporting != 2 || totals.InstancesTotal != 3 {
+		t.Errorf("unexpected instance counts: %v/%v", totals.InstancesReporting, totals.InstancesTotal)
+	}
+}
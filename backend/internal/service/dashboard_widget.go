@@ -0,0 +1,586 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// Widget dimensions (GROUP BY) and metrics (aggregate); each maps to a fixed
+// SQL expression so no free-form SQL is ever accepted
+const (
+	WidgetDimensionNone    = "none"
+	WidgetDimensionDay     = "day"
+	WidgetDimensionHour    = "hour"
+	WidgetDimensionModel   = "model"
+	WidgetDimensionChannel = "channel"
+	WidgetDimensionUser    = "user"
+	WidgetDimensionGroup   = "group"
+	WidgetDimensionToken   = "token"
+)
+
+const (
+	WidgetMetricRequests         = "requests"
+	WidgetMetricQuota            = "quota"
+	WidgetMetricPromptTokens     = "prompt_tokens"
+	WidgetMetricCompletionTokens = "completion_tokens"
+	WidgetMetricTotalTokens      = "total_tokens"
+	WidgetMetricUniqueUsers      = "unique_users"
+	WidgetMetricAvgUseTime       = "avg_use_time"
+)
+
+var (
+	WidgetDimensions = []string{WidgetDimensionNone, WidgetDimensionDay, WidgetDimensionHour, WidgetDimensionModel,
+		WidgetDimensionChannel, WidgetDimensionUser, WidgetDimensionGroup, WidgetDimensionToken}
+	WidgetMetrics = []string{WidgetMetricRequests, WidgetMetricQuota, WidgetMetricPromptTokens, WidgetMetricCompletionTokens,
+		WidgetMetricTotalTokens, WidgetMetricUniqueUsers, WidgetMetricAvgUseTime}
+	WidgetPeriods  = []string{"1h", "6h", "24h", "3d", "7d", "14d", "30d"}
+	WidgetLogTypes = []string{"consume", "error", "all"}
+	WidgetCharts   = []string{"number", "line", "bar", "pie", "table"}
+)
+
+var (
+	ErrWidgetNotFound = errors.New("widget not found")
+	ErrInvalidWidget  = errors.New("invalid widget")
+)
+
+// maxWidgetFilterValues bounds every filter list
+const maxWidgetFilterValues = 50
+
+// widgetMetricExprs maps a metric to its aggregate over logs
+var widgetMetricExprs = map[string]string{
+	WidgetMetricRequests:         "COUNT(*)",
+	WidgetMetricQuota:            "COALESCE(SUM(quota), 0)",
+	WidgetMetricPromptTokens:     "COALESCE(SUM(prompt_tokens), 0)",
+	WidgetMetricCompletionTokens: "COALESCE(SUM(completion_tokens), 0)",
+	WidgetMetricTotalTokens:      "COALESCE(SUM(prompt_tokens + completion_tokens), 0)",
+	WidgetMetricUniqueUsers:      "COUNT(DISTINCT user_id)",
+	WidgetMetricAvgUseTime:       "COALESCE(AVG(use_time), 0)",
+}
+
+// WidgetFilters narrows the logs a widget aggregates; empty lists match everything
+type WidgetFilters struct {
+	Models     []string `json:"models"` // 以 * 结尾按前缀匹配，如 gpt-4*
+	ChannelIDs []int64  `json:"channel_ids"`
+	UserIDs    []int64  `json:"user_ids"`
+	Groups     []string `json:"groups"`
+	LogType    string   `json:"log_type"` // consume | error | all
+}
+
+// DashboardWidget is a saved, parameterized aggregation rendered as a custom dashboard panel
+type DashboardWidget struct {
+	ID        int64         `json:"id"`
+	Name      string        `json:"name"`
+	Dimension string        `json:"dimension"`
+	Metric    string        `json:"metric"`
+	Filters   WidgetFilters `json:"filters"`
+	Period    string        `json:"period"`
+	Limit     int           `json:"limit"` // 非时间维度的行数上限
+	Chart     string        `json:"chart"` // 前端展示方式
+	CreatedBy string        `json:"created_by"`
+	CreatedAt int64         `json:"created_at"`
+	UpdatedAt int64         `json:"updated_at"`
+}
+
+// DashboardWidgetInput supports create / partial update of a widget
+type DashboardWidgetInput struct {
+	Name      *string        `json:"name"`
+	Dimension *string        `json:"dimension"`
+	Metric    *string        `json:"metric"`
+	Filters   *WidgetFilters `json:"filters"`
+	Period    *string        `json:"period"`
+	Limit     *int           `json:"limit"`
+	Chart     *string        `json:"chart"`
+}
+
+// WidgetDataRow is one bucket of a widget's result
+type WidgetDataRow struct {
+	Key   string  `json:"key"`
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+}
+
+// WidgetData is the evaluated result of a widget
+type WidgetData struct {
+	Widget      DashboardWidget `json:"widget"`
+	Period      string          `json:"period"`
+	StartTime   int64           `json:"start_time"`
+	EndTime     int64           `json:"end_time"`
+	Rows        []WidgetDataRow `json:"rows"`
+	Total       float64         `json:"total"` // 各行合计（unique_users / avg_use_time 为整体值）
+	GeneratedAt int64           `json:"generated_at"`
+}
+
+// DashboardWidgetService stores widget definitions and evaluates them against the logs
+type DashboardWidgetService struct {
+	logDB *database.Manager
+}
+
+// NewDashboardWidgetService creates a DashboardWidgetService
+func NewDashboardWidgetService() *DashboardWidgetService {
+	return &DashboardWidgetService{logDB: database.GetReadLog()}
+}
+
+func ensureDashboardWidgetTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS dashboard_widgets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			dimension TEXT NOT NULL DEFAULT 'none',
+			metric TEXT NOT NULL DEFAULT 'requests',
+			filters TEXT NOT NULL DEFAULT '{}',
+			period TEXT NOT NULL DEFAULT '24h',
+			row_limit INTEGER NOT NULL DEFAULT 10,
+			chart TEXT NOT NULL DEFAULT '',
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0
+		)`)
+	return err
+}
+
+func openDashboardWidgetStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureDashboardWidgetTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func isTimeDimension(dim string) bool {
+	return dim == WidgetDimensionDay || dim == WidgetDimensionHour
+}
+
+func validateDashboardWidget(w *DashboardWidget) error {
+	w.Name = strings.TrimSpace(w.Name)
+	if w.Name == "" || len([]rune(w.Name)) > 64 {
+		return fmt.Errorf("%w: name must be 1-64 characters", ErrInvalidWidget)
+	}
+	if w.Dimension == "" {
+		w.Dimension = WidgetDimensionNone
+	}
+	if !isReportOption(WidgetDimensions, w.Dimension) {
+		return fmt.Errorf("%w: dimension must be one of %s", ErrInvalidWidget, strings.Join(WidgetDimensions, ", "))
+	}
+	if w.Metric == "" {
+		w.Metric = WidgetMetricRequests
+	}
+	if !isReportOption(WidgetMetrics, w.Metric) {
+		return fmt.Errorf("%w: metric must be one of %s", ErrInvalidWidget, strings.Join(WidgetMetrics, ", "))
+	}
+	if w.Period == "" {
+		w.Period = "24h"
+	}
+	if !isReportOption(WidgetPeriods, w.Period) {
+		return fmt.Errorf("%w: period must be one of %s", ErrInvalidWidget, strings.Join(WidgetPeriods, ", "))
+	}
+	w.Limit = clampSetting(w.Limit, 1, 100, 10)
+	if w.Chart == "" {
+		switch {
+		case w.Dimension == WidgetDimensionNone:
+			w.Chart = "number"
+		case isTimeDimension(w.Dimension):
+			w.Chart = "line"
+		default:
+			w.Chart = "bar"
+		}
+	}
+	if !isReportOption(WidgetCharts, w.Chart) {
+		return fmt.Errorf("%w: chart must be one of %s", ErrInvalidWidget, strings.Join(WidgetCharts, ", "))
+	}
+
+	f := &w.Filters
+	if f.LogType == "" {
+		f.LogType = "consume"
+	}
+	if !isReportOption(WidgetLogTypes, f.LogType) {
+		return fmt.Errorf("%w: filters.log_type must be one of %s", ErrInvalidWidget, strings.Join(WidgetLogTypes, ", "))
+	}
+	models, groups := []string{}, []string{}
+	for _, m := range f.Models {
+		if m = strings.TrimSpace(m); m != "" && m != "*" {
+			models = appendUniqueString(models, m)
+		}
+	}
+	for _, g := range f.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = appendUniqueString(groups, g)
+		}
+	}
+	f.Models, f.Groups = models, groups
+	for _, ids := range [][]int64{f.ChannelIDs, f.UserIDs} {
+		for _, id := range ids {
+			if id <= 0 {
+				return fmt.Errorf("%w: filter ids must be positive", ErrInvalidWidget)
+			}
+		}
+	}
+	if f.ChannelIDs == nil {
+		f.ChannelIDs = []int64{}
+	}
+	if f.UserIDs == nil {
+		f.UserIDs = []int64{}
+	}
+	if len(f.Models) > maxWidgetFilterValues || len(f.Groups) > maxWidgetFilterValues ||
+		len(f.ChannelIDs) > maxWidgetFilterValues || len(f.UserIDs) > maxWidgetFilterValues {
+		return fmt.Errorf("%w: at most %d values per filter", ErrInvalidWidget, maxWidgetFilterValues)
+	}
+	return nil
+}
+
+const dashboardWidgetColumns = `id, name, dimension, metric, filters, period, row_limit, chart, created_by, created_at, updated_at`
+
+func scanDashboardWidget(scan func(dest ...interface{}) error) (DashboardWidget, error) {
+	var w DashboardWidget
+	var filters string
+	if err := scan(&w.ID, &w.Name, &w.Dimension, &w.Metric, &filters, &w.Period, &w.Limit, &w.Chart,
+		&w.CreatedBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return w, err
+	}
+	_ = json.Unmarshal([]byte(filters), &w.Filters)
+	return w, nil
+}
+
+func getDashboardWidget(ctx context.Context, db *sql.DB, id int64) (DashboardWidget, error) {
+	w, err := scanDashboardWidget(db.QueryRowContext(ctx, `SELECT `+dashboardWidgetColumns+` FROM dashboard_widgets WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return w, ErrWidgetNotFound
+	}
+	return w, err
+}
+
+func applyDashboardWidgetInput(w *DashboardWidget, in DashboardWidgetInput) {
+	if in.Name != nil {
+		w.Name = *in.Name
+	}
+	if in.Dimension != nil {
+		w.Dimension = *in.Dimension
+	}
+	if in.Metric != nil {
+		w.Metric = *in.Metric
+	}
+	if in.Filters != nil {
+		w.Filters = *in.Filters
+	}
+	if in.Period != nil {
+		w.Period = *in.Period
+	}
+	if in.Limit != nil {
+		w.Limit = *in.Limit
+	}
+	if in.Chart != nil {
+		w.Chart = *in.Chart
+	}
+}
+
+// List returns all saved widgets
+func (s *DashboardWidgetService) List(ctx context.Context) ([]DashboardWidget, error) {
+	db, err := openDashboardWidgetStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT `+dashboardWidgetColumns+` FROM dashboard_widgets ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	widgets := []DashboardWidget{}
+	for rows.Next() {
+		w, err := scanDashboardWidget(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		widgets = append(widgets, w)
+	}
+	return widgets, rows.Err()
+}
+
+// Get returns one widget by id
+func (s *DashboardWidgetService) Get(ctx context.Context, id int64) (DashboardWidget, error) {
+	db, err := openDashboardWidgetStore(ctx)
+	if err != nil {
+		return DashboardWidget{}, err
+	}
+	defer db.Close()
+	return getDashboardWidget(ctx, db, id)
+}
+
+// Create saves a new widget
+func (s *DashboardWidgetService) Create(ctx context.Context, createdBy string, in DashboardWidgetInput) (DashboardWidget, error) {
+	w := DashboardWidget{CreatedBy: createdBy}
+	applyDashboardWidgetInput(&w, in)
+	if err := validateDashboardWidget(&w); err != nil {
+		return w, err
+	}
+	db, err := openDashboardWidgetStore(ctx)
+	if err != nil {
+		return w, err
+	}
+	defer db.Close()
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM dashboard_widgets WHERE name = ?`, w.Name).Scan(&exists); err != nil {
+		return w, err
+	}
+	if exists > 0 {
+		return w, fmt.Errorf("%w: name %q already used", ErrInvalidWidget, w.Name)
+	}
+
+	w.CreatedAt = time.Now().Unix()
+	w.UpdatedAt = w.CreatedAt
+	filters, _ := json.Marshal(w.Filters)
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO dashboard_widgets (name, dimension, metric, filters, period, row_limit, chart, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.Name, w.Dimension, w.Metric, string(filters), w.Period, w.Limit, w.Chart, w.CreatedBy, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return w, err
+	}
+	w.ID, _ = res.LastInsertId()
+	return w, nil
+}
+
+// Update applies a partial update
+func (s *DashboardWidgetService) Update(ctx context.Context, id int64, in DashboardWidgetInput) (DashboardWidget, error) {
+	db, err := openDashboardWidgetStore(ctx)
+	if err != nil {
+		return DashboardWidget{}, err
+	}
+	defer db.Close()
+	w, err := getDashboardWidget(ctx, db, id)
+	if err != nil {
+		return w, err
+	}
+	// 维度变化时按新维度重新选择默认图表
+	if in.Dimension != nil && *in.Dimension != w.Dimension && in.Chart == nil {
+		w.Chart = ""
+	}
+	applyDashboardWidgetInput(&w, in)
+	if err := validateDashboardWidget(&w); err != nil {
+		return w, err
+	}
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM dashboard_widgets WHERE name = ? AND id <> ?`, w.Name, id).Scan(&exists); err != nil {
+		return w, err
+	}
+	if exists > 0 {
+		return w, fmt.Errorf("%w: name %q already used", ErrInvalidWidget, w.Name)
+	}
+
+	w.UpdatedAt = time.Now().Unix()
+	filters, _ := json.Marshal(w.Filters)
+	_, err = db.ExecContext(ctx, `
+		UPDATE dashboard_widgets SET name = ?, dimension = ?, metric = ?, filters = ?, period = ?, row_limit = ?,
+			chart = ?, updated_at = ?
+		WHERE id = ?`,
+		w.Name, w.Dimension, w.Metric, string(filters), w.Period, w.Limit, w.Chart, w.UpdatedAt, id)
+	return w, err
+}
+
+// Delete removes a widget
+func (s *DashboardWidgetService) Delete(ctx context.Context, id int64) error {
+	db, err := openDashboardWidgetStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.ExecContext(ctx, `DELETE FROM dashboard_widgets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWidgetNotFound
+	}
+	return nil
+}
+
+// widgetQuery builds the aggregation of w over [start, end]: the dimension
+// key (and a display label for entity dimensions) plus the metric value
+func (s *DashboardWidgetService) widgetQuery(w DashboardWidget, start, end int64) (string, []interface{}, error) {
+	f := w.Filters
+	needsGroup := w.Dimension == WidgetDimensionGroup || len(f.Groups) > 0
+	if needsGroup && !s.logDB.ColumnExists("logs", "group") {
+		return "", nil, fmt.Errorf("%w: the logs table has no group column", ErrInvalidWidget)
+	}
+
+	var keyExpr, labelExpr string
+	switch w.Dimension {
+	case WidgetDimensionDay:
+		keyExpr = reportDayExpr("created_at", start, end)
+	case WidgetDimensionHour:
+		keyExpr = fmt.Sprintf("FLOOR((created_at + %d) / 3600)", localTZOffset())
+	case WidgetDimensionModel:
+		keyExpr = "model_name"
+	case WidgetDimensionChannel:
+		keyExpr = "channel_id"
+	case WidgetDimensionUser:
+		keyExpr, labelExpr = "user_id", "MAX(username)"
+	case WidgetDimensionGroup:
+		keyExpr = "COALESCE(" + groupColFor(s.logDB) + ", '')"
+	case WidgetDimensionToken:
+		keyExpr, labelExpr = "token_id", "MAX(token_name)"
+	}
+
+	conds := []string{"created_at >= ?", "created_at <= ?"}
+	args := []interface{}{start, end}
+	switch f.LogType {
+	case "error":
+		conds = append(conds, "type = "+ltError())
+	case "all":
+		conds = append(conds, "type IN ("+ltRequests()+")")
+	default:
+		conds = append(conds, "type = "+ltConsume())
+	}
+	if len(f.Models) > 0 {
+		ors := make([]string, 0, len(f.Models))
+		for _, m := range f.Models {
+			if strings.HasSuffix(m, "*") {
+				ors = append(ors, "model_name LIKE ?")
+				args = append(args, strings.TrimSuffix(m, "*")+"%")
+			} else {
+				ors = append(ors, "model_name = ?")
+				args = append(args, m)
+			}
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+	if len(f.ChannelIDs) > 0 {
+		in, inArgs := inClause(f.ChannelIDs)
+		conds = append(conds, "channel_id IN ("+in+")")
+		args = append(args, inArgs...)
+	}
+	if len(f.UserIDs) > 0 {
+		in, inArgs := inClause(f.UserIDs)
+		conds = append(conds, "user_id IN ("+in+")")
+		args = append(args, inArgs...)
+	}
+	if len(f.Groups) > 0 {
+		conds = append(conds, groupColFor(s.logDB)+" IN ("+placeholders(len(f.Groups))+")")
+		for _, g := range f.Groups {
+			args = append(args, g)
+		}
+	}
+
+	where := strings.Join(conds, " AND ")
+	metric := widgetMetricExprs[w.Metric]
+	if keyExpr == "" {
+		return fmt.Sprintf(`SELECT %s as value FROM logs WHERE %s`, metric, where), args, nil
+	}
+	if labelExpr == "" {
+		labelExpr = "''"
+	}
+	query := fmt.Sprintf(`
+		SELECT %s as dim_key, %s as label, %s as value
+		FROM logs
+		WHERE %s
+		GROUP BY %s`, keyExpr, labelExpr, metric, where, keyExpr)
+	if isTimeDimension(w.Dimension) {
+		query += " ORDER BY dim_key ASC"
+	} else {
+		query += fmt.Sprintf(" ORDER BY value DESC LIMIT %d", w.Limit)
+	}
+	return query, args, nil
+}
+
+// Data evaluates a saved widget; period overrides the saved period when set
+func (s *DashboardWidgetService) Data(ctx context.Context, id int64, period string, noCache bool) (*WidgetData, error) {
+	w, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if period == "" {
+		period = w.Period
+	}
+	if !isReportOption(WidgetPeriods, period) {
+		return nil, fmt.Errorf("%w: period must be one of %s", ErrInvalidWidget, strings.Join(WidgetPeriods, ", "))
+	}
+
+	cm := cache.Get()
+	// updated_at 进入缓存键，编辑后立即生效
+	cacheKey := cache.Key("dashboard_widget:%d:%d:%s", w.ID, w.UpdatedAt, period)
+	if !noCache {
+		var cached WidgetData
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return &cached, nil
+		}
+	}
+
+	start, end := parsePeriodToTimestamps(period)
+	query, args, err := s.widgetQuery(w, start, end)
+	if err != nil {
+		return nil, err
+	}
+	logDB := s.logDB.WithContext(ctx)
+	rows, err := logDB.QueryWithTimeout(30*time.Second, logDB.RebindQuery(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &WidgetData{Widget: w, Period: period, StartTime: start, EndTime: end,
+		Rows: make([]WidgetDataRow, 0, len(rows)), GeneratedAt: time.Now().Unix()}
+	tzOffset := int64(localTZOffset())
+	for _, r := range rows {
+		row := WidgetDataRow{Value: round2(toFloat64(r["value"]))}
+		switch w.Dimension {
+		case WidgetDimensionNone:
+			row.Key, row.Label = "total", "total"
+		case WidgetDimensionDay:
+			day := time.Unix(toInt64(r["dim_key"])*86400, 0).UTC().Format("2006-01-02")
+			row.Key, row.Label = day, day
+		case WidgetDimensionHour:
+			ts := toInt64(r["dim_key"])*3600 - tzOffset
+			row.Key = fmt.Sprintf("%d", ts)
+			row.Label = time.Unix(ts, 0).In(ReportLocation()).Format("2006-01-02 15:00")
+		default:
+			row.Key, row.Label = toString(r["dim_key"]), toString(r["label"])
+			if w.Dimension == WidgetDimensionGroup && row.Key == "" {
+				row.Key = "default"
+			}
+			if row.Label == "" {
+				row.Label = row.Key
+			}
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	// 非时间维度按值降序，值相同时按键稳定排序
+	if !isTimeDimension(w.Dimension) {
+		sort.SliceStable(data.Rows, func(i, j int) bool {
+			if data.Rows[i].Value != data.Rows[j].Value {
+				return data.Rows[i].Value > data.Rows[j].Value
+			}
+			return data.Rows[i].Key < data.Rows[j].Key
+		})
+	}
+	for _, row := range data.Rows {
+		data.Total += row.Value
+	}
+	data.Total = round2(data.Total)
+	if w.Dimension != WidgetDimensionNone && (w.Metric == WidgetMetricUniqueUsers || w.Metric == WidgetMetricAvgUseTime) {
+		// 去重人数与平均耗时不能逐行相加，单独算整体值
+		total := w
+		total.Dimension = WidgetDimensionNone
+		if query, args, err = s.widgetQuery(total, start, end); err != nil {
+			return nil, err
+		}
+		row, err := logDB.QueryOneWithTimeout(30*time.Second, logDB.RebindQuery(query), args...)
+		if err != nil {
+			return nil, err
+		}
+		data.Total = round2(toFloat64(row["value"]))
+	}
+
+	cm.Set(cacheKey, data, scaledTTL(2*time.Minute))
+	return data, nil
+}
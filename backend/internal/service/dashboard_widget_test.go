@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestValidateDashboardWidget(t *testing.T) {
+	w := DashboardWidget{Name: " 模型额度 ", Dimension: "model", Filters: WidgetFilters{Models: []string{"gpt-4*", "gpt-4*", " ", "*"}}}
+	if err := validateDashboardWidget(&w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Name != "模型额度" || w.Metric != WidgetMetricRequests || w.Period != "24h" || w.Limit != 10 || w.Chart != "bar" ||
+		w.Filters.LogType != "consume" || len(w.Filters.Models) != 1 {
+		t.Errorf("normalized = %+v", w)
+	}
+	for _, bad := range []DashboardWidget{
+		{},
+		{Name: "x", Dimension: "ip"},
+		{Name: "x", Metric: "quota; DROP TABLE logs"},
+		{Name: "x", Period: "90d"},
+		{Name: "x", Chart: "radar"},
+		{Name: "x", Filters: WidgetFilters{LogType: "topup"}},
+		{Name: "x", Filters: WidgetFilters{UserIDs: []int64{0}}},
+	} {
+		if err := validateDashboardWidget(&bad); !errors.Is(err, ErrInvalidWidget) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+}
+
+func TestDashboardWidgetData(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { cache.Get().DeleteByPrefix(cache.Key("dashboard_widget:")) })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+		channel_id INTEGER, token_id INTEGER, token_name TEXT, model_name TEXT, type INTEGER, quota INTEGER,
+		prompt_tokens INTEGER, completion_tokens INTEGER, use_time INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix() - 60
+	for _, r := range [][]interface{}{
+		{1, "alice", 1, 11, "a-key", "gpt-4o", 2, 300, 100, 50, 2, now},
+		{1, "alice", 1, 11, "a-key", "gpt-4o-mini", 2, 100, 10, 5, 4, now},
+		{2, "bob", 2, 21, "b-key", "gpt-4o", 2, 500, 200, 100, 6, now},
+		{2, "bob", 2, 21, "b-key", "claude-3", 2, 700, 300, 100, 1, now - 2*86400},
+		{2, "bob", 2, 21, "b-key", "gpt-4o", 5, 0, 0, 0, 9, now},                // error log
+		{3, "carol", 1, 31, "c-key", "gpt-4o", 2, 900, 0, 0, 1, now - 40*86400}, // outside every period
+	} {
+		if _, err := db.Exec(`INSERT INTO logs (user_id, username, channel_id, token_id, token_name, model_name, type, quota,
+			prompt_tokens, completion_tokens, use_time, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	svc := NewDashboardWidgetService()
+	str := func(s string) *string { return &s }
+	byUser, err := svc.Create(ctx, "admin", DashboardWidgetInput{Name: str("用户额度"), Dimension: str("user"),
+		Metric: str("quota"), Filters: &WidgetFilters{Models: []string{"gpt-4o*"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Create(ctx, "admin", DashboardWidgetInput{Name: str("用户额度")}); !errors.Is(err, ErrInvalidWidget) {
+		t.Fatalf("duplicate name: %v", err)
+	}
+
+	data, err := svc.Data(ctx, byUser.ID, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Rows) != 2 || data.Rows[0].Label != "bob" || data.Rows[0].Value != 500 ||
+		data.Rows[1].Key != "1" || data.Rows[1].Value != 400 || data.Total != 900 {
+		t.Errorf("24h by user = %+v", data)
+	}
+	if data, err = svc.Data(ctx, byUser.ID, "7d", true); err != nil || data.Total != 900 {
+		t.Errorf("7d gpt-4o* = %+v, %v", data, err)
+	}
+	if _, err := svc.Data(ctx, byUser.ID, "1y", true); !errors.Is(err, ErrInvalidWidget) {
+		t.Errorf("bad period override: %v", err)
+	}
+
+	// Distinct users are totalled over the whole period, not summed per day
+	perDay, err := svc.Create(ctx, "admin", DashboardWidgetInput{Name: str("每日活跃"), Dimension: str("day"),
+		Metric: str("unique_users"), Period: str("7d"), Filters: &WidgetFilters{LogType: "all"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perDay.Chart != "line" {
+		t.Errorf("default chart = %q", perDay.Chart)
+	}
+	if data, err = svc.Data(ctx, perDay.ID, "", true); err != nil {
+		t.Fatal(err)
+	}
+	today := reportDayStart(time.Unix(now, 0)).Format("2006-01-02")
+	if len(data.Rows) != 2 || data.Rows[1].Key != today || data.Rows[1].Value != 2 || data.Rows[0].Value != 1 || data.Total != 2 {
+		t.Errorf("7d unique users per day = %+v", data)
+	}
+
+	if _, err := svc.Update(ctx, perDay.ID, DashboardWidgetInput{Dimension: str("group")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Data(ctx, perDay.ID, "", true); !errors.Is(err, ErrInvalidWidget) {
+		t.Errorf("group dimension without logs.group: %v", err)
+	}
+	if err := svc.Delete(ctx, perDay.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Data(ctx, perDay.ID, "", true); !errors.Is(err, ErrWidgetNotFound) {
+		t.Errorf("deleted widget: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dataMaskingSettingsKey = "data_masking"
+
+// DataMaskingSettings controls redaction of emails and IPs in user, risk and
+// IP responses. Enabled masks every session; otherwise only requests sending
+// X-Data-Masking: on are masked. Operator logins are masked on every endpoint
+// regardless (see middleware.DataMaskingMiddleware).
+type DataMaskingSettings struct {
+	Enabled    bool  `json:"enabled"`
+	MaskEmails bool  `json:"mask_emails"`
+	MaskIPs    bool  `json:"mask_ips"`
+	UpdatedAt  int64 `json:"updated_at"`
+}
+
+// DataMaskingSettingsInput is a partial update; nil fields keep their value
+type DataMaskingSettingsInput struct {
+	Enabled    *bool `json:"enabled"`
+	MaskEmails *bool `json:"mask_emails"`
+	MaskIPs    *bool `json:"mask_ips"`
+}
+
+// dataMasking caches the settings and pseudonym key: the masking middleware
+// consults them on every matching request
+var dataMasking struct {
+	sync.Mutex
+	loaded   bool
+	settings DataMaskingSettings
+	anon     *ExportAnonymizer
+}
+
+func defaultDataMaskingSettings() DataMaskingSettings {
+	return DataMaskingSettings{MaskEmails: true, MaskIPs: true}
+}
+
+// GetDataMaskingSettings returns the masking settings (defaults if never saved)
+func GetDataMaskingSettings(ctx context.Context) (DataMaskingSettings, error) {
+	settings := defaultDataMaskingSettings()
+	if _, err := loadLocalSetting(ctx, dataMaskingSettingsKey, &settings); err != nil {
+		return defaultDataMaskingSettings(), err
+	}
+	return settings, nil
+}
+
+// UpdateDataMaskingSettings applies a partial update
+func UpdateDataMaskingSettings(ctx context.Context, in DataMaskingSettingsInput) (DataMaskingSettings, error) {
+	settings, err := GetDataMaskingSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.MaskEmails != nil {
+		settings.MaskEmails = *in.MaskEmails
+	}
+	if in.MaskIPs != nil {
+		settings.MaskIPs = *in.MaskIPs
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, dataMaskingSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	dataMasking.Lock()
+	dataMasking.settings = settings
+	dataMasking.Unlock()
+	return settings, nil
+}
+
+// DataMasker redacts emails and IPs. Masked values keep a short keyed tag
+// (the export pseudonym key) so the same address still correlates across
+// rows and pages: "a***#3f9c2a@example.com", "203.0.113.*#7d01e4".
+type DataMasker struct {
+	anon   *ExportAnonymizer
+	emails bool
+	ips    bool
+}
+
+// CurrentDataMasking returns the cached settings and a masker for them
+func CurrentDataMasking(ctx context.Context) (DataMaskingSettings, *DataMasker, error) {
+	dataMasking.Lock()
+	defer dataMasking.Unlock()
+	if !dataMasking.loaded {
+		settings, err := GetDataMaskingSettings(ctx)
+		if err != nil {
+			return settings, nil, err
+		}
+		anon, err := NewExportAnonymizer(ctx)
+		if err != nil {
+			return settings, nil, err
+		}
+		dataMasking.settings, dataMasking.anon, dataMasking.loaded = settings, anon, true
+	}
+	s := dataMasking.settings
+	return s, &DataMasker{anon: dataMasking.anon, emails: s.MaskEmails, ips: s.MaskIPs}, nil
+}
+
+func (m *DataMasker) tag(kind, value string) string {
+	return m.anon.pseudonym("", kind, value)[:6]
+}
+
+// looksLikeEmail is a cheap check for "local@domain.tld" without spaces
+func looksLikeEmail(s string) bool {
+	at := strings.LastIndexByte(s, '@')
+	return at > 0 && at < len(s)-1 && strings.Contains(s[at+1:], ".") && !strings.ContainsAny(s, " \t\r\n<>")
+}
+
+// MaskEmail keeps the first character of the local part and the domain
+func (m *DataMasker) MaskEmail(s string) string {
+	if !looksLikeEmail(s) {
+		return s
+	}
+	at := strings.LastIndexByte(s, '@')
+	local, domain := s[:at], s[at+1:]
+	first := string([]rune(local)[:1])
+	return first + "***#" + m.tag("mask-email", strings.ToLower(s)) + "@" + domain
+}
+
+// MaskIP hides the last octet of IPv4 addresses and everything after the
+// /48 prefix of IPv6 addresses; other strings are returned unchanged
+func (m *DataMasker) MaskIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+	tag := "#" + m.tag("mask-ip", ip.String())
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.*%s", v4[0], v4[1], v4[2], tag)
+	}
+	prefix := ip.Mask(net.CIDRMask(48, 128)).String()
+	return strings.TrimSuffix(prefix, "::") + "::*" + tag
+}
+
+// maskString masks s if the whole value is an email or an IP address
+func (m *DataMasker) maskString(s string) string {
+	if m.emails && strings.IndexByte(s, '@') > 0 {
+		return m.MaskEmail(s)
+	}
+	if m.ips && (strings.IndexByte(s, '.') > 0 || strings.IndexByte(s, ':') >= 0) {
+		return m.MaskIP(s)
+	}
+	return s
+}
+
+func (m *DataMasker) maskValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return m.maskString(val)
+	case []interface{}:
+		for i := range val {
+			val[i] = m.maskValue(val[i])
+		}
+		return val
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			// IPs are also used as keys, e.g. per-IP counters
+			out[m.maskString(k)] = m.maskValue(child)
+		}
+		return out
+	}
+	return v
+}
+
+// MaskJSON masks every string value (and object key) of a JSON document that
+// is an email address or an IP. Numbers are kept verbatim. Invalid JSON is
+// returned unchanged.
+func (m *DataMasker) MaskJSON(body []byte) []byte {
+	if m == nil || (!m.emails && !m.ips) || len(body) == 0 {
+		return body
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return body
+	}
+	out, err := json.Marshal(m.maskValue(doc))
+	if err != nil {
+		return body
+	}
+	return out
+}
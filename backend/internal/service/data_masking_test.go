@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestDataMaskerValues(t *testing.T) {
+	m := &DataMasker{anon: &ExportAnonymizer{key: []byte("0123456789abcdef")}, emails: true, ips: true}
+
+	email := m.MaskEmail("Alice@Example.com")
+	if !strings.HasPrefix(email, "A***#") || !strings.HasSuffix(email, "@Example.com") || strings.Contains(email, "lice") {
+		t.Fatalf("email mask: %s", email)
+	}
+	if m.MaskEmail("alice@Example.com")[1:] != email[1:] {
+		t.Fatal("email tag should ignore case so the same address correlates")
+	}
+	if m.MaskEmail("bob@example.com") == email {
+		t.Fatal("different addresses should get different tags")
+	}
+
+	v4 := m.MaskIP("203.0.113.57")
+	if !strings.HasPrefix(v4, "203.0.113.*#") || len(v4) != len("203.0.113.*#")+6 {
+		t.Fatalf("ipv4 mask: %s", v4)
+	}
+	if m.MaskIP("203.0.113.58") == v4 || m.MaskIP("203.0.113.57") != v4 {
+		t.Fatal("ipv4 tags should be stable per address")
+	}
+	if v6 := m.MaskIP("2001:db8:abcd:12::1"); !strings.HasPrefix(v6, "2001:db8:abcd::*#") {
+		t.Fatalf("ipv6 mask: %s", v6)
+	}
+	for _, s := range []string{"gpt-4o", "v1.2", "not an @ email", "12:30"} {
+		if got := m.maskString(s); got != s {
+			t.Errorf("%q should be left alone, got %q", s, got)
+		}
+	}
+}
+
+func TestDataMaskerJSON(t *testing.T) {
+	m := &DataMasker{anon: &ExportAnonymizer{key: []byte("0123456789abcdef")}, emails: true, ips: false}
+	body := []byte(`{"success":true,"data":{"items":[{"id":9007199254740993,"email":"carol@example.org","ip":"198.51.100.7"}],"by_ip":{"198.51.100.7":3}}}`)
+
+	out := m.MaskJSON(body)
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("invalid json: %s", out)
+	}
+	s := string(out)
+	if strings.Contains(s, "carol@") || !strings.Contains(s, "198.51.100.7") || !strings.Contains(s, "9007199254740993") {
+		t.Fatalf("emails only, numbers verbatim: %s", s)
+	}
+
+	m.ips = true
+	s = string(m.MaskJSON(body))
+	if strings.Contains(s, "198.51.100.7") || !strings.Contains(s, `"198.51.100.*#`) {
+		t.Fatalf("ips in values and keys should be masked: %s", s)
+	}
+	if got := m.MaskJSON([]byte("not json")); string(got) != "not json" {
+		t.Fatal("invalid json should pass through")
+	}
+}
+
+func TestDataMaskingSettings(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	ctx := context.Background()
+	dataMasking.Lock()
+	dataMasking.loaded = false
+	dataMasking.Unlock()
+
+	settings, masker, err := CurrentDataMasking(ctx)
+	if err != nil || settings.Enabled || !settings.MaskEmails || !settings.MaskIPs || masker == nil {
+		t.Fatalf("defaults: %+v %v", settings, err)
+	}
+	enabled, ips := true, false
+	if _, err := UpdateDataMaskingSettings(ctx, DataMaskingSettingsInput{Enabled: &enabled, MaskIPs: &ips}); err != nil {
+		t.Fatal(err)
+	}
+	settings, masker, _ = CurrentDataMasking(ctx)
+	if !settings.Enabled || masker.ips || !masker.emails {
+		t.Fatalf("cached settings not refreshed: %+v", settings)
+	}
+}
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const dbStatsSettingsKey = "db_stats_advisor"
+
+var (
+	ErrInvalidDBStatsSettings = errors.New("invalid db stats settings")
+	ErrDBStatsUnsupported     = errors.New("statistics advisor requires PostgreSQL")
+	ErrDBStatsRunning         = errors.New("analyze already running")
+)
+
+// dbStatsPlanQueries are the representative GROUP BY queries whose planner
+// cost is compared before and after ANALYZE. $1, when present, is the unix
+// timestamp one day ago.
+var dbStatsPlanQueries = map[string]string{
+	"logs":     `SELECT user_id, COUNT(*) FROM logs WHERE created_at >= $1 GROUP BY user_id`,
+	"users":    `SELECT "group", COUNT(*) FROM users WHERE deleted_at IS NULL GROUP BY "group"`,
+	"tokens":   `SELECT user_id, COUNT(*) FROM tokens WHERE status = 1 GROUP BY user_id`,
+	"channels": `SELECT "group", COUNT(*) FROM channels GROUP BY "group"`,
+	"top_ups":  `SELECT user_id, COUNT(*) FROM top_ups WHERE create_time >= $1 GROUP BY user_id`,
+}
+
+// DBStatsSettings controls the statistics advisor and the scheduled ANALYZE
+type DBStatsSettings struct {
+	Enabled       bool     `json:"enabled"` // 维护窗口内自动 ANALYZE 过期的表
+	Tables        []string `json:"tables"`
+	StaleHours    int      `json:"stale_hours"`    // 距上次 ANALYZE 超过该时长视为过期
+	ModifiedRatio float64  `json:"modified_ratio"` // 上次 ANALYZE 后变更行数 / 存活行数超过该比例视为过期
+	WindowStart   string   `json:"window_start"`   // 维护窗口（报表时区，HH:MM），可跨零点
+	WindowEnd     string   `json:"window_end"`
+	UpdatedAt     int64    `json:"updated_at"`
+}
+
+// DBStatsSettingsInput is a partial update; nil fields keep their value
+type DBStatsSettingsInput struct {
+	Enabled       *bool     `json:"enabled"`
+	Tables        *[]string `json:"tables"`
+	StaleHours    *int      `json:"stale_hours"`
+	ModifiedRatio *float64  `json:"modified_ratio"`
+	WindowStart   *string   `json:"window_start"`
+	WindowEnd     *string   `json:"window_end"`
+}
+
+// DBTableStats is the statistics freshness of one table
+type DBTableStats struct {
+	Table             string  `json:"table"`
+	LiveRows          int64   `json:"live_rows"`
+	ModifiedSince     int64   `json:"modified_since_analyze"`
+	ModifiedRatio     float64 `json:"modified_ratio"`
+	LastAnalyzedAt    int64   `json:"last_analyzed_at"` // 手动与 autovacuum 中较近的一次，0 = 从未
+	LastAutoAnalyzeAt int64   `json:"last_autoanalyze_at"`
+	Stale             bool    `json:"stale"`
+	Reason            string  `json:"reason,omitempty"`
+	PlanCost          float64 `json:"plan_cost"` // 代表性 GROUP BY 查询的计划总成本
+	PlanRows          float64 `json:"plan_rows"`
+	Error             string  `json:"error,omitempty"`
+}
+
+// DBStatsReport is the /api/system/db-stats response
+type DBStatsReport struct {
+	Supported bool            `json:"supported"`
+	InWindow  bool            `json:"in_window"`
+	Tables    []DBTableStats  `json:"tables"`
+	Settings  DBStatsSettings `json:"settings"`
+	Runs      []DBAnalyzeRun  `json:"runs"`
+}
+
+// DBAnalyzeRun is one ANALYZE with the plan cost around it
+type DBAnalyzeRun struct {
+	ID         int64   `json:"id"`
+	Table      string  `json:"table"`
+	Trigger    string  `json:"trigger"` // schedule / manual
+	BeforeCost float64 `json:"before_cost"`
+	AfterCost  float64 `json:"after_cost"`
+	BeforeRows float64 `json:"before_rows"`
+	AfterRows  float64 `json:"after_rows"`
+	DurationMs int64   `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+	CreatedAt  int64   `json:"created_at"`
+}
+
+// dbAnalyzeMu serialises ANALYZE runs (background vs manual)
+var dbAnalyzeMu sync.Mutex
+
+func defaultDBStatsSettings() DBStatsSettings {
+	return DBStatsSettings{
+		Tables:        []string{"logs", "users"},
+		StaleHours:    24,
+		ModifiedRatio: 0.1,
+		WindowStart:   "03:00",
+		WindowEnd:     "05:00",
+	}
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(v string) (int, bool) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+func normalizeDBStatsSettings(s *DBStatsSettings) error {
+	seen := map[string]bool{}
+	tables := make([]string, 0, len(s.Tables))
+	for _, t := range s.Tables {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if _, ok := dbStatsPlanQueries[t]; !ok {
+			return fmt.Errorf("%w: 不支持的表 %q（logs / users / tokens / channels / top_ups）", ErrInvalidDBStatsSettings, t)
+		}
+		seen[t] = true
+		tables = append(tables, t)
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("%w: tables 不能为空", ErrInvalidDBStatsSettings)
+	}
+	s.Tables = tables
+	s.StaleHours = clampSetting(s.StaleHours, 1, 720, 24)
+	if s.ModifiedRatio <= 0 || s.ModifiedRatio > 1 {
+		return fmt.Errorf("%w: modified_ratio 需在 (0, 1] 之间", ErrInvalidDBStatsSettings)
+	}
+	for _, v := range []string{s.WindowStart, s.WindowEnd} {
+		if _, ok := parseClock(v); !ok {
+			return fmt.Errorf("%w: 维护窗口需为 HH:MM，得到 %q", ErrInvalidDBStatsSettings, v)
+		}
+	}
+	return nil
+}
+
+// inWindow reports whether t falls in [start, end) local time; the window
+// may wrap past midnight and start == end means any time
+func (s DBStatsSettings) inWindow(t time.Time) bool {
+	start, _ := parseClock(s.WindowStart)
+	end, _ := parseClock(s.WindowEnd)
+	t = t.In(ReportLocation())
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return m >= start && m < end
+	default:
+		return m >= start || m < end
+	}
+}
+
+// staleReason explains why a table's statistics are stale, "" if fresh
+func (s DBStatsSettings) staleReason(t DBTableStats, now time.Time) string {
+	switch {
+	case t.LastAnalyzedAt == 0:
+		return "从未 ANALYZE"
+	case now.Unix()-t.LastAnalyzedAt > int64(s.StaleHours)*3600:
+		return fmt.Sprintf("距上次 ANALYZE 已超过 %d 小时", s.StaleHours)
+	case t.ModifiedRatio >= s.ModifiedRatio:
+		return fmt.Sprintf("上次 ANALYZE 后变更 %.0f%% 的行", t.ModifiedRatio*100)
+	}
+	return ""
+}
+
+// GetDBStatsSettings returns the advisor settings (defaults if never saved)
+func GetDBStatsSettings(ctx context.Context) (DBStatsSettings, error) {
+	settings := defaultDBStatsSettings()
+	if _, err := loadLocalSetting(ctx, dbStatsSettingsKey, &settings); err != nil {
+		return defaultDBStatsSettings(), err
+	}
+	if err := normalizeDBStatsSettings(&settings); err != nil {
+		return defaultDBStatsSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateDBStatsSettings applies a partial update
+func UpdateDBStatsSettings(ctx context.Context, in DBStatsSettingsInput) (DBStatsSettings, error) {
+	settings, err := GetDBStatsSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Tables != nil {
+		settings.Tables = *in.Tables
+	}
+	if in.StaleHours != nil {
+		settings.StaleHours = *in.StaleHours
+	}
+	if in.ModifiedRatio != nil {
+		settings.ModifiedRatio = *in.ModifiedRatio
+	}
+	if in.WindowStart != nil {
+		settings.WindowStart = *in.WindowStart
+	}
+	if in.WindowEnd != nil {
+		settings.WindowEnd = *in.WindowEnd
+	}
+	if err := normalizeDBStatsSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, dbStatsSettingsKey, settings)
+}
+
+func ensureDBStatsTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS db_analyze_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			table_name TEXT NOT NULL,
+			trigger TEXT NOT NULL,
+			before_cost REAL NOT NULL DEFAULT 0,
+			after_cost REAL NOT NULL DEFAULT 0,
+			before_rows REAL NOT NULL DEFAULT 0,
+			after_rows REAL NOT NULL DEFAULT 0,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`)
+	return err
+}
+
+func openDBStatsStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureDBStatsTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// dbStatsManager returns the database holding table: logs may live in a
+// separate log database
+func dbStatsManager(ctx context.Context, table string) *database.Manager {
+	if table == "logs" {
+		return database.GetLog().WithContext(ctx)
+	}
+	return database.Get().WithContext(ctx)
+}
+
+func dbStatsSupported() bool {
+	return database.Get().IsPG && database.GetLog().IsPG
+}
+
+// parsePlanCost reads the top node's total cost and row estimate from
+// EXPLAIN (FORMAT JSON) output
+func parsePlanCost(raw []byte) (cost, rows float64, err error) {
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+			PlanRows  float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil {
+		return 0, 0, err
+	}
+	if len(plans) == 0 {
+		return 0, 0, errors.New("empty plan")
+	}
+	return plans[0].Plan.TotalCost, plans[0].Plan.PlanRows, nil
+}
+
+// planCost runs EXPLAIN on the table's representative query
+func planCost(ctx context.Context, table string) (float64, float64, error) {
+	db := dbStatsManager(ctx, table)
+	query := dbStatsPlanQueries[table]
+	var args []interface{}
+	if strings.Contains(query, "$1") {
+		args = append(args, time.Now().Unix()-86400)
+	}
+	var raw []byte
+	if err := db.DB.QueryRowContext(db.Context(), "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&raw); err != nil {
+		return 0, 0, err
+	}
+	return parsePlanCost(raw)
+}
+
+// tableStats reads pg_stat_user_tables for one table
+func tableStats(ctx context.Context, table string, settings DBStatsSettings, now time.Time) DBTableStats {
+	t := DBTableStats{Table: table}
+	db := dbStatsManager(ctx, table)
+	row, err := db.QueryOne(`
+		SELECT n_live_tup, n_mod_since_analyze,
+			COALESCE(EXTRACT(EPOCH FROM GREATEST(last_analyze, last_autoanalyze))::bigint, 0) AS last_analyzed,
+			COALESCE(EXTRACT(EPOCH FROM last_autoanalyze)::bigint, 0) AS last_autoanalyze
+		FROM pg_stat_user_tables WHERE schemaname = current_schema() AND relname = $1`, table)
+	if err != nil {
+		t.Error = err.Error()
+		return t
+	}
+	if row == nil {
+		t.Error = "表不存在"
+		return t
+	}
+	t.LiveRows = toInt64(row["n_live_tup"])
+	t.ModifiedSince = toInt64(row["n_mod_since_analyze"])
+	t.LastAnalyzedAt = toInt64(row["last_analyzed"])
+	t.LastAutoAnalyzeAt = toInt64(row["last_autoanalyze"])
+	if t.LiveRows > 0 {
+		t.ModifiedRatio = math.Round(float64(t.ModifiedSince)/float64(t.LiveRows)*1000) / 1000
+	}
+	t.Reason = settings.staleReason(t, now)
+	t.Stale = t.Reason != ""
+	if t.PlanCost, t.PlanRows, err = planCost(ctx, table); err != nil {
+		t.Error = "explain: " + err.Error()
+	}
+	return t
+}
+
+// DBStatsReportNow checks the statistics freshness of the configured tables
+func DBStatsReportNow(ctx context.Context) (*DBStatsReport, error) {
+	settings, err := GetDBStatsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	report := &DBStatsReport{Supported: dbStatsSupported(), InWindow: settings.inWindow(now), Tables: []DBTableStats{}, Settings: settings}
+	if report.Supported {
+		for _, table := range settings.Tables {
+			report.Tables = append(report.Tables, tableStats(ctx, table, settings, now))
+		}
+	}
+	if report.Runs, err = ListDBAnalyzeRuns(ctx, 20); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// AnalyzeTables runs ANALYZE on tables (all configured tables when empty),
+// recording the plan cost of the representative query before and after
+func AnalyzeTables(ctx context.Context, tables []string, trigger string) ([]DBAnalyzeRun, error) {
+	if !dbStatsSupported() {
+		return nil, ErrDBStatsUnsupported
+	}
+	settings, err := GetDBStatsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		tables = settings.Tables
+	}
+	for _, t := range tables {
+		if _, ok := dbStatsPlanQueries[t]; !ok {
+			return nil, fmt.Errorf("%w: 不支持的表 %q", ErrInvalidDBStatsSettings, t)
+		}
+	}
+	if !dbAnalyzeMu.TryLock() {
+		return nil, ErrDBStatsRunning
+	}
+	defer dbAnalyzeMu.Unlock()
+
+	store, err := openDBStatsStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	runs := make([]DBAnalyzeRun, 0, len(tables))
+	for _, table := range tables {
+		run := DBAnalyzeRun{Table: table, Trigger: trigger, CreatedAt: time.Now().Unix()}
+		run.BeforeCost, run.BeforeRows, _ = planCost(ctx, table)
+		started := time.Now()
+		// table 已在白名单内校验，可直接拼接
+		if _, err := dbStatsManager(ctx, table).Execute("ANALYZE " + table); err != nil {
+			run.Error = err.Error()
+		} else {
+			run.AfterCost, run.AfterRows, _ = planCost(ctx, table)
+		}
+		run.DurationMs = time.Since(started).Milliseconds()
+
+		res, err := store.ExecContext(ctx, `
+			INSERT INTO db_analyze_runs (table_name, trigger, before_cost, after_cost, before_rows, after_rows, duration_ms, error, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			run.Table, run.Trigger, run.BeforeCost, run.AfterCost, run.BeforeRows, run.AfterRows, run.DurationMs, run.Error, run.CreatedAt)
+		if err != nil {
+			return runs, err
+		}
+		run.ID, _ = res.LastInsertId()
+		if run.Error == "" {
+			logger.L.System(fmt.Sprintf("[统计信息] ANALYZE %s 完成 (%s)，耗时 %dms，计划成本 %.0f → %.0f",
+				table, trigger, run.DurationMs, run.BeforeCost, run.AfterCost))
+		} else {
+			logger.L.Warn(fmt.Sprintf("[统计信息] ANALYZE %s 失败: %s", table, run.Error))
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// RunScheduledAnalyze analyzes the stale tables when enabled and inside the
+// maintenance window. Returns the runs (nil when nothing was due).
+func RunScheduledAnalyze(ctx context.Context) ([]DBAnalyzeRun, error) {
+	if !dbStatsSupported() {
+		return nil, nil
+	}
+	settings, err := GetDBStatsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !settings.Enabled || !settings.inWindow(now) {
+		return nil, nil
+	}
+	var stale []string
+	for _, table := range settings.Tables {
+		if t := tableStats(ctx, table, settings, now); t.Stale && t.Error == "" {
+			stale = append(stale, table)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	return AnalyzeTables(ctx, stale, "schedule")
+}
+
+// ListDBAnalyzeRuns returns the latest ANALYZE runs, newest first
+func ListDBAnalyzeRuns(ctx context.Context, limit int) ([]DBAnalyzeRun, error) {
+	store, err := openDBStatsStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, table_name, trigger, before_cost, after_cost, before_rows, after_rows, duration_ms, error, created_at
+		FROM db_analyze_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []DBAnalyzeRun{}
+	for rows.Next() {
+		var r DBAnalyzeRun
+		if err := rows.Scan(&r.ID, &r.Table, &r.Trigger, &r.BeforeCost, &r.AfterCost, &r.BeforeRows, &r.AfterRows,
+			&r.DurationMs, &r.Error, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
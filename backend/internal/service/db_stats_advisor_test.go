@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestDBStatsSettingsValidation(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	ctx := context.Background()
+
+	settings, err := GetDBStatsSettings(ctx)
+	if err != nil || settings.Enabled || len(settings.Tables) != 2 || settings.WindowStart != "03:00" {
+		t.Fatalf("defaults: %+v %v", settings, err)
+	}
+	bad := []string{"logs", "pg_class"}
+	if _, err := UpdateDBStatsSettings(ctx, DBStatsSettingsInput{Tables: &bad}); !errors.Is(err, ErrInvalidDBStatsSettings) {
+		t.Fatalf("unknown table should be rejected, got %v", err)
+	}
+	badWindow := "25:00"
+	if _, err := UpdateDBStatsSettings(ctx, DBStatsSettingsInput{WindowStart: &badWindow}); !errors.Is(err, ErrInvalidDBStatsSettings) {
+		t.Fatalf("invalid window should be rejected, got %v", err)
+	}
+	enabled, tables, start, end := true, []string{" logs ", "logs", "tokens"}, "23:30", "01:00"
+	settings, err = UpdateDBStatsSettings(ctx, DBStatsSettingsInput{Enabled: &enabled, Tables: &tables, WindowStart: &start, WindowEnd: &end})
+	if err != nil || !settings.Enabled || len(settings.Tables) != 2 || settings.Tables[1] != "tokens" {
+		t.Fatalf("update: %+v %v", settings, err)
+	}
+	if reloaded, _ := GetDBStatsSettings(ctx); reloaded.WindowStart != "23:30" || !reloaded.Enabled {
+		t.Fatalf("settings not persisted: %+v", reloaded)
+	}
+}
+
+func TestDBStatsMaintenanceWindow(t *testing.T) {
+	loc := ReportLocation()
+	at := func(hh, mm int) time.Time { return time.Date(2026, 1, 1, hh, mm, 0, 0, loc) }
+
+	s := DBStatsSettings{WindowStart: "03:00", WindowEnd: "05:00"}
+	if !s.inWindow(at(3, 0)) || !s.inWindow(at(4, 59)) || s.inWindow(at(5, 0)) || s.inWindow(at(2, 59)) {
+		t.Fatal("plain window boundaries")
+	}
+	s = DBStatsSettings{WindowStart: "23:30", WindowEnd: "01:00"}
+	if !s.inWindow(at(23, 45)) || !s.inWindow(at(0, 30)) || s.inWindow(at(1, 0)) || s.inWindow(at(12, 0)) {
+		t.Fatal("window wrapping midnight")
+	}
+	s = DBStatsSettings{WindowStart: "00:00", WindowEnd: "00:00"}
+	if !s.inWindow(at(15, 0)) {
+		t.Fatal("equal start and end should mean any time")
+	}
+}
+
+func TestDBStatsStaleReason(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := DBStatsSettings{StaleHours: 24, ModifiedRatio: 0.1}
+	cases := []struct {
+		stats DBTableStats
+		stale bool
+	}{
+		{DBTableStats{}, true},
+		{DBTableStats{LastAnalyzedAt: now.Unix() - 25*3600}, true},
+		{DBTableStats{LastAnalyzedAt: now.Unix() - 3600, ModifiedRatio: 0.2}, true},
+		{DBTableStats{LastAnalyzedAt: now.Unix() - 3600, ModifiedRatio: 0.05}, false},
+	}
+	for i, c := range cases {
+		if got := s.staleReason(c.stats, now) != ""; got != c.stale {
+			t.Errorf("case %d: stale=%v, want %v", i, got, c.stale)
+		}
+	}
+}
+
+func TestParsePlanCost(t *testing.T) {
+	raw := []byte(`[{"Plan": {"Node Type": "Aggregate", "Startup Cost": 1.5, "Total Cost": 1234.56, "Plan Rows": 42, "Plans": []}}]`)
+	cost, rows, err := parsePlanCost(raw)
+	if err != nil || cost != 1234.56 || rows != 42 {
+		t.Fatalf("got cost=%v rows=%v err=%v", cost, rows, err)
+	}
+	if _, _, err := parsePlanCost([]byte(`[]`)); err == nil {
+		t.Fatal("empty plan should fail")
+	}
+}
+
+// TestDBStatsUnsupportedOnSQLite 验证非 PostgreSQL 时报告 supported=false 且拒绝 ANALYZE。
+func TestDBStatsUnsupportedOnSQLite(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	installSQLiteForTests(t)
+	ctx := context.Background()
+
+	report, err := DBStatsReportNow(ctx)
+	if err != nil || report.Supported || len(report.Tables) != 0 || report.Runs == nil {
+		t.Fatalf("report: %+v %v", report, err)
+	}
+	if _, err := AnalyzeTables(ctx, nil, "manual"); !errors.Is(err, ErrDBStatsUnsupported) {
+		t.Fatalf("analyze on sqlite: %v", err)
+	}
+	if runs, err := RunScheduledAnalyze(ctx); err != nil || runs != nil {
+		t.Fatalf("scheduled analyze on sqlite: %v %v", runs, err)
+	}
+}
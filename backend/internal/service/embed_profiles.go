@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const embedProfilesSettingsKey = "embed_profiles"
+
+var (
+	ErrEmbedProfileNotFound = errors.New("embed profile not found")
+	ErrInvalidEmbedProfile  = errors.New("invalid embed profile")
+)
+
+// Embed dark mode options
+var AvailableEmbedDarkModes = []string{"auto", "light", "dark"}
+
+// EmbedThemeColors overrides individual colors of the preset theme ("" = keep)
+type EmbedThemeColors struct {
+	Primary    string `json:"primary"`
+	Background string `json:"background"`
+	Text       string `json:"text"`
+	Accent     string `json:"accent"`
+}
+
+// EmbedProfile is a named theme for public embeds (?profile=name), so one
+// deployment can serve differently styled embeds from the same endpoints
+type EmbedProfile struct {
+	Name      string           `json:"name"`
+	Theme     string           `json:"theme"`     // AvailableThemes 中的预设
+	DarkMode  string           `json:"dark_mode"` // auto | light | dark
+	Font      string           `json:"font"`      // CSS font-family，"" 使用主题默认
+	Colors    EmbedThemeColors `json:"colors"`
+	UpdatedAt int64            `json:"updated_at"`
+}
+
+var (
+	embedProfileName  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+	embedProfileColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	// font-family values only: no ; { } ( ) so nothing can escape the declaration
+	embedProfileFont = regexp.MustCompile(`^[A-Za-z0-9 ,'"_-]{0,120}$`)
+)
+
+func normalizeEmbedProfile(p *EmbedProfile) error {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+	if !embedProfileName.MatchString(p.Name) {
+		return fmt.Errorf("%w: name must match [a-z0-9_-], up to 32 characters", ErrInvalidEmbedProfile)
+	}
+
+	p.Theme = strings.TrimSpace(p.Theme)
+	if mapped, ok := LegacyThemeMap[p.Theme]; ok {
+		p.Theme = mapped
+	}
+	if p.Theme == "" {
+		p.Theme = DefaultTheme
+	}
+	validTheme := false
+	for _, t := range AvailableThemes {
+		if t == p.Theme {
+			validTheme = true
+			break
+		}
+	}
+	if !validTheme {
+		return fmt.Errorf("%w: unknown theme %q", ErrInvalidEmbedProfile, p.Theme)
+	}
+
+	p.DarkMode = strings.ToLower(strings.TrimSpace(p.DarkMode))
+	if p.DarkMode == "" {
+		p.DarkMode = "auto"
+	}
+	validMode := false
+	for _, m := range AvailableEmbedDarkModes {
+		if m == p.DarkMode {
+			validMode = true
+			break
+		}
+	}
+	if !validMode {
+		return fmt.Errorf("%w: dark_mode must be auto, light or dark", ErrInvalidEmbedProfile)
+	}
+
+	p.Font = strings.TrimSpace(p.Font)
+	if !embedProfileFont.MatchString(p.Font) {
+		return fmt.Errorf("%w: font must be a plain font-family list", ErrInvalidEmbedProfile)
+	}
+
+	for field, color := range map[string]*string{
+		"primary":    &p.Colors.Primary,
+		"background": &p.Colors.Background,
+		"text":       &p.Colors.Text,
+		"accent":     &p.Colors.Accent,
+	} {
+		*color = strings.TrimSpace(*color)
+		if *color != "" && !embedProfileColor.MatchString(*color) {
+			return fmt.Errorf("%w: colors.%s must be a hex color", ErrInvalidEmbedProfile, field)
+		}
+	}
+	return nil
+}
+
+func (s *ModelStatusService) loadEmbedProfiles(ctx context.Context) (map[string]EmbedProfile, error) {
+	profiles := map[string]EmbedProfile{}
+	if _, err := loadLocalSetting(ctx, embedProfilesSettingsKey, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// ListEmbedProfiles returns all embed profiles sorted by name
+func (s *ModelStatusService) ListEmbedProfiles(ctx context.Context) ([]EmbedProfile, error) {
+	profiles, err := s.loadEmbedProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]EmbedProfile, 0, len(profiles))
+	for _, p := range profiles {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// GetEmbedProfile returns one profile by name
+func (s *ModelStatusService) GetEmbedProfile(ctx context.Context, name string) (EmbedProfile, error) {
+	profiles, err := s.loadEmbedProfiles(ctx)
+	if err != nil {
+		return EmbedProfile{}, err
+	}
+	p, ok := profiles[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return EmbedProfile{}, ErrEmbedProfileNotFound
+	}
+	return p, nil
+}
+
+// SaveEmbedProfile creates or replaces a profile
+func (s *ModelStatusService) SaveEmbedProfile(ctx context.Context, p EmbedProfile) (EmbedProfile, error) {
+	if err := normalizeEmbedProfile(&p); err != nil {
+		return p, err
+	}
+	profiles, err := s.loadEmbedProfiles(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.UpdatedAt = time.Now().Unix()
+	profiles[p.Name] = p
+	return p, saveLocalSetting(ctx, embedProfilesSettingsKey, profiles)
+}
+
+// DeleteEmbedProfile removes a profile
+func (s *ModelStatusService) DeleteEmbedProfile(ctx context.Context, name string) error {
+	profiles, err := s.loadEmbedProfiles(ctx)
+	if err != nil {
+		return err
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := profiles[name]; !ok {
+		return ErrEmbedProfileNotFound
+	}
+	delete(profiles, name)
+	return saveLocalSetting(ctx, embedProfilesSettingsKey, profiles)
+}
+
+// ResolveEmbedTheme returns the theme block for an embed request: the named
+// profile when given, otherwise the global model status theme
+func (s *ModelStatusService) ResolveEmbedTheme(ctx context.Context, profile string) (map[string]interface{}, error) {
+	if strings.TrimSpace(profile) == "" {
+		return map[string]interface{}{
+			"profile":   "",
+			"theme":     s.GetConfig()["theme"],
+			"dark_mode": "auto",
+			"font":      "",
+			"colors":    EmbedThemeColors{},
+		}, nil
+	}
+	p, err := s.GetEmbedProfile(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"profile":   p.Name,
+		"theme":     p.Theme,
+		"dark_mode": p.DarkMode,
+		"font":      p.Font,
+		"colors":    p.Colors,
+	}, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestNormalizeEmbedProfileRejectsUnsafeValues(t *testing.T) {
+	ok := EmbedProfile{Name: " Brand-A ", Theme: "dark", Font: `"Inter", sans-serif`, Colors: EmbedThemeColors{Primary: "#ff6600"}}
+	if err := normalizeEmbedProfile(&ok); err != nil {
+		t.Fatalf("valid profile rejected: %v", err)
+	}
+	if ok.Name != "brand-a" || ok.Theme != "obsidian" || ok.DarkMode != "auto" {
+		t.Fatalf("unexpected normalization: %+v", ok)
+	}
+
+	bad := []EmbedProfile{
+		{Name: "has space"},
+		{Name: "x", Theme: "no-such-theme"},
+		{Name: "x", DarkMode: "sepia"},
+		{Name: "x", Font: "Inter; } body { display:none"},
+		{Name: "x", Colors: EmbedThemeColors{Background: "url(javascript:alert(1))"}},
+	}
+	for _, p := range bad {
+		if err := normalizeEmbedProfile(&p); !errors.Is(err, ErrInvalidEmbedProfile) {
+			t.Errorf("profile %+v should be rejected, got %v", p, err)
+		}
+	}
+}
+
+func TestResolveEmbedThemeUsesNamedProfile(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	svc := NewModelStatusService()
+	ctx := context.Background()
+	if _, err := svc.SaveEmbedProfile(ctx, EmbedProfile{Name: "partner", Theme: "neon", DarkMode: "dark", Colors: EmbedThemeColors{Accent: "#0f0"}}); err != nil {
+		t.Fatalf("SaveEmbedProfile: %v", err)
+	}
+
+	theme, err := svc.ResolveEmbedTheme(ctx, "partner")
+	if err != nil || theme["theme"] != "neon" || theme["dark_mode"] != "dark" {
+		t.Fatalf("expected the partner profile, got %v %v", theme, err)
+	}
+	if theme, err = svc.ResolveEmbedTheme(ctx, ""); err != nil || theme["profile"] != "" {
+		t.Fatalf("no profile should fall back to the global theme, got %v %v", theme, err)
+	}
+	if _, err := svc.ResolveEmbedTheme(ctx, "missing"); !errors.Is(err, ErrEmbedProfileNotFound) {
+		t.Fatalf("unknown profile should be reported, got %v", err)
+	}
+
+	if err := svc.DeleteEmbedProfile(ctx, "partner"); err != nil {
+		t.Fatalf("DeleteEmbedProfile: %v", err)
+	}
+	if list, _ := svc.ListEmbedProfiles(ctx); len(list) != 0 {
+		t.Fatalf("expected no profiles after delete, got %v", list)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EmbedConfigKeys are the keys every embed config response carries. The
+// embed page reads them without null checks, so each one always has a value
+// of the documented type — even when Redis is cold or holds data written by
+// an older release.
+var EmbedConfigKeys = []string{
+	"time_window", "theme", "refresh_interval", "sort_mode",
+	"custom_order", "selected_models", "custom_groups", "site_title",
+}
+
+// EmbedCustomGroupKeys are the keys of each custom_groups entry
+var EmbedCustomGroupKeys = []string{"id", "name", "icon", "models"}
+
+const defaultRefreshInterval = 60
+
+func isEmbedOption(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEmbedTimeWindow falls back to the default for unknown windows
+func normalizeEmbedTimeWindow(window string) string {
+	if isEmbedOption(AvailableTimeWindows, window) {
+		return window
+	}
+	return DefaultTimeWindow
+}
+
+// normalizeEmbedTheme maps legacy names and falls back to the default theme
+func normalizeEmbedTheme(theme string) string {
+	if mapped, ok := LegacyThemeMap[theme]; ok {
+		theme = mapped
+	}
+	if isEmbedOption(AvailableThemes, theme) {
+		return theme
+	}
+	return DefaultTheme
+}
+
+func normalizeEmbedRefreshInterval(interval int) int {
+	for _, v := range AvailableRefreshIntervals {
+		if v == interval {
+			return interval
+		}
+	}
+	return defaultRefreshInterval
+}
+
+func normalizeEmbedSortMode(mode string) string {
+	if isEmbedOption(AvailableSortModes, mode) {
+		return mode
+	}
+	return "default"
+}
+
+// nonNilStrings drops blanks and turns nil into an empty list
+func nonNilStrings(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// normalizeEmbedCustomGroups gives every group an id, a name, an icon and a
+// model list; entries without any usable identity are dropped
+func normalizeEmbedCustomGroups(groups []map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(groups))
+	for i, g := range groups {
+		if g == nil {
+			continue
+		}
+		id := strings.TrimSpace(toString(g["id"]))
+		name := strings.TrimSpace(toString(g["name"]))
+		if id == "" && name == "" {
+			continue
+		}
+		if id == "" {
+			id = fmt.Sprintf("group-%d", i+1)
+		}
+		if name == "" {
+			name = id
+		}
+		var models []string
+		switch v := g["models"].(type) {
+		case []string:
+			models = v
+		case []interface{}:
+			for _, m := range v {
+				if s, ok := m.(string); ok {
+					models = append(models, s)
+				}
+			}
+		}
+		entry := make(map[string]interface{}, len(g)+4)
+		for k, v := range g {
+			entry[k] = v
+		}
+		entry["id"] = id
+		entry["name"] = name
+		entry["icon"] = strings.TrimSpace(toString(g["icon"]))
+		entry["models"] = nonNilStrings(models)
+		out = append(out, entry)
+	}
+	return out
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const endpointSLOSettingsKey = "endpoint_slo"
+
+// endpointSampleCap bounds the latency samples kept per route; busy routes
+// keep the most recent ones, so the window is effectively shorter for them
+const endpointSampleCap = 1000
+
+var ErrInvalidEndpointSLO = errors.New("invalid endpoint slo config")
+
+// EndpointSLOSettings configures the p95 latency objectives of our own API.
+// Routes are gin route templates prefixed with the method, e.g.
+// "GET /api/risk/users/:user_id/analysis".
+type EndpointSLOSettings struct {
+	Enabled       bool           `json:"enabled"`        // 定时检查并推送 endpoint_slo 事件
+	DefaultP95Ms  int            `json:"default_p95_ms"` // 未单独配置的路由的 p95 目标
+	Targets       map[string]int `json:"targets"`        // 路由 → p95 目标毫秒，0 = 不考核
+	WindowMinutes int            `json:"window_minutes"` // 统计窗口
+	MinSamples    int            `json:"min_samples"`    // 窗口内请求数不足时不判定
+	UpdatedAt     int64          `json:"updated_at"`
+}
+
+// EndpointSLOSettingsInput supports partial update; targets replace the map
+type EndpointSLOSettingsInput struct {
+	Enabled       *bool           `json:"enabled"`
+	DefaultP95Ms  *int            `json:"default_p95_ms"`
+	Targets       *map[string]int `json:"targets"`
+	WindowMinutes *int            `json:"window_minutes"`
+	MinSamples    *int            `json:"min_samples"`
+}
+
+// EndpointLatency is one route's latency over the window
+type EndpointLatency struct {
+	Route     string  `json:"route"`
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"` // 5xx 响应数
+	P50Ms     int64   `json:"p50_ms"`
+	P95Ms     int64   `json:"p95_ms"`
+	P99Ms     int64   `json:"p99_ms"`
+	MaxMs     int64   `json:"max_ms"`
+	TargetMs  int     `json:"target_ms"` // 0 = 不考核
+	Burn      float64 `json:"burn"`      // p95 / 目标
+	Violating bool    `json:"violating"`
+	Alerting  bool    `json:"alerting"` // 已发出告警且尚未恢复
+}
+
+// EndpointSLOReport is the per-route view served at /api/system/slo
+type EndpointSLOReport struct {
+	WindowMinutes int               `json:"window_minutes"`
+	DefaultP95Ms  int               `json:"default_p95_ms"`
+	Routes        []EndpointLatency `json:"routes"`
+	Violations    int               `json:"violations"`
+	Since         int64             `json:"since"` // 进程启动后开始采样的时间
+}
+
+type endpointSample struct {
+	at     int64 // unix ms
+	ms     int64
+	failed bool
+}
+
+// endpointSamples is a ring buffer of recent requests to one route
+type endpointSamples struct {
+	items []endpointSample
+	next  int
+}
+
+// endpointStats holds the in-process samples; they are lost on restart,
+// which is fine for a rolling window of minutes
+var endpointStats = struct {
+	sync.Mutex
+	routes   map[string]*endpointSamples
+	alerting map[string]bool
+	since    int64
+}{routes: map[string]*endpointSamples{}, alerting: map[string]bool{}, since: time.Now().Unix()}
+
+// RecordEndpointLatency stores one request of route (gin template) for SLO
+// tracking. Called by the request logger middleware.
+func RecordEndpointLatency(method, route string, took time.Duration, status int) {
+	if route == "" {
+		return
+	}
+	key := method + " " + route
+	sample := endpointSample{at: time.Now().UnixMilli(), ms: took.Milliseconds(), failed: status >= 500}
+
+	endpointStats.Lock()
+	defer endpointStats.Unlock()
+	buf := endpointStats.routes[key]
+	if buf == nil {
+		buf = &endpointSamples{}
+		endpointStats.routes[key] = buf
+	}
+	if len(buf.items) < endpointSampleCap {
+		buf.items = append(buf.items, sample)
+		return
+	}
+	buf.items[buf.next] = sample
+	buf.next = (buf.next + 1) % endpointSampleCap
+}
+
+// ResetEndpointLatency drops every sample and alert state
+func ResetEndpointLatency() {
+	endpointStats.Lock()
+	defer endpointStats.Unlock()
+	endpointStats.routes = map[string]*endpointSamples{}
+	endpointStats.alerting = map[string]bool{}
+	endpointStats.since = time.Now().Unix()
+}
+
+func defaultEndpointSLOSettings() EndpointSLOSettings {
+	return EndpointSLOSettings{
+		DefaultP95Ms:  3000,
+		Targets:       map[string]int{},
+		WindowMinutes: 15,
+		MinSamples:    20,
+	}
+}
+
+func normalizeEndpointSLOSettings(s *EndpointSLOSettings) error {
+	if s.DefaultP95Ms < 0 || s.DefaultP95Ms > 600000 {
+		return fmt.Errorf("%w: default_p95_ms 需在 0-600000 之间", ErrInvalidEndpointSLO)
+	}
+	s.WindowMinutes = clampSetting(s.WindowMinutes, 1, 24*60, 15)
+	s.MinSamples = clampSetting(s.MinSamples, 1, endpointSampleCap, 20)
+	targets := make(map[string]int, len(s.Targets))
+	for route, ms := range s.Targets {
+		key, err := normalizeEndpointRoute(route)
+		if err != nil {
+			return err
+		}
+		if ms < 0 || ms > 600000 {
+			return fmt.Errorf("%w: %s 的目标需在 0-600000 毫秒之间", ErrInvalidEndpointSLO, key)
+		}
+		targets[key] = ms
+	}
+	s.Targets = targets
+	return nil
+}
+
+// normalizeEndpointRoute accepts "GET /api/x" or "get  /api/x"
+func normalizeEndpointRoute(route string) (string, error) {
+	fields := strings.Fields(route)
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "/api/") {
+		return "", fmt.Errorf("%w: 路由需形如 \"GET /api/dashboard/overview\"，收到 %q", ErrInvalidEndpointSLO, route)
+	}
+	return strings.ToUpper(fields[0]) + " " + fields[1], nil
+}
+
+func (s EndpointSLOSettings) targetFor(route string) int {
+	if ms, ok := s.Targets[route]; ok {
+		return ms
+	}
+	return s.DefaultP95Ms
+}
+
+// GetEndpointSLOSettings returns the SLO settings (defaults if never saved)
+func GetEndpointSLOSettings(ctx context.Context) (EndpointSLOSettings, error) {
+	settings := defaultEndpointSLOSettings()
+	if _, err := loadLocalSetting(ctx, endpointSLOSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeEndpointSLOSettings(&settings); err != nil {
+		return defaultEndpointSLOSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateEndpointSLOSettings applies a partial update
+func UpdateEndpointSLOSettings(ctx context.Context, in EndpointSLOSettingsInput) (EndpointSLOSettings, error) {
+	settings, err := GetEndpointSLOSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.DefaultP95Ms != nil {
+		settings.DefaultP95Ms = *in.DefaultP95Ms
+	}
+	if in.Targets != nil {
+		settings.Targets = *in.Targets
+	}
+	if in.WindowMinutes != nil {
+		settings.WindowMinutes = *in.WindowMinutes
+	}
+	if in.MinSamples != nil {
+		settings.MinSamples = *in.MinSamples
+	}
+	if err := normalizeEndpointSLOSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, endpointSLOSettingsKey, settings)
+}
+
+// nearestRank returns the p-th percentile of sorted values
+func nearestRank(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// buildEndpointSLOReport computes per-route percentiles over the window;
+// violations first, then by p95 descending
+func buildEndpointSLOReport(settings EndpointSLOSettings, now time.Time) EndpointSLOReport {
+	cutoff := now.Add(-time.Duration(settings.WindowMinutes) * time.Minute).UnixMilli()
+	report := EndpointSLOReport{WindowMinutes: settings.WindowMinutes, DefaultP95Ms: settings.DefaultP95Ms, Routes: []EndpointLatency{}}
+
+	endpointStats.Lock()
+	report.Since = endpointStats.since
+	for route, buf := range endpointStats.routes {
+		var took []int64
+		errs := 0
+		for _, sample := range buf.items {
+			if sample.at < cutoff {
+				continue
+			}
+			took = append(took, sample.ms)
+			if sample.failed {
+				errs++
+			}
+		}
+		if len(took) == 0 {
+			continue
+		}
+		sort.Slice(took, func(i, j int) bool { return took[i] < took[j] })
+		l := EndpointLatency{
+			Route:    route,
+			Count:    len(took),
+			Errors:   errs,
+			P50Ms:    nearestRank(took, 0.50),
+			P95Ms:    nearestRank(took, 0.95),
+			P99Ms:    nearestRank(took, 0.99),
+			MaxMs:    took[len(took)-1],
+			TargetMs: settings.targetFor(route),
+			Alerting: endpointStats.alerting[route],
+		}
+		if l.TargetMs > 0 {
+			l.Burn = math.Round(float64(l.P95Ms)/float64(l.TargetMs)*100) / 100
+			l.Violating = l.Count >= settings.MinSamples && l.P95Ms > int64(l.TargetMs)
+		}
+		if l.Violating {
+			report.Violations++
+		}
+		report.Routes = append(report.Routes, l)
+	}
+	endpointStats.Unlock()
+
+	sort.Slice(report.Routes, func(i, j int) bool {
+		a, b := report.Routes[i], report.Routes[j]
+		if a.Violating != b.Violating {
+			return a.Violating
+		}
+		if a.P95Ms != b.P95Ms {
+			return a.P95Ms > b.P95Ms
+		}
+		return a.Route < b.Route
+	})
+	return report
+}
+
+// EndpointSLOReportNow returns the current per-route latency and violations
+func EndpointSLOReportNow(ctx context.Context) (EndpointSLOReport, error) {
+	settings, err := GetEndpointSLOSettings(ctx)
+	if err != nil {
+		return EndpointSLOReport{}, err
+	}
+	return buildEndpointSLOReport(settings, time.Now()), nil
+}
+
+// CheckEndpointSLOs alerts once when a route starts violating its objective
+// and once when it recovers. Returns the routes that newly started violating.
+func CheckEndpointSLOs(ctx context.Context) ([]EndpointLatency, error) {
+	settings, err := GetEndpointSLOSettings(ctx)
+	if err != nil || !settings.Enabled {
+		return nil, err
+	}
+	report := buildEndpointSLOReport(settings, time.Now())
+
+	var raised []EndpointLatency
+	endpointStats.Lock()
+	seen := make(map[string]bool, len(report.Routes))
+	for _, l := range report.Routes {
+		seen[l.Route] = true
+		switch {
+		case l.Violating && !endpointStats.alerting[l.Route]:
+			endpointStats.alerting[l.Route] = true
+			raised = append(raised, l)
+		case !l.Violating && endpointStats.alerting[l.Route] && l.Count >= settings.MinSamples:
+			delete(endpointStats.alerting, l.Route)
+			logger.L.Info(fmt.Sprintf("[接口 SLO] %s 已恢复: p95 %dms / 目标 %dms", l.Route, l.P95Ms, l.TargetMs))
+			PublishEvent(EventEndpointSLO, map[string]interface{}{
+				"route": l.Route, "status": "recovered", "p95_ms": l.P95Ms, "target_ms": l.TargetMs,
+			})
+		}
+	}
+	// 窗口内已无请求的路由不再视为告警中
+	for route := range endpointStats.alerting {
+		if !seen[route] {
+			delete(endpointStats.alerting, route)
+		}
+	}
+	endpointStats.Unlock()
+
+	for _, l := range raised {
+		logger.L.Warn(fmt.Sprintf("[接口 SLO] %s p95 %dms 超过目标 %dms（%d 次请求，近 %d 分钟）",
+			l.Route, l.P95Ms, l.TargetMs, l.Count, settings.WindowMinutes))
+		PublishEvent(EventEndpointSLO, map[string]interface{}{
+			"route":          l.Route,
+			"status":         "violating",
+			"p95_ms":         l.P95Ms,
+			"target_ms":      l.TargetMs,
+			"count":          l.Count,
+			"window_minutes": settings.WindowMinutes,
+		})
+	}
+	return raised, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestEndpointSLOReportAndAlerts(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	ResetEndpointLatency()
+	t.Cleanup(ResetEndpointLatency)
+
+	ctx := context.Background()
+	enabled, minSamples := true, 10
+	targets := map[string]int{"get /api/risk/leaderboards": 5000}
+	if _, err := UpdateEndpointSLOSettings(ctx, EndpointSLOSettingsInput{Enabled: &enabled, MinSamples: &minSamples, Targets: &targets}); err != nil {
+		t.Fatalf("update settings: %v", err)
+	}
+
+	// 18 fast and 2 slow requests: p95 = 19th of 20 = slow
+	for i := 0; i < 18; i++ {
+		RecordEndpointLatency("GET", "/api/dashboard/overview", 100*time.Millisecond, 200)
+		RecordEndpointLatency("GET", "/api/risk/leaderboards", 4*time.Second, 200)
+	}
+	for i := 0; i < 2; i++ {
+		RecordEndpointLatency("GET", "/api/dashboard/overview", 6*time.Second, 500)
+	}
+	RecordEndpointLatency("GET", "/api/system/scale", 9*time.Second, 200)
+
+	events, unsubscribe := GetEventBus().Subscribe()
+	defer unsubscribe()
+
+	raised, err := CheckEndpointSLOs(ctx)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(raised) != 1 || raised[0].Route != "GET /api/dashboard/overview" || raised[0].P95Ms != 6000 || raised[0].Errors != 2 {
+		t.Fatalf("expected only the dashboard route to violate, got %+v", raised)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventEndpointSLO || ev.Data["status"] != "violating" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no endpoint_slo event")
+	}
+
+	// Already alerting: no second alert
+	if raised, _ = CheckEndpointSLOs(ctx); len(raised) != 0 {
+		t.Fatalf("alert should fire once, got %+v", raised)
+	}
+
+	report, err := EndpointSLOReportNow(ctx)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if len(report.Routes) != 3 || report.Violations != 1 || !report.Routes[0].Alerting {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for _, l := range report.Routes {
+		switch l.Route {
+		case "GET /api/risk/leaderboards":
+			if l.TargetMs != 5000 || l.Violating {
+				t.Errorf("per-route target not applied: %+v", l)
+			}
+		case "GET /api/system/scale":
+			if l.Violating {
+				t.Errorf("route below min_samples must not violate: %+v", l)
+			}
+		}
+	}
+}
+
+func TestNormalizeEndpointSLOSettingsRejectsBadRoutes(t *testing.T) {
+	s := EndpointSLOSettings{Targets: map[string]int{"/api/dashboard": 100}}
+	if err := normalizeEndpointSLOSettings(&s); !errors.Is(err, ErrInvalidEndpointSLO) {
+		t.Fatalf("route without method should be rejected, got %v", err)
+	}
+	s = EndpointSLOSettings{DefaultP95Ms: -1}
+	if err := normalizeEndpointSLOSettings(&s); !errors.Is(err, ErrInvalidEndpointSLO) {
+		t.Fatalf("negative default should be rejected, got %v", err)
+	}
+}
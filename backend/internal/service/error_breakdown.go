@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// Error classes for failed requests (type=5) beyond the probe classes, which
+// are reused as-is so probes and real traffic share one taxonomy
+const (
+	ErrorClassContextLength = "context_length"
+	ErrorClassContentFilter = "content_filter"
+	ErrorClassBadRequest    = "bad_request"
+	ErrorClassCanceled      = "client_canceled"
+)
+
+// ErrorClasses lists the taxonomy in display order
+var ErrorClasses = []string{
+	ProbeErrorTimeout, ProbeErrorRateLimit, ProbeErrorQuota, ProbeErrorAuth, ProbeErrorModelNotFound,
+	ErrorClassContextLength, ErrorClassContentFilter, ErrorClassBadRequest, ProbeErrorUpstream5xx,
+	ProbeErrorNetwork, ErrorClassCanceled, ProbeErrorUnknown,
+}
+
+// errorBreakdownSlots maps a window to its time-series slot length
+var errorBreakdownSlots = map[string]int64{
+	"1h": 300, "3h": 900, "6h": 1800, "12h": 3600, "24h": 3600, "3d": 10800, "7d": 21600,
+}
+
+const (
+	// errorBreakdownRowCap bounds the grouped rows read per query
+	errorBreakdownRowCap = 50000
+	// errorBreakdownTopN bounds the per-model / per-channel lists
+	errorBreakdownTopN = 50
+)
+
+var ErrInvalidErrorQuery = errors.New("invalid error breakdown query")
+
+// logStatusPattern finds the upstream HTTP status in NewAPI error messages,
+// e.g. "status code 429", "status_code=502", "bad response status code 500"
+var logStatusPattern = regexp.MustCompile(`(?i)status[ _]?code\s*[=:]?\s*([1-5]\d{2})\b`)
+
+// parseLogErrorStatus returns the HTTP status mentioned in a failure log, or 0
+func parseLogErrorStatus(content string) int {
+	m := logStatusPattern.FindStringSubmatch(content)
+	if m == nil {
+		return 0
+	}
+	status, _ := strconv.Atoi(m[1])
+	return status
+}
+
+// classifyLogError maps a failure log's content to an error class and the
+// HTTP status it mentions
+func classifyLogError(content string) (string, int) {
+	status := parseLogErrorStatus(content)
+	msg := strings.ToLower(content)
+	switch {
+	case strings.Contains(msg, "context canceled") || strings.Contains(msg, "client disconnected") ||
+		strings.Contains(msg, "client gone"):
+		return ErrorClassCanceled, status
+	case strings.Contains(msg, "context_length") || strings.Contains(msg, "context length") ||
+		strings.Contains(msg, "maximum context") || strings.Contains(msg, "too many tokens") ||
+		strings.Contains(msg, "prompt is too long"):
+		return ErrorClassContextLength, status
+	case strings.Contains(msg, "content_filter") || strings.Contains(msg, "content policy") ||
+		strings.Contains(msg, "content management policy") || strings.Contains(msg, "safety") ||
+		strings.Contains(msg, "moderation") || strings.Contains(msg, "sensitive") ||
+		strings.Contains(msg, "敏感") || strings.Contains(msg, "违规"):
+		return ErrorClassContentFilter, status
+	}
+	class := classifyProbeError(status, content, nil)
+	if class == ProbeErrorUnknown && (status == 400 || status == 422 || strings.Contains(msg, "invalid_request") ||
+		strings.Contains(msg, "invalid request") || strings.Contains(msg, "bad request")) {
+		class = ErrorClassBadRequest
+	}
+	return class, status
+}
+
+// ErrorClassCount is one class of the overall breakdown
+type ErrorClassCount struct {
+	Class       string         `json:"class"`
+	Count       int64          `json:"count"`
+	Share       float64        `json:"share"` // 占失败总数的百分比
+	StatusCodes map[int]int64  `json:"status_codes"`
+	TopMessages []ErrorMessage `json:"top_messages"`
+}
+
+// ErrorMessage is a frequent failure message of a class
+type ErrorMessage struct {
+	Message string `json:"message"`
+	Count   int64  `json:"count"`
+}
+
+// ErrorGroup is the class breakdown of one model or channel
+type ErrorGroup struct {
+	ModelName   string           `json:"model_name,omitempty"`
+	ChannelID   int64            `json:"channel_id,omitempty"`
+	ChannelName string           `json:"channel_name,omitempty"`
+	Total       int64            `json:"total"`
+	Classes     map[string]int64 `json:"classes"`
+}
+
+// ErrorSlot is one time-series point
+type ErrorSlot struct {
+	Start   int64            `json:"start"`
+	Total   int64            `json:"total"`
+	Classes map[string]int64 `json:"classes"`
+}
+
+// ErrorBreakdown is the /api/analytics/errors response
+type ErrorBreakdown struct {
+	Window      string            `json:"window"`
+	StartTime   int64             `json:"start_time"`
+	EndTime     int64             `json:"end_time"`
+	SlotSeconds int64             `json:"slot_seconds"`
+	Total       int64             `json:"total"`
+	Taxonomy    []string          `json:"taxonomy"`
+	Classes     []ErrorClassCount `json:"classes"`
+	ByModel     []ErrorGroup      `json:"by_model"`
+	ByChannel   []ErrorGroup      `json:"by_channel"`
+	Series      []ErrorSlot       `json:"series"`
+	Truncated   bool              `json:"truncated"` // 分组行数超过上限，统计不完整
+}
+
+// ErrorQuery filters the breakdown
+type ErrorQuery struct {
+	Window    string
+	ModelName string
+	ChannelID int64
+	NoCache   bool
+}
+
+// ErrorBreakdownService classifies failed requests into the error taxonomy
+type ErrorBreakdownService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewErrorBreakdownService creates an ErrorBreakdownService on the primary instance
+func NewErrorBreakdownService() *ErrorBreakdownService {
+	return &ErrorBreakdownService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ErrorBreakdownService) WithContext(ctx context.Context) *ErrorBreakdownService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// GetBreakdown classifies the window's failure logs per class, model,
+// channel and time slot. Logs are grouped by their first 300 characters of
+// content in SQL, so only distinct messages are transferred.
+func (s *ErrorBreakdownService) GetBreakdown(q ErrorQuery) (*ErrorBreakdown, error) {
+	if q.Window == "" {
+		q.Window = "24h"
+	}
+	windowSeconds, ok := WindowSeconds[q.Window]
+	if !ok {
+		return nil, fmt.Errorf("%w: window %s", ErrInvalidErrorQuery, q.Window)
+	}
+	slotSeconds := errorBreakdownSlots[q.Window]
+	now := time.Now().Unix()
+	end := now - now%slotSeconds + slotSeconds
+	start := end - windowSeconds
+
+	cacheKey := cache.Key("analytics:errors:%s:%s:%d:%d", q.Window, q.ModelName, q.ChannelID, end)
+	cm := cache.Get()
+	var cached ErrorBreakdown
+	if found, _ := cm.GetJSON(cacheKey, &cached); found && !q.NoCache && cached.Classes != nil {
+		return &cached, nil
+	}
+
+	where, args := "type = "+ltError()+" AND created_at >= ? AND created_at < ?", []interface{}{start, end}
+	if q.ModelName != "" {
+		where, args = where+" AND model_name = ?", append(args, q.ModelName)
+	}
+	if q.ChannelID > 0 {
+		where, args = where+" AND channel_id = ?", append(args, q.ChannelID)
+	}
+	slotExpr := fmt.Sprintf("FLOOR((created_at - %d) / %d)", start, slotSeconds)
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT %s as slot_idx, COALESCE(model_name, '') as model_name, COALESCE(channel_id, 0) as channel_id,
+			SUBSTR(COALESCE(content, ''), 1, 300) as content, COUNT(*) as cnt
+		FROM logs
+		WHERE %s
+		GROUP BY %s, COALESCE(model_name, ''), COALESCE(channel_id, 0), SUBSTR(COALESCE(content, ''), 1, 300)
+		LIMIT %d`, slotExpr, where, slotExpr, errorBreakdownRowCap+1)), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ErrorBreakdown{
+		Window:      q.Window,
+		StartTime:   start,
+		EndTime:     end,
+		SlotSeconds: slotSeconds,
+		Taxonomy:    ErrorClasses,
+		Truncated:   len(rows) > errorBreakdownRowCap,
+	}
+	if result.Truncated {
+		rows = rows[:errorBreakdownRowCap]
+	}
+	numSlots := int(windowSeconds / slotSeconds)
+	result.Series = make([]ErrorSlot, numSlots)
+	for i := range result.Series {
+		result.Series[i] = ErrorSlot{Start: start + int64(i)*slotSeconds, Classes: map[string]int64{}}
+	}
+	classes := map[string]*ErrorClassCount{}
+	messages := map[string]map[string]int64{}
+	models := map[string]*ErrorGroup{}
+	channels := map[int64]*ErrorGroup{}
+	for _, row := range rows {
+		n := toInt64(row["cnt"])
+		content := toString(row["content"])
+		class, status := classifyLogError(content)
+		result.Total += n
+
+		cc := classes[class]
+		if cc == nil {
+			cc = &ErrorClassCount{Class: class, StatusCodes: map[int]int64{}}
+			classes[class], messages[class] = cc, map[string]int64{}
+		}
+		cc.Count += n
+		if status > 0 {
+			cc.StatusCodes[status] += n
+		}
+		if msg := truncateErrorMessage(content); msg != "" {
+			messages[class][msg] += n
+		}
+
+		model := toString(row["model_name"])
+		if models[model] == nil {
+			models[model] = &ErrorGroup{ModelName: model, Classes: map[string]int64{}}
+		}
+		models[model].Total += n
+		models[model].Classes[class] += n
+		if channelID := toInt64(row["channel_id"]); channelID > 0 {
+			if channels[channelID] == nil {
+				channels[channelID] = &ErrorGroup{ChannelID: channelID, Classes: map[string]int64{}}
+			}
+			channels[channelID].Total += n
+			channels[channelID].Classes[class] += n
+		}
+		if idx := toInt64(row["slot_idx"]); idx >= 0 && idx < int64(numSlots) {
+			result.Series[idx].Total += n
+			result.Series[idx].Classes[class] += n
+		}
+	}
+
+	result.Classes = []ErrorClassCount{}
+	for _, class := range ErrorClasses {
+		cc := classes[class]
+		if cc == nil {
+			continue
+		}
+		cc.Share = roundRate(float64(cc.Count) * 100 / float64(result.Total))
+		cc.TopMessages = topErrorMessages(messages[class], 3)
+		result.Classes = append(result.Classes, *cc)
+	}
+	result.ByModel = make([]ErrorGroup, 0, len(models))
+	for _, g := range models {
+		result.ByModel = append(result.ByModel, *g)
+	}
+	result.ByModel = topErrorGroups(result.ByModel)
+	result.ByChannel = make([]ErrorGroup, 0, len(channels))
+	for _, g := range channels {
+		result.ByChannel = append(result.ByChannel, *g)
+	}
+	result.ByChannel = topErrorGroups(result.ByChannel)
+	if len(result.ByChannel) > 0 {
+		names, err := s.channelNames()
+		if err == nil {
+			for i := range result.ByChannel {
+				result.ByChannel[i].ChannelName = names[result.ByChannel[i].ChannelID]
+			}
+		}
+	}
+
+	cm.Set(cacheKey, result, 2*time.Minute)
+	return result, nil
+}
+
+func (s *ErrorBreakdownService) channelNames() (map[int64]string, error) {
+	rows, err := s.db.Query(`SELECT id, name FROM channels`)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		names[toInt64(row["id"])] = toString(row["name"])
+	}
+	return names, nil
+}
+
+func truncateErrorMessage(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if runes := []rune(msg); len(runes) > 160 {
+		return string(runes[:160]) + "..."
+	}
+	return msg
+}
+
+func topErrorMessages(counts map[string]int64, n int) []ErrorMessage {
+	items := make([]ErrorMessage, 0, len(counts))
+	for msg, count := range counts {
+		items = append(items, ErrorMessage{Message: msg, Count: count})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Message < items[j].Message
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+func topErrorGroups(items []ErrorGroup) []ErrorGroup {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Total != items[j].Total {
+			return items[i].Total > items[j].Total
+		}
+		if items[i].ModelName != items[j].ModelName {
+			return items[i].ModelName < items[j].ModelName
+		}
+		return items[i].ChannelID < items[j].ChannelID
+	})
+	if len(items) > errorBreakdownTopN {
+		items = items[:errorBreakdownTopN]
+	}
+	return items
+}
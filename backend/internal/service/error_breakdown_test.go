@@ -0,0 +1,156 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestClassifyLogError(t *testing.T) {
+	cases := []struct {
+		content string
+		class   string
+		status  int
+	}{
+		{"bad response status code 429, message: Rate limit reached", ProbeErrorRateLimit, 429},
+		{"status_code=502, upstream error: Bad Gateway", ProbeErrorUpstream5xx, 502},
+		{"This model's maximum context length is 128000 tokens", ErrorClassContextLength, 0},
+		{"status code 400: The response was filtered due to content management policy", ErrorClassContentFilter, 400},
+		{"status code 400: invalid_request_error: messages is required", ErrorClassBadRequest, 400},
+		{"Post \"https://api.example.com\": context deadline exceeded (Client.Timeout)", ProbeErrorTimeout, 0},
+		{"context canceled", ErrorClassCanceled, 0},
+		{"status code 401: Incorrect API key provided", ProbeErrorAuth, 401},
+		{"当前分组 default 下对于模型 x 无可用渠道 (no available channel)", ProbeErrorModelNotFound, 0},
+		{"something odd", ProbeErrorUnknown, 0},
+	}
+	for _, tc := range cases {
+		class, status := classifyLogError(tc.content)
+		if class != tc.class || status != tc.status {
+			t.Errorf("classifyLogError(%q) = %s, %d; want %s, %d", tc.content, class, status, tc.class, tc.status)
+		}
+	}
+}
+
+func TestErrorBreakdownByModelAndChannel(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, type INTEGER, model_name TEXT, channel_id INTEGER,
+			content TEXT, created_at INTEGER);
+		INSERT INTO channels VALUES (1, 'primary'), (2, 'backup');`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	now := time.Now().Unix()
+	insert := func(typ int, model string, channel int, content string, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := db.Exec(`INSERT INTO logs (type, model_name, channel_id, content, created_at) VALUES (?, ?, ?, ?, ?)`,
+				typ, model, channel, content, now-60); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+		}
+	}
+	insert(5, "gpt-x", 1, "status code 429: rate limited", 6)
+	insert(5, "gpt-x", 2, "status code 503: service unavailable", 3)
+	insert(5, "claude-y", 2, "context deadline exceeded", 1)
+	insert(2, "gpt-x", 1, "", 10) // successes are ignored
+
+	got, err := NewErrorBreakdownService().GetBreakdown(ErrorQuery{Window: "24h", NoCache: true})
+	if err != nil {
+		t.Fatalf("GetBreakdown: %v", err)
+	}
+	if got.Total != 10 || len(got.Classes) != 3 || got.Classes[0].Class != ProbeErrorTimeout {
+		t.Fatalf("unexpected classes %+v", got.Classes)
+	}
+	var rateLimit ErrorClassCount
+	for _, cc := range got.Classes {
+		if cc.Class == ProbeErrorRateLimit {
+			rateLimit = cc
+		}
+	}
+	if rateLimit.Count != 6 || rateLimit.Share != 60 || rateLimit.StatusCodes[429] != 6 || len(rateLimit.TopMessages) != 1 {
+		t.Fatalf("unexpected rate_limit class %+v", rateLimit)
+	}
+	if got.ByModel[0].ModelName != "gpt-x" || got.ByModel[0].Total != 9 || got.ByModel[0].Classes[ProbeErrorUpstream5xx] != 3 {
+		t.Fatalf("unexpected by_model %+v", got.ByModel)
+	}
+	if got.ByChannel[0].ChannelName != "primary" || got.ByChannel[1].ChannelName != "backup" || got.ByChannel[1].Total != 4 {
+		t.Fatalf("unexpected by_channel %+v", got.ByChannel)
+	}
+	var series int64
+	for _, slot := range got.Series {
+		series += slot.Total
+	}
+	if len(got.Series) != 24 || series != 10 {
+		t.Fatalf("series should hold all 10 failures over 24 slots, got %d over %d", series, len(got.Series))
+	}
+
+	filtered, err := NewErrorBreakdownService().GetBreakdown(ErrorQuery{Window: "24h", ChannelID: 2, NoCache: true})
+	if err != nil || filtered.Total != 4 {
+		t.Fatalf("channel filter: %+v, %v", filtered, err)
+	}
+	if _, err := NewErrorBreakdownService().GetBreakdown(ErrorQuery{Window: "9h"}); err == nil {
+		t.Fatal("unknown window should be rejected")
+	}
+}
+
+func TestGetFailureSamples(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, type INTEGER, user_id INTEGER, username TEXT,
+			token_name TEXT, model_name TEXT, channel_id INTEGER, ip TEXT, use_time INTEGER, content TEXT, created_at INTEGER);
+		INSERT INTO channels VALUES (1, 'primary');`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	now := time.Now().Unix()
+	for i := 0; i < 40; i++ {
+		content, user := "status code 429: rate limited", 7
+		if i%4 == 0 {
+			content, user = "context deadline exceeded", 8
+		}
+		if _, err := db.Exec(`INSERT INTO logs (type, user_id, username, token_name, model_name, channel_id, ip, use_time, content, created_at)
+			VALUES (5, ?, 'u', 'tok', 'gpt-x', 1, '203.0.113.1', 3, ?, ?)`, user, content, now-int64(40-i)*60); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	svc := NewErrorBreakdownService()
+
+	recent, err := svc.GetFailureSamples(FailureQuery{Limit: 5})
+	if err != nil {
+		t.Fatalf("recent: %v", err)
+	}
+	if recent.Matched != 40 || len(recent.Items) != 5 || recent.Items[0].ID != 40 {
+		t.Fatalf("recent should return the 5 newest of 40, got %d items (first %+v)", len(recent.Items), recent.Items)
+	}
+	if it := recent.Items[0]; it.ChannelName != "primary" || it.Class != ProbeErrorRateLimit || it.StatusCode != 429 {
+		t.Fatalf("unexpected sample %+v", it)
+	}
+
+	spread, err := svc.GetFailureSamples(FailureQuery{Sample: FailureSampleSpread, Limit: 4})
+	if err != nil {
+		t.Fatalf("spread: %v", err)
+	}
+	if spread.Step != 10 || len(spread.Items) != 4 || spread.Items[3].ID != 10 {
+		t.Fatalf("spread should pick every 10th id, got step %d items %+v", spread.Step, spread.Items)
+	}
+
+	timeouts, err := svc.GetFailureSamples(FailureQuery{UserID: 8, Class: ProbeErrorTimeout, Limit: 50})
+	if err != nil || timeouts.Matched != 10 || len(timeouts.Items) != 10 {
+		t.Fatalf("user + class filter: %+v, %v", timeouts, err)
+	}
+	if _, err := svc.GetFailureSamples(FailureQuery{Class: "bogus"}); err == nil {
+		t.Fatal("unknown class should be rejected")
+	}
+}
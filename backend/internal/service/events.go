@@ -0,0 +1,193 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types pushed over /api/events (SSE).
+const (
+	EventCacheInvalidated    = "cache_invalidated"
+	EventScanFinished        = "scan_finished"
+	EventHighRiskUser        = "high_risk_user"
+	EventModelStatusChanged  = "model_status_changed"
+	EventChannelLowBalance   = "channel_low_balance"
+	EventChannelAutoDisabled = "channel_auto_disabled"
+	EventChannelRecovered    = "channel_recovered"
+	EventChannelKeyInvalid   = "channel_key_invalid"
+	EventIPBlocklistEnforced = "ip_blocklist_enforced"
+	EventReportReady         = "report_ready"
+	EventWatchlistAlert      = "watchlist_alert"
+	EventSettingsChanged     = "settings_changed"
+	EventTrafficAnomaly      = "traffic_anomaly"
+	EventRegistrationSpike   = "registration_spike"
+	EventNegativeMargin      = "negative_margin"
+	EventRiskPenalty         = "risk_penalty"
+	EventEndpointSLO         = "endpoint_slo"
+	EventKillSwitch          = "kill_switch"
+	EventGroupBudget         = "group_budget"
+	EventSmokeTest           = "smoke_test"
+)
+
+// eventSubscriberBuffer is the per-subscriber channel size; slow clients drop
+// events instead of blocking publishers.
+const eventSubscriberBuffer = 32
+
+// Event is a lightweight notification for the SPA to refresh a view.
+type Event struct {
+	ID        int64                  `json:"id"`
+	Type      string                 `json:"type"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Owner     string                 `json:"owner,omitempty"` // 非空时只推送给该管理员
+	CreatedAt int64                  `json:"created_at"`
+}
+
+// EventBus is an in-process fan-out hub for live UI events.
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   map[int64]chan Event
+	nextID int64
+	seq    atomic.Int64
+}
+
+var (
+	eventBus     *EventBus
+	eventBusOnce sync.Once
+)
+
+// GetEventBus returns the process-wide event bus
+func GetEventBus() *EventBus {
+	eventBusOnce.Do(func() {
+		eventBus = &EventBus{subs: make(map[int64]chan Event)}
+	})
+	return eventBus
+}
+
+// PublishEvent is a shorthand for GetEventBus().Publish.
+func PublishEvent(eventType string, data map[string]interface{}) {
+	GetEventBus().Publish(eventType, data)
+}
+
+// PublishEventTo publishes an event addressed to a single admin; the SSE
+// stream of other admins skips it.
+func PublishEventTo(owner, eventType string, data map[string]interface{}) {
+	GetEventBus().publish(owner, eventType, data)
+}
+
+// Publish delivers an event to every subscriber without blocking.
+func (b *EventBus) Publish(eventType string, data map[string]interface{}) {
+	b.publish("", eventType, data)
+}
+
+func (b *EventBus) publish(owner, eventType string, data map[string]interface{}) {
+	ev := Event{
+		ID:        b.seq.Add(1),
+		Type:      eventType,
+		Data:      data,
+		Owner:     owner,
+		CreatedAt: time.Now().Unix(),
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			// subscriber is lagging; drop rather than stall the publisher
+		}
+	}
+}
+
+// Subscribe registers a listener. The returned cancel func must be called
+// when the client goes away.
+func (b *EventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventSubscriberBuffer)
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// SubscriberCount returns the number of connected listeners.
+func (b *EventBus) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// ========== Change detectors ==========
+
+// highRiskNotifyInterval suppresses repeated high_risk_user events per user.
+const highRiskNotifyInterval = time.Hour
+
+// lowBalanceNotifyInterval suppresses repeated channel_low_balance events per channel.
+const lowBalanceNotifyInterval = 24 * time.Hour
+
+var (
+	highRiskNotified   sync.Map // user_id -> last notified unix
+	modelStatusLastSet sync.Map // model|window -> last status color
+	lowBalanceNotified sync.Map // channel_id -> last notified unix
+)
+
+// notifyHighRiskUser publishes high_risk_user at most once per interval per user.
+func notifyHighRiskUser(userID int64, username, reason string, data map[string]interface{}) {
+	now := time.Now().Unix()
+	if last, ok := highRiskNotified.Load(userID); ok && now-last.(int64) < int64(highRiskNotifyInterval.Seconds()) {
+		return
+	}
+	highRiskNotified.Store(userID, now)
+	recordRiskFlag(userID, username, reason)
+	payload := map[string]interface{}{
+		"user_id":  userID,
+		"username": username,
+		"reason":   reason,
+	}
+	for k, v := range data {
+		payload[k] = v
+	}
+	PublishEvent(EventHighRiskUser, payload)
+}
+
+// notifyModelStatus publishes model_status_changed when a model's overall
+// status color differs from the last observed value for the same window.
+func notifyModelStatus(modelName, window, status string) {
+	key := modelName + "|" + window
+	prev, loaded := modelStatusLastSet.Swap(key, status)
+	if !loaded || prev.(string) == status {
+		return
+	}
+	PublishEvent(EventModelStatusChanged, map[string]interface{}{
+		"model_name": modelName,
+		"window":     window,
+		"from":       prev,
+		"to":         status,
+	})
+}
+
+// notifyLowBalance publishes channel_low_balance at most once per interval per
+// channel. Returns true when an event was actually emitted.
+func notifyLowBalance(channelID int64, data map[string]interface{}) bool {
+	now := time.Now().Unix()
+	if last, ok := lowBalanceNotified.Load(channelID); ok && now-last.(int64) < int64(lowBalanceNotifyInterval.Seconds()) {
+		return false
+	}
+	lowBalanceNotified.Store(channelID, now)
+	payload := map[string]interface{}{"channel_id": channelID}
+	for k, v := range data {
+		payload[k] = v
+	}
+	PublishEvent(EventChannelLowBalance, payload)
+	return true
+}
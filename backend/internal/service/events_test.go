@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusModelStatusChange(t *testing.T) {
+	events, cancel := GetEventBus().Subscribe()
+	defer cancel()
+
+	notifyModelStatus("gpt-test", "1h", "green") // first observation: no event
+	notifyModelStatus("gpt-test", "1h", "green")
+	notifyModelStatus("gpt-test", "1h", "red")
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventModelStatusChanged || ev.Data["from"] != "green" || ev.Data["to"] != "red" {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected model_status_changed event")
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected extra event: %+v", ev)
+	default:
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const exportAnonymizeSettingsKey = "export_anonymize_key"
+
+// exportAnonymizeMu guards first-use creation of the pseudonym key
+var exportAnonymizeMu sync.Mutex
+
+type exportAnonymizeKey struct {
+	Key       string `json:"key"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ExportAnonymizer replaces personal identifiers in exports with stable
+// pseudonyms for sharing with external accountants. Pseudonyms are keyed
+// HMACs: the same user maps to the same value in every monthly export of
+// this install, but cannot be reversed by hashing a list of known usernames.
+// A nil *ExportAnonymizer leaves values unchanged.
+type ExportAnonymizer struct {
+	key []byte
+}
+
+// NewExportAnonymizer loads the per-install pseudonym key from the local
+// store, creating it on first use
+func NewExportAnonymizer(ctx context.Context) (*ExportAnonymizer, error) {
+	exportAnonymizeMu.Lock()
+	defer exportAnonymizeMu.Unlock()
+
+	var stored exportAnonymizeKey
+	found, err := loadLocalSetting(ctx, exportAnonymizeSettingsKey, &stored)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(stored.Key)
+	if !found || err != nil || len(key) < 16 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		stored = exportAnonymizeKey{Key: hex.EncodeToString(key), CreatedAt: time.Now().Unix()}
+		if err := saveLocalSetting(ctx, exportAnonymizeSettingsKey, stored); err != nil {
+			return nil, err
+		}
+	}
+	return &ExportAnonymizer{key: key}, nil
+}
+
+func (a *ExportAnonymizer) pseudonym(prefix, kind, value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + value))
+	return prefix + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// UserID formats a user id, or its pseudonym ("u_…"); 0 stays empty
+func (a *ExportAnonymizer) UserID(id int64) string {
+	if a == nil {
+		return strconv.FormatInt(id, 10)
+	}
+	if id <= 0 {
+		return ""
+	}
+	return a.pseudonym("u_", "user", strconv.FormatInt(id, 10))
+}
+
+// Name masks a username or email ("n_…"); matching is case-insensitive so
+// the same address typed differently still maps to one pseudonym
+func (a *ExportAnonymizer) Name(s string) string {
+	s = strings.TrimSpace(s)
+	if a == nil || s == "" {
+		return s
+	}
+	return a.pseudonym("n_", "name", strings.ToLower(s))
+}
+
+// Code masks a secret reference such as a redemption key ("c_…")
+func (a *ExportAnonymizer) Code(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	return a.pseudonym("c_", "code", s)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Failure sampling modes
+const (
+	FailureSampleRecent = "recent" // 最近的 N 条
+	FailureSampleSpread = "spread" // 按 id 等距抽样，覆盖整个窗口
+)
+
+// FailureQuery filters the failed-request drill-down
+type FailureQuery struct {
+	Window    string
+	ModelName string
+	ChannelID int64
+	UserID    int64
+	Class     string // 按错误分类过滤（见 ErrorClasses），在抽样后于内存中过滤
+	Sample    string
+	Limit     int
+}
+
+// FailureSample is one failed request with its classified error excerpt
+type FailureSample struct {
+	ID          int64  `json:"id"`
+	CreatedAt   int64  `json:"created_at"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	TokenName   string `json:"token_name"`
+	ModelName   string `json:"model_name"`
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	IP          string `json:"ip"`
+	UseTime     int64  `json:"use_time"`
+	Class       string `json:"class"`
+	StatusCode  int    `json:"status_code"`
+	Content     string `json:"content"` // 截断到 300 字
+}
+
+// FailureSamples is the /api/analytics/failures response
+type FailureSamples struct {
+	Window    string          `json:"window"`
+	StartTime int64           `json:"start_time"`
+	Sample    string          `json:"sample"`
+	Matched   int64           `json:"matched"` // 窗口内符合 model / channel / user 过滤的失败数
+	Step      int64           `json:"step"`    // spread 模式的抽样间隔
+	Items     []FailureSample `json:"items"`
+}
+
+// GetFailureSamples returns recent failed request rows (type=5) so failures
+// can be inspected without direct DB access. spread mode keeps every step-th
+// id so a burst at the end of the window doesn't hide earlier errors.
+func (s *ErrorBreakdownService) GetFailureSamples(q FailureQuery) (*FailureSamples, error) {
+	if q.Window == "" {
+		q.Window = "24h"
+	}
+	windowSeconds, ok := WindowSeconds[q.Window]
+	if !ok {
+		return nil, fmt.Errorf("%w: window %s", ErrInvalidErrorQuery, q.Window)
+	}
+	if q.Sample == "" {
+		q.Sample = FailureSampleRecent
+	}
+	if q.Sample != FailureSampleRecent && q.Sample != FailureSampleSpread {
+		return nil, fmt.Errorf("%w: sample 只能是 recent 或 spread", ErrInvalidErrorQuery)
+	}
+	if q.Class != "" && !containsStr(ErrorClasses, q.Class) {
+		return nil, fmt.Errorf("%w: class 只能是 %s", ErrInvalidErrorQuery, strings.Join(ErrorClasses, "、"))
+	}
+	q.Limit = clampSetting(q.Limit, 1, 500, 50)
+
+	start := time.Now().Unix() - windowSeconds
+	where, args := "type = "+ltError()+" AND created_at >= ?", []interface{}{start}
+	if q.ModelName != "" {
+		where, args = where+" AND model_name = ?", append(args, q.ModelName)
+	}
+	if q.ChannelID > 0 {
+		where, args = where+" AND channel_id = ?", append(args, q.ChannelID)
+	}
+	if q.UserID > 0 {
+		where, args = where+" AND user_id = ?", append(args, q.UserID)
+	}
+
+	result := &FailureSamples{Window: q.Window, StartTime: start, Sample: q.Sample, Step: 1, Items: []FailureSample{}}
+	row, err := s.logDB.QueryOneWithTimeout(30*time.Second, s.logDB.RebindQuery(`SELECT COUNT(*) as cnt FROM logs WHERE `+where), args...)
+	if err != nil {
+		return nil, err
+	}
+	result.Matched = toInt64(row["cnt"])
+	if result.Matched == 0 {
+		return result, nil
+	}
+
+	// 按分类过滤发生在内存中，多取一些以尽量凑满 limit
+	fetch := q.Limit
+	if q.Class != "" {
+		fetch = q.Limit * 5
+	}
+	if q.Sample == FailureSampleSpread && result.Matched > int64(fetch) {
+		result.Step = (result.Matched + int64(fetch) - 1) / int64(fetch)
+		where, args = where+" AND id % ? = 0", append(args, result.Step)
+	}
+	rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT id, created_at, COALESCE(user_id, 0) as user_id, COALESCE(username, '') as username,
+			COALESCE(token_name, '') as token_name, COALESCE(model_name, '') as model_name,
+			COALESCE(channel_id, 0) as channel_id, COALESCE(ip, '') as ip, COALESCE(use_time, 0) as use_time,
+			SUBSTR(COALESCE(content, ''), 1, 300) as content
+		FROM logs
+		WHERE `+where+`
+		ORDER BY id DESC
+		LIMIT ?`), append(args, fetch)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		content := toString(r["content"])
+		class, status := classifyLogError(content)
+		if q.Class != "" && class != q.Class {
+			continue
+		}
+		result.Items = append(result.Items, FailureSample{
+			ID:         toInt64(r["id"]),
+			CreatedAt:  toInt64(r["created_at"]),
+			UserID:     toInt64(r["user_id"]),
+			Username:   toString(r["username"]),
+			TokenName:  toString(r["token_name"]),
+			ModelName:  toString(r["model_name"]),
+			ChannelID:  toInt64(r["channel_id"]),
+			IP:         toString(r["ip"]),
+			UseTime:    toInt64(r["use_time"]),
+			Class:      class,
+			StatusCode: status,
+			Content:    content,
+		})
+		if len(result.Items) >= q.Limit {
+			break
+		}
+	}
+	if len(result.Items) > 0 {
+		if names, err := s.channelNames(); err == nil {
+			for i := range result.Items {
+				result.Items[i].ChannelName = names[result.Items[i].ChannelID]
+			}
+		}
+	}
+	return result, nil
+}
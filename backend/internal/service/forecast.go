@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+const (
+	forecastSeason   = 7    // 周季节性
+	forecastZ95      = 1.96 // 95% 置信区间
+	forecastCacheTTL = 30 * time.Minute
+)
+
+// Forecast grid searched for the smoothing parameters (alpha, beta, gamma)
+var (
+	forecastAlphas = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	forecastBetas  = []float64{0, 0.05, 0.1, 0.2, 0.3}
+	forecastGammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+)
+
+// ForecastPoint is one projected day with its 95% confidence band
+type ForecastPoint struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// ForecastHistoryPoint is one observed day
+type ForecastHistoryPoint struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+}
+
+// ForecastSeries is the fit and projection of one metric
+type ForecastSeries struct {
+	History  []ForecastHistoryPoint `json:"history"`
+	Forecast []ForecastPoint        `json:"forecast"`
+	Total    float64                `json:"total"` // 预测期合计
+	Alpha    float64                `json:"alpha"`
+	Beta     float64                `json:"beta"`
+	Gamma    float64                `json:"gamma"`
+	RMSE     float64                `json:"rmse"` // 样本内一步预测误差
+}
+
+// Forecast is the response of GetForecast
+type Forecast struct {
+	Method      string          `json:"method"` // holt_winters（加法，周季节性）
+	HistoryDays int             `json:"history_days"`
+	Horizon     int             `json:"horizon"`
+	Requests    *ForecastSeries `json:"requests"`
+	Quota       *ForecastSeries `json:"quota"`
+	Revenue     *ForecastSeries `json:"revenue"` // 成功充值金额（充值货币）
+	GeneratedAt int64           `json:"generated_at"`
+}
+
+// holtWintersFit is one additive Holt-Winters fit
+type holtWintersFit struct {
+	alpha, beta, gamma float64
+	level, trend       float64
+	season             []float64
+	rmse               float64
+}
+
+// fitHoltWinters runs additive Holt-Winters with season length m over y
+// (len(y) >= 2m). The first two seasons initialise level, trend and the
+// seasonal indices (detrended); one-step errors from the second season on give the RMSE.
+func fitHoltWinters(y []float64, m int, alpha, beta, gamma float64) holtWintersFit {
+	var first, second float64
+	for i := 0; i < m; i++ {
+		first += y[i]
+		second += y[m+i]
+	}
+	first, second = first/float64(m), second/float64(m)
+	// 第一季均值对应季中，换算到季末作为初始水平，季节项扣除趋势
+	trend := (second - first) / float64(m)
+	mid := float64(m-1) / 2
+	fit := holtWintersFit{alpha: alpha, beta: beta, gamma: gamma, level: first + trend*mid, trend: trend}
+	fit.season = make([]float64, m)
+	for i := 0; i < m; i++ {
+		fit.season[i] = y[i] - (first + trend*(float64(i)-mid))
+	}
+
+	var sse float64
+	for t := m; t < len(y); t++ {
+		s := fit.season[t%m]
+		err := y[t] - (fit.level + fit.trend + s)
+		sse += err * err
+		level := alpha*(y[t]-s) + (1-alpha)*(fit.level+fit.trend)
+		fit.trend = beta*(level-fit.level) + (1-beta)*fit.trend
+		fit.season[t%m] = gamma*(y[t]-level) + (1-gamma)*s
+		fit.level = level
+	}
+	fit.rmse = math.Sqrt(sse / float64(len(y)-m))
+	return fit
+}
+
+// bestHoltWinters grid-searches the smoothing parameters with the lowest RMSE
+func bestHoltWinters(y []float64, m int) holtWintersFit {
+	var best holtWintersFit
+	for _, a := range forecastAlphas {
+		for _, b := range forecastBetas {
+			for _, g := range forecastGammas {
+				if fit := fitHoltWinters(y, m, a, b, g); best.season == nil || fit.rmse < best.rmse {
+					best = fit
+				}
+			}
+		}
+	}
+	return best
+}
+
+// project returns the h-step forecasts (h = 1..horizon) after the last of n
+// observations with a 95% band. The band widens with the Holt approximation
+// sigma_h = rmse * sqrt(1 + sum_{j<h} (alpha * (1 + j*beta))^2). Counts and
+// money cannot go negative, so values and lower bounds are clamped at 0.
+func (f holtWintersFit) project(n, horizon int) []ForecastPoint {
+	m := len(f.season)
+	points := make([]ForecastPoint, 0, horizon)
+	variance := 1.0
+	for h := 1; h <= horizon; h++ {
+		if h > 1 {
+			c := f.alpha * (1 + float64(h-1)*f.beta)
+			variance += c * c
+		}
+		value := f.level + float64(h)*f.trend + f.season[(n-1+h)%m]
+		band := forecastZ95 * f.rmse * math.Sqrt(variance)
+		points = append(points, ForecastPoint{
+			Value: round2(math.Max(value, 0)),
+			Lower: round2(math.Max(value-band, 0)),
+			Upper: round2(math.Max(value+band, 0)),
+		})
+	}
+	return points
+}
+
+// buildForecastSeries fits one metric; dates are the history days followed
+// by the horizon days
+func buildForecastSeries(values []float64, dates []string, horizon int) *ForecastSeries {
+	series := &ForecastSeries{History: make([]ForecastHistoryPoint, 0, len(values))}
+	for i, v := range values {
+		series.History = append(series.History, ForecastHistoryPoint{Date: dates[i], Value: v})
+	}
+	fit := bestHoltWinters(values, forecastSeason)
+	series.Forecast = fit.project(len(values), horizon)
+	for i := range series.Forecast {
+		series.Forecast[i].Date = dates[len(values)+i]
+		series.Total += series.Forecast[i].Value
+	}
+	series.Total = round2(series.Total)
+	series.Alpha, series.Beta, series.Gamma = fit.alpha, fit.beta, fit.gamma
+	series.RMSE = round2(fit.rmse)
+	return series
+}
+
+// GetForecast fits additive Holt-Winters with weekly seasonality to the last
+// historyDays complete days (today is excluded as it is still running) of
+// requests, quota and top-up revenue, and projects the next horizon days
+// starting today
+func GetForecast(ctx context.Context, historyDays, horizon int, noCache bool) (*Forecast, error) {
+	cm := cache.Get()
+	cacheKey := cache.Key("forecast:%d:%d", historyDays, horizon)
+	if !noCache {
+		var cached Forecast
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return &cached, nil
+		}
+	}
+
+	// Both trend sources cover historyDays complete days plus today
+	usage, err := NewDashboardService().WithContext(ctx).GetDailyTrends(historyDays+1, noCache)
+	if err != nil {
+		return nil, err
+	}
+	topUps, err := GetTopUpTrends(ctx, TopUpTrendsParams{Days: historyDays + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	today := reportDayStart(reportNow())
+	dates := make([]string, 0, historyDays+horizon)
+	for d := -historyDays; d < horizon; d++ {
+		dates = append(dates, today.AddDate(0, 0, d).Format("2006-01-02"))
+	}
+	index := make(map[string]int, historyDays)
+	for i, date := range dates[:historyDays] {
+		index[date] = i
+	}
+	requests := make([]float64, historyDays)
+	quota := make([]float64, historyDays)
+	revenue := make([]float64, historyDays)
+	for _, day := range usage {
+		if i, ok := index[day.Date]; ok {
+			requests[i] = float64(day.RequestCount)
+			quota[i] = float64(day.QuotaUsed)
+		}
+	}
+	for _, p := range topUps {
+		if i, ok := index[p.Date]; ok {
+			revenue[i] = p.SuccessMoney
+		}
+	}
+
+	forecast := &Forecast{
+		Method:      "holt_winters",
+		HistoryDays: historyDays,
+		Horizon:     horizon,
+		Requests:    buildForecastSeries(requests, dates, horizon),
+		Quota:       buildForecastSeries(quota, dates, horizon),
+		Revenue:     buildForecastSeries(revenue, dates, horizon),
+		GeneratedAt: time.Now().Unix(),
+	}
+	cm.Set(cacheKey, forecast, forecastCacheTTL)
+	return forecast, nil
+}
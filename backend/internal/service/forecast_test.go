@@ -0,0 +1,56 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHoltWintersForecast(t *testing.T) {
+	// 8 weeks of a linear trend plus a weekend dip
+	weekly := []float64{20, 25, 30, 25, 20, -40, -80}
+	truth := func(day int) float64 { return 1000 + 5*float64(day) + weekly[day%7] }
+	values := make([]float64, 56)
+	for i := range values {
+		values[i] = truth(i)
+	}
+	dates := make([]string, 56+14)
+	for i := range dates {
+		dates[i] = "d"
+	}
+
+	series := buildForecastSeries(values, dates, 14)
+	if len(series.History) != 56 || len(series.Forecast) != 14 {
+		t.Fatalf("series lengths = %d / %d", len(series.History), len(series.Forecast))
+	}
+	if series.RMSE > 5 {
+		t.Errorf("rmse = %v on a noiseless series", series.RMSE)
+	}
+	var total float64
+	for h, p := range series.Forecast {
+		want := truth(56 + h)
+		total += p.Value
+		if math.Abs(p.Value-want) > 10 {
+			t.Errorf("day %d: forecast %v, want %v", h+1, p.Value, want)
+		}
+		if p.Lower > p.Value || p.Upper < p.Value {
+			t.Errorf("day %d: band [%v, %v] excludes %v", h+1, p.Lower, p.Upper, p.Value)
+		}
+		if h > 0 && p.Upper-p.Lower < series.Forecast[h-1].Upper-series.Forecast[h-1].Lower {
+			t.Errorf("day %d: band narrower than the day before", h+1)
+		}
+	}
+	if math.Abs(series.Total-total) > 0.05 {
+		t.Errorf("total = %v, want %v", series.Total, total)
+	}
+
+	// A series that dropped to zero never forecasts negative values
+	drop := make([]float64, 28)
+	for i := 0; i < 21; i++ {
+		drop[i] = 500 - 20*float64(i)
+	}
+	for _, p := range buildForecastSeries(drop, dates, 30).Forecast {
+		if p.Value < 0 || p.Lower < 0 {
+			t.Fatalf("negative forecast %+v", p)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+// Global search result types
+const (
+	SearchTypeUser       = "user"
+	SearchTypeToken      = "token"
+	SearchTypeIP         = "ip"
+	SearchTypeRedemption = "redemption"
+	SearchTypeTopUp      = "top_up"
+)
+
+// searchIPWindow bounds the logs scanned for an IP match
+const searchIPWindow = 7 * 86400
+
+// searchQueryTimeout bounds each group's query so one slow table does not
+// hold up the others
+const searchQueryTimeout = 10 * time.Second
+
+// SearchGroup is the matches of one entity type. A failed group carries its
+// error and does not fail the whole search.
+type SearchGroup struct {
+	Type  string                   `json:"type"`
+	Items []map[string]interface{} `json:"items"`
+	Error string                   `json:"error,omitempty"`
+}
+
+// SearchResult is the outcome of a global search; groups without matches
+// are omitted
+type SearchResult struct {
+	Query  string        `json:"query"`
+	Groups []SearchGroup `json:"groups"`
+	Total  int           `json:"total"`
+}
+
+// GlobalSearch fans q out to users (username / display name / email /
+// linux_do_id / id), tokens (name / key prefix), IPs (recent log users),
+// redemption codes (key / name) and top-up trade numbers in parallel, and
+// returns the matches grouped by type in that order.
+func GlobalSearch(ctx context.Context, q string, limit int) (*SearchResult, error) {
+	q = strings.TrimSpace(q)
+	if q == "" || len([]rune(q)) > 128 {
+		return nil, fmt.Errorf("%w: q 需为 1-128 个字符", ErrInvalidSearch)
+	}
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	searches := []struct {
+		typ string
+		fn  func(context.Context, string, int) ([]map[string]interface{}, error)
+	}{
+		{SearchTypeUser, searchUsers},
+		{SearchTypeToken, searchTokens},
+		{SearchTypeIP, searchIPs},
+		{SearchTypeRedemption, searchRedemptions},
+		{SearchTypeTopUp, searchTopUps},
+	}
+	groups := make([]SearchGroup, len(searches))
+	var wg sync.WaitGroup
+	for i, sc := range searches {
+		wg.Add(1)
+		go func(i int, typ string, fn func(context.Context, string, int) ([]map[string]interface{}, error)) {
+			defer wg.Done()
+			groups[i] = SearchGroup{Type: typ}
+			items, err := fn(ctx, q, limit)
+			if err != nil {
+				groups[i].Error = err.Error()
+				return
+			}
+			groups[i].Items = items
+		}(i, sc.typ, sc.fn)
+	}
+	wg.Wait()
+
+	result := &SearchResult{Query: q, Groups: []SearchGroup{}}
+	for _, g := range groups {
+		if len(g.Items) == 0 && g.Error == "" {
+			continue
+		}
+		if g.Items == nil {
+			g.Items = []map[string]interface{}{}
+		}
+		result.Groups = append(result.Groups, g)
+		result.Total += len(g.Items)
+	}
+	return result, nil
+}
+
+// likeOp is the case-insensitive LIKE of the engine
+func likeOp(db *database.Manager) string {
+	if db.IsPG {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+func searchUsers(ctx context.Context, q string, limit int) ([]map[string]interface{}, error) {
+	db := database.GetRead().WithContext(ctx)
+	like := likeOp(db)
+	pattern := "%" + q + "%"
+	conds := []string{
+		"username " + like + " ?",
+		"COALESCE(display_name, '') " + like + " ?",
+		"COALESCE(email, '') " + like + " ?",
+	}
+	args := []interface{}{pattern, pattern, pattern}
+	linuxDoCol := "''"
+	if slices.Contains(NewUserManagementService().getAvailableOAuthColumns(), "linux_do_id") {
+		linuxDoCol = "COALESCE(linux_do_id, '')"
+		conds = append(conds, linuxDoCol+" = ?")
+		args = append(args, q)
+	}
+	if id, err := strconv.ParseInt(q, 10, 64); err == nil && id > 0 {
+		conds = append(conds, "id = ?")
+		args = append(args, id)
+	}
+	rows, err := db.QueryWithTimeout(searchQueryTimeout, db.RebindQuery(fmt.Sprintf(`
+		SELECT id, username, COALESCE(display_name, '') as display_name, COALESCE(email, '') as email,
+			%s as linux_do_id, status, deleted_at IS NOT NULL as deleted
+		FROM users
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT ?`, linuxDoCol, strings.Join(conds, " OR "))), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row["deleted"] = toInt64(row["deleted"]) != 0 || row["deleted"] == true
+	}
+	return rows, nil
+}
+
+// searchTokens matches token names and key prefixes (with or without the
+// "sk-" prefix shown to users). Keys are returned masked.
+func searchTokens(ctx context.Context, q string, limit int) ([]map[string]interface{}, error) {
+	db := database.GetRead().WithContext(ctx)
+	kc := keyCol(db.IsPG)
+	conds := []string{"t.name " + likeOp(db) + " ?"}
+	args := []interface{}{"%" + q + "%"}
+	// A key prefix shorter than 6 characters matches too many tokens to be useful
+	if prefix := strings.TrimPrefix(q, "sk-"); len(prefix) >= 6 && !strings.ContainsAny(prefix, "%_ ") {
+		conds = append(conds, fmt.Sprintf("t.%s LIKE ?", kc))
+		args = append(args, prefix+"%")
+	}
+	rows, err := db.QueryWithTimeout(searchQueryTimeout, db.RebindQuery(fmt.Sprintf(`
+		SELECT t.id, t.%s as token_key, t.name, t.user_id, COALESCE(u.username, '') as username, t.status
+		FROM tokens t
+		LEFT JOIN users u ON t.user_id = u.id
+		WHERE %s
+		ORDER BY t.id DESC
+		LIMIT ?`, kc, strings.Join(conds, " OR "))), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row["key"] = MaskTokenKey(toString(row["token_key"]))
+		delete(row, "token_key")
+	}
+	return rows, nil
+}
+
+// searchIPs returns the users seen on an exact IP in the last 7 days; other
+// queries are not IPs and match nothing
+func searchIPs(ctx context.Context, q string, limit int) ([]map[string]interface{}, error) {
+	ip := net.ParseIP(q)
+	if ip == nil {
+		return nil, nil
+	}
+	logDB := database.GetReadLog().WithContext(ctx)
+	rows, err := logDB.QueryWithTimeout(searchQueryTimeout, logDB.RebindQuery(`
+		SELECT user_id, MAX(username) as username, COUNT(*) as request_count, MAX(created_at) as last_seen
+		FROM logs
+		WHERE created_at >= ? AND ip = ?
+		GROUP BY user_id
+		ORDER BY request_count DESC
+		LIMIT ?`), time.Now().Unix()-searchIPWindow, ip.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row["ip"] = ip.String()
+	}
+	return rows, nil
+}
+
+// searchRedemptions matches a full code exactly, or code names by substring
+func searchRedemptions(ctx context.Context, q string, limit int) ([]map[string]interface{}, error) {
+	db := database.GetRead().WithContext(ctx)
+	kc := keyCol(db.IsPG)
+	return db.QueryWithTimeout(searchQueryTimeout, db.RebindQuery(fmt.Sprintf(`
+		SELECT r.id, r.%s as "key", COALESCE(r.name, '') as name, COALESCE(r.quota, 0) as quota,
+			COALESCE(r.redeemed_time, 0) as redeemed_time, COALESCE(r.used_user_id, 0) as used_user_id,
+			COALESCE(u.username, '') as used_username
+		FROM redemptions r
+		LEFT JOIN users u ON r.used_user_id = u.id AND r.used_user_id > 0
+		WHERE r.deleted_at IS NULL AND (r.%s = ? OR r.name %s ?)
+		ORDER BY r.id DESC
+		LIMIT ?`, kc, kc, likeOp(db))), q, "%"+q+"%", limit)
+}
+
+// searchTopUps matches trade numbers the way the top-up list does: a
+// complete trade_no hits the unique index, a fragment falls back to LIKE
+func searchTopUps(ctx context.Context, q string, limit int) ([]map[string]interface{}, error) {
+	db := database.GetRead().WithContext(ctx)
+	cond, arg := "t.trade_no LIKE ?", "%"+q+"%"
+	if isCompleteTradeNo(q) {
+		cond, arg = "t.trade_no = ?", q
+	}
+	return db.QueryWithTimeout(searchQueryTimeout, db.RebindQuery(`
+		SELECT t.id, t.user_id, COALESCE(u.username, '') as username, t.amount, t.money, t.trade_no,
+			t.status, t.create_time
+		FROM top_ups t
+		LEFT JOIN users u ON t.user_id = u.id
+		WHERE `+cond+`
+		ORDER BY t.id DESC
+		LIMIT ?`), arg, limit)
+}
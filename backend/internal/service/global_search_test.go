@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGlobalSearch(t *testing.T) {
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, email TEXT, linux_do_id TEXT,
+			status INTEGER, deleted_at INTEGER);
+		INSERT INTO users VALUES
+			(1, 'alice', 'Alice', 'alice@example.com', '9001', 1, NULL),
+			(2, 'bob', NULL, 'bob@corp.example', '', 2, 1700000000);
+		CREATE TABLE tokens (id INTEGER PRIMARY KEY, "key" TEXT, name TEXT, user_id INTEGER, status INTEGER);
+		INSERT INTO tokens VALUES (1, 'abcdef123456789', 'alice-prod', 1, 1), (2, 'zzzzzz000000', 'bob-dev', 2, 1);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY, user_id INTEGER, username TEXT, created_at INTEGER, ip TEXT);
+		INSERT INTO logs (user_id, username, created_at, ip) VALUES (1, 'alice', ?, '203.0.113.9'), (1, 'alice', ?, '203.0.113.9');
+		CREATE TABLE redemptions (id INTEGER PRIMARY KEY, "key" TEXT, name TEXT, quota INTEGER, redeemed_time INTEGER,
+			used_user_id INTEGER, deleted_at INTEGER);
+		INSERT INTO redemptions VALUES (1, 'REDEEM-KEY-1', 'spring promo', 100, 0, 0, NULL);
+		CREATE TABLE top_ups (id INTEGER PRIMARY KEY, user_id INTEGER, amount INTEGER, money REAL, trade_no TEXT,
+			status TEXT, create_time INTEGER);
+		INSERT INTO top_ups VALUES (1, 1, 10, 10.0, 'T20260101ABC', 'success', 1700000000);`, now, now); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	types := func(r *SearchResult) map[string]int {
+		out := map[string]int{}
+		for _, g := range r.Groups {
+			if g.Error != "" {
+				t.Errorf("%s failed: %s", g.Type, g.Error)
+			}
+			out[g.Type] = len(g.Items)
+		}
+		return out
+	}
+
+	r, err := GlobalSearch(ctx, "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types(r); got[SearchTypeUser] != 1 || got[SearchTypeToken] != 1 || len(got) != 2 {
+		t.Errorf("alice: %v", got)
+	}
+
+	r, _ = GlobalSearch(ctx, "sk-abcdef12", 10)
+	if got := types(r); got[SearchTypeToken] != 1 {
+		t.Errorf("key prefix: %v", got)
+	} else if key := toString(r.Groups[0].Items[0]["key"]); key != "abcdef12****" {
+		t.Errorf("key must be masked: %s", key)
+	}
+
+	r, _ = GlobalSearch(ctx, "203.0.113.9", 10)
+	if got := types(r); got[SearchTypeIP] != 1 || toInt64(r.Groups[0].Items[0]["request_count"]) != 2 {
+		t.Errorf("ip: %v", r.Groups)
+	}
+
+	for q, typ := range map[string]string{"2": SearchTypeUser, "REDEEM-KEY-1": SearchTypeRedemption, "T20260101ABC": SearchTypeTopUp} {
+		r, _ = GlobalSearch(ctx, q, 10)
+		if got := types(r); got[typ] != 1 {
+			t.Errorf("%s: %v", q, got)
+		}
+	}
+
+	r, _ = GlobalSearch(ctx, "bob", 10)
+	for _, g := range r.Groups {
+		if g.Type == SearchTypeUser && g.Items[0]["deleted"] != true {
+			t.Errorf("bob should be marked deleted: %v", g.Items[0])
+		}
+	}
+
+	if _, err := GlobalSearch(ctx, "  ", 10); !errors.Is(err, ErrInvalidSearch) {
+		t.Errorf("empty query: %v", err)
+	}
+}
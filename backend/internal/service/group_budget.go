@@ -0,0 +1,562 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+const groupBudgetSettingsKey = "group_budgets"
+
+// groupBudgetThresholds are the used-percent levels that raise an alert, each
+// at most once per group and month
+var groupBudgetThresholds = []int{80, 100}
+
+var ErrInvalidGroupBudget = errors.New("invalid group budget")
+
+// groupBudgetMu serialises checks so a threshold is never alerted twice
+var groupBudgetMu sync.Mutex
+
+// GroupBudget is the quota budget of one user group: a monthly budget, a
+// daily cap, or both
+type GroupBudget struct {
+	Group         string `json:"group"`
+	MonthlyQuota  int64  `json:"monthly_quota"`            // 0 = 不设月度预算
+	DailyQuota    int64  `json:"daily_quota,omitempty"`    // 0 = 不设日额度上限
+	DisableTokens bool   `json:"disable_tokens,omitempty"` // 超出日额度时禁用该分组的令牌，次日自动恢复
+	Note          string `json:"note,omitempty"`
+}
+
+// GroupBudgetSettings 分组额度预算
+type GroupBudgetSettings struct {
+	Enabled          bool          `json:"enabled"` // 是否定时检查并在 80% / 100% 及超出日额度时告警
+	Budgets          []GroupBudget `json:"budgets"`
+	WebhookURL       string        `json:"webhook_url"`
+	WebhookSecret    string        `json:"webhook_secret,omitempty"`
+	HasWebhookSecret bool          `json:"has_webhook_secret"`
+	UpdatedAt        int64         `json:"updated_at"`
+}
+
+// GroupBudgetSettingsInput supports partial update; budgets replaces the whole
+// list. For WebhookSecret: nil = unchanged, empty string = clear.
+type GroupBudgetSettingsInput struct {
+	Enabled       *bool          `json:"enabled"`
+	Budgets       *[]GroupBudget `json:"budgets"`
+	WebhookURL    *string        `json:"webhook_url"`
+	WebhookSecret *string        `json:"webhook_secret"`
+}
+
+// GroupBudgetDay is one day of the burn-down
+type GroupBudgetDay struct {
+	Date           string `json:"date"`
+	Used           int64  `json:"used"`
+	Cumulative     int64  `json:"cumulative"`
+	Remaining      int64  `json:"remaining"`
+	IdealRemaining int64  `json:"ideal_remaining"` // 按天均匀消耗时当天结束应剩余的额度
+}
+
+// GroupBudgetStatus is the consumption of one budgeted group in the month
+type GroupBudgetStatus struct {
+	GroupBudget
+	Used             int64            `json:"used"`
+	Remaining        int64            `json:"remaining"`
+	UsedPercent      float64          `json:"used_percent"`
+	ProjectedUsed    int64            `json:"projected_used"` // 按当前速度推算的月末用量
+	ProjectedPercent float64          `json:"projected_percent"`
+	ExhaustsAt       int64            `json:"exhausts_at"` // 预计耗尽时间，0 = 本月内不会耗尽
+	Status           string           `json:"status"`      // ok | warning | exceeded；未设月度预算时恒为 ok
+	TodayUsed        int64            `json:"today_used"`
+	TodayPercent     float64          `json:"today_percent"` // 今日用量占日额度的百分比，未设日额度时为 0
+	DailyStatus      string           `json:"daily_status"`  // ok | warning | exceeded；未设日额度时为空
+	Daily            []GroupBudgetDay `json:"daily"`
+}
+
+// GroupBudgetAlert is one raised threshold alert
+type GroupBudgetAlert struct {
+	ID        int64  `json:"id"`
+	Group     string `json:"group"`
+	Month     string `json:"month"`
+	Threshold int    `json:"threshold"`
+	Used      int64  `json:"used"`
+	Budget    int64  `json:"budget"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// GroupBudgetReport is the burn-down of every budgeted group for one month
+type GroupBudgetReport struct {
+	Month       string              `json:"month"`
+	Start       int64               `json:"start"`
+	End         int64               `json:"end"`
+	Source      string              `json:"source"` // logs：按日志的 group 字段；users：按用户当前分组
+	Enabled     bool                `json:"enabled"`
+	Budgets     []GroupBudgetStatus `json:"budgets"`
+	Alerts      []GroupBudgetAlert  `json:"alerts"`
+	DailyAlerts []GroupDailyAlert   `json:"daily_alerts"`
+	GeneratedAt int64               `json:"generated_at"`
+}
+
+func normalizeGroupBudgetSettings(s *GroupBudgetSettings) error {
+	seen := map[string]bool{}
+	budgets := make([]GroupBudget, 0, len(s.Budgets))
+	for _, b := range s.Budgets {
+		b.Group = strings.TrimSpace(b.Group)
+		b.Note = strings.TrimSpace(b.Note)
+		if b.Group == "" || len(b.Group) > 64 {
+			return fmt.Errorf("%w: 分组名不能为空且不超过 64 个字符", ErrInvalidGroupBudget)
+		}
+		if seen[b.Group] {
+			return fmt.Errorf("%w: 分组 %s 重复", ErrInvalidGroupBudget, b.Group)
+		}
+		if b.MonthlyQuota < 0 || b.DailyQuota < 0 || (b.MonthlyQuota == 0 && b.DailyQuota == 0) {
+			return fmt.Errorf("%w: 分组 %s 需设置大于 0 的 monthly_quota 或 daily_quota", ErrInvalidGroupBudget, b.Group)
+		}
+		if b.DisableTokens && b.DailyQuota == 0 {
+			return fmt.Errorf("%w: 分组 %s 开启 disable_tokens 时需设置 daily_quota", ErrInvalidGroupBudget, b.Group)
+		}
+		seen[b.Group] = true
+		budgets = append(budgets, b)
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].Group < budgets[j].Group })
+	s.Budgets = budgets
+	s.WebhookURL = strings.TrimSpace(s.WebhookURL)
+	if s.WebhookURL != "" {
+		if u, err := url.Parse(s.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: webhook_url 需为 http(s) 地址", ErrInvalidGroupBudget)
+		}
+	}
+	s.HasWebhookSecret = s.WebhookSecret != ""
+	return nil
+}
+
+// view hides the webhook secret from API responses
+func (s GroupBudgetSettings) view() GroupBudgetSettings {
+	s.HasWebhookSecret = s.WebhookSecret != ""
+	s.WebhookSecret = ""
+	return s
+}
+
+// GroupBudgetService tracks group quota consumption against monthly budgets
+// and daily caps
+type GroupBudgetService struct {
+	db      *database.Manager
+	logDB   *database.Manager
+	writeDB *database.Manager // 禁用 / 恢复令牌
+}
+
+// NewGroupBudgetService creates a new GroupBudgetService
+func NewGroupBudgetService() *GroupBudgetService {
+	return &GroupBudgetService{db: database.GetRead(), logDB: database.GetReadLog(), writeDB: database.Get()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *GroupBudgetService) WithContext(ctx context.Context) *GroupBudgetService {
+	c := *s
+	c.db, c.logDB, c.writeDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx), s.writeDB.WithContext(ctx)
+	return &c
+}
+
+func loadGroupBudgetSettings(ctx context.Context) (GroupBudgetSettings, error) {
+	settings := GroupBudgetSettings{Enabled: true, Budgets: []GroupBudget{}}
+	if _, err := loadLocalSetting(ctx, groupBudgetSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeGroupBudgetSettings(&settings); err != nil {
+		return GroupBudgetSettings{Enabled: true, Budgets: []GroupBudget{}}, nil
+	}
+	return settings, nil
+}
+
+// GetSettings returns the budget settings (no budgets if never saved)
+// without the webhook secret
+func (s *GroupBudgetService) GetSettings(ctx context.Context) (GroupBudgetSettings, error) {
+	settings, err := loadGroupBudgetSettings(ctx)
+	return settings.view(), err
+}
+
+// UpdateSettings applies a partial update
+func (s *GroupBudgetService) UpdateSettings(ctx context.Context, in GroupBudgetSettingsInput) (GroupBudgetSettings, error) {
+	settings, err := loadGroupBudgetSettings(ctx)
+	if err != nil {
+		return settings.view(), err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Budgets != nil {
+		settings.Budgets = *in.Budgets
+	}
+	if in.WebhookURL != nil {
+		settings.WebhookURL = *in.WebhookURL
+	}
+	if in.WebhookSecret != nil {
+		settings.WebhookSecret = strings.TrimSpace(*in.WebhookSecret)
+	}
+	if err := normalizeGroupBudgetSettings(&settings); err != nil {
+		return settings.view(), err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, groupBudgetSettingsKey, settings); err != nil {
+		return settings.view(), err
+	}
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("group_budget:"))
+	return settings.view(), nil
+}
+
+// budgetMonth resolves "YYYY-MM" (empty = current month) to its bounds in the
+// reporting timezone
+func budgetMonth(month string, now time.Time) (string, time.Time, time.Time, error) {
+	loc := ReportLocation()
+	now = now.In(loc)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if month != "" {
+		t, err := time.ParseInLocation("2006-01", month, loc)
+		if err != nil {
+			return "", start, start, fmt.Errorf("%w: month 格式应为 YYYY-MM", ErrInvalidGroupBudget)
+		}
+		if t.After(start) {
+			return "", start, start, fmt.Errorf("%w: 不能查询未来月份", ErrInvalidGroupBudget)
+		}
+		start = t
+	}
+	return start.Format("2006-01"), start, start.AddDate(0, 1, 0), nil
+}
+
+// groupDailyUsage returns group -> local day start -> consumed quota. Day
+// buckets use the timezone offset at the start of the month, so a DST change
+// shifts the boundary by an hour for the rest of that month.
+func (s *GroupBudgetService) groupDailyUsage(start, end time.Time) (map[string]map[int64]int64, string, error) {
+	_, offset := start.Zone()
+	dayExpr := fmt.Sprintf("created_at - ((created_at + %d) %% 86400)", offset)
+	usage := map[string]map[int64]int64{}
+	add := func(group string, day, quota int64) {
+		if group == "" {
+			group = "default"
+		}
+		if usage[group] == nil {
+			usage[group] = map[int64]int64{}
+		}
+		usage[group][day] += quota
+	}
+
+	if s.logDB.ColumnExists("logs", "group") {
+		groupCol := "`group`"
+		if s.logDB.IsPG {
+			groupCol = `"group"`
+		}
+		rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+			SELECT %s AS day, COALESCE(%s, '') AS group_name, COALESCE(SUM(quota), 0) AS quota
+			FROM logs
+			WHERE type = `+ltConsume()+` AND created_at >= ? AND created_at < ?
+			GROUP BY %s, COALESCE(%s, '')`, dayExpr, groupCol, dayExpr, groupCol)), start.Unix(), end.Unix())
+		if err != nil {
+			return nil, "logs", err
+		}
+		for _, r := range rows {
+			add(toString(r["group_name"]), toInt64(r["day"]), toInt64(r["quota"]))
+		}
+		return usage, "logs", nil
+	}
+
+	// 日志没有 group 字段：按用户聚合后映射到用户当前分组（日志可能在独立库，不能 JOIN）
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT user_id, %s AS day, COALESCE(SUM(quota), 0) AS quota
+		FROM logs
+		WHERE type = `+ltConsume()+` AND created_at >= ? AND created_at < ?
+		GROUP BY user_id, %s`, dayExpr, dayExpr)), start.Unix(), end.Unix())
+	if err != nil {
+		return nil, "users", err
+	}
+	seen := map[int64]bool{}
+	var userIDs []int64
+	for _, r := range rows {
+		if uid := toInt64(r["user_id"]); uid > 0 && !seen[uid] {
+			seen[uid] = true
+			userIDs = append(userIDs, uid)
+		}
+	}
+	groupCol := "`group`"
+	if s.db.IsPG {
+		groupCol = `"group"`
+	}
+	userGroups := make(map[int64]string, len(userIDs))
+	const chunk = 500
+	for i := 0; i < len(userIDs); i += chunk {
+		end := min(i+chunk, len(userIDs))
+		in, args := inClause(userIDs[i:end])
+		groupRows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(
+			`SELECT id, COALESCE(%s, '') as group_name FROM users WHERE id IN (%s)`, groupCol, in)), args...)
+		if err != nil {
+			return nil, "users", err
+		}
+		for _, r := range groupRows {
+			userGroups[toInt64(r["id"])] = toString(r["group_name"])
+		}
+	}
+	for _, r := range rows {
+		add(userGroups[toInt64(r["user_id"])], toInt64(r["day"]), toInt64(r["quota"]))
+	}
+	return usage, "users", nil
+}
+
+// buildGroupBudgetStatus computes the burn-down of one group. now caps the
+// days shown and the elapsed time used for the projection; within the month
+// the last day shown is today.
+func buildGroupBudgetStatus(b GroupBudget, daily map[int64]int64, start, end, now time.Time) GroupBudgetStatus {
+	st := GroupBudgetStatus{GroupBudget: b, Daily: []GroupBudgetDay{}}
+	totalDays := int(end.Sub(start).Hours()/24 + 0.5)
+	var cumulative int64
+	for d := 0; d < totalDays; d++ {
+		day := start.AddDate(0, 0, d)
+		if day.After(now) {
+			break
+		}
+		used := daily[start.Unix()+int64(d)*86400] // same fixed-offset buckets as groupDailyUsage
+		cumulative += used
+		st.Daily = append(st.Daily, GroupBudgetDay{
+			Date:           day.Format("2006-01-02"),
+			Used:           used,
+			Cumulative:     cumulative,
+			Remaining:      b.MonthlyQuota - cumulative,
+			IdealRemaining: b.MonthlyQuota - b.MonthlyQuota*int64(d+1)/int64(totalDays),
+		})
+	}
+	st.Used = cumulative
+	if now.Before(end) && len(st.Daily) > 0 {
+		st.TodayUsed = st.Daily[len(st.Daily)-1].Used
+	}
+	if b.DailyQuota > 0 {
+		st.TodayPercent = round2(float64(st.TodayUsed) * 100 / float64(b.DailyQuota))
+		st.DailyStatus = budgetStatus(st.TodayPercent)
+	}
+	if b.MonthlyQuota <= 0 {
+		st.Status = "ok"
+		return st
+	}
+	st.Remaining = b.MonthlyQuota - st.Used
+	st.UsedPercent = round2(float64(st.Used) * 100 / float64(b.MonthlyQuota))
+
+	st.ProjectedUsed = st.Used
+	if now.Before(end) {
+		elapsed := now.Sub(start).Seconds()
+		if elapsed > 0 {
+			rate := float64(st.Used) / elapsed
+			st.ProjectedUsed = int64(rate * end.Sub(start).Seconds())
+			if st.Used < b.MonthlyQuota && rate > 0 {
+				if at := start.Unix() + int64(float64(b.MonthlyQuota)/rate); at < end.Unix() {
+					st.ExhaustsAt = at
+				}
+			}
+		}
+	}
+	st.ProjectedPercent = round2(float64(st.ProjectedUsed) * 100 / float64(b.MonthlyQuota))
+	st.Status = budgetStatus(st.UsedPercent)
+	return st
+}
+
+func budgetStatus(usedPercent float64) string {
+	switch {
+	case usedPercent >= 100:
+		return "exceeded"
+	case usedPercent >= float64(groupBudgetThresholds[0]):
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// GetReport returns the burn-down of all budgeted groups for month
+// ("YYYY-MM", empty = current month)
+func (s *GroupBudgetService) GetReport(ctx context.Context, month string, noCache bool) (*GroupBudgetReport, error) {
+	settings, err := loadGroupBudgetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.report(ctx, settings, month, noCache, time.Now())
+}
+
+func (s *GroupBudgetService) report(ctx context.Context, settings GroupBudgetSettings, month string, noCache bool, now time.Time) (*GroupBudgetReport, error) {
+	month, start, end, err := budgetMonth(month, now)
+	if err != nil {
+		return nil, err
+	}
+	cm := cache.Get()
+	cacheKey := cache.Key("group_budget:%s", month)
+	report := &GroupBudgetReport{}
+	if !noCache {
+		if found, _ := cm.GetJSON(cacheKey, report); found {
+			return report, nil
+		}
+	}
+
+	report = &GroupBudgetReport{
+		Month: month, Start: start.Unix(), End: end.Unix(), Enabled: settings.Enabled,
+		Budgets: []GroupBudgetStatus{}, Alerts: []GroupBudgetAlert{}, DailyAlerts: []GroupDailyAlert{},
+		GeneratedAt: now.Unix(),
+	}
+	if len(settings.Budgets) > 0 {
+		usage, source, err := s.groupDailyUsage(start, end)
+		if err != nil {
+			return nil, err
+		}
+		report.Source = source
+		for _, b := range settings.Budgets {
+			report.Budgets = append(report.Budgets, buildGroupBudgetStatus(b, usage[b.Group], start, end, now))
+		}
+		sort.SliceStable(report.Budgets, func(i, j int) bool {
+			return report.Budgets[i].UsedPercent > report.Budgets[j].UsedPercent
+		})
+	}
+	if alerts, err := listGroupBudgetAlerts(ctx, month); err == nil {
+		report.Alerts = alerts
+	}
+	if alerts, err := listGroupDailyAlerts(ctx, month); err == nil {
+		report.DailyAlerts = alerts
+	}
+	cm.Set(cacheKey, report, 5*time.Minute)
+	return report, nil
+}
+
+func ensureGroupBudgetTables(ctx context.Context, db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS group_budget_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_name TEXT NOT NULL,
+			month TEXT NOT NULL,
+			threshold INTEGER NOT NULL,
+			used INTEGER NOT NULL DEFAULT 0,
+			budget INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			UNIQUE (group_name, month, threshold)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_budget_alerts_month ON group_budget_alerts(month)`,
+		`CREATE TABLE IF NOT EXISTS group_daily_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_name TEXT NOT NULL,
+			day TEXT NOT NULL,
+			used INTEGER NOT NULL DEFAULT 0,
+			budget INTEGER NOT NULL DEFAULT 0,
+			tokens_disabled INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			UNIQUE (group_name, day)
+		)`,
+		`CREATE TABLE IF NOT EXISTS group_budget_disabled_tokens (
+			token_id INTEGER PRIMARY KEY,
+			group_name TEXT NOT NULL,
+			day TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openGroupBudgetStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureGroupBudgetTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func listGroupBudgetAlerts(ctx context.Context, month string) ([]GroupBudgetAlert, error) {
+	db, err := openGroupBudgetStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, group_name, month, threshold, used, budget, created_at
+		FROM group_budget_alerts WHERE month = ? ORDER BY id DESC`, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alerts := []GroupBudgetAlert{}
+	for rows.Next() {
+		var a GroupBudgetAlert
+		if err := rows.Scan(&a.ID, &a.Group, &a.Month, &a.Threshold, &a.Used, &a.Budget, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// CheckAlerts recomputes the current month and raises an alert for every
+// threshold a group has crossed that was not alerted yet this month.
+// Returns the raised alerts.
+func (s *GroupBudgetService) CheckAlerts(ctx context.Context) ([]GroupBudgetAlert, error) {
+	groupBudgetMu.Lock()
+	defer groupBudgetMu.Unlock()
+
+	settings, err := loadGroupBudgetSettings(ctx)
+	if err != nil || !settings.Enabled || len(settings.Budgets) == 0 {
+		return nil, err
+	}
+	report, err := s.report(ctx, settings, "", true, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	db, err := openGroupBudgetStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	raised := []GroupBudgetAlert{}
+	now := time.Now().Unix()
+	for _, st := range report.Budgets {
+		if st.MonthlyQuota <= 0 {
+			continue
+		}
+		for _, threshold := range groupBudgetThresholds {
+			if st.UsedPercent < float64(threshold) {
+				continue
+			}
+			res, err := db.ExecContext(ctx, `
+				INSERT OR IGNORE INTO group_budget_alerts (group_name, month, threshold, used, budget, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)`, st.Group, report.Month, threshold, st.Used, st.MonthlyQuota, now)
+			if err != nil {
+				return raised, err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			alert := GroupBudgetAlert{Group: st.Group, Month: report.Month, Threshold: threshold,
+				Used: st.Used, Budget: st.MonthlyQuota, CreatedAt: now}
+			alert.ID, _ = res.LastInsertId()
+			raised = append(raised, alert)
+			notifyGroupBudget(ctx, settings, map[string]interface{}{
+				"kind":         "monthly",
+				"id":           alert.ID,
+				"group":        alert.Group,
+				"month":        alert.Month,
+				"threshold":    alert.Threshold,
+				"used":         alert.Used,
+				"budget":       alert.Budget,
+				"used_percent": st.UsedPercent,
+			})
+		}
+	}
+	if len(raised) > 0 {
+		_, _ = cache.Get().DeleteByPrefix(cache.Key("group_budget:"))
+	}
+	return raised, nil
+}
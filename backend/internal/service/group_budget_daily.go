@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// GroupDailyAlert is raised the first time a group exceeds its daily cap on
+// a given day
+type GroupDailyAlert struct {
+	ID             int64  `json:"id"`
+	Group          string `json:"group"`
+	Day            string `json:"day"`
+	Used           int64  `json:"used"`
+	Budget         int64  `json:"budget"`
+	TokensDisabled int64  `json:"tokens_disabled"`
+	CreatedAt      int64  `json:"created_at"`
+}
+
+// GroupDailyCheckResult is the outcome of one daily cap check
+type GroupDailyCheckResult struct {
+	Day            string            `json:"day"`
+	Alerts         []GroupDailyAlert `json:"alerts"`          // 本次新触发的超额告警
+	TokensDisabled int64             `json:"tokens_disabled"` // 本次禁用的令牌数
+	TokensRestored int64             `json:"tokens_restored"` // 本次恢复的前几日被禁用的令牌数
+}
+
+// budgetToday returns today's key and bounds in the reporting timezone
+func budgetToday(now time.Time) (string, time.Time, time.Time) {
+	loc := ReportLocation()
+	now = now.In(loc)
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	return start.Format("2006-01-02"), start, start.AddDate(0, 0, 1)
+}
+
+func listGroupDailyAlerts(ctx context.Context, month string) ([]GroupDailyAlert, error) {
+	db, err := openGroupBudgetStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, group_name, day, used, budget, tokens_disabled, created_at
+		FROM group_daily_alerts WHERE day LIKE ? ORDER BY id DESC`, month+"-%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alerts := []GroupDailyAlert{}
+	for rows.Next() {
+		var a GroupDailyAlert
+		if err := rows.Scan(&a.ID, &a.Group, &a.Day, &a.Used, &a.Budget, &a.TokensDisabled, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// CheckDailyCaps compares today's consumption of every group with a daily
+// cap, raises one alert per group and day once the cap is exceeded and, for
+// groups with disable_tokens, disables their enabled tokens (again on every
+// check while over the cap, so tokens created later are covered too). Tokens
+// disabled on an earlier day are re-enabled first, unless someone changed
+// their status in the meantime.
+func (s *GroupBudgetService) CheckDailyCaps(ctx context.Context) (*GroupDailyCheckResult, error) {
+	groupBudgetMu.Lock()
+	defer groupBudgetMu.Unlock()
+
+	day, start, end := budgetToday(time.Now())
+	result := &GroupDailyCheckResult{Day: day, Alerts: []GroupDailyAlert{}}
+	settings, err := loadGroupBudgetSettings(ctx)
+	if err != nil {
+		return result, err
+	}
+	store, err := openGroupBudgetStore(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer store.Close()
+
+	if result.TokensRestored, err = s.restoreDisabledTokens(ctx, store, day); err != nil {
+		return result, err
+	}
+	if !settings.Enabled {
+		return result, nil
+	}
+	capped := []GroupBudget{}
+	for _, b := range settings.Budgets {
+		if b.DailyQuota > 0 {
+			capped = append(capped, b)
+		}
+	}
+	if len(capped) == 0 {
+		return result, nil
+	}
+	usage, _, err := s.groupDailyUsage(start, end)
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now().Unix()
+	for _, b := range capped {
+		used := usage[b.Group][start.Unix()]
+		if used < b.DailyQuota {
+			continue
+		}
+		var disabled int64
+		if b.DisableTokens {
+			if disabled, err = s.disableGroupTokens(ctx, store, b.Group, day); err != nil {
+				return result, err
+			}
+			result.TokensDisabled += disabled
+		}
+		res, err := store.ExecContext(ctx, `
+			INSERT OR IGNORE INTO group_daily_alerts (group_name, day, used, budget, tokens_disabled, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, b.Group, day, used, b.DailyQuota, disabled, now)
+		if err != nil {
+			return result, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		alert := GroupDailyAlert{Group: b.Group, Day: day, Used: used, Budget: b.DailyQuota,
+			TokensDisabled: disabled, CreatedAt: now}
+		alert.ID, _ = res.LastInsertId()
+		result.Alerts = append(result.Alerts, alert)
+		notifyGroupBudget(ctx, settings, map[string]interface{}{
+			"kind":            "daily",
+			"id":              alert.ID,
+			"group":           alert.Group,
+			"day":             alert.Day,
+			"used":            alert.Used,
+			"budget":          alert.Budget,
+			"used_percent":    round2(float64(used) * 100 / float64(b.DailyQuota)),
+			"tokens_disabled": alert.TokensDisabled,
+		})
+	}
+	if len(result.Alerts) > 0 || result.TokensDisabled > 0 || result.TokensRestored > 0 {
+		_, _ = cache.Get().DeleteByPrefix(cache.Key("group_budget:"))
+	}
+	return result, nil
+}
+
+// disableGroupTokens disables the enabled tokens of the group's users and
+// remembers them so they are restored the next day
+func (s *GroupBudgetService) disableGroupTokens(ctx context.Context, store *sql.DB, group, day string) (int64, error) {
+	groupCol := "`group`"
+	if s.writeDB.IsPG {
+		groupCol = `"group"`
+	}
+	rows, err := s.writeDB.Query(s.writeDB.RebindQuery(fmt.Sprintf(`
+		SELECT id FROM tokens
+		WHERE deleted_at IS NULL AND status = 1 AND user_id IN (SELECT id FROM users WHERE %s = ?)`, groupCol)), group)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, toInt64(r["id"]))
+	}
+
+	var disabled int64
+	now := time.Now().Unix()
+	const chunk = 500
+	for i := 0; i < len(ids); i += chunk {
+		batch := ids[i:min(i+chunk, len(ids))]
+		in, args := inClause(batch)
+		n, err := s.writeDB.Execute(s.writeDB.RebindQuery(fmt.Sprintf(
+			"UPDATE tokens SET status = ? WHERE status = 1 AND id IN (%s)", in)),
+			append([]interface{}{tokenStatusDisabled}, args...)...)
+		if err != nil {
+			return disabled, err
+		}
+		disabled += n
+		for _, id := range batch {
+			if _, err := store.ExecContext(ctx, `
+				INSERT OR REPLACE INTO group_budget_disabled_tokens (token_id, group_name, day, created_at)
+				VALUES (?, ?, ?, ?)`, id, group, day, now); err != nil {
+				return disabled, err
+			}
+		}
+	}
+	logger.L.Business(fmt.Sprintf("[分组预算] 分组 %s 超出日额度，已禁用 %d 个令牌", group, disabled))
+	return disabled, nil
+}
+
+// restoreDisabledTokens re-enables tokens disabled by the daily cap before
+// today; tokens that are no longer disabled (re-enabled or deleted by hand)
+// are left as they are
+func (s *GroupBudgetService) restoreDisabledTokens(ctx context.Context, store *sql.DB, today string) (int64, error) {
+	rows, err := store.QueryContext(ctx, `SELECT token_id FROM group_budget_disabled_tokens WHERE day <> ?`, today)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	var restored int64
+	const chunk = 500
+	for i := 0; i < len(ids); i += chunk {
+		in, args := inClause(ids[i:min(i+chunk, len(ids))])
+		n, err := s.writeDB.Execute(s.writeDB.RebindQuery(fmt.Sprintf(
+			"UPDATE tokens SET status = 1 WHERE status = ? AND id IN (%s)", in)),
+			append([]interface{}{tokenStatusDisabled}, args...)...)
+		if err != nil {
+			return restored, err
+		}
+		restored += n
+	}
+	if _, err := store.ExecContext(ctx, `DELETE FROM group_budget_disabled_tokens WHERE day <> ?`, today); err != nil {
+		return restored, err
+	}
+	if restored > 0 {
+		logger.L.Business(fmt.Sprintf("[分组预算] 新的一天，已恢复 %d 个因超出日额度被禁用的令牌", restored))
+	}
+	return restored, nil
+}
+
+// notifyGroupBudget publishes a group_budget event and delivers it to the
+// configured webhook
+func notifyGroupBudget(ctx context.Context, settings GroupBudgetSettings, payload map[string]interface{}) {
+	PublishEvent(EventGroupBudget, payload)
+	if settings.WebhookURL != "" {
+		if err := postGroupBudgetWebhook(ctx, settings, payload); err != nil {
+			logger.L.Warn("[分组预算] webhook 发送失败: "+err.Error(), logger.CatSystem)
+		}
+	}
+}
+
+// postGroupBudgetWebhook delivers the alert to the configured webhook
+func postGroupBudgetWebhook(ctx context.Context, settings GroupBudgetSettings, payload map[string]interface{}) error {
+	return postSignedWebhook(ctx, settings.WebhookURL, settings.WebhookSecret, "NewAPI-Tools/group-budgets", map[string]interface{}{
+		"event":     EventGroupBudget,
+		"data":      payload,
+		"timestamp": time.Now().Unix(),
+	})
+}
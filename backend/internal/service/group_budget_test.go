@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestBuildGroupBudgetStatus(t *testing.T) {
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	daily := map[int64]int64{start.Unix(): 1000, start.Unix() + 86400: 500}
+
+	st := buildGroupBudgetStatus(GroupBudget{Group: "vip", MonthlyQuota: 3000}, daily, start, end, start.Add(48*time.Hour))
+	if st.Used != 1500 || st.Remaining != 1500 || st.UsedPercent != 50 || st.Status != "ok" {
+		t.Fatalf("status = %+v", st)
+	}
+	if len(st.Daily) != 3 || st.Daily[1].Cumulative != 1500 || st.Daily[0].IdealRemaining != 2900 {
+		t.Errorf("daily = %+v", st.Daily)
+	}
+	if st.ProjectedUsed != 22500 || st.ExhaustsAt != start.Unix()+4*86400 {
+		t.Errorf("projection = %d, exhausts at %d", st.ProjectedUsed, st.ExhaustsAt)
+	}
+
+	// A finished month projects its actual usage
+	past := buildGroupBudgetStatus(GroupBudget{Group: "vip", MonthlyQuota: 1200}, daily, start, end, end.Add(time.Hour))
+	if len(past.Daily) != 30 || past.ProjectedUsed != 1500 || past.ExhaustsAt != 0 || past.Status != "exceeded" {
+		t.Errorf("past month = %+v", past)
+	}
+
+	if _, _, _, err := budgetMonth("2026-13", start); !errors.Is(err, ErrInvalidGroupBudget) {
+		t.Errorf("bad month: %v", err)
+	}
+	if _, _, _, err := budgetMonth("2026-05", start); !errors.Is(err, ErrInvalidGroupBudget) {
+		t.Errorf("future month: %v", err)
+	}
+}
+
+func TestGroupBudgetAlerts(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { cache.Get().DeleteByPrefix(cache.Key("group_budget:")) })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, "group" TEXT);
+		INSERT INTO users VALUES (1, 'alice', 'vip'), (2, 'bob', ''), (3, 'carol', 'vip');
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type INTEGER, quota INTEGER, created_at INTEGER);`); err != nil {
+		t.Fatal(err)
+	}
+	_, monthStart, _, _ := budgetMonth("", time.Now())
+	at := max(time.Now().Unix()-60, monthStart.Unix())
+	insert := func(userID, logType, quota int64) {
+		if _, err := db.Exec(`INSERT INTO logs (user_id, type, quota, created_at) VALUES (?, ?, ?, ?)`, userID, logType, quota, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(1, 2, 600)
+	insert(3, 2, 300)
+	insert(2, 2, 100)
+	insert(1, 5, 5000) // failed requests are not billed
+	insert(2, 1, 9999) // top-ups are not consumption
+	svc := NewGroupBudgetService()
+	ctx := context.Background()
+
+	if _, err := svc.UpdateSettings(ctx, GroupBudgetSettingsInput{Budgets: &[]GroupBudget{{Group: "vip", MonthlyQuota: 0}}}); !errors.Is(err, ErrInvalidGroupBudget) {
+		t.Errorf("zero budget: %v", err)
+	}
+	if _, err := svc.UpdateSettings(ctx, GroupBudgetSettingsInput{Budgets: &[]GroupBudget{
+		{Group: " vip ", MonthlyQuota: 1000}, {Group: "default", MonthlyQuota: 10000},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	raised, err := svc.CheckAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raised) != 1 || raised[0].Group != "vip" || raised[0].Threshold != 80 || raised[0].Used != 900 {
+		t.Fatalf("raised = %+v", raised)
+	}
+	if again, _ := svc.CheckAlerts(ctx); len(again) != 0 {
+		t.Errorf("threshold alerted twice: %+v", again)
+	}
+
+	insert(3, 2, 200)
+	if raised, _ = svc.CheckAlerts(ctx); len(raised) != 1 || raised[0].Threshold != 100 {
+		t.Fatalf("100%% alert = %+v", raised)
+	}
+
+	report, err := svc.GetReport(ctx, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Source != "users" || len(report.Budgets) != 2 || len(report.Alerts) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if vip := report.Budgets[0]; vip.Group != "vip" || vip.Used != 1100 || vip.Status != "exceeded" {
+		t.Errorf("vip = %+v", vip)
+	}
+	if def := report.Budgets[1]; def.Group != "default" || def.Used != 100 || def.Status != "ok" {
+		t.Errorf("default = %+v", def)
+	}
+}
+
+func TestGroupBudgetDailyCap(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { cache.Get().DeleteByPrefix(cache.Key("group_budget:")) })
+
+	hooks := make(chan map[string]interface{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Event string                 `json:"event"`
+			Data  map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil && body.Event == EventGroupBudget && r.Header.Get("X-Signature") != "" {
+			hooks <- body.Data
+		}
+	}))
+	defer srv.Close()
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, `group` TEXT);" + `
+		CREATE TABLE tokens (id INTEGER PRIMARY KEY, name TEXT, user_id INTEGER, status INTEGER, deleted_at DATETIME);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type INTEGER, quota INTEGER, created_at INTEGER);
+		INSERT INTO users VALUES (1, 'alice', 'vip'), (2, 'bob', 'default');
+		INSERT INTO tokens VALUES (1, 'alice-a', 1, 1, NULL), (2, 'alice-b', 1, 2, NULL), (3, 'bob-a', 2, 1, NULL);`); err != nil {
+		t.Fatal(err)
+	}
+	_, dayStart, _ := budgetToday(time.Now())
+	at := max(time.Now().Unix()-60, dayStart.Unix())
+	for _, quota := range []int64{400, 200} {
+		if _, err := db.Exec(`INSERT INTO logs (user_id, type, quota, created_at) VALUES (1, 2, ?, ?)`, quota, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func(id int) int64 {
+		var s int64
+		if err := db.Get(&s, "SELECT status FROM tokens WHERE id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	svc := NewGroupBudgetService()
+	ctx := context.Background()
+
+	for _, bad := range []GroupBudget{{Group: "vip"}, {Group: "vip", MonthlyQuota: 1000, DisableTokens: true}} {
+		if _, err := svc.UpdateSettings(ctx, GroupBudgetSettingsInput{Budgets: &[]GroupBudget{bad}}); !errors.Is(err, ErrInvalidGroupBudget) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+	secret := "s3cret"
+	settings, err := svc.UpdateSettings(ctx, GroupBudgetSettingsInput{
+		Budgets:       &[]GroupBudget{{Group: "vip", DailyQuota: 500, DisableTokens: true}, {Group: "default", DailyQuota: 500}},
+		WebhookURL:    &srv.URL,
+		WebhookSecret: &secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.WebhookSecret != "" || !settings.HasWebhookSecret {
+		t.Errorf("secret leaked: %+v", settings)
+	}
+
+	result, err := svc.CheckDailyCaps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Alerts) != 1 || result.Alerts[0].Group != "vip" || result.Alerts[0].Used != 600 || result.TokensDisabled != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	if status(1) != tokenStatusDisabled || status(3) != 1 {
+		t.Errorf("token status = %d, %d", status(1), status(3))
+	}
+	select {
+	case hook := <-hooks:
+		if hook["kind"] != "daily" || hook["group"] != "vip" {
+			t.Errorf("webhook = %v", hook)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	if again, _ := svc.CheckDailyCaps(ctx); len(again.Alerts) != 0 || again.TokensDisabled != 0 {
+		t.Errorf("daily cap alerted twice: %+v", again)
+	}
+
+	report, err := svc.GetReport(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.DailyAlerts) != 1 || len(report.Alerts) != 0 {
+		t.Fatalf("report alerts = %+v / %+v", report.DailyAlerts, report.Alerts)
+	}
+	for _, st := range report.Budgets {
+		if st.Group == "vip" && (st.TodayUsed != 600 || st.TodayPercent != 120 || st.DailyStatus != "exceeded" || st.Status != "ok") {
+			t.Errorf("vip = %+v", st)
+		}
+	}
+
+	// The next day the disabled tokens come back; the token alice disabled herself stays disabled
+	store, err := openGroupBudgetStore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.Exec(`UPDATE group_budget_disabled_tokens SET day = '2000-01-01'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM logs`); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = svc.CheckDailyCaps(ctx); err != nil || result.TokensRestored != 1 || result.TokensDisabled != 0 {
+		t.Fatalf("restore = %+v, %v", result, err)
+	}
+	if status(1) != 1 || status(2) != tokenStatusDisabled {
+		t.Errorf("token status after restore = %d, %d", status(1), status(2))
+	}
+}
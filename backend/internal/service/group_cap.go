@@ -0,0 +1,33 @@
+package service
+
+// groupedRowCap bounds the rows returned by endpoints that GROUP BY ip or
+// model_name; large installs see tens of thousands of distinct IPs per
+// window. Queries fetch cap+1 rows so truncation can be detected.
+const groupedRowCap = 500
+
+// groupedOtherKey labels the row aggregating every group past the cap
+const groupedOtherKey = "other"
+
+// foldOtherGroup keeps the first limit rows of a weight-ordered GROUP BY
+// result and appends an "other" row for the rest. totals is the ungrouped
+// aggregate over the same WHERE, carrying the distinct group count as
+// "group_count": each sumCol of the other row is the total minus the kept
+// rows. Rows within the cap are returned unchanged.
+func foldOtherGroup(rows []map[string]interface{}, limit int, keyCol string, totals map[string]interface{}, sumCols ...string) []map[string]interface{} {
+	if len(rows) <= limit {
+		return rows
+	}
+	rows = rows[:limit]
+	other := map[string]interface{}{keyCol: groupedOtherKey, "group_count": toInt64(totals["group_count"]) - int64(limit)}
+	for _, col := range sumCols {
+		rest := toInt64(totals[col])
+		for _, row := range rows {
+			rest -= toInt64(row[col])
+		}
+		if rest < 0 {
+			rest = 0
+		}
+		other[col] = rest
+	}
+	return append(rows, other)
+}
@@ -0,0 +1,810 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const ipBlocklistSettingsKey = "ip_blocklist"
+
+// IP blocklist enforcement actions
+const (
+	IPBlockActionDisableTokens = "disable_tokens"
+	IPBlockActionBanUser       = "ban_user"
+)
+
+// IP blocklist entry sources
+const (
+	IPBlockSourceLocal = "local"
+	IPBlockSourceAIBan = "ai_ban" // AI 封禁配置中的 blacklist_ips，只读
+)
+
+var (
+	ErrInvalidCIDR            = errors.New("invalid IP or CIDR")
+	ErrIPBlocklistEntryExists = errors.New("IP blocklist entry already exists")
+	ErrIPBlocklistNotFound    = errors.New("IP blocklist entry not found")
+)
+
+// IPBlocklistSettings IP 黑名单执行配置
+type IPBlocklistSettings struct {
+	Enabled          bool    `json:"enabled"`
+	IntervalMinutes  int     `json:"interval_minutes"`
+	WindowMinutes    int     `json:"window_minutes"`    // 统计最近请求的窗口
+	MinRequests      int     `json:"min_requests"`      // 窗口内请求数不足时不判定
+	ThresholdPercent float64 `json:"threshold_percent"` // 来自黑名单网段的请求占比 ≥ 该值时处置
+	Action           string  `json:"action"`            // disable_tokens | ban_user
+	DryRun           bool    `json:"dry_run"`
+	IncludeAIBanList bool    `json:"include_ai_ban_list"` // 合并 AI 封禁配置中的 blacklist_ips / whitelist_ips
+	UpdatedAt        int64   `json:"updated_at"`
+}
+
+// IPBlocklistSettingsInput supports partial update of IPBlocklistSettings
+type IPBlocklistSettingsInput struct {
+	Enabled          *bool    `json:"enabled"`
+	IntervalMinutes  *int     `json:"interval_minutes"`
+	WindowMinutes    *int     `json:"window_minutes"`
+	MinRequests      *int     `json:"min_requests"`
+	ThresholdPercent *float64 `json:"threshold_percent"`
+	Action           *string  `json:"action"`
+	DryRun           *bool    `json:"dry_run"`
+	IncludeAIBanList *bool    `json:"include_ai_ban_list"`
+}
+
+// IPBlocklistEntry is one blocked IP or CIDR range
+type IPBlocklistEntry struct {
+	ID        int64  `json:"id"`
+	CIDR      string `json:"cidr"`
+	Note      string `json:"note"`
+	Enabled   bool   `json:"enabled"`
+	Source    string `json:"source"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// IPBlocklistEntryInput supports create / partial update of an entry
+type IPBlocklistEntryInput struct {
+	CIDR    *string `json:"cidr"`
+	Note    *string `json:"note"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// IPBlocklistHit is a user or token whose recent traffic is predominantly
+// from blocklisted ranges
+type IPBlocklistHit struct {
+	TargetType      string   `json:"target_type"` // user | token
+	UserID          int64    `json:"user_id"`
+	Username        string   `json:"username"`
+	TokenID         int64    `json:"token_id"`
+	TokenName       string   `json:"token_name"`
+	Requests        int64    `json:"requests"`
+	BlockedRequests int64    `json:"blocked_requests"`
+	BlockedPercent  float64  `json:"blocked_percent"`
+	MatchedIPs      []string `json:"matched_ips"`
+	MatchedRules    []string `json:"matched_rules"`
+	Applied         bool     `json:"applied"`
+	Skipped         string   `json:"skipped,omitempty"` // whitelisted | already_disabled | 执行错误
+}
+
+// IPBlocklistEnforceResult summarises one enforcement pass
+type IPBlocklistEnforceResult struct {
+	DryRun        bool             `json:"dry_run"`
+	Action        string           `json:"action"`
+	WindowMinutes int              `json:"window_minutes"`
+	Rules         int              `json:"rules"`
+	Targets       int              `json:"targets"` // users / tokens with traffic in the window
+	Hits          []IPBlocklistHit `json:"hits"`
+	Applied       int              `json:"applied"`
+	Duration      int64            `json:"duration_ms"`
+}
+
+// IPBlocklistService manages blocked IP ranges and enforces them against the
+// IPs recorded in logs: tokens (or users) whose recent requests come mostly
+// from blocked ranges are disabled (or banned).
+type IPBlocklistService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// ipBlocklistEnforceMu serialises enforcement passes (background vs manual)
+var ipBlocklistEnforceMu sync.Mutex
+
+// NewIPBlocklistService creates a new IPBlocklistService
+func NewIPBlocklistService() *IPBlocklistService {
+	return &IPBlocklistService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *IPBlocklistService) WithContext(ctx context.Context) *IPBlocklistService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func defaultIPBlocklistSettings() IPBlocklistSettings {
+	return IPBlocklistSettings{
+		IntervalMinutes:  15,
+		WindowMinutes:    60,
+		MinRequests:      20,
+		ThresholdPercent: 80,
+		Action:           IPBlockActionDisableTokens,
+		DryRun:           true,
+		IncludeAIBanList: true,
+	}
+}
+
+func normalizeIPBlocklistSettings(s *IPBlocklistSettings) {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 5, 1440, 15)
+	s.WindowMinutes = clampSetting(s.WindowMinutes, 5, 10080, 60)
+	s.MinRequests = clampSetting(s.MinRequests, 1, 100000, 20)
+	if s.ThresholdPercent <= 0 || s.ThresholdPercent > 100 {
+		s.ThresholdPercent = 80
+	}
+	if s.Action != IPBlockActionBanUser {
+		s.Action = IPBlockActionDisableTokens
+	}
+}
+
+// GetSettings returns the enforcement settings (defaults if never saved)
+func (s *IPBlocklistService) GetSettings(ctx context.Context) (IPBlocklistSettings, error) {
+	settings := defaultIPBlocklistSettings()
+	if _, err := loadLocalSetting(ctx, ipBlocklistSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	normalizeIPBlocklistSettings(&settings)
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update and persists it
+func (s *IPBlocklistService) UpdateSettings(ctx context.Context, in IPBlocklistSettingsInput) (IPBlocklistSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.WindowMinutes != nil {
+		settings.WindowMinutes = *in.WindowMinutes
+	}
+	if in.MinRequests != nil {
+		settings.MinRequests = *in.MinRequests
+	}
+	if in.ThresholdPercent != nil {
+		settings.ThresholdPercent = *in.ThresholdPercent
+	}
+	if in.Action != nil {
+		settings.Action = strings.TrimSpace(*in.Action)
+	}
+	if in.DryRun != nil {
+		settings.DryRun = *in.DryRun
+	}
+	if in.IncludeAIBanList != nil {
+		settings.IncludeAIBanList = *in.IncludeAIBanList
+	}
+	normalizeIPBlocklistSettings(&settings)
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, ipBlocklistSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// normalizeBlocklistCIDR parses an IP or CIDR and returns its canonical
+// network form; a bare IP becomes /32 (IPv4) or /128 (IPv6).
+func normalizeBlocklistCIDR(value string) (string, *net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil, ErrInvalidCIDR
+	}
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidCIDR, value)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			value = ip4.String() + "/32"
+		} else {
+			value = ip.String() + "/128"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidCIDR, value)
+	}
+	return ipNet.String(), ipNet, nil
+}
+
+// ListEntries returns local entries followed by the read-only AI ban
+// blacklist_ips (when merged via settings)
+func (s *IPBlocklistService) ListEntries(ctx context.Context) ([]IPBlocklistEntry, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureIPBlocklistTables(ctx, store); err != nil {
+		return nil, err
+	}
+	entries, err := listIPBlocklistEntries(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	if settings.IncludeAIBanList {
+		entries = append(entries, aiBanListEntries("blacklist_ips")...)
+	}
+	return entries, nil
+}
+
+// AddEntry stores a new blocked IP / CIDR
+func (s *IPBlocklistService) AddEntry(ctx context.Context, cidr, note string) (*IPBlocklistEntry, error) {
+	normalized, _, err := normalizeBlocklistCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureIPBlocklistTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	var exists int
+	if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM ip_blocklist WHERE cidr = ?`, normalized).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrIPBlocklistEntryExists, normalized)
+	}
+
+	now := time.Now().Unix()
+	res, err := store.ExecContext(ctx, `INSERT INTO ip_blocklist (cidr, note, enabled, created_at, updated_at) VALUES (?, ?, 1, ?, ?)`,
+		normalized, strings.TrimSpace(note), now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	logger.L.Security(fmt.Sprintf("IP 黑名单新增 %s", normalized))
+	return &IPBlocklistEntry{ID: id, CIDR: normalized, Note: strings.TrimSpace(note), Enabled: true,
+		Source: IPBlockSourceLocal, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// UpdateEntry applies a partial update to a local entry
+func (s *IPBlocklistService) UpdateEntry(ctx context.Context, id int64, in IPBlocklistEntryInput) (*IPBlocklistEntry, error) {
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureIPBlocklistTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	entry, err := getIPBlocklistEntry(ctx, store, id)
+	if err != nil {
+		return nil, err
+	}
+	if in.CIDR != nil {
+		normalized, _, err := normalizeBlocklistCIDR(*in.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		var exists int
+		if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM ip_blocklist WHERE cidr = ? AND id <> ?`, normalized, id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrIPBlocklistEntryExists, normalized)
+		}
+		entry.CIDR = normalized
+	}
+	if in.Note != nil {
+		entry.Note = strings.TrimSpace(*in.Note)
+	}
+	if in.Enabled != nil {
+		entry.Enabled = *in.Enabled
+	}
+	entry.UpdatedAt = time.Now().Unix()
+	if _, err := store.ExecContext(ctx, `UPDATE ip_blocklist SET cidr = ?, note = ?, enabled = ?, updated_at = ? WHERE id = ?`,
+		entry.CIDR, entry.Note, boolToInt(entry.Enabled), entry.UpdatedAt, id); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DeleteEntry removes a local entry
+func (s *IPBlocklistService) DeleteEntry(ctx context.Context, id int64) error {
+	store, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := ensureIPBlocklistTables(ctx, store); err != nil {
+		return err
+	}
+	res, err := store.ExecContext(ctx, `DELETE FROM ip_blocklist WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrIPBlocklistNotFound
+	}
+	logger.L.Security(fmt.Sprintf("IP 黑名单删除 #%d", id))
+	return nil
+}
+
+// CheckIP reports which enabled rules match ip (and whether a whitelist overrides them)
+func (s *IPBlocklistService) CheckIP(ctx context.Context, ip string) (map[string]interface{}, error) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCIDR, ip)
+	}
+	matcher, err := s.loadMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules, whitelisted := matcher.match(parsed)
+	if rules == nil {
+		rules = []string{}
+	}
+	return map[string]interface{}{
+		"ip":          parsed.String(),
+		"blocked":     len(rules) > 0 && !whitelisted,
+		"whitelisted": whitelisted,
+		"rules":       rules,
+	}, nil
+}
+
+// ipBlockMatcher matches IPs against enabled blocklist ranges; allow ranges
+// (AI ban whitelist_ips) take precedence.
+type ipBlockMatcher struct {
+	block []*net.IPNet
+	allow []*net.IPNet
+}
+
+func newIPBlockMatcher(block, allow []string) *ipBlockMatcher {
+	m := &ipBlockMatcher{}
+	for _, v := range block {
+		if _, n, err := normalizeBlocklistCIDR(v); err == nil {
+			m.block = append(m.block, n)
+		}
+	}
+	for _, v := range allow {
+		if _, n, err := normalizeBlocklistCIDR(v); err == nil {
+			m.allow = append(m.allow, n)
+		}
+	}
+	return m
+}
+
+// match returns the matched block rules and whether ip is whitelisted
+func (m *ipBlockMatcher) match(ip net.IP) ([]string, bool) {
+	var rules []string
+	for _, n := range m.block {
+		if n.Contains(ip) {
+			rules = append(rules, n.String())
+		}
+	}
+	if len(rules) == 0 {
+		return nil, false
+	}
+	for _, n := range m.allow {
+		if n.Contains(ip) {
+			return rules, true
+		}
+	}
+	return rules, false
+}
+
+func (s *IPBlocklistService) loadMatcher(ctx context.Context) (*ipBlockMatcher, error) {
+	entries, err := s.ListEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	block := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Enabled {
+			block = append(block, e.CIDR)
+		}
+	}
+	var allow []string
+	if settings, err := s.GetSettings(ctx); err == nil && settings.IncludeAIBanList {
+		for _, e := range aiBanListEntries("whitelist_ips") {
+			allow = append(allow, e.CIDR)
+		}
+	}
+	return newIPBlockMatcher(block, allow), nil
+}
+
+// ipBlockTarget accumulates the traffic of one user / token in the window
+type ipBlockTarget struct {
+	hit   IPBlocklistHit
+	ips   map[string]bool
+	rules map[string]bool
+}
+
+// Enforce scans the recent logs and disables tokens (or bans users) whose
+// requests with a recorded IP come from blocklisted ranges at or above the
+// configured share. dryRun overrides the saved setting when non-nil.
+func (s *IPBlocklistService) Enforce(ctx context.Context, dryRun *bool) (*IPBlocklistEnforceResult, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun != nil {
+		settings.DryRun = *dryRun
+	}
+	matcher, err := s.loadMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ipBlocklistEnforceMu.Lock()
+	defer ipBlocklistEnforceMu.Unlock()
+
+	start := time.Now()
+	result := &IPBlocklistEnforceResult{
+		DryRun:        settings.DryRun,
+		Action:        settings.Action,
+		WindowMinutes: settings.WindowMinutes,
+		Rules:         len(matcher.block),
+		Hits:          []IPBlocklistHit{},
+	}
+	if len(matcher.block) == 0 {
+		return result, nil
+	}
+
+	since := time.Now().Unix() - int64(settings.WindowMinutes)*60
+	rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT user_id, COALESCE(token_id, 0) as token_id,
+			MAX(COALESCE(username, '')) as username, MAX(COALESCE(token_name, '')) as token_name,
+			ip, COUNT(*) as requests
+		FROM logs
+		WHERE created_at >= ? AND type IN (`+ltRequests()+`) AND ip IS NOT NULL AND ip != ''
+		GROUP BY user_id, COALESCE(token_id, 0), ip`), since)
+	if err != nil {
+		return nil, fmt.Errorf("blocklist traffic query failed: %w", err)
+	}
+
+	byUser := settings.Action == IPBlockActionBanUser
+	targets := map[int64]*ipBlockTarget{}
+	for _, row := range rows {
+		userID := toInt64(row["user_id"])
+		tokenID := toInt64(row["token_id"])
+		key := tokenID
+		if byUser {
+			key = userID
+		}
+		if key <= 0 {
+			continue
+		}
+		t := targets[key]
+		if t == nil {
+			t = &ipBlockTarget{ips: map[string]bool{}, rules: map[string]bool{}}
+			t.hit.UserID = userID
+			t.hit.Username = toString(row["username"])
+			if byUser {
+				t.hit.TargetType = "user"
+			} else {
+				t.hit.TargetType = "token"
+				t.hit.TokenID = tokenID
+				t.hit.TokenName = toString(row["token_name"])
+			}
+			targets[key] = t
+		}
+		requests := toInt64(row["requests"])
+		t.hit.Requests += requests
+		ip := strings.TrimSpace(toString(row["ip"]))
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		if rules, whitelisted := matcher.match(parsed); len(rules) > 0 && !whitelisted {
+			t.hit.BlockedRequests += requests
+			t.ips[ip] = true
+			for _, r := range rules {
+				t.rules[r] = true
+			}
+		}
+	}
+	result.Targets = len(targets)
+
+	for _, t := range targets {
+		if t.hit.Requests < int64(settings.MinRequests) || t.hit.BlockedRequests == 0 {
+			continue
+		}
+		t.hit.BlockedPercent = roundRate(float64(t.hit.BlockedRequests) / float64(t.hit.Requests) * 100)
+		if t.hit.BlockedPercent < settings.ThresholdPercent {
+			continue
+		}
+		t.hit.MatchedIPs = sortedKeys(t.ips, 10)
+		t.hit.MatchedRules = sortedKeys(t.rules, 0)
+		result.Hits = append(result.Hits, t.hit)
+	}
+	sort.Slice(result.Hits, func(i, j int) bool {
+		if result.Hits[i].BlockedRequests != result.Hits[j].BlockedRequests {
+			return result.Hits[i].BlockedRequests > result.Hits[j].BlockedRequests
+		}
+		return result.Hits[i].TokenID+result.Hits[i].UserID < result.Hits[j].TokenID+result.Hits[j].UserID
+	})
+
+	if err := s.applyHits(ctx, settings, result); err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(start).Milliseconds()
+
+	PublishEvent(EventScanFinished, map[string]interface{}{
+		"scanner": "ip_blocklist",
+		"dry_run": result.DryRun,
+		"hits":    len(result.Hits),
+		"applied": result.Applied,
+	})
+	return result, nil
+}
+
+// applyHits marks whitelisted / already disabled targets and, outside dry
+// run, disables the rest and records the action.
+func (s *IPBlocklistService) applyHits(ctx context.Context, settings IPBlocklistSettings, result *IPBlocklistEnforceResult) error {
+	if len(result.Hits) == 0 {
+		return nil
+	}
+	userIDs := make([]int64, 0, len(result.Hits))
+	for _, h := range result.Hits {
+		userIDs = append(userIDs, h.UserID)
+	}
+	whitelisted, err := whitelistedUsers(s.db.WithContext(ctx), userIDs, 5)
+	if err != nil {
+		return err
+	}
+	active, err := s.activeTargets(result.Hits, settings.Action == IPBlockActionBanUser)
+	if err != nil {
+		return err
+	}
+
+	var store *sql.DB
+	if !settings.DryRun {
+		store, err = openLocalStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if err := ensureIPBlocklistTables(ctx, store); err != nil {
+			return err
+		}
+	}
+
+	um := NewUserManagementService()
+	for i := range result.Hits {
+		h := &result.Hits[i]
+		id := h.TokenID
+		if h.TargetType == "user" {
+			id = h.UserID
+		}
+		switch {
+		case whitelisted[h.UserID] != "":
+			h.Skipped = "whitelisted"
+			continue
+		case !active[id]:
+			h.Skipped = "already_disabled"
+			continue
+		case settings.DryRun:
+			continue
+		}
+
+		if h.TargetType == "user" {
+			err = um.BanUser(h.UserID, true)
+		} else {
+			err = um.DisableToken(h.TokenID)
+		}
+		if err != nil {
+			h.Skipped = err.Error()
+			continue
+		}
+		h.Applied = true
+		result.Applied++
+
+		now := time.Now().Unix()
+		if _, err := store.ExecContext(ctx, `
+			INSERT INTO ip_blocklist_actions (target_type, user_id, username, token_id, token_name, action, requests, blocked_requests, blocked_percent, matched_ips, matched_rules, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			h.TargetType, h.UserID, h.Username, h.TokenID, h.TokenName, settings.Action, h.Requests, h.BlockedRequests,
+			h.BlockedPercent, strings.Join(h.MatchedIPs, ","), strings.Join(h.MatchedRules, ","), now); err != nil {
+			logger.L.Warn("[IP黑名单] 记录处置失败: "+err.Error(), logger.CatSystem)
+		}
+		logger.L.Security(fmt.Sprintf("[IP黑名单] %s 用户 %d (%s) Token %d | 黑名单请求 %d/%d (%.2f%%)",
+			settings.Action, h.UserID, h.Username, h.TokenID, h.BlockedRequests, h.Requests, h.BlockedPercent))
+		PublishEvent(EventIPBlocklistEnforced, map[string]interface{}{
+			"action":          settings.Action,
+			"user_id":         h.UserID,
+			"username":        h.Username,
+			"token_id":        h.TokenID,
+			"blocked_percent": h.BlockedPercent,
+		})
+	}
+	return nil
+}
+
+// activeTargets returns which hit users / tokens are still enabled (status = 1)
+func (s *IPBlocklistService) activeTargets(hits []IPBlocklistHit, byUser bool) (map[int64]bool, error) {
+	table := "tokens"
+	ids := make([]interface{}, 0, len(hits))
+	for _, h := range hits {
+		if byUser {
+			ids = append(ids, h.UserID)
+		} else {
+			ids = append(ids, h.TokenID)
+		}
+	}
+	if byUser {
+		table = "users"
+	}
+	rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(
+		"SELECT id FROM %s WHERE status = 1 AND id IN (%s)", table, buildPlaceholders(s.db.IsPG, len(ids), 1))), ids...)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		active[toInt64(row["id"])] = true
+	}
+	return active, nil
+}
+
+// ListActions returns the most recent enforcement actions
+func (s *IPBlocklistService) ListActions(ctx context.Context, limit int) ([]map[string]interface{}, error) {
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureIPBlocklistTables(ctx, store); err != nil {
+		return nil, err
+	}
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, target_type, user_id, username, token_id, token_name, action, requests, blocked_requests,
+			blocked_percent, matched_ips, matched_rules, created_at
+		FROM ip_blocklist_actions ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []map[string]interface{}{}
+	for rows.Next() {
+		var id, userID, tokenID, requests, blocked, createdAt int64
+		var targetType, username, tokenName, action, ips, rules string
+		var percent float64
+		if err := rows.Scan(&id, &targetType, &userID, &username, &tokenID, &tokenName, &action, &requests, &blocked,
+			&percent, &ips, &rules, &createdAt); err != nil {
+			return nil, err
+		}
+		items = append(items, map[string]interface{}{
+			"id":               id,
+			"target_type":      targetType,
+			"user_id":          userID,
+			"username":         username,
+			"token_id":         tokenID,
+			"token_name":       tokenName,
+			"action":           action,
+			"requests":         requests,
+			"blocked_requests": blocked,
+			"blocked_percent":  percent,
+			"matched_ips":      splitCSV(ips),
+			"matched_rules":    splitCSV(rules),
+			"created_at":       createdAt,
+		})
+	}
+	return items, rows.Err()
+}
+
+// aiBanListEntries exposes an AI ban IP list (blacklist_ips / whitelist_ips)
+// as read-only entries; invalid values are dropped.
+func aiBanListEntries(key string) []IPBlocklistEntry {
+	values := aiBanConfigList(NewAIAutoBanService().GetConfig(), key)
+	entries := []IPBlocklistEntry{}
+	seen := map[string]bool{}
+	for _, v := range values {
+		normalized, _, err := normalizeBlocklistCIDR(v)
+		if err != nil || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		entries = append(entries, IPBlocklistEntry{CIDR: normalized, Note: "AI 封禁配置", Enabled: true, Source: IPBlockSourceAIBan})
+	}
+	return entries
+}
+
+// sortedKeys returns the keys of set in order, capped at limit (0 = no cap)
+func sortedKeys(set map[string]bool, limit int) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+func getIPBlocklistEntry(ctx context.Context, db *sql.DB, id int64) (*IPBlocklistEntry, error) {
+	var e IPBlocklistEntry
+	var enabled int
+	err := db.QueryRowContext(ctx, `SELECT id, cidr, note, enabled, created_at, updated_at FROM ip_blocklist WHERE id = ?`, id).
+		Scan(&e.ID, &e.CIDR, &e.Note, &enabled, &e.CreatedAt, &e.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrIPBlocklistNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.Enabled = enabled == 1
+	e.Source = IPBlockSourceLocal
+	return &e, nil
+}
+
+func listIPBlocklistEntries(ctx context.Context, db *sql.DB) ([]IPBlocklistEntry, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, cidr, note, enabled, created_at, updated_at FROM ip_blocklist ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []IPBlocklistEntry{}
+	for rows.Next() {
+		var e IPBlocklistEntry
+		var enabled int
+		if err := rows.Scan(&e.ID, &e.CIDR, &e.Note, &enabled, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		e.Enabled = enabled == 1
+		e.Source = IPBlockSourceLocal
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func ensureIPBlocklistTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS ip_blocklist (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			cidr TEXT NOT NULL UNIQUE,
+			note TEXT NOT NULL DEFAULT '',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS ip_blocklist_actions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			target_type TEXT NOT NULL DEFAULT '',
+			user_id INTEGER NOT NULL DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			token_id INTEGER NOT NULL DEFAULT 0,
+			token_name TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL DEFAULT '',
+			requests INTEGER NOT NULL DEFAULT 0,
+			blocked_requests INTEGER NOT NULL DEFAULT 0,
+			blocked_percent REAL NOT NULL DEFAULT 0,
+			matched_ips TEXT NOT NULL DEFAULT '',
+			matched_rules TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0
+		)`)
+	return err
+}
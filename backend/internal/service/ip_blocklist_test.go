@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestNormalizeBlocklistCIDR(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.7":    "203.0.113.7/32",
+		" 10.1.2.3/8 ":   "10.0.0.0/8",
+		"2001:db8::1":    "2001:db8::1/128",
+		"2001:db8::/32":  "2001:db8::/32",
+		"::ffff:1.2.3.4": "1.2.3.4/32",
+	}
+	for in, want := range cases {
+		got, _, err := normalizeBlocklistCIDR(in)
+		if err != nil || got != want {
+			t.Errorf("normalizeBlocklistCIDR(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "10.0.0.0/33", "not-an-ip"} {
+		if _, _, err := normalizeBlocklistCIDR(bad); !errors.Is(err, ErrInvalidCIDR) {
+			t.Errorf("normalizeBlocklistCIDR(%q) should fail with ErrInvalidCIDR, got %v", bad, err)
+		}
+	}
+}
+
+func TestIPBlocklistEnforceDisablesPredominantTokens(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	schema := `
+	CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, status INTEGER);
+	CREATE TABLE tokens (id INTEGER PRIMARY KEY, user_id INTEGER, name TEXT, status INTEGER);
+	CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT, token_id INTEGER,
+		token_name TEXT, ip TEXT, type INTEGER, created_at INTEGER);
+	INSERT INTO users VALUES (1, 'proxy', 1), (2, 'mixed', 1);
+	INSERT INTO tokens VALUES (11, 1, 'bad', 1), (21, 2, 'ok', 1);`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		// token 11: all traffic from the blocked /24; token 21: half from it
+		mixedIP := "198.51.100.9"
+		if i%2 == 0 {
+			mixedIP = "203.0.113.50"
+		}
+		db.MustExec(`INSERT INTO logs (user_id, username, token_id, token_name, ip, type, created_at) VALUES
+			(1, 'proxy', 11, 'bad', '203.0.113.7', 2, ?), (2, 'mixed', 21, 'ok', ?, 2, ?)`, now-60, mixedIP, now-60)
+	}
+
+	svc := NewIPBlocklistService()
+	ctx := context.Background()
+	if _, err := svc.AddEntry(ctx, "203.0.113.0/24", "proxy range"); err != nil {
+		t.Fatalf("AddEntry: %v", err)
+	}
+	if _, err := svc.AddEntry(ctx, "203.0.113.9/24", ""); !errors.Is(err, ErrIPBlocklistEntryExists) {
+		t.Fatalf("duplicate range should be rejected, got %v", err)
+	}
+
+	check, err := svc.CheckIP(ctx, "203.0.113.200")
+	if err != nil || check["blocked"] != true {
+		t.Fatalf("CheckIP should match the /24, got %v %v", check, err)
+	}
+
+	// default settings are dry run: report but do not touch the token
+	res, err := svc.Enforce(ctx, nil)
+	if err != nil {
+		t.Fatalf("Enforce (dry run): %v", err)
+	}
+	if !res.DryRun || len(res.Hits) != 1 || res.Hits[0].TokenID != 11 || res.Applied != 0 {
+		t.Fatalf("expected dry-run hit on token 11 only, got %+v", res)
+	}
+	if res.Hits[0].BlockedPercent != 100 {
+		t.Fatalf("expected 100%% blocked for token 11, got %v", res.Hits[0].BlockedPercent)
+	}
+
+	dryRun := false
+	res, err = svc.Enforce(ctx, &dryRun)
+	if err != nil {
+		t.Fatalf("Enforce: %v", err)
+	}
+	if res.Applied != 1 || !res.Hits[0].Applied {
+		t.Fatalf("expected token 11 disabled, got %+v", res)
+	}
+	var status int
+	db.Get(&status, `SELECT status FROM tokens WHERE id = 11`)
+	if status != 2 {
+		t.Fatalf("token 11 should be disabled, got status=%d", status)
+	}
+	db.Get(&status, `SELECT status FROM tokens WHERE id = 21`)
+	if status != 1 {
+		t.Fatalf("token 21 is below the threshold and must stay enabled, got status=%d", status)
+	}
+
+	// second pass: the token is already disabled, nothing new is applied
+	res, err = svc.Enforce(ctx, &dryRun)
+	if err != nil {
+		t.Fatalf("Enforce (repeat): %v", err)
+	}
+	if res.Applied != 0 || res.Hits[0].Skipped != "already_disabled" {
+		t.Fatalf("expected already_disabled skip, got %+v", res)
+	}
+	actions, err := svc.ListActions(ctx, 10)
+	if err != nil || len(actions) != 1 {
+		t.Fatalf("expected one recorded action, got %v %v", actions, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,12 +34,14 @@ var geoipDownloadURLs = []string{
 	"https://cdn.jsdelivr.net/gh/adysec/IP_database@main/geolite/GeoLite2-City.mmdb",
 }
 
-// geoipUpdateInterval is the interval between automatic database updates (24 hours)
-const geoipUpdateInterval = 24 * time.Hour
-
 // geoipMinFileSize is the minimum valid database file size (1 MB)
 const geoipMinFileSize = 1024 * 1024
 
+// asnDatabaseFiles are the optional ASN / ISP databases, in preference order.
+// GeoIP2-ISP (commercial) also carries ISP and organization names; GeoLite2-ASN
+// only has the AS number and its registered organization.
+var asnDatabaseFiles = []string{"GeoIP2-ISP.mmdb", "GeoLite2-ASN.mmdb"}
+
 // IPGeoService provides IP geolocation queries using MaxMind GeoLite2
 type IPGeoService struct {
 	cityReader *geoip2.Reader
@@ -46,6 +49,24 @@ type IPGeoService struct {
 	mu         sync.RWMutex
 	available  bool
 	stopCh     chan struct{}
+
+	// Optional ASN / ISP enrichment
+	asnReader *geoip2.Reader
+	asnPath   string
+	asnIsISP  bool
+
+	// IPs answered without geo data, re-resolved after the next (re)load
+	pendingMu sync.Mutex
+	pending   map[string]struct{}
+
+	// Database directory and update state, see ip_geo_update.go
+	dir         string
+	updateMu    sync.Mutex // held for a whole update run
+	stateMu     sync.Mutex
+	updating    bool
+	lastCheckAt int64
+	lastUpdate  int64
+	lastError   string
 }
 
 var (
@@ -82,6 +103,8 @@ func (s *IPGeoService) init() {
 	if geoipDir == "" {
 		geoipDir = "/app/data/geoip"
 	}
+	s.dir = geoipDir
+	s.loadASNDatabase(geoipDir)
 
 	// Try to find GeoLite2-City.mmdb in common paths
 	paths := []string{
@@ -114,7 +137,7 @@ func (s *IPGeoService) init() {
 	// Database not found — try to download it
 	fmt.Println("[GeoIP] No GeoLite2-City.mmdb found, attempting auto-download...")
 	downloadPath := filepath.Join(geoipDir, "GeoLite2-City.mmdb")
-	if err := s.downloadDatabase(downloadPath); err != nil {
+	if err := s.downloadDatabase(downloadPath, geoipDownloadURLs); err != nil {
 		fmt.Printf("[GeoIP] Auto-download failed: %v\n", err)
 		fmt.Println("[GeoIP] IP geolocation disabled. Will retry in background.")
 		s.dbPath = downloadPath
@@ -127,6 +150,8 @@ func (s *IPGeoService) init() {
 	reader, err := geoip2.Open(downloadPath)
 	if err != nil {
 		fmt.Printf("[GeoIP] Failed to open downloaded database: %v\n", err)
+		s.dbPath = downloadPath
+		go s.backgroundUpdater()
 		return
 	}
 	s.cityReader = reader
@@ -138,8 +163,41 @@ func (s *IPGeoService) init() {
 	go s.backgroundUpdater()
 }
 
-// downloadDatabase downloads the GeoLite2-City.mmdb file from mirror URLs
-func (s *IPGeoService) downloadDatabase(destPath string) error {
+// loadASNDatabase opens the optional ASN / ISP database. GEOIP_ASN_DB points
+// at an explicit file; otherwise the GeoIP directories are searched. Missing
+// is fine — lookups then just leave asn / isp / org empty.
+func (s *IPGeoService) loadASNDatabase(geoipDir string) {
+	var paths []string
+	if p := os.Getenv("GEOIP_ASN_DB"); p != "" {
+		paths = append(paths, p)
+	}
+	for _, dir := range []string{geoipDir, "/app/data/geoip", "./data/geoip", "/usr/share/GeoIP"} {
+		for _, name := range asnDatabaseFiles {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		reader, err := geoip2.Open(path)
+		if err != nil {
+			fmt.Printf("[GeoIP] Failed to open ASN database %s: %v\n", path, err)
+			continue
+		}
+		s.asnReader = reader
+		s.asnPath = path
+		s.asnIsISP = strings.Contains(reader.Metadata().DatabaseType, "ISP")
+		fmt.Printf("[GeoIP] Loaded ASN database: %s\n", path)
+		return
+	}
+	fmt.Println("[GeoIP] No ASN database found, ASN/ISP enrichment disabled")
+}
+
+// downloadDatabase downloads an mmdb file from the first working mirror,
+// validates it and atomically replaces destPath
+func (s *IPGeoService) downloadDatabase(destPath string, urls []string) error {
 	// Ensure directory exists
 	dir := filepath.Dir(destPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -151,7 +209,7 @@ func (s *IPGeoService) downloadDatabase(destPath string) error {
 
 	client := &http.Client{Timeout: 120 * time.Second}
 
-	for _, url := range geoipDownloadURLs {
+	for _, url := range urls {
 		fmt.Printf("[GeoIP] Downloading from %s ...\n", url)
 
 		resp, err := client.Get(url)
@@ -211,57 +269,40 @@ func (s *IPGeoService) downloadDatabase(destPath string) error {
 	return fmt.Errorf("all download mirrors failed")
 }
 
-// backgroundUpdater periodically checks and updates the GeoIP database
+// backgroundUpdater periodically checks and updates the GeoIP databases
 func (s *IPGeoService) backgroundUpdater() {
-	// First check: if database is not available, retry download after 5 minutes
-	if !s.IsAvailable() {
+	// Degraded mode: keep retrying every few minutes until a database loads,
+	// either downloaded or dropped into place by an operator
+	for !s.IsAvailable() {
 		select {
-		case <-time.After(5 * time.Minute):
+		case <-time.After(geoipRetryInterval):
 		case <-s.stopCh:
 			return
 		}
-		s.tryUpdateDatabase()
+		s.autoUpdate()
 	}
 
-	ticker := time.NewTicker(geoipUpdateInterval)
+	// The interval is configurable at runtime, so check often whether an
+	// update is due rather than sleeping for the whole interval
+	ticker := time.NewTicker(geoipCheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			s.tryUpdateDatabase()
+			s.autoUpdate()
 		case <-s.stopCh:
 			return
 		}
 	}
 }
 
-// tryUpdateDatabase attempts to download and reload the GeoIP database
-func (s *IPGeoService) tryUpdateDatabase() {
-	if s.dbPath == "" {
-		return
-	}
-
-	// Check if the existing database is fresh enough
-	if info, err := os.Stat(s.dbPath); err == nil {
-		age := time.Since(info.ModTime())
-		if age < geoipUpdateInterval {
-			return // database is fresh, skip update
-		}
-	}
-
-	fmt.Println("[GeoIP] Checking for database update...")
-
-	if err := s.downloadDatabase(s.dbPath); err != nil {
-		fmt.Printf("[GeoIP] Update failed: %v\n", err)
-		return
-	}
-
-	// Reload the database
+// reloadCityDatabase (re)opens the city database at dbPath, swaps it in and
+// re-resolves the IPs served without geo data in the meantime
+func (s *IPGeoService) reloadCityDatabase() (int, error) {
 	newReader, err := geoip2.Open(s.dbPath)
 	if err != nil {
-		fmt.Printf("[GeoIP] Failed to reload updated database: %v\n", err)
-		return
+		return 0, err
 	}
 
 	s.mu.Lock()
@@ -273,8 +314,7 @@ func (s *IPGeoService) tryUpdateDatabase() {
 	if oldReader != nil {
 		oldReader.Close()
 	}
-
-	fmt.Println("[GeoIP] Database updated and reloaded successfully")
+	return s.resolvePending(), nil
 }
 
 // IsAvailable returns whether the GeoIP service is available
@@ -284,6 +324,46 @@ func (s *IPGeoService) IsAvailable() bool {
 	return s.available
 }
 
+// IsASNAvailable returns whether ASN / ISP enrichment is loaded
+func (s *IPGeoService) IsASNAvailable() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.asnReader != nil
+}
+
+// fillASN adds ASN / ISP / organization from the optional database.
+// Caller must hold s.mu (read).
+func (s *IPGeoService) fillASN(result *IPGeoInfo, ip net.IP) {
+	if s.asnReader == nil {
+		return
+	}
+	if s.asnIsISP {
+		record, err := s.asnReader.ISP(ip)
+		if err != nil {
+			return
+		}
+		if record.AutonomousSystemNumber > 0 {
+			result.ASN = fmt.Sprintf("AS%d", record.AutonomousSystemNumber)
+		}
+		result.ISP = record.ISP
+		result.Org = record.Organization
+		if result.ISP == "" {
+			result.ISP = record.AutonomousSystemOrganization
+		}
+		if result.Org == "" {
+			result.Org = record.AutonomousSystemOrganization
+		}
+		return
+	}
+	record, err := s.asnReader.ASN(ip)
+	if err != nil || record.AutonomousSystemNumber == 0 {
+		return
+	}
+	result.ASN = fmt.Sprintf("AS%d", record.AutonomousSystemNumber)
+	result.ISP = record.AutonomousSystemOrganization
+	result.Org = record.AutonomousSystemOrganization
+}
+
 // QuerySingle looks up a single IP address
 func (s *IPGeoService) QuerySingle(ip string) IPGeoInfo {
 	result := IPGeoInfo{IP: ip}
@@ -303,7 +383,9 @@ func (s *IPGeoService) QuerySingle(ip string) IPGeoInfo {
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	s.fillASN(&result, parsedIP)
 	if !s.available || s.cityReader == nil {
+		s.queueUnresolved(ip)
 		return result
 	}
 
@@ -311,6 +393,9 @@ func (s *IPGeoService) QuerySingle(ip string) IPGeoInfo {
 	if err != nil {
 		return result
 	}
+	if record.Country.IsoCode == "" {
+		s.queueUnresolved(ip) // 当前库缺少该 IP，数据库更新后再试
+	}
 
 	result.Success = true
 
@@ -372,6 +457,12 @@ func LookupIPGeoBatch(ips []string) map[string]IPGeoInfo {
 	return svc.QueryBatch(ips)
 }
 
+// IsIPASNAvailable reports whether ASN / ISP enrichment is loaded.
+func IsIPASNAvailable() bool {
+	svc := ipGeoServiceProvider()
+	return svc != nil && svc.IsASNAvailable()
+}
+
 // IsIPGeoAvailable reports whether the configured GeoIP service is ready.
 func IsIPGeoAvailable() bool {
 	svc := ipGeoServiceProvider()
@@ -421,4 +512,8 @@ func (s *IPGeoService) Close() {
 		s.cityReader = nil
 		s.available = false
 	}
+	if s.asnReader != nil {
+		s.asnReader.Close()
+		s.asnReader = nil
+	}
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+// geoipRetryInterval is how often a degraded (unloaded) GeoIP service retries
+const geoipRetryInterval = 5 * time.Minute
+
+// geoipPendingLimit bounds the IPs remembered for re-resolution
+const geoipPendingLimit = 10000
+
+// geoipCachePrefixes are the cached results embedding per-IP geo data
+var geoipCachePrefixes = []string{
+	"dashboard:ip_distribution:",
+}
+
+var ErrGeoIPNoDatabase = errors.New("geoip database path unknown")
+
+// GeoIPReloadResult reports the outcome of a GeoIP (re)load
+type GeoIPReloadResult struct {
+	Available bool `json:"available"`
+	Resolved  int  `json:"resolved"` // 本次重新解析成功的 IP 数
+	Pending   int  `json:"pending"`  // 仍待解析的 IP 数
+}
+
+// queueUnresolved remembers an IP answered without geo data. Private and
+// malformed addresses never resolve and are not queued.
+func (s *IPGeoService) queueUnresolved(ip string) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() {
+		return
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]struct{})
+	}
+	if len(s.pending) < geoipPendingLimit {
+		s.pending[ip] = struct{}{}
+	}
+}
+
+// PendingCount returns how many IPs wait for re-resolution
+func (s *IPGeoService) PendingCount() int {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	return len(s.pending)
+}
+
+// resolvePending looks up every queued IP again and drops the cached results
+// built while they had no geo data. IPs still unresolved are queued again by
+// QuerySingle. Returns the number resolved.
+func (s *IPGeoService) resolvePending() int {
+	s.pendingMu.Lock()
+	ips := make([]string, 0, len(s.pending))
+	for ip := range s.pending {
+		ips = append(ips, ip)
+	}
+	s.pending = nil
+	s.pendingMu.Unlock()
+
+	resolved := 0
+	for _, info := range s.QueryBatch(ips) {
+		if info.Success && info.CountryCode != "" {
+			resolved++
+		}
+	}
+	for _, prefix := range geoipCachePrefixes {
+		cache.Get().DeleteByPrefix(cache.Key("%s", prefix))
+	}
+	if len(ips) > 0 {
+		fmt.Printf("[GeoIP] Re-resolved %d/%d queued IPs\n", resolved, len(ips))
+	}
+	return resolved
+}
+
+// ReloadIPGeo reloads the GeoIP database from disk right away (e.g. after an
+// operator fixed or replaced the file) instead of waiting for the next retry
+func ReloadIPGeo() (GeoIPReloadResult, error) {
+	svc := ipGeoServiceProvider()
+	if svc == nil || svc.dbPath == "" {
+		return GeoIPReloadResult{}, ErrGeoIPNoDatabase
+	}
+	resolved, err := svc.reloadCityDatabase()
+	if err != nil {
+		return GeoIPReloadResult{Pending: svc.PendingCount()}, err
+	}
+	return GeoIPReloadResult{Available: svc.IsAvailable(), Resolved: resolved, Pending: svc.PendingCount()}, nil
+}
+
+// IPGeoPendingCount reports how many IPs wait for re-resolution
+func IPGeoPendingCount() int {
+	svc := ipGeoServiceProvider()
+	if svc == nil {
+		return 0
+	}
+	return svc.PendingCount()
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+// TestGeoIPQueuesIPsWhileDegraded 验证 GeoIP 未加载时查询过的公网 IP 会排队，
+// 重新加载后统一重试并清掉按空地理信息生成的分布缓存。
+func TestGeoIPQueuesIPsWhileDegraded(t *testing.T) {
+	svc := &IPGeoService{}
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "8.8.8.8", "10.0.0.1", "127.0.0.1", "not-an-ip"} {
+		if info := svc.QuerySingle(ip); info.CountryCode != "" && info.CountryCode != "LO" {
+			t.Fatalf("degraded lookup of %s should be blank, got %+v", ip, info)
+		}
+	}
+	if got := svc.PendingCount(); got != 2 {
+		t.Fatalf("only the two public IPs should be queued, got %d", got)
+	}
+
+	key := cache.Key("dashboard:ip_distribution:%s", "24h")
+	cache.Get().Set(key, map[string]interface{}{"by_country": []interface{}{}}, 0)
+	t.Cleanup(func() { cache.Get().Delete(key) })
+
+	// 仍未加载：重试失败的 IP 重新入队，但缓存照样刷新
+	if resolved := svc.resolvePending(); resolved != 0 {
+		t.Fatalf("nothing can resolve without a database, got %d", resolved)
+	}
+	if got := svc.PendingCount(); got != 2 {
+		t.Errorf("unresolved IPs should stay queued, got %d", got)
+	}
+	var cached map[string]interface{}
+	if found, _ := cache.Get().GetJSON(key, &cached); found {
+		t.Errorf("re-resolution should drop the cached IP distribution")
+	}
+
+	defer SetIPGeoServiceProviderForTesting(func() *IPGeoService { return svc })()
+	if _, err := ReloadIPGeo(); err != ErrGeoIPNoDatabase {
+		t.Errorf("reload without a database path should fail, got %v", err)
+	}
+	if IPGeoPendingCount() != 2 {
+		t.Errorf("IPGeoPendingCount should read the provider's queue")
+	}
+}
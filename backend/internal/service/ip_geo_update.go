@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+const geoipUpdateSettingsKey = "geoip_update"
+
+// geoipCheckInterval is how often the background task checks whether an
+// update is due
+const geoipCheckInterval = 10 * time.Minute
+
+const (
+	defaultGeoIPUpdateHours = 24
+	maxGeoIPUpdateHours     = 720
+	maxGeoIPMirrors         = 5
+)
+
+var (
+	ErrInvalidGeoIPUpdate = errors.New("invalid geoip update settings")
+	ErrGeoIPUpdateRunning = errors.New("geoip update already running")
+)
+
+// GeoIPUpdateSettings controls the periodic database download
+type GeoIPUpdateSettings struct {
+	Enabled       bool     `json:"enabled"`
+	IntervalHours int      `json:"interval_hours"`
+	CityURLs      []string `json:"city_urls"` // 空 = 内置 GeoLite2-City 镜像
+	ASNURLs       []string `json:"asn_urls"`  // 空 = 不下载 ASN 库（仍加载本地已有文件）
+	UpdatedAt     int64    `json:"updated_at"`
+}
+
+// GeoIPUpdateSettingsInput is a partial update; nil fields keep their value
+type GeoIPUpdateSettingsInput struct {
+	Enabled       *bool     `json:"enabled"`
+	IntervalHours *int      `json:"interval_hours"`
+	CityURLs      *[]string `json:"city_urls"`
+	ASNURLs       *[]string `json:"asn_urls"`
+}
+
+// GeoIPDatabaseInfo describes one database file and the loaded version
+type GeoIPDatabaseInfo struct {
+	Name         string `json:"name"` // city / asn
+	Path         string `json:"path"`
+	Loaded       bool   `json:"loaded"`
+	DatabaseType string `json:"database_type,omitempty"`
+	BuildEpoch   int64  `json:"build_epoch,omitempty"` // 数据库构建时间（Unix 秒），即版本
+	SizeBytes    int64  `json:"size_bytes"`
+	ModifiedAt   int64  `json:"modified_at"`
+}
+
+// GeoIPDatabaseUpdate is the outcome of one database in an update run
+type GeoIPDatabaseUpdate struct {
+	Name    string `json:"name"`
+	Updated bool   `json:"updated"`
+	Skipped string `json:"skipped,omitempty"` // up_to_date / reloaded_from_disk / not_configured
+	Error   string `json:"error,omitempty"`
+}
+
+// GeoIPStatus is the /api/system/geoip response
+type GeoIPStatus struct {
+	Available    bool                `json:"available"`
+	ASNAvailable bool                `json:"asn_available"`
+	Databases    []GeoIPDatabaseInfo `json:"databases"`
+	Pending      int                 `json:"pending"`
+	Updating     bool                `json:"updating"`
+	LastCheckAt  int64               `json:"last_check_at"`
+	LastUpdateAt int64               `json:"last_update_at"`
+	LastError    string              `json:"last_error,omitempty"`
+	Settings     GeoIPUpdateSettings `json:"settings"`
+}
+
+func defaultGeoIPUpdateSettings() GeoIPUpdateSettings {
+	return GeoIPUpdateSettings{Enabled: true, IntervalHours: defaultGeoIPUpdateHours, CityURLs: []string{}, ASNURLs: []string{}}
+}
+
+func normalizeGeoIPMirrors(field string, urls []string) ([]string, error) {
+	out := make([]string, 0, len(urls))
+	for _, raw := range urls {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: %s 需为 http(s) 地址: %s", ErrInvalidGeoIPUpdate, field, raw)
+		}
+		out = append(out, raw)
+	}
+	if len(out) > maxGeoIPMirrors {
+		return nil, fmt.Errorf("%w: %s 最多 %d 个镜像", ErrInvalidGeoIPUpdate, field, maxGeoIPMirrors)
+	}
+	return out, nil
+}
+
+func normalizeGeoIPUpdateSettings(s *GeoIPUpdateSettings) error {
+	if s.IntervalHours == 0 {
+		s.IntervalHours = defaultGeoIPUpdateHours
+	}
+	if s.IntervalHours < 1 || s.IntervalHours > maxGeoIPUpdateHours {
+		return fmt.Errorf("%w: interval_hours 需在 1-%d 之间", ErrInvalidGeoIPUpdate, maxGeoIPUpdateHours)
+	}
+	var err error
+	if s.CityURLs, err = normalizeGeoIPMirrors("city_urls", s.CityURLs); err != nil {
+		return err
+	}
+	s.ASNURLs, err = normalizeGeoIPMirrors("asn_urls", s.ASNURLs)
+	return err
+}
+
+// GetGeoIPUpdateSettings returns the update settings (defaults if never saved)
+func GetGeoIPUpdateSettings(ctx context.Context) (GeoIPUpdateSettings, error) {
+	settings := defaultGeoIPUpdateSettings()
+	if _, err := loadLocalSetting(ctx, geoipUpdateSettingsKey, &settings); err != nil {
+		return defaultGeoIPUpdateSettings(), err
+	}
+	if err := normalizeGeoIPUpdateSettings(&settings); err != nil {
+		return defaultGeoIPUpdateSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateGeoIPUpdateSettings applies a partial update
+func UpdateGeoIPUpdateSettings(ctx context.Context, in GeoIPUpdateSettingsInput) (GeoIPUpdateSettings, error) {
+	settings, err := GetGeoIPUpdateSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalHours != nil {
+		settings.IntervalHours = *in.IntervalHours
+	}
+	if in.CityURLs != nil {
+		settings.CityURLs = *in.CityURLs
+	}
+	if in.ASNURLs != nil {
+		settings.ASNURLs = *in.ASNURLs
+	}
+	if err := normalizeGeoIPUpdateSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, geoipUpdateSettingsKey, settings)
+}
+
+// autoUpdate runs an update when one is due: always while degraded,
+// otherwise once per interval_hours when enabled
+func (s *IPGeoService) autoUpdate() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	settings, err := GetGeoIPUpdateSettings(ctx)
+	cancel()
+	if err != nil {
+		fmt.Printf("[GeoIP] Failed to load update settings: %v\n", err)
+	}
+	if s.IsAvailable() {
+		if !settings.Enabled {
+			return
+		}
+		s.stateMu.Lock()
+		last := s.lastCheckAt
+		s.stateMu.Unlock()
+		if last == 0 {
+			// First check since start: the file age tells when it was last updated
+			if info, err := os.Stat(s.dbPath); err == nil {
+				last = info.ModTime().Unix()
+			}
+		}
+		if time.Since(time.Unix(last, 0)) < time.Duration(settings.IntervalHours)*time.Hour {
+			return
+		}
+	}
+	if _, err := s.updateDatabases(settings, false); err != nil && !errors.Is(err, ErrGeoIPUpdateRunning) {
+		fmt.Printf("[GeoIP] Update failed: %v\n", err)
+	}
+}
+
+// updateDatabases downloads the city database (and the ASN database when
+// mirrors are configured) and swaps the loaded readers. Without force, a
+// city file younger than the interval is only (re)loaded from disk.
+func (s *IPGeoService) updateDatabases(settings GeoIPUpdateSettings, force bool) ([]GeoIPDatabaseUpdate, error) {
+	if s.dbPath == "" {
+		return nil, ErrGeoIPNoDatabase
+	}
+	if !s.updateMu.TryLock() {
+		return nil, ErrGeoIPUpdateRunning
+	}
+	defer s.updateMu.Unlock()
+	s.setUpdating(true)
+	defer s.setUpdating(false)
+
+	results := []GeoIPDatabaseUpdate{s.updateCity(settings, force)}
+	results = append(results, s.updateASN(settings))
+
+	var errs []string
+	updated := false
+	for _, r := range results {
+		if r.Error != "" {
+			errs = append(errs, r.Name+": "+r.Error)
+		}
+		updated = updated || r.Updated
+	}
+	s.stateMu.Lock()
+	s.lastCheckAt = time.Now().Unix()
+	if updated {
+		s.lastUpdate = s.lastCheckAt
+	}
+	s.lastError = strings.Join(errs, "; ")
+	s.stateMu.Unlock()
+	if len(errs) > 0 {
+		return results, errors.New(strings.Join(errs, "; "))
+	}
+	return results, nil
+}
+
+func (s *IPGeoService) setUpdating(v bool) {
+	s.stateMu.Lock()
+	s.updating = v
+	s.stateMu.Unlock()
+}
+
+func (s *IPGeoService) updateCity(settings GeoIPUpdateSettings, force bool) GeoIPDatabaseUpdate {
+	result := GeoIPDatabaseUpdate{Name: "city"}
+	if !force {
+		if info, err := os.Stat(s.dbPath); err == nil && time.Since(info.ModTime()) < time.Duration(settings.IntervalHours)*time.Hour {
+			if s.IsAvailable() {
+				result.Skipped = "up_to_date"
+				return result
+			}
+			// 文件较新但未加载：多为人工修复 / 放入的数据库，直接加载即可
+			if _, err := s.reloadCityDatabase(); err == nil {
+				result.Skipped = "reloaded_from_disk"
+				return result
+			}
+		}
+	}
+
+	urls := settings.CityURLs
+	if len(urls) == 0 {
+		urls = geoipDownloadURLs
+	}
+	fmt.Println("[GeoIP] Checking for database update...")
+	if err := s.downloadDatabase(s.dbPath, urls); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if _, err := s.reloadCityDatabase(); err != nil {
+		result.Error = "reload: " + err.Error()
+		return result
+	}
+	fmt.Println("[GeoIP] Database updated and reloaded successfully")
+	result.Updated = true
+	return result
+}
+
+func (s *IPGeoService) updateASN(settings GeoIPUpdateSettings) GeoIPDatabaseUpdate {
+	result := GeoIPDatabaseUpdate{Name: "asn"}
+	if len(settings.ASNURLs) == 0 {
+		result.Skipped = "not_configured"
+		return result
+	}
+	s.mu.RLock()
+	path := s.asnPath
+	s.mu.RUnlock()
+	if path == "" {
+		path = filepath.Join(s.dir, asnDatabaseFiles[len(asnDatabaseFiles)-1])
+	}
+	if err := s.downloadDatabase(path, settings.ASNURLs); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		result.Error = "reload: " + err.Error()
+		return result
+	}
+	s.mu.Lock()
+	old := s.asnReader
+	s.asnReader, s.asnPath = reader, path
+	s.asnIsISP = strings.Contains(reader.Metadata().DatabaseType, "ISP")
+	s.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	fmt.Printf("[GeoIP] ASN database updated: %s\n", path)
+	result.Updated = true
+	return result
+}
+
+// status reports the loaded databases and the update state
+func (s *IPGeoService) status() GeoIPStatus {
+	s.mu.RLock()
+	st := GeoIPStatus{
+		Available:    s.available,
+		ASNAvailable: s.asnReader != nil,
+		Databases: []GeoIPDatabaseInfo{
+			geoipDatabaseInfo("city", s.dbPath, s.cityReader),
+			geoipDatabaseInfo("asn", s.asnPath, s.asnReader),
+		},
+	}
+	s.mu.RUnlock()
+	st.Pending = s.PendingCount()
+	s.stateMu.Lock()
+	st.Updating, st.LastCheckAt, st.LastUpdateAt, st.LastError = s.updating, s.lastCheckAt, s.lastUpdate, s.lastError
+	s.stateMu.Unlock()
+	return st
+}
+
+func geoipDatabaseInfo(name, path string, reader *geoip2.Reader) GeoIPDatabaseInfo {
+	info := GeoIPDatabaseInfo{Name: name, Path: path, Loaded: reader != nil}
+	if reader != nil {
+		meta := reader.Metadata()
+		info.DatabaseType, info.BuildEpoch = meta.DatabaseType, int64(meta.BuildEpoch)
+	}
+	if path != "" {
+		if fi, err := os.Stat(path); err == nil {
+			info.SizeBytes, info.ModifiedAt = fi.Size(), fi.ModTime().Unix()
+		}
+	}
+	return info
+}
+
+// GetGeoIPStatus returns the GeoIP database versions, update state and settings
+func GetGeoIPStatus(ctx context.Context) (GeoIPStatus, error) {
+	settings, err := GetGeoIPUpdateSettings(ctx)
+	svc := ipGeoServiceProvider()
+	if svc == nil {
+		return GeoIPStatus{Databases: []GeoIPDatabaseInfo{}, Settings: settings}, err
+	}
+	st := svc.status()
+	st.Settings = settings
+	return st, err
+}
+
+// GeoIPUpdating reports whether an update run is in progress
+func GeoIPUpdating() bool {
+	svc := ipGeoServiceProvider()
+	if svc == nil {
+		return false
+	}
+	svc.stateMu.Lock()
+	defer svc.stateMu.Unlock()
+	return svc.updating
+}
+
+// UpdateGeoIPNow downloads and swaps the databases right away, ignoring the
+// interval and the enabled switch
+func UpdateGeoIPNow(ctx context.Context) ([]GeoIPDatabaseUpdate, error) {
+	svc := ipGeoServiceProvider()
+	if svc == nil {
+		return nil, ErrGeoIPNoDatabase
+	}
+	settings, err := GetGeoIPUpdateSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return svc.updateDatabases(settings, true)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestGeoIPUpdateSettingsValidation(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	ctx := context.Background()
+
+	settings, err := GetGeoIPUpdateSettings(ctx)
+	if err != nil || !settings.Enabled || settings.IntervalHours != defaultGeoIPUpdateHours {
+		t.Fatalf("defaults: %+v %v", settings, err)
+	}
+	bad := []string{"ftp://example.com/a.mmdb"}
+	if _, err := UpdateGeoIPUpdateSettings(ctx, GeoIPUpdateSettingsInput{CityURLs: &bad}); !errors.Is(err, ErrInvalidGeoIPUpdate) {
+		t.Fatalf("non-http mirror should be rejected, got %v", err)
+	}
+	hours, asn := 6, []string{" https://example.com/GeoLite2-ASN.mmdb ", ""}
+	settings, err = UpdateGeoIPUpdateSettings(ctx, GeoIPUpdateSettingsInput{IntervalHours: &hours, ASNURLs: &asn})
+	if err != nil || settings.IntervalHours != 6 || len(settings.ASNURLs) != 1 || settings.ASNURLs[0] != "https://example.com/GeoLite2-ASN.mmdb" {
+		t.Fatalf("update: %+v %v", settings, err)
+	}
+}
+
+// TestGeoIPUpdateKeepsCurrentFileOnBadDownload 验证下载到无效文件时不替换现有文件，
+// 错误记录在状态中；同一时间只允许一次更新。
+func TestGeoIPUpdateKeepsCurrentFileOnBadDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not an mmdb"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "GeoLite2-City.mmdb")
+	if err := os.WriteFile(dbPath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svc := &IPGeoService{dbPath: dbPath, dir: dir}
+	settings := defaultGeoIPUpdateSettings()
+	settings.CityURLs = []string{srv.URL + "/city.mmdb"}
+
+	results, err := svc.updateDatabases(settings, true)
+	if err == nil || len(results) != 2 || results[0].Updated || results[1].Skipped != "not_configured" {
+		t.Fatalf("bad download should fail without swapping: %+v %v", results, err)
+	}
+	if raw, _ := os.ReadFile(dbPath); string(raw) != "old" {
+		t.Errorf("existing file must be kept, got %q", raw)
+	}
+	if _, err := os.Stat(dbPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file should be removed")
+	}
+	st := svc.status()
+	if st.Available || st.Updating || st.LastCheckAt == 0 || st.LastUpdateAt != 0 || !strings.Contains(st.LastError, "city") {
+		t.Errorf("status: %+v", st)
+	}
+
+	svc.updateMu.Lock()
+	if _, err := svc.updateDatabases(settings, true); !errors.Is(err, ErrGeoIPUpdateRunning) {
+		t.Errorf("concurrent update should be refused, got %v", err)
+	}
+	svc.updateMu.Unlock()
+}
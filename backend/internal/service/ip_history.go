@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	ipHistoryCursor = "ip_history"
+	// ipHistoryBackfillDays is how far back the first sync starts; older
+	// windows keep scanning logs
+	ipHistoryBackfillDays = 30
+)
+
+// IPHistoryState is the sync cursor and size of the ip_history table
+type IPHistoryState struct {
+	LogCursor
+	Rows int64 `json:"rows"`
+}
+
+// IPHistoryService maintains the local per-user IP history of the primary
+// instance: one row per (user_id, ip) with first/last seen and request count,
+// fed incrementally from logs by id so IP analyses no longer re-scan logs.
+type IPHistoryService struct {
+	logDB *database.Manager
+}
+
+// NewIPHistoryService creates an IPHistoryService on the primary instance
+func NewIPHistoryService() *IPHistoryService {
+	return &IPHistoryService{logDB: database.GetLog()}
+}
+
+func ensureIPHistoryTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS ip_history (
+			user_id INTEGER NOT NULL,
+			ip TEXT NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			first_seen INTEGER NOT NULL DEFAULT 0,
+			last_seen INTEGER NOT NULL DEFAULT 0,
+			request_count INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, ip)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ip_history_last_seen ON ip_history(last_seen);
+		CREATE INDEX IF NOT EXISTS idx_ip_history_ip ON ip_history(ip)`)
+	return err
+}
+
+// GetState returns the sync cursor and row count
+func (s *IPHistoryService) GetState(ctx context.Context) (IPHistoryState, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return IPHistoryState{}, err
+	}
+	defer db.Close()
+	if err := ensureIPHistoryTables(ctx, db); err != nil {
+		return IPHistoryState{}, err
+	}
+	cur, _, err := loadLogCursor(ctx, db, ipHistoryCursor)
+	st := IPHistoryState{LogCursor: cur}
+	if err != nil {
+		return st, err
+	}
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ip_history`).Scan(&st.Rows)
+	return st, err
+}
+
+// Covers reports whether the table is fresh and reaches back to since, i.e.
+// whether a reader may use it instead of scanning logs
+func (s *IPHistoryService) Covers(ctx context.Context, since int64) bool {
+	st, err := s.GetState(ctx)
+	return err == nil && logCursorCovers(st.LogCursor, since)
+}
+
+// SyncIPHistory folds logs newer than the cursor into ip_history, at most
+// maxBatches batches. The first run starts ipHistoryBackfillDays days back.
+func (s *IPHistoryService) SyncIPHistory(ctx context.Context, maxBatches int) (*LogCursorSyncResult, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureIPHistoryTables(ctx, db); err != nil {
+		return nil, err
+	}
+
+	result, err := runLogCursorSync(ctx, db, s.logDB, ipHistoryCursor, ipHistoryBackfillDays, maxBatches, logCursorBatch{
+		fetch: func(ctx context.Context, lo, hi int64) ([]map[string]interface{}, error) {
+			return s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(`
+				SELECT user_id, ip, MAX(username) as username, MIN(created_at) as first_seen,
+					MAX(created_at) as last_seen, COUNT(*) as request_count
+				FROM logs
+				WHERE id > ? AND id <= ? AND type IN (`+ltRequests()+`) AND user_id > 0 AND ip IS NOT NULL AND ip <> ''
+				GROUP BY user_id, ip`), lo, hi)
+		},
+		write: writeIPHistoryRows,
+	})
+	if err == nil && result.Upserted > 0 {
+		logger.L.Info(fmt.Sprintf("[IP历史] 同步 %d 批，合并 %d 行，游标 %d/%d",
+			result.Batches, result.Upserted, result.LastLogID, result.MaxLogID), logger.CatAnalytics)
+	}
+	return result, err
+}
+
+func writeIPHistoryRows(ctx context.Context, tx *sql.Tx, rows []map[string]interface{}) error {
+	for _, r := range rows {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ip_history (user_id, ip, username, first_seen, last_seen, request_count)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, ip) DO UPDATE SET
+				username = CASE WHEN excluded.username <> '' THEN excluded.username ELSE ip_history.username END,
+				first_seen = MIN(ip_history.first_seen, excluded.first_seen),
+				last_seen = MAX(ip_history.last_seen, excluded.last_seen),
+				request_count = ip_history.request_count + excluded.request_count`,
+			toInt64(r["user_id"]), toString(r["ip"]), toString(r["username"]),
+			toInt64(r["first_seen"]), toInt64(r["last_seen"]), toInt64(r["request_count"])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset drops all history; the next sync starts a fresh backfill
+func (s *IPHistoryService) Reset(ctx context.Context) error {
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureIPHistoryTables(ctx, db); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM ip_history`); err != nil {
+		return err
+	}
+	return deleteLogCursor(ctx, db, ipHistoryCursor)
+}
+
+// MultiIPUsers returns users with at least minIPs distinct IPs seen since
+// startTime, with their top IPs. An IP counts when its last_seen falls in the
+// window; request_count is the lifetime count of those IPs.
+func (s *IPHistoryService) MultiIPUsers(ctx context.Context, startTime int64, minIPs, limit int) ([]map[string]interface{}, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureIPHistoryTables(ctx, db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, MAX(username), COUNT(*) as ip_count, SUM(request_count) as request_count
+		FROM ip_history
+		WHERE last_seen >= ?
+		GROUP BY user_id
+		HAVING COUNT(*) >= ?
+		ORDER BY ip_count DESC, request_count DESC
+		LIMIT ?`, startTime, minIPs, limit)
+	if err != nil {
+		return nil, err
+	}
+	items := []map[string]interface{}{}
+	var userIDs []int64
+	for rows.Next() {
+		var userID, ipCount, requests int64
+		var username string
+		if err := rows.Scan(&userID, &username, &ipCount, &requests); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+		items = append(items, map[string]interface{}{
+			"user_id":       userID,
+			"username":      username,
+			"ip_count":      ipCount,
+			"request_count": requests,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(items) == 0 {
+		return items, err
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",")
+	args := []interface{}{startTime}
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	ipRows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT user_id, ip, request_count
+		FROM ip_history
+		WHERE last_seen >= ? AND user_id IN (%s)
+		ORDER BY user_id, request_count DESC`, in), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer ipRows.Close()
+	ipsByUser := map[int64][]map[string]interface{}{}
+	for ipRows.Next() {
+		var userID, requests int64
+		var ip string
+		if err := ipRows.Scan(&userID, &ip, &requests); err != nil {
+			return nil, err
+		}
+		if len(ipsByUser[userID]) < userIPDetailLimit {
+			ipsByUser[userID] = append(ipsByUser[userID], map[string]interface{}{"ip": ip, "request_count": requests})
+		}
+	}
+	for _, item := range items {
+		if ips, ok := ipsByUser[toInt64(item["user_id"])]; ok {
+			item["top_ips"] = ips
+		} else {
+			item["top_ips"] = []interface{}{}
+		}
+	}
+	return items, ipRows.Err()
+}
+
+// UserIPSequence rebuilds an approximate IP sequence for analyzeIPSwitches
+// from the user's IP intervals in [startTime, endTime]: each IP contributes
+// its first and last sighting inside the window. Interleaving inside an
+// interval is not visible, so switch counts are a lower bound.
+func (s *IPHistoryService) UserIPSequence(ctx context.Context, userID, startTime, endTime int64) ([]map[string]interface{}, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureIPHistoryTables(ctx, db); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT ip, first_seen, last_seen FROM ip_history
+		WHERE user_id = ? AND last_seen >= ? AND first_seen <= ?`, userID, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var intervals []ipInterval
+	for rows.Next() {
+		var iv ipInterval
+		if err := rows.Scan(&iv.ip, &iv.first, &iv.last); err != nil {
+			return nil, err
+		}
+		intervals = append(intervals, iv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ipSequenceFromIntervals(intervals, startTime, endTime), nil
+}
+
+type ipInterval struct {
+	ip          string
+	first, last int64
+}
+
+// ipSequenceFromIntervals turns IP intervals into time-ordered sightings
+// ({created_at, ip}) clipped to [startTime, endTime]
+func ipSequenceFromIntervals(intervals []ipInterval, startTime, endTime int64) []map[string]interface{} {
+	seq := make([]map[string]interface{}, 0, len(intervals)*2)
+	for _, iv := range intervals {
+		first, last := iv.first, iv.last
+		if first < startTime {
+			first = startTime
+		}
+		if last > endTime {
+			last = endTime
+		}
+		if first > last {
+			continue
+		}
+		seq = append(seq, map[string]interface{}{"created_at": first, "ip": iv.ip})
+		if last != first {
+			seq = append(seq, map[string]interface{}{"created_at": last, "ip": iv.ip})
+		}
+	}
+	sort.SliceStable(seq, func(i, j int) bool {
+		ti, tj := toInt64(seq[i]["created_at"]), toInt64(seq[j]["created_at"])
+		if ti != tj {
+			return ti < tj
+		}
+		return toString(seq[i]["ip"]) < toString(seq[j]["ip"])
+	})
+	return seq
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestSyncIPHistoryIsIncremental(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+		ip TEXT, type INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	insert := func(userID int, ip string, ts int64) {
+		db.MustExec(`INSERT INTO logs (user_id, username, ip, type, created_at) VALUES (?, 'u', ?, 2, ?)`, userID, ip, ts)
+	}
+	insert(1, "10.0.0.1", now-40*86400) // before the backfill window
+	insert(1, "10.0.0.1", now-3000)
+	insert(1, "10.0.0.2", now-2000)
+	insert(2, "10.0.0.9", now-1000)
+
+	svc := NewIPHistoryService()
+	ctx := context.Background()
+	if svc.Covers(ctx, now-86400) {
+		t.Fatal("an unsynced table must not be used")
+	}
+	res, err := svc.SyncIPHistory(ctx, 0)
+	if err != nil || !res.Completed || res.Upserted != 3 {
+		t.Fatalf("first sync: %+v %v", res, err)
+	}
+
+	// new logs are folded into existing rows
+	insert(1, "10.0.0.1", now-100)
+	insert(1, "10.0.0.3", now-50)
+	if res, err = svc.SyncIPHistory(ctx, 0); err != nil || res.Upserted != 2 {
+		t.Fatalf("second sync: %+v %v", res, err)
+	}
+	st, err := svc.GetState(ctx)
+	if err != nil || st.Rows != 4 || st.LastLogID != 6 {
+		t.Fatalf("unexpected state: %+v %v", st, err)
+	}
+	if !svc.Covers(ctx, now-86400) || svc.Covers(ctx, now-60*86400) {
+		t.Fatal("Covers must accept windows inside the backfill and reject older ones")
+	}
+
+	items, err := svc.MultiIPUsers(ctx, now-86400, 2, 10)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("MultiIPUsers: %v %v", items, err)
+	}
+	if toInt64(items[0]["user_id"]) != 1 || toInt64(items[0]["ip_count"]) != 3 || toInt64(items[0]["request_count"]) != 4 {
+		t.Fatalf("unexpected multi-ip row: %v", items[0])
+	}
+	top := items[0]["top_ips"].([]map[string]interface{})
+	if top[0]["ip"] != "10.0.0.1" || toInt64(top[0]["request_count"]) != 2 {
+		t.Fatalf("10.0.0.1 should lead with 2 in-backfill requests, got %v", top)
+	}
+
+	seq, err := svc.UserIPSequence(ctx, 1, now-86400, now)
+	if err != nil {
+		t.Fatalf("UserIPSequence: %v", err)
+	}
+	analysis := analyzeIPSwitches(seq)
+	// .1 [now-3000, now-100], .2 at now-2000, .3 at now-50 → .1 → .2 → .1 → .3
+	if toInt64(analysis["switch_count"]) != 3 {
+		t.Fatalf("expected 3 switches from intervals, got %v (seq=%v)", analysis["switch_count"], seq)
+	}
+}
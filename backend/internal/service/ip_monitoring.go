@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -22,8 +23,10 @@ var WindowSeconds = map[string]int64{
 
 // IPMonitoringService handles IP analysis queries
 type IPMonitoringService struct {
-	db    *database.Manager
-	logDB *database.Manager
+	db       *database.Manager
+	logDB    *database.Manager
+	cm       *cache.Manager
+	instance string
 }
 
 const (
@@ -35,7 +38,20 @@ const (
 
 // NewIPMonitoringService creates a new IPMonitoringService
 func NewIPMonitoringService() *IPMonitoringService {
-	return &IPMonitoringService{db: database.Get(), logDB: database.GetLog()}
+	return NewIPMonitoringServiceFor("")
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *IPMonitoringService) WithContext(ctx context.Context) *IPMonitoringService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// NewIPMonitoringServiceFor creates a IPMonitoringService bound to a registered New API instance ("" = primary)
+func NewIPMonitoringServiceFor(instance string) *IPMonitoringService {
+	db, logDB := database.ForInstanceRead(instance)
+	return &IPMonitoringService{db: db, logDB: logDB, cm: cache.ForInstance(instance), instance: instance}
 }
 
 // GetIPStats returns IP recording statistics matching the Python format:
@@ -118,8 +134,8 @@ func (s *IPMonitoringService) GetSharedIPs(window string, minTokens, limit int,
 	startTime := time.Now().Unix() - seconds
 
 	// Check cache
-	cacheKey := fmt.Sprintf("ip:shared:%s:%d:%d", window, minTokens, limit)
-	cm := cache.Get()
+	cacheKey := cache.Key("ip:shared:%s:%d:%d", window, minTokens, limit)
+	cm := s.cm
 	var cached map[string]interface{}
 	if !noCache {
 		found, _ := cm.GetJSON(cacheKey, &cached)
@@ -228,8 +244,8 @@ func (s *IPMonitoringService) GetMultiIPTokens(window string, minIPs, limit int,
 	}
 	startTime := time.Now().Unix() - seconds
 
-	cacheKey := fmt.Sprintf("ip:multi_token:%s:%d:%d", window, minIPs, limit)
-	cm := cache.Get()
+	cacheKey := cache.Key("ip:multi_token:%s:%d:%d", window, minIPs, limit)
+	cm := s.cm
 	var cached map[string]interface{}
 	if !noCache {
 		found, _ := cm.GetJSON(cacheKey, &cached)
@@ -328,8 +344,8 @@ func (s *IPMonitoringService) GetMultiIPUsers(window string, minIPs, limit int,
 	}
 	startTime := time.Now().Unix() - seconds
 
-	cacheKey := fmt.Sprintf("ip:multi_user:%s:%d:%d", window, minIPs, limit)
-	cm := cache.Get()
+	cacheKey := cache.Key("ip:multi_user:%s:%d:%d", window, minIPs, limit)
+	cm := s.cm
 	var cached map[string]interface{}
 	if !noCache {
 		found, _ := cm.GetJSON(cacheKey, &cached)
@@ -338,6 +354,25 @@ func (s *IPMonitoringService) GetMultiIPUsers(window string, minIPs, limit int,
 		}
 	}
 
+	// Fast path: the local ip_history table (primary instance, kept in sync
+	// by the analytics processor) instead of a GROUP BY over logs
+	if s.instance == "" {
+		history := NewIPHistoryService()
+		if history.Covers(context.Background(), startTime) {
+			if items, err := history.MultiIPUsers(context.Background(), startTime, minIPs, limit); err == nil {
+				result := map[string]interface{}{
+					"items":   items,
+					"total":   len(items),
+					"window":  window,
+					"min_ips": minIPs,
+					"source":  "ip_history",
+				}
+				cm.Set(cacheKey, result, 5*time.Minute)
+				return result, nil
+			}
+		}
+	}
+
 	query := s.logDB.RebindQuery(`
 		SELECT l.user_id, COALESCE(l.username, '') as username,
 			COUNT(DISTINCT l.ip) as ip_count, COUNT(*) as request_count
@@ -413,6 +448,7 @@ func (s *IPMonitoringService) GetMultiIPUsers(window string, minIPs, limit int,
 		"total":   len(rows),
 		"window":  window,
 		"min_ips": minIPs,
+		"source":  "logs",
 	}
 
 	cm.Set(cacheKey, result, 5*time.Minute)
@@ -487,39 +523,58 @@ func (s *IPMonitoringService) LookupIPUsers(ip, window string, limit int, includ
 	return result, nil
 }
 
-// GetUserIPs returns all unique IPs for a user
+// GetUserIPs returns the unique IPs of a user, busiest first. Past
+// groupedRowCap IPs the rest are folded into one "other" row and truncated
+// is set.
 func (s *IPMonitoringService) GetUserIPs(userID int64, window string) (map[string]interface{}, error) {
 	seconds, ok := WindowSeconds[window]
 	if !ok {
 		seconds = 86400
 	}
 	startTime := time.Now().Unix() - seconds
+	where := "user_id = ? AND created_at >= ? AND ip IS NOT NULL AND ip <> ''"
 
-	query := s.logDB.RebindQuery(`
+	query := s.logDB.RebindQuery(fmt.Sprintf(`
 		SELECT ip, COUNT(*) as request_count,
 			MIN(created_at) as first_seen, MAX(created_at) as last_seen
 		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND ip IS NOT NULL AND ip <> ''
+		WHERE %s
 		GROUP BY ip
-		ORDER BY request_count DESC`)
+		ORDER BY request_count DESC
+		LIMIT %d`, where, groupedRowCap+1))
 
 	rows, err := s.logDB.QueryWithTimeout(ipMonitoringQueryTimeout, query, userID, startTime)
 	if err != nil {
 		return nil, err
 	}
 
+	total := int64(len(rows))
+	truncated := len(rows) > groupedRowCap
+	if truncated {
+		totals, err := s.logDB.QueryOneWithTimeout(ipMonitoringQueryTimeout, s.logDB.RebindQuery(
+			"SELECT COUNT(DISTINCT ip) as group_count, COUNT(*) as request_count FROM logs WHERE "+where), userID, startTime)
+		if err != nil {
+			return nil, err
+		}
+		total = toInt64(totals["group_count"])
+		rows = foldOtherGroup(rows, groupedRowCap, "ip", totals, "request_count")
+	}
+
 	return map[string]interface{}{
-		"user_id": userID,
-		"items":   rows,
-		"total":   len(rows),
-		"window":  window,
+		"user_id":   userID,
+		"items":     rows,
+		"total":     total,
+		"truncated": truncated,
+		"window":    window,
 	}, nil
 }
 
 // EnableAllIPRecording enables IP recording for all users by updating the setting JSON field
 func (s *IPMonitoringService) EnableAllIPRecording() (map[string]interface{}, error) {
+	// s.db may be the read replica; writes go to the primary
+	primary, _ := database.ForInstance(s.instance)
 	var updateSQL string
-	if s.db.IsPG {
+	if primary.IsPG {
 		updateSQL = `
 			UPDATE users SET setting =
 				CASE
@@ -539,7 +594,7 @@ func (s *IPMonitoringService) EnableAllIPRecording() (map[string]interface{}, er
 			AND (setting IS NULL OR setting = '' OR JSON_EXTRACT(setting, '$.record_ip_log') IS NULL OR JSON_EXTRACT(setting, '$.record_ip_log') != true)`
 	}
 
-	affected, err := s.db.Execute(updateSQL)
+	affected, err := primary.Execute(updateSQL)
 	if err != nil {
 		return nil, err
 	}
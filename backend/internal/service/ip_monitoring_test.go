@@ -44,8 +44,8 @@ func stubGeoIP(t *testing.T) {
 func clearIPTestCaches(t *testing.T) {
 	t.Helper()
 	cm := cache.Get()
-	cm.DeleteByPrefix("dashboard:ip_distribution:")
-	cm.DeleteByPrefix("ip:")
+	cm.DeleteByPrefix(cache.Key("dashboard:ip_distribution:"))
+	cm.DeleteByPrefix(cache.Key("ip:"))
 }
 
 func TestLookupIPUsersIncludesGeoAndFullAggregates(t *testing.T) {
@@ -212,3 +212,42 @@ func TestMultiIPTokenDetailsAreLimitedInSQL(t *testing.T) {
 		t.Fatalf("expected %d detailed IPs, got %d", tokenIPDetailLimit, len(ips))
 	}
 }
+
+func TestUserIPsFoldsGroupsPastCapIntoOther(t *testing.T) {
+	installIPMonitoringSchema(t)
+	db := NewIPMonitoringService().db.DB
+	now := time.Now().Unix()
+	tx := db.MustBegin()
+	// 前 groupedRowCap 个 IP 各 3 次请求，之后 5 个 IP 各 1 次
+	for i := 0; i < groupedRowCap+5; i++ {
+		n := 1
+		if i < groupedRowCap {
+			n = 3
+		}
+		for j := 0; j < n; j++ {
+			tx.MustExec(`INSERT INTO logs (user_id, created_at, type, ip) VALUES (7, ?, 2, ?)`, now, fmt.Sprintf("10.1.%d.%d", i/256, i%256))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewIPMonitoringService().GetUserIPs(7, "24h")
+	if err != nil {
+		t.Fatalf("GetUserIPs: %v", err)
+	}
+	items := res["items"].([]map[string]interface{})
+	if res["truncated"] != true || toInt64(res["total"]) != groupedRowCap+5 || len(items) != groupedRowCap+1 {
+		t.Fatalf("expected %d rows + other, truncated, total %d; got %d rows, %v, %v",
+			groupedRowCap, groupedRowCap+5, len(items), res["truncated"], res["total"])
+	}
+	other := items[groupedRowCap]
+	if other["ip"] != groupedOtherKey || toInt64(other["request_count"]) != 5 || toInt64(other["group_count"]) != 5 {
+		t.Fatalf("other row should fold the 5 remaining IPs, got %v", other)
+	}
+
+	res, err = NewIPMonitoringService().GetUserIPs(8, "24h")
+	if err != nil || res["truncated"] != false || toInt64(res["total"]) != 0 {
+		t.Fatalf("a user without traffic is not truncated, got %v, %v", res, err)
+	}
+}
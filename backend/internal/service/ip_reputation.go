@@ -0,0 +1,569 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+const ipReputationSettingsKey = "ip_reputation"
+
+// IP network types
+const (
+	IPTypeDatacenter  = "datacenter"
+	IPTypeVPN         = "vpn"
+	IPTypeTor         = "tor"
+	IPTypeResidential = "residential"
+	IPTypePrivate     = "private"
+	IPTypeUnknown     = "unknown" // 没有任何信誉数据可用
+)
+
+// ipReputationCategories are the list categories in match precedence order
+var ipReputationCategories = []string{IPTypeTor, IPTypeVPN, IPTypeDatacenter}
+
+var ErrInvalidReputationSource = errors.New("invalid reputation source")
+
+// ipReputationMaxListSize caps a downloaded list (bytes)
+const ipReputationMaxListSize = 64 * 1024 * 1024
+
+// IPReputationSource is one downloadable IP / CIDR list (one entry per line, # comments)
+type IPReputationSource struct {
+	Name     string `json:"name"`
+	Category string `json:"category"` // datacenter | vpn | tor
+	URL      string `json:"url"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// IPReputationSettings IP 信誉（机房 / VPN / Tor）识别配置
+type IPReputationSettings struct {
+	Enabled         bool                 `json:"enabled"` // 是否定期下载信誉列表
+	RefreshHours    int                  `json:"refresh_hours"`
+	UseASNHeuristic bool                 `json:"use_asn_heuristic"` // 按 ASN 组织名识别云厂商 / 托管商
+	Sources         []IPReputationSource `json:"sources"`
+	UpdatedAt       int64                `json:"updated_at"`
+}
+
+// IPReputationSettingsInput supports partial update of IPReputationSettings
+type IPReputationSettingsInput struct {
+	Enabled         *bool                 `json:"enabled"`
+	RefreshHours    *int                  `json:"refresh_hours"`
+	UseASNHeuristic *bool                 `json:"use_asn_heuristic"`
+	Sources         *[]IPReputationSource `json:"sources"`
+}
+
+// IPReputationSourceStatus is the load state of one source
+type IPReputationSourceStatus struct {
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Entries   int    `json:"entries"`
+	FetchedAt int64  `json:"fetched_at"`
+	Error     string `json:"error,omitempty"`
+}
+
+func defaultIPReputationSettings() IPReputationSettings {
+	return IPReputationSettings{
+		Enabled:         true,
+		RefreshHours:    24,
+		UseASNHeuristic: true,
+		Sources: []IPReputationSource{
+			{Name: "x4bnet-datacenter", Category: IPTypeDatacenter, URL: "https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/datacenter/ipv4.txt", Enabled: true},
+			{Name: "x4bnet-vpn", Category: IPTypeVPN, URL: "https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/vpn/ipv4.txt", Enabled: true},
+			{Name: "tor-exit", Category: IPTypeTor, URL: "https://check.torproject.org/torbulkexitlist", Enabled: true},
+		},
+	}
+}
+
+var ipReputationSourceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func normalizeIPReputationSettings(s *IPReputationSettings) error {
+	s.RefreshHours = clampSetting(s.RefreshHours, 1, 720, 24)
+	seen := map[string]bool{}
+	sources := make([]IPReputationSource, 0, len(s.Sources))
+	for _, src := range s.Sources {
+		src.Name = strings.ToLower(strings.TrimSpace(src.Name))
+		src.Category = strings.ToLower(strings.TrimSpace(src.Category))
+		src.URL = strings.TrimSpace(src.URL)
+		if !ipReputationSourceName.MatchString(src.Name) {
+			return fmt.Errorf("invalid source name %q (a-z, 0-9, -, _)", src.Name)
+		}
+		if seen[src.Name] {
+			return fmt.Errorf("duplicate source name %q", src.Name)
+		}
+		switch src.Category {
+		case IPTypeDatacenter, IPTypeVPN, IPTypeTor:
+		default:
+			return fmt.Errorf("source %s: category must be datacenter, vpn or tor", src.Name)
+		}
+		if !strings.HasPrefix(src.URL, "http://") && !strings.HasPrefix(src.URL, "https://") {
+			return fmt.Errorf("source %s: url must be http(s)", src.Name)
+		}
+		seen[src.Name] = true
+		sources = append(sources, src)
+	}
+	s.Sources = sources
+	return nil
+}
+
+// ipRangeSet is a set of IP ranges: IPv4 as merged sorted intervals (binary
+// search), IPv6 as a plain CIDR list (lists are overwhelmingly IPv4).
+type ipRangeSet struct {
+	v4      [][2]uint32
+	v6      []*net.IPNet
+	entries int
+}
+
+func (r *ipRangeSet) add(line string) bool {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexAny(line, "#; \t"); i >= 0 {
+		line = line[:i]
+	}
+	if line == "" {
+		return false
+	}
+	_, n, err := normalizeBlocklistCIDR(line)
+	if err != nil {
+		return false
+	}
+	r.entries++
+	if ip4 := n.IP.To4(); ip4 != nil {
+		ones, _ := n.Mask.Size()
+		start := binary.BigEndian.Uint32(ip4)
+		end := start | (^uint32(0) >> uint(ones))
+		if ones == 0 {
+			end = ^uint32(0)
+		}
+		r.v4 = append(r.v4, [2]uint32{start, end})
+		return true
+	}
+	r.v6 = append(r.v6, n)
+	return true
+}
+
+// finish sorts and merges the IPv4 intervals
+func (r *ipRangeSet) finish() {
+	sort.Slice(r.v4, func(i, j int) bool { return r.v4[i][0] < r.v4[j][0] })
+	merged := r.v4[:0]
+	for _, iv := range r.v4 {
+		if n := len(merged); n > 0 && uint64(iv[0]) <= uint64(merged[n-1][1])+1 {
+			if iv[1] > merged[n-1][1] {
+				merged[n-1][1] = iv[1]
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	r.v4 = merged
+}
+
+func (r *ipRangeSet) contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		v := binary.BigEndian.Uint32(ip4)
+		i := sort.Search(len(r.v4), func(i int) bool { return r.v4[i][1] >= v })
+		return i < len(r.v4) && r.v4[i][0] <= v
+	}
+	for _, n := range r.v6 {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostingOrgKeywords flags ASN organisations that are clouds / hosting
+// providers; matched case-insensitively as substrings.
+var hostingOrgKeywords = []string{
+	"amazon", "aws", "google cloud", "google llc", "microsoft", "azure", "digitalocean", "linode", "akamai",
+	"vultr", "choopa", "ovh", "hetzner", "contabo", "leaseweb", "scaleway", "oracle", "alibaba", "aliyun",
+	"tencent", "huawei cloud", "ucloud", "kingsoft cloud", "cloudflare", "fastly", "m247", "datacamp",
+	"hosting", "hostinger", "data center", "datacenter", "colocation", "dedicated", "server", "vps",
+}
+
+func isHostingOrg(org string) bool {
+	org = strings.ToLower(org)
+	if org == "" {
+		return false
+	}
+	for _, kw := range hostingOrgKeywords {
+		if strings.Contains(org, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPReputationService classifies IPs as datacenter / VPN / Tor / residential
+// from downloadable reputation lists plus an ASN organisation heuristic. Lists
+// are cached under DATA_DIR/iprep so restarts do not need the network.
+type IPReputationService struct {
+	mu       sync.RWMutex
+	sets     map[string]map[string]*ipRangeSet // category -> source -> ranges
+	status   []IPReputationSourceStatus
+	useASN   bool
+	client   *http.Client
+	refreshM sync.Mutex
+}
+
+var (
+	ipReputationService     *IPReputationService
+	ipReputationServiceOnce sync.Once
+)
+
+var ipReputationProvider = func() *IPReputationService {
+	return GetIPReputationService()
+}
+
+// GetIPReputationService returns the singleton IPReputationService (lists are
+// loaded from the on-disk cache on first use)
+func GetIPReputationService() *IPReputationService {
+	ipReputationServiceOnce.Do(func() {
+		ipReputationService = &IPReputationService{client: &http.Client{Timeout: 120 * time.Second}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := ipReputationService.Reload(ctx); err != nil {
+			logger.L.Warn("[IP信誉] 加载本地列表失败: "+err.Error(), logger.CatSystem)
+		}
+	})
+	return ipReputationService
+}
+
+func ipReputationDir() string {
+	dataDir := strings.TrimSpace(config.Get().DataDir)
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return filepath.Join(dataDir, "iprep")
+}
+
+// GetSettings returns the reputation settings (defaults if never saved)
+func (s *IPReputationService) GetSettings(ctx context.Context) (IPReputationSettings, error) {
+	settings := defaultIPReputationSettings()
+	if _, err := loadLocalSetting(ctx, ipReputationSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeIPReputationSettings(&settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update, persists it and reloads the lists
+func (s *IPReputationService) UpdateSettings(ctx context.Context, in IPReputationSettingsInput) (IPReputationSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.RefreshHours != nil {
+		settings.RefreshHours = *in.RefreshHours
+	}
+	if in.UseASNHeuristic != nil {
+		settings.UseASNHeuristic = *in.UseASNHeuristic
+	}
+	if in.Sources != nil {
+		settings.Sources = *in.Sources
+	}
+	if err := normalizeIPReputationSettings(&settings); err != nil {
+		return settings, fmt.Errorf("%w: %v", ErrInvalidReputationSource, err)
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, ipReputationSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	return settings, s.Reload(ctx)
+}
+
+// Refresh downloads every enabled source and reloads the sets. A source that
+// fails keeps its previous cached copy.
+func (s *IPReputationService) Refresh(ctx context.Context) ([]IPReputationSourceStatus, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.refreshM.Lock()
+	defer s.refreshM.Unlock()
+
+	dir := ipReputationDir()
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	fetchErrors := map[string]string{}
+	for _, src := range settings.Sources {
+		if !src.Enabled {
+			continue
+		}
+		if err := s.download(ctx, src, filepath.Join(dir, src.Name+".txt")); err != nil {
+			fetchErrors[src.Name] = err.Error()
+			logger.L.Warn(fmt.Sprintf("[IP信誉] 下载 %s 失败: %v", src.Name, err), logger.CatSystem)
+		}
+	}
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for i := range s.status {
+		if msg, ok := fetchErrors[s.status[i].Name]; ok {
+			s.status[i].Error = msg
+		}
+	}
+	status := append([]IPReputationSourceStatus(nil), s.status...)
+	s.mu.Unlock()
+	return status, nil
+}
+
+func (s *IPReputationService) download(ctx context.Context, src IPReputationSource, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	tmp := dest + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	written, err := io.Copy(out, io.LimitReader(resp.Body, ipReputationMaxListSize))
+	out.Close()
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		return fmt.Errorf("empty list")
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Reload rebuilds the in-memory sets from the cached list files
+func (s *IPReputationService) Reload(ctx context.Context) error {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	dir := ipReputationDir()
+	sets := map[string]map[string]*ipRangeSet{}
+	status := make([]IPReputationSourceStatus, 0, len(settings.Sources))
+	for _, src := range settings.Sources {
+		if !src.Enabled {
+			continue
+		}
+		st := IPReputationSourceStatus{Name: src.Name, Category: src.Category}
+		path := filepath.Join(dir, src.Name+".txt")
+		set, fetchedAt, err := loadIPRangeFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				st.Error = err.Error()
+			}
+			status = append(status, st)
+			continue
+		}
+		st.Entries, st.FetchedAt = set.entries, fetchedAt
+		if sets[src.Category] == nil {
+			sets[src.Category] = map[string]*ipRangeSet{}
+		}
+		sets[src.Category][src.Name] = set
+		status = append(status, st)
+	}
+
+	s.mu.Lock()
+	s.sets = sets
+	s.status = status
+	s.useASN = settings.UseASNHeuristic
+	s.mu.Unlock()
+	return nil
+}
+
+func loadIPRangeFile(path string) (*ipRangeSet, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	set := &ipRangeSet{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		set.add(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	set.finish()
+	return set, info.ModTime().Unix(), nil
+}
+
+// Status reports the loaded sources
+func (s *IPReputationService) Status() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return map[string]interface{}{
+		"sources":       append([]IPReputationSourceStatus{}, s.status...),
+		"asn_heuristic": s.useASN,
+		"asn_available": IsIPASNAvailable(),
+	}
+}
+
+// Stale reports whether any enabled source is missing or older than maxAge
+func (s *IPReputationService) Stale(maxAge time.Duration) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cutoff := time.Now().Add(-maxAge).Unix()
+	for _, st := range s.status {
+		if st.FetchedAt < cutoff {
+			return true
+		}
+	}
+	return false
+}
+
+// hasData reports whether any list is loaded or the ASN heuristic can run.
+// Caller must hold s.mu (read).
+func (s *IPReputationService) hasData() bool {
+	for _, bySource := range s.sets {
+		if len(bySource) > 0 {
+			return true
+		}
+	}
+	return s.useASN && IsIPASNAvailable()
+}
+
+// Classify returns the network type of one IP
+func (s *IPReputationService) Classify(ip string) api.IPReputation {
+	result := api.IPReputation{IP: ip, Type: IPTypeUnknown}
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return result
+	}
+	if parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() {
+		result.Type = IPTypePrivate
+		return result
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, category := range ipReputationCategories {
+		names := make([]string, 0, len(s.sets[category]))
+		for name := range s.sets[category] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if s.sets[category][name].contains(parsed) {
+				result.Type = category
+				result.Source = name
+				return result
+			}
+		}
+	}
+	if s.useASN {
+		geo := LookupIPGeo(parsed.String())
+		result.ASN, result.Org = geo.ASN, geo.Org
+		if isHostingOrg(geo.Org) {
+			result.Type = IPTypeDatacenter
+			result.Source = "asn"
+			return result
+		}
+	}
+	if s.hasData() {
+		result.Type = IPTypeResidential
+	}
+	return result
+}
+
+// ClassifyIP classifies one IP through the configured reputation provider
+func ClassifyIP(ip string) api.IPReputation {
+	svc := ipReputationProvider()
+	if svc == nil {
+		return api.IPReputation{IP: ip, Type: IPTypeUnknown}
+	}
+	return svc.Classify(ip)
+}
+
+// ClassifyIPBatch classifies multiple IPs, keyed by IP
+func ClassifyIPBatch(ips []string) map[string]api.IPReputation {
+	out := make(map[string]api.IPReputation, len(ips))
+	for _, ip := range ips {
+		if _, ok := out[ip]; !ok {
+			out[ip] = ClassifyIP(ip)
+		}
+	}
+	return out
+}
+
+// SetIPReputationProviderForTesting replaces the reputation provider and returns a restore function.
+func SetIPReputationProviderForTesting(provider func() *IPReputationService) func() {
+	old := ipReputationProvider
+	ipReputationProvider = provider
+	return func() {
+		ipReputationProvider = old
+	}
+}
+
+// summarizeIPReputation annotates the top IP rows with ip_type and
+// returns the request split per type. Returns nil when no reputation data is
+// available, so callers can omit the section entirely.
+func summarizeIPReputation(rows []api.UserTopIP) *api.IPReputationSummary {
+	ips := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ips = append(ips, row.IP)
+	}
+	reps := ClassifyIPBatch(ips)
+
+	summary := &api.IPReputationSummary{
+		RequestsByType: map[string]int64{},
+		ShareByType:    map[string]float64{},
+		IPsByType:      map[string][]string{},
+	}
+	var total int64
+	known := false
+	for i := range rows {
+		row := &rows[i]
+		rep := reps[row.IP]
+		row.IPType, row.IPTypeSource = rep.Type, rep.Source
+		if rep.Type != IPTypeUnknown && rep.Type != IPTypePrivate {
+			known = true
+		}
+		total += row.Requests
+		summary.RequestsByType[rep.Type] += row.Requests
+		summary.IPsByType[rep.Type] = append(summary.IPsByType[rep.Type], row.IP)
+	}
+	if !known {
+		return nil
+	}
+
+	for t, n := range summary.RequestsByType {
+		if total > 0 {
+			summary.ShareByType[t] = roundRate(float64(n) / float64(total) * 100)
+		}
+	}
+	return summary
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+func TestIPRangeSetMergesAndMatches(t *testing.T) {
+	set := &ipRangeSet{}
+	for _, line := range []string{"# comment", "10.0.0.0/24", "10.0.1.0/24 ; adjacent", "192.0.2.7", "2001:db8::/32", "garbage"} {
+		set.add(line)
+	}
+	set.finish()
+	if set.entries != 4 || len(set.v4) != 2 {
+		t.Fatalf("expected 4 entries merged into 2 IPv4 ranges, got entries=%d v4=%v", set.entries, set.v4)
+	}
+	for ip, want := range map[string]bool{
+		"10.0.0.1": true, "10.0.1.255": true, "10.0.2.0": false,
+		"192.0.2.7": true, "192.0.2.8": false, "2001:db8::1": true, "2001:db9::1": false,
+	} {
+		if got := set.contains(net.ParseIP(ip)); got != want {
+			t.Errorf("contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestIPReputationClassifyFromCachedLists(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", dataDir)
+	config.Load()
+
+	dir := filepath.Join(dataDir, "iprep")
+	os.MkdirAll(dir, 0750)
+	os.WriteFile(filepath.Join(dir, "x4bnet-datacenter.txt"), []byte("203.0.113.0/24\n"), 0640)
+	os.WriteFile(filepath.Join(dir, "x4bnet-vpn.txt"), []byte("198.51.100.0/24\n"), 0640)
+	os.WriteFile(filepath.Join(dir, "tor-exit.txt"), []byte("198.51.100.9\n"), 0640)
+
+	svc := &IPReputationService{client: http.DefaultClient}
+	useASN := false
+	if _, err := svc.UpdateSettings(context.Background(), IPReputationSettingsInput{UseASNHeuristic: &useASN}); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	restore := SetIPReputationProviderForTesting(func() *IPReputationService { return svc })
+	defer restore()
+
+	for ip, want := range map[string]string{
+		"203.0.113.5":  IPTypeDatacenter,
+		"198.51.100.1": IPTypeVPN,
+		"198.51.100.9": IPTypeTor, // tor takes precedence over the vpn range
+		"8.8.4.4":      IPTypeResidential,
+		"192.168.1.2":  IPTypePrivate,
+		"not-an-ip":    IPTypeUnknown,
+	} {
+		if got := ClassifyIP(ip); got.Type != want {
+			t.Errorf("ClassifyIP(%s) = %+v, want %s", ip, got, want)
+		}
+	}
+
+	rows := []api.UserTopIP{
+		{IP: "203.0.113.5", Requests: 30},
+		{IP: "8.8.4.4", Requests: 10},
+	}
+	rep := summarizeIPReputation(rows)
+	if rep.ShareByType[IPTypeDatacenter] != 75 || rows[0].IPType != IPTypeDatacenter {
+		t.Fatalf("unexpected reputation summary: %+v rows=%+v", rep, rows)
+	}
+
+	vars := aiBanPromptVariables(&api.UserAnalysis{
+		TopIPs: rows,
+		Risk:   api.UserAnalysisRisk{IPReputation: rep},
+	}, map[string]interface{}{"blacklist_ips": []interface{}{"203.0.113.0/24"}})
+	prompt := renderAIBanPrompt("机房: {datacenter_ips} | 黑名单: {user_blacklisted_ips} | {unknown}", vars)
+	if !strings.Contains(prompt, "机房: 203.0.113.5") || !strings.Contains(prompt, "黑名单: 203.0.113.5") || !strings.Contains(prompt, "{unknown}") {
+		t.Fatalf("unexpected prompt: %s", prompt)
+	}
+}
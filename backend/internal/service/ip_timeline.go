@@ -0,0 +1,228 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+const (
+	// ipTimelineMaxBuckets bounds the buckets of one timeline; the bucket
+	// size is widened until the window fits
+	ipTimelineMaxBuckets = 200
+	// ipTimelineMaxUsers bounds the per-user series; quieter users are only
+	// counted in other_users
+	ipTimelineMaxUsers = 20
+	// ipTimelineSharedRatio is the share of active buckets with two or more
+	// users above which the IP is considered used simultaneously
+	ipTimelineSharedRatio = 0.3
+)
+
+// IP timeline patterns
+const (
+	IPPatternSingleUser   = "single_user"  // 只有一个用户
+	IPPatternSimultaneous = "simultaneous" // 多个用户在同一时段交替使用，疑似账号共享
+	IPPatternSequential   = "sequential"   // 用户先后使用、时段不重叠，多为动态 IP 重新分配
+	IPPatternMixed        = "mixed"
+)
+
+// ipTimelineBucketSizes are the candidate bucket sizes, smallest first
+var ipTimelineBucketSizes = []int64{60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 86400}
+
+// IPTimelinePoint is the requests of one bucket
+type IPTimelinePoint struct {
+	Time     int64 `json:"time"` // 桶起点（Unix 秒）
+	Requests int64 `json:"requests"`
+}
+
+// IPTimelineUser is one user's activity on the IP
+type IPTimelineUser struct {
+	UserID    int64             `json:"user_id"`
+	Username  string            `json:"username"`
+	Requests  int64             `json:"requests"`
+	FirstSeen int64             `json:"first_seen"`
+	LastSeen  int64             `json:"last_seen"`
+	Buckets   []IPTimelinePoint `json:"buckets"` // 仅有请求的桶
+}
+
+// IPTimelineBucket summarizes one bucket across users
+type IPTimelineBucket struct {
+	Time     int64 `json:"time"`
+	Users    int   `json:"users"`
+	Requests int64 `json:"requests"`
+}
+
+// IPTimelineSummary tells simultaneous from sequential use
+type IPTimelineSummary struct {
+	Users          int     `json:"users"`
+	ActiveBuckets  int     `json:"active_buckets"`
+	OverlapBuckets int     `json:"overlap_buckets"` // 两个及以上用户同时活跃的桶
+	OverlapRatio   float64 `json:"overlap_ratio"`
+	MaxConcurrent  int     `json:"max_concurrent_users"`
+	Handoffs       int     `json:"handoffs"` // 相邻活跃桶之间独占用户的切换次数
+	Pattern        string  `json:"pattern"`
+}
+
+// IPTimeline is the /api/ip/shared-ips/:ip/timeline response
+type IPTimeline struct {
+	IP            string             `json:"ip"`
+	Window        string             `json:"window"`
+	BucketSeconds int64              `json:"bucket_seconds"`
+	StartTime     int64              `json:"start_time"`
+	EndTime       int64              `json:"end_time"`
+	Buckets       []IPTimelineBucket `json:"buckets"` // 仅有请求的桶，按时间升序
+	Users         []IPTimelineUser   `json:"users"`   // 请求数最多的前 20 个用户
+	OtherUsers    int                `json:"other_users"`
+	Summary       IPTimelineSummary  `json:"summary"`
+}
+
+// ipTimelineBucketSize returns the requested bucket size if it keeps the
+// window within ipTimelineMaxBuckets, else the smallest size that does
+func ipTimelineBucketSize(windowSeconds, requested int64) int64 {
+	if requested > 0 && windowSeconds/requested <= ipTimelineMaxBuckets {
+		return requested
+	}
+	for _, size := range ipTimelineBucketSizes {
+		if windowSeconds/size <= ipTimelineMaxBuckets {
+			return size
+		}
+	}
+	return ipTimelineBucketSizes[len(ipTimelineBucketSizes)-1]
+}
+
+// GetSharedIPTimeline buckets the requests from ip per user over the window
+// so simultaneous use (several users active in the same buckets) can be told
+// from sequential use (one user after another, typical of dynamic ISP
+// reassignment). bucketSeconds <= 0 picks a size automatically.
+func (s *IPMonitoringService) GetSharedIPTimeline(ip, window string, bucketSeconds int64) (*IPTimeline, error) {
+	seconds, ok := WindowSeconds[window]
+	if !ok {
+		window, seconds = "24h", 86400
+	}
+	bucket := ipTimelineBucketSize(seconds, bucketSeconds)
+	now := time.Now().Unix()
+	startTime := now - seconds
+
+	cacheKey := cache.Key("ip:timeline:%s:%s:%d", ip, window, bucket)
+	var cached IPTimeline
+	if found, _ := s.cm.GetJSON(cacheKey, &cached); found {
+		return &cached, nil
+	}
+
+	bucketExpr := fmt.Sprintf("FLOOR(created_at / %d)", bucket)
+	rows, err := s.logDB.QueryWithTimeout(ipMonitoringQueryTimeout, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT %s AS bucket, user_id, COALESCE(MAX(username), '') AS username,
+			COUNT(*) AS requests, MIN(created_at) AS first_seen, MAX(created_at) AS last_seen
+		FROM logs
+		WHERE created_at >= ? AND ip = ?
+		GROUP BY %s, user_id`, bucketExpr, bucketExpr)), startTime, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := map[int64]*IPTimelineUser{}
+	byBucket := map[int64]*IPTimelineBucket{}
+	bucketUsers := map[int64][]int64{}
+	for _, row := range rows {
+		at := toInt64(row["bucket"]) * bucket
+		uid := toInt64(row["user_id"])
+		requests := toInt64(row["requests"])
+		first, last := toInt64(row["first_seen"]), toInt64(row["last_seen"])
+
+		u := byUser[uid]
+		if u == nil {
+			u = &IPTimelineUser{UserID: uid, FirstSeen: first, LastSeen: last}
+			byUser[uid] = u
+		}
+		if name := toString(row["username"]); name != "" {
+			u.Username = name
+		}
+		u.Requests += requests
+		u.FirstSeen, u.LastSeen = min(u.FirstSeen, first), max(u.LastSeen, last)
+		u.Buckets = append(u.Buckets, IPTimelinePoint{Time: at, Requests: requests})
+
+		b := byBucket[at]
+		if b == nil {
+			b = &IPTimelineBucket{Time: at}
+			byBucket[at] = b
+		}
+		b.Users++
+		b.Requests += requests
+		bucketUsers[at] = append(bucketUsers[at], uid)
+	}
+
+	result := &IPTimeline{
+		IP:            ip,
+		Window:        window,
+		BucketSeconds: bucket,
+		StartTime:     startTime,
+		EndTime:       now,
+		Buckets:       make([]IPTimelineBucket, 0, len(byBucket)),
+		Users:         make([]IPTimelineUser, 0, min(len(byUser), ipTimelineMaxUsers)),
+	}
+	for _, b := range byBucket {
+		result.Buckets = append(result.Buckets, *b)
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Time < result.Buckets[j].Time })
+
+	users := make([]*IPTimelineUser, 0, len(byUser))
+	for _, u := range byUser {
+		sort.Slice(u.Buckets, func(i, j int) bool { return u.Buckets[i].Time < u.Buckets[j].Time })
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Requests != users[j].Requests {
+			return users[i].Requests > users[j].Requests
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	for i, u := range users {
+		if i >= ipTimelineMaxUsers {
+			result.OtherUsers = len(users) - ipTimelineMaxUsers
+			break
+		}
+		result.Users = append(result.Users, *u)
+	}
+
+	result.Summary = summarizeIPTimeline(result.Buckets, bucketUsers, len(byUser))
+	s.cm.Set(cacheKey, result, scaledTTL(2*time.Minute))
+	return result, nil
+}
+
+// summarizeIPTimeline classifies the usage pattern from the per-bucket users
+func summarizeIPTimeline(buckets []IPTimelineBucket, bucketUsers map[int64][]int64, users int) IPTimelineSummary {
+	sum := IPTimelineSummary{Users: users, ActiveBuckets: len(buckets)}
+	var lastSole int64
+	for _, b := range buckets {
+		if b.Users > sum.MaxConcurrent {
+			sum.MaxConcurrent = b.Users
+		}
+		if b.Users >= 2 {
+			sum.OverlapBuckets++
+			continue
+		}
+		sole := bucketUsers[b.Time][0]
+		if lastSole != 0 && sole != lastSole {
+			sum.Handoffs++
+		}
+		lastSole = sole
+	}
+	if len(buckets) > 0 {
+		sum.OverlapRatio = math.Round(float64(sum.OverlapBuckets)/float64(len(buckets))*1000) / 1000
+	}
+
+	switch {
+	case users <= 1:
+		sum.Pattern = IPPatternSingleUser
+	case sum.OverlapRatio >= ipTimelineSharedRatio:
+		sum.Pattern = IPPatternSimultaneous
+	case sum.OverlapBuckets == 0:
+		sum.Pattern = IPPatternSequential
+	default:
+		sum.Pattern = IPPatternMixed
+	}
+	return sum
+}
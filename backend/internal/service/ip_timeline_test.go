@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func TestSharedIPTimelinePatterns(t *testing.T) {
+	installIPMonitoringSchema(t)
+	db := database.Get().DB
+
+	base := (time.Now().Unix()-6*3600)/900*900 + 10
+	insert := func(userID int64, ip string, at int64) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO logs (user_id, created_at, type, ip, username) VALUES (?, ?, 2, ?, ?)`,
+			userID, at, ip, "user"); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	// 10.0.0.1: users 1 and 2 take turns within the same quarter hours
+	for i := int64(0); i < 4; i++ {
+		insert(1, "10.0.0.1", base+i*900)
+		insert(2, "10.0.0.1", base+i*900+60)
+		insert(1, "10.0.0.1", base+i*900+120)
+	}
+	// 10.0.0.2: user 3 in the morning, user 4 hours later
+	for i := int64(0); i < 3; i++ {
+		insert(3, "10.0.0.2", base+i*900)
+		insert(4, "10.0.0.2", base+4*3600+i*900)
+	}
+
+	svc := NewIPMonitoringService()
+	shared, err := svc.GetSharedIPTimeline("10.0.0.1", "24h", 900)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if shared.BucketSeconds != 900 || len(shared.Buckets) != 4 || len(shared.Users) != 2 {
+		t.Fatalf("unexpected timeline: %+v", shared)
+	}
+	if u := shared.Users[0]; u.UserID != 1 || u.Requests != 8 || len(u.Buckets) != 4 || u.Buckets[0].Time != base-10 {
+		t.Errorf("top user: %+v", u)
+	}
+	if sum := shared.Summary; sum.Pattern != IPPatternSimultaneous || sum.OverlapBuckets != 4 || sum.MaxConcurrent != 2 {
+		t.Errorf("shared summary: %+v", sum)
+	}
+
+	reassigned, err := svc.GetSharedIPTimeline("10.0.0.2", "24h", 900)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if sum := reassigned.Summary; sum.Pattern != IPPatternSequential || sum.OverlapBuckets != 0 || sum.Handoffs != 1 || sum.ActiveBuckets != 6 {
+		t.Errorf("reassigned summary: %+v", sum)
+	}
+
+	// 60s buckets over 7 days would be 10080 buckets: widened automatically
+	wide, err := svc.GetSharedIPTimeline("10.0.0.2", "7d", 60)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	if wide.BucketSeconds != 3600 {
+		t.Errorf("bucket should widen to 1h for 7d, got %d", wide.BucketSeconds)
+	}
+}
@@ -42,6 +42,7 @@ func (e *LookupError) Error() string {
 // LinuxDoLookupService provides linux.do username lookup via TLS fingerprint bypass.
 type LinuxDoLookupService struct {
 	client tls_client.HttpClient
+	ctx    context.Context
 }
 
 var (
@@ -82,13 +83,26 @@ func NewLinuxDoLookupService() *LinuxDoLookupService {
 	return &LinuxDoLookupService{client: client}
 }
 
+// WithContext returns a copy of the service whose lookups are canceled with ctx
+func (s *LinuxDoLookupService) WithContext(ctx context.Context) *LinuxDoLookupService {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+func (s *LinuxDoLookupService) requestContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
 // LookupUsername looks up the linux.do username for a given user ID.
 func (s *LinuxDoLookupService) LookupUsername(linuxDoID string) (*LookupResult, *LookupError) {
 	// 1. Check Redis cache
 	cacheKey := ldCachePrefix + linuxDoID
 	if cm := cache.Get(); cm != nil {
-		ctx := context.Background()
-		if cached, err := cm.RedisClient().Get(ctx, cacheKey).Result(); err == nil && cached != "" {
+		if cached, err := cm.RedisClient().Get(s.requestContext(), cacheKey).Result(); err == nil && cached != "" {
 			logger.L.Debug(fmt.Sprintf("[LinuxDoLookup] 缓存命中: id=%s → %s", linuxDoID, cached))
 			return &LookupResult{
 				LinuxDoID:  linuxDoID,
@@ -112,7 +126,7 @@ func (s *LinuxDoLookupService) LookupUsername(linuxDoID string) (*LookupResult,
 	targetURL := fmt.Sprintf(ldCertURLTpl, linuxDoID)
 	logger.L.Debug(fmt.Sprintf("[LinuxDoLookup] 请求: id=%s url=%s", linuxDoID, targetURL))
 
-	req, err := fhttp.NewRequest(fhttp.MethodGet, targetURL, nil)
+	req, err := fhttp.NewRequestWithContext(s.requestContext(), fhttp.MethodGet, targetURL, nil)
 	if err != nil {
 		return nil, &LookupError{
 			ErrorType:  "network",
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	fhttp "github.com/bogdanfinn/fhttp"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	ldTrustLevelCachePrefix = "linuxdo:trust_level:"
+	ldTrustLevelCacheTTL    = 7 * 24 * time.Hour
+	ldSuspendedCachePrefix  = "linuxdo:suspended:"
+	ldSuspendedCacheTTL     = 24 * time.Hour
+	ldUserJSONTpl           = "https://linux.do/u/%s.json"
+)
+
+// TrustLevelResult is the linux.do trust level (0-4) of a user
+type TrustLevelResult struct {
+	LinuxDoID  string `json:"linux_do_id"`
+	Username   string `json:"username"`
+	TrustLevel int    `json:"trust_level"`
+	Suspended  bool   `json:"suspended"` // 论坛账号封禁中
+	FromCache  bool   `json:"from_cache"`
+}
+
+// CachedLinuxDoTrustLevel returns a previously looked-up trust level without
+// touching the network
+func CachedLinuxDoTrustLevel(linuxDoID string) (int, bool) {
+	if linuxDoID == "" {
+		return 0, false
+	}
+	var level int
+	found, _ := cache.Get().GetJSON(ldTrustLevelCachePrefix+linuxDoID, &level)
+	return level, found
+}
+
+// CachedLinuxDoSuspended returns a previously looked-up forum suspension
+// state without touching the network
+func CachedLinuxDoSuspended(linuxDoID string) (bool, bool) {
+	if linuxDoID == "" {
+		return false, false
+	}
+	var suspended bool
+	found, _ := cache.Get().GetJSON(ldSuspendedCachePrefix+linuxDoID, &suspended)
+	return suspended, found
+}
+
+// LookupTrustLevel resolves the linux.do username of an id and reads the
+// trust level from the public profile JSON; results are cached for 7 days.
+func (s *LinuxDoLookupService) LookupTrustLevel(linuxDoID string) (*TrustLevelResult, *LookupError) {
+	if level, ok := CachedLinuxDoTrustLevel(linuxDoID); ok {
+		suspended, _ := CachedLinuxDoSuspended(linuxDoID)
+		return &TrustLevelResult{LinuxDoID: linuxDoID, TrustLevel: level, Suspended: suspended, FromCache: true}, nil
+	}
+	return s.fetchProfile(linuxDoID)
+}
+
+// LookupSuspended reports whether the linux.do account is currently suspended
+// on the forum; cached for a day since suspensions are what demotion reacts to.
+func (s *LinuxDoLookupService) LookupSuspended(linuxDoID string) (bool, *LookupError) {
+	if suspended, ok := CachedLinuxDoSuspended(linuxDoID); ok {
+		return suspended, nil
+	}
+	result, lookupErr := s.fetchProfile(linuxDoID)
+	if lookupErr != nil {
+		return false, lookupErr
+	}
+	return result.Suspended, nil
+}
+
+// fetchProfile reads the public profile JSON and caches both the trust level
+// and the suspension state
+func (s *LinuxDoLookupService) fetchProfile(linuxDoID string) (*TrustLevelResult, *LookupError) {
+	user, lookupErr := s.LookupUsername(linuxDoID)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	req, err := fhttp.NewRequestWithContext(s.requestContext(), fhttp.MethodGet, fmt.Sprintf(ldUserJSONTpl, url.PathEscape(user.Username)), nil)
+	if err != nil {
+		return nil, &LookupError{ErrorType: "network", Message: "创建请求失败", StatusCode: http.StatusInternalServerError}
+	}
+	req.Header = fhttp.Header{
+		"User-Agent":      {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36"},
+		"Accept":          {"application/json"},
+		"Accept-Language": {"en-US,en;q=0.9,zh-CN;q=0.8,zh;q=0.7"},
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		logger.L.Warn(fmt.Sprintf("[LinuxDoLookup] 信任等级请求失败: id=%s err=%v", linuxDoID, err))
+		return nil, &LookupError{ErrorType: "network", Message: "无法连接到 linux.do，请稍后重试", StatusCode: http.StatusBadGateway}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &LookupError{ErrorType: "rate_limit", Message: "请求被限速，请稍后重试", StatusCode: http.StatusTooManyRequests}
+	case resp.StatusCode == http.StatusForbidden:
+		return nil, &LookupError{ErrorType: "cf_blocked", Message: "被 Cloudflare 拦截 (403)", StatusCode: http.StatusBadGateway}
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &LookupError{ErrorType: "not_found", Message: "linux.do 用户资料不存在或未公开", StatusCode: http.StatusNotFound}
+	case resp.StatusCode != http.StatusOK:
+		return nil, &LookupError{ErrorType: "unknown", Message: fmt.Sprintf("获取用户资料失败 (HTTP %d)", resp.StatusCode), StatusCode: http.StatusBadGateway}
+	}
+
+	var profile struct {
+		User struct {
+			TrustLevel    *int   `json:"trust_level"`
+			SuspendedTill string `json:"suspended_till"`
+		} `json:"user"`
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	if err != nil || json.Unmarshal(body, &profile) != nil || profile.User.TrustLevel == nil {
+		return nil, &LookupError{ErrorType: "unknown", Message: "用户资料中未找到信任等级", StatusCode: http.StatusBadGateway}
+	}
+
+	level := *profile.User.TrustLevel
+	suspended := false
+	if till, err := time.Parse(time.RFC3339, profile.User.SuspendedTill); err == nil && till.After(time.Now()) {
+		suspended = true
+	}
+	cache.Get().Set(ldTrustLevelCachePrefix+linuxDoID, level, ldTrustLevelCacheTTL)
+	cache.Get().Set(ldSuspendedCachePrefix+linuxDoID, suspended, ldSuspendedCacheTTL)
+	logger.L.Info(fmt.Sprintf("[LinuxDoLookup] 信任等级: id=%s (%s) → %d suspended=%v", linuxDoID, user.Username, level, suspended))
+	return &TrustLevelResult{LinuxDoID: linuxDoID, Username: user.Username, TrustLevel: level, Suspended: suspended}, nil
+}
+
+// linuxDoTrustLevelLookup fetches an uncached trust level; swapped out in tests
+var linuxDoTrustLevelLookup = func(linuxDoID string) (int, error) {
+	result, lookupErr := NewLinuxDoLookupService().LookupTrustLevel(linuxDoID)
+	if lookupErr != nil {
+		return 0, lookupErr
+	}
+	return result.TrustLevel, nil
+}
+
+// linuxDoSuspendedLookup fetches an uncached suspension state; swapped out in tests
+var linuxDoSuspendedLookup = func(linuxDoID string) (bool, error) {
+	suspended, lookupErr := NewLinuxDoLookupService().LookupSuspended(linuxDoID)
+	if lookupErr != nil {
+		return false, lookupErr
+	}
+	return suspended, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+// localStoreFile is the tool-owned SQLite database that holds state which must
+// never be written into the NewAPI database (audit trail, local settings, ...).
+const localStoreFile = "tools.db"
+
+// openLocalStore opens the tool-local SQLite store under DATA_DIR.
+// Callers own the returned handle and must Close it; tables are created lazily
+// by each feature's ensure*Tables helper.
+func openLocalStore() (*sql.DB, error) {
+	path := localStorePath()
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
+
+// localStorePath returns the absolute-or-relative path of the local store file.
+func localStorePath() string {
+	dataDir := strings.TrimSpace(config.Get().DataDir)
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return filepath.Join(dataDir, localStoreFile)
+}
+
+// ensureLocalSettingsTable creates the shared key/value settings table used by
+// features that persist a single JSON config document.
+func ensureLocalSettingsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS local_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL DEFAULT 0
+		)`)
+	return err
+}
+
+// loadLocalSetting decodes the JSON document stored under key into dest.
+// Returns false (and leaves dest untouched) when the key has never been saved.
+func loadLocalSetting(ctx context.Context, key string, dest interface{}) (bool, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	if err := ensureLocalSettingsTable(ctx, db); err != nil {
+		return false, err
+	}
+	var raw string
+	err = db.QueryRowContext(ctx, `SELECT value FROM local_settings WHERE key = ?`, key).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(raw), dest)
+}
+
+// saveLocalSetting stores value as a JSON document under key.
+func saveLocalSetting(ctx context.Context, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureLocalSettingsTable(ctx, db); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO local_settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, string(raw), time.Now().Unix())
+	return err
+}
+
+// boolToInt converts a bool to the 0/1 representation stored in SQLite
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
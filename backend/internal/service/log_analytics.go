@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/new-api-tools/backend/internal/cache"
@@ -24,28 +27,42 @@ type LogAnalyticsService struct {
 
 // NewLogAnalyticsService creates a new LogAnalyticsService
 func NewLogAnalyticsService() *LogAnalyticsService {
-	return &LogAnalyticsService{db: database.Get(), logDB: database.GetLog()}
+	return &LogAnalyticsService{db: database.GetRead(), logDB: database.GetReadLog()}
 }
 
-// GetAnalyticsState returns current processing state from DB
-// Goes directly to DB to count processed logs (type=2 and type=5)
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *LogAnalyticsService) WithContext(ctx context.Context) *LogAnalyticsService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// GetAnalyticsState returns current processing state (rollup cursor once the
+// backfill is done, the live logs table before that)
 func (s *LogAnalyticsService) GetAnalyticsState() map[string]interface{} {
 	cm := cache.Get()
 	var cached map[string]interface{}
-	found, _ := cm.GetJSON("analytics:state", &cached)
+	found, _ := cm.GetJSON(cache.Key("analytics:state"), &cached)
 	if found {
 		return cached
 	}
 
-	// Get actual counts from database
-	total, maxID := s.getLogsApproxStats()
-	result := map[string]interface{}{
-		"last_log_id":       maxID,
-		"last_processed_at": time.Now().Unix(),
-		"total_processed":   total,
+	result := map[string]interface{}{}
+	if st, err := NewAnalyticsRollupService().GetState(context.Background()); err == nil && st.SyncedAt > 0 {
+		result["last_log_id"] = st.LastLogID
+		result["last_processed_at"] = st.SyncedAt
+		result["total_processed"] = st.LastLogID - st.StartLogID
+		result["source"] = "rollup"
+	} else {
+		// Rollups not backfilled yet: report the live table
+		total, maxID := s.getLogsApproxStats()
+		result["last_log_id"] = maxID
+		result["last_processed_at"] = time.Now().Unix()
+		result["total_processed"] = total
+		result["source"] = "logs"
 	}
 
-	cm.Set("analytics:state", result, 60*time.Second)
+	cm.Set(cache.Key("analytics:state"), result, scaledTTL(60*time.Second))
 	return result
 }
 
@@ -53,7 +70,7 @@ func (s *LogAnalyticsService) GetAnalyticsState() map[string]interface{} {
 func (s *LogAnalyticsService) GetUserRequestRanking(limit int) ([]map[string]interface{}, error) {
 	cm := cache.Get()
 	var cached []map[string]interface{}
-	found, _ := cm.GetJSON("analytics:user_request_ranking", &cached)
+	found, _ := cm.GetJSON(cache.Key("analytics:user_request_ranking"), &cached)
 	if found && len(cached) > 0 {
 		if limit > 0 && limit < len(cached) {
 			return cached[:limit], nil
@@ -64,7 +81,13 @@ func (s *LogAnalyticsService) GetUserRequestRanking(limit int) ([]map[string]int
 	var rows []map[string]interface{}
 	var err error
 
-	if IsQuotaDataAvailable() {
+	thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Unix()
+	excludeSQL, excludeArgs := roleExclusionClause(s.db, "user_id")
+	rollup := NewAnalyticsRollupService()
+	if rollup.Covers(context.Background(), thirtyDaysAgo) {
+		// Fastest path: local hourly rollups maintained by the processor
+		rows, err = rollup.UserRanking(context.Background(), thirtyDaysAgo, "requests", limit)
+	} else if IsQuotaDataAvailable() {
 		// Fast path: aggregate from quota_data
 		query := s.db.RebindQuery(`
 			SELECT q.user_id,
@@ -73,31 +96,31 @@ func (s *LogAnalyticsService) GetUserRequestRanking(limit int) ([]map[string]int
 				COALESCE(SUM(q.quota), 0) as quota_used
 			FROM quota_data q
 			LEFT JOIN users u ON q.user_id = u.id
-			WHERE q.user_id > 0
+			WHERE q.user_id > 0` + excludeSQL + `
 			GROUP BY q.user_id, u.username
 			ORDER BY request_count DESC
 			LIMIT ?`)
-		rows, err = s.db.QueryWithTimeout(30*time.Second, query, limit)
+		rows, err = s.db.QueryWithTimeout(30*time.Second, query, append(excludeArgs, limit)...)
 	} else {
 		// Fallback: scan logs with 30-day filter
-		thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Unix()
 		query := s.logDB.RebindQuery(`
 			SELECT l.user_id,
 				COALESCE(l.username, '') as username,
 				COUNT(*) as request_count,
 				COALESCE(SUM(l.quota), 0) as quota_used
 			FROM logs l
-			WHERE l.type IN (2, 5) AND l.user_id > 0 AND l.created_at >= ?
+			WHERE l.type IN (` + ltRequests() + `) AND l.user_id > 0 AND l.created_at >= ?` + excludeSQL + `
 			GROUP BY l.user_id, l.username
 			ORDER BY request_count DESC
 			LIMIT ?`)
-		rows, err = s.logDB.QueryWithTimeout(30*time.Second, query, thirtyDaysAgo, limit)
+		args := append([]interface{}{thirtyDaysAgo}, excludeArgs...)
+		rows, err = s.logDB.QueryWithTimeout(30*time.Second, query, append(args, limit)...)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	cm.Set("analytics:user_request_ranking", rows, 5*time.Minute)
+	cm.Set(cache.Key("analytics:user_request_ranking"), rows, scaledTTL(5*time.Minute))
 	return rows, nil
 }
 
@@ -105,7 +128,7 @@ func (s *LogAnalyticsService) GetUserRequestRanking(limit int) ([]map[string]int
 func (s *LogAnalyticsService) GetUserQuotaRanking(limit int) ([]map[string]interface{}, error) {
 	cm := cache.Get()
 	var cached []map[string]interface{}
-	found, _ := cm.GetJSON("analytics:user_quota_ranking", &cached)
+	found, _ := cm.GetJSON(cache.Key("analytics:user_quota_ranking"), &cached)
 	if found && len(cached) > 0 {
 		if limit > 0 && limit < len(cached) {
 			return cached[:limit], nil
@@ -116,7 +139,13 @@ func (s *LogAnalyticsService) GetUserQuotaRanking(limit int) ([]map[string]inter
 	var rows []map[string]interface{}
 	var err error
 
-	if IsQuotaDataAvailable() {
+	thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Unix()
+	excludeSQL, excludeArgs := roleExclusionClause(s.db, "user_id")
+	rollup := NewAnalyticsRollupService()
+	if rollup.Covers(context.Background(), thirtyDaysAgo) {
+		// Fastest path: local hourly rollups maintained by the processor
+		rows, err = rollup.UserRanking(context.Background(), thirtyDaysAgo, "quota", limit)
+	} else if IsQuotaDataAvailable() {
 		query := s.db.RebindQuery(`
 			SELECT q.user_id,
 				COALESCE(u.username, '') as username,
@@ -124,30 +153,30 @@ func (s *LogAnalyticsService) GetUserQuotaRanking(limit int) ([]map[string]inter
 				COALESCE(SUM(q.quota), 0) as quota_used
 			FROM quota_data q
 			LEFT JOIN users u ON q.user_id = u.id
-			WHERE q.user_id > 0
+			WHERE q.user_id > 0` + excludeSQL + `
 			GROUP BY q.user_id, u.username
 			ORDER BY quota_used DESC
 			LIMIT ?`)
-		rows, err = s.db.QueryWithTimeout(30*time.Second, query, limit)
+		rows, err = s.db.QueryWithTimeout(30*time.Second, query, append(excludeArgs, limit)...)
 	} else {
-		thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Unix()
 		query := s.logDB.RebindQuery(`
 			SELECT l.user_id,
 				COALESCE(l.username, '') as username,
 				COUNT(*) as request_count,
 				COALESCE(SUM(l.quota), 0) as quota_used
 			FROM logs l
-			WHERE l.type IN (2, 5) AND l.user_id > 0 AND l.created_at >= ?
+			WHERE l.type IN (` + ltRequests() + `) AND l.user_id > 0 AND l.created_at >= ?` + excludeSQL + `
 			GROUP BY l.user_id, l.username
 			ORDER BY quota_used DESC
 			LIMIT ?`)
-		rows, err = s.logDB.QueryWithTimeout(30*time.Second, query, thirtyDaysAgo, limit)
+		args := append([]interface{}{thirtyDaysAgo}, excludeArgs...)
+		rows, err = s.logDB.QueryWithTimeout(30*time.Second, query, append(args, limit)...)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	cm.Set("analytics:user_quota_ranking", rows, 5*time.Minute)
+	cm.Set(cache.Key("analytics:user_quota_ranking"), rows, scaledTTL(5*time.Minute))
 	return rows, nil
 }
 
@@ -155,7 +184,7 @@ func (s *LogAnalyticsService) GetUserQuotaRanking(limit int) ([]map[string]inter
 func (s *LogAnalyticsService) GetModelStatistics(limit int) ([]map[string]interface{}, error) {
 	cm := cache.Get()
 	var cached []map[string]interface{}
-	found, _ := cm.GetJSON("analytics:model_statistics", &cached)
+	found, _ := cm.GetJSON(cache.Key("analytics:model_statistics"), &cached)
 	if found && len(cached) > 0 {
 		if limit > 0 && limit < len(cached) {
 			return cached[:limit], nil
@@ -164,43 +193,31 @@ func (s *LogAnalyticsService) GetModelStatistics(limit int) ([]map[string]interf
 	}
 
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Unix()
-	query := s.logDB.RebindQuery(`
-		SELECT model_name,
-			COUNT(*) as total_requests,
-			SUM(CASE WHEN type = 2 THEN 1 ELSE 0 END) as success_count,
-			SUM(CASE WHEN type = 5 THEN 1 ELSE 0 END) as failure_count,
-			SUM(CASE WHEN type = 2 AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count
-		FROM logs
-		WHERE type IN (2, 5) AND model_name != '' AND created_at >= ?
-		GROUP BY model_name
-		ORDER BY total_requests DESC
-		LIMIT ?`)
-
-	rows, err := s.logDB.QueryWithTimeout(30*time.Second, query, thirtyDaysAgo, limit)
+	var rows []map[string]interface{}
+	var err error
+	rollup := NewAnalyticsRollupService()
+	if rollup.Covers(context.Background(), thirtyDaysAgo) {
+		rows, err = rollup.ModelStatistics(context.Background(), thirtyDaysAgo, limit)
+	} else {
+		query := s.logDB.RebindQuery(`
+			SELECT model_name,
+				COUNT(*) as total_requests,
+				SUM(CASE WHEN type = ` + ltConsume() + ` THEN 1 ELSE 0 END) as success_count,
+				SUM(CASE WHEN type = ` + ltError() + ` THEN 1 ELSE 0 END) as failure_count,
+				SUM(CASE WHEN type = ` + ltConsume() + ` AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count
+			FROM logs
+			WHERE type IN (` + ltRequests() + `) AND model_name != '' AND created_at >= ?
+			GROUP BY model_name
+			ORDER BY total_requests DESC
+			LIMIT ?`)
+		rows, err = s.logDB.QueryWithTimeout(30*time.Second, query, thirtyDaysAgo, limit)
+	}
 	if err != nil {
 		return nil, err
 	}
+	fillModelRates(rows)
 
-	// Calculate success_rate and empty_rate
-	for _, row := range rows {
-		total := toInt64(row["total_requests"])
-		success := toInt64(row["success_count"])
-		empty := toInt64(row["empty_count"])
-
-		successRate := float64(0)
-		if total > 0 {
-			successRate = float64(success) / float64(total) * 100
-		}
-		emptyRate := float64(0)
-		if success > 0 {
-			emptyRate = float64(empty) / float64(success) * 100
-		}
-
-		row["success_rate"] = math.Round(successRate*100) / 100
-		row["empty_rate"] = math.Round(emptyRate*100) / 100
-	}
-
-	cm.Set("analytics:model_statistics", rows, 5*time.Minute)
+	cm.Set(cache.Key("analytics:model_statistics"), rows, scaledTTL(5*time.Minute))
 	return rows, nil
 }
 
@@ -232,85 +249,128 @@ func (s *LogAnalyticsService) GetSummary() (map[string]interface{}, error) {
 	}, nil
 }
 
-// ProcessLogs clears caches and returns actual total count
-// In Go implementation, data is queried live from DB — "processing" means refreshing cache
+// ProcessLogs folds new logs into the local rollup / ip_history tables (one
+// short round) and clears the analytics caches
 func (s *LogAnalyticsService) ProcessLogs() (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	sync := s.SyncIncremental(ctx, 10)
 	s.clearAllCaches()
 
-	// Get actual counts to return meaningful response
-	total, maxID := s.getLogsApproxStats()
-
-	logger.L.Business(fmt.Sprintf("日志分析处理完成，共 %d 条日志", total))
+	rollup := sync.Rollups
+	if rollup == nil {
+		rollup = &LogCursorSyncResult{}
+	}
+	logger.L.Business(fmt.Sprintf("日志分析处理完成，本轮 %d 条日志，游标 %d/%d", rollup.Processed, rollup.LastLogID, rollup.MaxLogID))
 
 	return map[string]interface{}{
 		"success":        true,
-		"processed":      total,
-		"message":        "Analytics cache refreshed, data will reload on next query",
-		"last_log_id":    maxID,
+		"processed":      rollup.Processed,
+		"message":        "Analytics rollups updated",
+		"last_log_id":    rollup.LastLogID,
 		"users_updated":  0,
 		"models_updated": 0,
+		"completed":      rollup.Completed,
+		"ip_history":     sync.IPHistory,
+		"errors":         sync.Errors,
 	}, nil
 }
 
-// BatchProcess clears caches and returns completion status
-// Since Go queries DB directly (no incremental state), batch process just refreshes everything
+// BatchProcess runs up to maxIterations rollup batches (used by the
+// frontend's initial sync loop, which calls it until completed)
 func (s *LogAnalyticsService) BatchProcess(maxIterations int) (map[string]interface{}, error) {
 	if maxIterations <= 0 {
 		maxIterations = defaultMaxIterations
 	}
 
 	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	sync := s.SyncIncremental(ctx, maxIterations)
 	s.clearAllCaches()
-
-	// Get total log count for progress reporting
-	total, maxID := s.getLogsApproxStats()
+	if sync.Rollups == nil {
+		return nil, fmt.Errorf("rollup sync failed: %s", strings.Join(sync.Errors, "; "))
+	}
+	rollup := sync.Rollups
 
 	elapsed := time.Since(start).Seconds()
 	logsPerSec := float64(0)
 	if elapsed > 0 {
-		logsPerSec = float64(total) / elapsed
+		logsPerSec = float64(rollup.Processed) / elapsed
 	}
+	status, _ := s.GetSyncStatus()
 
 	return map[string]interface{}{
 		"success":          true,
-		"total_processed":  total,
-		"iterations":       1,
-		"batch_size":       defaultBatchSize,
+		"total_processed":  rollup.Processed,
+		"iterations":       rollup.Batches,
+		"batch_size":       scaleBatchSize(),
 		"elapsed_seconds":  math.Round(elapsed*100) / 100,
 		"logs_per_second":  math.Round(logsPerSec*10) / 10,
-		"progress_percent": 100.0,
-		"remaining_logs":   0,
-		"last_log_id":      maxID,
-		"completed":        true,
-		"timed_out":        false,
+		"progress_percent": status["progress_percent"],
+		"remaining_logs":   rollup.MaxLogID - rollup.LastLogID,
+		"last_log_id":      rollup.LastLogID,
+		"completed":        rollup.Completed,
+		"timed_out":        ctx.Err() != nil,
+		"ip_history":       sync.IPHistory,
 	}, nil
 }
 
-// ResetAnalytics clears all analytics caches
+// ResetAnalytics clears the analytics caches, rollups and ip_history
 func (s *LogAnalyticsService) ResetAnalytics() error {
 	s.clearAllCaches()
+	ctx := context.Background()
+	if err := NewAnalyticsRollupService().Reset(ctx); err != nil {
+		return err
+	}
+	if err := NewIPHistoryService().Reset(ctx); err != nil {
+		return err
+	}
 	logger.L.Business("分析数据已重置")
 	return nil
 }
 
-// GetSyncStatus returns sync status matching frontend SyncStatus interface
+// GetSyncStatus returns sync status matching frontend SyncStatus interface,
+// derived from the rollup cursor
 func (s *LogAnalyticsService) GetSyncStatus() (map[string]interface{}, error) {
-	// Since Go queries DB directly, we are always "synced"
 	total, maxID := s.getLogsApproxStats()
+	st, err := NewAnalyticsRollupService().GetState(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	started := st.StartLogID > 0 || st.LastLogID > 0
+	remaining := maxID - st.LastLogID
+	if !started || remaining < 0 {
+		remaining = 0
+	}
+	progress := 100.0
+	if span := maxID - st.StartLogID; started && span > 0 {
+		progress = math.Round(float64(st.LastLogID-st.StartLogID)/float64(span)*1000) / 10
+	}
+	if !started && maxID > 0 {
+		progress = 0
+	}
+	backfilled := st.SyncedAt > 0
 
+	var initCutoff interface{}
+	if started {
+		initCutoff = st.StartLogID
+	}
 	return map[string]interface{}{
-		"last_log_id":        maxID,
+		"last_log_id":        st.LastLogID,
 		"max_log_id":         maxID,
-		"init_cutoff_id":     nil,
+		"init_cutoff_id":     initCutoff,
 		"total_logs_in_db":   total,
-		"total_processed":    total,
-		"progress_percent":   100.0,
-		"remaining_logs":     0,
-		"is_synced":          true,
-		"is_initializing":    false,
-		"needs_initial_sync": false,
-		"data_inconsistent":  false,
-		"needs_reset":        false,
+		"total_processed":    st.LastLogID - st.StartLogID,
+		"progress_percent":   progress,
+		"remaining_logs":     remaining,
+		"is_synced":          backfilled && remaining == 0,
+		"is_initializing":    started && !backfilled,
+		"needs_initial_sync": !started && maxID > 0,
+		"data_inconsistent":  st.LastLogID > maxID,
+		"needs_reset":        st.LastLogID > maxID,
+		"rollup":             st,
 	}, nil
 }
 
@@ -321,13 +381,31 @@ func (s *LogAnalyticsService) CheckDataConsistency(autoReset bool) (map[string]i
 		return nil, err
 	}
 
-	// Since Go queries DB directly, data is always consistent
+	// The only inconsistency the rollups can have is a cursor past MAX(id),
+	// i.e. the logs table was truncated or restored
+	inconsistent, _ := syncStatus["data_inconsistent"].(bool)
+	if !inconsistent {
+		return map[string]interface{}{
+			"consistent":        true,
+			"reset":             false,
+			"message":           "Data is consistent",
+			"data_inconsistent": false,
+			"needs_reset":       false,
+			"details":           syncStatus,
+		}, nil
+	}
+	if autoReset {
+		if err := s.ResetAnalytics(); err != nil {
+			return nil, err
+		}
+		syncStatus, _ = s.GetSyncStatus()
+	}
 	return map[string]interface{}{
-		"consistent":        true,
-		"reset":             false,
-		"message":           "Data is consistent (Go backend queries DB directly)",
-		"data_inconsistent": false,
-		"needs_reset":       false,
+		"consistent":        false,
+		"reset":             autoReset,
+		"message":           "Rollup cursor is ahead of the logs table",
+		"data_inconsistent": !autoReset,
+		"needs_reset":       !autoReset,
 		"details":           syncStatus,
 	}, nil
 }
@@ -335,11 +413,12 @@ func (s *LogAnalyticsService) CheckDataConsistency(autoReset bool) (map[string]i
 // clearAllCaches removes all analytics-related caches
 func (s *LogAnalyticsService) clearAllCaches() {
 	cm := cache.Get()
-	cm.Delete("analytics:state")
-	cm.Delete("analytics:user_request_ranking")
-	cm.Delete("analytics:user_quota_ranking")
-	cm.Delete("analytics:model_statistics")
+	cm.Delete(cache.Key("analytics:state"))
+	cm.Delete(cache.Key("analytics:user_request_ranking"))
+	cm.Delete(cache.Key("analytics:user_quota_ranking"))
+	cm.Delete(cache.Key("analytics:model_statistics"))
 	cm.Delete(analyticsStatePrefix)
+	PublishEvent(EventCacheInvalidated, map[string]interface{}{"scope": "analytics"})
 }
 
 // getLogsApproxStats returns the approximate logs row count and the exact max id.
@@ -365,3 +444,54 @@ func (s *LogAnalyticsService) getLogsApproxStats() (total int64, maxID int64) {
 	}
 	return
 }
+
+// IncrementalSyncResult is the outcome of one SyncIncremental round
+type IncrementalSyncResult struct {
+	Rollups   *LogCursorSyncResult `json:"rollups"`
+	IPHistory *LogCursorSyncResult `json:"ip_history"`
+	Backfill  *RollupBackfillJob   `json:"backfill,omitempty"` // 未完成的历史回填任务（若有）
+	Errors    []string             `json:"errors,omitempty"`
+}
+
+// SyncIncremental advances every cursor-fed local table (rollups, ip_history)
+// by up to maxBatches batches. Failures are logged and reported per table.
+func (s *LogAnalyticsService) SyncIncremental(ctx context.Context, maxBatches int) IncrementalSyncResult {
+	var out IncrementalSyncResult
+	var err error
+	if out.Rollups, err = NewAnalyticsRollupService().Sync(ctx, maxBatches); err != nil {
+		out.Rollups = nil
+		out.Errors = append(out.Errors, "rollups: "+err.Error())
+		logger.L.Warn("[分析汇总] 同步失败: "+err.Error(), logger.CatAnalytics)
+	}
+	if out.IPHistory, err = NewIPHistoryService().SyncIPHistory(ctx, maxBatches); err != nil {
+		out.IPHistory = nil
+		out.Errors = append(out.Errors, "ip_history: "+err.Error())
+		logger.L.Warn("[IP历史] 同步失败: "+err.Error(), logger.CatAnalytics)
+	}
+	if out.Backfill, err = NewAnalyticsRollupService().RunBackfill(ctx, maxBatches); err != nil && !errors.Is(err, ErrRollupBackfillRunning) {
+		out.Errors = append(out.Errors, "backfill: "+err.Error())
+		logger.L.Warn("[分析汇总] 历史回填失败: "+err.Error(), logger.CatAnalytics)
+	}
+	return out
+}
+
+// fillModelRates adds success_rate and empty_rate to model statistics rows
+func fillModelRates(rows []map[string]interface{}) {
+	for _, row := range rows {
+		total := toInt64(row["total_requests"])
+		success := toInt64(row["success_count"])
+		empty := toInt64(row["empty_count"])
+
+		successRate := float64(0)
+		if total > 0 {
+			successRate = float64(success) / float64(total) * 100
+		}
+		emptyRate := float64(0)
+		if success > 0 {
+			emptyRate = float64(empty) / float64(success) * 100
+		}
+
+		row["success_rate"] = math.Round(successRate*100) / 100
+		row["empty_rate"] = math.Round(emptyRate*100) / 100
+	}
+}
@@ -0,0 +1,613 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const logArchiveSettingsKey = "log_archive"
+
+// Log archive storage backends
+const (
+	LogArchiveStorageS3    = "s3"
+	LogArchiveStorageLocal = "local" // 本地磁盘，默认 DATA_DIR/log-archives
+)
+
+var (
+	ErrLogArchiveRunning       = errors.New("log archive run already in progress")
+	ErrLogArchiveNotConfigured = errors.New("log archive storage is not configured")
+	ErrInvalidLogArchiveConfig = errors.New("invalid log archive config")
+)
+
+// LogArchiveSettings S3 兼容对象存储归档配置
+type LogArchiveSettings struct {
+	Enabled          bool   `json:"enabled"` // 定时归档；开启后数据保留只删除已归档的日志
+	Storage          string `json:"storage"` // s3 | local
+	LocalDir         string `json:"local_dir"`
+	Endpoint         string `json:"endpoint"`
+	Region           string `json:"region"`
+	Bucket           string `json:"bucket"`
+	Prefix           string `json:"prefix"`
+	AccessKeyID      string `json:"access_key_id"`
+	SecretAccessKey  string `json:"secret_access_key,omitempty"` // 仅存储，接口返回时清空
+	HasSecret        bool   `json:"has_secret"`
+	PathStyle        bool   `json:"path_style"`
+	ArchiveAfterDays int    `json:"archive_after_days"` // 早于该天数的日志才会归档
+	RowsPerFile      int    `json:"rows_per_file"`
+	MaxFilesPerRun   int    `json:"max_files_per_run"`
+	IntervalHours    int    `json:"interval_hours"`
+	UpdatedAt        int64  `json:"updated_at"`
+}
+
+// LogArchiveSettingsInput supports partial update of LogArchiveSettings.
+// For SecretAccessKey: nil = unchanged, empty string = clear.
+type LogArchiveSettingsInput struct {
+	Enabled          *bool   `json:"enabled"`
+	Storage          *string `json:"storage"`
+	LocalDir         *string `json:"local_dir"`
+	Endpoint         *string `json:"endpoint"`
+	Region           *string `json:"region"`
+	Bucket           *string `json:"bucket"`
+	Prefix           *string `json:"prefix"`
+	AccessKeyID      *string `json:"access_key_id"`
+	SecretAccessKey  *string `json:"secret_access_key"`
+	PathStyle        *bool   `json:"path_style"`
+	ArchiveAfterDays *int    `json:"archive_after_days"`
+	RowsPerFile      *int    `json:"rows_per_file"`
+	MaxFilesPerRun   *int    `json:"max_files_per_run"`
+	IntervalHours    *int    `json:"interval_hours"`
+}
+
+// LogArchive is one archived file in the manifest
+type LogArchive struct {
+	ID           int64  `json:"id"`
+	Storage      string `json:"storage"` // s3 | local
+	ObjectKey    string `json:"object_key"`
+	FirstLogID   int64  `json:"first_log_id"`
+	LastLogID    int64  `json:"last_log_id"`
+	MinCreatedAt int64  `json:"min_created_at"`
+	MaxCreatedAt int64  `json:"max_created_at"`
+	Rows         int64  `json:"rows"`
+	Bytes        int64  `json:"bytes"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// LogArchiveRun is the state of the current or last archive run
+type LogArchiveRun struct {
+	Running    bool   `json:"running"`
+	Trigger    string `json:"trigger"` // schedule | manual
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt int64  `json:"finished_at"`
+	Cutoff     int64  `json:"cutoff"`
+	TargetID   int64  `json:"target_log_id"` // 本轮要归档到的最大日志 id
+	LastLogID  int64  `json:"last_log_id"`   // 已归档到的日志 id
+	Files      int    `json:"files"`
+	Rows       int64  `json:"rows"`
+	Bytes      int64  `json:"bytes"`
+	Remaining  bool   `json:"remaining"` // 达到单次文件上限，下次继续
+	Error      string `json:"error,omitempty"`
+}
+
+// LogArchiveService exports old NewAPI logs, by ascending id range, as
+// gzipped JSON Lines objects to an S3-compatible bucket or a local directory
+// and records each object in a local manifest. Export never deletes; pruning
+// stays with the retention policies, which only prune archived ids while the
+// scheduled archive is enabled.
+type LogArchiveService struct {
+	logDB *database.Manager
+}
+
+var logArchiveState struct {
+	sync.Mutex
+	run LogArchiveRun
+}
+
+// NewLogArchiveService creates a LogArchiveService on the primary instance
+func NewLogArchiveService() *LogArchiveService {
+	return &LogArchiveService{logDB: database.GetLog()}
+}
+
+func defaultLogArchiveSettings() LogArchiveSettings {
+	return LogArchiveSettings{
+		Region:           "us-east-1",
+		Prefix:           "newapi-logs/",
+		ArchiveAfterDays: 30,
+		RowsPerFile:      50000,
+		MaxFilesPerRun:   20,
+		IntervalHours:    24,
+	}
+}
+
+func normalizeLogArchiveSettings(s *LogArchiveSettings) error {
+	s.Endpoint = strings.TrimRight(strings.TrimSpace(s.Endpoint), "/")
+	s.Storage = strings.ToLower(strings.TrimSpace(s.Storage))
+	if s.Storage == "" {
+		// 早期配置只有 S3：填过 endpoint 的保持 S3，否则默认本地磁盘
+		s.Storage = LogArchiveStorageLocal
+		if s.Endpoint != "" {
+			s.Storage = LogArchiveStorageS3
+		}
+	}
+	if s.Storage != LogArchiveStorageS3 && s.Storage != LogArchiveStorageLocal {
+		return fmt.Errorf("%w: storage 只能是 s3 或 local", ErrInvalidLogArchiveConfig)
+	}
+	s.LocalDir = strings.TrimSpace(s.LocalDir)
+	s.Region = strings.TrimSpace(s.Region)
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	s.Bucket = strings.TrimSpace(s.Bucket)
+	s.Prefix = strings.TrimLeft(strings.TrimSpace(s.Prefix), "/")
+	if s.Prefix != "" && !strings.HasSuffix(s.Prefix, "/") {
+		s.Prefix += "/"
+	}
+	s.AccessKeyID = strings.TrimSpace(s.AccessKeyID)
+	s.ArchiveAfterDays = clampSetting(s.ArchiveAfterDays, 1, 3650, 30)
+	s.RowsPerFile = clampSetting(s.RowsPerFile, 1000, 500000, 50000)
+	s.MaxFilesPerRun = clampSetting(s.MaxFilesPerRun, 1, 1000, 20)
+	s.IntervalHours = clampSetting(s.IntervalHours, 1, 168, 24)
+	if s.Endpoint != "" {
+		if _, err := newS3Client(s.Endpoint, s.Region, s.Bucket, "", "", s.PathStyle); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLogArchiveConfig, err)
+		}
+	}
+	s.HasSecret = s.SecretAccessKey != ""
+	if s.Enabled && !s.Ready() {
+		return fmt.Errorf("%w: endpoint、bucket 与访问密钥填写完整后才能开启定时归档", ErrInvalidLogArchiveConfig)
+	}
+	return nil
+}
+
+// Ready reports whether the storage is usable; local storage always is
+func (s LogArchiveSettings) Ready() bool {
+	if s.Storage == LogArchiveStorageLocal {
+		return true
+	}
+	return s.Endpoint != "" && s.Bucket != "" && s.AccessKeyID != "" && s.HasSecret
+}
+
+// localArchiveDir is LocalDir or DATA_DIR/log-archives
+func (s LogArchiveSettings) localArchiveDir() string {
+	if s.LocalDir != "" {
+		return s.LocalDir
+	}
+	dataDir := strings.TrimSpace(config.Get().DataDir)
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return filepath.Join(dataDir, "log-archives")
+}
+
+// view hides the secret from API responses
+func (s LogArchiveSettings) view() LogArchiveSettings {
+	s.HasSecret = s.SecretAccessKey != ""
+	s.SecretAccessKey = ""
+	return s
+}
+
+func (s *LogArchiveService) loadSettings(ctx context.Context) (LogArchiveSettings, error) {
+	settings := defaultLogArchiveSettings()
+	if _, err := loadLocalSetting(ctx, logArchiveSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeLogArchiveSettings(&settings); err != nil {
+		settings.Enabled = false
+	}
+	return settings, nil
+}
+
+// GetSettings returns the archive settings without the secret
+func (s *LogArchiveService) GetSettings(ctx context.Context) (LogArchiveSettings, error) {
+	settings, err := s.loadSettings(ctx)
+	return settings.view(), err
+}
+
+// UpdateSettings applies a partial update
+func (s *LogArchiveService) UpdateSettings(ctx context.Context, in LogArchiveSettingsInput) (LogArchiveSettings, error) {
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return settings.view(), err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Storage != nil {
+		settings.Storage = *in.Storage
+	}
+	if in.LocalDir != nil {
+		settings.LocalDir = *in.LocalDir
+	}
+	if in.Endpoint != nil {
+		settings.Endpoint = *in.Endpoint
+	}
+	if in.Region != nil {
+		settings.Region = *in.Region
+	}
+	if in.Bucket != nil {
+		settings.Bucket = *in.Bucket
+	}
+	if in.Prefix != nil {
+		settings.Prefix = *in.Prefix
+	}
+	if in.AccessKeyID != nil {
+		settings.AccessKeyID = *in.AccessKeyID
+	}
+	if in.SecretAccessKey != nil {
+		settings.SecretAccessKey = *in.SecretAccessKey
+	}
+	if in.PathStyle != nil {
+		settings.PathStyle = *in.PathStyle
+	}
+	if in.ArchiveAfterDays != nil {
+		settings.ArchiveAfterDays = *in.ArchiveAfterDays
+	}
+	if in.RowsPerFile != nil {
+		settings.RowsPerFile = *in.RowsPerFile
+	}
+	if in.MaxFilesPerRun != nil {
+		settings.MaxFilesPerRun = *in.MaxFilesPerRun
+	}
+	if in.IntervalHours != nil {
+		settings.IntervalHours = *in.IntervalHours
+	}
+	if err := normalizeLogArchiveSettings(&settings); err != nil {
+		return settings.view(), err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, logArchiveSettingsKey, settings); err != nil {
+		return settings.view(), err
+	}
+	return settings.view(), nil
+}
+
+// logArchiveSink stores one archive object; implemented by *s3Client and
+// localArchiveSink
+type logArchiveSink interface {
+	PutObject(ctx context.Context, key string, body []byte, contentType string) error
+	ListObjects(ctx context.Context, prefix string, maxKeys int) ([]s3Object, error)
+}
+
+func (s *LogArchiveService) sink(settings LogArchiveSettings) (logArchiveSink, error) {
+	if !settings.Ready() {
+		return nil, ErrLogArchiveNotConfigured
+	}
+	if settings.Storage == LogArchiveStorageLocal {
+		return localArchiveSink{dir: settings.localArchiveDir()}, nil
+	}
+	return newS3Client(settings.Endpoint, settings.Region, settings.Bucket, settings.AccessKeyID, settings.SecretAccessKey, settings.PathStyle)
+}
+
+// localArchiveSink writes objects under dir, keyed like the S3 layout
+type localArchiveSink struct {
+	dir string
+}
+
+// PutObject writes through a temp file and renames it, so a crash never
+// leaves a truncated archive behind a manifest entry
+func (l localArchiveSink) PutObject(_ context.Context, key string, body []byte, _ string) error {
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ListObjects lists up to maxKeys files under prefix
+func (l localArchiveSink) ListObjects(_ context.Context, prefix string, maxKeys int) ([]s3Object, error) {
+	if err := os.MkdirAll(l.dir, 0750); err != nil {
+		return nil, err
+	}
+	objects := []s3Object{}
+	errStop := errors.New("stop")
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(l.dir, path)
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, s3Object{Key: key, Size: info.Size(), LastModified: info.ModTime().UTC().Format(time.RFC3339)})
+		if len(objects) >= maxKeys {
+			return errStop
+		}
+		return nil
+	})
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+	return objects, err
+}
+
+// TestConnection lists a few objects under the prefix to verify credentials
+// (or that the local directory is usable)
+func (s *LogArchiveService) TestConnection(ctx context.Context) ([]s3Object, error) {
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.sink(settings)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := c.ListObjects(ctx, settings.Prefix, 5)
+	if objects == nil {
+		objects = []s3Object{}
+	}
+	return objects, err
+}
+
+func ensureLogArchiveTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS log_archives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			storage TEXT NOT NULL DEFAULT 's3',
+			object_key TEXT NOT NULL,
+			first_log_id INTEGER NOT NULL,
+			last_log_id INTEGER NOT NULL,
+			min_created_at INTEGER NOT NULL DEFAULT 0,
+			max_created_at INTEGER NOT NULL DEFAULT 0,
+			rows INTEGER NOT NULL DEFAULT 0,
+			bytes INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_log_archives_last_log_id ON log_archives(last_log_id)`)
+	return err
+}
+
+// ListArchives returns the manifest, newest first, with totals
+func (s *LogArchiveService) ListArchives(ctx context.Context, limit, offset int) (map[string]interface{}, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureLogArchiveTables(ctx, db); err != nil {
+		return nil, err
+	}
+
+	var total, rowsTotal, bytesTotal, archivedUpTo int64
+	if err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(rows), 0), COALESCE(SUM(bytes), 0), COALESCE(MAX(last_log_id), 0)
+		FROM log_archives`).Scan(&total, &rowsTotal, &bytesTotal, &archivedUpTo); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, storage, object_key, first_log_id, last_log_id, min_created_at, max_created_at, rows, bytes, created_at
+		FROM log_archives ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LogArchive{}
+	for rows.Next() {
+		var a LogArchive
+		if err := rows.Scan(&a.ID, &a.Storage, &a.ObjectKey, &a.FirstLogID, &a.LastLogID,
+			&a.MinCreatedAt, &a.MaxCreatedAt, &a.Rows, &a.Bytes, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, a)
+	}
+	return map[string]interface{}{
+		"items":          items,
+		"total":          total,
+		"rows":           rowsTotal,
+		"bytes":          bytesTotal,
+		"archived_up_to": archivedUpTo,
+	}, rows.Err()
+}
+
+// GetRun returns the live or last archive run
+func (s *LogArchiveService) GetRun() LogArchiveRun {
+	logArchiveState.Lock()
+	defer logArchiveState.Unlock()
+	return logArchiveState.run
+}
+
+func (s *LogArchiveService) update(fn func(r *LogArchiveRun)) {
+	logArchiveState.Lock()
+	fn(&logArchiveState.run)
+	logArchiveState.Unlock()
+}
+
+// Run exports logs older than archive_after_days, continuing after the last
+// archived id, as at most max_files_per_run objects of rows_per_file rows
+func (s *LogArchiveService) Run(ctx context.Context, trigger string) (LogArchiveRun, error) {
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return LogArchiveRun{}, err
+	}
+	c, err := s.sink(settings)
+	if err != nil {
+		return LogArchiveRun{}, err
+	}
+
+	logArchiveState.Lock()
+	if logArchiveState.run.Running {
+		logArchiveState.Unlock()
+		return LogArchiveRun{}, ErrLogArchiveRunning
+	}
+	logArchiveState.run = LogArchiveRun{
+		Running:   true,
+		Trigger:   trigger,
+		StartedAt: time.Now().Unix(),
+		Cutoff:    time.Now().AddDate(0, 0, -settings.ArchiveAfterDays).Unix(),
+	}
+	cutoff := logArchiveState.run.Cutoff
+	logArchiveState.Unlock()
+
+	err = s.export(ctx, c, settings, cutoff)
+	s.update(func(r *LogArchiveRun) {
+		r.Running = false
+		r.FinishedAt = time.Now().Unix()
+		if err != nil {
+			r.Error = err.Error()
+		}
+	})
+	run := s.GetRun()
+	if run.Files > 0 {
+		logger.L.System(fmt.Sprintf("[日志归档] 写入 %d 个文件，%d 行，归档至日志 #%d", run.Files, run.Rows, run.LastLogID))
+	}
+	return run, err
+}
+
+func (s *LogArchiveService) export(ctx context.Context, c logArchiveSink, settings LogArchiveSettings, cutoff int64) error {
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureLogArchiveTables(ctx, db); err != nil {
+		return err
+	}
+
+	var lastID int64
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(last_log_id), 0) FROM log_archives`).Scan(&lastID); err != nil {
+		return err
+	}
+	row, err := s.logDB.WithContext(ctx).QueryOneWithTimeout(60*time.Second, s.logDB.RebindQuery(
+		`SELECT COALESCE(MAX(id), 0) as max_id FROM logs WHERE created_at < ?`), cutoff)
+	if err != nil {
+		return fmt.Errorf("archive target query failed: %w", err)
+	}
+	targetID := toInt64(row["max_id"])
+	s.update(func(r *LogArchiveRun) { r.TargetID = targetID; r.LastLogID = lastID })
+
+	for files := 0; lastID < targetID; files++ {
+		if files >= settings.MaxFilesPerRun {
+			s.update(func(r *LogArchiveRun) { r.Remaining = true })
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		a, err := s.exportFile(ctx, c, settings, lastID, targetID)
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			return nil
+		}
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO log_archives (storage, object_key, first_log_id, last_log_id, min_created_at, max_created_at, rows, bytes, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.Storage, a.ObjectKey, a.FirstLogID, a.LastLogID, a.MinCreatedAt, a.MaxCreatedAt, a.Rows, a.Bytes, a.CreatedAt); err != nil {
+			return err
+		}
+		lastID = a.LastLogID
+		s.update(func(r *LogArchiveRun) {
+			r.Files++
+			r.Rows += a.Rows
+			r.Bytes += a.Bytes
+			r.LastLogID = lastID
+		})
+	}
+	return nil
+}
+
+// exportFile reads up to rows_per_file logs with id in (afterID, targetID]
+// in pages and stores them as one gzipped JSONL object. Returns nil when
+// the range holds no rows.
+func (s *LogArchiveService) exportFile(ctx context.Context, c logArchiveSink, settings LogArchiveSettings, afterID, targetID int64) (*LogArchive, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	a := &LogArchive{Storage: settings.Storage}
+
+	cursor := afterID
+	for a.Rows < int64(settings.RowsPerFile) && cursor < targetID {
+		page := settings.RowsPerFile - int(a.Rows)
+		if batch := int(scaleBatchSize()); page > batch {
+			page = batch
+		}
+		rows, err := s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(
+			`SELECT * FROM logs WHERE id > ? AND id <= ? ORDER BY id LIMIT ?`), cursor, targetID, page)
+		if err != nil {
+			return nil, fmt.Errorf("archive read failed: %w", err)
+		}
+		if len(rows) == 0 {
+			cursor = targetID
+			break
+		}
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+			created := toInt64(r["created_at"])
+			if a.MinCreatedAt == 0 || created < a.MinCreatedAt {
+				a.MinCreatedAt = created
+			}
+			if created > a.MaxCreatedAt {
+				a.MaxCreatedAt = created
+			}
+		}
+		if a.FirstLogID == 0 {
+			a.FirstLogID = toInt64(rows[0]["id"])
+		}
+		cursor = toInt64(rows[len(rows)-1]["id"])
+		a.Rows += int64(len(rows))
+		if len(rows) < page {
+			cursor = targetID
+		}
+	}
+	if a.Rows == 0 {
+		return nil, nil
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	// 本文件覆盖的 id 区间到 cursor 为止（含其中已不存在的 id），下一个文件从这里继续
+	a.LastLogID = cursor
+	a.Bytes = int64(buf.Len())
+	a.CreatedAt = time.Now().Unix()
+	a.ObjectKey = fmt.Sprintf("%slogs/%s/logs-%d-%d.jsonl.gz", settings.Prefix,
+		time.Unix(a.MinCreatedAt, 0).Format("2006/01"), a.FirstLogID, a.LastLogID)
+	if err := c.PutObject(ctx, a.ObjectKey, buf.Bytes(), "application/gzip"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// PruneLimit returns the highest log id retention may delete: while the
+// scheduled archive is enabled, logs are only pruned once they appear in the
+// manifest. ok is false when archiving is off and no limit applies.
+func (s *LogArchiveService) PruneLimit(ctx context.Context) (maxID int64, ok bool, err error) {
+	settings, err := s.loadSettings(ctx)
+	if err != nil || !settings.Enabled {
+		return 0, false, err
+	}
+	db, err := openLocalStore()
+	if err != nil {
+		return 0, false, err
+	}
+	defer db.Close()
+	if err := ensureLogArchiveTables(ctx, db); err != nil {
+		return 0, false, err
+	}
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(last_log_id), 0) FROM log_archives`).Scan(&maxID)
+	return maxID, err == nil, err
+}
@@ -0,0 +1,438 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+const (
+	archiveScanMaxFiles = 50
+	archiveScanMaxRows  = 2000000
+
+	// ArchivedDataLabel marks results that merge archived logs
+	ArchivedDataLabel = "includes archived data"
+)
+
+// openArchive opens one manifest entry for reading
+func (s *LogArchiveService) openArchive(ctx context.Context, settings LogArchiveSettings, a LogArchive) (io.ReadCloser, error) {
+	if a.Storage == LogArchiveStorageLocal {
+		return os.Open(filepath.Join(settings.localArchiveDir(), filepath.FromSlash(a.ObjectKey)))
+	}
+	if settings.Endpoint == "" || settings.Bucket == "" || settings.AccessKeyID == "" || settings.SecretAccessKey == "" {
+		return nil, ErrLogArchiveNotConfigured
+	}
+	c, err := newS3Client(settings.Endpoint, settings.Region, settings.Bucket, settings.AccessKeyID, settings.SecretAccessKey, settings.PathStyle)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetObject(ctx, a.ObjectKey)
+}
+
+// ScanArchived streams archived logs with created_at in [startTime, endTime]
+// (and user_id = userID when userID > 0) that are no longer in the live logs
+// table. At most archiveScanMaxFiles files / archiveScanMaxRows rows are read;
+// a file that cannot be read is reported in Errors and skipped.
+func (s *LogArchiveService) ScanArchived(ctx context.Context, startTime, endTime, userID int64, fn func(row map[string]interface{})) (*api.ArchivedLogScan, error) {
+	scan := &api.ArchivedLogScan{IncludesArchived: true, Label: ArchivedDataLabel}
+
+	row, err := s.logDB.WithContext(ctx).QueryOneWithTimeout(30*time.Second, `SELECT COALESCE(MIN(id), 0) as min_id FROM logs`)
+	if err != nil {
+		return nil, fmt.Errorf("live log range query failed: %w", err)
+	}
+	scan.LiveFromID = toInt64(row["min_id"])
+	if scan.LiveFromID == 0 {
+		// logs 表为空：归档中的全部行都已被清理
+		scan.LiveFromID = math.MaxInt64
+	}
+
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureLogArchiveTables(ctx, db); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, storage, object_key, first_log_id, last_log_id, rows
+		FROM log_archives
+		WHERE max_created_at >= ? AND min_created_at <= ? AND first_log_id < ?
+		ORDER BY first_log_id
+		LIMIT ?`, startTime, endTime, scan.LiveFromID, archiveScanMaxFiles+1)
+	if err != nil {
+		return nil, err
+	}
+	var archives []LogArchive
+	for rows.Next() {
+		var a LogArchive
+		if err := rows.Scan(&a.ID, &a.Storage, &a.ObjectKey, &a.FirstLogID, &a.LastLogID, &a.Rows); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(archives) > archiveScanMaxFiles {
+		archives = archives[:archiveScanMaxFiles]
+		scan.Truncated = true
+	}
+
+	for _, a := range archives {
+		if err := ctx.Err(); err != nil {
+			return scan, err
+		}
+		if scan.ScannedRows >= archiveScanMaxRows {
+			scan.Truncated = true
+			break
+		}
+		if err := s.scanArchive(ctx, settings, a, scan, startTime, endTime, userID, fn); err != nil {
+			scan.Errors = append(scan.Errors, fmt.Sprintf("%s: %v", a.ObjectKey, err))
+			continue
+		}
+		scan.Files++
+	}
+	return scan, nil
+}
+
+// emitPruned passes on the rows whose id is no longer in the logs table
+func (s *LogArchiveService) emitPruned(ctx context.Context, rows []map[string]interface{}, scan *api.ArchivedLogScan, fn func(row map[string]interface{})) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(rows))
+	for i, r := range rows {
+		ids[i] = toInt64(r["id"])
+	}
+	live, err := s.logDB.WithContext(ctx).QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(
+		fmt.Sprintf(`SELECT id FROM logs WHERE id IN (%s)`, placeholders(len(ids)))), ids...)
+	if err != nil {
+		return err
+	}
+	exists := make(map[int64]bool, len(live))
+	for _, r := range live {
+		exists[toInt64(r["id"])] = true
+	}
+	for _, r := range rows {
+		if !exists[toInt64(r["id"])] {
+			scan.MatchedRows++
+			fn(r)
+		}
+	}
+	return nil
+}
+
+func (s *LogArchiveService) scanArchive(ctx context.Context, settings LogArchiveSettings, a LogArchive, scan *api.ArchivedLogScan,
+	startTime, endTime, userID int64, fn func(row map[string]interface{})) error {
+	r, err := s.openArchive(ctx, settings, a)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	// ids at or above LiveFromID may still be live; check them in batches
+	var pending []map[string]interface{}
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if scan.ScannedRows >= archiveScanMaxRows {
+			scan.Truncated = true
+			break
+		}
+		scan.ScannedRows++
+		var row map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+			return err
+		}
+		created := toInt64(row["created_at"])
+		if created < startTime || created > endTime {
+			continue
+		}
+		if userID > 0 && toInt64(row["user_id"]) != userID {
+			continue
+		}
+		if toInt64(row["id"]) < scan.LiveFromID {
+			scan.MatchedRows++
+			fn(row)
+			continue
+		}
+		if pending = append(pending, row); len(pending) >= 500 {
+			if err := s.emitPruned(ctx, pending, scan, fn); err != nil {
+				return err
+			}
+			pending = pending[:0]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return s.emitPruned(ctx, pending, scan, fn)
+}
+
+// archivedUserTotals aggregates archived success/failure logs per user
+type archivedUserTotals struct {
+	username string
+	requests int64
+	quota    int64
+}
+
+// UserRankingWithArchive ranks users by requests or quota over the last
+// `days` days, merging the live logs with archived logs already pruned from
+// the logs table. Live candidates are fetched generously and users that only
+// rank through archived data get their live totals looked up exactly.
+func (s *LogAnalyticsService) UserRankingWithArchive(ctx context.Context, orderBy string, days, limit int) ([]map[string]interface{}, *api.ArchivedLogScan, error) {
+	now := time.Now().Unix()
+	startTime := time.Now().AddDate(0, 0, -days).Unix()
+
+	archived := map[int64]*archivedUserTotals{}
+	scan, err := NewLogArchiveService().ScanArchived(ctx, startTime, now, 0, func(row map[string]interface{}) {
+		if !isRequestLogType(toInt64(row["type"])) {
+			return
+		}
+		uid := toInt64(row["user_id"])
+		if uid <= 0 {
+			return
+		}
+		t := archived[uid]
+		if t == nil {
+			t = &archivedUserTotals{}
+			archived[uid] = t
+		}
+		if name := toString(row["username"]); name != "" {
+			t.username = name
+		}
+		t.requests++
+		t.quota += toInt64(row["quota"])
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order := "request_count DESC"
+	if orderBy == "quota" {
+		order = "quota_used DESC"
+	}
+	candidates := limit * 5
+	if candidates < 200 {
+		candidates = 200
+	} else if candidates > 1000 {
+		candidates = 1000
+	}
+	live, err := s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT l.user_id as user_id,
+			COALESCE(MAX(l.username), '') as username,
+			COUNT(*) as request_count,
+			COALESCE(SUM(l.quota), 0) as quota_used
+		FROM logs l
+		WHERE l.type IN (`+ltRequests()+`) AND l.user_id > 0 AND l.created_at >= ?
+		GROUP BY l.user_id
+		ORDER BY %s
+		LIMIT ?`, order)), startTime, candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := map[int64]map[string]interface{}{}
+	for _, r := range live {
+		merged[toInt64(r["user_id"])] = map[string]interface{}{
+			"user_id":       toInt64(r["user_id"]),
+			"username":      toString(r["username"]),
+			"request_count": toInt64(r["request_count"]),
+			"quota_used":    toInt64(r["quota_used"]),
+		}
+	}
+	// 只在归档中排名靠前的用户：补查其实时部分
+	var missing []interface{}
+	for uid := range archived {
+		if _, ok := merged[uid]; !ok {
+			missing = append(missing, uid)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		a, b := archived[missing[i].(int64)], archived[missing[j].(int64)]
+		if orderBy == "quota" {
+			return a.quota > b.quota
+		}
+		return a.requests > b.requests
+	})
+	if len(missing) > candidates {
+		missing = missing[:candidates]
+	}
+	for _, uid := range missing {
+		merged[uid.(int64)] = map[string]interface{}{"user_id": uid, "username": "", "request_count": int64(0), "quota_used": int64(0)}
+	}
+	for start := 0; start < len(missing); start += 500 {
+		end := start + 500
+		if end > len(missing) {
+			end = len(missing)
+		}
+		chunk := missing[start:end]
+		args := append(append([]interface{}{}, chunk...), startTime)
+		rows, err := s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+			SELECT user_id, COUNT(*) as request_count, COALESCE(SUM(quota), 0) as quota_used
+			FROM logs
+			WHERE user_id IN (%s) AND type IN (`+ltRequests()+`) AND created_at >= ?
+			GROUP BY user_id`, placeholders(len(chunk)))), args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, r := range rows {
+			if m := merged[toInt64(r["user_id"])]; m != nil {
+				m["request_count"] = toInt64(r["request_count"])
+				m["quota_used"] = toInt64(r["quota_used"])
+			}
+		}
+	}
+
+	out := make([]map[string]interface{}, 0, len(merged))
+	for uid, m := range merged {
+		m["archived_request_count"] = int64(0)
+		m["archived_quota_used"] = int64(0)
+		if t := archived[uid]; t != nil {
+			m["request_count"] = toInt64(m["request_count"]) + t.requests
+			m["quota_used"] = toInt64(m["quota_used"]) + t.quota
+			m["archived_request_count"] = t.requests
+			m["archived_quota_used"] = t.quota
+			if toString(m["username"]) == "" {
+				m["username"] = t.username
+			}
+		}
+		out = append(out, m)
+	}
+	key := "request_count"
+	if orderBy == "quota" {
+		key = "quota_used"
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := toInt64(out[i][key]), toInt64(out[j][key])
+		if a != b {
+			return a > b
+		}
+		return toInt64(out[i]["user_id"]) < toInt64(out[j]["user_id"])
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, scan, nil
+}
+
+// archivedUserStats accumulates the archived part of a per-user analysis
+type archivedUserStats struct {
+	total, success, failure, quota, prompt, completion, empty int64
+	ips, tokens, models, channels                             map[string]bool
+}
+
+func (a *archivedUserStats) add(row map[string]interface{}) {
+	t := toInt64(row["type"])
+	if !isRequestLogType(t) {
+		return
+	}
+	a.total++
+	if t == int64(logTypes().Consume) {
+		a.success++
+		if toInt64(row["completion_tokens"]) == 0 {
+			a.empty++
+		}
+	} else {
+		a.failure++
+	}
+	a.quota += toInt64(row["quota"])
+	a.prompt += toInt64(row["prompt_tokens"])
+	a.completion += toInt64(row["completion_tokens"])
+	addDistinct(&a.ips, row["ip"])
+	addDistinct(&a.tokens, row["token_id"])
+	addDistinct(&a.models, row["model_name"])
+	addDistinct(&a.channels, row["channel_id"])
+}
+
+func addDistinct(set *map[string]bool, v interface{}) {
+	if v == nil {
+		return
+	}
+	key := strings.TrimSpace(fmt.Sprintf("%v", v))
+	if key == "" {
+		return
+	}
+	if *set == nil {
+		*set = map[string]bool{}
+	}
+	(*set)[key] = true
+}
+
+func (a *archivedUserStats) summary() *api.ArchivedUserSummary {
+	return &api.ArchivedUserSummary{
+		TotalRequests:    a.total,
+		SuccessRequests:  a.success,
+		FailureRequests:  a.failure,
+		QuotaUsed:        a.quota,
+		PromptTokens:     a.prompt,
+		CompletionTokens: a.completion,
+		EmptyCount:       a.empty,
+		UniqueIPs:        int64(len(a.ips)),
+		UniqueTokens:     int64(len(a.tokens)),
+		UniqueModels:     int64(len(a.models)),
+		UniqueChannels:   int64(len(a.channels)),
+	}
+}
+
+// GetUserAnalysisWithArchive is GetUserAnalysis plus the user's archived logs
+// in the same window. Additive counters and rates in summary include the
+// archived rows; distinct counts can overlap between live and archived data,
+// so they are reported separately in archived_summary.
+func (s *RiskMonitoringService) GetUserAnalysisWithArchive(ctx context.Context, userID, windowSeconds int64, endTime *int64) (*api.UserAnalysis, error) {
+	result, err := s.GetUserAnalysis(userID, windowSeconds, endTime)
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now().Unix()
+	if endTime != nil {
+		end = *endTime
+	}
+	stats := &archivedUserStats{}
+	scan, err := NewLogArchiveService().ScanArchived(ctx, end-windowSeconds, end, userID, stats.add)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := stats.summary()
+	summary := &result.Summary
+	summary.TotalRequests += archived.TotalRequests
+	summary.SuccessRequests += archived.SuccessRequests
+	summary.FailureRequests += archived.FailureRequests
+	summary.QuotaUsed += archived.QuotaUsed
+	summary.PromptTokens += archived.PromptTokens
+	summary.CompletionTokens += archived.CompletionTokens
+	summary.EmptyCount += archived.EmptyCount
+	if summary.TotalRequests > 0 {
+		summary.FailureRate = float64(summary.FailureRequests) / float64(summary.TotalRequests)
+	}
+	if summary.SuccessRequests > 0 {
+		summary.EmptyRate = float64(summary.EmptyCount) / float64(summary.SuccessRequests)
+	}
+	result.ArchivedSummary = archived
+	result.Archive = scan
+	return result, nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+// fakeS3 stores PUT bodies of a path-style bucket in memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	if r.Method == http.MethodPut {
+		if r.Header.Get("x-amz-content-sha256") != sha256Hex(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.objects[strings.TrimPrefix(r.URL.Path, "/archive/")] = body
+		f.mu.Unlock()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestLogArchiveRunUploadsIDRangesAndResumes(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, model_name TEXT, created_at INTEGER)`)
+	now := time.Now().Unix()
+	for i := 0; i < 2500; i++ {
+		db.MustExec(`INSERT INTO logs (user_id, model_name, created_at) VALUES (1, 'gpt-4o', ?)`, now-60*86400+int64(i))
+	}
+	db.MustExec(`INSERT INTO logs (user_id, model_name, created_at) VALUES (1, 'gpt-4o', ?)`, now)
+
+	s3 := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc := NewLogArchiveService()
+	storage := LogArchiveStorageS3
+	if _, err := svc.UpdateSettings(ctx, LogArchiveSettingsInput{Storage: &storage}); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if _, err := svc.Run(ctx, "manual"); !errors.Is(err, ErrLogArchiveNotConfigured) {
+		t.Fatalf("unconfigured run should fail, got %v", err)
+	}
+
+	endpoint, bucket, key, secret, rows, files := srv.URL, "archive", "ak", "sk", 1000, 2
+	pathStyle := true
+	settings, err := svc.UpdateSettings(ctx, LogArchiveSettingsInput{
+		Endpoint: &endpoint, Bucket: &bucket, AccessKeyID: &key, SecretAccessKey: &secret,
+		PathStyle: &pathStyle, RowsPerFile: &rows, MaxFilesPerRun: &files,
+	})
+	if err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if settings.SecretAccessKey != "" || !settings.HasSecret {
+		t.Fatalf("secret must not be returned: %+v", settings)
+	}
+
+	run, err := svc.Run(ctx, "manual")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if run.Files != 2 || run.Rows != 2000 || !run.Remaining || run.TargetID != 2500 {
+		t.Fatalf("first run should stop after 2 files, got %+v", run)
+	}
+	if run, err = svc.Run(ctx, "manual"); err != nil || run.Files != 1 || run.LastLogID != 2500 || run.Remaining {
+		t.Fatalf("second run should finish the range, got %+v %v", run, err)
+	}
+
+	list, err := svc.ListArchives(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("ListArchives: %v", err)
+	}
+	items := list["items"].([]LogArchive)
+	if len(items) != 3 || list["rows"].(int64) != 2500 || list["archived_up_to"].(int64) != 2500 {
+		t.Fatalf("unexpected manifest: %+v", list)
+	}
+	if items[2].FirstLogID != 1 || items[2].LastLogID != 1000 || items[0].FirstLogID != 2001 {
+		t.Fatalf("archives should cover consecutive id ranges: %+v", items)
+	}
+
+	body := s3.objects[items[0].ObjectKey]
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("object %s is not gzip: %v", items[0].ObjectKey, err)
+	}
+	lines := 0
+	for sc := bufio.NewScanner(gz); sc.Scan(); {
+		lines++
+	}
+	if lines != 500 {
+		t.Fatalf("last object should hold 500 rows, got %d", lines)
+	}
+}
+
+func TestLogArchiveLocalStorageGuardsRetention(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	dataDir := t.TempDir()
+	t.Setenv("DATA_DIR", dataDir)
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, model_name TEXT, created_at INTEGER)`)
+	now := time.Now().Unix()
+	for i := 0; i < 1500; i++ {
+		db.MustExec(`INSERT INTO logs (user_id, model_name, created_at) VALUES (1, 'gpt-4o', ?)`, now-60*86400+int64(i))
+	}
+
+	ctx := context.Background()
+	svc := NewLogArchiveService()
+	enabled, rows, files := true, 1000, 1
+	settings, err := svc.UpdateSettings(ctx, LogArchiveSettingsInput{Enabled: &enabled, RowsPerFile: &rows, MaxFilesPerRun: &files})
+	if err != nil || settings.Storage != LogArchiveStorageLocal {
+		t.Fatalf("local storage should be the default, got %+v, %v", settings, err)
+	}
+	if limit, ok, err := svc.PruneLimit(ctx); err != nil || !ok || limit != 0 {
+		t.Fatalf("nothing archived yet: limit=%d ok=%v err=%v", limit, ok, err)
+	}
+
+	run, err := svc.Run(ctx, "manual")
+	if err != nil || run.Files != 1 || run.LastLogID != 1000 || !run.Remaining {
+		t.Fatalf("Run = %+v, %v", run, err)
+	}
+	list, _ := svc.ListArchives(ctx, 10, 0)
+	item := list["items"].([]LogArchive)[0]
+	if item.Storage != LogArchiveStorageLocal {
+		t.Fatalf("manifest should record local storage: %+v", item)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "log-archives", filepath.FromSlash(item.ObjectKey))); err != nil {
+		t.Fatalf("archive file missing: %v", err)
+	}
+
+	// retention only prunes what the manifest covers
+	retention := NewRetentionService()
+	on, ttl := true, 30
+	if _, err := retention.UpdateSettings(ctx, RetentionSettingsInput{
+		Enabled:  &on,
+		Policies: map[string]RetentionPolicy{RetentionTableLogs: {TTLDays: ttl, Action: RetentionActionDelete}},
+	}); err != nil {
+		t.Fatalf("retention UpdateSettings: %v", err)
+	}
+	if _, err := retention.Run(ctx, "manual"); err != nil {
+		t.Fatalf("retention Run: %v", err)
+	}
+	var left, minID int64
+	if err := db.QueryRow(`SELECT COUNT(*), MIN(id) FROM logs`).Scan(&left, &minID); err != nil {
+		t.Fatal(err)
+	}
+	if left != 500 || minID != 1001 {
+		t.Fatalf("only archived logs should be pruned, left %d rows from id %d", left, minID)
+	}
+}
+
+func TestArchivedLogsMergeIntoRankingAndUserAnalysis(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	restore := SetIPGeoServiceProviderForTesting(func() *IPGeoService { return nil })
+	defer restore()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT, type INTEGER,
+		quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, use_time INTEGER, ip TEXT, token_id INTEGER,
+		model_name TEXT, channel_id INTEGER, created_at INTEGER)`)
+	now := time.Now().Unix()
+	insert := func(userID int64, name string, created int64) {
+		db.MustExec(`INSERT INTO logs (user_id, username, type, quota, prompt_tokens, completion_tokens, use_time, ip, token_id, model_name, channel_id, created_at)
+			VALUES (?, ?, 2, 10, 1, 1, 1, '1.1.1.1', 1, 'gpt-4o', 1, ?)`, userID, name, created)
+	}
+	// 50 days ago: bob is by far the heaviest user; today only alice is active
+	for i := 0; i < 300; i++ {
+		insert(2, "bob", now-50*86400+int64(i))
+	}
+	for i := 0; i < 20; i++ {
+		insert(1, "alice", now-50*86400+int64(i))
+		insert(1, "alice", now-int64(i))
+	}
+
+	ctx := context.Background()
+	archive := NewLogArchiveService()
+	enabled := true
+	if _, err := archive.UpdateSettings(ctx, LogArchiveSettingsInput{Enabled: &enabled}); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if _, err := archive.Run(ctx, "manual"); err != nil {
+		t.Fatalf("archive Run: %v", err)
+	}
+	on := true
+	if _, err := NewRetentionService().UpdateSettings(ctx, RetentionSettingsInput{
+		Enabled:  &on,
+		Policies: map[string]RetentionPolicy{RetentionTableLogs: {TTLDays: 30, Action: RetentionActionDelete}},
+	}); err != nil {
+		t.Fatalf("retention UpdateSettings: %v", err)
+	}
+	if _, err := NewRetentionService().Run(ctx, "manual"); err != nil {
+		t.Fatalf("retention Run: %v", err)
+	}
+	var live int
+	_ = db.Get(&live, `SELECT COUNT(*) FROM logs`)
+	if live != 20 {
+		t.Fatalf("old logs should have been pruned, %d left", live)
+	}
+
+	rows, scan, err := NewLogAnalyticsService().UserRankingWithArchive(ctx, "requests", 90, 10)
+	if err != nil {
+		t.Fatalf("UserRankingWithArchive: %v", err)
+	}
+	if !scan.IncludesArchived || scan.Label != ArchivedDataLabel || scan.MatchedRows != 320 || scan.Truncated {
+		t.Fatalf("unexpected scan %+v", scan)
+	}
+	if len(rows) != 2 || toInt64(rows[0]["user_id"]) != 2 || toInt64(rows[0]["request_count"]) != 300 ||
+		toInt64(rows[1]["request_count"]) != 40 || toInt64(rows[1]["archived_request_count"]) != 20 {
+		t.Fatalf("ranking should merge live and archived logs, got %+v", rows)
+	}
+
+	end := now - 49*86400
+	analysis, err := NewRiskMonitoringService().GetUserAnalysisWithArchive(ctx, 1, 7*86400, &end)
+	if err != nil {
+		t.Fatalf("GetUserAnalysisWithArchive: %v", err)
+	}
+	summary, archived := analysis.Summary, analysis.ArchivedSummary
+	if summary.TotalRequests != 20 || archived == nil || archived.UniqueIPs != 1 || summary.QuotaUsed != 200 {
+		t.Fatalf("analysis should include archived logs: summary=%+v archived=%+v", summary, archived)
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// logCursorMaxLag is how stale a cursor-fed table may be before readers fall
+// back to scanning logs
+const logCursorMaxLag = 15 * time.Minute
+
+// LogCursor is the sync position of a local table fed incrementally from logs
+// by id (ip_history, analytics rollups, ...)
+type LogCursor struct {
+	Name          string `json:"name"`
+	LastLogID     int64  `json:"last_log_id"`
+	StartLogID    int64  `json:"start_log_id"`   // 首次同步的起点（回填进度的分母）
+	BackfillSince int64  `json:"backfill_since"` // 表中数据覆盖的最早时间
+	SyncedAt      int64  `json:"synced_at"`      // 最近一次追平 MAX(id) 的时间，回填完成前为 0
+}
+
+// LogCursorSyncResult summarizes one sync run of a cursor-fed table
+type LogCursorSyncResult struct {
+	Processed int64 `json:"processed"` // 扫描的日志 id 区间长度
+	Upserted  int64 `json:"upserted"`  // 写入 / 合并的聚合行
+	Batches   int   `json:"batches"`
+	LastLogID int64 `json:"last_log_id"`
+	MaxLogID  int64 `json:"max_log_id"`
+	Completed bool  `json:"completed"`
+}
+
+// logCursorBatch is one feature's batch step: fetch aggregates of logs with
+// id in (lo, hi] from the log DB, then merge them inside the local tx that
+// also advances the cursor
+type logCursorBatch struct {
+	fetch func(ctx context.Context, lo, hi int64) ([]map[string]interface{}, error)
+	write func(ctx context.Context, tx *sql.Tx, rows []map[string]interface{}) error
+}
+
+func ensureLogCursorTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS log_cursors (
+			name TEXT PRIMARY KEY,
+			last_log_id INTEGER NOT NULL DEFAULT 0,
+			start_log_id INTEGER NOT NULL DEFAULT 0,
+			backfill_since INTEGER NOT NULL DEFAULT 0,
+			synced_at INTEGER NOT NULL DEFAULT 0
+		)`)
+	return err
+}
+
+func loadLogCursor(ctx context.Context, db *sql.DB, name string) (LogCursor, bool, error) {
+	c := LogCursor{Name: name}
+	if err := ensureLogCursorTable(ctx, db); err != nil {
+		return c, false, err
+	}
+	err := db.QueryRowContext(ctx, `SELECT last_log_id, start_log_id, backfill_since, synced_at FROM log_cursors WHERE name = ?`, name).
+		Scan(&c.LastLogID, &c.StartLogID, &c.BackfillSince, &c.SyncedAt)
+	if err == sql.ErrNoRows {
+		return c, false, nil
+	}
+	return c, err == nil, err
+}
+
+func saveLogCursor(ctx context.Context, tx *sql.Tx, c LogCursor) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO log_cursors (name, last_log_id, start_log_id, backfill_since, synced_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			last_log_id = excluded.last_log_id,
+			synced_at = excluded.synced_at`,
+		c.Name, c.LastLogID, c.StartLogID, c.BackfillSince, c.SyncedAt)
+	return err
+}
+
+func deleteLogCursor(ctx context.Context, db *sql.DB, name string) error {
+	if err := ensureLogCursorTable(ctx, db); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `DELETE FROM log_cursors WHERE name = ?`, name)
+	return err
+}
+
+// logCursorCovers reports whether a cursor has finished its backfill, is
+// fresh, and reaches back to since
+func logCursorCovers(c LogCursor, since int64) bool {
+	return c.SyncedAt > 0 && c.BackfillSince <= since && time.Since(time.Unix(c.SyncedAt, 0)) <= logCursorMaxLag
+}
+
+// runLogCursorSync advances the named cursor by at most maxBatches batches of
+// scaleBatchSize() log ids. A new cursor starts at the first log of the last
+// backfillDays days. Each batch is merged and the cursor moved in one local
+// transaction, so an interrupted run resumes without double counting.
+func runLogCursorSync(ctx context.Context, db *sql.DB, logDB *database.Manager, name string, backfillDays, maxBatches int, batch logCursorBatch) (*LogCursorSyncResult, error) {
+	logDB = logDB.WithContext(ctx)
+	if maxBatches <= 0 {
+		maxBatches = defaultMaxIterations
+	}
+	cur, found, err := loadLogCursor(ctx, db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRow, err := logDB.QueryOneWithTimeout(15*time.Second, `SELECT COALESCE(MAX(id), 0) as max_id FROM logs`)
+	if err != nil {
+		return nil, fmt.Errorf("max log id query failed: %w", err)
+	}
+	maxID := toInt64(maxRow["max_id"])
+
+	if !found {
+		cur.BackfillSince = time.Now().AddDate(0, 0, -backfillDays).Unix()
+		row, err := logDB.QueryOneWithTimeout(60*time.Second, logDB.RebindQuery(
+			`SELECT COALESCE(MIN(id), 0) as min_id FROM logs WHERE created_at >= ?`), cur.BackfillSince)
+		if err != nil {
+			return nil, fmt.Errorf("backfill start query failed: %w", err)
+		}
+		if minID := toInt64(row["min_id"]); minID > 0 {
+			cur.LastLogID = minID - 1
+		} else {
+			cur.LastLogID = maxID
+		}
+		cur.StartLogID = cur.LastLogID
+	}
+
+	commit := func(rows []map[string]interface{}) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if len(rows) > 0 {
+			if err := batch.write(ctx, tx, rows); err != nil {
+				return err
+			}
+		}
+		if err := saveLogCursor(ctx, tx, cur); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	result := &LogCursorSyncResult{MaxLogID: maxID}
+	for result.Batches < maxBatches && cur.LastLogID < maxID {
+		if ctx.Err() != nil {
+			break
+		}
+		upper := cur.LastLogID + scaleBatchSize()
+		if upper > maxID {
+			upper = maxID
+		}
+		rows, err := batch.fetch(ctx, cur.LastLogID, upper)
+		if err != nil {
+			return result, fmt.Errorf("%s batch query failed: %w", name, err)
+		}
+		result.Processed += upper - cur.LastLogID
+		cur.LastLogID = upper
+		if err := commit(rows); err != nil {
+			return result, err
+		}
+		result.Batches++
+		result.Upserted += int64(len(rows))
+	}
+
+	result.LastLogID = cur.LastLogID
+	if cur.LastLogID >= maxID {
+		result.Completed = true
+		cur.SyncedAt = time.Now().Unix()
+		if err := commit(nil); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+var (
+	ErrLogNotFound   = errors.New("log not found")
+	ErrInvalidReplay = errors.New("invalid replay")
+)
+
+// logReplayRetention is how long replay outcomes are kept
+const logReplayRetention = 30 * 24 * time.Hour
+
+// LogReplay is one re-issued test request for a failed log entry. The
+// synthetic request goes through NewAPI's channel test on the same channel
+// and model; the original token is recorded for context only, the test is
+// billed to no one.
+type LogReplay struct {
+	ID              int64  `json:"id"`
+	LogID           int64  `json:"log_id"`
+	LogCreatedAt    int64  `json:"log_created_at"`
+	UserID          int64  `json:"user_id"`
+	Username        string `json:"username"`
+	TokenID         int64  `json:"token_id"`
+	TokenName       string `json:"token_name"`
+	ChannelID       int64  `json:"channel_id"`
+	ChannelName     string `json:"channel_name"`
+	Model           string `json:"model"`
+	OriginalClass   string `json:"original_class"`   // 原日志的错误分类（见 ErrorClasses）
+	OriginalMessage string `json:"original_message"` // 截断到 300 字
+	Success         bool   `json:"success"`
+	Persists        bool   `json:"persists"` // 重放仍失败，说明故障仍在
+	ErrorClass      string `json:"error_class,omitempty"`
+	Message         string `json:"message,omitempty"`
+	LatencyMs       int64  `json:"latency_ms"`
+	Operator        string `json:"operator"`
+	CreatedAt       int64  `json:"created_at"`
+}
+
+// LogReplayService re-issues failed requests to check whether the failure persists
+type LogReplayService struct {
+	db    *database.Manager
+	logDB *database.Manager
+	probe *ChannelProbeService
+}
+
+// NewLogReplayService creates a LogReplayService on the primary instance
+func NewLogReplayService() *LogReplayService {
+	return &LogReplayService{db: database.Get(), logDB: database.GetLog(), probe: NewChannelProbeService()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *LogReplayService) WithContext(ctx context.Context) *LogReplayService {
+	c := *s
+	c.db, c.logDB, c.probe = s.db.WithContext(ctx), s.logDB.WithContext(ctx), s.probe.WithContext(ctx)
+	return &c
+}
+
+func ensureLogReplayTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS log_replays (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			log_id INTEGER NOT NULL,
+			log_created_at INTEGER NOT NULL DEFAULT 0,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			token_id INTEGER NOT NULL DEFAULT 0,
+			token_name TEXT NOT NULL DEFAULT '',
+			channel_id INTEGER NOT NULL DEFAULT 0,
+			channel_name TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			original_class TEXT NOT NULL DEFAULT '',
+			original_message TEXT NOT NULL DEFAULT '',
+			success INTEGER NOT NULL DEFAULT 0,
+			error_class TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL DEFAULT '',
+			latency_ms INTEGER NOT NULL DEFAULT 0,
+			operator TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_log_replays_log ON log_replays(log_id, id)`)
+	return err
+}
+
+func openLogReplayStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureLogReplayTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadReplayTarget reconstructs the request metadata of a failed log entry
+func (s *LogReplayService) loadReplayTarget(logID int64) (LogReplay, error) {
+	r := LogReplay{LogID: logID}
+	row, err := s.logDB.QueryOne(s.logDB.RebindQuery(`
+		SELECT id, type, created_at, COALESCE(user_id, 0) as user_id, COALESCE(username, '') as username,
+			COALESCE(token_id, 0) as token_id, COALESCE(token_name, '') as token_name,
+			COALESCE(channel_id, 0) as channel_id, COALESCE(model_name, '') as model_name,
+			SUBSTR(COALESCE(content, ''), 1, 300) as content
+		FROM logs WHERE id = ?`), logID)
+	if err != nil {
+		return r, err
+	}
+	if row == nil {
+		return r, ErrLogNotFound
+	}
+	if toInt64(row["type"]) != int64(logTypes().Error) {
+		return r, fmt.Errorf("%w: log #%d is not a failed request", ErrInvalidReplay, logID)
+	}
+	r.LogCreatedAt = toInt64(row["created_at"])
+	r.UserID, r.Username = toInt64(row["user_id"]), toString(row["username"])
+	r.TokenID, r.TokenName = toInt64(row["token_id"]), toString(row["token_name"])
+	r.ChannelID, r.Model = toInt64(row["channel_id"]), toString(row["model_name"])
+	r.OriginalMessage = toString(row["content"])
+	r.OriginalClass, _ = classifyLogError(r.OriginalMessage)
+	if r.ChannelID <= 0 || r.Model == "" {
+		return r, fmt.Errorf("%w: log #%d has no channel or model to replay", ErrInvalidReplay, logID)
+	}
+
+	ch, err := s.db.QueryOne(s.db.RebindQuery(`SELECT id, name FROM channels WHERE id = ?`), r.ChannelID)
+	if err != nil {
+		return r, err
+	}
+	if ch == nil {
+		return r, fmt.Errorf("%w: channel #%d no longer exists", ErrInvalidReplay, r.ChannelID)
+	}
+	r.ChannelName = toString(ch["name"])
+	return r, nil
+}
+
+// Replay re-issues the failed request of log logID as a NewAPI channel test
+// on the same channel and model, and records the outcome. Replays do not
+// count towards the channel probe's consecutive failures.
+func (s *LogReplayService) Replay(ctx context.Context, logID int64, operator string) (LogReplay, error) {
+	if !s.probe.Configured() {
+		return LogReplay{}, ErrProbeNotConfigured
+	}
+	r, err := s.loadReplayTarget(logID)
+	if err != nil {
+		return r, err
+	}
+	settings, err := s.probe.GetSettings(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	res := s.probe.probeOne(ctx, probeTarget{ID: r.ChannelID, Name: r.ChannelName, Model: r.Model}, settings)
+	r.Success, r.Persists = res.Success, !res.Success
+	r.ErrorClass, r.Message, r.LatencyMs = res.ErrorClass, res.Message, res.LatencyMs
+	r.Operator, r.CreatedAt = operator, res.CreatedAt
+
+	db, err := openLogReplayStore(ctx)
+	if err != nil {
+		return r, err
+	}
+	defer db.Close()
+	ins, err := db.ExecContext(ctx, `
+		INSERT INTO log_replays (log_id, log_created_at, user_id, username, token_id, token_name, channel_id, channel_name,
+			model, original_class, original_message, success, error_class, message, latency_ms, operator, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.LogID, r.LogCreatedAt, r.UserID, r.Username, r.TokenID, r.TokenName, r.ChannelID, r.ChannelName,
+		r.Model, r.OriginalClass, r.OriginalMessage, boolToInt(r.Success), r.ErrorClass, r.Message, r.LatencyMs,
+		r.Operator, r.CreatedAt)
+	if err != nil {
+		return r, err
+	}
+	r.ID, _ = ins.LastInsertId()
+	if _, err := db.ExecContext(ctx, `DELETE FROM log_replays WHERE created_at < ?`,
+		time.Now().Add(-logReplayRetention).Unix()); err != nil {
+		logger.L.Warn("[日志重放] 清理过期记录失败: "+err.Error(), logger.CatSystem)
+	}
+
+	outcome := "已恢复"
+	if r.Persists {
+		outcome = "仍失败 | class=" + r.ErrorClass
+	}
+	logger.L.Business(fmt.Sprintf("[日志重放] 日志 #%d 渠道 #%d (%s) 模型 %s：%s", r.LogID, r.ChannelID, r.ChannelName, r.Model, outcome))
+	return r, nil
+}
+
+// ListReplays returns recorded replays, newest first; logID 0 lists all
+func (s *LogReplayService) ListReplays(ctx context.Context, logID int64, limit int) ([]LogReplay, error) {
+	db, err := openLogReplayStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query, args := `
+		SELECT id, log_id, log_created_at, user_id, username, token_id, token_name, channel_id, channel_name, model,
+			original_class, original_message, success, error_class, message, latency_ms, operator, created_at
+		FROM log_replays`, []interface{}{}
+	if logID > 0 {
+		query, args = query+" WHERE log_id = ?", append(args, logID)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY id DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	replays := []LogReplay{}
+	for rows.Next() {
+		var r LogReplay
+		var success int
+		if err := rows.Scan(&r.ID, &r.LogID, &r.LogCreatedAt, &r.UserID, &r.Username, &r.TokenID, &r.TokenName,
+			&r.ChannelID, &r.ChannelName, &r.Model, &r.OriginalClass, &r.OriginalMessage, &success, &r.ErrorClass,
+			&r.Message, &r.LatencyMs, &r.Operator, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Success, r.Persists = success == 1, success != 1
+		replays = append(replays, r)
+	}
+	return replays, rows.Err()
+}
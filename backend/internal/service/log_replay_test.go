@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestLogReplay(t *testing.T) {
+	var gotPath, gotModel string
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotModel = r.URL.Path, r.URL.Query().Get("model")
+		if healthy.Load() {
+			w.Write([]byte(`{"success": true, "message": "", "time": 0.42}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "message": "bad response status code 502, Bad Gateway"}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("NEWAPI_BASEURL", srv.URL)
+	t.Setenv("NEWAPI_API_KEY", "test-key")
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, type INTEGER, user_id INTEGER, username TEXT,
+			token_id INTEGER, token_name TEXT, model_name TEXT, channel_id INTEGER, content TEXT, created_at INTEGER);
+		INSERT INTO channels VALUES (3, 'backup');`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	if _, err := db.Exec(`INSERT INTO logs (type, user_id, username, token_id, token_name, model_name, channel_id, content, created_at)
+		VALUES (5, 7, 'alice', 70, 'k', 'gpt-4o', 3, 'status code 502: bad gateway', ?),
+			(2, 7, 'alice', 70, 'k', 'gpt-4o', 3, '', ?),
+			(5, 7, 'alice', 70, 'k', 'gpt-4o', 9, 'status code 502', ?)`, now, now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	svc := NewLogReplayService()
+	r, err := svc.Replay(ctx, 1, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/api/channel/test/3" || gotModel != "gpt-4o" {
+		t.Errorf("request = %s?model=%s", gotPath, gotModel)
+	}
+	if !r.Persists || r.ErrorClass != ProbeErrorUpstream5xx || r.ChannelName != "backup" || r.TokenName != "k" ||
+		r.OriginalClass == "" || r.Operator != "admin" {
+		t.Errorf("failed replay = %+v", r)
+	}
+
+	healthy.Store(true)
+	if r, err = svc.Replay(ctx, 1, "admin"); err != nil || !r.Success || r.Persists || r.LatencyMs != 420 {
+		t.Errorf("healthy replay = %+v, %v", r, err)
+	}
+	if _, err := svc.Replay(ctx, 2, "admin"); !errors.Is(err, ErrInvalidReplay) {
+		t.Errorf("successful log: %v", err)
+	}
+	if _, err := svc.Replay(ctx, 3, "admin"); !errors.Is(err, ErrInvalidReplay) {
+		t.Errorf("deleted channel: %v", err)
+	}
+	if _, err := svc.Replay(ctx, 99, "admin"); !errors.Is(err, ErrLogNotFound) {
+		t.Errorf("missing log: %v", err)
+	}
+
+	replays, err := svc.ListReplays(ctx, 1, 10)
+	if err != nil || len(replays) != 2 || !replays[0].Success || !replays[1].Persists {
+		t.Errorf("history = %+v, %v", replays, err)
+	}
+}
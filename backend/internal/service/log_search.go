@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+var ErrInvalidLogSearch = errors.New("invalid log search")
+
+// Log search type filters
+const (
+	LogSearchTypeRequests = "requests" // consume + error
+	LogSearchTypeConsume  = "consume"
+	LogSearchTypeError    = "error"
+	LogSearchTypeAll      = "all" // 含充值、管理等全部日志
+)
+
+var LogSearchTypes = []string{LogSearchTypeRequests, LogSearchTypeConsume, LogSearchTypeError, LogSearchTypeAll}
+
+const (
+	// logSearchMaxSpan bounds the time range so a content substring never
+	// scans the whole logs table
+	logSearchMaxSpan      = 31 * 86400
+	logSearchDefaultSpan  = 86400
+	logSearchQueryTimeout = 30 * time.Second
+	logSearchContentRunes = 500
+)
+
+// LogSearchQuery filters /api/logs/search; zero values match everything.
+// Results are newest first; pass the previous page's next_cursor as Cursor
+// to continue (keyset pagination on id).
+type LogSearchQuery struct {
+	UserID    int64
+	Username  string
+	TokenID   int64
+	TokenName string
+	ModelName string // 以 * 结尾按前缀匹配
+	ChannelID int64
+	IP        string
+	Type      string
+	Content   string // 内容子串，不区分大小写
+	StartTime int64
+	EndTime   int64
+	Cursor    int64 // 只返回 id < cursor 的日志
+	Limit     int
+}
+
+// LogSearchItem is one matched log row
+type LogSearchItem struct {
+	ID               int64  `json:"id"`
+	CreatedAt        int64  `json:"created_at"`
+	Type             int64  `json:"type"`
+	UserID           int64  `json:"user_id"`
+	Username         string `json:"username"`
+	TokenID          int64  `json:"token_id"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	ChannelID        int64  `json:"channel_id"`
+	ChannelName      string `json:"channel_name"`
+	IP               string `json:"ip"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	UseTime          int64  `json:"use_time"`
+	Content          string `json:"content"` // 截断到 500 字
+}
+
+// LogSearchResult is one page of matches
+type LogSearchResult struct {
+	StartTime  int64           `json:"start_time"`
+	EndTime    int64           `json:"end_time"`
+	Items      []LogSearchItem `json:"items"`
+	HasMore    bool            `json:"has_more"`
+	NextCursor int64           `json:"next_cursor"` // 0 表示没有更多
+}
+
+// LogSearchService searches the raw NewAPI logs for incident investigation
+type LogSearchService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewLogSearchService creates a LogSearchService on the primary instance
+func NewLogSearchService() *LogSearchService {
+	return &LogSearchService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *LogSearchService) WithContext(ctx context.Context) *LogSearchService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// normalizeLogSearchQuery fills the defaults (last 24 hours, requests only,
+// 50 rows) and rejects unknown types and ranges longer than 31 days
+func normalizeLogSearchQuery(q *LogSearchQuery, now int64) error {
+	q.Username = strings.TrimSpace(q.Username)
+	q.TokenName = strings.TrimSpace(q.TokenName)
+	q.ModelName = strings.TrimSpace(q.ModelName)
+	q.IP = strings.TrimSpace(q.IP)
+	q.Content = strings.TrimSpace(q.Content)
+	if len([]rune(q.Content)) > 200 {
+		return fmt.Errorf("%w: content 最多 200 个字符", ErrInvalidLogSearch)
+	}
+	if q.Type == "" {
+		q.Type = LogSearchTypeRequests
+	}
+	if !containsStr(LogSearchTypes, q.Type) {
+		return fmt.Errorf("%w: type 只能是 %s", ErrInvalidLogSearch, strings.Join(LogSearchTypes, "、"))
+	}
+	if q.EndTime <= 0 || q.EndTime > now {
+		q.EndTime = now
+	}
+	if q.StartTime <= 0 {
+		q.StartTime = q.EndTime - logSearchDefaultSpan
+	}
+	if q.StartTime > q.EndTime {
+		return fmt.Errorf("%w: start_time 不能晚于 end_time", ErrInvalidLogSearch)
+	}
+	if q.EndTime-q.StartTime > logSearchMaxSpan {
+		return fmt.Errorf("%w: 时间范围最长 31 天", ErrInvalidLogSearch)
+	}
+	if q.Cursor < 0 {
+		q.Cursor = 0
+	}
+	q.Limit = clampSetting(q.Limit, 1, 200, 50)
+	return nil
+}
+
+// Search returns the logs matching q, newest first, one page at a time
+func (s *LogSearchService) Search(q LogSearchQuery) (*LogSearchResult, error) {
+	if err := normalizeLogSearchQuery(&q, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+
+	where := []string{"created_at >= ?", "created_at <= ?"}
+	args := []interface{}{q.StartTime, q.EndTime}
+	switch q.Type {
+	case LogSearchTypeRequests:
+		where = append(where, "type IN ("+ltRequests()+")")
+	case LogSearchTypeConsume:
+		where = append(where, "type = "+ltConsume())
+	case LogSearchTypeError:
+		where = append(where, "type = "+ltError())
+	}
+	if q.Cursor > 0 {
+		where, args = append(where, "id < ?"), append(args, q.Cursor)
+	}
+	if q.UserID > 0 {
+		where, args = append(where, "user_id = ?"), append(args, q.UserID)
+	}
+	if q.Username != "" {
+		where, args = append(where, "username = ?"), append(args, q.Username)
+	}
+	if q.TokenID > 0 {
+		where, args = append(where, "token_id = ?"), append(args, q.TokenID)
+	}
+	if q.TokenName != "" {
+		where, args = append(where, "token_name = ?"), append(args, q.TokenName)
+	}
+	if prefix, ok := strings.CutSuffix(q.ModelName, "*"); ok && prefix != "" {
+		where, args = append(where, "model_name LIKE ?"), append(args, prefix+"%")
+	} else if q.ModelName != "" && q.ModelName != "*" {
+		where, args = append(where, "model_name = ?"), append(args, q.ModelName)
+	}
+	if q.ChannelID > 0 {
+		where, args = append(where, "channel_id = ?"), append(args, q.ChannelID)
+	}
+	if q.IP != "" {
+		where, args = append(where, "ip = ?"), append(args, q.IP)
+	}
+	if q.Content != "" {
+		where, args = append(where, "content "+likeOp(s.logDB)+" ?"), append(args, "%"+q.Content+"%")
+	}
+
+	// 多取一行判断是否还有下一页
+	rows, err := s.logDB.QueryWithTimeout(logSearchQueryTimeout, s.logDB.RebindQuery(`
+		SELECT id, created_at, type, COALESCE(user_id, 0) as user_id, COALESCE(username, '') as username,
+			COALESCE(token_id, 0) as token_id, COALESCE(token_name, '') as token_name,
+			COALESCE(model_name, '') as model_name, COALESCE(channel_id, 0) as channel_id,
+			COALESCE(ip, '') as ip, COALESCE(quota, 0) as quota, COALESCE(prompt_tokens, 0) as prompt_tokens,
+			COALESCE(completion_tokens, 0) as completion_tokens, COALESCE(use_time, 0) as use_time,
+			SUBSTR(COALESCE(content, ''), 1, `+strconv.Itoa(logSearchContentRunes)+`) as content
+		FROM logs
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id DESC
+		LIMIT ?`), append(args, q.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LogSearchResult{StartTime: q.StartTime, EndTime: q.EndTime, Items: make([]LogSearchItem, 0, min(len(rows), q.Limit))}
+	if len(rows) > q.Limit {
+		rows, result.HasMore = rows[:q.Limit], true
+	}
+	for _, r := range rows {
+		result.Items = append(result.Items, LogSearchItem{
+			ID:               toInt64(r["id"]),
+			CreatedAt:        toInt64(r["created_at"]),
+			Type:             toInt64(r["type"]),
+			UserID:           toInt64(r["user_id"]),
+			Username:         toString(r["username"]),
+			TokenID:          toInt64(r["token_id"]),
+			TokenName:        toString(r["token_name"]),
+			ModelName:        toString(r["model_name"]),
+			ChannelID:        toInt64(r["channel_id"]),
+			IP:               toString(r["ip"]),
+			Quota:            toInt64(r["quota"]),
+			PromptTokens:     toInt64(r["prompt_tokens"]),
+			CompletionTokens: toInt64(r["completion_tokens"]),
+			UseTime:          toInt64(r["use_time"]),
+			Content:          toString(r["content"]),
+		})
+	}
+	if result.HasMore {
+		result.NextCursor = result.Items[len(result.Items)-1].ID
+	}
+	if len(result.Items) > 0 {
+		if chRows, err := s.db.Query(`SELECT id, name FROM channels`); err == nil {
+			names := make(map[int64]string, len(chRows))
+			for _, r := range chRows {
+				names[toInt64(r["id"])] = toString(r["name"])
+			}
+			for i := range result.Items {
+				result.Items[i].ChannelName = names[result.Items[i].ChannelID]
+			}
+		}
+	}
+	return result, nil
+}
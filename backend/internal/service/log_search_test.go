@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestNormalizeLogSearchQuery(t *testing.T) {
+	now := int64(1_700_000_000)
+	q := LogSearchQuery{}
+	if err := normalizeLogSearchQuery(&q, now); err != nil {
+		t.Fatal(err)
+	}
+	if q.EndTime != now || q.StartTime != now-86400 || q.Type != LogSearchTypeRequests || q.Limit != 50 {
+		t.Errorf("defaults = %+v", q)
+	}
+	for _, bad := range []LogSearchQuery{
+		{Type: "topup"},
+		{StartTime: now - 32*86400},
+		{StartTime: now - 10, EndTime: now - 20},
+	} {
+		if err := normalizeLogSearchQuery(&bad, now); !errors.Is(err, ErrInvalidLogSearch) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+}
+
+func TestLogSearch(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, type INTEGER, user_id INTEGER, username TEXT,
+			token_id INTEGER, token_name TEXT, model_name TEXT, channel_id INTEGER, ip TEXT, quota INTEGER,
+			prompt_tokens INTEGER, completion_tokens INTEGER, use_time INTEGER, content TEXT, created_at INTEGER);
+		INSERT INTO channels VALUES (1, 'primary');`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	for i := 0; i < 12; i++ {
+		typ, model, content := 2, "gpt-4o", "ok"
+		if i%3 == 0 {
+			typ, model, content = 5, "gpt-4o-mini", "upstream returned Status Code 502"
+		}
+		if _, err := db.Exec(`INSERT INTO logs (type, user_id, username, token_id, token_name, model_name, channel_id, ip,
+			quota, prompt_tokens, completion_tokens, use_time, content, created_at)
+			VALUES (?, 7, 'alice', 70, 'k', ?, 1, '203.0.113.9', 10, 1, 1, 1, ?, ?)`, typ, model, content, now-int64(12-i)*60); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// outside the default 24h window, and a top-up log that is not a request
+	if _, err := db.Exec(`INSERT INTO logs (type, user_id, username, model_name, content, created_at)
+		VALUES (5, 7, 'alice', 'gpt-4o-mini', 'status code 502', ?), (1, 7, 'alice', '', 'status code 502', ?)`, now-2*86400, now); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewLogSearchService()
+
+	// keyset pages: 4 + 4 + 4 of the 12 request logs, newest first
+	var ids []int64
+	cursor := int64(0)
+	for page := 0; page < 3; page++ {
+		res, err := svc.Search(LogSearchQuery{UserID: 7, Cursor: cursor, Limit: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Items) != 4 || res.HasMore != (page < 2) {
+			t.Fatalf("page %d = %+v", page, res)
+		}
+		for _, it := range res.Items {
+			ids = append(ids, it.ID)
+		}
+		cursor = res.NextCursor
+	}
+	if cursor != 0 || ids[0] != 12 || ids[11] != 1 || ids[0] <= ids[1] {
+		t.Errorf("paged ids = %v, final cursor %d", ids, cursor)
+	}
+
+	res, err := svc.Search(LogSearchQuery{Content: "status code 502", ModelName: "gpt-4o*", IP: "203.0.113.9", Type: LogSearchTypeError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 4 || res.Items[0].ChannelName != "primary" || res.Items[0].ModelName != "gpt-4o-mini" {
+		t.Errorf("content search = %+v", res)
+	}
+	if res, err = svc.Search(LogSearchQuery{Content: "502", Type: LogSearchTypeAll, StartTime: now - 3*86400}); err != nil || len(res.Items) != 6 {
+		t.Errorf("all types over 3 days = %+v, %v", res, err)
+	}
+}
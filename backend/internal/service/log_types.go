@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// logTypes returns the deployment's logs.type codes (LOG_TYPE_*)
+func logTypes() config.LogTypeConfig {
+	return config.LogTypes()
+}
+
+// SQL fragments of the log type codes, spliced into logs queries in place of
+// literals so forks with renumbered types are read correctly:
+//
+//	WHERE type IN (` + ltRequests() + `)   -- 成功 + 失败调用
+//	SUM(CASE WHEN type = ` + ltError() + ` THEN 1 ELSE 0 END)
+
+// ltConsume is the successful (billed) request log type
+func ltConsume() string { return strconv.Itoa(logTypes().Consume) }
+
+// ltError is the failed request log type
+func ltError() string { return strconv.Itoa(logTypes().Error) }
+
+// ltRequests lists the request log types (consume, error) for an IN clause
+func ltRequests() string {
+	lt := logTypes()
+	return strconv.Itoa(lt.Consume) + ", " + strconv.Itoa(lt.Error)
+}
+
+// ltQuotaCredits lists the quota credit log types (top-up / redemption,
+// admin adjustment) for an IN clause
+func ltQuotaCredits() string {
+	lt := logTypes()
+	return strconv.Itoa(lt.TopUp) + ", " + strconv.Itoa(lt.Manage)
+}
+
+// isRequestLogType reports whether a log row's type is a consume or error log
+func isRequestLogType(t int64) bool {
+	lt := logTypes()
+	return t == int64(lt.Consume) || t == int64(lt.Error)
+}
+
+// LogTypeCount is how many logs of one type were written recently
+type LogTypeCount struct {
+	Type  int64  `json:"type"`
+	Kind  string `json:"kind"` // top_up / consume / manage / system / error，未映射的类型为空
+	Count int64  `json:"count"`
+}
+
+// LogTypeReport shows the active mapping next to the types actually in the
+// logs table, so a fork's renumbering can be spotted and configured
+type LogTypeReport struct {
+	Mapping   config.LogTypeConfig `json:"mapping"`
+	Custom    bool                 `json:"custom"` // 是否通过 LOG_TYPE_* 自定义
+	Since     int64                `json:"since"`
+	Counts    []LogTypeCount       `json:"counts"`
+	Unmapped  int64                `json:"unmapped"` // 未映射类型的日志数
+	ElapsedMs int64                `json:"elapsed_ms"`
+}
+
+// GetLogTypeReport counts the last 24 hours of logs by type
+func GetLogTypeReport(ctx context.Context) (*LogTypeReport, error) {
+	started := time.Now()
+	lt := logTypes()
+	report := &LogTypeReport{
+		Mapping: lt,
+		Custom:  lt != config.DefaultLogTypes,
+		Since:   time.Now().Unix() - 86400,
+		Counts:  []LogTypeCount{},
+	}
+	logDB := database.GetReadLog().WithContext(ctx)
+	rows, err := logDB.QueryWithTimeout(30*time.Second, logDB.RebindQuery(`
+		SELECT type, COUNT(*) as count FROM logs WHERE created_at >= ? GROUP BY type ORDER BY type`), report.Since)
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[int64]string{
+		int64(lt.TopUp): "top_up", int64(lt.Consume): "consume", int64(lt.Manage): "manage",
+		int64(lt.System): "system", int64(lt.Error): "error",
+	}
+	for _, row := range rows {
+		c := LogTypeCount{Type: toInt64(row["type"]), Count: toInt64(row["count"])}
+		c.Kind = kinds[c.Type]
+		if c.Kind == "" {
+			report.Unmapped += c.Count
+		}
+		report.Counts = append(report.Counts, c)
+	}
+	report.ElapsedMs = time.Since(started).Milliseconds()
+	return report, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+// useLogTypes loads a config with the given LOG_TYPE_* overrides for the test
+func useLogTypes(t *testing.T, env map[string]string) {
+	t.Helper()
+	t.Cleanup(func() { config.Load() }) // runs after the env is restored
+	t.Setenv("SQL_DSN", "not-used")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	config.Load()
+}
+
+func TestLogTypeFragments(t *testing.T) {
+	useLogTypes(t, nil)
+	if ltRequests() != "2, 5" || ltConsume() != "2" || ltError() != "5" || ltQuotaCredits() != "1, 3" {
+		t.Fatalf("defaults: %s / %s / %s / %s", ltRequests(), ltConsume(), ltError(), ltQuotaCredits())
+	}
+
+	useLogTypes(t, map[string]string{"LOG_TYPE_ERROR": "3", "LOG_TYPE_MANAGE": "6"})
+	if ltRequests() != "2, 3" || ltError() != "3" || ltQuotaCredits() != "1, 6" {
+		t.Fatalf("fork mapping: %s / %s / %s", ltRequests(), ltError(), ltQuotaCredits())
+	}
+	if !isRequestLogType(3) || isRequestLogType(5) {
+		t.Error("isRequestLogType should follow the mapping")
+	}
+}
+
+func TestLogTypeMappingAppliesToQueries(t *testing.T) {
+	useLogTypes(t, map[string]string{"LOG_TYPE_ERROR": "3", "LOG_TYPE_MANAGE": "6"})
+	resetRateMetrics()
+	t.Cleanup(resetRateMetrics)
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+		type INTEGER, created_at INTEGER, ip TEXT);
+		INSERT INTO logs (user_id, username, type, created_at) VALUES
+			(1, 'alice', 2, ?), (1, 'alice', 3, ?), (1, 'alice', 5, ?), (1, 'alice', 9, ?);`, now, now, now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Consume (2) and the fork's error type (3) count as requests; 5 does not
+	folded, err := PollRateMetrics(context.Background())
+	if err != nil || folded != 2 {
+		t.Fatalf("folded = %d err=%v, want 2", folded, err)
+	}
+
+	report, err := GetLogTypeReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[int64]string{}
+	for _, c := range report.Counts {
+		kinds[c.Type] = c.Kind
+	}
+	if !report.Custom || kinds[2] != "consume" || kinds[3] != "error" || kinds[5] != "" || report.Unmapped != 2 {
+		t.Errorf("report = %+v", report)
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+var (
+	ErrMaintenanceNotFound = errors.New("maintenance window not found")
+	ErrInvalidMaintenance  = errors.New("invalid maintenance window")
+)
+
+const (
+	maxMaintenanceDuration = 30 * 86400
+	maxMaintenanceTargets  = 100
+	// maintenanceRetention is how long finished windows are kept; the uptime
+	// history only needs the windows of recomputed slots
+	maintenanceRetention = 120 * 24 * time.Hour
+)
+
+// MaintenanceWindow is a scheduled period during which the listed channels
+// and models are expected to fail: probes skip them, failover and anomaly
+// alerts ignore them, their uptime slots do not count as down and the
+// public status shows "maintenance".
+type MaintenanceWindow struct {
+	ID         int64    `json:"id"`
+	Title      string   `json:"title"`
+	Message    string   `json:"message"`
+	ChannelIDs []int64  `json:"channel_ids"`
+	Models     []string `json:"models"`
+	StartsAt   int64    `json:"starts_at"`
+	EndsAt     int64    `json:"ends_at"`
+	Active     bool     `json:"active"` // 当前时间处于窗口内
+	CreatedBy  string   `json:"created_by"`
+	CreatedAt  int64    `json:"created_at"`
+	UpdatedAt  int64    `json:"updated_at"`
+}
+
+// MaintenanceWindowInput creates or partially updates a window
+type MaintenanceWindowInput struct {
+	Title      *string   `json:"title"`
+	Message    *string   `json:"message"`
+	ChannelIDs *[]int64  `json:"channel_ids"`
+	Models     *[]string `json:"models"`
+	StartsAt   *int64    `json:"starts_at"`
+	EndsAt     *int64    `json:"ends_at"`
+}
+
+func normalizeMaintenanceWindow(w *MaintenanceWindow) error {
+	w.Title = strings.TrimSpace(w.Title)
+	if w.Title == "" || len([]rune(w.Title)) > 100 {
+		return fmt.Errorf("%w: title 不能为空且最多 100 个字符", ErrInvalidMaintenance)
+	}
+	w.Message = strings.TrimSpace(w.Message)
+	if len([]rune(w.Message)) > 2000 {
+		return fmt.Errorf("%w: message 最多 2000 个字符", ErrInvalidMaintenance)
+	}
+	channels := []int64{}
+	for _, id := range w.ChannelIDs {
+		if id <= 0 {
+			return fmt.Errorf("%w: 无效的渠道 ID %d", ErrInvalidMaintenance, id)
+		}
+		if !slices.Contains(channels, id) {
+			channels = append(channels, id)
+		}
+	}
+	models := []string{}
+	for _, m := range w.Models {
+		if m = strings.TrimSpace(m); m != "" {
+			models = appendUniqueString(models, m)
+		}
+	}
+	if len(channels) == 0 && len(models) == 0 {
+		return fmt.Errorf("%w: 至少指定一个渠道或模型", ErrInvalidMaintenance)
+	}
+	if len(channels) > maxMaintenanceTargets || len(models) > maxMaintenanceTargets {
+		return fmt.Errorf("%w: 渠道和模型各最多 %d 个", ErrInvalidMaintenance, maxMaintenanceTargets)
+	}
+	w.ChannelIDs, w.Models = channels, models
+	if w.StartsAt <= 0 || w.EndsAt <= w.StartsAt {
+		return fmt.Errorf("%w: 需要 starts_at < ends_at", ErrInvalidMaintenance)
+	}
+	if w.EndsAt-w.StartsAt > maxMaintenanceDuration {
+		return fmt.Errorf("%w: 单个维护窗口最长 30 天", ErrInvalidMaintenance)
+	}
+	return nil
+}
+
+// overlaps reports whether the window intersects [from, to)
+func (w MaintenanceWindow) overlaps(from, to int64) bool {
+	return w.StartsAt < to && w.EndsAt > from
+}
+
+// maintenanceSchedule is the set of windows loaded for one evaluation pass
+type maintenanceSchedule []MaintenanceWindow
+
+// channelDuring reports whether the channel is under maintenance at any time in [from, to)
+func (m maintenanceSchedule) channelDuring(channelID, from, to int64) bool {
+	for _, w := range m {
+		if w.overlaps(from, to) && slices.Contains(w.ChannelIDs, channelID) {
+			return true
+		}
+	}
+	return false
+}
+
+// modelDuring reports whether the model is under maintenance at any time in [from, to)
+func (m maintenanceSchedule) modelDuring(model string, from, to int64) bool {
+	for _, w := range m {
+		if w.overlaps(from, to) && slices.Contains(w.Models, model) {
+			return true
+		}
+	}
+	return false
+}
+
+func ensureMaintenanceTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS maintenance_windows (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			channel_ids TEXT NOT NULL DEFAULT '[]',
+			models TEXT NOT NULL DEFAULT '[]',
+			starts_at INTEGER NOT NULL,
+			ends_at INTEGER NOT NULL,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_maintenance_windows_ends ON maintenance_windows(ends_at)`)
+	return err
+}
+
+func openMaintenanceStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMaintenanceTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+const maintenanceColumns = `id, title, message, channel_ids, models, starts_at, ends_at, created_by, created_at, updated_at`
+
+func queryMaintenanceWindows(ctx context.Context, db *sql.DB, query string, args ...interface{}) (maintenanceSchedule, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+maintenanceColumns+` FROM maintenance_windows `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	now := time.Now().Unix()
+	windows := maintenanceSchedule{}
+	for rows.Next() {
+		var w MaintenanceWindow
+		var channels, models string
+		if err := rows.Scan(&w.ID, &w.Title, &w.Message, &channels, &models, &w.StartsAt, &w.EndsAt,
+			&w.CreatedBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(channels), &w.ChannelIDs); err != nil || w.ChannelIDs == nil {
+			w.ChannelIDs = []int64{}
+		}
+		if err := json.Unmarshal([]byte(models), &w.Models); err != nil || w.Models == nil {
+			w.Models = []string{}
+		}
+		w.Active = w.StartsAt <= now && now < w.EndsAt
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// loadMaintenanceSchedule returns the windows intersecting [from, to). An
+// unreadable store yields an empty schedule so suppression never blocks the
+// probes and alerts it guards.
+func loadMaintenanceSchedule(ctx context.Context, from, to int64) maintenanceSchedule {
+	db, err := openMaintenanceStore(ctx)
+	if err != nil {
+		logger.L.Warn("[维护窗口] 读取失败: "+err.Error(), logger.CatSystem)
+		return nil
+	}
+	defer db.Close()
+	windows, err := queryMaintenanceWindows(ctx, db, `WHERE starts_at < ? AND ends_at > ?`, to, from)
+	if err != nil {
+		logger.L.Warn("[维护窗口] 读取失败: "+err.Error(), logger.CatSystem)
+		return nil
+	}
+	return windows
+}
+
+// ListMaintenanceWindows returns windows newest first; includeFinished adds
+// windows that already ended
+func (s *ModelStatusService) ListMaintenanceWindows(ctx context.Context, includeFinished bool, limit int) ([]MaintenanceWindow, error) {
+	db, err := openMaintenanceStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	where, args := "", []interface{}{}
+	if !includeFinished {
+		where, args = "WHERE ends_at > ?", append(args, time.Now().Unix())
+	}
+	return queryMaintenanceWindows(ctx, db, where+" ORDER BY starts_at DESC, id DESC LIMIT ?", append(args, limit)...)
+}
+
+func applyMaintenanceInput(w *MaintenanceWindow, in MaintenanceWindowInput) {
+	if in.Title != nil {
+		w.Title = *in.Title
+	}
+	if in.Message != nil {
+		w.Message = *in.Message
+	}
+	if in.ChannelIDs != nil {
+		w.ChannelIDs = *in.ChannelIDs
+	}
+	if in.Models != nil {
+		w.Models = *in.Models
+	}
+	if in.StartsAt != nil {
+		w.StartsAt = *in.StartsAt
+	}
+	if in.EndsAt != nil {
+		w.EndsAt = *in.EndsAt
+	}
+}
+
+// invalidateMaintenanceViews drops the cached pages that depend on the schedule
+func invalidateMaintenanceViews() {
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("status_page:"))
+}
+
+// CreateMaintenanceWindow schedules a new window
+func (s *ModelStatusService) CreateMaintenanceWindow(ctx context.Context, in MaintenanceWindowInput, operator string) (MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	applyMaintenanceInput(&w, in)
+	if err := normalizeMaintenanceWindow(&w); err != nil {
+		return w, err
+	}
+	now := time.Now().Unix()
+	w.CreatedBy, w.CreatedAt, w.UpdatedAt = operator, now, now
+	w.Active = w.StartsAt <= now && now < w.EndsAt
+
+	db, err := openMaintenanceStore(ctx)
+	if err != nil {
+		return w, err
+	}
+	defer db.Close()
+	channels, _ := json.Marshal(w.ChannelIDs)
+	models, _ := json.Marshal(w.Models)
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO maintenance_windows (title, message, channel_ids, models, starts_at, ends_at, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.Title, w.Message, string(channels), string(models), w.StartsAt, w.EndsAt, w.CreatedBy, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return w, err
+	}
+	w.ID, _ = res.LastInsertId()
+	if _, err := db.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE ends_at < ?`,
+		time.Now().Add(-maintenanceRetention).Unix()); err != nil {
+		logger.L.Warn("[维护窗口] 清理过期记录失败: "+err.Error(), logger.CatSystem)
+	}
+	invalidateMaintenanceViews()
+	logger.L.Business(fmt.Sprintf("[维护窗口] %s 创建 #%d %s：渠道 %v 模型 %v", operator, w.ID, w.Title, w.ChannelIDs, w.Models))
+	return w, nil
+}
+
+// UpdateMaintenanceWindow applies a partial update, e.g. ending a window early
+func (s *ModelStatusService) UpdateMaintenanceWindow(ctx context.Context, id int64, in MaintenanceWindowInput) (MaintenanceWindow, error) {
+	db, err := openMaintenanceStore(ctx)
+	if err != nil {
+		return MaintenanceWindow{}, err
+	}
+	defer db.Close()
+	windows, err := queryMaintenanceWindows(ctx, db, `WHERE id = ?`, id)
+	if err != nil {
+		return MaintenanceWindow{}, err
+	}
+	if len(windows) == 0 {
+		return MaintenanceWindow{}, ErrMaintenanceNotFound
+	}
+	w := windows[0]
+	applyMaintenanceInput(&w, in)
+	if err := normalizeMaintenanceWindow(&w); err != nil {
+		return w, err
+	}
+	now := time.Now().Unix()
+	w.UpdatedAt = now
+	w.Active = w.StartsAt <= now && now < w.EndsAt
+	channels, _ := json.Marshal(w.ChannelIDs)
+	models, _ := json.Marshal(w.Models)
+	if _, err := db.ExecContext(ctx, `
+		UPDATE maintenance_windows SET title = ?, message = ?, channel_ids = ?, models = ?, starts_at = ?, ends_at = ?, updated_at = ?
+		WHERE id = ?`,
+		w.Title, w.Message, string(channels), string(models), w.StartsAt, w.EndsAt, w.UpdatedAt, id); err != nil {
+		return w, err
+	}
+	invalidateMaintenanceViews()
+	return w, nil
+}
+
+// DeleteMaintenanceWindow removes a window
+func (s *ModelStatusService) DeleteMaintenanceWindow(ctx context.Context, id int64) error {
+	db, err := openMaintenanceStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMaintenanceNotFound
+	}
+	invalidateMaintenanceViews()
+	return nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() {
+		cache.Get().DeleteByPrefix(cache.Key("model_status:uptime:"))
+		cache.Get().DeleteByPrefix(cache.Key("status_page:"))
+	})
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, model_name TEXT, type INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		db.MustExec(`INSERT INTO logs (model_name, type, created_at) VALUES ('gpt-4o', 5, ?)`, now.Unix()-600)
+	}
+
+	svc := NewModelStatusService()
+	ctx := context.Background()
+	title := "上游迁移"
+	start, end := now.Add(-time.Hour).Unix(), now.Add(time.Hour).Unix()
+	if _, err := svc.CreateMaintenanceWindow(ctx, MaintenanceWindowInput{Title: &title, StartsAt: &start, EndsAt: &end}, "admin"); !errors.Is(err, ErrInvalidMaintenance) {
+		t.Errorf("window without targets must be rejected, got %v", err)
+	}
+	models, channels := []string{"gpt-4o"}, []int64{7, 7}
+	if _, err := svc.CreateMaintenanceWindow(ctx, MaintenanceWindowInput{Title: &title, Models: &models, StartsAt: &end, EndsAt: &start}, "admin"); !errors.Is(err, ErrInvalidMaintenance) {
+		t.Errorf("ends_at before starts_at must be rejected, got %v", err)
+	}
+	w, err := svc.CreateMaintenanceWindow(ctx, MaintenanceWindowInput{Title: &title, Models: &models, ChannelIDs: &channels,
+		StartsAt: &start, EndsAt: &end}, "admin")
+	if err != nil || !w.Active || len(w.ChannelIDs) != 1 {
+		t.Fatalf("CreateMaintenanceWindow = %+v, %v", w, err)
+	}
+	pastStart, pastEnd := now.Add(-48*time.Hour).Unix(), now.Add(-47*time.Hour).Unix()
+	if _, err := svc.CreateMaintenanceWindow(ctx, MaintenanceWindowInput{Title: &title, ChannelIDs: &channels,
+		StartsAt: &pastStart, EndsAt: &pastEnd}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := svc.ListMaintenanceWindows(ctx, false, 50); err != nil || len(list) != 1 {
+		t.Errorf("current windows = %+v, %v", list, err)
+	}
+	if list, err := svc.ListMaintenanceWindows(ctx, true, 50); err != nil || len(list) != 2 {
+		t.Errorf("all windows = %+v, %v", list, err)
+	}
+
+	schedule := loadMaintenanceSchedule(ctx, now.Unix(), now.Unix()+1)
+	if !schedule.channelDuring(7, now.Unix(), now.Unix()+1) || schedule.channelDuring(8, now.Unix(), now.Unix()+1) ||
+		!schedule.modelDuring("gpt-4o", now.Unix(), now.Unix()+1) || schedule.modelDuring("claude", now.Unix(), now.Unix()+1) {
+		t.Errorf("schedule = %+v", schedule)
+	}
+
+	anomalies := []TrafficAnomaly{
+		{Dimension: AnomalyDimensionModel, Key: "gpt-4o", Hour: now.Unix() - now.Unix()%3600},
+		{Dimension: AnomalyDimensionModel, Key: "claude", Hour: now.Unix() - now.Unix()%3600},
+		{Dimension: AnomalyDimensionModel, Key: "gpt-4o", Hour: now.Add(-6*time.Hour).Unix() - now.Unix()%3600},
+	}
+	if kept := dropMaintenanceAnomalies(ctx, anomalies); len(kept) != 2 || kept[0].Key != "claude" {
+		t.Errorf("kept anomalies = %+v", kept)
+	}
+
+	// a failing slot inside the window is not down
+	if _, err := svc.snapshotUptimeAt(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	history, err := svc.GetUptimeHistory(ctx, "gpt-4o", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var down, maint int64
+	for _, b := range history.Bars {
+		down, maint = down+b.DownSlots, maint+b.MaintenanceSlots
+	}
+	if down != 0 || maint != 1 || history.Uptime == nil || *history.Uptime != 100 {
+		t.Errorf("history = %+v", history)
+	}
+
+	page, err := NewStatusPageService().GetStatusPage(ctx, StatusPageSettings{Models: []string{"gpt-4o"}, HistoryDays: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.OverallStatus != StatusPageMaintenance || page.Models[0].Status != StatusPageMaintenance ||
+		len(page.Maintenance) != 1 || !page.Maintenance[0].Active {
+		t.Errorf("status page = %+v", page)
+	}
+
+	early := now.Unix()
+	if w, err = svc.UpdateMaintenanceWindow(ctx, w.ID, MaintenanceWindowInput{EndsAt: &early}); err != nil || w.Active {
+		t.Errorf("UpdateMaintenanceWindow = %+v, %v", w, err)
+	}
+	if err := svc.DeleteMaintenanceWindow(ctx, w.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteMaintenanceWindow(ctx, w.ID); !errors.Is(err, ErrMaintenanceNotFound) {
+		t.Errorf("second delete = %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const marginAlertSettingsKey = "margin_alerts"
+
+// marginAlertRetentionDays bounds the margin_alerts table
+const marginAlertRetentionDays = 180
+
+var ErrInvalidMarginAlert = errors.New("invalid margin alert request")
+
+// marginAlertMu serialises checks so a model is never alerted twice per cooldown
+var marginAlertMu sync.Mutex
+
+// MarginAlertSettings configures the per-model negative margin alert
+type MarginAlertSettings struct {
+	Enabled       bool    `json:"enabled"`
+	WindowHours   int     `json:"window_hours"`   // 统计最近 N 小时的收入与成本
+	MarginRate    float64 `json:"margin_rate"`    // 毛利率（%）低于该值时告警，0 = 亏损即告警
+	MinCostUSD    float64 `json:"min_cost_usd"`   // 窗口内上游成本低于该值的模型不告警
+	CooldownHours int     `json:"cooldown_hours"` // 同一模型两次告警的最小间隔
+	UpdatedAt     int64   `json:"updated_at"`
+}
+
+// MarginAlertSettingsInput supports partial update of MarginAlertSettings
+type MarginAlertSettingsInput struct {
+	Enabled       *bool    `json:"enabled"`
+	WindowHours   *int     `json:"window_hours"`
+	MarginRate    *float64 `json:"margin_rate"`
+	MinCostUSD    *float64 `json:"min_cost_usd"`
+	CooldownHours *int     `json:"cooldown_hours"`
+}
+
+// MarginAlert is one raised alert: the model's charged quota did not cover
+// its estimated upstream cost over the window
+type MarginAlert struct {
+	ID          int64    `json:"id"`
+	ModelName   string   `json:"model_name"`
+	WindowHours int      `json:"window_hours"`
+	Requests    int64    `json:"requests"`
+	RevenueUSD  float64  `json:"revenue_usd"` // 已定价部分的收入
+	CostUSD     float64  `json:"cost_usd"`
+	MarginUSD   float64  `json:"margin_usd"`
+	MarginRate  *float64 `json:"margin_rate"` // 收入为 0 时为 null
+	CreatedAt   int64    `json:"created_at"`
+}
+
+func defaultMarginAlertSettings() MarginAlertSettings {
+	return MarginAlertSettings{Enabled: true, WindowHours: 24, MinCostUSD: 1, CooldownHours: 24}
+}
+
+func normalizeMarginAlertSettings(s *MarginAlertSettings) error {
+	if s.MarginRate < -100 || s.MarginRate > 100 {
+		return fmt.Errorf("%w: margin_rate 需在 -100 ~ 100 之间", ErrInvalidMarginAlert)
+	}
+	if s.MinCostUSD < 0 {
+		return fmt.Errorf("%w: min_cost_usd 不能为负数", ErrInvalidMarginAlert)
+	}
+	s.WindowHours = clampSetting(s.WindowHours, 1, 168, 24)
+	s.CooldownHours = clampSetting(s.CooldownHours, 1, 168, 24)
+	return nil
+}
+
+// GetAlertSettings returns the margin alert settings
+func (s *ChannelMarginService) GetAlertSettings(ctx context.Context) (MarginAlertSettings, error) {
+	settings := defaultMarginAlertSettings()
+	if _, err := loadLocalSetting(ctx, marginAlertSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeMarginAlertSettings(&settings); err != nil {
+		return defaultMarginAlertSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateAlertSettings applies a partial update
+func (s *ChannelMarginService) UpdateAlertSettings(ctx context.Context, in MarginAlertSettingsInput) (MarginAlertSettings, error) {
+	settings, err := s.GetAlertSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.WindowHours != nil {
+		settings.WindowHours = *in.WindowHours
+	}
+	if in.MarginRate != nil {
+		settings.MarginRate = *in.MarginRate
+	}
+	if in.MinCostUSD != nil {
+		settings.MinCostUSD = *in.MinCostUSD
+	}
+	if in.CooldownHours != nil {
+		settings.CooldownHours = *in.CooldownHours
+	}
+	if err := normalizeMarginAlertSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, marginAlertSettingsKey, settings)
+}
+
+func ensureMarginAlertTables(ctx context.Context, db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS margin_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			model_name TEXT NOT NULL,
+			window_hours INTEGER NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			revenue_usd REAL NOT NULL DEFAULT 0,
+			cost_usd REAL NOT NULL DEFAULT 0,
+			margin_usd REAL NOT NULL DEFAULT 0,
+			margin_rate REAL,
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_margin_alerts_model ON margin_alerts(model_name, created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openMarginAlertStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMarginAlertTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// belowMarginThreshold reports whether a model's priced revenue fails to
+// cover its cost plus the configured margin; zero revenue with a cost counts
+func belowMarginThreshold(revenue, cost float64, settings MarginAlertSettings) bool {
+	if cost <= 0 || cost < settings.MinCostUSD {
+		return false
+	}
+	return revenue-cost < revenue*settings.MarginRate/100
+}
+
+// CheckAlerts computes per-model margin over the configured window and raises
+// an alert for every priced model below the threshold that was not alerted
+// within the cooldown. Returns the raised alerts.
+func (s *ChannelMarginService) CheckAlerts(ctx context.Context) ([]MarginAlert, error) {
+	marginAlertMu.Lock()
+	defer marginAlertMu.Unlock()
+
+	settings, err := s.GetAlertSettings(ctx)
+	if err != nil || !settings.Enabled {
+		return nil, err
+	}
+	table, err := s.GetCostTable(ctx)
+	if err != nil || len(table.Models) == 0 {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	rows, err := s.usageRows(now - int64(settings.WindowHours)*3600)
+	if err != nil {
+		return nil, err
+	}
+	models, _ := computeChannelMargin(rows, table, nil)["models"].([]map[string]interface{})
+
+	db, err := openMarginAlertStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	raised := []MarginAlert{}
+	for _, m := range models {
+		if priced, _ := m["priced"].(bool); !priced {
+			continue
+		}
+		revenue, cost := toFloat64(m["priced_revenue"]), toFloat64(m["cost_usd"])
+		if !belowMarginThreshold(revenue, cost, settings) {
+			continue
+		}
+		alert := MarginAlert{
+			ModelName:   toString(m["model_name"]),
+			WindowHours: settings.WindowHours,
+			Requests:    toInt64(m["requests"]),
+			RevenueUSD:  revenue,
+			CostUSD:     cost,
+			MarginUSD:   toFloat64(m["margin_usd"]),
+			CreatedAt:   now,
+		}
+		if rate, ok := m["margin_rate"].(float64); ok {
+			alert.MarginRate = &rate
+		}
+
+		var recent int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM margin_alerts WHERE model_name = ? AND created_at > ?`,
+			alert.ModelName, now-int64(settings.CooldownHours)*3600).Scan(&recent); err != nil {
+			return raised, err
+		}
+		if recent > 0 {
+			continue
+		}
+		var rate interface{}
+		if alert.MarginRate != nil {
+			rate = *alert.MarginRate
+		}
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO margin_alerts (model_name, window_hours, requests, revenue_usd, cost_usd, margin_usd, margin_rate, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, alert.ModelName, alert.WindowHours, alert.Requests,
+			alert.RevenueUSD, alert.CostUSD, alert.MarginUSD, rate, alert.CreatedAt)
+		if err != nil {
+			return raised, err
+		}
+		alert.ID, _ = res.LastInsertId()
+		raised = append(raised, alert)
+		PublishEvent(EventNegativeMargin, map[string]interface{}{
+			"id":           alert.ID,
+			"model_name":   alert.ModelName,
+			"window_hours": alert.WindowHours,
+			"revenue_usd":  alert.RevenueUSD,
+			"cost_usd":     alert.CostUSD,
+			"margin_usd":   alert.MarginUSD,
+			"margin_rate":  rate,
+		})
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM margin_alerts WHERE created_at < ?`,
+		now-marginAlertRetentionDays*86400); err != nil {
+		logger.L.Warn("[毛利告警] 清理历史失败: " + err.Error())
+	}
+	sort.Slice(raised, func(i, j int) bool { return raised[i].MarginUSD < raised[j].MarginUSD })
+	return raised, nil
+}
+
+// ListAlerts returns raised alerts, newest first, optionally for one model
+func (s *ChannelMarginService) ListAlerts(ctx context.Context, model string, limit, offset int) ([]MarginAlert, int64, error) {
+	db, err := openMarginAlertStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+	where, args := "", []interface{}{}
+	if model != "" {
+		where, args = "WHERE model_name = ?", append(args, model)
+	}
+	var total int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM margin_alerts `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, model_name, window_hours, requests, revenue_usd, cost_usd, margin_usd, margin_rate, created_at
+		FROM margin_alerts `+where+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items := []MarginAlert{}
+	for rows.Next() {
+		var a MarginAlert
+		var rate sql.NullFloat64
+		if err := rows.Scan(&a.ID, &a.ModelName, &a.WindowHours, &a.Requests, &a.RevenueUSD,
+			&a.CostUSD, &a.MarginUSD, &rate, &a.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if rate.Valid {
+			a.MarginRate = &rate.Float64
+		}
+		items = append(items, a)
+	}
+	return items, total, rows.Err()
+}
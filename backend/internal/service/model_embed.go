@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+// Top-models embed windows
+var (
+	AvailableTopModelsWindows = []string{"24h", "7d", "30d"}
+	DefaultTopModelsWindow    = "7d"
+)
+
+// EmbedPagePath is the path of the embed page under BASE_PATH, used to build
+// the iframe URLs shown to admins
+func EmbedPagePath() string {
+	return config.BasePath() + "/embed.html"
+}
+
+var topModelsWindowSeconds = map[string]int64{
+	"24h": 86400,
+	"7d":  7 * 86400,
+	"30d": 30 * 86400,
+}
+
+// GetTopModels 返回窗口内请求量最高的模型（仅模型名与计数，不含任何用户数据），
+// 供公开嵌入的"本周热门模型"图表使用
+func (s *ModelStatusService) GetTopModels(window string, limit int) (map[string]interface{}, error) {
+	seconds, ok := topModelsWindowSeconds[window]
+	if !ok {
+		window = DefaultTopModelsWindow
+		seconds = topModelsWindowSeconds[window]
+	}
+	cacheKey := cache.Key("model_status:top_models:%s:%d", window, limit)
+	cm := cache.Get()
+	var cached map[string]interface{}
+	if found, _ := cm.GetJSON(cacheKey, &cached); found {
+		return cached, nil
+	}
+
+	since := time.Now().Unix() - seconds
+	rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT model_name, COUNT(*) as requests
+		FROM logs
+		WHERE created_at >= ? AND type = `+ltConsume()+` AND model_name != ''
+		GROUP BY model_name
+		ORDER BY requests DESC`), since)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, r := range rows {
+		total += toInt64(r["requests"])
+	}
+	items := make([]map[string]interface{}, 0, limit)
+	var othersRequests int64
+	for i, r := range rows {
+		requests := toInt64(r["requests"])
+		if i >= limit {
+			othersRequests += requests
+			continue
+		}
+		share := 0.0
+		if total > 0 {
+			share = roundRate(float64(requests) / float64(total) * 100)
+		}
+		items = append(items, map[string]interface{}{
+			"model_name": toString(r["model_name"]),
+			"requests":   requests,
+			"share":      share,
+		})
+	}
+
+	result := map[string]interface{}{
+		"window":          window,
+		"models":          items,
+		"total_requests":  total,
+		"others_requests": othersRequests,
+		"generated_at":    time.Now().Unix(),
+	}
+	cm.Set(cacheKey, result, 10*time.Minute)
+	return result, nil
+}
+
+// GetEmbedToken returns the access token required by public embeds ("" = open)
+func (s *ModelStatusService) GetEmbedToken() string {
+	var token string
+	cache.Get().GetJSON("model_status:embed_token", &token)
+	return token
+}
+
+// SetEmbedToken saves the embed access token; "" disables the check
+func (s *ModelStatusService) SetEmbedToken(token string) {
+	cache.Get().Set("model_status:embed_token", token, 0)
+}
+
+// CheckEmbedToken reports whether a caller-supplied token may read the embeds
+func (s *ModelStatusService) CheckEmbedToken(token string) bool {
+	expected := s.GetEmbedToken()
+	if expected == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestGetTopModelsRanksCountsOnly(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+		model_name TEXT, type INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	insert := func(model string, typ int, ts int64, n int) {
+		for i := 0; i < n; i++ {
+			db.MustExec(`INSERT INTO logs (user_id, username, model_name, type, created_at) VALUES (1, 'alice', ?, ?, ?)`, model, typ, ts)
+		}
+	}
+	insert("gpt-4o", 2, now-3600, 5)
+	insert("claude", 2, now-3600, 3)
+	insert("gemini", 2, now-3600, 2)
+	insert("gemini", 5, now-3600, 4)     // failures are not usage
+	insert("gpt-4o", 2, now-10*86400, 9) // outside 7d
+
+	data, err := NewModelStatusService().GetTopModels("bogus", 2)
+	if err != nil {
+		t.Fatalf("GetTopModels: %v", err)
+	}
+	if data["window"] != DefaultTopModelsWindow {
+		t.Fatalf("unknown window should fall back to %s, got %v", DefaultTopModelsWindow, data["window"])
+	}
+	items := data["models"].([]map[string]interface{})
+	if len(items) != 2 || items[0]["model_name"] != "gpt-4o" || toInt64(items[0]["requests"]) != 5 || items[1]["model_name"] != "claude" {
+		t.Fatalf("unexpected ranking: %v", items)
+	}
+	if toInt64(data["total_requests"]) != 10 || toInt64(data["others_requests"]) != 2 || items[0]["share"] != 50.0 {
+		t.Fatalf("unexpected totals: %v", data)
+	}
+	for _, it := range items {
+		if len(it) != 3 {
+			t.Fatalf("embed rows must only carry model_name/requests/share, got %v", it)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+// LatencyTimeWindows are the windows accepted by the latency endpoints; the
+// short ones share slot layout with model status, the long ones add coarser slots
+var LatencyTimeWindows = []string{"1h", "6h", "12h", "24h", "3d", "7d"}
+
+var latencyWindowConfigs = map[string]timeWindowConfig{
+	"3d": {259200, 36, 7200},  // 3 days, 36 slots, 2 hours each
+	"7d": {604800, 28, 21600}, // 7 days, 28 slots, 6 hours each
+}
+
+func latencyWindowConfig(window string) (timeWindowConfig, bool) {
+	if cfg, ok := timeWindowConfigs[window]; ok {
+		return cfg, true
+	}
+	cfg, ok := latencyWindowConfigs[window]
+	return cfg, ok
+}
+
+// LatencyStats summarises a use_time distribution (seconds). Percentiles use
+// the nearest-rank method, so they are always an observed value.
+type LatencyStats struct {
+	Requests int64   `json:"requests"`
+	Avg      float64 `json:"avg"`
+	P50      int64   `json:"p50"`
+	P90      int64   `json:"p90"`
+	P99      int64   `json:"p99"`
+	Max      int64   `json:"max"`
+}
+
+// LatencySlot is one time-series point of GetModelLatency
+type LatencySlot struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	LatencyStats
+}
+
+// ModelLatency is one row of GetLatencyOverview
+type ModelLatency struct {
+	ModelName string `json:"model_name"`
+	LatencyStats
+}
+
+// latencyHistogram counts requests per whole-second use_time. NewAPI stores
+// use_time as integer seconds, so grouping on it keeps results small and
+// percentiles exact on every database.
+type latencyHistogram map[int64]int64
+
+func (h latencyHistogram) stats() LatencyStats {
+	var st LatencyStats
+	values := make([]int64, 0, len(h))
+	var sum int64
+	for v, n := range h {
+		values = append(values, v)
+		st.Requests += n
+		sum += v * n
+	}
+	if st.Requests == 0 {
+		return st
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	st.Avg = roundRate(float64(sum) / float64(st.Requests))
+	st.Max = values[len(values)-1]
+	rank := func(p float64) int64 {
+		target := int64(float64(st.Requests)*p + 0.999999)
+		if target < 1 {
+			target = 1
+		}
+		var seen int64
+		for _, v := range values {
+			seen += h[v]
+			if seen >= target {
+				return v
+			}
+		}
+		return st.Max
+	}
+	st.P50, st.P90, st.P99 = rank(0.5), rank(0.9), rank(0.99)
+	return st
+}
+
+// GetModelLatency returns p50/p90/p99 of successful requests for one model,
+// per slot and over the whole window, plus the previous window for comparison
+func (s *ModelStatusService) GetModelLatency(modelName, window string) (map[string]interface{}, error) {
+	twConfig, ok := latencyWindowConfig(window)
+	if !ok {
+		window, twConfig = DefaultTimeWindow, timeWindowConfigs[DefaultTimeWindow]
+	}
+	cacheKey := cache.Key("model_status:latency:%s:%s", modelName, window)
+	var cached map[string]interface{}
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found && cached != nil {
+		return cached, nil
+	}
+
+	now := time.Now().Unix()
+	startTime := now - twConfig.totalSeconds
+	rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT FLOOR((created_at - %d) / %d) as slot_idx, COALESCE(use_time, 0) as use_time, COUNT(*) as cnt
+		FROM logs
+		WHERE model_name = ? AND type = `+ltConsume()+` AND created_at >= ? AND created_at < ?
+		GROUP BY FLOOR((created_at - %d) / %d), COALESCE(use_time, 0)`,
+		startTime, twConfig.slotSeconds, startTime, twConfig.slotSeconds)),
+		modelName, startTime, now)
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]latencyHistogram, twConfig.numSlots)
+	overall := latencyHistogram{}
+	for _, row := range rows {
+		idx := toInt64(row["slot_idx"])
+		if idx < 0 || idx >= int64(twConfig.numSlots) {
+			continue
+		}
+		if slots[idx] == nil {
+			slots[idx] = latencyHistogram{}
+		}
+		v, n := toInt64(row["use_time"]), toInt64(row["cnt"])
+		slots[idx][v] += n
+		overall[v] += n
+	}
+
+	previous := latencyHistogram{}
+	prevRows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT COALESCE(use_time, 0) as use_time, COUNT(*) as cnt
+		FROM logs
+		WHERE model_name = ? AND type = `+ltConsume()+` AND created_at >= ? AND created_at < ?
+		GROUP BY COALESCE(use_time, 0)`), modelName, startTime-twConfig.totalSeconds, startTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range prevRows {
+		previous[toInt64(row["use_time"])] += toInt64(row["cnt"])
+	}
+
+	series := make([]LatencySlot, twConfig.numSlots)
+	for i := range series {
+		slotStart := startTime + int64(i)*twConfig.slotSeconds
+		series[i] = LatencySlot{Start: slotStart, End: slotStart + twConfig.slotSeconds, LatencyStats: slots[i].stats()}
+	}
+	result := map[string]interface{}{
+		"model_name":   modelName,
+		"time_window":  window,
+		"slot_seconds": twConfig.slotSeconds,
+		"summary":      overall.stats(),
+		"previous":     previous.stats(),
+		"slots":        series,
+	}
+	cache.Get().Set(cacheKey, result, time.Minute)
+	return result, nil
+}
+
+// GetLatencyOverview returns window percentiles for the busiest models
+func (s *ModelStatusService) GetLatencyOverview(window string, limit int) (map[string]interface{}, error) {
+	twConfig, ok := latencyWindowConfig(window)
+	if !ok {
+		window, twConfig = DefaultTimeWindow, timeWindowConfigs[DefaultTimeWindow]
+	}
+	cacheKey := cache.Key("model_status:latency_overview:%s:%d", window, limit)
+	var cached map[string]interface{}
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found && cached != nil {
+		return cached, nil
+	}
+
+	startTime := time.Now().Unix() - twConfig.totalSeconds
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(`
+		SELECT model_name, COALESCE(use_time, 0) as use_time, COUNT(*) as cnt
+		FROM logs
+		WHERE type = `+ltConsume()+` AND model_name != '' AND created_at >= ?
+		GROUP BY model_name, COALESCE(use_time, 0)`), startTime)
+	if err != nil {
+		return nil, err
+	}
+	byModel := map[string]latencyHistogram{}
+	for _, row := range rows {
+		name := toString(row["model_name"])
+		if byModel[name] == nil {
+			byModel[name] = latencyHistogram{}
+		}
+		byModel[name][toInt64(row["use_time"])] += toInt64(row["cnt"])
+	}
+	items := make([]ModelLatency, 0, len(byModel))
+	for name, h := range byModel {
+		items = append(items, ModelLatency{ModelName: name, LatencyStats: h.stats()})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Requests != items[j].Requests {
+			return items[i].Requests > items[j].Requests
+		}
+		return items[i].ModelName < items[j].ModelName
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	result := map[string]interface{}{"time_window": window, "models": items}
+	cache.Get().Set(cacheKey, result, time.Minute)
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	// 90 fast requests and a slow tail an average hides
+	h := latencyHistogram{1: 90, 5: 9, 40: 1}
+	st := h.stats()
+	if st.Requests != 100 || st.P50 != 1 || st.P90 != 1 || st.P99 != 5 || st.Max != 40 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if st.Avg != 1.75 {
+		t.Fatalf("avg = %v, want 1.75", st.Avg)
+	}
+	if empty := (latencyHistogram{}).stats(); empty.Requests != 0 || empty.P99 != 0 {
+		t.Fatalf("empty histogram should be zero, got %+v", empty)
+	}
+}
+
+func TestGetModelLatencySeries(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, model_name TEXT, type INTEGER,
+		use_time INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	now := time.Now().Unix()
+	insert := func(model string, typ int, useTime, at int64) {
+		if _, err := db.Exec(`INSERT INTO logs (model_name, type, use_time, created_at) VALUES (?, ?, ?, ?)`,
+			model, typ, useTime, at); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		insert("gpt-x", 2, 2, now-300)       // current window, last slot
+		insert("gpt-x", 2, 1, now-86400-300) // previous window
+	}
+	insert("gpt-x", 2, 30, now-300)
+	insert("gpt-x", 5, 99, now-300) // failures are excluded
+	insert("other", 2, 7, now-300)
+
+	svc := NewModelStatusService()
+	data, err := svc.GetModelLatency("gpt-x", "24h")
+	if err != nil {
+		t.Fatalf("GetModelLatency: %v", err)
+	}
+	summary := data["summary"].(LatencyStats)
+	if summary.Requests != 21 || summary.P50 != 2 || summary.P99 != 30 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if prev := data["previous"].(LatencyStats); prev.Requests != 20 || prev.P90 != 1 {
+		t.Fatalf("unexpected previous window %+v", prev)
+	}
+	slots := data["slots"].([]LatencySlot)
+	if len(slots) != 24 || slots[23].Requests != 21 || slots[0].Requests != 0 {
+		t.Fatalf("requests should land in the last slot, got %+v", slots[23])
+	}
+
+	overview, err := svc.GetLatencyOverview("24h", 10)
+	if err != nil {
+		t.Fatalf("GetLatencyOverview: %v", err)
+	}
+	if n := len(overview["models"].([]ModelLatency)); n != 2 {
+		t.Fatalf("overview should list 2 models, got %d", n)
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+// ModelMatrixCell is the traffic of one model on one channel
+type ModelMatrixCell struct {
+	ChannelID     int64   `json:"channel_id"`
+	ModelName     string  `json:"model_name"`
+	TotalRequests int64   `json:"total_requests"`
+	SuccessCount  int64   `json:"success_count"`
+	SuccessRate   float64 `json:"success_rate"`
+	AvgLatency    float64 `json:"avg_latency"` // 成功请求的平均 use_time（秒）
+	Status        string  `json:"status"`      // green / yellow / red，同模型状态页
+}
+
+// ModelMatrixChannel is one row of the matrix
+type ModelMatrixChannel struct {
+	ChannelID     int64   `json:"channel_id"`
+	ChannelName   string  `json:"channel_name"`
+	ChannelStatus int64   `json:"channel_status"` // NewAPI 渠道状态：1 启用，2 手动禁用，3 自动禁用
+	TotalRequests int64   `json:"total_requests"`
+	SuccessRate   float64 `json:"success_rate"`
+	Status        string  `json:"status"`
+}
+
+// ModelMatrixModel is one column of the matrix
+type ModelMatrixModel struct {
+	ModelName     string  `json:"model_name"`
+	TotalRequests int64   `json:"total_requests"`
+	SuccessRate   float64 `json:"success_rate"`
+	Status        string  `json:"status"`
+}
+
+// ModelMatrix is the channels × models availability grid; cells without
+// traffic are omitted
+type ModelMatrix struct {
+	TimeWindow  string               `json:"time_window"`
+	Channels    []ModelMatrixChannel `json:"channels"`
+	Models      []ModelMatrixModel   `json:"models"`
+	Cells       []ModelMatrixCell    `json:"cells"`
+	GeneratedAt int64                `json:"generated_at"`
+}
+
+type matrixAgg struct {
+	total, success, useTime int64
+}
+
+func (a *matrixAgg) add(o matrixAgg) {
+	a.total += o.total
+	a.success += o.success
+	a.useTime += o.useTime
+}
+
+func (a matrixAgg) successRate() float64 {
+	if a.total == 0 {
+		return 100
+	}
+	return roundRate(float64(a.success) / float64(a.total) * 100)
+}
+
+// GetModelMatrix returns the success rate and average latency of every
+// (channel, model) pair with traffic in the window, so a channel failing for
+// a single model stands out. Only the `limit` busiest models are kept unless
+// models names them explicitly. Rows and columns are ordered by traffic.
+func (s *ModelStatusService) GetModelMatrix(window string, models []string, limit int) (*ModelMatrix, error) {
+	twConfig, ok := latencyWindowConfig(window)
+	if !ok {
+		window, twConfig = DefaultTimeWindow, timeWindowConfigs[DefaultTimeWindow]
+	}
+	wanted := []string{}
+	for _, m := range models {
+		if m = strings.TrimSpace(m); m != "" {
+			wanted = appendUniqueString(wanted, m)
+		}
+	}
+	sort.Strings(wanted)
+	cacheKey := cache.Key("model_status:matrix:%s:%d:%s", window, limit, strings.Join(wanted, ","))
+	var cached ModelMatrix
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found {
+		return &cached, nil
+	}
+
+	where, args := "type IN ("+ltRequests()+") AND model_name != '' AND created_at >= ?", []interface{}{time.Now().Unix() - twConfig.totalSeconds}
+	if len(wanted) > 0 {
+		where += " AND model_name IN (" + placeholders(len(wanted)) + ")"
+		for _, m := range wanted {
+			args = append(args, m)
+		}
+	}
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT COALESCE(channel_id, 0) as channel_id, model_name,
+			COUNT(*) as total,
+			SUM(CASE WHEN type = %s THEN 1 ELSE 0 END) as success,
+			SUM(CASE WHEN type = %s THEN COALESCE(use_time, 0) ELSE 0 END) as use_time
+		FROM logs
+		WHERE %s
+		GROUP BY COALESCE(channel_id, 0), model_name`, ltConsume(), ltConsume(), where)), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	byModel := map[string]*matrixAgg{}
+	for _, r := range rows {
+		name := toString(r["model_name"])
+		if byModel[name] == nil {
+			byModel[name] = &matrixAgg{}
+		}
+		byModel[name].add(matrixAgg{total: toInt64(r["total"]), success: toInt64(r["success"])})
+	}
+	modelNames := make([]string, 0, len(byModel))
+	for name := range byModel {
+		modelNames = append(modelNames, name)
+	}
+	sort.Slice(modelNames, func(i, j int) bool {
+		a, b := byModel[modelNames[i]], byModel[modelNames[j]]
+		if a.total != b.total {
+			return a.total > b.total
+		}
+		return modelNames[i] < modelNames[j]
+	})
+	if len(wanted) == 0 && len(modelNames) > limit {
+		modelNames = modelNames[:limit]
+	}
+	kept := make(map[string]bool, len(modelNames))
+	matrix := &ModelMatrix{TimeWindow: window, Models: make([]ModelMatrixModel, 0, len(modelNames)),
+		Channels: []ModelMatrixChannel{}, Cells: []ModelMatrixCell{}, GeneratedAt: time.Now().Unix()}
+	for _, name := range modelNames {
+		kept[name] = true
+		agg := byModel[name]
+		matrix.Models = append(matrix.Models, ModelMatrixModel{ModelName: name, TotalRequests: agg.total,
+			SuccessRate: agg.successRate(), Status: getStatusColor(agg.successRate(), agg.total)})
+	}
+
+	byChannel := map[int64]*matrixAgg{}
+	for _, r := range rows {
+		name := toString(r["model_name"])
+		if !kept[name] {
+			continue
+		}
+		cell := matrixAgg{total: toInt64(r["total"]), success: toInt64(r["success"]), useTime: toInt64(r["use_time"])}
+		channelID := toInt64(r["channel_id"])
+		if byChannel[channelID] == nil {
+			byChannel[channelID] = &matrixAgg{}
+		}
+		byChannel[channelID].add(cell)
+		var avgLatency float64
+		if cell.success > 0 {
+			avgLatency = round2(float64(cell.useTime) / float64(cell.success))
+		}
+		matrix.Cells = append(matrix.Cells, ModelMatrixCell{ChannelID: channelID, ModelName: name,
+			TotalRequests: cell.total, SuccessCount: cell.success, SuccessRate: cell.successRate(),
+			AvgLatency: avgLatency, Status: getStatusColor(cell.successRate(), cell.total)})
+	}
+
+	channelInfo := map[int64]map[string]interface{}{}
+	if chRows, err := s.db.Query(`SELECT id, name, status FROM channels`); err == nil {
+		for _, r := range chRows {
+			channelInfo[toInt64(r["id"])] = r
+		}
+	}
+	for id, agg := range byChannel {
+		ch := ModelMatrixChannel{ChannelID: id, TotalRequests: agg.total, SuccessRate: agg.successRate(),
+			Status: getStatusColor(agg.successRate(), agg.total)}
+		if info, ok := channelInfo[id]; ok {
+			ch.ChannelName, ch.ChannelStatus = toString(info["name"]), toInt64(info["status"])
+		}
+		matrix.Channels = append(matrix.Channels, ch)
+	}
+	sort.Slice(matrix.Channels, func(i, j int) bool {
+		a, b := matrix.Channels[i], matrix.Channels[j]
+		if a.TotalRequests != b.TotalRequests {
+			return a.TotalRequests > b.TotalRequests
+		}
+		return a.ChannelID < b.ChannelID
+	})
+	sort.Slice(matrix.Cells, func(i, j int) bool {
+		a, b := matrix.Cells[i], matrix.Cells[j]
+		if a.ChannelID != b.ChannelID {
+			return a.ChannelID < b.ChannelID
+		}
+		return a.ModelName < b.ModelName
+	})
+
+	cache.Get().Set(cacheKey, matrix, time.Minute)
+	return matrix, nil
+}
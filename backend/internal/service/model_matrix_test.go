@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestGetModelMatrix(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { cache.Get().DeleteByPrefix(cache.Key("model_status:matrix:")) })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT, status INTEGER);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, channel_id INTEGER, model_name TEXT, type INTEGER,
+			use_time INTEGER, created_at INTEGER);
+		INSERT INTO channels VALUES (1, 'main', 1), (2, 'backup', 3);`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	insert := func(channel int64, model string, typ int, useTime int64, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := db.Exec(`INSERT INTO logs (channel_id, model_name, type, use_time, created_at) VALUES (?, ?, ?, ?, ?)`,
+				channel, model, typ, useTime, now-300); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	insert(1, "gpt-4o", 2, 2, 10)
+	insert(1, "claude", 2, 4, 4)
+	insert(2, "gpt-4o", 2, 3, 2) // backup fails gpt-4o 3 out of 5
+	insert(2, "gpt-4o", 5, 9, 3)
+	insert(2, "rare", 2, 1, 1)
+
+	svc := NewModelStatusService()
+	m, err := svc.GetModelMatrix("24h", nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Models) != 2 || m.Models[0].ModelName != "gpt-4o" || m.Models[0].TotalRequests != 15 || m.Models[1].ModelName != "claude" {
+		t.Fatalf("models = %+v", m.Models)
+	}
+	if len(m.Channels) != 2 || m.Channels[0].ChannelName != "main" || m.Channels[1].ChannelStatus != 3 || m.Channels[1].TotalRequests != 5 {
+		t.Errorf("channels = %+v", m.Channels)
+	}
+	if len(m.Cells) != 3 {
+		t.Fatalf("cells = %+v", m.Cells)
+	}
+	if c := m.Cells[2]; c.ChannelID != 2 || c.ModelName != "gpt-4o" || c.SuccessRate != 40 || c.Status != "red" || c.AvgLatency != 3 {
+		t.Errorf("backup gpt-4o = %+v", c)
+	}
+	if c := m.Cells[1]; c.ChannelID != 1 || c.ModelName != "gpt-4o" || c.SuccessRate != 100 || c.Status != "green" {
+		t.Errorf("main gpt-4o = %+v", c)
+	}
+
+	// explicit models bypass the limit
+	if m, err = svc.GetModelMatrix("24h", []string{"rare", " "}, 1); err != nil || len(m.Models) != 1 || len(m.Cells) != 1 || m.Cells[0].ChannelID != 2 {
+		t.Errorf("rare only = %+v, %v", m, err)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -74,12 +75,19 @@ func NewModelStatusService() *ModelStatusService {
 	return &ModelStatusService{db: database.Get(), logDB: database.GetLog()}
 }
 
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *ModelStatusService) WithContext(ctx context.Context) *ModelStatusService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
 // GetAvailableModels returns all models with 24h request counts
 func (s *ModelStatusService) GetAvailableModels() ([]map[string]interface{}, error) {
 	cm := cache.Get()
 	var cached []map[string]interface{}
-	found, _ := cm.GetJSON("model_status:available_models", &cached)
-	if found {
+	found, _ := cm.GetJSON(cache.Key("model_status:available_models"), &cached)
+	if found && cached != nil {
 		return cached, nil
 	}
 
@@ -88,7 +96,7 @@ func (s *ModelStatusService) GetAvailableModels() ([]map[string]interface{}, err
 	query := s.logDB.RebindQuery(`
 		SELECT model_name, COUNT(*) as request_count_24h
 		FROM logs
-		WHERE type IN (2, 5) AND model_name != '' AND created_at >= ?
+		WHERE type IN (` + ltRequests() + `) AND model_name != '' AND created_at >= ?
 		GROUP BY model_name
 		ORDER BY request_count_24h DESC`)
 
@@ -96,15 +104,18 @@ func (s *ModelStatusService) GetAvailableModels() ([]map[string]interface{}, err
 	if err != nil {
 		return nil, err
 	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
 
-	cm.Set("model_status:available_models", rows, 5*time.Minute)
+	cm.Set(cache.Key("model_status:available_models"), rows, 5*time.Minute)
 	return rows, nil
 }
 
 // GetModelStatus returns status for a specific model
 // Uses a single GROUP BY FLOOR query (matches Python backend optimization)
 func (s *ModelStatusService) GetModelStatus(modelName, window string) (map[string]interface{}, error) {
-	cacheKey := fmt.Sprintf("model_status:%s:%s", modelName, window)
+	cacheKey := cache.Key("model_status:%s:%s", modelName, window)
 	cm := cache.Get()
 	var cached map[string]interface{}
 	found, _ := cm.GetJSON(cacheKey, &cached)
@@ -134,13 +145,13 @@ func (s *ModelStatusService) GetModelStatus(modelName, window string) (map[strin
 	slotQuery := s.logDB.RebindQuery(fmt.Sprintf(`
 		SELECT FLOOR((created_at - %d) / %d) as slot_idx,
 			COUNT(*) as total,
-			SUM(CASE WHEN type = 2 AND completion_tokens > 0 THEN 1 ELSE 0 END) as success,
-			SUM(CASE WHEN type = 5 THEN 1 ELSE 0 END) as failure,
-			SUM(CASE WHEN type = 2 AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty
+			SUM(CASE WHEN type = `+ltConsume()+` AND completion_tokens > 0 THEN 1 ELSE 0 END) as success,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failure,
+			SUM(CASE WHEN type = `+ltConsume()+` AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty
 		FROM logs
 		WHERE model_name = ?
 			AND created_at >= ? AND created_at < ?
-			AND type IN (2, 5)
+			AND type IN (`+ltRequests()+`)
 		GROUP BY FLOOR((created_at - %d) / %d)`,
 		startTime, slotSeconds,
 		startTime, slotSeconds))
@@ -233,6 +244,24 @@ func (s *ModelStatusService) GetModelStatus(modelName, window string) (map[strin
 		"success_rate":   roundRate(overallRate),
 		"current_status": getStatusColor(overallRate, totalReqs),
 		"slot_data":      slotData,
+		"in_maintenance": false,
+	}
+
+	// 维护窗口内照常返回统计，但标记维护中（状态变化事件由可用率快照任务推送）
+	var activeMaintenance *MaintenanceWindow
+	for _, w := range loadMaintenanceSchedule(context.Background(), now, now+1) {
+		if containsStr(w.Models, modelName) {
+			activeMaintenance = &w
+			break
+		}
+	}
+	if activeMaintenance != nil {
+		result["in_maintenance"] = true
+		result["maintenance"] = map[string]interface{}{
+			"title":     activeMaintenance.Title,
+			"starts_at": activeMaintenance.StartsAt,
+			"ends_at":   activeMaintenance.EndsAt,
+		}
 	}
 
 	cm.Set(cacheKey, result, 30*time.Second)
@@ -273,8 +302,8 @@ func (s *ModelStatusService) GetAllModelsStatus(window string) ([]map[string]int
 func (s *ModelStatusService) GetTokenGroups() ([]map[string]interface{}, error) {
 	cm := cache.Get()
 	var cached []map[string]interface{}
-	found, _ := cm.GetJSON("model_status:token_groups", &cached)
-	if found {
+	found, _ := cm.GetJSON(cache.Key("model_status:token_groups"), &cached)
+	if found && cached != nil {
 		return cached, nil
 	}
 
@@ -336,7 +365,7 @@ func (s *ModelStatusService) GetTokenGroups() ([]map[string]interface{}, error)
 		results = append(results, entry)
 	}
 
-	cm.Set("model_status:token_groups", results, 5*time.Minute)
+	cm.Set(cache.Key("model_status:token_groups"), results, 5*time.Minute)
 	return results, nil
 }
 
@@ -401,11 +430,8 @@ func (s *ModelStatusService) getGroupCol() string {
 func (s *ModelStatusService) GetSelectedModels() []string {
 	cm := cache.Get()
 	var models []string
-	found, _ := cm.GetJSON("model_status:selected_models", &models)
-	if found {
-		return models
-	}
-	return []string{}
+	cm.GetJSON("model_status:selected_models", &models)
+	return nonNilStrings(models)
 }
 
 // SetSelectedModels saves selected models to cache
@@ -418,51 +444,31 @@ func (s *ModelStatusService) SetSelectedModels(models []string) {
 func (s *ModelStatusService) GetConfig() map[string]interface{} {
 	cm := cache.Get()
 
+	// Missing, null or out-of-range values fall back to defaults so the
+	// embed page always receives every key in EmbedConfigKeys
 	var timeWindow string
-	found, _ := cm.GetJSON("model_status:time_window", &timeWindow)
-	if !found {
-		timeWindow = DefaultTimeWindow
-	}
+	cm.GetJSON("model_status:time_window", &timeWindow)
 
 	var theme string
-	found, _ = cm.GetJSON("model_status:theme", &theme)
-	if !found {
-		theme = DefaultTheme
-	}
-	// Map legacy theme names to valid ones
-	if mapped, ok := LegacyThemeMap[theme]; ok {
-		theme = mapped
-	}
+	cm.GetJSON("model_status:theme", &theme)
 
-	var refreshInterval int
-	found, _ = cm.GetJSON("model_status:refresh_interval", &refreshInterval)
-	if !found {
-		refreshInterval = 60
-	}
+	refreshInterval := defaultRefreshInterval
+	cm.GetJSON("model_status:refresh_interval", &refreshInterval)
 
 	var sortMode string
-	found, _ = cm.GetJSON("model_status:sort_mode", &sortMode)
-	if !found {
-		sortMode = "default"
-	}
+	cm.GetJSON("model_status:sort_mode", &sortMode)
 
 	var customOrder []string
 	cm.GetJSON("model_status:custom_order", &customOrder)
 
-	var customGroups []map[string]interface{}
-	found, _ = cm.GetJSON("model_status:custom_groups", &customGroups)
-	if !found {
-		customGroups = []map[string]interface{}{}
-	}
-
 	return map[string]interface{}{
-		"time_window":      timeWindow,
-		"theme":            theme,
-		"refresh_interval": refreshInterval,
-		"sort_mode":        sortMode,
-		"custom_order":     customOrder,
+		"time_window":      normalizeEmbedTimeWindow(timeWindow),
+		"theme":            normalizeEmbedTheme(theme),
+		"refresh_interval": normalizeEmbedRefreshInterval(refreshInterval),
+		"sort_mode":        normalizeEmbedSortMode(sortMode),
+		"custom_order":     nonNilStrings(customOrder),
 		"selected_models":  s.GetSelectedModels(),
-		"custom_groups":    customGroups,
+		"custom_groups":    s.GetCustomGroups(),
 		"site_title":       s.GetSiteTitle(),
 	}
 }
@@ -501,11 +507,8 @@ func (s *ModelStatusService) SetCustomOrder(order []string) {
 func (s *ModelStatusService) GetCustomGroups() []map[string]interface{} {
 	cm := cache.Get()
 	var groups []map[string]interface{}
-	found, _ := cm.GetJSON("model_status:custom_groups", &groups)
-	if found {
-		return groups
-	}
-	return []map[string]interface{}{}
+	cm.GetJSON("model_status:custom_groups", &groups)
+	return normalizeEmbedCustomGroups(groups)
 }
 
 // SetCustomGroups saves custom model groups to cache
@@ -538,5 +541,8 @@ func (s *ModelStatusService) GetEmbedConfig() map[string]interface{} {
 	config["available_themes"] = AvailableThemes
 	config["available_refresh_intervals"] = AvailableRefreshIntervals
 	config["available_sort_modes"] = AvailableSortModes
+	config["available_top_models_windows"] = AvailableTopModelsWindows
+	config["token_required"] = s.GetEmbedToken() != ""
+	config["embed_path"] = EmbedPagePath()
 	return config
 }
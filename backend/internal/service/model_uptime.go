@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+const (
+	modelUptimeStateKey = "model_uptime"
+
+	// uptimeSlotSeconds is the snapshot granularity: every slot is up (green),
+	// degraded (yellow) or down (red) by the model status thresholds
+	uptimeSlotSeconds = 300
+	// uptimeSlotWindow labels the model_status_changed events of the snapshot
+	uptimeSlotWindow = "5m"
+	// uptimeSettleSeconds leaves time for long requests to be logged before
+	// their slot is first snapshotted; uptimeRecheckSeconds of recent slots
+	// are recomputed on every run to pick up late logs
+	uptimeSettleSeconds  = 60
+	uptimeRecheckSeconds = 1800
+	// uptimeMaxBackfill bounds how far a run catches up after downtime
+	uptimeMaxBackfill = 86400
+
+	uptimeSlotRetention  = 8 * 24 * time.Hour
+	uptimeDailyRetention = 400 * 24 * time.Hour
+	maxUptimeHistoryDays = 90
+)
+
+// modelUptimeState remembers where the last snapshot stopped
+type modelUptimeState struct {
+	SyncedUntil int64 `json:"synced_until"`
+}
+
+// ModelUptimeDay is one bar of the uptime history. Only slots with traffic
+// are counted; a day without any is reported with status "none".
+type ModelUptimeDay struct {
+	Date             string   `json:"date"`
+	Requests         int64    `json:"requests"`
+	SuccessRate      float64  `json:"success_rate"`
+	Slots            int64    `json:"slots"`
+	DegradedSlots    int64    `json:"degraded_slots"`
+	DownSlots        int64    `json:"down_slots"`
+	MaintenanceSlots int64    `json:"maintenance_slots"` // 维护窗口内的时间槽，不计入降级 / 宕机
+	Uptime           *float64 `json:"uptime"`            // 非 down 时间槽占比（%），无流量为 null
+	Status           string   `json:"status"`            // green / yellow / red / none
+}
+
+// ModelUptimeHistory is the status-page style bar history of one model
+type ModelUptimeHistory struct {
+	ModelName string           `json:"model_name"`
+	Days      int              `json:"days"`
+	Uptime    *float64         `json:"uptime"`
+	Bars      []ModelUptimeDay `json:"bars"`
+}
+
+// ModelUptimeSummary is the SLA of one model over the last 30 and 90 days
+type ModelUptimeSummary struct {
+	ModelName   string   `json:"model_name"`
+	Uptime30d   *float64 `json:"uptime_30d"`
+	Uptime90d   *float64 `json:"uptime_90d"`
+	Requests30d int64    `json:"requests_30d"`
+	DaysTracked int      `json:"days_tracked"`
+}
+
+func ensureModelUptimeTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS model_uptime_slots (
+			model_name TEXT NOT NULL,
+			slot_start INTEGER NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			success INTEGER NOT NULL DEFAULT 0,
+			maintenance INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (model_name, slot_start)
+		);
+		CREATE INDEX IF NOT EXISTS idx_model_uptime_slots_start ON model_uptime_slots(slot_start);
+		CREATE TABLE IF NOT EXISTS model_uptime_daily (
+			model_name TEXT NOT NULL,
+			day TEXT NOT NULL,
+			day_start INTEGER NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			success INTEGER NOT NULL DEFAULT 0,
+			slots INTEGER NOT NULL DEFAULT 0,
+			degraded_slots INTEGER NOT NULL DEFAULT 0,
+			down_slots INTEGER NOT NULL DEFAULT 0,
+			maintenance_slots INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (model_name, day)
+		);
+		CREATE INDEX IF NOT EXISTS idx_model_uptime_daily_start ON model_uptime_daily(day_start)`)
+	if err != nil {
+		return err
+	}
+	if err := ensureSQLiteColumn(ctx, db, "model_uptime_slots", "maintenance", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return ensureSQLiteColumn(ctx, db, "model_uptime_daily", "maintenance_slots", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func openModelUptimeStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureModelUptimeTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// uptimePercent is the share of slots with traffic that were not down
+func uptimePercent(slots, down int64) *float64 {
+	if slots == 0 {
+		return nil
+	}
+	v := roundRate(float64(slots-down) / float64(slots) * 100)
+	return &v
+}
+
+// SnapshotUptime records the per-model request / success counts of every
+// complete 5-minute slot since the last run (at most a day back) and rolls
+// the touched days up into the daily table. Returns the slots written.
+func (s *ModelStatusService) SnapshotUptime(ctx context.Context) (int, error) {
+	return s.snapshotUptimeAt(ctx, time.Now())
+}
+
+func (s *ModelStatusService) snapshotUptimeAt(ctx context.Context, now time.Time) (int, error) {
+	var state modelUptimeState
+	if _, err := loadLocalSetting(ctx, modelUptimeStateKey, &state); err != nil {
+		return 0, err
+	}
+	end := floorDiv(now.Unix()-uptimeSettleSeconds, uptimeSlotSeconds) * uptimeSlotSeconds
+	from := min(state.SyncedUntil, end-uptimeRecheckSeconds)
+	if from < end-uptimeMaxBackfill {
+		from = end - uptimeMaxBackfill
+	}
+
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT model_name, FLOOR((created_at - %d) / %d) as slot_idx,
+			COUNT(*) as requests,
+			SUM(CASE WHEN type = %s THEN 1 ELSE 0 END) as success
+		FROM logs
+		WHERE type IN (%s) AND model_name != '' AND created_at >= ? AND created_at < ?
+		GROUP BY model_name, FLOOR((created_at - %d) / %d)`,
+		from, uptimeSlotSeconds, ltConsume(), ltRequests(), from, uptimeSlotSeconds)), from, end)
+	if err != nil {
+		return 0, err
+	}
+
+	store, err := openModelUptimeStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	tx, err := store.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// 重算区间内的时间槽以日志为准：先清空再写入，被删除或迟到的日志都能反映出来
+	if _, err := tx.ExecContext(ctx, `DELETE FROM model_uptime_slots WHERE slot_start >= ? AND slot_start < ?`, from, end); err != nil {
+		return 0, err
+	}
+	maintenance := loadMaintenanceSchedule(ctx, from, end)
+	for _, r := range rows {
+		slot, model := from+toInt64(r["slot_idx"])*uptimeSlotSeconds, toString(r["model_name"])
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO model_uptime_slots (model_name, slot_start, requests, success, maintenance) VALUES (?, ?, ?, ?, ?)`,
+			model, slot, toInt64(r["requests"]), toInt64(r["success"]),
+			boolToInt(maintenance.modelDuring(model, slot, slot+uptimeSlotSeconds))); err != nil {
+			return 0, err
+		}
+	}
+	for day := reportDayStart(time.Unix(from, 0)); day.Unix() < end; day = day.AddDate(0, 0, 1) {
+		if err := rollupUptimeDay(ctx, tx, day); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM model_uptime_slots WHERE slot_start < ?`,
+		now.Add(-uptimeSlotRetention).Unix()); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM model_uptime_daily WHERE day_start < ?`,
+		now.Add(-uptimeDailyRetention).Unix()); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if err := saveLocalSetting(ctx, modelUptimeStateKey, modelUptimeState{SyncedUntil: end}); err != nil {
+		return len(rows), err
+	}
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("model_status:uptime:"))
+
+	// 最新一个已结算时间槽的状态颜色变化推送 model_status_changed，维护中的模型不推送
+	latest := end - uptimeSlotSeconds
+	for _, r := range rows {
+		slot, model := from+toInt64(r["slot_idx"])*uptimeSlotSeconds, toString(r["model_name"])
+		if slot != latest || maintenance.modelDuring(model, slot, end) {
+			continue
+		}
+		requests := toInt64(r["requests"])
+		notifyModelStatus(model, uptimeSlotWindow, getStatusColor(float64(toInt64(r["success"]))/float64(requests)*100, requests))
+	}
+	return len(rows), nil
+}
+
+// rollupUptimeDay recomputes the daily row of every model from its slots
+func rollupUptimeDay(ctx context.Context, tx *sql.Tx, day time.Time) error {
+	start, end := day.Unix(), day.AddDate(0, 0, 1).Unix()
+	date := day.Format("2006-01-02")
+	if _, err := tx.ExecContext(ctx, `DELETE FROM model_uptime_daily WHERE day = ?`, date); err != nil {
+		return err
+	}
+	// green >= 95%，yellow >= 80%，否则 red，与 getStatusColor 一致；维护中的时间槽视为正常
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO model_uptime_daily (model_name, day, day_start, requests, success, slots, degraded_slots, down_slots, maintenance_slots)
+		SELECT model_name, ?, ?, SUM(requests), SUM(success), COUNT(*),
+			SUM(CASE WHEN maintenance = 0 AND success * 100 >= requests * 80 AND success * 100 < requests * 95 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN maintenance = 0 AND success * 100 < requests * 80 THEN 1 ELSE 0 END),
+			SUM(maintenance)
+		FROM model_uptime_slots
+		WHERE slot_start >= ? AND slot_start < ? AND requests > 0
+		GROUP BY model_name`, date, start, start, end)
+	return err
+}
+
+// GetUptimeSummary returns the 30 / 90-day uptime of the given models, or
+// of every tracked model when none are given, worst 30-day uptime first
+func (s *ModelStatusService) GetUptimeSummary(ctx context.Context, models []string) ([]ModelUptimeSummary, error) {
+	wanted := []string{}
+	for _, m := range models {
+		if m = strings.TrimSpace(m); m != "" {
+			wanted = appendUniqueString(wanted, m)
+		}
+	}
+	sort.Strings(wanted)
+	cacheKey := cache.Key("model_status:uptime:summary:%s", strings.Join(wanted, ","))
+	var cached []ModelUptimeSummary
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found && cached != nil {
+		return cached, nil
+	}
+
+	store, err := openModelUptimeStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	today := reportDayStart(reportNow())
+	since30, since90 := today.AddDate(0, 0, -29).Unix(), today.AddDate(0, 0, -89).Unix()
+	query, args := `
+		SELECT model_name,
+			SUM(CASE WHEN day_start >= ? THEN slots ELSE 0 END),
+			SUM(CASE WHEN day_start >= ? THEN down_slots ELSE 0 END),
+			SUM(CASE WHEN day_start >= ? THEN requests ELSE 0 END),
+			SUM(slots), SUM(down_slots), COUNT(*)
+		FROM model_uptime_daily
+		WHERE day_start >= ?`, []interface{}{since30, since30, since30, since90}
+	if len(wanted) > 0 {
+		query += " AND model_name IN (" + placeholders(len(wanted)) + ")"
+		for _, m := range wanted {
+			args = append(args, m)
+		}
+	}
+	rows, err := store.QueryContext(ctx, query+" GROUP BY model_name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ModelUptimeSummary{}
+	for rows.Next() {
+		var it ModelUptimeSummary
+		var slots30, down30, slots90, down90 int64
+		if err := rows.Scan(&it.ModelName, &slots30, &down30, &it.Requests30d, &slots90, &down90, &it.DaysTracked); err != nil {
+			return nil, err
+		}
+		it.Uptime30d, it.Uptime90d = uptimePercent(slots30, down30), uptimePercent(slots90, down90)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i].Uptime30d, items[j].Uptime30d
+		switch {
+		case a == nil || b == nil:
+			if (a == nil) != (b == nil) {
+				return b == nil
+			}
+		case *a != *b:
+			return *a < *b
+		}
+		return items[i].ModelName < items[j].ModelName
+	})
+	cache.Get().Set(cacheKey, items, time.Minute)
+	return items, nil
+}
+
+// GetUptimeHistory returns one bar per day (oldest first, today included) of
+// a model's uptime over the last `days` days
+func (s *ModelStatusService) GetUptimeHistory(ctx context.Context, modelName string, days int) (*ModelUptimeHistory, error) {
+	days = clampSetting(days, 1, maxUptimeHistoryDays, maxUptimeHistoryDays)
+	cacheKey := cache.Key("model_status:uptime:history:%s:%d", modelName, days)
+	var cached ModelUptimeHistory
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found {
+		return &cached, nil
+	}
+
+	store, err := openModelUptimeStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	today := reportDayStart(reportNow())
+	first := today.AddDate(0, 0, -(days - 1))
+	rows, err := store.QueryContext(ctx, `
+		SELECT day, requests, success, slots, degraded_slots, down_slots, maintenance_slots
+		FROM model_uptime_daily
+		WHERE model_name = ? AND day_start >= ?`, modelName, first.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byDay := map[string]ModelUptimeDay{}
+	for rows.Next() {
+		var d ModelUptimeDay
+		var success int64
+		if err := rows.Scan(&d.Date, &d.Requests, &success, &d.Slots, &d.DegradedSlots, &d.DownSlots, &d.MaintenanceSlots); err != nil {
+			return nil, err
+		}
+		if d.Requests > 0 {
+			d.SuccessRate = roundRate(float64(success) / float64(d.Requests) * 100)
+		}
+		byDay[d.Date] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	history := &ModelUptimeHistory{ModelName: modelName, Days: days, Bars: make([]ModelUptimeDay, 0, days)}
+	var slots, down int64
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		d, ok := byDay[date]
+		if !ok || d.Slots == 0 {
+			history.Bars = append(history.Bars, ModelUptimeDay{Date: date, Status: "none"})
+			continue
+		}
+		d.Uptime = uptimePercent(d.Slots, d.DownSlots)
+		d.Status = getStatusColor(*d.Uptime, d.Slots)
+		slots, down = slots+d.Slots, down+d.DownSlots
+		history.Bars = append(history.Bars, d)
+	}
+	history.Uptime = uptimePercent(slots, down)
+	cache.Get().Set(cacheKey, history, time.Minute)
+	return history, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestModelUptimeSnapshot(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { cache.Get().DeleteByPrefix(cache.Key("model_status:uptime:")) })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, model_name TEXT, type INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	end := floorDiv(now.Unix()-uptimeSettleSeconds, uptimeSlotSeconds) * uptimeSlotSeconds
+	insert := func(model string, slotsAgo int64, typ, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := db.Exec(`INSERT INTO logs (model_name, type, created_at) VALUES (?, ?, ?)`,
+				model, typ, end-slotsAgo*uptimeSlotSeconds+10); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	insert("gpt-4o", 1, 2, 10)
+	insert("gpt-4o", 2, 2, 10)
+	insert("gpt-4o", 3, 2, 9) // 90%: degraded
+	insert("gpt-4o", 3, 5, 1)
+	insert("gpt-4o", 4, 2, 1) // 20%: down
+	insert("gpt-4o", 4, 5, 4)
+	insert("claude", 1, 2, 2)
+	insert("claude", 0, 5, 3) // current slot is not complete yet
+
+	svc := NewModelStatusService()
+	ctx := context.Background()
+	for run := 0; run < 2; run++ { // re-snapshotting the recheck window must not double count
+		if _, err := svc.snapshotUptimeAt(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+		summary, err := svc.GetUptimeSummary(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summary) != 2 || summary[0].ModelName != "gpt-4o" || summary[1].ModelName != "claude" {
+			t.Fatalf("run %d summary = %+v", run, summary)
+		}
+		if s := summary[0]; s.Uptime30d == nil || *s.Uptime30d != 75 || *s.Uptime90d != 75 || s.Requests30d != 35 {
+			t.Errorf("run %d gpt-4o = %+v", run, s)
+		}
+		if s := summary[1]; s.Uptime30d == nil || *s.Uptime30d != 100 || s.Requests30d != 2 {
+			t.Errorf("run %d claude = %+v", run, s)
+		}
+	}
+
+	history, err := svc.GetUptimeHistory(ctx, "gpt-4o", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Bars) != 7 || history.Uptime == nil || *history.Uptime != 75 {
+		t.Fatalf("history = %+v", history)
+	}
+	var degraded, down int64
+	for _, b := range history.Bars {
+		degraded, down = degraded+b.DegradedSlots, down+b.DownSlots
+	}
+	if degraded != 1 || down != 1 || history.Bars[0].Status != "none" {
+		t.Errorf("bars = %+v", history.Bars)
+	}
+
+	if h, err := svc.GetUptimeHistory(ctx, "unknown", 0); err != nil || len(h.Bars) != maxUptimeHistoryDays || h.Uptime != nil {
+		t.Errorf("unknown = %+v, %v", h, err)
+	}
+	if s, err := svc.GetUptimeSummary(ctx, []string{"claude", ""}); err != nil || len(s) != 1 || s[0].ModelName != "claude" {
+		t.Errorf("claude only = %+v, %v", s, err)
+	}
+}
+
+func TestModelUptimeSnapshotPublishesStatusChange(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, model_name TEXT, type INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	latest := floorDiv(now.Unix()-uptimeSettleSeconds, uptimeSlotSeconds)*uptimeSlotSeconds - uptimeSlotSeconds
+	insert := func(typ, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := db.Exec(`INSERT INTO logs (model_name, type, created_at) VALUES ('uptime-event', ?, ?)`, typ, latest+10); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	events, cancel := GetEventBus().Subscribe()
+	defer cancel()
+	svc := NewModelStatusService()
+	ctx := context.Background()
+
+	insert(2, 10) // green: first observation, no event
+	if _, err := svc.snapshotUptimeAt(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	insert(5, 10) // 50%: red
+	if _, err := svc.snapshotUptimeAt(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventModelStatusChanged || ev.Data["model_name"] != "uptime-event" ||
+			ev.Data["window"] != uptimeSlotWindow || ev.Data["from"] != "green" || ev.Data["to"] != "red" {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected model_status_changed event")
+	}
+
+	// reads no longer publish
+	if _, err := svc.GetModelStatus("uptime-event", "1h"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected extra event: %+v", ev)
+	default:
+	}
+}
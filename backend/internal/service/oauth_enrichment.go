@@ -0,0 +1,451 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+const oauthEnrichmentSettingsKey = "oauth_enrichment"
+
+// OAuth providers that can be enriched
+const (
+	OAuthProviderGitHub  = "github"
+	OAuthProviderDiscord = "discord"
+)
+
+// discordEpochMs is the Discord snowflake epoch (2015-01-01 UTC)
+const discordEpochMs = 1420070400000
+
+var ErrOAuthEnrichmentDisabled = errors.New("OAuth 资料补全未开启")
+
+// Overridden in tests
+var (
+	githubAPIBase   = "https://api.github.com"
+	discordAPIBase  = "https://discord.com/api/v10"
+	oauthHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// OAuthEnrichmentSettings GitHub / Discord 账号资料补全配置
+type OAuthEnrichmentSettings struct {
+	Enabled            bool   `json:"enabled"`
+	GitHubToken        string `json:"github_token,omitempty"` // 可选，提高 GitHub API 限额；接口返回时清空
+	HasGitHubToken     bool   `json:"has_github_token"`
+	DiscordBotToken    string `json:"discord_bot_token,omitempty"` // 可选，用于获取用户名；注册时间由 ID 推算无需令牌
+	HasDiscordBotToken bool   `json:"has_discord_bot_token"`
+	RequestsPerMinute  int    `json:"requests_per_minute"` // 每个平台每分钟最多请求数
+	CacheDays          int    `json:"cache_days"`
+	NewAccountDays     int    `json:"new_account_days"` // 注册不足该天数视为新账号
+	UpdatedAt          int64  `json:"updated_at"`
+}
+
+// OAuthEnrichmentSettingsInput supports partial update; an empty token keeps
+// the stored one, "-" clears it
+type OAuthEnrichmentSettingsInput struct {
+	Enabled           *bool   `json:"enabled"`
+	GitHubToken       *string `json:"github_token"`
+	DiscordBotToken   *string `json:"discord_bot_token"`
+	RequestsPerMinute *int    `json:"requests_per_minute"`
+	CacheDays         *int    `json:"cache_days"`
+	NewAccountDays    *int    `json:"new_account_days"`
+}
+
+func defaultOAuthEnrichmentSettings() OAuthEnrichmentSettings {
+	return OAuthEnrichmentSettings{RequestsPerMinute: 30, CacheDays: 7, NewAccountDays: 30}
+}
+
+func normalizeOAuthEnrichmentSettings(s *OAuthEnrichmentSettings) {
+	s.RequestsPerMinute = clampSetting(s.RequestsPerMinute, 1, 600, 30)
+	s.CacheDays = clampSetting(s.CacheDays, 1, 90, 7)
+	s.NewAccountDays = clampSetting(s.NewAccountDays, 1, 3650, 30)
+	s.HasGitHubToken = s.GitHubToken != ""
+	s.HasDiscordBotToken = s.DiscordBotToken != ""
+}
+
+// view hides the tokens from API responses
+func (s OAuthEnrichmentSettings) view() OAuthEnrichmentSettings {
+	s.HasGitHubToken, s.HasDiscordBotToken = s.GitHubToken != "", s.DiscordBotToken != ""
+	s.GitHubToken, s.DiscordBotToken = "", ""
+	return s
+}
+
+var oauthEnrichmentCache struct {
+	sync.Mutex
+	loaded   bool
+	settings OAuthEnrichmentSettings
+}
+
+func loadOAuthEnrichmentSettings(ctx context.Context) (OAuthEnrichmentSettings, error) {
+	oauthEnrichmentCache.Lock()
+	defer oauthEnrichmentCache.Unlock()
+	if oauthEnrichmentCache.loaded {
+		return oauthEnrichmentCache.settings, nil
+	}
+	settings := defaultOAuthEnrichmentSettings()
+	if _, err := loadLocalSetting(ctx, oauthEnrichmentSettingsKey, &settings); err != nil {
+		return defaultOAuthEnrichmentSettings(), err
+	}
+	normalizeOAuthEnrichmentSettings(&settings)
+	oauthEnrichmentCache.settings, oauthEnrichmentCache.loaded = settings, true
+	return settings, nil
+}
+
+// OAuthEnrichmentService fetches account age / public profile of the GitHub and
+// Discord accounts linked to a user
+type OAuthEnrichmentService struct {
+	db *database.Manager
+	cm *cache.Manager
+}
+
+// NewOAuthEnrichmentService creates a new OAuthEnrichmentService
+func NewOAuthEnrichmentService() *OAuthEnrichmentService {
+	return &OAuthEnrichmentService{db: database.GetRead(), cm: cache.Get()}
+}
+
+// GetSettings returns the enrichment settings with tokens hidden
+func (s *OAuthEnrichmentService) GetSettings(ctx context.Context) (OAuthEnrichmentSettings, error) {
+	settings, err := loadOAuthEnrichmentSettings(ctx)
+	return settings.view(), err
+}
+
+// UpdateSettings applies a partial update
+func (s *OAuthEnrichmentService) UpdateSettings(ctx context.Context, in OAuthEnrichmentSettingsInput) (OAuthEnrichmentSettings, error) {
+	settings, err := loadOAuthEnrichmentSettings(ctx)
+	if err != nil {
+		return settings.view(), err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	applyToken := func(dst *string, v *string) {
+		if v == nil || strings.TrimSpace(*v) == "" {
+			return
+		}
+		if *v == "-" {
+			*dst = ""
+			return
+		}
+		*dst = strings.TrimSpace(*v)
+	}
+	applyToken(&settings.GitHubToken, in.GitHubToken)
+	applyToken(&settings.DiscordBotToken, in.DiscordBotToken)
+	if in.RequestsPerMinute != nil {
+		settings.RequestsPerMinute = *in.RequestsPerMinute
+	}
+	if in.CacheDays != nil {
+		settings.CacheDays = *in.CacheDays
+	}
+	if in.NewAccountDays != nil {
+		settings.NewAccountDays = *in.NewAccountDays
+	}
+	normalizeOAuthEnrichmentSettings(&settings)
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, oauthEnrichmentSettingsKey, settings); err != nil {
+		return settings.view(), err
+	}
+	oauthEnrichmentCache.Lock()
+	oauthEnrichmentCache.settings, oauthEnrichmentCache.loaded = settings, true
+	oauthEnrichmentCache.Unlock()
+	return settings.view(), nil
+}
+
+// oauthRateLimiter is a per-provider sliding one-minute window shared by all
+// callers, so bulk analyses cannot exhaust the provider's API quota
+var oauthRateLimiter = struct {
+	sync.Mutex
+	calls map[string][]time.Time
+}{calls: map[string][]time.Time{}}
+
+func oauthRateAllow(provider string, perMinute int) bool {
+	oauthRateLimiter.Lock()
+	defer oauthRateLimiter.Unlock()
+	cutoff := time.Now().Add(-time.Minute)
+	recent := oauthRateLimiter.calls[provider][:0]
+	for _, t := range oauthRateLimiter.calls[provider] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= perMinute {
+		oauthRateLimiter.calls[provider] = recent
+		return false
+	}
+	oauthRateLimiter.calls[provider] = append(recent, time.Now())
+	return true
+}
+
+// discordSnowflakeTime returns the creation time encoded in a Discord id
+func discordSnowflakeTime(id string) (int64, bool) {
+	n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+	if err != nil || n>>22 == 0 {
+		return 0, false
+	}
+	return int64((n>>22)+discordEpochMs) / 1000, true
+}
+
+// finishOAuthProfile derives the account age fields at read time so cached profiles age
+func finishOAuthProfile(p *api.OAuthProfile, newAccountDays int) {
+	p.AccountAgeDays, p.NewAccount = -1, false
+	if p.CreatedAt > 0 {
+		p.AccountAgeDays = int((time.Now().Unix() - p.CreatedAt) / 86400)
+		p.NewAccount = p.AccountAgeDays < newAccountDays
+	}
+}
+
+// Profile returns the enriched profile of one account; refresh bypasses the cache
+func (s *OAuthEnrichmentService) Profile(ctx context.Context, provider, id string, refresh bool) (*api.OAuthProfile, error) {
+	settings, err := loadOAuthEnrichmentSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, ErrOAuthEnrichmentDisabled
+	}
+	return s.profile(ctx, settings, provider, strings.TrimSpace(id), refresh), nil
+}
+
+func (s *OAuthEnrichmentService) profile(ctx context.Context, settings OAuthEnrichmentSettings, provider, id string, refresh bool) *api.OAuthProfile {
+	cacheKey := cache.Key("oauth_profile:%s:%s", provider, id)
+	if !refresh {
+		var cached api.OAuthProfile
+		if found, _ := s.cm.GetJSON(cacheKey, &cached); found {
+			cached.FromCache = true
+			finishOAuthProfile(&cached, settings.NewAccountDays)
+			return &cached
+		}
+	}
+
+	var p *api.OAuthProfile
+	switch provider {
+	case OAuthProviderGitHub:
+		p = fetchGitHubProfile(ctx, settings, id)
+	case OAuthProviderDiscord:
+		p = fetchDiscordProfile(ctx, settings, id)
+	default:
+		p = &api.OAuthProfile{Provider: provider, ID: id, Error: "unsupported"}
+	}
+	p.FetchedAt = time.Now().Unix()
+	switch p.Error {
+	case "":
+		s.cm.Set(cacheKey, p, time.Duration(settings.CacheDays)*24*time.Hour)
+	case "not_found":
+		s.cm.Set(cacheKey, p, 24*time.Hour)
+	}
+	finishOAuthProfile(p, settings.NewAccountDays)
+	return p
+}
+
+func oauthGetJSON(ctx context.Context, rawURL string, header http.Header, dest interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header
+	req.Header.Set("User-Agent", "new-api-tools")
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, json.Unmarshal(body, dest)
+}
+
+// oauthHTTPError maps a failed lookup to a profile error code
+func oauthHTTPError(provider, id string, status int, err error) string {
+	switch {
+	case err != nil:
+		logger.L.Warn(fmt.Sprintf("[OAuth 资料] %s 请求失败: id=%s err=%v", provider, id, err))
+		return "network"
+	case status == http.StatusNotFound:
+		return "not_found"
+	case status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status == http.StatusUnauthorized:
+		return "unauthorized"
+	default:
+		return fmt.Sprintf("http_%d", status)
+	}
+}
+
+// fetchGitHubProfile reads api.github.com/user/{id} (numeric ids, as stored by
+// New API) or /users/{login}
+func fetchGitHubProfile(ctx context.Context, settings OAuthEnrichmentSettings, id string) *api.OAuthProfile {
+	p := &api.OAuthProfile{Provider: OAuthProviderGitHub, ID: id, Source: "api"}
+	if !oauthRateAllow(OAuthProviderGitHub, settings.RequestsPerMinute) {
+		p.Error = "rate_limited"
+		return p
+	}
+	path := "/users/" + url.PathEscape(id)
+	if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+		path = "/user/" + id
+	}
+	header := http.Header{"Accept": {"application/vnd.github+json"}}
+	if settings.GitHubToken != "" {
+		header.Set("Authorization", "Bearer "+settings.GitHubToken)
+	}
+	var body struct {
+		Login       string `json:"login"`
+		Name        string `json:"name"`
+		HTMLURL     string `json:"html_url"`
+		CreatedAt   string `json:"created_at"`
+		PublicRepos int    `json:"public_repos"`
+		Followers   int    `json:"followers"`
+	}
+	status, err := oauthGetJSON(ctx, githubAPIBase+path, header, &body)
+	if err != nil || status != http.StatusOK {
+		p.Error = oauthHTTPError(OAuthProviderGitHub, id, status, err)
+		return p
+	}
+	p.Login, p.Name, p.ProfileURL = body.Login, body.Name, body.HTMLURL
+	p.PublicRepos, p.Followers = &body.PublicRepos, &body.Followers
+	if t, err := time.Parse(time.RFC3339, body.CreatedAt); err == nil {
+		p.CreatedAt = t.Unix()
+	}
+	return p
+}
+
+// fetchDiscordProfile derives the account age from the snowflake id; the
+// username is only fetched when a bot token is configured
+func fetchDiscordProfile(ctx context.Context, settings OAuthEnrichmentSettings, id string) *api.OAuthProfile {
+	p := &api.OAuthProfile{Provider: OAuthProviderDiscord, ID: id, Source: "snowflake", ProfileURL: "https://discord.com/users/" + id}
+	created, ok := discordSnowflakeTime(id)
+	if !ok {
+		p.Error = "invalid_id"
+		return p
+	}
+	p.CreatedAt = created
+	if settings.DiscordBotToken == "" {
+		return p
+	}
+	if !oauthRateAllow(OAuthProviderDiscord, settings.RequestsPerMinute) {
+		return p
+	}
+	var body struct {
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+	}
+	header := http.Header{"Authorization": {"Bot " + settings.DiscordBotToken}}
+	status, err := oauthGetJSON(ctx, discordAPIBase+"/users/"+id, header, &body)
+	if err != nil || status != http.StatusOK {
+		p.Error = oauthHTTPError(OAuthProviderDiscord, id, status, err)
+		if p.Error == "not_found" {
+			return p
+		}
+		// 注册时间已由 ID 推算，API 失败不影响缓存
+		p.Error = ""
+		return p
+	}
+	p.Source, p.Login, p.Name = "api", body.Username, body.GlobalName
+	return p
+}
+
+// UserProfiles enriches the GitHub / Discord accounts linked to a user
+func (s *OAuthEnrichmentService) UserProfiles(ctx context.Context, userID int64, refresh bool) ([]api.OAuthProfile, error) {
+	settings, err := loadOAuthEnrichmentSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, ErrOAuthEnrichmentDisabled
+	}
+	return s.userProfiles(ctx, settings, userID, refresh)
+}
+
+func (s *OAuthEnrichmentService) userProfiles(ctx context.Context, settings OAuthEnrichmentSettings, userID int64, refresh bool) ([]api.OAuthProfile, error) {
+	var cols []string
+	for _, col := range NewUserManagementService().getAvailableOAuthColumns() {
+		if col == "github_id" || col == "discord_id" {
+			cols = append(cols, col)
+		}
+	}
+	profiles := []api.OAuthProfile{}
+	if len(cols) == 0 {
+		return profiles, nil
+	}
+	row, err := s.db.WithContext(ctx).QueryOne(s.db.RebindQuery(
+		"SELECT "+strings.Join(cols, ", ")+" FROM users WHERE id = ?"), userID)
+	if err != nil || row == nil {
+		return profiles, err
+	}
+	for _, col := range cols {
+		id := strings.TrimSpace(toString(row[col]))
+		if id == "" || id == "0" {
+			continue
+		}
+		provider := strings.TrimSuffix(col, "_id")
+		profiles = append(profiles, *s.profile(ctx, settings, provider, id, refresh))
+	}
+	return profiles, nil
+}
+
+// userOAuthProfiles is UserProfiles for analysis paths: disabled or failing
+// enrichment yields nil rather than an error
+func userOAuthProfiles(ctx context.Context, userID int64) []api.OAuthProfile {
+	settings, err := loadOAuthEnrichmentSettings(ctx)
+	if err != nil || !settings.Enabled {
+		return nil
+	}
+	profiles, err := NewOAuthEnrichmentService().userProfiles(ctx, settings, userID, false)
+	if err != nil {
+		logger.L.Warn(fmt.Sprintf("[OAuth 资料] 用户 %d 资料补全失败: %v", userID, err))
+		return nil
+	}
+	return profiles
+}
+
+// oauthPromptVariables renders the {oauth_accounts} / {oauth_account_age_days}
+// prompt variables; the age is the youngest known account
+func oauthPromptVariables(profiles []api.OAuthProfile) (accounts, youngestAge string) {
+	if len(profiles) == 0 {
+		return "无", "未知"
+	}
+	parts := make([]string, 0, len(profiles))
+	youngest := -1
+	for _, p := range profiles {
+		name := p.Login
+		if name == "" {
+			name = p.ID
+		}
+		desc := p.Provider + " " + name
+		if p.AccountAgeDays >= 0 {
+			desc += fmt.Sprintf("（注册 %d 天", p.AccountAgeDays)
+			if p.NewAccount {
+				desc += "，新账号"
+			}
+			desc += "）"
+			if youngest < 0 || p.AccountAgeDays < youngest {
+				youngest = p.AccountAgeDays
+			}
+		} else {
+			desc += "（注册时间未知）"
+		}
+		if p.PublicRepos != nil && p.Followers != nil {
+			desc += fmt.Sprintf(" 公开仓库 %d / 关注者 %d", *p.PublicRepos, *p.Followers)
+		}
+		parts = append(parts, desc)
+	}
+	if youngest < 0 {
+		return strings.Join(parts, "; "), "未知"
+	}
+	return strings.Join(parts, "; "), strconv.Itoa(youngest)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+func TestDiscordSnowflakeTime(t *testing.T) {
+	got, ok := discordSnowflakeTime("175928847299117063")
+	if !ok || got != 1462015105 {
+		t.Errorf("snowflake time = %d %v, want 1462015105", got, ok)
+	}
+	for _, id := range []string{"", "abc", "12"} {
+		if _, ok := discordSnowflakeTime(id); ok {
+			t.Errorf("%q should not parse", id)
+		}
+	}
+}
+
+func TestOAuthGitHubProfile(t *testing.T) {
+	created := time.Now().AddDate(0, 0, -3).UTC().Format(time.RFC3339)
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if got := r.Header.Get("Authorization"); got != "Bearer ghp_test" {
+			t.Errorf("authorization = %q", got)
+		}
+		switch r.URL.Path {
+		case "/user/123":
+			w.Write([]byte(`{"login":"octo","name":"Octo","html_url":"https://github.com/octo","created_at":"` + created + `","public_repos":0,"followers":1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	origBase := githubAPIBase
+	githubAPIBase = srv.URL
+	t.Cleanup(func() { githubAPIBase = origBase })
+
+	cm := cache.Get()
+	t.Cleanup(func() { cm.DeleteByPrefix(cache.Key("oauth_profile:")) })
+	oauthRateLimiter.Lock()
+	delete(oauthRateLimiter.calls, OAuthProviderGitHub)
+	oauthRateLimiter.Unlock()
+
+	settings := defaultOAuthEnrichmentSettings()
+	settings.Enabled, settings.GitHubToken, settings.RequestsPerMinute = true, "ghp_test", 2
+	s := &OAuthEnrichmentService{cm: cm}
+	ctx := context.Background()
+
+	p := s.profile(ctx, settings, OAuthProviderGitHub, "123", false)
+	if p.Error != "" || p.Login != "octo" || p.AccountAgeDays != 3 || !p.NewAccount || p.FromCache {
+		t.Fatalf("profile = %+v", p)
+	}
+	if p = s.profile(ctx, settings, OAuthProviderGitHub, "123", false); !p.FromCache || hits != 1 || p.AccountAgeDays != 3 {
+		t.Errorf("second lookup should be cached: hits=%d %+v", hits, p)
+	}
+	if p = s.profile(ctx, settings, OAuthProviderGitHub, "ghost", false); p.Error != "not_found" || p.AccountAgeDays != -1 {
+		t.Errorf("missing account = %+v", p)
+	}
+	// Two requests used up the per-minute budget
+	if p = s.profile(ctx, settings, OAuthProviderGitHub, "123", true); p.Error != "rate_limited" || hits != 2 {
+		t.Errorf("over budget: hits=%d %+v", hits, p)
+	}
+
+	discord := s.profile(ctx, settings, OAuthProviderDiscord, "175928847299117063", false)
+	if discord.Source != "snowflake" || discord.CreatedAt != 1462015105 || discord.NewAccount {
+		t.Errorf("discord = %+v", discord)
+	}
+
+	accounts, age := oauthPromptVariables([]api.OAuthProfile{*discord, *s.profile(ctx, settings, OAuthProviderGitHub, "123", false)})
+	if age != "3" || !strings.Contains(accounts, "github octo（注册 3 天，新账号）") {
+		t.Errorf("prompt variables = %q / %q", accounts, age)
+	}
+	if accounts, age = oauthPromptVariables(nil); accounts != "无" || age != "未知" {
+		t.Errorf("no accounts = %q / %q", accounts, age)
+	}
+}
+
+func TestOAuthEnrichmentSettingsHideTokens(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	reset := func() {
+		oauthEnrichmentCache.Lock()
+		oauthEnrichmentCache.loaded = false
+		oauthEnrichmentCache.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+
+	s := NewOAuthEnrichmentService()
+	ctx := context.Background()
+	enabled, token, rpm := true, "ghp_secret", 0
+	settings, err := s.UpdateSettings(ctx, OAuthEnrichmentSettingsInput{Enabled: &enabled, GitHubToken: &token, RequestsPerMinute: &rpm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.GitHubToken != "" || !settings.HasGitHubToken || settings.RequestsPerMinute != 30 {
+		t.Errorf("settings view = %+v", settings)
+	}
+	empty := ""
+	if _, err := s.UpdateSettings(ctx, OAuthEnrichmentSettingsInput{GitHubToken: &empty}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := loadOAuthEnrichmentSettings(ctx); stored.GitHubToken != "ghp_secret" {
+		t.Errorf("empty token input should keep the stored token, got %q", stored.GitHubToken)
+	}
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const publicStatsSettingsKey = "public_stats"
+
+var publicStatsCacheKey = cache.Key("public_stats:data")
+
+// Public stats fields. Only these pre-aggregated figures can ever be exposed.
+const (
+	PublicStatTotalRequests    = "total_requests"
+	PublicStatRequests24h      = "requests_24h"
+	PublicStatRequests30d      = "requests_30d"
+	PublicStatTokensServed24h  = "tokens_served_24h"
+	PublicStatSuccessRate24h   = "success_rate_24h"
+	PublicStatModelsAvailable  = "models_available"
+	PublicStatChannelsActive   = "channels_active"
+	PublicStatTotalUsers       = "total_users"
+	PublicStatActiveUsers24h   = "active_users_24h"
+	PublicStatServiceStartedAt = "service_started_at"
+)
+
+// PublicStatFields lists every field that may be whitelisted, in display order
+var PublicStatFields = []string{
+	PublicStatTotalRequests,
+	PublicStatRequests24h,
+	PublicStatRequests30d,
+	PublicStatTokensServed24h,
+	PublicStatSuccessRate24h,
+	PublicStatModelsAvailable,
+	PublicStatChannelsActive,
+	PublicStatTotalUsers,
+	PublicStatActiveUsers24h,
+	PublicStatServiceStartedAt,
+}
+
+// PublicStatsSettings 公开统计（透明度页面）配置
+type PublicStatsSettings struct {
+	Enabled      bool     `json:"enabled"`       // 关闭时 /api/public/stats 返回 404
+	Fields       []string `json:"fields"`        // 对外暴露的字段白名单
+	CacheMinutes int      `json:"cache_minutes"` // 结果缓存时长，公开接口不会触发实时查询
+	UpdatedAt    int64    `json:"updated_at"`
+}
+
+// PublicStatsSettingsInput supports partial update of PublicStatsSettings
+type PublicStatsSettingsInput struct {
+	Enabled      *bool     `json:"enabled"`
+	Fields       *[]string `json:"fields"`
+	CacheMinutes *int      `json:"cache_minutes"`
+}
+
+// PublicStats is the payload of the public endpoint
+type PublicStats struct {
+	Stats        map[string]interface{} `json:"stats"`
+	GeneratedAt  int64                  `json:"generated_at"`
+	CacheMinutes int                    `json:"cache_minutes"`
+}
+
+func defaultPublicStatsSettings() PublicStatsSettings {
+	return PublicStatsSettings{
+		Enabled: false,
+		Fields: []string{
+			PublicStatTotalRequests,
+			PublicStatRequests24h,
+			PublicStatModelsAvailable,
+			PublicStatSuccessRate24h,
+		},
+		CacheMinutes: 30,
+	}
+}
+
+func normalizePublicStatsSettings(s *PublicStatsSettings) error {
+	s.CacheMinutes = clampSetting(s.CacheMinutes, 5, 1440, 30)
+	known := make(map[string]bool, len(PublicStatFields))
+	for _, f := range PublicStatFields {
+		known[f] = true
+	}
+	var fields []string
+	for _, f := range s.Fields {
+		if !known[f] {
+			return fmt.Errorf("unknown public stats field %q", f)
+		}
+		fields = appendUniqueString(fields, f)
+	}
+	if fields == nil {
+		fields = []string{}
+	}
+	s.Fields = fields
+	return nil
+}
+
+// PublicStatsService computes the transparency figures of the primary
+// instance. Everything is aggregated server-side and cached, so anonymous
+// callers can never drive a query against the database directly.
+type PublicStatsService struct {
+	db    *database.Manager
+	logDB *database.Manager
+	cm    *cache.Manager
+}
+
+// publicStatsMu serializes recomputation so a cold cache under load only
+// triggers one round of aggregate queries
+var publicStatsMu sync.Mutex
+
+// NewPublicStatsService creates a PublicStatsService on the primary instance
+func NewPublicStatsService() *PublicStatsService {
+	return &PublicStatsService{db: database.Get(), logDB: database.GetLog(), cm: cache.Get()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *PublicStatsService) WithContext(ctx context.Context) *PublicStatsService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// GetSettings returns the public stats settings (defaults if never saved)
+func (s *PublicStatsService) GetSettings(ctx context.Context) (PublicStatsSettings, error) {
+	settings := defaultPublicStatsSettings()
+	if _, err := loadLocalSetting(ctx, publicStatsSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizePublicStatsSettings(&settings); err != nil {
+		return defaultPublicStatsSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update and drops the cached figures
+func (s *PublicStatsService) UpdateSettings(ctx context.Context, in PublicStatsSettingsInput) (PublicStatsSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Fields != nil {
+		settings.Fields = *in.Fields
+	}
+	if in.CacheMinutes != nil {
+		settings.CacheMinutes = *in.CacheMinutes
+	}
+	if err := normalizePublicStatsSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, publicStatsSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	s.cm.Delete(publicStatsCacheKey)
+	return settings, nil
+}
+
+// GetPublicStats returns the whitelisted figures, recomputing them at most
+// once per cache_minutes. The whitelist is re-applied on every read so a
+// field removed from the config disappears immediately.
+func (s *PublicStatsService) GetPublicStats(ctx context.Context, settings PublicStatsSettings) (*PublicStats, error) {
+	var cached PublicStats
+	if found, _ := s.cm.GetJSON(publicStatsCacheKey, &cached); found {
+		return filterPublicStats(&cached, settings), nil
+	}
+
+	publicStatsMu.Lock()
+	defer publicStatsMu.Unlock()
+	if found, _ := s.cm.GetJSON(publicStatsCacheKey, &cached); found {
+		return filterPublicStats(&cached, settings), nil
+	}
+
+	stats := &PublicStats{
+		Stats:        s.computeStats(settings.Fields),
+		GeneratedAt:  time.Now().Unix(),
+		CacheMinutes: settings.CacheMinutes,
+	}
+	s.cm.Set(publicStatsCacheKey, stats, time.Duration(settings.CacheMinutes)*time.Minute)
+	return filterPublicStats(stats, settings), nil
+}
+
+// filterPublicStats keeps only whitelisted fields of a (possibly cached) result
+func filterPublicStats(stats *PublicStats, settings PublicStatsSettings) *PublicStats {
+	out := &PublicStats{
+		Stats:        make(map[string]interface{}, len(settings.Fields)),
+		GeneratedAt:  stats.GeneratedAt,
+		CacheMinutes: settings.CacheMinutes,
+	}
+	for _, f := range settings.Fields {
+		if v, ok := stats.Stats[f]; ok {
+			out.Stats[f] = v
+		}
+	}
+	return out
+}
+
+// computeStats runs only the queries needed by the requested fields. A
+// failing query leaves its fields out rather than failing the whole page.
+func (s *PublicStatsService) computeStats(fields []string) map[string]interface{} {
+	want := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		want[f] = true
+	}
+	result := map[string]interface{}{}
+	now := time.Now().Unix()
+
+	if want[PublicStatTotalRequests] {
+		row, err := s.logDB.QueryOneWithTimeout(60*time.Second, `SELECT COUNT(*) as total FROM logs WHERE type IN (`+ltRequests()+`)`)
+		if err != nil {
+			logger.L.Warn("[公开统计] total_requests 查询失败: "+err.Error(), logger.CatAnalytics)
+		} else if row != nil {
+			result[PublicStatTotalRequests] = toInt64(row["total"])
+		}
+	}
+
+	if want[PublicStatRequests24h] || want[PublicStatTokensServed24h] || want[PublicStatSuccessRate24h] || want[PublicStatActiveUsers24h] {
+		row, err := s.logDB.QueryOneWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+			SELECT COUNT(*) as requests,
+				SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures,
+				COALESCE(SUM(prompt_tokens), 0) + COALESCE(SUM(completion_tokens), 0) as tokens,
+				COUNT(DISTINCT user_id) as users
+			FROM logs
+			WHERE created_at >= ? AND type IN (`+ltRequests()+`)`), now-24*3600)
+		if err != nil {
+			logger.L.Warn("[公开统计] 24h 查询失败: "+err.Error(), logger.CatAnalytics)
+		} else if row != nil {
+			requests := toInt64(row["requests"])
+			result[PublicStatRequests24h] = requests
+			result[PublicStatTokensServed24h] = toInt64(row["tokens"])
+			result[PublicStatActiveUsers24h] = toInt64(row["users"])
+			if requests > 0 {
+				result[PublicStatSuccessRate24h] = roundRate(float64(requests-toInt64(row["failures"])) / float64(requests) * 100)
+			}
+		}
+	}
+
+	if want[PublicStatRequests30d] {
+		row, err := s.logDB.QueryOneWithTimeout(60*time.Second, s.logDB.RebindQuery(
+			`SELECT COUNT(*) as requests FROM logs WHERE created_at >= ? AND type IN (`+ltRequests()+`)`), now-30*86400)
+		if err != nil {
+			logger.L.Warn("[公开统计] requests_30d 查询失败: "+err.Error(), logger.CatAnalytics)
+		} else if row != nil {
+			result[PublicStatRequests30d] = toInt64(row["requests"])
+		}
+	}
+
+	if want[PublicStatModelsAvailable] {
+		row, err := s.db.QueryOneWithTimeout(10*time.Second, `
+			SELECT COUNT(DISTINCT a.model) as count
+			FROM abilities a
+			INNER JOIN channels c ON c.id = a.channel_id
+			WHERE c.status = 1`)
+		if err == nil && row != nil {
+			result[PublicStatModelsAvailable] = toInt64(row["count"])
+		}
+	}
+
+	if want[PublicStatChannelsActive] {
+		row, err := s.db.QueryOneWithTimeout(10*time.Second, `SELECT COUNT(*) as count FROM channels WHERE status = 1`)
+		if err == nil && row != nil {
+			result[PublicStatChannelsActive] = toInt64(row["count"])
+		}
+	}
+
+	if want[PublicStatTotalUsers] {
+		row, err := s.db.QueryOneWithTimeout(15*time.Second, `SELECT COUNT(*) as count FROM users WHERE deleted_at IS NULL`)
+		if err == nil && row != nil {
+			result[PublicStatTotalUsers] = toInt64(row["count"])
+		}
+	}
+
+	if want[PublicStatServiceStartedAt] {
+		row, err := s.logDB.QueryOneWithTimeout(15*time.Second, `SELECT MIN(created_at) as first FROM logs`)
+		if err == nil && row != nil && toInt64(row["first"]) > 0 {
+			result[PublicStatServiceStartedAt] = toInt64(row["first"])
+		}
+	}
+
+	return result
+}
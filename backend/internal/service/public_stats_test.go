@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestNormalizePublicStatsSettingsRejectsUnknownFields(t *testing.T) {
+	s := PublicStatsSettings{Fields: []string{PublicStatRequests24h, PublicStatRequests24h}}
+	if err := normalizePublicStatsSettings(&s); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if len(s.Fields) != 1 || s.CacheMinutes != 30 {
+		t.Fatalf("expected deduped fields and default cache minutes, got %+v", s)
+	}
+	s.Fields = []string{"quota_balance"}
+	if err := normalizePublicStatsSettings(&s); err == nil {
+		t.Fatal("non-whitelisted field must be rejected")
+	}
+}
+
+func TestPublicStatsOnlyExposesWhitelistedFields(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	schema := `
+	CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, deleted_at INTEGER);
+	CREATE TABLE channels (id INTEGER PRIMARY KEY, name TEXT, status INTEGER);
+	CREATE TABLE abilities (model TEXT, channel_id INTEGER);
+	CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, type INTEGER,
+		prompt_tokens INTEGER, completion_tokens INTEGER, created_at INTEGER);
+	INSERT INTO users VALUES (1, 'a', NULL), (2, 'b', NULL);
+	INSERT INTO channels VALUES (1, 'up', 1), (2, 'down', 2);
+	INSERT INTO abilities VALUES ('gpt-4o', 1), ('claude', 1), ('gemini', 2);`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	db.MustExec(`INSERT INTO logs (user_id, type, prompt_tokens, completion_tokens, created_at) VALUES
+		(1, 2, 10, 5, ?), (1, 2, 10, 5, ?), (2, 2, 10, 5, ?), (2, 5, 0, 0, ?), (1, 2, 10, 5, ?)`,
+		now-60, now-60, now-60, now-60, now-40*86400)
+
+	svc := NewPublicStatsService()
+	ctx := context.Background()
+	settings, err := svc.GetSettings(ctx)
+	if err != nil || settings.Enabled {
+		t.Fatalf("public stats must be disabled by default, got %+v %v", settings, err)
+	}
+
+	enabled := true
+	fields := []string{PublicStatTotalRequests, PublicStatRequests24h, PublicStatSuccessRate24h, PublicStatModelsAvailable}
+	settings, err = svc.UpdateSettings(ctx, PublicStatsSettingsInput{Enabled: &enabled, Fields: &fields})
+	if err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	stats, err := svc.GetPublicStats(ctx, settings)
+	if err != nil {
+		t.Fatalf("GetPublicStats: %v", err)
+	}
+	if len(stats.Stats) != 4 {
+		t.Fatalf("expected exactly the 4 whitelisted fields, got %v", stats.Stats)
+	}
+	if toInt64(stats.Stats[PublicStatTotalRequests]) != 5 || toInt64(stats.Stats[PublicStatRequests24h]) != 4 {
+		t.Fatalf("unexpected request counts: %v", stats.Stats)
+	}
+	if toFloat64(stats.Stats[PublicStatSuccessRate24h]) != 75 || toInt64(stats.Stats[PublicStatModelsAvailable]) != 2 {
+		t.Fatalf("unexpected success rate / models: %v", stats.Stats)
+	}
+	if _, ok := stats.Stats[PublicStatActiveUsers24h]; ok {
+		t.Fatal("active_users_24h is not whitelisted and must not be exposed")
+	}
+
+	// narrowing the whitelist applies immediately, even to cached figures
+	settings.Fields = []string{PublicStatModelsAvailable}
+	stats, _ = svc.GetPublicStats(ctx, settings)
+	if len(stats.Stats) != 1 {
+		t.Fatalf("expected only models_available, got %v", stats.Stats)
+	}
+}
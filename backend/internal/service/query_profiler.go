@@ -0,0 +1,521 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	queryProfilerSettingsKey = "query_profiler"
+	// maxStoredQueryPlans bounds the query_plans table; the oldest plans are
+	// dropped first
+	maxStoredQueryPlans = 100
+	queryPlanTimeout    = time.Minute
+)
+
+var (
+	ErrInvalidQueryProfiler = errors.New("invalid query profiler settings")
+	ErrQueryProfilerRunning = errors.New("query profiler already running")
+)
+
+// QueryProfilerSettings controls the slow query plan sampler
+type QueryProfilerSettings struct {
+	Enabled          bool  `json:"enabled"`
+	TopN             int   `json:"top_n"`              // 每轮 EXPLAIN 的查询数（按累计耗时排序）
+	MinOccurrences   int   `json:"min_occurrences"`    // 慢查询日志中至少出现的次数
+	IntervalMinutes  int   `json:"interval_minutes"`   // 后台采样间隔
+	AnalyzeOnReplica bool  `json:"analyze_on_replica"` // 只读副本上的查询使用 EXPLAIN ANALYZE（PostgreSQL）
+	UpdatedAt        int64 `json:"updated_at"`
+}
+
+// QueryProfilerSettingsInput is a partial update; nil fields keep their value
+type QueryProfilerSettingsInput struct {
+	Enabled          *bool `json:"enabled"`
+	TopN             *int  `json:"top_n"`
+	MinOccurrences   *int  `json:"min_occurrences"`
+	IntervalMinutes  *int  `json:"interval_minutes"`
+	AnalyzeOnReplica *bool `json:"analyze_on_replica"`
+}
+
+// QueryPlan is the stored plan of one recurring slow query
+type QueryPlan struct {
+	Fingerprint string   `json:"fingerprint"`
+	Database    string   `json:"database"`
+	SQL         string   `json:"sql"`
+	Args        []string `json:"args"` // EXPLAIN 使用的参数（最近一次慢查询）
+	Occurrences int      `json:"occurrences"`
+	AvgMs       int64    `json:"avg_ms"`
+	MaxMs       int64    `json:"max_ms"`
+	Analyzed    bool     `json:"analyzed"` // 实际执行过（EXPLAIN ANALYZE）
+	Format      string   `json:"format"`   // json (PostgreSQL / MySQL) / text (SQLite)
+	Plan        string   `json:"plan"`
+	TotalCost   float64  `json:"total_cost"`
+	ExecutionMs float64  `json:"execution_ms"` // 仅 analyzed
+	SeqScans    []string `json:"seq_scans"`    // 全表扫描的表（含过滤条件），即可能缺索引的位置
+	Error       string   `json:"error,omitempty"`
+	ProfiledAt  int64    `json:"profiled_at"`
+}
+
+// QueryProfileResult is the outcome of one sampling round
+type QueryProfileResult struct {
+	SlowQueries int         `json:"slow_queries"` // 慢查询日志中的条数
+	Candidates  int         `json:"candidates"`   // 满足出现次数的不同查询数
+	Plans       []QueryPlan `json:"plans"`
+}
+
+// slowQueryGroup is one distinct (database, SQL) of the slow query log
+type slowQueryGroup struct {
+	database.SlowQuery
+	count   int
+	totalMs int64
+	maxMs   int64
+}
+
+var queryProfilerMu sync.Mutex
+
+func defaultQueryProfilerSettings() QueryProfilerSettings {
+	return QueryProfilerSettings{TopN: 5, MinOccurrences: 3, IntervalMinutes: 60, AnalyzeOnReplica: true}
+}
+
+// GetQueryProfilerSettings returns the profiler settings (defaults if never saved)
+func GetQueryProfilerSettings(ctx context.Context) (QueryProfilerSettings, error) {
+	settings := defaultQueryProfilerSettings()
+	if _, err := loadLocalSetting(ctx, queryProfilerSettingsKey, &settings); err != nil {
+		return defaultQueryProfilerSettings(), err
+	}
+	return settings, nil
+}
+
+// UpdateQueryProfilerSettings applies a partial update
+func UpdateQueryProfilerSettings(ctx context.Context, in QueryProfilerSettingsInput) (QueryProfilerSettings, error) {
+	settings, err := GetQueryProfilerSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.TopN != nil {
+		if *in.TopN < 1 || *in.TopN > 20 {
+			return settings, fmt.Errorf("%w: top_n 需在 1-20 之间", ErrInvalidQueryProfiler)
+		}
+		settings.TopN = *in.TopN
+	}
+	if in.MinOccurrences != nil {
+		if *in.MinOccurrences < 1 || *in.MinOccurrences > 100 {
+			return settings, fmt.Errorf("%w: min_occurrences 需在 1-100 之间", ErrInvalidQueryProfiler)
+		}
+		settings.MinOccurrences = *in.MinOccurrences
+	}
+	if in.IntervalMinutes != nil {
+		if *in.IntervalMinutes < 10 || *in.IntervalMinutes > 1440 {
+			return settings, fmt.Errorf("%w: interval_minutes 需在 10-1440 之间", ErrInvalidQueryProfiler)
+		}
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.AnalyzeOnReplica != nil {
+		settings.AnalyzeOnReplica = *in.AnalyzeOnReplica
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, queryProfilerSettingsKey, settings)
+}
+
+func ensureQueryPlanTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS query_plans (
+			fingerprint TEXT PRIMARY KEY,
+			database_name TEXT NOT NULL,
+			sql_text TEXT NOT NULL,
+			args TEXT NOT NULL DEFAULT '[]',
+			occurrences INTEGER NOT NULL DEFAULT 0,
+			avg_ms INTEGER NOT NULL DEFAULT 0,
+			max_ms INTEGER NOT NULL DEFAULT 0,
+			analyzed INTEGER NOT NULL DEFAULT 0,
+			format TEXT NOT NULL DEFAULT '',
+			plan TEXT NOT NULL DEFAULT '',
+			total_cost REAL NOT NULL DEFAULT 0,
+			execution_ms REAL NOT NULL DEFAULT 0,
+			seq_scans TEXT NOT NULL DEFAULT '[]',
+			error TEXT NOT NULL DEFAULT '',
+			profiled_at INTEGER NOT NULL
+		)`)
+	return err
+}
+
+func openQueryPlanStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureQueryPlanTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func queryFingerprint(dbName, sqlText string) string {
+	sum := sha1.Sum([]byte(dbName + "\x00" + sqlText))
+	return hex.EncodeToString(sum[:8])
+}
+
+// explainable reports whether a slow query can be re-run under EXPLAIN: only
+// complete (untruncated) SELECTs qualify
+func explainable(q database.SlowQuery) bool {
+	head := strings.ToUpper(strings.TrimSpace(q.SQL))
+	if !strings.HasPrefix(head, "SELECT") && !strings.HasPrefix(head, "WITH") {
+		return false
+	}
+	if strings.HasSuffix(q.SQL, "…") {
+		return false
+	}
+	for _, a := range q.Args {
+		if strings.HasSuffix(a, "…") {
+			return false
+		}
+	}
+	return true
+}
+
+// recurringSlowQueries groups the slow query log (newest first) by database
+// and SQL and returns the topN groups seen at least minOccurrences times,
+// by total time spent. Each group keeps the args of its latest occurrence.
+func recurringSlowQueries(entries []database.SlowQuery, minOccurrences, topN int) ([]slowQueryGroup, int) {
+	groups := map[string]*slowQueryGroup{}
+	for _, q := range entries {
+		if !explainable(q) {
+			continue
+		}
+		key := q.Database + "\x00" + q.SQL
+		g := groups[key]
+		if g == nil {
+			g = &slowQueryGroup{SlowQuery: q}
+			groups[key] = g
+		}
+		g.count++
+		g.totalMs += q.DurationMs
+		g.maxMs = max(g.maxMs, q.DurationMs)
+	}
+	out := make([]slowQueryGroup, 0, len(groups))
+	for _, g := range groups {
+		if g.count >= minOccurrences {
+			out = append(out, *g)
+		}
+	}
+	candidates := len(out)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].totalMs != out[j].totalMs {
+			return out[i].totalMs > out[j].totalMs
+		}
+		return out[i].SQL < out[j].SQL
+	})
+	if len(out) > topN {
+		out = out[:topN]
+	}
+	return out, candidates
+}
+
+// RunQueryProfiler EXPLAINs the top recurring slow queries and stores their
+// plans. Queries that ran on the read replica are profiled with EXPLAIN
+// ANALYZE when enabled (PostgreSQL only): the replica can afford running them
+// again and the actual row counts show misestimates as well.
+func RunQueryProfiler(ctx context.Context) (*QueryProfileResult, error) {
+	if !queryProfilerMu.TryLock() {
+		return nil, ErrQueryProfilerRunning
+	}
+	defer queryProfilerMu.Unlock()
+
+	settings, err := GetQueryProfilerSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := database.SlowQueries(0)
+	groups, candidates := recurringSlowQueries(entries, settings.MinOccurrences, settings.TopN)
+	result := &QueryProfileResult{SlowQueries: len(entries), Candidates: candidates, Plans: []QueryPlan{}}
+	if len(groups) == 0 {
+		return result, nil
+	}
+
+	store, err := openQueryPlanStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	for _, g := range groups {
+		plan := QueryPlan{
+			Fingerprint: queryFingerprint(g.Database, g.SQL),
+			Database:    g.Database,
+			SQL:         g.SQL,
+			Args:        g.Args,
+			Occurrences: g.count,
+			AvgMs:       g.totalMs / int64(g.count),
+			MaxMs:       g.maxMs,
+			SeqScans:    []string{},
+			ProfiledAt:  time.Now().Unix(),
+		}
+		if m := database.ManagerByName(g.Database); m == nil {
+			plan.Error = "数据库连接不可用"
+		} else {
+			explainQuery(ctx, m, &plan, settings.AnalyzeOnReplica && g.Database == "replica")
+		}
+		if err := saveQueryPlan(ctx, store, plan); err != nil {
+			return nil, err
+		}
+		result.Plans = append(result.Plans, plan)
+	}
+	if _, err := store.ExecContext(ctx, `
+		DELETE FROM query_plans WHERE fingerprint NOT IN (
+			SELECT fingerprint FROM query_plans ORDER BY profiled_at DESC LIMIT ?)`, maxStoredQueryPlans); err != nil {
+		return nil, err
+	}
+	logger.L.System(fmt.Sprintf("[查询计划] 已采样 %d 条慢查询的执行计划", len(result.Plans)))
+	return result, nil
+}
+
+// explainQuery fills plan with the EXPLAIN output of its SQL on m. It runs on
+// the raw connection so the EXPLAIN itself never lands in the slow query log.
+func explainQuery(ctx context.Context, m *database.Manager, plan *QueryPlan, analyze bool) {
+	ctx, cancel := context.WithTimeout(ctx, queryPlanTimeout)
+	defer cancel()
+	args := make([]interface{}, len(plan.Args))
+	for i, a := range plan.Args {
+		args[i] = a
+	}
+
+	var err error
+	switch {
+	case m.IsPG:
+		prefix := "EXPLAIN (FORMAT JSON) "
+		if analyze {
+			prefix = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "
+			plan.Analyzed = true
+		}
+		var raw []byte
+		if err = m.DB.QueryRowContext(ctx, prefix+plan.SQL, args...).Scan(&raw); err == nil {
+			plan.Format, plan.Plan = "json", string(raw)
+			err = parsePGPlan(raw, plan)
+		}
+	case m.DB.DriverName() == "sqlite":
+		var rows *sql.Rows
+		if rows, err = m.DB.QueryContext(ctx, "EXPLAIN QUERY PLAN "+plan.SQL, args...); err == nil {
+			var lines []string
+			for rows.Next() {
+				var id, parent, notUsed int64
+				var detail string
+				if err = rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+					break
+				}
+				lines = append(lines, detail)
+			}
+			rows.Close()
+			plan.Format, plan.Plan = "text", strings.Join(lines, "\n")
+			plan.SeqScans = sqliteSeqScans(lines)
+		}
+	default:
+		var raw string
+		if err = m.DB.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+plan.SQL, args...).Scan(&raw); err == nil {
+			plan.Format, plan.Plan = "json", raw
+			err = parseMySQLPlan([]byte(raw), plan)
+		}
+	}
+	if err != nil {
+		plan.Error = err.Error()
+	}
+}
+
+// pgPlanNode is the subset of a PostgreSQL JSON plan node we inspect
+type pgPlanNode struct {
+	NodeType     string       `json:"Node Type"`
+	RelationName string       `json:"Relation Name"`
+	Filter       string       `json:"Filter"`
+	TotalCost    float64      `json:"Total Cost"`
+	Plans        []pgPlanNode `json:"Plans"`
+}
+
+// parsePGPlan reads the total cost, execution time and sequential scans of
+// EXPLAIN (FORMAT JSON) output
+func parsePGPlan(raw []byte, plan *QueryPlan) error {
+	var doc []struct {
+		Plan          pgPlanNode `json:"Plan"`
+		ExecutionTime float64    `json:"Execution Time"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	if len(doc) == 0 {
+		return errors.New("empty plan")
+	}
+	plan.TotalCost = doc[0].Plan.TotalCost
+	plan.ExecutionMs = doc[0].ExecutionTime
+	var walk func(n pgPlanNode)
+	walk = func(n pgPlanNode) {
+		if n.NodeType == "Seq Scan" && n.RelationName != "" {
+			scan := n.RelationName
+			if n.Filter != "" {
+				scan += " (Filter: " + n.Filter + ")"
+			}
+			plan.SeqScans = append(plan.SeqScans, scan)
+		}
+		for _, child := range n.Plans {
+			walk(child)
+		}
+	}
+	walk(doc[0].Plan)
+	return nil
+}
+
+// parseMySQLPlan reads the query cost and full table scans (access_type ALL)
+// of EXPLAIN FORMAT=JSON output
+func parseMySQLPlan(raw []byte, plan *QueryPlan) error {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	if block, ok := doc["query_block"].(map[string]interface{}); ok {
+		if info, ok := block["cost_info"].(map[string]interface{}); ok {
+			plan.TotalCost, _ = strconv.ParseFloat(toString(info["query_cost"]), 64)
+		}
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			if node["access_type"] == "ALL" {
+				if table := toString(node["table_name"]); table != "" {
+					scan := table
+					if cond := toString(node["attached_condition"]); cond != "" {
+						scan += " (Filter: " + cond + ")"
+					}
+					plan.SeqScans = append(plan.SeqScans, scan)
+				}
+			}
+			keys := make([]string, 0, len(node))
+			for k := range node {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(node[k])
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+	return nil
+}
+
+// sqliteSeqScans returns the tables of EXPLAIN QUERY PLAN lines that scan
+// without an index ("SCAN logs", not "SCAN logs USING INDEX ...")
+func sqliteSeqScans(lines []string) []string {
+	scans := []string{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "SCAN" && !strings.Contains(line, " USING ") {
+			scans = append(scans, fields[1])
+		}
+	}
+	return scans
+}
+
+func saveQueryPlan(ctx context.Context, store *sql.DB, p QueryPlan) error {
+	args, _ := json.Marshal(p.Args)
+	scans, _ := json.Marshal(p.SeqScans)
+	analyzed := 0
+	if p.Analyzed {
+		analyzed = 1
+	}
+	_, err := store.ExecContext(ctx, `
+		INSERT INTO query_plans (fingerprint, database_name, sql_text, args, occurrences, avg_ms, max_ms,
+			analyzed, format, plan, total_cost, execution_ms, seq_scans, error, profiled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(fingerprint) DO UPDATE SET
+			args = excluded.args, occurrences = excluded.occurrences, avg_ms = excluded.avg_ms,
+			max_ms = excluded.max_ms, analyzed = excluded.analyzed, format = excluded.format,
+			plan = excluded.plan, total_cost = excluded.total_cost, execution_ms = excluded.execution_ms,
+			seq_scans = excluded.seq_scans, error = excluded.error, profiled_at = excluded.profiled_at`,
+		p.Fingerprint, p.Database, p.SQL, string(args), p.Occurrences, p.AvgMs, p.MaxMs,
+		analyzed, p.Format, p.Plan, p.TotalCost, p.ExecutionMs, string(scans), p.Error, p.ProfiledAt)
+	return err
+}
+
+// ListQueryPlans returns the stored plans, most recently profiled first.
+// withPlan=false leaves out the (large) plan body.
+func ListQueryPlans(ctx context.Context, limit int, withPlan bool) ([]QueryPlan, error) {
+	store, err := openQueryPlanStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	planCol := "plan"
+	if !withPlan {
+		planCol = "''"
+	}
+	rows, err := store.QueryContext(ctx, `
+		SELECT fingerprint, database_name, sql_text, args, occurrences, avg_ms, max_ms, analyzed, format,
+			`+planCol+`, total_cost, execution_ms, seq_scans, error, profiled_at
+		FROM query_plans ORDER BY profiled_at DESC, avg_ms DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plans := []QueryPlan{}
+	for rows.Next() {
+		var p QueryPlan
+		var args, scans string
+		var analyzed int
+		if err := rows.Scan(&p.Fingerprint, &p.Database, &p.SQL, &args, &p.Occurrences, &p.AvgMs, &p.MaxMs,
+			&analyzed, &p.Format, &p.Plan, &p.TotalCost, &p.ExecutionMs, &scans, &p.Error, &p.ProfiledAt); err != nil {
+			return nil, err
+		}
+		p.Analyzed = analyzed == 1
+		_ = json.Unmarshal([]byte(args), &p.Args)
+		_ = json.Unmarshal([]byte(scans), &p.SeqScans)
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+// GetQueryPlan returns one stored plan, nil if unknown
+func GetQueryPlan(ctx context.Context, fingerprint string) (*QueryPlan, error) {
+	plans, err := ListQueryPlans(ctx, maxStoredQueryPlans, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range plans {
+		if plans[i].Fingerprint == fingerprint {
+			return &plans[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ClearQueryPlans deletes all stored plans
+func ClearQueryPlans(ctx context.Context) (int64, error) {
+	store, err := openQueryPlanStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	res, err := store.ExecContext(ctx, `DELETE FROM query_plans`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func TestRecurringSlowQueries(t *testing.T) {
+	q := func(db, sql string, ms int64, args ...string) database.SlowQuery {
+		return database.SlowQuery{Database: db, SQL: sql, DurationMs: ms, Args: args}
+	}
+	const byUser = "SELECT user_id, COUNT(*) FROM logs WHERE created_at >= ? GROUP BY user_id"
+	const byModel = "SELECT model_name, COUNT(*) FROM logs GROUP BY model_name"
+	entries := []database.SlowQuery{ // newest first
+		q("replica", byUser, 3000, "200"),
+		q("main", byModel, 9000),
+		q("replica", byUser, 2500, "100"),
+		q("main", "UPDATE users SET status = 2 WHERE id = ?", 5000, "1"),
+		q("main", "UPDATE users SET status = 2 WHERE id = ?", 5000, "1"),
+		q("replica", byUser, 2500, "50"),
+		q("main", byModel, 2000),
+		q("main", "SELECT * FROM logs WHERE content = ?", 4000, "very long…"),
+		q("main", "SELECT * FROM logs WHERE content = ?", 4000, "very long…"),
+	}
+
+	groups, candidates := recurringSlowQueries(entries, 2, 1)
+	if candidates != 2 || len(groups) != 1 {
+		t.Fatalf("candidates=%d groups=%d, want 2 and 1 (writes and truncated args are skipped)", candidates, len(groups))
+	}
+	g := groups[0]
+	if g.SQL != byModel || g.count != 2 || g.totalMs != 11000 || g.maxMs != 9000 {
+		t.Fatalf("top group should be the model query by total time, got %+v", g)
+	}
+
+	groups, _ = recurringSlowQueries(entries, 3, 5)
+	if len(groups) != 1 || groups[0].SQL != byUser || groups[0].Args[0] != "200" {
+		t.Fatalf("group should keep the latest args, got %+v", groups)
+	}
+}
+
+// TestExplainQuerySQLite 验证 SQLite 下 EXPLAIN QUERY PLAN 能识别全表扫描，
+// 建索引后不再报告；计划可保存并按指纹读回。
+func TestExplainQuerySQLite(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	db := installSQLiteForTests(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, user_id INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	const query = "SELECT user_id, COUNT(*) FROM logs WHERE created_at >= ? GROUP BY user_id"
+	plan := QueryPlan{Fingerprint: queryFingerprint("main", query), Database: "main", SQL: query, Args: []string{"100"}, SeqScans: []string{}}
+	explainQuery(ctx, database.ManagerByName("main"), &plan, false)
+	if plan.Error != "" || plan.Format != "text" || len(plan.SeqScans) != 1 || plan.SeqScans[0] != "logs" {
+		t.Fatalf("expected a full scan of logs, got %+v", plan)
+	}
+
+	if _, err := db.Exec(`CREATE INDEX idx_logs_created ON logs (created_at)`); err != nil {
+		t.Fatal(err)
+	}
+	indexed := QueryPlan{SQL: query, Args: []string{"100"}, SeqScans: []string{}}
+	explainQuery(ctx, database.ManagerByName("main"), &indexed, false)
+	if indexed.Error != "" || len(indexed.SeqScans) != 0 {
+		t.Fatalf("index should remove the full scan, got %+v", indexed)
+	}
+
+	store, err := openQueryPlanStore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := saveQueryPlan(ctx, store, plan); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetQueryPlan(ctx, plan.Fingerprint)
+	if err != nil || got == nil || got.Plan != plan.Plan || len(got.SeqScans) != 1 || got.Args[0] != "100" {
+		t.Fatalf("stored plan: %+v %v", got, err)
+	}
+	if list, _ := ListQueryPlans(ctx, 10, false); len(list) != 1 || list[0].Plan != "" {
+		t.Fatalf("list should omit the plan body: %+v", list)
+	}
+}
+
+func TestParsePGAndMySQLPlans(t *testing.T) {
+	pg := []byte(`[{"Plan": {"Node Type": "Aggregate", "Total Cost": 500.5, "Plans": [
+		{"Node Type": "Seq Scan", "Relation Name": "logs", "Filter": "(created_at >= 100)", "Total Cost": 400},
+		{"Node Type": "Index Scan", "Relation Name": "users", "Total Cost": 8}]}, "Execution Time": 12.5}]`)
+	var p QueryPlan
+	if err := parsePGPlan(pg, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.TotalCost != 500.5 || p.ExecutionMs != 12.5 || len(p.SeqScans) != 1 || p.SeqScans[0] != "logs (Filter: (created_at >= 100))" {
+		t.Fatalf("pg plan: %+v", p)
+	}
+
+	mysql := []byte(`{"query_block": {"cost_info": {"query_cost": "1024.50"}, "grouping_operation": {
+		"table": {"table_name": "logs", "access_type": "ALL", "attached_condition": "(logs.created_at >= 100)"}}}}`)
+	var m QueryPlan
+	if err := parseMySQLPlan(mysql, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.TotalCost != 1024.5 || len(m.SeqScans) != 1 || m.SeqScans[0] != "logs (Filter: (logs.created_at >= 100))" {
+		t.Fatalf("mysql plan: %+v", m)
+	}
+}
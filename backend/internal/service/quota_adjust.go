@@ -0,0 +1,172 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+// Quota adjustment modes
+const (
+	QuotaAdjustGrant  = "grant"  // 增加
+	QuotaAdjustDeduct = "deduct" // 扣减（不低于 0）
+	QuotaAdjustSet    = "set"    // 直接设为指定值
+)
+
+const (
+	maxQuotaAdjustBatch  = 500
+	maxQuotaAdjustAmount = int64(1e12)
+)
+
+var (
+	ErrInvalidQuotaAdjust = errors.New("invalid quota adjustment")
+	ErrQuotaUserNotFound  = errors.New("user not found")
+)
+
+// QuotaAdjustInput describes one adjustment; the amount is given either in
+// raw quota units or in USD (converted with util.TokensPerUSD)
+type QuotaAdjustInput struct {
+	Mode      string  `json:"mode"`
+	Quota     int64   `json:"quota"`
+	AmountUSD float64 `json:"amount_usd"`
+	Reason    string  `json:"reason"`
+}
+
+// QuotaAdjustResult reports the quota of one user before and after
+type QuotaAdjustResult struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	Before   int64  `json:"before"`
+	After    int64  `json:"after"`
+	Delta    int64  `json:"delta"` // 实际变化量（扣减触底时小于请求值）
+	Error    string `json:"error,omitempty"`
+}
+
+// normalizeQuotaAdjust validates the input and returns the amount in quota units
+func normalizeQuotaAdjust(in *QuotaAdjustInput) (int64, error) {
+	in.Mode = strings.TrimSpace(in.Mode)
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Mode != QuotaAdjustGrant && in.Mode != QuotaAdjustDeduct && in.Mode != QuotaAdjustSet {
+		return 0, fmt.Errorf("%w: mode 仅支持 grant / deduct / set", ErrInvalidQuotaAdjust)
+	}
+	if in.Reason == "" {
+		return 0, fmt.Errorf("%w: 必须填写调整原因", ErrInvalidQuotaAdjust)
+	}
+	if len([]rune(in.Reason)) > 500 {
+		return 0, fmt.Errorf("%w: 调整原因不能超过 500 字", ErrInvalidQuotaAdjust)
+	}
+	if in.Quota != 0 && in.AmountUSD != 0 {
+		return 0, fmt.Errorf("%w: quota 与 amount_usd 只能填一个", ErrInvalidQuotaAdjust)
+	}
+	amount := in.Quota
+	if in.AmountUSD != 0 {
+		amount = int64(math.Round(in.AmountUSD * util.TokensPerUSD))
+	}
+	if amount < 0 || amount > maxQuotaAdjustAmount || (amount == 0 && in.Mode != QuotaAdjustSet) {
+		return 0, fmt.Errorf("%w: 调整额度需在 1 ~ %d 之间（set 可为 0）", ErrInvalidQuotaAdjust, maxQuotaAdjustAmount)
+	}
+	return amount, nil
+}
+
+// applyQuotaAdjust changes one user's quota in a transaction, locking the
+// row so concurrent adjustments (or NewAPI billing) are not lost
+func (s *UserManagementService) applyQuotaAdjust(userID int64, mode string, amount int64) (QuotaAdjustResult, error) {
+	result := QuotaAdjustResult{UserID: userID}
+	tx, err := s.db.DB.BeginTxx(s.db.Context(), nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	lock := " FOR UPDATE"
+	if s.db.DB.DriverName() == "sqlite" {
+		lock = "" // SQLite 写事务本身即库级锁，且不支持 FOR UPDATE
+	}
+	var username sql.NullString
+	err = tx.QueryRowx(s.db.RebindQuery("SELECT username, quota FROM users WHERE id = ? AND deleted_at IS NULL"+lock), userID).
+		Scan(&username, &result.Before)
+	if err == sql.ErrNoRows {
+		return result, ErrQuotaUserNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Username = username.String
+
+	switch mode {
+	case QuotaAdjustGrant:
+		result.After = result.Before + amount
+	case QuotaAdjustDeduct:
+		result.After = result.Before - amount
+		if result.After < 0 {
+			result.After = 0
+		}
+	default:
+		result.After = amount
+	}
+	result.Delta = result.After - result.Before
+	if _, err := tx.Exec(s.db.RebindQuery("UPDATE users SET quota = ? WHERE id = ?"), result.After, userID); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
+
+// AdjustQuota grants, deducts or sets the quota of one user
+func (s *UserManagementService) AdjustQuota(userID int64, in QuotaAdjustInput) (QuotaAdjustResult, error) {
+	amount, err := normalizeQuotaAdjust(&in)
+	if err != nil {
+		return QuotaAdjustResult{UserID: userID}, err
+	}
+	result, err := s.applyQuotaAdjust(userID, in.Mode, amount)
+	if err != nil {
+		return result, err
+	}
+	logger.L.Business(fmt.Sprintf("[额度调整] 用户 %d %s: %d -> %d | 原因: %s", userID, in.Mode, result.Before, result.After, in.Reason))
+	return result, nil
+}
+
+// BatchAdjustQuota applies the same adjustment to many users. Each user is
+// adjusted in its own transaction; failures are reported per user and do
+// not stop the batch.
+func (s *UserManagementService) BatchAdjustQuota(userIDs []int64, in QuotaAdjustInput) ([]QuotaAdjustResult, error) {
+	amount, err := normalizeQuotaAdjust(&in)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int64]bool{}
+	ids := make([]int64, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxQuotaAdjustBatch {
+		return nil, fmt.Errorf("%w: user_ids 需为 1 ~ %d 个有效用户 ID", ErrInvalidQuotaAdjust, maxQuotaAdjustBatch)
+	}
+
+	results := make([]QuotaAdjustResult, 0, len(ids))
+	var applied int
+	var total int64
+	for _, id := range ids {
+		result, err := s.applyQuotaAdjust(id, in.Mode, amount)
+		if err != nil {
+			if errors.Is(err, ErrQuotaUserNotFound) {
+				result.Error = "用户不存在"
+			} else {
+				result.Error = err.Error()
+			}
+		} else {
+			applied++
+			total += result.Delta
+		}
+		results = append(results, result)
+	}
+	logger.L.Business(fmt.Sprintf("[额度调整] 批量 %s %d/%d 个用户, 合计变化 %d | 原因: %s", in.Mode, applied, len(ids), total, in.Reason))
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestAdjustQuota(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, quota INTEGER, deleted_at DATETIME);
+		INSERT INTO users VALUES (1, 'alice', 1000, NULL), (2, 'bob', 100, NULL), (3, 'gone', 0, '2026-01-01');`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	quota := func(id int) int64 {
+		var q int64
+		if err := db.Get(&q, "SELECT quota FROM users WHERE id = ?", id); err != nil {
+			t.Fatalf("quota: %v", err)
+		}
+		return q
+	}
+
+	svc := NewUserManagementService()
+	res, err := svc.AdjustQuota(1, QuotaAdjustInput{Mode: QuotaAdjustGrant, AmountUSD: 0.01, Reason: "误封补偿"})
+	if err != nil || res.Before != 1000 || res.After != 6000 || res.Delta != 5000 || quota(1) != 6000 {
+		t.Fatalf("grant: %+v %v", res, err)
+	}
+	res, err = svc.AdjustQuota(2, QuotaAdjustInput{Mode: QuotaAdjustDeduct, Quota: 500, Reason: "回收"})
+	if err != nil || res.After != 0 || res.Delta != -100 {
+		t.Fatalf("deduct should stop at zero: %+v %v", res, err)
+	}
+	if _, err := svc.AdjustQuota(1, QuotaAdjustInput{Mode: QuotaAdjustGrant, Quota: 1}); !errors.Is(err, ErrInvalidQuotaAdjust) {
+		t.Fatalf("missing reason should be rejected, got %v", err)
+	}
+	if _, err := svc.AdjustQuota(3, QuotaAdjustInput{Mode: QuotaAdjustSet, Quota: 1, Reason: "x"}); !errors.Is(err, ErrQuotaUserNotFound) {
+		t.Fatalf("deleted user should be not found, got %v", err)
+	}
+
+	results, err := svc.BatchAdjustQuota([]int64{1, 2, 2, 3}, QuotaAdjustInput{Mode: QuotaAdjustSet, Quota: 777, Reason: "统一重置"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("batch: %+v %v", results, err)
+	}
+	if quota(1) != 777 || quota(2) != 777 || results[2].Error == "" || quota(3) != 0 {
+		t.Fatalf("batch should set live users and report the deleted one: %+v", results)
+	}
+}
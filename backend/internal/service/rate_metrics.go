@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+const (
+	// rateWindowMinutes is how much per-minute history is kept per user
+	rateWindowMinutes = 60
+	// rateRPMMinutes is the span the current RPM is averaged over
+	rateRPMMinutes = 5
+	// rateBatchSize bounds the log ids folded in by one poll; a poller that
+	// fell behind catches up over several polls
+	rateBatchSize = 50000
+)
+
+// userRate is a ring of per-minute request counts of one user
+type userRate struct {
+	username string
+	minutes  [rateWindowMinutes]int64 // unix minute of each slot
+	counts   [rateWindowMinutes]int64
+}
+
+func (u *userRate) add(minute, n int64) {
+	i := minute % rateWindowMinutes
+	if u.minutes[i] != minute {
+		u.minutes[i], u.counts[i] = minute, 0
+	}
+	u.counts[i] += n
+}
+
+// sum counts the requests of the last `minutes` minutes up to now
+func (u *userRate) sum(now int64, minutes int) int64 {
+	var total int64
+	for i := range u.minutes {
+		if u.minutes[i] > now-int64(minutes) && u.minutes[i] <= now {
+			total += u.counts[i]
+		}
+	}
+	return total
+}
+
+// rateMetrics are in-process per-user request counters fed by polling logs
+// by id. They stand in for the Redis-backed rate views on deployments
+// without Redis and are lost on restart, which is fine for a one-hour window.
+var rateMetrics = struct {
+	sync.Mutex
+	users    map[int64]*userRate
+	cursor   int64 // last folded log id; 0 = not started
+	since    int64
+	polledAt int64
+}{users: map[int64]*userRate{}}
+
+// UserRate is one user's live request rate
+type UserRate struct {
+	UserID      int64   `json:"user_id"`
+	Username    string  `json:"username"`
+	RPM         float64 `json:"rpm"` // 最近 5 分钟平均每分钟请求数
+	Requests5m  int64   `json:"requests_5m"`
+	Requests60m int64   `json:"requests_60m"`
+	HighRPM     bool    `json:"high_rpm"` // 超过 HIGH_RPM 阈值
+}
+
+// RateMetricsReport is the view served at /api/risk/rate-metrics
+type RateMetricsReport struct {
+	Active        bool       `json:"active"` // 计数器是否在采样（无 Redis 时自动启用）
+	Since         int64      `json:"since"`
+	PolledAt      int64      `json:"polled_at"`
+	LastLogID     int64      `json:"last_log_id"`
+	TrackedUsers  int        `json:"tracked_users"`
+	RPMThreshold  float64    `json:"rpm_threshold"`
+	WindowMinutes int        `json:"window_minutes"`
+	Users         []UserRate `json:"users"`
+}
+
+// PollRateMetrics folds logs newer than the cursor into the counters. The
+// first poll starts an hour back so RPMs are meaningful right away.
+func PollRateMetrics(ctx context.Context) (int64, error) {
+	logDB := database.GetReadLog().WithContext(ctx)
+	now := time.Now().Unix()
+
+	rateMetrics.Lock()
+	cursor := rateMetrics.cursor
+	rateMetrics.Unlock()
+
+	maxRow, err := logDB.QueryOne("SELECT COALESCE(MAX(id), 0) as max_id FROM logs")
+	if err != nil {
+		return 0, err
+	}
+	maxID := toInt64(maxRow["max_id"])
+	if cursor == 0 {
+		row, err := logDB.QueryOne(logDB.RebindQuery("SELECT COALESCE(MIN(id), 0) as min_id FROM logs WHERE created_at >= ?"),
+			now-rateWindowMinutes*60)
+		if err != nil {
+			return 0, err
+		}
+		cursor = maxID
+		if minID := toInt64(row["min_id"]); minID > 0 {
+			cursor = minID - 1
+		}
+	}
+	hi := min(maxID, cursor+rateBatchSize)
+
+	var rows []map[string]interface{}
+	if hi > cursor {
+		rows, err = logDB.QueryWithTimeout(30*time.Second, logDB.RebindQuery(`
+			SELECT user_id, MAX(username) as username, created_at - (created_at % 60) as minute, COUNT(*) as requests
+			FROM logs
+			WHERE id > ? AND id <= ? AND type IN (`+ltRequests()+`)
+			GROUP BY user_id, created_at - (created_at % 60)`), cursor, hi)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	rateMetrics.Lock()
+	defer rateMetrics.Unlock()
+	if rateMetrics.since == 0 {
+		rateMetrics.since = now
+	}
+	oldest := now/60 - rateWindowMinutes
+	var folded int64
+	for _, row := range rows {
+		minute := toInt64(row["minute"]) / 60
+		if minute <= oldest {
+			continue
+		}
+		userID := toInt64(row["user_id"])
+		u := rateMetrics.users[userID]
+		if u == nil {
+			u = &userRate{}
+			rateMetrics.users[userID] = u
+		}
+		if name := toString(row["username"]); name != "" {
+			u.username = name
+		}
+		n := toInt64(row["requests"])
+		u.add(minute, n)
+		folded += n
+	}
+	// Users idle for the whole window are dropped
+	for id, u := range rateMetrics.users {
+		if u.sum(now/60, rateWindowMinutes) == 0 {
+			delete(rateMetrics.users, id)
+		}
+	}
+	rateMetrics.cursor, rateMetrics.polledAt = hi, now
+	return folded, nil
+}
+
+// RateMetricsActive reports whether the counters have been fed recently
+func RateMetricsActive() bool {
+	rateMetrics.Lock()
+	defer rateMetrics.Unlock()
+	return rateMetrics.polledAt > time.Now().Unix()-5*60
+}
+
+// LiveUserRPM returns a user's RPM over the last rateRPMMinutes minutes;
+// ok is false when the counters are not running
+func LiveUserRPM(userID int64) (rpm float64, ok bool) {
+	if !RateMetricsActive() {
+		return 0, false
+	}
+	rateMetrics.Lock()
+	defer rateMetrics.Unlock()
+	u := rateMetrics.users[userID]
+	if u == nil {
+		return 0, true
+	}
+	return float64(u.sum(time.Now().Unix()/60, rateRPMMinutes)) / rateRPMMinutes, true
+}
+
+// GetRateMetrics returns the busiest users by current RPM
+func GetRateMetrics(ctx context.Context, limit int) RateMetricsReport {
+	threshold := currentRiskWeights(ctx).Rules[RiskFlagHighRPM].Threshold
+	active := RateMetricsActive()
+
+	rateMetrics.Lock()
+	defer rateMetrics.Unlock()
+	now := time.Now().Unix() / 60
+	users := make([]UserRate, 0, len(rateMetrics.users))
+	for id, u := range rateMetrics.users {
+		r5 := u.sum(now, rateRPMMinutes)
+		rpm := float64(r5) / rateRPMMinutes
+		users = append(users, UserRate{
+			UserID:      id,
+			Username:    u.username,
+			RPM:         rpm,
+			Requests5m:  r5,
+			Requests60m: u.sum(now, rateWindowMinutes),
+			HighRPM:     rpm > threshold,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Requests5m != users[j].Requests5m {
+			return users[i].Requests5m > users[j].Requests5m
+		}
+		if users[i].Requests60m != users[j].Requests60m {
+			return users[i].Requests60m > users[j].Requests60m
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	tracked := len(users)
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return RateMetricsReport{
+		Active:        active,
+		Since:         rateMetrics.since,
+		PolledAt:      rateMetrics.polledAt,
+		LastLogID:     rateMetrics.cursor,
+		TrackedUsers:  tracked,
+		RPMThreshold:  threshold,
+		WindowMinutes: rateWindowMinutes,
+		Users:         users,
+	}
+}
+
+// resetRateMetrics drops the counters and cursor
+func resetRateMetrics() {
+	rateMetrics.Lock()
+	defer rateMetrics.Unlock()
+	rateMetrics.users = map[int64]*userRate{}
+	rateMetrics.cursor, rateMetrics.since, rateMetrics.polledAt = 0, 0, 0
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPollRateMetrics(t *testing.T) {
+	resetRateMetrics()
+	t.Cleanup(resetRateMetrics)
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+		type INTEGER, created_at INTEGER, ip TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	insert := func(userID int64, username string, typ int, n int, at int64) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := db.Exec(`INSERT INTO logs (user_id, username, type, created_at, ip) VALUES (?, ?, ?, ?, '')`,
+				userID, username, typ, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Older than the window: skipped on the first poll
+	insert(3, "old", 2, 5, now-2*3600)
+	insert(1, "alice", 2, 40, now-60)
+	insert(1, "alice", 5, 10, now-120)
+	insert(2, "bob", 2, 5, now-30*60)
+	// Non-request log types are ignored
+	insert(2, "bob", 4, 99, now)
+
+	if _, ok := LiveUserRPM(1); ok {
+		t.Fatal("LiveUserRPM should be inactive before the first poll")
+	}
+	folded, err := PollRateMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if folded != 55 {
+		t.Fatalf("folded = %d, want 55", folded)
+	}
+	if rpm, ok := LiveUserRPM(1); !ok || rpm != 10 {
+		t.Fatalf("alice rpm = %v ok=%v, want 10", rpm, ok)
+	}
+	if rpm, ok := LiveUserRPM(2); !ok || rpm != 0 {
+		t.Fatalf("bob rpm = %v, want 0 (outside 5 minutes)", rpm)
+	}
+
+	report := GetRateMetrics(ctx, 10)
+	if !report.Active || report.TrackedUsers != 2 || len(report.Users) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if u := report.Users[0]; u.UserID != 1 || u.Username != "alice" || u.Requests5m != 50 || u.Requests60m != 50 {
+		t.Fatalf("top user = %+v", u)
+	}
+	if u := report.Users[1]; u.UserID != 2 || u.Requests5m != 0 || u.Requests60m != 5 || u.HighRPM {
+		t.Fatalf("second user = %+v", u)
+	}
+
+	// A second poll folds only the new ids
+	insert(2, "bob", 2, 20, now)
+	if folded, err = PollRateMetrics(ctx); err != nil || folded != 20 {
+		t.Fatalf("second poll folded = %d err=%v, want 20", folded, err)
+	}
+	if rpm, _ := LiveUserRPM(2); rpm != 4 {
+		t.Fatalf("bob rpm = %v, want 4", rpm)
+	}
+	if report := GetRateMetrics(ctx, 1); len(report.Users) != 1 || report.TrackedUsers != 2 || report.Users[0].UserID != 1 {
+		t.Fatalf("limited report = %+v", report)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -87,7 +88,7 @@ func keyCol(isPG bool) string {
 }
 
 // GenerateCodes generates redemption codes and inserts into database
-func GenerateCodes(params GenerateParams) (*GenerateResult, error) {
+func GenerateCodes(ctx context.Context, params GenerateParams) (*GenerateResult, error) {
 	// Validate
 	if strings.TrimSpace(params.Name) == "" {
 		return nil, fmt.Errorf("name is required")
@@ -143,7 +144,7 @@ func GenerateCodes(params GenerateParams) (*GenerateResult, error) {
 	}
 
 	createdTime := time.Now().Unix()
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 	kc := keyCol(db.IsPG)
 
 	// Build SQL for display
@@ -153,7 +154,7 @@ func GenerateCodes(params GenerateParams) (*GenerateResult, error) {
 	insertSQL := fmt.Sprintf(`INSERT INTO redemptions (user_id, %s, name, quota, created_time, redeemed_time, used_user_id, expired_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, kc)
 	insertSQL = db.RebindQuery(insertSQL)
 
-	tx, err := db.DB.Beginx()
+	tx, err := db.DB.BeginTxx(ctx, nil)
 	if err != nil {
 		return &GenerateResult{Keys: keys, Count: len(keys), SQL: sql, Success: false, Message: "Failed to start transaction: " + err.Error()}, nil
 	}
@@ -171,6 +172,7 @@ func GenerateCodes(params GenerateParams) (*GenerateResult, error) {
 	}
 
 	logger.L.Business(fmt.Sprintf("兑换码生成 | count=%d | name=%s", len(keys), params.Name))
+	invalidateRedemptionAnalytics()
 
 	return &GenerateResult{
 		Keys:    keys,
@@ -190,7 +192,7 @@ func buildInsertSQL(keys []string, name string, quotas []int64, createdTime, exp
 }
 
 // ListCodes lists redemption codes with pagination and filtering
-func ListCodes(params ListRedemptionParams) (*PaginatedRedemptions, error) {
+func ListCodes(ctx context.Context, params ListRedemptionParams) (*PaginatedRedemptions, error) {
 	if params.Page < 1 {
 		params.Page = 1
 	}
@@ -198,11 +200,74 @@ func ListCodes(params ListRedemptionParams) (*PaginatedRedemptions, error) {
 		params.PageSize = 20
 	}
 
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 	kc := keyCol(db.IsPG)
 	currentTime := time.Now().Unix()
 
-	// Build WHERE clause (use r. prefix for JOIN query)
+	whereSQL, args, argIdx := buildRedemptionWhere(db, params, currentTime)
+
+	// Count total
+	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM redemptions r WHERE %s", whereSQL)
+	var total int64
+	if err := db.DB.GetContext(ctx, &total, countSQL, args...); err != nil {
+		return nil, fmt.Errorf("count query failed: %w", err)
+	}
+
+	totalPages := int((total + int64(params.PageSize) - 1) / int64(params.PageSize))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	offset := (params.Page - 1) * params.PageSize
+
+	// Query items with LEFT JOIN to get used username
+	selectSQL := fmt.Sprintf(`SELECT r.id, r.%s as "key", COALESCE(r.name,'') as name, COALESCE(r.quota,0) as quota, COALESCE(r.created_time,0) as created_time, COALESCE(r.redeemed_time,0) as redeemed_time, COALESCE(r.used_user_id,0) as used_user_id, COALESCE(u.username,'') as used_username, COALESCE(r.expired_time,0) as expired_time FROM redemptions r LEFT JOIN users u ON r.used_user_id = u.id AND r.used_user_id > 0 WHERE %s ORDER BY r.created_time DESC LIMIT %s OFFSET %s`,
+		kc, whereSQL, db.Placeholder(argIdx), db.Placeholder(argIdx+1))
+	args = append(args, params.PageSize, offset)
+
+	rows, err := db.DB.QueryxContext(ctx, selectSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var items []RedemptionCode
+	for rows.Next() {
+		var code RedemptionCode
+		if err := rows.StructScan(&code); err != nil {
+			continue
+		}
+		code.Status = redemptionStatus(code, currentTime)
+		items = append(items, code)
+	}
+
+	if items == nil {
+		items = []RedemptionCode{}
+	}
+
+	return &PaginatedRedemptions{
+		Items:      items,
+		Total:      total,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// redemptionStatus derives "unused" / "used" / "expired" for a code
+func redemptionStatus(code RedemptionCode, now int64) string {
+	if code.RedeemedTime > 0 {
+		return "used"
+	}
+	if code.ExpiredTime > 0 && code.ExpiredTime < now {
+		return "expired"
+	}
+	return "unused"
+}
+
+// buildRedemptionWhere builds the WHERE clause shared by ListCodes and the
+// export path (r. prefix, for the LEFT JOIN users query). Returns the SQL, its
+// args and the next placeholder index.
+func buildRedemptionWhere(db *database.Manager, params ListRedemptionParams, currentTime int64) (string, []interface{}, int) {
 	where := []string{"r.deleted_at IS NULL"}
 	args := []interface{}{}
 	argIdx := 1
@@ -233,7 +298,7 @@ func ListCodes(params ListRedemptionParams) (*PaginatedRedemptions, error) {
 	}
 
 	if params.StartDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(params.StartDate, false)
+		ts, err := parseReportDate(params.StartDate, false)
 		if err == nil {
 			where = append(where, fmt.Sprintf("r.created_time >= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -242,7 +307,7 @@ func ListCodes(params ListRedemptionParams) (*PaginatedRedemptions, error) {
 	}
 
 	if params.EndDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(params.EndDate, true)
+		ts, err := parseReportDate(params.EndDate, true)
 		if err == nil {
 			where = append(where, fmt.Sprintf("r.created_time <= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -250,69 +315,16 @@ func ListCodes(params ListRedemptionParams) (*PaginatedRedemptions, error) {
 		}
 	}
 
-	whereSQL := strings.Join(where, " AND ")
-
-	// Count total
-	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM redemptions r WHERE %s", whereSQL)
-	var total int64
-	if err := db.DB.Get(&total, countSQL, args...); err != nil {
-		return nil, fmt.Errorf("count query failed: %w", err)
-	}
-
-	totalPages := int((total + int64(params.PageSize) - 1) / int64(params.PageSize))
-	if totalPages < 1 {
-		totalPages = 1
-	}
-	offset := (params.Page - 1) * params.PageSize
-
-	// Query items with LEFT JOIN to get used username
-	selectSQL := fmt.Sprintf(`SELECT r.id, r.%s as "key", COALESCE(r.name,'') as name, COALESCE(r.quota,0) as quota, COALESCE(r.created_time,0) as created_time, COALESCE(r.redeemed_time,0) as redeemed_time, COALESCE(r.used_user_id,0) as used_user_id, COALESCE(u.username,'') as used_username, COALESCE(r.expired_time,0) as expired_time FROM redemptions r LEFT JOIN users u ON r.used_user_id = u.id AND r.used_user_id > 0 WHERE %s ORDER BY r.created_time DESC LIMIT %s OFFSET %s`,
-		kc, whereSQL, db.Placeholder(argIdx), db.Placeholder(argIdx+1))
-	args = append(args, params.PageSize, offset)
-
-	rows, err := db.DB.Queryx(selectSQL, args...)
-	if err != nil {
-		return nil, fmt.Errorf("select query failed: %w", err)
-	}
-	defer rows.Close()
-
-	var items []RedemptionCode
-	for rows.Next() {
-		var code RedemptionCode
-		if err := rows.StructScan(&code); err != nil {
-			continue
-		}
-		// Determine status
-		if code.RedeemedTime > 0 {
-			code.Status = "used"
-		} else if code.ExpiredTime > 0 && code.ExpiredTime < currentTime {
-			code.Status = "expired"
-		} else {
-			code.Status = "unused"
-		}
-		items = append(items, code)
-	}
-
-	if items == nil {
-		items = []RedemptionCode{}
-	}
-
-	return &PaginatedRedemptions{
-		Items:      items,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.PageSize,
-		TotalPages: totalPages,
-	}, nil
+	return strings.Join(where, " AND "), args, argIdx
 }
 
 // DeleteCodes soft-deletes redemption codes by IDs
-func DeleteCodes(ids []int64) (int64, error) {
+func DeleteCodes(ctx context.Context, ids []int64) (int64, error) {
 	if len(ids) == 0 {
 		return 0, fmt.Errorf("at least one ID is required")
 	}
 
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 
 	// Build placeholders
 	placeholders := make([]string, len(ids))
@@ -326,19 +338,20 @@ func DeleteCodes(ids []int64) (int64, error) {
 	sql := fmt.Sprintf("UPDATE redemptions SET deleted_at = %s WHERE id IN (%s) AND deleted_at IS NULL",
 		db.Placeholder(1), strings.Join(placeholders, ", "))
 
-	result, err := db.DB.Exec(sql, args...)
+	result, err := db.DB.ExecContext(ctx, sql, args...)
 	if err != nil {
 		return 0, fmt.Errorf("delete failed: %w", err)
 	}
 
 	affected, _ := result.RowsAffected()
 	logger.L.Business(fmt.Sprintf("兑换码删除 | count=%d", affected))
+	invalidateRedemptionAnalytics()
 	return affected, nil
 }
 
 // GetRedemptionStatistics returns aggregate stats for redemption codes
-func GetRedemptionStatistics(startDate, endDate string) (*RedemptionStatistics, error) {
-	db := database.Get()
+func GetRedemptionStatistics(ctx context.Context, startDate, endDate string) (*RedemptionStatistics, error) {
+	db := database.Get().WithContext(ctx)
 	currentTime := time.Now().Unix()
 
 	where := []string{"deleted_at IS NULL"}
@@ -346,7 +359,7 @@ func GetRedemptionStatistics(startDate, endDate string) (*RedemptionStatistics,
 	argIdx := 5
 
 	if startDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(startDate, false)
+		ts, err := parseReportDate(startDate, false)
 		if err == nil {
 			where = append(where, fmt.Sprintf("created_time >= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -354,7 +367,7 @@ func GetRedemptionStatistics(startDate, endDate string) (*RedemptionStatistics,
 		}
 	}
 	if endDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(endDate, true)
+		ts, err := parseReportDate(endDate, true)
 		if err == nil {
 			where = append(where, fmt.Sprintf("created_time <= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -378,7 +391,7 @@ func GetRedemptionStatistics(startDate, endDate string) (*RedemptionStatistics,
 		p(1), p(2), p(3), p(4), whereSQL)
 
 	var stats RedemptionStatistics
-	if err := db.DB.Get(&stats, sql, args...); err != nil {
+	if err := db.DB.GetContext(ctx, &stats, sql, args...); err != nil {
 		return nil, fmt.Errorf("statistics query failed: %w", err)
 	}
 
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+const redemptionAnalyticsCacheTTL = 5 * time.Minute
+
+// redemptionValueBuckets 面额分布区间（USD，左闭右开，最后一档无上限）
+var redemptionValueBuckets = []struct {
+	Label string
+	Min   float64
+	Max   float64 // 0 = no upper bound
+}{
+	{"<$1", 0, 1},
+	{"$1-5", 1, 5},
+	{"$5-10", 5, 10},
+	{"$10-50", 10, 50},
+	{"$50-100", 50, 100},
+	{">=$100", 100, 0},
+}
+
+// invalidateRedemptionAnalytics drops cached analytics after codes are added or removed
+func invalidateRedemptionAnalytics() {
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("redemption:analytics:"))
+}
+
+// GetRedemptionAnalytics returns every redemption analytics section for the
+// last N days in one payload (each section is cached on its own).
+func GetRedemptionAnalytics(ctx context.Context, days, topLimit int, noCache bool) (map[string]interface{}, error) {
+	trend, err := GetRedemptionTrend(ctx, days, noCache)
+	if err != nil {
+		return nil, err
+	}
+	latency, err := GetRedemptionLatency(ctx, days, noCache)
+	if err != nil {
+		return nil, err
+	}
+	top, err := GetTopRedeemers(ctx, days, topLimit, noCache)
+	if err != nil {
+		return nil, err
+	}
+	dist, err := GetRedemptionValueDistribution(ctx, days, noCache)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"days":               days,
+		"trend":              trend,
+		"time_to_redeem":     latency,
+		"top_redeemers":      top,
+		"value_distribution": dist,
+	}, nil
+}
+
+// GetRedemptionTrend returns per-day generated / redeemed counts.
+//
+// generated and cohort_redeemed are keyed by created_time (codes made that day
+// and how many of them have since been used), redeemed / redeemed_quota by
+// redeemed_time. redemption_rate is cohort_redeemed / generated in percent.
+func GetRedemptionTrend(ctx context.Context, days int, noCache bool) ([]map[string]interface{}, error) {
+	cm := cache.Get()
+	cacheKey := cache.Key("redemption:analytics:trend:%d", days)
+	if !noCache {
+		var cached []map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	db := database.GetRead().WithContext(ctx)
+	now := reportNow()
+	startTime := reportDayStart(now.AddDate(0, 0, -(days - 1))).Unix()
+	createdDay := reportDayExpr("created_time", startTime, now.Unix())
+	redeemedDay := reportDayExpr("redeemed_time", startTime, now.Unix())
+
+	created, err := db.QueryWithTimeout(30*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT %s as day_group,
+			COUNT(*) as generated,
+			COALESCE(SUM(quota), 0) as generated_quota,
+			SUM(CASE WHEN redeemed_time > 0 THEN 1 ELSE 0 END) as cohort_redeemed
+		FROM redemptions
+		WHERE deleted_at IS NULL AND created_time >= ?
+		GROUP BY %s`, createdDay, createdDay)), startTime)
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := db.QueryWithTimeout(30*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT %s as day_group,
+			COUNT(*) as redeemed,
+			COALESCE(SUM(quota), 0) as redeemed_quota
+		FROM redemptions
+		WHERE deleted_at IS NULL AND redeemed_time >= ?
+		GROUP BY %s`, redeemedDay, redeemedDay)), startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := mergeRedemptionTrend(created, redeemed, days, now)
+	cm.Set(cacheKey, rows, redemptionAnalyticsCacheTTL)
+	return rows, nil
+}
+
+// mergeRedemptionTrend joins the created / redeemed day groups into one
+// gap-free series of `days` local-time days ending today.
+func mergeRedemptionTrend(created, redeemed []map[string]interface{}, days int, now time.Time) []map[string]interface{} {
+	byCreated := make(map[int64]map[string]interface{}, len(created))
+	for _, r := range created {
+		byCreated[toInt64(r["day_group"])] = r
+	}
+	byRedeemed := make(map[int64]map[string]interface{}, len(redeemed))
+	for _, r := range redeemed {
+		byRedeemed[toInt64(r["day_group"])] = r
+	}
+
+	now = now.In(ReportLocation())
+	result := make([]map[string]interface{}, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		dayStart := reportDayStart(now.AddDate(0, 0, -i))
+		group := reportDayGroup(dayStart)
+
+		c, r := byCreated[group], byRedeemed[group]
+		generated := toInt64(c["generated"])
+		cohort := toInt64(c["cohort_redeemed"])
+		rate := float64(0)
+		if generated > 0 {
+			rate = roundRate(float64(cohort) / float64(generated) * 100)
+		}
+		result = append(result, map[string]interface{}{
+			"date":            dayStart.Format("2006-01-02"),
+			"timestamp":       dayStart.Unix(),
+			"generated":       generated,
+			"generated_quota": toInt64(c["generated_quota"]),
+			"cohort_redeemed": cohort,
+			"redemption_rate": rate,
+			"redeemed":        toInt64(r["redeemed"]),
+			"redeemed_quota":  toInt64(r["redeemed_quota"]),
+		})
+	}
+	return result
+}
+
+// GetRedemptionLatency returns how long codes redeemed in the window sat
+// between generation and use (seconds).
+func GetRedemptionLatency(ctx context.Context, days int, noCache bool) (map[string]interface{}, error) {
+	cm := cache.Get()
+	cacheKey := cache.Key("redemption:analytics:latency:%d", days)
+	if !noCache {
+		var cached map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	db := database.GetRead().WithContext(ctx)
+	startTime := time.Now().AddDate(0, 0, -days).Unix()
+	row, err := db.QueryOneWithTimeout(30*time.Second, db.RebindQuery(`
+		SELECT COUNT(*) as redeemed,
+			COALESCE(AVG(redeemed_time - created_time), 0) as avg_seconds,
+			COALESCE(MIN(redeemed_time - created_time), 0) as min_seconds,
+			COALESCE(MAX(redeemed_time - created_time), 0) as max_seconds,
+			SUM(CASE WHEN redeemed_time - created_time < 3600 THEN 1 ELSE 0 END) as within_1h,
+			SUM(CASE WHEN redeemed_time - created_time < 86400 THEN 1 ELSE 0 END) as within_1d,
+			SUM(CASE WHEN redeemed_time - created_time < 604800 THEN 1 ELSE 0 END) as within_7d
+		FROM redemptions
+		WHERE deleted_at IS NULL AND redeemed_time >= ? AND created_time > 0 AND redeemed_time >= created_time`), startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"redeemed":    int64(0),
+		"avg_seconds": float64(0),
+		"avg_hours":   float64(0),
+		"min_seconds": int64(0),
+		"max_seconds": int64(0),
+		"within_1h":   int64(0),
+		"within_1d":   int64(0),
+		"within_7d":   int64(0),
+	}
+	if row != nil {
+		avg := toFloat64(row["avg_seconds"])
+		result["redeemed"] = toInt64(row["redeemed"])
+		result["avg_seconds"] = roundRate(avg)
+		result["avg_hours"] = roundRate(avg / 3600)
+		result["min_seconds"] = toInt64(row["min_seconds"])
+		result["max_seconds"] = toInt64(row["max_seconds"])
+		result["within_1h"] = toInt64(row["within_1h"])
+		result["within_1d"] = toInt64(row["within_1d"])
+		result["within_7d"] = toInt64(row["within_7d"])
+	}
+
+	cm.Set(cacheKey, result, redemptionAnalyticsCacheTTL)
+	return result, nil
+}
+
+// GetTopRedeemers returns the users who redeemed the most quota in the window
+func GetTopRedeemers(ctx context.Context, days, limit int, noCache bool) ([]map[string]interface{}, error) {
+	cm := cache.Get()
+	cacheKey := cache.Key("redemption:analytics:top:%d:%d", days, limit)
+	if !noCache {
+		var cached []map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	db := database.GetRead().WithContext(ctx)
+	startTime := time.Now().AddDate(0, 0, -days).Unix()
+	rows, err := db.QueryWithTimeout(30*time.Second, db.RebindQuery(`
+		SELECT r.used_user_id as user_id,
+			COALESCE(MAX(u.username), '') as username,
+			COUNT(*) as redeemed,
+			COALESCE(SUM(r.quota), 0) as redeemed_quota,
+			MIN(r.redeemed_time) as first_redeemed,
+			MAX(r.redeemed_time) as last_redeemed
+		FROM redemptions r
+		LEFT JOIN users u ON u.id = r.used_user_id
+		WHERE r.deleted_at IS NULL AND r.redeemed_time >= ? AND r.used_user_id > 0
+		GROUP BY r.used_user_id
+		ORDER BY redeemed_quota DESC, redeemed DESC
+		LIMIT ?`), startTime, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		r["redeemed_usd"] = roundRate(float64(toInt64(r["redeemed_quota"])) / util.TokensPerUSD)
+	}
+
+	cm.Set(cacheKey, rows, redemptionAnalyticsCacheTTL)
+	return rows, nil
+}
+
+// GetRedemptionValueDistribution buckets codes generated in the window by face
+// value and reports how many of each bucket were redeemed.
+func GetRedemptionValueDistribution(ctx context.Context, days int, noCache bool) ([]map[string]interface{}, error) {
+	cm := cache.Get()
+	cacheKey := cache.Key("redemption:analytics:values:%d", days)
+	if !noCache {
+		var cached []map[string]interface{}
+		if found, _ := cm.GetJSON(cacheKey, &cached); found {
+			return cached, nil
+		}
+	}
+
+	db := database.GetRead().WithContext(ctx)
+	startTime := time.Now().AddDate(0, 0, -days).Unix()
+
+	// CASE quota < b1 THEN 0 WHEN quota < b2 THEN 1 ... ELSE n
+	var cases []string
+	for i, b := range redemptionValueBuckets {
+		if b.Max > 0 {
+			cases = append(cases, fmt.Sprintf("WHEN quota < %d THEN %d", int64(b.Max*util.TokensPerUSD), i))
+		}
+	}
+	bucketExpr := fmt.Sprintf("CASE %s ELSE %d END", strings.Join(cases, " "), len(redemptionValueBuckets)-1)
+
+	rows, err := db.QueryWithTimeout(30*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT %s as bucket,
+			COUNT(*) as generated,
+			COALESCE(SUM(quota), 0) as generated_quota,
+			SUM(CASE WHEN redeemed_time > 0 THEN 1 ELSE 0 END) as redeemed,
+			COALESCE(SUM(CASE WHEN redeemed_time > 0 THEN quota ELSE 0 END), 0) as redeemed_quota
+		FROM redemptions
+		WHERE deleted_at IS NULL AND created_time >= ?
+		GROUP BY %s`, bucketExpr, bucketExpr)), startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	byBucket := make(map[int64]map[string]interface{}, len(rows))
+	for _, r := range rows {
+		byBucket[toInt64(r["bucket"])] = r
+	}
+	result := make([]map[string]interface{}, 0, len(redemptionValueBuckets))
+	for i, b := range redemptionValueBuckets {
+		r := byBucket[int64(i)]
+		generated, redeemed := toInt64(r["generated"]), toInt64(r["redeemed"])
+		rate := float64(0)
+		if generated > 0 {
+			rate = roundRate(float64(redeemed) / float64(generated) * 100)
+		}
+		result = append(result, map[string]interface{}{
+			"label":           b.Label,
+			"min_usd":         b.Min,
+			"max_usd":         b.Max,
+			"generated":       generated,
+			"generated_quota": toInt64(r["generated_quota"]),
+			"redeemed":        redeemed,
+			"redeemed_quota":  toInt64(r["redeemed_quota"]),
+			"redemption_rate": rate,
+		})
+	}
+
+	cm.Set(cacheKey, result, redemptionAnalyticsCacheTTL)
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func TestRedemptionAnalytics(t *testing.T) {
+	seedRedemptions(t)
+	db := database.Get().DB
+	now := time.Now().Unix()
+	db.MustExec(`INSERT INTO users (id, username) VALUES (7, 'alice'), (8, 'bob')`)
+	// 3 fresh codes: $2 redeemed by alice after 1h, $20 redeemed by alice after 2d, $200 unused
+	db.MustExec(`INSERT INTO redemptions (key, name, quota, created_time, redeemed_time, used_user_id) VALUES
+		('freshcode0000001', 'p', 1000000, ?, ?, 7),
+		('freshcode0000002', 'p', 10000000, ?, ?, 7),
+		('freshcode0000003', 'p', 100000000, ?, 0, 0)`,
+		now-7200, now-3600, now-3*86400, now-86400, now-600)
+
+	res, err := GetRedemptionAnalytics(context.Background(), 7, 10, true)
+	if err != nil {
+		t.Fatalf("GetRedemptionAnalytics: %v", err)
+	}
+
+	trend := res["trend"].([]map[string]interface{})
+	if len(trend) != 7 {
+		t.Fatalf("expected 7 trend days, got %d", len(trend))
+	}
+	var generated, redeemed int64
+	for _, d := range trend {
+		generated += toInt64(d["generated"])
+		redeemed += toInt64(d["redeemed"])
+	}
+	if generated != 3 || redeemed != 2 {
+		t.Fatalf("trend totals: generated=%d redeemed=%d", generated, redeemed)
+	}
+
+	latency := res["time_to_redeem"].(map[string]interface{})
+	if toInt64(latency["redeemed"]) != 2 || toInt64(latency["within_1h"]) != 0 || toInt64(latency["within_1d"]) != 1 {
+		t.Fatalf("unexpected latency: %+v", latency)
+	}
+
+	top := res["top_redeemers"].([]map[string]interface{})
+	if len(top) != 1 || toString(top[0]["username"]) != "alice" || toInt64(top[0]["redeemed"]) != 2 {
+		t.Fatalf("unexpected top redeemers: %+v", top)
+	}
+
+	dist := res["value_distribution"].([]map[string]interface{})
+	want := map[string][2]int64{"$1-5": {1, 1}, "$10-50": {1, 1}, ">=$100": {1, 0}}
+	for _, b := range dist {
+		w := want[b["label"].(string)]
+		if toInt64(b["generated"]) != w[0] || toInt64(b["redeemed"]) != w[1] {
+			t.Fatalf("bucket %v: got generated=%v redeemed=%v", b["label"], b["generated"], b["redeemed"])
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+// RedemptionExportLimit caps how many codes a single export may contain.
+var RedemptionExportLimit int64 = 100000
+
+// RedemptionImportLimit caps how many codes a single import may contain.
+const RedemptionImportLimit = 5000
+
+// redemptionKeyPattern matches keys NewAPI accepts (redemptions.key is char(32)).
+var redemptionKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,32}$`)
+
+// RedemptionImportItem is one code to import. Amount is in USD and converted
+// with util.TokensPerUSD; Quota (raw tokens) wins when both are given.
+type RedemptionImportItem struct {
+	Key         string  `json:"key"`
+	Amount      float64 `json:"amount"`
+	Quota       int64   `json:"quota"`
+	ExpiredTime int64   `json:"expired_time"`
+}
+
+// RedemptionImportParams is the body of POST /api/redemptions/import.
+//
+// Codes can be sent as structured Items, or as raw Content in "txt" (one key
+// per line) or "csv" (key[,amount[,expired_time]]) format. Lines without an
+// amount fall back to DefaultAmount.
+type RedemptionImportParams struct {
+	Name          string                 `json:"name"`
+	Format        string                 `json:"format"` // txt | csv (only for Content)
+	Content       string                 `json:"content"`
+	Items         []RedemptionImportItem `json:"items"`
+	DefaultAmount float64                `json:"default_amount"`
+	ExpireMode    string                 `json:"expire_mode"`
+	ExpireDays    int                    `json:"expire_days"`
+	ExpireDate    string                 `json:"expire_date"`
+	DryRun        bool                   `json:"dry_run"`
+}
+
+// RedemptionImportIssue describes a rejected line
+type RedemptionImportIssue struct {
+	Line   int    `json:"line"`
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// RedemptionImportResult summarises an import (or dry run)
+type RedemptionImportResult struct {
+	Total            int                     `json:"total"`
+	Valid            int                     `json:"valid"`
+	Imported         int                     `json:"imported"`
+	DryRun           bool                    `json:"dry_run"`
+	DuplicateInBatch []RedemptionImportIssue `json:"duplicate_in_batch"`
+	AlreadyExists    []RedemptionImportIssue `json:"already_exists"`
+	Invalid          []RedemptionImportIssue `json:"invalid"`
+}
+
+type parsedImportItem struct {
+	line int
+	RedemptionImportItem
+}
+
+// CountRedemptionCodes returns the number of codes matching the list filter.
+// Used by the export handler to enforce RedemptionExportLimit up front.
+func CountRedemptionCodes(ctx context.Context, params ListRedemptionParams) (int64, error) {
+	db := database.Get().WithContext(ctx)
+	whereSQL, args, _ := buildRedemptionWhere(db, params, time.Now().Unix())
+	var total int64
+	if err := db.DB.GetContext(ctx, &total, fmt.Sprintf("SELECT COUNT(*) FROM redemptions r WHERE %s", whereSQL), args...); err != nil {
+		return 0, fmt.Errorf("count query failed: %w", err)
+	}
+	return total, nil
+}
+
+// ExportRedemptionCodes streams codes matching params to w.
+// format "txt" writes one key per line (for distribution); "csv" writes a
+// UTF-8 BOM + header with amount, status and timestamps. A non-nil anon
+// (csv only) masks the codes and the redeeming usernames.
+func ExportRedemptionCodes(ctx context.Context, w io.Writer, format string, params ListRedemptionParams, anon *ExportAnonymizer) error {
+	db := database.Get()
+	kc := keyCol(db.IsPG)
+	now := time.Now().Unix()
+	whereSQL, args, _ := buildRedemptionWhere(db, params, now)
+
+	selectSQL := fmt.Sprintf(`SELECT r.id, r.%s as "key", COALESCE(r.name,'') as name, COALESCE(r.quota,0) as quota, COALESCE(r.created_time,0) as created_time, COALESCE(r.redeemed_time,0) as redeemed_time, COALESCE(r.used_user_id,0) as used_user_id, COALESCE(u.username,'') as used_username, COALESCE(r.expired_time,0) as expired_time FROM redemptions r LEFT JOIN users u ON r.used_user_id = u.id AND r.used_user_id > 0 WHERE %s ORDER BY r.id ASC`,
+		kc, whereSQL)
+	rows, err := db.DB.QueryxContext(ctx, selectSQL, args...)
+	if err != nil {
+		return fmt.Errorf("export query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var csvW *csv.Writer
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	if format == "csv" {
+		// UTF-8 BOM so Excel (zh-CN locale) auto-detects encoding.
+		if _, err := bw.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+			return err
+		}
+		csvW = csv.NewWriter(bw)
+		defer csvW.Flush()
+		if err := csvW.Write([]string{"ID", "兑换码", "名称", "额度", "金额(USD)", "状态", "创建时间", "过期时间", "兑换时间", "兑换用户"}); err != nil {
+			return err
+		}
+	}
+
+	formatTime := func(ts int64) string {
+		if ts <= 0 {
+			return ""
+		}
+		return time.Unix(ts, 0).Format(time.RFC3339)
+	}
+
+	var written int64
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var code RedemptionCode
+		if err := rows.StructScan(&code); err != nil {
+			continue
+		}
+		if csvW == nil {
+			if _, err := bw.WriteString(code.Key + "\n"); err != nil {
+				return err
+			}
+		} else {
+			if err := csvW.Write([]string{
+				strconv.FormatInt(code.ID, 10),
+				anon.Code(code.Key),
+				code.Name,
+				strconv.FormatInt(code.Quota, 10),
+				strconv.FormatFloat(float64(code.Quota)/util.TokensPerUSD, 'f', 2, 64),
+				redemptionStatus(code, now),
+				formatTime(code.CreatedTime),
+				formatTime(code.ExpiredTime),
+				formatTime(code.RedeemedTime),
+				anon.Name(code.UsedUsername),
+			}); err != nil {
+				return err
+			}
+		}
+		written++
+		if written >= RedemptionExportLimit {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// ImportRedemptionCodes validates and inserts externally generated codes.
+// Keys that fail validation, repeat within the batch, or already exist in
+// the redemptions table (including soft-deleted rows, which still hold the
+// unique key) are reported and skipped; the rest are inserted in one
+// transaction unless DryRun is set.
+func ImportRedemptionCodes(ctx context.Context, params RedemptionImportParams) (*RedemptionImportResult, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	items, err := parseRedemptionImport(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no codes to import")
+	}
+	if len(items) > RedemptionImportLimit {
+		return nil, fmt.Errorf("too many codes (max %d per import)", RedemptionImportLimit)
+	}
+
+	defaultExpiry := int64(0)
+	if params.ExpireMode != "" && params.ExpireMode != "never" {
+		defaultExpiry, err = util.CalculateExpiration(params.ExpireMode, params.ExpireDays, params.ExpireDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate expiration: %w", err)
+		}
+	}
+	defaultQuota, err := util.CalculateFixedQuota(params.DefaultAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RedemptionImportResult{
+		Total:            len(items),
+		DryRun:           params.DryRun,
+		DuplicateInBatch: []RedemptionImportIssue{},
+		AlreadyExists:    []RedemptionImportIssue{},
+		Invalid:          []RedemptionImportIssue{},
+	}
+
+	seen := make(map[string]int, len(items))
+	valid := make([]parsedImportItem, 0, len(items))
+	for _, it := range items {
+		it.Key = strings.TrimSpace(it.Key)
+		if !redemptionKeyPattern.MatchString(it.Key) {
+			result.Invalid = append(result.Invalid, RedemptionImportIssue{Line: it.line, Key: it.Key, Reason: "兑换码须为 8-32 位字母、数字、- 或 _"})
+			continue
+		}
+		if first, dup := seen[it.Key]; dup {
+			result.DuplicateInBatch = append(result.DuplicateInBatch, RedemptionImportIssue{Line: it.line, Key: it.Key, Reason: fmt.Sprintf("与第 %d 行重复", first)})
+			continue
+		}
+		seen[it.Key] = it.line
+
+		if it.Amount < 0 {
+			result.Invalid = append(result.Invalid, RedemptionImportIssue{Line: it.line, Key: it.Key, Reason: "金额格式错误"})
+			continue
+		}
+		if it.Quota <= 0 {
+			if it.Amount > 0 {
+				it.Quota, _ = util.CalculateFixedQuota(it.Amount)
+			} else {
+				it.Quota = defaultQuota
+			}
+		}
+		if it.Quota <= 0 {
+			result.Invalid = append(result.Invalid, RedemptionImportIssue{Line: it.line, Key: it.Key, Reason: "额度必须大于 0"})
+			continue
+		}
+		if it.ExpiredTime == 0 {
+			it.ExpiredTime = defaultExpiry
+		}
+		valid = append(valid, it)
+	}
+
+	db := database.Get().WithContext(ctx)
+	existing, err := existingRedemptionKeys(db, valid)
+	if err != nil {
+		return nil, err
+	}
+	toInsert := valid[:0]
+	for _, it := range valid {
+		if existing[it.Key] {
+			result.AlreadyExists = append(result.AlreadyExists, RedemptionImportIssue{Line: it.line, Key: it.Key, Reason: "兑换码已存在"})
+			continue
+		}
+		toInsert = append(toInsert, it)
+	}
+	result.Valid = len(toInsert)
+	if params.DryRun || len(toInsert) == 0 {
+		return result, nil
+	}
+
+	kc := keyCol(db.IsPG)
+	insertSQL := db.RebindQuery(fmt.Sprintf(`INSERT INTO redemptions (user_id, %s, name, quota, created_time, redeemed_time, used_user_id, expired_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, kc))
+	tx, err := db.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	createdTime := time.Now().Unix()
+	for _, it := range toInsert {
+		if _, err := tx.Exec(insertSQL, 1, it.Key, name, it.Quota, createdTime, 0, 0, it.ExpiredTime); err != nil {
+			return nil, fmt.Errorf("insert %s failed: %w", it.Key, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.Imported = len(toInsert)
+
+	logger.L.Business(fmt.Sprintf("兑换码导入 | count=%d | skipped=%d | name=%s",
+		result.Imported, result.Total-result.Imported, name))
+	invalidateRedemptionAnalytics()
+	return result, nil
+}
+
+// parseRedemptionImport flattens Items / Content into line-numbered items
+func parseRedemptionImport(params RedemptionImportParams) ([]parsedImportItem, error) {
+	var items []parsedImportItem
+	for i, it := range params.Items {
+		items = append(items, parsedImportItem{line: i + 1, RedemptionImportItem: it})
+	}
+	content := strings.TrimPrefix(params.Content, "\ufeff")
+	if strings.TrimSpace(content) == "" {
+		return items, nil
+	}
+
+	format := strings.ToLower(strings.TrimSpace(params.Format))
+	if format == "" {
+		format = "txt"
+		if strings.Contains(content, ",") {
+			format = "csv"
+		}
+	}
+	switch format {
+	case "txt":
+		for i, line := range strings.Split(content, "\n") {
+			if key := strings.TrimSpace(line); key != "" {
+				items = append(items, parsedImportItem{line: i + 1, RedemptionImportItem: RedemptionImportItem{Key: key}})
+			}
+		}
+	case "csv":
+		r := csv.NewReader(strings.NewReader(content))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		line := 0
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			line++
+			if err != nil {
+				return nil, fmt.Errorf("csv line %d: %w", line, err)
+			}
+			if len(rec) == 0 || strings.TrimSpace(rec[0]) == "" {
+				continue
+			}
+			// Skip a header row such as "key,amount,expired_time".
+			if line == 1 && !redemptionKeyPattern.MatchString(strings.TrimSpace(rec[0])) {
+				continue
+			}
+			it := RedemptionImportItem{Key: strings.TrimSpace(rec[0])}
+			if len(rec) > 1 && strings.TrimSpace(rec[1]) != "" {
+				amount, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+				if err != nil || amount < 0 {
+					it.Amount = -1
+				} else {
+					it.Amount = amount
+				}
+			}
+			if len(rec) > 2 && strings.TrimSpace(rec[2]) != "" {
+				it.ExpiredTime, _ = strconv.ParseInt(strings.TrimSpace(rec[2]), 10, 64)
+			}
+			items = append(items, parsedImportItem{line: line, RedemptionImportItem: it})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q (txt or csv)", format)
+	}
+	return items, nil
+}
+
+// existingRedemptionKeys returns which of the given keys are already present
+func existingRedemptionKeys(db *database.Manager, items []parsedImportItem) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	kc := keyCol(db.IsPG)
+	const chunk = 500
+	for start := 0; start < len(items); start += chunk {
+		end := start + chunk
+		if end > len(items) {
+			end = len(items)
+		}
+		placeholders := make([]string, 0, end-start)
+		args := make([]interface{}, 0, end-start)
+		for _, it := range items[start:end] {
+			placeholders = append(placeholders, "?")
+			args = append(args, it.Key)
+		}
+		var keys []string
+		query := db.RebindQuery(fmt.Sprintf("SELECT %s FROM redemptions WHERE %s IN (%s)", kc, kc, strings.Join(placeholders, ",")))
+		if err := db.DB.SelectContext(db.Context(), &keys, query, args...); err != nil {
+			return nil, fmt.Errorf("duplicate check failed: %w", err)
+		}
+		for _, k := range keys {
+			existing[k] = true
+		}
+	}
+	return existing, nil
+}
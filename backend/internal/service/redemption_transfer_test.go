@@ -0,0 +1,78 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func seedRedemptions(t *testing.T) {
+	t.Helper()
+	db := installSQLiteForTests(t)
+	schema := `
+	CREATE TABLE redemptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		key TEXT NOT NULL UNIQUE,
+		name TEXT,
+		quota INTEGER NOT NULL DEFAULT 0,
+		created_time INTEGER NOT NULL DEFAULT 0,
+		redeemed_time INTEGER NOT NULL DEFAULT 0,
+		used_user_id INTEGER NOT NULL DEFAULT 0,
+		expired_time INTEGER NOT NULL DEFAULT 0,
+		deleted_at TEXT
+	);
+	CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT);
+	INSERT INTO redemptions (key, name, quota, created_time) VALUES ('existingcode0001', 'old', 500000, 1700000000);
+	INSERT INTO redemptions (key, name, quota, created_time, deleted_at) VALUES ('deletedcode00001', 'old', 500000, 1700000000, '2024-01-01');`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+}
+
+func TestImportRedemptionCodesDetectsDuplicates(t *testing.T) {
+	seedRedemptions(t)
+
+	content := "key,amount\nnewcode000000001,2\nnewcode000000001,3\nexistingcode0001\ndeletedcode00001\nbad key!\nnewcode000000002,abc\nnewcode000000003\n"
+	params := RedemptionImportParams{Name: "partner", Format: "csv", Content: content, DefaultAmount: 1, DryRun: true}
+
+	dry, err := ImportRedemptionCodes(context.Background(), params)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.Imported != 0 || dry.Valid != 2 {
+		t.Fatalf("dry run should validate 2 codes without importing, got %+v", dry)
+	}
+	if len(dry.DuplicateInBatch) != 1 || len(dry.AlreadyExists) != 2 || len(dry.Invalid) != 2 {
+		t.Fatalf("unexpected issue breakdown: %+v", dry)
+	}
+
+	params.DryRun = false
+	res, err := ImportRedemptionCodes(context.Background(), params)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Imported != 2 {
+		t.Fatalf("expected 2 imported, got %+v", res)
+	}
+
+	var quota int64
+	if err := database.Get().DB.Get(&quota, `SELECT quota FROM redemptions WHERE key = 'newcode000000001'`); err != nil || quota != 1000000 {
+		t.Fatalf("expected per-line amount to win (1000000), got %d err=%v", quota, err)
+	}
+}
+
+func TestExportRedemptionCodesTXT(t *testing.T) {
+	seedRedemptions(t)
+
+	var buf bytes.Buffer
+	if err := ExportRedemptionCodes(context.Background(), &buf, "txt", ListRedemptionParams{}, nil); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "existingcode0001" {
+		t.Fatalf("txt export should list only non-deleted keys, got %q", got)
+	}
+}
@@ -0,0 +1,564 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const registrationSpikeSettingsKey = "registration_spikes"
+
+const (
+	// registrationMinSamples is the number of hourly samples needed before
+	// the baseline is trusted
+	registrationMinSamples = 6
+	// registrationSnapshotLimit bounds the users kept per spike
+	registrationSnapshotLimit = 500
+	// registrationSampleRetentionDays bounds the samples table
+	registrationSampleRetentionDays = 60
+)
+
+// Registration spike review states
+const (
+	RegistrationSpikeOpen      = "open"
+	RegistrationSpikeReviewed  = "reviewed"
+	RegistrationSpikeDismissed = "dismissed"
+)
+
+var (
+	ErrInvalidRegistrationSpike  = errors.New("invalid registration spike request")
+	ErrRegistrationSpikeNotFound = errors.New("registration spike not found")
+)
+
+// registrationSpikeMu serialises sampling so one hour is never counted twice
+var registrationSpikeMu sync.Mutex
+
+// RegistrationSpikeSettings configures the registration velocity monitor
+type RegistrationSpikeSettings struct {
+	Enabled       bool    `json:"enabled"`        // 关闭后仍采样，但不告警
+	Multiplier    float64 `json:"multiplier"`     // 注册速率达到基线的倍数视为突增
+	BaselineHours int     `json:"baseline_hours"` // 基线取此前多少小时的平均速率
+	MinNewUsers   int64   `json:"min_new_users"`  // 单次采样新增用户少于该值不告警
+	UpdatedAt     int64   `json:"updated_at"`
+}
+
+// RegistrationSpikeSettingsInput supports partial update of RegistrationSpikeSettings
+type RegistrationSpikeSettingsInput struct {
+	Enabled       *bool    `json:"enabled"`
+	Multiplier    *float64 `json:"multiplier"`
+	BaselineHours *int     `json:"baseline_hours"`
+	MinNewUsers   *int64   `json:"min_new_users"`
+}
+
+// RegistrationSample is the users.id growth measured at the start of an hour.
+// New users are counted by id, since older NewAPI versions have no users.created_at.
+type RegistrationSample struct {
+	At        int64   `json:"at"`
+	MaxUserID int64   `json:"max_user_id"`
+	NewUsers  int64   `json:"new_users"`
+	Hours     float64 `json:"hours"` // 距上次采样的小时数（停机后可能 > 1）
+	Rate      float64 `json:"rate"`  // 每小时新增用户
+	Spike     bool    `json:"spike"`
+}
+
+// RegistrationSnapshot is the batch of new users captured when a spike is raised
+type RegistrationSnapshot struct {
+	Users       []map[string]interface{} `json:"users"`
+	Truncated   bool                     `json:"truncated"`
+	Groups      map[string]int64         `json:"groups"`
+	TopInviters []map[string]interface{} `json:"top_inviters"`
+	SharedIPs   []map[string]interface{} `json:"shared_ips"` // 被多个新用户使用的 IP（来自首批请求日志）
+	Errors      []string                 `json:"errors,omitempty"`
+}
+
+// RegistrationSpike is one raised alert awaiting review
+type RegistrationSpike struct {
+	ID         int64                 `json:"id"`
+	At         int64                 `json:"at"`
+	FromUserID int64                 `json:"from_user_id"` // 不含
+	ToUserID   int64                 `json:"to_user_id"`   // 含
+	NewUsers   int64                 `json:"new_users"`
+	Rate       float64               `json:"rate"`
+	Baseline   float64               `json:"baseline"`
+	Ratio      float64               `json:"ratio"`
+	Status     string                `json:"status"`
+	Note       string                `json:"note"`
+	ReviewedBy string                `json:"reviewed_by"`
+	ReviewedAt int64                 `json:"reviewed_at"`
+	CreatedAt  int64                 `json:"created_at"`
+	Snapshot   *RegistrationSnapshot `json:"snapshot,omitempty"`
+}
+
+// RegistrationSpikeService samples registration velocity and keeps spike snapshots
+type RegistrationSpikeService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewRegistrationSpikeService creates a RegistrationSpikeService on the primary instance
+func NewRegistrationSpikeService() *RegistrationSpikeService {
+	return &RegistrationSpikeService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *RegistrationSpikeService) WithContext(ctx context.Context) *RegistrationSpikeService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func ensureRegistrationSpikeTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS registration_samples (
+			at INTEGER PRIMARY KEY,
+			max_user_id INTEGER NOT NULL DEFAULT 0,
+			new_users INTEGER NOT NULL DEFAULT 0,
+			hours REAL NOT NULL DEFAULT 0,
+			spike INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS registration_spikes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at INTEGER NOT NULL,
+			from_user_id INTEGER NOT NULL DEFAULT 0,
+			to_user_id INTEGER NOT NULL DEFAULT 0,
+			new_users INTEGER NOT NULL DEFAULT 0,
+			rate REAL NOT NULL DEFAULT 0,
+			baseline REAL NOT NULL DEFAULT 0,
+			ratio REAL NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT 'open',
+			note TEXT NOT NULL DEFAULT '',
+			reviewed_by TEXT NOT NULL DEFAULT '',
+			reviewed_at INTEGER NOT NULL DEFAULT 0,
+			snapshot TEXT NOT NULL DEFAULT '{}',
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_registration_spikes_status ON registration_spikes(status, id)`)
+	return err
+}
+
+func openRegistrationSpikeStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureRegistrationSpikeTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func defaultRegistrationSpikeSettings() RegistrationSpikeSettings {
+	return RegistrationSpikeSettings{Enabled: true, Multiplier: 3, BaselineHours: 168, MinNewUsers: 10}
+}
+
+func normalizeRegistrationSpikeSettings(s *RegistrationSpikeSettings) error {
+	if s.Multiplier == 0 {
+		s.Multiplier = 3
+	}
+	if s.Multiplier < 1.5 || s.Multiplier > 100 {
+		return fmt.Errorf("%w: multiplier 需在 1.5-100 之间", ErrInvalidRegistrationSpike)
+	}
+	s.BaselineHours = clampSetting(s.BaselineHours, 24, 720, 168)
+	if s.MinNewUsers < 1 {
+		return fmt.Errorf("%w: min_new_users 至少为 1", ErrInvalidRegistrationSpike)
+	}
+	return nil
+}
+
+// GetSettings returns the monitor settings
+func (s *RegistrationSpikeService) GetSettings(ctx context.Context) (RegistrationSpikeSettings, error) {
+	settings := defaultRegistrationSpikeSettings()
+	if _, err := loadLocalSetting(ctx, registrationSpikeSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeRegistrationSpikeSettings(&settings); err != nil {
+		return defaultRegistrationSpikeSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update
+func (s *RegistrationSpikeService) UpdateSettings(ctx context.Context, in RegistrationSpikeSettingsInput) (RegistrationSpikeSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Multiplier != nil {
+		settings.Multiplier = *in.Multiplier
+	}
+	if in.BaselineHours != nil {
+		settings.BaselineHours = *in.BaselineHours
+	}
+	if in.MinNewUsers != nil {
+		settings.MinNewUsers = *in.MinNewUsers
+	}
+	if err := normalizeRegistrationSpikeSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, registrationSpikeSettingsKey, settings)
+}
+
+func latestRegistrationSample(ctx context.Context, db *sql.DB) (RegistrationSample, bool, error) {
+	var sample RegistrationSample
+	var spike int
+	err := db.QueryRowContext(ctx, `
+		SELECT at, max_user_id, new_users, hours, spike FROM registration_samples ORDER BY at DESC LIMIT 1`).
+		Scan(&sample.At, &sample.MaxUserID, &sample.NewUsers, &sample.Hours, &spike)
+	if err == sql.ErrNoRows {
+		return sample, false, nil
+	}
+	sample.Spike = spike == 1
+	return sample, err == nil, err
+}
+
+// registrationBaseline is the mean hourly rate of the samples in
+// [at-hours, at), spikes excluded; ok is false with too little history
+func registrationBaseline(ctx context.Context, db *sql.DB, at int64, hours int) (float64, bool, error) {
+	var newUsers, elapsed float64
+	var samples int
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(new_users), 0), COALESCE(SUM(hours), 0), COUNT(*) FROM registration_samples
+		WHERE at >= ? AND at < ? AND hours > 0 AND spike = 0`, at-int64(hours)*3600, at).
+		Scan(&newUsers, &elapsed, &samples)
+	if err != nil || samples < registrationMinSamples || elapsed <= 0 {
+		return 0, false, err
+	}
+	return newUsers / elapsed, true, nil
+}
+
+// Check takes the hourly sample when a new hour has started and raises a
+// spike when the registration rate since the last sample exceeds
+// multiplier × baseline. Returns the raised spike, if any.
+func (s *RegistrationSpikeService) Check(ctx context.Context) (*RegistrationSpike, error) {
+	registrationSpikeMu.Lock()
+	defer registrationSpikeMu.Unlock()
+
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openRegistrationSpikeStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	now := time.Now().Unix()
+	at := now - now%3600
+	last, found, err := latestRegistrationSample(ctx, db)
+	if err != nil || (found && last.At >= at) {
+		return nil, err
+	}
+
+	row, err := s.db.QueryOne(`SELECT COALESCE(MAX(id), 0) AS max_id FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	sample := RegistrationSample{At: at, MaxUserID: toInt64(row["max_id"])}
+	if found && sample.MaxUserID > last.MaxUserID {
+		// 计数而不是 id 差值：id 可能跳号，软删除的用户仍计入
+		row, err := s.db.QueryOne(s.db.RebindQuery(`SELECT COUNT(*) AS cnt FROM users WHERE id > ? AND id <= ?`),
+			last.MaxUserID, sample.MaxUserID)
+		if err != nil {
+			return nil, err
+		}
+		sample.NewUsers = toInt64(row["cnt"])
+	}
+	if found {
+		sample.Hours = float64(at-last.At) / 3600
+		sample.Rate = float64(sample.NewUsers) / sample.Hours
+	}
+
+	var spike *RegistrationSpike
+	if found && settings.Enabled && sample.NewUsers >= settings.MinNewUsers {
+		baseline, ok, err := registrationBaseline(ctx, db, at, settings.BaselineHours)
+		if err != nil {
+			return nil, err
+		}
+		if ok && sample.Rate >= settings.Multiplier*baseline {
+			sample.Spike = true
+			spike = &RegistrationSpike{
+				At:         at,
+				FromUserID: last.MaxUserID,
+				ToUserID:   sample.MaxUserID,
+				NewUsers:   sample.NewUsers,
+				Rate:       roundRate(sample.Rate),
+				Baseline:   roundRate(baseline),
+				Status:     RegistrationSpikeOpen,
+				CreatedAt:  now,
+			}
+			if baseline > 0 {
+				spike.Ratio = roundRate(sample.Rate / baseline)
+			}
+			spike.Snapshot = s.snapshot(last.MaxUserID, sample.MaxUserID, last.At)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO registration_samples (at, max_user_id, new_users, hours, spike) VALUES (?, ?, ?, ?, ?)`,
+		sample.At, sample.MaxUserID, sample.NewUsers, sample.Hours, boolToInt(sample.Spike)); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM registration_samples WHERE at < ?`,
+		at-registrationSampleRetentionDays*86400); err != nil {
+		logger.L.Warn("[注册监控] 清理采样失败: " + err.Error())
+	}
+	if spike == nil {
+		return nil, nil
+	}
+
+	snapshot, _ := json.Marshal(spike.Snapshot)
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO registration_spikes (at, from_user_id, to_user_id, new_users, rate, baseline, ratio, status, snapshot, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, spike.At, spike.FromUserID, spike.ToUserID, spike.NewUsers,
+		spike.Rate, spike.Baseline, spike.Ratio, spike.Status, string(snapshot), spike.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	spike.ID, _ = res.LastInsertId()
+	PublishEvent(EventRegistrationSpike, map[string]interface{}{
+		"spike_id":  spike.ID,
+		"new_users": spike.NewUsers,
+		"rate":      spike.Rate,
+		"baseline":  spike.Baseline,
+		"ratio":     spike.Ratio,
+	})
+	return spike, nil
+}
+
+// snapshot captures the users with from < id <= to plus what their first
+// requests reveal; parts that fail are noted instead of dropping the alert
+func (s *RegistrationSpikeService) snapshot(from, to, since int64) *RegistrationSnapshot {
+	snap := &RegistrationSnapshot{
+		Users:       []map[string]interface{}{},
+		Groups:      map[string]int64{},
+		TopInviters: []map[string]interface{}{},
+		SharedIPs:   []map[string]interface{}{},
+	}
+	groupCol := "`group`"
+	if s.db.IsPG {
+		groupCol = `"group"`
+	}
+	rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(`
+		SELECT id, COALESCE(username, '') AS username, COALESCE(display_name, '') AS display_name,
+			COALESCE(email, '') AS email, COALESCE(%s, 'default') AS user_group, COALESCE(status, 0) AS status,
+			COALESCE(inviter_id, 0) AS inviter_id, COALESCE(github_id, '') AS github_id,
+			COALESCE(linux_do_id, '') AS linux_do_id
+		FROM users WHERE id > ? AND id <= ? ORDER BY id LIMIT ?`, groupCol)), from, to, registrationSnapshotLimit+1)
+	if err != nil {
+		snap.Errors = append(snap.Errors, "users: "+err.Error())
+		return snap
+	}
+	if len(rows) > registrationSnapshotLimit {
+		rows, snap.Truncated = rows[:registrationSnapshotLimit], true
+	}
+	inviters := map[int64]int64{}
+	ids := make([]interface{}, 0, len(rows))
+	for _, u := range rows {
+		snap.Users = append(snap.Users, u)
+		snap.Groups[toString(u["user_group"])]++
+		if inviter := toInt64(u["inviter_id"]); inviter > 0 {
+			inviters[inviter]++
+		}
+		ids = append(ids, toInt64(u["id"]))
+	}
+	for inviter, n := range inviters {
+		if n > 1 {
+			snap.TopInviters = append(snap.TopInviters, map[string]interface{}{"inviter_id": inviter, "users": n})
+		}
+	}
+	sort.Slice(snap.TopInviters, func(i, j int) bool {
+		return toInt64(snap.TopInviters[i]["users"]) > toInt64(snap.TopInviters[j]["users"])
+	})
+	if len(ids) == 0 {
+		return snap
+	}
+
+	// first-seen from logs: new accounts sharing an IP are the usual sign of a farm
+	args := append([]interface{}{since}, ids...)
+	in := placeholders(len(ids))
+	firstSeen, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT user_id, MIN(created_at) AS first_seen_at, COUNT(*) AS requests
+		FROM logs WHERE created_at >= ? AND user_id IN (`+in+`)
+		GROUP BY user_id`), args...)
+	if err != nil {
+		snap.Errors = append(snap.Errors, "first_seen: "+err.Error())
+	} else {
+		byUser := map[int64]map[string]interface{}{}
+		for _, r := range firstSeen {
+			byUser[toInt64(r["user_id"])] = r
+		}
+		for _, u := range snap.Users {
+			r := byUser[toInt64(u["id"])]
+			u["first_seen_at"] = toInt64(r["first_seen_at"])
+			u["requests"] = toInt64(r["requests"])
+		}
+	}
+	shared, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT ip, COUNT(DISTINCT user_id) AS users
+		FROM logs WHERE created_at >= ? AND user_id IN (`+in+`) AND ip IS NOT NULL AND ip != ''
+		GROUP BY ip HAVING COUNT(DISTINCT user_id) > 1
+		ORDER BY users DESC LIMIT 20`), args...)
+	if err != nil {
+		snap.Errors = append(snap.Errors, "shared_ips: "+err.Error())
+	} else if shared != nil {
+		snap.SharedIPs = shared
+	}
+	return snap
+}
+
+const registrationSpikeColumns = `id, at, from_user_id, to_user_id, new_users, rate, baseline, ratio, status, note,
+	reviewed_by, reviewed_at, created_at`
+
+func scanRegistrationSpike(scan func(dest ...interface{}) error, extra ...interface{}) (RegistrationSpike, error) {
+	var sp RegistrationSpike
+	dest := []interface{}{&sp.ID, &sp.At, &sp.FromUserID, &sp.ToUserID, &sp.NewUsers, &sp.Rate, &sp.Baseline, &sp.Ratio,
+		&sp.Status, &sp.Note, &sp.ReviewedBy, &sp.ReviewedAt, &sp.CreatedAt}
+	err := scan(append(dest, extra...)...)
+	return sp, err
+}
+
+// List returns spikes newest first, without snapshots; status filters when set
+func (s *RegistrationSpikeService) List(ctx context.Context, status string, limit, offset int) ([]RegistrationSpike, int64, error) {
+	db, err := openRegistrationSpikeStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+	where, args := "", []interface{}{}
+	if status != "" {
+		where, args = "WHERE status = ?", append(args, status)
+	}
+	var total int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM registration_spikes `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT `+registrationSpikeColumns+` FROM registration_spikes `+where+`
+		ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items := []RegistrationSpike{}
+	for rows.Next() {
+		sp, err := scanRegistrationSpike(rows.Scan)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, sp)
+	}
+	return items, total, rows.Err()
+}
+
+// Get returns one spike with its snapshot
+func (s *RegistrationSpikeService) Get(ctx context.Context, id int64) (RegistrationSpike, error) {
+	db, err := openRegistrationSpikeStore(ctx)
+	if err != nil {
+		return RegistrationSpike{}, err
+	}
+	defer db.Close()
+	return getRegistrationSpike(ctx, db, id)
+}
+
+func getRegistrationSpike(ctx context.Context, db *sql.DB, id int64) (RegistrationSpike, error) {
+	var snapshot string
+	sp, err := scanRegistrationSpike(db.QueryRowContext(ctx, `SELECT `+registrationSpikeColumns+`, snapshot
+		FROM registration_spikes WHERE id = ?`, id).Scan, &snapshot)
+	if err == sql.ErrNoRows {
+		return sp, ErrRegistrationSpikeNotFound
+	}
+	if err != nil {
+		return sp, err
+	}
+	sp.Snapshot = &RegistrationSnapshot{}
+	_ = json.Unmarshal([]byte(snapshot), sp.Snapshot)
+	return sp, nil
+}
+
+// Review marks a spike as reviewed or dismissed (or reopens it)
+func (s *RegistrationSpikeService) Review(ctx context.Context, id int64, status, note, operator string) (RegistrationSpike, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status != RegistrationSpikeOpen && status != RegistrationSpikeReviewed && status != RegistrationSpikeDismissed {
+		return RegistrationSpike{}, fmt.Errorf("%w: status 只能是 open、reviewed 或 dismissed", ErrInvalidRegistrationSpike)
+	}
+	db, err := openRegistrationSpikeStore(ctx)
+	if err != nil {
+		return RegistrationSpike{}, err
+	}
+	defer db.Close()
+	reviewedAt := time.Now().Unix()
+	if status == RegistrationSpikeOpen {
+		operator, reviewedAt = "", 0
+	}
+	res, err := db.ExecContext(ctx, `UPDATE registration_spikes SET status = ?, note = ?, reviewed_by = ?, reviewed_at = ? WHERE id = ?`,
+		status, strings.TrimSpace(note), operator, reviewedAt, id)
+	if err != nil {
+		return RegistrationSpike{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return RegistrationSpike{}, ErrRegistrationSpikeNotFound
+	}
+	return getRegistrationSpike(ctx, db, id)
+}
+
+// Rate returns the samples of the last hours with the current baseline
+func (s *RegistrationSpikeService) Rate(ctx context.Context, hours int) (map[string]interface{}, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openRegistrationSpikeStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	now := time.Now().Unix()
+	rows, err := db.QueryContext(ctx, `
+		SELECT at, max_user_id, new_users, hours, spike FROM registration_samples
+		WHERE at >= ? ORDER BY at`, now-int64(hours)*3600)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	samples := []RegistrationSample{}
+	for rows.Next() {
+		var sample RegistrationSample
+		var spike int
+		if err := rows.Scan(&sample.At, &sample.MaxUserID, &sample.NewUsers, &sample.Hours, &spike); err != nil {
+			return nil, err
+		}
+		sample.Spike = spike == 1
+		if sample.Hours > 0 {
+			sample.Rate = roundRate(float64(sample.NewUsers) / sample.Hours)
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	baseline, ready, err := registrationBaseline(ctx, db, now-now%3600+3600, settings.BaselineHours)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"samples":        samples,
+		"baseline":       roundRate(baseline),
+		"baseline_ready": ready,
+		"threshold":      roundRate(baseline * settings.Multiplier),
+		"settings":       settings,
+	}, nil
+}
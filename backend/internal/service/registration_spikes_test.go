@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestRegistrationSpikeCheckSnapshotsBatch(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, email TEXT, "group" TEXT,
+			status INTEGER, inviter_id INTEGER, github_id TEXT, linux_do_id TEXT, deleted_at INTEGER);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, ip TEXT, created_at INTEGER);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	ctx := context.Background()
+	now := time.Now().Unix()
+	hour := now - now%3600
+
+	// 12 hours of history at 2 users/hour, the last sample ending at user 100
+	store, err := openRegistrationSpikeStore(ctx)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	for i := 12; i >= 1; i-- {
+		if _, err := store.Exec(`INSERT INTO registration_samples (at, max_user_id, new_users, hours) VALUES (?, ?, 2, 1)`,
+			hour-int64(i)*3600, 100-2*(i-1)); err != nil {
+			t.Fatalf("seed sample: %v", err)
+		}
+	}
+	store.Close()
+
+	for id := 1; id <= 140; id++ {
+		inviter := 0
+		if id > 100 && id%2 == 0 {
+			inviter = 7
+		}
+		if _, err := db.Exec(`INSERT INTO users VALUES (?, ?, '', '', 'default', 1, ?, '', '', NULL)`,
+			id, fmt.Sprintf("u%d", id), inviter); err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+	}
+	for _, uid := range []int{101, 102, 103} {
+		if _, err := db.Exec(`INSERT INTO logs (user_id, ip, created_at) VALUES (?, '203.0.113.5', ?)`, uid, now-60); err != nil {
+			t.Fatalf("seed log: %v", err)
+		}
+	}
+
+	events, unsubscribe := GetEventBus().Subscribe()
+	defer unsubscribe()
+
+	svc := NewRegistrationSpikeService()
+	spike, err := svc.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if spike == nil {
+		t.Fatal("40 new users against a 2/hour baseline should raise a spike")
+	}
+	if spike.NewUsers != 40 || spike.Baseline != 2 || spike.Ratio != 20 {
+		t.Fatalf("unexpected spike: %+v", spike)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventRegistrationSpike {
+			t.Fatalf("unexpected event %s", ev.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("registration_spike event not published")
+	}
+
+	got, err := svc.Get(ctx, spike.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	snap := got.Snapshot
+	if len(snap.Users) != 40 || snap.Groups["default"] != 40 {
+		t.Fatalf("snapshot should hold the 40 new users, got %d users %v", len(snap.Users), snap.Groups)
+	}
+	if len(snap.TopInviters) != 1 || toInt64(snap.TopInviters[0]["users"]) != 20 {
+		t.Fatalf("inviter 7 should be reported with 20 invitees, got %v", snap.TopInviters)
+	}
+	if len(snap.SharedIPs) != 1 || toInt64(snap.SharedIPs[0]["users"]) != 3 {
+		t.Fatalf("shared IP should list 3 users, got %v", snap.SharedIPs)
+	}
+
+	// same hour: already sampled
+	if again, err := svc.Check(ctx); err != nil || again != nil {
+		t.Fatalf("second check in the same hour should be a no-op, got %v, %v", again, err)
+	}
+
+	reviewed, err := svc.Review(ctx, spike.ID, "dismissed", "campus event", "admin")
+	if err != nil || reviewed.Status != RegistrationSpikeDismissed || reviewed.ReviewedBy != "admin" {
+		t.Fatalf("Review: %+v, %v", reviewed, err)
+	}
+	if open, total, err := svc.List(ctx, RegistrationSpikeOpen, 10, 0); err != nil || total != 0 || len(open) != 0 {
+		t.Fatalf("no open spikes expected, got %d (%v)", total, err)
+	}
+	if _, err := svc.Review(ctx, spike.ID, "bogus", "", "admin"); err == nil {
+		t.Fatal("invalid status should be rejected")
+	}
+}
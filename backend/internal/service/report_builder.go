@@ -0,0 +1,961 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// Report metrics an admin can pick; each maps to an existing aggregate so no
+// free-form SQL is ever accepted
+const (
+	ReportMetricOverview    = "overview"
+	ReportMetricTopUsers    = "top_users"
+	ReportMetricModelStats  = "model_stats"
+	ReportMetricIncidents   = "incidents"
+	ReportMetricRiskSummary = "risk_summary"
+)
+
+// Report output formats
+const (
+	ReportFormatJSON     = "json"
+	ReportFormatMarkdown = "markdown"
+	ReportFormatCSV      = "csv"
+	ReportFormatPDF      = "pdf"
+)
+
+// Report schedule frequencies
+const (
+	ReportFrequencyNone    = "none"
+	ReportFrequencyDaily   = "daily"
+	ReportFrequencyWeekly  = "weekly"
+	ReportFrequencyMonthly = "monthly"
+)
+
+var (
+	ReportMetrics     = []string{ReportMetricOverview, ReportMetricTopUsers, ReportMetricModelStats, ReportMetricIncidents, ReportMetricRiskSummary}
+	ReportPeriods     = []string{"24h", "7d", "30d"}
+	ReportFormats     = []string{ReportFormatJSON, ReportFormatMarkdown, ReportFormatCSV, ReportFormatPDF}
+	ReportFrequencies = []string{ReportFrequencyNone, ReportFrequencyDaily, ReportFrequencyWeekly, ReportFrequencyMonthly}
+)
+
+var (
+	ErrReportNotFound    = errors.New("report not found")
+	ErrReportRunNotFound = errors.New("report run not found")
+	ErrInvalidReport     = errors.New("invalid report")
+)
+
+// reportRunsKept bounds the stored history per report; runs older than
+// REPORT_RETENTION_DAYS are removed as well
+const reportRunsKept = 30
+
+// ReportSchedule describes when a report is generated automatically (server local time)
+type ReportSchedule struct {
+	Frequency string `json:"frequency"` // none | daily | weekly | monthly
+	Hour      int    `json:"hour"`      // 0-23
+	Weekday   int    `json:"weekday"`   // weekly: 0=周日 … 6=周六
+	Day       int    `json:"day"`       // monthly: 1-28
+}
+
+// ReportDefinition is a saved report: which metrics, over which period, in which format
+type ReportDefinition struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name"`
+	Metrics   []string       `json:"metrics"`
+	Period    string         `json:"period"`
+	Format    string         `json:"format"`
+	Limit     int            `json:"limit"` // top_users / model_stats 行数
+	Schedule  ReportSchedule `json:"schedule"`
+	Enabled   bool           `json:"enabled"`
+	CreatedBy string         `json:"created_by"`
+	LastRunAt int64          `json:"last_run_at"`
+	NextRunAt int64          `json:"next_run_at"`
+	CreatedAt int64          `json:"created_at"`
+	UpdatedAt int64          `json:"updated_at"`
+}
+
+// ReportDefinitionInput supports create / partial update of a report
+type ReportDefinitionInput struct {
+	Name     *string         `json:"name"`
+	Metrics  *[]string       `json:"metrics"`
+	Period   *string         `json:"period"`
+	Format   *string         `json:"format"`
+	Limit    *int            `json:"limit"`
+	Schedule *ReportSchedule `json:"schedule"`
+	Enabled  *bool           `json:"enabled"`
+}
+
+// ReportSection is one metric block of a generated report
+type ReportSection struct {
+	Metric  string                   `json:"metric"`
+	Title   string                   `json:"title"`
+	Values  map[string]interface{}   `json:"values,omitempty"`
+	Columns []string                 `json:"columns,omitempty"`
+	Rows    []map[string]interface{} `json:"rows,omitempty"`
+	Error   string                   `json:"error,omitempty"` // 单个指标失败不影响其它部分
+}
+
+// ReportData is the format-independent content of a generated report
+type ReportData struct {
+	Name        string          `json:"name"`
+	Period      string          `json:"period"`
+	StartTime   int64           `json:"start_time"`
+	EndTime     int64           `json:"end_time"`
+	GeneratedAt int64           `json:"generated_at"`
+	Sections    []ReportSection `json:"sections"`
+}
+
+// ReportRun is one generated report; Content is only filled when fetched
+// individually. PDF output is binary and kept in Document instead of Content.
+type ReportRun struct {
+	ID        int64  `json:"id"`
+	ReportID  int64  `json:"report_id"`
+	Trigger   string `json:"trigger"` // manual | schedule
+	Format    string `json:"format"`
+	Status    string `json:"status"` // success | failed
+	Error     string `json:"error,omitempty"`
+	Size      int    `json:"size"`
+	Content   string `json:"content,omitempty"`
+	Document  []byte `json:"-"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Body returns the downloadable output of the run in its format
+func (r ReportRun) Body() []byte {
+	if r.Format == ReportFormatPDF {
+		return r.Document
+	}
+	return []byte(r.Content)
+}
+
+// ReportService stores report definitions and renders them on demand or on schedule
+type ReportService struct{}
+
+// reportRunMu keeps the scheduler from generating the same due report twice
+var reportRunMu sync.Mutex
+
+// NewReportService creates a ReportService
+func NewReportService() *ReportService {
+	return &ReportService{}
+}
+
+func ensureReportTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS report_definitions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			metrics TEXT NOT NULL DEFAULT '[]',
+			period TEXT NOT NULL DEFAULT '24h',
+			format TEXT NOT NULL DEFAULT 'markdown',
+			row_limit INTEGER NOT NULL DEFAULT 10,
+			schedule TEXT NOT NULL DEFAULT '{}',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_by TEXT NOT NULL DEFAULT '',
+			last_run_at INTEGER NOT NULL DEFAULT 0,
+			next_run_at INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS report_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			report_id INTEGER NOT NULL,
+			trigger TEXT NOT NULL DEFAULT '',
+			format TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_report_runs_report ON report_runs(report_id, id)`)
+	if err != nil {
+		return err
+	}
+	return ensureSQLiteColumn(ctx, db, "report_runs", "document", "BLOB")
+}
+
+func isReportOption(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func validateReportDefinition(d *ReportDefinition) error {
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Name == "" || len([]rune(d.Name)) > 64 {
+		return fmt.Errorf("%w: name must be 1-64 characters", ErrInvalidReport)
+	}
+	metrics := []string{}
+	for _, m := range d.Metrics {
+		m = strings.TrimSpace(m)
+		if !isReportOption(ReportMetrics, m) {
+			return fmt.Errorf("%w: unknown metric %q", ErrInvalidReport, m)
+		}
+		metrics = appendUniqueString(metrics, m)
+	}
+	if len(metrics) == 0 {
+		return fmt.Errorf("%w: pick at least one metric", ErrInvalidReport)
+	}
+	d.Metrics = metrics
+	if d.Period == "" {
+		d.Period = "24h"
+	}
+	if !isReportOption(ReportPeriods, d.Period) {
+		return fmt.Errorf("%w: period must be one of %s", ErrInvalidReport, strings.Join(ReportPeriods, ", "))
+	}
+	if d.Format == "" {
+		d.Format = ReportFormatMarkdown
+	}
+	if !isReportOption(ReportFormats, d.Format) {
+		return fmt.Errorf("%w: format must be one of %s", ErrInvalidReport, strings.Join(ReportFormats, ", "))
+	}
+	d.Limit = clampSetting(d.Limit, 1, 50, 10)
+
+	sched := &d.Schedule
+	if sched.Frequency == "" {
+		sched.Frequency = ReportFrequencyNone
+	}
+	if !isReportOption(ReportFrequencies, sched.Frequency) {
+		return fmt.Errorf("%w: schedule.frequency must be one of %s", ErrInvalidReport, strings.Join(ReportFrequencies, ", "))
+	}
+	if sched.Hour < 0 || sched.Hour > 23 {
+		return fmt.Errorf("%w: schedule.hour must be 0-23", ErrInvalidReport)
+	}
+	if sched.Weekday < 0 || sched.Weekday > 6 {
+		return fmt.Errorf("%w: schedule.weekday must be 0-6", ErrInvalidReport)
+	}
+	if sched.Frequency == ReportFrequencyMonthly && (sched.Day < 1 || sched.Day > 28) {
+		return fmt.Errorf("%w: schedule.day must be 1-28", ErrInvalidReport)
+	}
+	return nil
+}
+
+// nextReportRun returns the first scheduled time strictly after from (0 = not
+// scheduled); hours and days are read in the reporting timezone
+func nextReportRun(sched ReportSchedule, from time.Time) int64 {
+	loc := ReportLocation()
+	from = from.In(loc)
+	at := time.Date(from.Year(), from.Month(), from.Day(), sched.Hour, 0, 0, 0, loc)
+	switch sched.Frequency {
+	case ReportFrequencyDaily:
+		if !at.After(from) {
+			at = at.AddDate(0, 0, 1)
+		}
+	case ReportFrequencyWeekly:
+		at = at.AddDate(0, 0, (sched.Weekday-int(at.Weekday())+7)%7)
+		if !at.After(from) {
+			at = at.AddDate(0, 0, 7)
+		}
+	case ReportFrequencyMonthly:
+		at = time.Date(from.Year(), from.Month(), sched.Day, sched.Hour, 0, 0, 0, loc)
+		if !at.After(from) {
+			at = at.AddDate(0, 1, 0)
+		}
+	default:
+		return 0
+	}
+	return at.Unix()
+}
+
+const reportColumns = `id, name, metrics, period, format, row_limit, schedule, enabled, created_by,
+	last_run_at, next_run_at, created_at, updated_at`
+
+func scanReportDefinition(scan func(dest ...interface{}) error) (ReportDefinition, error) {
+	var d ReportDefinition
+	var metrics, schedule string
+	var enabled int
+	if err := scan(&d.ID, &d.Name, &metrics, &d.Period, &d.Format, &d.Limit, &schedule, &enabled, &d.CreatedBy,
+		&d.LastRunAt, &d.NextRunAt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return d, err
+	}
+	d.Enabled = enabled == 1
+	d.Metrics = []string{}
+	_ = json.Unmarshal([]byte(metrics), &d.Metrics)
+	_ = json.Unmarshal([]byte(schedule), &d.Schedule)
+	return d, nil
+}
+
+func getReportDefinition(ctx context.Context, db *sql.DB, id int64) (ReportDefinition, error) {
+	d, err := scanReportDefinition(db.QueryRowContext(ctx, `SELECT `+reportColumns+` FROM report_definitions WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return d, ErrReportNotFound
+	}
+	return d, err
+}
+
+func openReportStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureReportTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func applyReportInput(d *ReportDefinition, in ReportDefinitionInput) {
+	if in.Name != nil {
+		d.Name = *in.Name
+	}
+	if in.Metrics != nil {
+		d.Metrics = *in.Metrics
+	}
+	if in.Period != nil {
+		d.Period = *in.Period
+	}
+	if in.Format != nil {
+		d.Format = *in.Format
+	}
+	if in.Limit != nil {
+		d.Limit = *in.Limit
+	}
+	if in.Schedule != nil {
+		d.Schedule = *in.Schedule
+	}
+	if in.Enabled != nil {
+		d.Enabled = *in.Enabled
+	}
+}
+
+// List returns all saved reports
+func (s *ReportService) List(ctx context.Context) ([]ReportDefinition, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT `+reportColumns+` FROM report_definitions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reports := []ReportDefinition{}
+	for rows.Next() {
+		d, err := scanReportDefinition(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, d)
+	}
+	return reports, rows.Err()
+}
+
+// Get returns one report by id
+func (s *ReportService) Get(ctx context.Context, id int64) (ReportDefinition, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return ReportDefinition{}, err
+	}
+	defer db.Close()
+	return getReportDefinition(ctx, db, id)
+}
+
+// Create saves a new report definition
+func (s *ReportService) Create(ctx context.Context, createdBy string, in ReportDefinitionInput) (ReportDefinition, error) {
+	d := ReportDefinition{Enabled: true, CreatedBy: createdBy}
+	applyReportInput(&d, in)
+	if err := validateReportDefinition(&d); err != nil {
+		return d, err
+	}
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return d, err
+	}
+	defer db.Close()
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM report_definitions WHERE name = ?`, d.Name).Scan(&exists); err != nil {
+		return d, err
+	}
+	if exists > 0 {
+		return d, fmt.Errorf("%w: name %q already used", ErrInvalidReport, d.Name)
+	}
+
+	now := time.Now()
+	d.CreatedAt = now.Unix()
+	d.UpdatedAt = d.CreatedAt
+	if d.Enabled {
+		d.NextRunAt = nextReportRun(d.Schedule, now)
+	}
+	metrics, _ := json.Marshal(d.Metrics)
+	schedule, _ := json.Marshal(d.Schedule)
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO report_definitions (name, metrics, period, format, row_limit, schedule, enabled, created_by,
+			next_run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Name, string(metrics), d.Period, d.Format, d.Limit, string(schedule), boolToInt(d.Enabled), d.CreatedBy,
+		d.NextRunAt, d.CreatedAt, d.UpdatedAt)
+	if err != nil {
+		return d, err
+	}
+	d.ID, _ = res.LastInsertId()
+	return d, nil
+}
+
+// Update applies a partial update; the next run is recomputed from the new schedule
+func (s *ReportService) Update(ctx context.Context, id int64, in ReportDefinitionInput) (ReportDefinition, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return ReportDefinition{}, err
+	}
+	defer db.Close()
+	d, err := getReportDefinition(ctx, db, id)
+	if err != nil {
+		return d, err
+	}
+	applyReportInput(&d, in)
+	if err := validateReportDefinition(&d); err != nil {
+		return d, err
+	}
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM report_definitions WHERE name = ? AND id <> ?`, d.Name, id).Scan(&exists); err != nil {
+		return d, err
+	}
+	if exists > 0 {
+		return d, fmt.Errorf("%w: name %q already used", ErrInvalidReport, d.Name)
+	}
+
+	now := time.Now()
+	d.UpdatedAt = now.Unix()
+	d.NextRunAt = 0
+	if d.Enabled {
+		d.NextRunAt = nextReportRun(d.Schedule, now)
+	}
+	metrics, _ := json.Marshal(d.Metrics)
+	schedule, _ := json.Marshal(d.Schedule)
+	_, err = db.ExecContext(ctx, `
+		UPDATE report_definitions SET name = ?, metrics = ?, period = ?, format = ?, row_limit = ?, schedule = ?,
+			enabled = ?, next_run_at = ?, updated_at = ?
+		WHERE id = ?`,
+		d.Name, string(metrics), d.Period, d.Format, d.Limit, string(schedule), boolToInt(d.Enabled),
+		d.NextRunAt, d.UpdatedAt, id)
+	return d, err
+}
+
+// Delete removes a report and its run history
+func (s *ReportService) Delete(ctx context.Context, id int64) error {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.ExecContext(ctx, `DELETE FROM report_definitions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrReportNotFound
+	}
+	_, err = db.ExecContext(ctx, `DELETE FROM report_runs WHERE report_id = ?`, id)
+	return err
+}
+
+// Preview renders a definition without saving it or recording a run
+func (s *ReportService) Preview(ctx context.Context, in ReportDefinitionInput) (string, error) {
+	d := ReportDefinition{Name: "preview"}
+	applyReportInput(&d, in)
+	if err := validateReportDefinition(&d); err != nil {
+		return "", err
+	}
+	return RenderReport(s.Build(ctx, d), d.Format)
+}
+
+// Build collects the selected metrics for d's period
+func (s *ReportService) Build(ctx context.Context, d ReportDefinition) ReportData {
+	start, end := parsePeriodToTimestamps(d.Period)
+	data := ReportData{
+		Name:        d.Name,
+		Period:      d.Period,
+		StartTime:   start,
+		EndTime:     end,
+		GeneratedAt: time.Now().Unix(),
+		Sections:    []ReportSection{},
+	}
+	dash := NewDashboardService()
+	for _, metric := range d.Metrics {
+		var section ReportSection
+		var err error
+		switch metric {
+		case ReportMetricOverview:
+			section, err = reportOverview(dash, d.Period)
+		case ReportMetricTopUsers:
+			section, err = reportTopUsers(dash, d.Period, d.Limit)
+		case ReportMetricModelStats:
+			section, err = reportModelStats(dash, d.Period, d.Limit)
+		case ReportMetricIncidents:
+			section, err = reportIncidents(ctx, start, d.Limit)
+		case ReportMetricRiskSummary:
+			section, err = reportRiskSummary(ctx, start, d.Limit)
+		default:
+			continue
+		}
+		section.Metric = metric
+		if err != nil {
+			section.Error = err.Error()
+		}
+		data.Sections = append(data.Sections, section)
+	}
+	return data
+}
+
+// reportOverviewKeys fixes the row order of the overview block
+var reportOverviewKeys = []string{
+	"total_requests", "total_quota_used", "total_prompt_tokens", "total_completion_tokens", "average_response_time",
+	"active_users", "total_users", "total_tokens", "active_tokens", "total_channels", "active_channels", "total_models",
+}
+
+func reportOverview(dash *DashboardService, period string) (ReportSection, error) {
+	section := ReportSection{Title: "概览", Values: map[string]interface{}{}}
+	usage, err := dash.GetUsageStatistics(period, false)
+	if err != nil {
+		return section, err
+	}
+	overview, err := dash.GetSystemOverview(period, false)
+	if err != nil {
+		return section, err
+	}
+	values := map[string]interface{}{
+		"total_requests":          usage.TotalRequests,
+		"total_quota_used":        usage.TotalQuotaUsed,
+		"total_prompt_tokens":     usage.TotalPromptTokens,
+		"total_completion_tokens": usage.TotalCompletionTokens,
+		"average_response_time":   usage.AverageResponseTime,
+		"active_users":            overview.ActiveUsers,
+		"total_users":             overview.TotalUsers,
+		"total_tokens":            overview.TotalTokens,
+		"active_tokens":           overview.ActiveTokens,
+		"total_channels":          overview.TotalChannels,
+		"active_channels":         overview.ActiveChannels,
+		"total_models":            overview.TotalModels,
+	}
+	for _, key := range reportOverviewKeys {
+		section.Values[key] = values[key]
+	}
+	return section, nil
+}
+
+func reportTopUsers(dash *DashboardService, period string, limit int) (ReportSection, error) {
+	section := ReportSection{Title: "用户排行", Columns: []string{"user_id", "username", "request_count", "quota_used"}}
+	rows, err := dash.GetTopUsers(period, limit, false)
+	if err != nil {
+		return section, err
+	}
+	return section, remarshal(rows, &section.Rows)
+}
+
+func reportModelStats(dash *DashboardService, period string, limit int) (ReportSection, error) {
+	section := ReportSection{Title: "模型统计", Columns: []string{"model_name", "request_count", "quota_used", "prompt_tokens", "completion_tokens"}}
+	rows, err := dash.GetModelUsage(period, limit, false)
+	if err != nil {
+		return section, err
+	}
+	return section, remarshal(rows, &section.Rows)
+}
+
+// reportIncidents lists channel auto-disables and IP blocklist enforcements since start
+func reportIncidents(ctx context.Context, start int64, limit int) (ReportSection, error) {
+	section := ReportSection{Title: "事件", Columns: []string{"time", "type", "target", "detail"}, Rows: []map[string]interface{}{}}
+	db, err := openLocalStore()
+	if err != nil {
+		return section, err
+	}
+	defer db.Close()
+	if err := ensureChannelFailoverTables(ctx, db); err != nil {
+		return section, err
+	}
+	if err := ensureIPBlocklistTables(ctx, db); err != nil {
+		return section, err
+	}
+
+	states, err := listChannelFailoverStates(ctx, db, false)
+	if err != nil {
+		return section, err
+	}
+	for _, st := range states {
+		if st.DisabledAt < start {
+			continue
+		}
+		detail := fmt.Sprintf("failure rate %.1f%% over %d requests", st.FailureRate*100, st.Requests)
+		if st.RecoveredAt > 0 {
+			detail += fmt.Sprintf(", recovered at %s", time.Unix(st.RecoveredAt, 0).In(ReportLocation()).Format("2006-01-02 15:04"))
+		}
+		section.Rows = append(section.Rows, map[string]interface{}{
+			"time":   st.DisabledAt,
+			"type":   EventChannelAutoDisabled,
+			"target": fmt.Sprintf("channel #%d %s", st.ChannelID, st.ChannelName),
+			"detail": detail,
+		})
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT target_type, user_id, username, token_id, token_name, action, blocked_requests, requests, created_at
+		FROM ip_blocklist_actions WHERE created_at >= ? ORDER BY id DESC LIMIT ?`, start, limit)
+	if err != nil {
+		return section, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var targetType, username, tokenName, action string
+		var userID, tokenID, blocked, requests, createdAt int64
+		if err := rows.Scan(&targetType, &userID, &username, &tokenID, &tokenName, &action, &blocked, &requests, &createdAt); err != nil {
+			return section, err
+		}
+		target := fmt.Sprintf("user #%d %s", userID, username)
+		if targetType == "token" {
+			target = fmt.Sprintf("token #%d %s", tokenID, tokenName)
+		}
+		section.Rows = append(section.Rows, map[string]interface{}{
+			"time":   createdAt,
+			"type":   EventIPBlocklistEnforced,
+			"target": target,
+			"detail": fmt.Sprintf("%s: %d/%d requests from blocked IPs", action, blocked, requests),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return section, err
+	}
+
+	sort.SliceStable(section.Rows, func(i, j int) bool {
+		return toInt64(section.Rows[i]["time"]) > toInt64(section.Rows[j]["time"])
+	})
+	if len(section.Rows) > limit {
+		section.Rows = section.Rows[:limit]
+	}
+	return section, nil
+}
+
+// reportRiskSummary lists the users flagged as high risk since start
+func reportRiskSummary(ctx context.Context, start int64, limit int) (ReportSection, error) {
+	section := ReportSection{Title: "风险摘要", Columns: []string{"time", "user_id", "username", "reason"}, Rows: []map[string]interface{}{}}
+	flags, err := listRiskFlags(ctx, start)
+	if err != nil {
+		return section, err
+	}
+	for _, f := range flags {
+		if len(section.Rows) >= limit {
+			break
+		}
+		section.Rows = append(section.Rows, map[string]interface{}{
+			"time":     f.CreatedAt,
+			"user_id":  f.UserID,
+			"username": f.Username,
+			"reason":   f.Reason,
+		})
+	}
+	return section, nil
+}
+
+func reportCell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		if val == float64(int64(val)) {
+			return fmt.Sprint(int64(val))
+		}
+		return fmt.Sprintf("%.2f", val)
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// RenderReport serialises data in the given format. PDF output is binary
+// and returned as the raw bytes of the string.
+func RenderReport(data ReportData, format string) (string, error) {
+	switch format {
+	case ReportFormatPDF:
+		return string(renderReportPDF(data)), nil
+	case ReportFormatJSON:
+		out, err := json.MarshalIndent(data, "", "  ")
+		return string(out), err
+	case ReportFormatMarkdown:
+		return renderReportMarkdown(data), nil
+	case ReportFormatCSV:
+		return renderReportCSV(data)
+	default:
+		return "", fmt.Errorf("%w: unknown format %q", ErrInvalidReport, format)
+	}
+}
+
+func renderReportMarkdown(data ReportData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", data.Name)
+	fmt.Fprintf(&b, "周期 %s：%s ~ %s\n", data.Period,
+		time.Unix(data.StartTime, 0).In(ReportLocation()).Format("2006-01-02 15:04"), time.Unix(data.EndTime, 0).In(ReportLocation()).Format("2006-01-02 15:04"))
+	for _, section := range data.Sections {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.Title)
+		if section.Error != "" {
+			fmt.Fprintf(&b, "> 生成失败: %s\n", section.Error)
+			continue
+		}
+		if section.Values != nil {
+			b.WriteString("| 指标 | 值 |\n| --- | --- |\n")
+			for _, key := range reportOverviewKeys {
+				if v, ok := section.Values[key]; ok {
+					fmt.Fprintf(&b, "| %s | %s |\n", key, reportCell(v))
+				}
+			}
+			continue
+		}
+		if len(section.Rows) == 0 {
+			b.WriteString("无数据\n")
+			continue
+		}
+		b.WriteString("| " + strings.Join(section.Columns, " | ") + " |\n")
+		b.WriteString(strings.Repeat("| --- ", len(section.Columns)) + "|\n")
+		for _, row := range section.Rows {
+			cells := make([]string, len(section.Columns))
+			for i, col := range section.Columns {
+				cell := row[col]
+				if col == "time" {
+					cell = time.Unix(toInt64(cell), 0).In(ReportLocation()).Format("2006-01-02 15:04")
+				}
+				cells[i] = strings.ReplaceAll(reportCell(cell), "|", "\\|")
+			}
+			b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+	}
+	return b.String()
+}
+
+// renderReportCSV writes one block per section: a "# title" marker row, the
+// header row and the data rows, separated by an empty line
+func renderReportCSV(data ReportData) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for i, section := range data.Sections {
+		if i > 0 {
+			_ = w.Write([]string{})
+		}
+		_ = w.Write([]string{"# " + section.Metric})
+		if section.Error != "" {
+			_ = w.Write([]string{"error", section.Error})
+			continue
+		}
+		if section.Values != nil {
+			_ = w.Write([]string{"metric", "value"})
+			for _, key := range reportOverviewKeys {
+				if v, ok := section.Values[key]; ok {
+					_ = w.Write([]string{key, reportCell(v)})
+				}
+			}
+			continue
+		}
+		_ = w.Write(section.Columns)
+		for _, row := range section.Rows {
+			cells := make([]string, len(section.Columns))
+			for j, col := range section.Columns {
+				cells[j] = reportCell(row[col])
+			}
+			_ = w.Write(cells)
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// Run generates report id now, stores the output and notifies subscribers
+func (s *ReportService) Run(ctx context.Context, id int64, trigger string) (ReportRun, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return ReportRun{}, err
+	}
+	defer db.Close()
+	d, err := getReportDefinition(ctx, db, id)
+	if err != nil {
+		return ReportRun{}, err
+	}
+	return s.run(ctx, db, d, trigger)
+}
+
+func (s *ReportService) run(ctx context.Context, db *sql.DB, d ReportDefinition, trigger string) (ReportRun, error) {
+	run := ReportRun{ReportID: d.ID, Trigger: trigger, Format: d.Format, Status: "success", CreatedAt: time.Now().Unix()}
+	content, err := RenderReport(s.Build(ctx, d), d.Format)
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	if d.Format == ReportFormatPDF {
+		run.Document = []byte(content)
+	} else {
+		run.Content = content
+	}
+	run.Size = len(content)
+
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO report_runs (report_id, trigger, format, status, error, content, document, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, run.ReportID, run.Trigger, run.Format, run.Status, run.Error, run.Content, run.Document, run.CreatedAt)
+	if err != nil {
+		return run, err
+	}
+	run.ID, _ = res.LastInsertId()
+
+	// 手动运行不影响排期；定时运行后推进到下一个周期
+	next := d.NextRunAt
+	if trigger == "schedule" {
+		next = nextReportRun(d.Schedule, time.Now())
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE report_definitions SET last_run_at = ?, next_run_at = ? WHERE id = ?`,
+		run.CreatedAt, next, d.ID); err != nil {
+		return run, err
+	}
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM report_runs WHERE report_id = ? AND id NOT IN (
+			SELECT id FROM report_runs WHERE report_id = ? ORDER BY id DESC LIMIT ?)`, d.ID, d.ID, reportRunsKept); err != nil {
+		logger.L.Warn("[报表] 清理历史失败: " + err.Error())
+	}
+	if _, err := pruneExpiredReportRuns(ctx, db); err != nil {
+		logger.L.Warn("[报表] 清理过期报表失败: " + err.Error())
+	}
+
+	PublishEvent(EventReportReady, map[string]interface{}{
+		"report_id": d.ID,
+		"run_id":    run.ID,
+		"name":      d.Name,
+		"format":    run.Format,
+		"status":    run.Status,
+		"trigger":   trigger,
+	})
+	return run, nil
+}
+
+// RunDue generates every enabled report whose scheduled time has passed
+func (s *ReportService) RunDue(ctx context.Context) (int, error) {
+	reportRunMu.Lock()
+	defer reportRunMu.Unlock()
+
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT `+reportColumns+` FROM report_definitions
+		WHERE enabled = 1 AND next_run_at > 0 AND next_run_at <= ? ORDER BY next_run_at`, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	due := []ReportDefinition{}
+	for rows.Next() {
+		d, err := scanReportDefinition(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	if n, err := pruneExpiredReportRuns(ctx, db); err != nil {
+		logger.L.Warn("[报表] 清理过期报表失败: " + err.Error())
+	} else if n > 0 {
+		logger.L.Info(fmt.Sprintf("[报表] 已清理 %d 份过期报表", n))
+	}
+
+	ran := 0
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return ran, ctx.Err()
+		}
+		if _, err := s.run(ctx, db, d, "schedule"); err != nil {
+			logger.L.Warn(fmt.Sprintf("[报表] %s 生成失败: %v", d.Name, err))
+			continue
+		}
+		ran++
+	}
+	return ran, nil
+}
+
+// pruneExpiredReportRuns deletes runs older than REPORT_RETENTION_DAYS (0 = keep)
+func pruneExpiredReportRuns(ctx context.Context, db *sql.DB) (int64, error) {
+	days := config.Get().ReportRetentionDays
+	if days <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -days).Unix()
+	res, err := db.ExecContext(ctx, `DELETE FROM report_runs WHERE created_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListRuns returns the stored runs of a report, newest first, without content
+func (s *ReportService) ListRuns(ctx context.Context, reportID int64) ([]ReportRun, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if _, err := getReportDefinition(ctx, db, reportID); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, report_id, trigger, format, status, error, LENGTH(content) + COALESCE(LENGTH(document), 0), created_at
+		FROM report_runs WHERE report_id = ? ORDER BY id DESC`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []ReportRun{}
+	for rows.Next() {
+		var r ReportRun
+		if err := rows.Scan(&r.ID, &r.ReportID, &r.Trigger, &r.Format, &r.Status, &r.Error, &r.Size, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// GetRun returns one run including its rendered content
+func (s *ReportService) GetRun(ctx context.Context, reportID, runID int64) (ReportRun, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return ReportRun{}, err
+	}
+	defer db.Close()
+	return scanReportRun(db.QueryRowContext(ctx, `
+		SELECT id, report_id, trigger, format, status, error, content, document, created_at
+		FROM report_runs WHERE id = ? AND report_id = ?`, runID, reportID).Scan)
+}
+
+// LatestRun returns the newest successful run of a report including its output
+func (s *ReportService) LatestRun(ctx context.Context, reportID int64) (ReportRun, error) {
+	db, err := openReportStore(ctx)
+	if err != nil {
+		return ReportRun{}, err
+	}
+	defer db.Close()
+	if _, err := getReportDefinition(ctx, db, reportID); err != nil {
+		return ReportRun{}, err
+	}
+	return scanReportRun(db.QueryRowContext(ctx, `
+		SELECT id, report_id, trigger, format, status, error, content, document, created_at
+		FROM report_runs WHERE report_id = ? AND status = 'success' ORDER BY id DESC LIMIT 1`, reportID).Scan)
+}
+
+func scanReportRun(scan func(dest ...interface{}) error) (ReportRun, error) {
+	var r ReportRun
+	err := scan(&r.ID, &r.ReportID, &r.Trigger, &r.Format, &r.Status, &r.Error, &r.Content, &r.Document, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return r, ErrReportRunNotFound
+	}
+	r.Size = len(r.Content) + len(r.Document)
+	return r, err
+}
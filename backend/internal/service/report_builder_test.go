@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestNextReportRun(t *testing.T) {
+	// 2026-03-04 is a Wednesday
+	from := time.Date(2026, 3, 4, 10, 30, 0, 0, time.Local)
+	cases := []struct {
+		sched ReportSchedule
+		want  time.Time
+	}{
+		{ReportSchedule{Frequency: ReportFrequencyDaily, Hour: 9}, time.Date(2026, 3, 5, 9, 0, 0, 0, time.Local)},
+		{ReportSchedule{Frequency: ReportFrequencyDaily, Hour: 11}, time.Date(2026, 3, 4, 11, 0, 0, 0, time.Local)},
+		{ReportSchedule{Frequency: ReportFrequencyWeekly, Weekday: 1, Hour: 9}, time.Date(2026, 3, 9, 9, 0, 0, 0, time.Local)},
+		{ReportSchedule{Frequency: ReportFrequencyWeekly, Weekday: 3, Hour: 9}, time.Date(2026, 3, 11, 9, 0, 0, 0, time.Local)},
+		{ReportSchedule{Frequency: ReportFrequencyMonthly, Day: 1, Hour: 8}, time.Date(2026, 4, 1, 8, 0, 0, 0, time.Local)},
+	}
+	for _, tc := range cases {
+		if got := nextReportRun(tc.sched, from); got != tc.want.Unix() {
+			t.Errorf("%+v: got %s, want %s", tc.sched, time.Unix(got, 0), tc.want)
+		}
+	}
+	if got := nextReportRun(ReportSchedule{Frequency: ReportFrequencyNone}, from); got != 0 {
+		t.Errorf("unscheduled report should have no next run, got %d", got)
+	}
+}
+
+func TestReportBuildRunAndNotify(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, user_id INTEGER, username TEXT, model_name TEXT, type INTEGER,
+		quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, use_time INTEGER, created_at INTEGER)`)
+	now := time.Now().Unix()
+	db.MustExec(`INSERT INTO logs (user_id, username, model_name, type, quota, prompt_tokens, completion_tokens, use_time, created_at)
+		VALUES (1, 'alice', 'gpt-4o', 2, 500, 10, 20, 1, ?), (1, 'alice', 'gpt-4o', 2, 300, 10, 20, 1, ?),
+		(2, 'bob', 'claude', 2, 100, 5, 5, 1, ?)`, now-60, now-30, now-10)
+
+	ctx := context.Background()
+	svc := NewReportService()
+	str := func(s string) *string { return &s }
+	metrics := []string{ReportMetricTopUsers, ReportMetricModelStats, ReportMetricIncidents}
+
+	if _, err := svc.Create(ctx, "admin", ReportDefinitionInput{Name: str("bad"), Metrics: &[]string{"raw_sql"}}); !errors.Is(err, ErrInvalidReport) {
+		t.Fatalf("unknown metric should be rejected, got %v", err)
+	}
+	report, err := svc.Create(ctx, "admin", ReportDefinitionInput{
+		Name:     str("daily ops"),
+		Metrics:  &metrics,
+		Period:   str("24h"),
+		Format:   str(ReportFormatCSV),
+		Schedule: &ReportSchedule{Frequency: ReportFrequencyDaily, Hour: 9},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if report.NextRunAt <= now {
+		t.Fatalf("scheduled report should have a future next run, got %d", report.NextRunAt)
+	}
+
+	events, cancel := GetEventBus().Subscribe()
+	defer cancel()
+
+	run, err := svc.Run(ctx, report.ID, "manual")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if run.Status != "success" || !strings.Contains(run.Content, "1,alice,2,800") || !strings.Contains(run.Content, "# model_stats") {
+		t.Fatalf("unexpected report content (%s):\n%s", run.Status, run.Content)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventReportReady || toInt64(ev.Data["run_id"]) != run.ID {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("report_ready event not published")
+	}
+
+	// a manual run keeps the schedule
+	got, err := svc.Get(ctx, report.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.NextRunAt != report.NextRunAt || got.LastRunAt == 0 {
+		t.Fatalf("manual run should only set last_run_at, got %+v", got)
+	}
+
+	// make it due and let the scheduler pick it up
+	store, err := openReportStore(ctx)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	store.ExecContext(ctx, `UPDATE report_definitions SET next_run_at = ? WHERE id = ?`, now-1, report.ID)
+	store.Close()
+	if ran, err := svc.RunDue(ctx); err != nil || ran != 1 {
+		t.Fatalf("RunDue = %d, %v; want 1", ran, err)
+	}
+	if ran, _ := svc.RunDue(ctx); ran != 0 {
+		t.Fatalf("report should not run twice in the same period, ran %d", ran)
+	}
+
+	runs, err := svc.ListRuns(ctx, report.ID)
+	if err != nil || len(runs) != 2 || runs[0].Trigger != "schedule" || runs[0].Content != "" {
+		t.Fatalf("ListRuns = %+v, %v", runs, err)
+	}
+	full, err := svc.GetRun(ctx, report.ID, runs[0].ID)
+	if err != nil || full.Content == "" || full.Size != runs[0].Size {
+		t.Fatalf("GetRun = %+v, %v", full, err)
+	}
+
+	if err := svc.Delete(ctx, report.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := svc.ListRuns(ctx, report.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("runs of a deleted report should be gone, got %v", err)
+	}
+}
+
+func TestRenderReportMarkdown(t *testing.T) {
+	data := ReportData{
+		Name:   "weekly",
+		Period: "7d",
+		Sections: []ReportSection{
+			{Metric: ReportMetricOverview, Title: "概览", Values: map[string]interface{}{"total_requests": int64(42)}},
+			{Metric: ReportMetricTopUsers, Title: "用户排行", Columns: []string{"username", "quota_used"},
+				Rows: []map[string]interface{}{{"username": "a|b", "quota_used": float64(1.5)}}},
+			{Metric: ReportMetricIncidents, Title: "事件", Error: "store unavailable"},
+		},
+	}
+	out, err := RenderReport(data, ReportFormatMarkdown)
+	if err != nil {
+		t.Fatalf("RenderReport: %v", err)
+	}
+	for _, want := range []string{"# weekly", "| total_requests | 42 |", `| a\|b | 1.50 |`, "> 生成失败: store unavailable"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReportPDFRunAndRetention(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("REPORT_RETENTION_DAYS", "7")
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, user_id INTEGER, username TEXT, model_name TEXT, type INTEGER,
+		quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, use_time INTEGER, created_at INTEGER)`)
+	now := time.Now().Unix()
+	db.MustExec(`INSERT INTO logs (user_id, username, model_name, type, quota, prompt_tokens, completion_tokens, use_time, created_at)
+		VALUES (1, 'alice', 'gpt-4o', 2, 500, 10, 20, 1, ?)`, now-60)
+	recordRiskFlag(7, "mallory", "共享 IP 过多")
+
+	ctx := context.Background()
+	svc := NewReportService()
+	str := func(s string) *string { return &s }
+	metrics := []string{ReportMetricModelStats, ReportMetricRiskSummary}
+	report, err := svc.Create(ctx, "admin", ReportDefinitionInput{
+		Name: str("运营周报"), Metrics: &metrics, Period: str("7d"), Format: str(ReportFormatPDF),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	run, err := svc.Run(ctx, report.ID, "manual")
+	if err != nil || run.Status != "success" {
+		t.Fatalf("Run = %+v, %v", run, err)
+	}
+	latest, err := svc.LatestRun(ctx, report.ID)
+	if err != nil {
+		t.Fatalf("LatestRun: %v", err)
+	}
+	pdf := string(latest.Body())
+	if latest.Content != "" || !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatalf("unexpected pdf output (%d bytes): %.40q", len(pdf), pdf)
+	}
+	// text is UTF-16 hex: the risky username and the model name must be in the page stream
+	for _, want := range []string{"mallory", "gpt-4o"} {
+		if !strings.Contains(pdf, strings.Trim(pdfHexText(want), "<>")) {
+			t.Errorf("pdf missing %q", want)
+		}
+	}
+	if runs, _ := svc.ListRuns(ctx, report.ID); len(runs) != 1 || runs[0].Size != len(pdf) {
+		t.Fatalf("ListRuns should report the pdf size, got %+v", runs)
+	}
+
+	// runs older than REPORT_RETENTION_DAYS are dropped by the scheduler pass
+	store, err := openReportStore(ctx)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	store.ExecContext(ctx, `UPDATE report_runs SET created_at = ? WHERE id = ?`, now-8*86400, run.ID)
+	store.Close()
+	if _, err := svc.RunDue(ctx); err != nil {
+		t.Fatalf("RunDue: %v", err)
+	}
+	if _, err := svc.LatestRun(ctx, report.ID); !errors.Is(err, ErrReportRunNotFound) {
+		t.Fatalf("expired run should be pruned, got %v", err)
+	}
+}
+
+func TestRenderReportPDFPaginates(t *testing.T) {
+	rows := make([]map[string]interface{}, 120)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"model_name": strings.Repeat("很长的模型名称", 10), "request_count": i}
+	}
+	out := renderReportPDF(ReportData{Name: "分页", Period: "24h", Sections: []ReportSection{
+		{Metric: ReportMetricModelStats, Title: "模型统计", Columns: []string{"model_name", "request_count"}, Rows: rows},
+	}})
+	if n := strings.Count(string(out), "/Type /Page "); n < 3 {
+		t.Fatalf("120 rows should span several pages, got %d", n)
+	}
+	if !strings.Contains(string(out), "/Count "+fmt.Sprint(strings.Count(string(out), "/Type /Page "))) {
+		t.Fatal("page tree count does not match the pages written")
+	}
+}
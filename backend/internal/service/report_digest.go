@@ -0,0 +1,618 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+const reportDigestSettingsKey = "report_digest"
+
+// SMTP connection security
+const (
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecuritySSL      = "ssl"
+	SMTPSecurityNone     = "none"
+)
+
+var ErrInvalidReportDigest = errors.New("invalid report digest config")
+
+// reportDigestMu keeps the scheduler and a manual send from mailing twice
+var reportDigestMu sync.Mutex
+
+// ReportDigestSettings configures the e-mailed daily/weekly digest
+type ReportDigestSettings struct {
+	Enabled      bool     `json:"enabled"`
+	Frequency    string   `json:"frequency"` // daily | weekly
+	Hour         int      `json:"hour"`      // 0-23，服务器本地时间
+	Weekday      int      `json:"weekday"`   // weekly: 0=周日 … 6=周六
+	Recipients   []string `json:"recipients"`
+	TopModels    int      `json:"top_models"`
+	SMTPHost     string   `json:"smtp_host"`
+	SMTPPort     int      `json:"smtp_port"`
+	SMTPSecurity string   `json:"smtp_security"` // starttls | ssl | none
+	SMTPUsername string   `json:"smtp_username"`
+	SMTPPassword string   `json:"smtp_password,omitempty"` // 仅存储，接口返回时清空
+	HasPassword  bool     `json:"has_password"`
+	From         string   `json:"from"`
+
+	LastSentAt int64  `json:"last_sent_at"`
+	NextSendAt int64  `json:"next_send_at"`
+	LastError  string `json:"last_error"`
+	// 上次发送时 users 表的最大 id，用于统计新用户（users 表没有注册时间）
+	LastUserID int64 `json:"last_user_id"`
+	UpdatedAt  int64 `json:"updated_at"`
+}
+
+// ReportDigestSettingsInput supports partial update of ReportDigestSettings.
+// For SMTPPassword: nil = unchanged, empty string = clear.
+type ReportDigestSettingsInput struct {
+	Enabled      *bool     `json:"enabled"`
+	Frequency    *string   `json:"frequency"`
+	Hour         *int      `json:"hour"`
+	Weekday      *int      `json:"weekday"`
+	Recipients   *[]string `json:"recipients"`
+	TopModels    *int      `json:"top_models"`
+	SMTPHost     *string   `json:"smtp_host"`
+	SMTPPort     *int      `json:"smtp_port"`
+	SMTPSecurity *string   `json:"smtp_security"`
+	SMTPUsername *string   `json:"smtp_username"`
+	SMTPPassword *string   `json:"smtp_password"`
+	From         *string   `json:"from"`
+}
+
+// ReportDigest is the content of one digest mail
+type ReportDigest struct {
+	Frequency     string                   `json:"frequency"`
+	StartTime     int64                    `json:"start_time"`
+	EndTime       int64                    `json:"end_time"`
+	GeneratedAt   int64                    `json:"generated_at"`
+	Requests      int64                    `json:"requests"`
+	QuotaUsed     int64                    `json:"quota_used"`
+	ActiveUsers   int64                    `json:"active_users"`
+	TopModels     []api.ModelUsage         `json:"top_models"`
+	NewUsers      int64                    `json:"new_users"`
+	NewUsersKnown bool                     `json:"new_users_known"` // 首次发送没有基准 id
+	MaxUserID     int64                    `json:"max_user_id"`
+	TopUpCount    int64                    `json:"top_up_count"`
+	Revenue       float64                  `json:"revenue"`
+	HighRisk      []RiskFlag               `json:"high_risk"`
+	AutoBans      []map[string]interface{} `json:"auto_bans"`
+	Errors        []string                 `json:"errors,omitempty"` // 单项失败不影响其它部分
+}
+
+// RiskFlag is one high_risk_user notification kept for the digest
+type RiskFlag struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ReportDigestService builds and mails the periodic digest
+type ReportDigestService struct{}
+
+// NewReportDigestService creates a ReportDigestService
+func NewReportDigestService() *ReportDigestService {
+	return &ReportDigestService{}
+}
+
+func defaultReportDigestSettings() ReportDigestSettings {
+	return ReportDigestSettings{
+		Frequency:    ReportFrequencyDaily,
+		Hour:         8,
+		Weekday:      1,
+		Recipients:   []string{},
+		TopModels:    10,
+		SMTPPort:     587,
+		SMTPSecurity: SMTPSecurityStartTLS,
+	}
+}
+
+func normalizeReportDigestSettings(s *ReportDigestSettings) error {
+	s.Frequency = strings.ToLower(strings.TrimSpace(s.Frequency))
+	if s.Frequency != ReportFrequencyDaily && s.Frequency != ReportFrequencyWeekly {
+		return fmt.Errorf("%w: frequency 只能是 daily 或 weekly", ErrInvalidReportDigest)
+	}
+	if s.Hour < 0 || s.Hour > 23 {
+		return fmt.Errorf("%w: hour 需在 0-23 之间", ErrInvalidReportDigest)
+	}
+	if s.Weekday < 0 || s.Weekday > 6 {
+		return fmt.Errorf("%w: weekday 需在 0-6 之间", ErrInvalidReportDigest)
+	}
+	s.TopModels = clampSetting(s.TopModels, 1, 50, 10)
+	recipients := make([]string, 0, len(s.Recipients))
+	seen := map[string]bool{}
+	for _, r := range s.Recipients {
+		r = strings.TrimSpace(r)
+		if r == "" || seen[strings.ToLower(r)] {
+			continue
+		}
+		if _, err := mail.ParseAddress(r); err != nil {
+			return fmt.Errorf("%w: 无效的收件人 %q", ErrInvalidReportDigest, r)
+		}
+		seen[strings.ToLower(r)] = true
+		recipients = append(recipients, r)
+	}
+	s.Recipients = recipients
+
+	s.SMTPHost = strings.TrimSpace(s.SMTPHost)
+	s.SMTPUsername = strings.TrimSpace(s.SMTPUsername)
+	s.From = strings.TrimSpace(s.From)
+	s.SMTPSecurity = strings.ToLower(strings.TrimSpace(s.SMTPSecurity))
+	switch s.SMTPSecurity {
+	case "":
+		s.SMTPSecurity = SMTPSecurityStartTLS
+	case SMTPSecurityStartTLS, SMTPSecuritySSL, SMTPSecurityNone:
+	default:
+		return fmt.Errorf("%w: smtp_security 只能是 starttls、ssl 或 none", ErrInvalidReportDigest)
+	}
+	if s.SMTPPort <= 0 || s.SMTPPort > 65535 {
+		return fmt.Errorf("%w: smtp_port 需在 1-65535 之间", ErrInvalidReportDigest)
+	}
+	if s.From != "" {
+		if _, err := mail.ParseAddress(s.From); err != nil {
+			return fmt.Errorf("%w: 无效的发件人 %q", ErrInvalidReportDigest, s.From)
+		}
+	}
+	s.HasPassword = s.SMTPPassword != ""
+	if s.Enabled && !s.Ready() {
+		return fmt.Errorf("%w: SMTP 服务器、发件人和收件人填写完整后才能开启", ErrInvalidReportDigest)
+	}
+	return nil
+}
+
+// Ready reports whether a digest can be sent
+func (s ReportDigestSettings) Ready() bool {
+	return s.SMTPHost != "" && s.From != "" && len(s.Recipients) > 0
+}
+
+// view hides the SMTP password from API responses
+func (s ReportDigestSettings) view() ReportDigestSettings {
+	s.HasPassword = s.SMTPPassword != ""
+	s.SMTPPassword = ""
+	return s
+}
+
+func (s ReportDigestSettings) schedule() ReportSchedule {
+	return ReportSchedule{Frequency: s.Frequency, Hour: s.Hour, Weekday: s.Weekday}
+}
+
+// period is the dashboard period covered by one digest
+func (s ReportDigestSettings) period() string {
+	if s.Frequency == ReportFrequencyWeekly {
+		return "7d"
+	}
+	return "24h"
+}
+
+func (s *ReportDigestService) loadSettings(ctx context.Context) (ReportDigestSettings, error) {
+	settings := defaultReportDigestSettings()
+	if _, err := loadLocalSetting(ctx, reportDigestSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeReportDigestSettings(&settings); err != nil {
+		settings.Enabled = false
+	}
+	return settings, nil
+}
+
+// GetSettings returns the digest settings without the SMTP password
+func (s *ReportDigestService) GetSettings(ctx context.Context) (ReportDigestSettings, error) {
+	settings, err := s.loadSettings(ctx)
+	return settings.view(), err
+}
+
+// UpdateSettings applies a partial update and reschedules the next digest
+func (s *ReportDigestService) UpdateSettings(ctx context.Context, in ReportDigestSettingsInput) (ReportDigestSettings, error) {
+	reportDigestMu.Lock()
+	defer reportDigestMu.Unlock()
+
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return settings.view(), err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Frequency != nil {
+		settings.Frequency = *in.Frequency
+	}
+	if in.Hour != nil {
+		settings.Hour = *in.Hour
+	}
+	if in.Weekday != nil {
+		settings.Weekday = *in.Weekday
+	}
+	if in.Recipients != nil {
+		settings.Recipients = *in.Recipients
+	}
+	if in.TopModels != nil {
+		settings.TopModels = *in.TopModels
+	}
+	if in.SMTPHost != nil {
+		settings.SMTPHost = *in.SMTPHost
+	}
+	if in.SMTPPort != nil {
+		settings.SMTPPort = *in.SMTPPort
+	}
+	if in.SMTPSecurity != nil {
+		settings.SMTPSecurity = *in.SMTPSecurity
+	}
+	if in.SMTPUsername != nil {
+		settings.SMTPUsername = *in.SMTPUsername
+	}
+	if in.SMTPPassword != nil {
+		settings.SMTPPassword = *in.SMTPPassword
+	}
+	if in.From != nil {
+		settings.From = *in.From
+	}
+	if err := normalizeReportDigestSettings(&settings); err != nil {
+		return settings.view(), err
+	}
+	settings.NextSendAt = 0
+	if settings.Enabled {
+		settings.NextSendAt = nextReportRun(settings.schedule(), time.Now())
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, reportDigestSettingsKey, settings); err != nil {
+		return settings.view(), err
+	}
+	return settings.view(), nil
+}
+
+// Build collects the digest for the configured period. New users are counted
+// against the users.id watermark of the last scheduled digest.
+func (s *ReportDigestService) Build(ctx context.Context, settings ReportDigestSettings) ReportDigest {
+	start, end := parsePeriodToTimestamps(settings.period())
+	digest := ReportDigest{
+		Frequency:   settings.Frequency,
+		StartTime:   start,
+		EndTime:     end,
+		GeneratedAt: time.Now().Unix(),
+		TopModels:   []api.ModelUsage{},
+		HighRisk:    []RiskFlag{},
+		AutoBans:    []map[string]interface{}{},
+	}
+	fail := func(part string, err error) {
+		digest.Errors = append(digest.Errors, part+": "+err.Error())
+	}
+
+	dash := NewDashboardService().WithContext(ctx)
+	if usage, err := dash.GetUsageStatistics(settings.period(), false); err != nil {
+		fail("requests", err)
+	} else {
+		digest.Requests = usage.TotalRequests
+		digest.QuotaUsed = usage.TotalQuotaUsed
+	}
+	if overview, err := dash.GetSystemOverview(settings.period(), false); err != nil {
+		fail("active_users", err)
+	} else {
+		digest.ActiveUsers = overview.ActiveUsers
+	}
+	if rows, err := dash.GetModelUsage(settings.period(), settings.TopModels, false); err != nil {
+		fail("top_models", err)
+	} else {
+		digest.TopModels = rows
+	}
+
+	db := database.Get().WithContext(ctx)
+	if row, err := db.QueryOne(`SELECT COALESCE(MAX(id), 0) AS max_id FROM users`); err != nil {
+		fail("new_users", err)
+	} else if row != nil {
+		digest.MaxUserID = toInt64(row["max_id"])
+		if settings.LastUserID > 0 {
+			digest.NewUsersKnown = true
+			if digest.MaxUserID > settings.LastUserID {
+				digest.NewUsers = digest.MaxUserID - settings.LastUserID
+			}
+		}
+	}
+	if row, err := db.QueryOne(db.RebindQuery(fmt.Sprintf(`
+		SELECT COUNT(*) AS cnt, COALESCE(SUM(money), 0) AS revenue FROM top_ups
+		WHERE create_time >= ? AND create_time <= ? AND (%s) = 'success'`, topUpStatusBucketSQL("status"))), start, end); err != nil {
+		fail("revenue", err)
+	} else if row != nil {
+		digest.TopUpCount = toInt64(row["cnt"])
+		digest.Revenue = toFloat64(row["revenue"])
+	}
+
+	if flags, err := listRiskFlags(ctx, start); err != nil {
+		fail("high_risk", err)
+	} else {
+		digest.HighRisk = flags
+	}
+	if bans, err := reportIncidents(ctx, start, 50); err != nil {
+		fail("auto_bans", err)
+	} else {
+		for _, row := range bans.Rows {
+			if row["type"] == EventIPBlocklistEnforced {
+				digest.AutoBans = append(digest.AutoBans, row)
+			}
+		}
+	}
+	return digest
+}
+
+var reportDigestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"time": func(ts int64) string { return time.Unix(ts, 0).In(ReportLocation()).Format("2006-01-02 15:04") },
+	"cell": reportCell,
+	"money": func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#1f2937;max-width:720px;margin:0 auto;padding:16px">
+<h2 style="margin-bottom:4px">{{.Title}}</h2>
+<p style="color:#6b7280;margin-top:0">{{time .D.StartTime}} ~ {{time .D.EndTime}}</p>
+<table cellpadding="6" style="border-collapse:collapse;width:100%;margin-bottom:16px">
+<tr><td>请求量</td><td><b>{{.D.Requests}}</b></td><td>活跃用户</td><td><b>{{.D.ActiveUsers}}</b></td></tr>
+<tr><td>消耗额度</td><td><b>{{.D.QuotaUsed}}</b></td><td>新用户</td><td><b>{{if .D.NewUsersKnown}}{{.D.NewUsers}}{{else}}-{{end}}</b></td></tr>
+<tr><td>充值笔数</td><td><b>{{.D.TopUpCount}}</b></td><td>充值金额</td><td><b>{{money .D.Revenue}}</b></td></tr>
+</table>
+<h3>热门模型</h3>
+{{if .D.TopModels}}<table cellpadding="4" border="1" style="border-collapse:collapse;width:100%">
+<tr><th align="left">模型</th><th align="right">请求</th><th align="right">额度</th></tr>
+{{range .D.TopModels}}<tr><td>{{.ModelName}}</td><td align="right">{{.RequestCount}}</td><td align="right">{{.QuotaUsed}}</td></tr>
+{{end}}</table>{{else}}<p>无数据</p>{{end}}
+<h3>高风险用户 ({{len .D.HighRisk}})</h3>
+{{if .D.HighRisk}}<table cellpadding="4" border="1" style="border-collapse:collapse;width:100%">
+<tr><th align="left">时间</th><th align="left">用户</th><th align="left">原因</th></tr>
+{{range .D.HighRisk}}<tr><td>{{time .CreatedAt}}</td><td>#{{.UserID}} {{.Username}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{else}}<p>无</p>{{end}}
+<h3>自动封禁 ({{len .D.AutoBans}})</h3>
+{{if .D.AutoBans}}<table cellpadding="4" border="1" style="border-collapse:collapse;width:100%">
+<tr><th align="left">时间</th><th align="left">对象</th><th align="left">详情</th></tr>
+{{range .D.AutoBans}}<tr><td>{{time (index . "time")}}</td><td>{{cell (index . "target")}}</td><td>{{cell (index . "detail")}}</td></tr>
+{{end}}</table>{{else}}<p>无</p>{{end}}
+{{if .D.Errors}}<p style="color:#b91c1c">部分数据生成失败：{{range .D.Errors}}<br>{{.}}{{end}}</p>{{end}}
+<p style="color:#9ca3af;font-size:12px">由 NewAPI Tools 于 {{time .D.GeneratedAt}} 生成</p>
+</body></html>`))
+
+// digestTitle is the mail subject / page title of a digest
+func digestTitle(d ReportDigest) string {
+	if d.Frequency == ReportFrequencyWeekly {
+		return "NewAPI 周报 " + time.Unix(d.EndTime, 0).In(ReportLocation()).Format("2006-01-02")
+	}
+	return "NewAPI 日报 " + time.Unix(d.EndTime, 0).In(ReportLocation()).Format("2006-01-02")
+}
+
+// RenderReportDigest renders the digest as a self-contained HTML mail body
+func RenderReportDigest(d ReportDigest) (string, error) {
+	var buf bytes.Buffer
+	err := reportDigestTemplate.Execute(&buf, map[string]interface{}{"Title": digestTitle(d), "D": d})
+	return buf.String(), err
+}
+
+// Preview builds and renders the digest without sending it
+func (s *ReportDigestService) Preview(ctx context.Context) (string, error) {
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return "", err
+	}
+	return RenderReportDigest(s.Build(ctx, settings))
+}
+
+// Send mails the digest now. A manual send does not move the schedule nor
+// the new-user watermark.
+func (s *ReportDigestService) Send(ctx context.Context) (ReportDigest, error) {
+	reportDigestMu.Lock()
+	defer reportDigestMu.Unlock()
+
+	settings, err := s.loadSettings(ctx)
+	if err != nil {
+		return ReportDigest{}, err
+	}
+	if !settings.Ready() {
+		return ReportDigest{}, fmt.Errorf("%w: SMTP 服务器、发件人和收件人尚未配置", ErrInvalidReportDigest)
+	}
+	digest := s.Build(ctx, settings)
+	return digest, s.deliver(settings, digest)
+}
+
+// SendDue mails the scheduled digest when its time has passed. Returns
+// whether a digest was sent.
+func (s *ReportDigestService) SendDue(ctx context.Context) (bool, error) {
+	reportDigestMu.Lock()
+	defer reportDigestMu.Unlock()
+
+	settings, err := s.loadSettings(ctx)
+	if err != nil || !settings.Enabled {
+		return false, err
+	}
+	now := time.Now()
+	if settings.NextSendAt == 0 {
+		settings.NextSendAt = nextReportRun(settings.schedule(), now)
+		return false, saveLocalSetting(ctx, reportDigestSettingsKey, settings)
+	}
+	if settings.NextSendAt > now.Unix() {
+		return false, nil
+	}
+
+	digest := s.Build(ctx, settings)
+	sendErr := s.deliver(settings, digest)
+	settings.NextSendAt = nextReportRun(settings.schedule(), now)
+	settings.LastError = ""
+	if sendErr != nil {
+		settings.LastError = sendErr.Error()
+	} else {
+		settings.LastSentAt = now.Unix()
+		if digest.MaxUserID > 0 {
+			settings.LastUserID = digest.MaxUserID
+		}
+	}
+	if err := saveLocalSetting(ctx, reportDigestSettingsKey, settings); err != nil {
+		return sendErr == nil, err
+	}
+	return sendErr == nil, sendErr
+}
+
+func (s *ReportDigestService) deliver(settings ReportDigestSettings, digest ReportDigest) error {
+	body, err := RenderReportDigest(digest)
+	if err != nil {
+		return err
+	}
+	msg := buildDigestMail(settings.From, settings.Recipients, digestTitle(digest), body)
+	return sendSMTPMail(settings, msg)
+}
+
+// buildDigestMail assembles an RFC 5322 HTML message
+func buildDigestMail(from string, to []string, subject, html string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(html, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// sendSMTPMail delivers msg over implicit TLS, STARTTLS or plain SMTP
+func sendSMTPMail(settings ReportDigestSettings, msg []byte) error {
+	addr := net.JoinHostPort(settings.SMTPHost, strconv.Itoa(settings.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: settings.SMTPHost}
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if settings.SMTPSecurity == SMTPSecuritySSL {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp connect: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+	client, err := smtp.NewClient(conn, settings.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if settings.SMTPSecurity == SMTPSecurityStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if settings.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", settings.SMTPUsername, settings.SMTPPassword, settings.SMTPHost)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	from, _ := mail.ParseAddress(settings.From)
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	for _, r := range settings.Recipients {
+		addr, _ := mail.ParseAddress(r)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", addr.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
+
+// ========== High-risk flag history ==========
+
+// riskFlagsKeptDays bounds the high_risk_user history kept for digests
+const riskFlagsKeptDays = 35
+
+func ensureRiskFlagTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS risk_flags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_risk_flags_created_at ON risk_flags (created_at)`)
+	return err
+}
+
+// recordRiskFlag keeps a high_risk_user notification so the next digest can
+// list it; the SSE event itself is not persisted
+func recordRiskFlag(userID int64, username, reason string) {
+	ctx := context.Background()
+	db, err := openLocalStore()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	if err := ensureRiskFlagTables(ctx, db); err != nil {
+		logger.L.Warn("[摘要报表] 记录高风险用户失败: " + err.Error())
+		return
+	}
+	now := time.Now().Unix()
+	if _, err := db.ExecContext(ctx, `INSERT INTO risk_flags (user_id, username, reason, created_at) VALUES (?, ?, ?, ?)`,
+		userID, username, reason, now); err != nil {
+		logger.L.Warn("[摘要报表] 记录高风险用户失败: " + err.Error())
+		return
+	}
+	_, _ = db.ExecContext(ctx, `DELETE FROM risk_flags WHERE created_at < ?`, now-riskFlagsKeptDays*86400)
+}
+
+// listRiskFlags returns the flags raised since start, newest first, one row per user
+func listRiskFlags(ctx context.Context, start int64) ([]RiskFlag, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureRiskFlagTables(ctx, db); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, username, reason, created_at FROM risk_flags
+		WHERE created_at >= ? ORDER BY created_at DESC, id DESC`, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	flags := []RiskFlag{}
+	seen := map[int64]bool{}
+	for rows.Next() {
+		var f RiskFlag
+		if err := rows.Scan(&f.UserID, &f.Username, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		if seen[f.UserID] {
+			continue
+		}
+		seen[f.UserID] = true
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// fakeSMTPServer accepts one message and returns its DATA section
+func fakeSMTPServer(t *testing.T) (int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					got <- data.String()
+					reply("250 ok")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, got
+}
+
+func TestReportDigestConfigAndScheduledSend(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT)`)
+	db.MustExec(`INSERT INTO users (id, username) VALUES (1, 'a'), (2, 'b')`)
+
+	ctx := context.Background()
+	svc := NewReportDigestService()
+	str := func(s string) *string { return &s }
+	yes := true
+
+	for _, in := range []ReportDigestSettingsInput{
+		{Frequency: str("monthly")},
+		{Recipients: &[]string{"not an address"}},
+		{SMTPSecurity: str("tls13")},
+		{Enabled: &yes}, // SMTP 未配置
+	} {
+		if _, err := svc.UpdateSettings(ctx, in); !errors.Is(err, ErrInvalidReportDigest) {
+			t.Fatalf("UpdateSettings(%+v) should be rejected, got %v", in, err)
+		}
+	}
+
+	port, received := fakeSMTPServer(t)
+	settings, err := svc.UpdateSettings(ctx, ReportDigestSettingsInput{
+		Enabled:      &yes,
+		Recipients:   &[]string{"ops@example.com", " OPS@example.com ", "Bob <bob@example.com>"},
+		SMTPHost:     str("127.0.0.1"),
+		SMTPPort:     &port,
+		SMTPSecurity: str(SMTPSecurityNone),
+		SMTPPassword: str("s3cr3t"),
+		From:         str("NewAPI <bot@example.com>"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if settings.SMTPPassword != "" || !settings.HasPassword || len(settings.Recipients) != 2 || settings.NextSendAt == 0 {
+		t.Fatalf("unexpected settings view %+v", settings)
+	}
+
+	recordRiskFlag(7, "mallory", "HIGH_FAILURE_RATE")
+	recordRiskFlag(7, "mallory", "IP_SWITCH")
+
+	// 到期后发送，并把新用户基准推进到当前最大 id
+	raw, _ := svc.loadSettings(ctx)
+	raw.NextSendAt = time.Now().Unix() - 1
+	if err := saveLocalSetting(ctx, reportDigestSettingsKey, raw); err != nil {
+		t.Fatal(err)
+	}
+	sent, err := svc.SendDue(ctx)
+	if err != nil || !sent {
+		t.Fatalf("SendDue = %v, %v", sent, err)
+	}
+	select {
+	case msg := <-received:
+		if !strings.Contains(msg, "Content-Type: text/html") || !strings.Contains(msg, "mallory") ||
+			!strings.Contains(msg, "IP_SWITCH") || strings.Contains(msg, "HIGH_FAILURE_RATE") {
+			t.Fatalf("unexpected mail:\n%s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+	after, _ := svc.loadSettings(ctx)
+	if after.LastUserID != 2 || after.LastSentAt == 0 || after.NextSendAt <= time.Now().Unix() || after.LastError != "" {
+		t.Fatalf("state not advanced after send: %+v", after)
+	}
+
+	db.MustExec(`INSERT INTO users (id, username) VALUES (3, 'c'), (4, 'd'), (5, 'e')`)
+	if d := svc.Build(ctx, after); !d.NewUsersKnown || d.NewUsers != 3 {
+		t.Fatalf("new users = %d (known=%v), want 3", d.NewUsers, d.NewUsersKnown)
+	}
+	if sent, err := svc.SendDue(ctx); sent || err != nil {
+		t.Fatalf("digest is not due yet, got %v, %v", sent, err)
+	}
+}
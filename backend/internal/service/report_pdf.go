@@ -0,0 +1,214 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDF page geometry (A4, points)
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 48.0
+)
+
+// reportPDF is a minimal PDF writer for generated reports. Text uses the
+// STSong-Light CID font every PDF reader ships for Adobe-GB1, so Chinese
+// titles render without embedding a font file and without any dependency.
+type reportPDF struct {
+	pages [][]byte
+	cur   bytes.Buffer
+	y     float64
+}
+
+func newReportPDF() *reportPDF {
+	return &reportPDF{y: pdfPageHeight - pdfMargin}
+}
+
+// pdfTextWidth estimates the width of s at size: Latin glyphs of STSong-Light
+// are half width, everything else full width
+func pdfTextWidth(s string, size float64) float64 {
+	var w float64
+	for _, r := range s {
+		if r < 0x80 {
+			w += 0.5
+		} else {
+			w += 1
+		}
+	}
+	return w * size
+}
+
+// pdfFit truncates s with an ellipsis so it fits in width
+func pdfFit(s string, size, width float64) string {
+	if pdfTextWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdfTextWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// pdfHexText encodes s as UTF-16BE for the UniGB-UCS2-H encoding; characters
+// outside the BMP are replaced
+func pdfHexText(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if r > 0xFFFF || utf16.IsSurrogate(r) {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+func (p *reportPDF) newPage() {
+	p.pages = append(p.pages, append([]byte(nil), p.cur.Bytes()...))
+	p.cur.Reset()
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// reserve starts a new page when fewer than h points are left
+func (p *reportPDF) reserve(h float64) {
+	if p.y-h < pdfMargin {
+		p.newPage()
+	}
+}
+
+func (p *reportPDF) text(x, y, size float64, s string) {
+	fmt.Fprintf(&p.cur, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", size, x, y, pdfHexText(s))
+}
+
+func (p *reportPDF) rule(y float64, gray float64) {
+	fmt.Fprintf(&p.cur, "%.2f G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", gray, pdfMargin, y, pdfPageWidth-pdfMargin, y)
+}
+
+// line writes one line of text and advances the cursor
+func (p *reportPDF) line(size float64, s string) {
+	p.reserve(size * 1.6)
+	p.y -= size * 1.4
+	p.text(pdfMargin, p.y, size, pdfFit(s, size, pdfPageWidth-2*pdfMargin))
+	p.y -= size * 0.2
+}
+
+// table writes a header row and the data rows in equal-width columns,
+// repeating the header after a page break
+func (p *reportPDF) table(header []string, rows [][]string) {
+	const size, rowHeight = 9.0, 15.0
+	colWidth := (pdfPageWidth - 2*pdfMargin) / float64(len(header))
+	writeRow := func(cells []string) {
+		for i, cell := range cells {
+			p.text(pdfMargin+float64(i)*colWidth, p.y+4, size, pdfFit(cell, size, colWidth-6))
+		}
+	}
+	writeHeader := func() {
+		p.y -= rowHeight
+		writeRow(header)
+		p.rule(p.y, 0.3)
+	}
+	p.reserve(rowHeight * 2)
+	writeHeader()
+	for _, row := range rows {
+		if p.y-rowHeight < pdfMargin {
+			p.newPage()
+			writeHeader()
+		}
+		p.y -= rowHeight
+		writeRow(row)
+		p.rule(p.y, 0.85)
+	}
+	p.y -= 6
+}
+
+// bytes assembles the document: catalog, page tree, font and one content
+// stream per page, followed by the cross-reference table
+func (p *reportPDF) bytes() []byte {
+	if p.cur.Len() > 0 || len(p.pages) == 0 {
+		p.newPage()
+	}
+	var out bytes.Buffer
+	offsets := []int{}
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1 catalog, 2 pages, 3 font, 4 CID font, 5 descriptor, then page/content pairs
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	obj("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor 5 0 R /DW 1000 /W [1 95 500 814 939 500] >>")
+	obj("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, content := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 7+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// renderReportPDF lays the report out as title, period and one block per
+// section (key/value table or row table), paginated on A4
+func renderReportPDF(data ReportData) []byte {
+	p := newReportPDF()
+	p.line(18, data.Name)
+	p.line(10, fmt.Sprintf("周期 %s：%s ~ %s    生成于 %s", data.Period,
+		time.Unix(data.StartTime, 0).Format("2006-01-02 15:04"), time.Unix(data.EndTime, 0).Format("2006-01-02 15:04"),
+		time.Unix(data.GeneratedAt, 0).Format("2006-01-02 15:04")))
+	for _, section := range data.Sections {
+		p.y -= 8
+		p.reserve(40)
+		p.line(13, section.Title)
+		switch {
+		case section.Error != "":
+			p.line(10, "生成失败: "+section.Error)
+		case section.Values != nil:
+			rows := [][]string{}
+			for _, key := range reportOverviewKeys {
+				if v, ok := section.Values[key]; ok {
+					rows = append(rows, []string{key, reportCell(v)})
+				}
+			}
+			p.table([]string{"指标", "值"}, rows)
+		case len(section.Rows) == 0:
+			p.line(10, "无数据")
+		default:
+			rows := make([][]string, len(section.Rows))
+			for i, row := range section.Rows {
+				cells := make([]string, len(section.Columns))
+				for j, col := range section.Columns {
+					cell := row[col]
+					if col == "time" {
+						cell = time.Unix(toInt64(cell), 0).Format("2006-01-02 15:04")
+					}
+					cells[j] = reportCell(cell)
+				}
+				rows[i] = cells
+			}
+			p.table(section.Columns, rows)
+		}
+	}
+	return p.bytes()
+}
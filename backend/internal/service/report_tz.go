@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+const reportingSettingsKey = "reporting"
+
+// maxReportTZTransitions bounds the CASE expression of reportTZOffsetSQL;
+// real zones change offset at most twice a year
+const maxReportTZTransitions = 64
+
+var ErrInvalidReportTimeZone = errors.New("invalid reporting timezone")
+
+// reportingCachePrefixes are the cached series bucketed by local day / hour
+var reportingCachePrefixes = []string{
+	"dashboard:daily:",
+	"dashboard:hourly:",
+	"topup:trends:",
+	"topup:revenue_trends:",
+	"topup:financial:",
+	"topup:realtime:",
+	"topup:heatmap:",
+	"redemption:analytics:trend:",
+}
+
+// ReportingSettings selects the timezone that defines "a day" for every
+// analytics, dashboard and top-up series, independent of the server TZ
+type ReportingSettings struct {
+	TimeZone  string `json:"timezone"` // IANA 时区名，留空跟随 TZ / TIMEZONE 环境变量
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+var reportTZ struct {
+	sync.RWMutex
+	loc *time.Location // nil = time.Local
+}
+
+func normalizeReportingSettings(s *ReportingSettings) error {
+	s.TimeZone = strings.TrimSpace(s.TimeZone)
+	if s.TimeZone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return fmt.Errorf("%w: 无法识别的时区 %q", ErrInvalidReportTimeZone, s.TimeZone)
+	}
+	return nil
+}
+
+func loadReportingSettings(ctx context.Context) (ReportingSettings, error) {
+	var s ReportingSettings
+	if _, err := loadLocalSetting(ctx, reportingSettingsKey, &s); err != nil {
+		return s, err
+	}
+	if normalizeReportingSettings(&s) != nil {
+		s.TimeZone = ""
+	}
+	return s, nil
+}
+
+// applyReportingSettings loads the stored timezone into memory and drops the
+// series cached under the previous one
+func applyReportingSettings(ctx context.Context) error {
+	s, err := loadReportingSettings(ctx)
+	if err != nil {
+		return err
+	}
+	var loc *time.Location
+	if s.TimeZone != "" {
+		if loc, err = time.LoadLocation(s.TimeZone); err != nil {
+			return err
+		}
+	}
+	setReportLocation(loc)
+	for _, prefix := range reportingCachePrefixes {
+		cache.Get().DeleteByPrefix(cache.Key("%s", prefix))
+	}
+	return nil
+}
+
+func setReportLocation(loc *time.Location) {
+	reportTZ.Lock()
+	reportTZ.loc = loc
+	reportTZ.Unlock()
+}
+
+// ReportLocation returns the reporting timezone (default: the process TZ)
+func ReportLocation() *time.Location {
+	reportTZ.RLock()
+	defer reportTZ.RUnlock()
+	if reportTZ.loc != nil {
+		return reportTZ.loc
+	}
+	return time.Local
+}
+
+// reportNow is the current time in the reporting timezone
+func reportNow() time.Time {
+	return time.Now().In(ReportLocation())
+}
+
+// localTZOffset returns the current offset of the reporting timezone in
+// seconds (e.g. 28800 for UTC+8). Only hour buckets use a fixed offset: DST
+// shifts whole hours, so hour boundaries stay aligned across a transition.
+func localTZOffset() int {
+	_, offset := reportNow().Zone()
+	return offset
+}
+
+// reportTZOffsetSQL returns a SQL expression yielding the UTC offset of the
+// reporting timezone at the unix timestamp in column. Offsets change at DST
+// transitions, so the expression is a CASE over every transition between
+// start and end; rows outside the range take the nearest zone's offset.
+func reportTZOffsetSQL(column string, start, end int64) string {
+	loc := ReportLocation()
+	t := time.Unix(start, 0).In(loc)
+	_, base := t.Zone()
+
+	type transition struct {
+		at     int64
+		offset int
+	}
+	var transitions []transition
+	for len(transitions) < maxReportTZTransitions {
+		_, zoneEnd := t.ZoneBounds()
+		if zoneEnd.IsZero() || zoneEnd.Unix() > end {
+			break
+		}
+		t = zoneEnd.In(loc)
+		_, offset := t.Zone()
+		transitions = append(transitions, transition{t.Unix(), offset})
+	}
+	if len(transitions) == 0 {
+		return strconv.Itoa(base)
+	}
+
+	var b strings.Builder
+	b.WriteString("(CASE")
+	for i := len(transitions) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, " WHEN %s >= %d THEN %d", column, transitions[i].at, transitions[i].offset)
+	}
+	fmt.Fprintf(&b, " ELSE %d END)", base)
+	return b.String()
+}
+
+// reportDayExpr groups a unix column into local calendar days, numbered as
+// days since 1970-01-01; reportDayGroup is its Go counterpart
+func reportDayExpr(column string, start, end int64) string {
+	return fmt.Sprintf("FLOOR((%s + %s) / 86400)", column, reportTZOffsetSQL(column, start, end))
+}
+
+// reportWeekExpr groups a unix column into Monday-aligned local weeks.
+// 345600 = 4 * 86400 shifts Unix epoch (1970-01-01 Thu) so that the
+// following Monday (1970-01-05) starts bucket 0.
+func reportWeekExpr(column string, start, end int64) string {
+	return fmt.Sprintf("FLOOR((%s + %s - 345600) / 604800)", column, reportTZOffsetSQL(column, start, end))
+}
+
+// reportDayGroup returns the reportDayExpr bucket of t
+func reportDayGroup(t time.Time) int64 {
+	_, offset := t.In(ReportLocation()).Zone()
+	return floorDiv(t.Unix()+int64(offset), 86400)
+}
+
+// reportWeekGroup returns the reportWeekExpr bucket of t
+func reportWeekGroup(t time.Time) int64 {
+	_, offset := t.In(ReportLocation()).Zone()
+	return floorDiv(t.Unix()+int64(offset)-345600, 604800)
+}
+
+// reportDayStart returns local midnight of the day containing t
+func reportDayStart(t time.Time) time.Time {
+	t = t.In(ReportLocation())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// parseReportDate parses a start_date / end_date filter in the reporting timezone
+func parseReportDate(dateStr string, endOfDay bool) (int64, error) {
+	return util.ParseDateInLocation(dateStr, endOfDay, ReportLocation())
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
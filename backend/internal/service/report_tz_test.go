@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+// useReportLocation switches the reporting timezone for one test
+func useReportLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	setReportLocation(loc)
+	t.Cleanup(func() { setReportLocation(nil) })
+	return loc
+}
+
+// TestReportDayBucketsAcrossDST 验证 SQL 端的 CASE 偏移与 Go 端分桶一致：
+// 夏令时切换日（23 / 25 小时）的首尾两笔落在同一天，固定偏移会把它们切到相邻两天。
+func TestReportDayBucketsAcrossDST(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	ny := useReportLocation(t, "America/New_York")
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE events (id INTEGER PRIMARY KEY, created_at INTEGER)`)
+	stamps := []time.Time{
+		time.Date(2026, 3, 7, 23, 30, 0, 0, ny),  // EST
+		time.Date(2026, 3, 8, 0, 30, 0, 0, ny),   // EST, 切换日开始
+		time.Date(2026, 3, 8, 23, 30, 0, 0, ny),  // EDT, 切换日结束（23 小时）
+		time.Date(2026, 3, 9, 0, 30, 0, 0, ny),   // EDT
+		time.Date(2026, 11, 1, 0, 30, 0, 0, ny),  // EDT, 回拨日开始
+		time.Date(2026, 11, 1, 23, 30, 0, 0, ny), // EST, 回拨日结束（25 小时）
+		time.Date(2026, 11, 2, 0, 30, 0, 0, ny),  // EST
+	}
+	for i, ts := range stamps {
+		db.MustExec(`INSERT INTO events (id, created_at) VALUES (?, ?)`, i+1, ts.Unix())
+	}
+
+	start, end := stamps[0].Unix(), stamps[len(stamps)-1].Unix()
+	rows, err := db.Queryx(fmt.Sprintf(`SELECT id, CAST(%s AS INTEGER) AS day_group FROM events ORDER BY id`,
+		reportDayExpr("created_at", start, end)))
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	got := map[int]int64{}
+	for rows.Next() {
+		var id int
+		var group int64
+		if err := rows.Scan(&id, &group); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		got[id] = group
+	}
+
+	for i, ts := range stamps {
+		if want := reportDayGroup(ts); got[i+1] != want {
+			t.Errorf("%s: SQL day_group = %d, Go = %d", ts, got[i+1], want)
+		}
+	}
+	if got[2] != got[3] || got[5] != got[6] {
+		t.Errorf("both ends of a DST day must share one bucket: %v", got)
+	}
+	if got[1] == got[2] || got[3] == got[4] || got[6] == got[7] {
+		t.Errorf("adjacent days must not share a bucket: %v", got)
+	}
+	if reportWeekGroup(stamps[1]) != reportWeekGroup(stamps[2]) {
+		t.Errorf("Sunday 2026-03-08 start and end must share one week")
+	}
+}
+
+func TestFillGapsAcrossDST(t *testing.T) {
+	ny := useReportLocation(t, "America/New_York")
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, ny)
+	days := fillDailyGaps([]map[string]interface{}{
+		{"day_group": reportDayGroup(time.Date(2026, 3, 8, 23, 30, 0, 0, ny)), "request_count": int64(5)},
+	}, 4, now)
+	wantDates := []string{"2026-03-07", "2026-03-08", "2026-03-09", "2026-03-10"}
+	if len(days) != len(wantDates) {
+		t.Fatalf("expected %d days, got %d", len(wantDates), len(days))
+	}
+	for i, want := range wantDates {
+		if days[i].Date != want {
+			t.Errorf("day %d = %v, want %s", i, days[i].Date, want)
+		}
+	}
+	if days[1].RequestCount != 5 {
+		t.Errorf("the 23:30 EDT row belongs to 2026-03-08, got %v", days)
+	}
+	if gap := days[2].Timestamp - days[1].Timestamp; gap != 23*3600 {
+		t.Errorf("2026-03-08 should last 23 hours, got %ds", gap)
+	}
+
+	// 回拨日 01:00 出现两次，两个真实小时各占一行
+	fallBack := time.Date(2026, 11, 1, 3, 0, 0, 0, ny)
+	_, offset := fallBack.Zone()
+	hours := fillHourlyGaps(nil, 4, offset, fallBack)
+	wantHours := []string{"2026-11-01 01:00", "2026-11-01 01:00", "2026-11-01 02:00", "2026-11-01 03:00"}
+	for i, row := range hours {
+		if row.Hour != wantHours[i] {
+			t.Errorf("hour %d = %v, want %s", i, row.Hour, wantHours[i])
+		}
+		if i > 0 && row.Timestamp-hours[i-1].Timestamp != 3600 {
+			t.Errorf("hour buckets must be 3600s apart: %v", hours)
+		}
+	}
+}
+
+func TestReportScheduleAndDatesFollowReportingTimezone(t *testing.T) {
+	ny := useReportLocation(t, "America/New_York")
+
+	// 每天 9 点的报表在夏令时切换后仍是当地 9 点
+	from := time.Date(2026, 3, 7, 10, 0, 0, 0, ny)
+	next := nextReportRun(ReportSchedule{Frequency: ReportFrequencyDaily, Hour: 9}, from)
+	if want := time.Date(2026, 3, 8, 9, 0, 0, 0, ny); next != want.Unix() {
+		t.Errorf("next run = %s, want %s", time.Unix(next, 0).In(ny), want)
+	}
+
+	end, err := parseReportDate("2026-11-01", true)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if want := time.Date(2026, 11, 2, 0, 0, 0, 0, ny).Unix() - 1; end != want {
+		t.Errorf("end of the 25 hour day = %s, want %s", time.Unix(end, 0).In(ny), time.Unix(want, 0).In(ny))
+	}
+	if start, _ := util.ParseDateInLocation("2026-11-01", false, ny); end-start != 25*3600-1 {
+		t.Errorf("2026-11-01 should span 25 hours, got %ds", end-start+1)
+	}
+}
+
+func TestReportingSettingsSection(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() { setReportLocation(nil) })
+	ctx := context.Background()
+
+	svc := NewSettingsService()
+	if _, _, err := svc.Update(ctx, "reporting", "admin", map[string]interface{}{"timezone": "Mars/Olympus"}); !errors.Is(err, ErrInvalidSetting) {
+		t.Fatalf("unknown timezone should be rejected, got %v", err)
+	}
+	if _, _, err := svc.Update(ctx, "reporting", "admin", map[string]interface{}{"timezone": "America/New_York"}); err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	if got := ReportLocation().String(); got != "America/New_York" {
+		t.Fatalf("update should hot-reload the reporting timezone, got %s", got)
+	}
+	if _, _, err := svc.Update(ctx, "reporting", "admin", map[string]interface{}{"timezone": ""}); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if ReportLocation() != time.Local {
+		t.Fatalf("an empty timezone should follow the process TZ, got %s", ReportLocation())
+	}
+}
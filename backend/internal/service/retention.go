@@ -0,0 +1,541 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	retentionSettingsKey = "retention"
+	retentionLastRunKey  = "retention_last_run"
+)
+
+// Retention targets
+const (
+	RetentionTableLogs      = "logs"       // NewAPI 日志库中的 logs 表
+	RetentionTableAuditLogs = "audit_logs" // 本地审计日志
+	RetentionTableIPHistory = "ip_history" // 本地 IP 历史（按 last_seen 过期）
+)
+
+// RetentionTables lists every table a policy can be set for
+var RetentionTables = []string{RetentionTableLogs, RetentionTableAuditLogs, RetentionTableIPHistory}
+
+// Retention actions
+const (
+	RetentionActionDelete  = "delete"
+	RetentionActionArchive = "archive" // 先写入 DATA_DIR/archive 下的 jsonl.gz 再删除
+)
+
+var (
+	ErrRetentionRunning       = errors.New("retention run already in progress")
+	ErrInvalidRetentionPolicy = errors.New("invalid retention policy")
+)
+
+// RetentionPolicy is the TTL of one table
+type RetentionPolicy struct {
+	TTLDays int    `json:"ttl_days"` // 0 = 永久保留
+	Action  string `json:"action"`   // delete | archive
+}
+
+// RetentionSettings 数据保留策略配置
+type RetentionSettings struct {
+	Enabled          bool                       `json:"enabled"`
+	IntervalMinutes  int                        `json:"interval_minutes"`
+	BatchSize        int                        `json:"batch_size"`          // 每批删除的行数
+	BatchPauseMs     int                        `json:"batch_pause_ms"`      // 批次间暂停，限制对数据库的压力
+	MaxBatchesPerRun int                        `json:"max_batches_per_run"` // 单表单次运行的批次上限，剩余部分下次继续
+	Policies         map[string]RetentionPolicy `json:"policies"`
+	UpdatedAt        int64                      `json:"updated_at"`
+}
+
+// RetentionSettingsInput supports partial update of RetentionSettings;
+// Policies only replaces the tables it names
+type RetentionSettingsInput struct {
+	Enabled          *bool                      `json:"enabled"`
+	IntervalMinutes  *int                       `json:"interval_minutes"`
+	BatchSize        *int                       `json:"batch_size"`
+	BatchPauseMs     *int                       `json:"batch_pause_ms"`
+	MaxBatchesPerRun *int                       `json:"max_batches_per_run"`
+	Policies         map[string]RetentionPolicy `json:"policies"`
+}
+
+// RetentionTableProgress is the progress of one table in a run
+type RetentionTableProgress struct {
+	Table       string `json:"table"`
+	Action      string `json:"action"`
+	TTLDays     int    `json:"ttl_days"`
+	Cutoff      int64  `json:"cutoff"`
+	Deleted     int64  `json:"deleted"`
+	Archived    int64  `json:"archived"`
+	Batches     int    `json:"batches"`
+	Remaining   bool   `json:"remaining"` // 达到批次上限，仍有过期数据
+	ArchiveFile string `json:"archive_file,omitempty"`
+	// 日志归档开启时 logs 只删除到已归档的 id（含），未归档的留到归档后
+	PruneLimitID *int64 `json:"prune_limit_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RetentionRun is the state of the current or last retention run
+type RetentionRun struct {
+	Running    bool                     `json:"running"`
+	Trigger    string                   `json:"trigger"` // schedule | manual
+	StartedAt  int64                    `json:"started_at"`
+	FinishedAt int64                    `json:"finished_at"`
+	Tables     []RetentionTableProgress `json:"tables"`
+}
+
+// RetentionService applies per-table TTLs: rows older than the TTL are
+// deleted (or archived, then deleted) in small rate-limited batches so a
+// large backlog never holds long locks on the NewAPI log table.
+type RetentionService struct {
+	logDB *database.Manager
+}
+
+// retentionState holds the live progress shared by the background task and
+// the manual trigger; only one run may be active at a time
+var retentionState struct {
+	sync.Mutex
+	run RetentionRun
+}
+
+// NewRetentionService creates a RetentionService on the primary instance
+func NewRetentionService() *RetentionService {
+	return &RetentionService{logDB: database.GetLog()}
+}
+
+func defaultRetentionSettings() RetentionSettings {
+	return RetentionSettings{
+		Enabled:          false,
+		IntervalMinutes:  60,
+		BatchSize:        1000,
+		BatchPauseMs:     500,
+		MaxBatchesPerRun: 200,
+		Policies: map[string]RetentionPolicy{
+			RetentionTableLogs:      {TTLDays: 0, Action: RetentionActionDelete},
+			RetentionTableAuditLogs: {TTLDays: 180, Action: RetentionActionDelete},
+			RetentionTableIPHistory: {TTLDays: 90, Action: RetentionActionDelete},
+		},
+	}
+}
+
+func normalizeRetentionSettings(s *RetentionSettings) error {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 10, 1440, 60)
+	s.BatchSize = clampSetting(s.BatchSize, 100, 10000, 1000)
+	if s.BatchPauseMs < 0 || s.BatchPauseMs > 60000 {
+		s.BatchPauseMs = 500
+	}
+	s.MaxBatchesPerRun = clampSetting(s.MaxBatchesPerRun, 1, 10000, 200)
+
+	policies := make(map[string]RetentionPolicy, len(RetentionTables))
+	for _, table := range RetentionTables {
+		policies[table] = RetentionPolicy{Action: RetentionActionDelete}
+	}
+	for table, p := range s.Policies {
+		if _, ok := policies[table]; !ok {
+			return fmt.Errorf("%w: unknown table %q", ErrInvalidRetentionPolicy, table)
+		}
+		if p.TTLDays < 0 || p.TTLDays > 3650 {
+			return fmt.Errorf("%w: ttl_days of %s must be between 0 and 3650", ErrInvalidRetentionPolicy, table)
+		}
+		if p.Action == "" {
+			p.Action = RetentionActionDelete
+		}
+		if p.Action != RetentionActionDelete && p.Action != RetentionActionArchive {
+			return fmt.Errorf("%w: action of %s must be delete or archive", ErrInvalidRetentionPolicy, table)
+		}
+		policies[table] = p
+	}
+	s.Policies = policies
+	return nil
+}
+
+// GetSettings returns the retention settings (defaults if never saved)
+func (s *RetentionService) GetSettings(ctx context.Context) (RetentionSettings, error) {
+	settings := defaultRetentionSettings()
+	if _, err := loadLocalSetting(ctx, retentionSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeRetentionSettings(&settings); err != nil {
+		return defaultRetentionSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update
+func (s *RetentionService) UpdateSettings(ctx context.Context, in RetentionSettingsInput) (RetentionSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.BatchSize != nil {
+		settings.BatchSize = *in.BatchSize
+	}
+	if in.BatchPauseMs != nil {
+		settings.BatchPauseMs = *in.BatchPauseMs
+	}
+	if in.MaxBatchesPerRun != nil {
+		settings.MaxBatchesPerRun = *in.MaxBatchesPerRun
+	}
+	for table, p := range in.Policies {
+		settings.Policies[table] = p
+	}
+	if err := normalizeRetentionSettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, retentionSettingsKey, settings)
+}
+
+// GetRun returns the live run, or the last finished run after a restart
+func (s *RetentionService) GetRun(ctx context.Context) RetentionRun {
+	retentionState.Lock()
+	run := retentionState.run
+	run.Tables = append([]RetentionTableProgress(nil), run.Tables...)
+	retentionState.Unlock()
+	if run.StartedAt == 0 {
+		_, _ = loadLocalSetting(ctx, retentionLastRunKey, &run)
+	}
+	if run.Tables == nil {
+		run.Tables = []RetentionTableProgress{}
+	}
+	return run
+}
+
+// Run applies every policy with a TTL once. Returns ErrRetentionRunning when
+// another run is active.
+func (s *RetentionService) Run(ctx context.Context, trigger string) (RetentionRun, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return RetentionRun{}, err
+	}
+
+	retentionState.Lock()
+	if retentionState.run.Running {
+		retentionState.Unlock()
+		return RetentionRun{}, ErrRetentionRunning
+	}
+	retentionState.run = RetentionRun{Running: true, Trigger: trigger, StartedAt: time.Now().Unix(), Tables: []RetentionTableProgress{}}
+	retentionState.Unlock()
+
+	for _, table := range RetentionTables {
+		p := settings.Policies[table]
+		if p.TTLDays <= 0 {
+			continue
+		}
+		progress := RetentionTableProgress{
+			Table:   table,
+			Action:  p.Action,
+			TTLDays: p.TTLDays,
+			Cutoff:  time.Now().AddDate(0, 0, -p.TTLDays).Unix(),
+		}
+		idx := s.publish(-1, progress)
+		if err := s.applyTable(ctx, settings, &progress, idx); err != nil {
+			progress.Error = err.Error()
+			logger.L.Warn(fmt.Sprintf("[数据保留] %s 清理失败: %v", table, err))
+		}
+		s.publish(idx, progress)
+		if progress.Deleted > 0 {
+			logger.L.System(fmt.Sprintf("[数据保留] %s: 删除 %d 行（归档 %d 行），%d 批", table, progress.Deleted, progress.Archived, progress.Batches))
+		}
+	}
+
+	retentionState.Lock()
+	retentionState.run.Running = false
+	retentionState.run.FinishedAt = time.Now().Unix()
+	run := retentionState.run
+	run.Tables = append([]RetentionTableProgress(nil), run.Tables...)
+	retentionState.Unlock()
+	_ = saveLocalSetting(context.Background(), retentionLastRunKey, run)
+	return run, nil
+}
+
+// publish stores a table's progress at idx (-1 appends) and returns its index
+func (s *RetentionService) publish(idx int, p RetentionTableProgress) int {
+	retentionState.Lock()
+	defer retentionState.Unlock()
+	if idx < 0 {
+		retentionState.run.Tables = append(retentionState.run.Tables, p)
+		return len(retentionState.run.Tables) - 1
+	}
+	retentionState.run.Tables[idx] = p
+	return idx
+}
+
+// retentionBatch deletes one batch of expired rows, first appending them to
+// archive when it is not nil
+type retentionBatch func(ctx context.Context, archive *retentionArchive) (archived, deleted int64, err error)
+
+func (s *RetentionService) applyTable(ctx context.Context, settings RetentionSettings, p *RetentionTableProgress, idx int) error {
+	var batch retentionBatch
+	switch p.Table {
+	case RetentionTableLogs:
+		maxID := int64(math.MaxInt64)
+		if p.Action == RetentionActionDelete {
+			limit, ok, err := NewLogArchiveService().PruneLimit(ctx)
+			if err != nil {
+				return err
+			}
+			if ok {
+				maxID = limit
+				p.PruneLimitID = &limit
+			}
+		}
+		batch = s.logsBatch(p.Cutoff, maxID, settings.BatchSize)
+	case RetentionTableAuditLogs, RetentionTableIPHistory:
+		db, err := openLocalStore()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if p.Table == RetentionTableAuditLogs {
+			err = ensureAuditLogTables(ctx, db)
+		} else {
+			err = ensureIPHistoryTables(ctx, db)
+		}
+		if err != nil {
+			return err
+		}
+		batch = localRetentionBatch(db, p.Table, p.Cutoff, settings.BatchSize)
+		if p.Table == RetentionTableIPHistory {
+			// 删除旧行后 ip_history 只覆盖到 cutoff，读取方据此回落到 logs
+			defer s.raiseIPHistoryCoverage(ctx, db, p.Cutoff)
+		}
+	default:
+		return fmt.Errorf("unknown retention table %q", p.Table)
+	}
+
+	var archive *retentionArchive
+	if p.Action == RetentionActionArchive {
+		archive = &retentionArchive{table: p.Table}
+		defer archive.Close()
+	}
+
+	pause := time.Duration(settings.BatchPauseMs) * time.Millisecond
+	for p.Batches < settings.MaxBatchesPerRun {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		archived, n, err := batch(ctx, archive)
+		if archive != nil {
+			p.ArchiveFile = archive.Path()
+		}
+		p.Archived += archived
+		p.Deleted += n
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		p.Batches++
+		s.publish(idx, *p)
+		if pause > 0 {
+			select {
+			case <-time.After(pause):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	p.Remaining = true
+	return nil
+}
+
+// logsBatch deletes logs by id range so MySQL and PostgreSQL share one
+// statement; the created_at condition is repeated to never cross the cutoff.
+// Ids above maxID are kept.
+func (s *RetentionService) logsBatch(cutoff, maxID int64, size int) retentionBatch {
+	return func(ctx context.Context, archive *retentionArchive) (int64, int64, error) {
+		ids, err := s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(
+			`SELECT id FROM logs WHERE created_at < ? AND id <= ? ORDER BY id LIMIT ?`), cutoff, maxID, size)
+		if err != nil || len(ids) == 0 {
+			return 0, 0, err
+		}
+		lo, hi := toInt64(ids[0]["id"]), toInt64(ids[len(ids)-1]["id"])
+
+		var archived int64
+		if archive != nil {
+			rows, err := s.logDB.WithContext(ctx).QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(
+				`SELECT * FROM logs WHERE id >= ? AND id <= ? AND created_at < ? ORDER BY id`), lo, hi, cutoff)
+			if err != nil {
+				return 0, 0, err
+			}
+			if err := archive.Write(rows); err != nil {
+				return 0, 0, err
+			}
+			archived = int64(len(rows))
+		}
+
+		execCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+		res, err := s.logDB.DB.ExecContext(execCtx, s.logDB.RebindQuery(
+			`DELETE FROM logs WHERE id >= ? AND id <= ? AND created_at < ?`), lo, hi, cutoff)
+		if err != nil {
+			return archived, 0, err
+		}
+		n, _ := res.RowsAffected()
+		return archived, n, nil
+	}
+}
+
+// localRetentionBatch deletes expired rows of a local store table by rowid
+func localRetentionBatch(db *sql.DB, table string, cutoff int64, size int) retentionBatch {
+	column := "created_at"
+	if table == RetentionTableIPHistory {
+		column = "last_seen"
+	}
+	batchRows := fmt.Sprintf(`rowid IN (SELECT rowid FROM %s WHERE %s < ? ORDER BY rowid LIMIT ?)`, table, column)
+	return func(ctx context.Context, archive *retentionArchive) (int64, int64, error) {
+		// 单连接的本地库中归档与删除放在同一事务，两次选中的批次一致
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer tx.Rollback()
+
+		var archived int64
+		if archive != nil {
+			r, err := tx.QueryContext(ctx, `SELECT * FROM `+table+` WHERE `+batchRows, cutoff, size)
+			if err != nil {
+				return 0, 0, err
+			}
+			rows, err := scanRowMaps(r)
+			if err != nil {
+				return 0, 0, err
+			}
+			if err := archive.Write(rows); err != nil {
+				return 0, 0, err
+			}
+			archived = int64(len(rows))
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+batchRows, cutoff, size)
+		if err != nil {
+			return archived, 0, err
+		}
+		n, _ := res.RowsAffected()
+		return archived, n, tx.Commit()
+	}
+}
+
+func (s *RetentionService) raiseIPHistoryCoverage(ctx context.Context, db *sql.DB, cutoff int64) {
+	if err := ensureLogCursorTable(ctx, db); err != nil {
+		return
+	}
+	_, _ = db.ExecContext(ctx, `UPDATE log_cursors SET backfill_since = ? WHERE name = ? AND backfill_since < ?`,
+		cutoff, ipHistoryCursor, cutoff)
+}
+
+func scanRowMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var out []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if b, ok := values[i].([]byte); ok {
+				row[c] = string(b)
+			} else {
+				row[c] = values[i]
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// retentionArchive appends archived rows of one table and run to
+// DATA_DIR/archive/<table>/<table>-<time>.jsonl.gz. Each batch is flushed
+// before its rows are deleted.
+type retentionArchive struct {
+	table string
+	path  string
+	file  *os.File
+	gz    *gzip.Writer
+}
+
+// Path returns the archive file path ("" before the first write)
+func (a *retentionArchive) Path() string {
+	return a.path
+}
+
+// Write appends rows as JSON lines and flushes them to disk
+func (a *retentionArchive) Write(rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if a.gz == nil {
+		dir := filepath.Join(retentionArchiveDir(), a.table)
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+		a.path = filepath.Join(dir, fmt.Sprintf("%s-%s.jsonl.gz", a.table, time.Now().Format("20060102-150405")))
+		f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		a.file = f
+		a.gz = gzip.NewWriter(f)
+	}
+	enc := json.NewEncoder(a.gz)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// Close finishes the gzip stream
+func (a *retentionArchive) Close() error {
+	if a.gz == nil {
+		return nil
+	}
+	err := a.gz.Close()
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	a.gz = nil
+	return err
+}
+
+func retentionArchiveDir() string {
+	dataDir := strings.TrimSpace(config.Get().DataDir)
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return filepath.Join(dataDir, "archive")
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+const (
+	// clusterLogSampleCap bounds the log rows scanned per clustering pass
+	clusterLogSampleCap = 200000
+	// clusterMinRequests is the requests a user needs on a fingerprint for it
+	// to count as one of the user's devices
+	clusterMinRequests = 3
+	// clusterMaxUsers skips fingerprints shared by more users than this:
+	// a stock SDK user-agent on a big carrier is not one operator
+	clusterMaxUsers = 50
+)
+
+// Fingerprint sources, reported so the UI can say how strong a cluster is
+const (
+	FingerprintSourceColumn = "user_agent_column" // logs.user_agent（部分分支版本）
+	FingerprintSourceOther  = "other_json"        // logs.other 中的 user_agent / ua 字段
+	FingerprintSourceNone   = "none"              // 无 UA，仅按网络与时间模式
+)
+
+// ClusterMember is one account of a suspected multi-account cluster
+type ClusterMember struct {
+	UserID     int64   `json:"user_id"`
+	Username   string  `json:"username"`
+	UserStatus int64   `json:"user_status"`
+	Requests   int64   `json:"requests"`
+	IPs        int     `json:"ips"`
+	Similarity float64 `json:"similarity"` // 与簇内时间模式的余弦相似度
+}
+
+// DeviceCluster groups accounts sharing one device fingerprint (user-agent +
+// network) whose hour-of-day activity patterns match
+type DeviceCluster struct {
+	ID         string          `json:"id"`
+	UserAgent  string          `json:"user_agent"`
+	Network    string          `json:"network"` // ASN，无 ASN 库时为 /24 (IPv6 /48) 网段
+	ISP        string          `json:"isp,omitempty"`
+	SharedIPs  int             `json:"shared_ips"` // 被两个及以上成员使用的 IP 数
+	Similarity float64         `json:"similarity"` // 成员平均时间模式相似度
+	Score      float64         `json:"score"`      // 0-100 置信度
+	Members    []ClusterMember `json:"members"`
+}
+
+// ClusterQuery are the /api/risk/clusters parameters
+type ClusterQuery struct {
+	Window        string
+	MinUsers      int
+	MinSimilarity float64
+	Limit         int
+}
+
+type clusterUserStats struct {
+	requests int64
+	hours    [24]float64
+	ips      map[string]bool
+}
+
+type clusterFingerprint struct {
+	ua      string
+	network string
+	isp     string
+	users   map[int64]*clusterUserStats
+}
+
+// clusterSources caches the fingerprint source per instance
+var clusterSources sync.Map
+
+// fingerprintSource reports where the user-agent comes from in this
+// instance's logs, probing once per process
+func (s *RiskMonitoringService) fingerprintSource() string {
+	if v, ok := clusterSources.Load(s.instance); ok {
+		return v.(string)
+	}
+	source := FingerprintSourceNone
+	if s.logDB.ColumnExists("logs", "user_agent") {
+		source = FingerprintSourceColumn
+	} else if s.logDB.ColumnExists("logs", "other") {
+		source = FingerprintSourceOther
+	}
+	clusterSources.Store(s.instance, source)
+	return source
+}
+
+// userAgentFromOther extracts the user-agent a fork may record in logs.other
+func userAgentFromOther(raw string) string {
+	if !strings.Contains(raw, `ua"`) && !strings.Contains(raw, `gent"`) {
+		return ""
+	}
+	var other map[string]interface{}
+	if json.Unmarshal([]byte(raw), &other) != nil {
+		return ""
+	}
+	for _, key := range []string{"user_agent", "ua", "User-Agent", "userAgent"} {
+		if v, ok := other[key].(string); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// networkPrefix is the fallback network key without an ASN database
+func networkPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// cosineSimilarity compares two hour-of-day activity profiles
+func cosineSimilarity(a, b [24]float64) float64 {
+	var dot, na, nb float64
+	for i := 0; i < 24; i++ {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// splitByTiming greedily groups users whose activity profile matches a
+// cluster seed (the busiest remaining user) with at least minSimilarity
+func splitByTiming(users map[int64]*clusterUserStats, minSimilarity float64) [][]int64 {
+	ids := make([]int64, 0, len(users))
+	for uid := range users {
+		ids = append(ids, uid)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if users[ids[i]].requests != users[ids[j]].requests {
+			return users[ids[i]].requests > users[ids[j]].requests
+		}
+		return ids[i] < ids[j]
+	})
+	assigned := map[int64]bool{}
+	var groups [][]int64
+	for _, seed := range ids {
+		if assigned[seed] {
+			continue
+		}
+		assigned[seed] = true
+		group := []int64{seed}
+		for _, uid := range ids {
+			if !assigned[uid] && cosineSimilarity(users[seed].hours, users[uid].hours) >= minSimilarity {
+				assigned[uid] = true
+				group = append(group, uid)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// GetDeviceClusters lists probable multi-account operators: accounts that
+// share a user-agent on the same network (ASN, or /24 without the ASN
+// database) and are active at the same hours of the day. Without a
+// user-agent in the logs the clusters fall back to network + timing only.
+func (s *RiskMonitoringService) GetDeviceClusters(q ClusterQuery) (map[string]interface{}, error) {
+	seconds, ok := WindowSeconds[q.Window]
+	if !ok {
+		q.Window, seconds = "24h", WindowSeconds["24h"]
+	}
+	if q.MinUsers < 2 {
+		q.MinUsers = 2
+	}
+	if q.MinSimilarity <= 0 || q.MinSimilarity > 1 {
+		q.MinSimilarity = 0.8
+	}
+	cacheKey := cache.Key("risk:clusters:%s:%d:%.2f:%d", q.Window, q.MinUsers, q.MinSimilarity, q.Limit)
+	var cached map[string]interface{}
+	if found, _ := s.cm.GetJSON(cacheKey, &cached); found {
+		return cached, nil
+	}
+
+	source := s.fingerprintSource()
+	uaCol := "'' AS ua"
+	switch source {
+	case FingerprintSourceColumn:
+		uaCol = "user_agent AS ua"
+	case FingerprintSourceOther:
+		uaCol = "other AS ua"
+	}
+	startTime := time.Now().Unix() - seconds
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT user_id, ip, created_at, %s
+		FROM logs
+		WHERE type IN (`+ltRequests()+`) AND created_at >= ? AND user_id > 0 AND ip IS NOT NULL AND ip <> ''
+		ORDER BY id DESC
+		LIMIT ?`, uaCol)), startTime, clusterLogSampleCap)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve each distinct IP to its network once
+	ipSet := map[string]bool{}
+	for _, row := range rows {
+		ipSet[toString(row["ip"])] = true
+	}
+	asnAvailable := IsIPASNAvailable()
+	networks := make(map[string][2]string, len(ipSet)) // ip -> {network, isp}
+	if asnAvailable {
+		ips := make([]string, 0, len(ipSet))
+		for ip := range ipSet {
+			ips = append(ips, ip)
+		}
+		for ip, geo := range LookupIPGeoBatch(ips) {
+			if geo.ASN != "" {
+				networks[ip] = [2]string{geo.ASN, geo.ISP}
+			}
+		}
+	}
+
+	uaFound := false
+	fingerprints := map[string]*clusterFingerprint{}
+	for _, row := range rows {
+		ip := toString(row["ip"])
+		ua := toString(row["ua"])
+		if source == FingerprintSourceOther {
+			ua = userAgentFromOther(ua)
+		}
+		uaFound = uaFound || ua != ""
+		network, ok := networks[ip]
+		if !ok {
+			network = [2]string{networkPrefix(ip), ""}
+		}
+		key := ua + "\x00" + network[0]
+		fp := fingerprints[key]
+		if fp == nil {
+			fp = &clusterFingerprint{ua: ua, network: network[0], isp: network[1], users: map[int64]*clusterUserStats{}}
+			fingerprints[key] = fp
+		}
+		uid := toInt64(row["user_id"])
+		u := fp.users[uid]
+		if u == nil {
+			u = &clusterUserStats{ips: map[string]bool{}}
+			fp.users[uid] = u
+		}
+		u.requests++
+		u.hours[time.Unix(toInt64(row["created_at"]), 0).UTC().Hour()]++
+		u.ips[ip] = true
+	}
+	if !uaFound {
+		source = FingerprintSourceNone
+	}
+
+	clusters := []DeviceCluster{}
+	skippedGeneric := 0
+	for _, fp := range fingerprints {
+		for uid, u := range fp.users {
+			if u.requests < clusterMinRequests {
+				delete(fp.users, uid)
+			}
+		}
+		if len(fp.users) < q.MinUsers {
+			continue
+		}
+		if len(fp.users) > clusterMaxUsers {
+			skippedGeneric++
+			continue
+		}
+		for _, group := range splitByTiming(fp.users, q.MinSimilarity) {
+			if len(group) < q.MinUsers {
+				continue
+			}
+			clusters = append(clusters, buildDeviceCluster(fp, group, source != FingerprintSourceNone))
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Score != clusters[j].Score {
+			return clusters[i].Score > clusters[j].Score
+		}
+		return clusters[i].ID < clusters[j].ID
+	})
+	total := len(clusters)
+	if q.Limit > 0 && len(clusters) > q.Limit {
+		clusters = clusters[:q.Limit]
+	}
+	s.enrichClusterMembers(clusters)
+
+	result := map[string]interface{}{
+		"items":              clusters,
+		"total":              total,
+		"window":             q.Window,
+		"min_users":          q.MinUsers,
+		"min_similarity":     q.MinSimilarity,
+		"fingerprint_source": source,
+		"asn_available":      asnAvailable,
+		"sampled_logs":       len(rows),
+		"sample_truncated":   len(rows) >= clusterLogSampleCap,
+		"skipped_generic":    skippedGeneric,
+	}
+	s.cm.Set(cacheKey, result, scaledTTL(10*time.Minute))
+	return result, nil
+}
+
+// buildDeviceCluster scores one timing group of a fingerprint: more accounts,
+// tighter timing and shared IPs raise the score; without a user-agent the
+// score is capped since network + timing alone is weaker evidence
+func buildDeviceCluster(fp *clusterFingerprint, group []int64, hasUA bool) DeviceCluster {
+	var centroid [24]float64
+	for _, uid := range group {
+		u := fp.users[uid]
+		for h := 0; h < 24; h++ {
+			centroid[h] += u.hours[h] / float64(u.requests)
+		}
+	}
+
+	ipUsers := map[string]int{}
+	members := make([]ClusterMember, 0, len(group))
+	var simSum float64
+	for _, uid := range group {
+		u := fp.users[uid]
+		sim := cosineSimilarity(u.hours, centroid)
+		simSum += sim
+		for ip := range u.ips {
+			ipUsers[ip]++
+		}
+		members = append(members, ClusterMember{UserID: uid, Requests: u.requests, IPs: len(u.ips), Similarity: math.Round(sim*1000) / 1000})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	shared := 0
+	for _, n := range ipUsers {
+		if n >= 2 {
+			shared++
+		}
+	}
+
+	similarity := simSum / float64(len(group))
+	score := 40*similarity + 10*math.Min(float64(len(group)-1), 4) + 20*math.Min(float64(shared), 1)
+	if !hasUA {
+		score *= 0.6
+	}
+
+	h := sha1.New()
+	h.Write([]byte(fp.ua + "\x00" + fp.network))
+	for _, m := range members {
+		fmt.Fprintf(h, ",%d", m.UserID)
+	}
+	return DeviceCluster{
+		ID:         hex.EncodeToString(h.Sum(nil))[:12],
+		UserAgent:  fp.ua,
+		Network:    fp.network,
+		ISP:        fp.isp,
+		SharedIPs:  shared,
+		Similarity: math.Round(similarity*1000) / 1000,
+		Score:      math.Round(score*10) / 10,
+		Members:    members,
+	}
+}
+
+// enrichClusterMembers adds username and status to every member
+func (s *RiskMonitoringService) enrichClusterMembers(clusters []DeviceCluster) {
+	var rows []map[string]interface{}
+	for _, c := range clusters {
+		for _, m := range c.Members {
+			rows = append(rows, map[string]interface{}{"user_id": m.UserID})
+		}
+	}
+	s.enrichUserInfo(rows)
+	i := 0
+	for ci := range clusters {
+		for mi := range clusters[ci].Members {
+			clusters[ci].Members[mi].Username = toString(rows[i]["username"])
+			clusters[ci].Members[mi].UserStatus = toInt64(rows[i]["user_status"])
+			i++
+		}
+	}
+}
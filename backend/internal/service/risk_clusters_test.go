@@ -0,0 +1,83 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserAgentFromOther(t *testing.T) {
+	cases := map[string]string{
+		`{"user_agent": " curl/8.4 "}`:         "curl/8.4",
+		`{"ua": "Go-http-client/1.1"}`:         "Go-http-client/1.1",
+		`{"model_ratio": 1, "group_ratio": 1}`: "",
+		`not json with "ua" inside`:            "",
+		``:                                     "",
+	}
+	for raw, want := range cases {
+		if got := userAgentFromOther(raw); got != want {
+			t.Errorf("userAgentFromOther(%q) = %q, want %q", raw, got, want)
+		}
+	}
+	if got := networkPrefix("203.0.113.77"); got != "203.0.113.0/24" {
+		t.Errorf("networkPrefix v4 = %s", got)
+	}
+	if got := networkPrefix("2001:db8:1:2::5"); got != "2001:db8:1::/48" {
+		t.Errorf("networkPrefix v6 = %s", got)
+	}
+}
+
+func TestGetDeviceClustersGroupsSharedFingerprints(t *testing.T) {
+	restore := SetIPGeoServiceProviderForTesting(func() *IPGeoService { return nil })
+	defer restore()
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, status INTEGER, deleted_at INTEGER);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, ip TEXT, type INTEGER, created_at INTEGER, other TEXT);
+		INSERT INTO users VALUES (1, 'a1', '', 1, NULL), (2, 'a2', '', 1, NULL), (3, 'a3', '', 2, NULL), (4, 'b1', '', 1, NULL);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	clusterSources.Store("", FingerprintSourceOther)
+	defer clusterSources.Delete("")
+
+	// Users 1-3: same UA on 198.51.100.0/24, all active around the same
+	// hour. User 2 shares an IP with user 1. User 4 has the same UA and
+	// network but is active twelve hours later.
+	now := time.Now().Unix()
+	base := now - now%86400 - 86400 + 3*3600 // yesterday 03:00 UTC
+	insert := func(uid int64, ip string, at int64) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO logs (user_id, ip, type, created_at, other) VALUES (?, ?, 2, ?, '{"user_agent":"bot/1.0"}')`,
+			uid, ip, at); err != nil {
+			t.Fatalf("seed log: %v", err)
+		}
+	}
+	for i := int64(0); i < 4; i++ {
+		insert(1, "198.51.100.10", base+i*60)
+		insert(2, "198.51.100.10", base+i*60+5)
+		insert(3, "198.51.100.30", base+i*60+9)
+		insert(4, "198.51.100.40", base+12*3600+i*60)
+	}
+	insert(4, "198.51.100.40", base+12*3600+300)
+
+	data, err := NewRiskMonitoringService().GetDeviceClusters(ClusterQuery{Window: "3d", MinUsers: 2, Limit: 10})
+	if err != nil {
+		t.Fatalf("clusters: %v", err)
+	}
+	if data["fingerprint_source"] != FingerprintSourceOther {
+		t.Fatalf("fingerprint source = %v", data["fingerprint_source"])
+	}
+	clusters := data["items"].([]DeviceCluster)
+	if len(clusters) != 1 {
+		t.Fatalf("expected one cluster, got %+v", clusters)
+	}
+	c := clusters[0]
+	if c.UserAgent != "bot/1.0" || c.Network != "198.51.100.0/24" || c.SharedIPs != 1 || len(c.Members) != 3 {
+		t.Fatalf("unexpected cluster: %+v", c)
+	}
+	if c.Members[0].Username != "a1" || c.Members[2].UserStatus != 2 {
+		t.Fatalf("members not enriched: %+v", c.Members)
+	}
+	if c.Similarity < 0.99 || c.Score <= 0 || c.Score > 100 {
+		t.Fatalf("unexpected similarity / score: %+v", c)
+	}
+}
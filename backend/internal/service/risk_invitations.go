@@ -0,0 +1,281 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+const (
+	defaultInviteDepth = 3
+	maxInviteDepth     = 10
+	// maxInviteGraphNodes bounds the users loaded for one graph; deeper or
+	// wider trees are cut off and marked truncated
+	maxInviteGraphNodes = 5000
+	// inviteQueryChunk bounds the inviter IDs per IN (...) query
+	inviteQueryChunk = 500
+)
+
+// InviteNode is one user of an invitation graph. Subtree* include the user.
+type InviteNode struct {
+	UserID           int64  `json:"user_id"`
+	Username         string `json:"username"`
+	DisplayName      string `json:"display_name"`
+	InviterID        int64  `json:"inviter_id"`
+	Depth            int    `json:"depth"` // 根为 0，上级为负数
+	Status           int64  `json:"status"`
+	Deleted          bool   `json:"deleted"`
+	UsedQuota        int64  `json:"used_quota"`
+	RequestCount     int64  `json:"request_count"`
+	Invited          int    `json:"invited"` // 直接邀请人数（含未展开的）
+	SubtreeUsers     int    `json:"subtree_users"`
+	SubtreeUsedQuota int64  `json:"subtree_used_quota"`
+	Truncated        bool   `json:"truncated"` // 还有下级未展开（超出 depth 或节点上限）
+}
+
+// InviteEdge points from inviter to invitee
+type InviteEdge struct {
+	From  int64 `json:"from"`
+	To    int64 `json:"to"`
+	Cycle bool  `json:"cycle"` // 指回已出现的用户，闭合了一个邀请环
+}
+
+// InviteGraph is the invitation tree below a user plus the chain above it
+type InviteGraph struct {
+	RootID    int64        `json:"root_id"`
+	Depth     int          `json:"depth"`
+	Nodes     []InviteNode `json:"nodes"`     // 根与下级，按层序
+	Ancestors []InviteNode `json:"ancestors"` // 邀请链上级，由近及远
+	Edges     []InviteEdge `json:"edges"`
+	Cycles    [][]int64    `json:"cycles"` // 每个环按邀请方向列出，首尾相同
+	Truncated bool         `json:"truncated"`
+}
+
+// inviteUserColumns are the users columns loaded for graph nodes
+const inviteUserColumns = `id, username, COALESCE(display_name, '') AS display_name, COALESCE(inviter_id, 0) AS inviter_id,
+	status, used_quota, request_count, deleted_at`
+
+func inviteNodeFromRow(row map[string]interface{}, depth int) InviteNode {
+	return InviteNode{
+		UserID:       toInt64(row["id"]),
+		Username:     toString(row["username"]),
+		DisplayName:  toString(row["display_name"]),
+		InviterID:    toInt64(row["inviter_id"]),
+		Depth:        depth,
+		Status:       toInt64(row["status"]),
+		Deleted:      row["deleted_at"] != nil,
+		UsedQuota:    toInt64(row["used_quota"]),
+		RequestCount: toInt64(row["request_count"]),
+	}
+}
+
+// GetInvitationGraph walks the invitation tree below rootID up to depth
+// levels, aggregating used quota per subtree, and follows the inviter chain
+// above it. Soft-deleted users stay in the graph (marked deleted): abuse
+// rings often delete the middle of a chain. Each user has one inviter, so a
+// cycle can only show up as an invitee that was already visited; such edges
+// are reported in cycles and not descended into. Returns nil when rootID
+// does not exist.
+func (s *RiskMonitoringService) GetInvitationGraph(rootID int64, depth int) (*InviteGraph, error) {
+	if depth <= 0 {
+		depth = defaultInviteDepth
+	}
+	if depth > maxInviteDepth {
+		depth = maxInviteDepth
+	}
+
+	cacheKey := cache.Key("risk:invite_graph:%d:%d", rootID, depth)
+	var cached InviteGraph
+	if found, _ := s.cm.GetJSON(cacheKey, &cached); found {
+		return &cached, nil
+	}
+
+	rootRow, err := s.db.QueryOne(s.db.RebindQuery(`SELECT `+inviteUserColumns+` FROM users WHERE id = ?`), rootID)
+	if err != nil {
+		return nil, err
+	}
+	if rootRow == nil {
+		return nil, nil
+	}
+
+	graph := &InviteGraph{RootID: rootID, Depth: depth, Edges: []InviteEdge{}, Cycles: [][]int64{}, Ancestors: []InviteNode{}}
+	graph.Nodes = []InviteNode{inviteNodeFromRow(rootRow, 0)}
+	index := map[int64]int{rootID: 0}
+	frontier := []int64{rootID}
+
+	for level := 1; len(frontier) > 0; level++ {
+		if level > depth || len(graph.Nodes) >= maxInviteGraphNodes {
+			// Leaves: count their invitees so the UI can offer to expand them
+			counts, err := s.countInvitees(frontier)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range frontier {
+				if n := counts[id]; n > 0 {
+					node := &graph.Nodes[index[id]]
+					node.Invited, node.Truncated = n, true
+					graph.Truncated = true
+				}
+			}
+			break
+		}
+		rows, err := s.loadInvitees(frontier)
+		if err != nil {
+			return nil, err
+		}
+		var next []int64
+		for _, row := range rows {
+			child := inviteNodeFromRow(row, level)
+			parent := &graph.Nodes[index[child.InviterID]]
+			parent.Invited++
+			if _, seen := index[child.UserID]; seen {
+				graph.Edges = append(graph.Edges, InviteEdge{From: child.InviterID, To: child.UserID, Cycle: true})
+				// Only the root can be reached twice: its inviter is in its own subtree
+				graph.Cycles = append(graph.Cycles, append(inviteTreePath(graph.Nodes, index, child.InviterID), child.UserID))
+				continue
+			}
+			if len(graph.Nodes) >= maxInviteGraphNodes {
+				parent.Truncated = true
+				graph.Truncated = true
+				continue
+			}
+			index[child.UserID] = len(graph.Nodes)
+			graph.Nodes = append(graph.Nodes, child)
+			graph.Edges = append(graph.Edges, InviteEdge{From: child.InviterID, To: child.UserID})
+			next = append(next, child.UserID)
+		}
+		frontier = next
+	}
+
+	// Nodes are in BFS order, so children always come after their parent
+	for i := len(graph.Nodes) - 1; i >= 0; i-- {
+		node := &graph.Nodes[i]
+		node.SubtreeUsers++
+		node.SubtreeUsedQuota += node.UsedQuota
+		if i == 0 {
+			break
+		}
+		parent := &graph.Nodes[index[node.InviterID]]
+		parent.SubtreeUsers += node.SubtreeUsers
+		parent.SubtreeUsedQuota += node.SubtreeUsedQuota
+	}
+
+	if err := s.loadInviteAncestors(graph, index); err != nil {
+		return nil, err
+	}
+
+	s.cm.Set(cacheKey, graph, scaledTTL(5*time.Minute))
+	return graph, nil
+}
+
+// loadInvitees returns the users invited by any of inviterIDs, ordered by id
+func (s *RiskMonitoringService) loadInvitees(inviterIDs []int64) ([]map[string]interface{}, error) {
+	var out []map[string]interface{}
+	for start := 0; start < len(inviterIDs); start += inviteQueryChunk {
+		chunk := inviterIDs[start:min(start+inviteQueryChunk, len(inviterIDs))]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		rows, err := s.db.Query(fmt.Sprintf(`SELECT %s FROM users WHERE inviter_id IN (%s) ORDER BY id`,
+			inviteUserColumns, buildPlaceholders(s.db.IsPG, len(chunk), 1)), args...)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rows...)
+	}
+	return out, nil
+}
+
+// countInvitees returns the number of users invited by each of inviterIDs
+func (s *RiskMonitoringService) countInvitees(inviterIDs []int64) (map[int64]int, error) {
+	counts := map[int64]int{}
+	for start := 0; start < len(inviterIDs); start += inviteQueryChunk {
+		chunk := inviterIDs[start:min(start+inviteQueryChunk, len(inviterIDs))]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		rows, err := s.db.Query(fmt.Sprintf(`SELECT inviter_id, COUNT(*) AS cnt FROM users WHERE inviter_id IN (%s) GROUP BY inviter_id`,
+			buildPlaceholders(s.db.IsPG, len(chunk), 1)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			counts[toInt64(row["inviter_id"])] = int(toInt64(row["cnt"]))
+		}
+	}
+	return counts, nil
+}
+
+// loadInviteAncestors follows the root's inviter chain for up to
+// maxInviteDepth steps. Reaching a user already in the graph closes a cycle.
+func (s *RiskMonitoringService) loadInviteAncestors(graph *InviteGraph, index map[int64]int) error {
+	seen := map[int64]int{} // user -> position in graph.Ancestors
+	child := graph.Nodes[0]
+	for step := 1; step <= maxInviteDepth && child.InviterID > 0; step++ {
+		inviterID := child.InviterID
+		if _, inTree := index[inviterID]; inTree {
+			// root -> ... -> inviter (tree) -> child -> ... -> root (ancestors, downward)
+			if graphHasCycleEdge(graph.Edges, inviterID, child.UserID) {
+				return nil // 树遍历时已报告
+			}
+			graph.Edges = append(graph.Edges, InviteEdge{From: inviterID, To: child.UserID, Cycle: true})
+			path := inviteTreePath(graph.Nodes, index, inviterID)
+			for i := len(graph.Ancestors) - 1; i >= 0; i-- {
+				path = append(path, graph.Ancestors[i].UserID)
+			}
+			graph.Cycles = append(graph.Cycles, append(path, graph.RootID))
+			return nil
+		}
+		if pos, ok := seen[inviterID]; ok {
+			// A loop above the root: inviter -> child -> ... -> inviter
+			graph.Edges = append(graph.Edges, InviteEdge{From: inviterID, To: child.UserID, Cycle: true})
+			path := []int64{inviterID}
+			for i := len(graph.Ancestors) - 1; i > pos; i-- {
+				path = append(path, graph.Ancestors[i].UserID)
+			}
+			graph.Cycles = append(graph.Cycles, append(path, inviterID))
+			return nil
+		}
+		row, err := s.db.QueryOne(s.db.RebindQuery(`SELECT `+inviteUserColumns+` FROM users WHERE id = ?`), inviterID)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil // 上级已被物理删除
+		}
+		seen[inviterID] = len(graph.Ancestors)
+		parent := inviteNodeFromRow(row, -step)
+		graph.Ancestors = append(graph.Ancestors, parent)
+		graph.Edges = append(graph.Edges, InviteEdge{From: inviterID, To: child.UserID})
+		child = parent
+	}
+	return nil
+}
+
+// inviteTreePath returns the tree path from the root down to id
+func inviteTreePath(nodes []InviteNode, index map[int64]int, id int64) []int64 {
+	var up []int64
+	for i := index[id]; ; i = index[nodes[i].InviterID] {
+		up = append(up, nodes[i].UserID)
+		if i == 0 {
+			break
+		}
+	}
+	path := make([]int64, len(up))
+	for i, v := range up {
+		path[len(up)-1-i] = v
+	}
+	return path
+}
+
+func graphHasCycleEdge(edges []InviteEdge, from, to int64) bool {
+	for _, e := range edges {
+		if e.Cycle && e.From == from && e.To == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInvitationGraphSubtreesAndCycles(t *testing.T) {
+	db := installSQLiteForTests(t)
+	// 1 -> 2 -> 4 -> 1 is a cycle; 1 -> 3 -> 5 -> 6 is a plain chain
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, inviter_id INTEGER,
+			status INTEGER, used_quota INTEGER, request_count INTEGER, deleted_at INTEGER);
+		INSERT INTO users VALUES
+			(1, 'root', NULL, 4, 1, 10, 1, NULL),
+			(2, 'u2', NULL, 1, 1, 20, 1, NULL),
+			(3, 'u3', NULL, 1, 2, 30, 1, 1700000000),
+			(4, 'u4', NULL, 2, 1, 40, 1, NULL),
+			(5, 'u5', NULL, 3, 1, 50, 1, NULL),
+			(6, 'u6', NULL, 5, 1, 60, 1, NULL);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	svc := NewRiskMonitoringService()
+
+	graph, err := svc.GetInvitationGraph(1, 3)
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	if len(graph.Nodes) != 6 || graph.Truncated {
+		t.Fatalf("expected the whole tree, got %+v", graph)
+	}
+	root := graph.Nodes[0]
+	if root.SubtreeUsers != 6 || root.SubtreeUsedQuota != 210 || root.Invited != 2 {
+		t.Errorf("root aggregates: %+v", root)
+	}
+	if u3 := graph.Nodes[2]; u3.UserID != 3 || !u3.Deleted || u3.SubtreeUsedQuota != 140 {
+		t.Errorf("u3: %+v", u3)
+	}
+	if !reflect.DeepEqual(graph.Cycles, [][]int64{{1, 2, 4, 1}}) {
+		t.Errorf("cycles: %v", graph.Cycles)
+	}
+	if len(graph.Ancestors) != 0 {
+		t.Errorf("root's inviter is in its own subtree, no ancestors expected: %+v", graph.Ancestors)
+	}
+
+	graph, err = svc.GetInvitationGraph(1, 2)
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	if len(graph.Nodes) != 5 || !graph.Truncated {
+		t.Fatalf("depth 2 should cut u6 off, got %d nodes", len(graph.Nodes))
+	}
+	for _, n := range graph.Nodes {
+		if (n.UserID == 4 || n.UserID == 5) != n.Truncated || (n.Truncated && n.Invited != 1) {
+			t.Errorf("leaf expansion flag: %+v", n)
+		}
+	}
+	if !reflect.DeepEqual(graph.Cycles, [][]int64{{1, 2, 4, 1}}) {
+		t.Errorf("cycle beyond depth should be found via the inviter chain: %v", graph.Cycles)
+	}
+
+	graph, err = svc.GetInvitationGraph(5, 1)
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	var chain []int64
+	for _, a := range graph.Ancestors {
+		chain = append(chain, a.UserID)
+	}
+	if !reflect.DeepEqual(chain, []int64{3, 1, 4, 2}) || !reflect.DeepEqual(graph.Cycles, [][]int64{{1, 2, 4, 1}}) {
+		t.Errorf("ancestors %v cycles %v", chain, graph.Cycles)
+	}
+
+	if graph, err := svc.GetInvitationGraph(99, 3); err != nil || graph != nil {
+		t.Errorf("unknown user should return nil, got %+v %v", graph, err)
+	}
+}
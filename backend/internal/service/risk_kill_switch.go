@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+var (
+	ErrInvalidKillSwitch   = errors.New("invalid kill switch request")
+	ErrKillSwitchNotFound  = errors.New("kill switch target not found")
+	ErrKillSwitchProtected = errors.New("kill switch target is protected")
+)
+
+// killSwitchCachePrefixes are the cached views showing user / token status
+var killSwitchCachePrefixes = []string{"risk:", "ip:", "dashboard:"}
+
+// KillSwitchInput targets either a user (banned, tokens disabled) or a
+// single token (disabled)
+type KillSwitchInput struct {
+	UserID        int64  `json:"user_id"`
+	TokenID       int64  `json:"token_id"`
+	Reason        string `json:"reason"`
+	DisableTokens *bool  `json:"disable_tokens"` // 封禁用户时同时禁用其全部令牌，默认 true
+}
+
+// KillSwitchStep is the outcome of one step of the flow
+type KillSwitchStep struct {
+	Step   string `json:"step"` // ban_user / disable_tokens / disable_token / clear_cache / notify
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// KillSwitchRecord is one kill-switch activation
+type KillSwitchRecord struct {
+	ID             int64            `json:"id"`
+	Target         string           `json:"target"` // user / token
+	UserID         int64            `json:"user_id"`
+	Username       string           `json:"username"`
+	TokenID        int64            `json:"token_id"`
+	TokenName      string           `json:"token_name"`
+	Reason         string           `json:"reason"`
+	Operator       string           `json:"operator"`
+	TokensDisabled int64            `json:"tokens_disabled"`
+	CachesCleared  int64            `json:"caches_cleared"`
+	Steps          []KillSwitchStep `json:"steps"`
+	CreatedAt      int64            `json:"created_at"`
+}
+
+// KillSwitchService bans a user or disables a token in one call during an
+// incident: the database change, cache invalidation, notification and
+// record that otherwise take three separate requests
+type KillSwitchService struct {
+	db *database.Manager
+	cm *cache.Manager
+}
+
+// NewKillSwitchService creates a KillSwitchService on the primary instance
+func NewKillSwitchService() *KillSwitchService {
+	return &KillSwitchService{db: database.Get(), cm: cache.Get()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *KillSwitchService) WithContext(ctx context.Context) *KillSwitchService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+func ensureKillSwitchTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS kill_switch_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			target TEXT NOT NULL,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			token_id INTEGER NOT NULL DEFAULT 0,
+			token_name TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			operator TEXT NOT NULL DEFAULT '',
+			tokens_disabled INTEGER NOT NULL DEFAULT 0,
+			caches_cleared INTEGER NOT NULL DEFAULT 0,
+			steps TEXT NOT NULL DEFAULT '[]',
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_kill_switch_user ON kill_switch_records (user_id, id)`)
+	return err
+}
+
+func openKillSwitchStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureKillSwitchTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Activate runs the kill switch. The ban / disable updates share one
+// transaction, so a failure there changes nothing and is returned as an
+// error. Cache invalidation, notification and the record run afterwards;
+// their failures are reported in the steps since the ban already holds.
+// Admin accounts (and their tokens) are refused.
+func (s *KillSwitchService) Activate(ctx context.Context, in KillSwitchInput, operator string) (*KillSwitchRecord, error) {
+	in.Reason = strings.TrimSpace(in.Reason)
+	if (in.UserID > 0) == (in.TokenID > 0) {
+		return nil, fmt.Errorf("%w: user_id 与 token_id 需且仅需填一个", ErrInvalidKillSwitch)
+	}
+	if in.Reason == "" || len([]rune(in.Reason)) > 500 {
+		return nil, fmt.Errorf("%w: 请填写原因（不超过 500 字）", ErrInvalidKillSwitch)
+	}
+
+	rec := &KillSwitchRecord{Reason: in.Reason, Operator: operator, Steps: []KillSwitchStep{}, CreatedAt: time.Now().Unix()}
+	var err error
+	if in.UserID > 0 {
+		rec.Target, rec.UserID = "user", in.UserID
+		err = s.banUser(rec, in.DisableTokens == nil || *in.DisableTokens)
+	} else {
+		rec.Target, rec.TokenID = "token", in.TokenID
+		err = s.disableToken(rec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cleared int64
+	var cacheErrs []string
+	for _, prefix := range killSwitchCachePrefixes {
+		n, err := s.cm.DeleteByPrefix(cache.Key("%s", prefix))
+		if err != nil {
+			cacheErrs = append(cacheErrs, err.Error())
+		}
+		cleared += n
+	}
+	rec.CachesCleared = cleared
+	rec.Steps = append(rec.Steps, KillSwitchStep{Step: "clear_cache", OK: len(cacheErrs) == 0, Detail: strings.Join(cacheErrs, "; ")})
+	PublishEvent(EventCacheInvalidated, map[string]interface{}{"scope": "risk"})
+
+	rec.Steps = append(rec.Steps, KillSwitchStep{Step: "notify", OK: true})
+	PublishEvent(EventKillSwitch, map[string]interface{}{
+		"target":          rec.Target,
+		"user_id":         rec.UserID,
+		"username":        rec.Username,
+		"token_id":        rec.TokenID,
+		"tokens_disabled": rec.TokensDisabled,
+		"reason":          rec.Reason,
+		"operator":        operator,
+	})
+	if rec.Target == "user" {
+		logger.L.Security(fmt.Sprintf("[紧急封禁] %s 封禁用户 %d (%s)，禁用令牌 %d 个 | 原因: %s",
+			operator, rec.UserID, rec.Username, rec.TokensDisabled, rec.Reason))
+	} else {
+		logger.L.Security(fmt.Sprintf("[紧急封禁] %s 禁用令牌 %d (%s，用户 %d) | 原因: %s",
+			operator, rec.TokenID, rec.TokenName, rec.UserID, rec.Reason))
+	}
+
+	if err := s.record(ctx, rec); err != nil {
+		logger.L.Warn("[紧急封禁] 记录保存失败: " + err.Error())
+		rec.Steps = append(rec.Steps, KillSwitchStep{Step: "record", OK: false, Detail: err.Error()})
+	}
+	return rec, nil
+}
+
+// lockClause returns the row lock suffix for the driver
+func (s *KillSwitchService) lockClause() string {
+	if s.db.DB.DriverName() == "sqlite" {
+		return "" // SQLite 写事务本身即库级锁，且不支持 FOR UPDATE
+	}
+	return " FOR UPDATE"
+}
+
+func (s *KillSwitchService) banUser(rec *KillSwitchRecord, disableTokens bool) error {
+	tx, err := s.db.DB.BeginTxx(s.db.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username sql.NullString
+	var role, status int64
+	err = tx.QueryRowx(s.db.RebindQuery("SELECT username, role, status FROM users WHERE id = ? AND deleted_at IS NULL"+s.lockClause()), rec.UserID).
+		Scan(&username, &role, &status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: 用户 %d 不存在", ErrKillSwitchNotFound, rec.UserID)
+	}
+	if err != nil {
+		return err
+	}
+	if role >= RoleAdminUser {
+		return fmt.Errorf("%w: 不能封禁管理员账号", ErrKillSwitchProtected)
+	}
+	rec.Username = username.String
+
+	detail := ""
+	if status != 1 {
+		detail = "已是封禁状态"
+	}
+	if _, err := tx.Exec(s.db.RebindQuery("UPDATE users SET status = 2 WHERE id = ?"), rec.UserID); err != nil {
+		return err
+	}
+	rec.Steps = append(rec.Steps, KillSwitchStep{Step: "ban_user", OK: true, Detail: detail})
+	if disableTokens {
+		res, err := tx.Exec(s.db.RebindQuery("UPDATE tokens SET status = 2 WHERE user_id = ? AND status = 1"), rec.UserID)
+		if err != nil {
+			return err
+		}
+		rec.TokensDisabled, _ = res.RowsAffected()
+		rec.Steps = append(rec.Steps, KillSwitchStep{Step: "disable_tokens", OK: true, Detail: fmt.Sprintf("%d 个令牌", rec.TokensDisabled)})
+	}
+	return tx.Commit()
+}
+
+func (s *KillSwitchService) disableToken(rec *KillSwitchRecord) error {
+	tx, err := s.db.DB.BeginTxx(s.db.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name sql.NullString
+	var userID int64
+	err = tx.QueryRowx(s.db.RebindQuery("SELECT name, user_id FROM tokens WHERE id = ?"+s.lockClause()), rec.TokenID).Scan(&name, &userID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: 令牌 %d 不存在", ErrKillSwitchNotFound, rec.TokenID)
+	}
+	if err != nil {
+		return err
+	}
+	rec.TokenName, rec.UserID = name.String, userID
+
+	var username sql.NullString
+	var role int64
+	err = tx.QueryRowx(s.db.RebindQuery("SELECT username, role FROM users WHERE id = ?"), userID).Scan(&username, &role)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if role >= RoleAdminUser {
+		return fmt.Errorf("%w: 不能禁用管理员的令牌", ErrKillSwitchProtected)
+	}
+	rec.Username = username.String
+
+	res, err := tx.Exec(s.db.RebindQuery("UPDATE tokens SET status = 2 WHERE id = ?"), rec.TokenID)
+	if err != nil {
+		return err
+	}
+	rec.TokensDisabled, _ = res.RowsAffected()
+	rec.Steps = append(rec.Steps, KillSwitchStep{Step: "disable_token", OK: true})
+	return tx.Commit()
+}
+
+func (s *KillSwitchService) record(ctx context.Context, rec *KillSwitchRecord) error {
+	store, err := openKillSwitchStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	steps, _ := json.Marshal(rec.Steps)
+	res, err := store.ExecContext(ctx, `
+		INSERT INTO kill_switch_records (target, user_id, username, token_id, token_name, reason, operator,
+			tokens_disabled, caches_cleared, steps, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.Target, rec.UserID, rec.Username, rec.TokenID, rec.TokenName, rec.Reason, rec.Operator,
+		rec.TokensDisabled, rec.CachesCleared, string(steps), rec.CreatedAt)
+	if err != nil {
+		return err
+	}
+	rec.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ListRecords returns kill-switch activations, newest first. userID 0 = all.
+func (s *KillSwitchService) ListRecords(ctx context.Context, userID int64, limit, offset int) ([]KillSwitchRecord, int64, error) {
+	store, err := openKillSwitchStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer store.Close()
+
+	where, args := "", []interface{}{}
+	if userID > 0 {
+		where, args = " WHERE user_id = ?", append(args, userID)
+	}
+	var total int64
+	if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM kill_switch_records`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, target, user_id, username, token_id, token_name, reason, operator, tokens_disabled, caches_cleared, steps, created_at
+		FROM kill_switch_records`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items := []KillSwitchRecord{}
+	for rows.Next() {
+		var r KillSwitchRecord
+		var steps string
+		if err := rows.Scan(&r.ID, &r.Target, &r.UserID, &r.Username, &r.TokenID, &r.TokenName, &r.Reason, &r.Operator,
+			&r.TokensDisabled, &r.CachesCleared, &steps, &r.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal([]byte(steps), &r.Steps); err != nil || r.Steps == nil {
+			r.Steps = []KillSwitchStep{}
+		}
+		items = append(items, r)
+	}
+	return items, total, rows.Err()
+}
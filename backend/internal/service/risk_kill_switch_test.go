@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestKillSwitchBansUserAndRecords(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role INTEGER, status INTEGER, deleted_at INTEGER);
+		CREATE TABLE tokens (id INTEGER PRIMARY KEY, user_id INTEGER, name TEXT, status INTEGER);
+		INSERT INTO users VALUES (1, 'abuser', 1, 1, NULL), (2, 'other', 1, 1, NULL), (3, 'root', 100, 1, NULL);
+		INSERT INTO tokens VALUES (10, 1, 'a', 1), (11, 1, 'b', 1), (12, 1, 'c', 2), (20, 2, 'd', 1), (30, 3, 'e', 1);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	ctx := context.Background()
+	svc := NewKillSwitchService()
+
+	events, unsubscribe := GetEventBus().Subscribe()
+	defer unsubscribe()
+
+	rec, err := svc.Activate(ctx, KillSwitchInput{UserID: 1, Reason: "card testing"}, "admin")
+	if err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if rec.ID == 0 || rec.Username != "abuser" || rec.TokensDisabled != 2 || len(rec.Steps) != 4 {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	var status int
+	db.Get(&status, `SELECT status FROM users WHERE id = 1`)
+	var enabled int
+	db.Get(&enabled, `SELECT COUNT(*) FROM tokens WHERE user_id = 1 AND status = 1`)
+	if status != 2 || enabled != 0 {
+		t.Fatalf("user status %d, enabled tokens %d", status, enabled)
+	}
+	deadline := time.After(time.Second)
+	for found := false; !found; {
+		select {
+		case ev := <-events:
+			found = ev.Type == EventKillSwitch && ev.Data["user_id"] == int64(1)
+		case <-deadline:
+			t.Fatal("no kill_switch event")
+		}
+	}
+
+	rec, err = svc.Activate(ctx, KillSwitchInput{TokenID: 20, Reason: "leaked key"}, "admin")
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	db.Get(&status, `SELECT status FROM users WHERE id = 2`)
+	if rec.Target != "token" || rec.UserID != 2 || rec.TokenName != "d" || status != 1 {
+		t.Fatalf("token kill switch must not ban the owner: %+v status %d", rec, status)
+	}
+
+	if _, err := svc.Activate(ctx, KillSwitchInput{UserID: 3, Reason: "x"}, "admin"); !errors.Is(err, ErrKillSwitchProtected) {
+		t.Errorf("admin must be refused, got %v", err)
+	}
+	if _, err := svc.Activate(ctx, KillSwitchInput{TokenID: 30, Reason: "x"}, "admin"); !errors.Is(err, ErrKillSwitchProtected) {
+		t.Errorf("admin token must be refused, got %v", err)
+	}
+	if _, err := svc.Activate(ctx, KillSwitchInput{UserID: 1, TokenID: 10, Reason: "x"}, "admin"); !errors.Is(err, ErrInvalidKillSwitch) {
+		t.Errorf("both targets must be rejected, got %v", err)
+	}
+	if _, err := svc.Activate(ctx, KillSwitchInput{UserID: 99, Reason: "x"}, "admin"); !errors.Is(err, ErrKillSwitchNotFound) {
+		t.Errorf("unknown user, got %v", err)
+	}
+
+	items, total, err := svc.ListRecords(ctx, 0, 50, 0)
+	if err != nil || total != 2 || items[0].Target != "token" || len(items[1].Steps) != 4 {
+		t.Fatalf("records: %+v total %d err %v", items, total, err)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strings"
@@ -10,17 +11,33 @@ import (
 	"github.com/new-api-tools/backend/internal/cache"
 	"github.com/new-api-tools/backend/internal/database"
 	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // RiskMonitoringService handles risk detection queries
 type RiskMonitoringService struct {
-	db    *database.Manager
-	logDB *database.Manager
+	db       *database.Manager
+	logDB    *database.Manager
+	cm       *cache.Manager
+	instance string
 }
 
 // NewRiskMonitoringService creates a new RiskMonitoringService
 func NewRiskMonitoringService() *RiskMonitoringService {
-	return &RiskMonitoringService{db: database.Get(), logDB: database.GetLog()}
+	return NewRiskMonitoringServiceFor("")
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *RiskMonitoringService) WithContext(ctx context.Context) *RiskMonitoringService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+// NewRiskMonitoringServiceFor creates a RiskMonitoringService bound to a registered New API instance ("" = primary)
+func NewRiskMonitoringServiceFor(instance string) *RiskMonitoringService {
+	db, logDB := database.ForInstanceRead(instance)
+	return &RiskMonitoringService{db: db, logDB: logDB, cm: cache.ForInstance(instance), instance: instance}
 }
 
 // enrichUserInfo backfills username/display_name (preferring display_name) and
@@ -81,16 +98,16 @@ func (s *RiskMonitoringService) enrichUserInfo(rows []map[string]interface{}) {
 }
 
 // GetLeaderboards returns usage leaderboards across multiple time windows
-func (s *RiskMonitoringService) GetLeaderboards(windows []string, limit int, sortBy string) (map[string]interface{}, error) {
-	cm := cache.Get()
-	cacheKey := fmt.Sprintf("risk:leaderboards:%s:%d:%s", strings.Join(windows, ","), limit, sortBy)
-	var cached map[string]interface{}
+func (s *RiskMonitoringService) GetLeaderboards(windows []string, limit int, sortBy string) (*api.Leaderboards, error) {
+	cm := s.cm
+	cacheKey := cache.Key("risk:leaderboards:%s:%d:%s", strings.Join(windows, ","), limit, sortBy)
+	var cached api.Leaderboards
 	found, _ := cm.GetJSON(cacheKey, &cached)
 	if found {
-		return cached, nil
+		return &cached, nil
 	}
 
-	windowsData := map[string]interface{}{}
+	windowsData := map[string][]api.LeaderboardEntry{}
 
 	// Validate sortBy to prevent SQL injection via ORDER BY expression
 	orderBy := "request_count DESC"
@@ -107,6 +124,7 @@ func (s *RiskMonitoringService) GetLeaderboards(windows []string, limit int, sor
 		}
 		now := time.Now().Unix()
 		startTime := now - seconds
+		excludeSQL, excludeArgs := roleExclusionClause(s.db, "l.user_id")
 
 		// Aggregate from logs first (logs may live in a separate DB → no JOIN users).
 		// display_name / status come from the main DB in a second step below.
@@ -114,43 +132,59 @@ func (s *RiskMonitoringService) GetLeaderboards(windows []string, limit int, sor
 			SELECT l.user_id as user_id,
 				COALESCE(NULLIF(MAX(l.username), ''), '') as username,
 				COUNT(*) as request_count,
-				SUM(CASE WHEN l.type = 5 THEN 1 ELSE 0 END) as failure_requests,
-				(SUM(CASE WHEN l.type = 5 THEN 1 ELSE 0 END) * 1.0) / NULLIF(COUNT(*), 0) as failure_rate,
+				SUM(CASE WHEN l.type = `+ltError()+` THEN 1 ELSE 0 END) as failure_requests,
+				(SUM(CASE WHEN l.type = `+ltError()+` THEN 1 ELSE 0 END) * 1.0) / NULLIF(COUNT(*), 0) as failure_rate,
 				COALESCE(SUM(l.quota), 0) as quota_used,
 				COALESCE(SUM(l.prompt_tokens), 0) as prompt_tokens,
 				COALESCE(SUM(l.completion_tokens), 0) as completion_tokens,
 				COALESCE(COUNT(DISTINCT NULLIF(l.ip, '')), 0) as unique_ips
 			FROM logs l
 			WHERE l.created_at >= ? AND l.created_at <= ?
-				AND l.type IN (2, 5)
-				AND l.user_id IS NOT NULL
+				AND l.type IN (`+ltRequests()+`)
+				AND l.user_id IS NOT NULL%s
 			GROUP BY l.user_id
 			ORDER BY %s
-			LIMIT ?`, orderBy))
+			LIMIT ?`, excludeSQL, orderBy))
 
-		rows, err := s.logDB.Query(query, startTime, now, limit)
+		args := append([]interface{}{startTime, now}, excludeArgs...)
+		rows, err := s.logDB.Query(query, append(args, limit)...)
 		if err != nil {
-			windowsData[window] = []map[string]interface{}{}
+			windowsData[window] = []api.LeaderboardEntry{}
 			continue
 		}
 
 		// Enrich with display_name / status from the main users table.
 		s.enrichUserInfo(rows)
 
-		windowsData[window] = rows
+		entries := make([]api.LeaderboardEntry, 0, len(rows))
+		for _, row := range rows {
+			entries = append(entries, api.LeaderboardEntry{
+				UserID:           toInt64(row["user_id"]),
+				Username:         toString(row["username"]),
+				UserStatus:       toInt64(row["user_status"]),
+				RequestCount:     toInt64(row["request_count"]),
+				FailureRequests:  toInt64(row["failure_requests"]),
+				FailureRate:      toFloat64(row["failure_rate"]),
+				QuotaUsed:        toInt64(row["quota_used"]),
+				PromptTokens:     toInt64(row["prompt_tokens"]),
+				CompletionTokens: toInt64(row["completion_tokens"]),
+				UniqueIPs:        toInt64(row["unique_ips"]),
+			})
+		}
+		windowsData[window] = entries
 	}
 
-	result := map[string]interface{}{
-		"windows":      windowsData,
-		"generated_at": time.Now().Unix(),
+	result := &api.Leaderboards{
+		Windows:     windowsData,
+		GeneratedAt: time.Now().Unix(),
 	}
 
-	cm.Set(cacheKey, result, 3*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(3*time.Minute))
 	return result, nil
 }
 
 // GetUserAnalysis returns detailed risk analysis for a user
-func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int64, endTime *int64) (map[string]interface{}, error) {
+func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int64, endTime *int64) (*api.UserAnalysis, error) {
 	now := time.Now().Unix()
 	if endTime != nil {
 		now = *endTime
@@ -166,32 +200,29 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 		fmt.Sprintf("SELECT id, username, display_name, email, status, %s, remark, linux_do_id, request_count FROM users WHERE id = ? AND deleted_at IS NULL", groupCol)), userID)
 
 	// Build user object
-	userInfo := map[string]interface{}{
-		"id":           userID,
-		"username":     "",
-		"display_name": nil,
-		"email":        nil,
-		"status":       1,
-		"group":        nil,
-		"remark":       nil,
-		"linux_do_id":  nil,
-	}
+	userInfo := api.UserAnalysisUser{ID: userID, Status: 1}
 	if userRow != nil {
-		userInfo["id"] = userRow["id"]
-		userInfo["username"] = userRow["username"]
-		userInfo["display_name"] = userRow["display_name"]
-		userInfo["email"] = userRow["email"]
-		userInfo["status"] = userRow["status"]
-		userInfo["group"] = userRow["group"]
-		userInfo["remark"] = userRow["remark"]
-		userInfo["linux_do_id"] = userRow["linux_do_id"]
+		userInfo = api.UserAnalysisUser{
+			ID:          toInt64(userRow["id"]),
+			Username:    toString(userRow["username"]),
+			DisplayName: toString(userRow["display_name"]),
+			Email:       toString(userRow["email"]),
+			Status:      toInt64(userRow["status"]),
+			Group:       toString(userRow["group"]),
+			Remark:      toString(userRow["remark"]),
+			LinuxDoID:   toString(userRow["linux_do_id"]),
+		}
+	}
+	// GitHub / Discord 账号注册时间（开启 OAuth 资料补全时）
+	if s.instance == "" && userRow != nil {
+		userInfo.OAuthProfiles = userOAuthProfiles(s.db.Context(), userID)
 	}
 
 	// Usage stats in window
 	statsQuery := s.logDB.RebindQuery(`
 		SELECT COUNT(*) as total_requests,
-			SUM(CASE WHEN type = 2 THEN 1 ELSE 0 END) as success_requests,
-			SUM(CASE WHEN type = 5 THEN 1 ELSE 0 END) as failure_requests,
+			SUM(CASE WHEN type = ` + ltConsume() + ` THEN 1 ELSE 0 END) as success_requests,
+			SUM(CASE WHEN type = ` + ltError() + ` THEN 1 ELSE 0 END) as failure_requests,
 			COALESCE(SUM(quota), 0) as quota_used,
 			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
 			COALESCE(SUM(completion_tokens), 0) as completion_tokens,
@@ -199,9 +230,9 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 			COUNT(DISTINCT token_id) as unique_tokens,
 			COUNT(DISTINCT model_name) as unique_models,
 			COUNT(DISTINCT channel_id) as unique_channels,
-			SUM(CASE WHEN type = 2 AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count
+			SUM(CASE WHEN type = ` + ltConsume() + ` AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count
 		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (2, 5)`)
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `)`)
 
 	statsRow, _ := s.logDB.QueryOne(statsQuery, userID, startTime, now)
 
@@ -245,7 +276,7 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 	avgUseTimeQuery := s.logDB.RebindQuery(`
 		SELECT COALESCE(AVG(use_time), 0) as avg_use_time
 		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type = 2`)
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type = ` + ltConsume())
 	avgRow, _ := s.logDB.QueryOne(avgUseTimeQuery, userID, startTime, now)
 	avgUseTime := 0.0
 	if avgRow != nil {
@@ -257,21 +288,21 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 	}
 
 	// Summary
-	summary := map[string]interface{}{
-		"total_requests":    totalRequests,
-		"success_requests":  successRequests,
-		"failure_requests":  failureRequests,
-		"quota_used":        quotaUsed,
-		"prompt_tokens":     promptTokens,
-		"completion_tokens": completionTokens,
-		"avg_use_time":      avgUseTime,
-		"unique_ips":        uniqueIPs,
-		"unique_tokens":     uniqueTokens,
-		"unique_models":     uniqueModels,
-		"unique_channels":   uniqueChannels,
-		"empty_count":       emptyCount,
-		"failure_rate":      failureRate,
-		"empty_rate":        emptyRate,
+	summary := api.UserAnalysisSummary{
+		TotalRequests:    totalRequests,
+		SuccessRequests:  successRequests,
+		FailureRequests:  failureRequests,
+		QuotaUsed:        quotaUsed,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		AvgUseTime:       avgUseTime,
+		UniqueIPs:        uniqueIPs,
+		UniqueTokens:     uniqueTokens,
+		UniqueModels:     uniqueModels,
+		UniqueChannels:   uniqueChannels,
+		EmptyCount:       emptyCount,
+		FailureRate:      failureRate,
+		EmptyRate:        emptyRate,
 	}
 
 	// Risk analysis
@@ -286,45 +317,70 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 		avgQuotaPerRequest = float64(quotaUsed) / float64(totalRequests)
 	}
 
-	// IP switch analysis — fetch IP sequence ordered by time
-	ipSeqQuery := s.logDB.RebindQuery(`
-		SELECT created_at, ip
-		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ?
-			AND type IN (2, 5) AND ip IS NOT NULL AND ip != ''
-		ORDER BY created_at ASC`)
-	ipSequence, _ := s.logDB.QueryWithTimeout(30*time.Second, ipSeqQuery, userID, startTime, now)
+	// IP switch analysis — prefer the IP intervals in ip_history; fall back to
+	// the full per-request IP sequence from logs (exact, but a long scan)
+	var ipSequence []map[string]interface{}
+	ipSwitchSource := "logs"
+	if s.instance == "" && endTime == nil {
+		history := NewIPHistoryService()
+		if history.Covers(context.Background(), startTime) {
+			if seq, err := history.UserIPSequence(context.Background(), userID, startTime, now); err == nil {
+				ipSequence, ipSwitchSource = seq, "ip_history"
+			}
+		}
+	}
+	if ipSwitchSource == "logs" {
+		ipSeqQuery := s.logDB.RebindQuery(`
+			SELECT created_at, ip
+			FROM logs
+			WHERE user_id = ? AND created_at >= ? AND created_at <= ?
+				AND type IN (` + ltRequests() + `) AND ip IS NOT NULL AND ip != ''
+			ORDER BY created_at ASC`)
+		ipSequence, _ = s.logDB.QueryWithTimeout(30*time.Second, ipSeqQuery, userID, startTime, now)
+	}
 	if ipSequence == nil {
 		ipSequence = []map[string]interface{}{}
 	}
 	ipSwitchAnalysis := analyzeIPSwitches(ipSequence)
+	ipSwitchAnalysis["source"] = ipSwitchSource
 
-	// Risk flags
+	// Risk flags (thresholds and points from /api/risk/config)
+	weights := currentRiskWeights(s.db.Context())
+	rules := weights.Rules
 	riskFlags := []string{}
-	if requestsPerMinute > 5.0 {
-		riskFlags = append(riskFlags, "HIGH_RPM")
+	// The in-process counters (no-Redis mode) catch a current burst that the
+	// window average smooths away
+	var liveRPM *float64
+	highRPM := requestsPerMinute > rules[RiskFlagHighRPM].Threshold
+	if s.instance == "" && endTime == nil {
+		if rpm, ok := LiveUserRPM(userID); ok {
+			liveRPM = &rpm
+			highRPM = highRPM || rpm > rules[RiskFlagHighRPM].Threshold
+		}
 	}
-	if uniqueIPs > 10 {
-		riskFlags = append(riskFlags, "MANY_IPS")
+	if highRPM {
+		riskFlags = append(riskFlags, RiskFlagHighRPM)
 	}
-	if failureRate > 50.0 && totalRequests > 10 {
-		riskFlags = append(riskFlags, "HIGH_FAILURE_RATE")
+	if float64(uniqueIPs) > rules[RiskFlagManyIPs].Threshold {
+		riskFlags = append(riskFlags, RiskFlagManyIPs)
+	}
+	if failureRate*100 >= rules[RiskFlagHighFailureRate].Threshold && totalRequests >= weights.FailureMinRequests {
+		riskFlags = append(riskFlags, RiskFlagHighFailureRate)
 	}
 
 	// IP switch risk flags (matching Python logic)
 	avgIPDuration := toFloat64(ipSwitchAnalysis["avg_ip_duration"])
 	rapidSwitchCount := toInt64(ipSwitchAnalysis["rapid_switch_count"])
 	realSwitchCount := toInt64(ipSwitchAnalysis["real_switch_count"])
-	if rapidSwitchCount >= 3 && avgIPDuration < 300 {
-		riskFlags = append(riskFlags, "IP_RAPID_SWITCH")
+	if rapidSwitchCount >= weights.SwitchMinCount && avgIPDuration < rules[RiskFlagIPRapidSwitch].Threshold {
+		riskFlags = append(riskFlags, RiskFlagIPRapidSwitch)
 	}
-	if avgIPDuration < 30 && realSwitchCount >= 3 {
-		riskFlags = append(riskFlags, "IP_HOPPING")
+	if avgIPDuration < rules[RiskFlagIPHopping].Threshold && realSwitchCount >= weights.SwitchMinCount {
+		riskFlags = append(riskFlags, RiskFlagIPHopping)
 	}
 
 	// Checkin anomaly detection
 	checkin := analyzeCheckins(s.db, userID, startTime, now)
-	var checkinAnalysisMap map[string]interface{}
 	if checkin != nil && checkin.CheckinCount > 0 {
 		requestsPerCheckin := float64(0)
 		if checkin.CheckinCount > 0 {
@@ -332,44 +388,81 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 		}
 		checkin.RequestsPerCheckin = math.Round(requestsPerCheckin*10) / 10
 
-		checkinAnalysisMap = map[string]interface{}{
-			"checkin_count":        checkin.CheckinCount,
-			"total_quota_awarded":  checkin.TotalQuotaAwarded,
-			"requests_per_checkin": checkin.RequestsPerCheckin,
+		// Flag: many checkins but very few requests per checkin
+		if checkin.CheckinCount > weights.CheckinMinCount && requestsPerCheckin < rules[RiskFlagCheckinAnomaly].Threshold {
+			riskFlags = append(riskFlags, RiskFlagCheckinAnomaly)
 		}
+	}
 
-		// Flag: many checkins but very few requests per checkin
-		if checkin.CheckinCount > 3 && requestsPerCheckin < 5 {
-			riskFlags = append(riskFlags, "CHECKIN_ANOMALY")
+	// Top IPs
+	ipsQuery := s.logDB.RebindQuery(`
+		SELECT ip, COUNT(*) as requests
+		FROM logs
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND ip IS NOT NULL AND ip != ''
+		GROUP BY ip
+		ORDER BY requests DESC
+		LIMIT 20`)
+
+	ipRows, _ := s.logDB.QueryWithTimeout(30*time.Second, ipsQuery, userID, startTime, now)
+	topIPs := make([]api.UserTopIP, 0, len(ipRows))
+	for _, row := range ipRows {
+		topIPs = append(topIPs, api.UserTopIP{IP: toString(row["ip"]), Requests: toInt64(row["requests"])})
+	}
+
+	// IP reputation: share of the top IPs' requests from datacenter / VPN / Tor
+	ipReputation := summarizeIPReputation(topIPs)
+	if ipReputation != nil {
+		if requests := ipReputation.RequestsByType[IPTypeTor]; requests > 0 &&
+			float64(requests) >= rules[RiskFlagTorExit].Threshold {
+			riskFlags = append(riskFlags, RiskFlagTorExit)
+		}
+		if ipReputation.ShareByType[IPTypeVPN] >= rules[RiskFlagVPNIP].Threshold {
+			riskFlags = append(riskFlags, RiskFlagVPNIP)
+		}
+		if ipReputation.ShareByType[IPTypeDatacenter] >= rules[RiskFlagDatacenterIP].Threshold {
+			riskFlags = append(riskFlags, RiskFlagDatacenterIP)
 		}
 	}
 
-	risk := map[string]interface{}{
-		"requests_per_minute":   requestsPerMinute,
-		"avg_quota_per_request": avgQuotaPerRequest,
-		"risk_flags":            riskFlags,
-		"ip_switch_analysis":    ipSwitchAnalysis,
+	ruleScore, ruleLevel := weights.Score(riskFlags)
+	risk := api.UserAnalysisRisk{
+		RequestsPerMinute:  requestsPerMinute,
+		LiveRPM:            liveRPM,
+		AvgQuotaPerRequest: avgQuotaPerRequest,
+		RiskFlags:          riskFlags,
+		RuleScore:          ruleScore,
+		RuleLevel:          ruleLevel,
+		IPSwitchAnalysis:   ipSwitchAnalysis,
+		IPReputation:       ipReputation,
 	}
-	if checkinAnalysisMap != nil {
-		risk["checkin_analysis"] = checkinAnalysisMap
+	if checkin != nil && checkin.CheckinCount > 0 {
+		risk.CheckinAnalysis = checkin
 	}
 
 	// Top models
 	modelsQuery := s.logDB.RebindQuery(`
 		SELECT COALESCE(model_name, 'unknown') as model_name, COUNT(*) as requests,
 			COALESCE(SUM(quota), 0) as quota_used,
-			SUM(CASE WHEN type = 2 THEN 1 ELSE 0 END) as success_requests,
-			SUM(CASE WHEN type = 5 THEN 1 ELSE 0 END) as failure_requests,
-			SUM(CASE WHEN type = 2 AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count
+			SUM(CASE WHEN type = ` + ltConsume() + ` THEN 1 ELSE 0 END) as success_requests,
+			SUM(CASE WHEN type = ` + ltError() + ` THEN 1 ELSE 0 END) as failure_requests,
+			SUM(CASE WHEN type = ` + ltConsume() + ` AND completion_tokens = 0 THEN 1 ELSE 0 END) as empty_count
 		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (2, 5)
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `)
 		GROUP BY COALESCE(model_name, 'unknown')
 		ORDER BY requests DESC
 		LIMIT 10`)
 
-	topModels, _ := s.logDB.Query(modelsQuery, userID, startTime, now)
-	if topModels == nil {
-		topModels = []map[string]interface{}{}
+	modelRows, _ := s.logDB.Query(modelsQuery, userID, startTime, now)
+	topModels := make([]api.UserTopModel, 0, len(modelRows))
+	for _, row := range modelRows {
+		topModels = append(topModels, api.UserTopModel{
+			ModelName:       toString(row["model_name"]),
+			Requests:        toInt64(row["requests"]),
+			QuotaUsed:       toInt64(row["quota_used"]),
+			SuccessRequests: toInt64(row["success_requests"]),
+			FailureRequests: toInt64(row["failure_requests"]),
+			EmptyCount:      toInt64(row["empty_count"]),
+		})
 	}
 
 	// Top channels
@@ -378,28 +471,20 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 			COUNT(*) as requests,
 			COALESCE(SUM(quota), 0) as quota_used
 		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (2, 5)
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `)
 		GROUP BY channel_id
 		ORDER BY requests DESC
 		LIMIT 10`)
 
-	topChannels, _ := s.logDB.Query(channelsQuery, userID, startTime, now)
-	if topChannels == nil {
-		topChannels = []map[string]interface{}{}
-	}
-
-	// Top IPs
-	ipsQuery := s.logDB.RebindQuery(`
-		SELECT ip, COUNT(*) as requests
-		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND ip IS NOT NULL AND ip != ''
-		GROUP BY ip
-		ORDER BY requests DESC
-		LIMIT 20`)
-
-	topIPs, _ := s.logDB.QueryWithTimeout(30*time.Second, ipsQuery, userID, startTime, now)
-	if topIPs == nil {
-		topIPs = []map[string]interface{}{}
+	channelRows, _ := s.logDB.Query(channelsQuery, userID, startTime, now)
+	topChannels := make([]api.UserTopChannel, 0, len(channelRows))
+	for _, row := range channelRows {
+		topChannels = append(topChannels, api.UserTopChannel{
+			ChannelID:   toInt64(row["channel_id"]),
+			ChannelName: toString(row["channel_name"]),
+			Requests:    toInt64(row["requests"]),
+			QuotaUsed:   toInt64(row["quota_used"]),
+		})
 	}
 
 	// Recent logs (token_name and channel_name are directly in logs table)
@@ -415,47 +500,56 @@ func (s *RiskMonitoringService) GetUserAnalysis(userID int64, windowSeconds int6
 			COALESCE(token_id, 0) as token_id,
 			COALESCE(token_name, '') as token_name
 		FROM logs
-		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (2, 5)
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ? AND type IN (` + ltRequests() + `)
 		ORDER BY id DESC
 		LIMIT 50`)
 
-	recentLogs, _ := s.logDB.Query(recentLogsQuery, userID, startTime, now)
-	if recentLogs == nil {
-		recentLogs = []map[string]interface{}{}
-	}
-
-	result := map[string]interface{}{
-		"range": map[string]interface{}{
-			"start_time":     startTime,
-			"end_time":       now,
-			"window_seconds": windowSeconds,
-		},
-		"user":         userInfo,
-		"summary":      summary,
-		"risk":         risk,
-		"top_models":   topModels,
-		"top_channels": topChannels,
-		"top_ips":      topIPs,
-		"recent_logs":  recentLogs,
+	logRows, _ := s.logDB.Query(recentLogsQuery, userID, startTime, now)
+	recentLogs := make([]api.UserRecentLog, 0, len(logRows))
+	for _, row := range logRows {
+		recentLogs = append(recentLogs, api.UserRecentLog{
+			ID:               toInt64(row["id"]),
+			CreatedAt:        toInt64(row["created_at"]),
+			Type:             toInt64(row["type"]),
+			ModelName:        toString(row["model_name"]),
+			Quota:            toInt64(row["quota"]),
+			PromptTokens:     toInt64(row["prompt_tokens"]),
+			CompletionTokens: toInt64(row["completion_tokens"]),
+			UseTime:          toInt64(row["use_time"]),
+			IP:               toString(row["ip"]),
+			ChannelID:        toInt64(row["channel_id"]),
+			ChannelName:      toString(row["channel_name"]),
+			TokenID:          toInt64(row["token_id"]),
+			TokenName:        toString(row["token_name"]),
+		})
 	}
 
-	return result, nil
+	return &api.UserAnalysis{
+		Range:       api.UserAnalysisRange{StartTime: startTime, EndTime: now, WindowSeconds: windowSeconds},
+		User:        userInfo,
+		Summary:     summary,
+		Risk:        risk,
+		TopModels:   topModels,
+		TopChannels: topChannels,
+		TopIPs:      topIPs,
+		RecentLogs:  recentLogs,
+	}, nil
 }
 
 // GetTokenRotationUsers detects token rotation behavior
-func (s *RiskMonitoringService) GetTokenRotationUsers(window string, minTokens, maxReqPerToken, limit int) (map[string]interface{}, error) {
+func (s *RiskMonitoringService) GetTokenRotationUsers(window string, minTokens, maxReqPerToken, limit int) (*api.TokenRotationList, error) {
 	seconds, ok := WindowSeconds[window]
 	if !ok {
 		seconds = 86400
 	}
 	startTime := time.Now().Unix() - seconds
 
-	cacheKey := fmt.Sprintf("risk:token_rotation:%s:%d:%d:%d", window, minTokens, maxReqPerToken, limit)
-	cm := cache.Get()
-	var cached map[string]interface{}
+	cacheKey := cache.Key("risk:token_rotation:%s:%d:%d:%d", window, minTokens, maxReqPerToken, limit)
+	cm := s.cm
+	var cached api.TokenRotationList
 	found, _ := cm.GetJSON(cacheKey, &cached)
 	if found {
-		return cached, nil
+		return &cached, nil
 	}
 
 	query := s.logDB.RebindQuery(`
@@ -463,7 +557,7 @@ func (s *RiskMonitoringService) GetTokenRotationUsers(window string, minTokens,
 			COUNT(DISTINCT l.token_id) as token_count,
 			COUNT(*) as total_requests
 		FROM logs l
-		WHERE l.created_at >= ? AND l.type IN (2, 5)
+		WHERE l.created_at >= ? AND l.type IN (` + ltRequests() + `)
 		GROUP BY l.user_id, l.username
 		HAVING COUNT(DISTINCT l.token_id) >= ?
 			AND (COUNT(*) * 1.0 / COUNT(DISTINCT l.token_id)) <= ?
@@ -475,32 +569,38 @@ func (s *RiskMonitoringService) GetTokenRotationUsers(window string, minTokens,
 		return nil, err
 	}
 
+	items := make([]api.TokenRotationUser, 0, len(rows))
 	for _, row := range rows {
-		total := toInt64(row["total_requests"])
-		tokens := toInt64(row["token_count"])
-		if tokens > 0 {
-			row["avg_requests_per_token"] = float64(total) / float64(tokens)
+		item := api.TokenRotationUser{
+			UserID:        toInt64(row["user_id"]),
+			Username:      toString(row["username"]),
+			TokenCount:    toInt64(row["token_count"]),
+			TotalRequests: toInt64(row["total_requests"]),
 		}
+		if item.TokenCount > 0 {
+			item.AvgRequestsPerToken = float64(item.TotalRequests) / float64(item.TokenCount)
+		}
+		items = append(items, item)
 	}
 
-	result := map[string]interface{}{
-		"items":  rows,
-		"total":  len(rows),
-		"window": window,
+	result := &api.TokenRotationList{
+		Items:  items,
+		Total:  len(items),
+		Window: window,
 	}
 
-	cm.Set(cacheKey, result, 5*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(5*time.Minute))
 	return result, nil
 }
 
 // GetAffiliatedAccounts detects accounts from same inviter
-func (s *RiskMonitoringService) GetAffiliatedAccounts(minInvited, limit int) (map[string]interface{}, error) {
-	cacheKey := fmt.Sprintf("risk:affiliated:%d:%d", minInvited, limit)
-	cm := cache.Get()
-	var cached map[string]interface{}
+func (s *RiskMonitoringService) GetAffiliatedAccounts(minInvited, limit int) (*api.AffiliatedAccountList, error) {
+	cacheKey := cache.Key("risk:affiliated:%d:%d", minInvited, limit)
+	cm := s.cm
+	var cached api.AffiliatedAccountList
 	found, _ := cm.GetJSON(cacheKey, &cached)
 	if found {
-		return cached, nil
+		return &cached, nil
 	}
 
 	query := s.db.RebindQuery(`
@@ -516,31 +616,35 @@ func (s *RiskMonitoringService) GetAffiliatedAccounts(minInvited, limit int) (ma
 	if err != nil {
 		return nil, err
 	}
+	items := make([]api.AffiliatedInviter, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, api.AffiliatedInviter{InviterID: toInt64(row["inviter_id"]), InvitedCount: toInt64(row["invited_count"])})
+	}
 
-	result := map[string]interface{}{
-		"items":       rows,
-		"total":       len(rows),
-		"min_invited": minInvited,
+	result := &api.AffiliatedAccountList{
+		Items:      items,
+		Total:      len(items),
+		MinInvited: minInvited,
 	}
 
-	cm.Set(cacheKey, result, 10*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(10*time.Minute))
 	return result, nil
 }
 
 // GetSameIPRegistrations detects accounts registered from same IP
-func (s *RiskMonitoringService) GetSameIPRegistrations(window string, minUsers, limit int) (map[string]interface{}, error) {
+func (s *RiskMonitoringService) GetSameIPRegistrations(window string, minUsers, limit int) (*api.SameIPRegistrationList, error) {
 	seconds, ok := WindowSeconds[window]
 	if !ok {
 		seconds = 604800
 	}
 	startTime := time.Now().Unix() - seconds
 
-	cacheKey := fmt.Sprintf("risk:same_ip:%s:%d:%d", window, minUsers, limit)
-	cm := cache.Get()
-	var cached map[string]interface{}
+	cacheKey := cache.Key("risk:same_ip:%s:%d:%d", window, minUsers, limit)
+	cm := s.cm
+	var cached api.SameIPRegistrationList
 	found, _ := cm.GetJSON(cacheKey, &cached)
 	if found {
-		return cached, nil
+		return &cached, nil
 	}
 
 	// Find IPs with first requests from multiple users
@@ -549,7 +653,7 @@ func (s *RiskMonitoringService) GetSameIPRegistrations(window string, minUsers,
 		FROM (
 			SELECT user_id, ip as first_ip
 			FROM logs
-			WHERE type IN (2, 5) AND ip IS NOT NULL AND ip != ''
+			WHERE type IN (` + ltRequests() + `) AND ip IS NOT NULL AND ip != ''
 			AND created_at >= ?
 			GROUP BY user_id, ip
 		) sub
@@ -562,15 +666,19 @@ func (s *RiskMonitoringService) GetSameIPRegistrations(window string, minUsers,
 	if err != nil {
 		return nil, err
 	}
+	items := make([]api.SameIPRegistration, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, api.SameIPRegistration{FirstIP: toString(row["first_ip"]), UserCount: toInt64(row["user_count"])})
+	}
 
-	result := map[string]interface{}{
-		"items":     rows,
-		"total":     len(rows),
-		"window":    window,
-		"min_users": minUsers,
+	result := &api.SameIPRegistrationList{
+		Items:    items,
+		Total:    len(items),
+		Window:   window,
+		MinUsers: minUsers,
 	}
 
-	cm.Set(cacheKey, result, 10*time.Minute)
+	cm.Set(cacheKey, result, scaledTTL(10*time.Minute))
 	return result, nil
 }
 
@@ -587,33 +695,32 @@ func (s *RiskMonitoringService) ListBanRecords(page, pageSize int, action string
 
 // ========== Checkin Analysis ==========
 
-var (
-	checkinTableOnce   sync.Once
-	checkinTableExists bool
-)
-
-// checkinAnalysis holds checkin anomaly detection results
-type checkinAnalysis struct {
-	CheckinCount       int64   `json:"checkin_count"`
-	TotalQuotaAwarded  int64   `json:"total_quota_awarded"`
-	RequestsPerCheckin float64 `json:"requests_per_checkin"`
+// checkinTable caches whether the checkins table exists; a failed check (e.g.
+// a request canceled mid-query) is retried on the next analysis
+var checkinTable struct {
+	sync.Mutex
+	checked bool
+	exists  bool
 }
 
 // analyzeCheckins checks for checkin abuse patterns
-func analyzeCheckins(db *database.Manager, userID int64, startTime, endTime int64) *checkinAnalysis {
-	checkinTableOnce.Do(func() {
+func analyzeCheckins(db *database.Manager, userID int64, startTime, endTime int64) *api.CheckinAnalysis {
+	checkinTable.Lock()
+	if !checkinTable.checked {
 		exists, err := db.TableExists("checkins")
 		if err != nil {
 			logger.L.Warn("检查 checkins 表失败: " + err.Error())
-			return
-		}
-		checkinTableExists = exists
-		if exists {
-			logger.L.System("checkins 表已检测到，启用签到分析")
+		} else {
+			checkinTable.checked, checkinTable.exists = true, exists
+			if exists {
+				logger.L.System("checkins 表已检测到，启用签到分析")
+			}
 		}
-	})
+	}
+	exists := checkinTable.exists
+	checkinTable.Unlock()
 
-	if !checkinTableExists {
+	if !exists {
 		return nil
 	}
 
@@ -630,7 +737,7 @@ func analyzeCheckins(db *database.Manager, userID int64, startTime, endTime int6
 	count := toInt64(row["checkin_count"])
 	quotaAwarded := toInt64(row["total_quota_awarded"])
 
-	return &checkinAnalysis{
+	return &api.CheckinAnalysis{
 		CheckinCount:      count,
 		TotalQuotaAwarded: quotaAwarded,
 	}
@@ -0,0 +1,753 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const riskPolicySettingsKey = "risk_policies"
+
+// Progressive penalty actions, in escalation order
+const (
+	RiskPenaltyWarn         = "warn"
+	RiskPenaltyRateLimit    = "rate_limit" // 仅打标记（NewAPI 无按用户限流接口），供人工或外部限流读取
+	RiskPenaltyTempBan      = "temp_ban"   // 封禁 duration_hours 小时后自动解封
+	RiskPenaltyPermanentBan = "permanent_ban"
+)
+
+// riskPenaltySeverity orders the actions; a user only moves up the ladder
+var riskPenaltySeverity = map[string]int{
+	RiskPenaltyWarn:         1,
+	RiskPenaltyRateLimit:    2,
+	RiskPenaltyTempBan:      3,
+	RiskPenaltyPermanentBan: 4,
+}
+
+// maxRiskPolicyWindowDays stays below riskFlagsKeptDays so the whole window
+// of offenses is still on record
+const maxRiskPolicyWindowDays = 30
+
+var (
+	ErrInvalidRiskPolicy   = errors.New("invalid risk policy")
+	ErrRiskPenaltyNotFound = errors.New("risk penalty not found")
+)
+
+// RiskPolicyStep is one rung of the penalty ladder
+type RiskPolicyStep struct {
+	Action        string `json:"action"`                   // warn | rate_limit | temp_ban | permanent_ban
+	MinOffenses   int    `json:"min_offenses"`             // 窗口内累计违规次数达到该值时触发
+	DurationHours int    `json:"duration_hours,omitempty"` // 仅 rate_limit / temp_ban
+}
+
+// RiskPolicySettings configures the progressive penalty engine. Offenses are
+// the high_risk_user flags recorded per user (risk_flags).
+type RiskPolicySettings struct {
+	Enabled         bool             `json:"enabled"`
+	DryRun          bool             `json:"dry_run"`
+	IntervalMinutes int              `json:"interval_minutes"`
+	WindowDays      int              `json:"window_days"` // 违规次数与已处罚等级的统计窗口
+	Steps           []RiskPolicyStep `json:"steps"`
+	UpdatedAt       int64            `json:"updated_at"`
+}
+
+// RiskPolicySettingsInput supports partial update of RiskPolicySettings
+type RiskPolicySettingsInput struct {
+	Enabled         *bool             `json:"enabled"`
+	DryRun          *bool             `json:"dry_run"`
+	IntervalMinutes *int              `json:"interval_minutes"`
+	WindowDays      *int              `json:"window_days"`
+	Steps           *[]RiskPolicyStep `json:"steps"`
+}
+
+// RiskPenalty is one recorded penalty decision
+type RiskPenalty struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Action    string `json:"action"`
+	Offenses  int64  `json:"offenses"`
+	Reason    string `json:"reason"` // 最近一次违规的风险标记
+	Applied   bool   `json:"applied"`
+	Skipped   string `json:"skipped,omitempty"` // whitelisted | admin | already_banned | not_found
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"` // 0 = 不过期
+	LiftedAt  int64  `json:"lifted_at"`
+	LiftedBy  string `json:"lifted_by,omitempty"` // expired = 到期自动解除，其余为撤销的管理员
+	Revoked   bool   `json:"revoked"`             // 管理员撤销：该用户的违规计数与等级从撤销时重新开始
+	Active    bool   `json:"active"`
+}
+
+// RiskPolicyDecision is the escalation chosen for one user in a pass
+type RiskPolicyDecision struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Offenses int64  `json:"offenses"`
+	Previous string `json:"previous,omitempty"` // 此前已到达的等级
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+	Applied  bool   `json:"applied"`
+	Skipped  string `json:"skipped,omitempty"`
+}
+
+// RiskPolicyEnforceResult summarises one evaluation pass
+type RiskPolicyEnforceResult struct {
+	DryRun     bool                 `json:"dry_run"`
+	WindowDays int                  `json:"window_days"`
+	Users      int                  `json:"users"` // 窗口内有违规记录的用户数
+	Decisions  []RiskPolicyDecision `json:"decisions"`
+	Applied    int                  `json:"applied"`
+	Lifted     int                  `json:"lifted"` // 本轮到期解除的处罚
+	Duration   int64                `json:"duration_ms"`
+}
+
+// RiskPolicyService escalates repeat offenders along the configured ladder
+// (warn → rate-limit flag → temporary ban → permanent ban) and keeps a
+// per-user penalty history.
+type RiskPolicyService struct {
+	db *database.Manager
+}
+
+// riskPolicyMu serialises evaluation passes (background vs manual)
+var riskPolicyMu sync.Mutex
+
+// NewRiskPolicyService creates a new RiskPolicyService
+func NewRiskPolicyService() *RiskPolicyService {
+	return &RiskPolicyService{db: database.Get()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *RiskPolicyService) WithContext(ctx context.Context) *RiskPolicyService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+func defaultRiskPolicySettings() RiskPolicySettings {
+	return RiskPolicySettings{
+		DryRun:          true,
+		IntervalMinutes: 10,
+		WindowDays:      30,
+		Steps: []RiskPolicyStep{
+			{Action: RiskPenaltyWarn, MinOffenses: 1},
+			{Action: RiskPenaltyRateLimit, MinOffenses: 2, DurationHours: 24},
+			{Action: RiskPenaltyTempBan, MinOffenses: 3, DurationHours: 24},
+			{Action: RiskPenaltyPermanentBan, MinOffenses: 5},
+		},
+	}
+}
+
+func normalizeRiskPolicySettings(s *RiskPolicySettings) error {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 1, 1440, 10)
+	if s.WindowDays == 0 {
+		s.WindowDays = 30
+	}
+	if s.WindowDays < 1 || s.WindowDays > maxRiskPolicyWindowDays {
+		return fmt.Errorf("%w: window_days 需在 1-%d 之间", ErrInvalidRiskPolicy, maxRiskPolicyWindowDays)
+	}
+	if len(s.Steps) == 0 || len(s.Steps) > len(riskPenaltySeverity) {
+		return fmt.Errorf("%w: steps 需包含 1-%d 级", ErrInvalidRiskPolicy, len(riskPenaltySeverity))
+	}
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		step.Action = strings.TrimSpace(step.Action)
+		severity, ok := riskPenaltySeverity[step.Action]
+		if !ok {
+			return fmt.Errorf("%w: 未知处罚 %q（warn / rate_limit / temp_ban / permanent_ban）", ErrInvalidRiskPolicy, step.Action)
+		}
+		if step.MinOffenses < 1 {
+			return fmt.Errorf("%w: min_offenses 至少为 1", ErrInvalidRiskPolicy)
+		}
+		if i > 0 {
+			prev := s.Steps[i-1]
+			if severity <= riskPenaltySeverity[prev.Action] || step.MinOffenses <= prev.MinOffenses {
+				return fmt.Errorf("%w: 各级处罚需按 warn → rate_limit → temp_ban → permanent_ban 递进，且 min_offenses 递增", ErrInvalidRiskPolicy)
+			}
+		}
+		switch step.Action {
+		case RiskPenaltyRateLimit, RiskPenaltyTempBan:
+			if step.DurationHours == 0 {
+				step.DurationHours = 24
+			}
+			if step.DurationHours < 1 || step.DurationHours > 720 {
+				return fmt.Errorf("%w: %s 的 duration_hours 需在 1-720 之间", ErrInvalidRiskPolicy, step.Action)
+			}
+		default:
+			step.DurationHours = 0
+		}
+	}
+	return nil
+}
+
+// stepFor returns the highest step reached with the given offense count
+func (s RiskPolicySettings) stepFor(offenses int64) *RiskPolicyStep {
+	var reached *RiskPolicyStep
+	for i := range s.Steps {
+		if offenses >= int64(s.Steps[i].MinOffenses) {
+			reached = &s.Steps[i]
+		}
+	}
+	return reached
+}
+
+// nextStep returns the first step above severity, or nil at the top
+func (s RiskPolicySettings) nextStep(severity int) *RiskPolicyStep {
+	for i := range s.Steps {
+		if riskPenaltySeverity[s.Steps[i].Action] > severity {
+			return &s.Steps[i]
+		}
+	}
+	return nil
+}
+
+// GetSettings returns the policy settings (defaults if never saved)
+func (s *RiskPolicyService) GetSettings(ctx context.Context) (RiskPolicySettings, error) {
+	settings := defaultRiskPolicySettings()
+	if _, err := loadLocalSetting(ctx, riskPolicySettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeRiskPolicySettings(&settings); err != nil {
+		return defaultRiskPolicySettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update; steps are replaced as a whole
+func (s *RiskPolicyService) UpdateSettings(ctx context.Context, in RiskPolicySettingsInput) (RiskPolicySettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.DryRun != nil {
+		settings.DryRun = *in.DryRun
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.WindowDays != nil {
+		settings.WindowDays = *in.WindowDays
+	}
+	if in.Steps != nil {
+		settings.Steps = append([]RiskPolicyStep(nil), (*in.Steps)...)
+	}
+	if err := normalizeRiskPolicySettings(&settings); err != nil {
+		return settings, err
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	return settings, saveLocalSetting(ctx, riskPolicySettingsKey, settings)
+}
+
+func ensureRiskPenaltyTables(ctx context.Context, db *sql.DB) error {
+	if err := ensureRiskFlagTables(ctx, db); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS risk_penalties (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL DEFAULT '',
+			offenses INTEGER NOT NULL DEFAULT 0,
+			reason TEXT NOT NULL DEFAULT '',
+			applied INTEGER NOT NULL DEFAULT 0,
+			skipped TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0,
+			expires_at INTEGER NOT NULL DEFAULT 0,
+			lifted_at INTEGER NOT NULL DEFAULT 0,
+			lifted_by TEXT NOT NULL DEFAULT '',
+			revoked INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_risk_penalties_user ON risk_penalties (user_id, created_at)`)
+	return err
+}
+
+func openRiskPenaltyStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureRiskPenaltyTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+const riskPenaltyColumns = `id, user_id, username, action, offenses, reason, applied, skipped,
+	created_at, expires_at, lifted_at, lifted_by, revoked`
+
+func scanRiskPenalty(scan func(dest ...interface{}) error, now int64) (RiskPenalty, error) {
+	var p RiskPenalty
+	var applied, revoked int
+	if err := scan(&p.ID, &p.UserID, &p.Username, &p.Action, &p.Offenses, &p.Reason, &applied, &p.Skipped,
+		&p.CreatedAt, &p.ExpiresAt, &p.LiftedAt, &p.LiftedBy, &revoked); err != nil {
+		return p, err
+	}
+	p.Applied, p.Revoked = applied == 1, revoked == 1
+	p.Active = p.Applied && p.LiftedAt == 0 && p.Action != RiskPenaltyWarn && (p.ExpiresAt == 0 || p.ExpiresAt > now)
+	return p, nil
+}
+
+// riskOffenses is one user's offense record inside the window
+type riskOffenses struct {
+	username string
+	count    int64
+	reason   string // 最近一次
+}
+
+// riskLadderState loads, per user, the offenses and the highest penalty
+// reached since max(window start, last revoke)
+func riskLadderState(ctx context.Context, store *sql.DB, since int64, userID int64) (map[int64]*riskOffenses, map[int64]int, error) {
+	filter, args := "", []interface{}{}
+	if userID > 0 {
+		filter, args = " AND user_id = ?", []interface{}{userID}
+	}
+
+	resets := map[int64]int64{}
+	rows, err := store.QueryContext(ctx, `SELECT user_id, MAX(lifted_at) FROM risk_penalties WHERE revoked = 1`+filter+` GROUP BY user_id`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var uid, at int64
+		if err := rows.Scan(&uid, &at); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		resets[uid] = at
+	}
+	rows.Close()
+
+	offenses := map[int64]*riskOffenses{}
+	rows, err = store.QueryContext(ctx, `SELECT user_id, username, reason, created_at FROM risk_flags
+		WHERE created_at >= ?`+filter+` ORDER BY created_at, id`, append([]interface{}{since}, args...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var uid, at int64
+		var username, reason string
+		if err := rows.Scan(&uid, &username, &reason, &at); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if uid <= 0 || at <= resets[uid] {
+			continue
+		}
+		o := offenses[uid]
+		if o == nil {
+			o = &riskOffenses{}
+			offenses[uid] = o
+		}
+		o.count++
+		o.reason = reason
+		if username != "" {
+			o.username = username
+		}
+	}
+	rows.Close()
+
+	levels := map[int64]int{}
+	rows, err = store.QueryContext(ctx, `SELECT user_id, action, created_at FROM risk_penalties
+		WHERE revoked = 0 AND (created_at >= ? OR action = ?)`+filter, append([]interface{}{since, RiskPenaltyPermanentBan}, args...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid, at int64
+		var action string
+		if err := rows.Scan(&uid, &action, &at); err != nil {
+			return nil, nil, err
+		}
+		if at > resets[uid] && riskPenaltySeverity[action] > levels[uid] {
+			levels[uid] = riskPenaltySeverity[action]
+		}
+	}
+	return offenses, levels, rows.Err()
+}
+
+// Enforce lifts expired penalties and escalates every user whose offense
+// count in the window reaches a step above the penalty already applied.
+// dryRun overrides the saved setting when non-nil; dry runs record nothing.
+func (s *RiskPolicyService) Enforce(ctx context.Context, dryRun *bool) (*RiskPolicyEnforceResult, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun != nil {
+		settings.DryRun = *dryRun
+	}
+
+	riskPolicyMu.Lock()
+	defer riskPolicyMu.Unlock()
+
+	start := time.Now()
+	result := &RiskPolicyEnforceResult{DryRun: settings.DryRun, WindowDays: settings.WindowDays, Decisions: []RiskPolicyDecision{}}
+	store, err := openRiskPenaltyStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	if !settings.DryRun {
+		if result.Lifted, err = s.liftExpired(ctx, store); err != nil {
+			return nil, err
+		}
+	}
+
+	since := start.Unix() - int64(settings.WindowDays)*86400
+	offenses, levels, err := riskLadderState(ctx, store, since, 0)
+	if err != nil {
+		return nil, err
+	}
+	result.Users = len(offenses)
+	for uid, o := range offenses {
+		step := settings.stepFor(o.count)
+		if step == nil || riskPenaltySeverity[step.Action] <= levels[uid] {
+			continue
+		}
+		d := RiskPolicyDecision{UserID: uid, Username: o.username, Offenses: o.count, Action: step.Action, Reason: o.reason}
+		for action, severity := range riskPenaltySeverity {
+			if severity == levels[uid] {
+				d.Previous = action
+			}
+		}
+		result.Decisions = append(result.Decisions, d)
+	}
+	sort.Slice(result.Decisions, func(i, j int) bool { return result.Decisions[i].UserID < result.Decisions[j].UserID })
+
+	if err := s.applyDecisions(ctx, store, settings, result); err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(start).Milliseconds()
+
+	PublishEvent(EventScanFinished, map[string]interface{}{
+		"scanner": "risk_policy",
+		"dry_run": result.DryRun,
+		"hits":    len(result.Decisions),
+		"applied": result.Applied,
+	})
+	return result, nil
+}
+
+// applyDecisions marks whitelisted / admin / already banned users and,
+// outside dry run, applies and records every decision. Skipped decisions are
+// recorded too so the same rung is not re-evaluated every pass.
+func (s *RiskPolicyService) applyDecisions(ctx context.Context, store *sql.DB, settings RiskPolicySettings, result *RiskPolicyEnforceResult) error {
+	if len(result.Decisions) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, 0, len(result.Decisions))
+	userIDs := make([]int64, 0, len(result.Decisions))
+	for _, d := range result.Decisions {
+		ids = append(ids, d.UserID)
+		userIDs = append(userIDs, d.UserID)
+	}
+	whitelisted, err := whitelistedUsers(s.db.WithContext(ctx), userIDs, 5)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf(
+		"SELECT id, role, status FROM users WHERE id IN (%s)", buildPlaceholders(s.db.IsPG, len(ids), 1))), ids...)
+	if err != nil {
+		return err
+	}
+	users := make(map[int64]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		users[toInt64(row["id"])] = row
+	}
+
+	um := NewUserManagementService()
+	durations := map[string]int{}
+	for _, step := range settings.Steps {
+		durations[step.Action] = step.DurationHours
+	}
+	for i := range result.Decisions {
+		d := &result.Decisions[i]
+		user := users[d.UserID]
+		isBan := d.Action == RiskPenaltyTempBan || d.Action == RiskPenaltyPermanentBan
+		switch {
+		case user == nil:
+			d.Skipped = "not_found"
+		case whitelisted[d.UserID] != "":
+			d.Skipped = "whitelisted"
+		case toInt64(user["role"]) >= RoleAdminUser:
+			d.Skipped = "admin"
+		case isBan && toInt64(user["status"]) != 1:
+			d.Skipped = "already_banned"
+		}
+		if settings.DryRun {
+			continue
+		}
+		if d.Skipped == "" && isBan {
+			if err := um.BanUser(d.UserID, false); err != nil {
+				d.Skipped = err.Error()
+				continue // 未落库，下一轮重试
+			}
+		}
+		d.Applied = d.Skipped == ""
+
+		now := time.Now().Unix()
+		var expiresAt int64
+		if d.Applied && durations[d.Action] > 0 {
+			expiresAt = now + int64(durations[d.Action])*3600
+		}
+		if _, err := store.ExecContext(ctx, `
+			INSERT INTO risk_penalties (user_id, username, action, offenses, reason, applied, skipped, created_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.UserID, d.Username, d.Action, d.Offenses, d.Reason, boolToInt(d.Applied), d.Skipped, now, expiresAt); err != nil {
+			return err
+		}
+		if !d.Applied {
+			continue
+		}
+		result.Applied++
+		logger.L.Security(fmt.Sprintf("[处罚策略] 用户 %d (%s) %s | 窗口内违规 %d 次 | 最近: %s",
+			d.UserID, d.Username, d.Action, d.Offenses, d.Reason))
+		PublishEvent(EventRiskPenalty, map[string]interface{}{
+			"user_id":    d.UserID,
+			"username":   d.Username,
+			"action":     d.Action,
+			"offenses":   d.Offenses,
+			"expires_at": expiresAt,
+		})
+	}
+	return nil
+}
+
+// LiftExpired ends the rate-limit flags and temporary bans past their expiry
+func (s *RiskPolicyService) LiftExpired(ctx context.Context) (int, error) {
+	store, err := openRiskPenaltyStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	riskPolicyMu.Lock()
+	defer riskPolicyMu.Unlock()
+	return s.liftExpired(ctx, store)
+}
+
+func (s *RiskPolicyService) liftExpired(ctx context.Context, store *sql.DB) (int, error) {
+	now := time.Now().Unix()
+	rows, err := store.QueryContext(ctx, `SELECT `+riskPenaltyColumns+` FROM risk_penalties
+		WHERE applied = 1 AND lifted_at = 0 AND expires_at > 0 AND expires_at <= ? ORDER BY id`, now)
+	if err != nil {
+		return 0, err
+	}
+	var expired []RiskPenalty
+	for rows.Next() {
+		p, err := scanRiskPenalty(rows.Scan, now)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, p)
+	}
+	rows.Close()
+
+	lifted := 0
+	for _, p := range expired {
+		if err := s.liftExpiredOne(ctx, store, p, now); err != nil {
+			logger.L.Warn(fmt.Sprintf("[处罚策略] 解除 #%d 失败: %v", p.ID, err))
+			continue
+		}
+		lifted++
+	}
+	return lifted, nil
+}
+
+// liftExpiredOne ends one expired penalty; a temporary ban is only undone
+// when no other ban of the same user is still in force
+func (s *RiskPolicyService) liftExpiredOne(ctx context.Context, store *sql.DB, p RiskPenalty, now int64) error {
+	if p.Action == RiskPenaltyTempBan {
+		var others int
+		if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM risk_penalties
+			WHERE user_id = ? AND id <> ? AND applied = 1 AND lifted_at = 0 AND action IN (?, ?) AND (expires_at = 0 OR expires_at > ?)`,
+			p.UserID, p.ID, RiskPenaltyTempBan, RiskPenaltyPermanentBan, now).Scan(&others); err != nil {
+			return err
+		}
+		if others == 0 {
+			if err := NewUserManagementService().UnbanUser(p.UserID, false); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := store.ExecContext(ctx, `UPDATE risk_penalties SET lifted_at = ?, lifted_by = 'expired' WHERE id = ?`, now, p.ID); err != nil {
+		return err
+	}
+	logger.L.Security(fmt.Sprintf("[处罚策略] 用户 %d 的 %s (#%d) 已到期解除", p.UserID, p.Action, p.ID))
+	return nil
+}
+
+// Revoke lifts a penalty on operator request (e.g. a false positive), ends
+// the user's other penalties still in force and restarts that user's offense
+// count and ladder from now
+func (s *RiskPolicyService) Revoke(ctx context.Context, id int64, operator string) (RiskPenalty, error) {
+	store, err := openRiskPenaltyStore(ctx)
+	if err != nil {
+		return RiskPenalty{}, err
+	}
+	defer store.Close()
+	riskPolicyMu.Lock()
+	defer riskPolicyMu.Unlock()
+
+	now := time.Now().Unix()
+	p, err := scanRiskPenalty(store.QueryRowContext(ctx, `SELECT `+riskPenaltyColumns+` FROM risk_penalties WHERE id = ?`, id).Scan, now)
+	if err == sql.ErrNoRows {
+		return p, ErrRiskPenaltyNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+	if operator == "" {
+		operator = "admin"
+	}
+
+	var banned int
+	if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM risk_penalties
+		WHERE user_id = ? AND applied = 1 AND lifted_at = 0 AND action IN (?, ?)`,
+		p.UserID, RiskPenaltyTempBan, RiskPenaltyPermanentBan).Scan(&banned); err != nil {
+		return p, err
+	}
+	if banned > 0 {
+		if err := NewUserManagementService().UnbanUser(p.UserID, false); err != nil {
+			return p, err
+		}
+	}
+	if _, err := store.ExecContext(ctx, `UPDATE risk_penalties SET lifted_at = ?, lifted_by = ? WHERE user_id = ? AND lifted_at = 0`,
+		now, operator, p.UserID); err != nil {
+		return p, err
+	}
+	// 撤销时间即该用户的计数重置点，已到期的处罚也记为此刻
+	if _, err := store.ExecContext(ctx, `UPDATE risk_penalties SET lifted_at = ?, lifted_by = ?, revoked = 1 WHERE id = ?`,
+		now, operator, id); err != nil {
+		return p, err
+	}
+	logger.L.Security(fmt.Sprintf("[处罚策略] %s 撤销用户 %d 的 %s (#%d)，违规计数重新开始", operator, p.UserID, p.Action, id))
+	return scanRiskPenalty(store.QueryRowContext(ctx, `SELECT `+riskPenaltyColumns+` FROM risk_penalties WHERE id = ?`, id).Scan, now)
+}
+
+// ListPenalties returns penalty records, newest first. userID 0 = all users;
+// activeOnly keeps rate-limit flags and bans still in force.
+func (s *RiskPolicyService) ListPenalties(ctx context.Context, userID int64, action string, activeOnly bool, limit, offset int) ([]RiskPenalty, int64, error) {
+	store, err := openRiskPenaltyStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer store.Close()
+
+	now := time.Now().Unix()
+	where, args := " WHERE 1 = 1", []interface{}{}
+	if userID > 0 {
+		where += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if action != "" {
+		if _, ok := riskPenaltySeverity[action]; !ok {
+			return nil, 0, fmt.Errorf("%w: 未知处罚 %q", ErrInvalidRiskPolicy, action)
+		}
+		where += " AND action = ?"
+		args = append(args, action)
+	}
+	if activeOnly {
+		where += " AND applied = 1 AND lifted_at = 0 AND action <> ? AND (expires_at = 0 OR expires_at > ?)"
+		args = append(args, RiskPenaltyWarn, now)
+	}
+
+	var total int64
+	if err := store.QueryRowContext(ctx, `SELECT COUNT(*) FROM risk_penalties`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.QueryContext(ctx, `SELECT `+riskPenaltyColumns+` FROM risk_penalties`+where+
+		` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items := []RiskPenalty{}
+	for rows.Next() {
+		p, err := scanRiskPenalty(rows.Scan, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, p)
+	}
+	return items, total, rows.Err()
+}
+
+// UserPenalties summarises one user's position on the ladder: offenses in
+// the window, the rung reached, the next rung and the penalty history
+func (s *RiskPolicyService) UserPenalties(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openRiskPenaltyStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Unix() - int64(settings.WindowDays)*86400
+	offenses, levels, err := riskLadderState(ctx, store, since, userID)
+	store.Close()
+	if err != nil {
+		return nil, err
+	}
+	history, total, err := s.ListPenalties(ctx, userID, "", false, 100, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if o := offenses[userID]; o != nil {
+		count = o.count
+	}
+	level := ""
+	for action, severity := range riskPenaltySeverity {
+		if severity == levels[userID] {
+			level = action
+		}
+	}
+	rateLimited, bannedUntil := false, int64(-1) // -1 = 未被本策略封禁，0 = 永久
+	for _, p := range history {
+		if !p.Active {
+			continue
+		}
+		switch p.Action {
+		case RiskPenaltyRateLimit:
+			rateLimited = true
+		case RiskPenaltyPermanentBan:
+			bannedUntil = 0
+		case RiskPenaltyTempBan:
+			if bannedUntil != 0 && p.ExpiresAt > bannedUntil {
+				bannedUntil = p.ExpiresAt
+			}
+		}
+	}
+	data := map[string]interface{}{
+		"user_id":       userID,
+		"window_days":   settings.WindowDays,
+		"offenses":      count,
+		"level":         level,
+		"rate_limited":  rateLimited,
+		"banned_until":  bannedUntil,
+		"history":       history,
+		"history_total": total,
+	}
+	if next := settings.nextStep(levels[userID]); next != nil {
+		data["next_action"] = next.Action
+		data["next_at_offenses"] = next.MinOffenses
+	}
+	return data, nil
+}
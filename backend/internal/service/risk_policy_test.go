@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestNormalizeRiskPolicySettingsRequiresEscalation(t *testing.T) {
+	s := defaultRiskPolicySettings()
+	if err := normalizeRiskPolicySettings(&s); err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+
+	bad := []RiskPolicySettings{
+		{Steps: []RiskPolicyStep{{Action: "mute", MinOffenses: 1}}},
+		{Steps: []RiskPolicyStep{{Action: RiskPenaltyTempBan, MinOffenses: 2}, {Action: RiskPenaltyWarn, MinOffenses: 3}}},
+		{Steps: []RiskPolicyStep{{Action: RiskPenaltyWarn, MinOffenses: 2}, {Action: RiskPenaltyTempBan, MinOffenses: 2}}},
+		{WindowDays: 60, Steps: []RiskPolicyStep{{Action: RiskPenaltyWarn, MinOffenses: 1}}},
+		{Steps: []RiskPolicyStep{{Action: RiskPenaltyTempBan, MinOffenses: 1, DurationHours: 1000}}},
+	}
+	for i, s := range bad {
+		if err := normalizeRiskPolicySettings(&s); !errors.Is(err, ErrInvalidRiskPolicy) {
+			t.Errorf("case %d: expected ErrInvalidRiskPolicy, got %v", i, err)
+		}
+	}
+
+	s = RiskPolicySettings{Steps: []RiskPolicyStep{{Action: RiskPenaltyTempBan, MinOffenses: 1}, {Action: RiskPenaltyPermanentBan, MinOffenses: 2, DurationHours: 5}}}
+	if err := normalizeRiskPolicySettings(&s); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if s.Steps[0].DurationHours != 24 || s.Steps[1].DurationHours != 0 {
+		t.Fatalf("durations not normalised: %+v", s.Steps)
+	}
+	if step := s.stepFor(0); step != nil {
+		t.Fatalf("no step expected below the first rung, got %+v", step)
+	}
+	if step := s.stepFor(7); step == nil || step.Action != RiskPenaltyPermanentBan {
+		t.Fatalf("stepFor(7) = %+v", step)
+	}
+	if next := s.nextStep(riskPenaltySeverity[RiskPenaltyTempBan]); next == nil || next.Action != RiskPenaltyPermanentBan {
+		t.Fatalf("nextStep after temp_ban = %+v", next)
+	}
+}
+
+func TestRiskPolicyEnforceEscalatesAndRevokeResets(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role INTEGER, status INTEGER);
+		INSERT INTO users VALUES (1, 'alice', 1, 1), (2, 'root', 100, 1);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	ctx := context.Background()
+	svc := NewRiskPolicyService()
+	enabled, dryRun := true, false
+	steps := []RiskPolicyStep{
+		{Action: RiskPenaltyWarn, MinOffenses: 1},
+		{Action: RiskPenaltyTempBan, MinOffenses: 2, DurationHours: 24},
+	}
+	if _, err := svc.UpdateSettings(ctx, RiskPolicySettingsInput{Enabled: &enabled, DryRun: &dryRun, Steps: &steps}); err != nil {
+		t.Fatalf("update settings: %v", err)
+	}
+
+	store, err := openRiskPenaltyStore(ctx)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	defer store.Close()
+	flag := func(uid int64, at int64) {
+		t.Helper()
+		if _, err := store.Exec(`INSERT INTO risk_flags (user_id, username, reason, created_at) VALUES (?, '', 'high_rpm', ?)`, uid, at); err != nil {
+			t.Fatalf("seed flag: %v", err)
+		}
+	}
+	now := time.Now().Unix()
+	flag(1, now-300)
+	flag(2, now-300)
+	flag(2, now-200)
+
+	result, err := svc.Enforce(ctx, nil)
+	if err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	if len(result.Decisions) != 2 || result.Applied != 1 {
+		t.Fatalf("expected warn for user 1 and skipped admin, got %+v", result)
+	}
+	if d := result.Decisions[1]; d.UserID != 2 || d.Skipped != "admin" || d.Applied {
+		t.Fatalf("admin should be skipped: %+v", d)
+	}
+
+	// Same offense count again: nothing new to apply
+	if result, err = svc.Enforce(ctx, nil); err != nil || len(result.Decisions) != 0 {
+		t.Fatalf("second pass should be a no-op: %+v %v", result, err)
+	}
+
+	// A second offense escalates straight to the temporary ban
+	flag(1, now-100)
+	if result, err = svc.Enforce(ctx, nil); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	if len(result.Decisions) != 1 || result.Decisions[0].Action != RiskPenaltyTempBan || result.Decisions[0].Previous != RiskPenaltyWarn {
+		t.Fatalf("expected temp_ban after warn, got %+v", result.Decisions)
+	}
+	var status int
+	if err := db.Get(&status, `SELECT status FROM users WHERE id = 1`); err != nil || status != 2 {
+		t.Fatalf("user should be banned, status=%d err=%v", status, err)
+	}
+
+	summary, err := svc.UserPenalties(ctx, 1)
+	if err != nil {
+		t.Fatalf("user penalties: %v", err)
+	}
+	if summary["offenses"].(int64) != 2 || summary["level"] != RiskPenaltyTempBan || summary["banned_until"].(int64) <= now {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	history, _, err := svc.ListPenalties(ctx, 1, RiskPenaltyTempBan, true, 10, 0)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("active temp_ban not listed: %+v %v", history, err)
+	}
+	if _, err := svc.Revoke(ctx, history[0].ID, "tester"); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := db.Get(&status, `SELECT status FROM users WHERE id = 1`); err != nil || status != 1 {
+		t.Fatalf("user should be unbanned, status=%d err=%v", status, err)
+	}
+	summary, err = svc.UserPenalties(ctx, 1)
+	if err != nil {
+		t.Fatalf("user penalties: %v", err)
+	}
+	if summary["offenses"].(int64) != 0 || summary["level"] != "" {
+		t.Fatalf("revoke should reset the ladder: %+v", summary)
+	}
+	if _, err := svc.Revoke(ctx, 9999, "tester"); !errors.Is(err, ErrRiskPenaltyNotFound) {
+		t.Fatalf("expected ErrRiskPenaltyNotFound, got %v", err)
+	}
+}
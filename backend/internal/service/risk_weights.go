@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+const riskWeightsSettingsKey = "risk_weights"
+
+var ErrInvalidRiskWeights = errors.New("invalid risk weights")
+
+// Risk flags raised by GetUserAnalysis
+const (
+	RiskFlagHighRPM         = "HIGH_RPM"
+	RiskFlagManyIPs         = "MANY_IPS"
+	RiskFlagHighFailureRate = "HIGH_FAILURE_RATE"
+	RiskFlagIPRapidSwitch   = "IP_RAPID_SWITCH"
+	RiskFlagIPHopping       = "IP_HOPPING"
+	RiskFlagCheckinAnomaly  = "CHECKIN_ANOMALY"
+	RiskFlagTorExit         = "TOR_EXIT"
+	RiskFlagVPNIP           = "VPN_IP"
+	RiskFlagDatacenterIP    = "DATACENTER_IP"
+)
+
+// RiskRule is the threshold that raises one flag and the points it adds to
+// the risk score. Points 0 keeps the flag but does not score it.
+type RiskRule struct {
+	Threshold float64 `json:"threshold"`
+	Points    int     `json:"points"`
+}
+
+// RiskWeights configures the risk flags of the user analysis and the AI-ban
+// candidate scan. Rule thresholds:
+//
+//	HIGH_RPM           每分钟请求数 >
+//	MANY_IPS           窗口内不同 IP 数 >
+//	HIGH_FAILURE_RATE  失败率（%）>=，且请求数 >= failure_min_requests
+//	IP_RAPID_SWITCH    平均 IP 停留秒数 <，且快速切换次数 >= switch_min_count
+//	IP_HOPPING         平均 IP 停留秒数 <，且真实切换次数 >= switch_min_count
+//	CHECKIN_ANOMALY    每次签到对应请求数 <，且签到次数 > checkin_min_count
+//	TOR_EXIT           Tor 出口请求数 >=
+//	VPN_IP             VPN 请求占比（%）>=
+//	DATACENTER_IP      机房请求占比（%）>=
+type RiskWeights struct {
+	Rules                 map[string]RiskRule `json:"rules"`
+	FailureMinRequests    int64               `json:"failure_min_requests"`
+	SwitchMinCount        int64               `json:"switch_min_count"`
+	CheckinMinCount       int64               `json:"checkin_min_count"`
+	SuspiciousMinRequests int                 `json:"suspicious_min_requests"` // AI 封禁候选用户的最少请求数
+	MediumScore           int                 `json:"medium_score"`            // rule_level 分档
+	HighScore             int                 `json:"high_score"`
+	UpdatedAt             int64               `json:"updated_at"`
+}
+
+// RiskWeightsInput is a partial update; rules are merged per flag
+type RiskWeightsInput struct {
+	Rules                 map[string]RiskRule `json:"rules"`
+	FailureMinRequests    *int64              `json:"failure_min_requests"`
+	SwitchMinCount        *int64              `json:"switch_min_count"`
+	CheckinMinCount       *int64              `json:"checkin_min_count"`
+	SuspiciousMinRequests *int                `json:"suspicious_min_requests"`
+	MediumScore           *int                `json:"medium_score"`
+	HighScore             *int                `json:"high_score"`
+}
+
+// DefaultRiskWeights keeps the thresholds that used to be hard-coded
+func DefaultRiskWeights() RiskWeights {
+	return RiskWeights{
+		Rules: map[string]RiskRule{
+			RiskFlagHighRPM:         {Threshold: 5, Points: 20},
+			RiskFlagManyIPs:         {Threshold: 10, Points: 25},
+			RiskFlagHighFailureRate: {Threshold: 50, Points: 15},
+			RiskFlagIPRapidSwitch:   {Threshold: 300, Points: 15},
+			RiskFlagIPHopping:       {Threshold: 30, Points: 25},
+			RiskFlagCheckinAnomaly:  {Threshold: 5, Points: 10},
+			RiskFlagTorExit:         {Threshold: 1, Points: 30},
+			RiskFlagVPNIP:           {Threshold: 50, Points: 10},
+			RiskFlagDatacenterIP:    {Threshold: 50, Points: 15},
+		},
+		FailureMinRequests:    10,
+		SwitchMinCount:        3,
+		CheckinMinCount:       3,
+		SuspiciousMinRequests: 10,
+		MediumScore:           30,
+		HighScore:             60,
+	}
+}
+
+// riskWeightsCache avoids a local store read per analysis; updates replace it
+var riskWeightsCache struct {
+	sync.Mutex
+	loaded  bool
+	weights RiskWeights
+}
+
+func normalizeRiskWeights(w *RiskWeights) error {
+	defaults := DefaultRiskWeights()
+	for flag, rule := range w.Rules {
+		if _, ok := defaults.Rules[flag]; !ok {
+			return fmt.Errorf("%w: 未知的风险标签 %s", ErrInvalidRiskWeights, flag)
+		}
+		if rule.Threshold < 0 || rule.Points < 0 || rule.Points > 100 {
+			return fmt.Errorf("%w: %s 的 threshold 不能为负，points 需在 0-100 之间", ErrInvalidRiskWeights, flag)
+		}
+	}
+	for flag, rule := range defaults.Rules {
+		if _, ok := w.Rules[flag]; !ok {
+			w.Rules[flag] = rule
+		}
+	}
+	for _, share := range []string{RiskFlagHighFailureRate, RiskFlagVPNIP, RiskFlagDatacenterIP} {
+		if w.Rules[share].Threshold > 100 {
+			return fmt.Errorf("%w: %s 的 threshold 为百分比，需在 0-100 之间", ErrInvalidRiskWeights, share)
+		}
+	}
+	if w.FailureMinRequests < 0 || w.SwitchMinCount < 0 || w.CheckinMinCount < 0 || w.SuspiciousMinRequests < 1 {
+		return fmt.Errorf("%w: 最少次数不能为负（suspicious_min_requests 至少为 1）", ErrInvalidRiskWeights)
+	}
+	if w.MediumScore < 1 || w.HighScore <= w.MediumScore || w.HighScore > 100 {
+		return fmt.Errorf("%w: 需满足 1 <= medium_score < high_score <= 100", ErrInvalidRiskWeights)
+	}
+	return nil
+}
+
+// GetRiskWeights returns the risk weights (defaults if never saved)
+func GetRiskWeights(ctx context.Context) (RiskWeights, error) {
+	riskWeightsCache.Lock()
+	defer riskWeightsCache.Unlock()
+	if riskWeightsCache.loaded {
+		return riskWeightsCache.weights.clone(), nil
+	}
+	weights := DefaultRiskWeights()
+	if _, err := loadLocalSetting(ctx, riskWeightsSettingsKey, &weights); err != nil {
+		return DefaultRiskWeights(), err
+	}
+	if weights.Rules == nil {
+		weights.Rules = map[string]RiskRule{}
+	}
+	if err := normalizeRiskWeights(&weights); err != nil {
+		weights = DefaultRiskWeights()
+	}
+	riskWeightsCache.weights, riskWeightsCache.loaded = weights, true
+	return weights.clone(), nil
+}
+
+// currentRiskWeights is GetRiskWeights for scoring paths: a store error falls
+// back to the defaults rather than failing the analysis
+func currentRiskWeights(ctx context.Context) RiskWeights {
+	weights, _ := GetRiskWeights(ctx)
+	return weights
+}
+
+// UpdateRiskWeights applies a partial update
+func UpdateRiskWeights(ctx context.Context, in RiskWeightsInput) (RiskWeights, error) {
+	weights, err := GetRiskWeights(ctx)
+	if err != nil {
+		return weights, err
+	}
+	if err := mergeRiskWeights(&weights, in); err != nil {
+		return weights, err
+	}
+	weights.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, riskWeightsSettingsKey, weights); err != nil {
+		return weights, err
+	}
+	riskWeightsCache.Lock()
+	riskWeightsCache.weights, riskWeightsCache.loaded = weights.clone(), true
+	riskWeightsCache.Unlock()
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("ai_ban:suspicious:"))
+	return weights, nil
+}
+
+// mergeRiskWeights applies in onto w and validates the result
+func mergeRiskWeights(w *RiskWeights, in RiskWeightsInput) error {
+	for flag, rule := range in.Rules {
+		w.Rules[flag] = rule
+	}
+	if in.FailureMinRequests != nil {
+		w.FailureMinRequests = *in.FailureMinRequests
+	}
+	if in.SwitchMinCount != nil {
+		w.SwitchMinCount = *in.SwitchMinCount
+	}
+	if in.CheckinMinCount != nil {
+		w.CheckinMinCount = *in.CheckinMinCount
+	}
+	if in.SuspiciousMinRequests != nil {
+		w.SuspiciousMinRequests = *in.SuspiciousMinRequests
+	}
+	if in.MediumScore != nil {
+		w.MediumScore = *in.MediumScore
+	}
+	if in.HighScore != nil {
+		w.HighScore = *in.HighScore
+	}
+	return normalizeRiskWeights(w)
+}
+
+func (w RiskWeights) clone() RiskWeights {
+	rules := make(map[string]RiskRule, len(w.Rules))
+	for k, v := range w.Rules {
+		rules[k] = v
+	}
+	w.Rules = rules
+	return w
+}
+
+// Score sums the points of flags (capped at 100) and maps it to a level.
+// This is the rule_score of analyses, separate from the AI's 0-10 risk_score.
+func (w RiskWeights) Score(flags []string) (int, string) {
+	score := 0
+	for _, flag := range flags {
+		score += w.Rules[flag].Points
+	}
+	score = min(score, 100)
+	switch {
+	case score >= w.HighScore:
+		return score, "high"
+	case score >= w.MediumScore:
+		return score, "medium"
+	case score > 0:
+		return score, "low"
+	}
+	return score, "none"
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func resetRiskWeightsCache(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		riskWeightsCache.Lock()
+		riskWeightsCache.loaded = false
+		riskWeightsCache.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestRiskWeightsUpdate(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	resetRiskWeightsCache(t)
+	ctx := context.Background()
+
+	weights, err := GetRiskWeights(ctx)
+	if err != nil || weights.Rules[RiskFlagManyIPs].Threshold != 10 || weights.SuspiciousMinRequests != 10 {
+		t.Fatalf("defaults: %+v %v", weights, err)
+	}
+
+	bad := []RiskWeightsInput{
+		{Rules: map[string]RiskRule{"UNKNOWN": {Threshold: 1, Points: 1}}},
+		{Rules: map[string]RiskRule{RiskFlagVPNIP: {Threshold: 150, Points: 10}}},
+		{Rules: map[string]RiskRule{RiskFlagHighRPM: {Threshold: 5, Points: 101}}},
+	}
+	high := 20
+	bad = append(bad, RiskWeightsInput{HighScore: &high}) // below medium_score
+	for i, in := range bad {
+		if _, err := UpdateRiskWeights(ctx, in); !errors.Is(err, ErrInvalidRiskWeights) {
+			t.Errorf("case %d should be rejected, got %v", i, err)
+		}
+	}
+
+	minReq := 50
+	weights, err = UpdateRiskWeights(ctx, RiskWeightsInput{
+		Rules:                 map[string]RiskRule{RiskFlagManyIPs: {Threshold: 20, Points: 40}},
+		SuspiciousMinRequests: &minReq,
+	})
+	if err != nil || weights.Rules[RiskFlagManyIPs].Points != 40 || weights.Rules[RiskFlagHighRPM].Points != 20 {
+		t.Fatalf("rules should merge per flag: %+v %v", weights.Rules, err)
+	}
+
+	// Reload from the local store rather than the cache
+	resetRiskWeightsCache(t)
+	if reloaded, _ := GetRiskWeights(ctx); reloaded.Rules[RiskFlagManyIPs].Threshold != 20 || reloaded.SuspiciousMinRequests != 50 {
+		t.Fatalf("weights not persisted: %+v", reloaded)
+	}
+}
+
+func TestRiskWeightsScore(t *testing.T) {
+	w := DefaultRiskWeights()
+	cases := []struct {
+		flags []string
+		score int
+		level string
+	}{
+		{nil, 0, "none"},
+		{[]string{RiskFlagVPNIP}, 10, "low"},
+		{[]string{RiskFlagManyIPs, RiskFlagVPNIP}, 35, "medium"},
+		{[]string{RiskFlagTorExit, RiskFlagIPHopping, RiskFlagManyIPs, RiskFlagHighRPM}, 100, "high"},
+	}
+	for _, c := range cases {
+		if score, level := w.Score(c.flags); score != c.score || level != c.level {
+			t.Errorf("%v: got %d/%s, want %d/%s", c.flags, score, level, c.score, c.level)
+		}
+	}
+}
+
+// TestSuspiciousUsersUseRiskWeights 验证 AI 封禁候选扫描使用配置的最少请求数与失败率阈值。
+func TestSuspiciousUsersUseRiskWeights(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	installIPMonitoringSchema(t)
+	resetRiskWeightsCache(t)
+	ctx := context.Background()
+	db := database.Get()
+	if _, err := db.Execute(`ALTER TABLE logs ADD COLUMN quota INTEGER DEFAULT 0`); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	insert := func(userID int64, typ, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := db.Execute(`INSERT INTO logs (user_id, created_at, type, ip, username, model_name) VALUES (?, ?, ?, '10.0.0.1', ?, 'gpt')`,
+				userID, now-int64(i), typ, "u"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	insert(1, 2, 6) // 12 requests, 50% failures
+	insert(1, 5, 6)
+	insert(2, 2, 5) // below the default minimum of 10
+
+	rows, err := NewAIAutoBanService().GetSuspiciousUsers("1h", 10)
+	if err != nil || len(rows) != 1 || rows[0].UserID != 1 {
+		t.Fatalf("rows: %v %v", rows, err)
+	}
+	if flags := rows[0].RiskFlags; len(flags) == 0 || flags[0] != RiskFlagHighFailureRate || rows[0].RuleScore == 0 {
+		t.Fatalf("expected HIGH_FAILURE_RATE with a score, got %v", rows[0])
+	}
+
+	minReq := 20
+	if _, err := UpdateRiskWeights(ctx, RiskWeightsInput{SuspiciousMinRequests: &minReq}); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := NewAIAutoBanService().GetSuspiciousUsers("1h", 10); err != nil || len(rows) != 0 {
+		t.Fatalf("raised minimum should drop the user: %v %v", rows, err)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const roleExclusionKey = "role_exclusion"
+
+// NewAPI user roles
+const (
+	RoleCommonUser = 1
+	RoleAdminUser  = 10
+	RoleRootUser   = 100
+)
+
+// roleExclusionRefresh is how long the excluded user IDs are reused
+const roleExclusionRefresh = 5 * time.Minute
+
+// roleExclusionCachePrefixes are the cached rankings that depend on the exclusion
+var roleExclusionCachePrefixes = []string{
+	"risk:leaderboards:",
+	"ai_ban:suspicious:",
+	"dashboard:topusers:",
+	"analytics:user_request_ranking",
+	"analytics:user_quota_ranking",
+	"tokens:top:",
+}
+
+// RoleExclusionSettings keeps admin / root maintenance traffic out of
+// leaderboards, suspicious-user selection and dashboard rankings
+type RoleExclusionSettings struct {
+	Enabled   bool  `json:"enabled"`
+	MinRole   int   `json:"min_role"` // role >= min_role 的账号被排除（10 = 管理员，100 = 超级管理员）
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// excludedIDs is the resolved ID list of one database
+type excludedIDs struct {
+	ids       []int64
+	fetchedAt time.Time
+}
+
+var roleExclusion struct {
+	sync.Mutex
+	loaded   bool
+	settings RoleExclusionSettings
+	byDB     map[*sqlx.DB]excludedIDs // 每个实例的用户 ID 不同，按主库连接分别缓存
+}
+
+func defaultRoleExclusionSettings() RoleExclusionSettings {
+	return RoleExclusionSettings{Enabled: true, MinRole: RoleAdminUser}
+}
+
+func loadRoleExclusionSettings(ctx context.Context) (RoleExclusionSettings, error) {
+	s := defaultRoleExclusionSettings()
+	_, err := loadLocalSetting(ctx, roleExclusionKey, &s)
+	if s.MinRole < 1 {
+		s.MinRole = RoleAdminUser
+	}
+	return s, err
+}
+
+// resetRoleExclusion drops the in-memory state and the rankings cached with
+// the old exclusion, so a settings change applies immediately
+func resetRoleExclusion() {
+	roleExclusion.Lock()
+	roleExclusion.loaded, roleExclusion.byDB = false, nil
+	roleExclusion.Unlock()
+	for _, prefix := range roleExclusionCachePrefixes {
+		cache.Get().DeleteByPrefix(cache.Key("%s", prefix))
+	}
+}
+
+// excludedUserIDs returns the IDs of db's accounts whose role is at or
+// above the configured minimum, or nil when the exclusion is off. Failures
+// are logged and treated as "exclude nobody" so rankings never break over it.
+func excludedUserIDs(db *database.Manager) []int64 {
+	if db == nil || db.DB == nil {
+		return nil
+	}
+	roleExclusion.Lock()
+	defer roleExclusion.Unlock()
+	if !roleExclusion.loaded {
+		s, err := loadRoleExclusionSettings(context.Background())
+		if err != nil {
+			logger.L.Warn("[角色排除] 读取配置失败: " + err.Error())
+		}
+		roleExclusion.settings, roleExclusion.loaded = s, true
+		roleExclusion.byDB = map[*sqlx.DB]excludedIDs{}
+	}
+	if !roleExclusion.settings.Enabled {
+		return nil
+	}
+	if cached, ok := roleExclusion.byDB[db.DB]; ok && time.Since(cached.fetchedAt) < roleExclusionRefresh {
+		return cached.ids
+	}
+	rows, err := db.QueryWithTimeout(10*time.Second, db.RebindQuery(
+		`SELECT id FROM users WHERE role >= ? ORDER BY id LIMIT 1000`), roleExclusion.settings.MinRole)
+	var ids []int64
+	if err != nil {
+		logger.L.Warn("[角色排除] 查询管理员账号失败: " + err.Error())
+	} else {
+		ids = make([]int64, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, toInt64(row["id"]))
+		}
+	}
+	roleExclusion.byDB[db.DB] = excludedIDs{ids: ids, fetchedAt: time.Now()}
+	return ids
+}
+
+// roleExclusionClause returns " AND <column> NOT IN (...)" with its args for
+// the accounts of db (the instance's main DB) to exclude, or an empty clause.
+// The IDs are resolved up front so the clause also works on a separate log DB.
+func roleExclusionClause(db *database.Manager, column string) (string, []interface{}) {
+	ids := excludedUserIDs(db)
+	if len(ids) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return fmt.Sprintf(" AND %s NOT IN (%s)", column, placeholders(len(ids))), args
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestRoleExclusionKeepsAdminsOffRankings(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	resetRoleExclusion()
+	t.Cleanup(resetRoleExclusion)
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role INTEGER);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT, type INTEGER,
+			quota INTEGER, created_at INTEGER);
+		INSERT INTO users VALUES (1, 'root', 100), (2, 'ops', 10), (3, 'alice', 1);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	now := time.Now().Unix()
+	for _, u := range []struct {
+		id, quota int64
+		name      string
+	}{{1, 900, "root"}, {2, 500, "ops"}, {3, 100, "alice"}} {
+		if _, err := db.Exec(`INSERT INTO logs (user_id, username, type, quota, created_at) VALUES (?, ?, 2, ?, ?)`,
+			u.id, u.name, u.quota, now-60); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	topUsers := func() []int64 {
+		rows, err := NewDashboardService().GetTopUsers("24h", 10, true)
+		if err != nil {
+			t.Fatalf("GetTopUsers: %v", err)
+		}
+		ids := []int64{}
+		for _, row := range rows {
+			ids = append(ids, row.UserID)
+		}
+		return ids
+	}
+
+	if ids := topUsers(); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("admins should be excluded by default, got %v", ids)
+	}
+
+	ctx := context.Background()
+	if _, _, err := NewSettingsService().Update(ctx, "role_exclusion", "admin", map[string]interface{}{"min_role": float64(100)}); err != nil {
+		t.Fatalf("update min_role: %v", err)
+	}
+	if ids := topUsers(); len(ids) != 2 || ids[0] != 2 {
+		t.Fatalf("only root should be excluded with min_role=100, got %v", ids)
+	}
+	if _, _, err := NewSettingsService().Update(ctx, "role_exclusion", "admin", map[string]interface{}{"enabled": false}); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if ids := topUsers(); len(ids) != 3 {
+		t.Fatalf("disabled exclusion should list everyone, got %v", ids)
+	}
+	if _, _, err := NewSettingsService().Update(ctx, "role_exclusion", "admin", map[string]interface{}{"min_role": float64(1)}); err == nil {
+		t.Fatal("min_role below 2 would hide every user and should be rejected")
+	}
+}
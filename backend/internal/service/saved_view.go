@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Saved view scopes: the list endpoints whose query parameters can be saved
+const (
+	SavedViewScopeUsers            = "users"             // /api/users
+	SavedViewScopeRiskLeaderboards = "risk_leaderboards" // /api/risk/leaderboards
+	SavedViewScopeTopUps           = "top_ups"           // /api/top-ups
+	SavedViewScopeIPMonitoring     = "ip_monitoring"     // /api/ip/*
+	SavedViewScopeAuditLogs        = "audit_logs"        // /api/audit-logs
+	SavedViewScopeTokens           = "tokens"            // /api/tokens
+)
+
+// SavedViewScopes lists every valid scope
+var SavedViewScopes = []string{
+	SavedViewScopeUsers,
+	SavedViewScopeRiskLeaderboards,
+	SavedViewScopeTopUps,
+	SavedViewScopeIPMonitoring,
+	SavedViewScopeAuditLogs,
+	SavedViewScopeTokens,
+}
+
+// savedViewMaxParamsBytes bounds the stored filter set of one view
+const savedViewMaxParamsBytes = 4096
+
+var (
+	ErrSavedViewNotFound = errors.New("saved view not found")
+	ErrSavedViewExists   = errors.New("saved view already exists")
+	ErrInvalidSavedView  = errors.New("invalid saved view")
+)
+
+// SavedView is a named set of list filters owned by one admin
+type SavedView struct {
+	ID        int64                  `json:"id"`
+	Owner     string                 `json:"owner"`
+	Scope     string                 `json:"scope"`
+	Name      string                 `json:"name"`
+	Params    map[string]interface{} `json:"params"` // 原样回填到对应列表接口的查询参数
+	IsDefault bool                   `json:"is_default"`
+	CreatedAt int64                  `json:"created_at"`
+	UpdatedAt int64                  `json:"updated_at"`
+}
+
+// SavedViewInput supports create / partial update of a view
+type SavedViewInput struct {
+	Scope     *string                 `json:"scope"`
+	Name      *string                 `json:"name"`
+	Params    *map[string]interface{} `json:"params"`
+	IsDefault *bool                   `json:"is_default"`
+}
+
+// SavedViewService stores per-admin filter presets in the local store
+type SavedViewService struct{}
+
+// NewSavedViewService creates a SavedViewService
+func NewSavedViewService() *SavedViewService {
+	return &SavedViewService{}
+}
+
+func ensureSavedViewTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS saved_views (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			owner TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			name TEXT NOT NULL,
+			params TEXT NOT NULL DEFAULT '{}',
+			is_default INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0,
+			UNIQUE (owner, scope, name)
+		)`)
+	return err
+}
+
+func validateSavedView(v *SavedView) (string, error) {
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" || len([]rune(v.Name)) > 64 {
+		return "", fmt.Errorf("%w: name must be 1-64 characters", ErrInvalidSavedView)
+	}
+	validScope := false
+	for _, scope := range SavedViewScopes {
+		if scope == v.Scope {
+			validScope = true
+			break
+		}
+	}
+	if !validScope {
+		return "", fmt.Errorf("%w: unknown scope %q", ErrInvalidSavedView, v.Scope)
+	}
+	if v.Params == nil {
+		v.Params = map[string]interface{}{}
+	}
+	for key, val := range v.Params {
+		switch val.(type) {
+		case string, float64, bool, nil, []interface{}:
+		default:
+			return "", fmt.Errorf("%w: params.%s must be a scalar or list", ErrInvalidSavedView, key)
+		}
+	}
+	raw, err := json.Marshal(v.Params)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > savedViewMaxParamsBytes {
+		return "", fmt.Errorf("%w: params exceed %d bytes", ErrInvalidSavedView, savedViewMaxParamsBytes)
+	}
+	return string(raw), nil
+}
+
+func scanSavedView(scan func(dest ...interface{}) error) (SavedView, error) {
+	var v SavedView
+	var params string
+	var isDefault int
+	if err := scan(&v.ID, &v.Owner, &v.Scope, &v.Name, &params, &isDefault, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return v, err
+	}
+	v.IsDefault = isDefault == 1
+	v.Params = map[string]interface{}{}
+	_ = json.Unmarshal([]byte(params), &v.Params)
+	return v, nil
+}
+
+const savedViewColumns = `id, owner, scope, name, params, is_default, created_at, updated_at`
+
+// List returns the owner's views, optionally of one scope
+func (s *SavedViewService) List(ctx context.Context, owner, scope string) ([]SavedView, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureSavedViewTables(ctx, db); err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + savedViewColumns + ` FROM saved_views WHERE owner = ?`
+	args := []interface{}{owner}
+	if scope != "" {
+		query += ` AND scope = ?`
+		args = append(args, scope)
+	}
+	rows, err := db.QueryContext(ctx, query+` ORDER BY scope, is_default DESC, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	views := []SavedView{}
+	for rows.Next() {
+		v, err := scanSavedView(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+func getSavedView(ctx context.Context, db *sql.DB, owner string, id int64) (SavedView, error) {
+	v, err := scanSavedView(db.QueryRowContext(ctx,
+		`SELECT `+savedViewColumns+` FROM saved_views WHERE id = ? AND owner = ?`, id, owner).Scan)
+	if err == sql.ErrNoRows {
+		return v, ErrSavedViewNotFound
+	}
+	return v, err
+}
+
+// Create stores a new view for owner
+func (s *SavedViewService) Create(ctx context.Context, owner string, in SavedViewInput) (SavedView, error) {
+	v := SavedView{Owner: owner}
+	if in.Scope != nil {
+		v.Scope = *in.Scope
+	}
+	if in.Name != nil {
+		v.Name = *in.Name
+	}
+	if in.Params != nil {
+		v.Params = *in.Params
+	}
+	if in.IsDefault != nil {
+		v.IsDefault = *in.IsDefault
+	}
+	params, err := validateSavedView(&v)
+	if err != nil {
+		return v, err
+	}
+
+	db, err := openLocalStore()
+	if err != nil {
+		return v, err
+	}
+	defer db.Close()
+	if err := ensureSavedViewTables(ctx, db); err != nil {
+		return v, err
+	}
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM saved_views WHERE owner = ? AND scope = ? AND name = ?`,
+		owner, v.Scope, v.Name).Scan(&exists); err != nil {
+		return v, err
+	}
+	if exists > 0 {
+		return v, fmt.Errorf("%w: %s", ErrSavedViewExists, v.Name)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return v, err
+	}
+	defer tx.Rollback()
+	if v.IsDefault {
+		if err := clearSavedViewDefault(ctx, tx, owner, v.Scope); err != nil {
+			return v, err
+		}
+	}
+	v.CreatedAt = time.Now().Unix()
+	v.UpdatedAt = v.CreatedAt
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO saved_views (owner, scope, name, params, is_default, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, owner, v.Scope, v.Name, params, boolToInt(v.IsDefault), v.CreatedAt, v.UpdatedAt)
+	if err != nil {
+		return v, err
+	}
+	v.ID, _ = res.LastInsertId()
+	return v, tx.Commit()
+}
+
+// Update applies a partial update to one of owner's views
+func (s *SavedViewService) Update(ctx context.Context, owner string, id int64, in SavedViewInput) (SavedView, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return SavedView{}, err
+	}
+	defer db.Close()
+	if err := ensureSavedViewTables(ctx, db); err != nil {
+		return SavedView{}, err
+	}
+	v, err := getSavedView(ctx, db, owner, id)
+	if err != nil {
+		return v, err
+	}
+	if in.Scope != nil && *in.Scope != v.Scope {
+		return v, fmt.Errorf("%w: scope cannot be changed", ErrInvalidSavedView)
+	}
+	oldName := v.Name
+	if in.Name != nil {
+		v.Name = *in.Name
+	}
+	if in.Params != nil {
+		v.Params = *in.Params
+	}
+	if in.IsDefault != nil {
+		v.IsDefault = *in.IsDefault
+	}
+	params, err := validateSavedView(&v)
+	if err != nil {
+		return v, err
+	}
+	if v.Name != oldName {
+		var exists int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM saved_views WHERE owner = ? AND scope = ? AND name = ? AND id <> ?`,
+			owner, v.Scope, v.Name, id).Scan(&exists); err != nil {
+			return v, err
+		}
+		if exists > 0 {
+			return v, fmt.Errorf("%w: %s", ErrSavedViewExists, v.Name)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return v, err
+	}
+	defer tx.Rollback()
+	if v.IsDefault {
+		if err := clearSavedViewDefault(ctx, tx, owner, v.Scope); err != nil {
+			return v, err
+		}
+	}
+	v.UpdatedAt = time.Now().Unix()
+	if _, err := tx.ExecContext(ctx, `UPDATE saved_views SET name = ?, params = ?, is_default = ?, updated_at = ? WHERE id = ?`,
+		v.Name, params, boolToInt(v.IsDefault), v.UpdatedAt, id); err != nil {
+		return v, err
+	}
+	return v, tx.Commit()
+}
+
+// Delete removes one of owner's views
+func (s *SavedViewService) Delete(ctx context.Context, owner string, id int64) error {
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureSavedViewTables(ctx, db); err != nil {
+		return err
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM saved_views WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSavedViewNotFound
+	}
+	return nil
+}
+
+// clearSavedViewDefault keeps at most one default view per owner and scope
+func clearSavedViewDefault(ctx context.Context, tx *sql.Tx, owner, scope string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE saved_views SET is_default = 0 WHERE owner = ? AND scope = ?`, owner, scope)
+	return err
+}
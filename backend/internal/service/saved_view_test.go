@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestSavedViewsAreScopedToOwner(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	ctx := context.Background()
+	svc := NewSavedViewService()
+	str := func(s string) *string { return &s }
+	yes := true
+	params := map[string]interface{}{"windows": "1h,24h", "limit": float64(50)}
+
+	daily, err := svc.Create(ctx, "alice", SavedViewInput{Scope: str(SavedViewScopeRiskLeaderboards), Name: str("daily"), Params: &params, IsDefault: &yes})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Create(ctx, "alice", SavedViewInput{Scope: str(SavedViewScopeRiskLeaderboards), Name: str("daily")}); !errors.Is(err, ErrSavedViewExists) {
+		t.Fatalf("duplicate name should conflict, got %v", err)
+	}
+	if _, err := svc.Create(ctx, "bob", SavedViewInput{Scope: str(SavedViewScopeRiskLeaderboards), Name: str("daily")}); err != nil {
+		t.Fatalf("another admin may reuse the name: %v", err)
+	}
+	if _, err := svc.Create(ctx, "alice", SavedViewInput{Scope: str("orders"), Name: str("x")}); !errors.Is(err, ErrInvalidSavedView) {
+		t.Fatalf("unknown scope should be rejected, got %v", err)
+	}
+
+	// a new default replaces the previous one
+	if _, err := svc.Create(ctx, "alice", SavedViewInput{Scope: str(SavedViewScopeRiskLeaderboards), Name: str("weekly"), IsDefault: &yes}); err != nil {
+		t.Fatalf("Create weekly: %v", err)
+	}
+	views, err := svc.List(ctx, "alice", SavedViewScopeRiskLeaderboards)
+	if err != nil || len(views) != 2 {
+		t.Fatalf("expected alice's 2 views, got %v %v", views, err)
+	}
+	if views[0].Name != "weekly" || !views[0].IsDefault || views[1].IsDefault {
+		t.Fatalf("only the newest default should remain: %+v", views)
+	}
+	if views[1].Params["limit"] != float64(50) {
+		t.Fatalf("params not round-tripped: %+v", views[1].Params)
+	}
+
+	if _, err := svc.Update(ctx, "bob", daily.ID, SavedViewInput{Name: str("mine")}); !errors.Is(err, ErrSavedViewNotFound) {
+		t.Fatalf("bob must not edit alice's view, got %v", err)
+	}
+	if err := svc.Delete(ctx, "bob", daily.ID); !errors.Is(err, ErrSavedViewNotFound) {
+		t.Fatalf("bob must not delete alice's view, got %v", err)
+	}
+	if err := svc.Delete(ctx, "alice", daily.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+}
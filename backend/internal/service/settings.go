@@ -0,0 +1,724 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const runtimeQueryLimitsKey = "runtime_query_limits"
+
+var (
+	ErrSettingsSectionNotFound = errors.New("settings section not found")
+	ErrSettingsReadOnly        = errors.New("settings section is read-only")
+	ErrInvalidSetting          = errors.New("invalid setting")
+)
+
+// Setting sources
+const (
+	SettingSourceEnv   = "env"   // 环境变量，只读，修改需重启
+	SettingSourceRedis = "redis" // Redis 键（auto_group:config 等）
+	SettingSourceLocal = "local" // 本地 SQLite local_settings
+)
+
+// secretMask replaces secret values in responses; sending it back keeps the
+// stored value unchanged
+const secretMask = "***"
+
+// SettingField describes one typed setting
+type SettingField struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"` // bool | int | string | enum | string_list | int_list | object | object_list
+	Description string   `json:"description"`
+	Min         *int64   `json:"min,omitempty"`
+	Max         *int64   `json:"max,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Secret      bool     `json:"secret,omitempty"`
+}
+
+// SettingsSection is one group of settings with a single backing store
+type SettingsSection struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Source      string                 `json:"source"`
+	ReadOnly    bool                   `json:"read_only"`
+	HotReload   bool                   `json:"hot_reload"` // 保存后立即生效，无需重启
+	Fields      []SettingField         `json:"fields"`
+	Values      map[string]interface{} `json:"values"`
+}
+
+// SettingChange is one changed key in a settings update
+type SettingChange struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// SettingsHistoryEntry is one recorded settings update
+type SettingsHistoryEntry struct {
+	ID        int64           `json:"id"`
+	Section   string          `json:"section"`
+	Operator  string          `json:"operator"`
+	Changes   []SettingChange `json:"changes"`
+	CreatedAt int64           `json:"created_at"`
+}
+
+// QueryLimitSettings overrides DB_MAX_HEAVY_QUERIES / SLOW_QUERY_MS at runtime
+type QueryLimitSettings struct {
+	MaxHeavyQueries int   `json:"db_max_heavy_queries"`
+	SlowQueryMs     int   `json:"slow_query_ms"`
+	UpdatedAt       int64 `json:"updated_at"`
+}
+
+// settingsSection binds a schema to the store that owns it
+type settingsSection struct {
+	SettingsSection
+	load  func(ctx context.Context) (map[string]interface{}, error)
+	save  func(ctx context.Context, updates map[string]interface{}) error
+	apply func(ctx context.Context) error // 热加载：把已保存的值应用到运行中的服务
+}
+
+func intField(key, desc string, min, max int64) SettingField {
+	return SettingField{Key: key, Type: "int", Description: desc, Min: &min, Max: &max}
+}
+
+func boolField(key, desc string) SettingField {
+	return SettingField{Key: key, Type: "bool", Description: desc}
+}
+
+func stringField(key, desc string) SettingField {
+	return SettingField{Key: key, Type: "string", Description: desc}
+}
+
+func secretField(key, desc string) SettingField {
+	return SettingField{Key: key, Type: "string", Description: desc, Secret: true}
+}
+
+func enumField(key, desc string, options ...string) SettingField {
+	return SettingField{Key: key, Type: "enum", Description: desc, Options: options}
+}
+
+func listField(key, typ, desc string) SettingField {
+	return SettingField{Key: key, Type: typ, Description: desc}
+}
+
+// settingsSections lists every managed section in display order
+func settingsSections() []*settingsSection {
+	return []*settingsSection{
+		{
+			SettingsSection: SettingsSection{Name: "auto_group", Description: "自动分组", Source: SettingSourceRedis, HotReload: true, Fields: []SettingField{
+				boolField("enabled", "启用自动分组"),
+				enumField("mode", "分组模式", "simple", "by_source", "by_rules"),
+				stringField("target_group", "simple 模式的目标分组"),
+				{Key: "source_rules", Type: "object", Description: "by_source 模式：注册来源 → 分组"},
+				listField("condition_rules", "object_list", "by_rules 模式：按信任等级 / 账号天数 / 已用额度的条件规则（按顺序匹配）"),
+				listField("demotion_rules", "object_list", "降级规则：from_groups 中的用户在 linux.do 被封禁或信任等级过低时移出（每次扫描执行）"),
+				intField("scan_interval_minutes", "定时扫描间隔（分钟）", 1, 1440),
+				boolField("auto_scan_enabled", "启用定时扫描"),
+				listField("whitelist_ids", "int_list", "白名单用户 ID"),
+				intField("version", "配置版本（保存时回传读取到的值，已被他人修改则返回 409）", 0, math.MaxInt32),
+			}},
+			load: func(context.Context) (map[string]interface{}, error) {
+				return NewAutoGroupService().GetConfig(), nil
+			},
+			save: func(_ context.Context, updates map[string]interface{}) error {
+				err := NewAutoGroupService().SaveConfig(updates)
+				if errors.Is(err, ErrInvalidAutoGroupRule) {
+					return fmt.Errorf("%w: %v", ErrInvalidSetting, err)
+				}
+				return err
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "ai_ban", Description: "AI 自动封禁", Source: SettingSourceRedis, HotReload: true, Fields: []SettingField{
+				boolField("enabled", "启用 AI 自动封禁"),
+				boolField("dry_run", "试运行（只记录不封禁）"),
+				stringField("base_url", "OpenAI 兼容接口地址"),
+				secretField("api_key", "接口密钥"),
+				stringField("model", "审查模型"),
+				intField("scan_interval_minutes", "定时扫描间隔（分钟）", 1, 1440),
+				stringField("custom_prompt", "自定义提示词"),
+				listField("whitelist_ips", "string_list", "IP 白名单"),
+				listField("blacklist_ips", "string_list", "IP 黑名单"),
+				listField("excluded_models", "string_list", "排除的模型"),
+				listField("excluded_groups", "string_list", "排除的分组"),
+				intField("version", "配置版本（保存时回传读取到的值，已被他人修改则返回 409）", 0, math.MaxInt32),
+			}},
+			load: func(context.Context) (map[string]interface{}, error) {
+				return NewAIAutoBanService().GetConfig(), nil
+			},
+			save: func(_ context.Context, updates map[string]interface{}) error {
+				return NewAIAutoBanService().SaveConfig(updates)
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "retention", Description: "数据保留", Source: SettingSourceLocal, HotReload: true, Fields: []SettingField{
+				boolField("enabled", "启用定时清理"),
+				intField("interval_minutes", "清理间隔（分钟）", 10, 1440),
+				intField("batch_size", "每批删除行数", 100, 10000),
+				intField("batch_pause_ms", "批次间暂停（毫秒）", 0, 60000),
+				intField("max_batches_per_run", "单表单次最多批次", 1, 10000),
+				{Key: "policies", Type: "object", Description: "各表保留策略 {ttl_days, action}"},
+			}},
+			load: func(ctx context.Context) (map[string]interface{}, error) {
+				s, err := NewRetentionService().GetSettings(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return structToMap(s)
+			},
+			save: func(ctx context.Context, updates map[string]interface{}) error {
+				var in RetentionSettingsInput
+				if err := remarshal(updates, &in); err != nil {
+					return err
+				}
+				_, err := NewRetentionService().UpdateSettings(ctx, in)
+				if errors.Is(err, ErrInvalidRetentionPolicy) {
+					return fmt.Errorf("%w: %v", ErrInvalidSetting, err)
+				}
+				return err
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "log_archive", Description: "日志归档", Source: SettingSourceLocal, HotReload: true, Fields: []SettingField{
+				boolField("enabled", "启用定时归档"),
+				enumField("storage", "存储位置", LogArchiveStorageS3, LogArchiveStorageLocal),
+				stringField("local_dir", "本地归档目录"),
+				stringField("endpoint", "S3 Endpoint"),
+				stringField("region", "S3 Region"),
+				stringField("bucket", "S3 Bucket"),
+				stringField("prefix", "对象前缀"),
+				stringField("access_key_id", "Access Key ID"),
+				secretField("secret_access_key", "Secret Access Key"),
+				boolField("path_style", "Path-style 访问"),
+				intField("archive_after_days", "归档早于该天数的日志", 1, 3650),
+				intField("rows_per_file", "每个文件行数", 1000, 500000),
+				intField("max_files_per_run", "单次最多文件数", 1, 1000),
+				intField("interval_hours", "归档间隔（小时）", 1, 168),
+			}},
+			load: func(ctx context.Context) (map[string]interface{}, error) {
+				s, err := NewLogArchiveService().GetSettings(ctx)
+				if err != nil {
+					return nil, err
+				}
+				m, err := structToMap(s)
+				if err == nil && s.HasSecret {
+					m["secret_access_key"] = secretMask // GetSettings 已清空密钥，仅标记已设置
+				}
+				return m, err
+			},
+			save: func(ctx context.Context, updates map[string]interface{}) error {
+				var in LogArchiveSettingsInput
+				if err := remarshal(updates, &in); err != nil {
+					return err
+				}
+				_, err := NewLogArchiveService().UpdateSettings(ctx, in)
+				if errors.Is(err, ErrInvalidLogArchiveConfig) {
+					return fmt.Errorf("%w: %v", ErrInvalidSetting, err)
+				}
+				return err
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "system_scale", Description: "系统规模覆盖（0 / 空 = 沿用检测结果）", Source: SettingSourceLocal, HotReload: true, Fields: []SettingField{
+				enumField("scale", "固定规模档位", "", ScaleSmall, ScaleMedium, ScaleLarge, ScaleXLarge),
+				intField("cache_ttl", "基准缓存时长（秒）", 0, 86400),
+				intField("frontend_refresh_interval", "前端刷新间隔（秒）", 0, 3600),
+				intField("batch_size", "日志批大小", 0, 100000),
+				intField("scan_concurrency", "并发扫描数", 0, 32),
+				intField("query_limit_cap", "limit 上限", 0, 10000),
+			}},
+			load: func(ctx context.Context) (map[string]interface{}, error) {
+				var o ScaleOverride
+				if _, err := loadLocalSetting(ctx, systemScaleOverrideKey, &o); err != nil {
+					return nil, err
+				}
+				return structToMap(o)
+			},
+			save: func(ctx context.Context, updates map[string]interface{}) error {
+				var o ScaleOverride
+				if _, err := loadLocalSetting(ctx, systemScaleOverrideKey, &o); err != nil {
+					return err
+				}
+				if err := remarshal(updates, &o); err != nil {
+					return err
+				}
+				_, err := NewSystemScaleService().SetOverride(ctx, o)
+				if errors.Is(err, ErrInvalidScaleOverride) {
+					return fmt.Errorf("%w: %v", ErrInvalidSetting, err)
+				}
+				return err
+			},
+			apply: func(ctx context.Context) error {
+				scaleState.Lock()
+				scaleState.loaded = false
+				scaleState.Unlock()
+				loadScaleOverride(ctx)
+				return nil
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "query_limits", Description: "重查询并发与慢查询（覆盖 DB_MAX_HEAVY_QUERIES / SLOW_QUERY_MS）", Source: SettingSourceLocal, HotReload: true, Fields: []SettingField{
+				intField("db_max_heavy_queries", "同时执行的重查询上限，0 = 不限制", 0, 256),
+				intField("slow_query_ms", "慢查询阈值（毫秒），0 = 不记录", 0, 600000),
+			}},
+			load: func(ctx context.Context) (map[string]interface{}, error) {
+				s, _, err := loadQueryLimitSettings(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return structToMap(s)
+			},
+			save: func(ctx context.Context, updates map[string]interface{}) error {
+				s, _, err := loadQueryLimitSettings(ctx)
+				if err != nil {
+					return err
+				}
+				if err := remarshal(updates, &s); err != nil {
+					return err
+				}
+				s.UpdatedAt = time.Now().Unix()
+				return saveLocalSetting(ctx, runtimeQueryLimitsKey, s)
+			},
+			apply: func(ctx context.Context) error {
+				s, found, err := loadQueryLimitSettings(ctx)
+				if err != nil || !found {
+					return err
+				}
+				cfg := *config.Get()
+				cfg.DBMaxHeavyQueries, cfg.SlowQueryMs = s.MaxHeavyQueries, s.SlowQueryMs
+				database.ConfigureQueryLimits(&cfg)
+				return nil
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "role_exclusion", Description: "排行榜排除管理员账号（风控排行、可疑用户、仪表盘与分析排行）", Source: SettingSourceLocal, HotReload: true, Fields: []SettingField{
+				boolField("enabled", "排除高权限账号"),
+				intField("min_role", "role 不低于该值的账号被排除（10 = 管理员，100 = 超级管理员）", RoleCommonUser+1, RoleRootUser),
+			}},
+			load: func(ctx context.Context) (map[string]interface{}, error) {
+				s, err := loadRoleExclusionSettings(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return structToMap(s)
+			},
+			save: func(ctx context.Context, updates map[string]interface{}) error {
+				s, err := loadRoleExclusionSettings(ctx)
+				if err != nil {
+					return err
+				}
+				if err := remarshal(updates, &s); err != nil {
+					return err
+				}
+				s.UpdatedAt = time.Now().Unix()
+				return saveLocalSetting(ctx, roleExclusionKey, s)
+			},
+			apply: func(context.Context) error {
+				resetRoleExclusion()
+				return nil
+			},
+		},
+		{
+			SettingsSection: SettingsSection{Name: "reporting", Description: "报表时区（仪表盘、分析、充值与兑换码趋势按该时区划分日期）", Source: SettingSourceLocal, HotReload: true, Fields: []SettingField{
+				stringField("timezone", "IANA 时区名，如 Asia/Shanghai、America/New_York；留空跟随 TZ 环境变量"),
+			}},
+			load: func(ctx context.Context) (map[string]interface{}, error) {
+				s, err := loadReportingSettings(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return structToMap(s)
+			},
+			save: func(ctx context.Context, updates map[string]interface{}) error {
+				s, err := loadReportingSettings(ctx)
+				if err != nil {
+					return err
+				}
+				if err := remarshal(updates, &s); err != nil {
+					return err
+				}
+				if err := normalizeReportingSettings(&s); err != nil {
+					return fmt.Errorf("%w: %v", ErrInvalidSetting, err)
+				}
+				s.UpdatedAt = time.Now().Unix()
+				return saveLocalSetting(ctx, reportingSettingsKey, s)
+			},
+			apply: applyReportingSettings,
+		},
+		{
+			SettingsSection: SettingsSection{Name: "env", Description: "环境变量（只读，修改后需重启）", Source: SettingSourceEnv, ReadOnly: true, Fields: []SettingField{
+				intField("server_port", "PORT", 1, 65535),
+				stringField("timezone", "TZ"),
+				stringField("base_path", "BASE_PATH"),
+				stringField("database_engine", "数据库类型（由 SQL_DSN 推断）"),
+				boolField("log_database", "LOG_SQL_DSN 已配置"),
+				boolField("read_replica", "REPLICA_SQL_DSN 已配置"),
+				boolField("redis", "REDIS_CONN_STRING 已配置"),
+				intField("db_max_open_conns", "DB_MAX_OPEN_CONNS", 0, math.MaxInt32),
+				intField("db_max_idle_conns", "DB_MAX_IDLE_CONNS", 0, math.MaxInt32),
+				stringField("log_level", "LOG_LEVEL"),
+				stringField("data_dir", "DATA_DIR"),
+				stringField("newapi_base_url", "NEWAPI_BASE_URL"),
+			}},
+			load: func(context.Context) (map[string]interface{}, error) {
+				cfg := config.Get()
+				return map[string]interface{}{
+					"server_port":       cfg.ServerPort,
+					"timezone":          cfg.TimeZone,
+					"base_path":         cfg.BasePath,
+					"database_engine":   string(cfg.DatabaseEngine),
+					"log_database":      cfg.LogSQLDSN != "",
+					"read_replica":      cfg.HasReplica(),
+					"redis":             cfg.RedisConnString != "",
+					"db_max_open_conns": cfg.DBMaxOpenConns,
+					"db_max_idle_conns": cfg.DBMaxIdleConns,
+					"log_level":         cfg.LogLevel,
+					"data_dir":          cfg.DataDir,
+					"newapi_base_url":   cfg.NewAPIBaseURL,
+				}, nil
+			},
+		},
+	}
+}
+
+// loadQueryLimitSettings returns the stored override, or the env values when
+// nothing has been saved
+func loadQueryLimitSettings(ctx context.Context) (QueryLimitSettings, bool, error) {
+	cfg := config.Get()
+	s := QueryLimitSettings{MaxHeavyQueries: cfg.DBMaxHeavyQueries, SlowQueryMs: cfg.SlowQueryMs}
+	found, err := loadLocalSetting(ctx, runtimeQueryLimitsKey, &s)
+	return s, found, err
+}
+
+// structToMap converts a settings struct to its JSON object form
+func structToMap(v interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	return out, remarshal(v, &out)
+}
+
+// remarshal copies src into dest through JSON
+func remarshal(src, dest interface{}) error {
+	raw, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// SettingsService is the single entry point for reading and changing the
+// tool's configuration, whichever store a section lives in
+type SettingsService struct{}
+
+// NewSettingsService creates a SettingsService
+func NewSettingsService() *SettingsService {
+	return &SettingsService{}
+}
+
+func findSettingsSection(name string) (*settingsSection, error) {
+	for _, s := range settingsSections() {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSettingsSectionNotFound, name)
+}
+
+// view loads the section values, limited to schema fields with secrets masked
+func (sec *settingsSection) view(ctx context.Context) (SettingsSection, error) {
+	raw, err := sec.load(ctx)
+	if err != nil {
+		return SettingsSection{}, err
+	}
+	out := sec.SettingsSection
+	out.Values = make(map[string]interface{}, len(sec.Fields))
+	for _, f := range sec.Fields {
+		v := raw[f.Key]
+		if f.Secret {
+			v = maskSettingSecret(v)
+		}
+		out.Values[f.Key] = v
+	}
+	return out, nil
+}
+
+func maskSettingSecret(v interface{}) interface{} {
+	if s, _ := v.(string); s != "" {
+		return secretMask
+	}
+	return ""
+}
+
+// List returns every section with its schema and current values
+func (s *SettingsService) List(ctx context.Context) ([]SettingsSection, error) {
+	sections := settingsSections()
+	out := make([]SettingsSection, 0, len(sections))
+	for _, sec := range sections {
+		v, err := sec.view(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sec.Name, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// Get returns one section
+func (s *SettingsService) Get(ctx context.Context, name string) (SettingsSection, error) {
+	sec, err := findSettingsSection(name)
+	if err != nil {
+		return SettingsSection{}, err
+	}
+	return sec.view(ctx)
+}
+
+// Update validates updates against the section schema, saves them, records
+// the change history and hot-reloads the affected service
+func (s *SettingsService) Update(ctx context.Context, name, operator string, updates map[string]interface{}) (SettingsSection, []SettingChange, error) {
+	sec, err := findSettingsSection(name)
+	if err != nil {
+		return SettingsSection{}, nil, err
+	}
+	if sec.ReadOnly {
+		return SettingsSection{}, nil, fmt.Errorf("%w: %s", ErrSettingsReadOnly, name)
+	}
+	clean, err := validateSettingUpdates(sec.Fields, updates)
+	if err != nil {
+		return SettingsSection{}, nil, err
+	}
+	if len(clean) == 0 {
+		return SettingsSection{}, nil, fmt.Errorf("%w: 没有要保存的配置", ErrInvalidSetting)
+	}
+
+	before, err := sec.view(ctx)
+	if err != nil {
+		return SettingsSection{}, nil, err
+	}
+	if err := sec.save(ctx, clean); err != nil {
+		return SettingsSection{}, nil, err
+	}
+	if sec.apply != nil {
+		if err := sec.apply(ctx); err != nil {
+			logger.L.Warn(fmt.Sprintf("[配置] %s 热加载失败: %v", name, err), logger.CatSystem)
+		}
+	}
+	after, err := sec.view(ctx)
+	if err != nil {
+		return SettingsSection{}, nil, err
+	}
+
+	changes := diffSettings(sec.Fields, before.Values, after.Values)
+	if len(changes) > 0 {
+		if err := recordSettingsHistory(ctx, name, operator, changes); err != nil {
+			logger.L.Warn("[配置] 变更历史记录失败: "+err.Error(), logger.CatSystem)
+		}
+		keys := make([]string, len(changes))
+		for i, c := range changes {
+			keys[i] = c.Key
+		}
+		PublishEvent(EventSettingsChanged, map[string]interface{}{"section": name, "keys": keys})
+	}
+	return after, changes, nil
+}
+
+// Reload re-applies every stored runtime override (startup and
+// POST /api/settings/reload); sections without in-memory state are read
+// fresh on each use and need nothing
+func (s *SettingsService) Reload(ctx context.Context) []string {
+	var errs []string
+	for _, sec := range settingsSections() {
+		if sec.apply == nil {
+			continue
+		}
+		if err := sec.apply(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", sec.Name, err))
+		}
+	}
+	return errs
+}
+
+// validateSettingUpdates type-checks updates and drops unchanged secrets
+func validateSettingUpdates(fields []SettingField, updates map[string]interface{}) (map[string]interface{}, error) {
+	byKey := make(map[string]SettingField, len(fields))
+	for _, f := range fields {
+		byKey[f.Key] = f
+	}
+	clean := make(map[string]interface{}, len(updates))
+	for k, v := range updates {
+		f, ok := byKey[k]
+		if !ok {
+			return nil, fmt.Errorf("%w: 未知配置项 %s", ErrInvalidSetting, k)
+		}
+		if f.Secret && v == secretMask {
+			continue
+		}
+		nv, err := validateSettingValue(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %s", ErrInvalidSetting, k, err.Error())
+		}
+		clean[k] = nv
+	}
+	return clean, nil
+}
+
+func validateSettingValue(f SettingField, v interface{}) (interface{}, error) {
+	switch f.Type {
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, errors.New("必须是布尔值")
+	case "int":
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return nil, errors.New("必须是整数")
+		}
+		if (f.Min != nil && int64(n) < *f.Min) || (f.Max != nil && int64(n) > *f.Max) {
+			return nil, fmt.Errorf("必须在 %d-%d 之间", *f.Min, *f.Max)
+		}
+		return int64(n), nil
+	case "string", "enum":
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("必须是字符串")
+		}
+		if f.Type == "enum" && !containsStr(f.Options, s) {
+			return nil, fmt.Errorf("只能是 %v", f.Options)
+		}
+		return s, nil
+	case "string_list", "int_list":
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("必须是数组")
+		}
+		for _, item := range list {
+			if f.Type == "string_list" {
+				if _, ok := item.(string); !ok {
+					return nil, errors.New("元素必须是字符串")
+				}
+			} else if n, ok := item.(float64); !ok || n != math.Trunc(n) {
+				return nil, errors.New("元素必须是整数")
+			}
+		}
+		return list, nil
+	case "object":
+		if m, ok := v.(map[string]interface{}); ok {
+			return m, nil
+		}
+		return nil, errors.New("必须是对象")
+	case "object_list":
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("必须是数组")
+		}
+		for _, item := range list {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return nil, errors.New("元素必须是对象")
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("不支持的类型 %s", f.Type)
+}
+
+func containsStr(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// diffSettings compares two masked views key by key
+func diffSettings(fields []SettingField, before, after map[string]interface{}) []SettingChange {
+	var out []SettingChange
+	for _, f := range fields {
+		var o, n interface{}
+		_ = remarshal(before[f.Key], &o)
+		_ = remarshal(after[f.Key], &n)
+		if !reflect.DeepEqual(o, n) {
+			out = append(out, SettingChange{Key: f.Key, Old: o, New: n})
+		}
+	}
+	return out
+}
+
+func ensureSettingsHistoryTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS settings_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			section TEXT NOT NULL,
+			operator TEXT NOT NULL DEFAULT '',
+			changes TEXT NOT NULL DEFAULT '[]',
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_settings_history_section ON settings_history(section, id)`)
+	return err
+}
+
+func recordSettingsHistory(ctx context.Context, section, operator string, changes []SettingChange) error {
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	db, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := ensureSettingsHistoryTable(ctx, db); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO settings_history (section, operator, changes, created_at) VALUES (?, ?, ?, ?)`,
+		section, operator, string(raw), time.Now().Unix())
+	return err
+}
+
+// History returns recorded settings updates, newest first; section "" lists all
+func (s *SettingsService) History(ctx context.Context, section string, limit, offset int) (map[string]interface{}, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := ensureSettingsHistoryTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	where, args := "", []interface{}{}
+	if section != "" {
+		where, args = "WHERE section = ?", append(args, section)
+	}
+	var total int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM settings_history `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, section, operator, changes, created_at FROM settings_history `+where+
+		` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]SettingsHistoryEntry, 0)
+	for rows.Next() {
+		var e SettingsHistoryEntry
+		var raw string
+		if err := rows.Scan(&e.ID, &e.Section, &e.Operator, &raw, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(raw), &e.Changes)
+		items = append(items, e)
+	}
+	return map[string]interface{}{"items": items, "total": total}, rows.Err()
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestSettingsUpdateValidatesRecordsAndHotReloads(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	installSQLiteForTests(t)
+	database.ConfigureQueryLimits(config.Get())
+	defer database.ConfigureQueryLimits(config.Get())
+
+	ctx := context.Background()
+	svc := NewSettingsService()
+	sections, err := svc.List(ctx)
+	if err != nil || len(sections) == 0 {
+		t.Fatalf("List = %d sections, %v", len(sections), err)
+	}
+
+	for _, tc := range []struct {
+		section string
+		updates map[string]interface{}
+		want    error
+	}{
+		{"nope", map[string]interface{}{"a": 1.0}, ErrSettingsSectionNotFound},
+		{"env", map[string]interface{}{"log_level": "debug"}, ErrSettingsReadOnly},
+		{"query_limits", map[string]interface{}{"unknown": 1.0}, ErrInvalidSetting},
+		{"query_limits", map[string]interface{}{"slow_query_ms": "fast"}, ErrInvalidSetting},
+		{"query_limits", map[string]interface{}{"db_max_heavy_queries": 1.5}, ErrInvalidSetting},
+		{"query_limits", map[string]interface{}{"db_max_heavy_queries": 999.0}, ErrInvalidSetting},
+		{"log_archive", map[string]interface{}{"storage": "ftp"}, ErrInvalidSetting},
+		{"query_limits", map[string]interface{}{}, ErrInvalidSetting},
+	} {
+		if _, _, err := svc.Update(ctx, tc.section, "admin", tc.updates); !errors.Is(err, tc.want) {
+			t.Errorf("Update(%s, %v) = %v, want %v", tc.section, tc.updates, err, tc.want)
+		}
+	}
+
+	// query limits take effect without a restart
+	section, changes, err := svc.Update(ctx, "query_limits", "alice", map[string]interface{}{"db_max_heavy_queries": 3.0, "slow_query_ms": 500.0})
+	if err != nil || len(changes) != 2 || toInt64(section.Values["db_max_heavy_queries"]) != 3 {
+		t.Fatalf("Update query_limits = %+v, %+v, %v", section, changes, err)
+	}
+	if got := database.QueryLimits(); got.MaxHeavyQueries != 3 || got.SlowQueryMs != 500 {
+		t.Fatalf("query limits not hot-reloaded: %+v", got)
+	}
+	database.ConfigureQueryLimits(config.Get())
+	if errs := svc.Reload(ctx); len(errs) != 0 || database.QueryLimits().MaxHeavyQueries != 3 {
+		t.Fatalf("Reload should re-apply the stored override, errs=%v", errs)
+	}
+
+	// secrets are masked and "***" keeps the stored value
+	if _, _, err := svc.Update(ctx, "log_archive", "alice", map[string]interface{}{"secret_access_key": "s3cr3t"}); err != nil {
+		t.Fatalf("Update log_archive: %v", err)
+	}
+	archive, _, err := svc.Update(ctx, "log_archive", "alice", map[string]interface{}{"secret_access_key": "***", "prefix": "tools"})
+	if err != nil || archive.Values["secret_access_key"] != "***" || archive.Values["prefix"] != "tools/" {
+		t.Fatalf("masked update = %+v, %v", archive.Values, err)
+	}
+	if raw, _ := NewLogArchiveService().loadSettings(ctx); raw.SecretAccessKey != "s3cr3t" {
+		t.Fatalf("*** must not overwrite the stored secret, got %q", raw.SecretAccessKey)
+	}
+
+	// a no-op update records nothing
+	if _, changes, err := svc.Update(ctx, "query_limits", "bob", map[string]interface{}{"slow_query_ms": 500.0}); err != nil || len(changes) != 0 {
+		t.Fatalf("no-op update = %+v, %v", changes, err)
+	}
+	history, err := svc.History(ctx, "query_limits", 10, 0)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	items := history["items"].([]SettingsHistoryEntry)
+	if history["total"].(int64) != 1 || items[0].Operator != "alice" || len(items[0].Changes) != 2 {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if all, _ := svc.History(ctx, "", 10, 0); all["total"].(int64) != 3 {
+		t.Fatalf("history across sections = %+v", all)
+	}
+}
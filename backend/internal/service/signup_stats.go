@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+const signupSettingsKey = "signup_stats"
+
+// Sources for new-user counts. NewAPI users carry no creation time, so each
+// one is an approximation with its own blind spot.
+const (
+	// SignupSourceUserID counts users.id growth between daily watermark
+	// snapshots: every signup is counted, but only from the first snapshot on
+	SignupSourceUserID = "user_id"
+	// SignupSourceToken uses each user's first API token creation time;
+	// users who never created a token are missed
+	SignupSourceToken = "token"
+	// SignupSourceLogs uses each user's first request log; never-active
+	// signups are missed and old logs may have been cleaned
+	SignupSourceLogs = "logs"
+)
+
+// SignupSources lists the accepted sources
+var SignupSources = []string{SignupSourceUserID, SignupSourceToken, SignupSourceLogs}
+
+const maxSignupDays = 90
+
+var ErrInvalidSignupSource = errors.New("invalid signup source")
+
+// SignupSettings selects the default source of new-user counts
+type SignupSettings struct {
+	Source    string `json:"source"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// SignupDay is the new-user count of one local calendar day
+type SignupDay struct {
+	Date     string `json:"date"`
+	NewUsers int64  `json:"new_users"`
+	Known    bool   `json:"known"` // user_id 来源在首次快照之前的日子无数据
+}
+
+// SignupStats is the /api/users/signups response
+type SignupStats struct {
+	Source   string      `json:"source"`
+	Today    int64       `json:"today"`
+	Week     int64       `json:"week"` // 含今天的最近 7 天
+	Days     []SignupDay `json:"days"`
+	Since    string      `json:"since,omitempty"` // user_id 来源：首个完整快照日
+	Timezone string      `json:"timezone"`
+}
+
+// SignupStatsService counts new users per day from the configured source and
+// keeps the daily users.id watermark snapshots
+type SignupStatsService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewSignupStatsService creates a SignupStatsService on the primary instance
+func NewSignupStatsService() *SignupStatsService {
+	return &SignupStatsService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *SignupStatsService) WithContext(ctx context.Context) *SignupStatsService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func ensureSignupTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS signup_snapshots (
+			day INTEGER PRIMARY KEY,
+			max_user_id INTEGER NOT NULL DEFAULT 0,
+			new_users INTEGER NOT NULL DEFAULT -1,
+			updated_at INTEGER NOT NULL DEFAULT 0
+		)`)
+	return err
+}
+
+func openSignupStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureSignupTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func validSignupSource(source string) bool {
+	for _, s := range SignupSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSettings returns the signup settings (user_id source if never saved)
+func (s *SignupStatsService) GetSettings(ctx context.Context) (SignupSettings, error) {
+	settings := SignupSettings{Source: SignupSourceUserID}
+	if _, err := loadLocalSetting(ctx, signupSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if !validSignupSource(settings.Source) {
+		settings.Source = SignupSourceUserID
+	}
+	return settings, nil
+}
+
+// UpdateSettings changes the default source
+func (s *SignupStatsService) UpdateSettings(ctx context.Context, source string) (SignupSettings, error) {
+	if !validSignupSource(source) {
+		return SignupSettings{}, fmt.Errorf("%w: source 仅支持 user_id / token / logs", ErrInvalidSignupSource)
+	}
+	settings := SignupSettings{Source: source, UpdatedAt: time.Now().Unix()}
+	return settings, saveLocalSetting(ctx, signupSettingsKey, settings)
+}
+
+// Snapshot records today's users.id watermark. Today's count is the users
+// above the previous day's watermark and is refreshed on every call, so the
+// row is final once the day is over. The first snapshot has no previous
+// watermark and stays unknown. Snapshots after a gap attribute the whole
+// gap to the day of the snapshot.
+func (s *SignupStatsService) Snapshot(ctx context.Context) error {
+	store, err := openSignupStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	row, err := s.db.QueryOne(`SELECT COALESCE(MAX(id), 0) AS max_id FROM users`)
+	if err != nil {
+		return err
+	}
+	maxID := toInt64(row["max_id"])
+	now := time.Now()
+	today := reportDayGroup(now)
+
+	var prevMax int64
+	newUsers := int64(-1)
+	err = store.QueryRowContext(ctx, `SELECT max_user_id FROM signup_snapshots WHERE day < ? ORDER BY day DESC LIMIT 1`, today).Scan(&prevMax)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	default:
+		newUsers = 0
+		if maxID > prevMax {
+			// 计数而不是 id 差值：id 可能跳号，软删除的用户仍计入
+			row, err := s.db.QueryOne(s.db.RebindQuery(`SELECT COUNT(*) AS cnt FROM users WHERE id > ? AND id <= ?`), prevMax, maxID)
+			if err != nil {
+				return err
+			}
+			newUsers = toInt64(row["cnt"])
+		}
+	}
+	_, err = store.ExecContext(ctx, `
+		INSERT INTO signup_snapshots (day, max_user_id, new_users, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(day) DO UPDATE SET max_user_id = excluded.max_user_id, new_users = excluded.new_users, updated_at = excluded.updated_at`,
+		today, maxID, newUsers, now.Unix())
+	return err
+}
+
+// Stats returns new users per local day for the last days days. source ""
+// uses the configured source.
+func (s *SignupStatsService) Stats(ctx context.Context, source string, days int) (*SignupStats, error) {
+	if source == "" {
+		settings, err := s.GetSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		source = settings.Source
+	}
+	if !validSignupSource(source) {
+		return nil, fmt.Errorf("%w: source 仅支持 user_id / token / logs", ErrInvalidSignupSource)
+	}
+	if days < 7 || days > maxSignupDays {
+		days = 30
+	}
+
+	now := time.Now()
+	firstDay := reportDayStart(now).AddDate(0, 0, -(days - 1))
+	counts, since, err := s.countByDay(ctx, source, firstDay, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SignupStats{Source: source, Days: make([]SignupDay, 0, days), Timezone: ReportLocation().String()}
+	if since != 0 {
+		result.Since = dayGroupDate(since)
+	}
+	todayGroup := reportDayGroup(now)
+	for d := firstDay; !d.After(now); d = d.AddDate(0, 0, 1) {
+		group := reportDayGroup(d)
+		n, known := counts[group]
+		if source != SignupSourceUserID {
+			known = true
+		}
+		result.Days = append(result.Days, SignupDay{Date: d.Format("2006-01-02"), NewUsers: n, Known: known})
+		if group == todayGroup {
+			result.Today = n
+		}
+		if group > todayGroup-7 {
+			result.Week += n
+		}
+	}
+	return result, nil
+}
+
+// dayGroupDate formats a reportDayGroup bucket as a local date
+func dayGroupDate(group int64) string {
+	t := time.Unix(group*86400, 0).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, ReportLocation()).Format("2006-01-02")
+}
+
+// countByDay returns new users per reportDayGroup in [start, end]; for the
+// user_id source, days without a known snapshot are absent and since is the
+// first day with a known count
+func (s *SignupStatsService) countByDay(ctx context.Context, source string, start, end time.Time) (map[int64]int64, int64, error) {
+	counts := map[int64]int64{}
+	if source == SignupSourceUserID {
+		store, err := openSignupStore(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer store.Close()
+		var since sql.NullInt64
+		if err := store.QueryRowContext(ctx, `SELECT MIN(day) FROM signup_snapshots WHERE new_users >= 0`).Scan(&since); err != nil {
+			return nil, 0, err
+		}
+		rows, err := store.QueryContext(ctx, `SELECT day, new_users FROM signup_snapshots WHERE day >= ? AND day <= ? AND new_users >= 0`,
+			reportDayGroup(start), reportDayGroup(end))
+		if err != nil {
+			return nil, 0, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var day, n int64
+			if err := rows.Scan(&day, &n); err != nil {
+				return nil, 0, err
+			}
+			counts[day] = n
+		}
+		return counts, since.Int64, rows.Err()
+	}
+
+	cacheKey := cache.Key("users:signups:%s:%d:%d", source, start.Unix(), reportDayGroup(end))
+	var cached map[int64]int64
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found {
+		return cached, 0, nil
+	}
+
+	db, inner := s.db, `SELECT user_id, MIN(created_time) AS first_at FROM tokens WHERE user_id > 0 GROUP BY user_id`
+	if source == SignupSourceLogs {
+		db, inner = s.logDB, `SELECT user_id, MIN(created_at) AS first_at FROM logs WHERE user_id > 0 GROUP BY user_id`
+	}
+	dayExpr := reportDayExpr("first_at", start.Unix(), end.Unix())
+	rows, err := db.QueryWithTimeout(60*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT %s AS day, COUNT(*) AS cnt
+		FROM (%s) first_seen
+		WHERE first_at >= ? AND first_at <= ?
+		GROUP BY %s`, dayExpr, inner, dayExpr)), start.Unix(), end.Unix())
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, row := range rows {
+		counts[toInt64(row["day"])] = toInt64(row["cnt"])
+	}
+	cache.Get().Set(cacheKey, counts, scaledTTL(10*time.Minute))
+	return counts, 0, nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestSignupSnapshotCountsUsersAboveWatermark(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT);
+		INSERT INTO users VALUES (1, 'a'), (2, 'b'), (5, 'c'), (9, 'd');
+		CREATE TABLE tokens (id INTEGER PRIMARY KEY, user_id INTEGER, created_time INTEGER);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	svc := NewSignupStatsService()
+
+	// Yesterday's watermark was id 2; ids 5 and 9 signed up since (4 ids, 2 users)
+	store, err := openSignupStore(ctx)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	yesterday := reportDayGroup(time.Now()) - 1
+	if _, err := store.Exec(`INSERT INTO signup_snapshots (day, max_user_id, new_users) VALUES (?, 2, 1), (?, 1, -1)`, yesterday, yesterday-1); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	store.Close()
+
+	if err := svc.Snapshot(ctx); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	stats, err := svc.Stats(ctx, "", 7)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Source != SignupSourceUserID || stats.Today != 2 || stats.Week != 3 || len(stats.Days) != 7 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.Since != dayGroupDate(yesterday) {
+		t.Errorf("since should be the first known day, got %q", stats.Since)
+	}
+	if d := stats.Days[len(stats.Days)-3]; d.Known {
+		t.Errorf("first snapshot day has no previous watermark and must be unknown: %+v", d)
+	}
+
+	if _, err := svc.UpdateSettings(ctx, "email"); !errors.Is(err, ErrInvalidSignupSource) {
+		t.Fatalf("unknown source should be rejected, got %v", err)
+	}
+	if _, err := svc.UpdateSettings(ctx, SignupSourceToken); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if settings, _ := svc.GetSettings(ctx); settings.Source != SignupSourceToken {
+		t.Fatalf("source not saved: %+v", settings)
+	}
+
+	// Token source: only each user's first token counts, users without tokens are missed
+	now := time.Now().Unix()
+	if _, err := db.Exec(`INSERT INTO tokens (user_id, created_time) VALUES (1, ?), (1, ?), (5, ?), (9, 1000)`, now, now, now); err != nil {
+		t.Fatalf("seed tokens: %v", err)
+	}
+	stats, err = svc.Stats(ctx, "", 7)
+	if err != nil {
+		t.Fatalf("token stats: %v", err)
+	}
+	if stats.Source != SignupSourceToken || stats.Today != 2 || stats.Week != 2 || stats.Since != "" {
+		t.Fatalf("unexpected token stats: %+v", stats)
+	}
+}
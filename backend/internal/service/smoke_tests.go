@@ -0,0 +1,858 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const (
+	smokeTestSettingsKey = "smoke_tests"
+
+	defaultSmokeTestRunLimit = 20
+	maxSmokeTestRunLimit     = 200
+	smokeTestRunRetention    = 14 * 24 * time.Hour
+)
+
+// Smoke test steps, executed in this order
+const (
+	SmokeStepAuth       = "auth"       // 令牌能通过 /v1/models 鉴权，且可见配置的模型
+	SmokeStepCompletion = "completion" // 一次极小的对话补全
+	SmokeStepLog        = "log"        // 补全后数据库出现对应的消费日志
+	SmokeStepQuota      = "quota"      // 令牌所属用户的额度减少
+)
+
+// SmokeTestSteps lists every step in execution order
+var SmokeTestSteps = []string{SmokeStepAuth, SmokeStepCompletion, SmokeStepLog, SmokeStepQuota}
+
+var (
+	ErrInvalidSmokeTest       = errors.New("invalid smoke test config")
+	ErrSmokeTestNotConfigured = errors.New("冒烟测试未配置测试令牌或模型")
+)
+
+// smokeTestPollInterval is how often the log / quota steps re-check the database
+var smokeTestPollInterval = time.Second
+
+// SmokeTestSettings 端到端冒烟测试配置
+type SmokeTestSettings struct {
+	Enabled          bool     `json:"enabled"`
+	IntervalMinutes  int      `json:"interval_minutes"`
+	BaseURL          string   `json:"base_url"` // 空 = NEWAPI_BASEURL
+	Token            string   `json:"token,omitempty"`
+	HasToken         bool     `json:"has_token"`
+	Model            string   `json:"model"`
+	Prompt           string   `json:"prompt"`
+	MaxTokens        int      `json:"max_tokens"`
+	Steps            []string `json:"steps"`
+	TimeoutSeconds   int      `json:"timeout_seconds"`
+	WaitSeconds      int      `json:"wait_seconds"`      // 等待日志 / 额度落库的最长时间
+	FailureThreshold int      `json:"failure_threshold"` // 连续失败多少次后告警
+	WebhookURL       string   `json:"webhook_url"`
+	WebhookSecret    string   `json:"webhook_secret,omitempty"`
+	HasWebhookSecret bool     `json:"has_webhook_secret"`
+	UpdatedAt        int64    `json:"updated_at"`
+}
+
+// SmokeTestSettingsInput supports partial update of SmokeTestSettings.
+// For Token / WebhookSecret: nil = unchanged, empty string = clear.
+type SmokeTestSettingsInput struct {
+	Enabled          *bool     `json:"enabled"`
+	IntervalMinutes  *int      `json:"interval_minutes"`
+	BaseURL          *string   `json:"base_url"`
+	Token            *string   `json:"token"`
+	Model            *string   `json:"model"`
+	Prompt           *string   `json:"prompt"`
+	MaxTokens        *int      `json:"max_tokens"`
+	Steps            *[]string `json:"steps"`
+	TimeoutSeconds   *int      `json:"timeout_seconds"`
+	WaitSeconds      *int      `json:"wait_seconds"`
+	FailureThreshold *int      `json:"failure_threshold"`
+	WebhookURL       *string   `json:"webhook_url"`
+	WebhookSecret    *string   `json:"webhook_secret"`
+}
+
+// SmokeTestStep is the outcome of one step of a run
+type SmokeTestStep struct {
+	Name      string `json:"name"`
+	Success   bool   `json:"success"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Message   string `json:"message,omitempty"`
+}
+
+// SmokeTestRun is one execution of the suite
+type SmokeTestRun struct {
+	ID         int64           `json:"id"`
+	Trigger    string          `json:"trigger"` // schedule | manual
+	Success    bool            `json:"success"`
+	FailedStep string          `json:"failed_step,omitempty"`
+	Steps      []SmokeTestStep `json:"steps"`
+	DurationMs int64           `json:"duration_ms"`
+	Alerted    bool            `json:"alerted"`
+	CreatedAt  int64           `json:"created_at"`
+}
+
+// smokeTestToken is the test token as NewAPI stores it
+type smokeTestToken struct {
+	ID             int64
+	UserID         int64
+	RemainQuota    int64
+	UnlimitedQuota bool
+}
+
+// SmokeTestService runs a synthetic request through NewAPI with a real token
+// and checks that it is logged and billed, catching breakage anywhere in the
+// relay → log → quota pipeline rather than only upstream model failures.
+type SmokeTestService struct {
+	cfg        *config.Config
+	db         *database.Manager
+	logDB      *database.Manager
+	httpClient *http.Client
+}
+
+// smokeTestMu serialises runs (background ticker vs manual run)
+var smokeTestMu sync.Mutex
+
+// NewSmokeTestService creates a new SmokeTestService. Both databases are the
+// primaries: replicas may lag behind the log and quota writes being checked.
+func NewSmokeTestService() *SmokeTestService {
+	return &SmokeTestService{
+		cfg:        config.Get(),
+		db:         database.Get(),
+		logDB:      database.GetLog(),
+		httpClient: &http.Client{},
+	}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *SmokeTestService) WithContext(ctx context.Context) *SmokeTestService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	c.logDB = s.logDB.WithContext(ctx)
+	return &c
+}
+
+func defaultSmokeTestSettings() SmokeTestSettings {
+	return SmokeTestSettings{
+		IntervalMinutes:  30,
+		Prompt:           "ping",
+		MaxTokens:        5,
+		Steps:            append([]string(nil), SmokeTestSteps...),
+		TimeoutSeconds:   60,
+		WaitSeconds:      15,
+		FailureThreshold: 1,
+	}
+}
+
+func normalizeSmokeTestSettings(s *SmokeTestSettings) error {
+	s.IntervalMinutes = clampSetting(s.IntervalMinutes, 5, 1440, 30)
+	s.MaxTokens = clampSetting(s.MaxTokens, 1, 256, 5)
+	s.TimeoutSeconds = clampSetting(s.TimeoutSeconds, 5, 300, 60)
+	s.WaitSeconds = clampSetting(s.WaitSeconds, 1, 120, 15)
+	s.FailureThreshold = clampSetting(s.FailureThreshold, 1, 100, 1)
+	s.Token = strings.TrimSpace(s.Token)
+	s.Model = strings.TrimSpace(s.Model)
+	if strings.TrimSpace(s.Prompt) == "" {
+		s.Prompt = "ping"
+	}
+	s.BaseURL = strings.TrimRight(strings.TrimSpace(s.BaseURL), "/")
+	for name, raw := range map[string]string{"base_url": s.BaseURL, "webhook_url": strings.TrimSpace(s.WebhookURL)} {
+		if raw == "" {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: %s 需为 http(s) 地址", ErrInvalidSmokeTest, name)
+		}
+	}
+	s.WebhookURL = strings.TrimSpace(s.WebhookURL)
+	if s.Steps == nil {
+		s.Steps = append([]string(nil), SmokeTestSteps...)
+	}
+	// 保持固定的执行顺序并去重
+	steps := make([]string, 0, len(SmokeTestSteps))
+	for _, step := range s.Steps {
+		if !containsStr(SmokeTestSteps, strings.ToLower(strings.TrimSpace(step))) {
+			return fmt.Errorf("%w: 未知的检查步骤 %q，可选 %s", ErrInvalidSmokeTest, step, strings.Join(SmokeTestSteps, "、"))
+		}
+	}
+	for _, step := range SmokeTestSteps {
+		for _, want := range s.Steps {
+			if strings.ToLower(strings.TrimSpace(want)) == step {
+				steps = append(steps, step)
+				break
+			}
+		}
+	}
+	if len(steps) == 0 {
+		return fmt.Errorf("%w: 至少需要启用一个检查步骤", ErrInvalidSmokeTest)
+	}
+	s.Steps = steps
+	s.HasToken = s.Token != ""
+	s.HasWebhookSecret = s.WebhookSecret != ""
+	return nil
+}
+
+// view hides the test token and webhook secret from API responses
+func (s SmokeTestSettings) view() SmokeTestSettings {
+	s.HasToken = s.Token != ""
+	s.HasWebhookSecret = s.WebhookSecret != ""
+	s.Token, s.WebhookSecret = "", ""
+	return s
+}
+
+func loadSmokeTestSettings(ctx context.Context) (SmokeTestSettings, error) {
+	settings := defaultSmokeTestSettings()
+	if _, err := loadLocalSetting(ctx, smokeTestSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeSmokeTestSettings(&settings); err != nil {
+		def := defaultSmokeTestSettings()
+		def.Token, def.Model = settings.Token, settings.Model
+		settings = def
+		normalizeSmokeTestSettings(&settings)
+	}
+	return settings, nil
+}
+
+// GetSettings returns the settings without the token and webhook secret
+func (s *SmokeTestService) GetSettings(ctx context.Context) (SmokeTestSettings, error) {
+	settings, err := loadSmokeTestSettings(ctx)
+	return settings.view(), err
+}
+
+// UpdateSettings applies a partial update
+func (s *SmokeTestService) UpdateSettings(ctx context.Context, in SmokeTestSettingsInput) (SmokeTestSettings, error) {
+	settings, err := loadSmokeTestSettings(ctx)
+	if err != nil {
+		return settings.view(), err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.IntervalMinutes != nil {
+		settings.IntervalMinutes = *in.IntervalMinutes
+	}
+	if in.BaseURL != nil {
+		settings.BaseURL = *in.BaseURL
+	}
+	if in.Token != nil {
+		settings.Token = *in.Token
+	}
+	if in.Model != nil {
+		settings.Model = *in.Model
+	}
+	if in.Prompt != nil {
+		settings.Prompt = *in.Prompt
+	}
+	if in.MaxTokens != nil {
+		settings.MaxTokens = *in.MaxTokens
+	}
+	if in.Steps != nil {
+		settings.Steps = *in.Steps
+	}
+	if in.TimeoutSeconds != nil {
+		settings.TimeoutSeconds = *in.TimeoutSeconds
+	}
+	if in.WaitSeconds != nil {
+		settings.WaitSeconds = *in.WaitSeconds
+	}
+	if in.FailureThreshold != nil {
+		settings.FailureThreshold = *in.FailureThreshold
+	}
+	if in.WebhookURL != nil {
+		settings.WebhookURL = *in.WebhookURL
+	}
+	if in.WebhookSecret != nil {
+		settings.WebhookSecret = *in.WebhookSecret
+	}
+	if err := normalizeSmokeTestSettings(&settings); err != nil {
+		return settings.view(), err
+	}
+	if settings.Enabled && !s.configured(settings) {
+		return settings.view(), fmt.Errorf("%w: 启用前需配置测试令牌与模型", ErrInvalidSmokeTest)
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, smokeTestSettingsKey, settings); err != nil {
+		return settings.view(), err
+	}
+	return settings.view(), nil
+}
+
+func (s *SmokeTestService) baseURL(settings SmokeTestSettings) string {
+	if settings.BaseURL != "" {
+		return settings.BaseURL
+	}
+	return strings.TrimRight(strings.TrimSpace(s.cfg.NewAPIBaseURL), "/")
+}
+
+func (s *SmokeTestService) configured(settings SmokeTestSettings) bool {
+	return settings.Token != "" && settings.Model != "" && s.baseURL(settings) != ""
+}
+
+// Configured reports whether a test token, model and base URL are set
+func (s *SmokeTestService) Configured(ctx context.Context) bool {
+	settings, err := loadSmokeTestSettings(ctx)
+	return err == nil && s.configured(settings)
+}
+
+// RunIfDue runs the suite when it is enabled and the interval has passed
+// since the last run; returns nil when nothing was due.
+func (s *SmokeTestService) RunIfDue(ctx context.Context) (*SmokeTestRun, error) {
+	settings, err := loadSmokeTestSettings(ctx)
+	if err != nil || !settings.Enabled || !s.configured(settings) {
+		return nil, err
+	}
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	var last int64
+	err = ensureSmokeTestTables(ctx, store)
+	if err == nil {
+		err = store.QueryRowContext(ctx, `SELECT COALESCE(MAX(created_at), 0) FROM smoke_test_runs`).Scan(&last)
+	}
+	store.Close()
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix()-last < int64(settings.IntervalMinutes)*60 {
+		return nil, nil
+	}
+	return s.Run(ctx, "schedule")
+}
+
+// Run executes the enabled steps once, records the run and alerts when the
+// consecutive failure count reaches the threshold (and again on recovery).
+func (s *SmokeTestService) Run(ctx context.Context, trigger string) (*SmokeTestRun, error) {
+	settings, err := loadSmokeTestSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !s.configured(settings) {
+		return nil, ErrSmokeTestNotConfigured
+	}
+
+	smokeTestMu.Lock()
+	defer smokeTestMu.Unlock()
+
+	run := &SmokeTestRun{Trigger: trigger, CreatedAt: time.Now().Unix()}
+	started := time.Now()
+	s.execute(ctx, settings, run)
+	run.DurationMs = time.Since(started).Milliseconds()
+	run.Success = true
+	for _, st := range run.Steps {
+		if !st.Success && !st.Skipped {
+			run.Success, run.FailedStep = false, st.Name
+			break
+		}
+	}
+
+	if err := s.record(ctx, settings, run); err != nil {
+		return run, err
+	}
+	return run, nil
+}
+
+// execute runs the steps in order; once a step fails the rest are skipped
+func (s *SmokeTestService) execute(ctx context.Context, settings SmokeTestSettings, run *SmokeTestRun) {
+	enabled := func(step string) bool { return containsStr(settings.Steps, step) }
+	failed := false
+	skip := func(step, msg string) {
+		run.Steps = append(run.Steps, SmokeTestStep{Name: step, Skipped: true, Message: msg})
+	}
+	add := func(step SmokeTestStep) {
+		run.Steps = append(run.Steps, step)
+		failed = failed || !step.Success
+	}
+
+	// 额度基线需在补全之前读取
+	var tok *smokeTestToken
+	var tokErr error
+	var quotaBefore int64
+	if enabled(SmokeStepLog) || enabled(SmokeStepQuota) {
+		if tok, tokErr = s.lookupToken(settings.Token); tokErr == nil {
+			quotaBefore, tokErr = s.userQuota(tok.UserID)
+		}
+	}
+
+	if enabled(SmokeStepAuth) {
+		add(s.checkAuth(ctx, settings))
+	}
+	if !enabled(SmokeStepCompletion) {
+		for _, step := range []string{SmokeStepLog, SmokeStepQuota} {
+			if enabled(step) {
+				skip(step, "未启用 completion 步骤")
+			}
+		}
+		return
+	}
+	if failed {
+		for _, step := range settings.Steps[1:] {
+			skip(step, "前置步骤失败")
+		}
+		return
+	}
+	// 同一秒内的上一次运行也会留下日志，以补全前的最大日志 ID 为界
+	requestStart := time.Now().Unix()
+	var lastLogID int64
+	if enabled(SmokeStepLog) && tokErr == nil {
+		lastLogID, tokErr = s.lastLogID(tok.ID)
+	}
+	add(s.checkCompletion(ctx, settings))
+
+	var logQuota int64 = -1
+	if enabled(SmokeStepLog) {
+		switch {
+		case failed:
+			skip(SmokeStepLog, "前置步骤失败")
+		case tokErr != nil:
+			add(SmokeTestStep{Name: SmokeStepLog, Message: tokErr.Error()})
+		default:
+			var step SmokeTestStep
+			step, logQuota = s.checkLog(ctx, settings, tok.ID, lastLogID, requestStart)
+			add(step)
+		}
+	}
+	if enabled(SmokeStepQuota) {
+		switch {
+		case failed:
+			skip(SmokeStepQuota, "前置步骤失败")
+		case tokErr != nil:
+			add(SmokeTestStep{Name: SmokeStepQuota, Message: tokErr.Error()})
+		case logQuota == 0:
+			skip(SmokeStepQuota, "该次请求计费为 0，无法校验扣费")
+		default:
+			add(s.checkQuota(ctx, settings, tok.UserID, quotaBefore))
+		}
+	}
+}
+
+// lookupToken resolves the test token in the NewAPI database; NewAPI stores
+// the key without the "sk-" prefix
+func (s *SmokeTestService) lookupToken(token string) (*smokeTestToken, error) {
+	keyCol := "`key`"
+	if s.db.IsPG {
+		keyCol = `"key"`
+	}
+	row, err := s.db.QueryOne(s.db.RebindQuery(fmt.Sprintf(`
+		SELECT id, user_id, COALESCE(remain_quota, 0) AS remain_quota, COALESCE(unlimited_quota, false) AS unlimited_quota
+		FROM tokens WHERE %s = ? AND deleted_at IS NULL`, keyCol)), strings.TrimPrefix(token, "sk-"))
+	if err != nil {
+		return nil, fmt.Errorf("查询测试令牌失败: %v", err)
+	}
+	if row == nil {
+		return nil, errors.New("数据库中找不到测试令牌")
+	}
+	unlimited := row["unlimited_quota"]
+	return &smokeTestToken{
+		ID:             toInt64(row["id"]),
+		UserID:         toInt64(row["user_id"]),
+		RemainQuota:    toInt64(row["remain_quota"]),
+		UnlimitedQuota: unlimited == true || toInt64(unlimited) == 1,
+	}, nil
+}
+
+func (s *SmokeTestService) userQuota(userID int64) (int64, error) {
+	row, err := s.db.QueryOne(s.db.RebindQuery(`SELECT COALESCE(quota, 0) AS quota FROM users WHERE id = ?`), userID)
+	if err != nil {
+		return 0, fmt.Errorf("查询测试用户额度失败: %v", err)
+	}
+	if row == nil {
+		return 0, fmt.Errorf("测试令牌所属用户 #%d 不存在", userID)
+	}
+	return toInt64(row["quota"]), nil
+}
+
+// smokeRequest sends an authenticated request with the test token and
+// returns the status code and (truncated) body
+func (s *SmokeTestService) smokeRequest(ctx context.Context, settings SmokeTestSettings, method, path string, payload interface{}) (int, []byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(settings.TimeoutSeconds)*time.Second)
+	defer cancel()
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, method, s.baseURL(settings)+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	key := settings.Token
+	if !strings.HasPrefix(key, "sk-") {
+		key = "sk-" + key
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	return resp.StatusCode, data, nil
+}
+
+// smokeErrorMessage extracts an OpenAI-style error message from a response body
+func smokeErrorMessage(status int, body []byte) string {
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Message string `json:"message"`
+	}
+	msg := string(body)
+	if json.Unmarshal(body, &payload) == nil {
+		if payload.Error.Message != "" {
+			msg = payload.Error.Message
+		} else if payload.Message != "" {
+			msg = payload.Message
+		}
+	}
+	return truncateProbeMessage(fmt.Sprintf("HTTP %d: %s", status, msg))
+}
+
+// checkAuth lists models with the test token and expects the configured model
+func (s *SmokeTestService) checkAuth(ctx context.Context, settings SmokeTestSettings) SmokeTestStep {
+	step := SmokeTestStep{Name: SmokeStepAuth}
+	started := time.Now()
+	status, body, err := s.smokeRequest(ctx, settings, http.MethodGet, "/v1/models", nil)
+	step.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		step.Message = truncateProbeMessage(err.Error())
+		return step
+	}
+	if status != http.StatusOK {
+		step.Message = smokeErrorMessage(status, body)
+		return step
+	}
+	var payload struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		step.Message = "模型列表解析失败: " + err.Error()
+		return step
+	}
+	for _, m := range payload.Data {
+		if m.ID == settings.Model {
+			step.Success = true
+			step.Message = fmt.Sprintf("令牌可用，共 %d 个模型", len(payload.Data))
+			return step
+		}
+	}
+	step.Message = fmt.Sprintf("令牌可用，但无权访问模型 %s", settings.Model)
+	return step
+}
+
+// checkCompletion sends a tiny non-streaming chat completion
+func (s *SmokeTestService) checkCompletion(ctx context.Context, settings SmokeTestSettings) SmokeTestStep {
+	step := SmokeTestStep{Name: SmokeStepCompletion}
+	started := time.Now()
+	status, body, err := s.smokeRequest(ctx, settings, http.MethodPost, "/v1/chat/completions", map[string]interface{}{
+		"model":      settings.Model,
+		"messages":   []map[string]string{{"role": "user", "content": settings.Prompt}},
+		"max_tokens": settings.MaxTokens,
+		"stream":     false,
+	})
+	step.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		step.Message = truncateProbeMessage(err.Error())
+		return step
+	}
+	if status != http.StatusOK {
+		step.Message = smokeErrorMessage(status, body)
+		return step
+	}
+	var payload struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   struct {
+			TotalTokens int64 `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || len(payload.Choices) == 0 {
+		step.Message = truncateProbeMessage("响应中没有 choices: " + string(body))
+		return step
+	}
+	step.Success = true
+	step.Message = fmt.Sprintf("%s 返回 %d tokens", settings.Model, payload.Usage.TotalTokens)
+	return step
+}
+
+func (s *SmokeTestService) lastLogID(tokenID int64) (int64, error) {
+	row, err := s.logDB.QueryOne(s.logDB.RebindQuery(`SELECT COALESCE(MAX(id), 0) AS id FROM logs WHERE token_id = ?`), tokenID)
+	if err != nil {
+		return 0, fmt.Errorf("查询日志失败: %v", err)
+	}
+	if row == nil {
+		return 0, nil
+	}
+	return toInt64(row["id"]), nil
+}
+
+// checkLog waits for the consume log of the completion (id > afterID).
+// Returns the logged quota, or -1 when no log was found.
+func (s *SmokeTestService) checkLog(ctx context.Context, settings SmokeTestSettings, tokenID, afterID, since int64) (SmokeTestStep, int64) {
+	step := SmokeTestStep{Name: SmokeStepLog}
+	started := time.Now()
+	deadline := started.Add(time.Duration(settings.WaitSeconds) * time.Second)
+	query := s.logDB.RebindQuery(`
+		SELECT id, COALESCE(quota, 0) AS quota, model_name FROM logs
+		WHERE token_id = ? AND type = ` + ltConsume() + ` AND id > ? AND created_at >= ?
+		ORDER BY id DESC LIMIT 1`)
+	for {
+		row, err := s.logDB.QueryOne(query, tokenID, afterID, since)
+		if err != nil {
+			step.Message = "查询日志失败: " + err.Error()
+			return step, -1
+		}
+		if row != nil {
+			step.Success = true
+			step.LatencyMs = time.Since(started).Milliseconds()
+			step.Message = fmt.Sprintf("日志 #%d（%s，额度 %d）", toInt64(row["id"]), toString(row["model_name"]), toInt64(row["quota"]))
+			return step, toInt64(row["quota"])
+		}
+		if !sleepUntilNextPoll(ctx, deadline) {
+			break
+		}
+	}
+	step.LatencyMs = time.Since(started).Milliseconds()
+	step.Message = fmt.Sprintf("%d 秒内未出现令牌 #%d 的消费日志", settings.WaitSeconds, tokenID)
+	return step, -1
+}
+
+// checkQuota waits for the token owner's quota to drop below the baseline;
+// NewAPI may batch quota writes, so it is polled like the log
+func (s *SmokeTestService) checkQuota(ctx context.Context, settings SmokeTestSettings, userID, before int64) SmokeTestStep {
+	step := SmokeTestStep{Name: SmokeStepQuota}
+	started := time.Now()
+	deadline := started.Add(time.Duration(settings.WaitSeconds) * time.Second)
+	after := before
+	for {
+		quota, err := s.userQuota(userID)
+		if err != nil {
+			step.Message = err.Error()
+			return step
+		}
+		after = quota
+		if after < before {
+			step.Success = true
+			step.LatencyMs = time.Since(started).Milliseconds()
+			step.Message = fmt.Sprintf("用户 #%d 额度 %d → %d", userID, before, after)
+			return step
+		}
+		if !sleepUntilNextPoll(ctx, deadline) {
+			break
+		}
+	}
+	step.LatencyMs = time.Since(started).Milliseconds()
+	step.Message = fmt.Sprintf("%d 秒内用户 #%d 额度未减少（%d → %d）", settings.WaitSeconds, userID, before, after)
+	return step
+}
+
+// sleepUntilNextPoll waits one poll interval; false once the deadline passed
+// or ctx is done
+func sleepUntilNextPoll(ctx context.Context, deadline time.Time) bool {
+	if !time.Now().Add(smokeTestPollInterval).Before(deadline) {
+		return false
+	}
+	select {
+	case <-time.After(smokeTestPollInterval):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// record stores the run, then alerts when this run brings the consecutive
+// failures to the threshold or ends an alerted failure streak
+func (s *SmokeTestService) record(ctx context.Context, settings SmokeTestSettings, run *SmokeTestRun) error {
+	store, err := openLocalStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := ensureSmokeTestTables(ctx, store); err != nil {
+		return err
+	}
+
+	// 之前连续失败的次数（不含本次）
+	prevFailures := 0
+	rows, err := store.QueryContext(ctx, `SELECT success FROM smoke_test_runs ORDER BY id DESC LIMIT ?`, settings.FailureThreshold)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var success int
+		if err := rows.Scan(&success); err != nil {
+			rows.Close()
+			return err
+		}
+		if success == 1 {
+			break
+		}
+		prevFailures++
+	}
+	rows.Close()
+
+	event := ""
+	if !run.Success && prevFailures+1 == settings.FailureThreshold {
+		event = "failed"
+	} else if run.Success && prevFailures >= settings.FailureThreshold {
+		event = "recovered"
+	}
+	run.Alerted = event != ""
+
+	steps, _ := json.Marshal(run.Steps)
+	res, err := store.ExecContext(ctx, `
+		INSERT INTO smoke_test_runs (trigger_type, success, failed_step, steps, duration_ms, alerted, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.Trigger, boolToInt(run.Success), run.FailedStep, string(steps), run.DurationMs, boolToInt(run.Alerted), run.CreatedAt)
+	if err != nil {
+		return err
+	}
+	run.ID, _ = res.LastInsertId()
+	if _, err := store.ExecContext(ctx, `DELETE FROM smoke_test_runs WHERE created_at < ?`,
+		time.Now().Add(-smokeTestRunRetention).Unix()); err != nil {
+		return err
+	}
+
+	if event == "" {
+		return nil
+	}
+	payload := map[string]interface{}{
+		"status":      event,
+		"run_id":      run.ID,
+		"failed_step": run.FailedStep,
+		"failures":    prevFailures + 1,
+		"steps":       run.Steps,
+	}
+	if event == "recovered" {
+		payload["failures"] = prevFailures
+		logger.L.Business(fmt.Sprintf("[冒烟测试] 已恢复（此前连续失败 %d 次）", prevFailures))
+	} else {
+		logger.L.Warn(fmt.Sprintf("[冒烟测试] 连续失败 %d 次，失败步骤: %s", prevFailures+1, run.FailedStep), logger.CatSystem)
+	}
+	PublishEvent(EventSmokeTest, payload)
+	if settings.WebhookURL != "" {
+		if err := postSmokeTestWebhook(ctx, settings, payload); err != nil {
+			logger.L.Warn("[冒烟测试] webhook 发送失败: "+err.Error(), logger.CatSystem)
+		}
+	}
+	return nil
+}
+
+// postSmokeTestWebhook delivers the alert to the configured webhook
+func postSmokeTestWebhook(ctx context.Context, settings SmokeTestSettings, payload map[string]interface{}) error {
+	return postSignedWebhook(ctx, settings.WebhookURL, settings.WebhookSecret, "NewAPI-Tools/smoke-tests", map[string]interface{}{
+		"event":     EventSmokeTest,
+		"data":      payload,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// ListRuns returns recent runs (newest first) with the current failure streak
+func (s *SmokeTestService) ListRuns(ctx context.Context, limit int) (map[string]interface{}, error) {
+	if limit <= 0 {
+		limit = defaultSmokeTestRunLimit
+	}
+	if limit > maxSmokeTestRunLimit {
+		limit = maxSmokeTestRunLimit
+	}
+	settings, err := loadSmokeTestSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if err := ensureSmokeTestTables(ctx, store); err != nil {
+		return nil, err
+	}
+
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, trigger_type, success, failed_step, steps, duration_ms, alerted, created_at
+		FROM smoke_test_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []SmokeTestRun{}
+	for rows.Next() {
+		var r SmokeTestRun
+		var success, alerted int
+		var steps string
+		if err := rows.Scan(&r.ID, &r.Trigger, &success, &r.FailedStep, &steps, &r.DurationMs, &alerted, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Success, r.Alerted = success == 1, alerted == 1
+		if err := json.Unmarshal([]byte(steps), &r.Steps); err != nil || r.Steps == nil {
+			r.Steps = []SmokeTestStep{}
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	failures := 0
+	for _, r := range runs {
+		if r.Success {
+			break
+		}
+		failures++
+	}
+	var lastRun interface{}
+	if len(runs) > 0 {
+		lastRun = runs[0]
+	}
+	return map[string]interface{}{
+		"configured":           s.configured(settings),
+		"enabled":              settings.Enabled,
+		"consecutive_failures": failures,
+		"last_run":             lastRun,
+		"runs":                 runs,
+	}, nil
+}
+
+func ensureSmokeTestTables(ctx context.Context, db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS smoke_test_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			trigger_type TEXT NOT NULL DEFAULT '',
+			success INTEGER NOT NULL DEFAULT 0,
+			failed_step TEXT NOT NULL DEFAULT '',
+			steps TEXT NOT NULL DEFAULT '[]',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			alerted INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_smoke_test_runs_created ON smoke_test_runs(created_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestNormalizeSmokeTestSettings(t *testing.T) {
+	s := SmokeTestSettings{Steps: []string{"quota", " AUTH ", "auth"}, BaseURL: "http://newapi:3000/"}
+	if err := normalizeSmokeTestSettings(&s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Steps) != 2 || s.Steps[0] != SmokeStepAuth || s.Steps[1] != SmokeStepQuota || s.BaseURL != "http://newapi:3000" {
+		t.Errorf("normalized = %+v", s)
+	}
+	for _, bad := range []SmokeTestSettings{
+		{Steps: []string{"billing"}},
+		{Steps: []string{}},
+		{WebhookURL: "ftp://example.com"},
+	} {
+		if err := normalizeSmokeTestSettings(&bad); !errors.Is(err, ErrInvalidSmokeTest) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+}
+
+func TestSmokeTestRun(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	origPoll := smokeTestPollInterval
+	smokeTestPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { smokeTestPollInterval = origPoll })
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, quota INTEGER);
+		INSERT INTO users VALUES (7, 'smoke', 100000);
+		CREATE TABLE tokens (id INTEGER PRIMARY KEY, user_id INTEGER, "key" TEXT, remain_quota INTEGER, unlimited_quota INTEGER, deleted_at INTEGER);
+		INSERT INTO tokens VALUES (3, 7, 'abc123', 0, 1, NULL);
+		CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, token_id INTEGER, type INTEGER, quota INTEGER, model_name TEXT, created_at INTEGER);`); err != nil {
+		t.Fatal(err)
+	}
+
+	billing, completionStatus := true, http.StatusOK
+	var webhooks []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hook":
+			webhooks = append(webhooks, r.Header.Get("X-Signature"))
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"无效的令牌"}}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/models":
+			w.Write([]byte(`{"data":[{"id":"gpt-4o-mini"},{"id":"other"}]}`))
+		case "/v1/chat/completions":
+			if completionStatus != http.StatusOK {
+				w.WriteHeader(completionStatus)
+				w.Write([]byte(`{"error":{"message":"upstream down"}}`))
+				return
+			}
+			if billing {
+				db.Exec(`INSERT INTO logs (user_id, token_id, type, quota, model_name, created_at) VALUES (7, 3, 2, 150, 'gpt-4o-mini', ?)`, time.Now().Unix())
+				db.Exec(`UPDATE users SET quota = quota - 150 WHERE id = 7`)
+			}
+			w.Write([]byte(`{"choices":[{"message":{"content":"pong"}}],"usage":{"total_tokens":9}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	svc := NewSmokeTestService()
+	ctx := context.Background()
+	if _, err := svc.Run(ctx, "manual"); !errors.Is(err, ErrSmokeTestNotConfigured) {
+		t.Fatalf("unconfigured run: %v", err)
+	}
+	enabled := true
+	if _, err := svc.UpdateSettings(ctx, SmokeTestSettingsInput{Enabled: &enabled}); !errors.Is(err, ErrInvalidSmokeTest) {
+		t.Errorf("enabling without a token: %v", err)
+	}
+	base, token, model, wait, threshold := srv.URL, "sk-abc123", "gpt-4o-mini", 1, 2
+	hook, secret := srv.URL+"/hook", "s3cret"
+	settings, err := svc.UpdateSettings(ctx, SmokeTestSettingsInput{
+		BaseURL: &base, Token: &token, Model: &model, WaitSeconds: &wait,
+		FailureThreshold: &threshold, WebhookURL: &hook, WebhookSecret: &secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Token != "" || !settings.HasToken || settings.WebhookSecret != "" || !settings.HasWebhookSecret {
+		t.Errorf("settings view leaks secrets: %+v", settings)
+	}
+
+	run, err := svc.Run(ctx, "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run.Success || len(run.Steps) != 4 || run.Alerted {
+		t.Fatalf("healthy run = %+v", run)
+	}
+	if q := run.Steps[3]; !q.Success || q.Message != "用户 #7 额度 100000 → 99850" {
+		t.Errorf("quota step = %+v", q)
+	}
+
+	// Requests go through but are neither logged nor billed: the log step fails
+	billing = false
+	if run, _ = svc.Run(ctx, "schedule"); run.Success || run.FailedStep != SmokeStepLog || run.Alerted {
+		t.Fatalf("unlogged run = %+v", run)
+	}
+	if !run.Steps[3].Skipped {
+		t.Errorf("quota step after a failed log step = %+v", run.Steps[3])
+	}
+	// The second consecutive failure reaches the threshold and alerts once
+	completionStatus = http.StatusBadGateway
+	if run, _ = svc.Run(ctx, "schedule"); run.FailedStep != SmokeStepCompletion || !run.Alerted || run.Steps[1].Message != "HTTP 502: upstream down" {
+		t.Fatalf("alerting run = %+v", run)
+	}
+	if run, _ = svc.Run(ctx, "schedule"); run.Alerted {
+		t.Errorf("alerted twice in one streak: %+v", run)
+	}
+	billing, completionStatus = true, http.StatusOK
+	if run, _ = svc.Run(ctx, "schedule"); !run.Success || !run.Alerted {
+		t.Errorf("recovery run = %+v", run)
+	}
+	if len(webhooks) != 2 || webhooks[0] == "" {
+		t.Errorf("webhooks = %v", webhooks)
+	}
+
+	data, err := svc.ListRuns(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := data["runs"].([]SmokeTestRun)
+	if len(runs) != 5 || runs[0].ID != run.ID || data["consecutive_failures"] != 0 || len(runs[2].Steps) != 4 {
+		t.Errorf("list = %+v", data)
+	}
+	if due, err := svc.RunIfDue(ctx); due != nil || err != nil {
+		t.Errorf("disabled suite ran: %+v %v", due, err)
+	}
+}
@@ -0,0 +1,771 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const statusPageSettingsKey = "status_page"
+
+var statusPageCacheKey = cache.Key("status_page:data")
+
+var (
+	ErrStatusIncidentNotFound = errors.New("status incident not found")
+	ErrInvalidStatusPage      = errors.New("invalid status page")
+)
+
+// Incident severities, from least to most severe
+const (
+	IncidentSeverityMaintenance = "maintenance"
+	IncidentSeverityMinor       = "minor"
+	IncidentSeverityMajor       = "major"
+)
+
+var IncidentSeverities = []string{IncidentSeverityMaintenance, IncidentSeverityMinor, IncidentSeverityMajor}
+
+// Overall status of the page
+const (
+	StatusPageOperational = "operational"
+	StatusPageMaintenance = "maintenance"
+	StatusPageDegraded    = "degraded"
+	StatusPageMajorOutage = "major_outage"
+)
+
+const (
+	statusPageMaxModels    = 50
+	statusPageMaxIncidents = 50
+	// statusPageCurrentWindow is how far back the per-model current status looks
+	statusPageCurrentWindow = 3600
+	// statusPageMaintenanceAhead is how far ahead scheduled maintenance is announced
+	statusPageMaintenanceAhead = 7 * 86400
+)
+
+// StatusPagePath is the path of the public HTML status page under BASE_PATH
+func StatusPagePath() string {
+	return config.BasePath() + "/api/public/status/page"
+}
+
+// StatusPageSettings 公开状态页配置。与嵌入访问令牌相互独立：
+// 状态页只读取本地可用率快照与公告，不开放任何管理接口。
+type StatusPageSettings struct {
+	Enabled     bool     `json:"enabled"` // 关闭时公开接口返回 404
+	Title       string   `json:"title"`   // "" 使用站点标题
+	Description string   `json:"description"`
+	LogoURL     string   `json:"logo_url"`
+	Profile     string   `json:"profile"`      // 嵌入主题配置名，"" 使用全局主题
+	Models      []string `json:"models"`       // 为空时使用已选模型
+	HistoryDays int      `json:"history_days"` // 可用率条形历史天数 7-90
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+// StatusPageSettingsInput supports partial update of StatusPageSettings
+type StatusPageSettingsInput struct {
+	Enabled     *bool     `json:"enabled"`
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	LogoURL     *string   `json:"logo_url"`
+	Profile     *string   `json:"profile"`
+	Models      *[]string `json:"models"`
+	HistoryDays *int      `json:"history_days"`
+}
+
+// StatusIncident is an incident annotation shown on the status page.
+// Models empty means the incident affects every model.
+type StatusIncident struct {
+	ID         int64    `json:"id"`
+	Title      string   `json:"title"`
+	Message    string   `json:"message"`
+	Severity   string   `json:"severity"`
+	Models     []string `json:"models"`
+	StartedAt  int64    `json:"started_at"`
+	ResolvedAt int64    `json:"resolved_at"` // 0 表示仍在进行
+	CreatedBy  string   `json:"created_by,omitempty"`
+	CreatedAt  int64    `json:"created_at"`
+	UpdatedAt  int64    `json:"updated_at"`
+}
+
+// StatusIncidentInput creates or partially updates an incident
+type StatusIncidentInput struct {
+	Title      *string   `json:"title"`
+	Message    *string   `json:"message"`
+	Severity   *string   `json:"severity"`
+	Models     *[]string `json:"models"`
+	StartedAt  *int64    `json:"started_at"`
+	ResolvedAt *int64    `json:"resolved_at"`
+}
+
+// StatusPageBar is one day of a model's uptime history with the incidents
+// that overlap it
+type StatusPageBar struct {
+	ModelUptimeDay
+	Incidents []int64 `json:"incidents,omitempty"`
+}
+
+// StatusPageModel is one model row of the status page
+type StatusPageModel struct {
+	ModelName string          `json:"model_name"`
+	Status    string          `json:"status"` // 最近一小时：green / yellow / red / none，维护中为 maintenance
+	Uptime    *float64        `json:"uptime"` // history_days 内
+	Uptime30d *float64        `json:"uptime_30d"`
+	Uptime90d *float64        `json:"uptime_90d"`
+	Bars      []StatusPageBar `json:"bars"`
+}
+
+// StatusPageMaintenanceWindow is a current or upcoming maintenance window as
+// shown publicly: only the page's models, no channel ids
+type StatusPageMaintenanceWindow struct {
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Models   []string `json:"models"`
+	StartsAt int64    `json:"starts_at"`
+	EndsAt   int64    `json:"ends_at"`
+	Active   bool     `json:"active"`
+}
+
+// StatusPage is the payload of the public status page
+type StatusPage struct {
+	Title         string                        `json:"title"`
+	Description   string                        `json:"description"`
+	LogoURL       string                        `json:"logo_url"`
+	Theme         map[string]interface{}        `json:"theme"`
+	OverallStatus string                        `json:"overall_status"`
+	HistoryDays   int                           `json:"history_days"`
+	Models        []StatusPageModel             `json:"models"`
+	Incidents     []StatusIncident              `json:"incidents"`
+	Maintenance   []StatusPageMaintenanceWindow `json:"maintenance"`
+	GeneratedAt   int64                         `json:"generated_at"`
+}
+
+func defaultStatusPageSettings() StatusPageSettings {
+	return StatusPageSettings{Models: []string{}, HistoryDays: maxUptimeHistoryDays}
+}
+
+func normalizeStatusPageSettings(s *StatusPageSettings) error {
+	s.Title = strings.TrimSpace(s.Title)
+	if len([]rune(s.Title)) > 64 {
+		return fmt.Errorf("%w: title 最多 64 个字符", ErrInvalidStatusPage)
+	}
+	s.Description = strings.TrimSpace(s.Description)
+	if len([]rune(s.Description)) > 500 {
+		return fmt.Errorf("%w: description 最多 500 个字符", ErrInvalidStatusPage)
+	}
+	s.LogoURL = strings.TrimSpace(s.LogoURL)
+	if s.LogoURL != "" {
+		u, err := url.Parse(s.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(s.LogoURL) > 500 {
+			return fmt.Errorf("%w: logo_url 必须是 http(s) 地址", ErrInvalidStatusPage)
+		}
+	}
+	s.Profile = strings.ToLower(strings.TrimSpace(s.Profile))
+	models := []string{}
+	for _, m := range s.Models {
+		if m = strings.TrimSpace(m); m != "" {
+			models = appendUniqueString(models, m)
+		}
+	}
+	if len(models) > statusPageMaxModels {
+		return fmt.Errorf("%w: 最多 %d 个模型", ErrInvalidStatusPage, statusPageMaxModels)
+	}
+	s.Models = models
+	s.HistoryDays = clampSetting(s.HistoryDays, 7, maxUptimeHistoryDays, maxUptimeHistoryDays)
+	return nil
+}
+
+func normalizeStatusIncident(in *StatusIncident, now int64) error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" || len([]rune(in.Title)) > 100 {
+		return fmt.Errorf("%w: title 不能为空且最多 100 个字符", ErrInvalidStatusPage)
+	}
+	in.Message = strings.TrimSpace(in.Message)
+	if len([]rune(in.Message)) > 2000 {
+		return fmt.Errorf("%w: message 最多 2000 个字符", ErrInvalidStatusPage)
+	}
+	if in.Severity == "" {
+		in.Severity = IncidentSeverityMinor
+	}
+	if !containsStr(IncidentSeverities, in.Severity) {
+		return fmt.Errorf("%w: severity 只能是 %s", ErrInvalidStatusPage, strings.Join(IncidentSeverities, "、"))
+	}
+	models := []string{}
+	for _, m := range in.Models {
+		if m = strings.TrimSpace(m); m != "" {
+			models = appendUniqueString(models, m)
+		}
+	}
+	in.Models = models
+	if in.StartedAt <= 0 {
+		in.StartedAt = now
+	}
+	if in.ResolvedAt < 0 || (in.ResolvedAt > 0 && in.ResolvedAt < in.StartedAt) {
+		return fmt.Errorf("%w: resolved_at 不能早于 started_at", ErrInvalidStatusPage)
+	}
+	return nil
+}
+
+// affects reports whether the incident concerns model
+func (in StatusIncident) affects(model string) bool {
+	return len(in.Models) == 0 || containsStr(in.Models, model)
+}
+
+// StatusPageService publishes selected models' uptime and incident notes as
+// a public status page. The page is built only from the local uptime
+// snapshots and is cached, so anonymous callers never query NewAPI's database.
+type StatusPageService struct {
+	status *ModelStatusService
+}
+
+// NewStatusPageService creates a StatusPageService on the primary instance
+func NewStatusPageService() *StatusPageService {
+	return &StatusPageService{status: NewModelStatusService()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *StatusPageService) WithContext(ctx context.Context) *StatusPageService {
+	c := *s
+	c.status = s.status.WithContext(ctx)
+	return &c
+}
+
+func ensureStatusPageTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS status_incidents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			severity TEXT NOT NULL,
+			models TEXT NOT NULL DEFAULT '[]',
+			started_at INTEGER NOT NULL,
+			resolved_at INTEGER NOT NULL DEFAULT 0,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_status_incidents_started ON status_incidents(started_at)`)
+	return err
+}
+
+func openStatusPageStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureStatusPageTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// invalidate drops the cached public page after a config or incident change
+func (s *StatusPageService) invalidate() {
+	_, _ = cache.Get().DeleteByPrefix(cache.Key("status_page:"))
+}
+
+// GetSettings returns the status page settings (defaults if never saved)
+func (s *StatusPageService) GetSettings(ctx context.Context) (StatusPageSettings, error) {
+	settings := defaultStatusPageSettings()
+	if _, err := loadLocalSetting(ctx, statusPageSettingsKey, &settings); err != nil {
+		return settings, err
+	}
+	if err := normalizeStatusPageSettings(&settings); err != nil {
+		return defaultStatusPageSettings(), nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings applies a partial update; the theme profile must exist
+func (s *StatusPageService) UpdateSettings(ctx context.Context, in StatusPageSettingsInput) (StatusPageSettings, error) {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return settings, err
+	}
+	if in.Enabled != nil {
+		settings.Enabled = *in.Enabled
+	}
+	if in.Title != nil {
+		settings.Title = *in.Title
+	}
+	if in.Description != nil {
+		settings.Description = *in.Description
+	}
+	if in.LogoURL != nil {
+		settings.LogoURL = *in.LogoURL
+	}
+	if in.Profile != nil {
+		settings.Profile = *in.Profile
+	}
+	if in.Models != nil {
+		settings.Models = *in.Models
+	}
+	if in.HistoryDays != nil {
+		settings.HistoryDays = *in.HistoryDays
+	}
+	if err := normalizeStatusPageSettings(&settings); err != nil {
+		return settings, err
+	}
+	if settings.Profile != "" {
+		if _, err := s.status.GetEmbedProfile(ctx, settings.Profile); errors.Is(err, ErrEmbedProfileNotFound) {
+			return settings, fmt.Errorf("%w: 嵌入主题配置 %q 不存在", ErrInvalidStatusPage, settings.Profile)
+		} else if err != nil {
+			return settings, err
+		}
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, statusPageSettingsKey, settings); err != nil {
+		return settings, err
+	}
+	s.invalidate()
+	return settings, nil
+}
+
+func scanStatusIncidents(rows *sql.Rows) ([]StatusIncident, error) {
+	defer rows.Close()
+	incidents := []StatusIncident{}
+	for rows.Next() {
+		var in StatusIncident
+		var models string
+		if err := rows.Scan(&in.ID, &in.Title, &in.Message, &in.Severity, &models, &in.StartedAt, &in.ResolvedAt,
+			&in.CreatedBy, &in.CreatedAt, &in.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(models), &in.Models); err != nil || in.Models == nil {
+			in.Models = []string{}
+		}
+		incidents = append(incidents, in)
+	}
+	return incidents, rows.Err()
+}
+
+const statusIncidentColumns = `id, title, message, severity, models, started_at, resolved_at, created_by, created_at, updated_at`
+
+// ListIncidents returns incidents, newest first; since > 0 keeps only those
+// still ongoing or resolved after since
+func (s *StatusPageService) ListIncidents(ctx context.Context, since int64, limit int) ([]StatusIncident, error) {
+	db, err := openStatusPageStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+statusIncidentColumns+` FROM status_incidents
+		WHERE resolved_at = 0 OR resolved_at >= ?
+		ORDER BY started_at DESC, id DESC LIMIT ?`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanStatusIncidents(rows)
+}
+
+func (s *StatusPageService) getIncident(ctx context.Context, db *sql.DB, id int64) (StatusIncident, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+statusIncidentColumns+` FROM status_incidents WHERE id = ?`, id)
+	if err != nil {
+		return StatusIncident{}, err
+	}
+	incidents, err := scanStatusIncidents(rows)
+	if err != nil {
+		return StatusIncident{}, err
+	}
+	if len(incidents) == 0 {
+		return StatusIncident{}, ErrStatusIncidentNotFound
+	}
+	return incidents[0], nil
+}
+
+func applyStatusIncidentInput(in *StatusIncident, input StatusIncidentInput) {
+	if input.Title != nil {
+		in.Title = *input.Title
+	}
+	if input.Message != nil {
+		in.Message = *input.Message
+	}
+	if input.Severity != nil {
+		in.Severity = strings.ToLower(strings.TrimSpace(*input.Severity))
+	}
+	if input.Models != nil {
+		in.Models = *input.Models
+	}
+	if input.StartedAt != nil {
+		in.StartedAt = *input.StartedAt
+	}
+	if input.ResolvedAt != nil {
+		in.ResolvedAt = *input.ResolvedAt
+	}
+}
+
+// CreateIncident records a new incident annotation
+func (s *StatusPageService) CreateIncident(ctx context.Context, input StatusIncidentInput, operator string) (StatusIncident, error) {
+	var in StatusIncident
+	applyStatusIncidentInput(&in, input)
+	now := time.Now().Unix()
+	if err := normalizeStatusIncident(&in, now); err != nil {
+		return in, err
+	}
+	in.CreatedBy, in.CreatedAt, in.UpdatedAt = operator, now, now
+
+	db, err := openStatusPageStore(ctx)
+	if err != nil {
+		return in, err
+	}
+	defer db.Close()
+	models, _ := json.Marshal(in.Models)
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO status_incidents (title, message, severity, models, started_at, resolved_at, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		in.Title, in.Message, in.Severity, string(models), in.StartedAt, in.ResolvedAt, in.CreatedBy, in.CreatedAt, in.UpdatedAt)
+	if err != nil {
+		return in, err
+	}
+	in.ID, _ = res.LastInsertId()
+	s.invalidate()
+	logger.L.Business(fmt.Sprintf("[状态页] %s 发布事件 #%d [%s] %s", operator, in.ID, in.Severity, in.Title))
+	return in, nil
+}
+
+// UpdateIncident applies a partial update, e.g. setting resolved_at
+func (s *StatusPageService) UpdateIncident(ctx context.Context, id int64, input StatusIncidentInput) (StatusIncident, error) {
+	db, err := openStatusPageStore(ctx)
+	if err != nil {
+		return StatusIncident{}, err
+	}
+	defer db.Close()
+	in, err := s.getIncident(ctx, db, id)
+	if err != nil {
+		return in, err
+	}
+	applyStatusIncidentInput(&in, input)
+	now := time.Now().Unix()
+	if err := normalizeStatusIncident(&in, now); err != nil {
+		return in, err
+	}
+	in.UpdatedAt = now
+	models, _ := json.Marshal(in.Models)
+	if _, err := db.ExecContext(ctx, `
+		UPDATE status_incidents SET title = ?, message = ?, severity = ?, models = ?, started_at = ?, resolved_at = ?, updated_at = ?
+		WHERE id = ?`,
+		in.Title, in.Message, in.Severity, string(models), in.StartedAt, in.ResolvedAt, in.UpdatedAt, id); err != nil {
+		return in, err
+	}
+	s.invalidate()
+	return in, nil
+}
+
+// DeleteIncident removes an incident annotation
+func (s *StatusPageService) DeleteIncident(ctx context.Context, id int64) error {
+	db, err := openStatusPageStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.ExecContext(ctx, `DELETE FROM status_incidents WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStatusIncidentNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// currentUptimeStatus colors each model by its snapshot slots of the last hour
+func currentUptimeStatus(ctx context.Context, models []string, now time.Time) (map[string]string, error) {
+	status := make(map[string]string, len(models))
+	if len(models) == 0 {
+		return status, nil
+	}
+	store, err := openModelUptimeStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	args := []interface{}{now.Unix() - statusPageCurrentWindow}
+	for _, m := range models {
+		args = append(args, m)
+	}
+	rows, err := store.QueryContext(ctx, `
+		SELECT model_name, SUM(requests), SUM(success) FROM model_uptime_slots
+		WHERE slot_start >= ? AND model_name IN (`+placeholders(len(models))+`)
+		GROUP BY model_name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var requests, success int64
+		if err := rows.Scan(&name, &requests, &success); err != nil {
+			return nil, err
+		}
+		if requests > 0 {
+			status[name] = getStatusColor(float64(success)/float64(requests)*100, requests)
+		}
+	}
+	return status, rows.Err()
+}
+
+// GetStatusPage builds the public page for settings, cached for a minute
+func (s *StatusPageService) GetStatusPage(ctx context.Context, settings StatusPageSettings) (*StatusPage, error) {
+	var cached StatusPage
+	if found, _ := cache.Get().GetJSON(statusPageCacheKey, &cached); found {
+		return &cached, nil
+	}
+
+	theme, err := s.status.ResolveEmbedTheme(ctx, settings.Profile)
+	if errors.Is(err, ErrEmbedProfileNotFound) {
+		theme, err = s.status.ResolveEmbedTheme(ctx, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	title := settings.Title
+	if title == "" {
+		title = s.status.GetSiteTitle()
+	}
+	if title == "" {
+		title = "服务状态"
+	}
+	models := settings.Models
+	if len(models) == 0 {
+		models = s.status.GetSelectedModels()
+	}
+	if len(models) > statusPageMaxModels {
+		models = models[:statusPageMaxModels]
+	}
+
+	now := reportNow()
+	firstDay := reportDayStart(now).AddDate(0, 0, -(settings.HistoryDays - 1))
+	incidents, err := s.ListIncidents(ctx, firstDay.Unix(), statusPageMaxIncidents)
+	if err != nil {
+		return nil, err
+	}
+	for i := range incidents {
+		incidents[i].CreatedBy = ""
+	}
+	summaries, err := s.status.GetUptimeSummary(ctx, models)
+	if err != nil {
+		return nil, err
+	}
+	summaryByModel := make(map[string]ModelUptimeSummary, len(summaries))
+	for _, sm := range summaries {
+		summaryByModel[sm.ModelName] = sm
+	}
+	current, err := currentUptimeStatus(ctx, models, now)
+	if err != nil {
+		return nil, err
+	}
+
+	maintenance := loadMaintenanceSchedule(ctx, now.Unix(), now.Unix()+statusPageMaintenanceAhead)
+
+	page := &StatusPage{Title: title, Description: settings.Description, LogoURL: settings.LogoURL, Theme: theme,
+		HistoryDays: settings.HistoryDays, Models: make([]StatusPageModel, 0, len(models)), Incidents: incidents,
+		Maintenance: []StatusPageMaintenanceWindow{}, GeneratedAt: now.Unix()}
+	for _, w := range maintenance {
+		pm := StatusPageMaintenanceWindow{Title: w.Title, Message: w.Message, Models: []string{},
+			StartsAt: w.StartsAt, EndsAt: w.EndsAt, Active: w.Active}
+		for _, m := range w.Models {
+			if containsStr(models, m) {
+				pm.Models = append(pm.Models, m)
+			}
+		}
+		if len(pm.Models) > 0 {
+			page.Maintenance = append(page.Maintenance, pm)
+		}
+	}
+	sort.Slice(page.Maintenance, func(i, j int) bool { return page.Maintenance[i].StartsAt < page.Maintenance[j].StartsAt })
+	for _, name := range models {
+		history, err := s.status.GetUptimeHistory(ctx, name, settings.HistoryDays)
+		if err != nil {
+			return nil, err
+		}
+		m := StatusPageModel{ModelName: name, Status: "none", Uptime: history.Uptime,
+			Bars: make([]StatusPageBar, 0, len(history.Bars))}
+		if c, ok := current[name]; ok {
+			m.Status = c
+		}
+		if maintenance.modelDuring(name, now.Unix(), now.Unix()+1) {
+			m.Status = StatusPageMaintenance
+		}
+		if sm, ok := summaryByModel[name]; ok {
+			m.Uptime30d, m.Uptime90d = sm.Uptime30d, sm.Uptime90d
+		}
+		for _, d := range history.Bars {
+			bar := StatusPageBar{ModelUptimeDay: d}
+			if dayStart, err := time.ParseInLocation("2006-01-02", d.Date, ReportLocation()); err == nil {
+				dayEnd := dayStart.AddDate(0, 0, 1).Unix()
+				for _, in := range incidents {
+					end := in.ResolvedAt
+					if end == 0 {
+						end = now.Unix()
+					}
+					if in.affects(name) && in.StartedAt < dayEnd && end >= dayStart.Unix() {
+						bar.Incidents = append(bar.Incidents, in.ID)
+					}
+				}
+			}
+			m.Bars = append(m.Bars, bar)
+		}
+		page.Models = append(page.Models, m)
+	}
+	page.OverallStatus = overallStatusPageStatus(page.Models, incidents)
+
+	cache.Get().Set(statusPageCacheKey, page, time.Minute)
+	return page, nil
+}
+
+// overallStatusPageStatus combines ongoing incidents with current model status
+func overallStatusPageStatus(models []StatusPageModel, incidents []StatusIncident) string {
+	rank := map[string]int{StatusPageOperational: 0, StatusPageMaintenance: 1, StatusPageDegraded: 2, StatusPageMajorOutage: 3}
+	overall := StatusPageOperational
+	raise := func(s string) {
+		if rank[s] > rank[overall] {
+			overall = s
+		}
+	}
+	for _, in := range incidents {
+		if in.ResolvedAt != 0 {
+			continue
+		}
+		switch in.Severity {
+		case IncidentSeverityMajor:
+			raise(StatusPageMajorOutage)
+		case IncidentSeverityMinor:
+			raise(StatusPageDegraded)
+		case IncidentSeverityMaintenance:
+			raise(StatusPageMaintenance)
+		}
+	}
+	for _, m := range models {
+		switch m.Status {
+		case StatusPageMaintenance:
+			raise(StatusPageMaintenance)
+		case "red":
+			raise(StatusPageMajorOutage)
+		case "yellow":
+			raise(StatusPageDegraded)
+		}
+	}
+	return overall
+}
+
+var statusPageLabels = map[string]string{
+	StatusPageOperational: "所有服务运行正常",
+	StatusPageMaintenance: "维护中",
+	StatusPageDegraded:    "部分服务性能下降",
+	StatusPageMajorOutage: "部分服务中断",
+	"green":               "正常",
+	"yellow":              "降级",
+	"red":                 "中断",
+	"none":                "暂无数据",
+	IncidentSeverityMajor: "重大故障",
+	IncidentSeverityMinor: "轻微故障",
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time":  func(ts int64) string { return time.Unix(ts, 0).In(ReportLocation()).Format("2006-01-02 15:04") },
+	"label": func(s string) string { return statusPageLabels[s] },
+	"pct": func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f%%", *v)
+	},
+	// 颜色与字体已在保存主题配置时按白名单校验
+	"css": func(v interface{}) template.CSS { return template.CSS(toString(v)) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN"><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.P.Title}}</title>
+<style>
+:root{--bg:#f8fafc;--card:#ffffff;--text:#0f172a;--muted:#64748b;--border:#e2e8f0;--primary:#2563eb;--accent:#2563eb}
+{{if eq .DarkMode "dark"}}:root{--bg:#0b1120;--card:#111827;--text:#e5e7eb;--muted:#94a3b8;--border:#1f2937}
+{{else if eq .DarkMode "auto"}}@media (prefers-color-scheme: dark){:root{--bg:#0b1120;--card:#111827;--text:#e5e7eb;--muted:#94a3b8;--border:#1f2937}}
+{{end}}:root{ {{- with .Colors.Primary}}--primary:{{css .}};{{end}}{{with .Colors.Accent}}--accent:{{css .}};{{end}}{{with .Colors.Background}}--bg:{{css .}};{{end}}{{with .Colors.Text}}--text:{{css .}};{{end -}} }
+body{margin:0;background:var(--bg);color:var(--text);font-family:{{if .Font}}{{css .Font}}{{else}}-apple-system,Segoe UI,Helvetica,Arial,sans-serif{{end}}}
+main{max-width:860px;margin:0 auto;padding:24px 16px}
+header{display:flex;align-items:center;gap:12px}header img{height:40px}
+h1{font-size:24px;margin:0}.muted{color:var(--muted)}
+.card{background:var(--card);border:1px solid var(--border);border-radius:10px;padding:16px;margin:16px 0}
+.overall{font-size:18px;font-weight:600;color:#fff;border:none}
+.overall.operational{background:#16a34a}.overall.maintenance{background:var(--primary)}.overall.degraded{background:#d97706}.overall.major_outage{background:#dc2626}
+.row{display:flex;justify-content:space-between;align-items:baseline;gap:8px}
+.bars{display:flex;gap:2px;margin:8px 0 4px}.bars span{flex:1;height:28px;border-radius:2px;background:var(--border)}
+.green{background:#22c55e!important}.dot.maintenance{background:var(--primary)}.yellow{background:#f59e0b!important}.red{background:#ef4444!important}
+.bars span.marked{outline:2px solid var(--accent);outline-offset:-2px}
+.dot{display:inline-block;width:10px;height:10px;border-radius:50%;margin-right:6px;background:var(--border)}
+.incident h3{margin:0 0 4px;font-size:16px}.incident p{white-space:pre-wrap;margin:8px 0 0}
+footer{font-size:12px;text-align:center}
+</style></head>
+<body data-theme="{{.Theme}}"><main>
+<header>{{if .P.LogoURL}}<img src="{{.P.LogoURL}}" alt="">{{end}}<h1>{{.P.Title}}</h1></header>
+{{if .P.Description}}<p class="muted">{{.P.Description}}</p>{{end}}
+<div class="card overall {{.P.OverallStatus}}">{{label .P.OverallStatus}}</div>
+{{range .P.Maintenance}}<div class="card incident"><h3>{{if .Active}}维护中{{else}}计划维护{{end}}：{{.Title}}</h3>
+<div class="muted">{{time .StartsAt}} ~ {{time .EndsAt}} · 影响 {{range $i, $m := .Models}}{{if $i}}、{{end}}{{$m}}{{end}}</div>{{if .Message}}<p>{{.Message}}</p>{{end}}</div>
+{{end}}
+{{range .Ongoing}}<div class="card incident"><h3>{{label .Severity}}：{{.Title}}</h3>
+<div class="muted">开始于 {{time .StartedAt}}{{if .Models}} · 影响 {{range $i, $m := .Models}}{{if $i}}、{{end}}{{$m}}{{end}}{{end}}</div>{{if .Message}}<p>{{.Message}}</p>{{end}}</div>
+{{end}}
+<div class="card">
+{{range .P.Models}}<div style="margin-bottom:18px">
+<div class="row"><div><span class="dot {{.Status}}"></span><b>{{.ModelName}}</b> <span class="muted">{{label .Status}}</span></div>
+<div class="muted">30 天 {{pct .Uptime30d}} · 90 天 {{pct .Uptime90d}}</div></div>
+<div class="bars">{{range .Bars}}<span class="{{.Status}}{{if .Incidents}} marked{{end}}" title="{{.Date}} {{pct .Uptime}}"></span>{{end}}</div>
+<div class="row muted" style="font-size:12px"><span>{{$.HistoryDays}} 天前</span><span>{{pct .Uptime}}</span><span>今天</span></div>
+</div>{{else}}<p class="muted">暂无监控的模型</p>{{end}}
+</div>
+{{if .Past}}<h2 style="font-size:18px">历史事件</h2>
+{{range .Past}}<div class="card incident"><h3>{{.Title}}</h3>
+<div class="muted">{{label .Severity}} · {{time .StartedAt}} ~ {{time .ResolvedAt}}</div>{{if .Message}}<p>{{.Message}}</p>{{end}}</div>
+{{end}}{{end}}
+<footer class="muted">更新于 {{time .P.GeneratedAt}}</footer>
+</main></body></html>`))
+
+// RenderStatusPage renders the page as self-contained HTML
+func RenderStatusPage(page *StatusPage) (string, error) {
+	data := map[string]interface{}{
+		"P": page, "HistoryDays": page.HistoryDays, "Theme": toString(page.Theme["theme"]),
+		"DarkMode": toString(page.Theme["dark_mode"]), "Font": toString(page.Theme["font"]),
+	}
+	// theme 可能来自缓存（JSON 反序列化后为 map）或直接为 EmbedThemeColors
+	var colors EmbedThemeColors
+	if raw, err := json.Marshal(page.Theme["colors"]); err == nil {
+		_ = json.Unmarshal(raw, &colors)
+	}
+	data["Colors"] = colors
+	var ongoing, past []StatusIncident
+	for _, in := range page.Incidents {
+		if in.ResolvedAt == 0 {
+			ongoing = append(ongoing, in)
+		} else {
+			past = append(past, in)
+		}
+	}
+	sort.SliceStable(ongoing, func(i, j int) bool {
+		return statusIncidentRank(ongoing[i].Severity) > statusIncidentRank(ongoing[j].Severity)
+	})
+	data["Ongoing"], data["Past"] = ongoing, past
+	var buf bytes.Buffer
+	err := statusPageTemplate.Execute(&buf, data)
+	return buf.String(), err
+}
+
+func statusIncidentRank(severity string) int {
+	for i, s := range IncidentSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
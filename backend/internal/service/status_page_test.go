@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestStatusPage(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+	t.Cleanup(func() {
+		cache.Get().DeleteByPrefix(cache.Key("model_status:uptime:"))
+		cache.Get().DeleteByPrefix(cache.Key("status_page:"))
+	})
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, model_name TEXT, type INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		typ := 2
+		if i == 0 {
+			typ = 5 // 3 / 4 succeeded: red
+		}
+		db.MustExec(`INSERT INTO logs (model_name, type, created_at) VALUES ('gpt-4o', ?, ?), ('claude', 2, ?)`,
+			typ, now.Unix()-600, now.Unix()-600)
+	}
+	if _, err := NewModelStatusService().snapshotUptimeAt(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewStatusPageService()
+	ctx := context.Background()
+	settings, err := svc.GetSettings(ctx)
+	if err != nil || settings.Enabled || settings.HistoryDays != 90 {
+		t.Fatalf("status page must be unpublished by default, got %+v %v", settings, err)
+	}
+	bad := "javascript:alert(1)"
+	if _, err := svc.UpdateSettings(ctx, StatusPageSettingsInput{LogoURL: &bad}); !errors.Is(err, ErrInvalidStatusPage) {
+		t.Errorf("logo_url must be http(s), got %v", err)
+	}
+	missing := "nope"
+	if _, err := svc.UpdateSettings(ctx, StatusPageSettingsInput{Profile: &missing}); !errors.Is(err, ErrInvalidStatusPage) {
+		t.Errorf("unknown profile must be rejected, got %v", err)
+	}
+	enabled, title, desc, days := true, "Acme 状态", "<script>x</script>", 7
+	models := []string{"gpt-4o", "claude", "gpt-4o"}
+	if settings, err = svc.UpdateSettings(ctx, StatusPageSettingsInput{Enabled: &enabled, Title: &title,
+		Description: &desc, Models: &models, HistoryDays: &days}); err != nil || len(settings.Models) != 2 {
+		t.Fatalf("UpdateSettings = %+v, %v", settings, err)
+	}
+
+	if _, err := svc.CreateIncident(ctx, StatusIncidentInput{}, "admin"); !errors.Is(err, ErrInvalidStatusPage) {
+		t.Errorf("empty title must be rejected, got %v", err)
+	}
+	incTitle, sev := "gpt-4o 上游超时", IncidentSeverityMinor
+	incident, err := svc.CreateIncident(ctx, StatusIncidentInput{Title: &incTitle, Severity: &sev, Models: &[]string{"gpt-4o"}}, "admin")
+	if err != nil || incident.ID == 0 || incident.StartedAt == 0 || incident.CreatedBy != "admin" {
+		t.Fatalf("CreateIncident = %+v, %v", incident, err)
+	}
+	oldTitle, oldStart, oldEnd := "旧维护", now.Add(-30*24*time.Hour).Unix(), now.Add(-30*24*time.Hour+time.Hour).Unix()
+	if _, err := svc.CreateIncident(ctx, StatusIncidentInput{Title: &oldTitle, StartedAt: &oldStart, ResolvedAt: &oldEnd}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := svc.GetStatusPage(ctx, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != title || page.OverallStatus != StatusPageMajorOutage || len(page.Models) != 2 {
+		t.Fatalf("page = %+v", page)
+	}
+	if len(page.Incidents) != 1 || page.Incidents[0].CreatedBy != "" {
+		t.Errorf("public incidents must be within history and anonymous, got %+v", page.Incidents)
+	}
+	gpt, claude := page.Models[0], page.Models[1]
+	if gpt.Status != "red" || len(gpt.Bars) != 7 || gpt.Uptime == nil || *gpt.Uptime != 0 {
+		t.Errorf("gpt-4o = %+v", gpt)
+	}
+	if last := gpt.Bars[len(gpt.Bars)-1]; len(last.Incidents) != 1 || last.Incidents[0] != incident.ID {
+		t.Errorf("today's gpt-4o bar must carry the incident, got %+v", last)
+	}
+	if claude.Status != "green" || claude.Uptime30d == nil || *claude.Uptime30d != 100 || len(claude.Bars[6].Incidents) != 0 {
+		t.Errorf("claude = %+v", claude)
+	}
+
+	html, err := RenderStatusPage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "Acme 状态") || !strings.Contains(html, incTitle) || strings.Contains(html, "<script>") {
+		t.Errorf("unexpected html: %s", html)
+	}
+
+	resolved := incident.StartedAt + 60
+	if incident, err = svc.UpdateIncident(ctx, incident.ID, StatusIncidentInput{ResolvedAt: &resolved}); err != nil || incident.ResolvedAt != resolved {
+		t.Fatalf("UpdateIncident = %+v, %v", incident, err)
+	}
+	if err := svc.DeleteIncident(ctx, incident.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteIncident(ctx, incident.ID); !errors.Is(err, ErrStatusIncidentNotFound) {
+		t.Errorf("second delete = %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+const systemScaleOverrideKey = "system_scale_override"
+
+// System scales, by NewAPI row counts
+const (
+	ScaleSmall  = "small"
+	ScaleMedium = "medium"
+	ScaleLarge  = "large"
+	ScaleXLarge = "xlarge"
+)
+
+var ErrInvalidScaleOverride = errors.New("invalid system scale override")
+
+// ScaleProfile is the set of defaults chosen for a system scale. Modules read
+// it through CurrentScaleProfile instead of hard-coding their own numbers.
+type ScaleProfile struct {
+	Scale                   string `json:"scale"`
+	Description             string `json:"description"`
+	CacheTTL                int    `json:"cache_ttl"`                 // 秒，基准缓存时长（中型 = 300，各模块按比例缩放）
+	RefreshInterval         int    `json:"refresh_interval"`          // 秒，后端建议刷新间隔
+	FrontendRefreshInterval int    `json:"frontend_refresh_interval"` // 秒，前端自动刷新间隔
+	BatchSize               int    `json:"batch_size"`                // 日志增量同步 / 回填 / 归档每批行数
+	ScanConcurrency         int    `json:"scan_concurrency"`          // 并发扫描数（多实例汇总、渠道探测默认值）
+	QueryLimitCap           int    `json:"query_limit_cap"`           // 列表 / 排行接口 limit 上限
+}
+
+// scaleProfiles are the built-in profiles; medium matches the historical defaults
+var scaleProfiles = map[string]ScaleProfile{
+	ScaleSmall:  {Scale: ScaleSmall, Description: "小型系统", CacheTTL: 60, RefreshInterval: 60, FrontendRefreshInterval: 30, BatchSize: 2000, ScanConcurrency: 8, QueryLimitCap: 2000},
+	ScaleMedium: {Scale: ScaleMedium, Description: "中型系统", CacheTTL: 300, RefreshInterval: 300, FrontendRefreshInterval: 60, BatchSize: defaultBatchSize, ScanConcurrency: 4, QueryLimitCap: 1000},
+	ScaleLarge:  {Scale: ScaleLarge, Description: "大型系统", CacheTTL: 600, RefreshInterval: 600, FrontendRefreshInterval: 120, BatchSize: 10000, ScanConcurrency: 2, QueryLimitCap: 200},
+	ScaleXLarge: {Scale: ScaleXLarge, Description: "超大型系统", CacheTTL: 900, RefreshInterval: 900, FrontendRefreshInterval: 300, BatchSize: 20000, ScanConcurrency: 1, QueryLimitCap: 100},
+}
+
+// ScaleMetrics are the row counts the scale was detected from
+type ScaleMetrics struct {
+	TotalUsers int64 `json:"total_users"`
+	TotalLogs  int64 `json:"total_logs"` // 估算值（pg_class / information_schema）
+	DetectedAt int64 `json:"detected_at"`
+}
+
+// ScaleOverride pins the scale and/or individual profile fields; zero
+// values keep the detected profile
+type ScaleOverride struct {
+	Scale                   string `json:"scale"`
+	CacheTTL                int    `json:"cache_ttl"`
+	FrontendRefreshInterval int    `json:"frontend_refresh_interval"`
+	BatchSize               int    `json:"batch_size"`
+	ScanConcurrency         int    `json:"scan_concurrency"`
+	QueryLimitCap           int    `json:"query_limit_cap"`
+	UpdatedAt               int64  `json:"updated_at"`
+}
+
+// scaleState caches the detected scale and override in memory so hot paths
+// (cache TTLs, limit caps) never touch a database
+var scaleState struct {
+	sync.RWMutex
+	detected string
+	metrics  ScaleMetrics
+	override ScaleOverride
+	loaded   bool // override 已从本地存储加载
+}
+
+// detectScale classifies row counts; the larger of the two dimensions wins
+func detectScale(users, logs int64) string {
+	rank := func(v int64, limits [3]int64) int {
+		for i, l := range limits {
+			if v < l {
+				return i
+			}
+		}
+		return 3
+	}
+	r := rank(users, [3]int64{1000, 10000, 100000})
+	if lr := rank(logs, [3]int64{1000000, 10000000, 50000000}); lr > r {
+		r = lr
+	}
+	return []string{ScaleSmall, ScaleMedium, ScaleLarge, ScaleXLarge}[r]
+}
+
+// applyScaleOverride resolves the effective profile
+func applyScaleOverride(detected string, o ScaleOverride) ScaleProfile {
+	scale := detected
+	if _, ok := scaleProfiles[o.Scale]; ok {
+		scale = o.Scale
+	}
+	p, ok := scaleProfiles[scale]
+	if !ok {
+		p = scaleProfiles[ScaleMedium]
+	}
+	if o.CacheTTL > 0 {
+		p.CacheTTL = o.CacheTTL
+		p.RefreshInterval = o.CacheTTL
+	}
+	if o.FrontendRefreshInterval > 0 {
+		p.FrontendRefreshInterval = o.FrontendRefreshInterval
+	}
+	if o.BatchSize > 0 {
+		p.BatchSize = o.BatchSize
+	}
+	if o.ScanConcurrency > 0 {
+		p.ScanConcurrency = o.ScanConcurrency
+	}
+	if o.QueryLimitCap > 0 {
+		p.QueryLimitCap = o.QueryLimitCap
+	}
+	return p
+}
+
+// CurrentScaleProfile returns the effective profile (medium until the first
+// detection)
+func CurrentScaleProfile() ScaleProfile {
+	scaleState.RLock()
+	defer scaleState.RUnlock()
+	detected := scaleState.detected
+	if detected == "" {
+		detected = ScaleMedium
+	}
+	return applyScaleOverride(detected, scaleState.override)
+}
+
+// CurrentScaleMetrics returns the row counts of the last detection
+func CurrentScaleMetrics() ScaleMetrics {
+	scaleState.RLock()
+	defer scaleState.RUnlock()
+	return scaleState.metrics
+}
+
+// scaledTTL scales a module's cache TTL (tuned for a medium system) by the
+// profile's CacheTTL
+func scaledTTL(base time.Duration) time.Duration {
+	p := CurrentScaleProfile()
+	return base * time.Duration(p.CacheTTL) / time.Duration(scaleProfiles[ScaleMedium].CacheTTL)
+}
+
+// scaleBatchSize is the log batch size of the current profile
+func scaleBatchSize() int64 {
+	return int64(CurrentScaleProfile().BatchSize)
+}
+
+// SystemScaleService detects the system scale and manages the override
+type SystemScaleService struct {
+	db *database.Manager
+}
+
+// NewSystemScaleService creates a SystemScaleService on the primary instance
+func NewSystemScaleService() *SystemScaleService {
+	return &SystemScaleService{db: database.GetRead()}
+}
+
+// loadScaleOverride reads the stored override once per process (again after
+// a settings reload)
+func loadScaleOverride(ctx context.Context) {
+	scaleState.RLock()
+	loaded := scaleState.loaded
+	scaleState.RUnlock()
+	if loaded {
+		return
+	}
+	var o ScaleOverride
+	if _, err := loadLocalSetting(ctx, systemScaleOverrideKey, &o); err != nil {
+		return
+	}
+	scaleState.Lock()
+	scaleState.override, scaleState.loaded = o, true
+	scaleState.Unlock()
+}
+
+// Detect counts users and (approximately) logs and updates the detected scale
+func (s *SystemScaleService) Detect(ctx context.Context) (ScaleMetrics, error) {
+	loadScaleOverride(ctx)
+	m := ScaleMetrics{DetectedAt: time.Now().Unix()}
+	row, err := s.db.WithContext(ctx).QueryOneWithTimeout(30*time.Second, `SELECT COUNT(*) as total FROM users WHERE deleted_at IS NULL`)
+	if err != nil {
+		return m, fmt.Errorf("user count failed: %w", err)
+	}
+	m.TotalUsers = toInt64(row["total"])
+	total, maxID := NewLogAnalyticsService().WithContext(ctx).getLogsApproxStats()
+	if total <= 0 {
+		total = maxID // 无表统计信息时按最大 id 估算
+	}
+	m.TotalLogs = total
+
+	scale := detectScale(m.TotalUsers, m.TotalLogs)
+	scaleState.Lock()
+	changed := scaleState.detected != "" && scaleState.detected != scale
+	scaleState.detected, scaleState.metrics = scale, m
+	scaleState.Unlock()
+	if changed {
+		logger.L.System(fmt.Sprintf("[系统规模] 规模变更为 %s（用户 %d，日志约 %d）", scale, m.TotalUsers, m.TotalLogs))
+	}
+	return m, nil
+}
+
+// Get returns the effective profile, detection result and override,
+// detecting once if nothing has been detected yet
+func (s *SystemScaleService) Get(ctx context.Context) map[string]interface{} {
+	loadScaleOverride(ctx)
+	scaleState.RLock()
+	detected := scaleState.detected
+	scaleState.RUnlock()
+	if detected == "" {
+		if _, err := s.Detect(ctx); err != nil {
+			logger.L.Warn("[系统规模] 检测失败: " + err.Error())
+		}
+	}
+
+	scaleState.RLock()
+	defer scaleState.RUnlock()
+	p := applyScaleOverride(scaleState.detected, scaleState.override)
+	if scaleState.detected == "" {
+		p = applyScaleOverride(ScaleMedium, scaleState.override)
+	}
+	return map[string]interface{}{
+		"scale":          p.Scale,
+		"detected_scale": scaleState.detected,
+		"metrics":        scaleState.metrics,
+		"settings":       p,
+		"override":       scaleState.override,
+		"profiles":       scaleProfiles,
+	}
+}
+
+// SetOverride validates and stores the override; an empty override clears it
+func (s *SystemScaleService) SetOverride(ctx context.Context, o ScaleOverride) (ScaleOverride, error) {
+	if o.Scale != "" {
+		if _, ok := scaleProfiles[o.Scale]; !ok {
+			return o, fmt.Errorf("%w: scale 只能是 small / medium / large / xlarge", ErrInvalidScaleOverride)
+		}
+	}
+	if o.CacheTTL < 0 || o.CacheTTL > 86400 || o.FrontendRefreshInterval < 0 || o.FrontendRefreshInterval > 3600 ||
+		o.BatchSize < 0 || o.BatchSize > 100000 || o.ScanConcurrency < 0 || o.ScanConcurrency > 32 ||
+		o.QueryLimitCap < 0 || o.QueryLimitCap > 10000 {
+		return o, fmt.Errorf("%w: 数值超出允许范围", ErrInvalidScaleOverride)
+	}
+	o.UpdatedAt = time.Now().Unix()
+	if err := saveLocalSetting(ctx, systemScaleOverrideKey, o); err != nil {
+		return o, err
+	}
+	scaleState.Lock()
+	scaleState.override, scaleState.loaded = o, true
+	scaleState.Unlock()
+	return o, nil
+}
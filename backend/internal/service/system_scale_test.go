@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestSystemScaleDetectionAndOverride(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	resetScaleState := func() {
+		scaleState.Lock()
+		scaleState.detected, scaleState.metrics = "", ScaleMetrics{}
+		scaleState.override, scaleState.loaded = ScaleOverride{}, false
+		scaleState.Unlock()
+	}
+	resetScaleState()
+	t.Cleanup(resetScaleState)
+
+	for _, tc := range []struct {
+		users, logs int64
+		want        string
+	}{
+		{10, 1000, ScaleSmall},
+		{5000, 1000, ScaleMedium},
+		{10, 20000000, ScaleLarge}, // 日志量单独即可升档
+		{200000, 0, ScaleXLarge},
+	} {
+		if got := detectScale(tc.users, tc.logs); got != tc.want {
+			t.Errorf("detectScale(%d, %d) = %s, want %s", tc.users, tc.logs, got, tc.want)
+		}
+	}
+
+	if p := CurrentScaleProfile(); p.Scale != ScaleMedium || scaledTTL(5*time.Minute) != 5*time.Minute ||
+		scaleBatchSize() != defaultBatchSize {
+		t.Fatalf("undetected scale should keep the medium defaults, got %+v", p)
+	}
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE users (id INTEGER PRIMARY KEY, deleted_at INTEGER)`)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY)`)
+	db.MustExec(`INSERT INTO users (id) VALUES (1), (2)`)
+	db.MustExec(`INSERT INTO logs (id) VALUES (60000000)`)
+
+	ctx := context.Background()
+	svc := NewSystemScaleService()
+	m, err := svc.Detect(ctx)
+	if err != nil || m.TotalUsers != 2 || m.TotalLogs != 60000000 {
+		t.Fatalf("Detect = %+v, %v", m, err)
+	}
+	if p := CurrentScaleProfile(); p.Scale != ScaleXLarge || scaledTTL(time.Minute) != 3*time.Minute {
+		t.Fatalf("max id fallback should detect xlarge, got %+v", p)
+	}
+
+	if _, err := svc.SetOverride(ctx, ScaleOverride{Scale: "huge"}); !errors.Is(err, ErrInvalidScaleOverride) {
+		t.Fatalf("unknown scale should be rejected, got %v", err)
+	}
+	if _, err := svc.SetOverride(ctx, ScaleOverride{BatchSize: -1}); !errors.Is(err, ErrInvalidScaleOverride) {
+		t.Fatalf("negative batch size should be rejected, got %v", err)
+	}
+	if _, err := svc.SetOverride(ctx, ScaleOverride{Scale: ScaleSmall, QueryLimitCap: 300}); err != nil {
+		t.Fatalf("SetOverride: %v", err)
+	}
+	p := CurrentScaleProfile()
+	if p.Scale != ScaleSmall || p.QueryLimitCap != 300 || p.BatchSize != scaleProfiles[ScaleSmall].BatchSize {
+		t.Fatalf("override should pin the scale and the single field, got %+v", p)
+	}
+
+	// the override survives a restart (reloaded from the local store)
+	scaleState.Lock()
+	scaleState.override, scaleState.loaded = ScaleOverride{}, false
+	scaleState.Unlock()
+	data := svc.Get(ctx)
+	if data["scale"] != ScaleSmall || data["detected_scale"] != ScaleXLarge {
+		t.Fatalf("Get after reload = %+v", data)
+	}
+
+	if _, err := svc.SetOverride(ctx, ScaleOverride{}); err != nil {
+		t.Fatalf("clear override: %v", err)
+	}
+	if p := CurrentScaleProfile(); p.Scale != ScaleXLarge {
+		t.Fatalf("clearing the override should restore the detected scale, got %+v", p)
+	}
+}
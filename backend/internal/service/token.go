@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -59,6 +60,13 @@ func NewTokenService() *TokenService {
 	return &TokenService{db: database.Get(), logDB: database.GetLog()}
 }
 
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *TokenService) WithContext(ctx context.Context) *TokenService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
 // keyCol returns the properly quoted column name for 'key' (reserved word)
 func (s *TokenService) keyCol() string {
 	if s.db.IsPG {
@@ -200,7 +208,7 @@ func (s *TokenService) ListTokens(params TokenListParams) (map[string]interface{
 		lastUsedQuery := fmt.Sprintf(`
 			SELECT token_id, MAX(created_at) as accessed_time
 			FROM logs
-			WHERE created_at >= %s AND type IN (2, 5) AND token_id IN (%s)
+			WHERE created_at >= %s AND type IN (`+ltRequests()+`) AND token_id IN (%s)
 			GROUP BY token_id`, s.logDB.Placeholder(1), strings.Join(placeholders, ","))
 
 		lastUsedRows, err := s.logDB.Query(lastUsedQuery, aggArgs...)
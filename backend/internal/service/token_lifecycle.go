@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// Token batch lifecycle actions
+const (
+	TokenBatchDisableGroup = "disable_group"
+	TokenBatchExpireUnused = "expire_unused"
+	TokenBatchPurgeDeleted = "purge_deleted"
+)
+
+// NewAPI token status values written by the batch actions
+const (
+	tokenStatusDisabled = 2
+	tokenStatusExpired  = 3
+)
+
+const (
+	tokenBatchPreviewLimit = 20
+	maxTokenUnusedDays     = 3650
+)
+
+var ErrInvalidTokenBatch = errors.New("invalid token batch request")
+
+// TokenBatchResult is returned by both the dry run and the execution; Count
+// is always measured before anything is changed
+type TokenBatchResult struct {
+	Action   string   `json:"action"`
+	DryRun   bool     `json:"dry_run"`
+	Count    int64    `json:"count"`
+	Affected int64    `json:"affected"`
+	Tokens   []string `json:"tokens"` // 前 20 个令牌（名称#ID），供确认对话框展示
+}
+
+// runTokenBatch counts the tokens matched by where and, unless dryRun,
+// applies set as an UPDATE (or deletes the rows when set is empty)
+func (s *TokenService) runTokenBatch(name, where, set string, setArgs, args []interface{}, dryRun bool) (TokenBatchResult, error) {
+	result := TokenBatchResult{Action: name, DryRun: dryRun, Tokens: []string{}}
+	row, err := s.db.QueryOne(s.db.RebindQuery("SELECT COUNT(*) AS cnt FROM tokens WHERE "+where), args...)
+	if err != nil {
+		return result, err
+	}
+	result.Count = toInt64(row["cnt"])
+
+	rows, err := s.db.Query(s.db.RebindQuery(fmt.Sprintf("SELECT id, name FROM tokens WHERE %s ORDER BY id LIMIT %d",
+		where, tokenBatchPreviewLimit)), args...)
+	if err != nil {
+		return result, err
+	}
+	for _, r := range rows {
+		result.Tokens = append(result.Tokens, fmt.Sprintf("%s#%d", toString(r["name"]), toInt64(r["id"])))
+	}
+	if dryRun || result.Count == 0 {
+		return result, nil
+	}
+
+	if set == "" {
+		result.Affected, err = s.db.Execute(s.db.RebindQuery("DELETE FROM tokens WHERE "+where), args...)
+	} else {
+		result.Affected, err = s.db.Execute(s.db.RebindQuery("UPDATE tokens SET "+set+" WHERE "+where),
+			append(append([]interface{}{}, setArgs...), args...)...)
+	}
+	if err != nil {
+		return result, err
+	}
+	logger.L.Business(fmt.Sprintf("令牌批量操作 %s: %d 个", name, result.Affected))
+	return result, nil
+}
+
+// DisableGroupTokens disables every enabled token owned by users of group
+func (s *TokenService) DisableGroupTokens(group string, dryRun bool) (TokenBatchResult, error) {
+	group = strings.TrimSpace(group)
+	if group == "" {
+		return TokenBatchResult{}, fmt.Errorf("%w: group 不能为空", ErrInvalidTokenBatch)
+	}
+	where := fmt.Sprintf("deleted_at IS NULL AND status = 1 AND user_id IN (SELECT id FROM users WHERE %s = ?)", s.groupCol())
+	return s.runTokenBatch(TokenBatchDisableGroup, where, "status = ?",
+		[]interface{}{tokenStatusDisabled}, []interface{}{group}, dryRun)
+}
+
+// ExpireUnusedTokens marks enabled tokens not used for `days` days as
+// expired; tokens that were never used count from their creation time
+func (s *TokenService) ExpireUnusedTokens(days int, dryRun bool) (TokenBatchResult, error) {
+	if days < 1 || days > maxTokenUnusedDays {
+		return TokenBatchResult{}, fmt.Errorf("%w: days 需在 1 ~ %d 之间", ErrInvalidTokenBatch, maxTokenUnusedDays)
+	}
+	now := time.Now().Unix()
+	where := "deleted_at IS NULL AND status = 1 AND COALESCE(NULLIF(accessed_time, 0), created_time) < ?"
+	return s.runTokenBatch(TokenBatchExpireUnused, where, "status = ?, expired_time = ?",
+		[]interface{}{tokenStatusExpired, now}, []interface{}{now - int64(days)*86400}, dryRun)
+}
+
+// PurgeDeletedTokens permanently removes soft-deleted tokens
+func (s *TokenService) PurgeDeletedTokens(dryRun bool) (TokenBatchResult, error) {
+	return s.runTokenBatch(TokenBatchPurgeDeleted, "deleted_at IS NOT NULL", "", nil, nil, dryRun)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestTokenBatchLifecycle(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	now := time.Now().Unix()
+	old := now - 200*86400
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, `group` TEXT);" +
+		`CREATE TABLE tokens (id INTEGER PRIMARY KEY, name TEXT, user_id INTEGER, status INTEGER,
+			created_time INTEGER, accessed_time INTEGER, expired_time INTEGER, deleted_at DATETIME);
+		INSERT INTO users VALUES (1, 'free-user', 'free'), (2, 'vip-user', 'vip');`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	for _, r := range [][]interface{}{
+		{1, "free-active", 1, 1, old, now, -1, nil},
+		{2, "free-stale", 1, 1, old, old, -1, nil},
+		{3, "vip-never-used", 2, 1, old, 0, -1, nil},
+		{4, "vip-fresh", 2, 1, now, 0, -1, nil},
+		{5, "free-deleted", 1, 1, old, old, -1, "2026-01-01 00:00:00"},
+	} {
+		if _, err := db.Exec(`INSERT INTO tokens VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, r...); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	status := func(id int) int64 {
+		var s int64
+		if err := db.Get(&s, "SELECT status FROM tokens WHERE id = ?", id); err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		return s
+	}
+
+	svc := NewTokenService()
+	preview, err := svc.ExpireUnusedTokens(90, true)
+	if err != nil || preview.Count != 2 || preview.Affected != 0 || len(preview.Tokens) != 2 {
+		t.Fatalf("expire dry run: %+v %v", preview, err)
+	}
+	if status(2) != 1 {
+		t.Fatalf("dry run must not change tokens")
+	}
+	res, err := svc.ExpireUnusedTokens(90, false)
+	if err != nil || res.Affected != 2 || status(2) != tokenStatusExpired || status(3) != tokenStatusExpired || status(4) != 1 {
+		t.Fatalf("expire: %+v %v", res, err)
+	}
+
+	res, err = svc.DisableGroupTokens("free", false)
+	if err != nil || res.Count != 1 || status(1) != tokenStatusDisabled || status(5) != 1 {
+		t.Fatalf("disable group should only touch enabled, undeleted free tokens: %+v %v", res, err)
+	}
+	if _, err := svc.DisableGroupTokens(" ", true); !errors.Is(err, ErrInvalidTokenBatch) {
+		t.Fatalf("empty group should be rejected, got %v", err)
+	}
+
+	res, err = svc.PurgeDeletedTokens(false)
+	if err != nil || res.Affected != 1 || res.Tokens[0] != "free-deleted#5" {
+		t.Fatalf("purge: %+v %v", res, err)
+	}
+	var left int
+	_ = db.Get(&left, "SELECT COUNT(*) FROM tokens")
+	if left != 4 {
+		t.Fatalf("expected 4 tokens after purge, got %d", left)
+	}
+}
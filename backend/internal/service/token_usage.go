@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+)
+
+// tokenUsageLookback bounds the first/last use lookup so it can use
+// idx_logs_created_token_ip instead of the token's full history
+const tokenUsageLookback = 90 * 86400
+
+// tokenUsageIPLimit is how many source IPs the usage view lists before
+// folding the rest into "other"
+const tokenUsageIPLimit = 50
+
+var (
+	ErrTokenNotFound     = errors.New("token not found")
+	ErrInvalidTokenQuery = errors.New("invalid token usage query")
+)
+
+// TokenUsageSummary aggregates a token's traffic in the window
+type TokenUsageSummary struct {
+	Requests         int64 `json:"requests"`
+	Failures         int64 `json:"failures"`
+	Quota            int64 `json:"quota"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	UniqueIPs        int64 `json:"unique_ips"`
+	FirstUsedAt      int64 `json:"first_used_at"` // 窗口内首次使用
+	LastUsedAt       int64 `json:"last_used_at"`  // 窗口内最后使用
+	FirstSeenAt      int64 `json:"first_seen_at"` // 近 90 天内首次使用
+	LastSeenAt       int64 `json:"last_seen_at"`  // 近 90 天内最后使用
+}
+
+// TokenUsage is the /api/tokens/:token_id/usage response
+type TokenUsage struct {
+	Token    map[string]interface{}   `json:"token"`
+	Window   string                   `json:"window"`
+	Summary  TokenUsageSummary        `json:"summary"`
+	Models   []map[string]interface{} `json:"models"`
+	IPs      []map[string]interface{} `json:"ips"`
+	Timeline []map[string]interface{} `json:"timeline"` // 按小时
+	// Truncated 表示模型或 IP 超过上限，超出部分合并为 "other" 行
+	Truncated bool `json:"truncated"`
+}
+
+// GetTokenUsage returns what a token did in the window: per-model usage,
+// source IPs, an hourly timeline and first/last use
+func (s *TokenService) GetTokenUsage(tokenID int64, window string) (*TokenUsage, error) {
+	windowSeconds, ok := WindowSeconds[window]
+	if !ok {
+		return nil, fmt.Errorf("%w: window %s", ErrInvalidTokenQuery, window)
+	}
+	token, err := s.db.QueryOne(s.db.RebindQuery(fmt.Sprintf(`
+		SELECT t.id, t.%s as token_key, t.name, t.user_id, COALESCE(u.username, '') as username, t.status,
+			t.remain_quota, t.used_quota, t.unlimited_quota, t.%s as token_group,
+			COALESCE(t.created_time, 0) as created_time, COALESCE(t.expired_time, 0) as expired_time
+		FROM tokens t
+		LEFT JOIN users u ON t.user_id = u.id
+		WHERE t.id = ?`, s.keyCol(), s.groupCol())), tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrTokenNotFound
+	}
+	token["key"] = MaskTokenKey(toString(token["token_key"]))
+	token["group"] = token["token_group"]
+	delete(token, "token_key")
+	delete(token, "token_group")
+
+	cacheKey := cache.Key("tokens:usage:%d:%s", tokenID, window)
+	var cached TokenUsage
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found && cached.Models != nil {
+		cached.Token = token
+		return &cached, nil
+	}
+
+	now := time.Now().Unix()
+	start := now - windowSeconds
+	usage := &TokenUsage{Token: token, Window: window}
+
+	models, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT COALESCE(model_name, '') as model_name,
+			COUNT(*) as requests,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures,
+			COALESCE(SUM(quota), 0) as quota,
+			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) as completion_tokens,
+			MIN(created_at) as first_used_at,
+			MAX(created_at) as last_used_at
+		FROM logs
+		WHERE token_id = ? AND created_at >= ? AND type IN (`+ltRequests()+`)
+		GROUP BY COALESCE(model_name, '')
+		ORDER BY quota DESC, requests DESC
+		LIMIT %d`, groupedRowCap+1)), tokenID, start)
+	if err != nil {
+		return nil, err
+	}
+	var modelTotals map[string]interface{}
+	if len(models) > groupedRowCap {
+		modelTotals, err = s.logDB.QueryOneWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+			SELECT COUNT(DISTINCT COALESCE(model_name, '')) as group_count,
+				COUNT(*) as requests,
+				SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures,
+				COALESCE(SUM(quota), 0) as quota,
+				COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+				COALESCE(SUM(completion_tokens), 0) as completion_tokens,
+				MIN(created_at) as first_used_at,
+				MAX(created_at) as last_used_at
+			FROM logs
+			WHERE token_id = ? AND created_at >= ? AND type IN (`+ltRequests()+`)`), tokenID, start)
+		if err != nil {
+			return nil, err
+		}
+		models = foldOtherGroup(models, groupedRowCap, "model_name", modelTotals,
+			"requests", "failures", "quota", "prompt_tokens", "completion_tokens")
+		usage.Truncated = true
+	}
+	usage.Models = []map[string]interface{}{}
+	for _, m := range models {
+		sum := &usage.Summary
+		sum.Requests += toInt64(m["requests"])
+		sum.Failures += toInt64(m["failures"])
+		sum.Quota += toInt64(m["quota"])
+		sum.PromptTokens += toInt64(m["prompt_tokens"])
+		sum.CompletionTokens += toInt64(m["completion_tokens"])
+		if first := toInt64(m["first_used_at"]); first > 0 && (sum.FirstUsedAt == 0 || first < sum.FirstUsedAt) {
+			sum.FirstUsedAt = first
+		}
+		if last := toInt64(m["last_used_at"]); last > sum.LastUsedAt {
+			sum.LastUsedAt = last
+		}
+		usage.Models = append(usage.Models, m)
+	}
+	if modelTotals != nil {
+		usage.Summary.FirstUsedAt = toInt64(modelTotals["first_used_at"])
+		usage.Summary.LastUsedAt = toInt64(modelTotals["last_used_at"])
+	}
+
+	ipWhere := "token_id = ? AND created_at >= ? AND type IN (" + ltRequests() + ") AND ip IS NOT NULL AND ip != ''"
+	ips, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT ip, COUNT(*) as requests, COALESCE(SUM(quota), 0) as quota,
+			MIN(created_at) as first_seen, MAX(created_at) as last_seen
+		FROM logs
+		WHERE %s
+		GROUP BY ip
+		ORDER BY requests DESC
+		LIMIT %d`, ipWhere, tokenUsageIPLimit+1)), tokenID, start)
+	if err != nil {
+		return nil, err
+	}
+	usage.Summary.UniqueIPs = int64(len(ips))
+	if len(ips) > tokenUsageIPLimit {
+		totals, err := s.logDB.QueryOneWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+			SELECT COUNT(DISTINCT ip) as group_count, COUNT(*) as requests, COALESCE(SUM(quota), 0) as quota
+			FROM logs WHERE `+ipWhere), tokenID, start)
+		if err != nil {
+			return nil, err
+		}
+		usage.Summary.UniqueIPs = toInt64(totals["group_count"])
+		ips = foldOtherGroup(ips, tokenUsageIPLimit, "ip", totals, "requests", "quota")
+		usage.Truncated = true
+	}
+	usage.IPs = ips
+	if usage.IPs == nil {
+		usage.IPs = []map[string]interface{}{}
+	}
+
+	hourStart := start - start%3600
+	timeline, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT created_at - (created_at % 3600) as hour, COUNT(*) as requests,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures,
+			COALESCE(SUM(quota), 0) as quota
+		FROM logs
+		WHERE token_id = ? AND created_at >= ? AND type IN (`+ltRequests()+`)
+		GROUP BY created_at - (created_at % 3600)`), tokenID, hourStart)
+	if err != nil {
+		return nil, err
+	}
+	byHour := make(map[int64]map[string]interface{}, len(timeline))
+	for _, row := range timeline {
+		byHour[toInt64(row["hour"])] = row
+	}
+	usage.Timeline = make([]map[string]interface{}, 0, windowSeconds/3600+1)
+	for hour := hourStart; hour <= now; hour += 3600 {
+		row := byHour[hour]
+		usage.Timeline = append(usage.Timeline, map[string]interface{}{
+			"hour":     hour,
+			"requests": toInt64(row["requests"]),
+			"failures": toInt64(row["failures"]),
+			"quota":    toInt64(row["quota"]),
+		})
+	}
+
+	seen, err := s.logDB.QueryOneWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+		SELECT MIN(created_at) as first_seen, MAX(created_at) as last_seen
+		FROM logs
+		WHERE created_at >= ? AND token_id = ? AND type IN (`+ltRequests()+`)`), now-tokenUsageLookback, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	usage.Summary.FirstSeenAt, usage.Summary.LastSeenAt = toInt64(seen["first_seen"]), toInt64(seen["last_seen"])
+
+	cache.Get().Set(cacheKey, usage, time.Minute)
+	return usage, nil
+}
+
+// GetTopTokens ranks tokens by quota or requests in the window, with token
+// names and owners from the main DB; accounts excluded by role are left out
+func (s *TokenService) GetTopTokens(window, sortBy string, limit int) ([]map[string]interface{}, error) {
+	windowSeconds, ok := WindowSeconds[window]
+	if !ok {
+		return nil, fmt.Errorf("%w: window %s", ErrInvalidTokenQuery, window)
+	}
+	orderBy := "quota DESC, requests DESC"
+	switch sortBy {
+	case "", "quota":
+	case "requests":
+		orderBy = "requests DESC, quota DESC"
+	default:
+		return nil, fmt.Errorf("%w: sort_by 只能是 quota 或 requests", ErrInvalidTokenQuery)
+	}
+	cacheKey := cache.Key("tokens:top:%s:%s:%d", window, sortBy, limit)
+	var cached []map[string]interface{}
+	if found, _ := cache.Get().GetJSON(cacheKey, &cached); found && cached != nil {
+		return cached, nil
+	}
+
+	excludeSQL, excludeArgs := roleExclusionClause(s.db, "user_id")
+	args := append([]interface{}{time.Now().Unix() - windowSeconds}, excludeArgs...)
+	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(fmt.Sprintf(`
+		SELECT token_id, MAX(user_id) as user_id, COALESCE(MAX(token_name), '') as token_name,
+			COALESCE(MAX(username), '') as username,
+			COUNT(*) as requests,
+			SUM(CASE WHEN type = `+ltError()+` THEN 1 ELSE 0 END) as failures,
+			COALESCE(SUM(quota), 0) as quota,
+			COUNT(DISTINCT model_name) as models,
+			COUNT(DISTINCT NULLIF(ip, '')) as unique_ips,
+			MAX(created_at) as last_used_at
+		FROM logs
+		WHERE created_at >= ? AND type IN (`+ltRequests()+`) AND token_id > 0%s
+		GROUP BY token_id
+		ORDER BY %s
+		LIMIT ?`, excludeSQL, orderBy)), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	if len(rows) > 0 {
+		ids := make([]interface{}, len(rows))
+		for i, row := range rows {
+			ids[i] = toInt64(row["token_id"])
+		}
+		tokens, err := s.db.Query(s.db.RebindQuery(`SELECT id, name, status FROM tokens WHERE id IN (`+placeholders(len(ids))+`)`), ids...)
+		if err == nil {
+			byID := make(map[int64]map[string]interface{}, len(tokens))
+			for _, t := range tokens {
+				byID[toInt64(t["id"])] = t
+			}
+			for _, row := range rows {
+				if t, ok := byID[toInt64(row["token_id"])]; ok {
+					row["token_name"] = t["name"]
+					row["status"] = t["status"]
+				} else {
+					row["status"] = nil // 令牌已删除
+				}
+			}
+		}
+	}
+	cache.Get().Set(cacheKey, rows, 2*time.Minute)
+	return rows, nil
+}
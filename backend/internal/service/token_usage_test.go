@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+func TestTokenUsageAndTopTokens(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	logger.Init("error", "")
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role INTEGER);" +
+		"CREATE TABLE tokens (id INTEGER PRIMARY KEY, `key` TEXT, name TEXT, user_id INTEGER, status INTEGER, remain_quota INTEGER," +
+		" used_quota INTEGER, unlimited_quota INTEGER, `group` TEXT, created_time INTEGER, expired_time INTEGER);" +
+		`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, token_id INTEGER, token_name TEXT, user_id INTEGER, username TEXT,
+			type INTEGER, model_name TEXT, quota INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER, ip TEXT, created_at INTEGER);
+		INSERT INTO users VALUES (1, 'alice', 1), (2, 'bob', 1);
+		INSERT INTO tokens VALUES (10, 'abcdefghijklmnop', 'main', 1, 1, 0, 0, 1, 'default', 0, -1),
+			(20, 'qrstuvwxyz123456', 'side', 2, 2, 0, 0, 1, 'default', 0, -1);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	now := time.Now().Unix()
+	insert := func(token, user int64, typ int, model string, quota int64, ip string, at int64) {
+		if _, err := db.Exec(`INSERT INTO logs (token_id, token_name, user_id, username, type, model_name, quota,
+			prompt_tokens, completion_tokens, ip, created_at) VALUES (?, 't', ?, 'u', ?, ?, ?, 10, 5, ?, ?)`,
+			token, user, typ, model, quota, ip, at); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	insert(10, 1, 2, "gpt-x", 100, "198.51.100.1", now-7200)
+	insert(10, 1, 2, "gpt-x", 100, "198.51.100.2", now-60)
+	insert(10, 1, 5, "claude-y", 0, "198.51.100.2", now-30)
+	insert(10, 1, 2, "gpt-x", 100, "198.51.100.1", now-3*86400) // outside 24h, inside 90d
+	insert(20, 2, 2, "gpt-x", 50, "203.0.113.9", now-60)
+
+	svc := NewTokenService()
+	usage, err := svc.GetTokenUsage(10, "24h")
+	if err != nil {
+		t.Fatalf("GetTokenUsage: %v", err)
+	}
+	sum := usage.Summary
+	if sum.Requests != 3 || sum.Failures != 1 || sum.Quota != 200 || sum.UniqueIPs != 2 || sum.PromptTokens != 30 {
+		t.Fatalf("unexpected summary %+v", sum)
+	}
+	if sum.FirstUsedAt != now-7200 || sum.LastUsedAt != now-30 || sum.FirstSeenAt != now-3*86400 {
+		t.Fatalf("unexpected first/last use %+v", sum)
+	}
+	if usage.Token["key"] != "abcdefgh****" || toString(usage.Models[0]["model_name"]) != "gpt-x" {
+		t.Fatalf("unexpected token / models %+v %+v", usage.Token, usage.Models)
+	}
+	var timelineRequests int64
+	for _, h := range usage.Timeline {
+		timelineRequests += toInt64(h["requests"])
+	}
+	if len(usage.Timeline) < 24 || timelineRequests != 3 {
+		t.Fatalf("hourly timeline should hold 3 requests over >=24 hours, got %d over %d", timelineRequests, len(usage.Timeline))
+	}
+	if _, err := svc.GetTokenUsage(99, "24h"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("unknown token should be ErrTokenNotFound, got %v", err)
+	}
+
+	top, err := svc.GetTopTokens("24h", "quota", 10)
+	if err != nil {
+		t.Fatalf("GetTopTokens: %v", err)
+	}
+	if len(top) != 2 || toInt64(top[0]["token_id"]) != 10 || top[0]["token_name"] != "main" || toInt64(top[1]["status"]) != 2 {
+		t.Fatalf("unexpected ranking %+v", top)
+	}
+	if _, err := svc.GetTopTokens("24h", "bogus", 10); !errors.Is(err, ErrInvalidTokenQuery) {
+		t.Fatalf("bad sort_by should be rejected, got %v", err)
+	}
+}
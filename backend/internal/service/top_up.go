@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/new-api-tools/backend/internal/database"
-	"github.com/new-api-tools/backend/internal/util"
 )
 
 // TopUpRecord represents a top-up record
@@ -264,7 +263,7 @@ func buildTopUpWhere(params ListTopUpParams) (string, []interface{}, int) {
 	}
 
 	if params.StartDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(params.StartDate, false)
+		ts, err := parseReportDate(params.StartDate, false)
 		if err == nil {
 			where = append(where, fmt.Sprintf("t.create_time >= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -273,7 +272,7 @@ func buildTopUpWhere(params ListTopUpParams) (string, []interface{}, int) {
 	}
 
 	if params.EndDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(params.EndDate, true)
+		ts, err := parseReportDate(params.EndDate, true)
 		if err == nil {
 			where = append(where, fmt.Sprintf("t.create_time <= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -289,7 +288,7 @@ func buildTopUpWhere(params ListTopUpParams) (string, []interface{}, int) {
 }
 
 // ListTopUpRecords lists top-up records with pagination and filtering
-func ListTopUpRecords(params ListTopUpParams) (*PaginatedTopUps, error) {
+func ListTopUpRecords(ctx context.Context, params ListTopUpParams) (*PaginatedTopUps, error) {
 	if params.Page < 1 {
 		params.Page = 1
 	}
@@ -297,14 +296,14 @@ func ListTopUpRecords(params ListTopUpParams) (*PaginatedTopUps, error) {
 		params.PageSize = 20
 	}
 
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 
 	whereSQL, args, argIdx := buildTopUpWhere(params)
 
 	// Count
 	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM top_ups t LEFT JOIN users u ON t.user_id = u.id WHERE %s", whereSQL)
 	var total int64
-	if err := db.DB.Get(&total, countSQL, args...); err != nil {
+	if err := db.DB.GetContext(ctx, &total, countSQL, args...); err != nil {
 		return nil, fmt.Errorf("count query failed: %w", err)
 	}
 
@@ -319,7 +318,7 @@ func ListTopUpRecords(params ListTopUpParams) (*PaginatedTopUps, error) {
 		topUpSelectColumns(), whereSQL, db.Placeholder(argIdx), db.Placeholder(argIdx+1))
 	args = append(args, params.PageSize, offset)
 
-	rows, err := db.DB.Queryx(selectSQL, args...)
+	rows, err := db.DB.QueryxContext(ctx, selectSQL, args...)
 	if err != nil {
 		return nil, fmt.Errorf("select query failed: %w", err)
 	}
@@ -351,12 +350,12 @@ func ListTopUpRecords(params ListTopUpParams) (*PaginatedTopUps, error) {
 
 // CountTopUps returns the total number of top-ups matching the filter.
 // Used by ExportTopUpsToCSV to enforce the export size cap before streaming.
-func CountTopUps(params ListTopUpParams) (int64, error) {
-	db := database.Get()
+func CountTopUps(ctx context.Context, params ListTopUpParams) (int64, error) {
+	db := database.Get().WithContext(ctx)
 	whereSQL, args, _ := buildTopUpWhere(params)
 	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM top_ups t LEFT JOIN users u ON t.user_id = u.id WHERE %s", whereSQL)
 	var total int64
-	if err := db.DB.Get(&total, countSQL, args...); err != nil {
+	if err := db.DB.GetContext(ctx, &total, countSQL, args...); err != nil {
 		return 0, fmt.Errorf("count query failed: %w", err)
 	}
 	return total, nil
@@ -375,8 +374,9 @@ var TopUpExportLimit int64 = 100000
 // ExportTopUpsToCSV streams top-up records as CSV to the writer. The caller is
 // responsible for setting response headers and (recommended) running CountTopUps
 // first to short-circuit oversized exports — this function only flips on the
-// limit if the count exceeds it mid-stream.
-func ExportTopUpsToCSV(ctx context.Context, w io.Writer, params ListTopUpParams) error {
+// limit if the count exceeds it mid-stream. A non-nil anon replaces user ids
+// and usernames with stable pseudonyms.
+func ExportTopUpsToCSV(ctx context.Context, w io.Writer, params ListTopUpParams, anon *ExportAnonymizer) error {
 	db := database.Get()
 	whereSQL, args, _ := buildTopUpWhere(params)
 
@@ -433,8 +433,8 @@ func ExportTopUpsToCSV(ctx context.Context, w io.Writer, params ListTopUpParams)
 
 		if err := csvW.Write([]string{
 			strconv.FormatInt(rec.ID, 10),
-			strconv.FormatInt(rec.UserID, 10),
-			username,
+			anon.UserID(rec.UserID),
+			anon.Name(username),
 			strconv.FormatInt(rec.Amount, 10),
 			strconv.FormatFloat(rec.Money, 'f', 2, 64),
 			rec.TradeNo,
@@ -469,15 +469,15 @@ func ExportTopUpsToCSV(ctx context.Context, w io.Writer, params ListTopUpParams)
 }
 
 // GetTopUpStatistics returns aggregate top-up statistics
-func GetTopUpStatistics(startDate, endDate string) (*TopUpStatistics, error) {
-	db := database.Get()
+func GetTopUpStatistics(ctx context.Context, startDate, endDate string) (*TopUpStatistics, error) {
+	db := database.Get().WithContext(ctx)
 
 	where := []string{}
 	args := []interface{}{}
 	argIdx := 1
 
 	if startDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(startDate, false)
+		ts, err := parseReportDate(startDate, false)
 		if err == nil {
 			where = append(where, fmt.Sprintf("create_time >= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -485,7 +485,7 @@ func GetTopUpStatistics(startDate, endDate string) (*TopUpStatistics, error) {
 		}
 	}
 	if endDate != "" {
-		ts, err := util.ParseDateToTimestampPublic(endDate, true)
+		ts, err := parseReportDate(endDate, true)
 		if err == nil {
 			where = append(where, fmt.Sprintf("create_time <= %s", db.Placeholder(argIdx)))
 			args = append(args, ts)
@@ -548,7 +548,7 @@ func GetTopUpStatistics(startDate, endDate string) (*TopUpStatistics, error) {
 	}
 
 	var raw rawStats
-	if err := db.DB.Get(&raw, sql, args...); err != nil {
+	if err := db.DB.GetContext(ctx, &raw, sql, args...); err != nil {
 		return nil, fmt.Errorf("statistics query failed: %w", err)
 	}
 
@@ -575,10 +575,10 @@ func GetTopUpStatistics(startDate, endDate string) (*TopUpStatistics, error) {
 }
 
 // GetPaymentMethods returns distinct payment methods
-func GetPaymentMethods() ([]string, error) {
-	db := database.Get()
+func GetPaymentMethods(ctx context.Context) ([]string, error) {
+	db := database.Get().WithContext(ctx)
 	var methods []string
-	err := db.DB.Select(&methods, "SELECT DISTINCT payment_method FROM top_ups WHERE payment_method IS NOT NULL AND payment_method != '' ORDER BY payment_method")
+	err := db.DB.SelectContext(ctx, &methods, "SELECT DISTINCT payment_method FROM top_ups WHERE payment_method IS NOT NULL AND payment_method != '' ORDER BY payment_method")
 	if err != nil {
 		return nil, err
 	}
@@ -589,13 +589,13 @@ func GetPaymentMethods() ([]string, error) {
 }
 
 // GetPaymentProviders returns distinct payment providers.
-func GetPaymentProviders() ([]string, error) {
-	db := database.Get()
+func GetPaymentProviders(ctx context.Context) ([]string, error) {
+	db := database.Get().WithContext(ctx)
 	if !db.ColumnExists("top_ups", "payment_provider") {
 		return []string{}, nil
 	}
 	var providers []string
-	err := db.DB.Select(&providers, "SELECT DISTINCT payment_provider FROM top_ups WHERE payment_provider IS NOT NULL AND payment_provider != '' ORDER BY payment_provider")
+	err := db.DB.SelectContext(ctx, &providers, "SELECT DISTINCT payment_provider FROM top_ups WHERE payment_provider IS NOT NULL AND payment_provider != '' ORDER BY payment_provider")
 	if err != nil {
 		return nil, err
 	}
@@ -606,12 +606,12 @@ func GetPaymentProviders() ([]string, error) {
 }
 
 // GetTopUpByID returns a single top-up record
-func GetTopUpByID(id int64) (*TopUpRecord, error) {
-	db := database.Get()
+func GetTopUpByID(ctx context.Context, id int64) (*TopUpRecord, error) {
+	db := database.Get().WithContext(ctx)
 	sql := fmt.Sprintf(`SELECT %s FROM top_ups t LEFT JOIN users u ON t.user_id = u.id WHERE t.id = %s`, topUpSelectColumns(), db.Placeholder(1))
 
 	var rec TopUpRecord
-	if err := db.DB.Get(&rec, sql, id); err != nil {
+	if err := db.DB.GetContext(ctx, &rec, sql, id); err != nil {
 		return nil, err
 	}
 	enrichTopUpRecord(&rec, time.Now().Unix(), defaultPendingAnomalyHours)
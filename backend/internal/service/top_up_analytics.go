@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -9,7 +10,6 @@ import (
 
 	"github.com/new-api-tools/backend/internal/cache"
 	"github.com/new-api-tools/backend/internal/database"
-	"github.com/new-api-tools/backend/internal/util"
 )
 
 // TopUpTrendPoint represents a single data point in the revenue trend
@@ -113,15 +113,15 @@ func resolveTrendsRange(p TopUpTrendsParams) (granularity string, startTs, endTs
 		days = 30
 	}
 
-	loc := time.Now().Location()
-	now := time.Now().In(loc)
+	now := reportNow()
+	loc := now.Location()
 	endOfToday := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, loc)
 
 	var sTs, eTs int64
 	customRange := false
 	if p.StartDate != "" && p.EndDate != "" {
-		s, errS := util.ParseDateToTimestampPublic(p.StartDate, false)
-		e, errE := util.ParseDateToTimestampPublic(p.EndDate, true)
+		s, errS := parseReportDate(p.StartDate, false)
+		e, errE := parseReportDate(p.EndDate, true)
 		if errS == nil && errE == nil && s <= e {
 			sTs, eTs = s, e
 			customRange = true
@@ -138,11 +138,11 @@ func resolveTrendsRange(p TopUpTrendsParams) (granularity string, startTs, endTs
 }
 
 // GetTopUpTrends returns revenue trends with configurable granularity and date range
-func GetTopUpTrends(p TopUpTrendsParams) ([]TopUpTrendPoint, error) {
+func GetTopUpTrends(ctx context.Context, p TopUpTrendsParams) ([]TopUpTrendPoint, error) {
 	granularity, startTs, endTs := resolveTrendsRange(p)
 
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:trends:%s:%d:%d", granularity, startTs, endTs)
+	cacheKey := cache.Key("topup:trends:%s:%d:%d", granularity, startTs, endTs)
 	var cached []TopUpTrendPoint
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return cached, nil
@@ -154,11 +154,11 @@ func GetTopUpTrends(p TopUpTrendsParams) ([]TopUpTrendPoint, error) {
 	)
 	switch granularity {
 	case "weekly":
-		result, err = topUpTrendsWeekly(startTs, endTs)
+		result, err = topUpTrendsWeekly(ctx, startTs, endTs)
 	case "monthly":
-		result, err = topUpTrendsMonthly(startTs, endTs)
+		result, err = topUpTrendsMonthly(ctx, startTs, endTs)
 	default:
-		result, err = topUpTrendsDaily(startTs, endTs)
+		result, err = topUpTrendsDaily(ctx, startTs, endTs)
 	}
 	if err != nil {
 		return nil, err
@@ -169,11 +169,9 @@ func GetTopUpTrends(p TopUpTrendsParams) ([]TopUpTrendPoint, error) {
 }
 
 // topUpTrendsDaily groups by day in the local timezone.
-func topUpTrendsDaily(startTs, endTs int64) ([]TopUpTrendPoint, error) {
-	db := database.Get()
-	tzOffset := localTZOffset()
-
-	dayGroupExpr := fmt.Sprintf("FLOOR((create_time + %d) / 86400)", tzOffset)
+func topUpTrendsDaily(ctx context.Context, startTs, endTs int64) ([]TopUpTrendPoint, error) {
+	db := database.GetRead().WithContext(ctx)
+	dayGroupExpr := reportDayExpr("create_time", startTs, endTs)
 
 	query := db.RebindQuery(fmt.Sprintf(`
 		SELECT %s as bucket,
@@ -198,15 +196,12 @@ func topUpTrendsDaily(startTs, endTs int64) ([]TopUpTrendPoint, error) {
 		lookup[toInt64(row["bucket"])] = row
 	}
 
-	loc := time.Now().Location()
-	startTime := time.Unix(startTs, 0).In(loc)
-	endTime := time.Unix(endTs, 0).In(loc)
-	cursor := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, loc)
-	last := time.Date(endTime.Year(), endTime.Month(), endTime.Day(), 0, 0, 0, 0, loc)
+	cursor := reportDayStart(time.Unix(startTs, 0))
+	last := reportDayStart(time.Unix(endTs, 0))
 
 	result := make([]TopUpTrendPoint, 0)
 	for !cursor.After(last) {
-		expectedGroup := (cursor.Unix() + int64(tzOffset)) / 86400
+		expectedGroup := reportDayGroup(cursor)
 		point := TopUpTrendPoint{
 			Date:      cursor.Format("2006-01-02"),
 			Timestamp: cursor.Unix(),
@@ -224,15 +219,12 @@ func topUpTrendsDaily(startTs, endTs int64) ([]TopUpTrendPoint, error) {
 	return result, nil
 }
 
-// topUpTrendsWeekly groups by ISO week (Monday-aligned) in the local timezone.
-// Bucket math: FLOOR((create_time + tz - 345600) / 604800).
-// 345600 = 4 * 86400 shifts Unix epoch (1970-01-01 Thu) so the *following* Monday
-// (1970-01-05) becomes bucket 0 — every other Monday-aligned week aligns from there.
-func topUpTrendsWeekly(startTs, endTs int64) ([]TopUpTrendPoint, error) {
-	db := database.Get()
-	tzOffset := localTZOffset()
+// topUpTrendsWeekly groups by ISO week (Monday-aligned) in the reporting
+// timezone; see reportWeekExpr for the bucket math.
+func topUpTrendsWeekly(ctx context.Context, startTs, endTs int64) ([]TopUpTrendPoint, error) {
+	db := database.GetRead().WithContext(ctx)
 
-	weekGroupExpr := fmt.Sprintf("FLOOR((create_time + %d - 345600) / 604800)", tzOffset)
+	weekGroupExpr := reportWeekExpr("create_time", startTs, endTs)
 
 	query := db.RebindQuery(fmt.Sprintf(`
 		SELECT %s as bucket,
@@ -257,16 +249,13 @@ func topUpTrendsWeekly(startTs, endTs int64) ([]TopUpTrendPoint, error) {
 		lookup[toInt64(row["bucket"])] = row
 	}
 
-	loc := time.Now().Location()
-	startTime := time.Unix(startTs, 0).In(loc)
-	endTime := time.Unix(endTs, 0).In(loc)
-
-	cursor := mondayOf(startTime)
-	last := mondayOf(endTime)
+	loc := ReportLocation()
+	cursor := mondayOf(time.Unix(startTs, 0).In(loc))
+	last := mondayOf(time.Unix(endTs, 0).In(loc))
 
 	result := make([]TopUpTrendPoint, 0)
 	for !cursor.After(last) {
-		expectedGroup := (cursor.Unix() + int64(tzOffset) - 345600) / 604800
+		expectedGroup := reportWeekGroup(cursor)
 		year, week := cursor.ISOWeek()
 		point := TopUpTrendPoint{
 			Date:      fmt.Sprintf("%04d-W%02d", year, week),
@@ -299,9 +288,9 @@ func mondayOf(t time.Time) time.Time {
 // topUpTrendsMonthly walks each calendar month in the range and runs an aggregate query
 // per month. SQL-side grouping for months is messy across MySQL/PG; the per-month loop
 // keeps the bucket boundaries correct and stays under the cache layer anyway.
-func topUpTrendsMonthly(startTs, endTs int64) ([]TopUpTrendPoint, error) {
-	db := database.Get()
-	loc := time.Now().Location()
+func topUpTrendsMonthly(ctx context.Context, startTs, endTs int64) ([]TopUpTrendPoint, error) {
+	db := database.GetRead().WithContext(ctx)
+	loc := ReportLocation()
 
 	startTime := time.Unix(startTs, 0).In(loc)
 	endTime := time.Unix(endTs, 0).In(loc)
@@ -356,16 +345,16 @@ func topUpTrendsMonthly(startTs, endTs int64) ([]TopUpTrendPoint, error) {
 }
 
 // GetTopUpFinancialSummary returns monthly financial summaries
-func GetTopUpFinancialSummary(months int) ([]TopUpFinancialSummary, error) {
+func GetTopUpFinancialSummary(ctx context.Context, months int) ([]TopUpFinancialSummary, error) {
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:financial:%d", months)
+	cacheKey := cache.Key("topup:financial:%d", months)
 	var cached []TopUpFinancialSummary
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return cached, nil
 	}
 
-	db := database.Get()
-	now := time.Now()
+	db := database.GetRead().WithContext(ctx)
+	now := reportNow()
 	loc := now.Location()
 
 	result := make([]TopUpFinancialSummary, 0, months)
@@ -432,15 +421,15 @@ func GetTopUpFinancialSummary(months int) ([]TopUpFinancialSummary, error) {
 }
 
 // GetTopUpTopUsers returns top users by recharge amount
-func GetTopUpTopUsers(limit int, days int) ([]TopUpTopUser, error) {
+func GetTopUpTopUsers(ctx context.Context, limit int, days int) ([]TopUpTopUser, error) {
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:topusers:%d:%d", limit, days)
+	cacheKey := cache.Key("topup:topusers:%d:%d", limit, days)
 	var cached []TopUpTopUser
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return cached, nil
 	}
 
-	db := database.Get()
+	db := database.GetRead().WithContext(ctx)
 	startTime := time.Now().AddDate(0, 0, -days).Unix()
 
 	castExpr := "CAST(t.user_id AS CHAR)"
@@ -482,15 +471,15 @@ func GetTopUpTopUsers(limit int, days int) ([]TopUpTopUser, error) {
 }
 
 // GetPaymentMethodDistribution returns payment method breakdown
-func GetPaymentMethodDistribution(days int) ([]PaymentMethodDistribution, error) {
+func GetPaymentMethodDistribution(ctx context.Context, days int) ([]PaymentMethodDistribution, error) {
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:payment_dist:%d", days)
+	cacheKey := cache.Key("topup:payment_dist:%d", days)
 	var cached []PaymentMethodDistribution
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return cached, nil
 	}
 
-	db := database.Get()
+	db := database.GetRead().WithContext(ctx)
 	startTime := time.Now().AddDate(0, 0, -days).Unix()
 
 	query := db.RebindQuery(fmt.Sprintf(`
@@ -537,9 +526,9 @@ func GetPaymentMethodDistribution(days int) ([]PaymentMethodDistribution, error)
 }
 
 // GetTopUpRealtimeStats returns real-time comparison statistics
-func GetTopUpRealtimeStats() (*TopUpRealtimeStats, error) {
-	db := database.Get()
-	now := time.Now()
+func GetTopUpRealtimeStats(ctx context.Context) (*TopUpRealtimeStats, error) {
+	db := database.GetRead().WithContext(ctx)
+	now := reportNow()
 	loc := now.Location()
 
 	// Today
@@ -559,7 +548,7 @@ func GetTopUpRealtimeStats() (*TopUpRealtimeStats, error) {
 
 	// 缓存键编入日历边界，跨日 / 跨周 / 跨月时自动失效，避免临界点展示昨天数据。
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:realtime:%d:%d:%d", todayStart, weekStart, monthStart)
+	cacheKey := cache.Key("topup:realtime:%d:%d:%d", todayStart, weekStart, monthStart)
 	var cached TopUpRealtimeStats
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return &cached, nil
@@ -641,19 +630,19 @@ func GetTopUpRealtimeStats() (*TopUpRealtimeStats, error) {
 }
 
 // GetTopUpHourlyHeatmap returns hourly heatmap data for the past N days
-func GetTopUpHourlyHeatmap(days int) ([]HourlyHeatmapPoint, error) {
+func GetTopUpHourlyHeatmap(ctx context.Context, days int) ([]HourlyHeatmapPoint, error) {
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:heatmap:%d", days)
+	cacheKey := cache.Key("topup:heatmap:%d", days)
 	var cached []HourlyHeatmapPoint
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return cached, nil
 	}
 
-	db := database.Get()
-	startTime := time.Now().AddDate(0, 0, -days).Unix()
-	tzOffset := localTZOffset()
+	db := database.GetRead().WithContext(ctx)
+	now := time.Now()
+	startTime := now.AddDate(0, 0, -days).Unix()
 
-	hourExpr, dowExpr := topUpHeatmapTimeExpressions(tzOffset, db.IsPG)
+	hourExpr, dowExpr := topUpHeatmapTimeExpressions(reportTZOffsetSQL("create_time", startTime, now.Unix()), db.IsPG)
 
 	query := db.RebindQuery(fmt.Sprintf(`
 		SELECT %s as day_of_week,
@@ -717,11 +706,12 @@ func topUpHeatmapGrid(rows []map[string]interface{}) []HourlyHeatmapPoint {
 	return result
 }
 
-func topUpHeatmapTimeExpressions(tzOffset int, isPG bool) (hourExpr, dowExpr string) {
-	// Extract day of week and hour from unix timestamp with timezone offset.
+func topUpHeatmapTimeExpressions(offsetExpr string, isPG bool) (hourExpr, dowExpr string) {
+	// Extract day of week and hour from unix timestamp with the timezone offset
+	// expression (see reportTZOffsetSQL).
 	// Day of week: (day_bucket + 4) % 7 gives 0=Sunday because Unix epoch was Thursday=4.
-	hourExpr = fmt.Sprintf("FLOOR(((create_time + %d) %% 86400) / 3600)", tzOffset)
-	dayBucketExpr := fmt.Sprintf("FLOOR((create_time + %d) / 86400)", tzOffset)
+	hourExpr = fmt.Sprintf("FLOOR(((create_time + %s) %% 86400) / 3600)", offsetExpr)
+	dayBucketExpr := fmt.Sprintf("FLOOR((create_time + %s) / 86400)", offsetExpr)
 	if isPG {
 		// PostgreSQL FLOOR(bigint division) returns double precision, and modulo
 		// is not defined for double precision. Cast before applying %.
@@ -755,19 +745,19 @@ type TopUpFunnelData struct {
 }
 
 // GetTopUpFunnel returns conversion funnel statistics for the past N days.
-func GetTopUpFunnel(days int) (*TopUpFunnelData, error) {
+func GetTopUpFunnel(ctx context.Context, days int) (*TopUpFunnelData, error) {
 	if days < 1 || days > 365 {
 		days = 30
 	}
 
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:funnel:%d", days)
+	cacheKey := cache.Key("topup:funnel:%d", days)
 	var cached TopUpFunnelData
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return &cached, nil
 	}
 
-	db := database.Get()
+	db := database.GetRead().WithContext(ctx)
 	startTime := time.Now().AddDate(0, 0, -days).Unix()
 	bucketSQL := topUpStatusBucketSQL("status")
 
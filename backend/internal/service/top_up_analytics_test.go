@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"strings"
 	"testing"
 	"time"
@@ -124,7 +125,7 @@ func TestResolveTrendsRange_DaysClamp(t *testing.T) {
 func TestGetTopUpTopUsers_QualifiesStatusWhenJoiningUsers(t *testing.T) {
 	seedTopUpAnalyticsTables(t)
 
-	got, err := GetTopUpTopUsers(10, 365)
+	got, err := GetTopUpTopUsers(context.Background(), 10, 365)
 	if err != nil {
 		t.Fatalf("GetTopUpTopUsers returned error: %v", err)
 	}
@@ -163,7 +164,7 @@ func TestSuccessStatusCondition_QualifiesAndTrimsStatus(t *testing.T) {
 }
 
 func TestTopUpHeatmapTimeExpressions_PostgresCastsDayBucketBeforeModulo(t *testing.T) {
-	_, dowExpr := topUpHeatmapTimeExpressions(28800, true)
+	_, dowExpr := topUpHeatmapTimeExpressions("28800", true)
 	for _, frag := range []string{"CAST(FLOOR", "AS BIGINT", "% 7"} {
 		if !strings.Contains(dowExpr, frag) {
 			t.Fatalf("PostgreSQL DOW expression missing %q: %s", frag, dowExpr)
@@ -234,7 +235,7 @@ func TestGetTopUpPayerCohorts_UsersCreatedAtIsOptional(t *testing.T) {
 		now-1*86400,
 	)
 
-	got, err := GetTopUpPayerCohorts(30)
+	got, err := GetTopUpPayerCohorts(context.Background(), 30)
 	if err != nil {
 		t.Fatalf("GetTopUpPayerCohorts returned error without users.created_at: %v", err)
 	}
@@ -290,7 +291,7 @@ func TestGetTopUpAnomalies_CompleteTimeIsNullable(t *testing.T) {
 		now-3*3600,
 	)
 
-	got, err := GetTopUpAnomalies(30, 2, 50)
+	got, err := GetTopUpAnomalies(context.Background(), 30, 2, 50)
 	if err != nil {
 		t.Fatalf("GetTopUpAnomalies returned error: %v", err)
 	}
@@ -338,7 +339,7 @@ func TestGetTopUpProviderHealth_PaymentProviderColumnOptional(t *testing.T) {
 	db.MustExec(`INSERT INTO top_ups (id, user_id, amount, money, trade_no, payment_method, create_time, complete_time, status)
 		VALUES (1, 1, 100, 10, 'trade-1', 'alipay', ?, ?, 'success')`, now-3600, now-3500)
 
-	got, err := GetTopUpProviderHealth(30)
+	got, err := GetTopUpProviderHealth(context.Background(), 30)
 	if err != nil {
 		t.Fatalf("GetTopUpProviderHealth returned error without payment_provider column: %v", err)
 	}
@@ -407,7 +408,7 @@ func assertHeatmapCell(t *testing.T, cells []HourlyHeatmapPoint, dow, hour int,
 
 func clearTopUpAnalyticsCache(t *testing.T) {
 	t.Helper()
-	if _, err := cache.Get().DeleteByPrefix("topup:"); err != nil {
+	if _, err := cache.Get().DeleteByPrefix(cache.Key("topup:")); err != nil {
 		t.Fatalf("clear top-up analytics cache: %v", err)
 	}
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -92,17 +93,17 @@ func round4(v float64) float64 {
 	return math.Round(v*10000) / 100
 }
 
-func GetTopUpPayerCohorts(days int) (*TopUpPayerCohorts, error) {
+func GetTopUpPayerCohorts(ctx context.Context, days int) (*TopUpPayerCohorts, error) {
 	days = normalizeTopUpDays(days, 30, 365)
 
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:payer_cohorts:%d", days)
+	cacheKey := cache.Key("topup:payer_cohorts:%d", days)
 	var cached TopUpPayerCohorts
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return &cached, nil
 	}
 
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 	startTime := time.Now().AddDate(0, 0, -days).Unix()
 	userCreatedSelect := "0 as user_created_at"
 	userJoin := ""
@@ -281,17 +282,17 @@ func buildTopUpAnomalySQLFilters(statusBucketSQL string, now int64, pendingHours
 	return filters
 }
 
-func GetTopUpProviderHealth(days int) ([]TopUpProviderHealth, error) {
+func GetTopUpProviderHealth(ctx context.Context, days int) ([]TopUpProviderHealth, error) {
 	days = normalizeTopUpDays(days, 30, 365)
 
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:provider_health:%d", days)
+	cacheKey := cache.Key("topup:provider_health:%d", days)
 	var cached []TopUpProviderHealth
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return cached, nil
 	}
 
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 	startTime := time.Now().AddDate(0, 0, -days).Unix()
 	paymentProviderExpr := topUpPaymentProviderExpr("")
 	query := db.RebindQuery(fmt.Sprintf(`
@@ -386,7 +387,7 @@ func GetTopUpProviderHealth(days int) ([]TopUpProviderHealth, error) {
 	return result, nil
 }
 
-func GetTopUpAnomalies(days int, pendingHours int, limit int) (*TopUpAnomalies, error) {
+func GetTopUpAnomalies(ctx context.Context, days int, pendingHours int, limit int) (*TopUpAnomalies, error) {
 	days = normalizeTopUpDays(days, 30, 365)
 	if pendingHours < 1 || pendingHours > 168 {
 		pendingHours = defaultPendingAnomalyHours
@@ -396,13 +397,13 @@ func GetTopUpAnomalies(days int, pendingHours int, limit int) (*TopUpAnomalies,
 	}
 
 	cm := cache.Get()
-	cacheKey := fmt.Sprintf("topup:anomalies:%d:%d:%d", days, pendingHours, limit)
+	cacheKey := cache.Key("topup:anomalies:%d:%d:%d", days, pendingHours, limit)
 	var cached TopUpAnomalies
 	if found, _ := cm.GetJSON(cacheKey, &cached); found {
 		return &cached, nil
 	}
 
-	db := database.Get()
+	db := database.Get().WithContext(ctx)
 	startTime := time.Now().AddDate(0, 0, -days).Unix()
 	now := time.Now().Unix()
 	statusBucketSQL := topUpStatusBucketSQL("t.status")
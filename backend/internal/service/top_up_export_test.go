@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/new-api-tools/backend/internal/config"
+	"github.com/new-api-tools/backend/internal/database"
 )
 
 // seedTopUps creates the top_ups table on the in-memory SQLite and inserts n rows.
@@ -74,7 +77,7 @@ func TestExportTopUpsToCSV_BOMAndHeader(t *testing.T) {
 	seedTopUps(t, 3)
 
 	var buf bytes.Buffer
-	if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{}); err != nil {
+	if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{}, nil); err != nil {
 		t.Fatalf("export: %v", err)
 	}
 	out := buf.Bytes()
@@ -104,7 +107,7 @@ func TestExportTopUpsToCSV_HardLimitBreaks(t *testing.T) {
 	seedTopUps(t, 15)
 
 	var buf bytes.Buffer
-	if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{}); err != nil {
+	if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{}, nil); err != nil {
 		t.Fatalf("export: %v", err)
 	}
 	rows := countCSVRows(t, buf.Bytes())
@@ -129,7 +132,7 @@ func TestExportTopUpsToCSV_ContextCancel(t *testing.T) {
 	cancel() // 提前取消
 
 	var buf bytes.Buffer
-	err := ExportTopUpsToCSV(ctx, &buf, ListTopUpParams{})
+	err := ExportTopUpsToCSV(ctx, &buf, ListTopUpParams{}, nil)
 	// 取消可能在 query 阶段（返回 err）或 next 阶段（返回 ctx.Err()），两种都接受
 	if err == nil {
 		// 也允许 query 已经完成但 rows.Next 检查 ctx 时返回。检查写入量很小。
@@ -186,7 +189,7 @@ func TestExportTopUpsToCSV_StatusFilter(t *testing.T) {
 
 	// pending 必须捞到 id=4 (pending) 和 id=5 (NULL)
 	var buf bytes.Buffer
-	if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{Status: "pending"}); err != nil {
+	if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{Status: "pending"}, nil); err != nil {
 		t.Fatalf("export: %v", err)
 	}
 	out := string(buf.Bytes())
@@ -200,3 +203,54 @@ func TestExportTopUpsToCSV_StatusFilter(t *testing.T) {
 		t.Errorf("pending export must NOT include success/failed rows, got:\n%s", out)
 	}
 }
+
+// TestExportTopUpsToCSV_Anonymized 验证脱敏导出：用户 ID / 用户名被替换为稳定假名，
+// 同一用户两次导出得到相同假名，原始用户名不出现在输出中。
+func TestExportTopUpsToCSV_Anonymized(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	seedTopUps(t, 10)
+	if _, err := database.Get().DB.Exec(`INSERT INTO users (id, username) VALUES (1, 'Alice@Example.com'), (2, 'bob')`); err != nil {
+		t.Fatalf("users: %v", err)
+	}
+
+	export := func() [][]string {
+		anon, err := NewExportAnonymizer(context.Background())
+		if err != nil {
+			t.Fatalf("anonymizer: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := ExportTopUpsToCSV(context.Background(), &buf, ListTopUpParams{}, anon); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		if strings.Contains(strings.ToLower(buf.String()), "alice") || strings.Contains(buf.String(), "bob") {
+			t.Fatalf("anonymized export leaked a username:\n%s", buf.String())
+		}
+		rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\xEF\xBB\xBF"))).ReadAll()
+		if err != nil {
+			t.Fatalf("parse csv: %v", err)
+		}
+		return rows[1:]
+	}
+
+	first, second := export(), export()
+	pseudonyms := map[string]string{}
+	for i, row := range first {
+		if !strings.HasPrefix(row[1], "u_") || row[1] != second[i][1] || row[2] != second[i][2] {
+			t.Fatalf("pseudonyms should be stable across exports: %v vs %v", row, second[i])
+		}
+		if prev, ok := pseudonyms[row[1]]; ok && prev != row[2] {
+			t.Fatalf("one user should map to one name pseudonym")
+		}
+		pseudonyms[row[1]] = row[2]
+	}
+	if len(pseudonyms) != 5 {
+		t.Fatalf("expected 5 distinct user pseudonyms, got %d", len(pseudonyms))
+	}
+
+	var plain *ExportAnonymizer
+	if plain.UserID(7) != "7" || plain.Name("bob") != "bob" {
+		t.Fatalf("nil anonymizer must leave values unchanged")
+	}
+}
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/util"
+)
+
+// Reconciliation limits
+const (
+	reconcileDefaultDays     = 30
+	reconcileMaxDays         = 366
+	reconcileDefaultSlackMin = 10
+	reconcileMaxTopUps       = 50000
+	reconcileMaxLogs         = 100000
+	// 充值单可能在创建后很久才完成回调，日志查询窗口向后多放一天
+	reconcileCompleteGrace = 24 * 3600
+)
+
+// Mismatch kinds
+const (
+	ReconcilePaidNotCredited      = "paid_not_credited"
+	ReconcileAmountMismatch       = "amount_mismatch"
+	ReconcileRefundNotReflected   = "refund_not_reflected"
+	ReconcileCreditWithoutPayment = "credited_without_payment"
+)
+
+var (
+	// "使用在线充值成功，充值金额: ＄10.000000，支付金额：72.000000"
+	reconcileCreditAmountRe = regexp.MustCompile(`充值金额[:：]\s*[^\d\-]*(-?[\d.]+)`)
+	// "管理员将用户额度从 ＄10.000000 额度修改为 ＄0.000000 额度"
+	reconcileQuotaChangeRe = regexp.MustCompile(`从\s*[^\d\-]*(-?[\d.]+).*?修改为\s*[^\d\-]*(-?[\d.]+)`)
+)
+
+// ErrReconcileWindow is returned (wrapped) for an invalid start/end window
+var ErrReconcileWindow = errors.New("invalid reconciliation window")
+
+// TopUpReconcileParams controls the reconciliation window
+type TopUpReconcileParams struct {
+	StartDate    string `json:"start_date"` // YYYY-MM-DD, default = end - 30 days
+	EndDate      string `json:"end_date"`   // YYYY-MM-DD, default = today
+	SlackMinutes int    `json:"slack_minutes"`
+}
+
+// TopUpMismatch is one flagged row of the reconciliation report
+type TopUpMismatch struct {
+	Kind          string  `json:"kind"`
+	Detail        string  `json:"detail"`
+	TopUpID       int64   `json:"top_up_id,omitempty"`
+	TradeNo       string  `json:"trade_no,omitempty"`
+	UserID        int64   `json:"user_id"`
+	Username      string  `json:"username,omitempty"`
+	Amount        int64   `json:"amount,omitempty"`
+	Money         float64 `json:"money,omitempty"`
+	PaymentMethod string  `json:"payment_method,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	CreateTime    int64   `json:"create_time,omitempty"`
+	CompleteTime  int64   `json:"complete_time,omitempty"`
+	LogID         int64   `json:"log_id,omitempty"`
+	LogTime       int64   `json:"log_time,omitempty"`
+	LogContent    string  `json:"log_content,omitempty"`
+}
+
+// TopUpReconcileSummary aggregates the report
+type TopUpReconcileSummary struct {
+	CheckedTopUps          int     `json:"checked_top_ups"`
+	Matched                int     `json:"matched"`
+	PaidMoney              float64 `json:"paid_money"`
+	PaidAmount             int64   `json:"paid_amount"`
+	PaidNotCredited        int     `json:"paid_not_credited"`
+	AmountMismatch         int     `json:"amount_mismatch"`
+	RefundsChecked         int     `json:"refunds_checked"`
+	RefundNotReflected     int     `json:"refund_not_reflected"`
+	CreditLogs             int     `json:"credit_logs"`
+	CreditedWithoutPayment int     `json:"credited_without_payment"`
+}
+
+// TopUpReconcileReport is the full reconciliation result
+type TopUpReconcileReport struct {
+	StartTime    int64                 `json:"start_time"`
+	EndTime      int64                 `json:"end_time"`
+	SlackMinutes int                   `json:"slack_minutes"`
+	Summary      TopUpReconcileSummary `json:"summary"`
+	Mismatches   []TopUpMismatch       `json:"mismatches"`
+	Truncated    bool                  `json:"truncated"`
+	GeneratedAt  int64                 `json:"generated_at"`
+}
+
+type reconcileTopUp struct {
+	ID            int64
+	UserID        int64
+	Username      string
+	Amount        int64
+	Money         float64
+	TradeNo       string
+	PaymentMethod string
+	Status        string
+	CreateTime    int64
+	CompleteTime  int64
+	refunded      bool
+}
+
+// refTime is when the credit log is expected to appear
+func (t reconcileTopUp) refTime() int64 {
+	if t.CompleteTime > 0 {
+		return t.CompleteTime
+	}
+	return t.CreateTime
+}
+
+type reconcileLog struct {
+	ID        int64
+	UserID    int64
+	Type      int64
+	CreatedAt int64
+	Content   string
+	used      bool
+}
+
+// isRefundStatus reports whether a top_ups.status marks a refunded order.
+// topUpStatusBucket has no refund bucket (NewAPI upstream never writes one),
+// but several payment forks do.
+func isRefundStatus(status string) bool {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "refund", "refunded":
+		return true
+	}
+	return false
+}
+
+// resolveReconcileWindow turns params into [start, end] unix seconds
+func resolveReconcileWindow(params TopUpReconcileParams, now time.Time) (int64, int64, error) {
+	end := now.Unix()
+	if params.EndDate != "" {
+		ts, err := parseReportDate(params.EndDate, true)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: end_date: %v", ErrReconcileWindow, err)
+		}
+		end = ts
+	}
+	start := end - reconcileDefaultDays*86400
+	if params.StartDate != "" {
+		ts, err := parseReportDate(params.StartDate, false)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: start_date: %v", ErrReconcileWindow, err)
+		}
+		start = ts
+	}
+	if start >= end {
+		return 0, 0, fmt.Errorf("%w: start_date must be before end_date", ErrReconcileWindow)
+	}
+	if end-start > reconcileMaxDays*86400 {
+		return 0, 0, fmt.Errorf("%w: max %d days", ErrReconcileWindow, reconcileMaxDays)
+	}
+	return start, end, nil
+}
+
+// ReconcileTopUps cross-checks paid / refunded top_ups against the quota
+// credit (type=1) and admin adjustment (type=3) logs NewAPI writes when it
+// changes a user's balance.
+//
+//   - paid_not_credited: 成功订单在完成时间 ±slack 内找不到对应的充值日志
+//   - amount_mismatch: 充值日志里的金额和订单 amount 不一致
+//   - refund_not_reflected: 已退款订单曾到账，但之后没有扣减额度的管理日志
+//   - credited_without_payment: 在线充值日志找不到对应的成功订单
+func ReconcileTopUps(ctx context.Context, params TopUpReconcileParams) (*TopUpReconcileReport, error) {
+	start, end, err := resolveReconcileWindow(params, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	slack := clampSetting(params.SlackMinutes, 1, 1440, reconcileDefaultSlackMin)
+
+	topUps, truncated, err := loadReconcileTopUps(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	logs, logsTruncated, err := loadReconcileLogs(ctx, start-int64(slack)*60, end+reconcileCompleteGrace+int64(slack)*60)
+	if err != nil {
+		return nil, err
+	}
+
+	report := reconcileTopUpRecords(topUps, logs, start, end, slack)
+	report.Truncated = truncated || logsTruncated
+	return report, nil
+}
+
+func loadReconcileTopUps(ctx context.Context, start, end int64) ([]reconcileTopUp, bool, error) {
+	db := database.Get().WithContext(ctx)
+	query := db.RebindQuery(fmt.Sprintf(`
+		SELECT t.id, t.user_id, COALESCE(u.username, '') as username, COALESCE(t.amount, 0) as amount,
+			COALESCE(t.money, 0) as money, COALESCE(t.trade_no, '') as trade_no,
+			COALESCE(t.payment_method, '') as payment_method, COALESCE(t.status, '') as status,
+			COALESCE(t.create_time, 0) as create_time, COALESCE(t.complete_time, 0) as complete_time
+		FROM top_ups t
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.create_time >= ? AND t.create_time <= ?
+			AND ((%s) = 'success' OR LOWER(TRIM(COALESCE(t.status, ''))) IN ('refund', 'refunded'))
+		ORDER BY t.id ASC
+		LIMIT ?`, topUpStatusBucketSQL("t.status")))
+	rows, err := db.QueryWithTimeout(60*time.Second, query, start, end, reconcileMaxTopUps+1)
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := len(rows) > reconcileMaxTopUps
+	if truncated {
+		rows = rows[:reconcileMaxTopUps]
+	}
+	out := make([]reconcileTopUp, 0, len(rows))
+	for _, r := range rows {
+		t := reconcileTopUp{
+			ID:            toInt64(r["id"]),
+			UserID:        toInt64(r["user_id"]),
+			Username:      toString(r["username"]),
+			Amount:        toInt64(r["amount"]),
+			Money:         toFloat64(r["money"]),
+			TradeNo:       toString(r["trade_no"]),
+			PaymentMethod: toString(r["payment_method"]),
+			Status:        toString(r["status"]),
+			CreateTime:    toInt64(r["create_time"]),
+			CompleteTime:  toInt64(r["complete_time"]),
+		}
+		t.refunded = isRefundStatus(t.Status)
+		out = append(out, t)
+	}
+	return out, truncated, nil
+}
+
+func loadReconcileLogs(ctx context.Context, start, end int64) ([]reconcileLog, bool, error) {
+	logDB := database.GetLog().WithContext(ctx)
+	query := logDB.RebindQuery(`
+		SELECT id, user_id, type, created_at, COALESCE(content, '') as content
+		FROM logs
+		WHERE created_at >= ? AND created_at <= ? AND type IN (` + ltQuotaCredits() + `)
+		ORDER BY created_at ASC, id ASC
+		LIMIT ?`)
+	rows, err := logDB.QueryWithTimeout(60*time.Second, query, start, end, reconcileMaxLogs+1)
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := len(rows) > reconcileMaxLogs
+	if truncated {
+		rows = rows[:reconcileMaxLogs]
+	}
+	out := make([]reconcileLog, 0, len(rows))
+	for _, r := range rows {
+		l := reconcileLog{
+			ID:        toInt64(r["id"]),
+			UserID:    toInt64(r["user_id"]),
+			Type:      toInt64(r["type"]),
+			CreatedAt: toInt64(r["created_at"]),
+			Content:   toString(r["content"]),
+		}
+		// 兑换码充值同样是充值类型（type=1），但和 top_ups 无关
+		if l.Type == int64(logTypes().TopUp) && strings.Contains(l.Content, "兑换码") {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out, truncated, nil
+}
+
+// reconcileTopUpRecords does the matching; split out so it can be tested without a DB
+func reconcileTopUpRecords(topUps []reconcileTopUp, logs []reconcileLog, start, end int64, slackMinutes int) *TopUpReconcileReport {
+	report := &TopUpReconcileReport{
+		StartTime:    start,
+		EndTime:      end,
+		SlackMinutes: slackMinutes,
+		Mismatches:   []TopUpMismatch{},
+		GeneratedAt:  time.Now().Unix(),
+	}
+	slack := int64(slackMinutes) * 60
+
+	credits := map[int64][]*reconcileLog{}
+	adjustments := map[int64][]*reconcileLog{}
+	topUpType := int64(logTypes().TopUp)
+	for i := range logs {
+		l := &logs[i]
+		if l.Type == topUpType {
+			credits[l.UserID] = append(credits[l.UserID], l)
+			if l.CreatedAt >= start && l.CreatedAt <= end {
+				report.Summary.CreditLogs++
+			}
+		} else {
+			adjustments[l.UserID] = append(adjustments[l.UserID], l)
+		}
+	}
+
+	sort.SliceStable(topUps, func(i, j int) bool { return topUps[i].refTime() < topUps[j].refTime() })
+	for _, t := range topUps {
+		credit := matchCreditLog(credits[t.UserID], t.refTime(), slack)
+		if credit != nil {
+			credit.used = true
+		}
+
+		if t.refunded {
+			report.Summary.RefundsChecked++
+			// 没到过账就无需冲正；到账了则要求之后有一条扣减额度的管理日志
+			if credit != nil && !hasQuotaDecreaseAfter(adjustments[t.UserID], credit.CreatedAt) {
+				report.Summary.RefundNotReflected++
+				report.Mismatches = append(report.Mismatches, newTopUpMismatch(ReconcileRefundNotReflected,
+					"订单已退款，但到账后没有扣减额度的记录", t, credit))
+			}
+			continue
+		}
+
+		report.Summary.CheckedTopUps++
+		report.Summary.PaidMoney += t.Money
+		report.Summary.PaidAmount += t.Amount
+		if credit == nil {
+			report.Summary.PaidNotCredited++
+			report.Mismatches = append(report.Mismatches, newTopUpMismatch(ReconcilePaidNotCredited,
+				fmt.Sprintf("完成时间 ±%d 分钟内没有充值到账日志", slackMinutes), t, nil))
+			continue
+		}
+		report.Summary.Matched++
+		if logged, ok := parseCreditAmount(credit.Content); ok && !creditAmountMatches(logged, t.Amount) {
+			report.Summary.AmountMismatch++
+			report.Mismatches = append(report.Mismatches, newTopUpMismatch(ReconcileAmountMismatch,
+				fmt.Sprintf("日志到账 %s，订单额度 %d", strconv.FormatFloat(logged, 'f', -1, 64), t.Amount), t, credit))
+		}
+	}
+
+	for _, userLogs := range credits {
+		for _, l := range userLogs {
+			if l.used || l.CreatedAt < start || l.CreatedAt > end || !strings.Contains(l.Content, "在线充值") {
+				continue
+			}
+			report.Summary.CreditedWithoutPayment++
+			report.Mismatches = append(report.Mismatches, TopUpMismatch{
+				Kind:       ReconcileCreditWithoutPayment,
+				Detail:     "在线充值到账日志找不到对应的成功订单",
+				UserID:     l.UserID,
+				LogID:      l.ID,
+				LogTime:    l.CreatedAt,
+				LogContent: l.Content,
+			})
+		}
+	}
+
+	report.Summary.PaidMoney = math.Round(report.Summary.PaidMoney*100) / 100
+	sort.SliceStable(report.Mismatches, func(i, j int) bool {
+		return mismatchTime(report.Mismatches[i]) < mismatchTime(report.Mismatches[j])
+	})
+	return report
+}
+
+// matchCreditLog picks the closest unused credit log within ±slack of ts
+func matchCreditLog(logs []*reconcileLog, ts, slack int64) *reconcileLog {
+	var best *reconcileLog
+	bestDiff := slack + 1
+	for _, l := range logs {
+		if l.used {
+			continue
+		}
+		diff := l.CreatedAt - ts
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= slack && diff < bestDiff {
+			best, bestDiff = l, diff
+		}
+	}
+	return best
+}
+
+// hasQuotaDecreaseAfter reports whether any admin log after ts lowered the quota
+// or mentions a refund.
+func hasQuotaDecreaseAfter(logs []*reconcileLog, ts int64) bool {
+	for _, l := range logs {
+		if l.CreatedAt < ts {
+			continue
+		}
+		if strings.Contains(l.Content, "退款") {
+			return true
+		}
+		m := reconcileQuotaChangeRe.FindStringSubmatch(l.Content)
+		if len(m) == 3 {
+			from, err1 := strconv.ParseFloat(m[1], 64)
+			to, err2 := strconv.ParseFloat(m[2], 64)
+			if err1 == nil && err2 == nil && to < from {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseCreditAmount(content string) (float64, bool) {
+	m := reconcileCreditAmountRe.FindStringSubmatch(content)
+	if len(m) != 2 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	return v, err == nil
+}
+
+// creditAmountMatches accepts the logged amount as either the order amount
+// (USD display) or amount converted to quota (token display).
+func creditAmountMatches(logged float64, amount int64) bool {
+	const eps = 0.01
+	return math.Abs(logged-float64(amount)) < eps || math.Abs(logged-float64(amount)*util.TokensPerUSD) < eps
+}
+
+func newTopUpMismatch(kind, detail string, t reconcileTopUp, l *reconcileLog) TopUpMismatch {
+	m := TopUpMismatch{
+		Kind:          kind,
+		Detail:        detail,
+		TopUpID:       t.ID,
+		TradeNo:       t.TradeNo,
+		UserID:        t.UserID,
+		Username:      t.Username,
+		Amount:        t.Amount,
+		Money:         t.Money,
+		PaymentMethod: t.PaymentMethod,
+		Status:        t.Status,
+		CreateTime:    t.CreateTime,
+		CompleteTime:  t.CompleteTime,
+	}
+	if l != nil {
+		m.LogID = l.ID
+		m.LogTime = l.CreatedAt
+		m.LogContent = l.Content
+	}
+	return m
+}
+
+func mismatchTime(m TopUpMismatch) int64 {
+	if m.CompleteTime > 0 {
+		return m.CompleteTime
+	}
+	if m.CreateTime > 0 {
+		return m.CreateTime
+	}
+	return m.LogTime
+}
+
+// WriteReconciliationCSV writes the mismatches of a report as CSV; a non-nil
+// anon masks user ids and usernames
+func WriteReconciliationCSV(w io.Writer, report *TopUpReconcileReport, anon *ExportAnonymizer) error {
+	// UTF-8 BOM so Excel (zh-CN locale) auto-detects encoding.
+	if _, err := w.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+		return err
+	}
+	csvW := csv.NewWriter(w)
+	defer csvW.Flush()
+
+	header := []string{"类型", "说明", "订单ID", "交易号", "用户ID", "用户名", "额度(USD)", "金额(CNY)",
+		"支付方式", "状态", "创建时间", "完成时间", "日志ID", "日志时间", "日志内容"}
+	if err := csvW.Write(header); err != nil {
+		return err
+	}
+
+	formatTime := func(ts int64) string {
+		if ts <= 0 {
+			return ""
+		}
+		return time.Unix(ts, 0).Format(time.RFC3339)
+	}
+	for _, m := range report.Mismatches {
+		if err := csvW.Write([]string{
+			m.Kind,
+			m.Detail,
+			strconv.FormatInt(m.TopUpID, 10),
+			m.TradeNo,
+			anon.UserID(m.UserID),
+			anon.Name(m.Username),
+			strconv.FormatInt(m.Amount, 10),
+			strconv.FormatFloat(m.Money, 'f', 2, 64),
+			m.PaymentMethod,
+			m.Status,
+			formatTime(m.CreateTime),
+			formatTime(m.CompleteTime),
+			strconv.FormatInt(m.LogID, 10),
+			formatTime(m.LogTime),
+			m.LogContent,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
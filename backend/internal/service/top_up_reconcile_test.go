@@ -0,0 +1,52 @@
+package service
+
+import "testing"
+
+func TestReconcileTopUpRecords(t *testing.T) {
+	const day = int64(1717200000)
+	topUps := []reconcileTopUp{
+		{ID: 1, UserID: 10, Amount: 10, Money: 72, Status: "success", CreateTime: day, CompleteTime: day + 60},
+		{ID: 2, UserID: 11, Amount: 5, Money: 36, Status: "success", CreateTime: day, CompleteTime: day + 120},
+		{ID: 3, UserID: 12, Amount: 20, Money: 144, Status: "success", CreateTime: day, CompleteTime: day + 30},
+		{ID: 4, UserID: 13, Amount: 8, Money: 57.6, Status: "refunded", CreateTime: day, CompleteTime: day + 10, refunded: true},
+		{ID: 5, UserID: 14, Amount: 8, Money: 57.6, Status: "refunded", CreateTime: day, CompleteTime: day + 10, refunded: true},
+	}
+	logs := []reconcileLog{
+		{ID: 100, UserID: 10, Type: 1, CreatedAt: day + 62, Content: "使用在线充值成功，充值金额: ＄10.000000，支付金额：72.000000"},
+		// user 11 credited outside the slack window
+		{ID: 101, UserID: 11, Type: 1, CreatedAt: day + 3600, Content: "使用在线充值成功，充值金额: ＄5.000000，支付金额：36.000000"},
+		{ID: 102, UserID: 12, Type: 1, CreatedAt: day + 31, Content: "使用在线充值成功，充值金额: ＄2.000000，支付金额：144.000000"},
+		{ID: 103, UserID: 13, Type: 1, CreatedAt: day + 12, Content: "使用在线充值成功，充值金额: ＄8.000000，支付金额：57.600000"},
+		{ID: 104, UserID: 14, Type: 1, CreatedAt: day + 12, Content: "使用在线充值成功，充值金额: ＄8.000000，支付金额：57.600000"},
+		{ID: 105, UserID: 14, Type: 3, CreatedAt: day + 900, Content: "管理员将用户额度从 ＄8.000000 额度修改为 ＄0.000000 额度"},
+	}
+
+	report := reconcileTopUpRecords(topUps, logs, day, day+86400, 10)
+	s := report.Summary
+	if s.CheckedTopUps != 3 || s.Matched != 2 || s.RefundsChecked != 2 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if s.PaidNotCredited != 1 || s.AmountMismatch != 1 || s.RefundNotReflected != 1 || s.CreditedWithoutPayment != 1 {
+		t.Fatalf("unexpected mismatch counts: %+v", s)
+	}
+
+	kinds := map[string]int64{}
+	for _, m := range report.Mismatches {
+		if m.TopUpID != 0 {
+			kinds[m.Kind] = m.TopUpID
+		} else {
+			kinds[m.Kind] = m.LogID
+		}
+	}
+	want := map[string]int64{
+		ReconcilePaidNotCredited:      2,
+		ReconcileAmountMismatch:       3,
+		ReconcileRefundNotReflected:   4,
+		ReconcileCreditWithoutPayment: 101,
+	}
+	for k, id := range want {
+		if kinds[k] != id {
+			t.Fatalf("%s: want %d, got %d (all: %v)", k, id, kinds[k], kinds)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/cache"
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+// MethodRevenue is revenue / order count of one payment method in a bucket
+type MethodRevenue struct {
+	Method  string  `json:"method"`
+	Revenue float64 `json:"revenue"`
+	Count   int64   `json:"count"`
+	Share   float64 `json:"share"` // percent of the bucket's revenue
+}
+
+// RevenueTrendPoint is one day / week of the revenue breakdown
+type RevenueTrendPoint struct {
+	Date             string          `json:"date"`
+	Timestamp        int64           `json:"timestamp"`
+	Revenue          float64         `json:"revenue"`
+	Orders           int64           `json:"orders"`
+	PayingUsers      int64           `json:"paying_users"`
+	ARPU             float64         `json:"arpu"` // revenue per paying user
+	NewPayers        int64           `json:"new_payers"`
+	ReturningPayers  int64           `json:"returning_payers"`
+	NewRevenue       float64         `json:"new_revenue"`
+	ReturningRevenue float64         `json:"returning_revenue"`
+	RefundCount      int64           `json:"refund_count"`
+	RefundMoney      float64         `json:"refund_money"`
+	RefundRate       float64         `json:"refund_rate"` // percent of paid orders later refunded
+	ByMethod         []MethodRevenue `json:"by_method"`
+}
+
+// RevenueTrends is the response of GetRevenueTrends
+type RevenueTrends struct {
+	Granularity string              `json:"granularity"`
+	StartTime   int64               `json:"start_time"`
+	EndTime     int64               `json:"end_time"`
+	Methods     []string            `json:"methods"`
+	Totals      RevenueTrendPoint   `json:"totals"`
+	Series      []RevenueTrendPoint `json:"series"`
+}
+
+// revenueRefundCondition matches refunded orders (see isRefundStatus)
+func revenueRefundCondition(column string) string {
+	return fmt.Sprintf("LOWER(TRIM(COALESCE(%s, ''))) IN ('refund', 'refunded')", column)
+}
+
+// revenueBucketExpr returns the SQL bucket expression for a unix column, using
+// the same day / Monday-aligned week math as topUpTrendsDaily / topUpTrendsWeekly.
+func revenueBucketExpr(granularity, column string, startTs, endTs int64) string {
+	if granularity == "weekly" {
+		return reportWeekExpr(column, startTs, endTs)
+	}
+	return reportDayExpr(column, startTs, endTs)
+}
+
+// revenueBucket is the Go counterpart of revenueBucketExpr
+func revenueBucket(granularity string, t time.Time) int64 {
+	if granularity == "weekly" {
+		return reportWeekGroup(t)
+	}
+	return reportDayGroup(t)
+}
+
+// GetRevenueTrends returns daily or weekly revenue per payment method with
+// ARPU, refund rate and the new vs returning payer split. A payer is "new" in
+// the bucket that contains their first ever successful top-up.
+func GetRevenueTrends(ctx context.Context, p TopUpTrendsParams) (*RevenueTrends, error) {
+	granularity, startTs, endTs := resolveTrendsRange(p)
+	if granularity == "monthly" {
+		granularity = "weekly"
+	}
+
+	cm := cache.Get()
+	cacheKey := cache.Key("topup:revenue_trends:%s:%d:%d", granularity, startTs, endTs)
+	var cached RevenueTrends
+	if found, _ := cm.GetJSON(cacheKey, &cached); found {
+		return &cached, nil
+	}
+
+	db := database.Get().WithContext(ctx)
+	bucket := revenueBucketExpr(granularity, "t.create_time", startTs, endTs)
+	success := fmt.Sprintf("(%s) = 'success'", topUpStatusBucketSQL("t.status"))
+	refund := revenueRefundCondition("t.status")
+
+	// 1. revenue / refunds per bucket × method
+	methodRows, err := db.QueryWithTimeout(15*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT %s as bucket, COALESCE(t.payment_method, '') as method,
+			COALESCE(SUM(CASE WHEN %s THEN 1 ELSE 0 END), 0) as success_count,
+			COALESCE(SUM(CASE WHEN %s THEN t.money ELSE 0 END), 0) as success_money,
+			COALESCE(SUM(CASE WHEN %s THEN 1 ELSE 0 END), 0) as refund_count,
+			COALESCE(SUM(CASE WHEN %s THEN t.money ELSE 0 END), 0) as refund_money
+		FROM top_ups t
+		WHERE t.create_time >= ? AND t.create_time <= ? AND (%s OR %s)
+		GROUP BY %s, COALESCE(t.payment_method, '')`,
+		bucket, success, success, refund, refund, success, refund, bucket)), startTs, endTs)
+	if err != nil {
+		return nil, fmt.Errorf("revenue by method query failed: %w", err)
+	}
+
+	// 2. paying users and new vs returning per bucket
+	firstBucket := revenueBucketExpr(granularity, "f.first_time", startTs, endTs)
+	payerRows, err := db.QueryWithTimeout(15*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT %s as bucket,
+			COUNT(DISTINCT t.user_id) as paying_users,
+			COUNT(DISTINCT CASE WHEN %s = %s THEN t.user_id END) as new_payers,
+			COALESCE(SUM(CASE WHEN %s = %s THEN t.money ELSE 0 END), 0) as new_revenue
+		FROM top_ups t
+		JOIN (
+			SELECT t.user_id, MIN(t.create_time) as first_time
+			FROM top_ups t
+			WHERE %s AND t.user_id > 0
+			GROUP BY t.user_id
+		) f ON f.user_id = t.user_id
+		WHERE t.create_time >= ? AND t.create_time <= ? AND %s
+		GROUP BY %s`,
+		bucket, firstBucket, bucket, firstBucket, bucket, success, success, bucket)), startTs, endTs)
+	if err != nil {
+		return nil, fmt.Errorf("revenue payer split query failed: %w", err)
+	}
+
+	// 3. distinct payers over the whole window (not the sum of buckets)
+	var totalPayers int64
+	if row, err := db.QueryOneWithTimeout(15*time.Second, db.RebindQuery(fmt.Sprintf(`
+		SELECT COUNT(DISTINCT t.user_id) as paying_users FROM top_ups t
+		WHERE t.create_time >= ? AND t.create_time <= ? AND %s AND t.user_id > 0`, success)), startTs, endTs); err == nil && row != nil {
+		totalPayers = toInt64(row["paying_users"])
+	}
+
+	result := buildRevenueTrends(granularity, startTs, endTs, methodRows, payerRows, totalPayers)
+	cm.Set(cacheKey, result, 5*time.Minute)
+	return result, nil
+}
+
+// buildRevenueTrends gap-fills the buckets and derives the ratios
+func buildRevenueTrends(granularity string, startTs, endTs int64, methodRows, payerRows []map[string]interface{}, totalPayers int64) *RevenueTrends {
+	byBucketMethod := map[int64]map[string]*MethodRevenue{}
+	refunds := map[int64][2]float64{} // count, money
+	methodSet := map[string]bool{}
+	totalsByMethod := map[string]*MethodRevenue{}
+	for _, r := range methodRows {
+		b := toInt64(r["bucket"])
+		method := strings.TrimSpace(toString(r["method"]))
+		if method == "" {
+			method = "unknown"
+		}
+		if cnt := toInt64(r["success_count"]); cnt > 0 {
+			methodSet[method] = true
+			if byBucketMethod[b] == nil {
+				byBucketMethod[b] = map[string]*MethodRevenue{}
+			}
+			m := byBucketMethod[b][method]
+			if m == nil {
+				m = &MethodRevenue{Method: method}
+				byBucketMethod[b][method] = m
+			}
+			m.Count += cnt
+			m.Revenue += toFloat64(r["success_money"])
+
+			tm := totalsByMethod[method]
+			if tm == nil {
+				tm = &MethodRevenue{Method: method}
+				totalsByMethod[method] = tm
+			}
+			tm.Count += cnt
+			tm.Revenue += toFloat64(r["success_money"])
+		}
+		rf := refunds[b]
+		rf[0] += float64(toInt64(r["refund_count"]))
+		rf[1] += toFloat64(r["refund_money"])
+		refunds[b] = rf
+	}
+	payers := make(map[int64]map[string]interface{}, len(payerRows))
+	for _, r := range payerRows {
+		payers[toInt64(r["bucket"])] = r
+	}
+
+	methods := make([]string, 0, len(methodSet))
+	for m := range methodSet {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+
+	loc := ReportLocation()
+	start := time.Unix(startTs, 0).In(loc)
+	end := time.Unix(endTs, 0).In(loc)
+	cursor := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	last := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc)
+	step := 1
+	if granularity == "weekly" {
+		cursor, last, step = mondayOf(start), mondayOf(end), 7
+	}
+
+	totals := RevenueTrendPoint{Date: "total", Timestamp: startTs}
+	series := make([]RevenueTrendPoint, 0)
+	for !cursor.After(last) {
+		b := revenueBucket(granularity, cursor)
+		point := RevenueTrendPoint{Timestamp: cursor.Unix()}
+		if granularity == "weekly" {
+			year, week := cursor.ISOWeek()
+			point.Date = fmt.Sprintf("%04d-W%02d", year, week)
+		} else {
+			point.Date = cursor.Format("2006-01-02")
+		}
+
+		point.ByMethod = make([]MethodRevenue, 0, len(byBucketMethod[b]))
+		for _, m := range byBucketMethod[b] {
+			point.Revenue += m.Revenue
+			point.Orders += m.Count
+			point.ByMethod = append(point.ByMethod, *m)
+		}
+		finishMethodShares(point.ByMethod, point.Revenue)
+		if pr, ok := payers[b]; ok {
+			point.PayingUsers = toInt64(pr["paying_users"])
+			point.NewPayers = toInt64(pr["new_payers"])
+			point.NewRevenue = toFloat64(pr["new_revenue"])
+		}
+		rf := refunds[b]
+		point.RefundCount, point.RefundMoney = int64(rf[0]), rf[1]
+		finishRevenuePoint(&point)
+
+		totals.Revenue += point.Revenue
+		totals.Orders += point.Orders
+		totals.NewPayers += point.NewPayers
+		totals.NewRevenue += point.NewRevenue
+		totals.RefundCount += point.RefundCount
+		totals.RefundMoney += point.RefundMoney
+
+		series = append(series, point)
+		cursor = cursor.AddDate(0, 0, step)
+	}
+
+	totals.PayingUsers = totalPayers
+	totals.ByMethod = make([]MethodRevenue, 0, len(totalsByMethod))
+	for _, m := range totalsByMethod {
+		totals.ByMethod = append(totals.ByMethod, *m)
+	}
+	finishMethodShares(totals.ByMethod, totals.Revenue)
+	finishRevenuePoint(&totals)
+
+	return &RevenueTrends{
+		Granularity: granularity,
+		StartTime:   startTs,
+		EndTime:     endTs,
+		Methods:     methods,
+		Totals:      totals,
+		Series:      series,
+	}
+}
+
+func finishMethodShares(items []MethodRevenue, total float64) {
+	for i := range items {
+		items[i].Revenue = round2(items[i].Revenue)
+		if total > 0 {
+			items[i].Share = round2(items[i].Revenue / total * 100)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Revenue != items[j].Revenue {
+			return items[i].Revenue > items[j].Revenue
+		}
+		return items[i].Method < items[j].Method
+	})
+}
+
+func finishRevenuePoint(p *RevenueTrendPoint) {
+	p.ReturningPayers = p.PayingUsers - p.NewPayers
+	if p.ReturningPayers < 0 {
+		p.ReturningPayers = 0
+	}
+	p.ReturningRevenue = round2(p.Revenue - p.NewRevenue)
+	p.Revenue = round2(p.Revenue)
+	p.NewRevenue = round2(p.NewRevenue)
+	p.RefundMoney = round2(p.RefundMoney)
+	if p.PayingUsers > 0 {
+		p.ARPU = round2(p.Revenue / float64(p.PayingUsers))
+	}
+	if paid := p.Orders + p.RefundCount; paid > 0 {
+		p.RefundRate = round2(float64(p.RefundCount) / float64(paid) * 100)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+)
+
+func TestGetRevenueTrends(t *testing.T) {
+	seedTopUpAnalyticsTables(t)
+	db := database.Get().DB
+	now := time.Now().Unix()
+	// bob's first ever payment was long ago → returning; user 7 pays for the first time today
+	db.MustExec(`INSERT INTO top_ups (id, user_id, amount, money, payment_method, create_time, complete_time, status) VALUES
+		(10, 2, 10, 8, 'alipay', ?, ?, 'success'),
+		(11, 2, 10, 8, 'alipay', ?, ?, 'success'),
+		(12, 7, 10, 12, 'alipay', ?, ?, 'success'),
+		(13, 7, 10, 6, 'alipay', ?, ?, 'refunded')`,
+		now-200*86400, now-200*86400,
+		now-600, now-500,
+		now-400, now-300,
+		now-300, now-200)
+
+	res, err := GetRevenueTrends(context.Background(), TopUpTrendsParams{Granularity: "daily", Days: 7})
+	if err != nil {
+		t.Fatalf("GetRevenueTrends: %v", err)
+	}
+	if len(res.Series) != 7 {
+		t.Fatalf("expected 7 daily points, got %d", len(res.Series))
+	}
+	tot := res.Totals
+	// seeded stripe orders: 20 + 10 + 5 (pending 500 excluded); alipay today: 8 + 12
+	if tot.Revenue != 55 || tot.Orders != 5 {
+		t.Fatalf("totals revenue/orders = %v/%d", tot.Revenue, tot.Orders)
+	}
+	if tot.PayingUsers != 4 || tot.NewPayers != 3 || tot.ReturningPayers != 1 {
+		t.Fatalf("payer split: %+v", tot)
+	}
+	if tot.RefundCount != 1 || tot.RefundRate != round2(100.0/6) {
+		t.Fatalf("refunds: count=%d rate=%v", tot.RefundCount, tot.RefundRate)
+	}
+	if len(tot.ByMethod) != 2 || tot.ByMethod[0].Method != "stripe" || tot.ByMethod[0].Revenue != 35 {
+		t.Fatalf("by method: %+v", tot.ByMethod)
+	}
+	if tot.ARPU != round2(55.0/4) {
+		t.Fatalf("arpu = %v", tot.ARPU)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -166,7 +167,7 @@ func TestListTopUpRecords_PaymentProviderColumnOptional(t *testing.T) {
 	db.MustExec(`INSERT INTO top_ups (id, user_id, amount, money, trade_no, payment_method, create_time, complete_time, status)
 		VALUES (1, 1, 100, 10, 'trade-1', 'alipay', 1710000000, 1710000010, 'success')`)
 
-	got, err := ListTopUpRecords(ListTopUpParams{Page: 1, PageSize: 20})
+	got, err := ListTopUpRecords(context.Background(), ListTopUpParams{Page: 1, PageSize: 20})
 	if err != nil {
 		t.Fatalf("ListTopUpRecords returned error without payment_provider column: %v", err)
 	}
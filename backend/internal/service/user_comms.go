@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// CommChannels are the ways an operator can reach a user
+var CommChannels = []string{"email", "telegram", "qq", "wechat", "discord", "linuxdo", "site_notice", "other"}
+
+// CommOutcomes track where an outreach stands; pending entries with a
+// follow_up_at are listed as due follow-ups
+var CommOutcomes = []string{"pending", "acknowledged", "resolved", "no_response", "escalated"}
+
+// commRecentWindow is how long another operator's contact blocks a new one
+// unless forced, so two admins don't message the same user about the same thing
+const commRecentWindow = 24 * 3600
+
+var (
+	ErrCommNotFound          = errors.New("communication not found")
+	ErrInvalidComm           = errors.New("invalid communication")
+	ErrUserRecentlyContacted = errors.New("user recently contacted by another operator")
+)
+
+// UserCommunicationInput supports create / partial update of a communication
+type UserCommunicationInput struct {
+	Channel     *string `json:"channel"`
+	Subject     *string `json:"subject"`
+	Summary     *string `json:"summary"`
+	Outcome     *string `json:"outcome"`
+	ContactedAt *int64  `json:"contacted_at"`
+	FollowUpAt  *int64  `json:"follow_up_at"`
+	Force       bool    `json:"force"` // 忽略 24 小时内其他管理员的联系记录
+}
+
+// CommQuery filters the communications list
+type CommQuery struct {
+	UserID      int64
+	Operator    string
+	Outcome     string
+	FollowUpDue bool // 仅 pending 且 follow_up_at 已到期
+	Limit       int
+	Offset      int
+}
+
+// RecentContactError carries the contact that blocked a new entry
+type RecentContactError struct {
+	Previous api.UserCommunication
+}
+
+func (e *RecentContactError) Error() string {
+	return fmt.Sprintf("%s: %s at %s", ErrUserRecentlyContacted, e.Previous.Operator,
+		time.Unix(e.Previous.ContactedAt, 0).Format("2006-01-02 15:04"))
+}
+
+func (e *RecentContactError) Unwrap() error { return ErrUserRecentlyContacted }
+
+// UserCommsService keeps the manual outreach log per user
+type UserCommsService struct {
+	db *database.Manager
+}
+
+// NewUserCommsService creates a UserCommsService on the primary instance
+func NewUserCommsService() *UserCommsService {
+	return &UserCommsService{db: database.Get()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *UserCommsService) WithContext(ctx context.Context) *UserCommsService {
+	c := *s
+	c.db = s.db.WithContext(ctx)
+	return &c
+}
+
+func ensureUserCommsTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS user_communications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			channel TEXT NOT NULL,
+			subject TEXT NOT NULL DEFAULT '',
+			summary TEXT NOT NULL DEFAULT '',
+			outcome TEXT NOT NULL DEFAULT 'pending',
+			contacted_at INTEGER NOT NULL DEFAULT 0,
+			follow_up_at INTEGER NOT NULL DEFAULT 0,
+			operator TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_communications_user ON user_communications(user_id, contacted_at)`)
+	return err
+}
+
+func openUserCommsStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureUserCommsTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func applyCommInput(m *api.UserCommunication, in UserCommunicationInput) {
+	if in.Channel != nil {
+		m.Channel = strings.ToLower(strings.TrimSpace(*in.Channel))
+	}
+	if in.Subject != nil {
+		m.Subject = strings.TrimSpace(*in.Subject)
+	}
+	if in.Summary != nil {
+		m.Summary = strings.TrimSpace(*in.Summary)
+	}
+	if in.Outcome != nil {
+		m.Outcome = strings.ToLower(strings.TrimSpace(*in.Outcome))
+	}
+	if in.ContactedAt != nil {
+		m.ContactedAt = *in.ContactedAt
+	}
+	if in.FollowUpAt != nil {
+		m.FollowUpAt = *in.FollowUpAt
+	}
+}
+
+func validateComm(m *api.UserCommunication) error {
+	if !containsStr(CommChannels, m.Channel) {
+		return fmt.Errorf("%w: channel 只能是 %s", ErrInvalidComm, strings.Join(CommChannels, "、"))
+	}
+	if !containsStr(CommOutcomes, m.Outcome) {
+		return fmt.Errorf("%w: outcome 只能是 %s", ErrInvalidComm, strings.Join(CommOutcomes, "、"))
+	}
+	if m.Subject == "" || len([]rune(m.Subject)) > 100 {
+		return fmt.Errorf("%w: subject 必填且不超过 100 字", ErrInvalidComm)
+	}
+	if len([]rune(m.Summary)) > 2000 {
+		return fmt.Errorf("%w: summary 不超过 2000 字", ErrInvalidComm)
+	}
+	if m.ContactedAt <= 0 || m.ContactedAt > time.Now().Unix()+300 {
+		return fmt.Errorf("%w: contacted_at 不能是未来时间", ErrInvalidComm)
+	}
+	if m.FollowUpAt < 0 || (m.FollowUpAt > 0 && m.FollowUpAt < m.ContactedAt) {
+		return fmt.Errorf("%w: follow_up_at 不能早于 contacted_at", ErrInvalidComm)
+	}
+	return nil
+}
+
+const commColumns = `id, user_id, username, channel, subject, summary, outcome, contacted_at, follow_up_at,
+	operator, created_at, updated_at`
+
+func scanComm(scan func(dest ...interface{}) error) (api.UserCommunication, error) {
+	var m api.UserCommunication
+	err := scan(&m.ID, &m.UserID, &m.Username, &m.Channel, &m.Subject, &m.Summary, &m.Outcome, &m.ContactedAt,
+		&m.FollowUpAt, &m.Operator, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+func getComm(ctx context.Context, db *sql.DB, id int64) (api.UserCommunication, error) {
+	m, err := scanComm(db.QueryRowContext(ctx, `SELECT `+commColumns+` FROM user_communications WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return m, ErrCommNotFound
+	}
+	return m, err
+}
+
+func listComms(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]api.UserCommunication, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+commColumns+` FROM user_communications `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []api.UserCommunication{}
+	for rows.Next() {
+		m, err := scanComm(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, m)
+	}
+	return items, rows.Err()
+}
+
+// List returns communications newest contact first
+func (s *UserCommsService) List(ctx context.Context, q CommQuery) ([]api.UserCommunication, int64, error) {
+	db, err := openUserCommsStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+	conds, args := []string{"1=1"}, []interface{}{}
+	if q.UserID > 0 {
+		conds, args = append(conds, "user_id = ?"), append(args, q.UserID)
+	}
+	if q.Operator != "" {
+		conds, args = append(conds, "operator = ?"), append(args, q.Operator)
+	}
+	if q.Outcome != "" {
+		conds, args = append(conds, "outcome = ?"), append(args, q.Outcome)
+	}
+	if q.FollowUpDue {
+		conds = append(conds, "outcome = 'pending' AND follow_up_at > 0 AND follow_up_at <= ?")
+		args = append(args, time.Now().Unix())
+	}
+	where := "WHERE " + strings.Join(conds, " AND ")
+	var total int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_communications `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	items, err := listComms(ctx, db, where+` ORDER BY contacted_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, q.Limit, q.Offset)...)
+	return items, total, err
+}
+
+// Summary returns the outreach digest for one user
+func (s *UserCommsService) Summary(ctx context.Context, userID int64) (api.CommSummary, error) {
+	summary := api.CommSummary{Recent: []api.UserCommunication{}}
+	db, err := openUserCommsStore(ctx)
+	if err != nil {
+		return summary, err
+	}
+	defer db.Close()
+	if err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN outcome = 'pending' AND follow_up_at > 0 THEN 1 ELSE 0 END), 0)
+		FROM user_communications WHERE user_id = ?`, userID).Scan(&summary.Total, &summary.PendingFollowUp); err != nil {
+		return summary, err
+	}
+	summary.Recent, err = listComms(ctx, db, `WHERE user_id = ? ORDER BY contacted_at DESC, id DESC LIMIT 5`, userID)
+	if err != nil {
+		return summary, err
+	}
+	if len(summary.Recent) > 0 {
+		last := summary.Recent[0]
+		summary.LastContactedAt, summary.LastOperator, summary.LastOutcome = last.ContactedAt, last.Operator, last.Outcome
+	}
+	return summary, nil
+}
+
+// Create logs a contact with userID by operator. A contact by another
+// operator within the last 24 hours is rejected with *RecentContactError
+// unless in.Force is set.
+func (s *UserCommsService) Create(ctx context.Context, operator string, userID int64, in UserCommunicationInput) (api.UserCommunication, error) {
+	now := time.Now().Unix()
+	m := api.UserCommunication{UserID: userID, Outcome: "pending", ContactedAt: now, Operator: operator}
+	applyCommInput(&m, in)
+	if userID <= 0 {
+		return m, fmt.Errorf("%w: user_id 无效", ErrInvalidComm)
+	}
+	if err := validateComm(&m); err != nil {
+		return m, err
+	}
+	user, err := s.db.QueryOneWithTimeout(10*time.Second, s.db.RebindQuery(`SELECT username FROM users WHERE id = ?`), userID)
+	if err != nil {
+		return m, err
+	}
+	if user == nil {
+		return m, fmt.Errorf("%w: 用户 %d 不存在", ErrInvalidComm, userID)
+	}
+	m.Username = toString(user["username"])
+
+	db, err := openUserCommsStore(ctx)
+	if err != nil {
+		return m, err
+	}
+	defer db.Close()
+	if !in.Force {
+		recent, err := listComms(ctx, db, `WHERE user_id = ? AND operator != ? AND contacted_at >= ?
+			ORDER BY contacted_at DESC LIMIT 1`, userID, operator, m.ContactedAt-commRecentWindow)
+		if err != nil {
+			return m, err
+		}
+		if len(recent) > 0 {
+			return m, &RecentContactError{Previous: recent[0]}
+		}
+	}
+	m.CreatedAt, m.UpdatedAt = now, now
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO user_communications (user_id, username, channel, subject, summary, outcome, contacted_at,
+			follow_up_at, operator, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.UserID, m.Username, m.Channel, m.Subject, m.Summary, m.Outcome, m.ContactedAt, m.FollowUpAt,
+		m.Operator, m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		return m, err
+	}
+	m.ID, _ = res.LastInsertId()
+	return m, nil
+}
+
+// Update edits a logged contact, typically to record its outcome
+func (s *UserCommsService) Update(ctx context.Context, id int64, in UserCommunicationInput) (api.UserCommunication, error) {
+	db, err := openUserCommsStore(ctx)
+	if err != nil {
+		return api.UserCommunication{}, err
+	}
+	defer db.Close()
+	m, err := getComm(ctx, db, id)
+	if err != nil {
+		return m, err
+	}
+	applyCommInput(&m, in)
+	if err := validateComm(&m); err != nil {
+		return m, err
+	}
+	m.UpdatedAt = time.Now().Unix()
+	_, err = db.ExecContext(ctx, `
+		UPDATE user_communications SET channel = ?, subject = ?, summary = ?, outcome = ?, contacted_at = ?,
+			follow_up_at = ?, updated_at = ?
+		WHERE id = ?`, m.Channel, m.Subject, m.Summary, m.Outcome, m.ContactedAt, m.FollowUpAt, m.UpdatedAt, id)
+	return m, err
+}
+
+// Delete removes a logged contact
+func (s *UserCommsService) Delete(ctx context.Context, id int64) (api.UserCommunication, error) {
+	db, err := openUserCommsStore(ctx)
+	if err != nil {
+		return api.UserCommunication{}, err
+	}
+	defer db.Close()
+	m, err := getComm(ctx, db, id)
+	if err != nil {
+		return m, err
+	}
+	_, err = db.ExecContext(ctx, `DELETE FROM user_communications WHERE id = ?`, id)
+	return m, err
+}
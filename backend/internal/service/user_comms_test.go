@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestUserCommsBlocksDoubleContact(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT);
+		INSERT INTO users VALUES (42, 'reseller')`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	ctx := context.Background()
+	svc := NewUserCommsService()
+	str := func(s string) *string { return &s }
+	followUp := time.Now().Unix() + 3600
+
+	first, err := svc.Create(ctx, "alice", 42, UserCommunicationInput{
+		Channel: str("Email"), Subject: str("滥用警告"), FollowUpAt: &followUp,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if first.Username != "reseller" || first.Channel != "email" || first.Outcome != "pending" {
+		t.Fatalf("unexpected entry %+v", first)
+	}
+
+	// another operator within 24h is stopped and told who got there first
+	_, err = svc.Create(ctx, "bob", 42, UserCommunicationInput{Channel: str("telegram"), Subject: str("滥用警告")})
+	var recent *RecentContactError
+	if !errors.As(err, &recent) || recent.Previous.ID != first.ID || !errors.Is(err, ErrUserRecentlyContacted) {
+		t.Fatalf("expected RecentContactError for bob, got %v", err)
+	}
+	// the same operator logging a follow-up is fine
+	if _, err := svc.Create(ctx, "alice", 42, UserCommunicationInput{Channel: str("email"), Subject: str("回复")}); err != nil {
+		t.Fatalf("same operator create: %v", err)
+	}
+	if _, err := svc.Create(ctx, "bob", 42, UserCommunicationInput{
+		Channel: str("telegram"), Subject: str("二次提醒"), Force: true,
+	}); err != nil {
+		t.Fatalf("forced create: %v", err)
+	}
+
+	for _, bad := range []UserCommunicationInput{
+		{Channel: str("pigeon"), Subject: str("x")},
+		{Channel: str("email"), Subject: str("")},
+		{Channel: str("email"), Subject: str("x"), Outcome: str("maybe")},
+	} {
+		if _, err := svc.Create(ctx, "alice", 42, bad); !errors.Is(err, ErrInvalidComm) {
+			t.Errorf("expected ErrInvalidComm for %+v, got %v", bad, err)
+		}
+	}
+	if _, err := svc.Create(ctx, "alice", 7, UserCommunicationInput{Channel: str("email"), Subject: str("x")}); !errors.Is(err, ErrInvalidComm) {
+		t.Errorf("unknown user should be rejected, got %v", err)
+	}
+
+	updated, err := svc.Update(ctx, first.ID, UserCommunicationInput{Outcome: str("resolved")})
+	if err != nil || updated.Outcome != "resolved" || updated.Subject != "滥用警告" {
+		t.Fatalf("Update: %+v, %v", updated, err)
+	}
+	summary, err := svc.Summary(ctx, 42)
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if summary.Total != 3 || summary.PendingFollowUp != 0 || len(summary.Recent) != 3 || summary.LastContactedAt == 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if _, err := svc.Delete(ctx, 999); !errors.Is(err, ErrCommNotFound) {
+		t.Fatalf("Delete of unknown id should be ErrCommNotFound, got %v", err)
+	}
+}
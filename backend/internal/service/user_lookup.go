@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxUserLookup bounds the IDs + usernames resolved by one lookup
+const maxUserLookup = 500
+
+var ErrInvalidUserLookup = errors.New("invalid user lookup")
+
+// UserProfile is the compact user view returned by bulk lookups
+type UserProfile struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	DisplayName  string `json:"display_name"`
+	Group        string `json:"group"`
+	Role         int64  `json:"role"`
+	Status       int64  `json:"status"` // 1 = 正常，2 = 封禁
+	Quota        int64  `json:"quota"`
+	UsedQuota    int64  `json:"used_quota"`
+	RequestCount int64  `json:"request_count"`
+	Deleted      bool   `json:"deleted"`
+}
+
+// UserLookupResult holds the profiles found and the inputs that matched nothing
+type UserLookupResult struct {
+	Items              []UserProfile `json:"items"`
+	MissingIDs         []int64       `json:"missing_ids"`
+	MissingUsernames   []string      `json:"missing_usernames"`
+	RequestedIDs       int           `json:"requested_ids"`
+	RequestedUsernames int           `json:"requested_usernames"`
+}
+
+// LookupUsers resolves up to maxUserLookup user IDs and usernames in a
+// single query. Soft-deleted users are returned with deleted=true so risk
+// views can still label them. Items are ordered by id.
+func (s *UserManagementService) LookupUsers(ids []int64, usernames []string) (*UserLookupResult, error) {
+	seenID := map[int64]bool{}
+	uniqueIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id > 0 && !seenID[id] {
+			seenID[id] = true
+			uniqueIDs = append(uniqueIDs, id)
+		}
+	}
+	seenName := map[string]bool{}
+	uniqueNames := make([]string, 0, len(usernames))
+	for _, name := range usernames {
+		name = strings.TrimSpace(name)
+		if name != "" && !seenName[name] {
+			seenName[name] = true
+			uniqueNames = append(uniqueNames, name)
+		}
+	}
+	if len(uniqueIDs)+len(uniqueNames) == 0 || len(uniqueIDs)+len(uniqueNames) > maxUserLookup {
+		return nil, fmt.Errorf("%w: ids 与 usernames 合计需为 1 ~ %d 个", ErrInvalidUserLookup, maxUserLookup)
+	}
+
+	groupCol := "`group`"
+	if s.db.IsPG {
+		groupCol = `"group"`
+	}
+	var conds []string
+	args := make([]interface{}, 0, len(uniqueIDs)+len(uniqueNames))
+	if len(uniqueIDs) > 0 {
+		conds = append(conds, fmt.Sprintf("id IN (%s)", buildPlaceholders(s.db.IsPG, len(uniqueIDs), 1)))
+		for _, id := range uniqueIDs {
+			args = append(args, id)
+		}
+	}
+	if len(uniqueNames) > 0 {
+		conds = append(conds, fmt.Sprintf("username IN (%s)", buildPlaceholders(s.db.IsPG, len(uniqueNames), len(args)+1)))
+		for _, name := range uniqueNames {
+			args = append(args, name)
+		}
+	}
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, username, COALESCE(display_name, '') AS display_name, COALESCE(%s, '') AS user_group,
+			role, status, quota, used_quota, request_count, deleted_at
+		FROM users
+		WHERE %s
+		ORDER BY id`, groupCol, strings.Join(conds, " OR ")), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UserLookupResult{
+		Items:              make([]UserProfile, 0, len(rows)),
+		MissingIDs:         []int64{},
+		MissingUsernames:   []string{},
+		RequestedIDs:       len(uniqueIDs),
+		RequestedUsernames: len(uniqueNames),
+	}
+	foundID, foundName := map[int64]bool{}, map[string]bool{}
+	for _, row := range rows {
+		p := UserProfile{
+			ID:           toInt64(row["id"]),
+			Username:     toString(row["username"]),
+			DisplayName:  toString(row["display_name"]),
+			Group:        toString(row["user_group"]),
+			Role:         toInt64(row["role"]),
+			Status:       toInt64(row["status"]),
+			Quota:        toInt64(row["quota"]),
+			UsedQuota:    toInt64(row["used_quota"]),
+			RequestCount: toInt64(row["request_count"]),
+			Deleted:      row["deleted_at"] != nil,
+		}
+		foundID[p.ID] = true
+		foundName[p.Username] = true
+		result.Items = append(result.Items, p)
+	}
+	for _, id := range uniqueIDs {
+		if !foundID[id] {
+			result.MissingIDs = append(result.MissingIDs, id)
+		}
+	}
+	for _, name := range uniqueNames {
+		if !foundName[name] {
+			result.MissingUsernames = append(result.MissingUsernames, name)
+		}
+	}
+	return result, nil
+}
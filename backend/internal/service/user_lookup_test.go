@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupUsersByIDsAndUsernames(t *testing.T) {
+	db := installSQLiteForTests(t)
+	if _, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, display_name TEXT, "group" TEXT, role INTEGER,
+			status INTEGER, quota INTEGER, used_quota INTEGER, request_count INTEGER, deleted_at INTEGER);
+		INSERT INTO users VALUES
+			(1, 'alice', 'Alice', 'vip', 1, 1, 100, 50, 7, NULL),
+			(2, 'bob', NULL, NULL, 1, 2, 0, 0, 0, NULL),
+			(3, 'carol', '', 'default', 1, 1, 0, 0, 0, 1700000000);`); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	svc := NewUserManagementService()
+	result, err := svc.LookupUsers([]int64{1, 3, 1, 99}, []string{" bob ", "alice", "ghost"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(result.Items) != 3 || result.RequestedIDs != 3 || result.RequestedUsernames != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	alice, bob, carol := result.Items[0], result.Items[1], result.Items[2]
+	if alice.Username != "alice" || alice.Group != "vip" || alice.UsedQuota != 50 || alice.Deleted {
+		t.Errorf("alice: %+v", alice)
+	}
+	if bob.Status != 2 || bob.Group != "" || bob.DisplayName != "" {
+		t.Errorf("bob: %+v", bob)
+	}
+	if !carol.Deleted {
+		t.Errorf("carol should be marked deleted: %+v", carol)
+	}
+	if len(result.MissingIDs) != 1 || result.MissingIDs[0] != 99 {
+		t.Errorf("missing ids: %v", result.MissingIDs)
+	}
+	if len(result.MissingUsernames) != 1 || result.MissingUsernames[0] != "ghost" {
+		t.Errorf("missing usernames: %v", result.MissingUsernames)
+	}
+
+	if _, err := svc.LookupUsers(nil, []string{" "}); !errors.Is(err, ErrInvalidUserLookup) {
+		t.Fatalf("empty lookup should be rejected, got %v", err)
+	}
+	ids := make([]int64, maxUserLookup+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	if _, err := svc.LookupUsers(ids, nil); !errors.Is(err, ErrInvalidUserLookup) {
+		t.Fatalf("oversized lookup should be rejected, got %v", err)
+	}
+}
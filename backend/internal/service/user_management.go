@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/new-api-tools/backend/internal/database"
 	"github.com/new-api-tools/backend/internal/logger"
+	"github.com/new-api-tools/backend/pkg/api"
 )
 
 // Activity level constants
@@ -41,13 +43,20 @@ func NewUserManagementService() *UserManagementService {
 	return &UserManagementService{db: database.Get(), logDB: database.GetLog()}
 }
 
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *UserManagementService) WithContext(ctx context.Context) *UserManagementService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
 // activeUserIDsSince returns the set of user_ids that have at least one billable
 // log entry (type 2/5) since `since`. It queries the log DB directly, so it stays
 // correct when logs live in a separate database (LOG_SQL_DSN) — a cross-DB
 // EXISTS(...) subquery against the users table is impossible there.
 func (s *UserManagementService) activeUserIDsSince(since int64) (map[int64]bool, error) {
 	rows, err := s.logDB.QueryWithTimeout(60*time.Second, s.logDB.RebindQuery(
-		"SELECT DISTINCT user_id FROM logs WHERE type IN (2,5) AND created_at >= ? AND user_id > 0"), since)
+		"SELECT DISTINCT user_id FROM logs WHERE type IN ("+ltRequests()+") AND created_at >= ? AND user_id > 0"), since)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +82,7 @@ func (s *UserManagementService) getAvailableOAuthColumns() []string {
 }
 
 // GetActivityStats returns user activity statistics
-func (s *UserManagementService) GetActivityStats(quick bool) (map[string]interface{}, error) {
+func (s *UserManagementService) GetActivityStats(quick bool) (*api.ActivityStats, error) {
 	now := time.Now().Unix()
 	activeThreshold := now - ActiveThreshold
 	inactiveThreshold := now - InactiveThreshold
@@ -83,7 +92,7 @@ func (s *UserManagementService) GetActivityStats(quick bool) (map[string]interfa
 	if err != nil {
 		return nil, err
 	}
-	totalUsers := totalRow["count"]
+	totalUsers := toInt64(totalRow["count"])
 
 	if quick {
 		// Quick mode: only total + never requested
@@ -93,14 +102,7 @@ func (s *UserManagementService) GetActivityStats(quick bool) (map[string]interfa
 		if neverRow != nil {
 			neverCount = toInt64(neverRow["count"])
 		}
-		return map[string]interface{}{
-			"total_users":         totalUsers,
-			"active_users":        0,
-			"inactive_users":      0,
-			"very_inactive_users": 0,
-			"never_requested":     neverCount,
-			"quick_mode":          true,
-		}, nil
+		return &api.ActivityStats{TotalUsers: totalUsers, NeverRequested: neverCount, QuickMode: true}, nil
 	}
 
 	// Full stats: classify users by their most recent billable log.
@@ -142,32 +144,17 @@ func (s *UserManagementService) GetActivityStats(quick bool) (map[string]interfa
 		neverCount = toInt64(neverRow["count"])
 	}
 
-	total := toInt64(totalUsers)
-	veryInactive := total - activeCount - inactiveCount - neverCount
-
-	return map[string]interface{}{
-		"total_users":         total,
-		"active_users":        activeCount,
-		"inactive_users":      inactiveCount,
-		"very_inactive_users": veryInactive,
-		"never_requested":     neverCount,
+	return &api.ActivityStats{
+		TotalUsers:        totalUsers,
+		ActiveUsers:       activeCount,
+		InactiveUsers:     inactiveCount,
+		VeryInactiveUsers: totalUsers - activeCount - inactiveCount - neverCount,
+		NeverRequested:    neverCount,
 	}, nil
 }
 
-// ListUsersParams defines parameters for listing users
-type ListUsersParams struct {
-	Page           int    `json:"page"`
-	PageSize       int    `json:"page_size"`
-	ActivityFilter string `json:"activity_filter"`
-	GroupFilter    string `json:"group_filter"`
-	SourceFilter   string `json:"source_filter"`
-	Search         string `json:"search"`
-	OrderBy        string `json:"order_by"`
-	OrderDir       string `json:"order_dir"`
-}
-
 // GetUsers returns paginated user list
-func (s *UserManagementService) GetUsers(params ListUsersParams) (map[string]interface{}, error) {
+func (s *UserManagementService) GetUsers(params api.ListUsersParams) (*api.UserList, error) {
 	if params.Page < 1 {
 		params.Page = 1
 	}
@@ -334,26 +321,33 @@ func (s *UserManagementService) GetUsers(params ListUsersParams) (map[string]int
 		logger.L.Error(fmt.Sprintf("GetUsers 查询失败: %v, SQL: %s, args: %v", err, selectQuery, args))
 		return nil, err
 	}
-	if rows == nil {
-		rows = []map[string]interface{}{}
-	}
 
 	// Enrich rows with computed fields (activity_level, source, linux_do_id)
+	items := make([]api.UserListItem, 0, len(rows))
 	for _, row := range rows {
-		reqCount := toInt64(row["request_count"])
-		if reqCount == 0 {
-			row["activity_level"] = ActivityNever
-		} else {
-			row["activity_level"] = ActivityActive
+		item := api.UserListItem{
+			ID:            toInt64(row["id"]),
+			Username:      toString(row["username"]),
+			DisplayName:   toString(row["display_name"]),
+			Email:         toString(row["email"]),
+			Role:          toInt64(row["role"]),
+			Status:        toInt64(row["status"]),
+			Quota:         toInt64(row["quota"]),
+			UsedQuota:     toInt64(row["used_quota"]),
+			RequestCount:  toInt64(row["request_count"]),
+			Group:         toString(row["group"]),
+			AffCode:       toString(row["aff_code"]),
+			Remark:        toString(row["remark"]),
+			ActivityLevel: ActivityActive,
+		}
+		if item.RequestCount == 0 {
+			item.ActivityLevel = ActivityNever
 		}
-		row["last_request_time"] = nil
 
 		// Preserve linux_do_id for frontend display
-		linuxDoID := ""
 		if oauthColSet["linux_do_id"] {
-			linuxDoID = toString(row["linux_do_id"])
+			item.LinuxDoID = toString(row["linux_do_id"])
 		}
-		row["linux_do_id"] = linuxDoID
 
 		// Compute source from OAuth ID fields (only check existing columns)
 		source := "password"
@@ -370,29 +364,21 @@ func (s *UserManagementService) GetUsers(params ListUsersParams) (map[string]int
 		} else if oauthColSet["oidc_id"] && toString(row["oidc_id"]) != "" {
 			source = "oidc"
 		}
-		row["source"] = source
-
-		// Clean up internal OAuth fields (except linux_do_id which is kept)
-		for _, col := range oauthCols {
-			if col != "linux_do_id" {
-				delete(row, col)
-			}
-		}
+		item.Source = source
+		items = append(items, item)
 	}
 
-	totalPages := int((total + int64(params.PageSize) - 1) / int64(params.PageSize))
-
-	return map[string]interface{}{
-		"items":       rows,
-		"total":       total,
-		"page":        params.Page,
-		"page_size":   params.PageSize,
-		"total_pages": totalPages,
+	return &api.UserList{
+		Items:      items,
+		Total:      total,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+		TotalPages: int((total + int64(params.PageSize) - 1) / int64(params.PageSize)),
 	}, nil
 }
 
 // GetBannedUsers returns banned users list
-func (s *UserManagementService) GetBannedUsers(page, pageSize int, search string) (map[string]interface{}, error) {
+func (s *UserManagementService) GetBannedUsers(page, pageSize int, search string) (*api.BannedUserList, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -435,15 +421,27 @@ func (s *UserManagementService) GetBannedUsers(page, pageSize int, search string
 	if err != nil {
 		return nil, err
 	}
-
-	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
-
-	return map[string]interface{}{
-		"items":       rows,
-		"total":       total,
-		"page":        page,
-		"page_size":   pageSize,
-		"total_pages": totalPages,
+	items := make([]api.BannedUser, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, api.BannedUser{
+			ID:           toInt64(row["id"]),
+			Username:     toString(row["username"]),
+			DisplayName:  toString(row["display_name"]),
+			Email:        toString(row["email"]),
+			Status:       toInt64(row["status"]),
+			Role:         toInt64(row["role"]),
+			Quota:        toInt64(row["quota"]),
+			UsedQuota:    toInt64(row["used_quota"]),
+			RequestCount: toInt64(row["request_count"]),
+		})
+	}
+
+	return &api.BannedUserList{
+		Items:      items,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
 	}, nil
 }
 
@@ -557,7 +555,7 @@ func (s *UserManagementService) PreviewSoftDeletedUsers() (map[string]interface{
 }
 
 // BatchDeleteInactiveUsers deletes inactive users
-func (s *UserManagementService) BatchDeleteInactiveUsers(activityLevel string, dryRun, hardDelete bool) (map[string]interface{}, error) {
+func (s *UserManagementService) BatchDeleteInactiveUsers(activityLevel string, dryRun, hardDelete bool) (*api.BatchDeleteResult, error) {
 	now := time.Now()
 	nowUnix := now.Unix()
 
@@ -622,23 +620,24 @@ func (s *UserManagementService) BatchDeleteInactiveUsers(activityLevel string, d
 			}
 			preview = append(preview, u.username)
 		}
-		return map[string]interface{}{
-			"dry_run":        true,
-			"count":          affected,
-			"affected_count": affected,
-			"activity_level": activityLevel,
-			"users":          preview,
+		return &api.BatchDeleteResult{
+			DryRun:        true,
+			Count:         affected,
+			AffectedCount: affected,
+			ActivityLevel: activityLevel,
+			HardDelete:    hardDelete,
+			Users:         preview,
 		}, nil
 	}
 
+	result := &api.BatchDeleteResult{
+		Count:         affected,
+		AffectedCount: affected,
+		ActivityLevel: activityLevel,
+		HardDelete:    hardDelete,
+	}
 	if affected == 0 {
-		return map[string]interface{}{
-			"dry_run":        false,
-			"count":          int64(0),
-			"affected_count": int64(0),
-			"activity_level": activityLevel,
-			"hard_delete":    hardDelete,
-		}, nil
+		return result, nil
 	}
 
 	ids := make([]int64, len(toDelete))
@@ -681,14 +680,7 @@ func (s *UserManagementService) BatchDeleteInactiveUsers(activityLevel string, d
 	}
 
 	logger.L.Business(fmt.Sprintf("批量删除 %s 用户: %d 个", activityLevel, affected))
-
-	return map[string]interface{}{
-		"dry_run":        false,
-		"count":          affected,
-		"affected_count": affected,
-		"activity_level": activityLevel,
-		"hard_delete":    hardDelete,
-	}, nil
+	return result, nil
 }
 
 func (s *UserManagementService) previewUsers(query string) ([]string, error) {
@@ -760,31 +752,25 @@ func toString(v interface{}) string {
 }
 
 // GetInvitedUsers returns users invited by the specified user
-func (s *UserManagementService) GetInvitedUsers(userID int64, page, pageSize int) (map[string]interface{}, error) {
+func (s *UserManagementService) GetInvitedUsers(userID int64, page, pageSize int) (*api.InvitedUsers, error) {
 	offset := (page - 1) * pageSize
+	result := &api.InvitedUsers{Items: []api.InvitedUser{}, Page: page, PageSize: pageSize}
 
 	// Get inviter info
 	inviterRow, err := s.db.QueryOne(s.db.RebindQuery(
 		"SELECT id, username, display_name, aff_code, aff_count, aff_quota, aff_history FROM users WHERE id = ? AND deleted_at IS NULL"), userID)
 	if err != nil || inviterRow == nil {
-		return map[string]interface{}{
-			"inviter":   nil,
-			"items":     []interface{}{},
-			"total":     0,
-			"page":      page,
-			"page_size": pageSize,
-			"stats":     map[string]interface{}{},
-		}, nil
+		return result, nil
 	}
 
-	inviter := map[string]interface{}{
-		"user_id":      inviterRow["id"],
-		"username":     inviterRow["username"],
-		"display_name": inviterRow["display_name"],
-		"aff_code":     inviterRow["aff_code"],
-		"aff_count":    inviterRow["aff_count"],
-		"aff_quota":    inviterRow["aff_quota"],
-		"aff_history":  inviterRow["aff_history"],
+	result.Inviter = &api.Inviter{
+		UserID:      toInt64(inviterRow["id"]),
+		Username:    toString(inviterRow["username"]),
+		DisplayName: toString(inviterRow["display_name"]),
+		AffCode:     toString(inviterRow["aff_code"]),
+		AffCount:    toInt64(inviterRow["aff_count"]),
+		AffQuota:    toInt64(inviterRow["aff_quota"]),
+		AffHistory:  toInt64(inviterRow["aff_history"]),
 	}
 
 	// Count total invited
@@ -815,33 +801,30 @@ func (s *UserManagementService) GetInvitedUsers(userID int64, page, pageSize int
 	}
 
 	// Compute stats
-	activeCount := 0
-	bannedCount := 0
-	totalUsedQuota := int64(0)
-	totalRequests := int64(0)
+	result.Total = total
+	result.Stats.TotalInvited = total
 	for _, row := range rows {
-		if toInt64(row["request_count"]) > 0 {
-			activeCount++
+		user := api.InvitedUser{
+			ID:           toInt64(row["id"]),
+			Username:     toString(row["username"]),
+			DisplayName:  toString(row["display_name"]),
+			Email:        toString(row["email"]),
+			Status:       toInt64(row["status"]),
+			Quota:        toInt64(row["quota"]),
+			UsedQuota:    toInt64(row["used_quota"]),
+			RequestCount: toInt64(row["request_count"]),
+			Group:        toString(row["group"]),
+			Role:         toInt64(row["role"]),
+		}
+		if user.RequestCount > 0 {
+			result.Stats.ActiveCount++
 		}
-		if toInt64(row["status"]) == 2 {
-			bannedCount++
+		if user.Status == 2 {
+			result.Stats.BannedCount++
 		}
-		totalUsedQuota += toInt64(row["used_quota"])
-		totalRequests += toInt64(row["request_count"])
+		result.Stats.TotalUsedQuota += user.UsedQuota
+		result.Stats.TotalRequests += user.RequestCount
+		result.Items = append(result.Items, user)
 	}
-
-	return map[string]interface{}{
-		"inviter":   inviter,
-		"items":     rows,
-		"total":     total,
-		"page":      page,
-		"page_size": pageSize,
-		"stats": map[string]interface{}{
-			"total_invited":    total,
-			"active_count":     activeCount,
-			"banned_count":     bannedCount,
-			"total_used_quota": totalUsedQuota,
-			"total_requests":   totalRequests,
-		},
-	}, nil
+	return result, nil
 }
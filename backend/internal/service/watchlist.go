@@ -0,0 +1,585 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/database"
+	"github.com/new-api-tools/backend/internal/logger"
+)
+
+// Watchlist alert kinds
+const (
+	WatchAlertRequests = "requests" // 窗口内请求数超过阈值
+	WatchAlertQuota    = "quota"    // 窗口内额度消耗超过阈值
+	WatchAlertCountry  = "country"  // 最近请求来源国家变化
+	WatchAlertBanned   = "banned"   // 用户被封禁
+)
+
+// watchAlertsKept bounds the alert feed per admin
+const watchAlertsKept = 500
+
+var (
+	ErrWatchNotFound = errors.New("watch not found")
+	ErrWatchExists   = errors.New("user already watched")
+	ErrInvalidWatch  = errors.New("invalid watch")
+)
+
+// WatchEntry is one admin's rule set for one watched user. The Last* fields
+// are evaluation state so each condition only fires on a change.
+type WatchEntry struct {
+	ID                  int64  `json:"id"`
+	Owner               string `json:"owner"`
+	UserID              int64  `json:"user_id"`
+	Username            string `json:"username"`
+	Note                string `json:"note"`
+	Enabled             bool   `json:"enabled"`
+	WindowMinutes       int    `json:"window_minutes"`
+	RequestThreshold    int64  `json:"request_threshold"` // 0 = 不检查
+	QuotaThreshold      int64  `json:"quota_threshold"`   // 0 = 不检查
+	NotifyCountryChange bool   `json:"notify_country_change"`
+	NotifyBan           bool   `json:"notify_ban"`
+	LastCountry         string `json:"last_country"`
+	LastStatus          int    `json:"last_status"`
+	LastRequestAlertAt  int64  `json:"last_request_alert_at"`
+	LastQuotaAlertAt    int64  `json:"last_quota_alert_at"`
+	LastEvaluatedAt     int64  `json:"last_evaluated_at"`
+	CreatedAt           int64  `json:"created_at"`
+	UpdatedAt           int64  `json:"updated_at"`
+}
+
+// WatchEntryInput supports create / partial update of a watch
+type WatchEntryInput struct {
+	UserID              *int64  `json:"user_id"`
+	Note                *string `json:"note"`
+	Enabled             *bool   `json:"enabled"`
+	WindowMinutes       *int    `json:"window_minutes"`
+	RequestThreshold    *int64  `json:"request_threshold"`
+	QuotaThreshold      *int64  `json:"quota_threshold"`
+	NotifyCountryChange *bool   `json:"notify_country_change"`
+	NotifyBan           *bool   `json:"notify_ban"`
+}
+
+// WatchAlert is one notification delivered to the watch owner
+type WatchAlert struct {
+	ID        int64                  `json:"id"`
+	WatchID   int64                  `json:"watch_id"`
+	Owner     string                 `json:"owner"`
+	UserID    int64                  `json:"user_id"`
+	Username  string                 `json:"username"`
+	Kind      string                 `json:"kind"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data"`
+	Read      bool                   `json:"read"`
+	CreatedAt int64                  `json:"created_at"`
+}
+
+// WatchlistEvalResult summarises one evaluation pass
+type WatchlistEvalResult struct {
+	Evaluated int `json:"evaluated"`
+	Alerts    int `json:"alerts"`
+}
+
+// WatchlistService lets admins watch specific users and be notified
+// personally when they cross usage thresholds, move country or get banned
+type WatchlistService struct {
+	db    *database.Manager
+	logDB *database.Manager
+}
+
+// NewWatchlistService creates a WatchlistService on the primary instance
+func NewWatchlistService() *WatchlistService {
+	return &WatchlistService{db: database.Get(), logDB: database.GetLog()}
+}
+
+// WithContext returns a copy of the service whose queries are canceled with ctx
+func (s *WatchlistService) WithContext(ctx context.Context) *WatchlistService {
+	c := *s
+	c.db, c.logDB = s.db.WithContext(ctx), s.logDB.WithContext(ctx)
+	return &c
+}
+
+func ensureWatchlistTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS watchlist (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			owner TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			note TEXT NOT NULL DEFAULT '',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			window_minutes INTEGER NOT NULL DEFAULT 60,
+			request_threshold INTEGER NOT NULL DEFAULT 0,
+			quota_threshold INTEGER NOT NULL DEFAULT 0,
+			notify_country_change INTEGER NOT NULL DEFAULT 1,
+			notify_ban INTEGER NOT NULL DEFAULT 1,
+			last_country TEXT NOT NULL DEFAULT '',
+			last_status INTEGER NOT NULL DEFAULT 0,
+			last_request_alert_at INTEGER NOT NULL DEFAULT 0,
+			last_quota_alert_at INTEGER NOT NULL DEFAULT 0,
+			last_evaluated_at INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0,
+			UNIQUE (owner, user_id)
+		);
+		CREATE TABLE IF NOT EXISTS watchlist_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			watch_id INTEGER NOT NULL,
+			owner TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			kind TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			data TEXT NOT NULL DEFAULT '{}',
+			read INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_watchlist_alerts_owner ON watchlist_alerts(owner, id)`)
+	return err
+}
+
+func openWatchlistStore(ctx context.Context) (*sql.DB, error) {
+	db, err := openLocalStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureWatchlistTables(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func validateWatchEntry(w *WatchEntry) error {
+	if w.UserID <= 0 {
+		return fmt.Errorf("%w: user_id is required", ErrInvalidWatch)
+	}
+	w.Note = strings.TrimSpace(w.Note)
+	if len([]rune(w.Note)) > 200 {
+		return fmt.Errorf("%w: note must be at most 200 characters", ErrInvalidWatch)
+	}
+	if w.WindowMinutes < 5 || w.WindowMinutes > 7*24*60 {
+		return fmt.Errorf("%w: window_minutes must be 5-10080", ErrInvalidWatch)
+	}
+	if w.RequestThreshold < 0 || w.QuotaThreshold < 0 {
+		return fmt.Errorf("%w: thresholds must not be negative", ErrInvalidWatch)
+	}
+	if w.RequestThreshold == 0 && w.QuotaThreshold == 0 && !w.NotifyCountryChange && !w.NotifyBan {
+		return fmt.Errorf("%w: enable at least one condition", ErrInvalidWatch)
+	}
+	return nil
+}
+
+func applyWatchInput(w *WatchEntry, in WatchEntryInput) {
+	if in.Note != nil {
+		w.Note = *in.Note
+	}
+	if in.Enabled != nil {
+		w.Enabled = *in.Enabled
+	}
+	if in.WindowMinutes != nil {
+		w.WindowMinutes = *in.WindowMinutes
+	}
+	if in.RequestThreshold != nil {
+		w.RequestThreshold = *in.RequestThreshold
+	}
+	if in.QuotaThreshold != nil {
+		w.QuotaThreshold = *in.QuotaThreshold
+	}
+	if in.NotifyCountryChange != nil {
+		w.NotifyCountryChange = *in.NotifyCountryChange
+	}
+	if in.NotifyBan != nil {
+		w.NotifyBan = *in.NotifyBan
+	}
+}
+
+const watchColumns = `id, owner, user_id, username, note, enabled, window_minutes, request_threshold, quota_threshold,
+	notify_country_change, notify_ban, last_country, last_status, last_request_alert_at, last_quota_alert_at,
+	last_evaluated_at, created_at, updated_at`
+
+func scanWatchEntry(scan func(dest ...interface{}) error) (WatchEntry, error) {
+	var w WatchEntry
+	var enabled, country, ban int
+	err := scan(&w.ID, &w.Owner, &w.UserID, &w.Username, &w.Note, &enabled, &w.WindowMinutes, &w.RequestThreshold,
+		&w.QuotaThreshold, &country, &ban, &w.LastCountry, &w.LastStatus, &w.LastRequestAlertAt, &w.LastQuotaAlertAt,
+		&w.LastEvaluatedAt, &w.CreatedAt, &w.UpdatedAt)
+	w.Enabled = enabled == 1
+	w.NotifyCountryChange = country == 1
+	w.NotifyBan = ban == 1
+	return w, err
+}
+
+func getWatchEntry(ctx context.Context, db *sql.DB, owner string, id int64) (WatchEntry, error) {
+	w, err := scanWatchEntry(db.QueryRowContext(ctx, `SELECT `+watchColumns+` FROM watchlist WHERE id = ? AND owner = ?`, id, owner).Scan)
+	if err == sql.ErrNoRows {
+		return w, ErrWatchNotFound
+	}
+	return w, err
+}
+
+// List returns the owner's watched users
+func (s *WatchlistService) List(ctx context.Context, owner string) ([]WatchEntry, error) {
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return listWatchEntries(ctx, db, `WHERE owner = ? ORDER BY id DESC`, owner)
+}
+
+func listWatchEntries(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]WatchEntry, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+watchColumns+` FROM watchlist `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []WatchEntry{}
+	for rows.Next() {
+		w, err := scanWatchEntry(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, w)
+	}
+	return entries, rows.Err()
+}
+
+// Create starts watching a user for owner
+func (s *WatchlistService) Create(ctx context.Context, owner string, in WatchEntryInput) (WatchEntry, error) {
+	w := WatchEntry{Owner: owner, Enabled: true, WindowMinutes: 60, NotifyCountryChange: true, NotifyBan: true}
+	if in.UserID != nil {
+		w.UserID = *in.UserID
+	}
+	applyWatchInput(&w, in)
+	if err := validateWatchEntry(&w); err != nil {
+		return w, err
+	}
+
+	user, err := s.db.QueryOneWithTimeout(10*time.Second, s.db.RebindQuery(
+		`SELECT username, status FROM users WHERE id = ? AND deleted_at IS NULL`), w.UserID)
+	if err != nil {
+		return w, err
+	}
+	if user == nil {
+		return w, fmt.Errorf("%w: user %d does not exist", ErrInvalidWatch, w.UserID)
+	}
+	w.Username = toString(user["username"])
+	// 以当前状态为基线，已封禁的用户不会立即触发通知
+	w.LastStatus = int(toInt64(user["status"]))
+
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return w, err
+	}
+	defer db.Close()
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM watchlist WHERE owner = ? AND user_id = ?`, owner, w.UserID).Scan(&exists); err != nil {
+		return w, err
+	}
+	if exists > 0 {
+		return w, fmt.Errorf("%w: %d", ErrWatchExists, w.UserID)
+	}
+	w.CreatedAt = time.Now().Unix()
+	w.UpdatedAt = w.CreatedAt
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO watchlist (owner, user_id, username, note, enabled, window_minutes, request_threshold, quota_threshold,
+			notify_country_change, notify_ban, last_status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		owner, w.UserID, w.Username, w.Note, boolToInt(w.Enabled), w.WindowMinutes, w.RequestThreshold, w.QuotaThreshold,
+		boolToInt(w.NotifyCountryChange), boolToInt(w.NotifyBan), w.LastStatus, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return w, err
+	}
+	w.ID, _ = res.LastInsertId()
+	return w, nil
+}
+
+// Update changes the rules of one of owner's watches; the watched user is fixed
+func (s *WatchlistService) Update(ctx context.Context, owner string, id int64, in WatchEntryInput) (WatchEntry, error) {
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return WatchEntry{}, err
+	}
+	defer db.Close()
+	w, err := getWatchEntry(ctx, db, owner, id)
+	if err != nil {
+		return w, err
+	}
+	if in.UserID != nil && *in.UserID != w.UserID {
+		return w, fmt.Errorf("%w: user_id cannot be changed", ErrInvalidWatch)
+	}
+	applyWatchInput(&w, in)
+	if err := validateWatchEntry(&w); err != nil {
+		return w, err
+	}
+	w.UpdatedAt = time.Now().Unix()
+	_, err = db.ExecContext(ctx, `
+		UPDATE watchlist SET note = ?, enabled = ?, window_minutes = ?, request_threshold = ?, quota_threshold = ?,
+			notify_country_change = ?, notify_ban = ?, updated_at = ?
+		WHERE id = ?`,
+		w.Note, boolToInt(w.Enabled), w.WindowMinutes, w.RequestThreshold, w.QuotaThreshold,
+		boolToInt(w.NotifyCountryChange), boolToInt(w.NotifyBan), w.UpdatedAt, id)
+	return w, err
+}
+
+// Delete stops watching; past alerts are kept
+func (s *WatchlistService) Delete(ctx context.Context, owner string, id int64) error {
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.ExecContext(ctx, `DELETE FROM watchlist WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWatchNotFound
+	}
+	return nil
+}
+
+// ListAlerts returns owner's most recent alerts
+func (s *WatchlistService) ListAlerts(ctx context.Context, owner string, unreadOnly bool, limit int) ([]WatchAlert, int, error) {
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+	var unread int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM watchlist_alerts WHERE owner = ? AND read = 0`, owner).Scan(&unread); err != nil {
+		return nil, 0, err
+	}
+	query := `SELECT id, watch_id, owner, user_id, username, kind, message, data, read, created_at
+		FROM watchlist_alerts WHERE owner = ?`
+	if unreadOnly {
+		query += ` AND read = 0`
+	}
+	rows, err := db.QueryContext(ctx, query+` ORDER BY id DESC LIMIT ?`, owner, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	alerts := []WatchAlert{}
+	for rows.Next() {
+		var a WatchAlert
+		var data string
+		var read int
+		if err := rows.Scan(&a.ID, &a.WatchID, &a.Owner, &a.UserID, &a.Username, &a.Kind, &a.Message, &data, &read, &a.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		a.Read = read == 1
+		a.Data = map[string]interface{}{}
+		_ = json.Unmarshal([]byte(data), &a.Data)
+		alerts = append(alerts, a)
+	}
+	return alerts, unread, rows.Err()
+}
+
+// MarkAlertsRead marks owner's alerts up to and including maxID as read (0 = all)
+func (s *WatchlistService) MarkAlertsRead(ctx context.Context, owner string, maxID int64) (int64, error) {
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	query := `UPDATE watchlist_alerts SET read = 1 WHERE owner = ? AND read = 0`
+	args := []interface{}{owner}
+	if maxID > 0 {
+		query += ` AND id <= ?`
+		args = append(args, maxID)
+	}
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// watchUserStats is what one evaluation pass knows about a watched user
+type watchUserStats struct {
+	requests int64
+	quota    int64
+	status   int
+	found    bool
+	lastIP   string
+}
+
+// Evaluate checks every enabled watch against current data and notifies the
+// owning admin of each newly met condition
+func (s *WatchlistService) Evaluate(ctx context.Context) (WatchlistEvalResult, error) {
+	var result WatchlistEvalResult
+	db, err := openWatchlistStore(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+	entries, err := listWatchEntries(ctx, db, `WHERE enabled = 1 ORDER BY user_id`)
+	if err != nil || len(entries) == 0 {
+		return result, err
+	}
+
+	// Usage is aggregated once per distinct window over all watched users
+	byWindow := map[int][]int64{}
+	users := map[int64]*watchUserStats{}
+	for _, w := range entries {
+		byWindow[w.WindowMinutes] = append(byWindow[w.WindowMinutes], w.UserID)
+		users[w.UserID] = &watchUserStats{}
+	}
+	usage := map[string]*watchUserStats{} // window|user_id
+	now := time.Now().Unix()
+	for window, ids := range byWindow {
+		args := []interface{}{now - int64(window)*60}
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		rows, err := s.logDB.QueryWithTimeout(30*time.Second, s.logDB.RebindQuery(`
+			SELECT user_id, COUNT(*) as requests, COALESCE(SUM(quota), 0) as quota
+			FROM logs
+			WHERE created_at >= ? AND type IN (`+ltRequests()+`) AND user_id IN (`+placeholders(len(ids))+`)
+			GROUP BY user_id`), args...)
+		if err != nil {
+			return result, err
+		}
+		for _, row := range rows {
+			usage[fmt.Sprintf("%d|%d", window, toInt64(row["user_id"]))] = &watchUserStats{
+				requests: toInt64(row["requests"]),
+				quota:    toInt64(row["quota"]),
+			}
+		}
+	}
+
+	userArgs := make([]interface{}, 0, len(users))
+	for id := range users {
+		userArgs = append(userArgs, id)
+	}
+	rows, err := s.db.QueryWithTimeout(15*time.Second, s.db.RebindQuery(
+		`SELECT id, status FROM users WHERE id IN (`+placeholders(len(userArgs))+`)`), userArgs...)
+	if err != nil {
+		return result, err
+	}
+	for _, row := range rows {
+		if st := users[toInt64(row["id"])]; st != nil {
+			st.status = int(toInt64(row["status"]))
+			st.found = true
+		}
+	}
+	if IsIPGeoAvailable() {
+		for id, st := range users {
+			row, err := s.logDB.QueryOneWithTimeout(10*time.Second, s.logDB.RebindQuery(
+				`SELECT ip FROM logs WHERE user_id = ? AND ip IS NOT NULL AND ip <> '' ORDER BY id DESC LIMIT 1`), id)
+			if err == nil && row != nil {
+				st.lastIP = toString(row["ip"])
+			}
+		}
+	}
+
+	for _, w := range entries {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		st := *users[w.UserID]
+		if u := usage[fmt.Sprintf("%d|%d", w.WindowMinutes, w.UserID)]; u != nil {
+			st.requests, st.quota = u.requests, u.quota
+		}
+		alerts := evaluateWatchEntry(&w, st, now)
+		for _, alert := range alerts {
+			if err := saveWatchAlert(ctx, db, &alert); err != nil {
+				return result, err
+			}
+			PublishEventTo(w.Owner, EventWatchlistAlert, map[string]interface{}{
+				"alert_id": alert.ID,
+				"watch_id": w.ID,
+				"user_id":  w.UserID,
+				"username": w.Username,
+				"kind":     alert.Kind,
+				"message":  alert.Message,
+			})
+		}
+		result.Evaluated++
+		result.Alerts += len(alerts)
+		if _, err := db.ExecContext(ctx, `
+			UPDATE watchlist SET last_country = ?, last_status = ?, last_request_alert_at = ?, last_quota_alert_at = ?,
+				last_evaluated_at = ?
+			WHERE id = ?`, w.LastCountry, w.LastStatus, w.LastRequestAlertAt, w.LastQuotaAlertAt, now, w.ID); err != nil {
+			return result, err
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM watchlist_alerts WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY owner ORDER BY id DESC) AS rn FROM watchlist_alerts
+			) WHERE rn > ?)`, watchAlertsKept); err != nil {
+		logger.L.Warn("[关注名单] 清理历史通知失败: " + err.Error())
+	}
+	return result, nil
+}
+
+// evaluateWatchEntry compares st with the watch's last known state, updates
+// that state in place and returns the alerts to deliver. Threshold alerts
+// repeat at most once per window.
+func evaluateWatchEntry(w *WatchEntry, st watchUserStats, now int64) []WatchAlert {
+	alerts := []WatchAlert{}
+	add := func(kind, message string, data map[string]interface{}) {
+		alerts = append(alerts, WatchAlert{
+			WatchID:   w.ID,
+			Owner:     w.Owner,
+			UserID:    w.UserID,
+			Username:  w.Username,
+			Kind:      kind,
+			Message:   message,
+			Data:      data,
+			CreatedAt: now,
+		})
+	}
+	window := int64(w.WindowMinutes) * 60
+
+	if w.RequestThreshold > 0 && st.requests >= w.RequestThreshold && now-w.LastRequestAlertAt >= window {
+		add(WatchAlertRequests, fmt.Sprintf("用户 %s 最近 %d 分钟请求 %d 次，超过阈值 %d", w.Username, w.WindowMinutes, st.requests, w.RequestThreshold),
+			map[string]interface{}{"requests": st.requests, "threshold": w.RequestThreshold, "window_minutes": w.WindowMinutes})
+		w.LastRequestAlertAt = now
+	}
+	if w.QuotaThreshold > 0 && st.quota >= w.QuotaThreshold && now-w.LastQuotaAlertAt >= window {
+		add(WatchAlertQuota, fmt.Sprintf("用户 %s 最近 %d 分钟消耗额度 %d，超过阈值 %d", w.Username, w.WindowMinutes, st.quota, w.QuotaThreshold),
+			map[string]interface{}{"quota": st.quota, "threshold": w.QuotaThreshold, "window_minutes": w.WindowMinutes})
+		w.LastQuotaAlertAt = now
+	}
+
+	if st.lastIP != "" {
+		if geo := LookupIPGeo(st.lastIP); geo.Success && geo.CountryCode != "" {
+			if w.NotifyCountryChange && w.LastCountry != "" && w.LastCountry != geo.CountryCode {
+				add(WatchAlertCountry, fmt.Sprintf("用户 %s 请求来源国家由 %s 变为 %s", w.Username, w.LastCountry, geo.CountryCode),
+					map[string]interface{}{"from": w.LastCountry, "to": geo.CountryCode, "ip": st.lastIP})
+			}
+			w.LastCountry = geo.CountryCode
+		}
+	}
+
+	if st.found {
+		if w.NotifyBan && st.status == 2 && w.LastStatus != 2 {
+			add(WatchAlertBanned, fmt.Sprintf("用户 %s 已被封禁", w.Username), map[string]interface{}{"status": st.status})
+		}
+		w.LastStatus = st.status
+	}
+	return alerts
+}
+
+func saveWatchAlert(ctx context.Context, db *sql.DB, a *WatchAlert) error {
+	data, _ := json.Marshal(a.Data)
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO watchlist_alerts (watch_id, owner, user_id, username, kind, message, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, a.WatchID, a.Owner, a.UserID, a.Username, a.Kind, a.Message, string(data), a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	a.ID, _ = res.LastInsertId()
+	return nil
+}
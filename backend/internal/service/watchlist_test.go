@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/new-api-tools/backend/internal/config"
+)
+
+func TestWatchlistEvaluateNotifiesOwner(t *testing.T) {
+	t.Setenv("SQL_DSN", "not-used")
+	t.Setenv("DATA_DIR", t.TempDir())
+	config.Load()
+	restore := SetIPGeoServiceProviderForTesting(func() *IPGeoService { return nil })
+	defer restore()
+
+	db := installSQLiteForTests(t)
+	db.MustExec(`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, status INTEGER, deleted_at INTEGER)`)
+	db.MustExec(`CREATE TABLE logs (id INTEGER PRIMARY KEY, user_id INTEGER, type INTEGER, quota INTEGER, ip TEXT, created_at INTEGER)`)
+	db.MustExec(`INSERT INTO users (id, username, status) VALUES (1, 'alice', 1), (2, 'bob', 1)`)
+	now := time.Now().Unix()
+	for i := 0; i < 12; i++ {
+		db.MustExec(`INSERT INTO logs (user_id, type, quota, ip, created_at) VALUES (1, 2, 100, '1.2.3.4', ?)`, now-int64(i))
+	}
+
+	ctx := context.Background()
+	svc := NewWatchlistService()
+	uid := func(v int64) *int64 { return &v }
+	threshold := int64(10)
+
+	if _, err := svc.Create(ctx, "alice-admin", WatchEntryInput{UserID: uid(99)}); !errors.Is(err, ErrInvalidWatch) {
+		t.Fatalf("unknown user should be rejected, got %v", err)
+	}
+	watch, err := svc.Create(ctx, "alice-admin", WatchEntryInput{UserID: uid(1), RequestThreshold: &threshold})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Create(ctx, "alice-admin", WatchEntryInput{UserID: uid(1)}); !errors.Is(err, ErrWatchExists) {
+		t.Fatalf("duplicate watch should conflict, got %v", err)
+	}
+	if _, err := svc.Create(ctx, "bob-admin", WatchEntryInput{UserID: uid(2)}); err != nil {
+		t.Fatalf("Create bob watch: %v", err)
+	}
+
+	events, cancel := GetEventBus().Subscribe()
+	defer cancel()
+
+	result, err := svc.Evaluate(ctx)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if result.Evaluated != 2 || result.Alerts != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventWatchlistAlert || ev.Owner != "alice-admin" || ev.Data["kind"] != WatchAlertRequests {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watchlist_alert event not published")
+	}
+
+	// the threshold alert is not repeated inside the same window; a ban is reported once
+	db.MustExec(`UPDATE users SET status = 2 WHERE id = 2`)
+	if result, err = svc.Evaluate(ctx); err != nil || result.Alerts != 1 {
+		t.Fatalf("second Evaluate = %+v, %v; want only the ban alert", result, err)
+	}
+	if result, _ = svc.Evaluate(ctx); result.Alerts != 0 {
+		t.Fatalf("third Evaluate should be quiet, got %+v", result)
+	}
+
+	alerts, unread, err := svc.ListAlerts(ctx, "bob-admin", false, 10)
+	if err != nil || len(alerts) != 1 || alerts[0].Kind != WatchAlertBanned || unread != 1 {
+		t.Fatalf("bob alerts = %+v (unread %d), %v", alerts, unread, err)
+	}
+	if alerts, _, _ := svc.ListAlerts(ctx, "alice-admin", false, 10); len(alerts) != 1 || alerts[0].WatchID != watch.ID {
+		t.Fatalf("alice should only see her own alert, got %+v", alerts)
+	}
+	if n, err := svc.MarkAlertsRead(ctx, "bob-admin", 0); err != nil || n != 1 {
+		t.Fatalf("MarkAlertsRead = %d, %v", n, err)
+	}
+	if _, unread, _ := svc.ListAlerts(ctx, "bob-admin", true, 10); unread != 0 {
+		t.Fatalf("alerts should be read, unread = %d", unread)
+	}
+
+	if err := svc.Delete(ctx, "bob-admin", watch.ID); !errors.Is(err, ErrWatchNotFound) {
+		t.Fatalf("another admin's watch must not be deletable, got %v", err)
+	}
+}
+
+func TestEvaluateWatchEntryQuotaWindow(t *testing.T) {
+	w := WatchEntry{ID: 1, Owner: "admin", UserID: 7, Username: "carol", WindowMinutes: 60, QuotaThreshold: 1000}
+	now := int64(1_700_000_000)
+
+	if alerts := evaluateWatchEntry(&w, watchUserStats{quota: 999}, now); len(alerts) != 0 {
+		t.Fatalf("below threshold should not alert, got %+v", alerts)
+	}
+	if alerts := evaluateWatchEntry(&w, watchUserStats{quota: 1500}, now); len(alerts) != 1 || alerts[0].Kind != WatchAlertQuota {
+		t.Fatalf("expected one quota alert, got %+v", alerts)
+	}
+	if alerts := evaluateWatchEntry(&w, watchUserStats{quota: 1500}, now+1800); len(alerts) != 0 {
+		t.Fatalf("quota alert should be suppressed within the window, got %+v", alerts)
+	}
+	if alerts := evaluateWatchEntry(&w, watchUserStats{quota: 1500}, now+3600); len(alerts) != 1 {
+		t.Fatalf("quota alert should repeat after the window, got %+v", alerts)
+	}
+}
@@ -31,7 +31,18 @@ func CalculateExpiration(mode string, days int, expireDate string) (int64, error
 // ParseDateToTimestamp parses a date string to Unix timestamp
 // Supports ISO 8601 (2024-01-01T00:00:00Z) and date-only (2024-01-01)
 func parseDateToTimestamp(dateStr string, endOfDay bool) (int64, error) {
-	// Try ISO 8601 with timezone
+	return ParseDateInLocation(dateStr, endOfDay, time.Local)
+}
+
+// ParseDateToTimestampPublic is the exported version for use outside util
+func ParseDateToTimestampPublic(dateStr string, endOfDay bool) (int64, error) {
+	return parseDateToTimestamp(dateStr, endOfDay)
+}
+
+// ParseDateInLocation parses a date string like parseDateToTimestamp, reading
+// dates without an explicit offset in loc. endOfDay moves a date-only value to
+// the last second of that calendar day (23 or 25 hours long on DST days).
+func ParseDateInLocation(dateStr string, endOfDay bool, loc *time.Location) (int64, error) {
 	layouts := []string{
 		time.RFC3339,
 		"2006-01-02T15:04:05",
@@ -39,10 +50,10 @@ func parseDateToTimestamp(dateStr string, endOfDay bool) (int64, error) {
 	}
 
 	for _, layout := range layouts {
-		t, err := time.ParseInLocation(layout, dateStr, time.Local)
+		t, err := time.ParseInLocation(layout, dateStr, loc)
 		if err == nil {
 			if endOfDay && layout == "2006-01-02" {
-				t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+				t = t.AddDate(0, 0, 1).Add(-time.Second)
 			}
 			return t.Unix(), nil
 		}
@@ -50,8 +61,3 @@ func parseDateToTimestamp(dateStr string, endOfDay bool) (int64, error) {
 
 	return 0, fmt.Errorf("invalid date format: %s", dateStr)
 }
-
-// ParseDateToTimestampPublic is the exported version for use outside util
-func ParseDateToTimestampPublic(dateStr string, endOfDay bool) (int64, error) {
-	return parseDateToTimestamp(dateStr, endOfDay)
-}
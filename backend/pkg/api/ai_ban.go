@@ -0,0 +1,105 @@
+package api
+
+// AuditLogPage is the data of GET /api/ai-ban/audit-logs; items are the
+// stored assessment records, newest first
+type AuditLogPage struct {
+	Items  []map[string]interface{} `json:"items"`
+	Total  int                      `json:"total"`
+	Limit  int                      `json:"limit"`
+	Offset int                      `json:"offset"`
+}
+
+// SuspiciousUser is one candidate of GET /api/ai-ban/suspicious-users
+type SuspiciousUser struct {
+	UserID        int64    `json:"user_id"`
+	Username      string   `json:"username"`
+	TotalRequests int64    `json:"total_requests"`
+	FailureCount  int64    `json:"failure_count"`
+	FailureRate   float64  `json:"failure_rate"` // 百分比
+	TotalQuota    int64    `json:"total_quota"`
+	UniqueIPs     int64    `json:"unique_ips"`
+	UniqueModels  int64    `json:"unique_models"`
+	RiskFlags     []string `json:"risk_flags"`
+	RuleScore     int      `json:"rule_score"`
+	RuleLevel     string   `json:"rule_level"`
+}
+
+// AssessRequest is the body of POST /api/ai-ban/assess
+type AssessRequest struct {
+	UserID int64  `json:"user_id"`
+	Window string `json:"window,omitempty"` // 省略时为 1h
+}
+
+// Assessment is the data of POST /api/ai-ban/assess
+type Assessment struct {
+	UserID          int64             `json:"user_id"`
+	Window          string            `json:"window"`
+	RiskScore       int               `json:"risk_score"`
+	RiskLevel       string            `json:"risk_level"`
+	Suggestion      string            `json:"suggestion"`
+	Assessed        bool              `json:"assessed"`
+	AssessedAt      int64             `json:"assessed_at"`
+	RuleScore       int               `json:"rule_score"`
+	RuleLevel       string            `json:"rule_level"`
+	PromptVariables map[string]string `json:"prompt_variables,omitempty"`
+	Prompt          string            `json:"prompt,omitempty"` // 配置了 custom_prompt 时为渲染后的提示词
+}
+
+// ScanResult is the data of POST /api/ai-ban/scan
+type ScanResult struct {
+	Scanned  int    `json:"scanned"`
+	Assessed int    `json:"assessed"`
+	Banned   int    `json:"banned"`
+	DryRun   bool   `json:"dry_run"`
+	Window   string `json:"window"`
+	Message  string `json:"message"`
+}
+
+// Whitelist is the data of GET /api/ai-ban/whitelist
+type Whitelist struct {
+	Items []WhitelistedUser `json:"items"`
+	Total int               `json:"total"`
+	Rules []WhitelistRule   `json:"rules"`
+}
+
+// WhitelistedUser is one unexpired whitelisted user
+type WhitelistedUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	Status    int64  `json:"status"`
+	Reason    string `json:"reason"`
+	AddedAt   int64  `json:"added_at"`
+	ExpiresAt int64  `json:"expires_at"` // 0 = 永久
+}
+
+// AddWhitelistRequest is the body of POST /api/ai-ban/whitelist/add
+type AddWhitelistRequest struct {
+	UserID    int64  `json:"user_id"`
+	Reason    string `json:"reason,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // 0 = 永久
+}
+
+// RemoveWhitelistRequest is the body of POST /api/ai-ban/whitelist/remove
+type RemoveWhitelistRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// WhitelistResult is the data of the whitelist add / remove endpoints
+type WhitelistResult struct {
+	Message string `json:"message"`
+}
+
+// WhitelistRule whitelists every user matching a pattern
+type WhitelistRule struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Reason    string `json:"reason"`
+	ExpiresAt int64  `json:"expires_at"` // 0 = 永久
+	CreatedAt int64  `json:"created_at"`
+}
+
+// String is how a rule is written in bulk imports and match results
+func (r WhitelistRule) String() string {
+	return r.Type + ":" + r.Value
+}
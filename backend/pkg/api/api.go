@@ -0,0 +1,25 @@
+// Package api holds the request and response types of the NewAPI Tools HTTP
+// API. The server (internal/service, internal/handler) and the Go SDK
+// (pkg/client) share them, so programs outside this module can build requests
+// and decode responses without importing internal packages.
+package api
+
+// ErrorDetail holds the error detail structure
+type ErrorDetail struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// LoginRequest matches Python's LoginRequest
+type LoginRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse matches Python's LoginResponse
+type LoginResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Token     string `json:"token,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,105 @@
+package api
+
+// SystemOverview is the data of GET /api/dashboard/overview
+type SystemOverview struct {
+	TotalUsers        int64 `json:"total_users"`
+	ActiveUsers       int64 `json:"active_users"` // 周期内有请求的用户
+	TotalTokens       int64 `json:"total_tokens"`
+	ActiveTokens      int64 `json:"active_tokens"`
+	TotalChannels     int64 `json:"total_channels"`
+	ActiveChannels    int64 `json:"active_channels"`
+	TotalModels       int64 `json:"total_models"`
+	TotalRedemptions  int64 `json:"total_redemptions"`
+	UnusedRedemptions int64 `json:"unused_redemptions"`
+}
+
+// UsageStatistics is the data of GET /api/dashboard/usage (successful requests only)
+type UsageStatistics struct {
+	TotalRequests         int64   `json:"total_requests"`
+	TotalQuotaUsed        int64   `json:"total_quota_used"`
+	TotalPromptTokens     int64   `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64   `json:"total_completion_tokens"`
+	AverageResponseTime   float64 `json:"average_response_time"`
+	Period                string  `json:"period"`
+}
+
+// ModelUsage is one row of GET /api/dashboard/models
+type ModelUsage struct {
+	ModelName        string `json:"model_name"`
+	RequestCount     int64  `json:"request_count"`
+	QuotaUsed        int64  `json:"quota_used"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// DailyTrend is one day of GET /api/dashboard/trends/daily; days without
+// traffic are filled with zeros
+type DailyTrend struct {
+	Date         string `json:"date"`      // 报表时区的 YYYY-MM-DD
+	Timestamp    int64  `json:"timestamp"` // 当天 0 点
+	RequestCount int64  `json:"request_count"`
+	QuotaUsed    int64  `json:"quota_used"`
+	UniqueUsers  int64  `json:"unique_users"`
+}
+
+// HourlyTrend is one hour of GET /api/dashboard/trends/hourly
+type HourlyTrend struct {
+	Hour         string `json:"hour"` // 报表时区的 "YYYY-MM-DD HH:00"
+	Timestamp    int64  `json:"timestamp"`
+	RequestCount int64  `json:"request_count"`
+	QuotaUsed    int64  `json:"quota_used"`
+}
+
+// TopUser is one row of GET /api/dashboard/top-users
+type TopUser struct {
+	UserID       int64  `json:"user_id"`
+	Username     string `json:"username"`
+	RequestCount int64  `json:"request_count"`
+	QuotaUsed    int64  `json:"quota_used"`
+}
+
+// ChannelStatus is one row of GET /api/dashboard/channels
+type ChannelStatus struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Type      int64   `json:"type"`
+	Status    int64   `json:"status"`
+	UsedQuota int64   `json:"used_quota"`
+	Balance   float64 `json:"balance"`
+	Priority  int64   `json:"priority"`
+}
+
+// FleetOverview is the data of GET /api/dashboard/fleet
+type FleetOverview struct {
+	Period    string          `json:"period"`
+	Totals    FleetTotals     `json:"totals"`
+	Instances []FleetInstance `json:"instances"`
+}
+
+// FleetInstance is one registered instance; the overview and usage numbers
+// are inlined once the instance answered
+type FleetInstance struct {
+	Instance  string `json:"instance"`
+	Available bool   `json:"available"`
+	Error     string `json:"error"`
+	*SystemOverview
+	*UsageStatistics
+}
+
+// FleetTotals sums the instances; average_response_time is weighted by
+// total_requests so a quiet instance doesn't skew the fleet mean
+type FleetTotals struct {
+	TotalUsers            int64   `json:"total_users"`
+	ActiveUsers           int64   `json:"active_users"`
+	TotalTokens           int64   `json:"total_tokens"`
+	ActiveTokens          int64   `json:"active_tokens"`
+	TotalChannels         int64   `json:"total_channels"`
+	ActiveChannels        int64   `json:"active_channels"`
+	TotalRequests         int64   `json:"total_requests"`
+	TotalQuotaUsed        int64   `json:"total_quota_used"`
+	TotalPromptTokens     int64   `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64   `json:"total_completion_tokens"`
+	AverageResponseTime   float64 `json:"average_response_time"`
+	InstancesTotal        int     `json:"instances_total"`
+	InstancesReporting    int     `json:"instances_reporting"` // 用量统计成功返回的实例数
+}
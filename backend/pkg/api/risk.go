@@ -0,0 +1,274 @@
+package api
+
+// IPReputation is the classification of one IP
+type IPReputation struct {
+	IP     string `json:"ip"`
+	Type   string `json:"type"`
+	Source string `json:"source,omitempty"` // 命中的列表名，或 asn
+	ASN    string `json:"asn,omitempty"`
+	Org    string `json:"org,omitempty"`
+}
+
+// IPReputationSummary splits the top IPs' requests by reputation type;
+// share_by_type is a percentage
+type IPReputationSummary struct {
+	RequestsByType map[string]int64    `json:"requests_by_type"`
+	ShareByType    map[string]float64  `json:"share_by_type"`
+	IPsByType      map[string][]string `json:"ips_by_type"`
+}
+
+// ArchivedLogScan describes the archived part of a result. Only rows already
+// pruned from the live logs table are taken from the archive, so nothing is
+// counted twice: ids below the smallest live id are gone by definition, the
+// few above it are checked against the logs table in batches.
+type ArchivedLogScan struct {
+	IncludesArchived bool     `json:"includes_archived"`
+	Label            string   `json:"label"`
+	Files            int      `json:"files"`
+	ScannedRows      int64    `json:"scanned_rows"`
+	MatchedRows      int64    `json:"matched_rows"`
+	LiveFromID       int64    `json:"live_from_id"` // logs 表当前最小 id
+	Truncated        bool     `json:"truncated"`    // 达到扫描上限，归档部分不完整
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// ArchivedUserSummary is the archived_summary of a user analysis
+type ArchivedUserSummary struct {
+	TotalRequests    int64 `json:"total_requests"`
+	SuccessRequests  int64 `json:"success_requests"`
+	FailureRequests  int64 `json:"failure_requests"`
+	QuotaUsed        int64 `json:"quota_used"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	EmptyCount       int64 `json:"empty_count"`
+	UniqueIPs        int64 `json:"unique_ips"`
+	UniqueTokens     int64 `json:"unique_tokens"`
+	UniqueModels     int64 `json:"unique_models"`
+	UniqueChannels   int64 `json:"unique_channels"`
+}
+
+// OAuthProfile is the public profile of one linked OAuth account
+type OAuthProfile struct {
+	Provider       string `json:"provider"`
+	ID             string `json:"id"`
+	Login          string `json:"login,omitempty"`
+	Name           string `json:"name,omitempty"`
+	ProfileURL     string `json:"profile_url,omitempty"`
+	CreatedAt      int64  `json:"created_at"`       // 账号注册时间，0 = 未知
+	AccountAgeDays int    `json:"account_age_days"` // -1 = 未知
+	NewAccount     bool   `json:"new_account"`
+	PublicRepos    *int   `json:"public_repos,omitempty"`
+	Followers      *int   `json:"followers,omitempty"`
+	Source         string `json:"source"` // api | snowflake
+	FromCache      bool   `json:"from_cache"`
+	FetchedAt      int64  `json:"fetched_at"`
+	Error          string `json:"error,omitempty"` // not_found / rate_limited / ...，仍可能带有推算出的注册时间
+}
+
+// Leaderboards is the data of GET /api/risk/leaderboards, keyed by window
+type Leaderboards struct {
+	Windows     map[string][]LeaderboardEntry `json:"windows"`
+	GeneratedAt int64                         `json:"generated_at"`
+}
+
+// LeaderboardEntry is one user of a leaderboard window
+type LeaderboardEntry struct {
+	UserID           int64   `json:"user_id"`
+	Username         string  `json:"username"` // 优先 display_name
+	UserStatus       int64   `json:"user_status"`
+	RequestCount     int64   `json:"request_count"`
+	FailureRequests  int64   `json:"failure_requests"`
+	FailureRate      float64 `json:"failure_rate"` // 0-1
+	QuotaUsed        int64   `json:"quota_used"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	UniqueIPs        int64   `json:"unique_ips"`
+}
+
+// UserAnalysis is the data of GET /api/risk/users/:user_id/analysis
+type UserAnalysis struct {
+	Range       UserAnalysisRange   `json:"range"`
+	User        UserAnalysisUser    `json:"user"`
+	Summary     UserAnalysisSummary `json:"summary"`
+	Risk        UserAnalysisRisk    `json:"risk"`
+	TopModels   []UserTopModel      `json:"top_models"`
+	TopChannels []UserTopChannel    `json:"top_channels"`
+	TopIPs      []UserTopIP         `json:"top_ips"`
+	RecentLogs  []UserRecentLog     `json:"recent_logs"`
+
+	// include_archived=1 时由 GetUserAnalysisWithArchive 填充
+	ArchivedSummary *ArchivedUserSummary `json:"archived_summary,omitempty"`
+	Archive         *ArchivedLogScan     `json:"archive,omitempty"`
+	// 主实例上由 handler 附加的人工联系记录摘要
+	Communications *CommSummary `json:"communications,omitempty"`
+}
+
+// UserAnalysisRange is the analyzed time range
+type UserAnalysisRange struct {
+	StartTime     int64 `json:"start_time"`
+	EndTime       int64 `json:"end_time"`
+	WindowSeconds int64 `json:"window_seconds"`
+}
+
+// UserAnalysisUser is the analyzed user; status is 1 when the user row is missing
+type UserAnalysisUser struct {
+	ID            int64          `json:"id"`
+	Username      string         `json:"username"`
+	DisplayName   string         `json:"display_name"`
+	Email         string         `json:"email"`
+	Status        int64          `json:"status"`
+	Group         string         `json:"group"`
+	Remark        string         `json:"remark"`
+	LinuxDoID     string         `json:"linux_do_id"`
+	OAuthProfiles []OAuthProfile `json:"oauth_profiles,omitempty"` // 开启 OAuth 资料补全时
+}
+
+// UserAnalysisSummary is the user's usage in the window; rates are 0-1
+type UserAnalysisSummary struct {
+	TotalRequests    int64   `json:"total_requests"`
+	SuccessRequests  int64   `json:"success_requests"`
+	FailureRequests  int64   `json:"failure_requests"`
+	QuotaUsed        int64   `json:"quota_used"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	AvgUseTime       float64 `json:"avg_use_time"`
+	UniqueIPs        int64   `json:"unique_ips"`
+	UniqueTokens     int64   `json:"unique_tokens"`
+	UniqueModels     int64   `json:"unique_models"`
+	UniqueChannels   int64   `json:"unique_channels"`
+	EmptyCount       int64   `json:"empty_count"`
+	FailureRate      float64 `json:"failure_rate"`
+	EmptyRate        float64 `json:"empty_rate"`
+}
+
+// UserAnalysisRisk is the rule-based risk assessment
+type UserAnalysisRisk struct {
+	RequestsPerMinute  float64                `json:"requests_per_minute"`
+	LiveRPM            *float64               `json:"live_rpm"` // 进程内计数器的最近 5 分钟 RPM，未启用时为 null
+	AvgQuotaPerRequest float64                `json:"avg_quota_per_request"`
+	RiskFlags          []string               `json:"risk_flags"`
+	RuleScore          int                    `json:"rule_score"` // 规则加权分 0-100，区别于 AI 评估的 risk_score
+	RuleLevel          string                 `json:"rule_level"`
+	IPSwitchAnalysis   map[string]interface{} `json:"ip_switch_analysis"`
+	CheckinAnalysis    *CheckinAnalysis       `json:"checkin_analysis,omitempty"`
+	IPReputation       *IPReputationSummary   `json:"ip_reputation,omitempty"`
+}
+
+// UserTopModel is one of the user's most used models
+type UserTopModel struct {
+	ModelName       string `json:"model_name"`
+	Requests        int64  `json:"requests"`
+	QuotaUsed       int64  `json:"quota_used"`
+	SuccessRequests int64  `json:"success_requests"`
+	FailureRequests int64  `json:"failure_requests"`
+	EmptyCount      int64  `json:"empty_count"`
+}
+
+// UserTopChannel is one of the user's most used channels
+type UserTopChannel struct {
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Requests    int64  `json:"requests"`
+	QuotaUsed   int64  `json:"quota_used"`
+}
+
+// UserTopIP is one of the user's most used IPs with its reputation type
+type UserTopIP struct {
+	IP           string `json:"ip"`
+	Requests     int64  `json:"requests"`
+	IPType       string `json:"ip_type,omitempty"`
+	IPTypeSource string `json:"ip_type_source,omitempty"`
+}
+
+// UserRecentLog is one of the user's latest request logs
+type UserRecentLog struct {
+	ID               int64  `json:"id"`
+	CreatedAt        int64  `json:"created_at"`
+	Type             int64  `json:"type"`
+	ModelName        string `json:"model_name"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	UseTime          int64  `json:"use_time"`
+	IP               string `json:"ip"`
+	ChannelID        int64  `json:"channel_id"`
+	ChannelName      string `json:"channel_name"`
+	TokenID          int64  `json:"token_id"`
+	TokenName        string `json:"token_name"`
+}
+
+// TokenRotationList is the data of GET /api/risk/token-rotation
+type TokenRotationList struct {
+	Items  []TokenRotationUser `json:"items"`
+	Total  int                 `json:"total"`
+	Window string              `json:"window"`
+}
+
+// TokenRotationUser is a user spreading few requests over many tokens
+type TokenRotationUser struct {
+	UserID              int64   `json:"user_id"`
+	Username            string  `json:"username"`
+	TokenCount          int64   `json:"token_count"`
+	TotalRequests       int64   `json:"total_requests"`
+	AvgRequestsPerToken float64 `json:"avg_requests_per_token"`
+}
+
+// AffiliatedAccountList is the data of GET /api/risk/affiliated-accounts
+type AffiliatedAccountList struct {
+	Items      []AffiliatedInviter `json:"items"`
+	Total      int                 `json:"total"`
+	MinInvited int                 `json:"min_invited"`
+}
+
+// AffiliatedInviter is an inviter with at least min_invited invitees
+type AffiliatedInviter struct {
+	InviterID    int64 `json:"inviter_id"`
+	InvitedCount int64 `json:"invited_count"`
+}
+
+// SameIPRegistrationList is the data of GET /api/risk/same-ip-registrations
+type SameIPRegistrationList struct {
+	Items    []SameIPRegistration `json:"items"`
+	Total    int                  `json:"total"`
+	Window   string               `json:"window"`
+	MinUsers int                  `json:"min_users"`
+}
+
+// SameIPRegistration is an IP shared by at least min_users users
+type SameIPRegistration struct {
+	FirstIP   string `json:"first_ip"`
+	UserCount int64  `json:"user_count"`
+}
+
+// CheckinAnalysis holds checkin anomaly detection results
+type CheckinAnalysis struct {
+	CheckinCount       int64   `json:"checkin_count"`
+	TotalQuotaAwarded  int64   `json:"total_quota_awarded"`
+	RequestsPerCheckin float64 `json:"requests_per_checkin"`
+}
+
+// UserCommunication is one logged outreach to a user
+type UserCommunication struct {
+	ID          int64  `json:"id"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	Channel     string `json:"channel"`
+	Subject     string `json:"subject"` // 事由，如 "滥用警告"
+	Summary     string `json:"summary"`
+	Outcome     string `json:"outcome"`
+	ContactedAt int64  `json:"contacted_at"`
+	FollowUpAt  int64  `json:"follow_up_at"` // 0 = 无需跟进
+	Operator    string `json:"operator"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+// CommSummary is the outreach digest shown in the user detail
+type CommSummary struct {
+	Total           int64               `json:"total"`
+	LastContactedAt int64               `json:"last_contacted_at"`
+	LastOperator    string              `json:"last_operator"`
+	LastOutcome     string              `json:"last_outcome"`
+	PendingFollowUp int64               `json:"pending_follow_up"`
+	Recent          []UserCommunication `json:"recent"`
+}
@@ -0,0 +1,168 @@
+package api
+
+// ActivityStats is the data of GET /api/users/activity-stats; quick mode
+// only counts total and never-requested users
+type ActivityStats struct {
+	TotalUsers        int64 `json:"total_users"`
+	ActiveUsers       int64 `json:"active_users"`        // 7 天内有请求
+	InactiveUsers     int64 `json:"inactive_users"`      // 7-30 天内有请求
+	VeryInactiveUsers int64 `json:"very_inactive_users"` // 30 天以上无请求
+	NeverRequested    int64 `json:"never_requested"`
+	QuickMode         bool  `json:"quick_mode,omitempty"`
+}
+
+// ListUsersParams defines parameters for listing users; the form tags are
+// the query parameters of GET /api/users
+type ListUsersParams struct {
+	Page           int    `json:"page" form:"page"`
+	PageSize       int    `json:"page_size" form:"page_size"`
+	ActivityFilter string `json:"activity_filter" form:"activity"`
+	GroupFilter    string `json:"group_filter" form:"group"`
+	SourceFilter   string `json:"source_filter" form:"source"`
+	Search         string `json:"search" form:"search"`
+	OrderBy        string `json:"order_by" form:"order_by"`
+	OrderDir       string `json:"order_dir" form:"order_dir"`
+}
+
+// UserList is the data of GET /api/users
+type UserList struct {
+	Items      []UserListItem `json:"items"`
+	Total      int64          `json:"total"`
+	Page       int            `json:"page"`
+	PageSize   int            `json:"page_size"`
+	TotalPages int            `json:"total_pages"`
+}
+
+// UserListItem is one user of the user list
+type UserListItem struct {
+	ID              int64  `json:"id"`
+	Username        string `json:"username"`
+	DisplayName     string `json:"display_name"`
+	Email           string `json:"email"`
+	Role            int64  `json:"role"`
+	Status          int64  `json:"status"`
+	Quota           int64  `json:"quota"`
+	UsedQuota       int64  `json:"used_quota"`
+	RequestCount    int64  `json:"request_count"`
+	Group           string `json:"group"`
+	AffCode         string `json:"aff_code"`
+	Remark          string `json:"remark"`
+	LinuxDoID       string `json:"linux_do_id"`
+	Source          string `json:"source"`            // password / github / wechat / telegram / discord / oidc / linux_do
+	ActivityLevel   string `json:"activity_level"`    // active / never
+	LastRequestTime *int64 `json:"last_request_time"` // 列表不统计，恒为 null
+}
+
+// BannedUserList is the data of GET /api/users/banned
+type BannedUserList struct {
+	Items      []BannedUser `json:"items"`
+	Total      int64        `json:"total"`
+	Page       int          `json:"page"`
+	PageSize   int          `json:"page_size"`
+	TotalPages int          `json:"total_pages"`
+}
+
+// BannedUser is one banned user
+type BannedUser struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	DisplayName  string `json:"display_name"`
+	Email        string `json:"email"`
+	Status       int64  `json:"status"`
+	Role         int64  `json:"role"`
+	Quota        int64  `json:"quota"`
+	UsedQuota    int64  `json:"used_quota"`
+	RequestCount int64  `json:"request_count"`
+}
+
+// Confirm texts the destructive user endpoints require in confirm_text
+const (
+	ConfirmTextSoftDelete = "注销用户"
+	ConfirmTextHardDelete = "彻底删除"
+)
+
+// DeleteUserRequest is the body of DELETE /api/users/:user_id
+type DeleteUserRequest struct {
+	ConfirmText string `json:"confirm_text"` // 软删除为 ConfirmTextSoftDelete，hard_delete=true 时为 ConfirmTextHardDelete
+}
+
+// BanUserRequest is the body of POST /api/users/:user_id/ban
+type BanUserRequest struct {
+	Reason        string `json:"reason,omitempty"`
+	DisableTokens bool   `json:"disable_tokens"` // 省略时为 true
+}
+
+// UnbanUserRequest is the body of POST /api/users/:user_id/unban
+type UnbanUserRequest struct {
+	Reason       string `json:"reason,omitempty"`
+	EnableTokens bool   `json:"enable_tokens"`
+}
+
+// AffectedResult is the data of the delete and purge endpoints
+type AffectedResult struct {
+	Affected int64 `json:"affected"`
+}
+
+// BatchDeleteRequest is the body of POST /api/users/batch-delete
+type BatchDeleteRequest struct {
+	ActivityLevel string `json:"activity_level"` // 省略时为 very_inactive
+	DryRun        bool   `json:"dry_run"`        // 省略时为 true
+	HardDelete    bool   `json:"hard_delete"`
+	ConfirmText   string `json:"confirm_text,omitempty"` // dry_run=false 时必填
+}
+
+// BatchDeleteResult is the data of POST /api/users/batch-delete
+type BatchDeleteResult struct {
+	DryRun        bool     `json:"dry_run"`
+	Count         int64    `json:"count"`
+	AffectedCount int64    `json:"affected_count"`
+	ActivityLevel string   `json:"activity_level"`
+	HardDelete    bool     `json:"hard_delete"`
+	Users         []string `json:"users,omitempty"` // dry_run 时最多 20 个待删除用户名
+}
+
+// InvitedUsers is the data of GET /api/users/:user_id/invited; inviter is
+// null and the list empty when the user does not exist
+type InvitedUsers struct {
+	Inviter  *Inviter      `json:"inviter"`
+	Items    []InvitedUser `json:"items"`
+	Total    int64         `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Stats    InvitedStats  `json:"stats"`
+}
+
+// Inviter is the user whose invitees are listed
+type Inviter struct {
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AffCode     string `json:"aff_code"`
+	AffCount    int64  `json:"aff_count"`
+	AffQuota    int64  `json:"aff_quota"`
+	AffHistory  int64  `json:"aff_history"`
+}
+
+// InvitedUser is one invitee
+type InvitedUser struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	DisplayName  string `json:"display_name"`
+	Email        string `json:"email"`
+	Status       int64  `json:"status"`
+	Quota        int64  `json:"quota"`
+	UsedQuota    int64  `json:"used_quota"`
+	RequestCount int64  `json:"request_count"`
+	Group        string `json:"group"`
+	Role         int64  `json:"role"`
+}
+
+// InvitedStats summarises the current page of invitees; total_invited
+// counts all of them
+type InvitedStats struct {
+	TotalInvited   int64 `json:"total_invited"`
+	ActiveCount    int64 `json:"active_count"`
+	BannedCount    int64 `json:"banned_count"`
+	TotalUsedQuota int64 `json:"total_used_quota"`
+	TotalRequests  int64 `json:"total_requests"`
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// AIBanAPI wraps /api/ai-ban endpoints.
+type AIBanAPI struct{ c *Client }
+
+// GetConfig calls GET /api/ai-ban/config.
+func (a *AIBanAPI) GetConfig(ctx context.Context) (Object, error) {
+	var out Object
+	_, err := a.c.do(ctx, http.MethodGet, "/api/ai-ban/config", nil, nil, &out)
+	return out, err
+}
+
+// SaveConfig calls POST /api/ai-ban/config with a partial config update and
+// returns the effective config.
+func (a *AIBanAPI) SaveConfig(ctx context.Context, patch Object) (Object, error) {
+	var out Object
+	_, err := a.c.do(ctx, http.MethodPost, "/api/ai-ban/config", nil, patch, &out)
+	return out, err
+}
+
+// SuspiciousUsers calls GET /api/ai-ban/suspicious-users.
+func (a *AIBanAPI) SuspiciousUsers(ctx context.Context, window string, limit int) ([]api.SuspiciousUser, error) {
+	q := url.Values{}
+	setStr(q, "window", window)
+	setInt(q, "limit", limit)
+	var out []api.SuspiciousUser
+	_, err := a.c.do(ctx, http.MethodGet, "/api/ai-ban/suspicious-users", q, nil, &out)
+	return out, err
+}
+
+// Assess calls POST /api/ai-ban/assess for a single user.
+func (a *AIBanAPI) Assess(ctx context.Context, req api.AssessRequest) (*api.Assessment, error) {
+	var out api.Assessment
+	_, err := a.c.do(ctx, http.MethodPost, "/api/ai-ban/assess", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Scan calls POST /api/ai-ban/scan.
+func (a *AIBanAPI) Scan(ctx context.Context, window string, limit int) (*api.ScanResult, error) {
+	q := url.Values{}
+	setStr(q, "window", window)
+	setInt(q, "limit", limit)
+	var out api.ScanResult
+	_, err := a.c.do(ctx, http.MethodPost, "/api/ai-ban/scan", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AuditLogs calls GET /api/ai-ban/audit-logs.
+func (a *AIBanAPI) AuditLogs(ctx context.Context, limit, offset int, status string) (*api.AuditLogPage, error) {
+	q := url.Values{}
+	setInt(q, "limit", limit)
+	setInt(q, "offset", offset)
+	setStr(q, "status", status)
+	var out api.AuditLogPage
+	_, err := a.c.do(ctx, http.MethodGet, "/api/ai-ban/audit-logs", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Whitelist calls GET /api/ai-ban/whitelist.
+func (a *AIBanAPI) Whitelist(ctx context.Context) (*api.Whitelist, error) {
+	var out api.Whitelist
+	_, err := a.c.do(ctx, http.MethodGet, "/api/ai-ban/whitelist", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddToWhitelist calls POST /api/ai-ban/whitelist/add.
+func (a *AIBanAPI) AddToWhitelist(ctx context.Context, req api.AddWhitelistRequest) (*api.WhitelistResult, error) {
+	var out api.WhitelistResult
+	_, err := a.c.do(ctx, http.MethodPost, "/api/ai-ban/whitelist/add", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveFromWhitelist calls POST /api/ai-ban/whitelist/remove.
+func (a *AIBanAPI) RemoveFromWhitelist(ctx context.Context, userID int64) (*api.WhitelistResult, error) {
+	var out api.WhitelistResult
+	_, err := a.c.do(ctx, http.MethodPost, "/api/ai-ban/whitelist/remove", nil, api.RemoveWhitelistRequest{UserID: userID}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
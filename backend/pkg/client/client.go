@@ -0,0 +1,208 @@
+// Package client is a typed Go SDK for the NewAPI Tools backend API.
+//
+// 自动化脚本可以直接使用本包调用 dashboard / users / risk / ai-ban 等接口，
+// 无需手写 HTTP 请求与 {"success": ..., "data": ...} 响应解包。请求与响应
+// 类型定义在 pkg/api，与服务端共用。
+//
+//	c := client.New("http://127.0.0.1:8000", client.WithAPIKey(os.Getenv("API_KEY")))
+//	overview, err := c.Dashboard.Overview(ctx, "7d")
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// Object is the generic JSON object of endpoints without a typed response
+// (e.g. the AI-ban config).
+type Object = map[string]interface{}
+
+// Client talks to a NewAPI Tools backend instance.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	token      string
+	httpClient *http.Client
+
+	Dashboard *DashboardAPI
+	Users     *UsersAPI
+	Risk      *RiskAPI
+	AIBan     *AIBanAPI
+}
+
+// Option customizes a Client.
+type Option func(*Client)
+
+// WithAPIKey authenticates requests with the X-API-Key header.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithToken authenticates requests with a JWT bearer token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient replaces the default http.Client (30s timeout).
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// New creates a Client for baseURL (e.g. "http://127.0.0.1:8000").
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.Dashboard = &DashboardAPI{c: c}
+	c.Users = &UsersAPI{c: c}
+	c.Risk = &RiskAPI{c: c}
+	c.AIBan = &AIBanAPI{c: c}
+	return c
+}
+
+// APIError is returned when the server answers with success=false or a non-2xx status.
+type APIError struct {
+	StatusCode int
+	api.ErrorDetail
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("api error %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// envelope is the standard {"success", "data", "message", "error"} wrapper.
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+	Error   api.ErrorDetail `json:"error"`
+}
+
+// Login exchanges the admin password for a JWT and stores it on the client.
+func (c *Client) Login(ctx context.Context, password string) (*api.LoginResponse, error) {
+	raw, status, err := c.send(ctx, http.MethodPost, "/api/auth/login", nil, api.LoginRequest{Password: password})
+	if err != nil {
+		return nil, err
+	}
+	var resp api.LoginResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("decode login response: %w", err)
+	}
+	if !resp.Success {
+		return &resp, &APIError{StatusCode: status, ErrorDetail: api.ErrorDetail{Code: "UNAUTHORIZED", Message: resp.Message}}
+	}
+	c.token = resp.Token
+	return &resp, nil
+}
+
+// do performs a request and decodes the envelope's data field into out (may be nil).
+// It returns the envelope message for endpoints that only report a message.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (string, error) {
+	raw, status, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return "", err
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return "", &APIError{StatusCode: status, ErrorDetail: api.ErrorDetail{Message: strings.TrimSpace(string(raw))}}
+	}
+	if !env.Success || status >= 400 {
+		detail := env.Error
+		if detail.Message == "" {
+			detail.Message = env.Message
+		}
+		return "", &APIError{StatusCode: status, ErrorDetail: detail}
+	}
+	if out != nil && len(env.Data) > 0 && string(env.Data) != "null" {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return "", fmt.Errorf("decode %s %s: %w", method, path, err)
+		}
+	}
+	return env.Message, nil
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}) ([]byte, int, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("encode request body: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return raw, resp.StatusCode, nil
+}
+
+// setInt adds an integer query parameter when v is positive.
+func setInt(q url.Values, key string, v int) {
+	if v > 0 {
+		q.Set(key, fmt.Sprintf("%d", v))
+	}
+}
+
+// setStr adds a string query parameter when v is non-empty.
+func setStr(q url.Values, key, v string) {
+	if v != "" {
+		q.Set(key, v)
+	}
+}
+
+// queryOf encodes the non-zero fields of a params struct under their form
+// tags, the same tags the handler binds the query with.
+func queryOf(params interface{}) url.Values {
+	q := url.Values{}
+	v := reflect.ValueOf(params)
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("form")
+		if f := v.Field(i); key != "" && !f.IsZero() {
+			q.Set(key, fmt.Sprint(f.Interface()))
+		}
+	}
+	return q
+}
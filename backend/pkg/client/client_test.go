@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+func TestClientDecodesEnvelopeAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "k" {
+			t.Fatalf("missing api key header")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/dashboard/top-users":
+			if r.URL.Query().Get("limit") != "5" {
+				t.Fatalf("unexpected query: %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"data":    []map[string]interface{}{{"user_id": 1, "username": "alice"}},
+			})
+		case "/api/users":
+			if got := r.URL.Query(); got.Get("activity") != "never" || got.Get("page") != "2" || got.Has("order_by") {
+				t.Fatalf("unexpected query: %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"data":    map[string]interface{}{"items": []map[string]interface{}{{"id": 3, "username": "bob"}}, "total": 1},
+			})
+		case "/api/users/9":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   map[string]interface{}{"code": "CONFIRM_TEXT_REQUIRED", "message": "confirm"},
+			})
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithAPIKey("k"))
+	users, err := c.Dashboard.TopUsers(context.Background(), "7d", 5)
+	if err != nil {
+		t.Fatalf("TopUsers failed: %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "alice" {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+
+	list, err := c.Users.List(context.Background(), api.ListUsersParams{Page: 2, ActivityFilter: "never"})
+	if err != nil || list.Total != 1 || list.Items[0].ID != 3 || list.Items[0].Username != "bob" {
+		t.Fatalf("unexpected list: %+v %v", list, err)
+	}
+
+	_, err = c.Users.Delete(context.Background(), 9, false)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "CONFIRM_TEXT_REQUIRED" {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// DashboardAPI wraps /api/dashboard endpoints.
+type DashboardAPI struct{ c *Client }
+
+// Overview calls GET /api/dashboard/overview.
+func (a *DashboardAPI) Overview(ctx context.Context, period string) (*api.SystemOverview, error) {
+	q := url.Values{}
+	setStr(q, "period", period)
+	var out api.SystemOverview
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/overview", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Usage calls GET /api/dashboard/usage.
+func (a *DashboardAPI) Usage(ctx context.Context, period string) (*api.UsageStatistics, error) {
+	q := url.Values{}
+	setStr(q, "period", period)
+	var out api.UsageStatistics
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/usage", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Models calls GET /api/dashboard/models.
+func (a *DashboardAPI) Models(ctx context.Context, period string, limit int) ([]api.ModelUsage, error) {
+	q := url.Values{}
+	setStr(q, "period", period)
+	setInt(q, "limit", limit)
+	var out []api.ModelUsage
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/models", q, nil, &out)
+	return out, err
+}
+
+// DailyTrends calls GET /api/dashboard/trends/daily.
+func (a *DashboardAPI) DailyTrends(ctx context.Context, days int) ([]api.DailyTrend, error) {
+	q := url.Values{}
+	setInt(q, "days", days)
+	var out []api.DailyTrend
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/trends/daily", q, nil, &out)
+	return out, err
+}
+
+// HourlyTrends calls GET /api/dashboard/trends/hourly.
+func (a *DashboardAPI) HourlyTrends(ctx context.Context, hours int) ([]api.HourlyTrend, error) {
+	q := url.Values{}
+	setInt(q, "hours", hours)
+	var out []api.HourlyTrend
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/trends/hourly", q, nil, &out)
+	return out, err
+}
+
+// TopUsers calls GET /api/dashboard/top-users.
+func (a *DashboardAPI) TopUsers(ctx context.Context, period string, limit int) ([]api.TopUser, error) {
+	q := url.Values{}
+	setStr(q, "period", period)
+	setInt(q, "limit", limit)
+	var out []api.TopUser
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/top-users", q, nil, &out)
+	return out, err
+}
+
+// Channels calls GET /api/dashboard/channels.
+func (a *DashboardAPI) Channels(ctx context.Context) ([]api.ChannelStatus, error) {
+	var out []api.ChannelStatus
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/channels", nil, nil, &out)
+	return out, err
+}
+
+// Fleet calls GET /api/dashboard/fleet (aggregated across all registered instances).
+func (a *DashboardAPI) Fleet(ctx context.Context, period string) (*api.FleetOverview, error) {
+	q := url.Values{}
+	setStr(q, "period", period)
+	var out api.FleetOverview
+	_, err := a.c.do(ctx, http.MethodGet, "/api/dashboard/fleet", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// InvalidateCache calls POST /api/dashboard/cache/invalidate.
+func (a *DashboardAPI) InvalidateCache(ctx context.Context) error {
+	_, err := a.c.do(ctx, http.MethodPost, "/api/dashboard/cache/invalidate", nil, nil, nil)
+	return err
+}
@@ -0,0 +1,93 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/new-api-tools/backend/pkg/api"
+	"github.com/new-api-tools/backend/pkg/client"
+)
+
+// TestExternalCallerBuildsRequests uses the SDK the way another module has to:
+// only pkg/client and pkg/api identifiers, no internal packages.
+func TestExternalCallerBuildsRequests(t *testing.T) {
+	bodies := map[string]map[string]interface{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies[r.Method+" "+r.URL.Path] = body
+		var data interface{}
+		switch r.URL.Path {
+		case "/api/users":
+			if r.URL.Query().Get("group") != "vip" || r.URL.Query().Get("order_dir") != "ASC" {
+				t.Errorf("unexpected query: %s", r.URL.RawQuery)
+			}
+			data = api.UserList{Items: []api.UserListItem{{ID: 7, Username: "carol"}}, Total: 1}
+		case "/api/users/batch-delete":
+			data = api.BatchDeleteResult{Count: 2, AffectedCount: 2, HardDelete: true}
+		case "/api/ai-ban/assess":
+			data = api.Assessment{UserID: 7, RiskScore: 80, RiskLevel: "high"}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.WithAPIKey("k"))
+	ctx := context.Background()
+
+	list, err := c.Users.List(ctx, api.ListUsersParams{GroupFilter: "vip", OrderDir: "ASC"})
+	if err != nil || list.Items[0].Username != "carol" {
+		t.Fatalf("List: %+v %v", list, err)
+	}
+	if err := c.Users.Ban(ctx, 7, api.BanUserRequest{Reason: "abuse", DisableTokens: true}); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	result, err := c.Users.BatchDelete(ctx, api.BatchDeleteRequest{
+		ActivityLevel: "never",
+		HardDelete:    true,
+		ConfirmText:   api.ConfirmTextHardDelete,
+	})
+	if err != nil || result.AffectedCount != 2 {
+		t.Fatalf("BatchDelete: %+v %v", result, err)
+	}
+	assessment, err := c.AIBan.Assess(ctx, api.AssessRequest{UserID: 7, Window: "24h"})
+	if err != nil || assessment.RiskLevel != "high" {
+		t.Fatalf("Assess: %+v %v", assessment, err)
+	}
+
+	if got := bodies["POST /api/users/7/ban"]; got["reason"] != "abuse" || got["disable_tokens"] != true {
+		t.Fatalf("ban body: %v", got)
+	}
+	if got := bodies["POST /api/users/batch-delete"]; got["confirm_text"] != api.ConfirmTextHardDelete || got["dry_run"] != false {
+		t.Fatalf("batch delete body: %v", got)
+	}
+	if got := bodies["POST /api/ai-ban/assess"]; got["user_id"] != float64(7) || got["window"] != "24h" {
+		t.Fatalf("assess body: %v", got)
+	}
+}
+
+// TestPublicPackagesAvoidInternalImports keeps the SDK importable from other
+// modules, which cannot import anything below internal/
+func TestPublicPackagesAvoidInternalImports(t *testing.T) {
+	files, _ := filepath.Glob("*.go")
+	more, _ := filepath.Glob("../api/*.go")
+	for _, name := range append(files, more...) {
+		f, err := parser.ParseFile(token.NewFileSet(), name, nil, parser.ImportsOnly)
+		if err != nil {
+			t.Fatalf("parse %s: %v", name, err)
+		}
+		for _, imp := range f.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); strings.Contains(path, "/internal/") {
+				t.Errorf("%s imports %s", filepath.Clean(name), path)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// RiskAPI wraps /api/risk endpoints.
+type RiskAPI struct{ c *Client }
+
+// Leaderboards calls GET /api/risk/leaderboards. sortBy is requests|quota|failure_rate.
+func (a *RiskAPI) Leaderboards(ctx context.Context, windows []string, limit int, sortBy string) (*api.Leaderboards, error) {
+	q := url.Values{}
+	if len(windows) > 0 {
+		q.Set("windows", strings.Join(windows, ","))
+	}
+	setInt(q, "limit", limit)
+	setStr(q, "sort_by", sortBy)
+	var out api.Leaderboards
+	_, err := a.c.do(ctx, http.MethodGet, "/api/risk/leaderboards", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UserAnalysis calls GET /api/risk/users/:user_id/analysis.
+func (a *RiskAPI) UserAnalysis(ctx context.Context, userID int64, window string) (*api.UserAnalysis, error) {
+	q := url.Values{}
+	setStr(q, "window", window)
+	var out api.UserAnalysis
+	_, err := a.c.do(ctx, http.MethodGet, fmt.Sprintf("/api/risk/users/%d/analysis", userID), q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TokenRotation calls GET /api/risk/token-rotation.
+func (a *RiskAPI) TokenRotation(ctx context.Context, window string, minTokens, limit int) (*api.TokenRotationList, error) {
+	q := url.Values{}
+	setStr(q, "window", window)
+	setInt(q, "min_tokens", minTokens)
+	setInt(q, "limit", limit)
+	var out api.TokenRotationList
+	_, err := a.c.do(ctx, http.MethodGet, "/api/risk/token-rotation", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AffiliatedAccounts calls GET /api/risk/affiliated-accounts.
+func (a *RiskAPI) AffiliatedAccounts(ctx context.Context, minInvited, limit int) (*api.AffiliatedAccountList, error) {
+	q := url.Values{}
+	setInt(q, "min_invited", minInvited)
+	setInt(q, "limit", limit)
+	var out api.AffiliatedAccountList
+	_, err := a.c.do(ctx, http.MethodGet, "/api/risk/affiliated-accounts", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SameIPRegistrations calls GET /api/risk/same-ip-registrations.
+func (a *RiskAPI) SameIPRegistrations(ctx context.Context, window string, minUsers, limit int) (*api.SameIPRegistrationList, error) {
+	q := url.Values{}
+	setStr(q, "window", window)
+	setInt(q, "min_users", minUsers)
+	setInt(q, "limit", limit)
+	var out api.SameIPRegistrationList
+	_, err := a.c.do(ctx, http.MethodGet, "/api/risk/same-ip-registrations", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
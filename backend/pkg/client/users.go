@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/new-api-tools/backend/pkg/api"
+)
+
+// 删除确认文本，与服务端共用同一组常量。
+const (
+	ConfirmTextSoftDelete = api.ConfirmTextSoftDelete
+	ConfirmTextHardDelete = api.ConfirmTextHardDelete
+)
+
+// UsersAPI wraps /api/users endpoints.
+type UsersAPI struct{ c *Client }
+
+// List calls GET /api/users; zero fields of p are left to the server defaults.
+func (a *UsersAPI) List(ctx context.Context, p api.ListUsersParams) (*api.UserList, error) {
+	var out api.UserList
+	_, err := a.c.do(ctx, http.MethodGet, "/api/users", queryOf(p), nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ActivityStats calls GET /api/users/activity-stats.
+func (a *UsersAPI) ActivityStats(ctx context.Context, quick bool) (*api.ActivityStats, error) {
+	q := url.Values{}
+	if quick {
+		q.Set("quick", "true")
+	}
+	var out api.ActivityStats
+	_, err := a.c.do(ctx, http.MethodGet, "/api/users/activity-stats", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Banned calls GET /api/users/banned.
+func (a *UsersAPI) Banned(ctx context.Context, page, pageSize int, search string) (*api.BannedUserList, error) {
+	q := url.Values{}
+	setInt(q, "page", page)
+	setInt(q, "page_size", pageSize)
+	setStr(q, "search", search)
+	var out api.BannedUserList
+	_, err := a.c.do(ctx, http.MethodGet, "/api/users/banned", q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Invited calls GET /api/users/:user_id/invited.
+func (a *UsersAPI) Invited(ctx context.Context, userID int64, page, pageSize int) (*api.InvitedUsers, error) {
+	q := url.Values{}
+	setInt(q, "page", page)
+	setInt(q, "page_size", pageSize)
+	var out api.InvitedUsers
+	_, err := a.c.do(ctx, http.MethodGet, fmt.Sprintf("/api/users/%d/invited", userID), q, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Ban calls POST /api/users/:user_id/ban.
+func (a *UsersAPI) Ban(ctx context.Context, userID int64, req api.BanUserRequest) error {
+	_, err := a.c.do(ctx, http.MethodPost, fmt.Sprintf("/api/users/%d/ban", userID), nil, req, nil)
+	return err
+}
+
+// Unban calls POST /api/users/:user_id/unban.
+func (a *UsersAPI) Unban(ctx context.Context, userID int64, req api.UnbanUserRequest) error {
+	_, err := a.c.do(ctx, http.MethodPost, fmt.Sprintf("/api/users/%d/unban", userID), nil, req, nil)
+	return err
+}
+
+// Delete calls DELETE /api/users/:user_id with the matching confirm text.
+func (a *UsersAPI) Delete(ctx context.Context, userID int64, hard bool) (*api.AffectedResult, error) {
+	q := url.Values{}
+	body := api.DeleteUserRequest{ConfirmText: ConfirmTextSoftDelete}
+	if hard {
+		q.Set("hard_delete", "true")
+		body.ConfirmText = ConfirmTextHardDelete
+	}
+	var out api.AffectedResult
+	_, err := a.c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/users/%d", userID), q, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BatchDelete calls POST /api/users/batch-delete.
+func (a *UsersAPI) BatchDelete(ctx context.Context, req api.BatchDeleteRequest) (*api.BatchDeleteResult, error) {
+	var out api.BatchDeleteResult
+	_, err := a.c.do(ctx, http.MethodPost, "/api/users/batch-delete", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DisableToken calls POST /api/users/tokens/:token_id/disable.
+func (a *UsersAPI) DisableToken(ctx context.Context, tokenID int64) error {
+	_, err := a.c.do(ctx, http.MethodPost, fmt.Sprintf("/api/users/tokens/%d/disable", tokenID), nil, nil, nil)
+	return err
+}
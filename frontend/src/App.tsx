@@ -2,6 +2,7 @@ import { useState, useEffect, lazy, Suspense } from 'react'
 import { Login, Layout, TabType, Dashboard } from './components'
 import { useAuth } from './contexts/AuthContext'
 import { WarmupScreen } from './components/WarmupScreen'
+import { appPath, currentRoutePath } from './lib/api'
 
 // 懒加载非首屏 tab — 显著降低初始包体积
 const TopUps = lazy(() => import('./components/TopUps').then(m => ({ default: m.TopUps })))
@@ -26,11 +27,11 @@ const legacyRedirects: Record<string, string> = {
 
 // Get initial tab from URL pathname (supports sub-routes like /risk/ip)
 const getInitialTab = (): TabType => {
-  const pathname = window.location.pathname.slice(1) // Remove leading /
+  const pathname = currentRoutePath().slice(1) // Remove leading /
   const mainPath = pathname.split('/')[0] // Get first segment for main tab
 
   if (legacyRedirects[mainPath]) {
-    window.history.replaceState(null, '', legacyRedirects[mainPath])
+    window.history.replaceState(null, '', appPath(legacyRedirects[mainPath]))
     return 'redemptions'
   }
 
@@ -42,14 +43,14 @@ const getInitialTab = (): TabType => {
   // 处理 #risk/ip 等格式
   const hashMain = hash.split('/')[0].replace('risk-', 'risk/')
   if (legacyRedirects[hashMain]) {
-    window.history.replaceState(null, '', legacyRedirects[hashMain])
+    window.history.replaceState(null, '', appPath(legacyRedirects[hashMain]))
     return 'redemptions'
   }
   if (validTabs.includes(hashMain as TabType)) {
     // 重定向到新路由
     const subPath = hash.includes('/') ? hash.split('/').slice(1).join('/') : ''
     const newPath = subPath ? `/${hashMain}/${subPath}` : `/${hashMain}`
-    window.history.replaceState(null, '', newPath)
+    window.history.replaceState(null, '', appPath(newPath))
     return hashMain as TabType
   }
   return 'dashboard'
@@ -103,17 +104,17 @@ function App() {
   // Sync tab with URL pathname (History API)
   // Only update if main path segment changes, preserve sub-routes
   useEffect(() => {
-    const pathname = window.location.pathname.slice(1)
+    const pathname = currentRoutePath().slice(1)
     const currentMainPath = pathname.split('/')[0]
     if (currentMainPath !== activeTab) {
-      window.history.pushState(null, '', `/${activeTab}`)
+      window.history.pushState(null, '', appPath(`/${activeTab}`))
     }
   }, [activeTab])
 
   // Listen for popstate (browser back/forward)
   useEffect(() => {
     const handlePopState = () => {
-      const pathname = window.location.pathname.slice(1)
+      const pathname = currentRoutePath().slice(1)
       const mainPath = pathname.split('/')[0] // Extract main tab from path
       if (validTabs.includes(mainPath as TabType)) {
         setActiveTab(mainPath as TabType)
@@ -72,6 +72,7 @@ interface Config {
   auto_scan_enabled: boolean
   whitelist_ids: number[]
   last_scan_time: number
+  version?: number
 }
 
 interface Stats {
@@ -81,6 +82,12 @@ interface Stats {
   next_scan_time: number
   enabled: boolean
   auto_scan_enabled: boolean
+  last_run?: {
+    trigger: string
+    success: boolean
+    message?: string
+    stats?: { total: number; assigned: number; skipped: number; errors: number }
+  } | null
 }
 
 // Source labels
@@ -256,12 +263,15 @@ export function AutoGroup() {
       const response = await fetch(`${apiUrl}/api/auto-group/config`, {
         method: 'POST',
         headers: getAuthHeaders(),
-        body: JSON.stringify(updates),
+        body: JSON.stringify({ ...updates, version: config?.version }),
       })
       const data = await response.json()
       if (data.success) {
         setConfig(data.data)
         showToast('success', '配置已保存')
+      } else if (response.status === 409) {
+        showToast('error', '配置已被其他管理员修改，已加载最新配置，请重新确认后保存')
+        fetchConfig()
       } else {
         showToast('error', data.message || '保存失败')
       }
@@ -399,6 +409,11 @@ export function AutoGroup() {
         <StatCard
           title="上次扫描"
           value={stats?.last_scan_time ? formatTime(stats.last_scan_time) : '-'}
+          subValue={stats?.last_run
+            ? `${stats.last_run.trigger === 'schedule' ? '定时' : '手动'} · ${stats.last_run.success
+              ? `分配 ${stats.last_run.stats?.assigned ?? 0} / ${stats.last_run.stats?.total ?? 0}`
+              : `失败：${stats.last_run.message || '未知错误'}`}`
+            : undefined}
           icon={Clock}
           color="purple"
         />
@@ -474,7 +489,13 @@ export function AutoGroup() {
                   >
                     <option value="simple">简单模式 - 所有用户分配到同一分组</option>
                     <option value="by_source">按来源分组 - 根据注册来源分配到不同分组</option>
+                    <option value="by_rules">按条件规则 - 根据信任等级、账号天数、已用额度分配</option>
                   </Select>
+                  {config.mode === 'by_rules' && (
+                    <p className="text-sm text-muted-foreground">
+                      条件规则通过 /api/auto-group/rules 编辑，按顺序匹配，首条命中的规则决定目标分组；可先试运行扫描预览结果
+                    </p>
+                  )}
                 </div>
 
                 {/* Simple Mode: Target Group */}
@@ -778,13 +799,13 @@ export function AutoGroup() {
                       </TableCell>
                       <TableCell>{renderSourceBadge(log.source)}</TableCell>
                       <TableCell>
-                        <Badge variant={log.action === 'assign' ? 'default' : 'secondary'}>
-                          {log.action === 'assign' ? '分配' : '恢复'}
+                        <Badge variant={log.action === 'assign' ? 'default' : log.action === 'demote' ? 'destructive' : 'secondary'}>
+                          {log.action === 'assign' ? '分配' : log.action === 'demote' ? '降级' : '恢复'}
                         </Badge>
                       </TableCell>
                       <TableCell>{log.operator}</TableCell>
                       <TableCell>
-                        {log.action === 'assign' && (
+                        {(log.action === 'assign' || log.action === 'demote') && (
                           <Button
                             variant="ghost"
                             size="sm"
@@ -4,7 +4,7 @@ import { Button } from './ui/button'
 import { Badge } from './ui/badge'
 import { cn } from '../lib/utils'
 import { useAuth } from '../contexts/AuthContext'
-import { apiFetch, createAuthHeaders } from '../lib/api'
+import { apiFetch, appPath, createAuthHeaders } from '../lib/api'
 
 export type TabType = 'dashboard' | 'risk' | 'abuse-broadcast' | 'ip-analysis' | 'redemptions' | 'topups' | 'analytics' | 'model-status' | 'users' | 'auto-group' | 'tokens'
 
@@ -180,7 +180,7 @@ export function Layout({ children, activeTab, onTabChange, onLogout }: LayoutPro
                   variant="ghost"
                   size="sm"
                   onClick={() => {
-                    window.history.pushState(null, '', '/abuse-broadcast?view=inbox')
+                    window.history.pushState(null, '', appPath('/abuse-broadcast?view=inbox'))
                     window.dispatchEvent(new CustomEvent('abuse-broadcast-open-inbox'))
                     onTabChange('abuse-broadcast')
                   }}
@@ -864,6 +864,14 @@ function getBadgeColor(status: 'green' | 'yellow' | 'red', styles: typeof themeS
 // Main Component
 // ============================================================================
 
+interface EmbedThemeProfile {
+  profile: string
+  theme: string
+  dark_mode: string
+  font: string
+  colors: { primary: string; background: string; text: string; accent: string }
+}
+
 interface ModelStatusEmbedProps {
   refreshInterval?: number
   defaultTheme?: ThemeId
@@ -885,6 +893,8 @@ export function ModelStatusEmbed({
   const [tokenGroups, setTokenGroups] = useState<EmbedTokenGroup[]>([])
   const [groupFilter, setGroupFilter] = useState('all')
   const [siteTitle, setSiteTitle] = useState('')
+  // 命名嵌入主题 (?profile=) 的字体 / 颜色覆盖
+  const [profileOverrides, setProfileOverrides] = useState<EmbedThemeProfile | null>(null)
 
   // Tooltip state - lifted to parent to avoid z-index/transform issues
   const [hoveredSlot, setHoveredSlot] = useState<SlotStatus | null>(null)
@@ -892,6 +902,12 @@ export function ModelStatusEmbed({
 
   const apiUrl = import.meta.env.VITE_API_URL || ''
   const styles = themeStyles[theme] || themeStyles.daylight
+  // 后台设置了嵌入访问令牌时，嵌入地址需带 ?token=，这里转发给数据接口
+  const embedToken = new URLSearchParams(window.location.search).get('token') || ''
+  const embedHeaders = useMemo<Record<string, string>>(
+    () => (embedToken ? { 'X-Embed-Token': embedToken } : {}),
+    [embedToken]
+  )
 
   // Parse URL params for theme override
   useEffect(() => {
@@ -905,7 +921,9 @@ export function ModelStatusEmbed({
   // Load config from backend
   const loadConfig = useCallback(async () => {
     try {
-      const response = await fetch(`${apiUrl}/api/model-status/embed/config/selected`)
+      const profile = new URLSearchParams(window.location.search).get('profile')
+      const configUrl = `${apiUrl}/api/model-status/embed/config/selected${profile ? `?profile=${encodeURIComponent(profile)}` : ''}`
+      const response = await fetch(configUrl)
       const data = await response.json()
       if (data.success) {
         if (Array.isArray(data.data) && data.data.length > 0) {
@@ -926,6 +944,9 @@ export function ModelStatusEmbed({
           const validTheme = THEMES.find(t => t.id === data.theme) ? data.theme : 'daylight'
           setTheme(validTheme as ThemeId)
         }
+        if (data.theme_profile?.profile) {
+          setProfileOverrides(data.theme_profile as EmbedThemeProfile)
+        }
         // Load custom groups
         if (data.custom_groups && Array.isArray(data.custom_groups)) {
           setCustomGroups(data.custom_groups as EmbedCustomGroup[])
@@ -936,7 +957,7 @@ export function ModelStatusEmbed({
         }
         // 加载令牌分组
         try {
-          const tgResponse = await fetch(`${apiUrl}/api/model-status/embed/token-groups`)
+          const tgResponse = await fetch(`${apiUrl}/api/model-status/embed/token-groups`, { headers: embedHeaders })
           const tgData = await tgResponse.json()
           if (tgData.success && Array.isArray(tgData.data)) {
             setTokenGroups(tgData.data)
@@ -950,7 +971,7 @@ export function ModelStatusEmbed({
       console.error('Failed to load config from backend:', error)
     }
     return []
-  }, [apiUrl])
+  }, [apiUrl, embedHeaders])
 
   useEffect(() => {
     loadConfig()
@@ -978,7 +999,7 @@ export function ModelStatusEmbed({
     try {
       const response = await fetch(`${apiUrl}/api/model-status/embed/status/batch?window=${timeWindow}`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', ...embedHeaders },
         body: JSON.stringify(fetchSet),
       })
       const data = await response.json()
@@ -991,7 +1012,7 @@ export function ModelStatusEmbed({
     } finally {
       setLoading(false)
     }
-  }, [apiUrl, selectedModels, timeWindow, groupFilter, tokenGroups])
+  }, [apiUrl, embedHeaders, selectedModels, timeWindow, groupFilter, tokenGroups])
 
   useEffect(() => {
     fetchModelStatuses()
@@ -1049,12 +1070,21 @@ export function ModelStatusEmbed({
     setHoveredSlot(slot)
   }
 
+  const containerStyle: React.CSSProperties | undefined = (() => {
+    const style: React.CSSProperties = {}
+    if (styles.background) style.background = styles.background.replace(/\s+/g, ' ')
+    if (profileOverrides?.colors.background) style.background = profileOverrides.colors.background
+    if (profileOverrides?.colors.text) style.color = profileOverrides.colors.text
+    if (profileOverrides?.font) style.fontFamily = profileOverrides.font
+    return Object.keys(style).length > 0 ? style : undefined
+  })()
+
   // Loading state
   if (loading && modelStatuses.length === 0) {
     return (
       <div
         className={cn("min-h-screen flex items-center justify-center", styles.container)}
-        style={styles.background ? { background: styles.background.replace(/\s+/g, ' ') } : undefined}
+        style={containerStyle}
       >
         <Loader2 className={cn("h-8 w-8 animate-spin", styles.loader)} />
       </div>
@@ -1064,7 +1094,7 @@ export function ModelStatusEmbed({
   return (
     <div
       className={styles.container}
-      style={styles.background ? { background: styles.background.replace(/\s+/g, ' ') } : undefined}
+      style={containerStyle}
     >
       {/* Neon theme scan line effect */}
       {theme === 'neon' && (
@@ -10,6 +10,7 @@ import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from '.
 import { Select } from './ui/select'
 import { Input } from './ui/input'
 import { cn, isCloudflareIp } from '../lib/utils'
+import { appPath } from '../lib/api'
 import { UserAnalysisDialog, BAN_REASONS, UNBAN_REASONS, RISK_FLAG_LABELS } from './UserAnalysisDialog'
 
 type WindowKey = '1h' | '3h' | '6h' | '12h' | '24h' | '3d' | '7d'
@@ -219,7 +220,7 @@ function getInitialView(): 'leaderboards' | 'banned_list' | 'ip_monitoring' | 'a
   if (hashMatch && hashMatch[1]) {
     const view = VIEW_PATH_MAP[hashMatch[1]] || 'leaderboards'
     const subPath = PATH_VIEW_MAP[view]
-    const newPath = subPath ? `/risk/${subPath}` : '/risk'
+    const newPath = appPath(subPath ? `/risk/${subPath}` : '/risk')
     window.history.replaceState(null, '', newPath)
     return view
   }
@@ -378,6 +379,7 @@ export function RealtimeRanking() {
     blacklist_ips?: string[]
     excluded_models?: string[]
     excluded_groups?: string[]
+    version?: number
     api_health?: {
       suspended: boolean
       consecutive_failures: number
@@ -1096,6 +1098,7 @@ export function RealtimeRanking() {
           enabled: aiConfigEdit.enabled,
           dry_run: aiConfigEdit.dry_run,
           scan_interval_minutes: aiConfigEdit.scan_interval_minutes,
+          version: aiConfig?.version,
         }),
       })
       const res = await response.json()
@@ -1103,6 +1106,9 @@ export function RealtimeRanking() {
         showToast('success', '配置已保存')
         setAiConfig(res.data)
         // 移除自动折叠逻辑，保持展开状态
+      } else if (response.status === 409) {
+        showToast('error', '配置已被其他管理员修改，已加载最新配置，请重新确认后保存')
+        fetchAiConfig()
       } else {
         showToast('error', res.message || '保存失败')
       }
@@ -1146,6 +1152,7 @@ export function RealtimeRanking() {
           blacklist_ips: blacklistIps,
           excluded_models: excludedModelsInput,
           excluded_groups: excludedGroupsInput,
+          version: aiConfig?.version,
         }),
       })
       const res = await response.json()
@@ -1153,6 +1160,9 @@ export function RealtimeRanking() {
         showToast('success', '配置已保存')
         setAiConfig(res.data)
         setPromptDialogOpen(false)
+      } else if (response.status === 409) {
+        showToast('error', '配置已被其他管理员修改，已加载最新配置，请重新确认后保存')
+        fetchAiConfig()
       } else {
         showToast('error', res.detail || res.message || '保存失败')
       }
@@ -4685,6 +4695,12 @@ export function RealtimeRanking() {
                     <span>{'{blacklist_ips}'} - 系统黑名单IP</span>
                     <span>{'{user_whitelisted_ips}'} - 用户IP中的白名单</span>
                     <span>{'{user_blacklisted_ips}'} - 用户IP中的黑名单</span>
+                    <span>{'{ip_types}'} - IP类型占比</span>
+                    <span>{'{datacenter_ips}'} - 机房IP</span>
+                    <span>{'{vpn_ips}'} - VPN/代理IP</span>
+                    <span>{'{tor_ips}'} - Tor出口IP</span>
+                    <span>{'{oauth_accounts}'} - 关联 GitHub/Discord 账号</span>
+                    <span>{'{oauth_account_age_days}'} - 最新账号注册天数</span>
                   </div>
                 </div>
               </div>
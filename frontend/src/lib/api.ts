@@ -50,3 +50,27 @@ export function createAuthHeaders(token: string | null): HeadersInit {
     ...(token ? { 'Authorization': `Bearer ${token}` } : {}),
   }
 }
+
+/**
+ * Deployment sub-path (vite `base`, taken from BASE_PATH at build time),
+ * without trailing slash. Empty when served from the root.
+ */
+export const basePath = import.meta.env.BASE_URL.replace(/\/$/, '')
+
+/**
+ * Prefix an app-absolute path ("/risk", "/embed.html") with the base path.
+ */
+export function appPath(path: string): string {
+  return `${basePath}${path}`
+}
+
+/**
+ * Current location pathname relative to the base path ("/risk/ip").
+ */
+export function currentRoutePath(): string {
+  const pathname = window.location.pathname
+  if (basePath && pathname.startsWith(basePath)) {
+    return pathname.slice(basePath.length) || '/'
+  }
+  return pathname
+}
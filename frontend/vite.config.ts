@@ -2,8 +2,18 @@ import { defineConfig } from 'vite'
 import react from '@vitejs/plugin-react'
 import path from 'path'
 
+// Sub-path deployment: BASE_PATH=/tools builds assets under /tools/ and
+// points API calls at /tools/api (must match the backend's BASE_PATH)
+const basePath = (process.env.BASE_PATH || '').replace(/^\/+|\/+$/g, '')
+const base = basePath ? `/${basePath}/` : '/'
+
 // https://vitejs.dev/config/
 export default defineConfig({
+  base,
+  // API calls use `${VITE_API_URL}/api/...`; default it to the base path
+  define: basePath && !process.env.VITE_API_URL
+    ? { 'import.meta.env.VITE_API_URL': JSON.stringify(`/${basePath}`) }
+    : {},
   plugins: [react()],
   resolve: {
     alias: {
@@ -32,7 +42,7 @@ export default defineConfig({
   server: {
     port: 3000,
     proxy: {
-      '/api': {
+      [`${base}api`]: {
         target: 'http://localhost:8000',
         changeOrigin: true,
       },